@@ -0,0 +1,51 @@
+"""Smoke test for the Python client generated from openapi.json.
+
+Run with `make smoke-python` against a server on MEZZANINE_URL
+(default http://localhost:8080). It writes one cell to the column
+"smoke" and reads it back through the cells and shards APIs.
+"""
+
+import os
+import uuid
+
+import mezzanine_client as mz
+
+
+def main() -> None:
+    config = mz.Configuration(host=os.environ.get("MEZZANINE_URL", "http://localhost:8080"))
+    with mz.ApiClient(config) as client:
+        cells = mz.CellsApi(client)
+        shards = mz.ShardsApi(client)
+
+        num_shards = shards.get_shard_count().num_shards
+        row_key = str(uuid.uuid4())
+        written = cells.write_cell(
+            mz.WriteCellBody(row_key=row_key, column_name="smoke", ref_key=1, body={"ok": True})
+        )
+
+        latest = cells.get_cell_latest(row_key=row_key, column_name="smoke")
+        assert latest.added_id == written.added_id, (latest, written)
+
+        placement = shards.get_shard_for_key(row_key=row_key)
+        assert 0 <= placement.shard_id < num_shards, placement
+
+        page = cells.partition_read(
+            partition_number=placement.shard_id,
+            read_type=2,
+            added_id=written.added_id - 1,
+            limit=10,
+        )
+        assert any(c.added_id == written.added_id for c in page), page
+
+        try:
+            cells.get_cell_latest(row_key=row_key, column_name="smoke_missing")
+        except mz.ApiException as e:
+            assert e.status == 404, e
+        else:
+            raise AssertionError("reading a missing cell did not fail")
+
+    print("python client smoke test passed")
+
+
+if __name__ == "__main__":
+    main()
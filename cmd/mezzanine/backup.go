@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/ryanbastic/go-mezzanine/internal/backup"
+	"github.com/ryanbastic/go-mezzanine/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// backupOptions holds the flags of the backup command.
+type backupOptions struct {
+	out    string
+	pgDump string
+}
+
+// backupCommand parses the backup flags and runs runBackup.
+func backupCommand() *cobra.Command {
+	var o backupOptions
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "pg_dump every backend with a consistent added_id marker",
+		Args:  cobra.NoArgs,
+		Run:   run(func() int { return runBackup(o) }),
+	}
+	fs := cmd.Flags()
+	fs.StringVar(&o.out, "out", "", "directory to write the backup into (required)")
+	fs.StringVar(&o.pgDump, "pg-dump", "pg_dump", "path to the pg_dump binary")
+	cmd.MarkFlagRequired("out")
+	return cmd
+}
+
+// runBackup records the current max added_id of every shard, then pg_dumps
+// each backend's cell tables (and the plugins table, from the metadata
+// database or the first backend) into a directory with a
+// manifest. Index tables are not dumped; restore rebuilds them.
+func runBackup(o backupOptions) int {
+	cfg := config.Load()
+	logger := newLogger(cfg.LogLevel)
+	ctx := context.Background()
+
+	shardCfg, err := config.LoadShardConfig(cfg.ShardConfigPath, cfg.NumShards)
+	if err != nil {
+		logger.Error("failed to load shard config", "error", err)
+		return 1
+	}
+	if err := os.MkdirAll(o.out, 0o755); err != nil {
+		logger.Error("failed to create backup directory", "error", err)
+		return 1
+	}
+	pools, err := openBackends(ctx, cfg, shardCfg, logger)
+	if err != nil {
+		logger.Error("failed to open backends", "error", err)
+		return 1
+	}
+	defer closeBackends(pools, logger)
+
+	// Record every marker before any dump starts: each dump is a snapshot
+	// taken at or after this point, so it contains everything up to the marker.
+	manifest := backup.NewManifest(cfg.NumShards)
+	manifest.ShardHash = shardCfg.Hash
+	for _, b := range shardCfg.Backends {
+		markers, err := backup.Markers(ctx, pools[b.Name], b.ShardStart, b.ShardEnd)
+		if err != nil {
+			logger.Error("failed to read consistency markers", "backend", b.Name, "error", err)
+			return 1
+		}
+		for shardID, marker := range markers {
+			manifest.Markers[shardID] = marker
+		}
+	}
+
+	for i, b := range shardCfg.Backends {
+		dump := backup.BackendDump{
+			Name:       b.Name,
+			ShardStart: b.ShardStart,
+			ShardEnd:   b.ShardEnd,
+			File:       b.Name + ".dump",
+			Plugins:    i == 0 && shardCfg.Metadata == nil,
+		}
+		dbURL, err := resolveBackendURL(ctx, b)
+		if err != nil {
+			logger.Error("failed to resolve database URL", "error", err)
+			return 1
+		}
+		logger.Info("dumping backend", "backend", b.Name, "shards", []int{b.ShardStart, b.ShardEnd})
+		tables := backup.Tables(b.ShardStart, b.ShardEnd, dump.Plugins)
+		if err := backup.Run(ctx, o.pgDump, dbURL, backup.DumpArgs(filepath.Join(o.out, dump.File), tables)); err != nil {
+			logger.Error("failed to dump backend", "backend", b.Name, "error", err)
+			return 1
+		}
+		manifest.Backends = append(manifest.Backends, dump)
+	}
+
+	if shardCfg.Metadata != nil {
+		dump := &backup.MetadataDump{File: config.MetadataBackend + ".dump"}
+		dbURL, err := resolveBackendURL(ctx, shardCfg.Metadata.Backend())
+		if err != nil {
+			logger.Error("failed to resolve database URL", "error", err)
+			return 1
+		}
+		logger.Info("dumping metadata database")
+		if err := backup.Run(ctx, o.pgDump, dbURL, backup.DumpArgs(filepath.Join(o.out, dump.File), backup.Tables(0, -1, true))); err != nil {
+			logger.Error("failed to dump metadata database", "error", err)
+			return 1
+		}
+		manifest.Metadata = dump
+	}
+
+	if err := backup.WriteManifest(o.out, manifest); err != nil {
+		logger.Error("failed to write manifest", "error", err)
+		return 1
+	}
+	logger.Info("backup complete", "dir", o.out, "backends", len(manifest.Backends))
+	return 0
+}
@@ -0,0 +1,559 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ryanbastic/go-mezzanine/internal/config"
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/offload"
+	"github.com/ryanbastic/go-mezzanine/internal/secrets"
+	"github.com/ryanbastic/go-mezzanine/internal/shadow"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+	"github.com/ryanbastic/go-mezzanine/internal/view"
+)
+
+// newLogger builds the process-wide JSON logger and installs it as the slog default.
+func newLogger(level string) *slog.Logger {
+	var logLevel slog.Level
+	invalid := false
+	switch level {
+	case "debug":
+		logLevel = slog.LevelDebug
+	case "warn":
+		logLevel = slog.LevelWarn
+	case "error":
+		logLevel = slog.LevelError
+	case "info":
+		logLevel = slog.LevelInfo
+	default:
+		logLevel = slog.LevelInfo
+		invalid = true
+	}
+
+	const modulePrefix = "github.com/ryanbastic/go-mezzanine/"
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level:     logLevel,
+		AddSource: true,
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.SourceKey {
+				if src, ok := a.Value.Any().(*slog.Source); ok {
+					if idx := strings.Index(src.File, modulePrefix); idx != -1 {
+						src.File = src.File[idx+len(modulePrefix):]
+					}
+					return slog.Attr{
+						Key: a.Key,
+						Value: slog.GroupValue(
+							slog.String("f", src.File),
+							slog.Int("l", src.Line),
+							slog.String("c", src.Function),
+						),
+					}
+				}
+			}
+			return a
+		},
+	}))
+	slog.SetDefault(logger)
+	if invalid {
+		logger.Warn("invalid log level, defaulting to info", "value", level)
+	}
+	return logger
+}
+
+// openBackends creates one pool per backend, plus one for the metadata
+// database under config.MetadataBackend if configured, resolving
+// secret-backed credentials, and pings each. Credential rotation watchers run until ctx is
+// cancelled. On error, any pools already opened are closed. The pools are
+// for commands' migrations, scans and copies, which take as long as the
+// data needs: their connections leave the database's session timeouts
+// alone.
+func openBackends(ctx context.Context, cfg config.Config, shardCfg *config.ShardConfig, logger *slog.Logger) (map[string]*pgxpool.Pool, error) {
+	return openPools(ctx, cfg, shardCfg, false, logger)
+}
+
+// openRequestBackends is openBackends for the pools serving API requests,
+// whose connections get the backends' session timeouts (see
+// config.SessionTimeouts) as a backstop for request deadlines.
+func openRequestBackends(ctx context.Context, cfg config.Config, shardCfg *config.ShardConfig, logger *slog.Logger) (map[string]*pgxpool.Pool, error) {
+	return openPools(ctx, cfg, shardCfg, true, logger)
+}
+
+func openPools(ctx context.Context, cfg config.Config, shardCfg *config.ShardConfig, requests bool, logger *slog.Logger) (map[string]*pgxpool.Pool, error) {
+	pools := make(map[string]*pgxpool.Pool, len(shardCfg.Backends))
+	for _, b := range shardCfg.Backends {
+		pool, err := openBackend(ctx, cfg, b, requests, logger)
+		if err != nil {
+			closeBackends(pools, logger)
+			return nil, err
+		}
+		pools[b.Name] = pool
+		var statementTimeout, idleTimeout time.Duration
+		if requests {
+			statementTimeout, idleTimeout = b.SessionTimeouts.Resolve(cfg)
+		}
+		logger.Info("connected to backend", "backend", b.Name, "shards", []int{b.ShardStart, b.ShardEnd},
+			"maxConns", cfg.DBMaxConns, "minConns", cfg.DBMinConns,
+			"statementTimeout", statementTimeout, "idleInTransactionTimeout", idleTimeout)
+	}
+	if shardCfg.Metadata != nil {
+		pool, err := openBackend(ctx, cfg, shardCfg.Metadata.Backend(), requests, logger)
+		if err != nil {
+			closeBackends(pools, logger)
+			return nil, err
+		}
+		pools[config.MetadataBackend] = pool
+		logger.Info("connected to metadata database", "maxConns", cfg.DBMaxConns, "minConns", cfg.DBMinConns)
+	}
+	return pools, nil
+}
+
+// openBackend opens and pings b's pool, whose connections get b's session
+// timeouts if it serves requests.
+func openBackend(ctx context.Context, cfg config.Config, b config.BackendConfig, requests bool, logger *slog.Logger) (*pgxpool.Pool, error) {
+	dbURL := b.DatabaseURL
+	var rotator *secrets.Rotator
+	if b.Secret != nil {
+		provider, err := secrets.New(*b.Secret, nil)
+		if err != nil {
+			return nil, fmt.Errorf("backend %s: configure secrets provider: %w", b.Name, err)
+		}
+		rotator, err = secrets.NewRotator(ctx, provider, logger.With("backend", b.Name))
+		if err != nil {
+			return nil, fmt.Errorf("backend %s: fetch database credentials from %s: %w", b.Name, b.Secret.Provider, err)
+		}
+		dbURL = rotator.Current()
+	}
+
+	poolCfg, err := pgxpool.ParseConfig(dbURL)
+	if err != nil {
+		return nil, fmt.Errorf("backend %s: parse database URL: %w", b.Name, err)
+	}
+	poolCfg.MaxConns = int32(cfg.DBMaxConns)
+	poolCfg.MinConns = int32(cfg.DBMinConns)
+	poolCfg.MaxConnLifetime = cfg.DBMaxConnLifetime
+	poolCfg.MaxConnIdleTime = cfg.DBMaxConnIdleTime
+	poolCfg.HealthCheckPeriod = cfg.DBHealthCheckPeriod
+	// Shard queries are prepared once per connection and reused; the cache
+	// must hold every shard's statements or hot queries get re-prepared.
+	// It is unused when the URL selects another default_query_exec_mode
+	// (e.g. "exec" behind PgBouncer in transaction mode).
+	poolCfg.ConnConfig.StatementCacheCapacity = cfg.DBStatementCacheCapacity
+	if poolCfg.ConnConfig.StatementCacheCapacity <= 0 {
+		poolCfg.ConnConfig.StatementCacheCapacity = storage.StatementCacheCapacity(b.ShardEnd - b.ShardStart + 1)
+	}
+	if rotator != nil {
+		poolCfg.BeforeConnect = rotator.BeforeConnect()
+	}
+	if requests {
+		poolCfg.AfterConnect = storage.SessionTimeouts(b.SessionTimeouts.Resolve(cfg))
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
+	if err != nil {
+		return nil, fmt.Errorf("backend %s: connect: %w", b.Name, err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("backend %s: ping: %w", b.Name, err)
+	}
+
+	if rotator != nil && cfg.SecretsRefreshInterval > 0 {
+		// Reset drops every connection so the pool reconnects with the
+		// rotated credentials supplied by BeforeConnect. The watcher runs
+		// until ctx is done, so a pool closed before then must be opened
+		// with a ctx cancelled along with it.
+		go rotator.Watch(ctx, cfg.SecretsRefreshInterval, func() {
+			pool.Reset()
+			logger.Info("reset pool after credential rotation", "backend", b.Name)
+		})
+	}
+	return pool, nil
+}
+
+// resolveBackendURL returns b's database URL, fetching it from the secrets
+// manager when the backend is configured with one.
+func resolveBackendURL(ctx context.Context, b config.BackendConfig) (string, error) {
+	if b.Secret == nil {
+		return b.DatabaseURL, nil
+	}
+	provider, err := secrets.New(*b.Secret, nil)
+	if err != nil {
+		return "", fmt.Errorf("backend %s: configure secrets provider: %w", b.Name, err)
+	}
+	dbURL, err := provider.Fetch(ctx)
+	if err != nil {
+		return "", fmt.Errorf("backend %s: fetch database credentials from %s: %w", b.Name, b.Secret.Provider, err)
+	}
+	return dbURL, nil
+}
+
+func closeBackends(pools map[string]*pgxpool.Pool, logger *slog.Logger) {
+	for name, pool := range pools {
+		pool.Close()
+		logger.Info("closed pool", "backend", name)
+	}
+}
+
+// migrateOnStart runs migrate, for serve, on pools of its own, opened
+// without the request pools' session timeouts and closed once it returns.
+// Their credential watchers stop with them.
+func migrateOnStart(ctx context.Context, cfg config.Config, shardCfg *config.ShardConfig, logger *slog.Logger, migrate func(pools map[string]*pgxpool.Pool) error) error {
+	ctx, stopWatching := context.WithCancel(ctx)
+	defer stopWatching()
+	pools, err := openBackends(ctx, cfg, shardCfg, logger)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		stopWatching()
+		closeBackends(pools, logger)
+	}()
+	return migrate(pools)
+}
+
+// migrateAll applies shard, index, view and plugin migrations to every
+// backend.
+func migrateAll(ctx context.Context, cfg config.Config, shardCfg *config.ShardConfig, pools map[string]*pgxpool.Pool, registry *index.Registry, views *view.Registry, logger *slog.Logger) error {
+	if err := migrateShards(ctx, cfg, shardCfg, pools, logger); err != nil {
+		return fmt.Errorf("run migrations: %w", err)
+	}
+	if err := createIndexTables(ctx, registry, shardCfg, pools, logger); err != nil {
+		return fmt.Errorf("create index tables: %w", err)
+	}
+	if err := createViewTables(ctx, views, shardCfg, pools, logger); err != nil {
+		return fmt.Errorf("create view tables: %w", err)
+	}
+	plugins := metadataPool(shardCfg, pools)
+	if err := storage.WithMigrationLock(ctx, plugins, func(db storage.DB) error {
+		if err := storage.RunPluginMigration(ctx, db); err != nil {
+			return err
+		}
+		if err := storage.RunColumnMigration(ctx, db); err != nil {
+			return err
+		}
+		if err := storage.RunFenceMigration(ctx, db); err != nil {
+			return err
+		}
+		if err := storage.RunShardLeaseMigration(ctx, db, cfg.NumShards); err != nil {
+			return err
+		}
+		if err := storage.RunReplicationMigration(ctx, db); err != nil {
+			return err
+		}
+		if err := storage.RunExportMigration(ctx, db); err != nil {
+			return err
+		}
+		if err := storage.RunShardHashMigration(ctx, db); err != nil {
+			return err
+		}
+		return storage.RunSearchMigration(ctx, db)
+	}); err != nil {
+		return fmt.Errorf("run metadata migrations: %w", err)
+	}
+	return nil
+}
+
+// checkShardTables verifies that every backend's database holds the cell
+// tables of its shard range and no others, so that a mis-edited shard config
+// fails at start instead of routing requests to tables that do not exist.
+// Tables for shards outside a backend's range are always an error: they hold
+// data the config sends elsewhere. Missing tables are an error only when
+// allowMissing is false; otherwise migrations are about to create them.
+// Backends sharing a database URL are checked together.
+func checkShardTables(ctx context.Context, shardCfg *config.ShardConfig, pools map[string]*pgxpool.Pool, allowMissing bool, logger *slog.Logger) error {
+	type database struct {
+		names  []string
+		pool   *pgxpool.Pool
+		ranges [][2]int
+	}
+	var dbs []*database
+	byURL := make(map[string]*database)
+	for _, b := range shardCfg.Backends {
+		db := byURL[b.DatabaseURL]
+		if db == nil || b.DatabaseURL == "" {
+			db = &database{pool: pools[b.Name]}
+			dbs = append(dbs, db)
+			byURL[b.DatabaseURL] = db
+		}
+		db.names = append(db.names, b.Name)
+		db.ranges = append(db.ranges, [2]int{b.ShardStart, b.ShardEnd})
+	}
+
+	var errs []error
+	for _, db := range dbs {
+		name := strings.Join(db.names, "+")
+		present, err := storage.ListShardTables(ctx, db.pool)
+		if err != nil {
+			return fmt.Errorf("backend %s: %w", name, err)
+		}
+		missing, unexpected := storage.DiffShardTables(present, db.ranges...)
+		var problems []string
+		if len(missing) > 0 && !allowMissing {
+			problems = append(problems, "missing tables for shards "+storage.FormatShards(missing))
+		}
+		if len(unexpected) > 0 {
+			problems = append(problems, "unexpected tables for shards "+storage.FormatShards(unexpected))
+		}
+		if len(problems) > 0 {
+			errs = append(errs, fmt.Errorf("backend %s (%s): %s", name, formatRanges(db.ranges), strings.Join(problems, "; ")))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("shard tables do not match the shard config: %w", errors.Join(errs...))
+	}
+	logger.Info("shard tables match the shard config", "backends", len(shardCfg.Backends))
+	return nil
+}
+
+// formatRanges writes shard ranges as "shards 0-31, 64-95".
+func formatRanges(ranges [][2]int) string {
+	parts := make([]string, len(ranges))
+	for i, r := range ranges {
+		parts[i] = fmt.Sprintf("%d-%d", r[0], r[1])
+	}
+	return "shards " + strings.Join(parts, ", ")
+}
+
+// migrateShards creates the cell tables (and latest-cells tables and commit
+// logs, when enabled) for every backend's shard range. Each backend is migrated under
+// its advisory lock.
+func migrateShards(ctx context.Context, cfg config.Config, shardCfg *config.ShardConfig, pools map[string]*pgxpool.Pool, logger *slog.Logger) error {
+	for _, b := range shardCfg.Backends {
+		logger.Info("running migrations for backend", "backend", b.Name, "shards", []int{b.ShardStart, b.ShardEnd})
+		pool := pools[b.Name]
+		if err := storage.WithMigrationLock(ctx, pool, func(db storage.DB) error {
+			if err := storage.RunMigrationsForPool(ctx, db, b.ShardStart, b.ShardEnd); err != nil {
+				return err
+			}
+			if cfg.LatestCellsTable {
+				if err := storage.RunLatestCellsMigration(ctx, db, b.ShardStart, b.ShardEnd); err != nil {
+					return err
+				}
+			}
+			if cfg.CommitLog {
+				return storage.RunCommitLogMigration(ctx, db, b.ShardStart, b.ShardEnd)
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("backend %s: %w", b.Name, err)
+		}
+		logger.Info("migrations complete", "backend", b.Name, "shards", []int{b.ShardStart, b.ShardEnd})
+	}
+	return nil
+}
+
+// newShardRouter registers a PostgresStore for every shard of every backend,
+// placing keys with the shard config's hash.
+func newShardRouter(cfg config.Config, shardCfg *config.ShardConfig, pools map[string]*pgxpool.Pool) *shard.Router {
+	router := shard.NewRouter()
+	router.SetHash(shardCfg.Hash)
+	for _, b := range shardCfg.Backends {
+		pool := pools[b.Name]
+		for i := b.ShardStart; i <= b.ShardEnd; i++ {
+			store := storage.NewPostgresStore(pool, i, cfg.DBQueryTimeout)
+			store.UseLatestTable(cfg.LatestCellsTable)
+			store.UseCommitLog(cfg.CommitLog)
+			router.Register(shard.ID(i), store)
+		}
+	}
+	return router
+}
+
+// newHeadNotifier shares the heads of router's stores between instances,
+// or returns nil if PARTITION_READ_WAIT_NOTIFY is off. It must be called
+// before interceptors wrap the stores.
+func newHeadNotifier(cfg config.Config, router *shard.Router, logger *slog.Logger) *storage.HeadNotifier {
+	if !cfg.PartitionReadWaitNotify {
+		return nil
+	}
+	heads := storage.NewHeadNotifier(logger)
+	for i := range cfg.NumShards {
+		store, err := router.StoreFor(shard.ID(i))
+		if err != nil {
+			continue
+		}
+		if pg, ok := store.(*storage.PostgresStore); ok {
+			heads.Add(i, pg)
+		}
+	}
+	return heads
+}
+
+// newIndexRegistry loads INDEX_CONFIG_PATH (if set) and registers every
+// index definition across all backends. It does not create tables.
+func newIndexRegistry(cfg config.Config, shardCfg *config.ShardConfig, pools map[string]*pgxpool.Pool, logger *slog.Logger) (*index.Registry, error) {
+	registry := index.NewRegistry()
+	registry.SetQueryTimeout(cfg.DBQueryTimeout)
+	registry.SetHash(shardCfg.Hash)
+	if cfg.IndexConfigPath == "" {
+		return registry, nil
+	}
+
+	logger.Info("loading index config", "path", cfg.IndexConfigPath)
+	idxCfg, err := config.LoadIndexConfig(cfg.IndexConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("index config loaded", "indexCount", len(idxCfg.Indexes))
+
+	for _, b := range shardCfg.Backends {
+		pool := pools[b.Name]
+		for _, idx := range idxCfg.Indexes {
+			registry.RegisterRange(pool, index.Definition{
+				Name:          idx.Name,
+				SourceColumn:  idx.SourceColumn,
+				ShardKeyField: idx.ShardKeyField,
+				Fields:        idx.Fields,
+				UniqueFields:  idx.UniqueFields,
+				FieldTypes:    indexFieldTypes(idx.FieldTypes),
+			}, b.ShardStart, b.ShardEnd)
+		}
+	}
+	return registry, nil
+}
+
+// indexFieldTypes converts the field types of an index config, which
+// config.LoadIndexConfig has checked.
+func indexFieldTypes(types map[string]string) map[string]index.FieldType {
+	if types == nil {
+		return nil
+	}
+	out := make(map[string]index.FieldType, len(types))
+	for f, typ := range types {
+		out[f] = index.FieldType(typ)
+	}
+	return out
+}
+
+// createIndexTables creates the per-shard tables for every registered index.
+func createIndexTables(ctx context.Context, registry *index.Registry, shardCfg *config.ShardConfig, pools map[string]*pgxpool.Pool, logger *slog.Logger) error {
+	for _, b := range shardCfg.Backends {
+		logger.Info("creating index tables", "backend", b.Name, "shards", []int{b.ShardStart, b.ShardEnd})
+		pool := pools[b.Name]
+		if err := storage.WithMigrationLock(ctx, pool, func(db storage.DB) error {
+			return registry.CreateTablesRange(ctx, db, b.ShardStart, b.ShardEnd)
+		}); err != nil {
+			return fmt.Errorf("backend %s: %w", b.Name, err)
+		}
+		logger.Info("index tables created", "backend", b.Name, "shards", []int{b.ShardStart, b.ShardEnd})
+	}
+	return nil
+}
+
+// newViewRegistry loads VIEW_CONFIG_PATH (if set) and registers every view
+// across all backends. It does not create tables.
+func newViewRegistry(cfg config.Config, shardCfg *config.ShardConfig, pools map[string]*pgxpool.Pool, logger *slog.Logger) (*view.Registry, error) {
+	registry := view.NewRegistry()
+	registry.SetQueryTimeout(cfg.DBQueryTimeout)
+	if cfg.ViewConfigPath == "" {
+		return registry, nil
+	}
+
+	viewCfg, err := view.Load(cfg.ViewConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("view config loaded", "path", cfg.ViewConfigPath, "views", len(viewCfg.Views))
+	for _, b := range shardCfg.Backends {
+		for _, def := range viewCfg.Views {
+			registry.RegisterRange(pools[b.Name], def, b.ShardStart, b.ShardEnd)
+		}
+	}
+	return registry, nil
+}
+
+// createViewTables creates the per-shard tables for every registered view.
+func createViewTables(ctx context.Context, registry *view.Registry, shardCfg *config.ShardConfig, pools map[string]*pgxpool.Pool, logger *slog.Logger) error {
+	if len(registry.Definitions()) == 0 {
+		return nil
+	}
+	for _, b := range shardCfg.Backends {
+		pool := pools[b.Name]
+		if err := storage.WithMigrationLock(ctx, pool, func(db storage.DB) error {
+			return registry.CreateTablesRange(ctx, db, b.ShardStart, b.ShardEnd)
+		}); err != nil {
+			return fmt.Errorf("backend %s: %w", b.Name, err)
+		}
+		logger.Info("view tables created", "backend", b.Name, "shards", []int{b.ShardStart, b.ShardEnd})
+	}
+	return nil
+}
+
+// newShadowTarget returns the target of shadow writes: the Mezzanine server
+// at SHADOW_WRITES_URL, or the backends of SHADOW_SHARD_CONFIG_PATH, which
+// must not be the primary's and are migrated like them when
+// MIGRATE_ON_START is set. A server is sent offloaded bodies resolved with
+// offloader, if set. The returned func closes the target's pools.
+func newShadowTarget(ctx context.Context, cfg config.Config, shardCfg *config.ShardConfig, offloader *offload.Offloader, logger *slog.Logger) (shadow.Target, func(), error) {
+	if cfg.ShadowWritesURL != "" {
+		if cfg.ShadowShardConfigPath != "" {
+			return nil, nil, errors.New("SHADOW_WRITES_URL and SHADOW_SHARD_CONFIG_PATH are mutually exclusive")
+		}
+		target := shadow.NewHTTPTarget(cfg.ShadowWritesURL, cfg.ShadowAPIKey)
+		target.ResolveOffloaded(offloader)
+		return target, func() {}, nil
+	}
+
+	numShards := cfg.ShadowNumShards
+	if numShards <= 0 {
+		numShards = cfg.NumShards
+	}
+	shadowCfg, err := config.LoadShardConfig(cfg.ShadowShardConfigPath, numShards)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load shadow shard config: %w", err)
+	}
+	if err := checkDistinctBackends(shardCfg, shadowCfg); err != nil {
+		return nil, nil, err
+	}
+	if shadowCfg.Hash != shardCfg.Hash {
+		return nil, nil, fmt.Errorf("shadow shard config hashes keys with %s, the primary with %s: they must match", shadowCfg.Hash, shardCfg.Hash)
+	}
+	if cfg.MigrateOnStart {
+		if err := migrateOnStart(ctx, cfg, shadowCfg, logger.With("shadow", true), func(pools map[string]*pgxpool.Pool) error {
+			return migrateShards(ctx, cfg, shadowCfg, pools, logger.With("shadow", true))
+		}); err != nil {
+			return nil, nil, fmt.Errorf("migrate shadow backends: %w", err)
+		}
+	}
+	pools, err := openRequestBackends(ctx, cfg, shadowCfg, logger.With("shadow", true))
+	if err != nil {
+		return nil, nil, fmt.Errorf("open shadow backends: %w", err)
+	}
+	target := shadow.NewStoreTarget(newShardRouter(cfg, shadowCfg, pools), numShards)
+	return target, func() { closeBackends(pools, logger) }, nil
+}
+
+// metadataPool returns the pool holding the cluster-wide tables — plugins,
+// columns and shard leases: the metadata database's if configured, otherwise
+// the first backend's.
+func metadataPool(shardCfg *config.ShardConfig, pools map[string]*pgxpool.Pool) *pgxpool.Pool {
+	if shardCfg.Metadata != nil {
+		return pools[config.MetadataBackend]
+	}
+	return pools[shardCfg.Backends[0].Name]
+}
+
+// checkShardHash refuses a shard config whose hash is not the one recorded
+// in the metadata database, which would route keys away from their data. A
+// cluster's first start records its hash.
+func checkShardHash(ctx context.Context, shardCfg *config.ShardConfig, pools map[string]*pgxpool.Pool) error {
+	return storage.CheckShardHash(ctx, metadataPool(shardCfg, pools), shardCfg.Hash)
+}
+
+// shardPools returns the pools of the backends that hold shards, without
+// the metadata database's.
+func shardPools(shardCfg *config.ShardConfig, pools map[string]*pgxpool.Pool) map[string]*pgxpool.Pool {
+	out := make(map[string]*pgxpool.Pool, len(shardCfg.Backends))
+	for _, b := range shardCfg.Backends {
+		out[b.Name] = pools[b.Name]
+	}
+	return out
+}
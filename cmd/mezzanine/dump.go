@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ryanbastic/go-mezzanine/internal/backup"
+	"github.com/ryanbastic/go-mezzanine/internal/config"
+	"github.com/ryanbastic/go-mezzanine/internal/dump"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+	"github.com/spf13/cobra"
+)
+
+// dumpOptions holds the flags of the dump command.
+type dumpOptions struct {
+	out string
+}
+
+// dumpCommand parses the dump flags and runs runDump.
+func dumpCommand() *cobra.Command {
+	var o dumpOptions
+	cmd := &cobra.Command{
+		Use:   "dump",
+		Short: "Write a portable logical dump of cells, indexes and plugins",
+		Args:  cobra.NoArgs,
+		Run:   run(func() int { return runDump(o) }),
+	}
+	fs := cmd.Flags()
+	fs.StringVar(&o.out, "out", "", "directory to write the dump into (required)")
+	cmd.MarkFlagRequired("out")
+	return cmd
+}
+
+// runDump writes a logical dump of the cluster: every shard's cells up to a
+// consistency marker, as in backup, plus the index definitions and plugins.
+// See internal/dump for the format.
+func runDump(o dumpOptions) int {
+	cfg := config.Load()
+	logger := newLogger(cfg.LogLevel)
+	ctx := context.Background()
+
+	shardCfg, err := config.LoadShardConfig(cfg.ShardConfigPath, cfg.NumShards)
+	if err != nil {
+		logger.Error("failed to load shard config", "error", err)
+		return 1
+	}
+	var defs []config.IndexDefinition
+	if cfg.IndexConfigPath != "" {
+		idxCfg, err := config.LoadIndexConfig(cfg.IndexConfigPath)
+		if err != nil {
+			logger.Error("failed to load index config", "error", err)
+			return 1
+		}
+		defs = idxCfg.Indexes
+	}
+	if err := os.MkdirAll(o.out, 0o755); err != nil {
+		logger.Error("failed to create dump directory", "error", err)
+		return 1
+	}
+	pools, err := openBackends(ctx, cfg, shardCfg, logger)
+	if err != nil {
+		logger.Error("failed to open backends", "error", err)
+		return 1
+	}
+	defer closeBackends(pools, logger)
+
+	// Record every marker before any shard is read, so that all shards are
+	// cut at the same point however long the dump takes.
+	markers := make(map[int]int64, cfg.NumShards)
+	for _, b := range shardCfg.Backends {
+		m, err := backup.Markers(ctx, pools[b.Name], b.ShardStart, b.ShardEnd)
+		if err != nil {
+			logger.Error("failed to read consistency markers", "backend", b.Name, "error", err)
+			return 1
+		}
+		for shardID, marker := range m {
+			markers[shardID] = marker
+		}
+	}
+
+	manifest := dump.NewManifest(cfg.NumShards)
+	manifest.Segments = make([]dump.Segment, cfg.NumShards)
+	var cells int64
+	for _, b := range shardCfg.Backends {
+		logger.Info("dumping backend", "backend", b.Name, "shards", []int{b.ShardStart, b.ShardEnd})
+		if err := dumpBackend(ctx, pools[b.Name], o.out, b.ShardStart, b.ShardEnd, markers, manifest.Segments); err != nil {
+			logger.Error("failed to dump backend", "backend", b.Name, "error", err)
+			return 1
+		}
+		for i := b.ShardStart; i <= b.ShardEnd; i++ {
+			cells += manifest.Segments[i].Cells
+		}
+	}
+
+	if err := dump.WriteIndexes(o.out, defs); err != nil {
+		logger.Error("failed to write index definitions", "error", err)
+		return 1
+	}
+	plugins, err := trigger.NewPostgresPluginStore(metadataPool(shardCfg, pools), cfg.DBQueryTimeout).ListPlugins(ctx)
+	if err != nil {
+		logger.Error("failed to list plugins", "error", err)
+		return 1
+	}
+	if err := dump.WritePlugins(o.out, plugins); err != nil {
+		logger.Error("failed to write plugins", "error", err)
+		return 1
+	}
+	// The manifest is written last: a directory without one is incomplete.
+	if err := dump.WriteManifest(o.out, manifest); err != nil {
+		logger.Error("failed to write manifest", "error", err)
+		return 1
+	}
+	logger.Info("dump complete", "dir", o.out, "cells", cells, "indexes", len(defs), "plugins", len(plugins))
+	return 0
+}
+
+// dumpBackend writes the segments of shards start to end, read in one
+// repeatable-read transaction, into segments.
+func dumpBackend(ctx context.Context, pool *pgxpool.Pool, dir string, start, end int, markers map[int]int64, segments []dump.Segment) error {
+	tx, err := pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("begin snapshot: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+	for i := start; i <= end; i++ {
+		seg, err := dump.DumpShard(ctx, tx, dir, i, markers[i])
+		if err != nil {
+			return err
+		}
+		segments[i] = seg
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ryanbastic/go-mezzanine/internal/config"
+	"github.com/ryanbastic/go-mezzanine/internal/importer"
+	"github.com/ryanbastic/go-mezzanine/internal/tablehealth"
+	"github.com/spf13/cobra"
+)
+
+// importOptions holds the flags of the import command.
+type importOptions struct {
+	sourceURL       string
+	table           string
+	rowKey          string
+	rowKeyNamespace string
+	column          string
+	refKeyColumn    string
+	refKey          int64
+	body            string
+	where           string
+	batch           int
+	analyze         bool
+}
+
+// importCommand parses the import flags and runs runImport.
+func importCommand() *cobra.Command {
+	var o importOptions
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Copy rows from an existing PostgreSQL table into cells",
+		Args:  cobra.NoArgs,
+		Run:   run(func() int { return runImport(o) }),
+	}
+	fs := cmd.Flags()
+	fs.StringVar(&o.sourceURL, "source-url", "", "PostgreSQL URL of the database holding the source table (required)")
+	fs.StringVar(&o.table, "table", "", "source table, optionally schema-qualified (required)")
+	fs.StringVar(&o.rowKey, "row-key", "", "source column supplying row_key (required)")
+	fs.StringVar(&o.rowKeyNamespace, "row-key-namespace", importer.LegacyRowKeyNamespace, "namespace non-UUID row keys are derived in, as clients derive them with DeriveRowKey (e.g. \"user\")")
+	fs.StringVar(&o.column, "column", "", "cell column_name to write (required)")
+	fs.StringVar(&o.refKeyColumn, "ref-key-column", "", "source column supplying ref_key (default: --ref-key for every row)")
+	fs.Int64Var(&o.refKey, "ref-key", 1, "ref_key used when --ref-key-column is not set")
+	fs.StringVar(&o.body, "body", "", "comma-separated source columns projected into the body (default: whole row)")
+	fs.StringVar(&o.where, "where", "", "SQL filter applied to the source table")
+	fs.IntVar(&o.batch, "batch", 500, "rows written per batch")
+	fs.BoolVar(&o.analyze, "analyze", true, "ANALYZE the shard tables once the import is complete, so the planner sees the new rows")
+	cmd.MarkFlagRequired("source-url")
+	cmd.MarkFlagRequired("table")
+	cmd.MarkFlagRequired("row-key")
+	cmd.MarkFlagRequired("column")
+	return cmd
+}
+
+// runImport streams rows from an existing PostgreSQL table into cells.
+func runImport(o importOptions) int {
+	icfg := importer.Config{
+		Table:           o.table,
+		RowKeyColumn:    o.rowKey,
+		RowKeyNamespace: o.rowKeyNamespace,
+		ColumnName:      o.column,
+		RefKeyColumn:    o.refKeyColumn,
+		RefKey:          o.refKey,
+		Where:           o.where,
+		BatchSize:       o.batch,
+	}
+	if o.body != "" {
+		for _, col := range strings.Split(o.body, ",") {
+			icfg.BodyColumns = append(icfg.BodyColumns, strings.TrimSpace(col))
+		}
+	}
+	query, err := importer.Query(icfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "import:", err)
+		return 2
+	}
+
+	cfg := config.Load()
+	logger := newLogger(cfg.LogLevel)
+	ctx := context.Background()
+
+	shardCfg, err := config.LoadShardConfig(cfg.ShardConfigPath, cfg.NumShards)
+	if err != nil {
+		logger.Error("failed to load shard config", "error", err)
+		return 1
+	}
+	pools, err := openBackends(ctx, cfg, shardCfg, logger)
+	if err != nil {
+		logger.Error("failed to open backends", "error", err)
+		return 1
+	}
+	defer closeBackends(pools, logger)
+	if err := checkShardHash(ctx, shardCfg, pools); err != nil {
+		logger.Error("shard hash check failed", "error", err)
+		return 1
+	}
+
+	router := newShardRouter(cfg, shardCfg, pools)
+	registry, err := newIndexRegistry(cfg, shardCfg, pools, logger)
+	if err != nil {
+		logger.Error("failed to load index config", "error", err)
+		return 1
+	}
+
+	source, err := pgx.Connect(ctx, o.sourceURL)
+	if err != nil {
+		logger.Error("failed to connect to source database", "error", err)
+		return 1
+	}
+	defer source.Close(ctx)
+
+	rows, err := source.Query(ctx, query)
+	if err != nil {
+		logger.Error("failed to query source table", "table", o.table, "error", err)
+		return 1
+	}
+	defer rows.Close()
+
+	logger.Info("importing", "table", o.table, "column_name", o.column)
+	stats, err := importer.New(router, registry, cfg.NumShards, logger).Run(ctx, icfg, rows)
+	if err != nil {
+		logger.Error("import failed", "read", stats.Read, "written", stats.Written, "error", err)
+		return 1
+	}
+
+	logger.Info("import complete", "read", stats.Read, "written", stats.Written,
+		"skipped", stats.Skipped, "index_failures", stats.IndexFailures)
+	if o.analyze && stats.Written > 0 {
+		// An import lands far more rows than autovacuum's thresholds
+		// expect between analyzes; until it catches up, shard table plans
+		// rest on statistics from before the import.
+		poolFor := func(shardID int) *pgxpool.Pool { return pools[shardCfg.BackendFor(shardID)] }
+		store := tablehealth.NewPostgresStore(poolFor, cfg.DBQueryTimeout)
+		for id := range cfg.NumShards {
+			if err := tablehealth.Analyze(ctx, store, id); err != nil {
+				logger.Warn("failed to analyze shard table after import", "shard_id", id, "error", err)
+			}
+		}
+		logger.Info("analyzed shard tables", "shards", cfg.NumShards)
+	}
+	if stats.IndexFailures > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ryanbastic/go-mezzanine/internal/config"
+	"github.com/ryanbastic/go-mezzanine/internal/dump"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+	"github.com/spf13/cobra"
+)
+
+// loadOptions holds the flags of the load command.
+type loadOptions struct {
+	from        string
+	skipReindex bool
+	batch       int
+}
+
+// loadCommand parses the load flags and runs runLoad.
+func loadCommand() *cobra.Command {
+	var o loadOptions
+	cmd := &cobra.Command{
+		Use:   "load",
+		Short: "Load a logical dump into a cluster of any shard layout",
+		Args:  cobra.NoArgs,
+		Run:   run(func() int { return runLoad(o) }),
+	}
+	fs := cmd.Flags()
+	fs.StringVar(&o.from, "from", "", "dump directory written by mezzanine dump (required)")
+	fs.BoolVar(&o.skipReindex, "skip-reindex", false, "do not rebuild index tables after loading")
+	fs.IntVar(&o.batch, "batch", 500, "cells read per scan query when rebuilding indexes")
+	cmd.MarkFlagRequired("from")
+	return cmd
+}
+
+// runLoad writes the cells and plugins of a logical dump into the cluster
+// described by the environment, whatever its shard layout, and rebuilds
+// its indexes. Cells and plugins already present are skipped, so an
+// interrupted load can simply be restarted. Loaded cells get a fresh
+// added_id and created_at.
+func runLoad(o loadOptions) int {
+	cfg := config.Load()
+	logger := newLogger(cfg.LogLevel)
+	ctx := context.Background()
+
+	manifest, err := dump.ReadManifest(o.from)
+	if err != nil {
+		logger.Error("failed to read dump", "error", err)
+		return 1
+	}
+	dumped, err := dump.ReadIndexes(o.from)
+	if err != nil {
+		logger.Error("failed to read dump", "error", err)
+		return 1
+	}
+	plugins, err := dump.ReadPlugins(o.from)
+	if err != nil {
+		logger.Error("failed to read dump", "error", err)
+		return 1
+	}
+	// Index definitions live in INDEX_CONFIG_PATH rather than the database,
+	// so the target must already be configured with the dump's.
+	var configured []config.IndexDefinition
+	if cfg.IndexConfigPath != "" {
+		idxCfg, err := config.LoadIndexConfig(cfg.IndexConfigPath)
+		if err != nil {
+			logger.Error("failed to load index config", "error", err)
+			return 1
+		}
+		configured = idxCfg.Indexes
+	}
+	if !dump.SameIndexes(dumped, configured) {
+		if len(dumped) == 0 {
+			fmt.Fprintln(os.Stderr, "load: the dump has no indexes but INDEX_CONFIG_PATH defines some; unset it")
+		} else {
+			fmt.Fprintf(os.Stderr, "load: INDEX_CONFIG_PATH does not define the dump's indexes; set it to %s\n", filepath.Join(o.from, dump.IndexesFile))
+		}
+		return 1
+	}
+	// Check every segment before writing anything.
+	for _, seg := range manifest.Segments {
+		if err := dump.ReadSegment(o.from, seg, func(dump.Cell) error { return nil }); err != nil {
+			logger.Error("dump is corrupt", "error", err)
+			return 1
+		}
+	}
+
+	shardCfg, err := config.LoadShardConfig(cfg.ShardConfigPath, cfg.NumShards)
+	if err != nil {
+		logger.Error("failed to load shard config", "error", err)
+		return 1
+	}
+	pools, err := openBackends(ctx, cfg, shardCfg, logger)
+	if err != nil {
+		logger.Error("failed to open backends", "error", err)
+		return 1
+	}
+	defer closeBackends(pools, logger)
+	registry, err := newIndexRegistry(cfg, shardCfg, pools, logger)
+	if err != nil {
+		logger.Error("failed to load index config", "error", err)
+		return 1
+	}
+	views, err := newViewRegistry(cfg, shardCfg, pools, logger)
+	if err != nil {
+		logger.Error("failed to load view config", "error", err)
+		return 1
+	}
+	if err := migrateAll(ctx, cfg, shardCfg, pools, registry, views, logger); err != nil {
+		logger.Error("migration failed", "error", err)
+		return 1
+	}
+	if err := checkShardHash(ctx, shardCfg, pools); err != nil {
+		logger.Error("shard hash check failed", "error", err)
+		return 1
+	}
+
+	if err := loadPlugins(ctx, trigger.NewPostgresPluginStore(metadataPool(shardCfg, pools), cfg.DBQueryTimeout), plugins); err != nil {
+		logger.Error("failed to load plugins", "error", err)
+		return 1
+	}
+
+	router := newShardRouter(cfg, shardCfg, pools)
+	var loaded, skipped int
+	for _, seg := range manifest.Segments {
+		err := dump.ReadSegment(o.from, seg, func(c dump.Cell) error {
+			req := c.WriteCellRequest
+			store, err := router.StoreFor(router.ForRowKey(req.RowKey, cfg.NumShards))
+			if err != nil {
+				return err
+			}
+			if c.Data != nil {
+				_, err = storage.WriteBlob(ctx, store, req, c.Data)
+			} else {
+				_, err = store.WriteCell(ctx, req)
+			}
+			switch {
+			case errors.Is(err, storage.ErrCellExists):
+				skipped++
+			case err != nil:
+				return fmt.Errorf("write cell %s/%s/%d: %w", req.RowKey, req.ColumnName, req.RefKey, err)
+			default:
+				loaded++
+			}
+			return nil
+		})
+		if err != nil {
+			logger.Error("failed to load segment", "file", seg.File, "error", err)
+			return 1
+		}
+		logger.Info("segment loaded", "file", seg.File, "loaded", loaded, "skipped", skipped)
+	}
+
+	defs := registry.Definitions()
+	if o.skipReindex || len(defs) == 0 {
+		logger.Info("load complete", "loaded", loaded, "skipped", skipped, "plugins", len(plugins))
+		return 0
+	}
+	indexed, failed, err := rebuildIndexes(ctx, cfg, shardCfg, pools, router, registry, defs, o.batch, logger)
+	if err != nil {
+		logger.Error("failed to rebuild indexes", "error", err)
+		return 1
+	}
+	logger.Info("load complete", "loaded", loaded, "skipped", skipped, "plugins", len(plugins),
+		"index_entries", indexed, "index_failures", failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// loadPlugins saves the plugins store does not already hold. A plugin with
+// the name of an existing one but a different ID is an error.
+func loadPlugins(ctx context.Context, store trigger.PluginStore, plugins []*trigger.Plugin) error {
+	existing, err := store.ListPlugins(ctx)
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]*trigger.Plugin, len(existing))
+	for _, p := range existing {
+		byName[p.Name] = p
+	}
+	for _, p := range plugins {
+		if have, ok := byName[p.Name]; ok {
+			if have.ID != p.ID {
+				return fmt.Errorf("plugin %q already exists with ID %s, not %s", p.Name, have.ID, p.ID)
+			}
+			continue
+		}
+		if err := store.SavePlugin(ctx, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
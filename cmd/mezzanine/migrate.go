@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/ryanbastic/go-mezzanine/internal/config"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// migrateOptions holds the flags of the migrate command.
+type migrateOptions struct {
+	timeout     time.Duration
+	replaceHash bool
+}
+
+// migrateCommand parses the migrate flags and runs runMigrate.
+func migrateCommand() *cobra.Command {
+	var o migrateOptions
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Create shard, index and plugin tables, then exit",
+		Args:  cobra.NoArgs,
+		Run:   run(func() int { return runMigrate(o) }),
+	}
+	fs := cmd.Flags()
+	fs.DurationVar(&o.timeout, "timeout", 0, "give up if migrations (including waiting for the lock) take longer than this; 0 waits forever")
+	fs.BoolVar(&o.replaceHash, "replace-shard-hash", false, "record the shard config's hash as the cluster's even if another is recorded, when switching to a cluster resharded onto another hash")
+	return cmd
+}
+
+// runMigrate creates all shard, index and plugin tables, records or checks
+// the cluster's shard hash, and exits. It is
+// meant to run once per rollout (e.g. as a Kubernetes init container or Job)
+// with serving pods started with MIGRATE_ON_START=false.
+func runMigrate(o migrateOptions) int {
+
+	cfg := config.Load()
+	logger := newLogger(cfg.LogLevel)
+	ctx := context.Background()
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+
+	shardCfg, err := config.LoadShardConfig(cfg.ShardConfigPath, cfg.NumShards)
+	if err != nil {
+		logger.Error("failed to load shard config", "error", err)
+		return 1
+	}
+	pools, err := openBackends(ctx, cfg, shardCfg, logger)
+	if err != nil {
+		logger.Error("failed to open backends", "error", err)
+		return 1
+	}
+	defer closeBackends(pools, logger)
+
+	// Creating tables for a mis-edited config would put empty shards on the
+	// wrong backends; only missing tables are expected here.
+	if cfg.ShardTableCheck {
+		if err := checkShardTables(ctx, shardCfg, pools, true, logger); err != nil {
+			logger.Error("shard table check failed", "error", err)
+			return 1
+		}
+	}
+
+	indexRegistry, err := newIndexRegistry(cfg, shardCfg, pools, logger)
+	if err != nil {
+		logger.Error("failed to load index config", "error", err)
+		return 1
+	}
+	viewRegistry, err := newViewRegistry(cfg, shardCfg, pools, logger)
+	if err != nil {
+		logger.Error("failed to load view config", "error", err)
+		return 1
+	}
+	if err := migrateAll(ctx, cfg, shardCfg, pools, indexRegistry, viewRegistry, logger); err != nil {
+		logger.Error("migration failed", "error", err)
+		return 1
+	}
+	if o.replaceHash {
+		if err := storage.ReplaceShardHash(ctx, metadataPool(shardCfg, pools), shardCfg.Hash); err != nil {
+			logger.Error("failed to replace shard hash", "error", err)
+			return 1
+		}
+		logger.Info("recorded shard hash", "hash", shardCfg.Hash.String())
+	} else if err := checkShardHash(ctx, shardCfg, pools); err != nil {
+		logger.Error("shard hash check failed", "error", err)
+		return 1
+	}
+
+	logger.Info("migrations complete")
+	return 0
+}
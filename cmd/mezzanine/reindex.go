@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ryanbastic/go-mezzanine/internal/config"
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/spf13/cobra"
+)
+
+// reindexOptions holds the flags of the reindex command.
+type reindexOptions struct {
+	names    string
+	views    bool
+	truncate bool
+	batch    int
+}
+
+// reindexCommand parses the reindex flags and runs runReindex.
+func reindexCommand() *cobra.Command {
+	var o reindexOptions
+	cmd := &cobra.Command{
+		Use:   "reindex",
+		Short: "Rebuild secondary index tables from stored cells",
+		Args:  cobra.NoArgs,
+		Run:   run(func() int { return runReindex(o) }),
+	}
+	fs := cmd.Flags()
+	fs.StringVar(&o.names, "index", "", "comma-separated index names to rebuild (default: all)")
+	fs.BoolVar(&o.views, "views", false, "rebuild the materialized views of VIEW_CONFIG_PATH instead of indexes")
+	fs.BoolVar(&o.truncate, "truncate", false, "with --views, empty the view tables before replaying; views read empty until the rebuild ends, so only use it offline")
+	fs.IntVar(&o.batch, "batch", 500, "cells read per scan query")
+	return cmd
+}
+
+// runReindex truncates and rebuilds index tables by replaying every cell of
+// each index's source column in added_id order, exactly as the write path
+// would have indexed them. With --views it rebuilds the materialized views
+// instead, in place unless --truncate is given.
+func runReindex(o reindexOptions) int {
+
+	cfg := config.Load()
+	logger := newLogger(cfg.LogLevel)
+	ctx := context.Background()
+
+	shardCfg, err := config.LoadShardConfig(cfg.ShardConfigPath, cfg.NumShards)
+	if err != nil {
+		logger.Error("failed to load shard config", "error", err)
+		return 1
+	}
+	pools, err := openBackends(ctx, cfg, shardCfg, logger)
+	if err != nil {
+		logger.Error("failed to open backends", "error", err)
+		return 1
+	}
+	defer closeBackends(pools, logger)
+	if err := checkShardHash(ctx, shardCfg, pools); err != nil {
+		logger.Error("shard hash check failed", "error", err)
+		return 1
+	}
+
+	router := newShardRouter(cfg, shardCfg, pools)
+	if o.views {
+		return reindexViews(ctx, cfg, shardCfg, pools, router, o.truncate, o.batch, logger)
+	}
+	registry, err := newIndexRegistry(cfg, shardCfg, pools, logger)
+	if err != nil {
+		logger.Error("failed to load index config", "error", err)
+		return 1
+	}
+
+	defs, err := selectIndexes(registry, o.names)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "reindex:", err)
+		return 2
+	}
+
+	if err := createIndexTables(ctx, registry, shardCfg, pools, logger); err != nil {
+		logger.Error("failed to create index tables", "error", err)
+		return 1
+	}
+	indexed, failed, err := rebuildIndexes(ctx, cfg, shardCfg, pools, router, registry, defs, o.batch, logger)
+	if err != nil {
+		logger.Error("reindex failed", "error", err)
+		return 1
+	}
+
+	logger.Info("reindex complete", "entries", indexed, "failed", failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// rebuildIndexes truncates the given indexes on every backend and replays
+// their source columns shard by shard. It returns the number of entries
+// written and the number of cells that failed to index.
+func rebuildIndexes(ctx context.Context, cfg config.Config, shardCfg *config.ShardConfig, pools map[string]*pgxpool.Pool,
+	router *shard.Router, registry *index.Registry, defs []index.Definition, batch int, logger *slog.Logger) (indexed, failed int, err error) {
+	for _, b := range shardCfg.Backends {
+		for _, def := range defs {
+			if err := registry.TruncateRange(ctx, pools[b.Name], def.Name, b.ShardStart, b.ShardEnd); err != nil {
+				return indexed, failed, fmt.Errorf("backend %s: %w", b.Name, err)
+			}
+		}
+	}
+
+	byColumn := make(map[string][]index.Definition)
+	for _, def := range defs {
+		byColumn[def.SourceColumn] = append(byColumn[def.SourceColumn], def)
+	}
+
+	for i := range cfg.NumShards {
+		store, err := router.StoreFor(shard.ID(i))
+		if err != nil {
+			return indexed, failed, fmt.Errorf("route shard %d: %w", i, err)
+		}
+		for column, colDefs := range byColumn {
+			var after int64
+			for {
+				cells, err := store.ScanCells(ctx, column, after, batch)
+				if err != nil {
+					return indexed, failed, fmt.Errorf("scan shard %d column %s: %w", i, column, err)
+				}
+				for _, c := range cells {
+					for _, def := range colDefs {
+						if err := registry.IndexCellFor(ctx, def.Name, &c, cfg.NumShards); err != nil {
+							failed++
+							logger.Warn("index write failed", "index", def.Name, "row_key", c.RowKey, "added_id", c.AddedID, "error", err)
+							continue
+						}
+						indexed++
+					}
+					after = c.AddedID
+				}
+				if len(cells) < batch {
+					break
+				}
+			}
+		}
+		logger.Debug("shard reindexed", "shard_id", i)
+	}
+	return indexed, failed, nil
+}
+
+// reindexViews replays every view's source column shard by shard, then
+// prunes the members no stored cell backs. Updates only ever replace older
+// versions, so views stay readable, and kept current by the write path,
+// while they are rebuilt. With truncate their tables are emptied first
+// instead.
+func reindexViews(ctx context.Context, cfg config.Config, shardCfg *config.ShardConfig, pools map[string]*pgxpool.Pool,
+	router *shard.Router, truncate bool, batch int, logger *slog.Logger) int {
+	registry, err := newViewRegistry(cfg, shardCfg, pools, logger)
+	if err != nil {
+		logger.Error("failed to load view config", "error", err)
+		return 1
+	}
+	defs := registry.Definitions()
+	if len(defs) == 0 {
+		fmt.Fprintln(os.Stderr, "reindex: no views registered; set VIEW_CONFIG_PATH")
+		return 2
+	}
+	if err := createViewTables(ctx, registry, shardCfg, pools, logger); err != nil {
+		logger.Error("failed to create view tables", "error", err)
+		return 1
+	}
+	if truncate {
+		for _, b := range shardCfg.Backends {
+			for _, def := range defs {
+				if err := registry.TruncateRange(ctx, pools[b.Name], def.Name, b.ShardStart, b.ShardEnd); err != nil {
+					logger.Error("reindex failed", "backend", b.Name, "error", err)
+					return 1
+				}
+			}
+		}
+	}
+
+	var applied, failed int
+	for i := range cfg.NumShards {
+		store, err := router.StoreFor(shard.ID(i))
+		if err != nil {
+			logger.Error("reindex failed", "error", fmt.Errorf("route shard %d: %w", i, err))
+			return 1
+		}
+		for _, column := range registry.Columns() {
+			var after int64
+			for {
+				cells, err := store.ScanCells(ctx, column, after, batch)
+				if err != nil {
+					logger.Error("reindex failed", "error", fmt.Errorf("scan shard %d column %s: %w", i, column, err))
+					return 1
+				}
+				for _, c := range cells {
+					if err := registry.HandleCell(ctx, i, &c); err != nil {
+						failed++
+						logger.Warn("view write failed", "row_key", c.RowKey, "added_id", c.AddedID, "error", err)
+					} else {
+						applied++
+					}
+					after = c.AddedID
+				}
+				if len(cells) < batch {
+					break
+				}
+			}
+		}
+		logger.Debug("shard views rebuilt", "shard_id", i)
+	}
+
+	// Only a complete replay is pruned: a member whose update failed may
+	// be of a version since compacted away while its row lives on.
+	var pruned int64
+	if failed == 0 && !truncate {
+		for _, b := range shardCfg.Backends {
+			for _, def := range defs {
+				n, err := registry.PruneRange(ctx, pools[b.Name], def.Name, b.ShardStart, b.ShardEnd)
+				pruned += n
+				if err != nil {
+					logger.Error("reindex failed", "backend", b.Name, "error", err)
+					return 1
+				}
+			}
+		}
+	}
+
+	logger.Info("view reindex complete", "cells", applied, "failed", failed, "pruned", pruned)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// selectIndexes resolves a comma-separated list of index names, or returns
+// every registered definition when names is empty.
+func selectIndexes(registry *index.Registry, names string) ([]index.Definition, error) {
+	all := registry.Definitions()
+	if len(all) == 0 {
+		return nil, fmt.Errorf("no indexes registered; set INDEX_CONFIG_PATH")
+	}
+	if names == "" {
+		return all, nil
+	}
+	var defs []index.Definition
+	for _, name := range strings.Split(names, ",") {
+		def, ok := registry.GetDefinition(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unknown index %q", name)
+		}
+		if !slices.ContainsFunc(defs, func(d index.Definition) bool { return d.Name == def.Name }) {
+			defs = append(defs, def)
+		}
+	}
+	return defs, nil
+}
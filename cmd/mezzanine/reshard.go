@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/config"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// reshardOptions holds the flags of the reshard command.
+type reshardOptions struct {
+	targetPath   string
+	targetShards int
+	batch        int
+}
+
+// reshardCommand parses the reshard flags and runs runReshard.
+func reshardCommand() *cobra.Command {
+	var o reshardOptions
+	cmd := &cobra.Command{
+		Use:   "reshard",
+		Short: "Copy every cell into a cluster with a different shard layout",
+		Args:  cobra.NoArgs,
+		Run:   run(func() int { return runReshard(o) }),
+	}
+	fs := cmd.Flags()
+	fs.StringVar(&o.targetPath, "target-shards", "", "shard config of the target cluster (required)")
+	fs.IntVar(&o.targetShards, "target-num-shards", 0, "shard count of the target cluster (required)")
+	fs.IntVar(&o.batch, "batch", 500, "cells read per partition query")
+	cmd.MarkFlagRequired("target-shards")
+	cmd.MarkFlagRequired("target-num-shards")
+	return cmd
+}
+
+// runReshard copies every cell from the cluster described by the environment
+// into a target cluster with a different shard count or backend layout.
+// Cells already present on the target are skipped, so an interrupted run can
+// simply be restarted. Copied cells get a fresh added_id and created_at.
+// Aliases are copied too, to the target shards their names hash to.
+func runReshard(o reshardOptions) int {
+	if o.targetShards <= 0 {
+		fmt.Fprintln(os.Stderr, "reshard: --target-num-shards must be positive")
+		return 2
+	}
+
+	cfg := config.Load()
+	logger := newLogger(cfg.LogLevel)
+	ctx := context.Background()
+
+	srcCfg, err := config.LoadShardConfig(cfg.ShardConfigPath, cfg.NumShards)
+	if err != nil {
+		logger.Error("failed to load shard config", "error", err)
+		return 1
+	}
+	dstCfg, err := config.LoadShardConfig(o.targetPath, o.targetShards)
+	if err != nil {
+		logger.Error("failed to load target shard config", "error", err)
+		return 1
+	}
+	if err := checkDistinctBackends(srcCfg, dstCfg); err != nil {
+		fmt.Fprintln(os.Stderr, "reshard:", err)
+		return 2
+	}
+
+	srcPools, err := openBackends(ctx, cfg, srcCfg, logger)
+	if err != nil {
+		logger.Error("failed to open source backends", "error", err)
+		return 1
+	}
+	defer closeBackends(srcPools, logger)
+	dstPools, err := openBackends(ctx, cfg, dstCfg, logger)
+	if err != nil {
+		logger.Error("failed to open target backends", "error", err)
+		return 1
+	}
+	defer closeBackends(dstPools, logger)
+
+	if err := migrateShards(ctx, cfg, dstCfg, dstPools, logger); err != nil {
+		logger.Error("failed to migrate target", "error", err)
+		return 1
+	}
+
+	// Cells are scanned from the source and placed with the target's hash,
+	// so a reshard can also move a cluster onto another hash.
+	src := newShardRouter(cfg, srcCfg, srcPools)
+	dst := newShardRouter(cfg, dstCfg, dstPools)
+
+	var copied, skipped, aliases int
+	for i := range cfg.NumShards {
+		store, err := src.StoreFor(shard.ID(i))
+		if err != nil {
+			logger.Error("shard routing failed", "shard_id", i, "error", err)
+			return 1
+		}
+		var after int64
+		for {
+			cells, err := store.PartitionRead(ctx, i, storage.PartitionReadTypeAddedID, after, time.Time{}, o.batch)
+			if err != nil {
+				logger.Error("failed to read source shard", "shard_id", i, "error", err)
+				return 1
+			}
+			for _, c := range cells {
+				target, err := dst.StoreFor(dst.ForRowKey(c.RowKey, o.targetShards))
+				if err != nil {
+					logger.Error("target shard routing failed", "row_key", c.RowKey, "error", err)
+					return 1
+				}
+				_, err = storage.CopyCell(ctx, store, target, c)
+				switch {
+				case errors.Is(err, storage.ErrCellExists):
+					skipped++
+				case err != nil:
+					logger.Error("failed to write cell to target", "row_key", c.RowKey, "column_name", c.ColumnName, "ref_key", c.RefKey, "error", err)
+					return 1
+				default:
+					copied++
+				}
+				// Tag indexes are per shard, so they are rebuilt from the
+				// metadata, whose versions arrive in order, rather than copied.
+				if c.ColumnName == cell.MetaColumn {
+					if err := reindexTags(ctx, target, c); err != nil {
+						logger.Error("failed to index row tags on target", "row_key", c.RowKey, "error", err)
+						return 1
+					}
+				}
+				after = c.AddedID
+			}
+			if len(cells) < o.batch {
+				break
+			}
+		}
+		n, err := copyAliases(ctx, store, dst, o.targetShards, o.batch)
+		aliases += n
+		if err != nil {
+			logger.Error("failed to copy aliases", "shard_id", i, "error", err)
+			return 1
+		}
+		logger.Info("shard copied", "shard_id", i, "copied", copied, "skipped", skipped, "aliases", aliases)
+	}
+
+	logger.Info("reshard complete", "copied", copied, "skipped", skipped, "aliases", aliases,
+		"hint", "run `mezzanine reindex` against the target cluster to rebuild its indexes")
+	return 0
+}
+
+// copyAliases registers the aliases of src, a source shard, on the target
+// shards of dst their names hash to, and returns how many it copied. An
+// alias already naming the same row on the target is left as is.
+func copyAliases(ctx context.Context, src storage.CellStore, dst *shard.Router, numShards, batch int) (int, error) {
+	var copied int
+	var after string
+	for {
+		aliases, err := storage.ListAliases(ctx, src, after, batch)
+		if errors.Is(err, storage.ErrAliasesUnsupported) {
+			return copied, nil
+		}
+		if err != nil {
+			return copied, err
+		}
+		for _, a := range aliases {
+			target, err := dst.StoreFor(dst.ForKey(a.Alias, numShards))
+			if err != nil {
+				return copied, err
+			}
+			if _, err := storage.PutAlias(ctx, target, a.Alias, a.RowKey); err != nil {
+				return copied, fmt.Errorf("alias %q: %w", a.Alias, err)
+			}
+			copied++
+			after = a.Alias
+		}
+		if len(aliases) < batch {
+			return copied, nil
+		}
+	}
+}
+
+// reindexTags indexes the tags of a row's metadata cell on store.
+func reindexTags(ctx context.Context, store storage.CellStore, c cell.Cell) error {
+	tags, err := cell.MetaTags(c.Body)
+	if err != nil {
+		return err
+	}
+	if err := storage.SetRowTags(ctx, store, c.RowKey, tags); err != nil && !errors.Is(err, storage.ErrTagsUnsupported) {
+		return err
+	}
+	return nil
+}
+
+// checkDistinctBackends refuses to reshard onto a database the source already
+// uses: shard tables are named by number only, so the layouts would collide.
+func checkDistinctBackends(src, dst *config.ShardConfig) error {
+	urls := make(map[string]string, len(src.Backends))
+	for _, b := range src.Backends {
+		if b.DatabaseURL != "" {
+			urls[b.DatabaseURL] = b.Name
+		}
+	}
+	for _, b := range dst.Backends {
+		if name, ok := urls[b.DatabaseURL]; ok {
+			return fmt.Errorf("target backend %q uses the same database as source backend %q", b.Name, name)
+		}
+	}
+	return nil
+}
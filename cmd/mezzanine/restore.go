@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ryanbastic/go-mezzanine/internal/backup"
+	"github.com/ryanbastic/go-mezzanine/internal/config"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// restoreOptions holds the flags of the restore command.
+type restoreOptions struct {
+	from        string
+	pgRestore   string
+	skipReindex bool
+	batch       int
+}
+
+// restoreCommand parses the restore flags and runs runRestore.
+func restoreCommand() *cobra.Command {
+	var o restoreOptions
+	cmd := &cobra.Command{
+		Use:   "restore",
+		Short: "Restore a backup to its marker and rebuild indexes",
+		Args:  cobra.NoArgs,
+		Run:   run(func() int { return runRestore(o) }),
+	}
+	fs := cmd.Flags()
+	fs.StringVar(&o.from, "from", "", "backup directory written by mezzanine backup (required)")
+	fs.StringVar(&o.pgRestore, "pg-restore", "pg_restore", "path to the pg_restore binary")
+	fs.BoolVar(&o.skipReindex, "skip-reindex", false, "do not rebuild index tables after restoring")
+	fs.IntVar(&o.batch, "batch", 500, "cells read per scan query when rebuilding indexes")
+	cmd.MarkFlagRequired("from")
+	return cmd
+}
+
+// runRestore pg_restores every backend archive of a backup, trims each shard
+// back to the manifest's consistency marker, recreates index tables and
+// rebuilds every index from the restored cells.
+func runRestore(o restoreOptions) int {
+	cfg := config.Load()
+	logger := newLogger(cfg.LogLevel)
+	ctx := context.Background()
+
+	manifest, err := backup.ReadManifest(o.from)
+	if err != nil {
+		logger.Error("failed to read backup", "error", err)
+		return 1
+	}
+	shardCfg, err := config.LoadShardConfig(cfg.ShardConfigPath, cfg.NumShards)
+	if err != nil {
+		logger.Error("failed to load shard config", "error", err)
+		return 1
+	}
+	if err := checkRestoreTarget(manifest, shardCfg, cfg.NumShards); err != nil {
+		fmt.Fprintln(os.Stderr, "restore:", err)
+		return 1
+	}
+	pools, err := openBackends(ctx, cfg, shardCfg, logger)
+	if err != nil {
+		logger.Error("failed to open backends", "error", err)
+		return 1
+	}
+	defer closeBackends(pools, logger)
+
+	backends := make(map[string]config.BackendConfig, len(shardCfg.Backends))
+	for _, b := range shardCfg.Backends {
+		backends[b.Name] = b
+	}
+	for _, dump := range manifest.Backends {
+		b := backends[dump.Name]
+		dbURL, err := resolveBackendURL(ctx, b)
+		if err != nil {
+			logger.Error("failed to resolve database URL", "error", err)
+			return 1
+		}
+		logger.Info("restoring backend", "backend", b.Name, "file", dump.File)
+		// Dumped shard tables carry their latest-cells and commit log
+		// triggers, if any, and draw added_id through
+		// mezzanine_next_added_id.
+		if err := storage.CreateLatestCellsFunction(ctx, pools[b.Name]); err != nil {
+			logger.Error("failed to restore backend", "backend", b.Name, "error", err)
+			return 1
+		}
+		if err := storage.CreateCommitLogFunction(ctx, pools[b.Name]); err != nil {
+			logger.Error("failed to restore backend", "backend", b.Name, "error", err)
+			return 1
+		}
+		if err := storage.CreateNextAddedIDFunction(ctx, pools[b.Name]); err != nil {
+			logger.Error("failed to restore backend", "backend", b.Name, "error", err)
+			return 1
+		}
+		if err := backup.Run(ctx, o.pgRestore, dbURL, backup.RestoreArgs(filepath.Join(o.from, dump.File))); err != nil {
+			logger.Error("failed to restore backend", "backend", b.Name, "error", err)
+			return 1
+		}
+
+		// Drop anything the dump captured after the markers were taken.
+		var trimmed int64
+		for i := dump.ShardStart; i <= dump.ShardEnd; i++ {
+			n, err := backup.TrimAfter(ctx, pools[b.Name], i, manifest.Markers[i])
+			if err != nil {
+				logger.Error("failed to trim shard", "backend", b.Name, "error", err)
+				return 1
+			}
+			trimmed += n
+			if err := storage.RebuildLatestCells(ctx, pools[b.Name], i); err != nil {
+				logger.Error("failed to rebuild latest cells", "backend", b.Name, "error", err)
+				return 1
+			}
+			if err := storage.RebuildCommitLog(ctx, pools[b.Name], i); err != nil {
+				logger.Error("failed to rebuild commit log", "backend", b.Name, "error", err)
+				return 1
+			}
+		}
+		logger.Info("backend restored", "backend", b.Name, "trimmed", trimmed)
+	}
+
+	if manifest.Metadata != nil {
+		dbURL, err := resolveBackendURL(ctx, shardCfg.Metadata.Backend())
+		if err != nil {
+			logger.Error("failed to resolve database URL", "error", err)
+			return 1
+		}
+		logger.Info("restoring metadata database", "file", manifest.Metadata.File)
+		if err := backup.Run(ctx, o.pgRestore, dbURL, backup.RestoreArgs(filepath.Join(o.from, manifest.Metadata.File))); err != nil {
+			logger.Error("failed to restore metadata database", "error", err)
+			return 1
+		}
+	}
+
+	registry, err := newIndexRegistry(cfg, shardCfg, pools, logger)
+	if err != nil {
+		logger.Error("failed to load index config", "error", err)
+		return 1
+	}
+	views, err := newViewRegistry(cfg, shardCfg, pools, logger)
+	if err != nil {
+		logger.Error("failed to load view config", "error", err)
+		return 1
+	}
+	if err := migrateAll(ctx, cfg, shardCfg, pools, registry, views, logger); err != nil {
+		logger.Error("migration failed", "error", err)
+		return 1
+	}
+
+	defs := registry.Definitions()
+	if o.skipReindex || len(defs) == 0 {
+		logger.Info("restore complete", "as_of", manifest.CreatedAt)
+		return 0
+	}
+	router := newShardRouter(cfg, shardCfg, pools)
+	indexed, failed, err := rebuildIndexes(ctx, cfg, shardCfg, pools, router, registry, defs, o.batch, logger)
+	if err != nil {
+		logger.Error("failed to rebuild indexes", "error", err)
+		return 1
+	}
+	logger.Info("restore complete", "as_of", manifest.CreatedAt, "index_entries", indexed, "index_failures", failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// checkRestoreTarget verifies the configured cluster has the same shard
+// layout as the backup. Restoring into a different layout is a reshard.
+func checkRestoreTarget(m *backup.Manifest, shardCfg *config.ShardConfig, numShards int) error {
+	if m.NumShards != numShards {
+		return fmt.Errorf("backup has %d shards but NUM_SHARDS is %d; restore with the original layout, then reshard", m.NumShards, numShards)
+	}
+	if m.ShardHash != shardCfg.Hash {
+		return fmt.Errorf("backup keys were placed with the shard hash %s but the shard config has %s; restore with the original hash, then reshard", m.ShardHash, shardCfg.Hash)
+	}
+	ranges := make(map[string][2]int, len(shardCfg.Backends))
+	for _, b := range shardCfg.Backends {
+		ranges[b.Name] = [2]int{b.ShardStart, b.ShardEnd}
+	}
+	for _, dump := range m.Backends {
+		r, ok := ranges[dump.Name]
+		if !ok {
+			return fmt.Errorf("backup backend %q is not in the shard config", dump.Name)
+		}
+		if r != [2]int{dump.ShardStart, dump.ShardEnd} {
+			return fmt.Errorf("backend %q owns shards %d-%d but the backup has %d-%d", dump.Name, r[0], r[1], dump.ShardStart, dump.ShardEnd)
+		}
+	}
+	if len(m.Backends) != len(shardCfg.Backends) {
+		return fmt.Errorf("backup has %d backends but the shard config has %d", len(m.Backends), len(shardCfg.Backends))
+	}
+	if (m.Metadata != nil) != (shardCfg.Metadata != nil) {
+		if m.Metadata != nil {
+			return errors.New("backup has a metadata database but the shard config does not")
+		}
+		return errors.New("shard config has a metadata database but the backup does not")
+	}
+	return nil
+}
@@ -0,0 +1,677 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/ryanbastic/go-mezzanine/internal/accounting"
+	"github.com/ryanbastic/go-mezzanine/internal/admin"
+	"github.com/ryanbastic/go-mezzanine/internal/api"
+	"github.com/ryanbastic/go-mezzanine/internal/apikey"
+	"github.com/ryanbastic/go-mezzanine/internal/cache"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/coalesce"
+	"github.com/ryanbastic/go-mezzanine/internal/column"
+	"github.com/ryanbastic/go-mezzanine/internal/compaction"
+	"github.com/ryanbastic/go-mezzanine/internal/config"
+	"github.com/ryanbastic/go-mezzanine/internal/export"
+	"github.com/ryanbastic/go-mezzanine/internal/fault"
+	"github.com/ryanbastic/go-mezzanine/internal/fence"
+	"github.com/ryanbastic/go-mezzanine/internal/httpserver"
+	"github.com/ryanbastic/go-mezzanine/internal/leader"
+	"github.com/ryanbastic/go-mezzanine/internal/lease"
+	"github.com/ryanbastic/go-mezzanine/internal/lifecycle"
+	"github.com/ryanbastic/go-mezzanine/internal/metrics"
+	"github.com/ryanbastic/go-mezzanine/internal/objstore"
+	"github.com/ryanbastic/go-mezzanine/internal/offload"
+	"github.com/ryanbastic/go-mezzanine/internal/replication"
+	"github.com/ryanbastic/go-mezzanine/internal/schema"
+	"github.com/ryanbastic/go-mezzanine/internal/search"
+	"github.com/ryanbastic/go-mezzanine/internal/shadow"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+	"github.com/ryanbastic/go-mezzanine/internal/stream"
+	"github.com/ryanbastic/go-mezzanine/internal/tablehealth"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+	"github.com/spf13/cobra"
+)
+
+// serveCommand runs runServe; it takes no flags.
+func serveCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "serve",
+		Short: "Run the HTTP API server (default)",
+		Args:  cobra.NoArgs,
+		Run:   run(runServe),
+	}
+}
+
+// runServe runs migrations (unless MIGRATE_ON_START=false), wires up the stores and registries, and serves
+// the HTTP API until SIGINT/SIGTERM.
+func runServe() int {
+	cfg := config.Load()
+	logger := newLogger(cfg.LogLevel)
+
+	// Settings validate rejects, such as a non-positive refresh interval,
+	// would fail later and less clearly, if at all.
+	var report config.Report
+	report.ValidateEnv(cfg)
+	if report.HasErrors() {
+		report.Write(os.Stderr)
+		return 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Load shard config
+	shardCfg, err := config.LoadShardConfig(cfg.ShardConfigPath, cfg.NumShards)
+	if err != nil {
+		logger.Error("failed to load shard config", "error", err)
+		return 1
+	}
+
+	// Create one pool per backend, ping each
+	pools, err := openRequestBackends(ctx, cfg, shardCfg, logger)
+	if err != nil {
+		logger.Error("failed to open backends", "error", err)
+		return 1
+	}
+	defer closeBackends(pools, logger)
+
+	// Register pgxpool metrics collector
+	prometheus.MustRegister(metrics.NewPoolCollector(pools))
+	logger.Info("registered pool metrics collector")
+
+	// Build shard-to-pool mapping and register stores
+	router := newShardRouter(cfg, shardCfg, pools)
+	heads := newHeadNotifier(cfg, router, logger)
+
+	// Initialize index registry
+	indexRegistry, err := newIndexRegistry(cfg, shardCfg, pools, logger)
+	if err != nil {
+		logger.Error("failed to load index config", "error", err)
+		return 1
+	}
+	viewRegistry, err := newViewRegistry(cfg, shardCfg, pools, logger)
+	if err != nil {
+		logger.Error("failed to load view config", "error", err)
+		return 1
+	}
+
+	if cfg.ShardTableCheck {
+		if err := checkShardTables(ctx, shardCfg, pools, cfg.MigrateOnStart, logger); err != nil {
+			logger.Error("shard table check failed", "error", err)
+			return 1
+		}
+	}
+
+	if cfg.MigrateOnStart {
+		logger.Info("running migrations")
+		if err := migrateOnStart(ctx, cfg, shardCfg, logger, func(pools map[string]*pgxpool.Pool) error {
+			return migrateAll(ctx, cfg, shardCfg, pools, indexRegistry, viewRegistry, logger)
+		}); err != nil {
+			logger.Error("migration failed", "error", err)
+			return 1
+		}
+	} else {
+		logger.Info("skipping migrations (MIGRATE_ON_START=false)")
+	}
+	if err := checkShardHash(ctx, shardCfg, pools); err != nil {
+		logger.Error("shard hash check failed", "error", err)
+		return 1
+	}
+
+	// Initialize trigger plugin system with persistent storage, in the
+	// metadata database (or the first backend, without one).
+	plugins := metadataPool(shardCfg, pools)
+	pluginStore := trigger.NewPostgresPluginStore(plugins, cfg.DBQueryTimeout)
+	pluginRegistry := trigger.NewPluginRegistry(pluginStore)
+	if err := pluginRegistry.LoadAll(ctx); err != nil {
+		logger.Error("failed to load plugins from store", "error", err)
+		return 1
+	}
+	logger.Info("plugin registry loaded", "count", len(pluginRegistry.List()))
+	streamRegistry := stream.NewRegistry(stream.NewPostgresStore(plugins, cfg.DBQueryTimeout))
+	if err := streamRegistry.LoadAll(ctx); err != nil {
+		logger.Error("failed to load streams", "error", err)
+		return 1
+	}
+	for _, s := range streamRegistry.List() {
+		if err := s.CheckColumns(); err != nil {
+			logger.Warn("stream selects a column that writes refuse; recreate it", "stream", s.Name, "error", err)
+		}
+	}
+	schemaRegistry := schema.NewRegistry(schema.NewPostgresStore(plugins, cfg.DBQueryTimeout))
+	if err := schemaRegistry.LoadAll(ctx); err != nil {
+		logger.Error("failed to load schemas", "error", err)
+		return 1
+	}
+	columnRegistry := column.NewRegistry(column.NewPostgresStore(plugins, cfg.DBQueryTimeout))
+	columnRegistry.SetTopK(cfg.ColumnTopK)
+	if err := columnRegistry.LoadAll(ctx); err != nil {
+		logger.Error("failed to load column registry", "error", err)
+		return 1
+	}
+	fenceRegistry := fence.NewRegistry(fence.NewPostgresStore(plugins, cfg.DBQueryTimeout))
+	if err := fenceRegistry.LoadAll(ctx); err != nil {
+		logger.Error("failed to load write fences", "error", err)
+		return 1
+	}
+
+	// Replication and shadow writes resolve offloaded bodies too.
+	var offloader *offload.Offloader
+	if cfg.BodyOffloadURL != "" {
+		bucket, err := objstore.NewS3Bucket(cfg.BodyOffloadURL, &http.Client{Timeout: cfg.BodyOffloadTimeout})
+		if err != nil {
+			logger.Error("failed to configure body offload bucket", "error", err)
+			return 1
+		}
+		bucket.ContentType = "application/json"
+		offloader = offload.New(bucket, cfg.BodyOffloadURL, cfg.BodyOffloadThreshold)
+		logger.Info("body offloading enabled", "url", cfg.BodyOffloadURL, "threshold", cfg.BodyOffloadThreshold)
+	}
+
+	// Background components are started together once the servers are
+	// built, and stopped in reverse dependency order on shutdown.
+	components := lifecycle.New(cfg.ShutdownComponentTimeout, logger)
+	components.Add(lifecycle.Component{ //nolint:errcheck
+		Name: "column-registry",
+		Run: func(ctx context.Context) error {
+			columnRegistry.Run(ctx, cfg.ColumnStatsFlushInterval, logger)
+			return nil
+		},
+		Stop: columnRegistry.Flush,
+	})
+	components.Add(lifecycle.Component{ //nolint:errcheck
+		Name: "write-fences",
+		Run: func(ctx context.Context) error {
+			fenceRegistry.Run(ctx, cfg.FenceRefreshInterval, logger)
+			return nil
+		},
+	})
+	components.Add(lifecycle.Component{ //nolint:errcheck
+		Name: "plugin-registry",
+		Run: func(ctx context.Context) error {
+			pluginRegistry.Run(ctx, cfg.TriggerPluginRefreshInterval, logger)
+			return nil
+		},
+	})
+	// The servers depend on everything they hand requests to.
+	serverDeps := []string{"column-registry", "write-fences", "plugin-registry", "trigger-notifier"}
+	if heads != nil {
+		components.Add(lifecycle.Component{ //nolint:errcheck
+			Name: "head-notifier",
+			Run: func(ctx context.Context) error {
+				heads.Run(ctx)
+				return nil
+			},
+		})
+		serverDeps = append(serverDeps, "head-notifier")
+	}
+
+	// Per-shard background work is divided among instances by lease.
+	var shardLeases *lease.Coordinator
+	if cfg.ShardLeases {
+		shardLeases = lease.New(lease.NewPostgresStore(plugins, cfg.DBQueryTimeout), lease.Options{NumShards: cfg.NumShards, TTL: cfg.ShardLeaseTTL}, logger)
+		components.Add(lifecycle.Component{Name: "shard-leases", Run: shardLeases.Run}) //nolint:errcheck
+		logger.Info("shard leases enabled", "node", shardLeases.Node(), "ttl", cfg.ShardLeaseTTL)
+	}
+	// Replication tails the shards, so with shard leases each instance
+	// replicates the shards it holds; otherwise one elected instance
+	// replicates them all.
+	if cfg.ReplicationURL != "" {
+		target := shadow.NewHTTPTarget(cfg.ReplicationURL, cfg.ReplicationAPIKey)
+		target.ResolveOffloaded(offloader)
+		replicator := replication.New(router, target,
+			storage.NewPostgresCheckpoints(plugins, storage.ReplicationCheckpoints, cfg.DBQueryTimeout), replication.Options{
+				Name:         cfg.ReplicationName,
+				NumShards:    cfg.NumShards,
+				BatchSize:    cfg.ReplicationBatchSize,
+				PollInterval: cfg.ReplicationPollInterval,
+				Settle:       cfg.ReplicationSettle,
+				Concurrency:  cfg.ReplicationConcurrency,
+				Timeout:      cfg.DBQueryTimeout,
+			}, logger)
+		if shardLeases != nil {
+			shardLeases.Handle(replicator.RunShard)
+		} else {
+			elector := leader.New(plugins, "replication/"+cfg.ReplicationName, 0, logger)
+			components.Add(lifecycle.Component{ //nolint:errcheck
+				Name: "replication",
+				Run: func(ctx context.Context) error {
+					return elector.Run(ctx, replicator.Run)
+				},
+			})
+		}
+		logger.Info("replication enabled", "url", cfg.ReplicationURL, "name", cfg.ReplicationName, "shard_leases", shardLeases != nil)
+	}
+	// The export to object storage is divided among instances the same way.
+	if cfg.ExportURL != "" {
+		bucket, err := export.NewS3Bucket(cfg.ExportURL, &http.Client{Timeout: cfg.ExportTimeout})
+		if err != nil {
+			logger.Error("failed to configure export bucket", "error", err)
+			return 1
+		}
+		exporter := export.New(router, bucket, storage.NewPostgresCheckpoints(plugins, storage.ExportCheckpoints, cfg.DBQueryTimeout), export.Options{
+			Name:        cfg.ExportName,
+			NumShards:   cfg.NumShards,
+			BatchSize:   cfg.ExportBatchSize,
+			MaxFileRows: cfg.ExportMaxFileRows,
+			Settle:      cfg.ExportSettle,
+			Concurrency: cfg.ExportConcurrency,
+		}, logger)
+		if shardLeases != nil {
+			shardLeases.Handle(exporter.RunShard)
+		} else {
+			elector := leader.New(plugins, "export/"+cfg.ExportName, 0, logger)
+			components.Add(lifecycle.Component{ //nolint:errcheck
+				Name: "export",
+				Run: func(ctx context.Context) error {
+					return elector.Run(ctx, exporter.Run)
+				},
+			})
+		}
+		logger.Info("export enabled", "url", cfg.ExportURL, "name", cfg.ExportName, "shard_leases", shardLeases != nil)
+	}
+	// So is search indexing.
+	if cfg.SearchURL != "" {
+		if cfg.SearchConfigPath == "" {
+			logger.Error("SEARCH_URL needs SEARCH_CONFIG_PATH")
+			return 1
+		}
+		searchCfg, err := search.Load(cfg.SearchConfigPath)
+		if err != nil {
+			logger.Error("failed to load search config", "error", err)
+			return 1
+		}
+		target, err := search.NewElasticTarget(cfg.SearchURL, cfg.SearchAPIKey, &http.Client{})
+		if err != nil {
+			logger.Error("failed to configure search cluster", "error", err)
+			return 1
+		}
+		indexer := search.New(router, target, storage.NewPostgresCheckpoints(plugins, storage.SearchCheckpoints, cfg.DBQueryTimeout), searchCfg, search.Options{
+			Name:         cfg.SearchName,
+			NumShards:    cfg.NumShards,
+			BatchSize:    cfg.SearchBatchSize,
+			PollInterval: cfg.SearchPollInterval,
+			Settle:       cfg.SearchSettle,
+			Concurrency:  cfg.SearchConcurrency,
+		}, logger)
+		if shardLeases != nil {
+			shardLeases.Handle(indexer.RunShard)
+		} else {
+			elector := leader.New(plugins, "search/"+cfg.SearchName, 0, logger)
+			components.Add(lifecycle.Component{ //nolint:errcheck
+				Name: "search",
+				Run: func(ctx context.Context) error {
+					return elector.Run(ctx, indexer.Run)
+				},
+			})
+		}
+		logger.Info("search indexing enabled", "columns", len(searchCfg.Columns), "name", cfg.SearchName, "shard_leases", shardLeases != nil)
+	}
+	// Garbage collection of superseded versions is divided the same way. It
+	// keeps the cells that the notifier's checkpoints hold for plugins, and
+	// those replication streams and exports have yet to read, whether or not
+	// this instance runs them.
+	triggerCheckpoints := trigger.NewPostgresCheckpointStore(plugins, cfg.DBQueryTimeout)
+	if cfg.CompactionEnabled {
+		poolFor := func(shardID int) *pgxpool.Pool { return pools[shardCfg.BackendFor(shardID)] }
+		readers := []compaction.Readers{
+			storage.NewPostgresCheckpoints(plugins, storage.ReplicationCheckpoints, cfg.DBQueryTimeout),
+			storage.NewPostgresCheckpoints(plugins, storage.ExportCheckpoints, cfg.DBQueryTimeout),
+		}
+		compactor := compaction.New(columnRegistry, compaction.NewPostgresStore(poolFor, cfg.DBQueryTimeout), triggerCheckpoints, readers, compaction.Options{
+			NumShards:    cfg.NumShards,
+			SafetyWindow: cfg.CompactionSafetyWindow,
+			Interval:     cfg.CompactionInterval,
+			BatchSize:    cfg.CompactionBatchSize,
+		}, logger)
+		if shardLeases != nil {
+			shardLeases.Handle(compactor.RunShard)
+		} else {
+			elector := leader.New(plugins, "compaction", 0, logger)
+			components.Add(lifecycle.Component{ //nolint:errcheck
+				Name: "compaction",
+				Run: func(ctx context.Context) error {
+					return elector.Run(ctx, compactor.Run)
+				},
+			})
+		}
+		logger.Info("garbage collection enabled", "safety_window", cfg.CompactionSafetyWindow, "interval", cfg.CompactionInterval, "shard_leases", shardLeases != nil)
+	}
+	if cfg.TableHealthEnabled {
+		poolFor := func(shardID int) *pgxpool.Pool { return pools[shardCfg.BackendFor(shardID)] }
+		advisor := tablehealth.New(tablehealth.NewPostgresStore(poolFor, cfg.DBQueryTimeout), tablehealth.Options{
+			NumShards:      cfg.NumShards,
+			Interval:       cfg.TableHealthInterval,
+			DeadPercent:    cfg.TableHealthDeadPercent,
+			AnalyzePercent: cfg.TableHealthAnalyzePercent,
+			MinRows:        int64(cfg.TableHealthMinRows),
+			AutoAnalyze:    cfg.TableHealthAutoAnalyze,
+		}, logger)
+		if shardLeases != nil {
+			shardLeases.Handle(advisor.RunShard)
+		} else {
+			elector := leader.New(plugins, "table_health", 0, logger)
+			components.Add(lifecycle.Component{ //nolint:errcheck
+				Name: "table_health",
+				Run: func(ctx context.Context) error {
+					return elector.Run(ctx, advisor.Run)
+				},
+			})
+		}
+		logger.Info("table health advisor enabled", "interval", cfg.TableHealthInterval, "auto_analyze", cfg.TableHealthAutoAnalyze, "shard_leases", shardLeases != nil)
+	}
+	// Counting usage sums every shard, so it runs on one elected instance
+	// even with shard leases.
+	if cfg.UsageCountEnabled {
+		poolFor := func(shardID int) *pgxpool.Pool { return pools[shardCfg.BackendFor(shardID)] }
+		counter := accounting.New(columnRegistry, accounting.NewPostgresStore(poolFor), accounting.Options{
+			NumShards: cfg.NumShards,
+			Interval:  cfg.UsageCountInterval,
+		}, logger)
+		elector := leader.New(plugins, "usage_count", 0, logger)
+		components.Add(lifecycle.Component{ //nolint:errcheck
+			Name: "usage_count",
+			Run: func(ctx context.Context) error {
+				return elector.Run(ctx, counter.Run)
+			},
+		})
+		logger.Info("column usage counting enabled", "interval", cfg.UsageCountInterval)
+	}
+	rpcClient := trigger.NewRPCClient(cfg.TriggerRetryMax, cfg.TriggerRetryBackoff, cfg.TriggerRPCTimeout)
+	transportOpts := trigger.TransportOptions{
+		MaxIdleConnsPerHost: cfg.TriggerMaxIdleConnsPerHost,
+		IdleConnTimeout:     cfg.TriggerIdleConnTimeout,
+		DialTimeout:         cfg.TriggerDialTimeout,
+		TLSHandshakeTimeout: cfg.TriggerTLSHandshakeTimeout,
+		DisableHTTP2:        !cfg.TriggerHTTP2,
+		H2C:                 cfg.TriggerH2C,
+	}
+	if cfg.TriggerProxyURL != "" {
+		proxy, err := url.Parse(cfg.TriggerProxyURL)
+		if err != nil {
+			logger.Error("invalid TRIGGER_PROXY_URL", "error", err)
+			return 1
+		}
+		transportOpts.Proxy = proxy
+	}
+	rpcTransport := trigger.NewTransport(transportOpts)
+	rpcClient.SetTransport(rpcTransport)
+	if cfg.TriggerSigningSecret != "" {
+		rpcClient.SetSigningSecret([]byte(cfg.TriggerSigningSecret))
+	}
+	rpcClient.SetHostLimits(cfg.TriggerHostMaxInflight, cfg.TriggerHostMaxQueue)
+
+	// The cache is installed first so it is outermost: hits skip the other
+	// interceptors and the database entirely.
+	if cfg.CacheMaxBytes > 0 {
+		cacheOpts := cache.Options{MaxBytes: cfg.CacheMaxBytes, TTL: cfg.CacheTTL, PrimeWrites: cfg.CachePrimeWrites}
+		var notifier *cache.PGNotifier
+		if cfg.CacheInvalidation {
+			notifier = cache.NewPGNotifier(shardPools(shardCfg, pools), shardCfg.BackendFor, logger)
+			cacheOpts.Broadcaster = notifier
+		}
+		readCache := cache.New(cacheOpts)
+		if notifier != nil {
+			components.Add(lifecycle.Component{ //nolint:errcheck
+				Name: "cache-invalidation",
+				Run: func(ctx context.Context) error {
+					notifier.Listen(ctx, readCache)
+					return nil
+				},
+			})
+			serverDeps = append(serverDeps, "cache-invalidation")
+		}
+		router.Use(readCache.Interceptor())
+		logger.Info("read cache enabled", "max_bytes", cfg.CacheMaxBytes, "ttl", cfg.CacheTTL, "invalidation", cfg.CacheInvalidation, "prime_writes", cfg.CachePrimeWrites)
+	}
+
+	// Inside the cache, whose hits it has no reason to see, and outside
+	// everything else, so that fenced writes are neither mirrored nor
+	// coalesced.
+	router.Use(fenceRegistry.Interceptor())
+
+	// Inside the cache, so that only writes that reach the store are
+	// mirrored, and outside fault injection, which then fails them first.
+	if cfg.ShadowWritesURL != "" || cfg.ShadowShardConfigPath != "" {
+		target, closeTarget, err := newShadowTarget(ctx, cfg, shardCfg, offloader, logger)
+		if err != nil {
+			logger.Error("failed to set up shadow writes", "error", err)
+			return 1
+		}
+		defer closeTarget()
+		mirror := shadow.New(target, shadow.Options{QueueSize: cfg.ShadowQueueSize, Workers: cfg.ShadowWorkers, Timeout: cfg.DBQueryTimeout}, logger)
+		components.Add(lifecycle.Component{Name: "shadow-writes", Run: mirror.Run, Stop: mirror.Drain}) //nolint:errcheck
+		serverDeps = append(serverDeps, "shadow-writes")
+		router.Use(mirror.Interceptor())
+		logger.Warn("shadow writes enabled: stored writes are mirrored to a secondary cluster", "url", cfg.ShadowWritesURL, "shard_config", cfg.ShadowShardConfigPath)
+	}
+
+	if cfg.FaultConfigPath != "" {
+		faultCfg, err := fault.Load(cfg.FaultConfigPath)
+		if err != nil {
+			logger.Error("failed to load fault config", "error", err)
+			return 1
+		}
+		injector := fault.NewInjector(faultCfg, shardCfg.BackendFor)
+		router.Use(injector.Interceptor())
+		rpcClient.SetTransport(injector.Transport(rpcTransport))
+		logger.Warn("FAULT INJECTION ENABLED: requests will be delayed or fail on purpose", "path", cfg.FaultConfigPath, "rules", len(faultCfg.Rules))
+	}
+	// Installed last so it is innermost: coalesced writes are still seen
+	// individually by the cache and fault interceptors.
+	if cfg.WriteCoalesceWindow > 0 {
+		router.Use(coalesce.Interceptor(coalesce.Options{Window: cfg.WriteCoalesceWindow, MaxBatch: cfg.WriteCoalesceMaxBatch}))
+		logger.Info("write coalescing enabled", "window", cfg.WriteCoalesceWindow, "max_batch", cfg.WriteCoalesceMaxBatch)
+	}
+
+	notifier := trigger.NewNotifier(pluginRegistry, rpcClient, logger)
+	notifier.SetCheckpoints(triggerCheckpoints)
+	notifier.SetStreams(streamRegistry)
+	notifier.SetSchemas(schemaRegistry, trigger.SchemaValidation(cfg.TriggerSchemaValidation))
+	notifier.SetWriteBack(trigger.WriteBackOptions{
+		Router:    router,
+		NumShards: cfg.NumShards,
+		Indexes:   indexRegistry,
+		Columns:   columnRegistry,
+		MaxDepth:  cfg.TriggerMaxDerivationDepth,
+	})
+	notifier.SetSyncTimeout(cfg.TriggerSyncTimeout)
+	if columns := viewRegistry.Columns(); len(columns) > 0 {
+		notifier.AddHandler("views", columns, viewRegistry.HandleCell)
+		logger.Info("materialized views enabled", "views", len(viewRegistry.Definitions()))
+	}
+	components.Add(lifecycle.Component{Name: "trigger-notifier", Stop: notifier.Shutdown}) //nolint:errcheck
+	// The watchdog looks at every plugin's checkpoints, so one elected
+	// instance runs it.
+	if cfg.TriggerWatchdogThreshold > 0 {
+		watchdog := trigger.NewWatchdog(notifier, triggerCheckpoints, router, trigger.WatchdogOptions{
+			Threshold:   cfg.TriggerWatchdogThreshold,
+			MaxAttempts: cfg.TriggerWatchdogMaxAttempts,
+		}, logger)
+		elector := leader.New(plugins, "trigger-watchdog", 0, logger)
+		components.Add(lifecycle.Component{ //nolint:errcheck
+			Name: "trigger-watchdog",
+			Run: func(ctx context.Context) error {
+				return elector.Run(ctx, watchdog.Run)
+			},
+		})
+	}
+
+	// Build backend pinger map for readiness checks. The metadata database
+	// is left out: cells can be served without it.
+	backends := make(map[string]api.Pinger, len(shardCfg.Backends))
+	for name, pool := range shardPools(shardCfg, pools) {
+		backends[name] = pool
+	}
+
+	// Start HTTP server
+	rowKeyFormat := cell.RowKeyFormat(cfg.RowKeyFormat)
+	if !rowKeyFormat.Valid() {
+		logger.Error("invalid ROW_KEY_FORMAT: want uuidv7, ulid or uuidv4", "format", cfg.RowKeyFormat)
+		return 1
+	}
+	serverOpts := api.ServerOptions{
+		Limits: api.Limits{
+			PartitionRead: api.ListLimit{Default: cfg.LimitPartitionReadDefault, Max: cfg.LimitPartitionReadMax},
+			WindowRead:    api.ListLimit{Default: cfg.LimitWindowReadDefault, Max: cfg.LimitWindowReadMax},
+			IndexQuery:    api.ListLimit{Default: cfg.LimitIndexQueryDefault, Max: cfg.LimitIndexQueryMax},
+			RowList:       api.ListLimit{Default: cfg.LimitRowListDefault, Max: cfg.LimitRowListMax},
+			Query:         api.ListLimit{Default: cfg.LimitQueryDefault, Max: cfg.LimitQueryMax},
+		},
+		Scatter:      api.ScatterLimits{MaxShards: cfg.ScatterMaxShards, MaxCells: cfg.ScatterMaxCells},
+		MaxWait:      cfg.PartitionReadMaxWait,
+		ServerTiming: cfg.ServerTiming,
+		RowMetadata:  cfg.RowMetadata,
+		RowKeyFormat: rowKeyFormat,
+		RetryAfter:   cfg.BackendRetryAfter,
+		Body: api.BodyLimits{
+			MaxBytes:           cfg.MaxRequestBodyBytes,
+			MaxBatchBytes:      cfg.MaxBatchBodyBytes,
+			AllowUnknownFields: !cfg.StrictRequestBodies,
+		},
+		Columns:            columnRegistry,
+		TriggerCheckpoints: triggerCheckpoints,
+		Streams:            streamRegistry,
+		Schemas:            schemaRegistry,
+		Views:              viewRegistry,
+	}
+	for _, b := range shardCfg.Backends {
+		serverOpts.ShardBackends = append(serverOpts.ShardBackends, api.ShardBackend{Name: b.Name, ShardStart: b.ShardStart, ShardEnd: b.ShardEnd})
+	}
+	if cfg.MaskHashSecret != "" {
+		serverOpts.MaskHashSecret = []byte(cfg.MaskHashSecret)
+	}
+	serverOpts.Offload = offloader
+	if cfg.APIKeysPath != "" {
+		keysCfg, err := apikey.Load(cfg.APIKeysPath)
+		if err != nil {
+			logger.Error("failed to load api keys", "error", err)
+			return 1
+		}
+		serverOpts.APIKeys = apikey.NewSet(keysCfg)
+		serverOpts.RowACL = api.RowACL(cfg.RowACL)
+		logger.Info("api key authentication enabled", "keys", serverOpts.APIKeys.Len())
+	}
+	handler := api.NewServer(logger, router, indexRegistry, pluginRegistry, notifier, cfg.NumShards, backends, serverOpts)
+	httpOpts := httpserver.Options{
+		ReadTimeout:    cfg.HTTPReadTimeout,
+		WriteTimeout:   cfg.HTTPWriteTimeout,
+		IdleTimeout:    cfg.HTTPIdleTimeout,
+		MaxHeaderBytes: cfg.HTTPMaxHeaderBytes,
+		HTTP2:          cfg.HTTP2Enabled,
+		MaxConns:       cfg.HTTPMaxConns,
+	}
+	shedder := api.NewLoadShedder(api.ShedLimits{
+		Reads:      cfg.ShedMaxReads,
+		Writes:     cfg.ShedMaxWrites,
+		Admin:      cfg.ShedMaxAdmin,
+		RetryAfter: cfg.ShedRetryAfter,
+	})
+	drainer := httpserver.NewDrainer("/v1/readyz", "/v1/health")
+	timeouts := api.RequestTimeouts(api.Timeouts{
+		Read:  cfg.RequestTimeoutRead,
+		Write: cfg.RequestTimeoutWrite,
+		Scan:  cfg.RequestTimeoutScan,
+	})
+	srv := httpserver.New(":"+cfg.Port, drainer.Middleware(shedder.Middleware(timeouts(handler))), httpOpts)
+	ln, err := httpserver.Listen(srv.Addr, httpOpts)
+	if err != nil {
+		logger.Error("failed to listen", "port", cfg.Port, "error", err)
+		return 1
+	}
+
+	// Admin dashboard on its own listener, if enabled.
+	var adminSrv *http.Server
+	if cfg.AdminPort != "" {
+		adminBackends := make([]admin.Backend, len(shardCfg.Backends))
+		for i, b := range shardCfg.Backends {
+			adminBackends[i] = admin.Backend{Name: b.Name, ShardStart: b.ShardStart, ShardEnd: b.ShardEnd, Pool: pools[b.Name]}
+		}
+		adminSrv = &http.Server{
+			Addr: ":" + cfg.AdminPort,
+			Handler: shedder.MiddlewareFor(api.ClassAdmin)(admin.NewHandler(admin.Options{
+				Backends:  adminBackends,
+				NumShards: cfg.NumShards,
+				Indexes:   indexRegistry,
+				Columns:   columnRegistry,
+				Fences:    fenceRegistry,
+				Leases:    shardLeases,
+				Plugins:   pluginRegistry,
+				Notifier:  notifier,
+				Logger:    logger,
+			})),
+			ReadTimeout:  cfg.HTTPReadTimeout,
+			WriteTimeout: cfg.HTTPWriteTimeout,
+			IdleTimeout:  cfg.HTTPIdleTimeout,
+		}
+		// Added before the API server so it stops after it. An admin
+		// listener that fails is logged but does not stop the server.
+		components.Add(lifecycle.Component{ //nolint:errcheck
+			Name: "admin-http",
+			Run: func(context.Context) error {
+				logger.Info("starting admin server", "port", cfg.AdminPort)
+				if err := adminSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					logger.Error("admin server error", "error", err)
+				}
+				return nil
+			},
+			Stop:      adminSrv.Shutdown,
+			Timeout:   cfg.HTTPShutdownTimeout,
+			DependsOn: serverDeps,
+		})
+	}
+
+	// Drain before stopping: readiness fails and keep-alive connections are
+	// closed so load balancers and clients move away without seeing resets.
+	components.Add(lifecycle.Component{ //nolint:errcheck
+		Name: "http",
+		Run: func(context.Context) error {
+			logger.Info("starting HTTP server", "port", cfg.Port, "http2", cfg.HTTP2Enabled, "max_conns", cfg.HTTPMaxConns)
+			if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+				return err
+			}
+			return nil
+		},
+		Stop: func(context.Context) error {
+			return drainer.Shutdown(srv, cfg.HTTPDrainPeriod, cfg.HTTPShutdownTimeout, logger)
+		},
+		Timeout:   cfg.HTTPDrainPeriod + cfg.HTTPShutdownTimeout + time.Second,
+		DependsOn: serverDeps,
+	})
+	if err := components.Start(ctx); err != nil {
+		logger.Error("failed to start components", "error", err)
+		return 1
+	}
+
+	// Graceful shutdown
+	code := 0
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case <-sigCh:
+	case err := <-components.Failed():
+		logger.Error("component failed", "error", err)
+		code = 1
+	}
+	logger.Info("shutting down...")
+
+	if err := components.Shutdown(); err != nil {
+		logger.Error("shutdown incomplete", "error", err)
+		code = 1
+	}
+	// Stops the credential rotators before the pools close.
+	cancel()
+
+	logger.Info("shutdown complete")
+	return code
+}
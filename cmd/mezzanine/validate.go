@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ryanbastic/go-mezzanine/internal/config"
+	"github.com/ryanbastic/go-mezzanine/internal/secrets"
+	"github.com/spf13/cobra"
+)
+
+// validateOptions holds the flags of the validate command.
+type validateOptions struct {
+	shardsPath  string
+	indexesPath string
+	numShards   int
+	online      bool
+	timeout     time.Duration
+}
+
+// validateCommand parses the validate flags and runs runValidate.
+func validateCommand() *cobra.Command {
+	var o validateOptions
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check environment, shard and index config",
+		Args:  cobra.NoArgs,
+		Run:   run(func() int { return runValidate(o) }),
+	}
+	fs := cmd.Flags()
+	fs.StringVar(&o.shardsPath, "shards", os.Getenv("SHARD_CONFIG_PATH"), "path to shard config (default $SHARD_CONFIG_PATH)")
+	fs.StringVar(&o.indexesPath, "indexes", os.Getenv("INDEX_CONFIG_PATH"), "path to index config (default $INDEX_CONFIG_PATH)")
+	fs.IntVar(&o.numShards, "num-shards", 0, "number of shards (default $NUM_SHARDS)")
+	fs.BoolVar(&o.online, "online", false, "also connect to every backend and secrets provider")
+	fs.DurationVar(&o.timeout, "timeout", 5*time.Second, "per-backend timeout for --online checks")
+	return cmd
+}
+
+// runValidate loads and cross-checks the environment, shard config and index
+// config, printing a report. It returns the process exit code: 0 when the
+// configuration is valid, 1 when any errors were found.
+func runValidate(o validateOptions) int {
+
+	var report config.Report
+	if o.shardsPath == "" {
+		report.Errorf("env", "no shard config: pass --shards or set SHARD_CONFIG_PATH")
+	} else {
+		os.Setenv("SHARD_CONFIG_PATH", o.shardsPath)
+		cfg := config.Load()
+		if o.numShards > 0 {
+			cfg.NumShards = o.numShards
+		}
+		report.ValidateEnv(cfg)
+		report.ValidateShardFile(o.shardsPath, cfg.NumShards)
+	}
+	if o.indexesPath != "" {
+		report.ValidateIndexFile(o.indexesPath)
+	}
+
+	if o.online && o.shardsPath != "" && !report.HasErrors() {
+		checkBackendsOnline(&report, o.shardsPath, o.timeout)
+	}
+
+	report.Write(os.Stdout)
+	if report.HasErrors() {
+		return 1
+	}
+	return 0
+}
+
+// checkBackendsOnline resolves every backend's credentials and pings it.
+func checkBackendsOnline(report *config.Report, shardsPath string, timeout time.Duration) {
+	data, err := os.ReadFile(shardsPath)
+	if err != nil {
+		report.Errorf("shards", "read %s: %v", shardsPath, err)
+		return
+	}
+	var sc config.ShardConfig
+	if err := json.Unmarshal(data, &sc); err != nil {
+		report.Errorf("shards", "parse %s: %v", shardsPath, err)
+		return
+	}
+
+	for _, b := range sc.Backends {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		if err := pingBackend(ctx, b); err != nil {
+			report.Errorf(b.Name, "%v", err)
+		}
+		cancel()
+	}
+}
+
+func pingBackend(ctx context.Context, b config.BackendConfig) error {
+	dbURL := b.DatabaseURL
+	if b.Secret != nil {
+		provider, err := secrets.New(*b.Secret, nil)
+		if err != nil {
+			return fmt.Errorf("secrets provider: %w", err)
+		}
+		dbURL, err = provider.Fetch(ctx)
+		if err != nil {
+			return fmt.Errorf("fetch secret: %w", err)
+		}
+	}
+	conn, err := pgx.Connect(ctx, dbURL)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer conn.Close(context.Background())
+	if err := conn.Ping(ctx); err != nil {
+		return fmt.Errorf("ping: %w", err)
+	}
+	return nil
+}
@@ -1,43 +1,17 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
 	"sort"
 	"sync"
 	"syscall"
-)
-
-// JSONRPCRequest mirrors the JSON-RPC 2.0 request shape from internal/trigger.
-type JSONRPCRequest struct {
-	JSONRPC string          `json:"jsonrpc"`
-	Method  string          `json:"method"`
-	Params  json.RawMessage `json:"params"`
-	ID      int64           `json:"id"`
-}
-
-// JSONRPCResponse is a JSON-RPC 2.0 response.
-type JSONRPCResponse struct {
-	JSONRPC string `json:"jsonrpc"`
-	Result  string `json:"result,omitempty"`
-	ID      int64  `json:"id"`
-}
 
-// CellWrittenParams is the notification payload for cell.written.
-type CellWrittenParams struct {
-	AddedID    int64           `json:"added_id"`
-	RowKey     string          `json:"row_key"`
-	ColumnName string          `json:"column_name"`
-	RefKey     int64           `json:"ref_key"`
-	Body       json.RawMessage `json:"body"`
-	CreatedAt  string          `json:"created_at"`
-	ShardID    int             `json:"shard_id"`
-}
+	"github.com/ryanbastic/go-mezzanine/pkg/plugin"
+)
 
 // BillingEvent is the expected body shape for billing column writes.
 // TODO we've integrated this with seed_users for now, so it's not ideal, but
@@ -97,96 +71,46 @@ func main() {
 		port = p
 	}
 
-	l := &ledger{charges: make(map[string]float64)}
-
-	// Start JSON-RPC server.
-	mux := http.NewServeMux()
-	mux.HandleFunc("/rpc", rpcHandler(l))
-
-	server := &http.Server{Addr: ":" + port, Handler: mux}
-
-	go func() {
-		fmt.Printf("Billing plugin listening on :%s/rpc\n", port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("server error: %v", err)
-		}
-	}()
-
-	// Register with Mezzanine.
-	endpoint := fmt.Sprintf("http://localhost:%s/rpc", port)
-	registerPlugin(mezzanineURL, endpoint)
-
-	// Wait for shutdown signal, then print summary.
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
-	<-sig
-
-	l.printSummary()
-}
-
-func rpcHandler(l *ledger) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		var req JSONRPCRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "bad request", http.StatusBadRequest)
-			return
-		}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-		if req.Method != "cell.written" {
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(JSONRPCResponse{
-				JSONRPC: "2.0",
-				Result:  "unknown method",
-				ID:      req.ID,
-			})
-			return
-		}
-
-		var params CellWrittenParams
-		if err := json.Unmarshal(req.Params, &params); err != nil {
-			fmt.Printf("  [warn] failed to parse params: %v\n", err)
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(JSONRPCResponse{JSONRPC: "2.0", Result: "ok", ID: req.ID})
-			return
-		}
+	l := &ledger{charges: make(map[string]float64)}
 
+	p := plugin.New(plugin.Options{Secret: []byte(os.Getenv("TRIGGER_SIGNING_SECRET"))})
+	p.OnCellWritten(func(ctx context.Context, c plugin.CellWritten) error {
 		var event BillingEvent
-		if err := json.Unmarshal(params.Body, &event); err != nil {
+		if err := c.Decode(&event); err != nil {
+			// Acknowledge anyway: a malformed event will not parse on retry either.
 			fmt.Printf("  [warn] failed to parse billing event body: %v\n", err)
-		} else {
-			l.add(event.Customer, event.Amount)
-			fmt.Printf("  [charge] customer=%s amount=$%.2f desc=%q row_key=%s\n",
-				event.Customer, event.Amount, event.Description, params.RowKey)
+			return nil
 		}
+		l.add(event.Customer, event.Amount)
+		fmt.Printf("  [charge] customer=%s amount=$%.2f desc=%q row_key=%s\n",
+			event.Customer, event.Amount, event.Description, c.RowKey)
+		return nil
+	})
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(JSONRPCResponse{JSONRPC: "2.0", Result: "ok", ID: req.ID})
-	}
-}
+	errCh := make(chan error, 1)
+	go func() {
+		fmt.Printf("Billing plugin listening on :%s/rpc\n", port)
+		errCh <- p.ListenAndServe(ctx, ":"+port)
+	}()
 
-func registerPlugin(mezzanineURL, endpoint string) {
-	body, err := json.Marshal(map[string]any{
-		"name":               "billing",
-		"endpoint":           endpoint,
-	//	"subscribed_columns": []string{"billing"},
-		"subscribed_columns": []string{"profile"},
+	// Register with Mezzanine; an existing registration is fine on restart.
+	err := plugin.Register(ctx, mezzanineURL, plugin.Registration{
+		Name:     "billing",
+		Endpoint: fmt.Sprintf("http://localhost:%s/rpc", port),
+		// SubscribedColumns: []string{"billing"},
+		SubscribedColumns: []string{"profile"},
 	})
-	if err != nil {
-		log.Fatalf("failed to marshal registration body: %v", err)
-	}
-
-	resp, err := http.Post(mezzanineURL+"/v1/plugins", "application/json", bytes.NewReader(body))
 	if err != nil {
 		log.Fatalf("failed to register plugin: %v", err)
 	}
-	defer resp.Body.Close()
+	fmt.Printf("Registered billing plugin with Mezzanine at %s\n", mezzanineURL)
 
-	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
-		// Allow StatusConflict so that we can restart
-		if resp.StatusCode != http.StatusConflict {
-			log.Fatalf("unexpected status registering plugin: %d", resp.StatusCode)
-		}
+	// Wait for shutdown, then print summary.
+	if err := <-errCh; err != nil {
+		log.Fatalf("server error: %v", err)
 	}
-
-	fmt.Printf("Registered billing plugin with Mezzanine at %s\n", mezzanineURL)
+	l.printSummary()
 }
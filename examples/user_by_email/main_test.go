@@ -2,7 +2,6 @@ package main
 
 import (
 	"bytes"
-	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,100 +9,28 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
-	"time"
 
 	"github.com/google/uuid"
 	"github.com/ryanbastic/go-mezzanine/internal/api"
-	"github.com/ryanbastic/go-mezzanine/internal/cell"
 	"github.com/ryanbastic/go-mezzanine/internal/index"
 	"github.com/ryanbastic/go-mezzanine/internal/shard"
-	"github.com/ryanbastic/go-mezzanine/internal/storage"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
 	"github.com/ryanbastic/go-mezzanine/internal/trigger"
 )
 
-// --- Mock CellStore (mirrors internal/api test mock) ---
-
-type mockCellStore struct {
-	cells  map[string]*cell.Cell
-	rows   map[string][]cell.Cell
-	nextID int64
-}
-
-func newMockCellStore() *mockCellStore {
-	return &mockCellStore{
-		cells: make(map[string]*cell.Cell),
-		rows:  make(map[string][]cell.Cell),
-	}
-}
-
-func mockCellKey(rowKey uuid.UUID, colName string, refKey int64) string {
-	return fmt.Sprintf("%s:%s:%d", rowKey, colName, refKey)
-}
-
-func (m *mockCellStore) WriteCell(_ context.Context, req cell.WriteCellRequest) (*cell.Cell, error) {
-	m.nextID++
-	c := &cell.Cell{
-		AddedID:    m.nextID,
-		RowKey:     req.RowKey,
-		ColumnName: req.ColumnName,
-		RefKey:     req.RefKey,
-		Body:       req.Body,
-		CreatedAt:  time.Now(),
-	}
-	m.cells[mockCellKey(req.RowKey, req.ColumnName, req.RefKey)] = c
-	m.rows[req.RowKey.String()] = append(m.rows[req.RowKey.String()], *c)
-	return c, nil
-}
-
-func (m *mockCellStore) GetCell(_ context.Context, ref cell.CellRef) (*cell.Cell, error) {
-	c, ok := m.cells[mockCellKey(ref.RowKey, ref.ColumnName, ref.RefKey)]
-	if !ok {
-		return nil, storage.ErrCellNotFound
-	}
-	return c, nil
-}
-
-func (m *mockCellStore) GetCellLatest(_ context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, error) {
-	var best *cell.Cell
-	for _, c := range m.cells {
-		if c.RowKey == rowKey && c.ColumnName == columnName {
-			if best == nil || c.RefKey > best.RefKey {
-				cc := *c
-				best = &cc
-			}
-		}
-	}
-	if best == nil {
-		return nil, storage.ErrCellNotFound
-	}
-	return best, nil
-}
-
-func (m *mockCellStore) GetRow(_ context.Context, rowKey uuid.UUID) ([]cell.Cell, error) {
-	return m.rows[rowKey.String()], nil
-}
-
-func (m *mockCellStore) PartitionRead(context.Context, int, int, int64, time.Time, int) ([]cell.Cell, error) {
-	return nil, nil
-}
-
-func (m *mockCellStore) ScanCells(context.Context, string, int64, int) ([]cell.Cell, error) {
-	return nil, nil
-}
-
-// testServerWithCells returns a server with mock cell stores (no index registry).
+// testServerWithCells returns a server with in-memory cell stores (no index registry).
 // Use this for write/read cell tests where IndexCell would hit a nil pool.
 func testServerWithCells(t *testing.T) *httptest.Server {
 	t.Helper()
 
-	store := newMockCellStore()
+	store := memory.New()
 	router := shard.NewRouter()
 	for i := range 64 {
 		router.Register(shard.ID(i), store)
 	}
 
 	logger := slog.New(slog.DiscardHandler)
-	handler := api.NewServer(logger, router, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil)
+	handler := api.NewServer(logger, router, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil, api.ServerOptions{})
 	return httptest.NewServer(handler)
 }
 
@@ -112,7 +39,7 @@ func testServerWithCells(t *testing.T) *httptest.Server {
 func testServerWithIndex(t *testing.T) *httptest.Server {
 	t.Helper()
 
-	store := newMockCellStore()
+	store := memory.New()
 	router := shard.NewRouter()
 	for i := range 64 {
 		router.Register(shard.ID(i), store)
@@ -128,7 +55,7 @@ func testServerWithIndex(t *testing.T) *httptest.Server {
 	}, 64)
 
 	logger := slog.New(slog.DiscardHandler)
-	handler := api.NewServer(logger, router, registry, trigger.NewPluginRegistry(), nil, 64, nil)
+	handler := api.NewServer(logger, router, registry, trigger.NewPluginRegistry(), nil, 64, nil, api.ServerOptions{})
 	return httptest.NewServer(handler)
 }
 
@@ -0,0 +1,57 @@
+package accounting
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ryanbastic/go-mezzanine/internal/column"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// PostgresStore implements Store with an aggregate over the shard tables.
+// Bodies are measured as JSON text, which may differ in whitespace from
+// what clients sent.
+type PostgresStore struct {
+	poolFor func(shardID int) *pgxpool.Pool
+}
+
+// NewPostgresStore creates a Store reaching each shard through the pool
+// poolFor returns. Counts take as long as the table needs to read, so they
+// run without a deadline or statement timeout.
+func NewPostgresStore(poolFor func(shardID int) *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{poolFor: poolFor}
+}
+
+func (s *PostgresStore) CountShard(ctx context.Context, shardID int) (map[string]column.Usage, error) {
+	pool := s.poolFor(shardID)
+	if pool == nil {
+		return nil, fmt.Errorf("no backend for shard %d", shardID)
+	}
+	out := make(map[string]column.Usage)
+	err := storage.WithoutStatementTimeout(ctx, pool, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT column_name, count(*), coalesce(sum(octet_length(body::text) + coalesce(octet_length(data), 0)), 0)
+			FROM `+storage.ShardTable(shardID)+`
+			GROUP BY column_name
+		`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var name string
+			var u column.Usage
+			if err := rows.Scan(&name, &u.Cells, &u.Bytes); err != nil {
+				return err
+			}
+			out[name] = u
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("count shard %d: %w", shardID, err)
+	}
+	return out, nil
+}
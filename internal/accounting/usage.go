@@ -0,0 +1,151 @@
+// Package accounting counts the storage each column uses in the shard tables,
+// for chargeback.
+//
+// The column registry adds every write to its columns' usage as it happens
+// (see column.Usage), which is cheap but drifts: deletes and garbage
+// collection are never subtracted, and cells written before the registry
+// tracked usage are missing. A Counter trues it up by counting each column's
+// cells and body bytes in every shard table once per interval and
+// replacing the registry's usage with the totals. A count reads the whole of
+// every table, so it runs on one instance, one shard at a time by default,
+// and rarely.
+package accounting
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/ryanbastic/go-mezzanine/internal/column"
+)
+
+var (
+	countsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "mezzanine",
+			Name:      "usage_counts_total",
+			Help:      "Counts of the storage columns use across all shard tables, by result (ok or error).",
+		},
+		[]string{"result"},
+	)
+	lastCounted = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "mezzanine",
+			Name:      "usage_last_counted_timestamp_seconds",
+			Help:      "Unix time the last successful count of column storage usage started.",
+		},
+	)
+)
+
+// Store counts the cells of shard tables.
+type Store interface {
+	// CountShard returns the cells and body bytes of each column with
+	// cells in shardID's table.
+	CountShard(ctx context.Context, shardID int) (map[string]column.Usage, error)
+}
+
+// Options configures a Counter.
+type Options struct {
+	// NumShards is the number of shards.
+	NumShards int
+	// Interval is the time between counts (default 24h).
+	Interval time.Duration
+	// Concurrency bounds the shard tables counted at once (default 1).
+	Concurrency int
+}
+
+// Counter periodically counts the storage usage of every column and sets
+// it in the column registry.
+type Counter struct {
+	columns *column.Registry
+	store   Store
+	opts    Options
+	logger  *slog.Logger
+	now     func() time.Time
+}
+
+// New returns a counter reading shard tables from store and setting usage
+// in columns.
+func New(columns *column.Registry, store Store, opts Options, logger *slog.Logger) *Counter {
+	if opts.Interval <= 0 {
+		opts.Interval = 24 * time.Hour
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	return &Counter{columns: columns, store: store, opts: opts, logger: logger, now: time.Now}
+}
+
+// Run counts usage once per interval until ctx is cancelled. A failed count
+// leaves the registry's usage as it was and is retried next interval. Only
+// one instance should run it; it has the signature of a leader.Elector
+// task.
+func (c *Counter) Run(ctx context.Context) error {
+	for {
+		if err := c.Count(ctx); err != nil && ctx.Err() == nil {
+			countsTotal.WithLabelValues("error").Inc()
+			c.logger.Warn("failed to count column storage usage; retrying next interval", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(c.opts.Interval):
+		}
+	}
+}
+
+// Count counts every shard table and sets the totals in the registry, as
+// of the time the count started.
+func (c *Counter) Count(ctx context.Context) error {
+	start := c.now()
+	var (
+		mu     sync.Mutex
+		totals = make(map[string]column.Usage)
+		errs   []error
+		wg     sync.WaitGroup
+		sem    = make(chan struct{}, c.opts.Concurrency)
+	)
+	for id := range c.opts.NumShards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+			counts, err := c.store.CountShard(ctx, id)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("shard %d: %w", id, err))
+				return
+			}
+			for name, u := range counts {
+				t := totals[name]
+				t.Cells += u.Cells
+				t.Bytes += u.Bytes
+				totals[name] = t
+			}
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("count %d of %d shards: %w", len(errs), c.opts.NumShards, errs[0])
+	}
+	if err := c.columns.SetUsage(ctx, totals, start); err != nil {
+		return err
+	}
+	countsTotal.WithLabelValues("ok").Inc()
+	lastCounted.Set(float64(start.Unix()))
+	c.logger.Info("counted column storage usage", "columns", len(totals), "duration", c.now().Sub(start))
+	return nil
+}
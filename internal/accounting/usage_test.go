@@ -0,0 +1,70 @@
+package accounting
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/ryanbastic/go-mezzanine/internal/column"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+type fakeStore struct {
+	counts map[int]map[string]column.Usage
+	fail   int // shard whose count fails, or -1
+}
+
+func (f *fakeStore) CountShard(_ context.Context, shardID int) (map[string]column.Usage, error) {
+	if shardID == f.fail {
+		return nil, errors.New("connection refused")
+	}
+	return f.counts[shardID], nil
+}
+
+func TestCounter_SumsShards(t *testing.T) {
+	columns := column.NewRegistry()
+	columns.Observe("profile", 10, 1000, time.Now())
+	columns.Observe("sessions", 4, 400, time.Now())
+	store := &fakeStore{fail: -1, counts: map[int]map[string]column.Usage{
+		0: {"profile": {Cells: 3, Bytes: 300}},
+		1: {"profile": {Cells: 2, Bytes: 150}, "orders": {Cells: 1, Bytes: 80}},
+	}}
+	c := New(columns, store, Options{NumShards: 3, Concurrency: 2}, testLogger())
+	start := time.Date(2026, 2, 6, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return start }
+
+	if err := c.Count(context.Background()); err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	for name, want := range map[string]column.Usage{
+		"profile":  {Cells: 5, Bytes: 450, CountedAt: start},
+		"orders":   {Cells: 1, Bytes: 80, CountedAt: start},
+		"sessions": {CountedAt: start},
+	} {
+		if got, _ := columns.Get(name); got.Usage != want {
+			t.Errorf("%s usage = %+v, want %+v", name, got.Usage, want)
+		}
+	}
+}
+
+func TestCounter_FailedShardKeepsUsage(t *testing.T) {
+	columns := column.NewRegistry()
+	columns.Observe("profile", 10, 1000, time.Now())
+	store := &fakeStore{fail: 1, counts: map[int]map[string]column.Usage{
+		0: {"profile": {Cells: 3, Bytes: 300}},
+	}}
+	c := New(columns, store, Options{NumShards: 2}, testLogger())
+
+	if err := c.Count(context.Background()); err == nil {
+		t.Fatal("expected error")
+	}
+	if got, _ := columns.Get("profile"); got.Usage.Cells != 10 || !got.Usage.CountedAt.IsZero() {
+		t.Errorf("profile usage = %+v, want the incremental count", got.Usage)
+	}
+}
@@ -0,0 +1,458 @@
+// Package admin serves the operator dashboard and its JSON APIs on the admin
+// listener (ADMIN_PORT). It is kept off the public API port because it has no
+// authentication and exposes cluster internals.
+package admin
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ryanbastic/go-mezzanine/internal/column"
+	"github.com/ryanbastic/go-mezzanine/internal/fence"
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/lease"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+)
+
+//go:embed ui
+var uiFS embed.FS
+
+// Backend is one database backend and the shard range it owns.
+type Backend struct {
+	Name       string
+	ShardStart int
+	ShardEnd   int
+	Pool       *pgxpool.Pool
+}
+
+// Options are the components the dashboard reports on. Nil registries and
+// notifier are reported as empty.
+type Options struct {
+	Backends  []Backend
+	NumShards int
+	Indexes   *index.Registry
+	Columns   *column.Registry
+	Fences    *fence.Registry
+	Leases    *lease.Coordinator
+	Plugins   *trigger.PluginRegistry
+	Notifier  *trigger.Notifier
+	Logger    *slog.Logger
+}
+
+type handler struct {
+	opts Options
+}
+
+// NewHandler returns the admin UI (at /) and JSON APIs (under /api/).
+func NewHandler(opts Options) http.Handler {
+	h := &handler{opts: opts}
+	mux := chi.NewRouter()
+
+	mux.Get("/api/shards", h.shards)
+	mux.Get("/api/pools", h.pools)
+	mux.Get("/api/leases", h.leases)
+	mux.Get("/api/indexes", h.indexes)
+	mux.Get("/api/columns", h.columns)
+	mux.Get("/api/columns/top", h.topColumns)
+	mux.Put("/api/columns/{name}", h.updateColumn)
+	mux.Get("/api/usage", h.usage)
+	mux.Get("/api/fences", h.fences)
+	mux.Put("/api/fences", h.setFence)
+	mux.Delete("/api/fences", h.removeFence)
+	mux.Get("/api/plugins", h.plugins)
+	mux.Get("/api/dead-letters", h.deadLetters)
+
+	ui, err := fs.Sub(uiFS, "ui")
+	if err != nil {
+		panic(err) // the embedded directory is fixed at build time
+	}
+	mux.Handle("/*", http.FileServerFS(ui))
+	return mux
+}
+
+func (h *handler) writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.opts.Logger.Error("failed to write admin response", "error", err)
+	}
+}
+
+// --- Shards ---
+
+type shardRange struct {
+	Backend    string `json:"backend"`
+	ShardStart int    `json:"shard_start"`
+	ShardEnd   int    `json:"shard_end"`
+	Healthy    bool   `json:"healthy"`
+	LatencyMs  int64  `json:"latency_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+type shardsResponse struct {
+	NumShards int          `json:"num_shards"`
+	Ranges    []shardRange `json:"ranges"`
+}
+
+// shards pings every backend concurrently and reports each shard range's health.
+func (h *handler) shards(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	ranges := make([]shardRange, len(h.opts.Backends))
+	var wg sync.WaitGroup
+	for i, b := range h.opts.Backends {
+		ranges[i] = shardRange{Backend: b.Name, ShardStart: b.ShardStart, ShardEnd: b.ShardEnd}
+		if b.Pool == nil {
+			ranges[i].Error = "no pool"
+			continue
+		}
+		wg.Add(1)
+		go func(sr *shardRange, pool *pgxpool.Pool) {
+			defer wg.Done()
+			start := time.Now()
+			err := pool.Ping(ctx)
+			sr.LatencyMs = time.Since(start).Milliseconds()
+			if err != nil {
+				sr.Error = err.Error()
+				return
+			}
+			sr.Healthy = true
+		}(&ranges[i], b.Pool)
+	}
+	wg.Wait()
+
+	h.writeJSON(w, shardsResponse{NumShards: h.opts.NumShards, Ranges: ranges})
+}
+
+// --- Pools ---
+
+type poolStats struct {
+	Backend            string `json:"backend"`
+	TotalConns         int32  `json:"total_conns"`
+	AcquiredConns      int32  `json:"acquired_conns"`
+	IdleConns          int32  `json:"idle_conns"`
+	MaxConns           int32  `json:"max_conns"`
+	AcquireCount       int64  `json:"acquire_count"`
+	EmptyAcquireCount  int64  `json:"empty_acquire_count"`
+	CanceledAcquires   int64  `json:"canceled_acquire_count"`
+	AcquireDurationMs  int64  `json:"acquire_duration_ms"`
+	ConstructingConns  int32  `json:"constructing_conns"`
+	NewConnsCount      int64  `json:"new_conns_count"`
+	MaxLifetimeDestroy int64  `json:"max_lifetime_destroy_count"`
+	MaxIdleDestroy     int64  `json:"max_idle_destroy_count"`
+}
+
+func (h *handler) pools(w http.ResponseWriter, r *http.Request) {
+	out := make([]poolStats, 0, len(h.opts.Backends))
+	for _, b := range h.opts.Backends {
+		if b.Pool == nil {
+			continue
+		}
+		s := b.Pool.Stat()
+		out = append(out, poolStats{
+			Backend:            b.Name,
+			TotalConns:         s.TotalConns(),
+			AcquiredConns:      s.AcquiredConns(),
+			IdleConns:          s.IdleConns(),
+			MaxConns:           s.MaxConns(),
+			AcquireCount:       s.AcquireCount(),
+			EmptyAcquireCount:  s.EmptyAcquireCount(),
+			CanceledAcquires:   s.CanceledAcquireCount(),
+			AcquireDurationMs:  s.AcquireDuration().Milliseconds(),
+			ConstructingConns:  s.ConstructingConns(),
+			NewConnsCount:      s.NewConnsCount(),
+			MaxLifetimeDestroy: s.MaxLifetimeDestroyCount(),
+			MaxIdleDestroy:     s.MaxIdleDestroyCount(),
+		})
+	}
+	h.writeJSON(w, out)
+}
+
+// --- Shard leases ---
+
+type leasesResponse struct {
+	Enabled bool          `json:"enabled"`
+	Node    string        `json:"node,omitempty"`
+	Leases  []lease.Lease `json:"leases"`
+}
+
+// leases reports which instance owns each shard's background work.
+func (h *handler) leases(w http.ResponseWriter, r *http.Request) {
+	out := leasesResponse{Leases: []lease.Lease{}}
+	if h.opts.Leases != nil {
+		leases, err := h.opts.Leases.Leases(r.Context())
+		if err != nil {
+			h.opts.Logger.Error("failed to list shard leases", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out = leasesResponse{Enabled: true, Node: h.opts.Leases.Node(), Leases: leases}
+	}
+	h.writeJSON(w, out)
+}
+
+// --- Indexes ---
+
+type indexInfo struct {
+	Name          string                     `json:"name"`
+	SourceColumn  string                     `json:"source_column"`
+	ShardKeyField string                     `json:"shard_key_field"`
+	Fields        []string                   `json:"fields"`
+	UniqueFields  []string                   `json:"unique_fields,omitempty"`
+	FieldTypes    map[string]index.FieldType `json:"field_types,omitempty"`
+}
+
+func (h *handler) indexes(w http.ResponseWriter, r *http.Request) {
+	out := []indexInfo{}
+	if h.opts.Indexes != nil {
+		for _, def := range h.opts.Indexes.Definitions() {
+			out = append(out, indexInfo{
+				Name:          def.Name,
+				SourceColumn:  def.SourceColumn,
+				ShardKeyField: def.ShardKeyField,
+				Fields:        def.Fields,
+				UniqueFields:  def.UniqueFields,
+				FieldTypes:    def.FieldTypes,
+			})
+		}
+	}
+	h.writeJSON(w, out)
+}
+
+// --- Columns ---
+
+func (h *handler) columns(w http.ResponseWriter, r *http.Request) {
+	out := []column.Column{}
+	if h.opts.Columns != nil {
+		out = h.opts.Columns.List()
+	}
+	h.writeJSON(w, out)
+}
+
+// topColumns reports the throughput of the columns this instance writes
+// most, the first n (default 10) of them.
+func (h *handler) topColumns(w http.ResponseWriter, r *http.Request) {
+	n := 10
+	if s := r.URL.Query().Get("n"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 1 {
+			http.Error(w, "n must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		n = v
+	}
+	out := []column.TopColumn{}
+	if h.opts.Columns != nil {
+		out = h.opts.Columns.Top(n)
+	}
+	h.writeJSON(w, out)
+}
+
+// updateColumn replaces a column's metadata, registering the column if it
+// has not been written to yet.
+func (h *handler) updateColumn(w http.ResponseWriter, r *http.Request) {
+	if h.opts.Columns == nil {
+		http.Error(w, "column registry not configured", http.StatusNotFound)
+		return
+	}
+	var meta column.Metadata
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&meta); err != nil {
+		http.Error(w, "invalid column metadata: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	c, err := h.opts.Columns.Update(r.Context(), chi.URLParam(r, "name"), meta)
+	if err != nil {
+		h.opts.Logger.Error("failed to update column", "column_name", chi.URLParam(r, "name"), "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.opts.Logger.Info("column metadata updated", "column_name", c.Name, "owner", c.Owner)
+	h.writeJSON(w, c)
+}
+
+// --- Usage ---
+
+type columnUsage struct {
+	Name  string `json:"name"`
+	Owner string `json:"owner"`
+	column.Usage
+}
+
+type ownerUsage struct {
+	Owner   string `json:"owner"`
+	Columns int    `json:"columns"`
+	Cells   int64  `json:"cells"`
+	Bytes   int64  `json:"bytes"`
+}
+
+type usageReport struct {
+	Columns []columnUsage `json:"columns"`
+	Owners  []ownerUsage  `json:"owners"`
+}
+
+// usage reports the storage each column uses, and the totals of each
+// owner, largest first, for chargeback.
+func (h *handler) usage(w http.ResponseWriter, r *http.Request) {
+	out := usageReport{Columns: []columnUsage{}, Owners: []ownerUsage{}}
+	if h.opts.Columns == nil {
+		h.writeJSON(w, out)
+		return
+	}
+	owners := make(map[string]*ownerUsage)
+	for _, c := range h.opts.Columns.List() {
+		out.Columns = append(out.Columns, columnUsage{Name: c.Name, Owner: c.Owner, Usage: c.Usage})
+		o, ok := owners[c.Owner]
+		if !ok {
+			o = &ownerUsage{Owner: c.Owner}
+			owners[c.Owner] = o
+		}
+		o.Columns++
+		o.Cells += c.Usage.Cells
+		o.Bytes += c.Usage.Bytes
+	}
+	for _, o := range owners {
+		out.Owners = append(out.Owners, *o)
+	}
+	sort.SliceStable(out.Columns, func(i, j int) bool { return out.Columns[i].Bytes > out.Columns[j].Bytes })
+	sort.Slice(out.Owners, func(i, j int) bool {
+		if out.Owners[i].Bytes != out.Owners[j].Bytes {
+			return out.Owners[i].Bytes > out.Owners[j].Bytes
+		}
+		return out.Owners[i].Owner < out.Owners[j].Owner
+	})
+	h.writeJSON(w, out)
+}
+
+// --- Fences ---
+
+func (h *handler) fences(w http.ResponseWriter, r *http.Request) {
+	out := []fence.Fence{}
+	if h.opts.Fences != nil {
+		out = h.opts.Fences.List()
+	}
+	h.writeJSON(w, out)
+}
+
+type fenceRequest struct {
+	Column            string `json:"column"`
+	Shard             *int   `json:"shard"`
+	Reason            string `json:"reason"`
+	RetryAfterSeconds int    `json:"retry_after_seconds"`
+	// ExpiresIn is a duration such as "30m" after which the fence lifts.
+	ExpiresIn string `json:"expires_in"`
+}
+
+// setFence fences writes to a column, a shard or a column on a shard,
+// replacing the fence of the same scope if there is one.
+func (h *handler) setFence(w http.ResponseWriter, r *http.Request) {
+	if h.opts.Fences == nil {
+		http.Error(w, "write fences not configured", http.StatusNotFound)
+		return
+	}
+	var req fenceRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, "invalid fence: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Shard != nil && *req.Shard >= h.opts.NumShards {
+		http.Error(w, fmt.Sprintf("shard %d out of range [0, %d)", *req.Shard, h.opts.NumShards), http.StatusBadRequest)
+		return
+	}
+	f := fence.Fence{Column: req.Column, Shard: req.Shard, Reason: req.Reason, RetryAfterSeconds: req.RetryAfterSeconds}
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			http.Error(w, fmt.Sprintf("expires_in must be a positive duration, got %q", req.ExpiresIn), http.StatusBadRequest)
+			return
+		}
+		f.ExpiresAt = time.Now().Add(d)
+	}
+	if err := f.Check(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f, err := h.opts.Fences.Set(r.Context(), f)
+	if err != nil {
+		h.opts.Logger.Error("failed to set write fence", "column_name", req.Column, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.opts.Logger.Warn("write fence set", "column_name", f.Column, "shard_id", f.Shard, "reason", f.Reason, "expires_at", f.ExpiresAt)
+	h.writeJSON(w, f)
+}
+
+// removeFence lifts the fence whose scope the column and shard query
+// parameters name.
+func (h *handler) removeFence(w http.ResponseWriter, r *http.Request) {
+	if h.opts.Fences == nil {
+		http.Error(w, "write fences not configured", http.StatusNotFound)
+		return
+	}
+	column := r.URL.Query().Get("column")
+	var shard *int
+	if s := r.URL.Query().Get("shard"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			http.Error(w, "shard must be an integer", http.StatusBadRequest)
+			return
+		}
+		shard = &v
+	}
+	removed, err := h.opts.Fences.Remove(r.Context(), column, shard)
+	if err != nil {
+		h.opts.Logger.Error("failed to remove write fence", "column_name", column, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !removed {
+		http.Error(w, "fence not found", http.StatusNotFound)
+		return
+	}
+	h.opts.Logger.Info("write fence removed", "column_name", column, "shard_id", shard)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// --- Plugins ---
+
+type pluginInfo struct {
+	*trigger.Plugin
+	Delivery trigger.DeliveryStats `json:"delivery"`
+}
+
+func (h *handler) plugins(w http.ResponseWriter, r *http.Request) {
+	out := []pluginInfo{}
+	if h.opts.Plugins == nil {
+		h.writeJSON(w, out)
+		return
+	}
+	var stats map[string]trigger.DeliveryStats
+	if h.opts.Notifier != nil {
+		stats = h.opts.Notifier.DeliveryStats()
+	}
+	for _, p := range h.opts.Plugins.List() {
+		out = append(out, pluginInfo{Plugin: p, Delivery: stats[p.Name]})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	h.writeJSON(w, out)
+}
+
+// --- Dead letters ---
+
+func (h *handler) deadLetters(w http.ResponseWriter, r *http.Request) {
+	out := []trigger.DeadLetter{}
+	if h.opts.Notifier != nil {
+		out = h.opts.Notifier.DeadLetters()
+	}
+	h.writeJSON(w, out)
+}
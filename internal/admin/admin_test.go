@@ -0,0 +1,245 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryanbastic/go-mezzanine/internal/column"
+	"github.com/ryanbastic/go-mezzanine/internal/fence"
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/lease"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+)
+
+func newTestHandler() http.Handler {
+	indexes := index.NewRegistry()
+	indexes.Register(nil, index.Definition{Name: "user_by_email", SourceColumn: "profile", ShardKeyField: "email", Fields: []string{"email"}}, 0)
+
+	plugins := trigger.NewPluginRegistry()
+	plugins.Register(context.Background(), &trigger.Plugin{Name: "billing", Endpoint: "http://billing", SubscribedColumns: []string{"orders"}}) //nolint:errcheck
+
+	columns := column.NewRegistry()
+	columns.Observe("profile", 3, 300, time.Now())
+
+	logger := slog.New(slog.DiscardHandler)
+	return NewHandler(Options{
+		Backends:  []Backend{{Name: "primary", ShardStart: 0, ShardEnd: 63}},
+		NumShards: 64,
+		Indexes:   indexes,
+		Columns:   columns,
+		Fences:    fence.NewRegistry(),
+		Plugins:   plugins,
+		Notifier:  trigger.NewNotifier(plugins, trigger.NewRPCClient(0, 0, 0), logger),
+		Logger:    logger,
+	})
+}
+
+func get(t *testing.T, h http.Handler, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d, body %s", path, rec.Code, rec.Body)
+	}
+	return rec
+}
+
+func TestHandler_ServesUI(t *testing.T) {
+	rec := get(t, newTestHandler(), "/")
+	if !strings.Contains(rec.Body.String(), "Mezzanine Admin") {
+		t.Error("expected the dashboard HTML")
+	}
+}
+
+func TestHandler_Shards(t *testing.T) {
+	rec := get(t, newTestHandler(), "/api/shards")
+
+	var got shardsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.NumShards != 64 || len(got.Ranges) != 1 {
+		t.Fatalf("got %+v", got)
+	}
+	if r := got.Ranges[0]; r.Backend != "primary" || r.ShardEnd != 63 || r.Healthy {
+		t.Errorf("got %+v, want unhealthy primary 0-63 (no pool)", r)
+	}
+}
+
+// staticLeases is a lease.Store that only lists fixed leases.
+type staticLeases []lease.Lease
+
+func (s staticLeases) Heartbeat(context.Context, string, time.Duration) (int, error) { return 1, nil }
+func (s staticLeases) Renew(context.Context, string, time.Duration) ([]int, error)   { return nil, nil }
+func (s staticLeases) Claim(context.Context, string, int, time.Duration) ([]int, error) {
+	return nil, nil
+}
+func (s staticLeases) Release(context.Context, string, []int) error { return nil }
+func (s staticLeases) Leave(context.Context, string) error          { return nil }
+func (s staticLeases) List(context.Context) ([]lease.Lease, error)  { return s, nil }
+
+func TestHandler_Leases(t *testing.T) {
+	var got leasesResponse
+	if err := json.Unmarshal(get(t, newTestHandler(), "/api/leases").Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.Enabled || len(got.Leases) != 0 {
+		t.Errorf("without a coordinator: got %+v", got)
+	}
+
+	logger := slog.New(slog.DiscardHandler)
+	coord := lease.New(staticLeases{{ShardID: 0, Owner: "a"}, {ShardID: 1}}, lease.Options{Node: "a", NumShards: 2}, logger)
+	h := NewHandler(Options{Leases: coord, Logger: logger})
+	if err := json.Unmarshal(get(t, h, "/api/leases").Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !got.Enabled || got.Node != "a" || len(got.Leases) != 2 || got.Leases[0].Owner != "a" || got.Leases[1].Owner != "" {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestHandler_Indexes(t *testing.T) {
+	rec := get(t, newTestHandler(), "/api/indexes")
+
+	var got []indexInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(got) != 1 || got[0].Name != "user_by_email" || got[0].SourceColumn != "profile" {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestHandler_UpdateColumn(t *testing.T) {
+	h := newTestHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/columns/profile", strings.NewReader(`{"owner":"accounts","description":"User profiles"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	rec = get(t, h, "/api/columns")
+	var got []column.Column
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(got) != 1 || got[0].Owner != "accounts" || got[0].Description != "User profiles" || got[0].Stats.Writes != 3 {
+		t.Errorf("got %+v", got)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/columns/profile", strings.NewReader(`{`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid body: status %d, want 400", rec.Code)
+	}
+}
+
+func TestHandler_TopColumns(t *testing.T) {
+	h := newTestHandler()
+	rec := get(t, h, "/api/columns/top?n=5")
+
+	var got []column.TopColumn
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(got) != 1 || got[0].Name != "profile" || got[0].Cells != 3 || got[0].Bytes != 300 {
+		t.Errorf("got %+v", got)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/columns/top?n=0", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("n=0: status %d, want 400", rec.Code)
+	}
+}
+
+func TestHandler_Usage(t *testing.T) {
+	h := newTestHandler()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/columns/orders", strings.NewReader(`{"owner":"accounts"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT: status %d, body %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/columns/profile", strings.NewReader(`{"owner":"accounts"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	rec = get(t, h, "/api/usage")
+	var got usageReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(got.Columns) != 2 || got.Columns[0].Name != "profile" || got.Columns[0].Cells != 3 || got.Columns[0].Bytes != 300 {
+		t.Errorf("columns: got %+v", got.Columns)
+	}
+	if len(got.Owners) != 1 || got.Owners[0] != (ownerUsage{Owner: "accounts", Columns: 2, Cells: 3, Bytes: 300}) {
+		t.Errorf("owners: got %+v", got.Owners)
+	}
+}
+
+func TestHandler_Fences(t *testing.T) {
+	h := newTestHandler()
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := send(http.MethodPut, "/api/fences", `{"column":"profile","shard":3,"reason":"cutover","retry_after_seconds":30,"expires_in":"1h"}`); rec.Code != http.StatusOK {
+		t.Fatalf("PUT: status %d, body %s", rec.Code, rec.Body)
+	}
+	for _, body := range []string{`{"reason":"everything"}`, `{"shard":64}`, `{"column":"profile","expires_in":"soon"}`, `{`} {
+		if rec := send(http.MethodPut, "/api/fences", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s: status %d, want 400", body, rec.Code)
+		}
+	}
+
+	var got []fence.Fence
+	if err := json.Unmarshal(get(t, h, "/api/fences").Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(got) != 1 || got[0].Column != "profile" || got[0].Shard == nil || *got[0].Shard != 3 || got[0].ExpiresAt.IsZero() {
+		t.Fatalf("got %+v", got)
+	}
+
+	if rec := send(http.MethodDelete, "/api/fences?column=profile", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("DELETE other scope: status %d, want 404", rec.Code)
+	}
+	if rec := send(http.MethodDelete, "/api/fences?column=profile&shard=3", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE: status %d, want 204", rec.Code)
+	}
+	if body := get(t, h, "/api/fences").Body.String(); strings.TrimSpace(body) != "[]" {
+		t.Errorf("after DELETE: %s", body)
+	}
+}
+
+func TestHandler_Plugins(t *testing.T) {
+	rec := get(t, newTestHandler(), "/api/plugins")
+
+	var got []map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(got) != 1 || got[0]["name"] != "billing" {
+		t.Fatalf("got %+v", got)
+	}
+	if _, ok := got[0]["delivery"]; !ok {
+		t.Error("expected delivery stats")
+	}
+}
+
+func TestHandler_DeadLettersEmpty(t *testing.T) {
+	rec := get(t, newTestHandler(), "/api/dead-letters")
+	if strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Errorf("got %s, want []", rec.Body)
+	}
+}
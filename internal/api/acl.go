@@ -0,0 +1,220 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/ryanbastic/go-mezzanine/internal/apikey"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// A row written with an API key that has a tenant is owned by that tenant:
+// the first such write stores the tenant in the row's owner column, a
+// system column that clients cannot write. With row ACLs enforced, keys of
+// other tenants can neither write nor read the row, and tenant keys may not
+// use reads spanning rows, which cannot be filtered by owner without
+// breaking their paging. Keys without a tenant, and rows without an owner,
+// are not restricted.
+
+// RowACL says what the API does when a tenant's key reaches for a row owned
+// by another tenant.
+type RowACL string
+
+const (
+	// RowACLOff neither records nor checks row owners.
+	RowACLOff RowACL = "off"
+	// RowACLWarn records owners and logs and counts violations, but lets
+	// them through.
+	RowACLWarn RowACL = "warn"
+	// RowACLEnforce records owners and refuses violations: foreign rows
+	// are not found, writes to them are forbidden.
+	RowACLEnforce RowACL = "enforce"
+)
+
+// ownerColumn holds a row's owner, at ownerRefKey, in an ownerBody.
+const (
+	ownerColumn = cell.ReservedPrefix + "owner"
+	ownerRefKey = 1
+)
+
+type ownerBody struct {
+	Tenant string `json:"tenant"`
+}
+
+var rowACLViolations = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "mezzanine",
+		Name:      "row_acl_violations_total",
+		Help:      "Requests by a tenant's API key for rows owned by another tenant, or for reads spanning rows, by operation.",
+	},
+	[]string{"op"},
+)
+
+// rowACL applies a RowACL mode to requests.
+type rowACL struct {
+	mode   RowACL
+	logger *slog.Logger
+}
+
+// tenant returns the tenant of the request's API key, if row ACLs apply to
+// it.
+func (a rowACL) tenant(ctx context.Context) (*apikey.Key, bool) {
+	if a.mode == "" || a.mode == RowACLOff {
+		return nil, false
+	}
+	k, ok := apikey.FromContext(ctx)
+	return k, ok && k.Tenant != ""
+}
+
+// violation logs and counts a violation and reports whether to refuse it.
+func (a rowACL) violation(k *apikey.Key, op string, args ...any) bool {
+	rowACLViolations.WithLabelValues(op).Inc()
+	a.logger.Warn("row ACL violation", append([]any{"op", op, "key", k.Name, "tenant", k.Tenant, "enforced", a.mode == RowACLEnforce}, args...)...)
+	return a.mode == RowACLEnforce
+}
+
+// owners returns the owner of each of rows that has one. All rows must be
+// on store's shard.
+func owners(ctx context.Context, store storage.CellStore, rows []uuid.UUID) (map[uuid.UUID]string, error) {
+	refs := make([]cell.CellRef, len(rows))
+	for i, row := range rows {
+		refs[i] = cell.CellRef{RowKey: row, ColumnName: ownerColumn, RefKey: ownerRefKey}
+	}
+	found, err := store.GetCells(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[uuid.UUID]string, len(rows))
+	for _, c := range found {
+		if c == nil {
+			continue
+		}
+		var body ownerBody
+		if err := json.Unmarshal(c.Body, &body); err != nil {
+			return nil, fmt.Errorf("row %s: invalid owner: %w", c.RowKey, err)
+		}
+		out[c.RowKey] = body.Tenant
+	}
+	return out, nil
+}
+
+// authorize checks that the request's tenant may write rows, all on store's
+// shard, and returns the owner cells recording it as the owner of those
+// without one, for the write to store with its cells.
+func (a rowACL) authorize(ctx context.Context, store storage.CellStore, rows []uuid.UUID) ([]cell.WriteCellRequest, error) {
+	k, ok := a.tenant(ctx)
+	if !ok {
+		return nil, nil
+	}
+	rows = distinctRows(rows)
+	owner, err := json.Marshal(ownerBody{Tenant: k.Tenant})
+	if err != nil {
+		return nil, err
+	}
+	have, err := owners(ctx, store, rows)
+	if err != nil {
+		a.logger.Error("failed to read row owners", "rows", len(rows), "error", err)
+		return nil, failed(ctx, err, "failed to check row owners")
+	}
+	var unowned []cell.WriteCellRequest
+	for _, row := range rows {
+		tenant, ok := have[row]
+		switch {
+		case !ok:
+			unowned = append(unowned, cell.WriteCellRequest{RowKey: row, ColumnName: ownerColumn, RefKey: ownerRefKey, Body: owner})
+		case tenant != k.Tenant && a.violation(k, "write", "row_key", row, "owner", tenant):
+			return nil, huma.Error403Forbidden(fmt.Sprintf("row %s belongs to another tenant", row))
+		}
+	}
+	return unowned, nil
+}
+
+// claim checks that the request's tenant may write rows, all on store's
+// shard, and unless dryRun records it as the owner of those without one.
+func (a rowACL) claim(ctx context.Context, store storage.CellStore, rows []uuid.UUID, dryRun bool) error {
+	// A claim racing another tenant's for the same row conflicts on the
+	// owner cell; the second pass then sees the winner.
+	for attempt := 0; ; attempt++ {
+		unowned, err := a.authorize(ctx, store, rows)
+		if err != nil {
+			return err
+		}
+		if len(unowned) == 0 || dryRun {
+			return nil
+		}
+		_, err = store.WriteCells(ctx, unowned)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, storage.ErrCellExists) || attempt > 0 {
+			a.logger.Error("failed to record row owners", "rows", len(unowned), "error", err)
+			return failed(ctx, err, "failed to record row owners")
+		}
+	}
+}
+
+// foreign returns those of rows, all on store's shard, that the request's
+// tenant may not read.
+func (a rowACL) foreign(ctx context.Context, store storage.CellStore, rows []uuid.UUID) (map[uuid.UUID]bool, error) {
+	k, ok := a.tenant(ctx)
+	if !ok {
+		return nil, nil
+	}
+	have, err := owners(ctx, store, distinctRows(rows))
+	if err != nil {
+		return nil, fmt.Errorf("read row owners: %w", err)
+	}
+	var out map[uuid.UUID]bool
+	for row, tenant := range have {
+		if tenant == k.Tenant || !a.violation(k, "read", "row_key", row, "owner", tenant) {
+			continue
+		}
+		if out == nil {
+			out = make(map[uuid.UUID]bool)
+		}
+		out[row] = true
+	}
+	return out, nil
+}
+
+// readable is foreign for one row, answering a foreign row with notFound.
+func (a rowACL) readable(ctx context.Context, store storage.CellStore, row uuid.UUID, notFound string) error {
+	foreign, err := a.foreign(ctx, store, []uuid.UUID{row})
+	if err != nil {
+		a.logger.Error("failed to read row owners", "row_key", row, "error", err)
+		return failed(ctx, err, "failed to check row owner")
+	}
+	if foreign[row] {
+		return huma.Error404NotFound(notFound)
+	}
+	return nil
+}
+
+// scan refuses a read spanning rows, op, to tenant keys.
+func (a rowACL) scan(ctx context.Context, op string) error {
+	k, ok := a.tenant(ctx)
+	if !ok || !a.violation(k, op) {
+		return nil
+	}
+	return huma.Error403Forbidden(fmt.Sprintf("API key %q is scoped to tenant %q and may only read rows by key", k.Name, k.Tenant))
+}
+
+func distinctRows(rows []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(rows))
+	out := rows[:0:0]
+	for _, row := range rows {
+		if !seen[row] {
+			seen[row] = true
+			out = append(out, row)
+		}
+	}
+	return out
+}
@@ -0,0 +1,307 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/apikey"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/fence"
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+)
+
+func setupACLServer(store *memory.Store, mode RowACL) http.Handler {
+	r := shard.NewRouter()
+	for i := range 8 {
+		r.Register(shard.ID(i), store)
+	}
+	keys := apikey.NewSet(&apikey.Config{Keys: []apikey.Key{
+		{Name: "backend", SHA256: sha256Hex("backend-token")},
+		{Name: "acme", SHA256: sha256Hex("acme-token"), Tenant: "acme"},
+		{Name: "globex", SHA256: sha256Hex("globex-token"), Tenant: "globex"},
+		{Name: "ops", SHA256: sha256Hex("ops-token"), Admin: true},
+	}})
+	return NewServer(testLogger(), r, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 8, nil, ServerOptions{APIKeys: keys, RowACL: mode})
+}
+
+func aclRequest(server http.Handler, token, method, path string, body any) *httptest.ResponseRecorder {
+	var r io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		r = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, r)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", token)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	return w
+}
+
+func aclWrite(server http.Handler, token string, row uuid.UUID, ref int64) int {
+	w := aclRequest(server, token, http.MethodPost, "/v1/cells", map[string]any{"row_key": row, "column_name": "profile", "ref_key": ref, "body": map[string]any{}})
+	return w.Code
+}
+
+func TestRowACL_Enforce(t *testing.T) {
+	store := memory.New()
+	server := setupACLServer(store, RowACLEnforce)
+	row := uuid.New()
+	if code := aclWrite(server, "acme-token", row, 1); code != http.StatusCreated {
+		t.Fatalf("owner's first write: got %d", code)
+	}
+	owner, err := store.GetCell(t.Context(), cell.CellRef{RowKey: row, ColumnName: ownerColumn, RefKey: ownerRefKey})
+	if err != nil || string(owner.Body) != `{"tenant":"acme"}` {
+		t.Fatalf("owner cell: got %v, %v", owner, err)
+	}
+
+	if code := aclWrite(server, "acme-token", row, 2); code != http.StatusCreated {
+		t.Errorf("owner's second write: got %d, want 201", code)
+	}
+	if code := aclWrite(server, "globex-token", row, 3); code != http.StatusForbidden {
+		t.Errorf("other tenant's write: got %d, want 403", code)
+	}
+	if code := aclWrite(server, "backend-token", row, 3); code != http.StatusCreated {
+		t.Errorf("untenanted key's write: got %d, want 201", code)
+	}
+
+	cellPath := "/v1/cells/" + row.String() + "/profile"
+	for _, tt := range []struct {
+		token, method, path string
+		want                int
+	}{
+		{"acme-token", http.MethodGet, cellPath, http.StatusOK},
+		{"backend-token", http.MethodGet, cellPath, http.StatusOK},
+		{"globex-token", http.MethodGet, cellPath, http.StatusNotFound},
+		{"globex-token", http.MethodGet, cellPath + "/1", http.StatusNotFound},
+		{"globex-token", http.MethodHead, cellPath, http.StatusNotFound},
+		{"globex-token", http.MethodHead, "/v1/cells/" + row.String(), http.StatusNotFound},
+		{"globex-token", http.MethodGet, "/v1/cells/partitionRead?partition_number=0&read_type=2&added_id=0", http.StatusForbidden},
+		{"acme-token", http.MethodGet, "/v1/cells/partitionRead?partition_number=0&read_type=2&added_id=0", http.StatusForbidden},
+		{"backend-token", http.MethodGet, "/v1/cells/partitionRead?partition_number=0&read_type=2&added_id=0", http.StatusOK},
+	} {
+		if w := aclRequest(server, tt.token, tt.method, tt.path, nil); w.Code != tt.want {
+			t.Errorf("%s %s with %s: got %d, want %d\nbody: %s", tt.method, tt.path, tt.token, w.Code, tt.want, w.Body.String())
+		}
+	}
+
+	w := aclRequest(server, "globex-token", http.MethodGet, "/v1/cells/"+row.String(), nil)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "profile") {
+		t.Errorf("other tenant's row read: got %d %s, want an empty row", w.Code, w.Body.String())
+	}
+
+	other := uuid.New()
+	if code := aclWrite(server, "globex-token", other, 1); code != http.StatusCreated {
+		t.Fatalf("globex write: got %d", code)
+	}
+	w = aclRequest(server, "globex-token", http.MethodPost, "/v1/rows:batchGet", map[string]any{"row_keys": []uuid.UUID{row, other}})
+	var rows GetRowsResponse
+	_ = json.NewDecoder(w.Body).Decode(&rows)
+	if _, ok := rows.Rows[other.String()]; !ok || len(rows.Rows) != 1 || len(rows.Missing) != 1 || rows.Missing[0] != row {
+		t.Errorf("batchGet: got %+v, want only the own row and the foreign one missing", rows)
+	}
+	w = aclRequest(server, "globex-token", http.MethodPost, "/v1/cells/multiget", map[string]any{"refs": []map[string]any{
+		{"row_key": row, "column_name": "profile", "ref_key": 1},
+		{"row_key": other, "column_name": "profile", "ref_key": 1},
+	}})
+	var cells GetCellsResponse
+	_ = json.NewDecoder(w.Body).Decode(&cells)
+	if len(cells.Cells) != 1 || cells.Cells[0].RowKey != other || len(cells.Missing) != 1 {
+		t.Errorf("multiget: got %+v, want only the own cell", cells)
+	}
+}
+
+func TestRowACL_HeadRowHidesSystemColumns(t *testing.T) {
+	store := memory.New()
+	server := setupACLServer(store, RowACLEnforce)
+	row := uuid.New()
+	seedCells(t, store, cell.Cell{RowKey: row, ColumnName: ownerColumn, RefKey: ownerRefKey, Body: json.RawMessage(`{"tenant":"acme"}`)})
+
+	if w := aclRequest(server, "acme-token", http.MethodHead, "/v1/cells/"+row.String(), nil); w.Code != http.StatusNotFound {
+		t.Errorf("owner-only row with a tenant key: got %d, want 404", w.Code)
+	}
+	w := aclRequest(server, "ops-token", http.MethodHead, "/v1/cells/"+row.String(), nil)
+	if w.Code != http.StatusOK || w.Header().Get("X-Column-Count") != "1" {
+		t.Errorf("owner-only row with an admin key: got %d, X-Column-Count %q", w.Code, w.Header().Get("X-Column-Count"))
+	}
+}
+
+func TestRowACL_RefusedWriteLeavesRowUnclaimed(t *testing.T) {
+	fences := fence.NewRegistry()
+	if _, err := fences.Set(t.Context(), fence.Fence{Column: "orders", Reason: "cutover"}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	store := memory.New()
+	r := shard.NewRouter()
+	r.Use(fences.Interceptor())
+	for i := range 8 {
+		r.Register(shard.ID(i), store)
+	}
+	keys := apikey.NewSet(&apikey.Config{Keys: []apikey.Key{{Name: "acme", SHA256: sha256Hex("acme-token"), Tenant: "acme"}}})
+	reject := func(_ context.Context, req cell.WriteCellRequest) (json.RawMessage, error) {
+		if req.ColumnName == "invalid" {
+			return nil, errors.New("invalid body")
+		}
+		return nil, nil
+	}
+	server := NewServer(testLogger(), r, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 8, nil, ServerOptions{APIKeys: keys, RowACL: RowACLEnforce, RowMetadata: true, WriteHooks: []WriteHook{reject}})
+
+	row := uuid.New()
+	write := func(column string) map[string]any {
+		return map[string]any{"row_key": row, "column_name": column, "ref_key": 1, "body": map[string]any{}}
+	}
+	for _, tt := range []struct {
+		name, path string
+		body       any
+		want       int
+	}{
+		{"fenced write", "/v1/cells", write("orders"), http.StatusServiceUnavailable},
+		{"fenced batch", "/v1/cells/batch", map[string]any{"cells": []any{write("profile"), write("orders")}}, http.StatusServiceUnavailable},
+		{"hook rejection", "/v1/cells", write("invalid"), http.StatusUnprocessableEntity},
+		{"hook rejection of an update", "/v1/cells:update", map[string]any{"row_key": row, "column_name": "invalid", "ops": []map[string]any{{"op": "increment", "field": "n", "value": 1}}}, http.StatusUnprocessableEntity},
+	} {
+		if w := aclRequest(server, "acme-token", http.MethodPost, tt.path, tt.body); w.Code != tt.want {
+			t.Errorf("%s: got %d, want %d\nbody: %s", tt.name, w.Code, tt.want, w.Body.String())
+		}
+		if n := store.Len(); n != 0 {
+			t.Fatalf("%s left %d cells behind", tt.name, n)
+		}
+	}
+
+	if w := aclRequest(server, "acme-token", http.MethodPost, "/v1/cells", write("profile")); w.Code != http.StatusCreated {
+		t.Fatalf("write: got %d", w.Code)
+	}
+	for _, column := range []string{ownerColumn, metaColumn, "profile"} {
+		if _, err := store.GetCellLatest(t.Context(), row, column); err != nil {
+			t.Errorf("%s after the write: %v", column, err)
+		}
+	}
+}
+
+func TestRowACL_BatchAndDryRun(t *testing.T) {
+	store := memory.New()
+	server := setupACLServer(store, RowACLEnforce)
+	keys := keysOnShard(2, 8)
+	if code := aclWrite(server, "acme-token", keys[0], 1); code != http.StatusCreated {
+		t.Fatalf("write: got %d", code)
+	}
+	batch := map[string]any{"cells": []map[string]any{
+		{"row_key": keys[1], "column_name": "profile", "ref_key": 1, "body": map[string]any{}},
+		{"row_key": keys[0], "column_name": "profile", "ref_key": 2, "body": map[string]any{}},
+	}}
+	n := store.Len()
+	if w := aclRequest(server, "globex-token", http.MethodPost, "/v1/cells/batch?dry_run=true", batch); w.Code != http.StatusForbidden {
+		t.Errorf("dry run over a foreign row: got %d, want 403", w.Code)
+	}
+	if w := aclRequest(server, "globex-token", http.MethodPost, "/v1/cells/batch", batch); w.Code != http.StatusForbidden {
+		t.Errorf("batch over a foreign row: got %d, want 403", w.Code)
+	}
+	if store.Len() != n {
+		t.Errorf("refused batch stored %d cells", store.Len()-n)
+	}
+	if w := aclRequest(server, "acme-token", http.MethodPost, "/v1/cells/batch?dry_run=true", batch); w.Code != http.StatusOK || store.Len() != n {
+		t.Errorf("owner's dry run: got %d and %d new cells, want 200 and none", w.Code, store.Len()-n)
+	}
+	if w := aclRequest(server, "acme-token", http.MethodPost, "/v1/cells/batch", batch); w.Code != http.StatusCreated {
+		t.Errorf("owner's batch: got %d, want 201", w.Code)
+	}
+	if code := aclWrite(server, "globex-token", keys[1], 2); code != http.StatusForbidden {
+		t.Errorf("row claimed by the batch: got %d, want 403", code)
+	}
+}
+
+func TestRowACL_Warn(t *testing.T) {
+	store := memory.New()
+	server := setupACLServer(store, RowACLWarn)
+	row := uuid.New()
+	if code := aclWrite(server, "acme-token", row, 1); code != http.StatusCreated {
+		t.Fatalf("write: got %d", code)
+	}
+	if code := aclWrite(server, "globex-token", row, 2); code != http.StatusCreated {
+		t.Errorf("other tenant's write: got %d, want 201", code)
+	}
+	if w := aclRequest(server, "globex-token", http.MethodGet, "/v1/cells/"+row.String()+"/profile", nil); w.Code != http.StatusOK {
+		t.Errorf("other tenant's read: got %d, want 200", w.Code)
+	}
+	owner, err := store.GetCell(t.Context(), cell.CellRef{RowKey: row, ColumnName: ownerColumn, RefKey: ownerRefKey})
+	if err != nil || string(owner.Body) != `{"tenant":"acme"}` {
+		t.Errorf("owner cell: got %v, %v", owner, err)
+	}
+}
+
+func TestRowACL_Off(t *testing.T) {
+	store := memory.New()
+	server := setupACLServer(store, RowACLOff)
+	row := uuid.New()
+	if code := aclWrite(server, "acme-token", row, 1); code != http.StatusCreated {
+		t.Fatalf("write: got %d", code)
+	}
+	if store.Len() != 1 {
+		t.Errorf("stored %d cells, want 1 without an owner", store.Len())
+	}
+}
+
+func TestSystemColumns_AdminOnly(t *testing.T) {
+	store := memory.New()
+	server := setupACLServer(store, RowACLWarn)
+	row := uuid.New()
+	if code := aclWrite(server, "acme-token", row, 1); code != http.StatusCreated {
+		t.Fatalf("write: got %d", code)
+	}
+
+	rowPath := "/v1/cells/" + row.String()
+	for _, tt := range []struct {
+		token string
+		want  bool
+	}{{"backend-token", false}, {"acme-token", false}, {"ops-token", true}} {
+		w := aclRequest(server, tt.token, http.MethodGet, rowPath, nil)
+		if got := strings.Contains(w.Body.String(), ownerColumn); w.Code != http.StatusOK || got != tt.want {
+			t.Errorf("row read with %s: got %d %s, want owner column listed %v", tt.token, w.Code, w.Body.String(), tt.want)
+		}
+		code := http.StatusNotFound
+		if tt.want {
+			code = http.StatusOK
+		}
+		if w := aclRequest(server, tt.token, http.MethodGet, rowPath+"/"+ownerColumn, nil); w.Code != code {
+			t.Errorf("owner cell read with %s: got %d, want %d", tt.token, w.Code, code)
+		}
+	}
+
+	w := aclRequest(server, "backend-token", http.MethodPost, "/v1/cells/multiget", map[string]any{"refs": []map[string]any{
+		{"row_key": row, "column_name": ownerColumn, "ref_key": ownerRefKey},
+	}})
+	var cells GetCellsResponse
+	_ = json.NewDecoder(w.Body).Decode(&cells)
+	if len(cells.Cells) != 0 || len(cells.Missing) != 1 {
+		t.Errorf("multiget of the owner cell: got %+v, want it missing", cells)
+	}
+	w = aclRequest(server, "backend-token", http.MethodPost, "/v1/rows:batchGet", map[string]any{"row_keys": []uuid.UUID{row}})
+	if strings.Contains(w.Body.String(), ownerColumn) {
+		t.Errorf("batchGet: got %s, want no owner column", w.Body.String())
+	}
+
+	// The owner cell is stored before the profile, so a page of one cell
+	// holds only the owner; it is read past instead of coming back empty.
+	partition := "/v1/cells/partitionRead?partition_number=0&read_type=2&added_id=0&limit=1"
+	w = aclRequest(server, "backend-token", http.MethodGet, partition, nil)
+	var page []CellResponse
+	if err := json.NewDecoder(w.Body).Decode(&page); err != nil || len(page) != 1 || page[0].ColumnName != "profile" {
+		t.Errorf("partitionRead: got %d %v, want the profile cell", w.Code, page)
+	}
+	w = aclRequest(server, "ops-token", http.MethodGet, partition, nil)
+	page = nil
+	if err := json.NewDecoder(w.Body).Decode(&page); err != nil || len(page) != 1 || page[0].ColumnName != ownerColumn {
+		t.Errorf("partitionRead with an admin key: got %d %v, want the owner cell", w.Code, page)
+	}
+}
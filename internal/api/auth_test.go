@@ -0,0 +1,147 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/apikey"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+)
+
+func setupAuthServer(store *memory.Store) http.Handler {
+	r := shard.NewRouter()
+	for i := range 8 {
+		r.Register(shard.ID(i), store)
+	}
+	keys := apikey.NewSet(&apikey.Config{Keys: []apikey.Key{
+		{Name: "backend", SHA256: sha256Hex("backend-token")},
+		{Name: "support", SHA256: sha256Hex("support-token"), Mask: []string{"ssn"}, Hash: []string{"email"}, Write: []string{}},
+		{Name: "billing", SHA256: sha256Hex("billing-token"), Write: []string{"billing", "invoice_*"}},
+	}})
+	return NewServer(testLogger(), r, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 8, nil, ServerOptions{APIKeys: keys})
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	server := setupAuthServer(memory.New())
+	tests := []struct {
+		name   string
+		path   string
+		header map[string]string
+		want   int
+	}{
+		{"missing key", "/v1/shards/count", nil, http.StatusUnauthorized},
+		{"invalid key", "/v1/shards/count", map[string]string{"X-API-Key": "nope"}, http.StatusUnauthorized},
+		{"x-api-key", "/v1/shards/count", map[string]string{"X-API-Key": "backend-token"}, http.StatusOK},
+		{"bearer", "/v1/shards/count", map[string]string{"Authorization": "Bearer backend-token"}, http.StatusOK},
+		{"basic is not a key", "/v1/shards/count", map[string]string{"Authorization": "Basic backend-token"}, http.StatusUnauthorized},
+		{"liveness is open", "/v1/livez", nil, http.StatusOK},
+		{"spec is open", "/openapi.json", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status: got %d, want %d\nbody: %s", w.Code, tt.want, w.Body.String())
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("Content-Type") != "application/problem+json" {
+				t.Errorf("Content-Type: got %q", w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestRequireAPIKey_AppliesMaskPolicy(t *testing.T) {
+	store := memory.New()
+	rowKey := uuid.New()
+	seedCells(t, store, cell.Cell{
+		AddedID: 1, RowKey: rowKey, ColumnName: "profile", RefKey: 1,
+		Body: json.RawMessage(`{"name":"Ann","email":"ann@example.com","ssn":"123"}`), CreatedAt: time.Now(),
+	})
+	server := setupAuthServer(store)
+
+	get := func(token, query string) string {
+		req := httptest.NewRequest(http.MethodGet, "/v1/cells/"+rowKey.String()+"/profile/1"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status: got %d\nbody: %s", w.Code, w.Body.String())
+		}
+		var resp CellResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return string(resp.Body)
+	}
+
+	if got := get("backend-token", ""); got != `{"name":"Ann","email":"ann@example.com","ssn":"123"}` {
+		t.Errorf("backend key: got %s", got)
+	}
+	want := `{"email":"sha256:` + sha256Hex("ann@example.com") + `","name":"Ann"}`
+	if got := get("support-token", ""); got != want {
+		t.Errorf("support key: got  %s\nwant %s", got, want)
+	}
+	// The query can mask more but cannot lift the key's policy.
+	if got := get("support-token", "?mask=name"); got != `{"email":"sha256:`+sha256Hex("ann@example.com")+`"}` {
+		t.Errorf("support key with mask: got %s", got)
+	}
+}
+
+func TestRequireAPIKey_WritePermissions(t *testing.T) {
+	server := setupAuthServer(memory.New())
+	send := func(token, path string, body any) int {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", token)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w.Code
+	}
+	cellBody := func(column string) map[string]any {
+		return map[string]any{"row_key": uuid.New().String(), "column_name": column, "ref_key": 1, "body": map[string]any{}}
+	}
+
+	tests := []struct {
+		token, column string
+		want          int
+	}{
+		{"backend-token", "billing", http.StatusCreated},
+		{"billing-token", "billing", http.StatusCreated},
+		{"billing-token", "invoice_2026", http.StatusCreated},
+		{"billing-token", "profile", http.StatusForbidden},
+		{"support-token", "profile", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if got := send(tt.token, "/v1/cells", cellBody(tt.column)); got != tt.want {
+			t.Errorf("%s writing %s: got %d, want %d", tt.token, tt.column, got, tt.want)
+		}
+	}
+
+	// A batch is rejected as a whole if any cell is not allowed.
+	keys := keysOnShard(2, 8)
+	batch := map[string]any{"cells": []map[string]any{
+		{"row_key": keys[0].String(), "column_name": "billing", "ref_key": 1, "body": map[string]any{}},
+		{"row_key": keys[1].String(), "column_name": "profile", "ref_key": 1, "body": map[string]any{}},
+	}}
+	if got := send("billing-token", "/v1/cells/batch", batch); got != http.StatusForbidden {
+		t.Errorf("mixed batch: got %d, want 403", got)
+	}
+	if got := send("backend-token", "/v1/cells/batch", batch); got != http.StatusCreated {
+		t.Errorf("unrestricted batch: got %d, want 201", got)
+	}
+}
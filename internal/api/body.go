@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// BodyLimits bounds request bodies. Bodies over a limit are rejected with
+// 413, malformed bodies with 400 and bodies that do not match the schema
+// with 422, all as problem+json.
+type BodyLimits struct {
+	// MaxBytes bounds single-cell writes and other requests with a body.
+	MaxBytes int64
+	// MaxBatchBytes bounds multi-cell requests: batch writes, multiget and
+	// rows:batchGet.
+	MaxBatchBytes int64
+	// AllowUnknownFields accepts and ignores JSON fields the API does not
+	// define. By default they are rejected, so that a misspelled field is
+	// not silently dropped.
+	AllowUnknownFields bool
+}
+
+// DefaultBodyLimits returns the body limits used when none are configured.
+func DefaultBodyLimits() BodyLimits {
+	return BodyLimits{MaxBytes: 1 << 20, MaxBatchBytes: 16 << 20}
+}
+
+// withDefaults fills unset limits from DefaultBodyLimits.
+func (l BodyLimits) withDefaults() BodyLimits {
+	d := DefaultBodyLimits()
+	if l.MaxBytes <= 0 {
+		l.MaxBytes = d.MaxBytes
+	}
+	if l.MaxBatchBytes <= 0 {
+		l.MaxBatchBytes = max(d.MaxBatchBytes, l.MaxBytes)
+	}
+	return l
+}
+
+// LimitRequestBody rejects requests whose declared Content-Length exceeds
+// limit before reading them, and caps chunked bodies at limit so that no route,
+// including ones outside the huma API, can be made to read an unbounded
+// body. Operations apply their own, smaller limits on top.
+func LimitRequestBody(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				w.Header().Set("Content-Type", "application/problem+json")
+				w.Header().Set("Connection", "close")
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				json.NewEncoder(w).Encode(map[string]any{
+					"title":  http.StatusText(http.StatusRequestEntityTooLarge),
+					"status": http.StatusRequestEntityTooLarge,
+					"detail": fmt.Sprintf("request body is too large limit=%d bytes", limit),
+				})
+				return
+			}
+			if r.Body != nil && r.Body != http.NoBody {
+				// One byte over, so huma's own check at limit still reports 413.
+				r.Body = http.MaxBytesReader(w, r.Body, limit+1)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// allowUnknownFields lets the request bodies of every registered operation
+// carry properties their schemas do not define. huma closes object schemas
+// by default; request schemas are shared with the validator, so opening
+// them here takes effect for requests.
+func allowUnknownFields(api huma.API) {
+	oapi := api.OpenAPI()
+	seen := make(map[*huma.Schema]bool)
+	for _, item := range oapi.Paths {
+		for _, op := range []*huma.Operation{item.Get, item.Put, item.Post, item.Patch, item.Delete} {
+			if op == nil || op.RequestBody == nil {
+				continue
+			}
+			for _, mt := range op.RequestBody.Content {
+				openSchema(oapi.Components.Schemas, mt.Schema, seen)
+			}
+		}
+	}
+}
+
+func openSchema(registry huma.Registry, s *huma.Schema, seen map[*huma.Schema]bool) {
+	if s == nil {
+		return
+	}
+	if s.Ref != "" {
+		s = registry.SchemaFromRef(s.Ref)
+		if s == nil {
+			return
+		}
+	}
+	if seen[s] {
+		return
+	}
+	seen[s] = true
+	if s.Type == huma.TypeObject && s.AdditionalProperties == false {
+		s.AdditionalProperties = true
+	}
+	for name, p := range s.Properties {
+		// "$schema" is huma's link to the schema, not client data.
+		if strings.HasPrefix(name, "$") {
+			continue
+		}
+		openSchema(registry, p, seen)
+	}
+	openSchema(registry, s.Items, seen)
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+)
+
+func setupBodyServer(store *memory.Store, body BodyLimits) http.Handler {
+	r := shard.NewRouter()
+	for i := range 8 {
+		r.Register(shard.ID(i), store)
+	}
+	return NewServer(testLogger(), r, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 8, nil, ServerOptions{Body: body})
+}
+
+func postRaw(server http.Handler, path string, body io.Reader) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, body)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	return w
+}
+
+func TestBodyLimits_Defaults(t *testing.T) {
+	got := BodyLimits{}.withDefaults()
+	if got != DefaultBodyLimits() {
+		t.Errorf("got %+v, want %+v", got, DefaultBodyLimits())
+	}
+	// A batch is never limited below a single write.
+	got = BodyLimits{MaxBytes: 32 << 20}.withDefaults()
+	if got.MaxBatchBytes != 32<<20 {
+		t.Errorf("MaxBatchBytes = %d, want %d", got.MaxBatchBytes, 32<<20)
+	}
+}
+
+func TestWriteCell_BodyTooLarge(t *testing.T) {
+	server := setupBodyServer(memory.New(), BodyLimits{MaxBytes: 1024})
+	body, _ := json.Marshal(map[string]any{
+		"row_key": uuid.New().String(), "column_name": "profile", "ref_key": 1,
+		"body": map[string]any{"pad": strings.Repeat("x", 2048)},
+	})
+
+	w := postRaw(server, "/v1/cells", bytes.NewReader(body))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status: got %d, want 413\nbody: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Content-Type: got %q", ct)
+	}
+
+	// Without a Content-Length the body is cut off while it is read.
+	w = postRaw(server, "/v1/cells", io.MultiReader(bytes.NewReader(body)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("chunked: got %d, want 413\nbody: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestWriteCellsBatch_UsesBatchLimit(t *testing.T) {
+	server := setupBodyServer(memory.New(), BodyLimits{MaxBytes: 1024, MaxBatchBytes: 64 << 10})
+	keys := keysOnShard(2, 8)
+	cells := make([]map[string]any, len(keys))
+	for i, k := range keys {
+		cells[i] = map[string]any{"row_key": k.String(), "column_name": "profile", "ref_key": 1, "body": map[string]any{"pad": strings.Repeat("x", 1024)}}
+	}
+	body, _ := json.Marshal(map[string]any{"cells": cells})
+
+	if w := postRaw(server, "/v1/cells/batch", bytes.NewReader(body)); w.Code != http.StatusCreated {
+		t.Errorf("batch under the batch limit: got %d, want 201\nbody: %s", w.Code, w.Body.String())
+	}
+	big := bytes.Repeat([]byte(" "), 65<<10)
+	if w := postRaw(server, "/v1/cells/batch", bytes.NewReader(append(big, body...))); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("batch over the batch limit: got %d, want 413", w.Code)
+	}
+}
+
+func TestLimitRequestBody_DeclaredLength(t *testing.T) {
+	called := false
+	h := LimitRequestBody(10)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/v1/cells", strings.NewReader(strings.Repeat("x", 11)))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge || called {
+		t.Errorf("got %d, handler called %v; want 413 before the handler", w.Code, called)
+	}
+	var problem map[string]any
+	if err := json.NewDecoder(w.Body).Decode(&problem); err != nil || problem["detail"] != "request body is too large limit=10 bytes" {
+		t.Errorf("problem: %v, %v", problem, err)
+	}
+}
+
+func TestWriteCell_UnknownField(t *testing.T) {
+	body, _ := json.Marshal(map[string]any{
+		"row_key": uuid.New().String(), "column_name": "profile", "ref_key": 1,
+		"body": map[string]any{"name": "Ann"}, "colum_name": "typo",
+	})
+
+	strict := setupBodyServer(memory.New(), BodyLimits{})
+	if w := postRaw(strict, "/v1/cells", bytes.NewReader(body)); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("strict: got %d, want 422\nbody: %s", w.Code, w.Body.String())
+	}
+
+	lenient := setupBodyServer(memory.New(), BodyLimits{AllowUnknownFields: true})
+	if w := postRaw(lenient, "/v1/cells", bytes.NewReader(body)); w.Code != http.StatusCreated {
+		t.Errorf("lenient: got %d, want 201\nbody: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestWriteCell_MalformedJSON(t *testing.T) {
+	server := setupBodyServer(memory.New(), BodyLimits{})
+	w := postRaw(server, "/v1/cells", strings.NewReader(`{"row_key": `))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status: got %d, want 400\nbody: %s", w.Code, w.Body.String())
+	}
+}
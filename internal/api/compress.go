@@ -0,0 +1,208 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// DefaultCompressMinSize is the smallest response body Compress encodes;
+// below it the encoding overhead outweighs the savings.
+const DefaultCompressMinSize = 1024
+
+var (
+	gzipPool = sync.Pool{New: func() any {
+		w, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return w
+	}}
+	zstdPool = sync.Pool{New: func() any {
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zstd.SpeedDefault))
+		return w
+	}}
+)
+
+// Compress encodes response bodies of at least minSize bytes with zstd or
+// gzip, whichever the client's Accept-Encoding prefers (zstd on a tie).
+// Smaller responses, responses that are already encoded and non-text content
+// types are passed through. Large GetRow, partition read and index query
+// responses are the main beneficiaries.
+func Compress(minSize int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: minSize, status: http.StatusOK}
+			defer cw.finish()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding picks "zstd", "gzip" or "" (identity) from an
+// Accept-Encoding header, honouring q-values.
+func negotiateEncoding(header string) string {
+	if header == "" {
+		return ""
+	}
+	var zstdQ, gzipQ, anyQ float64 = -1, -1, -1
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "zstd":
+			zstdQ = q
+		case "gzip", "x-gzip":
+			gzipQ = q
+		case "*":
+			anyQ = q
+		}
+	}
+	if zstdQ < 0 {
+		zstdQ = anyQ
+	}
+	if gzipQ < 0 {
+		gzipQ = anyQ
+	}
+	switch {
+	case zstdQ > 0 && zstdQ >= gzipQ:
+		return "zstd"
+	case gzipQ > 0:
+		return "gzip"
+	}
+	return ""
+}
+
+// compressible reports whether a response content type is worth encoding.
+func compressible(contentType string) bool {
+	ct, _, _ := strings.Cut(contentType, ";")
+	ct = strings.TrimSpace(ct)
+	return strings.HasPrefix(ct, "text/") ||
+		strings.HasSuffix(ct, "json") ||
+		strings.HasSuffix(ct, "msgpack") ||
+		ct == "application/cbor"
+}
+
+// compressWriter buffers the first minSize bytes of a response to decide
+// whether to encode it.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+	status   int
+
+	buf         []byte
+	decided     bool
+	enc         io.WriteCloser
+	wroteHeader bool
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.status = status
+	w.wroteHeader = true
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.decided {
+		if w.enc != nil {
+			return w.enc.Write(p)
+		}
+		return w.ResponseWriter.Write(p)
+	}
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= w.minSize {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush sends what has been buffered so far; streaming responses are
+// encoded if they qualify, so flushing forces the decision early.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		_ = w.decide(len(w.buf) >= w.minSize)
+	}
+	if f, ok := w.enc.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// decide writes the header and buffered bytes, encoding them if large is
+// set and the response qualifies.
+func (w *compressWriter) decide(large bool) error {
+	w.decided = true
+	h := w.Header()
+	if large && h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) &&
+		w.status != http.StatusNoContent && w.status != http.StatusNotModified {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", w.encoding)
+		switch w.encoding {
+		case "zstd":
+			z := zstdPool.Get().(*zstd.Encoder)
+			z.Reset(w.ResponseWriter)
+			w.enc = z
+		default:
+			g := gzipPool.Get().(*gzip.Writer)
+			g.Reset(w.ResponseWriter)
+			w.enc = g
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// finish flushes a small buffered response or closes the encoder.
+func (w *compressWriter) finish() {
+	if !w.decided {
+		if !w.wroteHeader && len(w.buf) == 0 {
+			// Nothing was written; let net/http send its default response.
+			return
+		}
+		_ = w.decide(false)
+		return
+	}
+	if w.enc == nil {
+		return
+	}
+	_ = w.enc.Close()
+	switch enc := w.enc.(type) {
+	case *zstd.Encoder:
+		enc.Reset(nil)
+		zstdPool.Put(enc)
+	case *gzip.Writer:
+		enc.Reset(nil)
+		gzipPool.Put(enc)
+	}
+}
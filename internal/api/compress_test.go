@@ -0,0 +1,159 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "gzip"},
+		{"gzip, zstd", "zstd"},
+		{"zstd;q=0.5, gzip", "gzip"},
+		{"zstd;q=0, gzip;q=0", ""},
+		{"*", "zstd"},
+		{"*;q=0.1, gzip;q=0.9", "gzip"},
+	}
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.header); got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+// largeRowServer serves a row whose JSON is well above DefaultCompressMinSize.
+func largeRowServer(t *testing.T) (http.Handler, uuid.UUID) {
+	t.Helper()
+	store := memory.New()
+	rowKey := uuid.New()
+	body := json.RawMessage(`{"bio":"` + strings.Repeat("lorem ipsum ", 200) + `"}`)
+	seedCells(t, store, cell.Cell{AddedID: 1, RowKey: rowKey, ColumnName: "profile", RefKey: 1, Body: body, CreatedAt: time.Now()})
+	return setupTestServer(store, 64), rowKey
+}
+
+func getRow(server http.Handler, rowKey uuid.UUID, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/v1/cells/"+rowKey.String(), nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	return w
+}
+
+func TestCompress_Encodings(t *testing.T) {
+	server, rowKey := largeRowServer(t)
+	plain := getRow(server, rowKey, nil)
+	if plain.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("uncompressed request got Content-Encoding %q", plain.Header().Get("Content-Encoding"))
+	}
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"zstd": func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+	}
+	for encoding, newReader := range decoders {
+		t.Run(encoding, func(t *testing.T) {
+			w := getRow(server, rowKey, map[string]string{"Accept-Encoding": encoding})
+			if got := w.Header().Get("Content-Encoding"); got != encoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, encoding)
+			}
+			if w.Body.Len() >= plain.Body.Len() {
+				t.Errorf("encoded body %d bytes, plain %d", w.Body.Len(), plain.Body.Len())
+			}
+			r, err := newReader(w.Body)
+			if err != nil {
+				t.Fatalf("reader: %v", err)
+			}
+			data, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if !bytes.Equal(data, plain.Body.Bytes()) {
+				t.Error("decoded body differs from uncompressed response")
+			}
+		})
+	}
+}
+
+func TestCompress_SmallResponsePassesThrough(t *testing.T) {
+	server := setupTestServer(memory.New(), 64)
+	req := httptest.NewRequest(http.MethodGet, "/v1/shards/count", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q, want none", got)
+	}
+	if !strings.Contains(w.Body.String(), `"num_shards":64`) {
+		t.Errorf("body = %s", w.Body.String())
+	}
+	if w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Vary = %q", w.Header().Get("Vary"))
+	}
+}
+
+func TestMsgpack_ResponseAndRequest(t *testing.T) {
+	server, rowKey := largeRowServer(t)
+	w := getRow(server, rowKey, map[string]string{"Accept": "application/msgpack"})
+	if ct := w.Header().Get("Content-Type"); ct != "application/msgpack" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	var row struct {
+		RowKey string `msgpack:"row_key"`
+		Cells  []struct {
+			ColumnName string         `msgpack:"column_name"`
+			Body       map[string]any `msgpack:"body"`
+		} `msgpack:"cells"`
+	}
+	if err := msgpack.Unmarshal(w.Body.Bytes(), &row); err != nil {
+		t.Fatalf("decode msgpack: %v", err)
+	}
+	if row.RowKey != rowKey.String() || len(row.Cells) != 1 || row.Cells[0].Body["bio"] == nil {
+		t.Errorf("row = %+v", row)
+	}
+
+	data, err := msgpack.Marshal(map[string]any{
+		"row_key":     uuid.New().String(),
+		"column_name": "profile",
+		"ref_key":     1,
+		"body":        map[string]any{"name": "packed"},
+	})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/cells", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/msgpack")
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("write: status %d\n%s", rec.Code, rec.Body.String())
+	}
+	var resp CellResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if string(resp.Body) != `{"name":"packed"}` {
+		t.Errorf("stored body = %s", resp.Body)
+	}
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// Writes answer with the shard they were routed to and the shard's
+// sequence number for the write (its added_id) in X-Shard-Id and
+// X-Shard-Seq. A read passing them back as min_seq=<shard>:<seq> reflects
+// that write and every earlier one to the shard: it skips the read cache,
+// and first waits for the shard to reach the sequence, so a client can read
+// its own writes, or pass the token on to another client, whatever instance
+// serves the read.
+
+// minSeqPoll bounds the backoff between checks of whether a shard has
+// reached a min_seq, for writes through other instances, which WaitHead
+// does not see.
+const minSeqPoll = 100 * time.Millisecond
+
+func seqHeader(addedID int64) string {
+	return strconv.FormatInt(addedID, 10)
+}
+
+// parseMinSeq parses min_seq tokens into the highest sequence required per
+// shard.
+func parseMinSeq(tokens []string, numShards int) (map[shard.ID]int64, error) {
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	out := make(map[shard.ID]int64, len(tokens))
+	for _, t := range tokens {
+		id, seq, ok := strings.Cut(t, ":")
+		n, err1 := strconv.Atoi(id)
+		s, err2 := strconv.ParseInt(seq, 10, 64)
+		if !ok || err1 != nil || err2 != nil || n < 0 || n >= numShards || s < 0 {
+			return nil, huma.Error400BadRequest(fmt.Sprintf("invalid min_seq %q: want <shard>:<seq> with a shard below %d", t, numShards))
+		}
+		out[shard.ID(n)] = max(out[shard.ID(n)], s)
+	}
+	return out, nil
+}
+
+// consistentRead applies min_seq to a read of shards. Without tokens it
+// returns ctx unchanged. Otherwise the returned context marks the read
+// fresh, after each shard read that has a token has reached its sequence;
+// a shard still behind after the server's maximum wait is a retryable 503.
+func (h *CellHandler) consistentRead(ctx context.Context, tokens []string, shards ...shard.ID) (context.Context, error) {
+	minSeq, err := parseMinSeq(tokens, h.numShards)
+	if err != nil || minSeq == nil {
+		return ctx, err
+	}
+	deadline := time.Now().Add(h.maxWait)
+	for _, id := range shards {
+		seq, ok := minSeq[id]
+		if !ok {
+			continue
+		}
+		store, err := h.router.StoreFor(id)
+		if err != nil {
+			h.logger.Error("shard routing failed", "shard_id", id, "error", err)
+			return nil, huma.Error500InternalServerError("shard routing failed")
+		}
+		// The committed head, not Head: a write is committed before its
+		// seq is handed out, but Head may trail it behind transactions
+		// still running on the server.
+		backoff := time.Millisecond
+		for {
+			head, err := storage.CommittedHead(ctx, store)
+			if err != nil {
+				h.logger.Error("failed to read shard head", "shard_id", id, "error", err)
+				return nil, failed(ctx, err, "failed to check min_seq")
+			}
+			if head >= seq {
+				break
+			}
+			wait := time.Until(deadline)
+			if wait <= 0 {
+				return nil, huma.Error503ServiceUnavailable(fmt.Sprintf("shard %d has not reached seq %d", id, seq))
+			}
+			// A write through this instance reaching seq wakes the wait
+			// early; writes through others are polled for, backing off.
+			waitCtx, cancel := context.WithTimeout(ctx, min(wait, backoff))
+			_, _ = storage.WaitHead(waitCtx, store, max(head, seq-1))
+			cancel()
+			if err := ctx.Err(); err != nil {
+				return nil, failed(ctx, err, "failed to check min_seq")
+			}
+			backoff = min(2*backoff, minSeqPoll)
+		}
+	}
+	return storage.WithFreshRead(ctx), nil
+}
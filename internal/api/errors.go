@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/ryanbastic/go-mezzanine/internal/fence"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// DefaultRetryAfter is the Retry-After of 503 responses when
+// ServerOptions.RetryAfter is zero.
+const DefaultRetryAfter = time.Second
+
+// ErrorModel is the body of every error response: huma's problem details
+// with whether the request may succeed if repeated.
+type ErrorModel struct {
+	huma.ErrorModel
+	Retryable bool `json:"retryable" doc:"Whether repeating the request may succeed: the server or a backend was unavailable or too slow, not the request at fault. Clients should wait for Retry-After, if sent, before retrying."`
+}
+
+var useErrorModel sync.Once
+
+// installErrorModel makes huma build its errors with newError. huma has no
+// per-API setting for this, only the package's NewError, so NewServer
+// installs it once, before building its API, rather than every importer of
+// the package getting it.
+func installErrorModel() {
+	useErrorModel.Do(func() {
+		humaNewError := huma.NewError
+		huma.NewError = func(status int, msg string, errs ...error) huma.StatusError {
+			return newError(humaNewError, status, msg, errs...)
+		}
+	})
+}
+
+// newError wraps the error base builds as an ErrorModel. 502, 503 and 504
+// responses are retryable, as are 429s. Errors other than huma's own
+// ErrorModel are returned as they are.
+func newError(base func(int, string, ...error) huma.StatusError, status int, msg string, errs ...error) huma.StatusError {
+	err := base(status, msg, errs...)
+	e, ok := err.(*huma.ErrorModel)
+	if !ok {
+		return err
+	}
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return &ErrorModel{ErrorModel: *e, Retryable: true}
+	}
+	return &ErrorModel{ErrorModel: *e}
+}
+
+// failed returns the error for a store call that failed with err: 503 with
+// the fence's Retry-After if a write fence rejected it, 504 if the request
+// ran out of time, 503 if the backend failed transiently (see
+// storage.IsTransient), 500 otherwise. An err that is already an API
+// error is returned as is.
+func failed(ctx context.Context, err error, msg string) error {
+	var fenced *fence.Error
+	var status huma.StatusError
+	switch {
+	case errors.As(err, &status):
+		return status
+	case errors.As(err, &fenced):
+		retryAfter := strconv.Itoa(int(fenced.Fence.RetryAfter() / time.Second))
+		return huma.ErrorWithHeaders(huma.Error503ServiceUnavailable(fenced.Error()), http.Header{"Retry-After": {retryAfter}})
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return huma.Error504GatewayTimeout(msg + ": request timed out")
+	case storage.IsTransient(err):
+		return huma.Error503ServiceUnavailable(msg + ": backend unavailable")
+	}
+	return huma.Error500InternalServerError(msg)
+}
+
+// RetryAfter sets a Retry-After header on 503 responses that have none. It
+// is a whole number of seconds between after and twice after, picked at
+// random so that clients backing off from the same incident do not all
+// return at once; zero after uses DefaultRetryAfter.
+func RetryAfter(after time.Duration) func(http.Handler) http.Handler {
+	if after <= 0 {
+		after = DefaultRetryAfter
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(&retryAfterWriter{ResponseWriter: w, after: after}, r)
+		})
+	}
+}
+
+type retryAfterWriter struct {
+	http.ResponseWriter
+	after time.Duration
+}
+
+func (w *retryAfterWriter) WriteHeader(status int) {
+	if status == http.StatusServiceUnavailable && w.Header().Get("Retry-After") == "" {
+		w.Header().Set("Retry-After", retryAfterSeconds(w.after))
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *retryAfterWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *retryAfterWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// retryAfterSeconds returns a Retry-After value between after and twice
+// after, rounded up to whole seconds.
+func retryAfterSeconds(after time.Duration) string {
+	d := after + rand.N(after+1)
+	return strconv.Itoa(int((d + time.Second - 1) / time.Second))
+}
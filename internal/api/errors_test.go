@@ -0,0 +1,164 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/fence"
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+)
+
+// failingStore fails every latest-cell read with err.
+type failingStore struct {
+	*memory.Store
+	err error
+}
+
+func (s failingStore) GetCellLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, error) {
+	return nil, s.err
+}
+
+func TestFailed_Classification(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		status    int
+		retryable bool
+	}{
+		{"connection failure", &pgconn.PgError{Code: "08006"}, http.StatusServiceUnavailable, true},
+		{"shutting down", &pgconn.PgError{Code: "57P01"}, http.StatusServiceUnavailable, true},
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, http.StatusServiceUnavailable, true},
+		{"statement timeout", &pgconn.PgError{Code: "57014"}, http.StatusServiceUnavailable, true},
+		{"constraint violation", &pgconn.PgError{Code: "23502"}, http.StatusInternalServerError, false},
+		{"other", errors.New("boom"), http.StatusInternalServerError, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := setupTestServer(failingStore{memory.New(), tt.err}, 64)
+
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/cells/"+uuid.NewString()+"/profile", nil))
+			if w.Code != tt.status {
+				t.Fatalf("status: got %d, want %d\nbody: %s", w.Code, tt.status, w.Body.String())
+			}
+			var body ErrorModel
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			if body.Retryable != tt.retryable {
+				t.Errorf("retryable: got %v, want %v", body.Retryable, tt.retryable)
+			}
+			if got := w.Header().Get("Retry-After"); (got != "") != tt.retryable {
+				t.Errorf("Retry-After = %q, want set: %v", got, tt.retryable)
+			}
+		})
+	}
+}
+
+func TestFailed_GatewayTimeoutRetryable(t *testing.T) {
+	server := RequestTimeouts(Timeouts{Read: 10 * time.Millisecond})(setupTestServer(slowStore{memory.New()}, 64))
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/cells/"+uuid.NewString()+"/profile", nil))
+	var body ErrorModel
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if w.Code != http.StatusGatewayTimeout || !body.Retryable {
+		t.Errorf("got %d retryable %v, want 504 retryable true", w.Code, body.Retryable)
+	}
+}
+
+func TestFailed_Fenced(t *testing.T) {
+	fences := fence.NewRegistry()
+	if _, err := fences.Set(context.Background(), fence.Fence{Column: "profile", Reason: "cutover", RetryAfterSeconds: 30}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	r := shard.NewRouter()
+	r.Use(fences.Interceptor())
+	for i := range 64 {
+		r.Register(shard.ID(i), memory.New())
+	}
+	server := RetryAfter(time.Second)(NewServer(testLogger(), r, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil, ServerOptions{}))
+
+	data, _ := json.Marshal(map[string]any{"row_key": uuid.NewString(), "column_name": "profile", "ref_key": 1, "body": map[string]string{"name": "test"}})
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/cells", bytes.NewReader(data)))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status: got %d, want 503\nbody: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After = %q, want the fence's 30", got)
+	}
+	var body ErrorModel
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if !body.Retryable || !strings.Contains(body.Detail, "cutover") {
+		t.Errorf("body = %+v, want retryable with the fence's reason", body)
+	}
+}
+
+// plainError is a huma.StatusError other than huma.ErrorModel.
+type plainError struct{}
+
+func (plainError) Error() string  { return "plain" }
+func (plainError) GetStatus() int { return http.StatusServiceUnavailable }
+
+func TestNewError_LeavesOtherErrorsAlone(t *testing.T) {
+	got := newError(func(int, string, ...error) huma.StatusError { return plainError{} }, http.StatusServiceUnavailable, "unavailable")
+	if _, ok := got.(plainError); !ok {
+		t.Errorf("newError wrapped a %T, want it returned as is", plainError{})
+	}
+	base := func(status int, msg string, _ ...error) huma.StatusError {
+		return &huma.ErrorModel{Status: status, Detail: msg}
+	}
+	if e, ok := newError(base, http.StatusServiceUnavailable, "unavailable").(*ErrorModel); !ok || !e.Retryable {
+		t.Errorf("newError of a 503: got %#v, want a retryable ErrorModel", e)
+	}
+}
+
+func TestRetryAfter_Jitter(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 200; i++ {
+		s := retryAfterSeconds(3 * time.Second)
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 3 || n > 6 {
+			t.Fatalf("retryAfterSeconds(3s) = %q, want 3 to 6", s)
+		}
+		seen[s] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("retryAfterSeconds(3s) always %v, want jitter", seen)
+	}
+	if s := retryAfterSeconds(100 * time.Millisecond); s != "1" {
+		t.Errorf("retryAfterSeconds(100ms) = %q, want 1", s)
+	}
+}
+
+func TestRetryAfter_KeepsExisting(t *testing.T) {
+	h := RetryAfter(time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+}
@@ -0,0 +1,295 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/apikey"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// Aliases are human-friendly names for rows, such as
+// "user:alice@example.com". An alias is stored on the shard its name hashes
+// to, so looking it up takes one read wherever the row lives. Under
+// /v1/alias/{alias}/ the cell routes take an alias in place of a row_key.
+
+// aliasPathPrefix addresses the cell routes by alias: a request for
+// /v1/alias/{alias}/rest is served as /v1/cells/{row_key}/rest.
+const aliasPathPrefix = "/v1/alias/"
+
+type AliasPath struct {
+	Alias string `path:"alias" doc:"Alias name; any text up to 255 bytes without a slash" minLength:"1" maxLength:"255" pattern:"^[^/]+$" patternDescription:"no slash"`
+}
+
+type PutAliasBody struct {
+	RowKey uuid.UUID `json:"row_key" doc:"Row the alias names" required:"true" example:"550e8400-e29b-41d4-a716-446655440000"`
+}
+
+type PutAliasInput struct {
+	AliasPath
+	Body PutAliasBody
+}
+
+type AliasResponse struct {
+	Alias     string    `json:"alias" doc:"Alias name" example:"user:alice@example.com"`
+	RowKey    uuid.UUID `json:"row_key" doc:"Row the alias names" example:"550e8400-e29b-41d4-a716-446655440000"`
+	CreatedAt time.Time `json:"created_at" doc:"When the alias was registered" example:"2026-02-06T12:00:00Z"`
+}
+
+type AliasOutput struct {
+	Body AliasResponse
+}
+
+func aliasToResponse(a *storage.Alias) AliasResponse {
+	return AliasResponse{Alias: a.Alias, RowKey: a.RowKey, CreatedAt: a.CreatedAt}
+}
+
+func registerAliasRoutes(api huma.API, h *CellHandler) {
+	huma.Register(api, huma.Operation{
+		OperationID: "put-alias",
+		Method:      http.MethodPut,
+		Path:        "/v1/aliases/{alias}",
+		Summary:     "Register a row alias",
+		Description: "Registers a human-friendly name for a row, so callers need not keep track of row_keys themselves. Cell routes then take the alias in place of the row_key under /v1/alias/{alias}/, e.g. GET /v1/alias/user:alice@example.com/profile. Registering an alias again for the same row returns it unchanged; an alias naming another row is not repointed but fails with 409, so delete it first. The row need not have cells yet.",
+		Tags:        []string{"aliases"},
+		Errors:      []int{http.StatusBadRequest, http.StatusForbidden, http.StatusConflict, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	}, h.PutAlias)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-alias",
+		Method:      http.MethodGet,
+		Path:        "/v1/aliases/{alias}",
+		Summary:     "Resolve a row alias",
+		Description: "Returns the row an alias names.",
+		Tags:        []string{"aliases"},
+		Errors:      []int{http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	}, h.GetAlias)
+
+	huma.Register(api, huma.Operation{
+		OperationID:   "delete-alias",
+		Method:        http.MethodDelete,
+		Path:          "/v1/aliases/{alias}",
+		Summary:       "Delete a row alias",
+		Description:   "Deletes an alias; the row and its cells are left alone, and the name is free to be registered for another row.",
+		Tags:          []string{"aliases"},
+		Errors:        []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		DefaultStatus: http.StatusNoContent,
+	}, h.DeleteAlias)
+}
+
+// rejectReadOnly rejects a change that is not a cell write, described by
+// action, with 403 if the request's API key is read-only.
+func rejectReadOnly(ctx context.Context, action string) error {
+	if k, ok := apikey.FromContext(ctx); ok && k.Write != nil && len(k.Write) == 0 {
+		return huma.Error403Forbidden(fmt.Sprintf("API key %q is read-only and may not %s", k.Name, action))
+	}
+	return nil
+}
+
+// aliasFailed maps an alias store error to an API error.
+func aliasFailed(ctx context.Context, err error, msg string) error {
+	switch {
+	case errors.Is(err, storage.ErrAliasNotFound):
+		return huma.Error404NotFound("alias not found")
+	case errors.Is(err, storage.ErrAliasExists):
+		return huma.Error409Conflict("alias already names another row; delete it first")
+	case errors.Is(err, storage.ErrAliasesUnsupported):
+		return huma.Error400BadRequest("the store does not support aliases")
+	}
+	return failed(ctx, err, msg)
+}
+
+// rowStore returns the store of the shard holding rowKey.
+func (h *CellHandler) rowStore(rowKey uuid.UUID) (storage.CellStore, error) {
+	shardID := h.router.ForRowKey(rowKey, h.numShards)
+	store, err := h.router.StoreFor(shardID)
+	if err != nil {
+		h.logger.Error("shard routing failed", "shard_id", shardID, "error", err)
+		return nil, huma.Error500InternalServerError("shard routing failed")
+	}
+	return store, nil
+}
+
+func (h *CellHandler) PutAlias(ctx context.Context, input *PutAliasInput) (*AliasOutput, error) {
+	if err := rejectReadOnly(ctx, "change aliases"); err != nil {
+		return nil, err
+	}
+	rowStore, err := h.rowStore(input.Body.RowKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.acl.claim(ctx, rowStore, []uuid.UUID{input.Body.RowKey}, true); err != nil {
+		return nil, err
+	}
+	store, err := aliasStore(h.router, h.numShards, input.Alias, h.logger)
+	if err != nil {
+		return nil, err
+	}
+	a, err := storage.PutAlias(ctx, store, input.Alias, input.Body.RowKey)
+	if err != nil {
+		if !errors.Is(err, storage.ErrAliasExists) {
+			h.logger.Error("failed to put alias", "alias", input.Alias, "error", err)
+		}
+		return nil, aliasFailed(ctx, err, "failed to put alias")
+	}
+	return &AliasOutput{Body: aliasToResponse(a)}, nil
+}
+
+func (h *CellHandler) GetAlias(ctx context.Context, input *AliasPath) (*AliasOutput, error) {
+	a, err := h.getAlias(ctx, input.Alias)
+	if err != nil {
+		return nil, err
+	}
+	rowStore, err := h.rowStore(a.RowKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.acl.readable(ctx, rowStore, a.RowKey, "alias not found"); err != nil {
+		return nil, err
+	}
+	return &AliasOutput{Body: aliasToResponse(a)}, nil
+}
+
+func (h *CellHandler) DeleteAlias(ctx context.Context, input *AliasPath) (*struct{}, error) {
+	if err := rejectReadOnly(ctx, "change aliases"); err != nil {
+		return nil, err
+	}
+	a, err := h.getAlias(ctx, input.Alias)
+	if err != nil {
+		return nil, err
+	}
+	rowStore, err := h.rowStore(a.RowKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.acl.claim(ctx, rowStore, []uuid.UUID{a.RowKey}, true); err != nil {
+		return nil, err
+	}
+	store, err := aliasStore(h.router, h.numShards, input.Alias, h.logger)
+	if err != nil {
+		return nil, err
+	}
+	if err := storage.DeleteAlias(ctx, store, input.Alias); err != nil {
+		if !errors.Is(err, storage.ErrAliasNotFound) {
+			h.logger.Error("failed to delete alias", "alias", input.Alias, "error", err)
+		}
+		return nil, aliasFailed(ctx, err, "failed to delete alias")
+	}
+	return nil, nil
+}
+
+func (h *CellHandler) getAlias(ctx context.Context, alias string) (*storage.Alias, error) {
+	store, err := aliasStore(h.router, h.numShards, alias, h.logger)
+	if err != nil {
+		return nil, err
+	}
+	a, err := storage.GetAlias(ctx, store, alias)
+	if err != nil {
+		if !errors.Is(err, storage.ErrAliasNotFound) {
+			h.logger.Error("failed to get alias", "alias", alias, "error", err)
+		}
+		return nil, aliasFailed(ctx, err, "failed to get alias")
+	}
+	return a, nil
+}
+
+// aliasStore returns the store of the shard alias hashes to.
+func aliasStore(router *shard.Router, numShards int, alias string, logger *slog.Logger) (storage.CellStore, error) {
+	shardID := router.ForKey(alias, numShards)
+	store, err := router.StoreFor(shardID)
+	if err != nil {
+		logger.Error("shard routing failed", "shard_id", shardID, "error", err)
+		return nil, huma.Error500InternalServerError("shard routing failed")
+	}
+	return store, nil
+}
+
+// ResolveAliases serves requests for /v1/alias/{alias}/rest as requests for
+// /v1/cells/{row_key}/rest, with the row_key the alias names, which is
+// returned in X-Row-Key. Unknown aliases, and with row ACLs those of rows
+// the request's tenant may not read, are answered with 404 and no row_key.
+// The cell route applies the rest of the ACL.
+func ResolveAliases(router *shard.Router, numShards int, mode RowACL, logger *slog.Logger) func(http.Handler) http.Handler {
+	acl := rowACL{mode: mode, logger: logger}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rest, ok := strings.CutPrefix(r.URL.EscapedPath(), aliasPathPrefix)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			escaped, rest, _ := strings.Cut(rest, "/")
+			alias, err := url.PathUnescape(escaped)
+			if err != nil || alias == "" || len(alias) > 255 {
+				writeProblem(w, http.StatusBadRequest, "invalid alias")
+				return
+			}
+			ctx := r.Context()
+			a, err := resolveAlias(ctx, router, numShards, acl, alias, logger)
+			if err != nil {
+				var se huma.StatusError
+				if !errors.As(err, &se) {
+					se = huma.Error500InternalServerError("failed to resolve alias")
+				}
+				writeProblem(w, se.GetStatus(), se.Error())
+				return
+			}
+			path := "/v1/cells/" + a.RowKey.String()
+			if rest != "" {
+				path += "/" + rest
+			}
+			r = r.Clone(ctx)
+			r.URL.RawPath = path
+			r.URL.Path, _ = url.PathUnescape(path)
+			w.Header().Set("X-Row-Key", a.RowKey.String())
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// resolveAlias looks alias up for ResolveAliases, answering an alias of a
+// row the request's tenant may not read as not found.
+func resolveAlias(ctx context.Context, router *shard.Router, numShards int, acl rowACL, alias string, logger *slog.Logger) (*storage.Alias, error) {
+	store, err := aliasStore(router, numShards, alias, logger)
+	if err != nil {
+		return nil, err
+	}
+	a, err := storage.GetAlias(ctx, store, alias)
+	if err != nil {
+		if !errors.Is(err, storage.ErrAliasNotFound) {
+			logger.Error("failed to resolve alias", "alias", alias, "error", err)
+		}
+		return nil, aliasFailed(ctx, err, "failed to resolve alias")
+	}
+	shardID := router.ForRowKey(a.RowKey, numShards)
+	rowStore, err := router.StoreFor(shardID)
+	if err != nil {
+		logger.Error("shard routing failed", "shard_id", shardID, "error", err)
+		return nil, huma.Error500InternalServerError("shard routing failed")
+	}
+	if err := acl.readable(ctx, rowStore, a.RowKey, "alias not found"); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// writeProblem writes an RFC 9457 error response outside the huma API.
+func writeProblem(w http.ResponseWriter, status int, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"title":  http.StatusText(status),
+		"status": status,
+		"detail": detail,
+	})
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+)
+
+func putAlias(server http.Handler, alias string, row uuid.UUID) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(map[string]any{"row_key": row})
+	req := httptest.NewRequest(http.MethodPut, "/v1/aliases/"+alias, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	return w
+}
+
+func get(server http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestAliases(t *testing.T) {
+	server := setupTestServer(memory.New(), 8)
+	row, other := uuid.New(), uuid.New()
+	const alias = "user:alice@example.com"
+
+	w := putAlias(server, alias, row)
+	if w.Code != http.StatusOK {
+		t.Fatalf("put: got %d: %s", w.Code, w.Body.String())
+	}
+	var resp AliasResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Alias != alias || resp.RowKey != row || resp.CreatedAt.IsZero() {
+		t.Errorf("put: got %+v", resp)
+	}
+	if w := putAlias(server, alias, row); w.Code != http.StatusOK {
+		t.Errorf("put again: got %d, want 200", w.Code)
+	}
+	if w := putAlias(server, alias, other); w.Code != http.StatusConflict {
+		t.Errorf("put for another row: got %d, want 409", w.Code)
+	}
+	if w := get(server, "/v1/aliases/"+alias); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), row.String()) {
+		t.Errorf("get: got %d %s", w.Code, w.Body.String())
+	}
+	if w := get(server, "/v1/aliases/user:bob@example.com"); w.Code != http.StatusNotFound {
+		t.Errorf("get missing: got %d, want 404", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/v1/aliases/"+alias, nil)
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("delete: got %d: %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/v1/aliases/"+alias, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("delete twice: got %d, want 404", w.Code)
+	}
+	if w := putAlias(server, alias, other); w.Code != http.StatusOK {
+		t.Errorf("put after delete: got %d, want 200", w.Code)
+	}
+}
+
+func TestAliases_CellRoutes(t *testing.T) {
+	server := setupTestServer(memory.New(), 8)
+	row := uuid.New()
+	postCell(t, server, map[string]any{"row_key": row, "column_name": "profile", "ref_key": 1, "body": map[string]any{"name": "Alice"}}, "")
+	postCell(t, server, map[string]any{"row_key": row, "column_name": "profile", "ref_key": 2, "body": map[string]any{"name": "Al"}}, "")
+	if w := putAlias(server, "user:alice@example.com", row); w.Code != http.StatusOK {
+		t.Fatalf("put: got %d", w.Code)
+	}
+
+	for _, tt := range []struct {
+		path, want string
+	}{
+		{"/v1/alias/user:alice@example.com/profile", `"name":"Al"`},
+		{"/v1/alias/user:alice@example.com/profile/1", `"name":"Alice"`},
+		{"/v1/alias/user:alice@example.com", `"column_name":"profile"`},
+		{"/v1/alias/user%3Aalice%40example.com/profile", `"name":"Al"`},
+	} {
+		w := get(server, tt.path)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), tt.want) {
+			t.Errorf("GET %s: got %d %s", tt.path, w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("X-Row-Key"); got != row.String() {
+			t.Errorf("GET %s: X-Row-Key %q, want %s", tt.path, got, row)
+		}
+	}
+
+	if w := patchCell(server, row, "profile", `{"age":30}`); w.Code != http.StatusOK {
+		t.Fatalf("patch: got %d", w.Code)
+	}
+	req := httptest.NewRequest(http.MethodPatch, "/v1/alias/user:alice@example.com/profile", strings.NewReader(`{"age":31}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"ref_key":4`) {
+		t.Errorf("patch by alias: got %d %s", w.Code, w.Body.String())
+	}
+
+	if w := get(server, "/v1/alias/user:bob@example.com/profile"); w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "alias not found") {
+		t.Errorf("unknown alias: got %d %s, want 404", w.Code, w.Body.String())
+	}
+}
+
+func TestAliases_RowACL(t *testing.T) {
+	store := memory.New()
+	server := setupACLServer(store, RowACLEnforce)
+	row := uuid.New()
+	if code := aclWrite(server, "acme-token", row, 1); code != http.StatusCreated {
+		t.Fatalf("owner's write: got %d", code)
+	}
+
+	if w := aclRequest(server, "globex-token", http.MethodPut, "/v1/aliases/acme:main", map[string]any{"row_key": row}); w.Code != http.StatusForbidden {
+		t.Errorf("other tenant's put: got %d, want 403", w.Code)
+	}
+	if w := aclRequest(server, "acme-token", http.MethodPut, "/v1/aliases/acme:main", map[string]any{"row_key": row}); w.Code != http.StatusOK {
+		t.Fatalf("owner's put: got %d: %s", w.Code, w.Body.String())
+	}
+	for _, tt := range []struct {
+		token, method, path string
+		want                int
+	}{
+		{"acme-token", http.MethodGet, "/v1/aliases/acme:main", http.StatusOK},
+		{"globex-token", http.MethodGet, "/v1/aliases/acme:main", http.StatusNotFound},
+		{"acme-token", http.MethodGet, "/v1/alias/acme:main/profile", http.StatusOK},
+		{"globex-token", http.MethodGet, "/v1/alias/acme:main/profile", http.StatusNotFound},
+		{"globex-token", http.MethodDelete, "/v1/aliases/acme:main", http.StatusForbidden},
+		{"acme-token", http.MethodDelete, "/v1/aliases/acme:main", http.StatusNoContent},
+	} {
+		w := aclRequest(server, tt.token, tt.method, tt.path, nil)
+		if w.Code != tt.want {
+			t.Errorf("%s %s as %s: got %d, want %d", tt.method, tt.path, tt.token, w.Code, tt.want)
+		}
+		// The row key is not disclosed to a tenant that may not read it.
+		if got := w.Header().Get("X-Row-Key"); (got != "") != (w.Code == http.StatusOK && strings.HasPrefix(tt.path, "/v1/alias/")) {
+			t.Errorf("%s %s as %s: X-Row-Key %q", tt.method, tt.path, tt.token, got)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/apikey"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// Binary cells carry bytes with a declared content type instead of a JSON
+// body. They are stored beside a body that describes them (see
+// cell.BlobBody), which is what every JSON read, index, plugin, replica and
+// export sees; /v1/blobs reads and writes the bytes themselves.
+
+type WriteBlobInput struct {
+	RowKey         string `path:"row_key" doc:"Row key UUID" format:"uuid"`
+	ColumnName     string `path:"column_name" doc:"Column name"`
+	RefKey         int64  `path:"ref_key" doc:"Reference key version" minimum:"0"`
+	ContentType    string `header:"Content-Type" doc:"Media type of the bytes, returned with them on reads" required:"true"`
+	IdempotencyKey string `header:"Idempotency-Key" doc:"Client-chosen key that makes retries of this write safe" maxLength:"255"`
+	RawBody        []byte `contentType:"application/octet-stream"`
+}
+
+type WriteBlobOutput struct {
+	// Status is 200 instead of 201 when an idempotent retry is replayed.
+	Status int
+	Shard  string `header:"X-Shard-Id" doc:"Shard the write was routed to"`
+	Seq    string `header:"X-Shard-Seq" doc:"The write's sequence number in its shard (its added_id); pass X-Shard-Id:X-Shard-Seq as min_seq to read it back"`
+	Body   CellResponse
+}
+
+type GetBlobInput struct {
+	RowKey     string `path:"row_key" doc:"Row key UUID" format:"uuid"`
+	ColumnName string `path:"column_name" doc:"Column name"`
+	RefKey     int64  `path:"ref_key" doc:"Reference key version"`
+}
+
+type GetBlobLatestInput struct {
+	RowKey     string   `path:"row_key" doc:"Row key UUID" format:"uuid"`
+	ColumnName string   `path:"column_name" doc:"Column name"`
+	MinSeq     []string `query:"min_seq" doc:"Consistency tokens <shard>:<seq> from X-Shard-Id and X-Shard-Seq of earlier writes, comma-separated: the read reflects those writes, waiting briefly for the shard to reach them"`
+}
+
+// GetBlobOutput is a binary cell's bytes, described in headers.
+type GetBlobOutput struct {
+	ContentType  string    `header:"Content-Type" doc:"Media type declared when the cell was written"`
+	ETag         string    `header:"ETag" doc:"SHA-256 of the bytes"`
+	AddedID      int64     `header:"X-Added-Id" doc:"added_id of the cell"`
+	RefKey       int64     `header:"X-Ref-Key" doc:"ref_key of the cell"`
+	LastModified time.Time `header:"Last-Modified" doc:"Creation time of the cell"`
+	Body         []byte
+}
+
+// blobResponses documents the bytes of a blob read, which huma would
+// otherwise describe as base64 JSON.
+func blobResponses() map[string]*huma.Response {
+	return map[string]*huma.Response{
+		"200": {Content: map[string]*huma.MediaType{
+			"application/octet-stream": {Schema: &huma.Schema{Type: huma.TypeString, Format: "binary"}},
+		}},
+	}
+}
+
+func registerBlobRoutes(api huma.API, h *CellHandler) {
+	huma.Register(api, huma.Operation{
+		OperationID:   "write-blob",
+		Method:        http.MethodPut,
+		Path:          "/v1/blobs/{row_key}/{column_name}/{ref_key}",
+		Summary:       "Write a binary cell",
+		Description:   "Stores the request body as a new immutable binary cell version, with its Content-Type, so images, protobufs and other bytes need no base64 wrapping. The cell's JSON body describes the bytes, as {\"_mezz.blob\":{\"content_type\",\"size\",\"sha256\"}}, and is what cell reads, indexes, plugins, replication and exports see. Conflicts, idempotent retries and synchronous plugins work as for cell writes; binary cells are not offloaded.",
+		Tags:          []string{"cells"},
+		Errors:        []int{http.StatusBadRequest, http.StatusForbidden, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		DefaultStatus: http.StatusCreated,
+		MaxBodyBytes:  h.body.MaxBytes,
+	}, h.WriteBlob)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-blob",
+		Method:      http.MethodGet,
+		Path:        "/v1/blobs/{row_key}/{column_name}/{ref_key}",
+		Summary:     "Get the bytes of a binary cell version",
+		Description: "Returns the bytes of one exact binary cell version with the Content-Type it was written with. A cell that is not binary is not found here; read it from /v1/cells.",
+		Tags:        []string{"cells"},
+		Errors:      []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		Responses:   blobResponses(),
+	}, h.GetBlob)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-blob-latest",
+		Method:      http.MethodGet,
+		Path:        "/v1/blobs/{row_key}/{column_name}",
+		Summary:     "Get the bytes of the latest binary cell version",
+		Description: "Returns the bytes of the version of a cell with the highest ref_key, if it is binary.",
+		Tags:        []string{"cells"},
+		Errors:      []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		Responses:   blobResponses(),
+	}, h.GetBlobLatest)
+}
+
+func (h *CellHandler) WriteBlob(ctx context.Context, input *WriteBlobInput) (*WriteBlobOutput, error) {
+	rowKey, err := uuid.Parse(input.RowKey)
+	if err != nil {
+		return nil, huma.Error400BadRequest("invalid row_key")
+	}
+	if err := cell.ValidateColumnName(input.ColumnName); err != nil {
+		return nil, huma.Error400BadRequest(err.Error())
+	}
+	if err := checkWritable(input.ColumnName); err != nil {
+		return nil, err
+	}
+	if _, _, err := mime.ParseMediaType(input.ContentType); err != nil {
+		return nil, huma.Error400BadRequest(fmt.Sprintf("invalid Content-Type %q", input.ContentType))
+	}
+	if err := authorizeWrite(ctx, input.ColumnName); err != nil {
+		return nil, err
+	}
+	body := cell.BlobBody(input.ContentType, input.RawBody)
+	req := cell.WriteCellRequest{RowKey: rowKey, ColumnName: input.ColumnName, RefKey: input.RefKey, Body: body}
+
+	shardID := h.router.ForRowKey(rowKey, h.numShards)
+	store, err := h.router.StoreFor(shardID)
+	if err != nil {
+		h.logger.Error("shard routing failed", "shard_id", shardID, "error", err)
+		return nil, huma.Error500InternalServerError("shard routing failed")
+	}
+	if _, err := h.acl.authorize(ctx, store, []uuid.UUID{rowKey}); err != nil {
+		return nil, err
+	}
+	reqs := []cell.WriteCellRequest{req}
+	idem := newIdempotency(ctx, input.IdempotencyKey, reqs)
+	if err := h.beforeWrite(ctx, shardID, reqs); err != nil {
+		return nil, err
+	}
+	if !sameJSON(reqs[0].Body, body) {
+		return nil, huma.Error422UnprocessableEntity("binary cells cannot be rewritten by write hooks or plugins")
+	}
+	if err := h.claimRows(ctx, store, []uuid.UUID{rowKey}); err != nil {
+		return nil, err
+	}
+
+	var timing writeTiming
+	at := time.Now()
+	c, err := storage.WriteBlob(ctx, store, req, input.RawBody)
+	if errors.Is(err, storage.ErrCellExists) {
+		out, err := h.replayWrite(ctx, store, shardID, req, idem)
+		if err != nil {
+			return nil, err
+		}
+		return &WriteBlobOutput{Status: out.Status, Shard: out.Shard, Seq: out.Seq, Body: out.Body}, nil
+	}
+	if errors.Is(err, storage.ErrBlobsUnsupported) {
+		return nil, huma.Error400BadRequest("shard does not support binary cells")
+	}
+	if err != nil {
+		h.logger.Error("failed to write blob", "row_key", rowKey, "column_name", req.ColumnName, "error", err)
+		return nil, failed(ctx, err, "failed to write cell")
+	}
+	h.recordIdempotency(ctx, store, idem)
+	at = since(&timing.store, at)
+
+	if h.notifier != nil {
+		h.notifier.NotifyCell(int(shardID), c)
+	}
+	at = since(&timing.notify, at)
+
+	if err := h.indexRegistry.IndexCell(ctx, c, h.numShards); err != nil {
+		h.logger.Error("index write failed", "row_key", c.RowKey, "column_name", c.ColumnName, "error", err)
+	}
+	since(&timing.index, at)
+	h.columns.Observe(c.ColumnName, 1, len(input.RawBody), c.CreatedAt)
+
+	h.reportTiming(timing, "wrote blob", "row_key", c.RowKey, "column_name", c.ColumnName, "bytes", len(input.RawBody))
+	return &WriteBlobOutput{Status: http.StatusCreated, Shard: shardIDHeader(shardID), Seq: seqHeader(c.AddedID), Body: cellToResponse(c)}, nil
+}
+
+func (h *CellHandler) GetBlob(ctx context.Context, input *GetBlobInput) (*GetBlobOutput, error) {
+	return h.getBlob(ctx, input.RowKey, input.ColumnName, nil, func(ctx context.Context, store storage.CellStore, rowKey uuid.UUID) (*cell.Cell, []byte, error) {
+		return storage.GetBlob(ctx, store, cell.CellRef{RowKey: rowKey, ColumnName: input.ColumnName, RefKey: input.RefKey})
+	})
+}
+
+func (h *CellHandler) GetBlobLatest(ctx context.Context, input *GetBlobLatestInput) (*GetBlobOutput, error) {
+	return h.getBlob(ctx, input.RowKey, input.ColumnName, input.MinSeq, func(ctx context.Context, store storage.CellStore, rowKey uuid.UUID) (*cell.Cell, []byte, error) {
+		return storage.GetBlobLatest(ctx, store, rowKey, input.ColumnName)
+	})
+}
+
+// getBlob serves a binary cell read by get.
+func (h *CellHandler) getBlob(ctx context.Context, row, columnName string, minSeq []string, get func(context.Context, storage.CellStore, uuid.UUID) (*cell.Cell, []byte, error)) (*GetBlobOutput, error) {
+	rowKey, err := uuid.Parse(row)
+	if err != nil {
+		return nil, huma.Error400BadRequest("invalid row_key")
+	}
+	// Masks name fields of JSON bodies, which bytes do not have: a key
+	// whose reads are masked could read around its policy here.
+	if k, ok := apikey.FromContext(ctx); ok && (len(k.Mask) > 0 || len(k.Hash) > 0) {
+		return nil, huma.Error403Forbidden(fmt.Sprintf("API key %q has a masking policy, which binary cells cannot honor", k.Name))
+	}
+
+	shardID := h.router.ForRowKey(rowKey, h.numShards)
+	store, err := h.router.StoreFor(shardID)
+	if err != nil {
+		h.logger.Error("shard routing failed", "shard_id", shardID, "error", err)
+		return nil, huma.Error500InternalServerError("shard routing failed")
+	}
+	if ctx, err = h.consistentRead(ctx, minSeq, shardID); err != nil {
+		return nil, err
+	}
+	if err := h.acl.readable(ctx, store, rowKey, "cell not found"); err != nil {
+		return nil, err
+	}
+
+	c, data, err := get(ctx, store, rowKey)
+	if errors.Is(err, storage.ErrCellNotFound) || errors.Is(err, storage.ErrBlobsUnsupported) {
+		return nil, huma.Error404NotFound("cell not found")
+	}
+	if err != nil {
+		h.logger.Error("failed to get blob", "row_key", rowKey, "column_name", columnName, "error", err)
+		return nil, failed(ctx, err, "failed to get cell")
+	}
+	info, ok := cell.ParseBlobBody(c.Body)
+	if !ok || data == nil {
+		return nil, huma.Error404NotFound("cell is not binary; read it from /v1/cells")
+	}
+	return &GetBlobOutput{
+		ContentType:  info.ContentType,
+		ETag:         `"` + info.SHA256 + `"`,
+		AddedID:      c.AddedID,
+		RefKey:       c.RefKey,
+		LastModified: c.CreatedAt,
+		Body:         data,
+	}, nil
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+)
+
+func putBlob(server http.Handler, path, contentType string, data []byte, idempotencyKey string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, path, bytes.NewReader(data))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	return w
+}
+
+func TestBlob_WriteAndRead(t *testing.T) {
+	server := setupTestServer(memory.New(), 8)
+	row := uuid.New()
+	png := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff, 0x10}
+	base := "/v1/blobs/" + row.String() + "/avatar"
+
+	w := putBlob(server, base+"/1", "image/png", png, "k1")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("write: got %d: %s", w.Code, w.Body.String())
+	}
+	var resp CellResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	info, ok := cell.ParseBlobBody(resp.Body)
+	if !ok || info.ContentType != "image/png" || info.Size != int64(len(png)) {
+		t.Errorf("write: got body %s, want a descriptor", resp.Body)
+	}
+
+	for _, path := range []string{base + "/1", base} {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), png) {
+			t.Fatalf("%s: got %d %q, want the bytes", path, w.Code, w.Body.Bytes())
+		}
+		if got := w.Header().Get("Content-Type"); got != "image/png" {
+			t.Errorf("%s: Content-Type %q, want image/png", path, got)
+		}
+		if got := w.Header().Get("ETag"); got != `"`+info.SHA256+`"` {
+			t.Errorf("%s: ETag %q, want the hash", path, got)
+		}
+	}
+
+	// JSON reads see the descriptor.
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/cells/"+row.String()+"/avatar", nil))
+	if w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte(cell.BlobKey)) {
+		t.Errorf("cell read: got %d %s, want the descriptor", w.Code, w.Body.String())
+	}
+
+	// Retries with the same bytes are replayed; different bytes under the
+	// same key are refused, and under another key conflict.
+	if w := putBlob(server, base+"/1", "image/png", png, "k1"); w.Code != http.StatusOK {
+		t.Errorf("retry: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := putBlob(server, base+"/1", "image/png", []byte("other"), "k1"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("different bytes: got %d, want 422", w.Code)
+	}
+	if w := putBlob(server, base+"/1", "image/png", []byte("other"), "k2"); w.Code != http.StatusConflict {
+		t.Errorf("different bytes under another key: got %d, want 409", w.Code)
+	}
+}
+
+func TestBlob_Errors(t *testing.T) {
+	server := setupTestServer(memory.New(), 8)
+	row := uuid.New()
+	if w := putBlob(server, "/v1/blobs/"+row.String()+"/avatar/1", "not a type", []byte("x"), ""); w.Code != http.StatusBadRequest {
+		t.Errorf("bad Content-Type: got %d, want 400", w.Code)
+	}
+	if w := putBlob(server, "/v1/blobs/"+row.String()+"/_mezz.x/1", "image/png", []byte("x"), ""); w.Code != http.StatusBadRequest {
+		t.Errorf("reserved column: got %d, want 400", w.Code)
+	}
+
+	postCell(t, server, map[string]any{"row_key": row, "column_name": "profile", "ref_key": 1, "body": map[string]string{"a": "b"}}, "")
+	for _, path := range []string{"/v1/blobs/" + row.String() + "/profile", "/v1/blobs/" + row.String() + "/missing"} {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: got %d, want 404", path, w.Code)
+		}
+	}
+
+	// Stores that cannot keep bytes reject binary writes.
+	server = setupTestServer(struct{ storage.CellStore }{memory.New()}, 8)
+	if w := putBlob(server, "/v1/blobs/"+row.String()+"/avatar/1", "image/png", []byte("x"), ""); w.Code != http.StatusBadRequest {
+		t.Errorf("unsupported store: got %d, want 400", w.Code)
+	}
+}
@@ -1,17 +1,26 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/google/uuid"
 	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/column"
 	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/offload"
 	"github.com/ryanbastic/go-mezzanine/internal/shard"
 	"github.com/ryanbastic/go-mezzanine/internal/storage"
 	"github.com/ryanbastic/go-mezzanine/internal/trigger"
@@ -20,70 +29,209 @@ import (
 // --- Huma Input/Output types ---
 
 type WriteCellBody struct {
-	RowKey     uuid.UUID       `json:"row_key" doc:"Row key UUID" required:"true"`
-	ColumnName string          `json:"column_name" doc:"Column name" required:"true" minLength:"1"`
-	RefKey     int64           `json:"ref_key" doc:"Reference key version"`
-	Body       json.RawMessage `json:"body" doc:"Arbitrary JSON payload" required:"true"`
+	RowKey     uuid.UUID       `json:"row_key" doc:"Row key UUID. A single write may omit it: the server derives it from natural_key if given, and otherwise generates a new time-ordered key for a new row, returned in the response. Batch writes must set it" required:"false" example:"550e8400-e29b-41d4-a716-446655440000"`
+	ColumnName string          `json:"column_name" doc:"Column name: a letter or _ followed by letters, digits, _, . or -; names starting with _mezz. are reserved for system columns" required:"true" minLength:"1" maxLength:"128" pattern:"^[A-Za-z_][A-Za-z0-9_.-]*$" patternDescription:"column name" example:"profile"`
+	RefKey     int64           `json:"ref_key" doc:"Reference key version" minimum:"0" example:"1"`
+	Body       json.RawMessage `json:"body" doc:"Arbitrary JSON payload" required:"true" example:"{\"name\":\"Alice\",\"email\":\"alice@example.com\"}"`
+	NaturalKey *NaturalKey     `json:"natural_key,omitempty" doc:"Natural key row_key was derived from (see derive-row-key); the write is rejected with 422 if row_key does not match it"`
 }
 
 type WriteCellInput struct {
-	Body WriteCellBody
+	IdempotencyKey string `header:"Idempotency-Key" doc:"Client-chosen key that makes retries of this write safe" maxLength:"255"`
+	DryRun         bool   `query:"dry_run" doc:"Validate and route the write, and check it for conflicts, without storing it"`
+	Body           WriteCellBody
 }
 
 type CellResponse struct {
-	AddedID    int64           `json:"added_id" doc:"Auto-incremented ID"`
-	RowKey     uuid.UUID       `json:"row_key" doc:"Row key UUID"`
-	ColumnName string          `json:"column_name" doc:"Column name"`
-	RefKey     int64           `json:"ref_key" doc:"Reference key version"`
-	Body       json.RawMessage `json:"body" doc:"Stored JSON payload"`
-	CreatedAt  time.Time       `json:"created_at" doc:"Creation timestamp"`
+	AddedID    int64           `json:"added_id" doc:"Auto-incremented ID" example:"42"`
+	RowKey     uuid.UUID       `json:"row_key" doc:"Row key UUID" example:"550e8400-e29b-41d4-a716-446655440000"`
+	ColumnName string          `json:"column_name" doc:"Column name" example:"profile"`
+	RefKey     int64           `json:"ref_key" doc:"Reference key version" example:"1"`
+	Body       json.RawMessage `json:"body" doc:"Stored JSON payload" example:"{\"name\":\"Alice\",\"email\":\"alice@example.com\"}"`
+	CreatedAt  time.Time       `json:"created_at" doc:"Creation timestamp" example:"2026-02-06T12:00:00Z"`
+	CommitSeq  int64           `json:"commit_seq,omitempty" doc:"Position in the shard's commit log; only set by partitionRead with read_type 3" example:"42"`
 }
 
 type WriteCellOutput struct {
-	Body CellResponse
+	// Status is 200 instead of 201 when an idempotent retry is replayed or
+	// the write is a dry run.
+	Status int
+	Shard  string `header:"X-Shard-Id" doc:"Shard the write was routed to"`
+	Seq    string `header:"X-Shard-Seq" doc:"The write's sequence number in its shard (its added_id); pass X-Shard-Id:X-Shard-Seq as min_seq to read it back. Not set on dry runs"`
+	Timing string `header:"Server-Timing" doc:"Milliseconds spent storing, indexing and notifying plugins; set when the server enables it"`
+	Body   CellResponse
+}
+
+type WriteCellsBatchBody struct {
+	Cells []WriteCellBody `json:"cells" doc:"Cells to write; all must belong to the same shard" minItems:"1" maxItems:"1000"`
+}
+
+type WriteCellsBatchInput struct {
+	IdempotencyKey string `header:"Idempotency-Key" doc:"Client-chosen key that makes retries of this batch safe" maxLength:"255"`
+	DryRun         bool   `query:"dry_run" doc:"Validate and route the batch, and check it for conflicts, without storing it"`
+	Body           WriteCellsBatchBody
+}
+
+type BatchResponse struct {
+	Cells []CellResponse `json:"cells" doc:"Written cells, in request order"`
+}
+
+type WriteCellsBatchOutput struct {
+	// Status is 200 instead of 201 when an idempotent retry is replayed or
+	// the write is a dry run.
+	Status int
+	Shard  string `header:"X-Shard-Id" doc:"Shard the batch was routed to"`
+	Seq    string `header:"X-Shard-Seq" doc:"The highest sequence number in the shard of the batch's cells; pass X-Shard-Id:X-Shard-Seq as min_seq to read them back. Not set on dry runs"`
+	Timing string `header:"Server-Timing" doc:"Milliseconds spent storing, indexing and notifying plugins, summed over the batch; set when the server enables it"`
+	Body   BatchResponse
 }
 
 type GetCellInput struct {
-	RowKey     string `path:"row_key" doc:"Row key UUID" format:"uuid"`
-	ColumnName string `path:"column_name" doc:"Column name"`
-	RefKey     int64  `path:"ref_key" doc:"Reference key version"`
+	RowKey     string   `path:"row_key" doc:"Row key UUID" format:"uuid"`
+	ColumnName string   `path:"column_name" doc:"Column name"`
+	RefKey     int64    `path:"ref_key" doc:"Reference key version"`
+	Mask       []string `query:"mask" doc:"Body fields to remove from the response, comma-separated; nested fields use dots"`
+	Resolve    bool     `query:"resolve" doc:"Return offloaded bodies, fetched from object storage, in place of their pointers"`
 }
 
 type GetCellOutput struct {
 	Body CellResponse
 }
 
+type CellRefBody struct {
+	RowKey     uuid.UUID `json:"row_key" doc:"Row key UUID" required:"true" example:"550e8400-e29b-41d4-a716-446655440000"`
+	ColumnName string    `json:"column_name" doc:"Column name" required:"true" minLength:"1" example:"profile"`
+	RefKey     int64     `json:"ref_key" doc:"Reference key version" example:"1"`
+}
+
+type GetCellsBody struct {
+	Refs []CellRefBody `json:"refs" doc:"Cells to fetch; they may span shards" minItems:"1" maxItems:"1000"`
+}
+
+type GetCellsInput struct {
+	Mask    []string `query:"mask" doc:"Body fields to remove from the response, comma-separated; nested fields use dots"`
+	Resolve bool     `query:"resolve" doc:"Return offloaded bodies, fetched from object storage, in place of their pointers"`
+	Partial bool     `query:"partial" doc:"On exceeding the server's query budget, return the results that fit and list the rest under unread, instead of failing with 422; when some shards fail, answer with 207, listing them under shard_errors and what they hold under unread, instead of failing the request"`
+	Body    GetCellsBody
+}
+
+type GetCellsResponse struct {
+	Cells       []CellResponse `json:"cells" doc:"Cells found, in request order"`
+	Missing     []CellRefBody  `json:"missing" doc:"Requested cells that do not exist"`
+	Unread      []CellRefBody  `json:"unread,omitempty" doc:"Requested cells not read because the request exceeded the server's query budget or their shard failed; only with partial=true"`
+	Partial     bool           `json:"partial,omitempty" doc:"Set when unread is not empty" example:"false"`
+	ShardErrors []ShardError   `json:"shard_errors,omitempty" doc:"Shards that failed, making the response 207; only with partial=true"`
+}
+
+type GetCellsOutput struct {
+	Status int
+	Body   GetCellsResponse
+}
+
 type GetCellLatestInput struct {
-	RowKey     string `path:"row_key" doc:"Row key UUID" format:"uuid"`
-	ColumnName string `path:"column_name" doc:"Column name"`
+	RowKey     string   `path:"row_key" doc:"Row key UUID" format:"uuid"`
+	ColumnName string   `path:"column_name" doc:"Column name"`
+	Mask       []string `query:"mask" doc:"Body fields to remove from the response, comma-separated; nested fields use dots"`
+	Resolve    bool     `query:"resolve" doc:"Return offloaded bodies, fetched from object storage, in place of their pointers"`
+	MinSeq     []string `query:"min_seq" doc:"Consistency tokens <shard>:<seq> from X-Shard-Id and X-Shard-Seq of earlier writes, comma-separated: the read reflects those writes, bypassing the read cache and waiting briefly for the shard to reach them"`
 }
 
 type GetCellLatestOutput struct {
 	Body CellResponse
 }
 
+// HeadCellLatestOutput describes the latest version of a cell in headers.
+type HeadCellLatestOutput struct {
+	AddedID      int64     `header:"X-Added-Id" doc:"added_id of the latest version"`
+	RefKey       int64     `header:"X-Ref-Key" doc:"ref_key of the latest version"`
+	LastModified time.Time `header:"Last-Modified" doc:"Creation time of the latest version"`
+}
+
+type HeadRowInput struct {
+	RowKey string   `path:"row_key" doc:"Row key UUID" format:"uuid"`
+	MinSeq []string `query:"min_seq" doc:"Consistency tokens <shard>:<seq> from X-Shard-Id and X-Shard-Seq of earlier writes, comma-separated: the read reflects those writes, bypassing the read cache and waiting briefly for the shard to reach them"`
+}
+
+// HeadRowOutput describes a row in headers.
+type HeadRowOutput struct {
+	ColumnCount  int       `header:"X-Column-Count" doc:"Number of columns in the row"`
+	LastModified time.Time `header:"Last-Modified" doc:"Creation time of the row's newest cell"`
+}
+
 type GetRowInput struct {
-	RowKey string `path:"row_key" doc:"Row key UUID" format:"uuid"`
+	RowKey  string   `path:"row_key" doc:"Row key UUID" format:"uuid"`
+	Columns []string `query:"columns" maxItems:"100" doc:"Columns to return, comma-separated; the others are not read. By default all of the row's columns are returned"`
+	Mask    []string `query:"mask" doc:"Body fields to remove from the response, comma-separated; nested fields use dots"`
+	Resolve bool     `query:"resolve" doc:"Return offloaded bodies, fetched from object storage, in place of their pointers"`
+	MinSeq  []string `query:"min_seq" doc:"Consistency tokens <shard>:<seq> from X-Shard-Id and X-Shard-Seq of earlier writes, comma-separated: the read reflects those writes, bypassing the read cache and waiting briefly for the shard to reach them"`
+	Accept  string   `header:"Accept" hidden:"true"`
 }
 
 type RowResponse struct {
-	RowKey uuid.UUID      `json:"row_key" doc:"Row key UUID"`
+	RowKey uuid.UUID      `json:"row_key" doc:"Row key UUID" example:"550e8400-e29b-41d4-a716-446655440000"`
 	Cells  []CellResponse `json:"cells" doc:"Latest cell per column"`
 }
 
+type GetRowsBody struct {
+	RowKeys []uuid.UUID `json:"row_keys" doc:"Rows to fetch; they may span shards" minItems:"1" maxItems:"1000" example:"[\"550e8400-e29b-41d4-a716-446655440000\"]"`
+}
+
+type GetRowsInput struct {
+	Mask    []string `query:"mask" doc:"Body fields to remove from the response, comma-separated; nested fields use dots"`
+	Resolve bool     `query:"resolve" doc:"Return offloaded bodies, fetched from object storage, in place of their pointers"`
+	MinSeq  []string `query:"min_seq" doc:"Consistency tokens <shard>:<seq> from X-Shard-Id and X-Shard-Seq of earlier writes, comma-separated: the read reflects those writes, bypassing the read cache and waiting briefly for the shard to reach them"`
+	Partial bool     `query:"partial" doc:"On exceeding the server's query budget, return the results that fit and list the rest under unread, instead of failing with 422; when some shards fail, answer with 207, listing them under shard_errors and what they hold under unread, instead of failing the request"`
+	Body    GetRowsBody
+}
+
+type GetRowsResponse struct {
+	Rows        map[string][]CellResponse `json:"rows" doc:"Latest cell per column, keyed by row_key"`
+	Missing     []uuid.UUID               `json:"missing" doc:"Requested rows that have no cells" example:"[\"6ba7b810-9dad-11d1-80b4-00c04fd430c8\"]"`
+	Unread      []uuid.UUID               `json:"unread,omitempty" doc:"Requested rows not read because the request exceeded the server's query budget or their shard failed; only with partial=true" example:"[\"6ba7b810-9dad-11d1-80b4-00c04fd430c8\"]"`
+	Partial     bool                      `json:"partial,omitempty" doc:"Set when unread is not empty" example:"false"`
+	ShardErrors []ShardError              `json:"shard_errors,omitempty" doc:"Shards that failed, making the response 207; only with partial=true"`
+}
+
+type GetRowsOutput struct {
+	Status int
+	Body   GetRowsResponse
+}
+
+// GetRowOutput streams a RowResponse; see cellStream.
 type GetRowOutput struct {
-	Body RowResponse
+	Body func(huma.Context)
 }
 
 type PartitionReadInput struct {
 	PartitionNumber   int       `query:"partition_number" doc:"Partition number" required:"true"`
-	PartitionReadType int       `query:"read_type" doc:"Read type" required:"true"`
+	PartitionReadType int       `query:"read_type" doc:"Read type: 1 pages by created_at, 2 by added_id, 3 in commit order from the shard's commit log (COMMIT_LOG), with added_id holding the commit_seq to read after" required:"true"`
 	CreatedAfter      time.Time `query:"created_after" doc:"Filter cells created after this timestamp" required:"false"`
-	AddedID           int64     `query:"added_id" doc:"Filter cells added after ID" required:"false"`
+	AddedID           int64     `query:"added_id" doc:"Filter cells added after ID; with read_type 1, resume after this added_id among cells created exactly at created_after, which are otherwise all skipped" required:"false"`
 	Limit             int       `query:"limit" doc:"Maximum number of cells to return" required:"false"`
+	Wait              int       `query:"wait" doc:"Seconds to wait for cells past added_id when there are none yet (read_type 2 only), up to the server's maximum; 0 returns at once" required:"false" minimum:"0"`
+	Mask              []string  `query:"mask" doc:"Body fields to remove from the response, comma-separated; nested fields use dots"`
+	Accept            string    `header:"Accept" hidden:"true"`
 }
 
+// PartitionReadOutput streams a []CellResponse; see cellStream.
 type PartitionReadOutput struct {
+	HeadAddedID   int64     `header:"X-Shard-Head-Added-Id" doc:"added_id of the shard's newest cell, read before the page: a consumer whose position reaches it has caught up"`
+	HeadCreatedAt time.Time `header:"X-Shard-Head-Created-At" timeFormat:"2006-01-02T15:04:05.999999999Z07:00" doc:"Creation time of the shard's newest cell, read before the page; absent if the shard is empty"`
+	Body          func(huma.Context)
+}
+
+type WindowReadInput struct {
+	PartitionNumber int       `query:"partition_number" doc:"Partition number" required:"true"`
+	ColumnName      string    `query:"column_name" doc:"Column to scan" required:"true" minLength:"1"`
+	From            time.Time `query:"from" doc:"Start of the created_at window (inclusive)" required:"true"`
+	To              time.Time `query:"to" doc:"End of the created_at window (exclusive)" required:"true"`
+	AfterAddedID    int64     `query:"after_added_id" doc:"Skip cells created exactly at from with this added_id or lower; pass the last cell's created_at as from and its added_id here for the next page" required:"false"`
+	Limit           int       `query:"limit" doc:"Maximum number of cells to return" required:"false"`
+	Mask            []string  `query:"mask" doc:"Body fields to remove from the response, comma-separated; nested fields use dots"`
+}
+
+type WindowReadOutput struct {
+	Link string `header:"Link" doc:"URL of the next page with rel=\"next\"; set when the page is full"`
 	Body []CellResponse
 }
 
@@ -94,11 +242,35 @@ type CellHandler struct {
 	numShards     int
 	indexRegistry *index.Registry
 	notifier      *trigger.Notifier
+	limits        Limits
+	maxWait       time.Duration
+	body          BodyLimits
+	columns       *column.Registry
+	maskSecret    []byte
+	hooks         []WriteHook
+	serverTiming  bool
+	scatter       ScatterLimits
+	acl           rowACL
+	rowMeta       *knownRows // rows known to have metadata; nil without row metadata
+	rowKeys       cell.RowKeyFormat
+	offload       *offload.Offloader
 	logger        *slog.Logger
 }
 
-func NewCellHandler(router *shard.Router, numShards int, indexRegistry *index.Registry, notifier *trigger.Notifier, logger *slog.Logger) *CellHandler {
-	return &CellHandler{router: router, numShards: numShards, indexRegistry: indexRegistry, notifier: notifier, logger: logger}
+// WriteHook inspects a cell before it is stored and returns the body to
+// store instead, or nil to keep the cell's. An error rejects the write with
+// 422 and the error's message.
+type WriteHook func(ctx context.Context, req cell.WriteCellRequest) (json.RawMessage, error)
+
+func NewCellHandler(router *shard.Router, numShards int, indexRegistry *index.Registry, notifier *trigger.Notifier, opts ServerOptions, logger *slog.Logger) *CellHandler {
+	columns := opts.Columns
+	if columns == nil {
+		columns = column.NewRegistry()
+	}
+	if opts.MaxWait <= 0 {
+		opts.MaxWait = DefaultMaxWait
+	}
+	return &CellHandler{router: router, numShards: numShards, indexRegistry: indexRegistry, notifier: notifier, limits: opts.Limits, maxWait: opts.MaxWait, body: opts.Body.withDefaults(), columns: columns, maskSecret: opts.MaskHashSecret, hooks: opts.WriteHooks, serverTiming: opts.ServerTiming, scatter: opts.Scatter, acl: rowACL{mode: opts.RowACL, logger: logger}, rowMeta: newRowMetaCache(opts.RowMetadata), rowKeys: opts.RowKeyFormat, offload: opts.Offload, logger: logger}
 }
 
 func registerCellRoutes(api huma.API, h *CellHandler) {
@@ -107,16 +279,44 @@ func registerCellRoutes(api huma.API, h *CellHandler) {
 		Method:        http.MethodPost,
 		Path:          "/v1/cells",
 		Summary:       "Write a cell",
+		Description:   "Stores a new immutable cell version. A cell with the same (row_key, column_name, ref_key) is a conflict unless the request is a retry carrying the Idempotency-Key of the write that stored it; a key reused for a different request within 24 hours fails with 422. Plugins subscribed to the column synchronously must accept the cell first: a rejection fails the write with 422, and a plugin that cannot be reached in time with 502. With dry_run the write is validated, routed and checked for conflicts but not stored, and answered with 200. When the server offloads large bodies, a body above its threshold is uploaded to object storage and the cell stores, and returns, a pointer to it; reads with resolve=true return the body. A failed upload fails the write with 502.",
 		Tags:          []string{"cells"},
+		Errors:        []int{http.StatusBadRequest, http.StatusForbidden, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
 		DefaultStatus: http.StatusCreated,
+		MaxBodyBytes:  h.body.MaxBytes,
 	}, h.WriteCell)
 
+	huma.Register(api, huma.Operation{
+		OperationID:   "write-cells-batch",
+		Method:        http.MethodPost,
+		Path:          "/v1/cells/batch",
+		Summary:       "Write a batch of cells to one shard atomically",
+		Description:   "Stores up to 1000 cells in one transaction: either all are written or none. All cells must hash to the same shard. Plugins subscribed synchronously to the cells' columns must accept them first, as for single writes. With dry_run the batch is validated, routed and checked for conflicts but not stored, and answered with 200. Large bodies are offloaded as for single writes.",
+		Tags:          []string{"cells"},
+		Errors:        []int{http.StatusBadRequest, http.StatusForbidden, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		DefaultStatus: http.StatusCreated,
+		MaxBodyBytes:  h.body.MaxBatchBytes,
+	}, h.WriteCellsBatch)
+
+	huma.Register(api, huma.Operation{
+		OperationID:  "get-cells",
+		Method:       http.MethodPost,
+		Path:         "/v1/cells/multiget",
+		Summary:      "Get many exact cell versions",
+		Description:  "Fetches up to 1000 exact cell versions, which may span shards. Cells that do not exist are listed in missing instead of failing the request.",
+		Tags:         []string{"cells"},
+		Errors:       []int{http.StatusRequestEntityTooLarge, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		MaxBodyBytes: h.body.MaxBatchBytes,
+	}, h.GetCells)
+
 	huma.Register(api, huma.Operation{
 		OperationID: "get-cell",
 		Method:      http.MethodGet,
 		Path:        "/v1/cells/{row_key}/{column_name}/{ref_key}",
 		Summary:     "Get exact cell version",
+		Description: "Fetches one exact cell version by row key, column name and ref_key.",
 		Tags:        []string{"cells"},
+		Errors:      []int{http.StatusBadRequest, http.StatusNotFound, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
 	}, h.GetCell)
 
 	huma.Register(api, huma.Operation{
@@ -124,56 +324,500 @@ func registerCellRoutes(api huma.API, h *CellHandler) {
 		Method:      http.MethodGet,
 		Path:        "/v1/cells/{row_key}/{column_name}",
 		Summary:     "Get latest cell version for a given row key and column name",
+		Description: "Fetches the version of a cell with the highest ref_key.",
 		Tags:        []string{"cells"},
+		Errors:      []int{http.StatusBadRequest, http.StatusNotFound, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
 	}, h.GetCellLatest)
 
+	huma.Register(api, huma.Operation{
+		OperationID: "head-cell-latest",
+		Method:      http.MethodHead,
+		Path:        "/v1/cells/{row_key}/{column_name}",
+		Summary:     "Check whether a cell exists and get its latest ref_key",
+		Description: "Reports whether a cell exists, with its latest ref_key and added_id in headers, without reading the body.",
+		Tags:        []string{"cells"},
+		Errors:      []int{http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	}, h.HeadCellLatest)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "head-row",
+		Method:      http.MethodHead,
+		Path:        "/v1/cells/{row_key}",
+		Summary:     "Check whether a row exists",
+		Description: "Reports whether a row has any cells, with its column count in a header, without reading the bodies.",
+		Tags:        []string{"cells"},
+		Errors:      []int{http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	}, h.HeadRow)
+
 	huma.Register(api, huma.Operation{
 		OperationID: "get-row",
 		Method:      http.MethodGet,
 		Path:        "/v1/cells/{row_key}",
 		Summary:     "Get all latest cells for a row key",
+		Description: "Fetches the latest version of every column in a row. JSON responses are streamed; an error after the first cell closes the connection.",
 		Tags:        []string{"cells"},
+		Errors:      []int{http.StatusBadRequest, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		Responses:   map[string]*huma.Response{"200": streamedResponse(api, RowResponse{})},
 	}, h.GetRow)
 
+	huma.Register(api, huma.Operation{
+		OperationID:  "get-rows",
+		Method:       http.MethodPost,
+		Path:         "/v1/rows:batchGet",
+		Summary:      "Get all latest cells for many row keys",
+		Description:  "Fetches the latest version of every column for up to 1000 rows, with one query per shard. Rows without cells are listed in missing.",
+		Tags:         []string{"cells"},
+		Errors:       []int{http.StatusRequestEntityTooLarge, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		MaxBodyBytes: h.body.MaxBatchBytes,
+	}, h.GetRows)
+
 	huma.Register(api, huma.Operation{
 		OperationID: "partition-read",
 		Method:      http.MethodGet,
 		Path:        "/v1/cells/partitionRead",
 		Summary:     "Read a partition of cells",
+		Description: "Pages through one shard's cells in created_at or added_id order. JSON responses are streamed; an error after the first cell closes the connection. Offloaded bodies are returned as their pointers.",
 		Tags:        []string{"cells"},
+		Errors:      []int{http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		Responses:   map[string]*huma.Response{"200": streamedResponse(api, []CellResponse{})},
 	}, h.PartitionRead)
+	documentLimit(api, "/v1/cells/partitionRead", h.limits.PartitionRead)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "window-read",
+		Method:      http.MethodGet,
+		Path:        "/v1/cells/windowRead",
+		Summary:     "Read a column's cells created in a time window",
+		Description: "Pages through one shard's cells of a column created in [from, to), in (created_at, added_id) order. Offloaded bodies are returned as their pointers.",
+		Tags:        []string{"cells"},
+		Errors:      []int{http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	}, h.WindowRead)
+	documentLimit(api, "/v1/cells/windowRead", h.limits.WindowRead)
 }
 
 func (h *CellHandler) WriteCell(ctx context.Context, input *WriteCellInput) (*WriteCellOutput, error) {
+	if err := h.assignRowKey(&input.Body, input.IdempotencyKey); err != nil {
+		return nil, err
+	}
 	req := cell.WriteCellRequest{
 		RowKey:     input.Body.RowKey,
 		ColumnName: input.Body.ColumnName,
 		RefKey:     input.Body.RefKey,
 		Body:       input.Body.Body,
 	}
+	if err := checkWritable(req.ColumnName); err != nil {
+		return nil, err
+	}
+	if err := authorizeWrite(ctx, req.ColumnName); err != nil {
+		return nil, err
+	}
+	if err := checkNaturalKey(input.Body); err != nil {
+		return nil, err
+	}
 
-	shardID := shard.ForRowKey(req.RowKey, h.numShards)
+	shardID := h.router.ForRowKey(req.RowKey, h.numShards)
 	store, err := h.router.StoreFor(shardID)
 	if err != nil {
 		h.logger.Error("shard routing failed", "shard_id", shardID, "error", err)
 		return nil, huma.Error500InternalServerError("shard routing failed")
 	}
+	claims, err := h.acl.authorize(ctx, store, []uuid.UUID{req.RowKey})
+	if err != nil {
+		return nil, err
+	}
+	reqs := []cell.WriteCellRequest{req}
+	idem := newIdempotency(ctx, input.IdempotencyKey, reqs)
+	if err := h.beforeWrite(ctx, shardID, reqs); err != nil {
+		return nil, err
+	}
+	originals, err := h.offloadBodies(ctx, reqs, input.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	req = reqs[0]
+	if input.DryRun {
+		return h.dryRunWrite(ctx, store, shardID, req, idem)
+	}
 
-	c, err := store.WriteCell(ctx, req)
+	var timing writeTiming
+	at := time.Now()
+	c, err := h.writeCell(ctx, store, claims, req)
+	if errors.Is(err, storage.ErrCellExists) {
+		return h.replayWrite(ctx, store, shardID, req, idem)
+	}
 	if err != nil {
 		h.logger.Error("failed to write cell", "row_key", req.RowKey, "column_name", req.ColumnName, "error", err)
-		return nil, huma.Error500InternalServerError("failed to write cell")
+		return nil, failed(ctx, err, "failed to write cell")
 	}
+	h.recordIdempotency(ctx, store, idem)
+	at = since(&timing.store, at)
 
+	written := withOriginal(c, originals, 0)
 	if h.notifier != nil {
-		h.notifier.NotifyCell(int(shardID), c)
+		h.notifier.NotifyCell(int(shardID), written)
 	}
+	at = since(&timing.notify, at)
 
-	if err := h.indexRegistry.IndexCell(ctx, c, h.numShards); err != nil {
+	if err := h.indexRegistry.IndexCell(ctx, written, h.numShards); err != nil {
 		h.logger.Error("index write failed", "row_key", c.RowKey, "column_name", c.ColumnName, "error", err)
 	}
+	since(&timing.index, at)
+	h.columns.Observe(c.ColumnName, 1, len(c.Body), c.CreatedAt)
+
+	header := h.reportTiming(timing, "wrote cell", "row_key", c.RowKey, "column_name", c.ColumnName)
+	return &WriteCellOutput{Status: http.StatusCreated, Shard: shardIDHeader(shardID), Seq: seqHeader(c.AddedID), Timing: header, Body: cellToResponse(c)}, nil
+}
+
+// WriteCellsBatch writes cells that all hash to one shard in a single
+// transaction, so the batch is stored entirely or not at all. Clients group
+// cells by shard before sending (see pkg/mezzanine's BulkWriter).
+func (h *CellHandler) WriteCellsBatch(ctx context.Context, input *WriteCellsBatchInput) (*WriteCellsBatchOutput, error) {
+	reqs := make([]cell.WriteCellRequest, len(input.Body.Cells))
+	rows := make([]uuid.UUID, len(input.Body.Cells))
+	var shardID shard.ID
+	for i, b := range input.Body.Cells {
+		if err := checkWritable(b.ColumnName); err != nil {
+			return nil, err
+		}
+		if err := authorizeWrite(ctx, b.ColumnName); err != nil {
+			return nil, err
+		}
+		if b.RowKey == uuid.Nil {
+			return nil, huma.Error400BadRequest("row_key is required in batch writes, whose cells must share a shard")
+		}
+		if err := checkNaturalKey(b); err != nil {
+			return nil, err
+		}
+		reqs[i] = cell.WriteCellRequest{RowKey: b.RowKey, ColumnName: b.ColumnName, RefKey: b.RefKey, Body: b.Body}
+		rows[i] = b.RowKey
+		id := h.router.ForRowKey(b.RowKey, h.numShards)
+		if i == 0 {
+			shardID = id
+		} else if id != shardID {
+			return nil, huma.Error400BadRequest("all cells in a batch must belong to the same shard")
+		}
+	}
+
+	store, err := h.router.StoreFor(shardID)
+	if err != nil {
+		h.logger.Error("shard routing failed", "shard_id", shardID, "error", err)
+		return nil, huma.Error500InternalServerError("shard routing failed")
+	}
+	claims, err := h.acl.authorize(ctx, store, rows)
+	if err != nil {
+		return nil, err
+	}
+	idem := newIdempotency(ctx, input.IdempotencyKey, reqs)
+	if err := h.beforeWrite(ctx, shardID, reqs); err != nil {
+		return nil, err
+	}
+	originals, err := h.offloadBodies(ctx, reqs, input.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	if input.DryRun {
+		return h.dryRunBatch(ctx, store, shardID, reqs, idem)
+	}
+
+	var timing writeTiming
+	at := time.Now()
+	cells, err := h.writeCells(ctx, store, claims, reqs)
+	if errors.Is(err, storage.ErrCellExists) {
+		return h.replayBatch(ctx, store, shardID, reqs, idem)
+	}
+	if err != nil {
+		h.logger.Error("failed to write cell batch", "shard_id", shardID, "cells", len(reqs), "error", err)
+		return nil, failed(ctx, err, "failed to write cells")
+	}
+	h.recordIdempotency(ctx, store, idem)
+
+	at = since(&timing.store, at)
+
+	out := make([]CellResponse, len(cells))
+	var seq int64
+	for i := range cells {
+		c := &cells[i]
+		seq = max(seq, c.AddedID)
+		written := withOriginal(c, originals, i)
+		if h.notifier != nil {
+			h.notifier.NotifyCell(int(shardID), written)
+		}
+		at = since(&timing.notify, at)
+		if err := h.indexRegistry.IndexCell(ctx, written, h.numShards); err != nil {
+			h.logger.Error("index write failed", "row_key", c.RowKey, "column_name", c.ColumnName, "error", err)
+		}
+		at = since(&timing.index, at)
+		h.columns.Observe(c.ColumnName, 1, len(c.Body), c.CreatedAt)
+		out[i] = cellToResponse(c)
+	}
+	header := h.reportTiming(timing, "wrote cell batch", "shard_id", shardID, "cells", len(cells))
+	return &WriteCellsBatchOutput{Status: http.StatusCreated, Shard: shardIDHeader(shardID), Seq: seqHeader(seq), Timing: header, Body: BatchResponse{Cells: out}}, nil
+}
+
+// reportTiming records a write's phases in metrics and a debug log with
+// args, and returns its Server-Timing header if the server sends it.
+func (h *CellHandler) reportTiming(t writeTiming, msg string, args ...any) string {
+	t.observe()
+	h.logger.Debug(msg, append(args, t.attrs()...)...)
+	if !h.serverTiming {
+		return ""
+	}
+	return t.header()
+}
+
+// beforeWrite rejects bodies shaped like offload pointers, runs the write
+// hooks on reqs, then has the plugins subscribed synchronously to their
+// columns validate them, replacing the bodies they transform. Transformed
+// bodies are held to the single-cell body limit.
+func (h *CellHandler) beforeWrite(ctx context.Context, shardID shard.ID, reqs []cell.WriteCellRequest) error {
+	orig := make([]json.RawMessage, len(reqs))
+	for i := range reqs {
+		if err := checkBody(reqs[i].Body); err != nil {
+			return err
+		}
+		orig[i] = reqs[i].Body
+		for _, hook := range h.hooks {
+			body, err := hook(ctx, reqs[i])
+			if err != nil {
+				return huma.Error422UnprocessableEntity(err.Error())
+			}
+			if body == nil {
+				continue
+			}
+			if !json.Valid(body) {
+				h.logger.Error("write hook returned an invalid body", "column_name", reqs[i].ColumnName)
+				return huma.Error500InternalServerError("write hook failed")
+			}
+			reqs[i].Body = body
+		}
+	}
+	if err := h.checkTransformed(reqs, orig); err != nil {
+		return err
+	}
+	if h.notifier == nil {
+		return nil
+	}
+	err := h.notifier.Validate(ctx, int(shardID), reqs)
+	if err != nil {
+		var rejected *trigger.RejectedError
+		if errors.As(err, &rejected) {
+			return huma.Error422UnprocessableEntity(rejected.Error())
+		}
+		return huma.Error502BadGateway("synchronous plugin validation failed")
+	}
+	return h.checkTransformed(reqs, orig)
+}
+
+// checkTransformed rejects with 422 a body that a hook or plugin replaced
+// with one over MaxBytes, which the client could not have written itself.
+// Bodies left as sent are not checked again.
+func (h *CellHandler) checkTransformed(reqs []cell.WriteCellRequest, orig []json.RawMessage) error {
+	for i, req := range reqs {
+		if int64(len(req.Body)) > h.body.MaxBytes && !bytes.Equal(req.Body, orig[i]) {
+			h.logger.Warn("transformed body over the limit", "column_name", req.ColumnName, "bytes", len(req.Body), "limit", h.body.MaxBytes)
+			return huma.Error422UnprocessableEntity(fmt.Sprintf("transformed body of column %q is %d bytes, over the %d-byte limit", req.ColumnName, len(req.Body), h.body.MaxBytes))
+		}
+	}
+	return nil
+}
+
+// writeCells stores reqs, all on store's shard, in one batch with claims,
+// the owner cells authorize returned for their rows, and the metadata
+// cells of rows without any, so a write the store refuses, such as one to
+// a fenced column, leaves its rows unclaimed. A conflict may be a
+// concurrent first write to one of the rows; the second pass looks at the
+// owners and metadata again, and a conflict then is the write's own.
+func (h *CellHandler) writeCells(ctx context.Context, store storage.CellStore, claims, reqs []cell.WriteCellRequest) ([]cell.Cell, error) {
+	rows := make([]uuid.UUID, len(reqs))
+	for i, req := range reqs {
+		rows[i] = req.RowKey
+	}
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			var err error
+			if claims, err = h.acl.authorize(ctx, store, rows); err != nil {
+				return nil, err
+			}
+		}
+		meta, err := h.missingMeta(ctx, store, rows)
+		if err != nil {
+			return nil, err
+		}
+		extra := append(slices.Clip(claims), meta...)
+		if len(extra) == 0 {
+			return store.WriteCells(ctx, reqs)
+		}
+		cells, err := store.WriteCells(ctx, append(extra, reqs...))
+		if err == nil {
+			h.wroteMeta(meta)
+			return cells[len(extra):], nil
+		}
+		if !errors.Is(err, storage.ErrCellExists) || attempt > 0 {
+			return nil, err
+		}
+	}
+}
+
+// writeCell is writeCells for one cell, written alone if its row needs
+// neither an owner nor metadata.
+func (h *CellHandler) writeCell(ctx context.Context, store storage.CellStore, claims []cell.WriteCellRequest, req cell.WriteCellRequest) (*cell.Cell, error) {
+	if len(claims) == 0 && (h.rowMeta == nil || h.rowMeta.has(req.RowKey)) {
+		return store.WriteCell(ctx, req)
+	}
+	cells, err := h.writeCells(ctx, store, claims, []cell.WriteCellRequest{req})
+	if err != nil {
+		return nil, err
+	}
+	return &cells[0], nil
+}
+
+// claimRows records the owners and metadata rows lack for a write the
+// store cannot batch with them. It runs once the write has passed
+// beforeWrite, so a write refused there leaves its rows unclaimed.
+func (h *CellHandler) claimRows(ctx context.Context, store storage.CellStore, rows []uuid.UUID) error {
+	if err := h.acl.claim(ctx, store, rows, false); err != nil {
+		return err
+	}
+	return h.recordMeta(ctx, store, rows)
+}
+
+// dryRunWrite answers a dry-run write with the cell as it would be stored,
+// without an added_id, or with the conflict or replay the write would meet.
+// Nothing is written, indexed or notified.
+func (h *CellHandler) dryRunWrite(ctx context.Context, store storage.CellStore, shardID shard.ID, req cell.WriteCellRequest, idem idempotency) (*WriteCellOutput, error) {
+	_, err := store.GetCell(ctx, cell.CellRef{RowKey: req.RowKey, ColumnName: req.ColumnName, RefKey: req.RefKey})
+	switch {
+	case err == nil:
+		return h.replayWrite(ctx, store, shardID, req, idem)
+	case !errors.Is(err, storage.ErrCellNotFound):
+		h.logger.Error("failed to read existing cell", "row_key", req.RowKey, "column_name", req.ColumnName, "error", err)
+		return nil, failed(ctx, err, "failed to check cell")
+	}
+	c := dryRunCell(req)
+	return &WriteCellOutput{Status: http.StatusOK, Shard: shardIDHeader(shardID), Body: cellToResponse(&c)}, nil
+}
+
+// dryRunBatch is dryRunWrite for batches.
+func (h *CellHandler) dryRunBatch(ctx context.Context, store storage.CellStore, shardID shard.ID, reqs []cell.WriteCellRequest, idem idempotency) (*WriteCellsBatchOutput, error) {
+	refs := make([]cell.CellRef, len(reqs))
+	for i, req := range reqs {
+		refs[i] = cell.CellRef{RowKey: req.RowKey, ColumnName: req.ColumnName, RefKey: req.RefKey}
+	}
+	found, err := store.GetCells(ctx, refs)
+	if err != nil {
+		h.logger.Error("failed to read existing cells", "cells", len(reqs), "error", err)
+		return nil, failed(ctx, err, "failed to check cells")
+	}
+	for _, existing := range found {
+		if existing != nil {
+			return h.replayBatch(ctx, store, shardID, reqs, idem)
+		}
+	}
+	out := make([]CellResponse, len(reqs))
+	for i, req := range reqs {
+		c := dryRunCell(req)
+		out[i] = cellToResponse(&c)
+	}
+	return &WriteCellsBatchOutput{Status: http.StatusOK, Shard: shardIDHeader(shardID), Body: BatchResponse{Cells: out}}, nil
+}
+
+// dryRunCell is the cell req would store, less its added_id.
+func dryRunCell(req cell.WriteCellRequest) cell.Cell {
+	return cell.Cell{RowKey: req.RowKey, ColumnName: req.ColumnName, RefKey: req.RefKey, Body: req.Body, CreatedAt: time.Now().UTC()}
+}
+
+func shardIDHeader(id shard.ID) string {
+	return strconv.Itoa(int(id))
+}
+
+// replayBatch is replayWrite for batches: an idempotent retry is answered
+// with the stored cells only if every cell exists and, unless the key was
+// remembered with the batch, has the same body.
+func (h *CellHandler) replayBatch(ctx context.Context, store storage.CellStore, shardID shard.ID, reqs []cell.WriteCellRequest, idem idempotency) (*WriteCellsBatchOutput, error) {
+	if idem.key == "" {
+		return nil, huma.Error409Conflict("a cell in the batch already exists")
+	}
+	retry, err := h.checkIdempotency(ctx, store, idem)
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]cell.CellRef, len(reqs))
+	for i, req := range reqs {
+		refs[i] = cell.CellRef{RowKey: req.RowKey, ColumnName: req.ColumnName, RefKey: req.RefKey}
+	}
+	found, err := store.GetCells(ctx, refs)
+	if err != nil {
+		h.logger.Error("failed to read existing cells", "cells", len(reqs), "error", err)
+		return nil, failed(ctx, err, "failed to write cells")
+	}
+	out := make([]CellResponse, len(reqs))
+	var seq int64
+	for i, req := range reqs {
+		existing := found[i]
+		if existing == nil {
+			return nil, huma.Error409Conflict("a cell in the batch already exists")
+		}
+		if !retry && !sameJSON(existing.Body, req.Body) {
+			return nil, huma.Error409Conflict("a cell in the batch already exists with a different body")
+		}
+		out[i] = cellToResponse(existing)
+		seq = max(seq, existing.AddedID)
+	}
+	h.logger.Debug("replayed idempotent batch write", "cells", len(reqs), "idempotency_key", idem.key)
+	return &WriteCellsBatchOutput{Status: http.StatusOK, Shard: shardIDHeader(shardID), Seq: seqHeader(seq), Body: BatchResponse{Cells: out}}, nil
+}
+
+// replayWrite handles a write whose cell already exists. Cells are immutable,
+// so a retry carrying an Idempotency-Key is answered with the stored cell;
+// the original write already indexed and notified it. The shard remembers
+// the request each key was first sent with: a different request reusing the
+// key fails with 422. A key no longer remembered is a retry if the stored
+// body matches. Any other duplicate is a conflict.
+func (h *CellHandler) replayWrite(ctx context.Context, store storage.CellStore, shardID shard.ID, req cell.WriteCellRequest, idem idempotency) (*WriteCellOutput, error) {
+	if idem.key == "" {
+		return nil, huma.Error409Conflict("cell already exists")
+	}
+	retry, err := h.checkIdempotency(ctx, store, idem)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := store.GetCell(ctx, cell.CellRef{RowKey: req.RowKey, ColumnName: req.ColumnName, RefKey: req.RefKey})
+	if err != nil {
+		h.logger.Error("failed to read existing cell", "row_key", req.RowKey, "column_name", req.ColumnName, "error", err)
+		return nil, failed(ctx, err, "failed to write cell")
+	}
+	if !retry && !sameJSON(existing.Body, req.Body) {
+		return nil, huma.Error409Conflict("cell already exists with a different body")
+	}
+	h.logger.Debug("replayed idempotent write", "row_key", req.RowKey, "column_name", req.ColumnName, "idempotency_key", idem.key)
+	return &WriteCellOutput{Status: http.StatusOK, Shard: shardIDHeader(shardID), Seq: seqHeader(existing.AddedID), Body: cellToResponse(existing)}, nil
+}
 
-	return &WriteCellOutput{Body: cellToResponse(c)}, nil
+// sameJSON reports whether a and b encode the same JSON value, ignoring
+// formatting and key order (PostgreSQL normalises stored jsonb).
+func sameJSON(a, b json.RawMessage) bool {
+	var va, vb any
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+// checkWritable rejects client writes to reserved system columns.
+func checkWritable(columnName string) error {
+	if cell.IsReserved(columnName) {
+		return huma.Error400BadRequest(fmt.Sprintf("column %q is reserved: names starting with %q are for system use", columnName, cell.ReservedPrefix))
+	}
+	return nil
+}
+
+// checkBody rejects client bodies shaped like an offload pointer, which
+// resolve=true would otherwise fetch from the bucket, whoever's body it is.
+func checkBody(body json.RawMessage) error {
+	if _, ok := offload.Parse(body); ok {
+		return huma.Error400BadRequest(fmt.Sprintf("body is reserved: an object with only a %q field is an offload pointer", offload.Key))
+	}
+	return nil
 }
 
 func (h *CellHandler) GetCell(ctx context.Context, input *GetCellInput) (*GetCellOutput, error) {
@@ -182,13 +826,19 @@ func (h *CellHandler) GetCell(ctx context.Context, input *GetCellInput) (*GetCel
 		return nil, huma.Error400BadRequest("invalid row_key")
 	}
 
-	shardID := shard.ForRowKey(rowKey, h.numShards)
+	shardID := h.router.ForRowKey(rowKey, h.numShards)
 	store, err := h.router.StoreFor(shardID)
 	if err != nil {
 		h.logger.Error("shard routing failed", "shard_id", shardID, "error", err)
 		return nil, huma.Error500InternalServerError("shard routing failed")
 	}
 
+	if err := h.acl.readable(ctx, store, rowKey, "cell not found"); err != nil {
+		return nil, err
+	}
+	if hidden(ctx, input.ColumnName) {
+		return nil, huma.Error404NotFound("cell not found")
+	}
 	ref := cell.CellRef{RowKey: rowKey, ColumnName: input.ColumnName, RefKey: input.RefKey}
 	c, err := store.GetCell(ctx, ref)
 	if err != nil {
@@ -196,10 +846,134 @@ func (h *CellHandler) GetCell(ctx context.Context, input *GetCellInput) (*GetCel
 			return nil, huma.Error404NotFound("cell not found")
 		}
 		h.logger.Error("failed to get cell", "row_key", rowKey, "column_name", input.ColumnName, "ref_key", input.RefKey, "error", err)
-		return nil, huma.Error500InternalServerError("failed to get cell")
+		return nil, failed(ctx, err, "failed to get cell")
+	}
+	if c, err = h.resolver(input.Resolve).cell(ctx, c); err != nil {
+		return nil, h.resolveFailed(ctx, err, "failed to get cell")
 	}
 
-	return &GetCellOutput{Body: cellToResponse(c)}, nil
+	return &GetCellOutput{Body: cellToResponse(readMask(ctx, input.Mask, h.maskSecret).cell(c))}, nil
+}
+
+// GetCells fetches many cells at once. Refs are grouped by shard and each
+// shard's lookups are pipelined to its backend in one round trip, with
+// shards queried concurrently within the server's ScatterLimits.
+func (h *CellHandler) GetCells(ctx context.Context, input *GetCellsInput) (*GetCellsOutput, error) {
+	type group struct {
+		store  storage.CellStore
+		idx    []int
+		refs   []cell.CellRef
+		found  []*cell.Cell
+		err    error
+		unread bool
+	}
+	groups := make(map[shard.ID]*group)
+	var order []shard.ID
+	for i, r := range input.Body.Refs {
+		shardID := h.router.ForRowKey(r.RowKey, h.numShards)
+		g, ok := groups[shardID]
+		if !ok {
+			store, err := h.router.StoreFor(shardID)
+			if err != nil {
+				h.logger.Error("shard routing failed", "shard_id", shardID, "error", err)
+				return nil, huma.Error500InternalServerError("shard routing failed")
+			}
+			g = &group{store: store}
+			groups[shardID] = g
+			order = append(order, shardID)
+		}
+		g.idx = append(g.idx, i)
+		g.refs = append(g.refs, cell.CellRef{RowKey: r.RowKey, ColumnName: r.ColumnName, RefKey: r.RefKey})
+	}
+	budget, readCtx := newScatterBudget(ctx, h.scatter, "multiget", input.Partial)
+	defer budget.done()
+	n, err := budget.shards(len(order))
+	if err != nil {
+		return nil, err
+	}
+	for _, shardID := range order[n:] {
+		groups[shardID].unread = true
+	}
+
+	var wg sync.WaitGroup
+	for _, shardID := range order[:n] {
+		g := groups[shardID]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rows := make([]uuid.UUID, len(g.refs))
+			for i, r := range g.refs {
+				rows[i] = r.RowKey
+			}
+			var foreign map[uuid.UUID]bool
+			if foreign, g.err = h.acl.foreign(readCtx, g.store, rows); g.err != nil {
+				return
+			}
+			if g.found, g.err = g.store.GetCells(readCtx, g.refs); g.err != nil {
+				return
+			}
+			found := 0
+			for i, c := range g.found {
+				if c != nil && (foreign[c.RowKey] || hidden(readCtx, c.ColumnName)) {
+					g.found[i] = nil
+				}
+				if g.found[i] != nil {
+					found++
+				}
+			}
+			budget.spend(found)
+		}()
+	}
+	wg.Wait()
+	if err := budget.checkCells(); err != nil {
+		return nil, err
+	}
+
+	found := make([]*cell.Cell, len(input.Body.Refs))
+	unread := make([]bool, len(input.Body.Refs))
+	var shardErrs []ShardError
+	for _, shardID := range order {
+		g := groups[shardID]
+		if budget.cancelled(ctx, g.err) {
+			g.unread = true
+		} else if g.err != nil {
+			h.logger.Error("failed to get cells", "shard_id", shardID, "cells", len(g.refs), "error", g.err)
+			e, err := budget.shardFailed(ctx, shardID, g.err, "failed to get cells")
+			if err != nil || len(shardErrs)+1 == n {
+				return nil, failed(ctx, g.err, "failed to get cells")
+			}
+			shardErrs = append(shardErrs, e)
+			g.unread = true
+		}
+		for j, i := range g.idx {
+			if g.unread {
+				unread[i] = true
+			} else {
+				found[i] = g.found[j]
+			}
+		}
+	}
+
+	// The cell budget is spent in request order.
+	mask := readMask(ctx, input.Mask, h.maskSecret)
+	resolve := h.resolver(input.Resolve)
+	resp := GetCellsResponse{Cells: []CellResponse{}, Missing: []CellRefBody{}}
+	for i, c := range found {
+		switch {
+		case unread[i] || c != nil && !budget.fits(len(resp.Cells), 1):
+			resp.Unread = append(resp.Unread, input.Body.Refs[i])
+		case c == nil:
+			resp.Missing = append(resp.Missing, input.Body.Refs[i])
+		default:
+			if c, err = resolve.cell(ctx, c); err != nil {
+				return nil, h.resolveFailed(ctx, err, "failed to get cells")
+			}
+			resp.Cells = append(resp.Cells, cellToResponse(mask.cell(c)))
+		}
+	}
+	resp.Partial = len(resp.Unread) > 0
+	resp.ShardErrors = shardErrs
+	return &GetCellsOutput{Status: multiStatus(shardErrs), Body: resp}, nil
 }
 
 func (h *CellHandler) GetCellLatest(ctx context.Context, input *GetCellLatestInput) (*GetCellLatestOutput, error) {
@@ -208,12 +982,21 @@ func (h *CellHandler) GetCellLatest(ctx context.Context, input *GetCellLatestInp
 		return nil, huma.Error400BadRequest("invalid row_key")
 	}
 
-	shardID := shard.ForRowKey(rowKey, h.numShards)
+	shardID := h.router.ForRowKey(rowKey, h.numShards)
 	store, err := h.router.StoreFor(shardID)
 	if err != nil {
 		h.logger.Error("shard routing failed", "shard_id", shardID, "error", err)
 		return nil, huma.Error500InternalServerError("shard routing failed")
 	}
+	if ctx, err = h.consistentRead(ctx, input.MinSeq, shardID); err != nil {
+		return nil, err
+	}
+	if err := h.acl.readable(ctx, store, rowKey, "cell not found"); err != nil {
+		return nil, err
+	}
+	if hidden(ctx, input.ColumnName) {
+		return nil, huma.Error404NotFound("cell not found")
+	}
 
 	c, err := store.GetCellLatest(ctx, rowKey, input.ColumnName)
 	if err != nil {
@@ -221,10 +1004,81 @@ func (h *CellHandler) GetCellLatest(ctx context.Context, input *GetCellLatestInp
 			return nil, huma.Error404NotFound("cell not found")
 		}
 		h.logger.Error("failed to get cell", "row_key", rowKey, "column_name", input.ColumnName, "error", err)
-		return nil, huma.Error500InternalServerError("failed to get cell")
+		return nil, failed(ctx, err, "failed to get cell")
+	}
+	if c, err = h.resolver(input.Resolve).cell(ctx, c); err != nil {
+		return nil, h.resolveFailed(ctx, err, "failed to get cell")
+	}
+
+	return &GetCellLatestOutput{Body: cellToResponse(readMask(ctx, input.Mask, h.maskSecret).cell(c))}, nil
+}
+
+// HeadCellLatest reports the latest version of a cell without its body, for
+// cheap presence checks.
+func (h *CellHandler) HeadCellLatest(ctx context.Context, input *GetCellLatestInput) (*HeadCellLatestOutput, error) {
+	rowKey, err := uuid.Parse(input.RowKey)
+	if err != nil {
+		return nil, huma.Error400BadRequest("invalid row_key")
+	}
+
+	shardID := h.router.ForRowKey(rowKey, h.numShards)
+	store, err := h.router.StoreFor(shardID)
+	if err != nil {
+		h.logger.Error("shard routing failed", "shard_id", shardID, "error", err)
+		return nil, huma.Error500InternalServerError("shard routing failed")
+	}
+	if ctx, err = h.consistentRead(ctx, input.MinSeq, shardID); err != nil {
+		return nil, err
+	}
+	if err := h.acl.readable(ctx, store, rowKey, "cell not found"); err != nil {
+		return nil, err
+	}
+	if hidden(ctx, input.ColumnName) {
+		return nil, huma.Error404NotFound("cell not found")
+	}
+
+	c, err := storage.ProbeCellLatest(ctx, store, rowKey, input.ColumnName)
+	if err != nil {
+		if errors.Is(err, storage.ErrCellNotFound) {
+			return nil, huma.Error404NotFound("cell not found")
+		}
+		h.logger.Error("failed to probe cell", "row_key", rowKey, "column_name", input.ColumnName, "error", err)
+		return nil, failed(ctx, err, "failed to get cell")
+	}
+
+	return &HeadCellLatestOutput{AddedID: c.AddedID, RefKey: c.RefKey, LastModified: c.CreatedAt}, nil
+}
+
+// HeadRow reports whether a row exists and how many columns it has.
+func (h *CellHandler) HeadRow(ctx context.Context, input *HeadRowInput) (*HeadRowOutput, error) {
+	rowKey, err := uuid.Parse(input.RowKey)
+	if err != nil {
+		return nil, huma.Error400BadRequest("invalid row_key")
+	}
+
+	shardID := h.router.ForRowKey(rowKey, h.numShards)
+	store, err := h.router.StoreFor(shardID)
+	if err != nil {
+		h.logger.Error("shard routing failed", "shard_id", shardID, "error", err)
+		return nil, huma.Error500InternalServerError("shard routing failed")
+	}
+	if ctx, err = h.consistentRead(ctx, input.MinSeq, shardID); err != nil {
+		return nil, err
+	}
+	if err := h.acl.readable(ctx, store, rowKey, "row not found"); err != nil {
+		return nil, err
+	}
+
+	sum, err := storage.ProbeRow(ctx, store, rowKey, readsSystem(ctx))
+	if err != nil {
+		h.logger.Error("failed to probe row", "row_key", rowKey, "error", err)
+		return nil, failed(ctx, err, "failed to get row")
+	}
+	if sum.Columns == 0 {
+		return nil, huma.Error404NotFound("row not found")
 	}
 
-	return &GetCellLatestOutput{Body: cellToResponse(c)}, nil
+	return &HeadRowOutput{ColumnCount: sum.Columns, LastModified: sum.UpdatedAt}, nil
 }
 
 func (h *CellHandler) GetRow(ctx context.Context, input *GetRowInput) (*GetRowOutput, error) {
@@ -233,35 +1087,186 @@ func (h *CellHandler) GetRow(ctx context.Context, input *GetRowInput) (*GetRowOu
 		return nil, huma.Error400BadRequest("invalid row_key")
 	}
 
-	shardID := shard.ForRowKey(rowKey, h.numShards)
+	shardID := h.router.ForRowKey(rowKey, h.numShards)
 	store, err := h.router.StoreFor(shardID)
 	if err != nil {
 		h.logger.Error("shard routing failed", "shard_id", shardID, "error", err)
 		return nil, huma.Error500InternalServerError("shard routing failed")
 	}
+	if ctx, err = h.consistentRead(ctx, input.MinSeq, shardID); err != nil {
+		return nil, err
+	}
 
-	cells, err := store.GetRow(ctx, rowKey)
+	foreign, err := h.acl.foreign(ctx, store, []uuid.UUID{rowKey})
+	if err != nil {
+		h.logger.Error("failed to read row owners", "row_key", rowKey, "error", err)
+		return nil, failed(ctx, err, "failed to get row")
+	}
+	// A foreign row reads as empty, like a row that does not exist.
+	it := storage.SliceIterator(nil)
+	if !foreign[rowKey] {
+		it, err = storage.StreamRowColumns(ctx, store, rowKey, input.Columns)
+	}
+	if err != nil {
+		h.logger.Error("failed to get row", "row_key", rowKey, "error", err)
+		return nil, failed(ctx, err, "failed to get row")
+	}
+	it = hideSystemIterator(ctx, it)
+	it = h.resolver(input.Resolve).iterator(ctx, it)
+	it = readMask(ctx, input.Mask, h.maskSecret).iterator(it)
+	stream, err := newCellStream(it, input.Accept, func(cells []CellResponse) any {
+		return RowResponse{RowKey: rowKey, Cells: cells}
+	}, h.logger.With("row_key", rowKey), "failed to stream row")
 	if err != nil {
 		h.logger.Error("failed to get row", "row_key", rowKey, "error", err)
-		return nil, huma.Error500InternalServerError("failed to get row")
+		return nil, h.resolveFailed(ctx, err, "failed to get row")
 	}
 
-	resp := make([]CellResponse, len(cells))
-	for i, c := range cells {
-		resp[i] = CellResponse{
-			AddedID:    c.AddedID,
-			RowKey:     c.RowKey,
-			ColumnName: c.ColumnName,
-			RefKey:     c.RefKey,
-			Body:       c.Body,
-			CreatedAt:  c.CreatedAt,
+	return &GetRowOutput{Body: stream.body(fmt.Sprintf(`{"row_key":%q,"cells":`, rowKey), "}")}, nil
+}
+
+// GetRows fetches many rows with one store call per shard, run concurrently
+// within the server's ScatterLimits.
+func (h *CellHandler) GetRows(ctx context.Context, input *GetRowsInput) (*GetRowsOutput, error) {
+	type group struct {
+		store  storage.CellStore
+		keys   []uuid.UUID
+		rows   map[uuid.UUID][]cell.Cell
+		err    error
+		unread bool
+	}
+	groups := make(map[shard.ID]*group)
+	var order []shard.ID
+	seen := make(map[uuid.UUID]bool, len(input.Body.RowKeys))
+	for _, rowKey := range input.Body.RowKeys {
+		if seen[rowKey] {
+			continue
+		}
+		seen[rowKey] = true
+		shardID := h.router.ForRowKey(rowKey, h.numShards)
+		g, ok := groups[shardID]
+		if !ok {
+			store, err := h.router.StoreFor(shardID)
+			if err != nil {
+				h.logger.Error("shard routing failed", "shard_id", shardID, "error", err)
+				return nil, huma.Error500InternalServerError("shard routing failed")
+			}
+			g = &group{store: store}
+			groups[shardID] = g
+			order = append(order, shardID)
 		}
+		g.keys = append(g.keys, rowKey)
+	}
+	budget, readCtx := newScatterBudget(ctx, h.scatter, "batch_get", input.Partial)
+	defer budget.done()
+	n, err := budget.shards(len(order))
+	if err != nil {
+		return nil, err
+	}
+	for _, shardID := range order[n:] {
+		groups[shardID].unread = true
+	}
+	readCtx, err = h.consistentRead(readCtx, input.MinSeq, order[:n]...)
+	if err != nil {
+		return nil, err
 	}
 
-	return &GetRowOutput{Body: RowResponse{RowKey: rowKey, Cells: resp}}, nil
+	var wg sync.WaitGroup
+	for _, shardID := range order[:n] {
+		g := groups[shardID]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var foreign map[uuid.UUID]bool
+			if foreign, g.err = h.acl.foreign(readCtx, g.store, g.keys); g.err != nil {
+				return
+			}
+			if g.rows, g.err = g.store.GetRows(readCtx, g.keys); g.err != nil {
+				return
+			}
+			for row := range foreign {
+				delete(g.rows, row)
+			}
+			cells := 0
+			for row, rowCells := range g.rows {
+				if rowCells = hideSystem(readCtx, rowCells); len(rowCells) == 0 {
+					delete(g.rows, row)
+					continue
+				}
+				g.rows[row] = rowCells
+				cells += len(rowCells)
+			}
+			budget.spend(cells)
+		}()
+	}
+	wg.Wait()
+	if err := budget.checkCells(); err != nil {
+		return nil, err
+	}
+
+	rows := make(map[uuid.UUID][]cell.Cell, len(seen))
+	unread := make(map[uuid.UUID]bool)
+	var shardErrs []ShardError
+	for _, shardID := range order {
+		g := groups[shardID]
+		if budget.cancelled(ctx, g.err) {
+			g.unread = true
+		} else if g.err != nil {
+			h.logger.Error("failed to get rows", "shard_id", shardID, "rows", len(g.keys), "error", g.err)
+			e, err := budget.shardFailed(ctx, shardID, g.err, "failed to get rows")
+			if err != nil || len(shardErrs)+1 == n {
+				return nil, failed(ctx, g.err, "failed to get rows")
+			}
+			shardErrs = append(shardErrs, e)
+			g.unread = true
+		}
+		for _, rowKey := range g.keys {
+			if g.unread {
+				unread[rowKey] = true
+			} else if cells := g.rows[rowKey]; len(cells) > 0 {
+				rows[rowKey] = cells
+			}
+		}
+	}
+
+	// Missing and unread rows follow request order, like multiget, and the
+	// cell budget is spent in that order.
+	mask := readMask(ctx, input.Mask, h.maskSecret)
+	resolve := h.resolver(input.Resolve)
+	resp := GetRowsResponse{Rows: make(map[string][]CellResponse, len(rows)), Missing: []uuid.UUID{}}
+	used := 0
+	for _, rowKey := range input.Body.RowKeys {
+		if !seen[rowKey] {
+			continue
+		}
+		delete(seen, rowKey)
+		cells, ok := rows[rowKey]
+		switch {
+		case unread[rowKey] || ok && !budget.fits(used, len(cells)):
+			resp.Unread = append(resp.Unread, rowKey)
+		case !ok:
+			resp.Missing = append(resp.Missing, rowKey)
+		default:
+			if cells, err = resolve.cells(ctx, cells); err != nil {
+				return nil, h.resolveFailed(ctx, err, "failed to get rows")
+			}
+			out := make([]CellResponse, len(cells))
+			for i := range cells {
+				out[i] = cellToResponse(mask.cell(&cells[i]))
+			}
+			resp.Rows[rowKey.String()] = out
+			used += len(cells)
+		}
+	}
+	resp.Partial = len(resp.Unread) > 0
+	resp.ShardErrors = shardErrs
+	return &GetRowsOutput{Status: multiStatus(shardErrs), Body: resp}, nil
 }
 
 func (h *CellHandler) PartitionRead(ctx context.Context, input *PartitionReadInput) (*PartitionReadOutput, error) {
+	if err := h.acl.scan(ctx, "partition_read"); err != nil {
+		return nil, err
+	}
 	switch input.PartitionReadType {
 	case storage.PartitionReadTypeCreatedAt:
 		// Handle type1 partition read
@@ -269,15 +1274,13 @@ func (h *CellHandler) PartitionRead(ctx context.Context, input *PartitionReadInp
 	case storage.PartitionReadTypeAddedID:
 		// Handle type2 partition read
 		break
+	case storage.PartitionReadTypeCommitSeq:
+		break
 	default:
 		return nil, huma.Error400BadRequest("invalid partition type")
 	}
 
-	if input.Limit <= 0 {
-		input.Limit = 100 // Default limit
-	} else if input.Limit > 1000 {
-		input.Limit = 1000 // Max limit
-	}
+	input.Limit = h.limits.PartitionRead.Apply(input.Limit)
 
 	if input.PartitionNumber < 0 || input.PartitionNumber >= h.numShards {
 		h.logger.Error("invalid partition number", "partition_number", input.PartitionNumber)
@@ -290,18 +1293,105 @@ func (h *CellHandler) PartitionRead(ctx context.Context, input *PartitionReadInp
 		return nil, huma.Error500InternalServerError("shard routing failed")
 	}
 
-	cells, err := store.PartitionRead(ctx, input.PartitionNumber, input.PartitionReadType, input.AddedID, input.CreatedAfter, input.Limit)
+	// The head is read before the page, so every cell committed by then is
+	// visible to the page.
+	head, err := store.Head(ctx)
+	if err != nil {
+		h.logger.Error("failed to read shard head", "partition_number", input.PartitionNumber, "error", err)
+		return nil, failed(ctx, err, "failed to read partition")
+	}
+	if input.Wait > 0 && input.PartitionReadType == storage.PartitionReadTypeAddedID && head.AddedID <= input.AddedID {
+		head, err = h.waitHead(ctx, store, head, time.Duration(input.Wait)*time.Second)
+		if err != nil {
+			h.logger.Error("failed to wait for shard head", "partition_number", input.PartitionNumber, "error", err)
+			return nil, failed(ctx, err, "failed to read partition")
+		}
+	}
+
+	it, err := streamVisiblePartition(ctx, store, input.PartitionNumber, input.PartitionReadType, input.AddedID, input.CreatedAfter, input.Limit)
+	if errors.Is(err, storage.ErrNoCommitLog) {
+		return nil, huma.Error400BadRequest("read_type 3 needs COMMIT_LOG enabled")
+	}
 	if err != nil {
 		h.logger.Error("failed to read partition", "partition_number", input.PartitionNumber, "error", err)
-		return nil, huma.Error500InternalServerError("failed to read partition")
+		return nil, failed(ctx, err, "failed to read partition")
+	}
+	it = readMask(ctx, input.Mask, h.maskSecret).iterator(it)
+	stream, err := newCellStream(it, input.Accept, func(cells []CellResponse) any {
+		return cells
+	}, h.logger.With("partition_number", input.PartitionNumber), "failed to stream partition")
+	if err != nil {
+		h.logger.Error("failed to read partition", "partition_number", input.PartitionNumber, "error", err)
+		return nil, failed(ctx, err, "failed to read partition")
 	}
 
-	resp := make([]CellResponse, len(cells))
-	for i, c := range cells {
-		resp[i] = cellToResponse(&c)
+	return &PartitionReadOutput{HeadAddedID: head.AddedID, HeadCreatedAt: head.CreatedAt, Body: stream.body("", "")}, nil
+}
+
+// waitHead long-polls a caught-up partition: it waits up to wait, the
+// server's maximum and half the request's remaining budget for cells past
+// head, and returns the head the page is then read up to.
+func (h *CellHandler) waitHead(ctx context.Context, store storage.CellStore, head storage.Head, wait time.Duration) (storage.Head, error) {
+	wait = min(wait, h.maxWait)
+	if deadline, ok := ctx.Deadline(); ok {
+		wait = min(wait, time.Until(deadline)/2)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	if _, err := storage.WaitHead(waitCtx, store, head.AddedID); err != nil {
+		if ctx.Err() != nil {
+			return storage.Head{}, ctx.Err()
+		}
+		return head, nil
+	}
+	return store.Head(ctx)
+}
+
+func (h *CellHandler) WindowRead(ctx context.Context, input *WindowReadInput) (*WindowReadOutput, error) {
+	if err := h.acl.scan(ctx, "window_read"); err != nil {
+		return nil, err
+	}
+	if !input.From.Before(input.To) {
+		return nil, huma.Error400BadRequest("from must be before to")
+	}
+	input.Limit = h.limits.WindowRead.Apply(input.Limit)
+	if input.PartitionNumber < 0 || input.PartitionNumber >= h.numShards {
+		return nil, huma.Error400BadRequest("invalid partition number")
 	}
 
-	return &PartitionReadOutput{Body: resp}, nil
+	store, err := h.router.StoreFor(shard.ID(input.PartitionNumber))
+	if err != nil {
+		h.logger.Error("shard routing failed", "partition_number", input.PartitionNumber, "error", err)
+		return nil, huma.Error500InternalServerError("shard routing failed")
+	}
+
+	if hidden(ctx, input.ColumnName) {
+		return &WindowReadOutput{Body: []CellResponse{}}, nil
+	}
+	cells, err := store.ScanCellsWindow(ctx, input.ColumnName, input.From, input.To, input.AfterAddedID, input.Limit)
+	if err != nil {
+		h.logger.Error("failed to read window", "partition_number", input.PartitionNumber, "column_name", input.ColumnName, "error", err)
+		return nil, failed(ctx, err, "failed to read window")
+	}
+
+	mask := readMask(ctx, input.Mask, h.maskSecret)
+	resp := make([]CellResponse, len(cells))
+	for i := range cells {
+		resp[i] = cellToResponse(mask.cell(&cells[i]))
+	}
+	out := &WindowReadOutput{Body: resp}
+	if len(cells) == input.Limit {
+		last := cells[len(cells)-1]
+		out.Link = nextLink("/v1/cells/windowRead", url.Values{
+			"partition_number": {strconv.Itoa(input.PartitionNumber)},
+			"column_name":      {input.ColumnName},
+			"from":             {last.CreatedAt.Format(time.RFC3339Nano)},
+			"to":               {input.To.Format(time.RFC3339Nano)},
+			"after_added_id":   {strconv.FormatInt(last.AddedID, 10)},
+			"limit":            {strconv.Itoa(input.Limit)},
+		}, input.Mask)
+	}
+	return out, nil
 }
 
 func cellToResponse(c *cell.Cell) CellResponse {
@@ -312,5 +1402,6 @@ func cellToResponse(c *cell.Cell) CellResponse {
 		RefKey:     c.RefKey,
 		Body:       c.Body,
 		CreatedAt:  c.CreatedAt,
+		CommitSeq:  c.CommitSeq,
 	}
 }
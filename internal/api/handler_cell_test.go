@@ -5,102 +5,54 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/fault"
 	"github.com/ryanbastic/go-mezzanine/internal/index"
 	"github.com/ryanbastic/go-mezzanine/internal/shard"
 	"github.com/ryanbastic/go-mezzanine/internal/storage"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
 	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+	"github.com/ryanbastic/go-mezzanine/pkg/plugin"
 )
 
-// --- Mock CellStore ---
-
-type mockCellStore struct {
-	cells     map[string]*cell.Cell
-	rows      map[string][]cell.Cell
-	writeErr  error
-	getErr    error
-	latestErr error
-	rowErr    error
-	nextID    int64
-}
-
-func newMockCellStore() *mockCellStore {
-	return &mockCellStore{
-		cells: make(map[string]*cell.Cell),
-		rows:  make(map[string][]cell.Cell),
-	}
-}
-
-func cellKey(rowKey uuid.UUID, colName string, refKey int64) string {
-	return rowKey.String() + ":" + colName + ":" + string(rune(refKey))
-}
-
-func (m *mockCellStore) WriteCell(ctx context.Context, req cell.WriteCellRequest) (*cell.Cell, error) {
-	if m.writeErr != nil {
-		return nil, m.writeErr
-	}
-	m.nextID++
-	c := &cell.Cell{
-		AddedID:    m.nextID,
-		RowKey:     req.RowKey,
-		ColumnName: req.ColumnName,
-		RefKey:     req.RefKey,
-		Body:       req.Body,
-		CreatedAt:  time.Now(),
-	}
-	m.cells[cellKey(req.RowKey, req.ColumnName, req.RefKey)] = c
-	return c, nil
-}
-
-func (m *mockCellStore) GetCell(ctx context.Context, ref cell.CellRef) (*cell.Cell, error) {
-	if m.getErr != nil {
-		return nil, m.getErr
-	}
-	c, ok := m.cells[cellKey(ref.RowKey, ref.ColumnName, ref.RefKey)]
-	if !ok {
-		return nil, storage.ErrCellNotFound
-	}
-	return c, nil
-}
-
-func (m *mockCellStore) GetCellLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, error) {
-	if m.latestErr != nil {
-		return nil, m.latestErr
-	}
-	var best *cell.Cell
-	for _, c := range m.cells {
-		if c.RowKey == rowKey && c.ColumnName == columnName {
-			if best == nil || c.RefKey > best.RefKey {
-				cc := *c
-				best = &cc
-			}
+// seedCells writes cells to store, each created at its CreatedAt unless
+// that is zero. The store assigns added_ids in order; a cell's AddedID, if
+// set, must be the one it gets.
+func seedCells(t *testing.T, store *memory.Store, cells ...cell.Cell) {
+	t.Helper()
+	defer store.SetClock(time.Now)
+	for _, c := range cells {
+		if !c.CreatedAt.IsZero() {
+			store.SetClock(func() time.Time { return c.CreatedAt })
+		}
+		req := cell.WriteCellRequest{RowKey: c.RowKey, ColumnName: c.ColumnName, RefKey: c.RefKey, Body: c.Body}
+		got, err := store.WriteCell(context.Background(), req)
+		if err != nil {
+			t.Fatalf("WriteCell: %v", err)
+		}
+		if c.AddedID != 0 && got.AddedID != c.AddedID {
+			t.Fatalf("seeded cell got added_id %d, want %d", got.AddedID, c.AddedID)
 		}
 	}
-	if best == nil {
-		return nil, storage.ErrCellNotFound
-	}
-	return best, nil
-}
-
-func (m *mockCellStore) GetRow(ctx context.Context, rowKey uuid.UUID) ([]cell.Cell, error) {
-	if m.rowErr != nil {
-		return nil, m.rowErr
-	}
-	return m.rows[rowKey.String()], nil
-}
-
-func (m *mockCellStore) PartitionRead(ctx context.Context, partitionNumber int, readType int, addedID int64, createdAfter time.Time, limit int) ([]cell.Cell, error) {
-	return nil, nil
 }
 
-func (m *mockCellStore) ScanCells(ctx context.Context, columnName string, afterAddedID int64, limit int) ([]cell.Cell, error) {
-	return nil, nil
+// failOn returns store with every call of op, an internal/fault operation,
+// failing.
+func failOn(store storage.CellStore, op string) storage.CellStore {
+	rule := fault.Rule{Operations: []string{op}, ErrorRate: 1, Error: "db error"}
+	return fault.NewInjector(&fault.Config{Rules: []fault.Rule{rule}}, nil).Interceptor()(0, store)
 }
 
 func setupTestServer(store storage.CellStore, numShards int) http.Handler {
@@ -108,13 +60,13 @@ func setupTestServer(store storage.CellStore, numShards int) http.Handler {
 	for i := 0; i < numShards; i++ {
 		r.Register(shard.ID(i), store)
 	}
-	return NewServer(testLogger(), r, index.NewRegistry(), trigger.NewPluginRegistry(), nil, numShards, nil)
+	return NewServer(testLogger(), r, index.NewRegistry(), trigger.NewPluginRegistry(), nil, numShards, nil, ServerOptions{})
 }
 
 // --- WriteCell Tests ---
 
 func TestWriteCell_Success(t *testing.T) {
-	store := newMockCellStore()
+	store := memory.New()
 	server := setupTestServer(store, 64)
 
 	rowKey := uuid.New()
@@ -149,7 +101,7 @@ func TestWriteCell_Success(t *testing.T) {
 }
 
 func TestWriteCell_InvalidBody(t *testing.T) {
-	store := newMockCellStore()
+	store := memory.New()
 	server := setupTestServer(store, 64)
 
 	req := httptest.NewRequest(http.MethodPost, "/v1/cells", bytes.NewReader([]byte("invalid json")))
@@ -164,7 +116,7 @@ func TestWriteCell_InvalidBody(t *testing.T) {
 }
 
 func TestWriteCell_MissingColumnName(t *testing.T) {
-	store := newMockCellStore()
+	store := memory.New()
 	server := setupTestServer(store, 64)
 
 	body := map[string]any{
@@ -185,11 +137,56 @@ func TestWriteCell_MissingColumnName(t *testing.T) {
 	}
 }
 
-func TestWriteCell_StoreError(t *testing.T) {
-	store := newMockCellStore()
-	store.writeErr = errors.New("db error")
+func TestWriteCell_ReservedColumn(t *testing.T) {
+	store := memory.New()
 	server := setupTestServer(store, 64)
 
+	w := postCell(t, server, map[string]any{"row_key": uuid.New().String(), "column_name": "_mezz.tombstone", "ref_key": 1, "body": map[string]any{}}, "")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status: got %d, want %d\nbody: %s", w.Code, http.StatusBadRequest, w.Body.String())
+	}
+	if store.Len() != 0 {
+		t.Errorf("stored %d cells, want 0", store.Len())
+	}
+}
+
+func TestWriteCell_InvalidCoordinates(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		column   string
+		refKey   int64
+		location string
+	}{
+		{"quote in column", "profile'); --", 1, "body.column_name"},
+		{"space in column", "my profile", 1, "body.column_name"},
+		{"leading digit", "1profile", 1, "body.column_name"},
+		{"long column", strings.Repeat("c", 129), 1, "body.column_name"},
+		{"negative ref_key", "profile", -1, "body.ref_key"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := memory.New()
+			server := setupTestServer(store, 64)
+
+			w := postCell(t, server, map[string]any{"row_key": uuid.New().String(), "column_name": tc.column, "ref_key": tc.refKey, "body": map[string]any{}}, "")
+			if w.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status: got %d, want %d\nbody: %s", w.Code, http.StatusUnprocessableEntity, w.Body.String())
+			}
+			var problem struct {
+				Errors []struct{ Location string }
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil || len(problem.Errors) == 0 || problem.Errors[0].Location != tc.location {
+				t.Errorf("errors: got %s, want one at %s", w.Body.String(), tc.location)
+			}
+			if store.Len() != 0 {
+				t.Errorf("stored %d cells, want 0", store.Len())
+			}
+		})
+	}
+}
+
+func TestWriteCell_StoreError(t *testing.T) {
+	server := setupTestServer(failOn(memory.New(), fault.OpWrite), 64)
+
 	body := map[string]any{
 		"row_key":     uuid.New().String(),
 		"column_name": "profile",
@@ -209,19 +206,379 @@ func TestWriteCell_StoreError(t *testing.T) {
 	}
 }
 
+func postCell(t *testing.T, server http.Handler, body map[string]any, idempotencyKey string) *httptest.ResponseRecorder {
+	t.Helper()
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/v1/cells", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	return w
+}
+
+func TestWriteCell_DuplicateIsConflict(t *testing.T) {
+	server := setupTestServer(memory.New(), 64)
+	body := map[string]any{
+		"row_key":     uuid.New().String(),
+		"column_name": "profile",
+		"ref_key":     1,
+		"body":        map[string]string{"name": "test"},
+	}
+
+	if w := postCell(t, server, body, ""); w.Code != http.StatusCreated {
+		t.Fatalf("first write: got %d\nbody: %s", w.Code, w.Body.String())
+	}
+	if w := postCell(t, server, body, ""); w.Code != http.StatusConflict {
+		t.Errorf("duplicate write: got %d, want %d", w.Code, http.StatusConflict)
+	}
+}
+
+func TestWriteCell_IdempotentRetryReplays(t *testing.T) {
+	store := memory.New()
+	// Hiding the store's idempotency keys leaves only the stored cell to
+	// compare, as once a key is forgotten.
+	server := setupTestServer(struct{ storage.CellStore }{store}, 64)
+	body := map[string]any{
+		"row_key":     uuid.New().String(),
+		"column_name": "profile",
+		"ref_key":     1,
+		"body":        map[string]any{"name": "test", "age": 30},
+	}
+
+	first := postCell(t, server, body, "key-1")
+	if first.Code != http.StatusCreated {
+		t.Fatalf("first write: got %d\nbody: %s", first.Code, first.Body.String())
+	}
+	retry := postCell(t, server, body, "key-1")
+	if retry.Code != http.StatusOK {
+		t.Fatalf("retry: got %d, want %d\nbody: %s", retry.Code, http.StatusOK, retry.Body.String())
+	}
+	var a, b CellResponse
+	_ = json.NewDecoder(first.Body).Decode(&a)
+	_ = json.NewDecoder(retry.Body).Decode(&b)
+	if a.AddedID != b.AddedID {
+		t.Errorf("retry returned added_id %d, want %d", b.AddedID, a.AddedID)
+	}
+	if store.Len() != 1 {
+		t.Errorf("store wrote %d cells, want 1", store.Len())
+	}
+
+	body["body"] = map[string]any{"name": "other"}
+	if w := postCell(t, server, body, "key-1"); w.Code != http.StatusConflict {
+		t.Errorf("retry with different body: got %d, want %d", w.Code, http.StatusConflict)
+	}
+}
+
+func TestWriteCell_IdempotencyKeyRemembered(t *testing.T) {
+	server := setupTestServer(memory.New(), 8)
+	body := map[string]any{"row_key": uuid.New().String(), "column_name": "profile", "ref_key": 1, "body": map[string]any{"name": "test"}}
+
+	if w := postCell(t, server, body, "key-1"); w.Code != http.StatusCreated {
+		t.Fatalf("first write: got %d\nbody: %s", w.Code, w.Body.String())
+	}
+	if w := postCell(t, server, body, "key-1"); w.Code != http.StatusOK {
+		t.Errorf("retry: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	body["body"] = map[string]any{"name": "other"}
+	if w := postCell(t, server, body, "key-1"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("key reused with a different body: got %d, want 422", w.Code)
+	}
+
+	cells := batchCells(keysOnShard(2, 8))
+	if w := postBatchCells(t, server, cells, "batch-1"); w.Code != http.StatusCreated {
+		t.Fatalf("batch: got %d\nbody: %s", w.Code, w.Body.String())
+	}
+	if w := postBatchCells(t, server, cells, "batch-1"); w.Code != http.StatusOK {
+		t.Errorf("batch retry: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	cells[0]["body"] = map[string]any{"changed": true}
+	if w := postBatchCells(t, server, cells, "batch-1"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("batch key reused with a different batch: got %d, want 422", w.Code)
+	}
+}
+
+func TestWriteCell_DryRun(t *testing.T) {
+	store := memory.New()
+	server := setupTestServer(store, 64)
+	rowKey := uuid.New()
+	body, _ := json.Marshal(map[string]any{"row_key": rowKey.String(), "column_name": "profile", "ref_key": 1, "body": map[string]any{"name": "Ann"}})
+
+	w := postRaw(server, "/v1/cells?dry_run=true", bytes.NewReader(body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	if got, want := w.Header().Get("X-Shard-Id"), strconv.Itoa(int(defaultShard(rowKey, 64))); got != want {
+		t.Errorf("X-Shard-Id: got %q, want %q", got, want)
+	}
+	if got := w.Header().Get("X-Shard-Seq"); got != "" {
+		t.Errorf("X-Shard-Seq set on a dry run: %q", got)
+	}
+	var resp CellResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if resp.AddedID != 0 || resp.RowKey != rowKey {
+		t.Errorf("response: got %+v", resp)
+	}
+	if store.Len() != 0 {
+		t.Fatalf("store wrote %d cells, want 0", store.Len())
+	}
+
+	// A dry run meets the same conflict as the real write.
+	if w := postRaw(server, "/v1/cells", bytes.NewReader(body)); w.Code != http.StatusCreated {
+		t.Fatalf("write: got %d", w.Code)
+	}
+	if w := postRaw(server, "/v1/cells?dry_run=true", bytes.NewReader(body)); w.Code != http.StatusConflict {
+		t.Errorf("dry run of an existing cell: got %d, want 409", w.Code)
+	}
+}
+
+func TestWriteCell_ShardSeq(t *testing.T) {
+	store := memory.New()
+	server := setupTestServer(store, 64)
+	rowKey := uuid.New()
+	body, _ := json.Marshal(map[string]any{"row_key": rowKey.String(), "column_name": "profile", "ref_key": 1, "body": map[string]any{}})
+
+	for _, want := range []int{http.StatusCreated, http.StatusOK} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/cells", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", "k1")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Fatalf("status: got %d, want %d\nbody: %s", w.Code, want, w.Body.String())
+		}
+		var resp CellResponse
+		_ = json.NewDecoder(w.Body).Decode(&resp)
+		if got, want := w.Header().Get("X-Shard-Id"), strconv.Itoa(int(defaultShard(rowKey, 64))); got != want {
+			t.Errorf("X-Shard-Id: got %q, want %q", got, want)
+		}
+		if got, want := w.Header().Get("X-Shard-Seq"), strconv.FormatInt(resp.AddedID, 10); got != want {
+			t.Errorf("X-Shard-Seq: got %q, want %q", got, want)
+		}
+	}
+
+	w := postBatch(t, server, keysOnShard(3, 64))
+	var resp BatchResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if got, want := w.Header().Get("X-Shard-Seq"), strconv.FormatInt(resp.Cells[2].AddedID, 10); got != want {
+		t.Errorf("batch X-Shard-Seq: got %q, want %q", got, want)
+	}
+}
+
+func TestWriteCell_SynchronousPlugin(t *testing.T) {
+	validator := plugin.New(plugin.Options{})
+	validator.OnCellValidate(func(_ context.Context, c plugin.CellValidate) error {
+		var p struct{ Amount int }
+		if err := c.Decode(&p); err != nil || p.Amount < 0 {
+			return errors.New("amount must not be negative")
+		}
+		return nil
+	})
+	pluginServer := httptest.NewServer(validator.Handler())
+	defer pluginServer.Close()
+
+	registry := trigger.NewPluginRegistry()
+	if err := registry.Register(context.Background(), &trigger.Plugin{
+		Name: "validator", Endpoint: pluginServer.URL + "/rpc", SubscribedColumns: []string{"payments"}, SynchronousColumns: []string{"payments"},
+	}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	notifier := trigger.NewNotifier(registry, trigger.NewRPCClient(0, time.Millisecond, time.Second), testLogger())
+	notifier.SetSyncTimeout(time.Second)
+	store := memory.New()
+	router := shard.NewRouter()
+	router.Register(0, store)
+	server := NewServer(testLogger(), router, index.NewRegistry(), registry, notifier, 1, nil, ServerOptions{})
+
+	rowKey := uuid.New()
+	write := func(refKey int64, amount int) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]any{"row_key": rowKey, "column_name": "payments", "ref_key": refKey, "body": map[string]any{"amount": amount}})
+		return postRaw(server, "/v1/cells", bytes.NewReader(body))
+	}
+	if w := write(1, 10); w.Code != http.StatusCreated {
+		t.Errorf("accepted write: got %d, body: %s", w.Code, w.Body.String())
+	}
+	if w := write(2, -1); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("rejected write: got %d, want 422", w.Code)
+	}
+	if _, err := store.GetCell(context.Background(), cell.CellRef{RowKey: rowKey, ColumnName: "payments", RefKey: 2}); err == nil {
+		t.Errorf("rejected cell was stored")
+	}
+
+	pluginServer.Close()
+	if w := write(3, 10); w.Code != http.StatusBadGateway {
+		t.Errorf("write with the plugin down: got %d, want 502", w.Code)
+	}
+	if _, err := store.GetCell(context.Background(), cell.CellRef{RowKey: rowKey, ColumnName: "payments", RefKey: 3}); err == nil {
+		t.Errorf("cell stored without the plugin's acceptance")
+	}
+	if err := notifier.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+}
+
+// --- WriteCellsBatch Tests ---
+
+// keysOnShard returns n row keys that all hash to the same shard.
+func keysOnShard(n, numShards int) []uuid.UUID {
+	first := uuid.New()
+	target := defaultShard(first, numShards)
+	keys := []uuid.UUID{first}
+	for len(keys) < n {
+		if k := uuid.New(); defaultShard(k, numShards) == target {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func postBatch(t *testing.T, server http.Handler, keys []uuid.UUID) *httptest.ResponseRecorder {
+	t.Helper()
+	return postBatchCells(t, server, batchCells(keys), "")
+}
+
+// batchCells returns a cell in the events column of each row.
+func batchCells(keys []uuid.UUID) []map[string]any {
+	cells := make([]map[string]any, len(keys))
+	for i, k := range keys {
+		cells[i] = map[string]any{
+			"row_key":     k.String(),
+			"column_name": "events",
+			"ref_key":     1,
+			"body":        map[string]int{"i": i},
+		}
+	}
+	return cells
+}
+
+func postBatchCells(t *testing.T, server http.Handler, cells []map[string]any, idempotencyKey string) *httptest.ResponseRecorder {
+	t.Helper()
+	data, _ := json.Marshal(map[string]any{"cells": cells})
+	req := httptest.NewRequest(http.MethodPost, "/v1/cells/batch", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	return w
+}
+
+func TestWriteCellsBatch_Success(t *testing.T) {
+	store := memory.New()
+	server := setupTestServer(store, 8)
+	keys := keysOnShard(3, 8)
+
+	w := postBatch(t, server, keys)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status: got %d, want %d\nbody: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+	var resp BatchResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Cells) != 3 {
+		t.Fatalf("cells: got %d, want 3", len(resp.Cells))
+	}
+	for i, c := range resp.Cells {
+		if c.RowKey != keys[i] {
+			t.Errorf("cell %d: row_key %s, want %s", i, c.RowKey, keys[i])
+		}
+	}
+}
+
+func TestWriteCellsBatch_MixedShards(t *testing.T) {
+	server := setupTestServer(memory.New(), 8)
+	keys := keysOnShard(1, 8)
+	for {
+		k := uuid.New()
+		if defaultShard(k, 8) != defaultShard(keys[0], 8) {
+			keys = append(keys, k)
+			break
+		}
+	}
+
+	if w := postBatch(t, server, keys); w.Code != http.StatusBadRequest {
+		t.Errorf("status: got %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestWriteCellsBatch_Duplicate(t *testing.T) {
+	server := setupTestServer(memory.New(), 8)
+	keys := keysOnShard(2, 8)
+
+	if w := postBatch(t, server, keys); w.Code != http.StatusCreated {
+		t.Fatalf("first batch: got %d\nbody: %s", w.Code, w.Body.String())
+	}
+	if w := postBatch(t, server, keys); w.Code != http.StatusConflict {
+		t.Errorf("duplicate batch: got %d, want %d", w.Code, http.StatusConflict)
+	}
+}
+
+func TestWriteCellsBatch_ReservedColumn(t *testing.T) {
+	server := setupTestServer(memory.New(), 8)
+	keys := keysOnShard(2, 8)
+	data, _ := json.Marshal(map[string]any{"cells": []map[string]any{
+		{"row_key": keys[0].String(), "column_name": "events", "ref_key": 1, "body": map[string]any{}},
+		{"row_key": keys[1].String(), "column_name": "_mezz.marker", "ref_key": 1, "body": map[string]any{}},
+	}})
+	req := httptest.NewRequest(http.MethodPost, "/v1/cells/batch", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status: got %d, want %d\nbody: %s", w.Code, http.StatusBadRequest, w.Body.String())
+	}
+}
+
+func TestWriteCellsBatch_DryRun(t *testing.T) {
+	store := memory.New()
+	server := setupTestServer(store, 64)
+	keys := keysOnShard(3, 64)
+	cells := make([]map[string]any, len(keys))
+	for i, k := range keys {
+		cells[i] = map[string]any{"row_key": k.String(), "column_name": "profile", "ref_key": 1, "body": map[string]any{"i": i}}
+	}
+	body, _ := json.Marshal(map[string]any{"cells": cells})
+
+	w := postRaw(server, "/v1/cells/batch?dry_run=true", bytes.NewReader(body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	var resp BatchResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp.Cells) != 3 || store.Len() != 0 {
+		t.Errorf("got %d cells and %d writes, want 3 and 0", len(resp.Cells), store.Len())
+	}
+
+	// Routing is still checked.
+	other := uuid.New()
+	for defaultShard(other, 64) == defaultShard(keys[0], 64) {
+		other = uuid.New()
+	}
+	cells = append(cells, map[string]any{"row_key": other.String(), "column_name": "profile", "ref_key": 1, "body": map[string]any{}})
+	body, _ = json.Marshal(map[string]any{"cells": cells})
+	if w := postRaw(server, "/v1/cells/batch?dry_run=true", bytes.NewReader(body)); w.Code != http.StatusBadRequest {
+		t.Errorf("mixed shards: got %d, want 400", w.Code)
+	}
+}
+
 // --- GetCell Tests ---
 
 func TestGetCell_Success(t *testing.T) {
-	store := newMockCellStore()
+	store := memory.New()
 	rowKey := uuid.New()
-	store.cells[cellKey(rowKey, "profile", 1)] = &cell.Cell{
+	seedCells(t, store, cell.Cell{
 		AddedID:    1,
 		RowKey:     rowKey,
 		ColumnName: "profile",
 		RefKey:     1,
 		Body:       json.RawMessage(`{"name":"test"}`),
 		CreatedAt:  time.Now(),
-	}
+	})
 
 	server := setupTestServer(store, 64)
 
@@ -236,7 +593,7 @@ func TestGetCell_Success(t *testing.T) {
 }
 
 func TestGetCell_InvalidRowKey(t *testing.T) {
-	store := newMockCellStore()
+	store := memory.New()
 	server := setupTestServer(store, 64)
 
 	req := httptest.NewRequest(http.MethodGet, "/v1/cells/not-a-uuid/profile/1", nil)
@@ -251,7 +608,7 @@ func TestGetCell_InvalidRowKey(t *testing.T) {
 }
 
 func TestGetCell_InvalidRefKey(t *testing.T) {
-	store := newMockCellStore()
+	store := memory.New()
 	server := setupTestServer(store, 64)
 
 	rowKey := uuid.New()
@@ -266,7 +623,7 @@ func TestGetCell_InvalidRefKey(t *testing.T) {
 }
 
 func TestGetCell_NotFound(t *testing.T) {
-	store := newMockCellStore()
+	store := memory.New()
 	server := setupTestServer(store, 64)
 
 	rowKey := uuid.New()
@@ -281,12 +638,9 @@ func TestGetCell_NotFound(t *testing.T) {
 }
 
 func TestGetCell_StoreError(t *testing.T) {
-	store := newMockCellStore()
-	store.getErr = errors.New("db error")
-	server := setupTestServer(store, 64)
+	server := setupTestServer(failOn(memory.New(), fault.OpRead), 64)
 
 	rowKey := uuid.New()
-	store.cells[cellKey(rowKey, "profile", 1)] = &cell.Cell{} // ensure shard routes
 	req := httptest.NewRequest(http.MethodGet, "/v1/cells/"+rowKey.String()+"/profile/1", nil)
 	w := httptest.NewRecorder()
 
@@ -297,19 +651,83 @@ func TestGetCell_StoreError(t *testing.T) {
 	}
 }
 
+// --- GetCells Tests ---
+
+func postMultiget(t *testing.T, server http.Handler, refs []map[string]any) *httptest.ResponseRecorder {
+	t.Helper()
+	data, _ := json.Marshal(map[string]any{"refs": refs})
+	req := httptest.NewRequest(http.MethodPost, "/v1/cells/multiget", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	return w
+}
+
+func TestGetCells_AcrossShards(t *testing.T) {
+	store := memory.New()
+	server := setupTestServer(store, 64)
+
+	var refs []map[string]any
+	var want []uuid.UUID
+	for i := 0; i < 10; i++ {
+		k := uuid.New()
+		seedCells(t, store, cell.Cell{AddedID: int64(i + 1), RowKey: k, ColumnName: "profile", RefKey: 1, Body: json.RawMessage(`{}`)})
+		refs = append(refs, map[string]any{"row_key": k.String(), "column_name": "profile", "ref_key": 1})
+		want = append(want, k)
+	}
+	missing := uuid.New()
+	refs = append(refs[:3], append([]map[string]any{{"row_key": missing.String(), "column_name": "profile", "ref_key": 1}}, refs[3:]...)...)
+
+	w := postMultiget(t, server, refs)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want %d\nbody: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp GetCellsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Cells) != len(want) {
+		t.Fatalf("cells: got %d, want %d", len(resp.Cells), len(want))
+	}
+	for i, c := range resp.Cells {
+		if c.RowKey != want[i] {
+			t.Errorf("cell %d: got row %s, want %s (request order)", i, c.RowKey, want[i])
+		}
+	}
+	if len(resp.Missing) != 1 || resp.Missing[0].RowKey != missing {
+		t.Errorf("missing: got %+v, want [%s]", resp.Missing, missing)
+	}
+}
+
+func TestGetCells_Empty(t *testing.T) {
+	server := setupTestServer(memory.New(), 64)
+	if w := postMultiget(t, server, []map[string]any{}); w.Code < 400 || w.Code >= 500 {
+		t.Errorf("status: got %d, want 4xx", w.Code)
+	}
+}
+
+func TestGetCells_StoreError(t *testing.T) {
+	server := setupTestServer(failOn(memory.New(), fault.OpRead), 64)
+
+	w := postMultiget(t, server, []map[string]any{{"row_key": uuid.New().String(), "column_name": "profile", "ref_key": 1}})
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status: got %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
+
 // --- GetCellLatest Tests ---
 
 func TestGetCellLatest_Success(t *testing.T) {
-	store := newMockCellStore()
+	store := memory.New()
 	rowKey := uuid.New()
-	store.cells[cellKey(rowKey, "profile", 1)] = &cell.Cell{
+	seedCells(t, store, cell.Cell{
 		AddedID: 1, RowKey: rowKey, ColumnName: "profile", RefKey: 1,
 		Body: json.RawMessage(`{"v":1}`), CreatedAt: time.Now(),
-	}
-	store.cells[cellKey(rowKey, "profile", 2)] = &cell.Cell{
+	})
+	seedCells(t, store, cell.Cell{
 		AddedID: 2, RowKey: rowKey, ColumnName: "profile", RefKey: 2,
 		Body: json.RawMessage(`{"v":2}`), CreatedAt: time.Now(),
-	}
+	})
 
 	server := setupTestServer(store, 64)
 
@@ -331,8 +749,73 @@ func TestGetCellLatest_Success(t *testing.T) {
 	}
 }
 
+func TestGetCellLatest_MinSeq(t *testing.T) {
+	store := memory.New()
+	r := shard.NewRouter()
+	for i := range 64 {
+		r.Register(shard.ID(i), store)
+	}
+	const maxWait = 50 * time.Millisecond
+	server := NewServer(testLogger(), r, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil, ServerOptions{MaxWait: maxWait})
+	rowKey := uuid.New()
+	w := postCell(t, server, map[string]any{"row_key": rowKey.String(), "column_name": "profile", "ref_key": 1, "body": map[string]any{}}, "")
+	token := w.Header().Get("X-Shard-Id") + ":" + w.Header().Get("X-Shard-Seq")
+	path := "/v1/cells/" + rowKey.String() + "/profile?min_seq="
+
+	get := func(minSeq string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+minSeq, nil))
+		return w
+	}
+	if w := get(token); w.Code != http.StatusOK {
+		t.Errorf("reached seq: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+	for _, bad := range []string{"7", "x:1", "64:1", "-1:1", "1:-1"} {
+		if w := get(bad); w.Code != http.StatusBadRequest {
+			t.Errorf("min_seq %q: got %d, want 400", bad, w.Code)
+		}
+	}
+	start := time.Now()
+	w = get(w.Header().Get("X-Shard-Id") + ":1000")
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"retryable":true`) {
+		t.Errorf("unreached seq: got %d, want a retryable 503\nbody: %s", w.Code, w.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed < maxWait {
+		t.Errorf("gave up after %v, want at least %v", elapsed, maxWait)
+	}
+}
+
+// fencedHeadStore reports a fenced head stuck at zero, as when an
+// unrelated transaction is still running, while the committed head keeps up.
+type fencedHeadStore struct{ *memory.Store }
+
+func (s fencedHeadStore) Head(context.Context) (storage.Head, error) { return storage.Head{}, nil }
+
+func (s fencedHeadStore) CommittedHead(ctx context.Context) (int64, error) {
+	head, err := s.Store.Head(ctx)
+	return head.AddedID, err
+}
+
+func TestGetCellLatest_MinSeqCommittedHead(t *testing.T) {
+	store := fencedHeadStore{memory.New()}
+	r := shard.NewRouter()
+	for i := range 64 {
+		r.Register(shard.ID(i), store)
+	}
+	server := NewServer(testLogger(), r, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil, ServerOptions{MaxWait: 50 * time.Millisecond})
+	rowKey := uuid.New()
+	w := postCell(t, server, map[string]any{"row_key": rowKey.String(), "column_name": "profile", "ref_key": 1, "body": map[string]any{}}, "")
+	token := w.Header().Get("X-Shard-Id") + ":" + w.Header().Get("X-Shard-Seq")
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/cells/"+rowKey.String()+"/profile?min_seq="+token, nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("committed seq behind the fence: got %d, want 200\nbody: %s", w.Code, w.Body.String())
+	}
+}
+
 func TestGetCellLatest_InvalidRowKey(t *testing.T) {
-	store := newMockCellStore()
+	store := memory.New()
 	server := setupTestServer(store, 64)
 
 	req := httptest.NewRequest(http.MethodGet, "/v1/cells/invalid/profile", nil)
@@ -346,7 +829,7 @@ func TestGetCellLatest_InvalidRowKey(t *testing.T) {
 }
 
 func TestGetCellLatest_NotFound(t *testing.T) {
-	store := newMockCellStore()
+	store := memory.New()
 	server := setupTestServer(store, 64)
 
 	rowKey := uuid.New()
@@ -361,9 +844,7 @@ func TestGetCellLatest_NotFound(t *testing.T) {
 }
 
 func TestGetCellLatest_StoreError(t *testing.T) {
-	store := newMockCellStore()
-	store.latestErr = errors.New("db error")
-	server := setupTestServer(store, 64)
+	server := setupTestServer(failOn(memory.New(), fault.OpRead), 64)
 
 	rowKey := uuid.New()
 	req := httptest.NewRequest(http.MethodGet, "/v1/cells/"+rowKey.String()+"/profile", nil)
@@ -379,12 +860,12 @@ func TestGetCellLatest_StoreError(t *testing.T) {
 // --- GetRow Tests ---
 
 func TestGetRow_Success(t *testing.T) {
-	store := newMockCellStore()
+	store := memory.New()
 	rowKey := uuid.New()
-	store.rows[rowKey.String()] = []cell.Cell{
-		{AddedID: 1, RowKey: rowKey, ColumnName: "profile", RefKey: 1, Body: json.RawMessage(`{}`), CreatedAt: time.Now()},
-		{AddedID: 2, RowKey: rowKey, ColumnName: "settings", RefKey: 1, Body: json.RawMessage(`{}`), CreatedAt: time.Now()},
-	}
+	seedCells(t, store,
+		cell.Cell{AddedID: 1, RowKey: rowKey, ColumnName: "profile", RefKey: 1, Body: json.RawMessage(`{}`), CreatedAt: time.Now()},
+		cell.Cell{AddedID: 2, RowKey: rowKey, ColumnName: "settings", RefKey: 1, Body: json.RawMessage(`{}`), CreatedAt: time.Now()},
+	)
 
 	server := setupTestServer(store, 64)
 
@@ -409,8 +890,34 @@ func TestGetRow_Success(t *testing.T) {
 	}
 }
 
+func TestGetRow_Columns(t *testing.T) {
+	store := memory.New()
+	rowKey := uuid.New()
+	seedCells(t, store,
+		cell.Cell{AddedID: 1, RowKey: rowKey, ColumnName: "billing", RefKey: 1, Body: json.RawMessage(`{}`), CreatedAt: time.Now()},
+		cell.Cell{AddedID: 2, RowKey: rowKey, ColumnName: "profile", RefKey: 1, Body: json.RawMessage(`{}`), CreatedAt: time.Now()},
+		cell.Cell{AddedID: 3, RowKey: rowKey, ColumnName: "settings", RefKey: 1, Body: json.RawMessage(`{}`), CreatedAt: time.Now()},
+	)
+	server := setupTestServer(store, 64)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/cells/"+rowKey.String()+"?columns=settings,billing", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want %d\nbody: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp RowResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Cells) != 2 || resp.Cells[0].ColumnName != "billing" || resp.Cells[1].ColumnName != "settings" {
+		t.Errorf("Cells: got %+v, want billing and settings", resp.Cells)
+	}
+}
+
 func TestGetRow_InvalidRowKey(t *testing.T) {
-	store := newMockCellStore()
+	store := memory.New()
 	server := setupTestServer(store, 64)
 
 	req := httptest.NewRequest(http.MethodGet, "/v1/cells/not-a-uuid", nil)
@@ -424,7 +931,7 @@ func TestGetRow_InvalidRowKey(t *testing.T) {
 }
 
 func TestGetRow_Empty(t *testing.T) {
-	store := newMockCellStore()
+	store := memory.New()
 	server := setupTestServer(store, 64)
 
 	rowKey := uuid.New()
@@ -439,9 +946,7 @@ func TestGetRow_Empty(t *testing.T) {
 }
 
 func TestGetRow_StoreError(t *testing.T) {
-	store := newMockCellStore()
-	store.rowErr = errors.New("db error")
-	server := setupTestServer(store, 64)
+	server := setupTestServer(failOn(memory.New(), fault.OpRead), 64)
 
 	rowKey := uuid.New()
 	req := httptest.NewRequest(http.MethodGet, "/v1/cells/"+rowKey.String(), nil)
@@ -454,11 +959,271 @@ func TestGetRow_StoreError(t *testing.T) {
 	}
 }
 
+// --- GetRows Tests ---
+
+// rowsCallCounter counts GetRows calls, to check there is one per shard.
+type rowsCallCounter struct {
+	*memory.Store
+	calls atomic.Int32
+}
+
+func (c *rowsCallCounter) GetRows(ctx context.Context, rowKeys []uuid.UUID) (map[uuid.UUID][]cell.Cell, error) {
+	c.calls.Add(1)
+	return c.Store.GetRows(ctx, rowKeys)
+}
+
+func postBatchGet(t *testing.T, server http.Handler, rowKeys []uuid.UUID) *httptest.ResponseRecorder {
+	t.Helper()
+	data, _ := json.Marshal(map[string]any{"row_keys": rowKeys})
+	req := httptest.NewRequest(http.MethodPost, "/v1/rows:batchGet", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	return w
+}
+
+func TestGetRows_AcrossShards(t *testing.T) {
+	store := &rowsCallCounter{Store: memory.New()}
+	server := setupTestServer(store, 4)
+
+	var keys []uuid.UUID
+	shards := make(map[shard.ID]bool)
+	for i := 0; i < 20; i++ {
+		k := uuid.New()
+		keys = append(keys, k)
+		shards[defaultShard(k, 4)] = true
+		if i%4 != 3 {
+			seedCells(t, store.Store, cell.Cell{RowKey: k, ColumnName: "profile", RefKey: 1, Body: json.RawMessage(`{}`), CreatedAt: time.Now()})
+		}
+	}
+	missing := []uuid.UUID{keys[3], keys[7]}
+	keys = append(keys, keys[0]) // duplicates are fetched once
+
+	w := postBatchGet(t, server, keys)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want %d\nbody: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp GetRowsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Rows) != 15 {
+		t.Errorf("rows: got %d, want 15", len(resp.Rows))
+	}
+	if cells := resp.Rows[keys[1].String()]; len(cells) != 1 || cells[0].AddedID != 2 {
+		t.Errorf("row %s: got %+v", keys[1], cells)
+	}
+	if len(resp.Missing) != 5 || resp.Missing[0] != missing[0] || resp.Missing[1] != missing[1] {
+		t.Errorf("missing: got %v, want 5 starting with %v", resp.Missing, missing)
+	}
+	if got := int(store.calls.Load()); got != len(shards) {
+		t.Errorf("GetRows calls: got %d, want one per shard (%d)", got, len(shards))
+	}
+}
+
+func TestGetRows_Empty(t *testing.T) {
+	server := setupTestServer(memory.New(), 64)
+	if w := postBatchGet(t, server, []uuid.UUID{}); w.Code < 400 || w.Code >= 500 {
+		t.Errorf("status: got %d, want 4xx", w.Code)
+	}
+}
+
+func TestGetRows_StoreError(t *testing.T) {
+	server := setupTestServer(failOn(memory.New(), fault.OpRead), 64)
+
+	if w := postBatchGet(t, server, []uuid.UUID{uuid.New()}); w.Code != http.StatusInternalServerError {
+		t.Errorf("status: got %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
+
+// --- WindowRead Tests ---
+
+func getWindow(t *testing.T, server http.Handler, query url.Values) []CellResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/v1/cells/windowRead?"+query.Encode(), nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want %d\nbody: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var cells []CellResponse
+	if err := json.NewDecoder(w.Body).Decode(&cells); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return cells
+}
+
+func TestWindowRead_Pages(t *testing.T) {
+	store := memory.New()
+	server := setupTestServer(store, 1)
+
+	base := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	// Two cells share a timestamp, so paging must resume within it.
+	for i, at := range []time.Duration{-time.Hour, 0, time.Minute, time.Minute, 2 * time.Minute, time.Hour} {
+		c := &cell.Cell{AddedID: int64(i + 1), RowKey: uuid.New(), ColumnName: "orders", RefKey: 1, Body: json.RawMessage(`{}`), CreatedAt: base.Add(at)}
+		seedCells(t, store, *c)
+	}
+	other := &cell.Cell{AddedID: 7, RowKey: uuid.New(), ColumnName: "profile", RefKey: 1, Body: json.RawMessage(`{}`), CreatedAt: base}
+	seedCells(t, store, *other)
+
+	q := url.Values{
+		"partition_number": {"0"},
+		"column_name":      {"orders"},
+		"from":             {base.Format(time.RFC3339Nano)},
+		"to":               {base.Add(time.Hour).Format(time.RFC3339Nano)},
+		"limit":            {"2"},
+	}
+	var got []int64
+	for page := 0; page < 5; page++ {
+		cells := getWindow(t, server, q)
+		if len(cells) == 0 {
+			break
+		}
+		for _, c := range cells {
+			got = append(got, c.AddedID)
+		}
+		last := cells[len(cells)-1]
+		q.Set("from", last.CreatedAt.Format(time.RFC3339Nano))
+		q.Set("after_added_id", strconv.FormatInt(last.AddedID, 10))
+	}
+	if want := []int64{2, 3, 4, 5}; !slices.Equal(got, want) {
+		t.Errorf("added_ids = %v, want %v", got, want)
+	}
+}
+
+func TestWindowRead_NextLink(t *testing.T) {
+	store := memory.New()
+	server := setupTestServer(store, 1)
+
+	base := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i, at := range []time.Duration{0, time.Minute, time.Minute, 2 * time.Minute} {
+		c := &cell.Cell{AddedID: int64(i + 1), RowKey: uuid.New(), ColumnName: "orders", RefKey: 1, Body: json.RawMessage(`{}`), CreatedAt: base.Add(at)}
+		seedCells(t, store, *c)
+	}
+
+	q := url.Values{
+		"partition_number": {"0"},
+		"column_name":      {"orders"},
+		"from":             {base.Format(time.RFC3339Nano)},
+		"to":               {base.Add(time.Hour).Format(time.RFC3339Nano)},
+		"limit":            {"2"},
+	}
+	// The last page is full too, so an empty page ends the walk.
+	pages := followLinks(t, server, "/v1/cells/windowRead?"+q.Encode())
+	if got, want := fmt.Sprint(pages), "[[1 2] [3 4] []]"; got != want {
+		t.Errorf("pages = %s, want %s", got, want)
+	}
+}
+
+func TestWindowRead_InvalidWindow(t *testing.T) {
+	server := setupTestServer(memory.New(), 1)
+	now := time.Now().UTC()
+
+	q := url.Values{
+		"partition_number": {"0"},
+		"column_name":      {"orders"},
+		"from":             {now.Format(time.RFC3339Nano)},
+		"to":               {now.Format(time.RFC3339Nano)},
+	}
+	req := httptest.NewRequest(http.MethodGet, "/v1/cells/windowRead?"+q.Encode(), nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status: got %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+// --- HEAD Tests ---
+
+func TestHeadCellLatest(t *testing.T) {
+	store := memory.New()
+	rowKey := uuid.New()
+	created := time.Date(2026, 2, 6, 12, 0, 0, 0, time.UTC)
+	seedCells(t, store, cell.Cell{
+		AddedID: 1, RowKey: rowKey, ColumnName: "profile", RefKey: 1, Body: json.RawMessage(`{}`), CreatedAt: created.Add(-time.Hour),
+	})
+	seedCells(t, store, cell.Cell{
+		AddedID: 2, RowKey: rowKey, ColumnName: "profile", RefKey: 4, Body: json.RawMessage(`{"big":true}`), CreatedAt: created,
+	})
+	server := setupTestServer(store, 64)
+
+	req := httptest.NewRequest(http.MethodHead, "/v1/cells/"+rowKey.String()+"/profile", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := w.Header().Get("X-Ref-Key"); got != "4" {
+		t.Errorf("X-Ref-Key: got %q, want 4", got)
+	}
+	if got := w.Header().Get("X-Added-Id"); got != "2" {
+		t.Errorf("X-Added-Id: got %q, want 2", got)
+	}
+	if got := w.Header().Get("Last-Modified"); got != created.Format(http.TimeFormat) {
+		t.Errorf("Last-Modified: got %q", got)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("body: got %q, want none", w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodHead, "/v1/cells/"+rowKey.String()+"/missing", nil)
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("missing column: got %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestHeadRow(t *testing.T) {
+	store := memory.New()
+	rowKey := uuid.New()
+	created := time.Date(2026, 2, 6, 12, 0, 0, 0, time.UTC)
+	seedCells(t, store,
+		cell.Cell{AddedID: 1, RowKey: rowKey, ColumnName: "profile", RefKey: 1, Body: json.RawMessage(`{}`), CreatedAt: created},
+		cell.Cell{AddedID: 2, RowKey: rowKey, ColumnName: "settings", RefKey: 1, Body: json.RawMessage(`{}`), CreatedAt: created.Add(-time.Minute)},
+	)
+	server := setupTestServer(store, 64)
+
+	req := httptest.NewRequest(http.MethodHead, "/v1/cells/"+rowKey.String(), nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := w.Header().Get("X-Column-Count"); got != "2" {
+		t.Errorf("X-Column-Count: got %q, want 2", got)
+	}
+	if got := w.Header().Get("Last-Modified"); got != created.Format(http.TimeFormat) {
+		t.Errorf("Last-Modified: got %q", got)
+	}
+
+	req = httptest.NewRequest(http.MethodHead, "/v1/cells/"+uuid.NewString(), nil)
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("missing row: got %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestHeadRow_StoreError(t *testing.T) {
+	server := setupTestServer(failOn(memory.New(), fault.OpRead), 64)
+
+	req := httptest.NewRequest(http.MethodHead, "/v1/cells/"+uuid.NewString(), nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status: got %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
+
 // --- Shard Routing Error Tests ---
 
 func TestWriteCell_ShardRoutingError(t *testing.T) {
 	// No stores registered
-	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil)
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil, ServerOptions{})
 
 	body := map[string]any{
 		"row_key":     uuid.New().String(),
@@ -480,7 +1245,7 @@ func TestWriteCell_ShardRoutingError(t *testing.T) {
 }
 
 func TestGetCell_ShardRoutingError(t *testing.T) {
-	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil)
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil, ServerOptions{})
 
 	rowKey := uuid.New()
 	req := httptest.NewRequest(http.MethodGet, "/v1/cells/"+rowKey.String()+"/profile/1", nil)
@@ -497,7 +1262,7 @@ func TestGetCell_ShardRoutingError(t *testing.T) {
 
 func TestNewCellHandler(t *testing.T) {
 	router := shard.NewRouter()
-	h := NewCellHandler(router, 64, index.NewRegistry(), nil, testLogger())
+	h := NewCellHandler(router, 64, index.NewRegistry(), nil, ServerOptions{Limits: DefaultLimits()}, testLogger())
 	if h == nil {
 		t.Fatal("NewCellHandler returned nil")
 	}
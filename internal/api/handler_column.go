@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/ryanbastic/go-mezzanine/internal/column"
+)
+
+// --- Huma Input/Output types ---
+
+type ColumnStatsResponse struct {
+	Writes        int64     `json:"writes" doc:"Cells written to the column since it was registered" example:"1024"`
+	Bytes         int64     `json:"bytes" doc:"Size of the bodies written, as clients sent them" example:"524288"`
+	LastWrittenAt time.Time `json:"last_written_at" doc:"Time of the most recent write; zero if never written" example:"2026-02-06T12:00:00Z"`
+}
+
+type ColumnUsageResponse struct {
+	Cells     int64     `json:"cells" doc:"Cells the column holds, every version of every row" example:"1010"`
+	Bytes     int64     `json:"bytes" doc:"Size of the bodies of those cells" example:"517120"`
+	CountedAt time.Time `json:"counted_at" doc:"When the shard tables were last counted; since then, writes are added but deletes and garbage collection are not subtracted. Zero if never counted" example:"2026-02-06T00:00:00Z"`
+}
+
+type ColumnResponse struct {
+	Name         string              `json:"name" doc:"Column name" example:"profile"`
+	Owner        string              `json:"owner" doc:"Owning team or service" example:"accounts"`
+	Description  string              `json:"description" doc:"What the column's cells hold" example:"User profile, one version per edit"`
+	SchemaRef    string              `json:"schema_ref" doc:"Reference to the schema of the column's cell bodies" example:"https://schemas.example.com/profile.json"`
+	KeepVersions int                 `json:"keep_versions" doc:"Versions of each row's cell kept by garbage collection once superseded; 0 keeps every version" example:"3"`
+	Stats        ColumnStatsResponse `json:"stats" doc:"Write statistics, summed across instances"`
+	Usage        ColumnUsageResponse `json:"usage" doc:"Storage the column uses"`
+	CreatedAt    time.Time           `json:"created_at" doc:"When the column was registered" example:"2026-02-06T12:00:00Z"`
+	UpdatedAt    time.Time           `json:"updated_at" doc:"When the column's metadata last changed" example:"2026-02-06T12:00:00Z"`
+}
+
+type ListColumnsInput struct{}
+
+type ListColumnsOutput struct {
+	Body []ColumnResponse
+}
+
+type GetColumnInput struct {
+	ColumnName string `path:"column_name" doc:"Column name"`
+}
+
+type GetColumnOutput struct {
+	Body ColumnResponse
+}
+
+// --- Handler ---
+
+type ColumnHandler struct {
+	registry *column.Registry
+}
+
+func NewColumnHandler(registry *column.Registry) *ColumnHandler {
+	return &ColumnHandler{registry: registry}
+}
+
+func registerColumnRoutes(api huma.API, h *ColumnHandler) {
+	huma.Register(api, huma.Operation{
+		OperationID: "list-columns",
+		Method:      http.MethodGet,
+		Path:        "/v1/columns",
+		Summary:     "List columns",
+		Description: "Lists every column that has been written to or registered by an operator, sorted by name. Columns written by other instances appear after their next statistics flush.",
+		Tags:        []string{"columns"},
+		Errors:      []int{http.StatusServiceUnavailable},
+	}, h.ListColumns)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-column",
+		Method:      http.MethodGet,
+		Path:        "/v1/columns/{column_name}",
+		Summary:     "Get a column",
+		Description: "Fetches the metadata, write statistics and storage usage of one column.",
+		Tags:        []string{"columns"},
+		Errors:      []int{http.StatusNotFound, http.StatusServiceUnavailable},
+	}, h.GetColumn)
+}
+
+func (h *ColumnHandler) ListColumns(ctx context.Context, input *ListColumnsInput) (*ListColumnsOutput, error) {
+	columns := h.registry.List()
+	resp := make([]ColumnResponse, len(columns))
+	for i, c := range columns {
+		resp[i] = columnToResponse(c)
+	}
+	return &ListColumnsOutput{Body: resp}, nil
+}
+
+func (h *ColumnHandler) GetColumn(ctx context.Context, input *GetColumnInput) (*GetColumnOutput, error) {
+	c, ok := h.registry.Get(input.ColumnName)
+	if !ok {
+		return nil, huma.Error404NotFound("column not found")
+	}
+	return &GetColumnOutput{Body: columnToResponse(c)}, nil
+}
+
+func columnToResponse(c column.Column) ColumnResponse {
+	return ColumnResponse{
+		Name:         c.Name,
+		Owner:        c.Owner,
+		Description:  c.Description,
+		SchemaRef:    c.SchemaRef,
+		KeepVersions: c.KeepVersions,
+		Stats:        ColumnStatsResponse{Writes: c.Stats.Writes, Bytes: c.Stats.Bytes, LastWrittenAt: c.Stats.LastWrittenAt},
+		Usage:        ColumnUsageResponse{Cells: c.Usage.Cells, Bytes: c.Usage.Bytes, CountedAt: c.Usage.CountedAt},
+		CreatedAt:    c.CreatedAt,
+		UpdatedAt:    c.UpdatedAt,
+	}
+}
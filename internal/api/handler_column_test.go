@@ -0,0 +1,86 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/column"
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+)
+
+func setupColumnTestServer(columns *column.Registry) http.Handler {
+	store := memory.New()
+	r := shard.NewRouter()
+	for i := range 64 {
+		r.Register(shard.ID(i), store)
+	}
+	return NewServer(testLogger(), r, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil, ServerOptions{Columns: columns})
+}
+
+func TestListColumns_RegisteredOnWrite(t *testing.T) {
+	columns := column.NewRegistry()
+	server := setupColumnTestServer(columns)
+
+	for _, col := range []string{"profile", "profile", "orders"} {
+		w := postCell(t, server, map[string]any{"row_key": uuid.New().String(), "column_name": col, "ref_key": 1, "body": map[string]any{}}, "")
+		if w.Code != http.StatusCreated {
+			t.Fatalf("write: status %d, body %s", w.Code, w.Body.String())
+		}
+	}
+	if _, err := columns.Update(context.Background(), "profile", column.Metadata{Owner: "accounts"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/columns", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d\nbody: %s", w.Code, w.Body.String())
+	}
+	var resp []ColumnResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp) != 2 || resp[0].Name != "orders" || resp[1].Name != "profile" {
+		t.Fatalf("got %+v", resp)
+	}
+	if resp[1].Owner != "accounts" || resp[1].Stats.Writes != 2 || resp[1].Stats.LastWrittenAt.IsZero() {
+		t.Errorf("profile: got %+v", resp[1])
+	}
+}
+
+func TestGetColumn(t *testing.T) {
+	columns := column.NewRegistry()
+	if _, err := columns.Update(context.Background(), "billing", column.Metadata{Owner: "payments", SchemaRef: "schemas/billing.json"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	server := setupColumnTestServer(columns)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/columns/billing", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d\nbody: %s", w.Code, w.Body.String())
+	}
+	var resp ColumnResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Owner != "payments" || resp.SchemaRef != "schemas/billing.json" || resp.Stats.Writes != 0 {
+		t.Errorf("got %+v", resp)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/columns/nope", nil)
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown column: got %d, want 404", w.Code)
+	}
+}
@@ -26,7 +26,7 @@ func (m *mockPinger) Ping(_ context.Context) error {
 // --- Livez ---
 
 func TestLivez_ReturnsOK(t *testing.T) {
-	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil)
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil, ServerOptions{})
 
 	req := httptest.NewRequest(http.MethodGet, "/v1/livez", nil)
 	w := httptest.NewRecorder()
@@ -48,7 +48,7 @@ func TestLivez_ReturnsOK(t *testing.T) {
 // --- Readyz ---
 
 func TestReadyz_NoBackends_ReturnsOK(t *testing.T) {
-	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil)
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil, ServerOptions{})
 
 	req := httptest.NewRequest(http.MethodGet, "/v1/readyz", nil)
 	w := httptest.NewRecorder()
@@ -64,7 +64,7 @@ func TestReadyz_AllHealthy(t *testing.T) {
 		"pg1": &mockPinger{},
 		"pg2": &mockPinger{},
 	}
-	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, backends)
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, backends, ServerOptions{})
 
 	req := httptest.NewRequest(http.MethodGet, "/v1/readyz", nil)
 	w := httptest.NewRecorder()
@@ -96,7 +96,7 @@ func TestReadyz_OneBackendDown(t *testing.T) {
 		"pg1": &mockPinger{},
 		"pg2": &mockPinger{err: errors.New("connection refused")},
 	}
-	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, backends)
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, backends, ServerOptions{})
 
 	req := httptest.NewRequest(http.MethodGet, "/v1/readyz", nil)
 	w := httptest.NewRecorder()
@@ -130,7 +130,7 @@ func TestHealth_BackwardsCompat_BehavesAsReadyz(t *testing.T) {
 	backends := map[string]Pinger{
 		"pg1": &mockPinger{},
 	}
-	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, backends)
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, backends, ServerOptions{})
 
 	req := httptest.NewRequest(http.MethodGet, "/v1/health", nil)
 	w := httptest.NewRecorder()
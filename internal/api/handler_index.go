@@ -5,6 +5,9 @@ import (
 	"encoding/json"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/danielgtaylor/huma/v2"
@@ -16,32 +19,65 @@ import (
 // --- Huma Input/Output types ---
 
 type QueryIndexInput struct {
-	IndexName string `path:"index_name" doc:"Secondary index name"`
-	Value     string `path:"value" doc:"Lookup value (e.g. email address)" minLength:"1"`
+	IndexName    string   `path:"index_name" doc:"Secondary index name"`
+	Value        string   `path:"value" doc:"Lookup value (e.g. email address)" minLength:"1"`
+	Filter       []string `query:"filter,explode" maxItems:"16" doc:"Filter on a denormalized body field as field:op:value, where op is eq, ne or in (comma-separated values); repeat to combine with AND"`
+	AfterAddedID int64    `query:"after_added_id" doc:"Return entries after this added_id; pass the last entry's added_id for the next page"`
+	Limit        int      `query:"limit" doc:"Maximum number of entries to return"`
+	Mask         []string `query:"mask" doc:"Body fields to remove from the response, comma-separated; nested fields use dots"`
 }
 
 type IndexEntryResponse struct {
-	AddedID   int64           `json:"added_id" doc:"Auto-incremented ID"`
-	ShardKey  string          `json:"shard_key" doc:"Shard key value"`
-	RowKey    uuid.UUID       `json:"row_key" doc:"Row key UUID"`
-	Body      json.RawMessage `json:"body" doc:"Denormalized JSON payload"`
-	CreatedAt time.Time       `json:"created_at" doc:"Creation timestamp"`
+	AddedID   int64           `json:"added_id" doc:"Auto-incremented ID" example:"7"`
+	ShardKey  string          `json:"shard_key" doc:"Shard key value" example:"alice@example.com"`
+	RowKey    uuid.UUID       `json:"row_key" doc:"Row key UUID" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Body      json.RawMessage `json:"body" doc:"Denormalized JSON payload" example:"{\"email\":\"alice@example.com\"}"`
+	CreatedAt time.Time       `json:"created_at" doc:"Creation timestamp" example:"2026-02-06T12:00:00Z"`
 }
 
 type QueryIndexOutput struct {
+	Link string `header:"Link" doc:"URL of the next page with rel=\"next\"; set when the page is full"`
 	Body []IndexEntryResponse
 }
 
+type CountIndexInput struct {
+	IndexName string   `path:"index_name" doc:"Secondary index name"`
+	Value     string   `path:"value" doc:"Lookup value (e.g. email address)" minLength:"1"`
+	Filter    []string `query:"filter,explode" maxItems:"16" doc:"Filter on a denormalized body field as field:op:value, where op is eq, ne or in (comma-separated values); repeat to combine with AND"`
+}
+
+type CountIndexTotalInput struct {
+	IndexName string   `path:"index_name" doc:"Secondary index name"`
+	Filter    []string `query:"filter,explode" maxItems:"16" doc:"Filter on a denormalized body field as field:op:value, where op is eq, ne or in (comma-separated values); repeat to combine with AND"`
+	Partial   bool     `query:"partial" doc:"When the index has more shards than the server's query budget allows, count the first shards within it instead of failing with 422; when some shards fail, answer with 207, listing them under shard_errors, instead of failing the request"`
+}
+
+type IndexCountResponse struct {
+	Count       int64        `json:"count" doc:"Number of matching index entries" example:"12"`
+	Partial     bool         `json:"partial,omitempty" doc:"Set when only some of the index's shards were counted, with partial=true" example:"false"`
+	Shards      int          `json:"shards,omitempty" doc:"Number of shards counted, when partial" example:"16"`
+	ShardErrors []ShardError `json:"shard_errors,omitempty" doc:"Shards that failed to count, making the response 207; only with partial=true"`
+}
+
+type CountIndexOutput struct {
+	Status int
+	Body   IndexCountResponse
+}
+
 // --- Handler ---
 
 type IndexHandler struct {
-	registry  *index.Registry
-	numShards int
-	logger    *slog.Logger
+	registry   *index.Registry
+	numShards  int
+	limits     Limits
+	maskSecret []byte
+	scatter    ScatterLimits
+	acl        rowACL
+	logger     *slog.Logger
 }
 
-func NewIndexHandler(registry *index.Registry, numShards int, logger *slog.Logger) *IndexHandler {
-	return &IndexHandler{registry: registry, numShards: numShards, logger: logger}
+func NewIndexHandler(registry *index.Registry, numShards int, opts ServerOptions, logger *slog.Logger) *IndexHandler {
+	return &IndexHandler{registry: registry, numShards: numShards, limits: opts.Limits, maskSecret: opts.MaskHashSecret, scatter: opts.Scatter, acl: rowACL{mode: opts.RowACL, logger: logger}, logger: logger}
 }
 
 func registerIndexRoutes(api huma.API, h *IndexHandler) {
@@ -50,34 +86,183 @@ func registerIndexRoutes(api huma.API, h *IndexHandler) {
 		Method:      http.MethodGet,
 		Path:        "/v1/index/{index_name}/{value}",
 		Summary:     "Query secondary index",
+		Description: "Pages through the entries of a secondary index for one shard key, optionally filtered on denormalized fields.",
 		Tags:        []string{"index"},
+		Errors:      []int{http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
 	}, h.QueryIndex)
+	documentLimit(api, "/v1/index/{index_name}/{value}", h.limits.IndexQuery)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "count-index",
+		Method:      http.MethodGet,
+		Path:        "/v1/index/{index_name}/{value}/count",
+		Summary:     "Count secondary index entries for a value",
+		Description: "Counts the entries of a secondary index for one shard key, optionally filtered on denormalized fields.",
+		Tags:        []string{"index"},
+		Errors:      []int{http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	}, h.CountIndex)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "count-index-total",
+		Method:      http.MethodGet,
+		Path:        "/v1/index/{index_name}:count",
+		Summary:     "Count secondary index entries across all shards",
+		Description: "Counts the entries of a secondary index on every shard, optionally filtered on denormalized fields.",
+		Tags:        []string{"index"},
+		Errors:      []int{http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	}, h.CountIndexTotal)
+
+	registerIndexAggregateRoute(api, h)
+}
+
+// parseFilters parses the filter query parameters of an index request and
+// checks them against the index definition, when one is registered.
+func (h *IndexHandler) parseFilters(indexName string, raw []string) ([]index.Filter, error) {
+	filters := make([]index.Filter, 0, len(raw))
+	for _, r := range raw {
+		f, err := index.ParseFilter(r)
+		if err != nil {
+			return nil, huma.Error400BadRequest(err.Error())
+		}
+		filters = append(filters, f)
+	}
+	if def, ok := h.registry.GetDefinition(indexName); ok {
+		if err := def.CheckFilters(filters); err != nil {
+			return nil, huma.Error400BadRequest(err.Error())
+		}
+	}
+	return filters, nil
 }
 
 func (h *IndexHandler) QueryIndex(ctx context.Context, input *QueryIndexInput) (*QueryIndexOutput, error) {
-	shardID := shard.ForKey(input.Value, h.numShards)
+	if err := h.acl.scan(ctx, "index_query"); err != nil {
+		return nil, err
+	}
+	shardID := h.registry.ForKey(input.Value, h.numShards)
 	store, ok := h.registry.StoreFor(input.IndexName, shardID)
 	if !ok {
 		return nil, huma.Error404NotFound("index not found")
 	}
 
-	entries, err := store.QueryByShardKey(ctx, input.Value)
+	filters, err := h.parseFilters(input.IndexName, input.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := index.Page{AfterAddedID: input.AfterAddedID, Limit: h.limits.IndexQuery.Apply(input.Limit)}
+	entries, err := store.QueryByShardKey(ctx, input.Value, page, filters...)
 	if err != nil {
 		h.logger.Error("failed to query index", "index_name", input.IndexName, "value", input.Value, "error", err)
-		return nil, huma.Error500InternalServerError("failed to query index")
+		return nil, failed(ctx, err, "failed to query index")
 	}
 
+	mask := readMask(ctx, input.Mask, h.maskSecret)
 	resp := make([]IndexEntryResponse, len(entries))
 	for i, e := range entries {
 		resp[i] = IndexEntryResponse{
 			AddedID:   e.AddedID,
 			ShardKey:  e.ShardKey,
 			RowKey:    e.RowKey,
-			Body:      e.Body,
+			Body:      mask.Apply(e.Body),
 			CreatedAt: e.CreatedAt,
 		}
 	}
 
-	return &QueryIndexOutput{Body: resp}, nil
+	out := &QueryIndexOutput{Body: resp}
+	if len(entries) == page.Limit {
+		path := "/v1/index/" + url.PathEscape(input.IndexName) + "/" + url.PathEscape(input.Value)
+		out.Link = nextLink(path, url.Values{
+			"filter":         input.Filter,
+			"after_added_id": {strconv.FormatInt(entries[len(entries)-1].AddedID, 10)},
+			"limit":          {strconv.Itoa(page.Limit)},
+		}, input.Mask)
+	}
+	return out, nil
+}
+
+func (h *IndexHandler) CountIndex(ctx context.Context, input *CountIndexInput) (*CountIndexOutput, error) {
+	if err := h.acl.scan(ctx, "index_count"); err != nil {
+		return nil, err
+	}
+	shardID := h.registry.ForKey(input.Value, h.numShards)
+	store, ok := h.registry.StoreFor(input.IndexName, shardID)
+	if !ok {
+		return nil, huma.Error404NotFound("index not found")
+	}
+	filters, err := h.parseFilters(input.IndexName, input.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := store.CountByShardKey(ctx, input.Value, filters...)
+	if err != nil {
+		h.logger.Error("failed to count index", "index_name", input.IndexName, "value", input.Value, "error", err)
+		return nil, failed(ctx, err, "failed to count index")
+	}
+	return &CountIndexOutput{Status: http.StatusOK, Body: IndexCountResponse{Count: n}}, nil
 }
 
+// CountIndexTotal counts matching entries on every shard of the index
+// concurrently, within the server's ScatterLimits, and sums them.
+func (h *IndexHandler) CountIndexTotal(ctx context.Context, input *CountIndexTotalInput) (*CountIndexOutput, error) {
+	if err := h.acl.scan(ctx, "index_count"); err != nil {
+		return nil, err
+	}
+	stores := make([]index.IndexStore, 0, h.numShards)
+	var ids []shard.ID
+	for i := range h.numShards {
+		store, ok := h.registry.StoreFor(input.IndexName, shard.ID(i))
+		if !ok {
+			continue
+		}
+		stores = append(stores, store)
+		ids = append(ids, shard.ID(i))
+	}
+	if len(stores) == 0 {
+		return nil, huma.Error404NotFound("index not found")
+	}
+	filters, err := h.parseFilters(input.IndexName, input.Filter)
+	if err != nil {
+		return nil, err
+	}
+	budget, ctx := newScatterBudget(ctx, h.scatter, "index_count", input.Partial)
+	defer budget.done()
+	n, err := budget.shards(len(stores))
+	if err != nil {
+		return nil, err
+	}
+	partial := n < len(stores)
+	stores = stores[:n]
+
+	counts := make([]int64, len(stores))
+	errs := make([]error, len(stores))
+	var wg sync.WaitGroup
+	for i, store := range stores {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			counts[i], errs[i] = store.Count(ctx, filters...)
+		}()
+	}
+	wg.Wait()
+
+	var total int64
+	var shardErrs []ShardError
+	for i, n := range counts {
+		if errs[i] != nil {
+			h.logger.Error("failed to count index", "index_name", input.IndexName, "shard_id", ids[i], "error", errs[i])
+			e, err := budget.shardFailed(ctx, ids[i], errs[i], "failed to count index")
+			if err != nil || len(shardErrs)+1 == len(stores) {
+				return nil, failed(ctx, errs[i], "failed to count index")
+			}
+			shardErrs = append(shardErrs, e)
+			continue
+		}
+		total += n
+	}
+	resp := IndexCountResponse{Count: total, ShardErrors: shardErrs}
+	if partial || len(shardErrs) > 0 {
+		resp.Partial, resp.Shards = true, len(stores)-len(shardErrs)
+	}
+	return &CountIndexOutput{Status: multiStatus(shardErrs), Body: resp}, nil
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+)
+
+// maxAggregateGroups bounds the groups of an index aggregation, merged
+// across shards.
+const maxAggregateGroups = 1000
+
+type AggregateIndexInput struct {
+	IndexName string   `path:"index_name" doc:"Secondary index name"`
+	GroupBy   []string `query:"group_by,explode" maxItems:"4" doc:"Denormalized field to group entries by, compared as text; repeat to group by several. Without one, all entries form one group"`
+	Metric    []string `query:"metric,explode" maxItems:"16" doc:"Metric to compute per group as func:field, where func is count (entries with the field), or sum, min or max of a field declared a number in the index's field_types; repeat for several"`
+	Filter    []string `query:"filter,explode" maxItems:"16" doc:"Filter on a denormalized body field as field:op:value, where op is eq, ne or in (comma-separated values); repeat to combine with AND"`
+	Partial   bool     `query:"partial" doc:"When the index has more shards than the server's query budget allows, aggregate the first shards within it instead of failing with 422; when some shards fail, answer with 207, listing them under shard_errors, instead of failing the request"`
+}
+
+type IndexGroupResponse struct {
+	Key     map[string]*string  `json:"key,omitempty" doc:"Value of each group_by field, as text; null where entries lack the field" example:"{\"status\":\"open\"}"`
+	Count   int64               `json:"count" doc:"Number of entries in the group" example:"12"`
+	Metrics map[string]*float64 `json:"metrics,omitempty" doc:"Value of each requested metric, keyed as requested; null when no entry has a number for it" example:"{\"sum:total\":420.5}"`
+}
+
+type IndexAggregateResponse struct {
+	Groups      []IndexGroupResponse `json:"groups" doc:"Groups, largest first"`
+	Partial     bool                 `json:"partial,omitempty" doc:"Set when only some of the index's shards were aggregated, with partial=true" example:"false"`
+	Shards      int                  `json:"shards,omitempty" doc:"Number of shards aggregated, when partial" example:"16"`
+	ShardErrors []ShardError         `json:"shard_errors,omitempty" doc:"Shards that failed to aggregate, making the response 207; only with partial=true"`
+}
+
+type AggregateIndexOutput struct {
+	Status int
+	Body   IndexAggregateResponse
+}
+
+func registerIndexAggregateRoute(api huma.API, h *IndexHandler) {
+	huma.Register(api, huma.Operation{
+		OperationID: "aggregate-index",
+		Method:      http.MethodGet,
+		Path:        "/v1/index/{index_name}:aggregate",
+		Summary:     "Aggregate secondary index entries across all shards",
+		Description: fmt.Sprintf("Groups the entries of a secondary index by denormalized fields and computes counts, sums, minimums and maximums per group, on every shard concurrently, merging the results. Entries may be filtered like a query. At most %d groups are returned; more fail with 422.", maxAggregateGroups),
+		Tags:        []string{"index"},
+		Errors:      []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusUnprocessableEntity, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	}, h.AggregateIndex)
+}
+
+// parseAggregation parses the group_by and metric parameters of an
+// aggregation and checks them against the index definition and the
+// request's masking policy: masked fields cannot be grouped or measured.
+func (h *IndexHandler) parseAggregation(ctx context.Context, def index.Definition, input *AggregateIndexInput) (index.Aggregation, error) {
+	agg := index.Aggregation{GroupBy: input.GroupBy, MaxGroups: maxAggregateGroups}
+	for _, raw := range input.Metric {
+		m, err := index.ParseMetric(raw)
+		if err != nil {
+			return agg, huma.Error400BadRequest(err.Error())
+		}
+		agg.Metrics = append(agg.Metrics, m)
+	}
+	if err := def.CheckAggregation(agg); err != nil {
+		return agg, huma.Error400BadRequest(err.Error())
+	}
+	mask := readMask(ctx, nil, h.maskSecret)
+	fields := slices.Clone(agg.GroupBy)
+	for _, m := range agg.Metrics {
+		fields = append(fields, m.Field)
+	}
+	for _, f := range fields {
+		if mask.covers(f) {
+			return agg, huma.Error403Forbidden(fmt.Sprintf("field %q is masked for this API key", f))
+		}
+	}
+	return agg, nil
+}
+
+// AggregateIndex aggregates matching entries on every shard of the index
+// concurrently, within the server's ScatterLimits, and merges the groups.
+func (h *IndexHandler) AggregateIndex(ctx context.Context, input *AggregateIndexInput) (*AggregateIndexOutput, error) {
+	if err := h.acl.scan(ctx, "index_aggregate"); err != nil {
+		return nil, err
+	}
+	def, ok := h.registry.GetDefinition(input.IndexName)
+	if !ok {
+		return nil, huma.Error404NotFound("index not found")
+	}
+	stores := make([]index.IndexStore, 0, h.numShards)
+	var ids []shard.ID
+	for i := range h.numShards {
+		if store, ok := h.registry.StoreFor(input.IndexName, shard.ID(i)); ok {
+			stores = append(stores, store)
+			ids = append(ids, shard.ID(i))
+		}
+	}
+	agg, err := h.parseAggregation(ctx, def, input)
+	if err != nil {
+		return nil, err
+	}
+	filters, err := h.parseFilters(input.IndexName, input.Filter)
+	if err != nil {
+		return nil, err
+	}
+	budget, ctx := newScatterBudget(ctx, h.scatter, "index_aggregate", input.Partial)
+	defer budget.done()
+	n, err := budget.shards(len(stores))
+	if err != nil {
+		return nil, err
+	}
+	partial := n < len(stores)
+	stores = stores[:n]
+
+	results := make([][]index.Group, len(stores))
+	errs := make([]error, len(stores))
+	var wg sync.WaitGroup
+	for i, store := range stores {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = index.Aggregate(ctx, store, agg, filters...)
+		}()
+	}
+	wg.Wait()
+
+	var shardErrs []ShardError
+	for i := range stores {
+		if errs[i] == nil {
+			continue
+		}
+		if errors.Is(errs[i], index.ErrAggregateUnsupported) {
+			return nil, huma.Error400BadRequest("the index store does not support aggregation")
+		}
+		h.logger.Error("failed to aggregate index", "index_name", input.IndexName, "shard_id", ids[i], "error", errs[i])
+		e, err := budget.shardFailed(ctx, ids[i], errs[i], "failed to aggregate index")
+		if err != nil || len(shardErrs)+1 == len(stores) {
+			return nil, failed(ctx, errs[i], "failed to aggregate index")
+		}
+		shardErrs = append(shardErrs, e)
+	}
+	groups := index.MergeGroups(agg, results...)
+	if len(groups) > maxAggregateGroups {
+		return nil, huma.Error422UnprocessableEntity(fmt.Sprintf("aggregation has more than %d groups; filter the entries or group by fewer fields", maxAggregateGroups))
+	}
+
+	resp := IndexAggregateResponse{Groups: aggregateToResponse(agg, groups), ShardErrors: shardErrs}
+	if partial || len(shardErrs) > 0 {
+		resp.Partial, resp.Shards = true, len(stores)-len(shardErrs)
+	}
+	return &AggregateIndexOutput{Status: multiStatus(shardErrs), Body: resp}, nil
+}
+
+// aggregateToResponse renders groups largest first, ties broken by key.
+func aggregateToResponse(agg index.Aggregation, groups []index.Group) []IndexGroupResponse {
+	slices.SortFunc(groups, func(a, b index.Group) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		for i := range a.Key {
+			switch {
+			case a.Key[i] == nil && b.Key[i] == nil:
+			case a.Key[i] == nil:
+				return 1
+			case b.Key[i] == nil:
+				return -1
+			default:
+				if c := cmp.Compare(*a.Key[i], *b.Key[i]); c != 0 {
+					return c
+				}
+			}
+		}
+		return 0
+	})
+	out := make([]IndexGroupResponse, len(groups))
+	for i, g := range groups {
+		r := IndexGroupResponse{Count: g.Count}
+		if len(agg.GroupBy) > 0 {
+			r.Key = make(map[string]*string, len(agg.GroupBy))
+			for j, f := range agg.GroupBy {
+				r.Key[f] = g.Key[j]
+			}
+		}
+		if len(agg.Metrics) > 0 {
+			r.Metrics = make(map[string]*float64, len(agg.Metrics))
+			for j, m := range agg.Metrics {
+				r.Metrics[m.String()] = g.Values[j]
+			}
+		}
+		out[i] = r
+	}
+	return out
+}
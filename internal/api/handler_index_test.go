@@ -5,8 +5,10 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"testing"
 	"time"
 
@@ -14,30 +16,49 @@ import (
 	"github.com/ryanbastic/go-mezzanine/internal/cell"
 	"github.com/ryanbastic/go-mezzanine/internal/index"
 	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
 	"github.com/ryanbastic/go-mezzanine/internal/trigger"
 )
 
 // --- Mock IndexStore ---
 
+// mockIndexStore is an index.MemoryStore whose queries can be made to fail.
 type mockIndexStore struct {
-	entries  []index.Entry
+	*index.MemoryStore
 	queryErr error
-	writeErr error
 }
 
-func (m *mockIndexStore) QueryByShardKey(_ context.Context, _ string) ([]index.Entry, error) {
+// newMockIndexStore returns a store holding entries, which get added_ids
+// 1, 2, ... in order.
+func newMockIndexStore(entries ...index.Entry) *mockIndexStore {
+	m := &mockIndexStore{MemoryStore: index.NewMemoryStore()}
+	for _, e := range entries {
+		if err := m.WriteEntry(context.Background(), e); err != nil {
+			panic(err)
+		}
+	}
+	return m
+}
+
+func (m *mockIndexStore) QueryByShardKey(ctx context.Context, shardKey string, page index.Page, filters ...index.Filter) ([]index.Entry, error) {
 	if m.queryErr != nil {
 		return nil, m.queryErr
 	}
-	return m.entries, nil
+	return m.MemoryStore.QueryByShardKey(ctx, shardKey, page, filters...)
 }
 
-func (m *mockIndexStore) WriteEntry(_ context.Context, entry index.Entry) error {
-	if m.writeErr != nil {
-		return m.writeErr
+func (m *mockIndexStore) CountByShardKey(ctx context.Context, shardKey string, filters ...index.Filter) (int64, error) {
+	if m.queryErr != nil {
+		return 0, m.queryErr
 	}
-	m.entries = append(m.entries, entry)
-	return nil
+	return m.MemoryStore.CountByShardKey(ctx, shardKey, filters...)
+}
+
+func (m *mockIndexStore) Count(ctx context.Context, filters ...index.Filter) (int64, error) {
+	if m.queryErr != nil {
+		return 0, m.queryErr
+	}
+	return m.MemoryStore.Count(ctx, filters...)
 }
 
 func setupIndexTestServer(mockStore index.IndexStore, indexName string, numShards int) http.Handler {
@@ -45,11 +66,11 @@ func setupIndexTestServer(mockStore index.IndexStore, indexName string, numShard
 	for i := range numShards {
 		registry.RegisterStore(indexName, shard.ID(i), mockStore)
 	}
-	return NewServer(testLogger(), shard.NewRouter(), registry, trigger.NewPluginRegistry(), nil, numShards, nil)
+	return NewServer(testLogger(), shard.NewRouter(), registry, trigger.NewPluginRegistry(), nil, numShards, nil, ServerOptions{})
 }
 
 func TestQueryIndex_IndexNotFound(t *testing.T) {
-	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil)
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil, ServerOptions{})
 
 	req := httptest.NewRequest(http.MethodGet, "/v1/index/nonexistent/alice@example.com", nil)
 	w := httptest.NewRecorder()
@@ -63,7 +84,7 @@ func TestQueryIndex_IndexNotFound(t *testing.T) {
 
 func TestNewIndexHandler(t *testing.T) {
 	registry := index.NewRegistry()
-	h := NewIndexHandler(registry, 64, testLogger())
+	h := NewIndexHandler(registry, 64, ServerOptions{Limits: DefaultLimits()}, testLogger())
 	if h == nil {
 		t.Fatal("NewIndexHandler returned nil")
 	}
@@ -82,7 +103,7 @@ func TestQueryIndex_UserByEmail_FoundRoute(t *testing.T) {
 		UniqueFields:  []string{"email"},
 	}, 64)
 
-	server := NewServer(testLogger(), shard.NewRouter(), registry, trigger.NewPluginRegistry(), nil, 64, nil)
+	server := NewServer(testLogger(), shard.NewRouter(), registry, trigger.NewPluginRegistry(), nil, 64, nil, ServerOptions{})
 
 	req := httptest.NewRequest(http.MethodGet, "/v1/index/user_by_email/alice@example.com", nil)
 	w := httptest.NewRecorder()
@@ -97,14 +118,14 @@ func TestQueryIndex_UserByEmail_FoundRoute(t *testing.T) {
 }
 
 func TestWriteCell_UserByEmail_ProfileStored(t *testing.T) {
-	store := newMockCellStore()
+	store := memory.New()
 	shardRouter := shard.NewRouter()
 	for i := range 64 {
 		shardRouter.Register(shard.ID(i), store)
 	}
 
 	// No index registry — just verify profile cell with email is stored correctly.
-	server := NewServer(testLogger(), shardRouter, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil)
+	server := NewServer(testLogger(), shardRouter, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil, ServerOptions{})
 
 	rowKey := uuid.New()
 	body := map[string]any{
@@ -152,7 +173,7 @@ func TestWriteCell_UserByEmail_ProfileStored(t *testing.T) {
 // --- Integration tests ---
 
 func TestServer_HasRequestID(t *testing.T) {
-	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil)
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil, ServerOptions{})
 
 	req := httptest.NewRequest(http.MethodGet, "/v1/health", nil)
 	w := httptest.NewRecorder()
@@ -165,7 +186,7 @@ func TestServer_HasRequestID(t *testing.T) {
 }
 
 func TestServer_NotFound(t *testing.T) {
-	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil)
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil, ServerOptions{})
 
 	req := httptest.NewRequest(http.MethodGet, "/nonexistent", nil)
 	w := httptest.NewRecorder()
@@ -178,13 +199,13 @@ func TestServer_NotFound(t *testing.T) {
 }
 
 func TestServer_WriteAndGetCell(t *testing.T) {
-	store := newMockCellStore()
+	store := memory.New()
 	shardRouter := shard.NewRouter()
 	for i := range 64 {
 		shardRouter.Register(shard.ID(i), store)
 	}
 
-	server := NewServer(testLogger(), shardRouter, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil)
+	server := NewServer(testLogger(), shardRouter, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil, ServerOptions{})
 
 	// Write a cell
 	rowKey := uuid.New()
@@ -224,18 +245,16 @@ func TestServer_WriteAndGetCell(t *testing.T) {
 }
 
 func TestServer_GetRow_Integration(t *testing.T) {
-	store := newMockCellStore()
+	store := memory.New()
 	rowKey := uuid.New()
-	store.rows[rowKey.String()] = []cell.Cell{
-		{AddedID: 1, RowKey: rowKey, ColumnName: "a", RefKey: 1, Body: json.RawMessage(`{}`), CreatedAt: time.Now()},
-	}
+	seedCells(t, store, cell.Cell{AddedID: 1, RowKey: rowKey, ColumnName: "a", RefKey: 1, Body: json.RawMessage(`{}`), CreatedAt: time.Now()})
 
 	shardRouter := shard.NewRouter()
 	for i := range 64 {
 		shardRouter.Register(shard.ID(i), store)
 	}
 
-	server := NewServer(testLogger(), shardRouter, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil)
+	server := NewServer(testLogger(), shardRouter, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil, ServerOptions{})
 
 	req := httptest.NewRequest(http.MethodGet, "/v1/cells/"+rowKey.String(), nil)
 	w := httptest.NewRecorder()
@@ -250,19 +269,12 @@ func TestServer_GetRow_Integration(t *testing.T) {
 
 func TestQueryIndex_Success(t *testing.T) {
 	rowKey := uuid.New()
-	now := time.Now().Truncate(time.Microsecond)
-
-	mock := &mockIndexStore{
-		entries: []index.Entry{
-			{
-				AddedID:   1,
-				ShardKey:  "alice@example.com",
-				RowKey:    rowKey,
-				Body:      json.RawMessage(`{"email":"alice@example.com","display_name":"Alice Smith"}`),
-				CreatedAt: now,
-			},
-		},
-	}
+
+	mock := newMockIndexStore(index.Entry{
+		ShardKey: "alice@example.com",
+		RowKey:   rowKey,
+		Body:     json.RawMessage(`{"email":"alice@example.com","display_name":"Alice Smith"}`),
+	})
 
 	server := setupIndexTestServer(mock, "user_by_email", 64)
 
@@ -290,7 +302,7 @@ func TestQueryIndex_Success(t *testing.T) {
 }
 
 func TestQueryIndex_EmptyResults(t *testing.T) {
-	mock := &mockIndexStore{entries: []index.Entry{}}
+	mock := newMockIndexStore()
 
 	server := setupIndexTestServer(mock, "user_by_email", 64)
 
@@ -312,7 +324,7 @@ func TestQueryIndex_EmptyResults(t *testing.T) {
 }
 
 func TestQueryIndex_StoreError(t *testing.T) {
-	mock := &mockIndexStore{queryErr: errors.New("db connection failed")}
+	mock := &mockIndexStore{MemoryStore: index.NewMemoryStore(), queryErr: errors.New("db connection failed")}
 
 	server := setupIndexTestServer(mock, "user_by_email", 64)
 
@@ -325,8 +337,139 @@ func TestQueryIndex_StoreError(t *testing.T) {
 	}
 }
 
+func TestQueryIndex_Filters(t *testing.T) {
+	mock := newMockIndexStore(
+		index.Entry{ShardKey: "acme", RowKey: uuid.New(), Body: json.RawMessage(`{"status":"active","country":"US"}`)},
+		index.Entry{ShardKey: "acme", RowKey: uuid.New(), Body: json.RawMessage(`{"status":"closed","country":"CA"}`)},
+		index.Entry{ShardKey: "acme", RowKey: uuid.New(), Body: json.RawMessage(`{"status":"active","country":"DE"}`)},
+	)
+	server := setupIndexTestServer(mock, "order_by_tenant", 64)
+
+	tests := []struct {
+		query string
+		want  []int64
+	}{
+		{"filter=status:eq:active", []int64{1, 3}},
+		{"filter=status:ne:active", []int64{2}},
+		{"filter=country:in:US,CA", []int64{1, 2}},
+		{"filter=status:eq:active&filter=country:in:US,CA", []int64{1}},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/v1/index/order_by_tenant/acme?"+tt.query, nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status: got %d, want %d\nbody: %s", tt.query, w.Code, http.StatusOK, w.Body.String())
+		}
+		var resp []IndexEntryResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s: decode: %v", tt.query, err)
+		}
+		var got []int64
+		for _, e := range resp {
+			got = append(got, e.AddedID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: added_ids = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestQueryIndex_InvalidFilter(t *testing.T) {
+	registry := index.NewRegistry()
+	registry.Register(nil, index.Definition{
+		Name:          "user_by_email",
+		SourceColumn:  "profile",
+		ShardKeyField: "email",
+		Fields:        []string{"email", "display_name"},
+	}, 64)
+	server := NewServer(testLogger(), shard.NewRouter(), registry, trigger.NewPluginRegistry(), nil, 64, nil, ServerOptions{})
+
+	for _, query := range []string{
+		"filter=display_name",            // malformed
+		"filter=display_name:like:Alice", // unknown op
+		"filter=password_hash:eq:secret", // not denormalized
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/v1/index/user_by_email/alice@example.com?"+query, nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status: got %d, want %d", query, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func getCount(t *testing.T, server http.Handler, path string) (int, int64) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	var resp IndexCountResponse
+	if w.Code == http.StatusOK {
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+	}
+	return w.Code, resp.Count
+}
+
+func TestCountIndex(t *testing.T) {
+	mock := newMockIndexStore(
+		index.Entry{ShardKey: "acme", Body: json.RawMessage(`{"status":"open"}`)},
+		index.Entry{ShardKey: "acme", Body: json.RawMessage(`{"status":"closed"}`)},
+		index.Entry{ShardKey: "acme", Body: json.RawMessage(`{"status":"open"}`)},
+	)
+	server := setupIndexTestServer(mock, "order_by_tenant", 64)
+
+	if code, n := getCount(t, server, "/v1/index/order_by_tenant/acme/count"); code != http.StatusOK || n != 3 {
+		t.Errorf("count: got %d (status %d), want 3", n, code)
+	}
+	if code, n := getCount(t, server, "/v1/index/order_by_tenant/acme/count?filter=status:eq:open"); code != http.StatusOK || n != 2 {
+		t.Errorf("filtered count: got %d (status %d), want 2", n, code)
+	}
+}
+
+func TestCountIndexTotal_SumsShards(t *testing.T) {
+	registry := index.NewRegistry()
+	for i := range 4 {
+		entries := make([]index.Entry, i+1)
+		for j := range entries {
+			entries[j] = index.Entry{Body: json.RawMessage(fmt.Sprintf(`{"shard":%d}`, i))}
+		}
+		registry.RegisterStore("order_by_tenant", shard.ID(i), newMockIndexStore(entries...))
+	}
+	server := NewServer(testLogger(), shard.NewRouter(), registry, trigger.NewPluginRegistry(), nil, 4, nil, ServerOptions{})
+
+	if code, n := getCount(t, server, "/v1/index/order_by_tenant:count"); code != http.StatusOK || n != 10 {
+		t.Errorf("total: got %d (status %d), want 10", n, code)
+	}
+	if code, n := getCount(t, server, "/v1/index/order_by_tenant:count?filter=shard:in:2,3"); code != http.StatusOK || n != 7 {
+		t.Errorf("filtered total: got %d (status %d), want 7", n, code)
+	}
+}
+
+func TestCountIndexTotal_NotFound(t *testing.T) {
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 4, nil, ServerOptions{})
+	if code, _ := getCount(t, server, "/v1/index/nonexistent:count"); code != http.StatusNotFound {
+		t.Errorf("status: got %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestCountIndexTotal_StoreError(t *testing.T) {
+	registry := index.NewRegistry()
+	registry.RegisterStore("order_by_tenant", 0, newMockIndexStore())
+	registry.RegisterStore("order_by_tenant", 1, &mockIndexStore{MemoryStore: index.NewMemoryStore(), queryErr: errors.New("db connection failed")})
+	server := NewServer(testLogger(), shard.NewRouter(), registry, trigger.NewPluginRegistry(), nil, 2, nil, ServerOptions{})
+
+	if code, _ := getCount(t, server, "/v1/index/order_by_tenant:count"); code != http.StatusInternalServerError {
+		t.Errorf("status: got %d, want %d", code, http.StatusInternalServerError)
+	}
+}
+
 func TestServer_OpenAPISpec(t *testing.T) {
-	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil)
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil, ServerOptions{})
 
 	req := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
 	w := httptest.NewRecorder()
@@ -345,3 +488,81 @@ func TestServer_OpenAPISpec(t *testing.T) {
 		t.Error("expected openapi field in spec")
 	}
 }
+
+func setupAggregateTestServer(t *testing.T) http.Handler {
+	t.Helper()
+	registry := index.NewRegistry()
+	registry.Register(nil, index.Definition{
+		Name:          "order_by_tenant",
+		SourceColumn:  "orders",
+		ShardKeyField: "tenant_id",
+		Fields:        []string{"status", "total"},
+		FieldTypes:    map[string]index.FieldType{"status": index.FieldString, "total": index.FieldNumber},
+	}, 2)
+	registry.RegisterStore("order_by_tenant", 0, newMockIndexStore(
+		index.Entry{Body: json.RawMessage(`{"status":"open","total":10}`)},
+		index.Entry{Body: json.RawMessage(`{"status":"closed","total":5}`)},
+	))
+	registry.RegisterStore("order_by_tenant", 1, newMockIndexStore(
+		index.Entry{Body: json.RawMessage(`{"status":"open","total":2.5}`)},
+		index.Entry{Body: json.RawMessage(`{"total":1}`)},
+	))
+	return NewServer(testLogger(), shard.NewRouter(), registry, trigger.NewPluginRegistry(), nil, 2, nil, ServerOptions{})
+}
+
+func TestAggregateIndex_MergesShards(t *testing.T) {
+	server := setupAggregateTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/index/order_by_tenant:aggregate?group_by=status&metric=sum:total&metric=max:total", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	var resp IndexAggregateResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	type group struct {
+		status   string
+		count    int64
+		sum, max float64
+	}
+	want := []group{{"open", 2, 12.5, 10}, {"closed", 1, 5, 5}, {"", 1, 1, 1}}
+	if len(resp.Groups) != len(want) {
+		t.Fatalf("groups: got %+v, want %d", resp.Groups, len(want))
+	}
+	for i, w := range want {
+		g := resp.Groups[i]
+		status := ""
+		if s := g.Key["status"]; s != nil {
+			status = *s
+		}
+		got := group{status, g.Count, *g.Metrics["sum:total"], *g.Metrics["max:total"]}
+		if got != w {
+			t.Errorf("group %d: got %+v, want %+v", i, got, w)
+		}
+	}
+}
+
+func TestAggregateIndex_Errors(t *testing.T) {
+	server := setupAggregateTestServer(t)
+
+	for _, tc := range []struct {
+		path string
+		want int
+	}{
+		{"/v1/index/nonexistent:aggregate", http.StatusNotFound},
+		{"/v1/index/order_by_tenant:aggregate?group_by=email", http.StatusBadRequest},
+		{"/v1/index/order_by_tenant:aggregate?metric=sum:status", http.StatusBadRequest},
+		{"/v1/index/order_by_tenant:aggregate?metric=avg:total", http.StatusBadRequest},
+		{"/v1/index/order_by_tenant:aggregate?filter=status", http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s: status: got %d, want %d", tc.path, w.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,466 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/apikey"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// With row metadata enabled, the first write to a row records when and by
+// which API key it was created in the row's metadata column, a system
+// column that clients cannot write, so rows can be told apart without
+// reading their columns. Tags are set through the API, each change writing
+// the next version of the metadata, and indexed per shard so rows can be
+// listed by tag, e.g. to pick the cohort of a backfill.
+
+// metaColumn holds a row's metadata, in a metaBody, from metaRefKey on.
+const (
+	metaColumn = cell.MetaColumn
+	metaRefKey = 1
+)
+
+type metaBody struct {
+	CreatedAt time.Time `json:"created_at"`
+	Creator   string    `json:"creator,omitempty"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+}
+
+// newMeta returns the metadata of a row created now by the request's API
+// key.
+func newMeta(ctx context.Context) metaBody {
+	m := metaBody{CreatedAt: time.Now().UTC()}
+	if k, ok := apikey.FromContext(ctx); ok {
+		m.Creator, m.Tenant = k.Name, k.Tenant
+	}
+	return m
+}
+
+// missingMeta returns the metadata cells of those of rows, all on store's
+// shard, that have none, for the write to store with its cells; nothing
+// without row metadata. Rows this process has seen metadata for are
+// skipped without a lookup, so only a row's first writes here cost one.
+func (h *CellHandler) missingMeta(ctx context.Context, store storage.CellStore, rows []uuid.UUID) ([]cell.WriteCellRequest, error) {
+	if h.rowMeta == nil {
+		return nil, nil
+	}
+	rows = slices.DeleteFunc(distinctRows(rows), h.rowMeta.has)
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	refs := make([]cell.CellRef, len(rows))
+	for i, row := range rows {
+		refs[i] = cell.CellRef{RowKey: row, ColumnName: metaColumn, RefKey: metaRefKey}
+	}
+	found, err := store.GetCells(ctx, refs)
+	if err != nil {
+		h.logger.Error("failed to read row metadata", "rows", len(rows), "error", err)
+		return nil, failed(ctx, err, "failed to read row metadata")
+	}
+	body, err := json.Marshal(newMeta(ctx))
+	if err != nil {
+		return nil, err
+	}
+	var missing []cell.WriteCellRequest
+	for i, c := range found {
+		if c == nil {
+			missing = append(missing, cell.WriteCellRequest{RowKey: rows[i], ColumnName: metaColumn, RefKey: metaRefKey, Body: body})
+		} else {
+			h.rowMeta.add(rows[i])
+		}
+	}
+	return missing, nil
+}
+
+// wroteMeta remembers the rows of the metadata cells among stored.
+func (h *CellHandler) wroteMeta(stored []cell.WriteCellRequest) {
+	for _, req := range stored {
+		if req.ColumnName == metaColumn {
+			h.rowMeta.add(req.RowKey)
+		}
+	}
+}
+
+// recordMeta writes the metadata of those of rows, all on store's shard,
+// that have none, unless row metadata is disabled.
+func (h *CellHandler) recordMeta(ctx context.Context, store storage.CellStore, rows []uuid.UUID) error {
+	// A concurrent first write to one of rows conflicts on its metadata
+	// cell; the second pass then skips it.
+	for attempt := 0; ; attempt++ {
+		missing, err := h.missingMeta(ctx, store, rows)
+		if err != nil || len(missing) == 0 {
+			return err
+		}
+		_, err = store.WriteCells(ctx, missing)
+		if err == nil {
+			h.wroteMeta(missing)
+			return nil
+		}
+		if !errors.Is(err, storage.ErrCellExists) || attempt > 0 {
+			h.logger.Error("failed to record row metadata", "rows", len(missing), "error", err)
+			return failed(ctx, err, "failed to record row metadata")
+		}
+	}
+}
+
+// rowMetaCacheSize bounds the rows a server remembers having metadata.
+const rowMetaCacheSize = 1 << 16
+
+// knownRows remembers a bounded number of rows, forgetting the oldest
+// first.
+type knownRows struct {
+	mu    sync.Mutex
+	rows  map[uuid.UUID]struct{}
+	order []uuid.UUID // ring of the remembered rows, oldest at next once full
+	next  int
+}
+
+// newRowMetaCache returns the cache of rows known to have metadata, or nil
+// without row metadata.
+func newRowMetaCache(enabled bool) *knownRows {
+	if !enabled {
+		return nil
+	}
+	return newKnownRows(rowMetaCacheSize)
+}
+
+func newKnownRows(size int) *knownRows {
+	return &knownRows{rows: make(map[uuid.UUID]struct{}, size), order: make([]uuid.UUID, size)}
+}
+
+func (k *knownRows) has(row uuid.UUID) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	_, ok := k.rows[row]
+	return ok
+}
+
+func (k *knownRows) add(row uuid.UUID) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.rows[row]; ok {
+		return
+	}
+	if len(k.rows) == len(k.order) {
+		delete(k.rows, k.order[k.next])
+	}
+	k.rows[row] = struct{}{}
+	k.order[k.next] = row
+	k.next = (k.next + 1) % len(k.order)
+}
+
+type RowMetaInput struct {
+	RowKey string `path:"row_key" doc:"Row key UUID" format:"uuid"`
+}
+
+type PutRowMetaBody struct {
+	Tags []string `json:"tags" doc:"Tags of the row, replacing its current ones; duplicates are dropped and the rest sorted" required:"true" maxItems:"32" example:"[\"vip\",\"beta\"]"`
+}
+
+type PutRowMetaInput struct {
+	RowKey string `path:"row_key" doc:"Row key UUID" format:"uuid"`
+	Body   PutRowMetaBody
+}
+
+type RowMetaResponse struct {
+	RowKey    uuid.UUID `json:"row_key" doc:"Row key UUID" example:"550e8400-e29b-41d4-a716-446655440000"`
+	CreatedAt time.Time `json:"created_at" doc:"When the row was first written with row metadata enabled" example:"2026-02-06T12:00:00Z"`
+	Creator   string    `json:"creator,omitempty" doc:"Name of the API key that first wrote the row; omitted without API keys" example:"billing"`
+	Tenant    string    `json:"tenant,omitempty" doc:"Tenant of that API key" example:"acme"`
+	Tags      []string  `json:"tags" doc:"Tags of the row" example:"[\"vip\"]"`
+	RefKey    int64     `json:"ref_key" doc:"Version of the metadata; each tag change writes the next" example:"1"`
+	UpdatedAt time.Time `json:"updated_at" doc:"When this version of the metadata was written" example:"2026-02-06T12:00:00Z"`
+}
+
+type RowMetaOutput struct {
+	Body RowMetaResponse
+}
+
+func metaToResponse(c *cell.Cell) (RowMetaResponse, error) {
+	var m metaBody
+	if err := json.Unmarshal(c.Body, &m); err != nil {
+		return RowMetaResponse{}, fmt.Errorf("row %s: invalid metadata: %w", c.RowKey, err)
+	}
+	if m.Tags == nil {
+		m.Tags = []string{}
+	}
+	return RowMetaResponse{RowKey: c.RowKey, CreatedAt: m.CreatedAt, Creator: m.Creator, Tenant: m.Tenant, Tags: m.Tags, RefKey: c.RefKey, UpdatedAt: c.CreatedAt}, nil
+}
+
+func registerMetaRoutes(api huma.API, h *CellHandler) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-row-meta",
+		Method:      http.MethodGet,
+		Path:        "/v1/rows/{row_key}/meta",
+		Summary:     "Get row metadata",
+		Description: "Returns a row's metadata: when it was created, by which API key and tenant, and its tags. With row metadata enabled it is recorded by the first write to the row, in the _mezz.meta system column; rows written before then have none until their next write, or until their tags are set.",
+		Tags:        []string{"cells"},
+		Errors:      []int{http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	}, h.GetRowMeta)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "put-row-meta",
+		Method:      http.MethodPut,
+		Path:        "/v1/rows/{row_key}/meta",
+		Summary:     "Set row tags",
+		Description: "Replaces a row's tags, writing the next version of its metadata, and indexes them for listing rows by tag; metadata is created for a row without any. Tags that do not change write nothing. Read-only API keys cannot set tags.",
+		Tags:        []string{"cells"},
+		Errors:      []int{http.StatusBadRequest, http.StatusForbidden, http.StatusConflict, http.StatusUnprocessableEntity, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	}, h.PutRowMeta)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "list-rows-by-tag",
+		Method:      http.MethodGet,
+		Path:        "/v1/rows",
+		Summary:     "List rows by tag",
+		Description: "Pages through the rows carrying a tag, of one shard or of all shards in shard order, in row_key order within a shard; pass next as after for the next page. A page reads at most the server's scatter limit of shards, so it may hold fewer rows than limit and still carry next. Tenant-scoped API keys cannot list rows.",
+		Tags:        []string{"cells"},
+		Errors:      []int{http.StatusBadRequest, http.StatusForbidden, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	}, h.ListRowsByTag)
+	documentLimit(api, "/v1/rows", h.limits.RowList)
+}
+
+func (h *CellHandler) GetRowMeta(ctx context.Context, input *RowMetaInput) (*RowMetaOutput, error) {
+	rowKey, err := uuid.Parse(input.RowKey)
+	if err != nil {
+		return nil, huma.Error400BadRequest("invalid row_key")
+	}
+	store, err := h.rowStore(rowKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.acl.readable(ctx, store, rowKey, "row metadata not found"); err != nil {
+		return nil, err
+	}
+	c, err := store.GetCellLatest(ctx, rowKey, metaColumn)
+	if errors.Is(err, storage.ErrCellNotFound) {
+		return nil, huma.Error404NotFound("row metadata not found")
+	}
+	if err != nil {
+		h.logger.Error("failed to get row metadata", "row_key", rowKey, "error", err)
+		return nil, failed(ctx, err, "failed to get row metadata")
+	}
+	resp, err := metaToResponse(c)
+	if err != nil {
+		h.logger.Error("failed to decode row metadata", "row_key", rowKey, "error", err)
+		return nil, huma.Error500InternalServerError("failed to decode row metadata")
+	}
+	return &RowMetaOutput{Body: resp}, nil
+}
+
+func (h *CellHandler) PutRowMeta(ctx context.Context, input *PutRowMetaInput) (*RowMetaOutput, error) {
+	rowKey, err := uuid.Parse(input.RowKey)
+	if err != nil {
+		return nil, huma.Error400BadRequest("invalid row_key")
+	}
+	if err := rejectReadOnly(ctx, "set row tags"); err != nil {
+		return nil, err
+	}
+	tags := slices.Clone(input.Body.Tags)
+	for _, tag := range tags {
+		if tag == "" || len(tag) > 64 {
+			return nil, huma.Error422UnprocessableEntity("tags must be 1 to 64 bytes long")
+		}
+	}
+	slices.Sort(tags)
+	tags = slices.Compact(tags)
+
+	store, err := h.rowStore(rowKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.acl.claim(ctx, store, []uuid.UUID{rowKey}, false); err != nil {
+		return nil, err
+	}
+	c, err := storage.UpdateCell(ctx, store, rowKey, metaColumn, func(ctx context.Context, latest *cell.Cell) (json.RawMessage, error) {
+		m := newMeta(ctx)
+		if latest != nil {
+			if err := json.Unmarshal(latest.Body, &m); err != nil {
+				return nil, fmt.Errorf("row %s: invalid metadata: %w", rowKey, err)
+			}
+		}
+		if latest != nil && (slices.Equal(m.Tags, tags) || len(m.Tags) == 0 && len(tags) == 0) {
+			return nil, nil
+		}
+		m.Tags = tags
+		return json.Marshal(m)
+	})
+	if errors.Is(err, storage.ErrCellExists) {
+		return nil, huma.Error409Conflict("row metadata was written concurrently; retry")
+	}
+	if err != nil {
+		h.logger.Error("failed to set row tags", "row_key", rowKey, "error", err)
+		return nil, failed(ctx, err, "failed to set row tags")
+	}
+	if err := h.indexRowTags(ctx, store, rowKey, tags); err != nil {
+		h.logger.Error("failed to index row tags", "row_key", rowKey, "error", err)
+		return nil, failed(ctx, err, "failed to index row tags")
+	}
+	resp, err := metaToResponse(c)
+	if err != nil {
+		h.logger.Error("failed to decode row metadata", "row_key", rowKey, "error", err)
+		return nil, huma.Error500InternalServerError("failed to decode row metadata")
+	}
+	return &RowMetaOutput{Body: resp}, nil
+}
+
+// indexRowTags writes the tag index of a row after its metadata commits,
+// outside the metadata update, which would otherwise hold one connection
+// while the index write waits for another. A concurrent change may commit
+// between the two, so the index is checked against the latest metadata and
+// written again until they agree; a failure is repaired by setting the tags
+// again. Unchanged tags are indexed too, in case an earlier change was not.
+func (h *CellHandler) indexRowTags(ctx context.Context, store storage.CellStore, rowKey uuid.UUID, tags []string) error {
+	for {
+		if err := storage.SetRowTags(ctx, store, rowKey, tags); err != nil {
+			if errors.Is(err, storage.ErrTagsUnsupported) {
+				return nil
+			}
+			return err
+		}
+		latest, err := store.GetCellLatest(storage.WithFreshRead(ctx), rowKey, metaColumn)
+		if err != nil {
+			return err
+		}
+		var m metaBody
+		if err := json.Unmarshal(latest.Body, &m); err != nil {
+			return fmt.Errorf("row %s: invalid metadata: %w", rowKey, err)
+		}
+		if slices.Equal(m.Tags, tags) || len(m.Tags) == 0 && len(tags) == 0 {
+			return nil
+		}
+		tags = m.Tags
+	}
+}
+
+type ListRowsByTagInput struct {
+	Tag     string `query:"tag" doc:"Tag the rows carry" required:"true" minLength:"1" maxLength:"64"`
+	ShardID int    `query:"shard_id" doc:"Shard to list; -1 lists every shard" default:"-1" minimum:"-1"`
+	After   string `query:"after" doc:"Cursor from the previous page's next"`
+	Limit   int    `query:"limit" doc:"Maximum number of rows to return"`
+}
+
+type TaggedRow struct {
+	RowKey  uuid.UUID `json:"row_key" doc:"Row key UUID" example:"550e8400-e29b-41d4-a716-446655440000"`
+	ShardID int       `json:"shard_id" doc:"Shard holding the row" example:"3"`
+}
+
+type ListRowsByTagResponse struct {
+	Rows []TaggedRow `json:"rows" doc:"Rows carrying the tag"`
+	Next string      `json:"next,omitempty" doc:"Cursor of the next page; set when the page is full or stopped at the scatter limit of shards" example:"3:550e8400-e29b-41d4-a716-446655440000"`
+}
+
+type ListRowsByTagOutput struct {
+	Link string `header:"Link" doc:"URL of the next page with rel=\"next\"; set with next"`
+	Body ListRowsByTagResponse
+}
+
+// rowCursor is the position of a row listing: past row on shard.
+type rowCursor struct {
+	shard int
+	row   uuid.UUID
+}
+
+func (c rowCursor) String() string {
+	return fmt.Sprintf("%d:%s", c.shard, c.row)
+}
+
+func parseRowCursor(s string) (rowCursor, error) {
+	shardPart, rowPart, ok := strings.Cut(s, ":")
+	if !ok {
+		return rowCursor{}, errors.New("invalid cursor")
+	}
+	shardID, err := strconv.Atoi(shardPart)
+	if err != nil {
+		return rowCursor{}, errors.New("invalid cursor")
+	}
+	row, err := uuid.Parse(rowPart)
+	if err != nil {
+		return rowCursor{}, errors.New("invalid cursor")
+	}
+	return rowCursor{shard: shardID, row: row}, nil
+}
+
+func (h *CellHandler) ListRowsByTag(ctx context.Context, input *ListRowsByTagInput) (*ListRowsByTagOutput, error) {
+	if err := h.acl.scan(ctx, "list_rows"); err != nil {
+		return nil, err
+	}
+	first, last := 0, h.numShards-1
+	if input.ShardID >= 0 {
+		if input.ShardID >= h.numShards {
+			return nil, huma.Error400BadRequest("invalid shard_id")
+		}
+		first, last = input.ShardID, input.ShardID
+	}
+	var pos rowCursor
+	if input.After != "" {
+		c, err := parseRowCursor(input.After)
+		if err != nil || c.shard < first || c.shard > last {
+			return nil, huma.Error400BadRequest("invalid after cursor")
+		}
+		pos = c
+		first = c.shard
+	}
+	limit := h.limits.RowList.Apply(input.Limit)
+
+	// A rare tag leaves most shards empty, so one page reads at most the
+	// scatter budget's MaxShards shards and resumes at the next one.
+	var resume *rowCursor
+	if maxShards := h.scatter.MaxShards; maxShards > 0 && last-first+1 > maxShards {
+		last = first + maxShards - 1
+		resume = &rowCursor{shard: last + 1}
+	}
+	resp := ListRowsByTagResponse{Rows: []TaggedRow{}}
+	for shardID := first; shardID <= last && len(resp.Rows) < limit; shardID++ {
+		store, err := h.router.StoreFor(shard.ID(shardID))
+		if err != nil {
+			h.logger.Error("shard routing failed", "shard_id", shardID, "error", err)
+			return nil, huma.Error500InternalServerError("shard routing failed")
+		}
+		after := uuid.Nil
+		if shardID == pos.shard {
+			after = pos.row
+		}
+		rows, err := storage.RowsByTag(ctx, store, input.Tag, after, limit-len(resp.Rows))
+		if errors.Is(err, storage.ErrTagsUnsupported) {
+			return nil, huma.Error400BadRequest("the store does not support row tags")
+		}
+		if err != nil {
+			h.logger.Error("failed to list rows by tag", "shard_id", shardID, "tag", input.Tag, "error", err)
+			return nil, failed(ctx, err, "failed to list rows")
+		}
+		for _, row := range rows {
+			resp.Rows = append(resp.Rows, TaggedRow{RowKey: row, ShardID: shardID})
+		}
+	}
+
+	out := &ListRowsByTagOutput{}
+	if n := len(resp.Rows); n == limit {
+		resume = &rowCursor{shard: resp.Rows[n-1].ShardID, row: resp.Rows[n-1].RowKey}
+	}
+	if resume != nil {
+		resp.Next = resume.String()
+		q := url.Values{"tag": {input.Tag}, "after": {resp.Next}, "limit": {strconv.Itoa(limit)}}
+		if input.ShardID >= 0 {
+			q.Set("shard_id", strconv.Itoa(input.ShardID))
+		}
+		out.Link = nextLink("/v1/rows", q, nil)
+	}
+	out.Body = resp
+	return out, nil
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/apikey"
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+)
+
+func setupMetaServer(store *memory.Store) http.Handler {
+	r := shard.NewRouter()
+	for i := range 8 {
+		r.Register(shard.ID(i), store)
+	}
+	keys := apikey.NewSet(&apikey.Config{Keys: []apikey.Key{
+		{Name: "backend", SHA256: sha256Hex("backend-token")},
+		{Name: "acme-app", SHA256: sha256Hex("acme-token"), Tenant: "acme"},
+		{Name: "reader", SHA256: sha256Hex("reader-token"), Write: []string{}},
+	}})
+	return NewServer(testLogger(), r, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 8, nil, ServerOptions{APIKeys: keys, RowMetadata: true})
+}
+
+func putTags(server http.Handler, token string, row uuid.UUID, tags ...string) *httptest.ResponseRecorder {
+	if tags == nil {
+		tags = []string{}
+	}
+	data, _ := json.Marshal(map[string]any{"tags": tags})
+	req := httptest.NewRequest(http.MethodPut, "/v1/rows/"+row.String()+"/meta", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", token)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	return w
+}
+
+func getMeta(t *testing.T, server http.Handler, token string, row uuid.UUID) (RowMetaResponse, int) {
+	t.Helper()
+	w := aclRequest(server, token, http.MethodGet, "/v1/rows/"+row.String()+"/meta", nil)
+	var resp RowMetaResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	return resp, w.Code
+}
+
+func TestRowMeta(t *testing.T) {
+	store := memory.New()
+	server := setupMetaServer(store)
+	row := uuid.New()
+
+	if _, code := getMeta(t, server, "backend-token", row); code != http.StatusNotFound {
+		t.Errorf("before any write: got %d, want 404", code)
+	}
+	if code := aclWrite(server, "acme-token", row, 1); code != http.StatusCreated {
+		t.Fatalf("first write: got %d", code)
+	}
+	meta, code := getMeta(t, server, "backend-token", row)
+	if code != http.StatusOK || meta.Creator != "acme-app" || meta.Tenant != "acme" || meta.CreatedAt.IsZero() || meta.RefKey != 1 || len(meta.Tags) != 0 {
+		t.Fatalf("after first write: got %d %+v", code, meta)
+	}
+
+	// Later writes, by any key, leave the metadata alone.
+	if code := aclWrite(server, "backend-token", row, 2); code != http.StatusCreated {
+		t.Fatalf("second write: got %d", code)
+	}
+	if again, _ := getMeta(t, server, "backend-token", row); again.Creator != "acme-app" || again.RefKey != 1 {
+		t.Errorf("after second write: got %+v", again)
+	}
+
+	w := putTags(server, "backend-token", row, "vip", "beta", "vip")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"tags":["beta","vip"]`) || !strings.Contains(w.Body.String(), `"ref_key":2`) {
+		t.Fatalf("put tags: got %d %s", w.Code, w.Body.String())
+	}
+	if w := putTags(server, "backend-token", row, "beta", "vip"); !strings.Contains(w.Body.String(), `"ref_key":2`) {
+		t.Errorf("unchanged tags: got %s, want no new version", w.Body.String())
+	}
+	if tagged, _ := getMeta(t, server, "backend-token", row); tagged.Creator != "acme-app" || !tagged.CreatedAt.Equal(meta.CreatedAt) {
+		t.Errorf("tags changed the creation record: got %+v", tagged)
+	}
+	if w := putTags(server, "reader-token", row, "x"); w.Code != http.StatusForbidden {
+		t.Errorf("read-only key: got %d, want 403", w.Code)
+	}
+	if w := putTags(server, "backend-token", row, strings.Repeat("x", 65)); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("long tag: got %d, want 422", w.Code)
+	}
+
+	// Tags can be set on a row without metadata.
+	other := uuid.New()
+	if w := putTags(server, "backend-token", other, "new"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"creator":"backend"`) {
+		t.Errorf("tags of a new row: got %d %s", w.Code, w.Body.String())
+	}
+
+	// The metadata column is a system column; other cell routes are unaffected.
+	if w := aclRequest(server, "backend-token", http.MethodPost, "/v1/cells", map[string]any{"row_key": row, "column_name": metaColumn, "ref_key": 9, "body": map[string]any{}}); w.Code != http.StatusBadRequest {
+		t.Errorf("client write to the metadata column: got %d, want 400", w.Code)
+	}
+	if w := aclRequest(server, "backend-token", http.MethodGet, "/v1/cells/"+row.String()+"/profile/1", nil); w.Code != http.StatusOK {
+		t.Errorf("exact version: got %d", w.Code)
+	}
+}
+
+func TestRowMeta_Disabled(t *testing.T) {
+	store := memory.New()
+	server := setupTestServer(store, 8)
+	row := uuid.New()
+	postCell(t, server, map[string]any{"row_key": row, "column_name": "profile", "ref_key": 1, "body": map[string]any{}}, "")
+	if w := get(server, "/v1/rows/"+row.String()+"/meta"); w.Code != http.StatusNotFound {
+		t.Errorf("metadata disabled: got %d, want 404", w.Code)
+	}
+}
+
+func TestListRowsByTag(t *testing.T) {
+	r := shard.NewRouter()
+	for i := range 4 {
+		r.Register(shard.ID(i), memory.New())
+	}
+	keys := apikey.NewSet(&apikey.Config{Keys: []apikey.Key{
+		{Name: "backend", SHA256: sha256Hex("backend-token")},
+		{Name: "acme-app", SHA256: sha256Hex("acme-token"), Tenant: "acme"},
+	}})
+	server := NewServer(testLogger(), r, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 4, nil, ServerOptions{APIKeys: keys, RowMetadata: true, RowACL: RowACLEnforce})
+
+	tagged := make(map[uuid.UUID]bool)
+	for range 10 {
+		row := uuid.New()
+		tagged[row] = true
+		if w := putTags(server, "backend-token", row, "backfill"); w.Code != http.StatusOK {
+			t.Fatalf("put tags: got %d", w.Code)
+		}
+	}
+	untagged := uuid.New()
+	putTags(server, "backend-token", untagged, "backfill")
+	putTags(server, "backend-token", untagged)
+
+	list := func(query string) ListRowsByTagResponse {
+		t.Helper()
+		w := aclRequest(server, "backend-token", http.MethodGet, "/v1/rows?"+query, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("list %s: got %d %s", query, w.Code, w.Body.String())
+		}
+		var resp ListRowsByTagResponse
+		_ = json.NewDecoder(w.Body).Decode(&resp)
+		return resp
+	}
+
+	// Pages of 3 walk the shards in order and return every tagged row once.
+	seen := make(map[uuid.UUID]bool)
+	lastShard := 0
+	for after := ""; ; {
+		page := list("tag=backfill&limit=3&after=" + after)
+		for _, row := range page.Rows {
+			if !tagged[row.RowKey] || seen[row.RowKey] || row.ShardID < lastShard || int(defaultShard(row.RowKey, 4)) != row.ShardID {
+				t.Fatalf("unexpected row %+v", row)
+			}
+			seen[row.RowKey], lastShard = true, row.ShardID
+		}
+		if page.Next == "" {
+			break
+		}
+		after = page.Next
+	}
+	if len(seen) != len(tagged) {
+		t.Errorf("listed %d rows, want %d", len(seen), len(tagged))
+	}
+
+	onShard := 0
+	for row := range tagged {
+		if defaultShard(row, 4) == 1 {
+			onShard++
+		}
+	}
+	if resp := list("tag=backfill&shard_id=1"); len(resp.Rows) != onShard {
+		t.Errorf("shard 1: got %d rows, want %d", len(resp.Rows), onShard)
+	} else {
+		for _, row := range resp.Rows {
+			if row.ShardID != 1 {
+				t.Errorf("shard 1 listing returned %+v", row)
+			}
+		}
+	}
+	if resp := list("tag=other"); len(resp.Rows) != 0 || resp.Next != "" {
+		t.Errorf("unused tag: got %+v", resp)
+	}
+
+	for _, tt := range []struct {
+		token, query string
+		want         int
+	}{
+		{"backend-token", "tag=backfill&shard_id=4", http.StatusBadRequest},
+		{"backend-token", "tag=backfill&after=bogus", http.StatusBadRequest},
+		{"backend-token", "tag=backfill&shard_id=1&after=2:" + uuid.NewString(), http.StatusBadRequest},
+		{"backend-token", "shard_id=1", http.StatusUnprocessableEntity},
+		{"acme-token", "tag=backfill", http.StatusForbidden},
+	} {
+		if w := aclRequest(server, tt.token, http.MethodGet, "/v1/rows?"+tt.query, nil); w.Code != tt.want {
+			t.Errorf("%s as %s: got %d, want %d", tt.query, tt.token, w.Code, tt.want)
+		}
+	}
+}
+
+func TestKnownRows(t *testing.T) {
+	k := newKnownRows(2)
+	a, b, c := uuid.New(), uuid.New(), uuid.New()
+	k.add(a)
+	k.add(b)
+	k.add(a)
+	if !k.has(a) || !k.has(b) {
+		t.Fatal("added rows not remembered")
+	}
+	k.add(c)
+	if k.has(a) || !k.has(b) || !k.has(c) {
+		t.Errorf("after overflow: has a=%v b=%v c=%v, want the oldest forgotten", k.has(a), k.has(b), k.has(c))
+	}
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// patchAttempts bounds how often a patch is reapplied when another write
+// takes the ref_key it was about to write.
+const patchAttempts = 5
+
+type PatchCellInput struct {
+	RowKey     string `path:"row_key" doc:"Row key UUID" format:"uuid"`
+	ColumnName string `path:"column_name" doc:"Column name"`
+	RawBody    []byte `contentType:"application/merge-patch+json"`
+}
+
+type PatchCellOutput struct {
+	Shard  string `header:"X-Shard-Id" doc:"Shard the write was routed to"`
+	Seq    string `header:"X-Shard-Seq" doc:"The sequence number in its shard (its added_id) of the returned cell; pass X-Shard-Id:X-Shard-Seq as min_seq to read it back"`
+	Timing string `header:"Server-Timing" doc:"Milliseconds spent storing, indexing and notifying plugins; set when the server enables it"`
+	Body   CellResponse
+}
+
+// mergePatchSchema documents the request body of patch-cell, which huma
+// would otherwise describe as bytes. It is left untyped: for an object
+// schema huma would document a $schema field, which a patch would merge
+// into the cell.
+var mergePatchSchema = &huma.Schema{
+	Description: "RFC 7386 JSON merge patch, a JSON object: fields set to null are removed, objects are merged recursively, and any other value replaces the field",
+	Examples:    []any{map[string]any{"email": "alice@example.org", "phone": nil}},
+}
+
+func registerPatchRoute(api huma.API, h *CellHandler) {
+	// The patch is read raw so that PatchCell can tell malformed JSON
+	// (400) from JSON that is not an object (422); huma validates only
+	// application/json bodies.
+	huma.Register(api, huma.Operation{
+		OperationID:  "patch-cell",
+		Method:       http.MethodPatch,
+		Path:         "/v1/cells/{row_key}/{column_name}",
+		Summary:      "Merge-patch the latest cell version",
+		Description:  "Applies an RFC 7386 JSON merge patch to the body of the latest version of a cell and writes the result as a new version with the next ref_key, so small updates need no read-modify-write cycle. The patch is applied to the latest version as stored: if another write takes the next ref_key first, the patch is reapplied to that version, and after repeated conflicts the request fails with 409. A patch that changes nothing writes no version and returns the latest one. The new version is written as by write-cell: write hooks and synchronous plugins see the merged body, and large bodies are offloaded. Binary cells cannot be patched.",
+		Tags:         []string{"cells"},
+		Errors:       []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		MaxBodyBytes: h.body.MaxBytes,
+	}, h.PatchCell)
+	oapi := api.OpenAPI()
+	oapi.Components.Schemas.Map()["MergePatch"] = mergePatchSchema
+	oapi.Paths["/v1/cells/{row_key}/{column_name}"].Patch.RequestBody.Content["application/merge-patch+json"].Schema = &huma.Schema{Ref: "#/components/schemas/MergePatch"}
+}
+
+// PatchCell writes the latest version of a cell merged with a patch as the
+// next version, retrying on the version a concurrent write took.
+func (h *CellHandler) PatchCell(ctx context.Context, input *PatchCellInput) (*PatchCellOutput, error) {
+	rowKey, err := uuid.Parse(input.RowKey)
+	if err != nil {
+		return nil, huma.Error400BadRequest("invalid row_key")
+	}
+	if err := checkWritable(input.ColumnName); err != nil {
+		return nil, err
+	}
+	if err := authorizeWrite(ctx, input.ColumnName); err != nil {
+		return nil, err
+	}
+	patch := json.RawMessage(input.RawBody)
+	if !json.Valid(patch) {
+		return nil, huma.Error400BadRequest("malformed JSON merge patch")
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &fields); err != nil {
+		return nil, huma.Error422UnprocessableEntity("merge patch must be a JSON object; write a new version to replace the whole body")
+	}
+
+	shardID := h.router.ForRowKey(rowKey, h.numShards)
+	store, err := h.router.StoreFor(shardID)
+	if err != nil {
+		h.logger.Error("shard routing failed", "shard_id", shardID, "error", err)
+		return nil, huma.Error500InternalServerError("shard routing failed")
+	}
+	if err := h.acl.readable(ctx, store, rowKey, "cell not found"); err != nil {
+		return nil, err
+	}
+	claims, err := h.acl.authorize(ctx, store, []uuid.UUID{rowKey})
+	if err != nil {
+		return nil, err
+	}
+
+	for range patchAttempts {
+		latest, err := store.GetCellLatest(storage.WithFreshRead(ctx), rowKey, input.ColumnName)
+		if errors.Is(err, storage.ErrCellNotFound) {
+			return nil, huma.Error404NotFound("cell not found")
+		}
+		if err != nil {
+			h.logger.Error("failed to get cell", "row_key", rowKey, "column_name", input.ColumnName, "error", err)
+			return nil, failed(ctx, err, "failed to get cell")
+		}
+		if _, ok := cell.ParseBlobBody(latest.Body); ok {
+			return nil, huma.Error422UnprocessableEntity("binary cells cannot be patched")
+		}
+		current, err := h.resolver(true).cell(ctx, latest)
+		if err != nil {
+			return nil, h.resolveFailed(ctx, err, "failed to get cell")
+		}
+		body, err := cell.MergePatch(current.Body, patch)
+		if err != nil {
+			h.logger.Error("failed to apply merge patch", "row_key", rowKey, "column_name", input.ColumnName, "error", err)
+			return nil, huma.Error500InternalServerError("failed to apply merge patch")
+		}
+		if sameJSON(body, current.Body) {
+			return &PatchCellOutput{Shard: shardIDHeader(shardID), Seq: seqHeader(latest.AddedID), Body: cellToResponse(readMask(ctx, nil, h.maskSecret).cell(latest))}, nil
+		}
+
+		reqs := []cell.WriteCellRequest{{RowKey: rowKey, ColumnName: input.ColumnName, RefKey: latest.RefKey + 1, Body: body}}
+		if err := h.beforeWrite(ctx, shardID, reqs); err != nil {
+			return nil, err
+		}
+		originals, err := h.offloadBodies(ctx, reqs, false)
+		if err != nil {
+			return nil, err
+		}
+
+		var timing writeTiming
+		at := time.Now()
+		c, err := h.writeCell(ctx, store, claims, reqs[0])
+		if errors.Is(err, storage.ErrCellExists) {
+			h.logger.Debug("merge patch lost a race, reapplying", "row_key", rowKey, "column_name", input.ColumnName, "ref_key", reqs[0].RefKey)
+			continue
+		}
+		if err != nil {
+			h.logger.Error("failed to write cell", "row_key", rowKey, "column_name", input.ColumnName, "error", err)
+			return nil, failed(ctx, err, "failed to write cell")
+		}
+		at = since(&timing.store, at)
+
+		written := withOriginal(c, originals, 0)
+		if h.notifier != nil {
+			h.notifier.NotifyCell(int(shardID), written)
+		}
+		at = since(&timing.notify, at)
+
+		if err := h.indexRegistry.IndexCell(ctx, written, h.numShards); err != nil {
+			h.logger.Error("index write failed", "row_key", c.RowKey, "column_name", c.ColumnName, "error", err)
+		}
+		since(&timing.index, at)
+		h.columns.Observe(c.ColumnName, 1, len(c.Body), c.CreatedAt)
+
+		header := h.reportTiming(timing, "patched cell", "row_key", c.RowKey, "column_name", c.ColumnName, "ref_key", c.RefKey)
+		return &PatchCellOutput{Shard: shardIDHeader(shardID), Seq: seqHeader(c.AddedID), Timing: header, Body: cellToResponse(readMask(ctx, nil, h.maskSecret).cell(c))}, nil
+	}
+	return nil, huma.Error409Conflict("cell changed concurrently on every attempt; retry the patch")
+}
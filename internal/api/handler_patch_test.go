@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+)
+
+func patchCell(server http.Handler, row uuid.UUID, column, patch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPatch, "/v1/cells/"+row.String()+"/"+column, strings.NewReader(patch))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	return w
+}
+
+func TestPatchCell(t *testing.T) {
+	store := memory.New()
+	server := setupTestServer(store, 8)
+	row := uuid.New()
+	postCell(t, server, map[string]any{"row_key": row, "column_name": "profile", "ref_key": 3, "body": map[string]any{
+		"name": "Alice", "email": "alice@example.com", "address": map[string]any{"city": "Oslo", "zip": "0150"},
+	}}, "")
+
+	w := patchCell(server, row, "profile", `{"email":null,"phone":"555","address":{"zip":"0151"}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("patch: got %d: %s", w.Code, w.Body.String())
+	}
+	var resp CellResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	want := `{"address":{"city":"Oslo","zip":"0151"},"name":"Alice","phone":"555"}`
+	if resp.RefKey != 4 || !sameJSON(resp.Body, json.RawMessage(want)) {
+		t.Errorf("patch: got ref_key %d body %s, want 4 %s", resp.RefKey, resp.Body, want)
+	}
+	if w.Header().Get("X-Shard-Seq") == "" {
+		t.Error("patch: missing X-Shard-Seq")
+	}
+
+	// A patch that changes nothing writes no version.
+	if w := patchCell(server, row, "profile", `{"name":"Alice"}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"ref_key":4`) {
+		t.Errorf("no-op patch: got %d %s, want version 4", w.Code, w.Body.String())
+	}
+	if latest, _ := store.GetCellLatest(t.Context(), row, "profile"); latest.RefKey != 4 {
+		t.Errorf("latest ref_key: got %d, want 4", latest.RefKey)
+	}
+
+	// application/json is accepted too.
+	req := httptest.NewRequest(http.MethodPatch, "/v1/cells/"+row.String()+"/profile", strings.NewReader(`{"name":"Al"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"ref_key":5`) {
+		t.Errorf("application/json: got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestPatchCell_Errors(t *testing.T) {
+	server := setupTestServer(memory.New(), 8)
+	row := uuid.New()
+	if w := patchCell(server, row, "profile", `{"a":1}`); w.Code != http.StatusNotFound {
+		t.Errorf("missing cell: got %d, want 404", w.Code)
+	}
+	postCell(t, server, map[string]any{"row_key": row, "column_name": "profile", "ref_key": 1, "body": map[string]any{"a": 1}}, "")
+	if w := patchCell(server, row, "profile", `["a"]`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("non-object patch: got %d, want 422", w.Code)
+	}
+	if w := patchCell(server, row, "profile", `{"a":`); w.Code != http.StatusBadRequest {
+		t.Errorf("malformed patch: got %d, want 400", w.Code)
+	}
+	if w := patchCell(server, row, "_mezz.owner", `{"a":1}`); w.Code != http.StatusBadRequest {
+		t.Errorf("reserved column: got %d, want 400", w.Code)
+	}
+	if w := putBlob(server, "/v1/blobs/"+row.String()+"/avatar/1", "image/png", []byte("x"), ""); w.Code != http.StatusCreated {
+		t.Fatalf("blob: got %d", w.Code)
+	}
+	if w := patchCell(server, row, "avatar", `{"a":1}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("binary cell: got %d, want 422", w.Code)
+	}
+}
+
+// racingStore writes a competing version of the cell just before each of
+// the first races patch writes.
+type racingStore struct {
+	*memory.Store
+	races int
+}
+
+func (s *racingStore) WriteCell(ctx context.Context, req cell.WriteCellRequest) (*cell.Cell, error) {
+	if s.races > 0 {
+		s.races--
+		if _, err := s.Store.WriteCell(ctx, cell.WriteCellRequest{RowKey: req.RowKey, ColumnName: req.ColumnName, RefKey: req.RefKey, Body: json.RawMessage(`{"other":true}`)}); err != nil {
+			return nil, err
+		}
+	}
+	return s.Store.WriteCell(ctx, req)
+}
+
+func TestPatchCell_Race(t *testing.T) {
+	store := &racingStore{Store: memory.New()}
+	server := setupTestServer(store, 8)
+	row := uuid.New()
+	postCell(t, server, map[string]any{"row_key": row, "column_name": "profile", "ref_key": 1, "body": map[string]any{"a": 1}}, "")
+
+	// The patch is reapplied to the competing version.
+	store.races = 2
+	w := patchCell(server, row, "profile", `{"b":2}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"ref_key":4`) || !strings.Contains(w.Body.String(), `"other":true`) {
+		t.Fatalf("race: got %d %s, want version 4 merged into the competing one", w.Code, w.Body.String())
+	}
+
+	store.races = patchAttempts
+	if w := patchCell(server, row, "profile", `{"c":3}`); w.Code != http.StatusConflict {
+		t.Errorf("lost every race: got %d, want 409", w.Code)
+	}
+}
@@ -2,21 +2,33 @@ package api
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/stream"
 	"github.com/ryanbastic/go-mezzanine/internal/trigger"
 )
 
 // --- Huma Input/Output types ---
 
 type RegisterPluginBody struct {
-	Name              string   `json:"name" doc:"Plugin name" required:"true" minLength:"1"`
-	Endpoint          string   `json:"endpoint" doc:"JSON-RPC endpoint URL" required:"true" minLength:"1"`
-	SubscribedColumns []string `json:"subscribed_columns" doc:"Columns to subscribe to" required:"true" minItems:"1"`
+	Name               string   `json:"name" doc:"Plugin name" required:"true" minLength:"1" example:"search-indexer"`
+	Endpoint           string   `json:"endpoint" doc:"JSON-RPC endpoint URL" required:"true" minLength:"1" example:"http://search-indexer:9000/rpc"`
+	SubscribedColumns  []string `json:"subscribed_columns,omitempty" doc:"Columns to subscribe to; at least one column or stream is required unless the plugin follows another" example:"[\"profile\"]"`
+	SubscribedStreams  []string `json:"subscribed_streams,omitempty" doc:"Streams to subscribe to (see /v1/streams)" example:"[\"eu-orders\"]"`
+	PoisonPolicy       string   `json:"poison_policy,omitempty" doc:"What the trigger watchdog does with a cell that still fails after max_attempts redeliveries: block keeps retrying it, skip dead-letters it and moves on, pause dead-letters it and pauses the plugin" enum:"block,skip,pause" default:"block" example:"skip"`
+	MaxAttempts        int      `json:"max_attempts,omitempty" doc:"Watchdog redeliveries of a stuck lane's failing cell before the poison policy applies; 0 uses the server's TRIGGER_WATCHDOG_MAX_ATTEMPTS" minimum:"0" example:"5"`
+	Encoding           string   `json:"encoding,omitempty" doc:"Encoding of the notifications sent to the plugin: json, or msgpack for plugins receiving large bodies at high rates. The plugin must accept it; pkg/plugin servers accept both" enum:"json,msgpack" default:"json" example:"msgpack"`
+	After              string   `json:"after,omitempty" doc:"Name of the plugin this one follows in a chain: it receives each cell of the chain only once that plugin has processed it successfully, and subscribes to nothing itself" example:"enricher"`
+	WritableColumns    []string `json:"writable_columns,omitempty" doc:"Columns the plugin may write derived cells to by returning them from its cell.written notifications; reserved columns are refused" example:"[\"profile_geo\"]"`
+	SynchronousColumns []string `json:"synchronous_columns,omitempty" doc:"Subscribed columns whose writes wait for the plugin to accept each cell with a cell.validate request before it is stored; a rejection fails the write with 422, and a plugin that cannot be reached within TRIGGER_SYNC_TIMEOUT fails it with 502" example:"[\"payments\"]"`
 }
 
 type RegisterPluginInput struct {
@@ -24,12 +36,20 @@ type RegisterPluginInput struct {
 }
 
 type PluginResponse struct {
-	ID                uuid.UUID `json:"id" doc:"Plugin UUID"`
-	Name              string    `json:"name" doc:"Plugin name"`
-	Endpoint          string    `json:"endpoint" doc:"JSON-RPC endpoint URL"`
-	SubscribedColumns []string  `json:"subscribed_columns" doc:"Subscribed columns"`
-	Status            string    `json:"status" doc:"Plugin status" example:"active"`
-	CreatedAt         time.Time `json:"created_at" doc:"Creation timestamp"`
+	ID                 uuid.UUID `json:"id" doc:"Plugin UUID" example:"6ba7b810-9dad-11d1-80b4-00c04fd430c8"`
+	Name               string    `json:"name" doc:"Plugin name" example:"search-indexer"`
+	Endpoint           string    `json:"endpoint" doc:"JSON-RPC endpoint URL" example:"http://search-indexer:9000/rpc"`
+	SubscribedColumns  []string  `json:"subscribed_columns" doc:"Subscribed columns" example:"[\"profile\"]"`
+	SubscribedStreams  []string  `json:"subscribed_streams" doc:"Subscribed streams" example:"[\"eu-orders\"]"`
+	Status             string    `json:"status" doc:"Plugin status: active, inactive, or paused by the watchdog" example:"active"`
+	CreatedAt          time.Time `json:"created_at" doc:"Creation timestamp" example:"2026-02-06T12:00:00Z"`
+	PoisonPolicy       string    `json:"poison_policy" doc:"What the trigger watchdog does with a cell that still fails after max_attempts redeliveries" example:"block"`
+	MaxAttempts        int       `json:"max_attempts" doc:"Watchdog redeliveries before the poison policy applies; 0 uses the server's default" example:"5"`
+	Encoding           string    `json:"encoding" doc:"Encoding of the notifications sent to the plugin" example:"json"`
+	After              string    `json:"after,omitempty" doc:"Plugin this one follows in a chain" example:"enricher"`
+	Next               []string  `json:"next" doc:"Plugins following this one in a chain" example:"[\"forwarder\"]"`
+	WritableColumns    []string  `json:"writable_columns" doc:"Columns the plugin may write derived cells to" example:"[\"profile_geo\"]"`
+	SynchronousColumns []string  `json:"synchronous_columns" doc:"Subscribed columns whose writes wait for the plugin to accept each cell" example:"[\"payments\"]"`
 }
 
 type RegisterPluginOutput struct {
@@ -50,29 +70,68 @@ type GetPluginOutput struct {
 	Body PluginResponse
 }
 
+type UpdatePluginBody struct {
+	Status       *string `json:"status,omitempty" doc:"active resumes a paused or inactive plugin; paused and inactive stop its notifications" enum:"active,inactive,paused" example:"active"`
+	PoisonPolicy *string `json:"poison_policy,omitempty" doc:"What the trigger watchdog does with a cell that still fails after max_attempts redeliveries" enum:"block,skip,pause" example:"skip"`
+	MaxAttempts  *int    `json:"max_attempts,omitempty" doc:"Watchdog redeliveries before the poison policy applies; 0 uses the server's default" minimum:"0" example:"5"`
+	Encoding     *string `json:"encoding,omitempty" doc:"Encoding of the notifications sent to the plugin" enum:"json,msgpack" example:"msgpack"`
+}
+
+type UpdatePluginInput struct {
+	PluginID string `path:"plugin_id" doc:"Plugin UUID" format:"uuid"`
+	Body     UpdatePluginBody
+}
+
+type UpdatePluginOutput struct {
+	Body PluginResponse
+}
+
 type DeletePluginInput struct {
 	PluginID string `path:"plugin_id" doc:"Plugin UUID" format:"uuid"`
 }
 
+type PluginCheckpointResponse struct {
+	ShardID   int       `json:"shard_id" doc:"Shard of the undelivered cell" example:"3"`
+	AddedID   int64     `json:"added_id" doc:"added_id of the oldest cell on the shard whose notification failed" example:"1024"`
+	UpdatedAt time.Time `json:"updated_at" doc:"When the checkpoint last moved back" example:"2026-02-06T12:00:00Z"`
+}
+
+type ListPluginCheckpointsInput struct {
+	PluginID string `path:"plugin_id" doc:"Plugin UUID" format:"uuid"`
+}
+
+type ListPluginCheckpointsOutput struct {
+	Body []PluginCheckpointResponse
+}
+
+type ReleasePluginCheckpointsInput struct {
+	PluginID string `path:"plugin_id" doc:"Plugin UUID" format:"uuid"`
+}
+
 // --- Handler ---
 
 type PluginHandler struct {
-	registry *trigger.PluginRegistry
-	logger   *slog.Logger
+	registry    *trigger.PluginRegistry
+	streams     *stream.Registry
+	checkpoints trigger.CheckpointStore // nil when checkpoints are not kept
+	logger      *slog.Logger
 }
 
-func NewPluginHandler(registry *trigger.PluginRegistry, logger *slog.Logger) *PluginHandler {
-	return &PluginHandler{registry: registry, logger: logger}
+func NewPluginHandler(registry *trigger.PluginRegistry, streams *stream.Registry, checkpoints trigger.CheckpointStore, logger *slog.Logger) *PluginHandler {
+	return &PluginHandler{registry: registry, streams: streams, checkpoints: checkpoints, logger: logger}
 }
 
-func registerPluginRoutes(api huma.API, h *PluginHandler) {
+func registerPluginRoutes(api huma.API, h *PluginHandler, maxBodyBytes int64) {
 	huma.Register(api, huma.Operation{
 		OperationID:   "register-plugin",
 		Method:        http.MethodPost,
 		Path:          "/v1/plugins",
 		Summary:       "Register a trigger plugin",
+		Description:   "Registers a JSON-RPC endpoint to be notified of writes to its subscribed columns and of the cells its subscribed streams select.",
 		Tags:          []string{"plugins"},
+		Errors:        []int{http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity, http.StatusServiceUnavailable},
 		DefaultStatus: http.StatusCreated,
+		MaxBodyBytes:  maxBodyBytes,
 	}, h.RegisterPlugin)
 
 	huma.Register(api, huma.Operation{
@@ -80,7 +139,9 @@ func registerPluginRoutes(api huma.API, h *PluginHandler) {
 		Method:      http.MethodGet,
 		Path:        "/v1/plugins",
 		Summary:     "List all plugins",
+		Description: "Lists every registered trigger plugin.",
 		Tags:        []string{"plugins"},
+		Errors:      []int{http.StatusServiceUnavailable},
 	}, h.ListPlugins)
 
 	huma.Register(api, huma.Operation{
@@ -88,39 +149,115 @@ func registerPluginRoutes(api huma.API, h *PluginHandler) {
 		Method:      http.MethodGet,
 		Path:        "/v1/plugins/{plugin_id}",
 		Summary:     "Get a plugin by ID",
+		Description: "Fetches one trigger plugin by ID.",
 		Tags:        []string{"plugins"},
+		Errors:      []int{http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable},
 	}, h.GetPlugin)
 
+	huma.Register(api, huma.Operation{
+		OperationID:  "update-plugin",
+		Method:       http.MethodPatch,
+		Path:         "/v1/plugins/{plugin_id}",
+		Summary:      "Update a plugin",
+		Description:  "Changes a plugin's status or poison policy; omitted fields are left as they are. Setting a paused plugin active resumes its notifications, and the cells held in its checkpoints meanwhile are redelivered by the watchdog or read by the plugin itself.",
+		Tags:         []string{"plugins"},
+		Errors:       []int{http.StatusBadRequest, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusServiceUnavailable},
+		MaxBodyBytes: maxBodyBytes,
+	}, h.UpdatePlugin)
+
 	huma.Register(api, huma.Operation{
 		OperationID:   "delete-plugin",
 		Method:        http.MethodDelete,
 		Path:          "/v1/plugins/{plugin_id}",
 		Summary:       "Delete a plugin",
+		Description:   "Unregisters a trigger plugin; it stops receiving notifications. A plugin others follow in a chain cannot be deleted before them.",
 		Tags:          []string{"plugins"},
+		Errors:        []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusServiceUnavailable},
 		DefaultStatus: http.StatusNoContent,
 	}, h.DeletePlugin)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "list-plugin-checkpoints",
+		Method:      http.MethodGet,
+		Path:        "/v1/plugins/{plugin_id}/checkpoints",
+		Summary:     "List a plugin's checkpoints",
+		Description: "Lists, per shard, the oldest cell whose notification to the plugin failed after all retries. A plugin catches up by reading each shard with partitionRead from the checkpoint's added_id minus one. Garbage collection keeps the plugin's columns' cells from the checkpoint on.",
+		Tags:        []string{"plugins"},
+		Errors:      []int{http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable},
+	}, h.ListPluginCheckpoints)
+
+	huma.Register(api, huma.Operation{
+		OperationID:   "release-plugin-checkpoints",
+		Method:        http.MethodDelete,
+		Path:          "/v1/plugins/{plugin_id}/checkpoints",
+		Summary:       "Release a plugin's checkpoints",
+		Description:   "Acknowledges that the plugin has caught up on its failed notifications, releasing the cells held back from garbage collection for it.",
+		Tags:          []string{"plugins"},
+		Errors:        []int{http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable},
+		DefaultStatus: http.StatusNoContent,
+	}, h.ReleasePluginCheckpoints)
 }
 
 func (h *PluginHandler) RegisterPlugin(ctx context.Context, input *RegisterPluginInput) (*RegisterPluginOutput, error) {
+	subscribes := len(input.Body.SubscribedColumns) > 0 || len(input.Body.SubscribedStreams) > 0
+	switch {
+	case input.Body.After != "" && subscribes:
+		return nil, huma.Error422UnprocessableEntity("a chained plugin receives the cells of the plugin it follows: omit subscribed_columns and subscribed_streams")
+	case input.Body.After != "":
+		if _, ok := h.pluginByName(input.Body.After); !ok {
+			return nil, huma.Error422UnprocessableEntity("unknown plugin " + input.Body.After)
+		}
+	case !subscribes:
+		return nil, huma.Error422UnprocessableEntity("plugin subscribes to nothing: set subscribed_columns or subscribed_streams")
+	}
+	for _, columns := range [][]string{input.Body.SubscribedColumns, input.Body.WritableColumns, input.Body.SynchronousColumns} {
+		for _, name := range columns {
+			if err := cell.ValidateColumnName(name); err != nil {
+				return nil, huma.Error422UnprocessableEntity(err.Error())
+			}
+		}
+	}
+	for _, name := range input.Body.SubscribedStreams {
+		if _, ok := h.streams.Get(name); !ok {
+			return nil, huma.Error422UnprocessableEntity("unknown stream " + name)
+		}
+	}
+	for _, name := range input.Body.SynchronousColumns {
+		if !slices.Contains(input.Body.SubscribedColumns, name) {
+			return nil, huma.Error422UnprocessableEntity("synchronous column " + name + " is not a subscribed column")
+		}
+	}
+	for _, name := range input.Body.WritableColumns {
+		if cell.IsReserved(name) {
+			return nil, huma.Error422UnprocessableEntity(fmt.Sprintf("column %q is reserved: names starting with %q are for system use", name, cell.ReservedPrefix))
+		}
+	}
 	p := &trigger.Plugin{
-		Name:              input.Body.Name,
-		Endpoint:          input.Body.Endpoint,
-		SubscribedColumns: input.Body.SubscribedColumns,
+		Name:               input.Body.Name,
+		Endpoint:           input.Body.Endpoint,
+		SubscribedColumns:  input.Body.SubscribedColumns,
+		SubscribedStreams:  input.Body.SubscribedStreams,
+		PoisonPolicy:       trigger.PoisonPolicy(input.Body.PoisonPolicy),
+		MaxAttempts:        input.Body.MaxAttempts,
+		Encoding:           input.Body.Encoding,
+		After:              input.Body.After,
+		WritableColumns:    input.Body.WritableColumns,
+		SynchronousColumns: input.Body.SynchronousColumns,
 	}
 	if err := h.registry.Register(ctx, p); err != nil {
 		return nil, huma.Error409Conflict(err.Error())
 	}
 
-	h.logger.Info("plugin registered", "id", p.ID, "name", p.Name, "endpoint", p.Endpoint)
+	h.logger.Info("plugin registered", "id", p.ID, "name", p.Name, "endpoint", p.Endpoint, "after", p.After)
 
-	return &RegisterPluginOutput{Body: pluginToResponse(p)}, nil
+	return &RegisterPluginOutput{Body: h.pluginToResponse(p)}, nil
 }
 
 func (h *PluginHandler) ListPlugins(ctx context.Context, input *ListPluginsInput) (*ListPluginsOutput, error) {
 	plugins := h.registry.List()
 	resp := make([]PluginResponse, len(plugins))
 	for i, p := range plugins {
-		resp[i] = pluginToResponse(p)
+		resp[i] = h.pluginToResponse(p)
 	}
 	return &ListPluginsOutput{Body: resp}, nil
 }
@@ -136,7 +273,36 @@ func (h *PluginHandler) GetPlugin(ctx context.Context, input *GetPluginInput) (*
 		return nil, huma.Error404NotFound("plugin not found")
 	}
 
-	return &GetPluginOutput{Body: pluginToResponse(p)}, nil
+	return &GetPluginOutput{Body: h.pluginToResponse(p)}, nil
+}
+
+func (h *PluginHandler) UpdatePlugin(ctx context.Context, input *UpdatePluginInput) (*UpdatePluginOutput, error) {
+	p, err := h.pluginByID(input.PluginID)
+	if err != nil {
+		return nil, err
+	}
+	body := input.Body
+	p, err = h.registry.Update(ctx, p.ID, func(p *trigger.Plugin) {
+		if body.Status != nil {
+			p.Status = trigger.PluginStatus(*body.Status)
+		}
+		if body.PoisonPolicy != nil {
+			p.PoisonPolicy = trigger.PoisonPolicy(*body.PoisonPolicy)
+		}
+		if body.MaxAttempts != nil {
+			p.MaxAttempts = *body.MaxAttempts
+		}
+		if body.Encoding != nil {
+			p.Encoding = *body.Encoding
+		}
+	})
+	if err != nil {
+		h.logger.Error("failed to update plugin", "id", input.PluginID, "error", err)
+		return nil, huma.Error503ServiceUnavailable("plugin store unavailable")
+	}
+
+	h.logger.Info("plugin updated", "id", p.ID, "name", p.Name, "status", p.Status, "poison_policy", p.Policy(), "max_attempts", p.MaxAttempts, "encoding", p.EncodingName())
+	return &UpdatePluginOutput{Body: h.pluginToResponse(p)}, nil
 }
 
 func (h *PluginHandler) DeletePlugin(ctx context.Context, input *DeletePluginInput) (*struct{}, error) {
@@ -145,6 +311,13 @@ func (h *PluginHandler) DeletePlugin(ctx context.Context, input *DeletePluginInp
 		return nil, huma.Error400BadRequest("invalid plugin_id")
 	}
 
+	p, err := h.registry.Get(id)
+	if err != nil {
+		return nil, huma.Error404NotFound("plugin not found")
+	}
+	if next := h.nextNames(p); len(next) > 0 {
+		return nil, huma.Error409Conflict("plugin is followed by: " + strings.Join(next, ", "))
+	}
 	if err := h.registry.Delete(id); err != nil {
 		return nil, huma.Error404NotFound("plugin not found")
 	}
@@ -153,13 +326,106 @@ func (h *PluginHandler) DeletePlugin(ctx context.Context, input *DeletePluginInp
 	return nil, nil
 }
 
-func pluginToResponse(p *trigger.Plugin) PluginResponse {
-	return PluginResponse{
-		ID:                p.ID,
-		Name:              p.Name,
-		Endpoint:          p.Endpoint,
-		SubscribedColumns: p.SubscribedColumns,
-		Status:            string(p.Status),
-		CreatedAt:         p.CreatedAt,
+func (h *PluginHandler) ListPluginCheckpoints(ctx context.Context, input *ListPluginCheckpointsInput) (*ListPluginCheckpointsOutput, error) {
+	p, err := h.pluginByID(input.PluginID)
+	if err != nil {
+		return nil, err
+	}
+	resp := []PluginCheckpointResponse{}
+	if h.checkpoints == nil {
+		return &ListPluginCheckpointsOutput{Body: resp}, nil
+	}
+	checkpoints, err := h.checkpoints.ListCheckpoints(ctx)
+	if err != nil {
+		h.logger.Error("failed to list trigger checkpoints", "error", err)
+		return nil, huma.Error503ServiceUnavailable("checkpoints unavailable")
+	}
+	for _, c := range checkpoints {
+		if c.PluginID == p.ID {
+			resp = append(resp, PluginCheckpointResponse{ShardID: c.ShardID, AddedID: c.AddedID, UpdatedAt: c.UpdatedAt})
+		}
+	}
+	return &ListPluginCheckpointsOutput{Body: resp}, nil
+}
+
+func (h *PluginHandler) ReleasePluginCheckpoints(ctx context.Context, input *ReleasePluginCheckpointsInput) (*struct{}, error) {
+	p, err := h.pluginByID(input.PluginID)
+	if err != nil {
+		return nil, err
+	}
+	if h.checkpoints == nil {
+		return nil, nil
+	}
+	n, err := h.checkpoints.ReleaseCheckpoints(ctx, p.ID)
+	if err != nil {
+		h.logger.Error("failed to release trigger checkpoints", "plugin", p.Name, "error", err)
+		return nil, huma.Error503ServiceUnavailable("checkpoints unavailable")
+	}
+	h.logger.Info("plugin checkpoints released", "id", p.ID, "name", p.Name, "shards", n)
+	return nil, nil
+}
+
+// pluginByID parses a plugin_id path parameter and looks the plugin up.
+func (h *PluginHandler) pluginByID(pluginID string) (*trigger.Plugin, error) {
+	id, err := uuid.Parse(pluginID)
+	if err != nil {
+		return nil, huma.Error400BadRequest("invalid plugin_id")
+	}
+	p, err := h.registry.Get(id)
+	if err != nil {
+		return nil, huma.Error404NotFound("plugin not found")
+	}
+	return p, nil
+}
+
+// pluginByName returns the registered plugin with the given name.
+func (h *PluginHandler) pluginByName(name string) (*trigger.Plugin, bool) {
+	for _, p := range h.registry.List() {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// nextNames returns the names of the plugins chained after p.
+func (h *PluginHandler) nextNames(p *trigger.Plugin) []string {
+	next := h.registry.Next(p.Name)
+	names := make([]string, len(next))
+	for i, q := range next {
+		names[i] = q.Name
+	}
+	return names
+}
+
+func (h *PluginHandler) pluginToResponse(p *trigger.Plugin) PluginResponse {
+	resp := PluginResponse{
+		ID:                 p.ID,
+		Name:               p.Name,
+		Endpoint:           p.Endpoint,
+		SubscribedColumns:  p.SubscribedColumns,
+		SubscribedStreams:  p.SubscribedStreams,
+		Status:             string(p.Status),
+		CreatedAt:          p.CreatedAt,
+		PoisonPolicy:       string(p.Policy()),
+		MaxAttempts:        p.MaxAttempts,
+		Encoding:           p.EncodingName(),
+		After:              p.After,
+		Next:               h.nextNames(p),
+		WritableColumns:    p.WritableColumns,
+		SynchronousColumns: p.SynchronousColumns,
+	}
+	if resp.SubscribedColumns == nil {
+		resp.SubscribedColumns = []string{}
+	}
+	if resp.SubscribedStreams == nil {
+		resp.SubscribedStreams = []string{}
+	}
+	if resp.WritableColumns == nil {
+		resp.WritableColumns = []string{}
+	}
+	if resp.SynchronousColumns == nil {
+		resp.SynchronousColumns = []string{}
 	}
+	return resp
 }
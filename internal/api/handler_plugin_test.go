@@ -16,7 +16,7 @@ import (
 
 func setupPluginTestServer() http.Handler {
 	registry := trigger.NewPluginRegistry()
-	return NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), registry, nil, 64, nil)
+	return NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), registry, nil, 64, nil, ServerOptions{})
 }
 
 func TestRegisterPlugin_Success(t *testing.T) {
@@ -49,11 +49,62 @@ func TestRegisterPlugin_Success(t *testing.T) {
 	if resp.Status != "active" {
 		t.Errorf("Status: got %q", resp.Status)
 	}
+	if resp.PoisonPolicy != "block" {
+		t.Errorf("PoisonPolicy: got %q, want block", resp.PoisonPolicy)
+	}
+	if resp.Encoding != "json" {
+		t.Errorf("Encoding: got %q, want json", resp.Encoding)
+	}
 	if resp.ID == uuid.Nil {
 		t.Error("expected non-nil ID")
 	}
 }
 
+func TestUpdatePlugin(t *testing.T) {
+	registry := trigger.NewPluginRegistry()
+	p := &trigger.Plugin{Name: "billing", Endpoint: "http://billing:9001/rpc", SubscribedColumns: []string{"billing"}, Status: trigger.PluginStatusPaused}
+	if err := registry.Register(context.Background(), p); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), registry, nil, 64, nil, ServerOptions{})
+
+	patch := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/v1/plugins/"+p.ID.String(), bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	w := patch(`{"status":"active","poison_policy":"skip","max_attempts":5,"encoding":"msgpack"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, body: %s", w.Code, w.Body.String())
+	}
+	var resp PluginResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Status != "active" || resp.PoisonPolicy != "skip" || resp.MaxAttempts != 5 || resp.Encoding != "msgpack" {
+		t.Errorf("response: got %+v", resp)
+	}
+
+	// Omitted fields are kept.
+	w = patch(`{"max_attempts":0}`)
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.PoisonPolicy != "skip" || resp.MaxAttempts != 0 {
+		t.Errorf("response: got %+v", resp)
+	}
+
+	if w := patch(`{"poison_policy":"retry"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("unknown policy: got %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+	if w := patch(`{"encoding":"protobuf"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("unknown encoding: got %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+}
+
 func TestRegisterPlugin_DuplicateName(t *testing.T) {
 	server := setupPluginTestServer()
 
@@ -149,7 +200,7 @@ func TestListPlugins_Empty(t *testing.T) {
 
 func TestListPlugins_AfterRegister(t *testing.T) {
 	registry := trigger.NewPluginRegistry()
-	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), registry, nil, 64, nil)
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), registry, nil, 64, nil, ServerOptions{})
 
 	// Register a plugin
 	body := map[string]any{
@@ -187,7 +238,7 @@ func TestListPlugins_AfterRegister(t *testing.T) {
 
 func TestGetPlugin_Success(t *testing.T) {
 	registry := trigger.NewPluginRegistry()
-	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), registry, nil, 64, nil)
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), registry, nil, 64, nil, ServerOptions{})
 
 	// Register
 	p := &trigger.Plugin{
@@ -242,7 +293,7 @@ func TestGetPlugin_InvalidID(t *testing.T) {
 
 func TestDeletePlugin_Success(t *testing.T) {
 	registry := trigger.NewPluginRegistry()
-	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), registry, nil, 64, nil)
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), registry, nil, 64, nil, ServerOptions{})
 
 	p := &trigger.Plugin{
 		Name:              "test",
@@ -267,6 +318,110 @@ func TestDeletePlugin_Success(t *testing.T) {
 	}
 }
 
+func TestPluginChains(t *testing.T) {
+	registry := trigger.NewPluginRegistry()
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), registry, nil, 64, nil, ServerOptions{})
+
+	if w := doJSON(server, http.MethodPost, "/v1/plugins", `{"name":"enricher","endpoint":"http://enricher:9000/rpc","subscribed_columns":["orders"]}`); w.Code != http.StatusCreated {
+		t.Fatalf("register enricher: got %d, body: %s", w.Code, w.Body.String())
+	}
+	for _, body := range []string{
+		`{"name":"forwarder","endpoint":"http://forwarder:9000/rpc","after":"missing"}`,
+		`{"name":"forwarder","endpoint":"http://forwarder:9000/rpc","after":"enricher","subscribed_columns":["orders"]}`,
+	} {
+		if w := doJSON(server, http.MethodPost, "/v1/plugins", body); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("register %s: got %d, want 422", body, w.Code)
+		}
+	}
+	w := doJSON(server, http.MethodPost, "/v1/plugins", `{"name":"forwarder","endpoint":"http://forwarder:9000/rpc","after":"enricher"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register forwarder: got %d, body: %s", w.Code, w.Body.String())
+	}
+	var forwarder PluginResponse
+	if err := json.NewDecoder(w.Body).Decode(&forwarder); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if forwarder.After != "enricher" {
+		t.Errorf("after: got %q, want enricher", forwarder.After)
+	}
+
+	var enricher *trigger.Plugin
+	for _, p := range registry.List() {
+		if p.Name == "enricher" {
+			enricher = p
+		}
+	}
+	w = doJSON(server, http.MethodGet, "/v1/plugins/"+enricher.ID.String(), "")
+	var resp PluginResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Next) != 1 || resp.Next[0] != "forwarder" {
+		t.Errorf("next: got %v, want [forwarder]", resp.Next)
+	}
+
+	if w := doJSON(server, http.MethodDelete, "/v1/plugins/"+enricher.ID.String(), ""); w.Code != http.StatusConflict {
+		t.Errorf("delete followed plugin: got %d, want 409", w.Code)
+	}
+	if w := doJSON(server, http.MethodDelete, "/v1/plugins/"+forwarder.ID.String(), ""); w.Code != http.StatusNoContent {
+		t.Errorf("delete forwarder: got %d, want 204", w.Code)
+	}
+	if w := doJSON(server, http.MethodDelete, "/v1/plugins/"+enricher.ID.String(), ""); w.Code != http.StatusNoContent {
+		t.Errorf("delete enricher after its chain: got %d, want 204", w.Code)
+	}
+}
+
+func TestRegisterPlugin_WritableColumns(t *testing.T) {
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil, ServerOptions{})
+
+	if w := doJSON(server, http.MethodPost, "/v1/plugins", `{"name":"geo","endpoint":"http://geo:9000/rpc","subscribed_columns":["profile"],"writable_columns":["_mezz.provenance.profile"]}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("reserved writable column: got %d, want 422", w.Code)
+	}
+	w := doJSON(server, http.MethodPost, "/v1/plugins", `{"name":"geo","endpoint":"http://geo:9000/rpc","subscribed_columns":["profile"],"writable_columns":["profile_geo"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register: got %d, body: %s", w.Code, w.Body.String())
+	}
+	var resp PluginResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.WritableColumns) != 1 || resp.WritableColumns[0] != "profile_geo" {
+		t.Errorf("writable_columns: got %v, want [profile_geo]", resp.WritableColumns)
+	}
+}
+
+func TestRegisterPlugin_SynchronousColumns(t *testing.T) {
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil, ServerOptions{})
+
+	if w := doJSON(server, http.MethodPost, "/v1/plugins", `{"name":"validator","endpoint":"http://validator:9000/rpc","subscribed_columns":["orders"],"synchronous_columns":["payments"]}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("unsubscribed synchronous column: got %d, want 422", w.Code)
+	}
+	w := doJSON(server, http.MethodPost, "/v1/plugins", `{"name":"validator","endpoint":"http://validator:9000/rpc","subscribed_columns":["payments"],"synchronous_columns":["payments"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register: got %d, body: %s", w.Code, w.Body.String())
+	}
+	var resp PluginResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.SynchronousColumns) != 1 || resp.SynchronousColumns[0] != "payments" {
+		t.Errorf("synchronous_columns: got %v, want [payments]", resp.SynchronousColumns)
+	}
+}
+
+func TestRegisterPlugin_InvalidColumnName(t *testing.T) {
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil, ServerOptions{})
+
+	for _, body := range []string{
+		`{"name":"geo","endpoint":"http://geo:9000/rpc","subscribed_columns":["pro file"]}`,
+		`{"name":"geo","endpoint":"http://geo:9000/rpc","subscribed_columns":["profile"],"writable_columns":["geo\"x"]}`,
+	} {
+		if w := doJSON(server, http.MethodPost, "/v1/plugins", body); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("register %s: got %d, want 422", body, w.Code)
+		}
+	}
+}
+
 func TestDeletePlugin_NotFound(t *testing.T) {
 	server := setupPluginTestServer()
 
@@ -278,3 +433,74 @@ func TestDeletePlugin_NotFound(t *testing.T) {
 		t.Errorf("status: got %d, want %d", w.Code, http.StatusNotFound)
 	}
 }
+
+// fakeCheckpoints is a CheckpointStore holding a fixed list.
+type fakeCheckpoints struct {
+	list []trigger.Checkpoint
+}
+
+func (f *fakeCheckpoints) HoldCheckpoint(context.Context, uuid.UUID, int, int64) error { return nil }
+
+func (f *fakeCheckpoints) AdvanceCheckpoint(context.Context, uuid.UUID, int, int64, int64) (bool, error) {
+	return false, nil
+}
+
+func (f *fakeCheckpoints) ListCheckpoints(context.Context) ([]trigger.Checkpoint, error) {
+	return f.list, nil
+}
+
+func (f *fakeCheckpoints) ReleaseCheckpoints(_ context.Context, pluginID uuid.UUID) (int64, error) {
+	var kept []trigger.Checkpoint
+	for _, c := range f.list {
+		if c.PluginID != pluginID {
+			kept = append(kept, c)
+		}
+	}
+	n := int64(len(f.list) - len(kept))
+	f.list = kept
+	return n, nil
+}
+
+func TestPluginCheckpoints_ListAndRelease(t *testing.T) {
+	registry := trigger.NewPluginRegistry()
+	p := &trigger.Plugin{Name: "test", Endpoint: "http://localhost:9000/rpc", SubscribedColumns: []string{"profile"}}
+	if err := registry.Register(context.Background(), p); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	checkpoints := &fakeCheckpoints{list: []trigger.Checkpoint{
+		{PluginID: p.ID, ShardID: 3, AddedID: 7},
+		{PluginID: uuid.New(), ShardID: 4, AddedID: 9},
+	}}
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), registry, nil, 64, nil, ServerOptions{TriggerCheckpoints: checkpoints})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/plugins/"+p.ID.String()+"/checkpoints", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list status: got %d\nbody: %s", w.Code, w.Body.String())
+	}
+	var got []PluginCheckpointResponse
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(got) != 1 || got[0].ShardID != 3 || got[0].AddedID != 7 {
+		t.Errorf("checkpoints: got %+v", got)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/v1/plugins/"+p.ID.String()+"/checkpoints", nil)
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("release status: got %d\nbody: %s", w.Code, w.Body.String())
+	}
+	if len(checkpoints.list) != 1 || checkpoints.list[0].PluginID == p.ID {
+		t.Errorf("after release: got %+v", checkpoints.list)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/plugins/"+uuid.New().String()+"/checkpoints", nil)
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown plugin: got %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,291 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/schema"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// --- Request/Response types ---
+
+type QueryPredicate struct {
+	Field  string `json:"field" doc:"Body field, with dots for nested fields; the column's registered schema must declare it a string, number, integer or boolean" required:"true" minLength:"1" example:"status"`
+	Op     string `json:"op" doc:"Comparison: eq, ne (also matches cells without the field), lt, lte, gt, gte (not for booleans) or in" required:"true" enum:"eq,ne,lt,lte,gt,gte,in" example:"eq"`
+	Value  any    `json:"value,omitempty" doc:"Value to compare with, of the field's type; for every op but in" example:"\"open\""`
+	Values []any  `json:"values,omitempty" doc:"Values to compare with, of the field's type; for in" maxItems:"100" example:"[\"open\",\"paid\"]"`
+}
+
+type QueryOrderBy struct {
+	Field string `json:"field" doc:"Body field to sort by, typed like a predicate's; cells without a value for it come last" required:"true" minLength:"1" example:"total"`
+	Desc  bool   `json:"desc,omitempty" doc:"Sort in descending order" example:"true"`
+}
+
+type QueryCellsBody struct {
+	Column  string           `json:"column" doc:"Column whose cells to query" required:"true" minLength:"1" example:"orders"`
+	ShardID int              `json:"shard_id" doc:"Shard to query" required:"true" minimum:"0" example:"3"`
+	Where   []QueryPredicate `json:"where,omitempty" doc:"Predicates every returned cell's body satisfies" maxItems:"16"`
+	OrderBy *QueryOrderBy    `json:"order_by,omitempty" doc:"Sort order; by default cells come in row_key order. Ties are broken by row_key"`
+	Limit   int              `json:"limit,omitempty" doc:"Maximum number of cells to return" minimum:"0" example:"50"`
+	Mask    []string         `json:"mask,omitempty" doc:"Fields to remove from the returned bodies; nested fields use dots" example:"[\"email\"]"`
+}
+
+type QueryCellsInput struct {
+	Body QueryCellsBody
+}
+
+type QueryCellsOutput struct {
+	Body []CellResponse
+}
+
+type ScanCellsBody struct {
+	Column  string           `json:"column" doc:"Column whose cells to query" required:"true" minLength:"1" example:"orders"`
+	Where   []QueryPredicate `json:"where,omitempty" doc:"Predicates every returned cell's body satisfies" maxItems:"16"`
+	OrderBy *QueryOrderBy    `json:"order_by,omitempty" doc:"Sort order; by default cells come in row_key order. Ties are broken by row_key"`
+	Limit   int              `json:"limit,omitempty" doc:"Maximum number of cells to return" minimum:"0" example:"50"`
+	Mask    []string         `json:"mask,omitempty" doc:"Fields to remove from the returned bodies; nested fields use dots" example:"[\"email\"]"`
+}
+
+type ScanCellsInput struct {
+	Partial bool `query:"partial" doc:"When the scan is over the server's query budget, return the cells of the shards within it instead of failing with 422; when some shards fail, answer with 207, listing them under shard_errors, instead of failing the request"`
+	Body    ScanCellsBody
+}
+
+type ScanCellsResponse struct {
+	Cells       []CellResponse `json:"cells" doc:"Matching cells"`
+	Partial     bool           `json:"partial,omitempty" doc:"Set when some shards were not read, with partial=true" example:"false"`
+	Unread      []int          `json:"unread,omitempty" doc:"Shards not read because the request exceeded the server's query budget or they failed; only with partial=true" example:"[2,3]"`
+	ShardErrors []ShardError   `json:"shard_errors,omitempty" doc:"Shards that failed to be read, making the response 207; only with partial=true"`
+}
+
+type ScanCellsOutput struct {
+	Status int
+	Body   ScanCellsResponse
+}
+
+// --- Handler ---
+
+type QueryHandler struct {
+	router     *shard.Router
+	numShards  int
+	schemas    *schema.Registry
+	limits     Limits
+	maskSecret []byte
+	acl        rowACL
+	scatter    ScatterLimits
+	logger     *slog.Logger
+}
+
+func NewQueryHandler(router *shard.Router, numShards int, opts ServerOptions, logger *slog.Logger) *QueryHandler {
+	return &QueryHandler{router: router, numShards: numShards, schemas: opts.Schemas, limits: opts.Limits, maskSecret: opts.MaskHashSecret, acl: rowACL{mode: opts.RowACL, logger: logger}, scatter: opts.Scatter, logger: logger}
+}
+
+func registerQueryRoutes(api huma.API, h *QueryHandler) {
+	huma.Register(api, huma.Operation{
+		OperationID: "query-cells",
+		Method:      http.MethodPost,
+		Path:        "/v1/query",
+		Summary:     "Query a column's cells by their bodies",
+		Description: fmt.Sprintf("Returns the latest cells of a column on one shard whose bodies satisfy every predicate, sorted by a body field or by row_key, for ad-hoc lookups that do not justify a secondary index. Predicates and sorting apply to fields the column's registered schema declares a string, number, integer or boolean, compared as that type; a body holding another type there does not match. The query runs as one parameterized SQL statement, without an index, so it reads the whole column on the shard. It returns %d cells unless limit asks otherwise, up to %d; there is no next page.", h.limits.Query.Default, h.limits.Query.Max),
+		Tags:        []string{"cells"},
+		Errors:      []int{http.StatusBadRequest, http.StatusForbidden, http.StatusUnprocessableEntity, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	}, h.QueryCells)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "scan-cells",
+		Method:      http.MethodPost,
+		Path:        "/v1/query:scan",
+		Summary:     "Query a column's cells on every shard",
+		Description: "Runs a query like query-cells on every shard at once and returns the first cells of all of them, in the query's order. It reads the whole column on every shard, so it is bounded by the server's scatter-gather budget: a scan reading more shards, or gathering more cells, than it allows fails with 422, or with partial=true returns what fits.",
+		Tags:        []string{"cells"},
+		Errors:      []int{http.StatusBadRequest, http.StatusForbidden, http.StatusUnprocessableEntity, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	}, h.ScanCells)
+}
+
+// compileQuery checks a query against the column's registered schema, which
+// types its fields, and against the request's masking policy: masked fields
+// cannot be filtered or sorted on.
+func (h *QueryHandler) compileQuery(ctx context.Context, body QueryCellsBody) (storage.Query, error) {
+	q := storage.Query{Column: body.Column, Limit: h.limits.Query.Apply(body.Limit)}
+	sc, ok := h.schemas.Latest(body.Column)
+	if !ok {
+		return q, huma.Error400BadRequest(fmt.Sprintf("column %q has no registered schema to type its fields", body.Column))
+	}
+	mask := readMask(ctx, nil, h.maskSecret)
+	fieldType := func(field string) (storage.FieldType, error) {
+		if mask.covers(field) {
+			return "", huma.Error403Forbidden(fmt.Sprintf("field %q is masked for this API key", field))
+		}
+		switch sc.FieldType(field) {
+		case "string":
+			return storage.TypeString, nil
+		case "number", "integer":
+			return storage.TypeNumber, nil
+		case "boolean":
+			return storage.TypeBoolean, nil
+		}
+		return "", huma.Error400BadRequest(fmt.Sprintf("schema v%d of column %q does not declare field %q a string, number, integer or boolean", sc.Version, body.Column, field))
+	}
+
+	for _, w := range body.Where {
+		t, err := fieldType(w.Field)
+		if err != nil {
+			return q, err
+		}
+		p := storage.Predicate{Field: w.Field, Type: t, Op: storage.QueryOp(w.Op), Values: w.Values}
+		if p.Op != storage.QueryIn {
+			if w.Values != nil || w.Value == nil {
+				return q, huma.Error400BadRequest(fmt.Sprintf("%s on %q takes a value", w.Op, w.Field))
+			}
+			p.Values = []any{w.Value}
+		} else if w.Value != nil {
+			return q, huma.Error400BadRequest(fmt.Sprintf("in on %q takes values", w.Field))
+		}
+		q.Where = append(q.Where, p)
+	}
+	if o := body.OrderBy; o != nil {
+		t, err := fieldType(o.Field)
+		if err != nil {
+			return q, err
+		}
+		q.OrderBy = &storage.QueryOrder{Field: o.Field, Type: t, Desc: o.Desc}
+	}
+	if err := q.Check(); err != nil {
+		return q, huma.Error400BadRequest(err.Error())
+	}
+	return q, nil
+}
+
+// QueryCells runs a query on one shard.
+func (h *QueryHandler) QueryCells(ctx context.Context, input *QueryCellsInput) (*QueryCellsOutput, error) {
+	// A query reads rows of every tenant on the shard.
+	if err := h.acl.scan(ctx, "query"); err != nil {
+		return nil, err
+	}
+	if input.Body.ShardID >= h.numShards {
+		return nil, huma.Error400BadRequest("invalid shard_id")
+	}
+	q, err := h.compileQuery(ctx, input.Body)
+	if err != nil {
+		return nil, err
+	}
+	if hidden(ctx, q.Column) {
+		return &QueryCellsOutput{Body: []CellResponse{}}, nil
+	}
+	store, err := h.router.StoreFor(shard.ID(input.Body.ShardID))
+	if err != nil {
+		h.logger.Error("shard routing failed", "shard_id", input.Body.ShardID, "error", err)
+		return nil, huma.Error500InternalServerError("shard routing failed")
+	}
+
+	cells, err := storage.QueryCells(ctx, store, q)
+	if errors.Is(err, storage.ErrQueryUnsupported) {
+		return nil, huma.Error400BadRequest("the store does not support queries")
+	}
+	if err != nil {
+		h.logger.Error("failed to query cells", "shard_id", input.Body.ShardID, "column_name", q.Column, "error", err)
+		return nil, failed(ctx, err, "failed to query cells")
+	}
+
+	mask := readMask(ctx, input.Body.Mask, h.maskSecret)
+	resp := make([]CellResponse, len(cells))
+	for i := range cells {
+		resp[i] = cellToResponse(mask.cell(&cells[i]))
+	}
+	return &QueryCellsOutput{Body: resp}, nil
+}
+
+// ScanCells runs a query on every shard, each for the query's limit, and
+// returns the first of their cells in the query's order.
+func (h *QueryHandler) ScanCells(ctx context.Context, input *ScanCellsInput) (*ScanCellsOutput, error) {
+	if err := h.acl.scan(ctx, "query"); err != nil {
+		return nil, err
+	}
+	b := input.Body
+	q, err := h.compileQuery(ctx, QueryCellsBody{Column: b.Column, Where: b.Where, OrderBy: b.OrderBy, Limit: b.Limit, Mask: b.Mask})
+	if err != nil {
+		return nil, err
+	}
+	if hidden(ctx, q.Column) {
+		return &ScanCellsOutput{Status: http.StatusOK, Body: ScanCellsResponse{Cells: []CellResponse{}}}, nil
+	}
+
+	budget, readCtx := newScatterBudget(ctx, h.scatter, "query_scan", input.Partial)
+	defer budget.done()
+	n, err := budget.shards(h.numShards)
+	if err != nil {
+		return nil, err
+	}
+	var unread []int
+	for i := n; i < h.numShards; i++ {
+		unread = append(unread, i)
+	}
+
+	results := make([][]cell.Cell, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		store, err := h.router.StoreFor(shard.ID(i))
+		if err != nil {
+			h.logger.Error("shard routing failed", "shard_id", i, "error", err)
+			return nil, huma.Error500InternalServerError("shard routing failed")
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if results[i], errs[i] = storage.QueryCells(readCtx, store, q); errs[i] == nil {
+				budget.spend(len(results[i]))
+			}
+		}()
+	}
+	wg.Wait()
+	if err := budget.checkCells(); err != nil {
+		return nil, err
+	}
+
+	var cells []cell.Cell
+	var shardErrs []ShardError
+	for i, err := range errs {
+		switch {
+		case errors.Is(err, storage.ErrQueryUnsupported):
+			return nil, huma.Error400BadRequest("the store does not support queries")
+		case budget.cancelled(ctx, err):
+			unread = append(unread, i)
+		case err != nil:
+			h.logger.Error("failed to query cells", "shard_id", i, "column_name", q.Column, "error", err)
+			e, ferr := budget.shardFailed(ctx, shard.ID(i), err, "failed to query cells")
+			if ferr != nil || len(shardErrs)+1 == n {
+				return nil, failed(ctx, err, "failed to query cells")
+			}
+			shardErrs = append(shardErrs, e)
+			unread = append(unread, i)
+		default:
+			cells = append(cells, results[i]...)
+		}
+	}
+	storage.SortQueryResults(cells, q)
+	limit := q.Limit
+	if h.scatter.MaxCells > 0 {
+		limit = min(limit, h.scatter.MaxCells)
+	}
+	cells = cells[:min(len(cells), limit)]
+
+	mask := readMask(ctx, b.Mask, h.maskSecret)
+	resp := ScanCellsResponse{Cells: make([]CellResponse, len(cells)), ShardErrors: shardErrs}
+	for i := range cells {
+		resp.Cells[i] = cellToResponse(mask.cell(&cells[i]))
+	}
+	slices.Sort(unread)
+	resp.Unread = unread
+	resp.Partial = len(unread) > 0
+	return &ScanCellsOutput{Status: multiStatus(shardErrs), Body: resp}, nil
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/apikey"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/schema"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+)
+
+const ordersSchema = `{"type": "object", "properties": {
+	"status": {"type": "string"},
+	"total": {"type": "number"},
+	"paid": {"type": "boolean"},
+	"customer": {"type": "object", "properties": {"email": {"type": "string"}}}
+}}`
+
+func setupQueryServer(t *testing.T) (http.Handler, *memory.Store) {
+	t.Helper()
+	store := memory.New()
+	r := shard.NewRouter()
+	for i := range 2 {
+		r.Register(shard.ID(i), store)
+	}
+	schemas := schema.NewRegistry()
+	if _, _, err := schemas.Register(context.Background(), "orders", json.RawMessage(ordersSchema)); err != nil {
+		t.Fatalf("Register schema: %v", err)
+	}
+	keys := apikey.NewSet(&apikey.Config{Keys: []apikey.Key{
+		{Name: "backend", SHA256: sha256Hex("backend-token")},
+		{Name: "support", SHA256: sha256Hex("support-token"), Mask: []string{"customer.email"}},
+	}})
+	return NewServer(testLogger(), r, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 2, nil, ServerOptions{APIKeys: keys, Schemas: schemas}), store
+}
+
+func TestQueryCells(t *testing.T) {
+	server, store := setupQueryServer(t)
+	for i, body := range []string{
+		`{"status":"open","total":30,"paid":true}`,
+		`{"status":"open","total":5,"paid":false}`,
+		`{"status":"closed","total":50,"paid":true}`,
+	} {
+		req := cell.WriteCellRequest{RowKey: uuid.New(), ColumnName: "orders", RefKey: int64(i + 1), Body: json.RawMessage(body)}
+		if _, err := store.WriteCell(context.Background(), req); err != nil {
+			t.Fatalf("WriteCell: %v", err)
+		}
+	}
+
+	w := aclRequest(server, "backend-token", http.MethodPost, "/v1/query", map[string]any{
+		"column":   "orders",
+		"shard_id": 0,
+		"where": []map[string]any{
+			{"field": "status", "op": "in", "values": []string{"open", "pending"}},
+			{"field": "total", "op": "gte", "value": 5},
+		},
+		"order_by": map[string]any{"field": "total", "desc": true},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200: %s", w.Code, w.Body)
+	}
+	var cells []CellResponse
+	if err := json.NewDecoder(w.Body).Decode(&cells); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(cells) != 2 || cells[0].RefKey != 1 || cells[1].RefKey != 2 {
+		t.Errorf("cells: got %+v, want ref_keys 1 and 2", cells)
+	}
+}
+
+func TestQueryCells_Rejected(t *testing.T) {
+	server, _ := setupQueryServer(t)
+	for _, tc := range []struct {
+		name  string
+		token string
+		body  map[string]any
+		want  int
+	}{
+		{"no schema", "backend-token", map[string]any{"column": "profile", "shard_id": 0}, http.StatusBadRequest},
+		{"untyped field", "backend-token", map[string]any{"column": "orders", "shard_id": 0,
+			"where": []map[string]any{{"field": "note", "op": "eq", "value": "x"}}}, http.StatusBadRequest},
+		{"wrong value type", "backend-token", map[string]any{"column": "orders", "shard_id": 0,
+			"where": []map[string]any{{"field": "total", "op": "eq", "value": "5"}}}, http.StatusBadRequest},
+		{"ordered boolean", "backend-token", map[string]any{"column": "orders", "shard_id": 0,
+			"where": []map[string]any{{"field": "paid", "op": "lt", "value": true}}}, http.StatusBadRequest},
+		{"missing value", "backend-token", map[string]any{"column": "orders", "shard_id": 0,
+			"where": []map[string]any{{"field": "status", "op": "eq"}}}, http.StatusBadRequest},
+		{"bad shard", "backend-token", map[string]any{"column": "orders", "shard_id": 2}, http.StatusBadRequest},
+		{"masked field", "support-token", map[string]any{"column": "orders", "shard_id": 0,
+			"order_by": map[string]any{"field": "customer.email"}}, http.StatusForbidden},
+		{"object holding a masked field", "support-token", map[string]any{"column": "orders", "shard_id": 0,
+			"where": []map[string]any{{"field": "customer", "op": "eq", "value": "x"}}}, http.StatusForbidden},
+	} {
+		if w := aclRequest(server, tc.token, http.MethodPost, "/v1/query", tc.body); w.Code != tc.want {
+			t.Errorf("%s: status: got %d, want %d: %s", tc.name, w.Code, tc.want, w.Body)
+		}
+	}
+}
+
+func TestScanCells(t *testing.T) {
+	r := shard.NewRouter()
+	for i := range 4 {
+		store := memory.New()
+		r.Register(shard.ID(i), store)
+		req := cell.WriteCellRequest{RowKey: uuid.New(), ColumnName: "orders", RefKey: 1, Body: json.RawMessage(fmt.Sprintf(`{"status":"open","total":%d}`, i*10))}
+		if _, err := store.WriteCell(context.Background(), req); err != nil {
+			t.Fatalf("WriteCell: %v", err)
+		}
+	}
+	schemas := schema.NewRegistry()
+	if _, _, err := schemas.Register(context.Background(), "orders", json.RawMessage(ordersSchema)); err != nil {
+		t.Fatalf("Register schema: %v", err)
+	}
+	scan := func(limits ScatterLimits, query string) (int, ScanCellsResponse) {
+		server := NewServer(testLogger(), r, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 4, nil, ServerOptions{Schemas: schemas, Scatter: limits})
+		w := doJSON(server, http.MethodPost, "/v1/query:scan"+query, `{"column":"orders","order_by":{"field":"total","desc":true},"limit":3}`)
+		var resp ScanCellsResponse
+		_ = json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+	totals := func(resp ScanCellsResponse) []float64 {
+		var out []float64
+		for _, c := range resp.Cells {
+			var body struct{ Total float64 }
+			_ = json.Unmarshal(c.Body, &body)
+			out = append(out, body.Total)
+		}
+		return out
+	}
+
+	code, resp := scan(ScatterLimits{}, "")
+	if code != http.StatusOK || !slices.Equal(totals(resp), []float64{30, 20, 10}) || resp.Partial {
+		t.Errorf("scan: got %d %v, want the top 3 of every shard", code, totals(resp))
+	}
+	if code, _ := scan(ScatterLimits{MaxShards: 2}, ""); code != http.StatusUnprocessableEntity {
+		t.Errorf("over the shard budget: got %d, want 422", code)
+	}
+	code, resp = scan(ScatterLimits{MaxShards: 2}, "?partial=true")
+	if code != http.StatusOK || !slices.Equal(totals(resp), []float64{10, 0}) || !resp.Partial || !slices.Equal(resp.Unread, []int{2, 3}) {
+		t.Errorf("partial scan: got %d %v unread %v, want shards 0 and 1", code, totals(resp), resp.Unread)
+	}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/rowkey"
+)
+
+// NaturalKey names a row by a key the caller already has, such as an email
+// address, from which its row_key is derived as a UUIDv5 (see
+// cell.DeriveRowKey).
+type NaturalKey struct {
+	Namespace string `json:"namespace" doc:"Kind of key, e.g. user; a UUID is used as the UUIDv5 namespace itself, any other string names one" minLength:"1" maxLength:"255" example:"user"`
+	Key       string `json:"key" doc:"The key within the namespace" minLength:"1" maxLength:"1024" example:"alice@example.com"`
+}
+
+type DeriveRowKeyInput struct {
+	Body NaturalKey
+}
+
+type DeriveRowKeyResponse struct {
+	RowKey uuid.UUID `json:"row_key" doc:"Row key derived from the natural key" example:"eeb29f0a-6613-574e-97b7-3af95f9271c5"`
+}
+
+type DeriveRowKeyOutput struct {
+	Body DeriveRowKeyResponse
+}
+
+func registerRowKeyRoute(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "derive-row-key",
+		Method:      http.MethodPost,
+		Path:        "/v1/row-keys:derive",
+		Summary:     "Derive a row key from a natural key",
+		Description: fmt.Sprintf("Returns the row_key of a natural key: the UUIDv5 of key in namespace. A namespace in UUID form is the UUIDv5 namespace itself; any other string names the namespace UUIDv5(%s, namespace). The same natural key always yields the same row_key, so producers that write an entity again reach its row without a key store of their own. The Go SDK derives keys locally with DeriveRowKey; writes may carry the natural_key their row_key was derived from, and are rejected if it does not match.", rowkey.Namespace),
+		Tags:        []string{"cells"},
+		Errors:      []int{http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusServiceUnavailable},
+	}, func(ctx context.Context, input *DeriveRowKeyInput) (*DeriveRowKeyOutput, error) {
+		return &DeriveRowKeyOutput{Body: DeriveRowKeyResponse{RowKey: cell.DeriveRowKey(input.Body.Namespace, input.Body.Key)}}, nil
+	})
+}
+
+// assignRowKey fills in the row_key of a single write that omits it, from
+// its natural key or else as a new key. A retry would generate another key
+// and write another row, so a write with an Idempotency-Key must carry its
+// row_key or natural key.
+func (h *CellHandler) assignRowKey(b *WriteCellBody, idempotencyKey string) error {
+	switch {
+	case b.RowKey != uuid.Nil:
+	case b.NaturalKey != nil:
+		b.RowKey = cell.DeriveRowKey(b.NaturalKey.Namespace, b.NaturalKey.Key)
+	case idempotencyKey != "":
+		return huma.Error400BadRequest("a write with an Idempotency-Key must set row_key or natural_key: a generated row_key would differ on each retry")
+	default:
+		b.RowKey = cell.NewRowKey(h.rowKeys)
+	}
+	return nil
+}
+
+// checkNaturalKey rejects a write whose row_key was not derived from the
+// natural key it carries.
+func checkNaturalKey(b WriteCellBody) error {
+	if b.NaturalKey == nil {
+		return nil
+	}
+	if want := cell.DeriveRowKey(b.NaturalKey.Namespace, b.NaturalKey.Key); b.RowKey != want {
+		return huma.Error422UnprocessableEntity(fmt.Sprintf("row_key %s does not match natural_key %s/%s, which derives %s", b.RowKey, b.NaturalKey.Namespace, b.NaturalKey.Key, want))
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+)
+
+func TestDeriveRowKey(t *testing.T) {
+	server := setupTestServer(memory.New(), 8)
+	data, _ := json.Marshal(map[string]any{"namespace": "user", "key": "alice@example.com"})
+	req := httptest.NewRequest(http.MethodPost, "/v1/row-keys:derive", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("derive: got %d: %s", w.Code, w.Body.String())
+	}
+	var resp DeriveRowKeyResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if want := uuid.MustParse("eeb29f0a-6613-574e-97b7-3af95f9271c5"); resp.RowKey != want {
+		t.Errorf("derive: got %s, want %s", resp.RowKey, want)
+	}
+
+	data, _ = json.Marshal(map[string]any{"namespace": "", "key": "alice@example.com"})
+	req = httptest.NewRequest(http.MethodPost, "/v1/row-keys:derive", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("empty namespace: got %d, want 422", w.Code)
+	}
+}
+
+func TestWriteCell_NaturalKey(t *testing.T) {
+	server := setupTestServer(memory.New(), 8)
+	natural := map[string]any{"namespace": "user", "key": "alice@example.com"}
+	row := cell.DeriveRowKey("user", "alice@example.com")
+
+	if w := postCell(t, server, map[string]any{"row_key": row, "column_name": "profile", "ref_key": 1, "body": map[string]any{}, "natural_key": natural}, ""); w.Code != http.StatusCreated {
+		t.Errorf("matching natural key: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := postCell(t, server, map[string]any{"row_key": uuid.New(), "column_name": "profile", "ref_key": 1, "body": map[string]any{}, "natural_key": natural}, ""); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("mismatched natural key: got %d, want 422", w.Code)
+	}
+
+	data, _ := json.Marshal(map[string]any{"cells": []map[string]any{
+		{"row_key": row, "column_name": "profile", "ref_key": 2, "body": map[string]any{}, "natural_key": natural},
+		{"row_key": row, "column_name": "profile", "ref_key": 3, "body": map[string]any{}, "natural_key": map[string]any{"namespace": "user", "key": "bob@example.com"}},
+	}})
+	req := httptest.NewRequest(http.MethodPost, "/v1/cells/batch", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("batch with a mismatched natural key: got %d, want 422", w.Code)
+	}
+}
+
+func TestWriteCell_GeneratedRowKey(t *testing.T) {
+	server := setupTestServer(memory.New(), 8)
+
+	w := postCell(t, server, map[string]any{"column_name": "profile", "ref_key": 1, "body": map[string]any{}}, "")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("without row_key: got %d: %s", w.Code, w.Body.String())
+	}
+	var resp CellResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if resp.RowKey.Version() != 7 {
+		t.Errorf("generated row_key %s is not a UUIDv7", resp.RowKey)
+	}
+
+	natural := map[string]any{"namespace": "user", "key": "alice@example.com"}
+	w = postCell(t, server, map[string]any{"column_name": "profile", "ref_key": 1, "body": map[string]any{}, "natural_key": natural}, "retry-1")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("natural_key without row_key: got %d: %s", w.Code, w.Body.String())
+	}
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if want := cell.DeriveRowKey("user", "alice@example.com"); resp.RowKey != want {
+		t.Errorf("row_key from natural_key: got %s, want %s", resp.RowKey, want)
+	}
+
+	if w := postCell(t, server, map[string]any{"column_name": "profile", "ref_key": 1, "body": map[string]any{}}, "retry-2"); w.Code != http.StatusBadRequest {
+		t.Errorf("idempotent write without row_key: got %d, want 400", w.Code)
+	}
+
+	data, _ := json.Marshal(map[string]any{"cells": []map[string]any{{"column_name": "profile", "ref_key": 1, "body": map[string]any{}}}})
+	req := httptest.NewRequest(http.MethodPost, "/v1/cells/batch", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("batch without row_key: got %d, want 400", w.Code)
+	}
+}
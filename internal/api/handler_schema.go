@@ -0,0 +1,186 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/ryanbastic/go-mezzanine/internal/schema"
+)
+
+// --- Huma Input/Output types ---
+
+type SchemaResponse struct {
+	Column    string         `json:"column" doc:"Column whose cell bodies the schema describes" example:"orders"`
+	Version   int            `json:"version" doc:"Registered schema version, counting from 1; 0 for a schema derived from notified bodies" example:"2"`
+	Derived   bool           `json:"derived" doc:"Whether the schema was derived from the bodies this instance has notified rather than registered" example:"false"`
+	Schema    map[string]any `json:"schema" doc:"JSON Schema of the column's cell bodies" example:"{\"type\":\"object\",\"required\":[\"amount\"]}"`
+	CreatedAt time.Time      `json:"created_at" doc:"When the version was registered, or the derived schema last widened" example:"2026-02-06T12:00:00Z"`
+}
+
+type ListSchemasInput struct{}
+
+type ListSchemasOutput struct {
+	Body []SchemaResponse
+}
+
+type GetSchemaInput struct {
+	ColumnName string `path:"column_name" doc:"Column name"`
+	Version    int    `query:"version" doc:"Registered version to fetch; omitted fetches the latest, or the derived schema if none is registered" minimum:"0"`
+}
+
+type GetSchemaOutput struct {
+	Body SchemaResponse
+}
+
+type ListSchemaVersionsInput struct {
+	ColumnName string `path:"column_name" doc:"Column name"`
+}
+
+type ListSchemaVersionsOutput struct {
+	Body []SchemaResponse
+}
+
+type RegisterSchemaBody struct {
+	Schema map[string]any `json:"schema" doc:"JSON Schema of the column's cell bodies" required:"true" example:"{\"type\":\"object\",\"required\":[\"amount\"]}"`
+}
+
+type RegisterSchemaInput struct {
+	ColumnName string `path:"column_name" doc:"Column name"`
+	Body       RegisterSchemaBody
+}
+
+type RegisterSchemaOutput struct {
+	Body SchemaResponse
+}
+
+// --- Handler ---
+
+type SchemaHandler struct {
+	registry *schema.Registry
+	logger   *slog.Logger
+}
+
+func NewSchemaHandler(registry *schema.Registry, logger *slog.Logger) *SchemaHandler {
+	return &SchemaHandler{registry: registry, logger: logger}
+}
+
+func registerSchemaRoutes(api huma.API, h *SchemaHandler, maxBodyBytes int64) {
+	huma.Register(api, huma.Operation{
+		OperationID: "list-schemas",
+		Method:      http.MethodGet,
+		Path:        "/v1/schemas",
+		Summary:     "List schemas",
+		Description: "Lists, per column sorted by name, the latest registered schema of its cell bodies, or the schema derived from the bodies notified to plugins if none is registered.",
+		Tags:        []string{"schemas"},
+		Errors:      []int{http.StatusServiceUnavailable},
+	}, h.ListSchemas)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-schema",
+		Method:      http.MethodGet,
+		Path:        "/v1/schemas/{column_name}",
+		Summary:     "Get a column's schema",
+		Description: "Fetches a column's latest registered schema, one of its versions, or the derived schema of a column without one. The version is the schema_version of the cell.written notifications validated against it.",
+		Tags:        []string{"schemas"},
+		Errors:      []int{http.StatusNotFound, http.StatusServiceUnavailable},
+	}, h.GetSchema)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "list-schema-versions",
+		Method:      http.MethodGet,
+		Path:        "/v1/schemas/{column_name}/versions",
+		Summary:     "List a column's schema versions",
+		Description: "Lists every registered version of a column's schema, oldest first.",
+		Tags:        []string{"schemas"},
+		Errors:      []int{http.StatusServiceUnavailable},
+	}, h.ListSchemaVersions)
+
+	huma.Register(api, huma.Operation{
+		OperationID:  "register-schema",
+		Method:       http.MethodPut,
+		Path:         "/v1/schemas/{column_name}",
+		Summary:      "Register a column's schema",
+		Description:  "Registers a new version of a column's schema, unless it equals the latest, which is returned as it is. Requires an admin API key.",
+		Tags:         []string{"schemas"},
+		Errors:       []int{http.StatusForbidden, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity, http.StatusServiceUnavailable},
+		MaxBodyBytes: maxBodyBytes,
+	}, h.RegisterSchema)
+}
+
+func (h *SchemaHandler) ListSchemas(ctx context.Context, input *ListSchemasInput) (*ListSchemasOutput, error) {
+	resp := []SchemaResponse{}
+	for _, column := range h.registry.Columns() {
+		s, ok := h.registry.Latest(column)
+		if !ok {
+			s, _ = h.registry.Derived(column)
+		}
+		resp = append(resp, schemaToResponse(s))
+	}
+	return &ListSchemasOutput{Body: resp}, nil
+}
+
+func (h *SchemaHandler) GetSchema(ctx context.Context, input *GetSchemaInput) (*GetSchemaOutput, error) {
+	if input.Version > 0 {
+		for _, s := range h.registry.Versions(input.ColumnName) {
+			if s.Version == input.Version {
+				return &GetSchemaOutput{Body: schemaToResponse(s)}, nil
+			}
+		}
+		return nil, huma.Error404NotFound("schema version not found")
+	}
+	s, ok := h.registry.Latest(input.ColumnName)
+	if !ok {
+		if s, ok = h.registry.Derived(input.ColumnName); !ok {
+			return nil, huma.Error404NotFound("no schema for column")
+		}
+	}
+	return &GetSchemaOutput{Body: schemaToResponse(s)}, nil
+}
+
+func (h *SchemaHandler) ListSchemaVersions(ctx context.Context, input *ListSchemaVersionsInput) (*ListSchemaVersionsOutput, error) {
+	versions := h.registry.Versions(input.ColumnName)
+	resp := make([]SchemaResponse, len(versions))
+	for i, s := range versions {
+		resp[i] = schemaToResponse(s)
+	}
+	return &ListSchemaVersionsOutput{Body: resp}, nil
+}
+
+func (h *SchemaHandler) RegisterSchema(ctx context.Context, input *RegisterSchemaInput) (*RegisterSchemaOutput, error) {
+	if err := authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+	doc, err := json.Marshal(input.Body.Schema)
+	if err != nil {
+		return nil, huma.Error422UnprocessableEntity(err.Error())
+	}
+	s, created, err := h.registry.Register(ctx, input.ColumnName, doc)
+	if err != nil {
+		if errors.Is(err, schema.ErrInvalid) {
+			return nil, huma.Error422UnprocessableEntity(err.Error())
+		}
+		h.logger.Error("failed to register schema", "column", input.ColumnName, "error", err)
+		return nil, huma.Error503ServiceUnavailable("schema store unavailable")
+	}
+	if created {
+		h.logger.Info("schema registered", "column", s.Column, "version", s.Version)
+	}
+	return &RegisterSchemaOutput{Body: schemaToResponse(s)}, nil
+}
+
+func schemaToResponse(s *schema.Schema) SchemaResponse {
+	var doc map[string]any
+	json.Unmarshal(s.Document, &doc) //nolint:errcheck // documents are objects once compiled
+	return SchemaResponse{
+		Column:    s.Column,
+		Version:   s.Version,
+		Derived:   s.Derived(),
+		Schema:    doc,
+		CreatedAt: s.CreatedAt,
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ryanbastic/go-mezzanine/internal/apikey"
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/schema"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+)
+
+func TestSchemas_RegisterAndGet(t *testing.T) {
+	schemas := schema.NewRegistry()
+	schemas.Observe("profile", json.RawMessage(`{"name":"Ada"}`))
+	if err := schemas.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil, ServerOptions{Schemas: schemas})
+
+	for i, body := range []string{
+		`{"schema":{"type":"object","required":["amount"]}}`,
+		`{"schema":{"required":["amount"],"type":"object"}}`,
+		`{"schema":{"type":"object","required":["amount","currency"]}}`,
+	} {
+		w := doJSON(server, http.MethodPut, "/v1/schemas/orders", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("register %d: got %d, body: %s", i, w.Code, w.Body.String())
+		}
+	}
+
+	w := doJSON(server, http.MethodGet, "/v1/schemas/orders", "")
+	var latest SchemaResponse
+	if err := json.NewDecoder(w.Body).Decode(&latest); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if latest.Version != 2 || latest.Derived {
+		t.Errorf("latest: got v%d derived %v, want registered v2", latest.Version, latest.Derived)
+	}
+
+	w = doJSON(server, http.MethodGet, "/v1/schemas/orders?version=1", "")
+	var first SchemaResponse
+	if err := json.NewDecoder(w.Body).Decode(&first); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if first.Version != 1 || len(first.Schema["required"].([]any)) != 1 {
+		t.Errorf("v1: got %+v", first)
+	}
+	if w := doJSON(server, http.MethodGet, "/v1/schemas/orders?version=3", ""); w.Code != http.StatusNotFound {
+		t.Errorf("missing version: got %d, want 404", w.Code)
+	}
+
+	w = doJSON(server, http.MethodGet, "/v1/schemas", "")
+	var list []SchemaResponse
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(list) != 2 || list[0].Column != "orders" || list[1].Column != "profile" || !list[1].Derived {
+		t.Errorf("list: got %+v, want orders v2 and derived profile", list)
+	}
+
+	w = doJSON(server, http.MethodGet, "/v1/schemas/orders/versions", "")
+	var versions []SchemaResponse
+	if err := json.NewDecoder(w.Body).Decode(&versions); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(versions) != 2 {
+		t.Errorf("versions: got %d, want 2", len(versions))
+	}
+}
+
+func TestSchemas_NotFound(t *testing.T) {
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil, ServerOptions{})
+
+	if w := doJSON(server, http.MethodGet, "/v1/schemas/orders", ""); w.Code != http.StatusNotFound {
+		t.Errorf("get unknown column: got %d, want 404", w.Code)
+	}
+}
+
+func TestSchemas_RegisterRequiresAdminKey(t *testing.T) {
+	keys := apikey.NewSet(&apikey.Config{Keys: []apikey.Key{
+		{Name: "backend", SHA256: sha256Hex("backend-token")},
+		{Name: "ops", SHA256: sha256Hex("ops-token"), Admin: true},
+	}})
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil, ServerOptions{APIKeys: keys, Schemas: schema.NewRegistry()})
+
+	for token, want := range map[string]int{"backend-token": http.StatusForbidden, "ops-token": http.StatusOK} {
+		req := httptest.NewRequest(http.MethodPut, "/v1/schemas/orders", strings.NewReader(`{"schema":{"type":"object"}}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", token)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("%s: got %d, want %d, body: %s", token, w.Code, want, w.Body.String())
+		}
+	}
+}
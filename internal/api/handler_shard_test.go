@@ -1,19 +1,30 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
 	"github.com/ryanbastic/go-mezzanine/internal/index"
 	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
 	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+	mezzanine "github.com/ryanbastic/go-mezzanine/pkg/mezzanine"
 )
 
 func TestGetShardCount(t *testing.T) {
 	const numShards = 16
-	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, numShards, nil)
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, numShards, nil, ServerOptions{})
 
 	req := httptest.NewRequest(http.MethodGet, "/v1/shards/count", nil)
 	w := httptest.NewRecorder()
@@ -33,3 +44,276 @@ func TestGetShardCount(t *testing.T) {
 		t.Errorf("num_shards: got %d, want %d", resp.NumShards, numShards)
 	}
 }
+
+func writeTestCells(t *testing.T, store *memory.Store, n int) {
+	t.Helper()
+	for i := range n {
+		req := cell.WriteCellRequest{RowKey: uuid.New(), ColumnName: "profile", RefKey: int64(i + 1), Body: json.RawMessage(`{}`)}
+		if _, err := store.WriteCell(context.Background(), req); err != nil {
+			t.Fatalf("WriteCell: %v", err)
+		}
+	}
+}
+
+func TestGetShardHead(t *testing.T) {
+	store := memory.New()
+	writeTestCells(t, store, 3)
+	server := setupTestServer(store, 4)
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/shards/2/head", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, body: %s", w.Code, w.Body.String())
+	}
+	var resp ShardHeadResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.ShardID != 2 || resp.AddedID != 3 || resp.CreatedAt.IsZero() {
+		t.Errorf("head: got %+v, want shard 2 at added_id 3", resp)
+	}
+}
+
+func TestGetShardHead_EmptyShard(t *testing.T) {
+	server := setupTestServer(memory.New(), 4)
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/shards/0/head", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, body: %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "created_at") {
+		t.Errorf("empty shard reported created_at: %s", w.Body.String())
+	}
+}
+
+func TestGetShardHead_InvalidShard(t *testing.T) {
+	server := setupTestServer(memory.New(), 4)
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/shards/4/head", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status: got %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestPartitionRead_ReportsShardHead(t *testing.T) {
+	store := memory.New()
+	writeTestCells(t, store, 5)
+	server := setupTestServer(store, 4)
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/cells/partitionRead?partition_number=1&read_type=2&limit=2", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, body: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("X-Shard-Head-Added-Id"); got != "5" {
+		t.Errorf("X-Shard-Head-Added-Id: got %q, want 5", got)
+	}
+	if w.Header().Get("X-Shard-Head-Created-At") == "" {
+		t.Error("X-Shard-Head-Created-At missing")
+	}
+}
+
+func TestPartitionRead_CommitSeq(t *testing.T) {
+	store := memory.New()
+	for i := range 3 {
+		if _, err := store.WriteCell(context.Background(), cell.WriteCellRequest{RowKey: uuid.New(), ColumnName: "profile", RefKey: int64(i), Body: json.RawMessage(`{}`)}); err != nil {
+			t.Fatalf("WriteCell: %v", err)
+		}
+	}
+	server := setupTestServer(store, 4)
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/cells/partitionRead?partition_number=1&read_type=3&added_id=1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, body: %s", w.Code, w.Body.String())
+	}
+	var cells []CellResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &cells); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(cells) != 2 || cells[0].CommitSeq != 2 || cells[1].CommitSeq != 3 {
+		t.Errorf("cells after commit_seq 1: got %+v, want commit_seq 2 and 3", cells)
+	}
+}
+
+// noCommitLogStore has no commit log, like a PostgresStore without
+// COMMIT_LOG.
+type noCommitLogStore struct {
+	*memory.Store
+}
+
+func (s noCommitLogStore) PartitionRead(ctx context.Context, partitionNumber int, readType int, addedID int64, createdAfter time.Time, limit int) ([]cell.Cell, error) {
+	if readType == storage.PartitionReadTypeCommitSeq {
+		return nil, storage.ErrNoCommitLog
+	}
+	return s.Store.PartitionRead(ctx, partitionNumber, readType, addedID, createdAfter, limit)
+}
+
+func TestPartitionRead_CommitSeqWithoutLog(t *testing.T) {
+	server := setupTestServer(noCommitLogStore{memory.New()}, 4)
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/cells/partitionRead?partition_number=1&read_type=3", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status: got %d, want 400; body: %s", w.Code, w.Body.String())
+	}
+}
+
+// writeOnWait writes a cell when a long poll waits on it.
+type writeOnWait struct {
+	*memory.Store
+	t *testing.T
+}
+
+func (s writeOnWait) WaitHead(ctx context.Context, afterAddedID int64) (int64, error) {
+	writeTestCells(s.t, s.Store, 1)
+	return afterAddedID + 1, nil
+}
+
+func TestPartitionRead_WaitRereadsHead(t *testing.T) {
+	store := memory.New()
+	writeTestCells(t, store, 2)
+	server := setupTestServer(writeOnWait{Store: store, t: t}, 4)
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/cells/partitionRead?partition_number=1&read_type=2&added_id=2&wait=5", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, body: %s", w.Code, w.Body.String())
+	}
+	// The page is read up to the head moved by the write.
+	if got := w.Header().Get("X-Shard-Head-Added-Id"); got != "3" {
+		t.Errorf("X-Shard-Head-Added-Id: got %q, want 3", got)
+	}
+}
+
+func TestPartitionRead_WaitTimesOut(t *testing.T) {
+	store := memory.New()
+	writeTestCells(t, store, 2)
+	r := shard.NewRouter()
+	for i := range 4 {
+		r.Register(shard.ID(i), store)
+	}
+	const maxWait = 50 * time.Millisecond
+	server := NewServer(testLogger(), r, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 4, nil, ServerOptions{MaxWait: maxWait})
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/cells/partitionRead?partition_number=1&read_type=2&added_id=2&wait=30", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, body: %s", w.Code, w.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed < maxWait || elapsed > 10*maxWait {
+		t.Errorf("waited %v, want about %v", elapsed, maxWait)
+	}
+	if got := strings.TrimSpace(w.Body.String()); got != "[]" {
+		t.Errorf("body: got %s, want an empty page", got)
+	}
+}
+
+type fakePinger struct{ err error }
+
+func (p fakePinger) Ping(ctx context.Context) error { return p.err }
+
+func TestGetShardMap(t *testing.T) {
+	r := shard.NewRouter()
+	pingers := map[string]Pinger{"a": fakePinger{}, "b": fakePinger{err: errors.New("down")}}
+	server := NewServer(testLogger(), r, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 5, pingers, ServerOptions{
+		ShardBackends: []ShardBackend{{Name: "a", ShardStart: 0, ShardEnd: 1}, {Name: "b", ShardStart: 2, ShardEnd: 3}, {Name: "c", ShardStart: 4, ShardEnd: 4}},
+	})
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/shards/map", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, body: %s", w.Code, w.Body.String())
+	}
+	var resp ShardMapResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	want := []ShardMapEntry{
+		{ShardPlacement{0, "a", "cells_0000"}, "ok"},
+		{ShardPlacement{1, "a", "cells_0001"}, "ok"},
+		{ShardPlacement{2, "b", "cells_0002"}, "error"},
+		{ShardPlacement{3, "b", "cells_0003"}, "error"},
+		{ShardPlacement{4, "c", "cells_0004"}, "unknown"},
+	}
+	if resp.NumShards != 5 || !reflect.DeepEqual(resp.Shards, want) {
+		t.Errorf("map: got %+v, want %+v", resp, want)
+	}
+	if want := (ShardHashResponse{Function: "fnv1a", Version: 1}); resp.Hash != want {
+		t.Errorf("hash: got %+v, want %+v", resp.Hash, want)
+	}
+}
+
+// countingPinger counts its pings.
+type countingPinger struct{ pings atomic.Int32 }
+
+func (p *countingPinger) Ping(ctx context.Context) error {
+	p.pings.Add(1)
+	return nil
+}
+
+func TestShardMap_CachesHealth(t *testing.T) {
+	pinger := &countingPinger{}
+	m := newShardMap([]ShardBackend{{Name: "a", ShardStart: 0, ShardEnd: 0}}, map[string]Pinger{"a": pinger})
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	for range 3 {
+		if got := m.health(context.Background()); got["a"] != "ok" {
+			t.Fatalf("health: got %v, want a ok", got)
+		}
+	}
+	if n := pinger.pings.Load(); n != 1 {
+		t.Errorf("pinged %d times within the TTL, want once", n)
+	}
+	now = now.Add(shardStatusTTL)
+	m.health(context.Background())
+	if n := pinger.pings.Load(); n != 2 {
+		t.Errorf("pinged %d times after the TTL, want twice", n)
+	}
+}
+
+func TestGetShardForKey(t *testing.T) {
+	const numShards = 16
+	hash := mezzanine.ShardHash{Function: mezzanine.HashXXHash, Seed: 7}
+	r := shard.NewRouter()
+	r.SetHash(hash)
+	server := NewServer(testLogger(), r, index.NewRegistry(), trigger.NewPluginRegistry(), nil, numShards, nil, ServerOptions{
+		ShardBackends: []ShardBackend{{Name: "primary", ShardStart: 0, ShardEnd: numShards - 1}},
+	})
+
+	rowKey := uuid.New()
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/shards/forKey/"+rowKey.String(), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, body: %s", w.Code, w.Body.String())
+	}
+	var resp ShardForKeyResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	id := int(shard.ForRowKey(hash, rowKey, numShards))
+	want := ShardForKeyResponse{RowKey: rowKey, ShardPlacement: ShardPlacement{ShardID: id, Backend: "primary", Table: storage.ShardTable(id)}}
+	if resp != want {
+		t.Errorf("forKey: got %+v, want %+v", resp, want)
+	}
+}
+
+func TestGetShardForKey_InvalidKey(t *testing.T) {
+	server := setupTestServer(memory.New(), 4)
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/shards/forKey/not-a-uuid", nil))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status: got %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+// defaultShard returns the shard of a row key under the default hash, which
+// test routers place keys with.
+func defaultShard(rowKey uuid.UUID, numShards int) shard.ID {
+	return shard.ForRowKey(mezzanine.ShardHash{}, rowKey, numShards)
+}
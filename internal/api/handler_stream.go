@@ -0,0 +1,191 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/ryanbastic/go-mezzanine/internal/stream"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+)
+
+// --- Huma Input/Output types ---
+
+type CreateStreamBody struct {
+	Name        string   `json:"name" doc:"Stream name: lowercase letters, digits, '_', '.' or '-', starting with a letter" required:"true" minLength:"1" maxLength:"63" example:"eu-orders"`
+	Columns     []string `json:"columns" doc:"Columns whose cells the stream selects" required:"true" minItems:"1" example:"[\"orders\"]"`
+	Filters     []string `json:"filters,omitempty" doc:"Conditions on top-level body fields, as field:op:value with op eq, ne or in (comma-separated values); a cell must match all of them" example:"[\"region:eq:eu\"]"`
+	Description string   `json:"description,omitempty" doc:"What the stream selects" example:"Orders placed in the EU region"`
+}
+
+type CreateStreamInput struct {
+	Body CreateStreamBody
+}
+
+type StreamResponse struct {
+	Name        string    `json:"name" doc:"Stream name" example:"eu-orders"`
+	Columns     []string  `json:"columns" doc:"Columns whose cells the stream selects" example:"[\"orders\"]"`
+	Filters     []string  `json:"filters" doc:"Conditions on top-level body fields a cell must match" example:"[\"region:eq:eu\"]"`
+	Description string    `json:"description" doc:"What the stream selects" example:"Orders placed in the EU region"`
+	Subscribers []string  `json:"subscribers" doc:"Names of the plugins subscribed to the stream" example:"[\"eu-fulfilment\"]"`
+	CreatedAt   time.Time `json:"created_at" doc:"Creation timestamp" example:"2026-02-06T12:00:00Z"`
+}
+
+type CreateStreamOutput struct {
+	Body StreamResponse
+}
+
+type ListStreamsInput struct{}
+
+type ListStreamsOutput struct {
+	Body []StreamResponse
+}
+
+type GetStreamInput struct {
+	Name string `path:"name" doc:"Stream name"`
+}
+
+type GetStreamOutput struct {
+	Body StreamResponse
+}
+
+type DeleteStreamInput struct {
+	Name string `path:"name" doc:"Stream name"`
+}
+
+// --- Handler ---
+
+type StreamHandler struct {
+	streams *stream.Registry
+	plugins *trigger.PluginRegistry
+	logger  *slog.Logger
+}
+
+func NewStreamHandler(streams *stream.Registry, plugins *trigger.PluginRegistry, logger *slog.Logger) *StreamHandler {
+	return &StreamHandler{streams: streams, plugins: plugins, logger: logger}
+}
+
+func registerStreamRoutes(api huma.API, h *StreamHandler, maxBodyBytes int64) {
+	huma.Register(api, huma.Operation{
+		OperationID:   "create-stream",
+		Method:        http.MethodPost,
+		Path:          "/v1/streams",
+		Summary:       "Create a stream",
+		Description:   "Defines a named selection of cells by column and body filter. Plugins subscribed to the stream are notified of the cells written from then on that it selects.",
+		Tags:          []string{"streams"},
+		Errors:        []int{http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity, http.StatusServiceUnavailable},
+		DefaultStatus: http.StatusCreated,
+		MaxBodyBytes:  maxBodyBytes,
+	}, h.CreateStream)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "list-streams",
+		Method:      http.MethodGet,
+		Path:        "/v1/streams",
+		Summary:     "List streams",
+		Description: "Lists every stream, sorted by name, with the plugins subscribed to it.",
+		Tags:        []string{"streams"},
+		Errors:      []int{http.StatusServiceUnavailable},
+	}, h.ListStreams)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-stream",
+		Method:      http.MethodGet,
+		Path:        "/v1/streams/{name}",
+		Summary:     "Get a stream",
+		Description: "Fetches one stream by name.",
+		Tags:        []string{"streams"},
+		Errors:      []int{http.StatusNotFound, http.StatusServiceUnavailable},
+	}, h.GetStream)
+
+	huma.Register(api, huma.Operation{
+		OperationID:   "delete-stream",
+		Method:        http.MethodDelete,
+		Path:          "/v1/streams/{name}",
+		Summary:       "Delete a stream",
+		Description:   "Deletes a stream no plugin subscribes to.",
+		Tags:          []string{"streams"},
+		Errors:        []int{http.StatusNotFound, http.StatusConflict, http.StatusServiceUnavailable},
+		DefaultStatus: http.StatusNoContent,
+	}, h.DeleteStream)
+}
+
+func (h *StreamHandler) CreateStream(ctx context.Context, input *CreateStreamInput) (*CreateStreamOutput, error) {
+	s := &stream.Stream{
+		Name:        input.Body.Name,
+		Columns:     input.Body.Columns,
+		Filters:     input.Body.Filters,
+		Description: input.Body.Description,
+	}
+	if err := h.streams.Create(ctx, s); err != nil {
+		switch {
+		case errors.Is(err, stream.ErrInvalid):
+			return nil, huma.Error422UnprocessableEntity(err.Error())
+		case errors.Is(err, stream.ErrExists):
+			return nil, huma.Error409Conflict(err.Error())
+		}
+		h.logger.Error("failed to create stream", "name", s.Name, "error", err)
+		return nil, huma.Error503ServiceUnavailable("stream store unavailable")
+	}
+
+	h.logger.Info("stream created", "name", s.Name, "columns", s.Columns, "filters", s.Filters)
+	return &CreateStreamOutput{Body: h.streamToResponse(s)}, nil
+}
+
+func (h *StreamHandler) ListStreams(ctx context.Context, input *ListStreamsInput) (*ListStreamsOutput, error) {
+	streams := h.streams.List()
+	resp := make([]StreamResponse, len(streams))
+	for i, s := range streams {
+		resp[i] = h.streamToResponse(s)
+	}
+	return &ListStreamsOutput{Body: resp}, nil
+}
+
+func (h *StreamHandler) GetStream(ctx context.Context, input *GetStreamInput) (*GetStreamOutput, error) {
+	s, ok := h.streams.Get(input.Name)
+	if !ok {
+		return nil, huma.Error404NotFound("stream not found")
+	}
+	return &GetStreamOutput{Body: h.streamToResponse(s)}, nil
+}
+
+func (h *StreamHandler) DeleteStream(ctx context.Context, input *DeleteStreamInput) (*struct{}, error) {
+	if _, ok := h.streams.Get(input.Name); !ok {
+		return nil, huma.Error404NotFound("stream not found")
+	}
+	if subscribers := h.plugins.Subscribers(input.Name); len(subscribers) > 0 {
+		return nil, huma.Error409Conflict("stream has subscribers: " + strings.Join(subscribers, ", "))
+	}
+	if err := h.streams.Delete(ctx, input.Name); err != nil {
+		if errors.Is(err, stream.ErrNotFound) {
+			return nil, huma.Error404NotFound("stream not found")
+		}
+		h.logger.Error("failed to delete stream", "name", input.Name, "error", err)
+		return nil, huma.Error503ServiceUnavailable("stream store unavailable")
+	}
+
+	h.logger.Info("stream deleted", "name", input.Name)
+	return nil, nil
+}
+
+func (h *StreamHandler) streamToResponse(s *stream.Stream) StreamResponse {
+	resp := StreamResponse{
+		Name:        s.Name,
+		Columns:     s.Columns,
+		Filters:     s.Filters,
+		Description: s.Description,
+		Subscribers: h.plugins.Subscribers(s.Name),
+		CreatedAt:   s.CreatedAt,
+	}
+	if resp.Filters == nil {
+		resp.Filters = []string{}
+	}
+	if resp.Subscribers == nil {
+		resp.Subscribers = []string{}
+	}
+	return resp
+}
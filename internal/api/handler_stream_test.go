@@ -0,0 +1,84 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+)
+
+func doJSON(server http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	return w
+}
+
+func TestStreams_CreateSubscribeDelete(t *testing.T) {
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil, ServerOptions{})
+
+	w := doJSON(server, http.MethodPost, "/v1/streams", `{"name":"eu-orders","columns":["orders"],"filters":["region:eq:eu"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: got %d, body: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(server, http.MethodPost, "/v1/streams", `{"name":"eu-orders","columns":["orders"]}`); w.Code != http.StatusConflict {
+		t.Errorf("duplicate create: got %d, want 409", w.Code)
+	}
+
+	w = doJSON(server, http.MethodPost, "/v1/plugins", `{"name":"eu-fulfilment","endpoint":"http://eu:9000/rpc","subscribed_streams":["eu-orders"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register: got %d, body: %s", w.Code, w.Body.String())
+	}
+	var plugin PluginResponse
+	if err := json.NewDecoder(w.Body).Decode(&plugin); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(plugin.SubscribedStreams) != 1 || plugin.SubscribedStreams[0] != "eu-orders" {
+		t.Errorf("SubscribedStreams: got %v", plugin.SubscribedStreams)
+	}
+
+	w = doJSON(server, http.MethodGet, "/v1/streams/eu-orders", "")
+	var resp StreamResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Subscribers) != 1 || resp.Subscribers[0] != "eu-fulfilment" {
+		t.Errorf("Subscribers: got %v, want [eu-fulfilment]", resp.Subscribers)
+	}
+
+	if w := doJSON(server, http.MethodDelete, "/v1/streams/eu-orders", ""); w.Code != http.StatusConflict {
+		t.Errorf("delete subscribed stream: got %d, want 409", w.Code)
+	}
+	if w := doJSON(server, http.MethodDelete, "/v1/plugins/"+plugin.ID.String(), ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete plugin: got %d", w.Code)
+	}
+	if w := doJSON(server, http.MethodDelete, "/v1/streams/eu-orders", ""); w.Code != http.StatusNoContent {
+		t.Errorf("delete stream: got %d, body: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(server, http.MethodGet, "/v1/streams/eu-orders", ""); w.Code != http.StatusNotFound {
+		t.Errorf("get deleted stream: got %d, want 404", w.Code)
+	}
+}
+
+func TestStreams_Invalid(t *testing.T) {
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 64, nil, ServerOptions{})
+
+	for _, body := range []string{
+		`{"name":"Orders","columns":["orders"]}`,
+		`{"name":"orders","columns":["orders"],"filters":["region:like:eu"]}`,
+	} {
+		if w := doJSON(server, http.MethodPost, "/v1/streams", body); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("create %s: got %d, want 422", body, w.Code)
+		}
+	}
+	w := doJSON(server, http.MethodPost, "/v1/plugins", `{"name":"p","endpoint":"http://p:9000/rpc","subscribed_streams":["missing"]}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("register with unknown stream: got %d, want 422", w.Code)
+	}
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+type FieldOpBody struct {
+	Op    string          `json:"op" doc:"increment adds value, a number, to a numeric field (0 if missing); append appends value to an array field (created if missing)" enum:"increment,append" example:"increment"`
+	Field string          `json:"field" doc:"Top-level key or dotted path into nested objects, which are created if missing" minLength:"1" example:"stats.views"`
+	Value json.RawMessage `json:"value" doc:"Number to add, or value to append" required:"true" example:"1"`
+}
+
+type UpdateCellBody struct {
+	RowKey     uuid.UUID     `json:"row_key" doc:"Row key UUID" required:"true" example:"550e8400-e29b-41d4-a716-446655440000"`
+	ColumnName string        `json:"column_name" doc:"Column name" required:"true" minLength:"1" maxLength:"128" pattern:"^[A-Za-z_][A-Za-z0-9_.-]*$" patternDescription:"column name" example:"stats"`
+	Ops        []FieldOpBody `json:"ops" doc:"Operations, applied in order" required:"true" minItems:"1" maxItems:"100"`
+}
+
+type UpdateCellInput struct {
+	Body UpdateCellBody
+}
+
+type UpdateCellOutput struct {
+	Shard  string `header:"X-Shard-Id" doc:"Shard the write was routed to"`
+	Seq    string `header:"X-Shard-Seq" doc:"The write's sequence number in its shard (its added_id); pass X-Shard-Id:X-Shard-Seq as min_seq to read it back"`
+	Timing string `header:"Server-Timing" doc:"Milliseconds spent storing, indexing and notifying plugins; set when the server enables it"`
+	Body   CellResponse
+}
+
+func registerUpdateRoute(api huma.API, h *CellHandler) {
+	huma.Register(api, huma.Operation{
+		OperationID:  "update-cell",
+		Method:       http.MethodPost,
+		Path:         "/v1/cells:update",
+		Summary:      "Increment or append to fields of the latest cell version",
+		Description:  "Applies field operations to the body of the latest version of a cell and writes the result as a new version with the next ref_key, atomically on the shard, so counters and activity logs need no read-modify-write cycle. Updates of a cell are serialized: one computed from a version another update replaced is recomputed from the new one, so none is lost. A cell with no versions is created, with ref_key 1, from an empty object. An operation that does not fit the body, such as incrementing a string, fails the update with 422; so do binary cells. A plain write taking the next ref_key first fails it with 409. The new version is written as by write-cell: write hooks and synchronous plugins see the updated body, and large bodies are offloaded.",
+		Tags:         []string{"cells"},
+		Errors:       []int{http.StatusBadRequest, http.StatusForbidden, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		MaxBodyBytes: h.body.MaxBytes,
+	}, h.UpdateCell)
+}
+
+// errStaleUpdate aborts a store update whose body was computed from a
+// version that is no longer the latest.
+var errStaleUpdate = errors.New("cell changed since the update was computed")
+
+// UpdateCell writes the next version of a cell from its latest one and a
+// list of field operations.
+func (h *CellHandler) UpdateCell(ctx context.Context, input *UpdateCellInput) (*UpdateCellOutput, error) {
+	rowKey, columnName := input.Body.RowKey, input.Body.ColumnName
+	if err := checkWritable(columnName); err != nil {
+		return nil, err
+	}
+	if err := authorizeWrite(ctx, columnName); err != nil {
+		return nil, err
+	}
+	if len(input.Body.Ops) == 0 {
+		return nil, huma.Error422UnprocessableEntity("ops must not be empty")
+	}
+	ops := make([]cell.FieldOp, len(input.Body.Ops))
+	for i, op := range input.Body.Ops {
+		ops[i] = cell.FieldOp{Op: op.Op, Field: op.Field, Value: op.Value}
+	}
+
+	shardID := h.router.ForRowKey(rowKey, h.numShards)
+	store, err := h.router.StoreFor(shardID)
+	if err != nil {
+		h.logger.Error("shard routing failed", "shard_id", shardID, "error", err)
+		return nil, huma.Error500InternalServerError("shard routing failed")
+	}
+	if _, err := h.acl.authorize(ctx, store, []uuid.UUID{rowKey}); err != nil {
+		return nil, err
+	}
+
+	// The next body is computed outside the store's update transaction,
+	// since hooks, plugins and offloading call out to other services; the
+	// update only writes it if the cell has not moved on meanwhile, and is
+	// recomputed otherwise. Each round some update of the cell wins, so
+	// the loop ends; the request's deadline bounds it under contention.
+	var timing writeTiming
+	at := time.Now()
+	var c *cell.Cell
+	var original []json.RawMessage
+	for {
+		latest, err := store.GetCellLatest(storage.WithFreshRead(ctx), rowKey, columnName)
+		if err != nil && !errors.Is(err, storage.ErrCellNotFound) {
+			h.logger.Error("failed to read cell", "row_key", rowKey, "column_name", columnName, "error", err)
+			return nil, failed(ctx, err, "failed to update cell")
+		}
+		var body json.RawMessage
+		body, original, err = h.nextBody(ctx, shardID, rowKey, columnName, latest, ops)
+		if err != nil {
+			return nil, err
+		}
+		if err := h.claimRows(ctx, store, []uuid.UUID{rowKey}); err != nil {
+			return nil, err
+		}
+		c, err = storage.UpdateCell(ctx, store, rowKey, columnName, func(_ context.Context, current *cell.Cell) (json.RawMessage, error) {
+			if refKeyOf(current) != refKeyOf(latest) {
+				return nil, errStaleUpdate
+			}
+			return body, nil
+		})
+		if errors.Is(err, errStaleUpdate) && ctx.Err() == nil {
+			continue
+		}
+		if errors.Is(err, storage.ErrCellExists) {
+			return nil, huma.Error409Conflict("cell was written concurrently; retry the update")
+		}
+		if err != nil {
+			h.logger.Error("failed to update cell", "row_key", rowKey, "column_name", columnName, "error", err)
+			return nil, failed(ctx, err, "failed to update cell")
+		}
+		break
+	}
+	at = since(&timing.store, at)
+
+	written := withOriginal(c, original, 0)
+	if h.notifier != nil {
+		h.notifier.NotifyCell(int(shardID), written)
+	}
+	at = since(&timing.notify, at)
+
+	if err := h.indexRegistry.IndexCell(ctx, written, h.numShards); err != nil {
+		h.logger.Error("index write failed", "row_key", c.RowKey, "column_name", c.ColumnName, "error", err)
+	}
+	since(&timing.index, at)
+	h.columns.Observe(c.ColumnName, 1, len(c.Body), c.CreatedAt)
+
+	header := h.reportTiming(timing, "updated cell", "row_key", c.RowKey, "column_name", c.ColumnName, "ref_key", c.RefKey)
+	return &UpdateCellOutput{Shard: shardIDHeader(shardID), Seq: seqHeader(c.AddedID), Timing: header, Body: cellToResponse(readMask(ctx, nil, h.maskSecret).cell(c))}, nil
+}
+
+// nextBody applies ops to latest, which is nil for a new cell, and passes
+// the result through write hooks, synchronous plugins and offloading. It
+// returns the body to store and, as offloadBodies does, the one it
+// replaced with a pointer.
+func (h *CellHandler) nextBody(ctx context.Context, shardID shard.ID, rowKey uuid.UUID, columnName string, latest *cell.Cell, ops []cell.FieldOp) (json.RawMessage, []json.RawMessage, error) {
+	var body json.RawMessage
+	refKey := int64(storage.FirstRefKey)
+	if latest != nil {
+		if _, ok := cell.ParseBlobBody(latest.Body); ok {
+			return nil, nil, huma.Error422UnprocessableEntity("binary cells cannot be updated")
+		}
+		current, err := h.resolver(true).cell(ctx, latest)
+		if err != nil {
+			return nil, nil, h.resolveFailed(ctx, err, "failed to update cell")
+		}
+		body, refKey = current.Body, latest.RefKey+1
+	}
+	next, err := cell.ApplyFieldOps(body, ops)
+	if errors.Is(err, cell.ErrFieldOp) {
+		return nil, nil, huma.Error422UnprocessableEntity(err.Error())
+	}
+	if err != nil {
+		h.logger.Error("failed to apply field operations", "row_key", rowKey, "column_name", columnName, "error", err)
+		return nil, nil, huma.Error500InternalServerError("failed to apply field operations")
+	}
+
+	reqs := []cell.WriteCellRequest{{RowKey: rowKey, ColumnName: columnName, RefKey: refKey, Body: next}}
+	if err := h.beforeWrite(ctx, shardID, reqs); err != nil {
+		return nil, nil, err
+	}
+	originals, err := h.offloadBodies(ctx, reqs, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	return reqs[0].Body, originals, nil
+}
+
+// refKeyOf returns the ref_key of c, or zero if the cell has no versions.
+func refKeyOf(c *cell.Cell) int64 {
+	if c == nil {
+		return 0
+	}
+	return c.RefKey
+}
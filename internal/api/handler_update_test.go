@@ -0,0 +1,125 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+)
+
+func updateCell(server http.Handler, row uuid.UUID, column string, ops ...map[string]any) *httptest.ResponseRecorder {
+	if ops == nil {
+		ops = []map[string]any{}
+	}
+	data, _ := json.Marshal(map[string]any{"row_key": row, "column_name": column, "ops": ops})
+	req := httptest.NewRequest(http.MethodPost, "/v1/cells:update", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	return w
+}
+
+func TestUpdateCell(t *testing.T) {
+	store := memory.New()
+	server := setupTestServer(store, 8)
+	row := uuid.New()
+
+	// The first update creates the cell.
+	w := updateCell(server, row, "stats",
+		map[string]any{"op": "increment", "field": "views", "value": 1},
+		map[string]any{"op": "append", "field": "log", "value": map[string]any{"event": "created"}},
+	)
+	if w.Code != http.StatusOK {
+		t.Fatalf("first update: got %d: %s", w.Code, w.Body.String())
+	}
+	var resp CellResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if resp.RefKey != 1 || !sameJSON(resp.Body, json.RawMessage(`{"views":1,"log":[{"event":"created"}]}`)) {
+		t.Errorf("first update: got ref_key %d body %s", resp.RefKey, resp.Body)
+	}
+
+	// Concurrent updates are serialized, so none is lost.
+	const n = 20
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if w := updateCell(server, row, "stats", map[string]any{"op": "increment", "field": "views", "value": 2}); w.Code != http.StatusOK {
+				t.Errorf("concurrent update: got %d: %s", w.Code, w.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+	latest, err := store.GetCellLatest(t.Context(), row, "stats")
+	if err != nil || latest.RefKey != n+1 || !sameJSON(latest.Body, json.RawMessage(`{"views":41,"log":[{"event":"created"}]}`)) {
+		t.Fatalf("after concurrent updates: got %+v, %v", latest, err)
+	}
+}
+
+func TestUpdateCell_Errors(t *testing.T) {
+	server := setupTestServer(memory.New(), 8)
+	row := uuid.New()
+	postCell(t, server, map[string]any{"row_key": row, "column_name": "profile", "ref_key": 1, "body": map[string]any{"name": "Alice"}}, "")
+
+	if w := updateCell(server, row, "profile", map[string]any{"op": "increment", "field": "name", "value": 1}); w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "not a number") {
+		t.Errorf("increment a string: got %d %s, want 422", w.Code, w.Body.String())
+	}
+	if w := updateCell(server, row, "profile", map[string]any{"op": "set", "field": "name", "value": 1}); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("unknown op: got %d, want 422", w.Code)
+	}
+	if w := updateCell(server, row, "profile"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("no ops: got %d, want 422", w.Code)
+	}
+	if w := updateCell(server, row, "_mezz.owner", map[string]any{"op": "increment", "field": "n", "value": 1}); w.Code != http.StatusBadRequest {
+		t.Errorf("reserved column: got %d, want 400", w.Code)
+	}
+	if w := putBlob(server, "/v1/blobs/"+row.String()+"/avatar/1", "image/png", []byte("x"), ""); w.Code != http.StatusCreated {
+		t.Fatalf("blob: got %d", w.Code)
+	}
+	if w := updateCell(server, row, "avatar", map[string]any{"op": "increment", "field": "n", "value": 1}); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("binary cell: got %d, want 422", w.Code)
+	}
+}
+
+// racingUpdateStore writes a version of the cell before the first update it is
+// asked for, as a concurrent update would while the body was computed.
+type racingUpdateStore struct {
+	*memory.Store
+	raced bool
+}
+
+func (s *racingUpdateStore) UpdateCell(ctx context.Context, rowKey uuid.UUID, columnName string, apply storage.UpdateFunc) (*cell.Cell, error) {
+	if !s.raced {
+		s.raced = true
+		if _, err := s.WriteCell(ctx, cell.WriteCellRequest{RowKey: rowKey, ColumnName: columnName, RefKey: 1, Body: json.RawMessage(`{"views":10}`)}); err != nil {
+			return nil, err
+		}
+	}
+	return s.Store.UpdateCell(ctx, rowKey, columnName, apply)
+}
+
+func TestUpdateCell_RecomputesStaleBody(t *testing.T) {
+	store := &racingUpdateStore{Store: memory.New()}
+	server := setupTestServer(store, 8)
+	row := uuid.New()
+
+	w := updateCell(server, row, "stats", map[string]any{"op": "increment", "field": "views", "value": 1})
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: got %d: %s", w.Code, w.Body.String())
+	}
+	var resp CellResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if resp.RefKey != 2 || !sameJSON(resp.Body, json.RawMessage(`{"views":11}`)) {
+		t.Errorf("update: got ref_key %d body %s, want the increment applied to the racing version", resp.RefKey, resp.Body)
+	}
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/view"
+)
+
+// --- Request/Response types ---
+
+type ReadViewInput struct {
+	Name    string   `path:"name" doc:"View name"`
+	Key     string   `path:"key" doc:"View key: the value of the view's key_field in cell bodies"`
+	Mask    []string `query:"mask" doc:"Fields to remove from the latest body, comma-separated; nested fields use dots"`
+	Partial bool     `query:"partial" doc:"When the view has more shards than the server's query budget allows, read the first shards within it instead of failing with 422; when some shards fail, answer with 207, listing them under shard_errors, instead of failing the request"`
+}
+
+type ViewLatestResponse struct {
+	RowKey    uuid.UUID       `json:"row_key" doc:"Row whose cell was written last" example:"550e8400-e29b-41d4-a716-446655440000"`
+	RefKey    int64           `json:"ref_key" doc:"Version of the cell" example:"3"`
+	Body      json.RawMessage `json:"body" doc:"The cell's body, or the view's fields of it" example:"{\"total\":42.5}"`
+	CreatedAt time.Time       `json:"created_at" doc:"When the cell was written" example:"2026-02-06T12:00:00Z"`
+}
+
+type ViewResponse struct {
+	Name        string              `json:"name" doc:"View name" example:"orders_per_customer"`
+	Key         string              `json:"key" doc:"View key" example:"c-42"`
+	Aggregate   view.Aggregate      `json:"aggregate" doc:"What the view keeps" enum:"count,sum,latest" example:"count"`
+	Count       int64               `json:"count" doc:"Number of rows with the key" example:"12"`
+	Sum         *float64            `json:"sum,omitempty" doc:"Sum of the view's value_field over the rows, for sum views" example:"420.5"`
+	Latest      *ViewLatestResponse `json:"latest,omitempty" doc:"The most recently written row, for latest views with rows"`
+	Partial     bool                `json:"partial,omitempty" doc:"Set when only some of the view's shards were read, with partial=true" example:"false"`
+	Shards      int                 `json:"shards,omitempty" doc:"Number of shards read, when partial" example:"16"`
+	ShardErrors []ShardError        `json:"shard_errors,omitempty" doc:"Shards that failed to be read, making the response 207; only with partial=true"`
+}
+
+type ReadViewOutput struct {
+	Status int
+	Body   ViewResponse
+}
+
+// --- Handler ---
+
+type ViewHandler struct {
+	registry   *view.Registry
+	numShards  int
+	maskSecret []byte
+	scatter    ScatterLimits
+	acl        rowACL
+	logger     *slog.Logger
+}
+
+func NewViewHandler(registry *view.Registry, numShards int, opts ServerOptions, logger *slog.Logger) *ViewHandler {
+	return &ViewHandler{registry: registry, numShards: numShards, maskSecret: opts.MaskHashSecret, scatter: opts.Scatter, acl: rowACL{mode: opts.RowACL, logger: logger}, logger: logger}
+}
+
+func registerViewRoutes(api huma.API, h *ViewHandler) {
+	huma.Register(api, huma.Operation{
+		OperationID: "read-view",
+		Method:      http.MethodGet,
+		Path:        "/v1/views/{name}/{key}",
+		Summary:     "Read a materialized view",
+		Description: "Returns a materialized view's aggregate for one key: the number of rows whose latest cell of the view's source column has the key, with the sum of a field over them or the latest of them, depending on the view. Views are maintained asynchronously as cells are written, so a write shows up shortly after it is acknowledged. A row's member lives on the row's shard, so every shard is read.",
+		Tags:        []string{"views"},
+		Errors:      []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusUnprocessableEntity, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	}, h.ReadView)
+}
+
+// ReadView reads a key on every shard of the view concurrently, within the
+// server's ScatterLimits, and merges the results.
+func (h *ViewHandler) ReadView(ctx context.Context, input *ReadViewInput) (*ReadViewOutput, error) {
+	// Views aggregate over rows of every tenant.
+	if err := h.acl.scan(ctx, "view_read"); err != nil {
+		return nil, err
+	}
+	def, ok := h.registry.Definition(input.Name)
+	if !ok {
+		return nil, huma.Error404NotFound("view not found")
+	}
+	stores := make([]view.Store, 0, h.numShards)
+	var ids []shard.ID
+	for i := range h.numShards {
+		if store, ok := h.registry.StoreFor(input.Name, shard.ID(i)); ok {
+			stores = append(stores, store)
+			ids = append(ids, shard.ID(i))
+		}
+	}
+	budget, ctx := newScatterBudget(ctx, h.scatter, "view_read", input.Partial)
+	defer budget.done()
+	n, err := budget.shards(len(stores))
+	if err != nil {
+		return nil, err
+	}
+	partial := n < len(stores)
+	stores = stores[:n]
+
+	latest := def.Aggregate == view.Latest
+	results := make([]view.Result, len(stores))
+	errs := make([]error, len(stores))
+	var wg sync.WaitGroup
+	for i, store := range stores {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = store.Read(ctx, input.Key, latest)
+		}()
+	}
+	wg.Wait()
+
+	var total view.Result
+	var shardErrs []ShardError
+	for i, r := range results {
+		if errs[i] != nil {
+			h.logger.Error("failed to read view", "view", input.Name, "shard_id", ids[i], "error", errs[i])
+			e, err := budget.shardFailed(ctx, ids[i], errs[i], "failed to read view")
+			if err != nil || len(shardErrs)+1 == len(stores) {
+				return nil, failed(ctx, errs[i], "failed to read view")
+			}
+			shardErrs = append(shardErrs, e)
+			continue
+		}
+		total.Merge(r)
+	}
+
+	resp := ViewResponse{Name: def.Name, Key: input.Key, Aggregate: def.Aggregate, Count: total.Count, ShardErrors: shardErrs}
+	if def.Aggregate == view.Sum {
+		resp.Sum = &total.Sum
+	}
+	if m := total.Latest; m != nil {
+		mask := readMask(ctx, input.Mask, h.maskSecret)
+		resp.Latest = &ViewLatestResponse{RowKey: m.RowKey, RefKey: m.RefKey, Body: mask.Apply(m.Body), CreatedAt: m.CreatedAt}
+	}
+	if partial || len(shardErrs) > 0 {
+		resp.Partial, resp.Shards = true, len(stores)-len(shardErrs)
+	}
+	return &ReadViewOutput{Status: multiStatus(shardErrs), Body: resp}, nil
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+	"github.com/ryanbastic/go-mezzanine/internal/view"
+)
+
+func TestReadView(t *testing.T) {
+	const numShards = 4
+	r := shard.NewRouter()
+	views := view.NewRegistry()
+	defs := []view.Definition{
+		{Name: "orders_per_customer", SourceColumn: "order", KeyField: "customer", Aggregate: view.Count},
+		{Name: "spend_per_customer", SourceColumn: "order", KeyField: "customer", Aggregate: view.Sum, ValueField: "total"},
+		{Name: "last_order", SourceColumn: "order", KeyField: "customer", Aggregate: view.Latest, Fields: []string{"total"}},
+	}
+	for i := range numShards {
+		r.Register(shard.ID(i), memory.New())
+		for _, def := range defs {
+			views.RegisterStore(def, shard.ID(i), view.NewMemoryStore())
+		}
+	}
+	notifier := trigger.NewNotifier(trigger.NewPluginRegistry(), nil, testLogger())
+	notifier.AddHandler("views", views.Columns(), views.HandleCell)
+	server := NewServer(testLogger(), r, index.NewRegistry(), trigger.NewPluginRegistry(), notifier, numShards, nil, ServerOptions{Views: views})
+
+	write := func(row uuid.UUID, ref int64, body map[string]any) {
+		t.Helper()
+		data, _ := json.Marshal(map[string]any{"row_key": row, "column_name": "order", "ref_key": ref, "body": body})
+		req := httptest.NewRequest(http.MethodPost, "/v1/cells", bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("write: got %d: %s", w.Code, w.Body.String())
+		}
+		if err := notifier.Drain(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(path string) ViewResponse {
+		t.Helper()
+		w := get(server, path)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d: %s", path, w.Code, w.Body.String())
+		}
+		var resp ViewResponse
+		_ = json.NewDecoder(w.Body).Decode(&resp)
+		return resp
+	}
+
+	rows := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	write(rows[0], 1, map[string]any{"customer": "c-1", "total": 10})
+	write(rows[1], 1, map[string]any{"customer": "c-1", "total": 5.5})
+	time.Sleep(time.Millisecond)
+	write(rows[2], 1, map[string]any{"customer": "c-2", "total": 7})
+	// A new version moves the row to another customer.
+	write(rows[2], 2, map[string]any{"customer": "c-1", "total": 1})
+
+	if got := read("/v1/views/orders_per_customer/c-1"); got.Count != 3 || got.Sum != nil || got.Latest != nil || got.Aggregate != view.Count {
+		t.Errorf("count c-1: got %+v, want 3", got)
+	}
+	if got := read("/v1/views/orders_per_customer/c-2"); got.Count != 0 {
+		t.Errorf("count c-2: got %d, want 0", got.Count)
+	}
+	if got := read("/v1/views/spend_per_customer/c-1"); got.Sum == nil || *got.Sum != 16.5 {
+		t.Errorf("sum c-1: got %+v, want 16.5", got.Sum)
+	}
+	got := read("/v1/views/last_order/c-1")
+	if got.Latest == nil || got.Latest.RowKey != rows[2] || got.Latest.RefKey != 2 || string(got.Latest.Body) != `{"total":1}` {
+		t.Errorf("latest c-1: got %+v", got.Latest)
+	}
+	if got := read("/v1/views/last_order/c-9"); got.Latest != nil || got.Count != 0 {
+		t.Errorf("latest of unknown key: got %+v", got)
+	}
+
+	if w := get(server, "/v1/views/nope/c-1"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown view: got %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/ryanbastic/go-mezzanine/internal/apikey"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// idempotency is the Idempotency-Key a write was sent with and a hash of
+// its request, as the client sent it. Shards remember both for
+// storage.IdempotencyKeyTTL after a write succeeds, so that a retry
+// meeting its own cells is answered with them, and a different request
+// reusing the key is refused.
+type idempotency struct {
+	// key is scoped to the API key making the request, so clients do not
+	// see each other's keys. It is empty without an Idempotency-Key.
+	key  string
+	hash []byte
+}
+
+// newIdempotency returns the idempotency of a write of reqs with key. It
+// must be taken before write hooks, plugins or offloading change the
+// bodies.
+func newIdempotency(ctx context.Context, key string, reqs []cell.WriteCellRequest) idempotency {
+	if key == "" {
+		return idempotency{}
+	}
+	if k, ok := apikey.FromContext(ctx); ok {
+		key = k.Name + "/" + key
+	}
+	type request struct {
+		RowKey     string          `json:"row_key"`
+		ColumnName string          `json:"column_name"`
+		RefKey     int64           `json:"ref_key"`
+		Body       json.RawMessage `json:"body"`
+	}
+	requests := make([]request, len(reqs))
+	for i, req := range reqs {
+		requests[i] = request{RowKey: req.RowKey.String(), ColumnName: req.ColumnName, RefKey: req.RefKey, Body: req.Body}
+	}
+	// Marshalling compacts the bodies, so whitespace does not count.
+	data, _ := json.Marshal(requests)
+	sum := sha256.Sum256(data)
+	return idempotency{key: key, hash: sum[:]}
+}
+
+// recordIdempotency remembers the key of a write that succeeded on store. A
+// failure is only logged: the write stands, and a retry is still compared
+// with the cells it meets.
+func (h *CellHandler) recordIdempotency(ctx context.Context, store storage.CellStore, idem idempotency) {
+	if idem.key == "" {
+		return
+	}
+	if err := storage.RecordIdempotencyKey(ctx, store, idem.key, idem.hash); err != nil {
+		h.logger.Warn("failed to record idempotency key", "idempotency_key", idem.key, "error", err)
+	}
+}
+
+// checkIdempotency reports whether a write meeting existing cells is a
+// retry of the request recorded with its key, whose cells those are. A
+// different request recorded with the key fails with 422; a key that is
+// not remembered reports false, leaving the caller to compare bodies.
+func (h *CellHandler) checkIdempotency(ctx context.Context, store storage.CellStore, idem idempotency) (bool, error) {
+	recorded, err := storage.IdempotencyKeyHash(ctx, store, idem.key)
+	switch {
+	case errors.Is(err, storage.ErrIdempotencyKeyNotFound):
+		return false, nil
+	case err != nil:
+		h.logger.Error("failed to read idempotency key", "idempotency_key", idem.key, "error", err)
+		return false, failed(ctx, err, "failed to check idempotency key")
+	case !bytes.Equal(recorded, idem.hash):
+		return false, huma.Error422UnprocessableEntity("Idempotency-Key was already used for a different request")
+	}
+	return true, nil
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// ListLimit is the page size policy of a list endpoint: requests without a
+// limit get Default, and larger limits are cut down to Max.
+type ListLimit struct {
+	Default int
+	Max     int
+}
+
+// Limits holds the page size policy of every list endpoint.
+type Limits struct {
+	// PartitionRead bounds GET /v1/cells/partitionRead.
+	PartitionRead ListLimit
+	// WindowRead bounds GET /v1/cells/windowRead.
+	WindowRead ListLimit
+	// IndexQuery bounds GET /v1/index/{index_name}/{value}.
+	IndexQuery ListLimit
+	// RowList bounds GET /v1/rows.
+	RowList ListLimit
+	// Query bounds POST /v1/query.
+	Query ListLimit
+}
+
+// DefaultLimits returns the limits used when none are configured.
+func DefaultLimits() Limits {
+	return Limits{
+		PartitionRead: ListLimit{Default: 100, Max: 1000},
+		WindowRead:    ListLimit{Default: 100, Max: 1000},
+		IndexQuery:    ListLimit{Default: 1000, Max: 10000},
+		RowList:       ListLimit{Default: 1000, Max: 10000},
+		Query:         ListLimit{Default: 100, Max: 1000},
+	}
+}
+
+// DefaultMaxWait is the longest partitionRead long-polls for new cells
+// when ServerOptions.MaxWait is unset, within the default HTTP_WRITE_TIMEOUT.
+const DefaultMaxWait = 5 * time.Second
+
+// withDefaults fills unset limits from DefaultLimits.
+func (l Limits) withDefaults() Limits {
+	d := DefaultLimits()
+	l.PartitionRead = l.PartitionRead.or(d.PartitionRead)
+	l.WindowRead = l.WindowRead.or(d.WindowRead)
+	l.IndexQuery = l.IndexQuery.or(d.IndexQuery)
+	l.RowList = l.RowList.or(d.RowList)
+	l.Query = l.Query.or(d.Query)
+	return l
+}
+
+func (l ListLimit) or(d ListLimit) ListLimit {
+	if l.Max <= 0 {
+		l.Max = d.Max
+	}
+	if l.Default <= 0 {
+		l.Default = min(d.Default, l.Max)
+	}
+	l.Default = min(l.Default, l.Max)
+	return l
+}
+
+// Apply returns the page size for a requested limit; zero or negative means
+// the client did not ask for one.
+func (l ListLimit) Apply(requested int) int {
+	if requested <= 0 {
+		return l.Default
+	}
+	return min(requested, l.Max)
+}
+
+// documentLimit records l on the limit query parameter of a registered GET
+// operation, so the OpenAPI spec shows the configured default and maximum.
+// The schema is copied: huma validates requests against the original, and
+// limits above the maximum are clamped rather than rejected.
+func documentLimit(api huma.API, path string, l ListLimit) {
+	item := api.OpenAPI().Paths[path]
+	if item == nil || item.Get == nil {
+		return
+	}
+	for _, p := range item.Get.Parameters {
+		if p.Name != "limit" || p.Schema == nil {
+			continue
+		}
+		s := *p.Schema
+		s.Default = l.Default
+		limitMax := float64(l.Max)
+		s.Maximum = &limitMax
+		s.Description = fmt.Sprintf("Maximum number of results to return (default %d, at most %d)", l.Default, l.Max)
+		p.Schema = &s
+		p.Description = s.Description
+	}
+}
+
+// nextLink returns a Link header value pointing at the next page of path
+// with query q, keeping the request's mask.
+func nextLink(path string, q url.Values, mask []string) string {
+	if len(mask) > 0 {
+		q.Set("mask", strings.Join(mask, ","))
+	}
+	return fmt.Sprintf("<%s?%s>; rel=\"next\"", path, q.Encode())
+}
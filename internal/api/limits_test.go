@@ -0,0 +1,186 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+)
+
+func TestListLimit_Apply(t *testing.T) {
+	l := ListLimit{Default: 100, Max: 1000}
+	for _, tt := range []struct{ in, want int }{
+		{0, 100}, {-5, 100}, {1, 1}, {1000, 1000}, {5000, 1000},
+	} {
+		if got := l.Apply(tt.in); got != tt.want {
+			t.Errorf("Apply(%d) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLimits_WithDefaults(t *testing.T) {
+	l := Limits{
+		PartitionRead: ListLimit{Default: 10},
+		WindowRead:    ListLimit{Max: 50},
+		IndexQuery:    ListLimit{Default: 500, Max: 200},
+	}.withDefaults()
+
+	if l.PartitionRead != (ListLimit{Default: 10, Max: 1000}) {
+		t.Errorf("PartitionRead = %+v", l.PartitionRead)
+	}
+	if l.WindowRead != (ListLimit{Default: 50, Max: 50}) {
+		t.Errorf("WindowRead = %+v, want the default capped at Max", l.WindowRead)
+	}
+	if l.IndexQuery != (ListLimit{Default: 200, Max: 200}) {
+		t.Errorf("IndexQuery = %+v, want the default capped at Max", l.IndexQuery)
+	}
+}
+
+func TestQueryIndex_Limit(t *testing.T) {
+	var entries []index.Entry
+	for range 5 {
+		entries = append(entries, index.Entry{ShardKey: "acme", RowKey: uuid.New(), Body: json.RawMessage(`{}`)})
+	}
+	mock := newMockIndexStore(entries...)
+	registry := index.NewRegistry()
+	for i := range 4 {
+		registry.RegisterStore("order_by_tenant", shard.ID(i), mock)
+	}
+	server := NewServer(testLogger(), shard.NewRouter(), registry, trigger.NewPluginRegistry(), nil, 4, nil, ServerOptions{
+		Limits: Limits{IndexQuery: ListLimit{Default: 2, Max: 3}},
+	})
+
+	for _, tt := range []struct {
+		query string
+		want  []int64
+	}{
+		{"", []int64{1, 2}},
+		{"?limit=10", []int64{1, 2, 3}},
+		{"?after_added_id=3", []int64{4, 5}},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/v1/index/order_by_tenant/acme"+tt.query, nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%q: status: got %d, want %d\nbody: %s", tt.query, w.Code, http.StatusOK, w.Body.String())
+		}
+		var resp []IndexEntryResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if fmt.Sprint(addedIDs(resp)) != fmt.Sprint(tt.want) {
+			t.Errorf("%q: added_ids = %v, want %v", tt.query, addedIDs(resp), tt.want)
+		}
+	}
+}
+
+func addedIDs(entries []IndexEntryResponse) []int64 {
+	ids := make([]int64, len(entries))
+	for i, e := range entries {
+		ids[i] = e.AddedID
+	}
+	return ids
+}
+
+func TestOpenAPI_ReportsLimits(t *testing.T) {
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 4, nil, ServerOptions{
+		Limits: Limits{PartitionRead: ListLimit{Default: 25, Max: 250}},
+	})
+	req := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	var spec struct {
+		Paths map[string]map[string]struct {
+			Parameters []struct {
+				Name   string `json:"name"`
+				Schema struct {
+					Default any     `json:"default"`
+					Maximum float64 `json:"maximum"`
+				} `json:"schema"`
+			} `json:"parameters"`
+		} `json:"paths"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&spec); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	for path, want := range map[string][2]float64{
+		"/v1/cells/partitionRead":        {25, 250},
+		"/v1/cells/windowRead":           {100, 1000},
+		"/v1/index/{index_name}/{value}": {1000, 10000},
+	} {
+		found := false
+		for _, p := range spec.Paths[path]["get"].Parameters {
+			if p.Name != "limit" {
+				continue
+			}
+			found = true
+			if p.Schema.Default != want[0] || p.Schema.Maximum != want[1] {
+				t.Errorf("%s limit: default %v, maximum %v, want %v", path, p.Schema.Default, p.Schema.Maximum, want)
+			}
+		}
+		if !found {
+			t.Errorf("%s: no limit parameter", path)
+		}
+	}
+}
+
+// followLinks fetches path and the pages its Link headers point to, and
+// returns the added_ids of every page.
+func followLinks(t *testing.T, server http.Handler, path string) [][]int64 {
+	t.Helper()
+	var pages [][]int64
+	for path != "" && len(pages) < 10 {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status: got %d, body: %s", path, w.Code, w.Body.String())
+		}
+		var entries []struct {
+			AddedID int64 `json:"added_id"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&entries); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		page := make([]int64, len(entries))
+		for i, e := range entries {
+			page[i] = e.AddedID
+		}
+		pages = append(pages, page)
+
+		path = ""
+		if link := w.Header().Get("Link"); link != "" {
+			m := regexp.MustCompile(`^<([^>]+)>; rel="next"$`).FindStringSubmatch(link)
+			if m == nil {
+				t.Fatalf("Link: got %q, want a next page", link)
+			}
+			path = m[1]
+		}
+	}
+	return pages
+}
+
+func TestQueryIndex_NextLink(t *testing.T) {
+	var entries []index.Entry
+	for range 5 {
+		entries = append(entries, index.Entry{ShardKey: "acme", RowKey: uuid.New(), Body: json.RawMessage(`{}`)})
+	}
+	mock := newMockIndexStore(entries...)
+	registry := index.NewRegistry()
+	for i := range 4 {
+		registry.RegisterStore("order_by_tenant", shard.ID(i), mock)
+	}
+	server := NewServer(testLogger(), shard.NewRouter(), registry, trigger.NewPluginRegistry(), nil, 4, nil, ServerOptions{})
+
+	pages := followLinks(t, server, "/v1/index/order_by_tenant/acme?limit=2")
+	if got, want := fmt.Sprint(pages), "[[1 2] [3 4] [5]]"; got != want {
+		t.Errorf("pages = %s, want %s", got, want)
+	}
+}
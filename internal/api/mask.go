@@ -0,0 +1,169 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"github.com/ryanbastic/go-mezzanine/internal/apikey"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// Mask rewrites JSON bodies on read: Strip fields are removed and Hash
+// fields are replaced by "sha256:<hex>" of their value. Fields are top-level
+// keys or dotted paths into nested objects; fields missing from a body are
+// ignored. Stored cells are never modified.
+type Mask struct {
+	Strip []string
+	Hash  []string
+	// Secret keys the hash with HMAC-SHA256 so that hashed values cannot be
+	// reversed by guessing; without one a plain SHA-256 is used.
+	Secret []byte
+}
+
+// readMask builds the mask of a read request: the fields the client asked to
+// strip plus the policy of the API key it authenticated with. A client can
+// add to its key's mask but not remove from it.
+func readMask(ctx context.Context, requested []string, secret []byte) Mask {
+	m := Mask{Secret: secret}
+	for _, f := range requested {
+		if f = strings.TrimSpace(f); f != "" {
+			m.Strip = append(m.Strip, f)
+		}
+	}
+	if k, ok := apikey.FromContext(ctx); ok {
+		m.Strip = append(m.Strip, k.Mask...)
+		m.Hash = append(m.Hash, k.Hash...)
+	}
+	return m
+}
+
+func (m Mask) empty() bool {
+	return len(m.Strip) == 0 && len(m.Hash) == 0
+}
+
+// covers reports whether the mask strips or hashes any of field: the field
+// itself, a field nested in it or an object holding it. Requests that would
+// reveal such a field by filtering, grouping or sorting on it are refused.
+func (m Mask) covers(field string) bool {
+	overlaps := func(path string) bool {
+		return path == field || strings.HasPrefix(path, field+".") || strings.HasPrefix(field, path+".")
+	}
+	return slices.ContainsFunc(m.Strip, overlaps) || slices.ContainsFunc(m.Hash, overlaps)
+}
+
+// Apply returns body with the mask applied. Bodies that are not JSON
+// objects, or that contain none of the fields, are returned unchanged.
+func (m Mask) Apply(body json.RawMessage) json.RawMessage {
+	if m.empty() {
+		return body
+	}
+	out := body
+	for _, f := range m.Strip {
+		out = rewriteField(out, strings.Split(f, "."), func(json.RawMessage) (json.RawMessage, bool) {
+			return nil, false
+		})
+	}
+	for _, f := range m.Hash {
+		// A field both stripped and hashed stays stripped.
+		if slices.Contains(m.Strip, f) {
+			continue
+		}
+		out = rewriteField(out, strings.Split(f, "."), func(v json.RawMessage) (json.RawMessage, bool) {
+			return m.hash(v), true
+		})
+	}
+	return out
+}
+
+// hash renders the masked form of a value. Strings are hashed without their
+// quotes so that a hash can be computed from a known plaintext value.
+func (m Mask) hash(v json.RawMessage) json.RawMessage {
+	var plain []byte
+	var s string
+	if err := json.Unmarshal(v, &s); err == nil {
+		plain = []byte(s)
+	} else {
+		var b bytes.Buffer
+		if err := json.Compact(&b, v); err != nil {
+			plain = v
+		} else {
+			plain = b.Bytes()
+		}
+	}
+	var sum []byte
+	if len(m.Secret) > 0 {
+		mac := hmac.New(sha256.New, m.Secret)
+		mac.Write(plain)
+		sum = mac.Sum(nil)
+	} else {
+		s := sha256.Sum256(plain)
+		sum = s[:]
+	}
+	out, _ := json.Marshal("sha256:" + hex.EncodeToString(sum))
+	return out
+}
+
+// rewriteField replaces the value at path with fn's result, or removes it
+// when fn returns false.
+func rewriteField(body json.RawMessage, path []string, fn func(json.RawMessage) (json.RawMessage, bool)) json.RawMessage {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(body, &obj); err != nil || obj == nil {
+		return body
+	}
+	v, ok := obj[path[0]]
+	if !ok {
+		return body
+	}
+	if len(path) > 1 {
+		nested := rewriteField(v, path[1:], fn)
+		if bytes.Equal(nested, v) {
+			return body
+		}
+		obj[path[0]] = nested
+	} else if nv, keep := fn(v); keep {
+		obj[path[0]] = nv
+	} else {
+		delete(obj, path[0])
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(obj); err != nil {
+		return body
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n"))
+}
+
+// cell returns a copy of c with its body masked.
+func (m Mask) cell(c *cell.Cell) *cell.Cell {
+	if m.empty() {
+		return c
+	}
+	masked := *c
+	masked.Body = m.Apply(c.Body)
+	return &masked
+}
+
+// maskedIterator applies a mask to the cells of an iterator.
+type maskedIterator struct {
+	storage.CellIterator
+	mask Mask
+}
+
+func (m Mask) iterator(it storage.CellIterator) storage.CellIterator {
+	if m.empty() {
+		return it
+	}
+	return &maskedIterator{CellIterator: it, mask: m}
+}
+
+func (it *maskedIterator) Cell() *cell.Cell {
+	return it.mask.cell(it.CellIterator.Cell())
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/apikey"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+)
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestMask_Apply(t *testing.T) {
+	body := json.RawMessage(`{"name":"Ann","email":"ann@example.com","ssn":"123","address":{"zip":"94107","city":"SF"},"age":42}`)
+	tests := []struct {
+		name string
+		mask Mask
+		want string
+	}{
+		{"empty", Mask{}, string(body)},
+		{"strip", Mask{Strip: []string{"ssn", "email"}}, `{"address":{"zip":"94107","city":"SF"},"age":42,"name":"Ann"}`},
+		{"strip nested", Mask{Strip: []string{"address.zip"}}, `{"address":{"city":"SF"},"age":42,"email":"ann@example.com","name":"Ann","ssn":"123"}`},
+		{"missing field", Mask{Strip: []string{"phone", "address.street", "name.first"}}, string(body)},
+		{"hash", Mask{Hash: []string{"email", "age"}}, `{"address":{"zip":"94107","city":"SF"},"age":"sha256:` + sha256Hex("42") + `","email":"sha256:` + sha256Hex("ann@example.com") + `","name":"Ann","ssn":"123"}`},
+		{"strip wins over hash", Mask{Strip: []string{"email"}, Hash: []string{"email"}}, `{"address":{"zip":"94107","city":"SF"},"age":42,"name":"Ann","ssn":"123"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(tt.mask.Apply(body)); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMask_ApplyNotAnObject(t *testing.T) {
+	m := Mask{Strip: []string{"a"}}
+	for _, body := range []string{`[1,2]`, `"a"`, `null`, `not json`} {
+		if got := string(m.Apply(json.RawMessage(body))); got != body {
+			t.Errorf("Apply(%s) = %s", body, got)
+		}
+	}
+}
+
+func TestMask_HashWithSecret(t *testing.T) {
+	m := Mask{Hash: []string{"email"}, Secret: []byte("k")}
+	mac := hmac.New(sha256.New, []byte("k"))
+	mac.Write([]byte("ann@example.com"))
+	want := `{"email":"sha256:` + hex.EncodeToString(mac.Sum(nil)) + `"}`
+	if got := string(m.Apply(json.RawMessage(`{"email":"ann@example.com"}`))); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestReadMask_CombinesKeyPolicy(t *testing.T) {
+	ctx := apikey.NewContext(context.Background(), &apikey.Key{Name: "support", Mask: []string{"ssn"}, Hash: []string{"email"}})
+	m := readMask(ctx, []string{" phone ", ""}, nil)
+	if len(m.Strip) != 2 || m.Strip[0] != "phone" || m.Strip[1] != "ssn" {
+		t.Errorf("Strip = %q", m.Strip)
+	}
+	if len(m.Hash) != 1 || m.Hash[0] != "email" {
+		t.Errorf("Hash = %q", m.Hash)
+	}
+}
+
+func TestMask_DoesNotModifyStoredCell(t *testing.T) {
+	c := &cell.Cell{Body: json.RawMessage(`{"ssn":"123"}`)}
+	masked := Mask{Strip: []string{"ssn"}}.cell(c)
+	if string(masked.Body) != `{}` || string(c.Body) != `{"ssn":"123"}` {
+		t.Errorf("masked %s, original %s", masked.Body, c.Body)
+	}
+}
+
+func TestMask_Covers(t *testing.T) {
+	m := Mask{Strip: []string{"address.zip"}, Hash: []string{"email"}}
+	for field, want := range map[string]bool{
+		"address.zip":      true,
+		"address":          true,
+		"address.zip.plus": true,
+		"address.city":     false,
+		"email":            true,
+		"emails":           false,
+		"name":             false,
+	} {
+		if got := m.covers(field); got != want {
+			t.Errorf("covers(%q): got %v, want %v", field, got, want)
+		}
+	}
+}
+
+func TestGetCellLatest_MaskQuery(t *testing.T) {
+	store := memory.New()
+	rowKey := uuid.New()
+	seedCells(t, store, cell.Cell{
+		AddedID: 1, RowKey: rowKey, ColumnName: "profile", RefKey: 1,
+		Body: json.RawMessage(`{"name":"Ann","email":"ann@example.com","ssn":"123"}`), CreatedAt: time.Now(),
+	})
+	server := setupTestServer(store, 64)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/cells/"+rowKey.String()+"/profile?mask=email,ssn", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d\nbody: %s", w.Code, w.Body.String())
+	}
+	var resp CellResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if string(resp.Body) != `{"name":"Ann"}` {
+		t.Errorf("body: got %s", resp.Body)
+	}
+}
+
+func TestGetRow_MaskQuery(t *testing.T) {
+	store := memory.New()
+	rowKey := uuid.New()
+	seedCells(t, store,
+		cell.Cell{AddedID: 1, RowKey: rowKey, ColumnName: "profile", RefKey: 1, Body: json.RawMessage(`{"name":"Ann","ssn":"123"}`), CreatedAt: time.Now()},
+		cell.Cell{AddedID: 2, RowKey: rowKey, ColumnName: "settings", RefKey: 1, Body: json.RawMessage(`{"theme":"dark"}`), CreatedAt: time.Now()},
+	)
+	server := setupTestServer(store, 64)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/cells/"+rowKey.String()+"?mask=ssn", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	var resp RowResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Cells) != 2 || string(resp.Cells[0].Body) != `{"name":"Ann"}` || string(resp.Cells[1].Body) != `{"theme":"dark"}` {
+		t.Errorf("cells: got %+v", resp.Cells)
+	}
+}
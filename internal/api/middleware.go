@@ -36,11 +36,16 @@ func Logging(logger *slog.Logger) func(http.Handler) http.Handler {
 }
 
 // Recovery recovers from panics and returns a 500 error.
+// http.ErrAbortHandler is re-raised so the server drops the connection, as
+// a streamed response that fails part-way intends.
 func Recovery(logger *slog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			defer func() {
 				if err := recover(); err != nil {
+					if err == http.ErrAbortHandler {
+						panic(err)
+					}
 					logger.Error("panic recovered", "error", err)
 					w.Header().Set("Content-Type", "application/json")
 					w.WriteHeader(http.StatusInternalServerError)
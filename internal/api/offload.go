@@ -0,0 +1,163 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/offload"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// offloadBodies replaces the bodies of reqs above the offload threshold
+// with pointers, uploading them unless dryRun is set. It runs after
+// beforeWrite, so hooks and synchronous plugins see the original bodies.
+// It returns the bodies it replaced, by index, for withOriginal; nil if it
+// replaced none.
+func (h *CellHandler) offloadBodies(ctx context.Context, reqs []cell.WriteCellRequest, dryRun bool) ([]json.RawMessage, error) {
+	if h.offload == nil {
+		return nil, nil
+	}
+	var originals []json.RawMessage
+	replace := func(i int, body json.RawMessage) {
+		if originals == nil {
+			originals = make([]json.RawMessage, len(reqs))
+		}
+		originals[i], reqs[i].Body = reqs[i].Body, body
+	}
+	for i := range reqs {
+		if dryRun {
+			if ptr := h.offload.Pointer(reqs[i].Body); ptr != nil {
+				replace(i, ptr)
+			}
+			continue
+		}
+		body, err := h.offload.Offload(ctx, reqs[i].Body)
+		if err != nil {
+			h.logger.Error("failed to offload cell body", "row_key", reqs[i].RowKey, "column_name", reqs[i].ColumnName, "error", err)
+			return nil, huma.Error502BadGateway("failed to offload cell body")
+		}
+		if !bytes.Equal(body, reqs[i].Body) {
+			replace(i, body)
+		}
+	}
+	return originals, nil
+}
+
+// withOriginal returns c with the i-th of the bodies offloadBodies
+// replaced, if it replaced that one, so indexes and plugins notified of the
+// write see the document rather than its pointer. c itself is not modified.
+func withOriginal(c *cell.Cell, originals []json.RawMessage, i int) *cell.Cell {
+	if originals == nil || originals[i] == nil {
+		return c
+	}
+	out := *c
+	out.Body = originals[i]
+	return &out
+}
+
+// resolver fetches the offloaded bodies of cells read with resolve=true.
+// The zero value, and one for a server without offloading, returns cells
+// as they are stored.
+type resolver struct {
+	offloader *offload.Offloader
+}
+
+func (h *CellHandler) resolver(resolve bool) resolver {
+	if !resolve {
+		return resolver{}
+	}
+	return resolver{offloader: h.offload}
+}
+
+// cell returns c with its body resolved. c itself is never modified, since
+// it may be shared with the read cache.
+func (r resolver) cell(ctx context.Context, c *cell.Cell) (*cell.Cell, error) {
+	if r.offloader == nil || c == nil {
+		return c, nil
+	}
+	if _, ok := offload.Parse(c.Body); !ok {
+		return c, nil
+	}
+	body, err := r.offloader.Resolve(ctx, c.Body)
+	if err != nil {
+		return nil, err
+	}
+	out := *c
+	out.Body = body
+	return &out, nil
+}
+
+// cells resolves the cells of a slice, copying it if any changes.
+func (r resolver) cells(ctx context.Context, cells []cell.Cell) ([]cell.Cell, error) {
+	if r.offloader == nil {
+		return cells, nil
+	}
+	var out []cell.Cell
+	for i := range cells {
+		c, err := r.cell(ctx, &cells[i])
+		if err != nil {
+			return nil, err
+		}
+		if c == &cells[i] {
+			continue
+		}
+		if out == nil {
+			out = append([]cell.Cell(nil), cells...)
+		}
+		out[i] = *c
+	}
+	if out == nil {
+		return cells, nil
+	}
+	return out, nil
+}
+
+// resolvedIterator resolves the cells of an iterator; a failure ends it
+// with the error.
+type resolvedIterator struct {
+	storage.CellIterator
+	ctx      context.Context
+	resolver resolver
+	cur      *cell.Cell
+	err      error
+}
+
+func (r resolver) iterator(ctx context.Context, it storage.CellIterator) storage.CellIterator {
+	if r.offloader == nil {
+		return it
+	}
+	return &resolvedIterator{CellIterator: it, ctx: ctx, resolver: r}
+}
+
+func (it *resolvedIterator) Next() bool {
+	if it.err != nil || !it.CellIterator.Next() {
+		return false
+	}
+	it.cur, it.err = it.resolver.cell(it.ctx, it.CellIterator.Cell())
+	return it.err == nil
+}
+
+func (it *resolvedIterator) Cell() *cell.Cell {
+	return it.cur
+}
+
+func (it *resolvedIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.CellIterator.Err()
+}
+
+// resolveFailed answers a read whose offloaded body could not be fetched
+// with 502, and any other error as failed does.
+func (h *CellHandler) resolveFailed(ctx context.Context, err error, msg string) error {
+	if errors.Is(err, offload.ErrResolve) {
+		h.logger.Error("failed to resolve offloaded body", "error", err)
+		return huma.Error502BadGateway("failed to fetch offloaded cell body")
+	}
+	return failed(ctx, err, msg)
+}
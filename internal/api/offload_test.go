@@ -0,0 +1,180 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/offload"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+)
+
+type memBucket struct {
+	objects map[string][]byte
+	err     error
+}
+
+func (b *memBucket) Put(_ context.Context, key string, data []byte) error {
+	if b.err != nil {
+		return b.err
+	}
+	b.objects[key] = data
+	return nil
+}
+
+func (b *memBucket) Get(_ context.Context, key string) ([]byte, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.objects[key], nil
+}
+
+func setupOffloadServer(bucket *memBucket) (http.Handler, *memory.Store) {
+	store := memory.New()
+	r := shard.NewRouter()
+	for i := range 8 {
+		r.Register(shard.ID(i), store)
+	}
+	opts := ServerOptions{Offload: offload.New(bucket, "s3://lake/bodies", 64)}
+	return NewServer(testLogger(), r, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 8, nil, opts), store
+}
+
+func TestOffload_WriteAndResolve(t *testing.T) {
+	bucket := &memBucket{objects: map[string][]byte{}}
+	server, store := setupOffloadServer(bucket)
+	row := uuid.New()
+	text := strings.Repeat("x", 100)
+	big := map[string]any{"row_key": row, "column_name": "doc", "ref_key": 1, "body": map[string]string{"text": text}}
+	small := map[string]any{"row_key": row, "column_name": "meta", "ref_key": 1, "body": map[string]string{"a": "b"}}
+
+	// A dry run computes the pointer without uploading.
+	data, _ := json.Marshal(big)
+	req := httptest.NewRequest(http.MethodPost, "/v1/cells?dry_run=true", strings.NewReader(string(data)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	var dry CellResponse
+	_ = json.NewDecoder(w.Body).Decode(&dry)
+	if _, ok := offload.Parse(dry.Body); w.Code != http.StatusOK || !ok || len(bucket.objects) != 0 {
+		t.Fatalf("dry run: got %d %s with %d objects, want a pointer and no upload", w.Code, dry.Body, len(bucket.objects))
+	}
+
+	if w := postCell(t, server, big, ""); w.Code != http.StatusCreated {
+		t.Fatalf("write: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := postCell(t, server, small, ""); w.Code != http.StatusCreated {
+		t.Fatalf("write: got %d: %s", w.Code, w.Body.String())
+	}
+	stored, err := store.GetCellLatest(t.Context(), row, "doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, ok := offload.Parse(stored.Body)
+	if !ok || string(stored.Body) != string(dry.Body) || len(bucket.objects) != 1 || p.Size != int64(len(text))+11 {
+		t.Fatalf("stored %s with %d objects, want the dry run's pointer", stored.Body, len(bucket.objects))
+	}
+
+	get := func(path string) (int, string) {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code, w.Body.String()
+	}
+	want := `{"text":"` + text + `"}`
+	base := "/v1/cells/" + row.String() + "/doc"
+	if code, body := get(base); code != http.StatusOK || !strings.Contains(body, offload.Key) {
+		t.Errorf("without resolve: got %d %s, want the pointer", code, body)
+	}
+	if code, body := get(base + "?resolve=true"); code != http.StatusOK || !strings.Contains(body, want) {
+		t.Errorf("latest: got %d %s, want the body", code, body)
+	}
+	if code, body := get(base + "/1?resolve=true&mask=text"); code != http.StatusOK || strings.Contains(body, text) || strings.Contains(body, offload.Key) {
+		t.Errorf("masked: got %d %s, want the resolved body masked", code, body)
+	}
+	if code, body := get("/v1/cells/" + row.String() + "?resolve=true"); code != http.StatusOK || !strings.Contains(body, want) || !strings.Contains(body, `{"a":"b"}`) {
+		t.Errorf("row: got %d %s, want both bodies", code, body)
+	}
+	if w := batchGet(server, "?resolve=true", []uuid.UUID{row}); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want) {
+		t.Errorf("batchGet: got %d %s, want the body", w.Code, w.Body.String())
+	}
+	// The cell read from the store is left as it is.
+	if again, _ := store.GetCellLatest(t.Context(), row, "doc"); string(again.Body) != string(stored.Body) {
+		t.Errorf("stored cell changed to %s", again.Body)
+	}
+
+	bucket.err = errors.New("status 503")
+	if code, _ := get(base + "?resolve=true"); code != http.StatusBadGateway {
+		t.Errorf("bucket down: got %d, want 502", code)
+	}
+	if code, _ := get("/v1/cells/" + row.String() + "?resolve=true"); code != http.StatusBadGateway {
+		t.Errorf("row with bucket down: got %d, want 502", code)
+	}
+	refs := []map[string]any{{"row_key": row, "column_name": "doc", "ref_key": 1}}
+	data, _ = json.Marshal(map[string]any{"refs": refs})
+	req = httptest.NewRequest(http.MethodPost, "/v1/cells/multiget?resolve=true", strings.NewReader(string(data)))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("multiget with bucket down: got %d, want 502", w.Code)
+	}
+	big["ref_key"] = 2
+	if w := postCell(t, server, big, ""); w.Code != http.StatusBadGateway {
+		t.Errorf("write with bucket down: got %d, want 502", w.Code)
+	}
+}
+
+func TestOffload_IndexesOriginalBody(t *testing.T) {
+	bucket := &memBucket{objects: map[string][]byte{}}
+	store := memory.New()
+	r := shard.NewRouter()
+	indexes := index.NewRegistry()
+	indexes.Register(nil, index.Definition{Name: "doc_by_title", SourceColumn: "doc", ShardKeyField: "title", Fields: []string{"title"}}, 8)
+	entries := index.NewMemoryStore()
+	for i := range 8 {
+		r.Register(shard.ID(i), store)
+		indexes.RegisterStore("doc_by_title", shard.ID(i), entries)
+	}
+	opts := ServerOptions{Offload: offload.New(bucket, "s3://lake/bodies", 64)}
+	server := NewServer(testLogger(), r, indexes, trigger.NewPluginRegistry(), nil, 8, nil, opts)
+
+	body := map[string]string{"title": "report", "text": strings.Repeat("x", 100)}
+	if w := postCell(t, server, map[string]any{"row_key": uuid.New(), "column_name": "doc", "ref_key": 1, "body": body}, ""); w.Code != http.StatusCreated {
+		t.Fatalf("write: got %d: %s", w.Code, w.Body.String())
+	}
+	if len(bucket.objects) != 1 {
+		t.Fatalf("got %d objects, want the body offloaded", len(bucket.objects))
+	}
+	if n, err := entries.CountByShardKey(t.Context(), "report"); err != nil || n != 1 {
+		t.Errorf("index entries for the offloaded cell: got %d, %v, want 1", n, err)
+	}
+}
+
+func TestWriteCell_RejectsPointerBodies(t *testing.T) {
+	server, _ := setupOffloadServer(&memBucket{objects: map[string][]byte{}})
+	ptr := map[string]any{offload.Key: map[string]any{"url": "s3://lake/bodies/sha256/x", "sha256": strings.Repeat("ab", 32), "size": 10}}
+	if w := postCell(t, server, map[string]any{"row_key": uuid.New(), "column_name": "doc", "ref_key": 1, "body": ptr}, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("pointer-shaped body: got %d, want 400: %s", w.Code, w.Body.String())
+	}
+	row := uuid.New()
+	if w := postCell(t, server, map[string]any{"row_key": row, "column_name": "doc", "ref_key": 1, "body": map[string]any{"a": 1}}, ""); w.Code != http.StatusCreated {
+		t.Fatalf("write: got %d", w.Code)
+	}
+	patch := httptest.NewRequest(http.MethodPatch, "/v1/cells/"+row.String()+"/doc", strings.NewReader(`{"a":null,"`+offload.Key+`":{"url":"s3://x","sha256":"`+strings.Repeat("ab", 32)+`","size":10}}`))
+	patch.Header.Set("Content-Type", "application/merge-patch+json")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, patch)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("patch into a pointer: got %d, want 400: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "offload pointer") {
+		t.Errorf("patch into a pointer: got %s, want it refused as a pointer", w.Body.String())
+	}
+}
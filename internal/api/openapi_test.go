@@ -0,0 +1,233 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+)
+
+// specSchema is the subset of a JSON schema the completeness checks read.
+type specSchema struct {
+	Ref                  string                 `json:"$ref"`
+	Format               string                 `json:"format"`
+	Description          string                 `json:"description"`
+	Examples             []any                  `json:"examples"`
+	Items                *specSchema            `json:"items"`
+	Properties           map[string]*specSchema `json:"properties"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties"`
+}
+
+type specOperation struct {
+	OperationID string   `json:"operationId"`
+	Summary     string   `json:"summary"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+	Parameters  []struct {
+		In string `json:"in"`
+	} `json:"parameters"`
+	RequestBody *struct {
+		Content map[string]struct {
+			Schema specSchema `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]struct {
+		Content map[string]struct {
+			Schema specSchema `json:"schema"`
+		} `json:"content"`
+	} `json:"responses"`
+}
+
+type spec struct {
+	Tags []struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	} `json:"tags"`
+	Paths      map[string]map[string]specOperation `json:"paths"`
+	Components struct {
+		Schemas map[string]*specSchema `json:"schemas"`
+	} `json:"components"`
+}
+
+var updateSpec = flag.Bool("update-openapi", false, "rewrite openapi.json from the server's spec")
+
+// rawSpec returns the spec served by a server with default options,
+// indented as in openapi.json.
+func rawSpec(t *testing.T) []byte {
+	t.Helper()
+	server := NewServer(testLogger(), shard.NewRouter(), index.NewRegistry(), trigger.NewPluginRegistry(), nil, 4, nil, ServerOptions{})
+	req := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want %d", w.Code, http.StatusOK)
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, w.Body.Bytes(), "", "  "); err != nil {
+		t.Fatalf("indent: %v", err)
+	}
+	out.WriteByte('\n')
+	return out.Bytes()
+}
+
+func loadSpec(t *testing.T) spec {
+	t.Helper()
+	var s spec
+	if err := json.Unmarshal(rawSpec(t), &s); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return s
+}
+
+// TestOpenAPISpec_Snapshot keeps openapi.json, which the Go, Python and
+// TypeScript clients are generated from, in step with the server. make
+// openapi rewrites it.
+func TestOpenAPISpec_Snapshot(t *testing.T) {
+	path := filepath.Join("..", "..", "openapi.json")
+	got := rawSpec(t)
+	if *updateSpec {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("openapi.json is out of date; run make openapi")
+	}
+}
+
+// TestOpenAPISpec_ComponentsReused checks that request and response bodies
+// refer to named schemas, alone or as array items, so generated clients
+// share one model per type instead of one per operation. Binary bodies have
+// no model to share.
+func TestOpenAPISpec_ComponentsReused(t *testing.T) {
+	s := loadSpec(t)
+	check := func(name, where string, schema specSchema) {
+		if schema.Items != nil {
+			schema = *schema.Items
+		}
+		if schema.Ref == "" && schema.Format != "binary" {
+			t.Errorf("%s: %s schema is inline, not a component", name, where)
+		}
+	}
+	for path, item := range s.Paths {
+		for method, op := range item {
+			name := strings.ToUpper(method) + " " + path
+			if op.RequestBody != nil {
+				for ct, c := range op.RequestBody.Content {
+					check(name, "request "+ct, c.Schema)
+				}
+			}
+			for code, resp := range op.Responses {
+				for ct, c := range resp.Content {
+					check(name, code+" "+ct, c.Schema)
+				}
+			}
+		}
+	}
+}
+
+// TestOpenAPISpec_Complete guards what SDK generators rely on: described
+// operations and tags, and typed error responses for every failure the
+// middleware or handlers can return.
+func TestOpenAPISpec_Complete(t *testing.T) {
+	s := loadSpec(t)
+
+	tags := make(map[string]bool)
+	for _, tag := range s.Tags {
+		if tag.Description == "" {
+			t.Errorf("tag %q has no description", tag.Name)
+		}
+		tags[tag.Name] = true
+	}
+
+	ids := make(map[string]bool)
+	for path, item := range s.Paths {
+		for method, op := range item {
+			name := strings.ToUpper(method) + " " + path
+			if op.OperationID == "" || ids[op.OperationID] {
+				t.Errorf("%s: missing or duplicate operationId %q", name, op.OperationID)
+			}
+			ids[op.OperationID] = true
+			if op.Summary == "" || op.Description == "" {
+				t.Errorf("%s: needs a summary and a description", name)
+			}
+			if len(op.Tags) == 0 {
+				t.Errorf("%s: no tags", name)
+			}
+			for _, tag := range op.Tags {
+				if !tags[tag] {
+					t.Errorf("%s: tag %q is not declared", name, tag)
+				}
+			}
+
+			success := false
+			for code, resp := range op.Responses {
+				switch {
+				case code == "default":
+					t.Errorf("%s: lists a default response instead of its error codes", name)
+				case code[0] == '2':
+					success = true
+				case code[0] == '4' || code[0] == '5':
+					if !strings.HasSuffix(resp.Content["application/problem+json"].Schema.Ref, "/ErrorModel") {
+						t.Errorf("%s: %s response is not an ErrorModel", name, code)
+					}
+				}
+			}
+			if !success {
+				t.Errorf("%s: no success response", name)
+			}
+			// Every operation can fail, and every limited one can be shed.
+			codes := []string{"500"}
+			if _, limited := ClassifyRoute(httptest.NewRequest(strings.ToUpper(method), path, nil)); limited {
+				codes = append(codes, "503")
+			}
+			for _, code := range codes {
+				if _, ok := op.Responses[code]; !ok {
+					t.Errorf("%s: missing %s response", name, code)
+				}
+			}
+			if len(op.Parameters) > 0 {
+				if _, ok := op.Responses["422"]; !ok {
+					t.Errorf("%s: has parameters but no 422 response", name)
+				}
+			}
+		}
+	}
+}
+
+// TestOpenAPISpec_SchemasDocumented checks that every property of the API's
+// own schemas is described, and that scalar properties carry an example.
+func TestOpenAPISpec_SchemasDocumented(t *testing.T) {
+	s := loadSpec(t)
+	for name, schema := range s.Components.Schemas {
+		if name == "ErrorModel" || name == "ErrorDetail" {
+			continue // defined by huma
+		}
+		for prop, p := range schema.Properties {
+			if prop == "$schema" {
+				continue
+			}
+			if p.Description == "" {
+				t.Errorf("%s.%s has no description", name, prop)
+			}
+			nested := p.Ref != "" || (p.Items != nil && p.Items.Ref != "") || strings.HasPrefix(string(p.AdditionalProperties), "{")
+			if !nested && len(p.Examples) == 0 {
+				t.Errorf("%s.%s has no example", name, prop)
+			}
+		}
+	}
+}
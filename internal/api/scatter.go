@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+)
+
+// ScatterLimits bounds the work of one request to an endpoint that gathers
+// from several shards: multiget, rows:batchGet and index totals. A request
+// over a limit is refused with 422, or with partial=true answered with what
+// fits, the rest listed as unread. Zero is unlimited.
+//
+// partial=true also lets these endpoints answer when some of the shards
+// they read fail: with 207 Multi-Status, the failed shards' errors listed in
+// shard_errors and what they held as unread. Without it (strict mode), any
+// shard failing fails the request, as does every shard failing either way.
+type ScatterLimits struct {
+	// MaxShards is the most shards one request reads.
+	MaxShards int
+	// MaxCells is the most cells one multiget or batchGet returns. Shards
+	// still being read when it is exceeded are cancelled.
+	MaxCells int
+}
+
+var scatterBudgetExceeded = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "mezzanine",
+		Name:      "scatter_budget_exceeded_total",
+		Help:      "Scatter-gather requests over a ScatterLimits budget, by endpoint, limit (shards or cells) and outcome (rejected or partial).",
+	},
+	[]string{"endpoint", "limit", "outcome"},
+)
+
+// scatterBudget tracks one request's spending against ScatterLimits.
+type scatterBudget struct {
+	limits   ScatterLimits
+	endpoint string
+	partial  bool
+
+	cancel   context.CancelFunc
+	cells    atomic.Int64
+	exceeded atomic.Bool
+}
+
+// newScatterBudget returns a budget for a request and the context its shard
+// reads run under, which is cancelled once the cell budget is exceeded.
+func newScatterBudget(ctx context.Context, limits ScatterLimits, endpoint string, partial bool) (*scatterBudget, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	return &scatterBudget{limits: limits, endpoint: endpoint, partial: partial, cancel: cancel}, ctx
+}
+
+// shards returns how many of n shards the request may read, or an error if
+// that is fewer than n and the request does not accept partial results.
+func (b *scatterBudget) shards(n int) (int, error) {
+	if b.limits.MaxShards <= 0 || n <= b.limits.MaxShards {
+		return n, nil
+	}
+	if err := b.over("shards", fmt.Sprintf("reads %d shards, at most %d allowed", n, b.limits.MaxShards)); err != nil {
+		return 0, err
+	}
+	return b.limits.MaxShards, nil
+}
+
+// spend records n cells read from a shard, cancelling the other shard reads
+// when they exceed the cell budget.
+func (b *scatterBudget) spend(n int) {
+	if b.limits.MaxCells > 0 && b.cells.Add(int64(n)) > int64(b.limits.MaxCells) && !b.exceeded.Swap(true) {
+		b.cancel()
+	}
+}
+
+// fits reports whether a result of n more cells, on top of used, stays
+// within the cell budget.
+func (b *scatterBudget) fits(used, n int) bool {
+	return b.limits.MaxCells <= 0 || used+n <= b.limits.MaxCells
+}
+
+// checkCells returns the error for a request that exceeded its cell
+// budget, if it does not accept partial results.
+func (b *scatterBudget) checkCells() error {
+	if !b.exceeded.Load() {
+		return nil
+	}
+	return b.over("cells", fmt.Sprintf("returns more than %d cells", b.limits.MaxCells))
+}
+
+// cancelled reports whether err from a shard read is the budget's own
+// cancellation, leaving that shard's results unread. Other errors, even
+// once the budget is exceeded, are the shard's failures.
+func (b *scatterBudget) cancelled(ctx context.Context, err error) bool {
+	return errors.Is(err, context.Canceled) && b.exceeded.Load() && ctx.Err() == nil
+}
+
+// done releases the budget's context.
+func (b *scatterBudget) done() {
+	b.cancel()
+}
+
+func (b *scatterBudget) over(limit, detail string) error {
+	if b.partial {
+		scatterBudgetExceeded.WithLabelValues(b.endpoint, limit, "partial").Inc()
+		return nil
+	}
+	scatterBudgetExceeded.WithLabelValues(b.endpoint, limit, "rejected").Inc()
+	return huma.Error422UnprocessableEntity(fmt.Sprintf("query budget exceeded: the request %s; split it, or pass partial=true for the results that fit", detail))
+}
+
+// ShardError is a shard whose read failed in a partial response: the error
+// the whole request would have failed with, without partial=true.
+type ShardError struct {
+	Shard     int    `json:"shard" doc:"Shard ID" example:"3"`
+	Status    int    `json:"status" doc:"HTTP status of the shard's failure" example:"503"`
+	Detail    string `json:"detail" doc:"What failed" example:"failed to get rows: backend unavailable"`
+	Retryable bool   `json:"retryable" doc:"Whether reading the shard again may succeed" example:"true"`
+}
+
+var scatterShardErrors = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "mezzanine",
+		Name:      "scatter_shard_errors_total",
+		Help:      "Shard reads that failed in scatter-gather requests answered with partial results, by endpoint.",
+	},
+	[]string{"endpoint"},
+)
+
+// shardFailed returns the ShardError for err from reading shard id, or the
+// error failing the request if it does not accept partial results.
+func (b *scatterBudget) shardFailed(ctx context.Context, id shard.ID, err error, msg string) (ShardError, error) {
+	err = failed(ctx, err, msg)
+	if !b.partial {
+		return ShardError{}, err
+	}
+	scatterShardErrors.WithLabelValues(b.endpoint).Inc()
+	out := ShardError{Shard: int(id), Status: http.StatusInternalServerError, Detail: err.Error()}
+	var e *ErrorModel
+	if errors.As(err, &e) {
+		out.Status, out.Retryable = e.Status, e.Retryable
+	}
+	return out, nil
+}
+
+// multiStatus is the status of a response: 207 if it lists shard errors.
+func multiStatus(errs []ShardError) int {
+	if len(errs) > 0 {
+		return http.StatusMultiStatus
+	}
+	return http.StatusOK
+}
@@ -0,0 +1,304 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+)
+
+// scatterServer serves 8 shards from one store, with rows on shards 0 to 3
+// in that order, each holding cells columns.
+func scatterServer(t *testing.T, limits ScatterLimits, columns int) (http.Handler, []uuid.UUID) {
+	t.Helper()
+	store := memory.New()
+	r := shard.NewRouter()
+	for i := range 8 {
+		r.Register(shard.ID(i), store)
+	}
+	var rows []uuid.UUID
+	for id := range 4 {
+		row := uuid.New()
+		for defaultShard(row, 8) != shard.ID(id) {
+			row = uuid.New()
+		}
+		rows = append(rows, row)
+		for c := range columns {
+			req := cell.WriteCellRequest{RowKey: row, ColumnName: fmt.Sprintf("c%d", c), RefKey: 1, Body: json.RawMessage(`{}`)}
+			if _, err := store.WriteCell(t.Context(), req); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return NewServer(testLogger(), r, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 8, nil, ServerOptions{Scatter: limits}), rows
+}
+
+func batchGet(server http.Handler, query string, rows []uuid.UUID) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(map[string]any{"row_keys": rows})
+	req := httptest.NewRequest(http.MethodPost, "/v1/rows:batchGet"+query, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	return w
+}
+
+func TestScatter_Unlimited(t *testing.T) {
+	server, rows := scatterServer(t, ScatterLimits{}, 3)
+	w := batchGet(server, "", rows)
+	var resp GetRowsResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || len(resp.Rows) != 4 || resp.Partial || resp.Unread != nil {
+		t.Errorf("got %d %+v, want all 4 rows", w.Code, resp)
+	}
+}
+
+func TestScatter_MaxShards(t *testing.T) {
+	server, rows := scatterServer(t, ScatterLimits{MaxShards: 2}, 1)
+	if w := batchGet(server, "", rows); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("over the fan-out: got %d, want 422", w.Code)
+	}
+	if w := batchGet(server, "", rows[:2]); w.Code != http.StatusOK {
+		t.Errorf("within the fan-out: got %d, want 200", w.Code)
+	}
+
+	w := batchGet(server, "?partial=true", rows)
+	var resp GetRowsResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || !resp.Partial || len(resp.Rows) != 2 || len(resp.Unread) != 2 || resp.Unread[0] != rows[2] || resp.Unread[1] != rows[3] {
+		t.Errorf("partial: got %d %+v, want the first two shards read and the rest unread", w.Code, resp)
+	}
+
+	refs := make([]map[string]any, len(rows))
+	for i, row := range rows {
+		refs[i] = map[string]any{"row_key": row, "column_name": "c0", "ref_key": 1}
+	}
+	if w := postMultiget(t, server, refs); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("multiget over the fan-out: got %d, want 422", w.Code)
+	}
+}
+
+func TestScatter_MaxCells(t *testing.T) {
+	server, rows := scatterServer(t, ScatterLimits{MaxCells: 5}, 2)
+	if w := batchGet(server, "", rows); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("over the cell budget: got %d, want 422\nbody: %s", w.Code, w.Body.String())
+	}
+
+	// Whole rows are returned while they fit; shards still being read
+	// when the budget runs out are cancelled, so which depends on timing.
+	w := batchGet(server, "?partial=true", rows)
+	var resp GetRowsResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	returned := 0
+	for _, cells := range resp.Rows {
+		if len(cells) != 2 {
+			t.Errorf("got a row with %d cells, want 2", len(cells))
+		}
+		returned += len(cells)
+	}
+	if w.Code != http.StatusOK || !resp.Partial || returned > 5 || len(resp.Rows)+len(resp.Unread) != 4 || len(resp.Missing) != 0 {
+		t.Errorf("partial: got %d %+v, want at most 5 cells and the other rows unread", w.Code, resp)
+	}
+
+	refs := make([]map[string]any, 0, 8)
+	for _, row := range rows {
+		for c := range 2 {
+			refs = append(refs, map[string]any{"row_key": row, "column_name": fmt.Sprintf("c%d", c), "ref_key": 1})
+		}
+	}
+	data, _ := json.Marshal(map[string]any{"refs": refs})
+	req := httptest.NewRequest(http.MethodPost, "/v1/cells/multiget?partial=true", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	var cells GetCellsResponse
+	_ = json.NewDecoder(w.Body).Decode(&cells)
+	if w.Code != http.StatusOK || !cells.Partial || len(cells.Cells) > 5 || len(cells.Cells)+len(cells.Unread) != 8 || len(cells.Missing) != 0 {
+		t.Errorf("partial multiget: got %d with %d cells and %d unread, want at most 5 cells and the rest unread", w.Code, len(cells.Cells), len(cells.Unread))
+	}
+}
+
+func TestScatter_CountIndexTotal(t *testing.T) {
+	registry := index.NewRegistry()
+	for i := range 4 {
+		registry.RegisterStore("order_by_tenant", shard.ID(i), newMockIndexStore(index.Entry{Body: json.RawMessage(`{}`)}))
+	}
+	server := NewServer(testLogger(), shard.NewRouter(), registry, trigger.NewPluginRegistry(), nil, 4, nil, ServerOptions{Scatter: ScatterLimits{MaxShards: 3}})
+
+	if code, _ := getCount(t, server, "/v1/index/order_by_tenant:count"); code != http.StatusUnprocessableEntity {
+		t.Errorf("over the fan-out: got %d, want 422", code)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/v1/index/order_by_tenant:count?partial=true", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	var resp IndexCountResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || resp.Count != 3 || !resp.Partial || resp.Shards != 3 || resp.ShardErrors != nil {
+		t.Errorf("partial: got %d %+v, want 3 of 3 shards", w.Code, resp)
+	}
+}
+
+func TestScatter_ListRowsByTag(t *testing.T) {
+	r := shard.NewRouter()
+	for i := range 4 {
+		r.Register(shard.ID(i), memory.New())
+	}
+	server := NewServer(testLogger(), r, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 4, nil, ServerOptions{Scatter: ScatterLimits{MaxShards: 1}})
+	tagged := make(map[uuid.UUID]bool)
+	for range 10 {
+		row := uuid.New()
+		tagged[row] = true
+		if w := putTags(server, "", row, "backfill"); w.Code != http.StatusOK {
+			t.Fatalf("put tags: got %d", w.Code)
+		}
+	}
+
+	// Each page reads one shard, so a listing takes one page per shard
+	// however large the pages may be.
+	pages := 0
+	for after := ""; ; pages++ {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/rows?tag=backfill&limit=100&after="+after, nil))
+		var page ListRowsByTagResponse
+		_ = json.NewDecoder(w.Body).Decode(&page)
+		if w.Code != http.StatusOK {
+			t.Fatalf("list: got %d", w.Code)
+		}
+		for _, row := range page.Rows {
+			if row.ShardID != pages || !tagged[row.RowKey] {
+				t.Fatalf("page %d: unexpected row %+v", pages, row)
+			}
+			delete(tagged, row.RowKey)
+		}
+		if page.Next == "" {
+			break
+		}
+		after = page.Next
+	}
+	if pages != 3 || len(tagged) != 0 {
+		t.Errorf("got %d pages leaving %d rows unlisted, want 4 pages listing every row", pages+1, len(tagged))
+	}
+}
+
+// downStore is a shard whose backend is unreachable.
+type downStore struct {
+	storage.CellStore
+}
+
+func (downStore) GetCells(context.Context, []cell.CellRef) ([]*cell.Cell, error) {
+	return nil, &pgconn.PgError{Code: "08006"}
+}
+
+func (downStore) GetRows(context.Context, []uuid.UUID) (map[uuid.UUID][]cell.Cell, error) {
+	return nil, &pgconn.PgError{Code: "08006"}
+}
+
+func TestScatter_ShardErrors(t *testing.T) {
+	store := memory.New()
+	r := shard.NewRouter()
+	for i := range 8 {
+		if i == 1 {
+			r.Register(shard.ID(i), downStore{store})
+		} else {
+			r.Register(shard.ID(i), store)
+		}
+	}
+	server := NewServer(testLogger(), r, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 8, nil, ServerOptions{})
+	var rows []uuid.UUID
+	for id := range 3 {
+		row := uuid.New()
+		for defaultShard(row, 8) != shard.ID(id) {
+			row = uuid.New()
+		}
+		rows = append(rows, row)
+		if _, err := store.WriteCell(t.Context(), cell.WriteCellRequest{RowKey: row, ColumnName: "c0", RefKey: 1, Body: json.RawMessage(`{}`)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if w := batchGet(server, "", rows); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("strict: got %d, want 503", w.Code)
+	}
+	w := batchGet(server, "?partial=true", rows)
+	var resp GetRowsResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	want := []ShardError{{Shard: 1, Status: http.StatusServiceUnavailable, Detail: "failed to get rows: backend unavailable", Retryable: true}}
+	if w.Code != http.StatusMultiStatus || len(resp.Rows) != 2 || !resp.Partial || len(resp.Unread) != 1 || resp.Unread[0] != rows[1] || !reflect.DeepEqual(resp.ShardErrors, want) {
+		t.Errorf("partial: got %d %+v, want 207 with shard 1 failed", w.Code, resp)
+	}
+	if w := batchGet(server, "?partial=true", rows[1:2]); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("every shard failed: got %d, want 503", w.Code)
+	}
+
+	refs := make([]map[string]any, len(rows))
+	for i, row := range rows {
+		refs[i] = map[string]any{"row_key": row, "column_name": "c0", "ref_key": 1}
+	}
+	if w := postMultiget(t, server, refs); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("strict multiget: got %d, want 503", w.Code)
+	}
+	data, _ := json.Marshal(map[string]any{"refs": refs})
+	req := httptest.NewRequest(http.MethodPost, "/v1/cells/multiget?partial=true", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	var cells GetCellsResponse
+	_ = json.NewDecoder(w.Body).Decode(&cells)
+	if w.Code != http.StatusMultiStatus || len(cells.Cells) != 2 || len(cells.Unread) != 1 || len(cells.ShardErrors) != 1 || cells.ShardErrors[0].Shard != 1 {
+		t.Errorf("partial multiget: got %d %+v, want 207 with shard 1 failed", w.Code, cells)
+	}
+}
+
+func TestScatter_CountIndexTotalShardErrors(t *testing.T) {
+	registry := index.NewRegistry()
+	for i := range 4 {
+		store := newMockIndexStore(index.Entry{Body: json.RawMessage(`{}`)})
+		if i == 2 {
+			store.queryErr = errors.New("db connection failed")
+		}
+		registry.RegisterStore("order_by_tenant", shard.ID(i), store)
+	}
+	server := NewServer(testLogger(), shard.NewRouter(), registry, trigger.NewPluginRegistry(), nil, 4, nil, ServerOptions{})
+
+	if code, _ := getCount(t, server, "/v1/index/order_by_tenant:count"); code != http.StatusInternalServerError {
+		t.Errorf("strict: got %d, want 500", code)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/v1/index/order_by_tenant:count?partial=true", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	var resp IndexCountResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	want := []ShardError{{Shard: 2, Status: http.StatusInternalServerError, Detail: "failed to count index"}}
+	if w.Code != http.StatusMultiStatus || resp.Count != 3 || !resp.Partial || resp.Shards != 3 || !reflect.DeepEqual(resp.ShardErrors, want) {
+		t.Errorf("partial: got %d %+v, want 3 shards counted and shard 2 failed", w.Code, resp)
+	}
+}
+
+func TestScatterBudget_CancelledOnlyByTheBudget(t *testing.T) {
+	budget, readCtx := newScatterBudget(context.Background(), ScatterLimits{MaxCells: 1}, "test", true)
+	defer budget.done()
+	budget.spend(2)
+	if readCtx.Err() == nil {
+		t.Fatal("reads were not cancelled over the cell budget")
+	}
+	ctx := context.Background()
+	if !budget.cancelled(ctx, fmt.Errorf("query: %w", context.Canceled)) {
+		t.Error("a read cut off by the budget is not reported cancelled")
+	}
+	if budget.cancelled(ctx, errors.New("backend unavailable")) {
+		t.Error("a backend failure after the budget ran out is reported cancelled")
+	}
+}
@@ -4,27 +4,127 @@ import (
 	"context"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/danielgtaylor/huma/v2/adapters/humachi"
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/ryanbastic/go-mezzanine/internal/apikey"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/column"
 	"github.com/ryanbastic/go-mezzanine/internal/index"
 	"github.com/ryanbastic/go-mezzanine/internal/metrics"
+	"github.com/ryanbastic/go-mezzanine/internal/offload"
+	"github.com/ryanbastic/go-mezzanine/internal/schema"
 	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+	"github.com/ryanbastic/go-mezzanine/internal/stream"
 	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+	"github.com/ryanbastic/go-mezzanine/internal/view"
+	mezzanine "github.com/ryanbastic/go-mezzanine/pkg/mezzanine"
 )
 
+// ServerOptions holds the tunable policies of the API. The zero value uses
+// the defaults.
+type ServerOptions struct {
+	// Limits sets page sizes of list endpoints; unset limits use
+	// DefaultLimits.
+	Limits Limits
+	// Scatter bounds the shards and cells of requests to endpoints that
+	// gather from several shards; the zero value is unlimited.
+	Scatter ScatterLimits
+	// MaxWait bounds how long partitionRead long-polls for new cells
+	// (see PartitionReadInput.Wait); zero uses DefaultMaxWait.
+	MaxWait time.Duration
+	// ServerTiming adds a Server-Timing header to cell and batch writes,
+	// breaking their latency down into store, index and notify phases.
+	ServerTiming bool
+	// ShardBackends names the backend serving each shard range, reported
+	// by GET /v1/shards/map and /v1/shards/forKey; nil leaves shards'
+	// backends unknown.
+	ShardBackends []ShardBackend
+	// APIKeys, when set, makes API requests present one of its keys and
+	// applies the key's masking policy to what it reads.
+	APIKeys *apikey.Set
+	// RowACL sets whether the tenants of API keys own the rows they write
+	// and are kept from other tenants' rows; empty is RowACLOff.
+	RowACL RowACL
+	// RowMetadata records when, and by which API key, each row was first
+	// written, in its _mezz.meta system column (GET
+	// /v1/rows/{row_key}/meta).
+	RowMetadata bool
+	// RowKeyFormat is how row keys are generated for single writes that
+	// omit one; empty generates UUIDv7 keys.
+	RowKeyFormat cell.RowKeyFormat
+	// MaskHashSecret keys the HMAC of hashed fields; without it hashed
+	// fields use a plain SHA-256.
+	MaskHashSecret []byte
+	// Body bounds request bodies and sets how strictly they are decoded;
+	// unset limits use DefaultBodyLimits.
+	Body BodyLimits
+	// Columns records the columns written through the API; nil uses an
+	// in-memory registry.
+	Columns *column.Registry
+	// TriggerCheckpoints holds plugins' undelivered cells (see
+	// trigger.Notifier.SetCheckpoints); nil lists none.
+	TriggerCheckpoints trigger.CheckpointStore
+	// Streams holds the streams plugins subscribe to; nil uses an in-memory
+	// registry.
+	Streams *stream.Registry
+	// Schemas holds the schemas of columns' cell bodies; nil uses an
+	// in-memory registry.
+	Schemas *schema.Registry
+	// WriteHooks run, in order, on every cell written through the API
+	// before plugins subscribed synchronously to its column validate it
+	// and it is stored.
+	WriteHooks []WriteHook
+	// Views holds the materialized views served under /v1/views; nil
+	// serves none.
+	Views *view.Registry
+	// Offload moves cell bodies above its threshold to object storage,
+	// storing pointers to them in their place; nil stores every body in
+	// PostgreSQL.
+	Offload *offload.Offloader
+	// RetryAfter is the least Retry-After sent with 503 responses, such as
+	// those for transient backend failures; zero uses DefaultRetryAfter.
+	RetryAfter time.Duration
+}
+
 // NewServer creates an HTTP server with all routes configured.
 // backends maps backend names to Pinger instances (e.g. *pgxpool.Pool) for
 // readiness checks. Pass nil when backends are not available (e.g. in tests).
-func NewServer(logger *slog.Logger, router *shard.Router, indexRegistry *index.Registry, pluginRegistry *trigger.PluginRegistry, notifier *trigger.Notifier, numShards int, backends map[string]Pinger) http.Handler {
+func NewServer(logger *slog.Logger, router *shard.Router, indexRegistry *index.Registry, pluginRegistry *trigger.PluginRegistry, notifier *trigger.Notifier, numShards int, backends map[string]Pinger, opts ServerOptions) http.Handler {
+	installErrorModel()
+	opts.Limits = opts.Limits.withDefaults()
+	opts.Body = opts.Body.withDefaults()
+	if opts.Columns == nil {
+		opts.Columns = column.NewRegistry()
+	}
+	if opts.Streams == nil {
+		opts.Streams = stream.NewRegistry()
+	}
+	if opts.Schemas == nil {
+		opts.Schemas = schema.NewRegistry()
+	}
+	if opts.Views == nil {
+		opts.Views = view.NewRegistry()
+	}
+
 	mux := chi.NewRouter()
 
 	mux.Use(RequestID)
 	mux.Use(Logging(logger))
 	mux.Use(Recovery(logger))
+	mux.Use(RetryAfter(opts.RetryAfter))
 	mux.Use(metrics.Metrics)
+	mux.Use(Compress(DefaultCompressMinSize))
+	mux.Use(LimitRequestBody(max(opts.Body.MaxBytes, opts.Body.MaxBatchBytes)))
+	if opts.APIKeys != nil {
+		mux.Use(RequireAPIKey(opts.APIKeys))
+	}
+	mux.Use(ResolveAliases(router, numShards, opts.RowACL, logger))
 
 	// Health probes registered directly on Chi (need conditional status codes).
 	healthHandler := NewHealthHandler(backends, logger)
@@ -35,20 +135,54 @@ func NewServer(logger *slog.Logger, router *shard.Router, indexRegistry *index.R
 
 	config := huma.DefaultConfig("Mezzanine API", "1.0.0")
 	config.Info.Description = "Sharded cell-based data store"
+	config.Formats = apiFormats()
+	config.Tags = apiTags
 	api := humachi.New(mux, config)
 
-	cellHandler := NewCellHandler(router, numShards, indexRegistry, notifier, logger)
-	indexHandler := NewIndexHandler(indexRegistry, numShards, logger)
-	pluginHandler := NewPluginHandler(pluginRegistry, logger)
+	cellHandler := NewCellHandler(router, numShards, indexRegistry, notifier, opts, logger)
+	indexHandler := NewIndexHandler(indexRegistry, numShards, opts, logger)
+	viewHandler := NewViewHandler(opts.Views, numShards, opts, logger)
+	queryHandler := NewQueryHandler(router, numShards, opts, logger)
+	pluginHandler := NewPluginHandler(pluginRegistry, opts.Streams, opts.TriggerCheckpoints, logger)
+	streamHandler := NewStreamHandler(opts.Streams, pluginRegistry, logger)
+	schemaHandler := NewSchemaHandler(opts.Schemas, logger)
+	columnHandler := NewColumnHandler(opts.Columns)
 
+	registerMetaRoutes(api, cellHandler)
 	registerCellRoutes(api, cellHandler)
+	registerPatchRoute(api, cellHandler)
+	registerUpdateRoute(api, cellHandler)
+	registerBlobRoutes(api, cellHandler)
+	registerAliasRoutes(api, cellHandler)
+	registerQueryRoutes(api, queryHandler)
+	registerRowKeyRoute(api)
 	registerIndexRoutes(api, indexHandler)
-	registerPluginRoutes(api, pluginHandler)
-	registerShardRoutes(api, numShards)
+	registerViewRoutes(api, viewHandler)
+	registerPluginRoutes(api, pluginHandler, opts.Body.MaxBytes)
+	registerStreamRoutes(api, streamHandler, opts.Body.MaxBytes)
+	registerSchemaRoutes(api, schemaHandler, opts.Body.MaxBytes)
+	registerColumnRoutes(api, columnHandler)
+	registerShardRoutes(api, router, numShards, newShardMap(opts.ShardBackends, backends), logger)
+	if opts.Body.AllowUnknownFields {
+		allowUnknownFields(api)
+	}
 
 	return mux
 }
 
+// apiTags describes the operation tags in the OpenAPI spec.
+var apiTags = []*huma.Tag{
+	{Name: "cells", Description: "Immutable, versioned cells addressed by (row_key, column_name, ref_key), and reads of rows and partitions."},
+	{Name: "aliases", Description: "Human-friendly names for rows, which cell routes take in place of a row_key under /v1/alias/{alias}/."},
+	{Name: "index", Description: "Secondary indexes: denormalized entries looked up by a shard key taken from cell bodies."},
+	{Name: "views", Description: "Materialized views: counts, sums and latest rows per key, maintained from cell bodies as they are written."},
+	{Name: "columns", Description: "Registry of the column names in use, with their owners, descriptions, schemas and write statistics."},
+	{Name: "plugins", Description: "Trigger plugins: JSON-RPC endpoints notified when cells in their subscribed columns or streams are written."},
+	{Name: "streams", Description: "Named selections of cells by column and body filter that plugins subscribe to."},
+	{Name: "schemas", Description: "Versioned JSON Schemas of columns' cell bodies, the payloads of plugin notifications."},
+	{Name: "shards", Description: "Cluster layout."},
+}
+
 // --- Shard Info ---
 
 type ShardCountInput struct{}
@@ -61,14 +195,150 @@ type ShardCountOutput struct {
 	Body ShardCountResponse
 }
 
-func registerShardRoutes(api huma.API, numShards int) {
+type ShardHeadInput struct {
+	ShardID int `path:"shard_id" doc:"Shard number" minimum:"0"`
+}
+
+type ShardHeadResponse struct {
+	ShardID   int       `json:"shard_id" doc:"Shard number" example:"3"`
+	AddedID   int64     `json:"added_id" doc:"added_id of the shard's newest cell; 0 if the shard is empty" example:"1024"`
+	CreatedAt time.Time `json:"created_at,omitzero" doc:"Creation time of the shard's newest cell; omitted if the shard is empty" example:"2026-02-06T12:00:00Z"`
+}
+
+type ShardHeadOutput struct {
+	Body ShardHeadResponse
+}
+
+type ShardMapInput struct{}
+
+type ShardPlacement struct {
+	ShardID int    `json:"shard_id" doc:"Shard number" example:"3"`
+	Backend string `json:"backend,omitempty" doc:"Name of the backend serving the shard; omitted if the server was not given its shard config" example:"primary"`
+	Table   string `json:"table" doc:"PostgreSQL table holding the shard's cells" example:"cells_0003"`
+}
+
+type ShardMapEntry struct {
+	ShardPlacement
+	Status string `json:"status" enum:"ok,error,unknown" doc:"Result of pinging the shard's backend: unknown if the server cannot ping it" example:"ok"`
+}
+
+type ShardHashResponse struct {
+	Function string `json:"function" enum:"fnv1a,xxhash,murmur3" doc:"Function row keys and index keys are hashed to shards with" example:"fnv1a"`
+	Version  int    `json:"version" doc:"Version of the function's key-to-shard mapping" example:"1"`
+	Seed     uint64 `json:"seed" doc:"Seed of the function; always 0 for fnv1a" example:"0"`
+}
+
+type ShardMapResponse struct {
+	NumShards int               `json:"num_shards" doc:"Number of configured shards" example:"64"`
+	Hash      ShardHashResponse `json:"hash" doc:"How keys are placed on shards, as recorded in the shard config; clients that group writes by shard must hash with it"`
+	Shards    []ShardMapEntry   `json:"shards" doc:"Every shard in order"`
+}
+
+type ShardMapOutput struct {
+	Body ShardMapResponse
+}
+
+type ShardForKeyInput struct {
+	RowKey uuid.UUID `path:"row_key" doc:"Row key UUID"`
+}
+
+type ShardForKeyResponse struct {
+	RowKey uuid.UUID `json:"row_key" doc:"Row key UUID" example:"550e8400-e29b-41d4-a716-446655440000"`
+	ShardPlacement
+}
+
+type ShardForKeyOutput struct {
+	Body ShardForKeyResponse
+}
+
+func registerShardRoutes(api huma.API, router *shard.Router, numShards int, shards *shardMap, logger *slog.Logger) {
 	huma.Register(api, huma.Operation{
 		OperationID: "get-shard-count",
 		Method:      http.MethodGet,
 		Path:        "/v1/shards/count",
 		Summary:     "Get shard count",
+		Description: "Returns the number of shards rows are hashed into, which clients need to compute a row's shard.",
 		Tags:        []string{"shards"},
+		Errors:      []int{http.StatusServiceUnavailable},
 	}, func(ctx context.Context, input *ShardCountInput) (*ShardCountOutput, error) {
 		return &ShardCountOutput{Body: ShardCountResponse{NumShards: numShards}}, nil
 	})
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-shard-head",
+		Method:      http.MethodGet,
+		Path:        "/v1/shards/{shard_id}/head",
+		Summary:     "Get a shard's head",
+		Description: "Returns the added_id and created_at of the shard's newest cell. A consumer reading the shard with partitionRead in added_id order has caught up with every write committed before this request once its position reaches added_id; its lag is the age of the first cell it has yet to read. Slower transactions can still commit cells below the head for a moment after it is read.",
+		Tags:        []string{"shards"},
+		Errors:      []int{http.StatusBadRequest, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	}, func(ctx context.Context, input *ShardHeadInput) (*ShardHeadOutput, error) {
+		if input.ShardID >= numShards {
+			return nil, huma.Error400BadRequest("invalid shard_id")
+		}
+		head, err := shardHead(ctx, router, input.ShardID, logger)
+		if err != nil {
+			return nil, err
+		}
+		return &ShardHeadOutput{Body: ShardHeadResponse{ShardID: input.ShardID, AddedID: head.AddedID, CreatedAt: head.CreatedAt}}, nil
+	})
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-shard-map",
+		Method:      http.MethodGet,
+		Path:        "/v1/shards/map",
+		Summary:     "Get the shard map",
+		Description: "Returns every shard with the backend serving it, its table and whether the backend answered a ping in the last few seconds, for tooling that reasons about placement.",
+		Tags:        []string{"shards"},
+		Errors:      []int{http.StatusInternalServerError},
+	}, func(ctx context.Context, input *ShardMapInput) (*ShardMapOutput, error) {
+		status := shards.health(ctx)
+		resp := ShardMapResponse{NumShards: numShards, Hash: shardHashToResponse(router.Hash()), Shards: make([]ShardMapEntry, numShards)}
+		for id := range numShards {
+			p := shards.placement(id)
+			s, ok := status[p.Backend]
+			if !ok {
+				s = "unknown"
+			}
+			resp.Shards[id] = ShardMapEntry{ShardPlacement: p, Status: s}
+		}
+		return &ShardMapOutput{Body: resp}, nil
+	})
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-shard-for-key",
+		Method:      http.MethodGet,
+		Path:        "/v1/shards/forKey/{row_key}",
+		Summary:     "Get a row key's shard",
+		Description: "Returns the shard a row key hashes to, the backend serving it and its table.",
+		Tags:        []string{"shards"},
+		Errors:      []int{http.StatusServiceUnavailable},
+	}, func(ctx context.Context, input *ShardForKeyInput) (*ShardForKeyOutput, error) {
+		id := router.ForRowKey(input.RowKey, numShards)
+		return &ShardForKeyOutput{Body: ShardForKeyResponse{RowKey: input.RowKey, ShardPlacement: shards.placement(int(id))}}, nil
+	})
+}
+
+// shardHashToResponse spells out the defaults of h.
+func shardHashToResponse(h mezzanine.ShardHash) ShardHashResponse {
+	resp := ShardHashResponse{Function: h.Function, Version: max(h.Version, 1), Seed: h.Seed}
+	if resp.Function == "" {
+		resp.Function = mezzanine.HashFNV1a
+	}
+	return resp
+}
+
+// shardHead reads a shard's write position, mapping failures to API errors.
+func shardHead(ctx context.Context, router *shard.Router, shardID int, logger *slog.Logger) (storage.Head, error) {
+	store, err := router.StoreFor(shard.ID(shardID))
+	if err != nil {
+		logger.Error("shard routing failed", "shard_id", shardID, "error", err)
+		return storage.Head{}, huma.Error500InternalServerError("shard routing failed")
+	}
+	head, err := store.Head(ctx)
+	if err != nil {
+		logger.Error("failed to read shard head", "shard_id", shardID, "error", err)
+		return storage.Head{}, failed(ctx, err, "failed to read shard head")
+	}
+	return head, nil
 }
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// ShardBackend is a backend and the inclusive range of shards it serves.
+type ShardBackend struct {
+	Name       string
+	ShardStart int
+	ShardEnd   int
+}
+
+// shardStatusTTL is how long the backends' ping results are reused, so that
+// polling the shard map does not ping every backend on every request.
+const shardStatusTTL = 5 * time.Second
+
+// shardMap reports where shards are placed and whether their backends are
+// up.
+type shardMap struct {
+	backends []ShardBackend
+	pingers  map[string]Pinger
+	now      func() time.Time
+
+	mu       sync.Mutex
+	status   map[string]string
+	pingedAt time.Time
+}
+
+func newShardMap(backends []ShardBackend, pingers map[string]Pinger) *shardMap {
+	return &shardMap{backends: backends, pingers: pingers, now: time.Now}
+}
+
+// placement returns the backend and table of shard id.
+func (m *shardMap) placement(id int) ShardPlacement {
+	p := ShardPlacement{ShardID: id, Table: storage.ShardTable(id)}
+	for _, b := range m.backends {
+		if id >= b.ShardStart && id <= b.ShardEnd {
+			p.Backend = b.Name
+			break
+		}
+	}
+	return p
+}
+
+// health returns "ok" or "error" by backend name, from pinging the
+// backends at most once per shardStatusTTL. Requests arriving while the
+// backends are pinged wait for the result. Backends without a Pinger are
+// left out.
+func (m *shardMap) health(ctx context.Context) map[string]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.status == nil || m.now().Sub(m.pingedAt) >= shardStatusTTL {
+		// The result is shared, so it is not cut short by the request
+		// that happens to refresh it.
+		m.status, m.pingedAt = m.ping(context.WithoutCancel(ctx)), m.now()
+	}
+	return m.status
+}
+
+// ping pings the shards' backends concurrently and returns "ok" or "error"
+// by backend name. Backends without a Pinger are left out.
+func (m *shardMap) ping(ctx context.Context) map[string]string {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		status = make(map[string]string, len(m.backends))
+	)
+	for _, b := range m.backends {
+		p, ok := m.pingers[b.Name]
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(name string, p Pinger) {
+			defer wg.Done()
+			s := "ok"
+			if err := p.Ping(ctx); err != nil {
+				s = "error"
+			}
+			mu.Lock()
+			status[name] = s
+			mu.Unlock()
+		}(b.Name, p)
+	}
+	wg.Wait()
+	return status
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// RouteClass groups routes that share a concurrency limit.
+type RouteClass string
+
+const (
+	ClassRead  RouteClass = "read"
+	ClassWrite RouteClass = "write"
+	ClassAdmin RouteClass = "admin"
+)
+
+var (
+	shedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "mezzanine",
+			Name:      "requests_shed_total",
+			Help:      "Requests rejected with 503 because their route class was at its concurrency limit.",
+		},
+		[]string{"class"},
+	)
+
+	classInFlight = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "mezzanine",
+			Name:      "class_requests_in_flight",
+			Help:      "Requests in flight per route class, as counted by the load shedder.",
+		},
+		[]string{"class"},
+	)
+)
+
+// ShedLimits bounds in-flight requests per route class; 0 is unlimited.
+type ShedLimits struct {
+	Reads  int
+	Writes int
+	Admin  int
+	// RetryAfter is sent with shed requests (default 1s).
+	RetryAfter time.Duration
+}
+
+// LoadShedder rejects requests with 503 and Retry-After once their route
+// class has too many requests in flight. Failing fast keeps a traffic spike
+// from queueing on the connection pools, where every request would time out
+// instead of most of them succeeding.
+type LoadShedder struct {
+	slots      map[RouteClass]chan struct{}
+	retryAfter string
+}
+
+// NewLoadShedder creates a LoadShedder.
+func NewLoadShedder(limits ShedLimits) *LoadShedder {
+	if limits.RetryAfter <= 0 {
+		limits.RetryAfter = time.Second
+	}
+	secs := int((limits.RetryAfter + time.Second - 1) / time.Second)
+	l := &LoadShedder{slots: make(map[RouteClass]chan struct{}), retryAfter: strconv.Itoa(secs)}
+	for class, n := range map[RouteClass]int{ClassRead: limits.Reads, ClassWrite: limits.Writes, ClassAdmin: limits.Admin} {
+		if n > 0 {
+			l.slots[class] = make(chan struct{}, n)
+		}
+	}
+	return l
+}
+
+// Middleware limits requests by the class ClassifyRoute assigns them.
+// Health probes and metrics are never shed.
+func (l *LoadShedder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class, ok := ClassifyRoute(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		l.serve(class, next, w, r)
+	})
+}
+
+// MiddlewareFor limits every request as class, e.g. a whole admin listener.
+func (l *LoadShedder) MiddlewareFor(class RouteClass) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			l.serve(class, next, w, r)
+		})
+	}
+}
+
+func (l *LoadShedder) serve(class RouteClass, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	slots, limited := l.slots[class]
+	if !limited {
+		next.ServeHTTP(w, r)
+		return
+	}
+	select {
+	case slots <- struct{}{}:
+	default:
+		shedTotal.WithLabelValues(string(class)).Inc()
+		w.Header().Set("Retry-After", l.retryAfter)
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]any{
+			"title":     http.StatusText(http.StatusServiceUnavailable),
+			"status":    http.StatusServiceUnavailable,
+			"detail":    "server is overloaded (" + string(class) + " requests); retry later",
+			"retryable": true,
+		})
+		return
+	}
+	gauge := classInFlight.WithLabelValues(string(class))
+	gauge.Inc()
+	defer func() {
+		gauge.Dec()
+		<-slots
+	}()
+	next.ServeHTTP(w, r)
+}
+
+// ClassifyRoute returns the route class of r, or false for requests that
+// are never shed (health probes, metrics).
+func ClassifyRoute(r *http.Request) (RouteClass, bool) {
+	p := r.URL.Path
+	switch {
+	case p == "/v1/livez" || p == "/v1/readyz" || p == "/v1/health" || p == "/v1/shards/map" || p == "/metrics":
+		return "", false
+	case strings.HasPrefix(p, "/v1/plugins"):
+		return ClassAdmin, true
+	case r.Method == http.MethodGet || r.Method == http.MethodHead || p == "/v1/cells/multiget" || p == "/v1/rows:batchGet" || p == "/v1/query":
+		return ClassRead, true
+	default:
+		return ClassWrite, true
+	}
+}
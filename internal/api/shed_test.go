@@ -0,0 +1,121 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestClassifyRoute(t *testing.T) {
+	tests := []struct {
+		method, path string
+		want         RouteClass
+		limited      bool
+	}{
+		{http.MethodGet, "/v1/cells/abc/profile", ClassRead, true},
+		{http.MethodPost, "/v1/cells/multiget", ClassRead, true},
+		{http.MethodPost, "/v1/rows:batchGet", ClassRead, true},
+		{http.MethodPost, "/v1/query", ClassRead, true},
+		{http.MethodGet, "/v1/index/user_by_email/a@b.c", ClassRead, true},
+		{http.MethodPost, "/v1/cells", ClassWrite, true},
+		{http.MethodPost, "/v1/cells/batch", ClassWrite, true},
+		{http.MethodPost, "/v1/plugins", ClassAdmin, true},
+		{http.MethodGet, "/v1/plugins", ClassAdmin, true},
+		{http.MethodGet, "/v1/readyz", "", false},
+		{http.MethodGet, "/v1/shards/map", "", false},
+		{http.MethodGet, "/metrics", "", false},
+	}
+	for _, tt := range tests {
+		got, limited := ClassifyRoute(httptest.NewRequest(tt.method, tt.path, nil))
+		if got != tt.want || limited != tt.limited {
+			t.Errorf("%s %s: got (%q, %v), want (%q, %v)", tt.method, tt.path, got, limited, tt.want, tt.limited)
+		}
+	}
+}
+
+// blockingHandler holds requests until release is closed.
+func blockingHandler() (http.Handler, chan struct{}, *sync.WaitGroup) {
+	release := make(chan struct{})
+	var entered sync.WaitGroup
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered.Done()
+		<-release
+	})
+	return h, release, &entered
+}
+
+func TestLoadShedder_ShedsOverLimit(t *testing.T) {
+	next, release, entered := blockingHandler()
+	h := NewLoadShedder(ShedLimits{Writes: 2}).Middleware(next)
+
+	var done sync.WaitGroup
+	entered.Add(2)
+	for i := 0; i < 2; i++ {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/cells", nil))
+		}()
+	}
+	entered.Wait()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/cells", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("write over limit: status %d, want 503", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("Retry-After = %q, want 1", rec.Header().Get("Retry-After"))
+	}
+	if !strings.Contains(rec.Body.String(), `"retryable":true`) {
+		t.Errorf("body = %s, want retryable", rec.Body.String())
+	}
+
+	// Reads have no limit and are unaffected by busy writes.
+	close(release)
+	entered.Add(1)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/cells/x", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("read: status %d, want 200", rec.Code)
+	}
+	done.Wait()
+
+	// Slots are released when requests finish.
+	entered.Add(1)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/cells", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("write after release: status %d, want 200", rec.Code)
+	}
+}
+
+func TestLoadShedder_MiddlewareFor(t *testing.T) {
+	next, release, entered := blockingHandler()
+	h := NewLoadShedder(ShedLimits{Admin: 1}).MiddlewareFor(ClassAdmin)(next)
+
+	entered.Add(1)
+	go h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/shards", nil))
+	entered.Wait()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status %d, want 503", rec.Code)
+	}
+	close(release)
+}
+
+func TestLoadShedder_HealthNeverShed(t *testing.T) {
+	next, release, entered := blockingHandler()
+	close(release)
+	h := NewLoadShedder(ShedLimits{Reads: 1}).Middleware(next)
+	entered.Add(1)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status %d, want 200", rec.Code)
+	}
+}
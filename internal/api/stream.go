@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"reflect"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/negotiation"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// streamTypes are the response types GetRow and PartitionRead negotiate
+// between. JSON is written one cell at a time; MessagePack is buffered.
+var streamTypes = []string{"application/json", "application/msgpack", "application/x-msgpack"}
+
+// cellStream sends the cells of an iterator as a JSON array as they are
+// read, so a large row or partition is never held in memory as a whole.
+// The response uses chunked encoding since its length is not known ahead.
+type cellStream struct {
+	it       storage.CellIterator
+	ct       string
+	more     bool
+	buffered any
+	logger   *slog.Logger
+	msg      string
+}
+
+// newCellStream prepares a response body for it, negotiated from accept.
+// It reads the first cell, so that an error from the query itself is still
+// returned with a status code; wrap builds the buffered (non-JSON)
+// response from all of the cells. A later error aborts the response.
+func newCellStream(it storage.CellIterator, accept string, wrap func([]CellResponse) any, logger *slog.Logger, msg string) (*cellStream, error) {
+	s := &cellStream{it: it, ct: negotiation.SelectQValueFast(accept, streamTypes), logger: logger, msg: msg}
+	if s.ct == "" {
+		s.ct = "application/json"
+	}
+	if s.ct != "application/json" {
+		defer it.Close()
+		cells := []CellResponse{}
+		for it.Next() {
+			cells = append(cells, cellToResponse(it.Cell()))
+		}
+		if err := it.Err(); err != nil {
+			return nil, err
+		}
+		s.buffered = wrap(cells)
+		return s, nil
+	}
+	s.more = it.Next()
+	if !s.more {
+		if err := it.Err(); err != nil {
+			it.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// body returns the huma body callback. prefix and suffix surround the
+// array of cells, for responses that wrap it in an object.
+func (s *cellStream) body(prefix, suffix string) func(huma.Context) {
+	return func(ctx huma.Context) {
+		ctx.SetHeader("Content-Type", s.ct)
+		ctx.SetStatus(http.StatusOK)
+		w := ctx.BodyWriter()
+		if s.buffered != nil {
+			if err := msgpackFormat.Marshal(w, s.buffered); err != nil {
+				s.logger.Error(s.msg, "error", err)
+			}
+			return
+		}
+		defer s.it.Close()
+
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		buf.WriteString(prefix)
+		buf.WriteByte('[')
+		for first := true; s.more; first = false {
+			if !first {
+				buf.WriteByte(',')
+			}
+			if err := enc.Encode(cellToResponse(s.it.Cell())); err != nil {
+				s.abort(err)
+			}
+			buf.Truncate(buf.Len() - 1) // Encode's trailing newline
+			if _, err := w.Write(buf.Bytes()); err != nil {
+				return // client went away
+			}
+			buf.Reset()
+			s.more = s.it.Next()
+		}
+		if err := s.it.Err(); err != nil {
+			s.abort(err)
+		}
+		buf.WriteByte(']')
+		buf.WriteString(suffix)
+		w.Write(buf.Bytes())
+	}
+}
+
+// abort ends a response whose status has already been sent. Closing the
+// connection mid-body is the only way left to tell the client it failed.
+func (s *cellStream) abort(err error) {
+	s.logger.Error(s.msg, "error", err)
+	s.it.Close()
+	panic(http.ErrAbortHandler)
+}
+
+// streamedResponse documents the 200 response of a streamed operation,
+// which huma cannot infer from a callback body.
+func streamedResponse(api huma.API, body any) *huma.Response {
+	schema := api.OpenAPI().Components.Schemas.Schema(reflect.TypeOf(body), true, "")
+	return &huma.Response{
+		Description: http.StatusText(http.StatusOK),
+		Content: map[string]*huma.MediaType{
+			"application/json": {Schema: schema},
+		},
+	}
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+)
+
+// streamingStore serves GetRow and PartitionRead through iterators that
+// fail with err after failAfter cells (never when failAfter < 0).
+type streamingStore struct {
+	*memory.Store
+	cells     []cell.Cell
+	failAfter int
+	err       error
+	closed    int
+}
+
+func (s *streamingStore) iter() *failingIterator {
+	return &failingIterator{s: s, i: -1}
+}
+
+func (s *streamingStore) StreamRow(context.Context, uuid.UUID) (storage.CellIterator, error) {
+	return s.iter(), nil
+}
+
+func (s *streamingStore) StreamPartition(context.Context, int, int, int64, time.Time, int) (storage.CellIterator, error) {
+	return s.iter(), nil
+}
+
+type failingIterator struct {
+	s      *streamingStore
+	i      int
+	err    error
+	closed bool
+}
+
+func (it *failingIterator) Next() bool {
+	if it.err != nil || it.i+1 >= len(it.s.cells) {
+		return false
+	}
+	if it.i+1 == it.s.failAfter {
+		it.err = it.s.err
+		return false
+	}
+	it.i++
+	return true
+}
+
+func (it *failingIterator) Cell() *cell.Cell { return &it.s.cells[it.i] }
+func (it *failingIterator) Err() error       { return it.err }
+
+func (it *failingIterator) Close() {
+	if !it.closed {
+		it.closed = true
+		it.s.closed++
+	}
+}
+
+func newStreamingStore(rowKey uuid.UUID, n int) *streamingStore {
+	s := &streamingStore{Store: memory.New(), failAfter: -1, err: errors.New("connection reset")}
+	for i := 0; i < n; i++ {
+		s.cells = append(s.cells, cell.Cell{
+			AddedID: int64(i + 1), RowKey: rowKey, ColumnName: fmt.Sprintf("col%03d", i), RefKey: 1,
+			Body: json.RawMessage(`{"html":"<b>&</b>"}`), CreatedAt: time.Now(),
+		})
+	}
+	return s
+}
+
+func TestGetRow_Streams(t *testing.T) {
+	rowKey := uuid.New()
+	store := newStreamingStore(rowKey, 500)
+	server := setupTestServer(store, 64)
+
+	w := getRow(server, rowKey, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var resp RowResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v\nbody: %.200s", err, w.Body.String())
+	}
+	if resp.RowKey != rowKey || len(resp.Cells) != 500 {
+		t.Fatalf("row_key %s with %d cells, want %s with 500", resp.RowKey, len(resp.Cells), rowKey)
+	}
+	if resp.Cells[499].ColumnName != "col499" || string(resp.Cells[0].Body) != `{"html":"<b>&</b>"}` {
+		t.Errorf("cells = %+v ... %+v", resp.Cells[0], resp.Cells[499])
+	}
+	if store.closed != 1 {
+		t.Errorf("iterator closed %d times, want 1", store.closed)
+	}
+}
+
+func TestGetRow_StreamEmpty(t *testing.T) {
+	rowKey := uuid.New()
+	server := setupTestServer(newStreamingStore(rowKey, 0), 64)
+
+	w := getRow(server, rowKey, nil)
+	want := fmt.Sprintf(`{"row_key":%q,"cells":[]}`, rowKey)
+	if w.Code != http.StatusOK || w.Body.String() != want {
+		t.Errorf("got %d %s, want 200 %s", w.Code, w.Body.String(), want)
+	}
+}
+
+func TestGetRow_StreamErrorBeforeFirstCell(t *testing.T) {
+	rowKey := uuid.New()
+	store := newStreamingStore(rowKey, 3)
+	store.failAfter = 0
+	server := setupTestServer(store, 64)
+
+	w := getRow(server, rowKey, nil)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+	if store.closed != 1 {
+		t.Errorf("iterator closed %d times, want 1", store.closed)
+	}
+}
+
+func TestGetRow_StreamErrorAbortsResponse(t *testing.T) {
+	rowKey := uuid.New()
+	store := newStreamingStore(rowKey, 100)
+	store.failAfter = 50
+	srv := httptest.NewServer(setupTestServer(store, 64))
+	defer srv.Close()
+
+	// Without compression the first cells are on the wire before the
+	// failure, so the client gets a 200 and then a truncated body.
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	resp, err := client.Get(srv.URL + "/v1/cells/" + rowKey.String())
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (sent before the failure)", resp.StatusCode)
+	}
+	var row RowResponse
+	if err := json.NewDecoder(resp.Body).Decode(&row); err == nil {
+		t.Fatalf("decoded a complete row (%d cells) from an aborted response", len(row.Cells))
+	}
+}
+
+func TestGetRow_StreamMsgpackIsBuffered(t *testing.T) {
+	rowKey := uuid.New()
+	store := newStreamingStore(rowKey, 3)
+	store.failAfter = 2
+	server := setupTestServer(store, 64)
+
+	// Errors surface before the status when the response is buffered.
+	w := getRow(server, rowKey, map[string]string{"Accept": "application/msgpack"})
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+}
+
+func TestPartitionRead_Streams(t *testing.T) {
+	store := newStreamingStore(uuid.New(), 20)
+	server := setupTestServer(store, 64)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/cells/partitionRead?partition_number=3&read_type=2&limit=20", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body: %s", w.Code, w.Body.String())
+	}
+	var cells []CellResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &cells); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(cells) != 20 || cells[19].AddedID != 20 {
+		t.Errorf("got %d cells", len(cells))
+	}
+}
+
+func TestStreamedOperations_DocumentResponseSchema(t *testing.T) {
+	server := setupTestServer(memory.New(), 64)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	var spec struct {
+		Paths map[string]map[string]struct {
+			Parameters []struct {
+				Name string `json:"name"`
+			} `json:"parameters"`
+			Responses map[string]struct {
+				Content map[string]struct {
+					Schema json.RawMessage `json:"schema"`
+				} `json:"content"`
+			} `json:"responses"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("decode spec: %v", err)
+	}
+	for path, want := range map[string]string{
+		"/v1/cells/{row_key}":     `"$ref":"#/components/schemas/RowResponse"`,
+		"/v1/cells/partitionRead": `"$ref":"#/components/schemas/CellResponse"`,
+	} {
+		op := spec.Paths[path]["get"]
+		schema := string(op.Responses["200"].Content["application/json"].Schema)
+		if !json.Valid([]byte(schema)) || !strings.Contains(schema, want) {
+			t.Errorf("%s: 200 schema = %s, want %s", path, schema, want)
+		}
+		for _, p := range op.Parameters {
+			if p.Name == "Accept" {
+				t.Errorf("%s documents the Accept header", path)
+			}
+		}
+	}
+}
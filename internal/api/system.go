@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/ryanbastic/go-mezzanine/internal/apikey"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// System columns (see cell.IsReserved) hold what Mezzanine records about a
+// row next to its data, such as its owner, its creator's key and the
+// provenance of derived cells. Only admin API keys read them; to other keys
+// they do not exist. Without API keys every request reads them, as every
+// request may do anything else.
+
+// readsSystem reports whether the request may read system columns.
+func readsSystem(ctx context.Context) bool {
+	k, ok := apikey.FromContext(ctx)
+	return !ok || k.Admin
+}
+
+// hidden reports whether column is a system column the request may not read.
+func hidden(ctx context.Context, column string) bool {
+	return cell.IsReserved(column) && !readsSystem(ctx)
+}
+
+// hideSystem removes the system columns the request may not read from cells.
+func hideSystem(ctx context.Context, cells []cell.Cell) []cell.Cell {
+	if readsSystem(ctx) {
+		return cells
+	}
+	return slices.DeleteFunc(cells, func(c cell.Cell) bool { return cell.IsReserved(c.ColumnName) })
+}
+
+// hideSystemIterator skips the system columns the request may not read.
+func hideSystemIterator(ctx context.Context, it storage.CellIterator) storage.CellIterator {
+	if readsSystem(ctx) {
+		return it
+	}
+	return &visibleIterator{CellIterator: it}
+}
+
+type visibleIterator struct {
+	storage.CellIterator
+}
+
+func (it *visibleIterator) Next() bool {
+	for it.CellIterator.Next() {
+		if !cell.IsReserved(it.Cell().ColumnName) {
+			return true
+		}
+	}
+	return false
+}
+
+// streamVisiblePartition returns an iterator over a partition page of up
+// to limit cells the request may read. Dropping system columns from a
+// single page could leave it empty while the partition goes on, and a
+// reader resuming after its last cell would then never get past a run of
+// system cells; so pages are read on past them until limit cells are found
+// or a page comes back short.
+func streamVisiblePartition(ctx context.Context, store storage.CellStore, partitionNumber, readType int, addedID int64, createdAfter time.Time, limit int) (storage.CellIterator, error) {
+	it, err := storage.StreamPartition(ctx, store, partitionNumber, readType, addedID, createdAfter, limit)
+	if err != nil || readsSystem(ctx) {
+		return it, err
+	}
+	return &partitionPages{
+		ctx: ctx, store: store, partitionNumber: partitionNumber, readType: readType,
+		addedID: addedID, createdAfter: createdAfter, limit: limit, page: limit, it: it,
+	}, nil
+}
+
+type partitionPages struct {
+	ctx             context.Context
+	store           storage.CellStore
+	partitionNumber int
+	readType        int
+	addedID         int64     // cursor of the next page, by added_id or commit_seq
+	createdAfter    time.Time // with addedID, the cursor by created_at
+	limit           int       // cells left to return
+	page            int       // limit of the current page
+	read            int       // cells read from the current page
+	it              storage.CellIterator
+	err             error
+}
+
+func (p *partitionPages) Next() bool {
+	for p.limit > 0 {
+		for p.it.Next() {
+			c := p.it.Cell()
+			p.read++
+			switch p.readType {
+			case storage.PartitionReadTypeCommitSeq:
+				p.addedID = c.CommitSeq
+			case storage.PartitionReadTypeCreatedAt:
+				p.createdAfter, p.addedID = c.CreatedAt, c.AddedID
+			default:
+				p.addedID = c.AddedID
+			}
+			if !cell.IsReserved(c.ColumnName) {
+				p.limit--
+				return true
+			}
+		}
+		if p.err = p.it.Err(); p.err != nil || p.read < p.page {
+			return false
+		}
+		p.it.Close()
+		p.page, p.read = p.limit, 0
+		p.it, p.err = storage.StreamPartition(p.ctx, p.store, p.partitionNumber, p.readType, p.addedID, p.createdAfter, p.page)
+		if p.err != nil {
+			p.it = storage.SliceIterator(nil)
+			return false
+		}
+	}
+	return false
+}
+
+func (p *partitionPages) Cell() *cell.Cell { return p.it.Cell() }
+func (p *partitionPages) Err() error       { return p.err }
+func (p *partitionPages) Close()           { p.it.Close() }
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// Timeouts are per-request budgets by kind of endpoint; zero leaves a kind
+// without a request deadline, bounded only by each store's query timeout.
+type Timeouts struct {
+	// Read bounds point reads: a cell, a latest cell, a row, a multiget or
+	// a batch of rows.
+	Read time.Duration
+	// Write bounds cell and batch writes, including indexing.
+	Write time.Duration
+	// Scan bounds partition and window reads, index queries and counts, and
+	// cell queries.
+	Scan time.Duration
+}
+
+// RequestTimeouts sets a deadline on each request's context according to its
+// kind, marked as a budget (see storage.WithQueryBudget) that replaces
+// stores' default per-query timeout, so a scan may run longer than
+// DB_QUERY_TIMEOUT while point reads fail fast.
+func RequestTimeouts(t Timeouts) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if d := t.forRequest(r); d > 0 {
+				ctx, cancel := context.WithTimeout(storage.WithQueryBudget(r.Context()), d)
+				defer cancel()
+				r = r.WithContext(ctx)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (t Timeouts) forRequest(r *http.Request) time.Duration {
+	p := r.URL.Path
+	if p == "/v1/cells/partitionRead" || p == "/v1/cells/windowRead" || p == "/v1/query" || strings.HasPrefix(p, "/v1/index/") {
+		return t.Scan
+	}
+	class, ok := ClassifyRoute(r)
+	if !ok {
+		return 0
+	}
+	switch class {
+	case ClassRead:
+		return t.Read
+	case ClassWrite:
+		return t.Write
+	}
+	return 0
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+)
+
+func TestRequestTimeouts_ByKind(t *testing.T) {
+	timeouts := Timeouts{Read: time.Second, Write: 2 * time.Second, Scan: 30 * time.Second}
+	tests := []struct {
+		method, path string
+		want         time.Duration
+	}{
+		{http.MethodGet, "/v1/cells/" + uuid.NewString() + "/profile", time.Second},
+		{http.MethodPost, "/v1/cells/multiget", time.Second},
+		{http.MethodPost, "/v1/rows:batchGet", time.Second},
+		{http.MethodPost, "/v1/cells", 2 * time.Second},
+		{http.MethodGet, "/v1/cells/partitionRead", 30 * time.Second},
+		{http.MethodGet, "/v1/index/user_by_email/a@b.c", 30 * time.Second},
+		{http.MethodGet, "/v1/index/user_by_email:count", 30 * time.Second},
+		{http.MethodPost, "/v1/query", 30 * time.Second},
+		{http.MethodGet, "/v1/cells/windowRead", 30 * time.Second},
+		{http.MethodGet, "/v1/readyz", 0},
+		{http.MethodPost, "/v1/plugins", 0},
+	}
+	for _, tt := range tests {
+		var got time.Duration
+		h := RequestTimeouts(timeouts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if dl, ok := r.Context().Deadline(); ok {
+				got = time.Until(dl).Round(time.Second)
+			}
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+		if got != tt.want {
+			t.Errorf("%s %s: deadline in %v, want %v", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+// slowStore blocks reads until the request context ends.
+type slowStore struct {
+	*memory.Store
+}
+
+func (s slowStore) GetCellLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestRequestTimeouts_GatewayTimeout(t *testing.T) {
+	server := RequestTimeouts(Timeouts{Read: 10 * time.Millisecond})(setupTestServer(slowStore{memory.New()}, 64))
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/cells/"+uuid.NewString()+"/profile", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("status: got %d, want %d\nbody: %s", w.Code, http.StatusGatewayTimeout, w.Body.String())
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var writePhaseDuration = promauto.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: "mezzanine",
+		Name:      "write_phase_duration_seconds",
+		Help:      "Time spent by cell and batch writes in each phase: store, index and notify.",
+		Buckets:   prometheus.DefBuckets,
+	},
+	[]string{"phase"},
+)
+
+// writeTiming breaks a write request's latency down into its phases: the
+// shard insert, the secondary index writes and enqueueing the plugin
+// notifications. Batches add up each phase over their cells.
+type writeTiming struct {
+	store  time.Duration
+	index  time.Duration
+	notify time.Duration
+}
+
+// since adds the time elapsed from start to *phase and returns now, the
+// start of the next phase.
+func since(phase *time.Duration, start time.Time) time.Time {
+	now := time.Now()
+	*phase += now.Sub(start)
+	return now
+}
+
+// observe records the phases in mezzanine_write_phase_duration_seconds.
+func (t writeTiming) observe() {
+	writePhaseDuration.WithLabelValues("store").Observe(t.store.Seconds())
+	writePhaseDuration.WithLabelValues("index").Observe(t.index.Seconds())
+	writePhaseDuration.WithLabelValues("notify").Observe(t.notify.Seconds())
+}
+
+// attrs returns the phases as log attributes in milliseconds.
+func (t writeTiming) attrs() []any {
+	return []any{
+		slog.Float64("store_ms", millis(t.store)),
+		slog.Float64("index_ms", millis(t.index)),
+		slog.Float64("notify_ms", millis(t.notify)),
+	}
+}
+
+// header formats the phases as a Server-Timing header value.
+func (t writeTiming) header() string {
+	var b strings.Builder
+	for i, m := range []struct {
+		name string
+		d    time.Duration
+	}{{"store", t.store}, {"index", t.index}, {"notify", t.notify}} {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%s;dur=%.3f", m.name, millis(m.d))
+	}
+	return b.String()
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
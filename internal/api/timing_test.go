@@ -0,0 +1,60 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+)
+
+func TestWriteTimingHeader(t *testing.T) {
+	timing := writeTiming{store: 11204 * time.Microsecond, index: 27 * time.Millisecond, notify: 12 * time.Microsecond}
+	want := "store;dur=11.204, index;dur=27.000, notify;dur=0.012"
+	if got := timing.header(); got != want {
+		t.Errorf("header: got %q, want %q", got, want)
+	}
+}
+
+func TestWriteCell_ServerTiming(t *testing.T) {
+	serverTimingHeader := regexp.MustCompile(`^store;dur=[0-9.]+, index;dur=[0-9.]+, notify;dur=[0-9.]+$`)
+	for _, tc := range []struct {
+		name    string
+		enabled bool
+		path    string
+		body    string
+	}{
+		{"cell", true, "/v1/cells", `{"row_key":"550e8400-e29b-41d4-a716-446655440000","column_name":"profile","ref_key":1,"body":{}}`},
+		{"batch", true, "/v1/cells/batch", `{"cells":[{"row_key":"550e8400-e29b-41d4-a716-446655440000","column_name":"profile","ref_key":1,"body":{}}]}`},
+		{"disabled", false, "/v1/cells", `{"row_key":"550e8400-e29b-41d4-a716-446655440000","column_name":"profile","ref_key":1,"body":{}}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := shard.NewRouter()
+			for i := range 4 {
+				r.Register(shard.ID(i), memory.New())
+			}
+			server := NewServer(testLogger(), r, index.NewRegistry(), trigger.NewPluginRegistry(), nil, 4, nil, ServerOptions{ServerTiming: tc.enabled})
+
+			req := httptest.NewRequest(http.MethodPost, tc.path, bytes.NewReader([]byte(tc.body)))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+			if w.Code != http.StatusCreated {
+				t.Fatalf("status: got %d, body: %s", w.Code, w.Body.String())
+			}
+			got := w.Header().Get("Server-Timing")
+			if tc.enabled && !serverTimingHeader.MatchString(got) {
+				t.Errorf("Server-Timing: got %q, want store, index and notify durations", got)
+			}
+			if !tc.enabled && got != "" {
+				t.Errorf("Server-Timing: got %q, want none", got)
+			}
+		})
+	}
+}
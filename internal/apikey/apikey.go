@@ -0,0 +1,176 @@
+// Package apikey authenticates API requests with static keys and carries the
+// policy of the calling key in the request context.
+//
+// Keys are configured in a JSON file that stores only the SHA-256 of each
+// key, so the file can be checked in or mounted without exposing secrets:
+//
+//	{
+//	  "keys": [
+//	    {"name": "backend", "sha256": "9f86d0..."},
+//	    {"name": "support", "sha256": "60303a...", "mask": ["ssn"], "hash": ["email"], "write": []},
+//	    {"name": "billing", "sha256": "2bb80d...", "write": ["billing", "invoice_*"]},
+//	    {"name": "acme", "sha256": "3c9909...", "tenant": "acme"},
+//	    {"name": "ops", "sha256": "b5bb9d...", "admin": true}
+//	  ]
+//	}
+package apikey
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Key is one API key and the policy applied to requests made with it.
+type Key struct {
+	// Name identifies the key in logs.
+	Name string `json:"name"`
+	// SHA256 is the hex-encoded SHA-256 of the key.
+	SHA256 string `json:"sha256"`
+	// Mask lists body fields removed from every cell and index entry this
+	// key reads. Nested fields are addressed with dots, e.g. "address.zip".
+	Mask []string `json:"mask,omitempty"`
+	// Hash lists body fields replaced by a keyed hash of their value, so
+	// that readers can still match equal values without seeing them.
+	Hash []string `json:"hash,omitempty"`
+	// Write lists the columns the key may write, as names or patterns where
+	// * matches any run of characters. Omitted, the key may write every
+	// column; an empty list makes it read-only.
+	Write []string `json:"write,omitempty"`
+	// Tenant, when set, owns the rows this key writes first; with row ACLs
+	// enabled, keys of other tenants cannot read or write them.
+	Tenant string `json:"tenant,omitempty"`
+	// Admin lets the key read system columns, whose names start with
+	// "_mezz." and which hold what Mezzanine records about rows, such as
+	// their owner and the key that created them. Other keys never see them.
+	// Only admin keys register column schemas.
+	Admin bool `json:"admin,omitempty"`
+}
+
+// CanWrite reports whether the key may write cells to column.
+func (k *Key) CanWrite(column string) bool {
+	if k.Write == nil {
+		return true
+	}
+	for _, pattern := range k.Write {
+		if matchPattern(pattern, column) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern reports whether s matches pattern, in which * matches any
+// run of characters and everything else matches itself.
+func matchPattern(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
+
+// Config is the contents of an API keys file.
+type Config struct {
+	Keys []Key `json:"keys"`
+}
+
+// Load reads and validates an API keys file.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read api keys: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse api keys: %w", err)
+	}
+	names := make(map[string]bool, len(cfg.Keys))
+	hashes := make(map[string]bool, len(cfg.Keys))
+	for i, k := range cfg.Keys {
+		if k.Name == "" {
+			return nil, fmt.Errorf("key %d: name is required", i)
+		}
+		if names[k.Name] {
+			return nil, fmt.Errorf("key %d: duplicate name %q", i, k.Name)
+		}
+		names[k.Name] = true
+		sum, err := hex.DecodeString(k.SHA256)
+		if err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("key %s: sha256 must be 64 hex characters", k.Name)
+		}
+		h := strings.ToLower(k.SHA256)
+		if hashes[h] {
+			return nil, fmt.Errorf("key %s: sha256 is shared with another key", k.Name)
+		}
+		hashes[h] = true
+		if k.Tenant != "" && strings.TrimSpace(k.Tenant) != k.Tenant {
+			return nil, fmt.Errorf("key %s: tenant must not start or end with spaces", k.Name)
+		}
+		for _, p := range k.Write {
+			if p == "" {
+				return nil, fmt.Errorf("key %s: empty write pattern", k.Name)
+			}
+		}
+		for _, f := range append(append([]string{}, k.Mask...), k.Hash...) {
+			if f == "" || strings.HasPrefix(f, ".") || strings.HasSuffix(f, ".") || strings.Contains(f, "..") {
+				return nil, fmt.Errorf("key %s: invalid field %q", k.Name, f)
+			}
+		}
+	}
+	return &cfg, nil
+}
+
+// Set looks up keys by their plaintext value.
+type Set struct {
+	byHash map[string]*Key
+}
+
+// NewSet indexes the keys of cfg.
+func NewSet(cfg *Config) *Set {
+	s := &Set{byHash: make(map[string]*Key, len(cfg.Keys))}
+	for i := range cfg.Keys {
+		s.byHash[strings.ToLower(cfg.Keys[i].SHA256)] = &cfg.Keys[i]
+	}
+	return s
+}
+
+// Len returns the number of keys in the set.
+func (s *Set) Len() int {
+	return len(s.byHash)
+}
+
+// Lookup returns the key whose SHA-256 matches token.
+func (s *Set) Lookup(token string) (*Key, bool) {
+	sum := sha256.Sum256([]byte(token))
+	k, ok := s.byHash[hex.EncodeToString(sum[:])]
+	return k, ok
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying k.
+func NewContext(ctx context.Context, k *Key) context.Context {
+	return context.WithValue(ctx, contextKey{}, k)
+}
+
+// FromContext returns the key a request was authenticated with, if any.
+func FromContext(ctx context.Context) (*Key, bool) {
+	k, ok := ctx.Value(contextKey{}).(*Key)
+	return k, ok
+}
@@ -0,0 +1,117 @@
+package apikey
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func sum(token string) string {
+	s := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(s[:])
+}
+
+func writeKeys(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	os.WriteFile(path, []byte(body), 0o644) //nolint:errcheck
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeKeys(t, `{"keys":[{"name":"support","sha256":"`+sum("s3cret")+`","mask":["ssn"],"hash":["contact.email"]}]}`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(cfg.Keys) != 1 || cfg.Keys[0].Name != "support" || cfg.Keys[0].Mask[0] != "ssn" || cfg.Keys[0].Hash[0] != "contact.email" {
+		t.Errorf("got %+v", cfg.Keys)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	for name, body := range map[string]string{
+		"missing name":   `{"keys":[{"sha256":"` + sum("a") + `"}]}`,
+		"duplicate name": `{"keys":[{"name":"a","sha256":"` + sum("a") + `"},{"name":"a","sha256":"` + sum("b") + `"}]}`,
+		"short sha256":   `{"keys":[{"name":"a","sha256":"abcd"}]}`,
+		"not hex":        `{"keys":[{"name":"a","sha256":"zz` + sum("a")[2:] + `"}]}`,
+		"shared sha256":  `{"keys":[{"name":"a","sha256":"` + sum("a") + `"},{"name":"b","sha256":"` + sum("a") + `"}]}`,
+		"empty field":    `{"keys":[{"name":"a","sha256":"` + sum("a") + `","mask":[""]}]}`,
+		"bad path":       `{"keys":[{"name":"a","sha256":"` + sum("a") + `","hash":["a..b"]}]}`,
+		"empty pattern":  `{"keys":[{"name":"a","sha256":"` + sum("a") + `","write":[""]}]}`,
+		"padded tenant":  `{"keys":[{"name":"a","sha256":"` + sum("a") + `","tenant":" acme"}]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Load(writeKeys(t, body)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestSet_Lookup(t *testing.T) {
+	set := NewSet(&Config{Keys: []Key{
+		{Name: "backend", SHA256: sum("backend-token")},
+		{Name: "support", SHA256: sum("support-token")},
+	}})
+
+	k, ok := set.Lookup("support-token")
+	if !ok || k.Name != "support" {
+		t.Errorf("Lookup(support-token) = %+v, %v", k, ok)
+	}
+	if _, ok := set.Lookup("nope"); ok {
+		t.Error("expected unknown token to fail")
+	}
+	if set.Len() != 2 {
+		t.Errorf("Len = %d, want 2", set.Len())
+	}
+}
+
+func TestLoad_ReadOnlyKey(t *testing.T) {
+	cfg, err := Load(writeKeys(t, `{"keys":[{"name":"a","sha256":"`+sum("a")+`","write":[]},{"name":"b","sha256":"`+sum("b")+`"}]}`))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Keys[0].CanWrite("profile") {
+		t.Error("empty write list should make the key read-only")
+	}
+	if !cfg.Keys[1].CanWrite("profile") {
+		t.Error("omitted write list should allow every column")
+	}
+}
+
+func TestKey_CanWrite(t *testing.T) {
+	k := &Key{Write: []string{"billing", "invoice_*", "*_audit", "a*b*c"}}
+	for column, want := range map[string]bool{
+		"billing":      true,
+		"billing2":     false,
+		"invoice_":     true,
+		"invoice_2026": true,
+		"invoices":     false,
+		"orders_audit": true,
+		"audit":        false,
+		"abc":          true,
+		"aXXbYYc":      true,
+		"acb":          false,
+		"profile":      false,
+	} {
+		if got := k.CanWrite(column); got != want {
+			t.Errorf("CanWrite(%q) = %v, want %v", column, got, want)
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	if _, ok := FromContext(context.Background()); ok {
+		t.Error("expected no key in empty context")
+	}
+	k := &Key{Name: "support"}
+	got, ok := FromContext(NewContext(context.Background(), k))
+	if !ok || got != k {
+		t.Errorf("FromContext = %+v, %v", got, ok)
+	}
+}
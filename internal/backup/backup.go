@@ -0,0 +1,249 @@
+// Package backup coordinates consistent backups of a sharded Mezzanine
+// cluster. Each backend is dumped with pg_dump; before dumping, the highest
+// added_id of every shard is recorded in a manifest. Restoring trims every
+// shard back to that marker, so all backends are restored to the same cut
+// point even though their dumps were taken at slightly different times.
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+	mezzanine "github.com/ryanbastic/go-mezzanine/pkg/mezzanine"
+)
+
+// ManifestFile is the name of the manifest within a backup directory.
+const ManifestFile = "manifest.json"
+
+// manifestVersion is bumped whenever the manifest format changes.
+const manifestVersion = 1
+
+// Manifest describes a backup: which backends were dumped to which files and
+// the consistency marker (max added_id) of every shard.
+type Manifest struct {
+	Version   int           `json:"version"`
+	CreatedAt time.Time     `json:"created_at"`
+	NumShards int           `json:"num_shards"`
+	Backends  []BackendDump `json:"backends"`
+	// Metadata is the metadata database's archive, when the cluster has one;
+	// it then holds the plugins table instead of the first backend.
+	Metadata *MetadataDump `json:"metadata,omitempty"`
+	// ShardHash is the hash that placed the backup's keys on its shards;
+	// it is unset in backups of clusters with the default hash.
+	ShardHash mezzanine.ShardHash `json:"shard_hash,omitzero"`
+	// Markers maps shard ID to the highest added_id included in the backup.
+	Markers map[int]int64 `json:"markers"`
+}
+
+// BackendDump is one backend's pg_dump archive.
+type BackendDump struct {
+	Name       string `json:"name"`
+	ShardStart int    `json:"shard_start"`
+	ShardEnd   int    `json:"shard_end"`
+	File       string `json:"file"`
+	// Plugins is true when the archive also holds the shared plugins table.
+	Plugins bool `json:"plugins,omitempty"`
+}
+
+// MetadataDump is the metadata database's pg_dump archive.
+type MetadataDump struct {
+	File string `json:"file"`
+}
+
+// NewManifest returns an empty manifest stamped with the current time.
+func NewManifest(numShards int) *Manifest {
+	return &Manifest{
+		Version:   manifestVersion,
+		CreatedAt: time.Now().UTC(),
+		NumShards: numShards,
+		Markers:   make(map[int]int64, numShards),
+	}
+}
+
+// WriteManifest writes m to dir/manifest.json. The file is written under
+// a temporary name and renamed into place, so a backup interrupted while
+// writing it, or another run into the same directory, never leaves a
+// manifest that is only partly written.
+func WriteManifest(dir string, m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode manifest: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ManifestFile+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, ManifestFile)); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	return nil
+}
+
+// ReadManifest reads dir/manifest.json and checks it covers every shard.
+func ReadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+	for i := range m.NumShards {
+		if _, ok := m.Markers[i]; !ok {
+			return nil, fmt.Errorf("manifest has no marker for shard %d", i)
+		}
+	}
+	return &m, nil
+}
+
+// Markers returns the highest added_id of every shard in [start, end]. Empty
+// shards have a marker of 0.
+func Markers(ctx context.Context, pool *pgxpool.Pool, start, end int) (map[int]int64, error) {
+	markers := make(map[int]int64, end-start+1)
+	for i := start; i <= end; i++ {
+		var addedID int64
+		q := fmt.Sprintf("SELECT COALESCE(MAX(added_id), 0) FROM %s", storage.ShardTable(i))
+		if err := pool.QueryRow(ctx, q).Scan(&addedID); err != nil {
+			return nil, fmt.Errorf("read marker for shard %d: %w", i, err)
+		}
+		markers[i] = addedID
+	}
+	return markers, nil
+}
+
+// TrimAfter deletes cells of shard that were written after marker and
+// returns how many were removed.
+func TrimAfter(ctx context.Context, pool *pgxpool.Pool, shard int, marker int64) (int64, error) {
+	q := fmt.Sprintf("DELETE FROM %s WHERE added_id > $1", storage.ShardTable(shard))
+	tag, err := pool.Exec(ctx, q, marker)
+	if err != nil {
+		return 0, fmt.Errorf("trim shard %d: %w", shard, err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Tables returns the tables dumped for a backend: its cell, alias and tag
+// tables and, when plugins is set, the shared plugins table. Index tables are not
+// dumped; they are rebuilt from cells after a restore.
+func Tables(shardStart, shardEnd int, plugins bool) []string {
+	tables := make([]string, 0, 3*(shardEnd-shardStart+1)+1)
+	for i := shardStart; i <= shardEnd; i++ {
+		tables = append(tables, storage.ShardTable(i), storage.AliasTable(i), storage.TagTable(i))
+	}
+	if plugins {
+		tables = append(tables, "plugins")
+	}
+	return tables
+}
+
+// DumpArgs returns the pg_dump arguments writing tables to file in custom
+// archive format.
+func DumpArgs(file string, tables []string) []string {
+	args := []string{"--format=custom", "--no-owner", "--file=" + file}
+	for _, t := range tables {
+		args = append(args, "--table="+t)
+	}
+	return args
+}
+
+// RestoreArgs returns the pg_restore arguments replacing the archived tables
+// in the target database.
+func RestoreArgs(file string) []string {
+	return []string{"--clean", "--if-exists", "--no-owner", file}
+}
+
+// Run executes a pg_dump/pg_restore style binary with args against the
+// database at dbURL, returning its combined output in the error on
+// failure.
+func Run(ctx context.Context, bin, dbURL string, args []string) error {
+	cmd, err := command(ctx, bin, dbURL, args)
+	if err != nil {
+		return err
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %w: %s", filepath.Base(bin), err, out)
+	}
+	return nil
+}
+
+// command builds the command Run executes. dbURL's password, if any, is
+// passed in PGPASSWORD rather than in --dbname: the command line of a
+// process can be read by any user on the host.
+func command(ctx context.Context, bin, dbURL string, args []string) (*exec.Cmd, error) {
+	conn, password, err := splitPassword(dbURL)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, bin, append([]string{"--dbname=" + conn}, args...)...)
+	cmd.Env = os.Environ()
+	if password != "" {
+		cmd.Env = append(cmd.Env, "PGPASSWORD="+password)
+	}
+	return cmd, nil
+}
+
+// passwordParam matches the password of a keyword/value connection string,
+// quoted or not.
+var passwordParam = regexp.MustCompile(`(^|\s)password\s*=\s*('(?:[^'\\]|\\.)*'|\S*)\s*`)
+
+// splitPassword returns dbURL without its password, and the password. Both
+// URLs and keyword/value connection strings are understood.
+func splitPassword(dbURL string) (string, string, error) {
+	if !strings.HasPrefix(dbURL, "postgres://") && !strings.HasPrefix(dbURL, "postgresql://") {
+		cfg, err := pgconn.ParseConfig(dbURL)
+		if err != nil {
+			return "", "", fmt.Errorf("parse database URL: %w", err)
+		}
+		return strings.TrimSpace(passwordParam.ReplaceAllString(dbURL, "$1")), cfg.Password, nil
+	}
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		return "", "", fmt.Errorf("parse database URL: %w", err)
+	}
+	var password string
+	if u.User != nil {
+		password, _ = u.User.Password()
+		if name := u.User.Username(); name != "" {
+			u.User = url.User(name)
+		} else {
+			u.User = nil
+		}
+	}
+	if q := u.Query(); q.Has("password") {
+		password = q.Get("password")
+		q.Del("password")
+		u.RawQuery = q.Encode()
+	}
+	return u.String(), password, nil
+}
@@ -0,0 +1,141 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	mezzanine "github.com/ryanbastic/go-mezzanine/pkg/mezzanine"
+)
+
+func TestManifest_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManifest(2)
+	m.Backends = []BackendDump{{Name: "primary", ShardStart: 0, ShardEnd: 1, File: "primary.dump", Plugins: true}}
+	m.ShardHash = mezzanine.ShardHash{Function: mezzanine.HashXXHash, Seed: 7}
+	m.Markers[0] = 42
+	m.Markers[1] = 0
+
+	if err := WriteManifest(dir, m); err != nil {
+		t.Fatalf("WriteManifest: %v", err)
+	}
+	got, err := ReadManifest(dir)
+	if err != nil {
+		t.Fatalf("ReadManifest: %v", err)
+	}
+	if got.NumShards != 2 || got.ShardHash != m.ShardHash || got.Markers[0] != 42 || got.Markers[1] != 0 {
+		t.Errorf("got %+v", got)
+	}
+	if len(got.Backends) != 1 || got.Backends[0] != m.Backends[0] {
+		t.Errorf("Backends: got %+v, want %+v", got.Backends, m.Backends)
+	}
+}
+
+func TestReadManifest_MissingMarker(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManifest(2)
+	m.Markers[0] = 1
+	if err := WriteManifest(dir, m); err != nil {
+		t.Fatalf("WriteManifest: %v", err)
+	}
+
+	_, err := ReadManifest(dir)
+	if err == nil || !strings.Contains(err.Error(), "shard 1") {
+		t.Errorf("expected missing marker error for shard 1, got %v", err)
+	}
+}
+
+func TestReadManifest_UnsupportedVersion(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ManifestFile), []byte(`{"version": 99}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadManifest(dir); err == nil {
+		t.Error("expected error for unsupported version")
+	}
+}
+
+func TestTables(t *testing.T) {
+	got := Tables(2, 3, true)
+	want := []string{"cells_0002", "cells_0002_aliases", "cells_0002_tags", "cells_0003", "cells_0003_aliases", "cells_0003_tags", "plugins"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := Tables(0, 0, false); !slices.Equal(got, []string{"cells_0000", "cells_0000_aliases", "cells_0000_tags"}) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestDumpArgs(t *testing.T) {
+	args := DumpArgs("/tmp/a.dump", []string{"cells_0000", "plugins"})
+	for _, want := range []string{"--format=custom", "--file=/tmp/a.dump", "--table=cells_0000", "--table=plugins"} {
+		if !slices.Contains(args, want) {
+			t.Errorf("args %v missing %q", args, want)
+		}
+	}
+}
+
+func TestRestoreArgs(t *testing.T) {
+	args := RestoreArgs("/tmp/a.dump")
+	if args[len(args)-1] != "/tmp/a.dump" {
+		t.Errorf("archive must be the last argument, got %v", args)
+	}
+	if !slices.Contains(args, "--clean") {
+		t.Errorf("got %v", args)
+	}
+}
+
+func TestCommand_PasswordNotInArgs(t *testing.T) {
+	for _, tc := range []struct {
+		dbURL, conn string
+	}{
+		{"postgres://app:s3cret@db:5432/mezzanine?sslmode=disable", "postgres://app@db:5432/mezzanine?sslmode=disable"},
+		{"postgres://app@db/mezzanine?password=s3cret", "postgres://app@db/mezzanine"},
+		{"host=db user=app password='s3cret' dbname=mezzanine", "host=db user=app dbname=mezzanine"},
+	} {
+		cmd, err := command(context.Background(), "pg_dump", tc.dbURL, []string{"--format=custom"})
+		if err != nil {
+			t.Fatalf("command(%q): %v", tc.dbURL, err)
+		}
+		if want := []string{"pg_dump", "--dbname=" + tc.conn, "--format=custom"}; !slices.Equal(cmd.Args, want) {
+			t.Errorf("command(%q) args: got %v, want %v", tc.dbURL, cmd.Args, want)
+		}
+		if !slices.Contains(cmd.Env, "PGPASSWORD=s3cret") {
+			t.Errorf("command(%q): PGPASSWORD not set", tc.dbURL)
+		}
+	}
+
+	cmd, err := command(context.Background(), "pg_dump", "postgres://app@db/mezzanine", nil)
+	if err != nil {
+		t.Fatalf("command: %v", err)
+	}
+	if len(cmd.Env) != len(os.Environ()) {
+		t.Errorf("PGPASSWORD set for a URL without a password: %v", cmd.Env)
+	}
+}
+
+func TestWriteManifest_ReplacesAtomically(t *testing.T) {
+	dir := t.TempDir()
+	for _, n := range []int{1, 2} {
+		m := NewManifest(n)
+		for i := range n {
+			m.Markers[i] = 1
+		}
+		if err := WriteManifest(dir, m); err != nil {
+			t.Fatalf("WriteManifest: %v", err)
+		}
+	}
+	if got, err := ReadManifest(dir); err != nil || got.NumShards != 2 {
+		t.Fatalf("ReadManifest: got %+v, %v; want the second manifest", got, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("backup directory holds %d files, want only the manifest", len(entries))
+	}
+}
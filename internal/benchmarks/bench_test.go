@@ -0,0 +1,189 @@
+package benchmarks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/api"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+	mezzanine "github.com/ryanbastic/go-mezzanine/pkg/mezzanine"
+)
+
+const numShards = 64
+
+var profileBody = json.RawMessage(`{"name":"Alice","email":"alice@example.com","city":"San Francisco","plan":"pro","tags":["a","b","c"]}`)
+
+var sink any
+
+func BenchmarkShardForRowKey(b *testing.B) {
+	key := uuid.New()
+	for i := 0; i < b.N; i++ {
+		sink = shard.ForRowKey(mezzanine.ShardHash{}, key, 4096)
+	}
+}
+
+func BenchmarkShardForKey(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		sink = shard.ForKey(mezzanine.ShardHash{}, "alice@example.com", 4096)
+	}
+}
+
+func BenchmarkIndexCell(b *testing.B) {
+	registry := index.NewRegistry()
+	registry.Register(nil, index.Definition{
+		Name:          "user_by_email",
+		SourceColumn:  "profile",
+		ShardKeyField: "email",
+		Fields:        []string{"name", "city"},
+	}, numShards)
+	for i := range numShards {
+		registry.RegisterStore("user_by_email", shard.ID(i), discardIndexStore{})
+	}
+	c := &cell.Cell{AddedID: 1, RowKey: uuid.New(), ColumnName: "profile", RefKey: 1, Body: profileBody}
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := registry.IndexCell(ctx, c, numShards); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkPluginRegistryForCell routes a cell write to its plugins among
+// thousands registered, most subscribed to other columns.
+func BenchmarkPluginRegistryForCell(b *testing.B) {
+	for _, n := range []int{10, 1000, 5000} {
+		b.Run(fmt.Sprintf("plugins=%d", n), func(b *testing.B) {
+			registry := trigger.NewPluginRegistry()
+			for i := range n {
+				p := &trigger.Plugin{
+					Name:              fmt.Sprintf("plugin-%d", i),
+					Endpoint:          "http://plugin:9000/rpc",
+					SubscribedColumns: []string{fmt.Sprintf("col%d", i%500)},
+				}
+				if i%10 == 0 {
+					p.SubscribedStreams = []string{fmt.Sprintf("stream%d", i%50)}
+				}
+				if err := registry.Register(context.Background(), p); err != nil {
+					b.Fatal(err)
+				}
+			}
+			streams := []string{"stream0"}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				sink = registry.ForCell("col0", streams)
+			}
+		})
+	}
+}
+
+// newServer returns the API over in-memory stores, without plugins or
+// request logging.
+func newServer(store *memory.Store) http.Handler {
+	router := shard.NewRouter()
+	for i := range numShards {
+		router.Register(shard.ID(i), store)
+	}
+	logger := slog.New(slog.DiscardHandler)
+	return api.NewServer(logger, router, index.NewRegistry(), trigger.NewPluginRegistry(), nil, numShards, nil, api.ServerOptions{})
+}
+
+func serve(b *testing.B, h http.Handler, req *http.Request, want int) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != want {
+		b.Fatalf("%s %s: status %d, want %d: %s", req.Method, req.URL.Path, w.Code, want, w.Body.String())
+	}
+}
+
+func writeRequest(rowKey uuid.UUID, refKey int) *http.Request {
+	data, _ := json.Marshal(map[string]any{"row_key": rowKey, "column_name": "profile", "ref_key": refKey, "body": profileBody})
+	req := httptest.NewRequest(http.MethodPost, "/v1/cells", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func BenchmarkHTTPWriteCell(b *testing.B) {
+	h := newServer(memory.New())
+	rowKey := uuid.New()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		serve(b, h, writeRequest(rowKey, i+1), http.StatusCreated)
+	}
+}
+
+func BenchmarkHTTPGetCell(b *testing.B) {
+	h := newServer(memory.New())
+	rowKey := uuid.New()
+	serve(b, h, writeRequest(rowKey, 1), http.StatusCreated)
+	path := fmt.Sprintf("/v1/cells/%s/profile/1", rowKey)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		serve(b, h, httptest.NewRequest(http.MethodGet, path, nil), http.StatusOK)
+	}
+}
+
+func BenchmarkHTTPGetRow(b *testing.B) {
+	store := memory.New()
+	h := newServer(store)
+	rowKey := uuid.New()
+	for i := 0; i < 20; i++ {
+		_, err := store.WriteCell(context.Background(), cell.WriteCellRequest{RowKey: rowKey, ColumnName: fmt.Sprintf("col%02d", i), RefKey: 1, Body: profileBody})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	path := "/v1/cells/" + rowKey.String()
+
+	for _, accept := range []string{"application/json", "application/msgpack"} {
+		b.Run(accept, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				req.Header.Set("Accept", accept)
+				serve(b, h, req, http.StatusOK)
+			}
+		})
+	}
+}
+
+func BenchmarkHTTPWriteBatch(b *testing.B) {
+	h := newServer(memory.New())
+	// Rows that hash to one shard, as the batch endpoint requires.
+	rows := make([]uuid.UUID, 0, 100)
+	target := shard.ForRowKey(mezzanine.ShardHash{}, uuid.New(), numShards)
+	for len(rows) < cap(rows) {
+		if k := uuid.New(); shard.ForRowKey(mezzanine.ShardHash{}, k, numShards) == target {
+			rows = append(rows, k)
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cells := make([]map[string]any, len(rows))
+		for j, k := range rows {
+			cells[j] = map[string]any{"row_key": k, "column_name": "profile", "ref_key": i + 1, "body": profileBody}
+		}
+		data, _ := json.Marshal(map[string]any{"cells": cells})
+		req := httptest.NewRequest(http.MethodPost, "/v1/cells/batch", bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		serve(b, h, req, http.StatusCreated)
+	}
+}
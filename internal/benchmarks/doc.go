@@ -0,0 +1,9 @@
+// Package benchmarks holds the performance regression suite: micro
+// benchmarks of hot helpers and end-to-end HTTP flows against in-memory
+// stores, so changes can be compared with a recorded baseline:
+//
+//	make bench-baseline   # on the base commit
+//	make bench-compare    # on the change
+//
+// Database-bound benchmarks live with PostgresStore in internal/storage.
+package benchmarks
@@ -0,0 +1,22 @@
+package benchmarks
+
+import (
+	"context"
+
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+)
+
+// discardIndexStore accepts index entries without storing them.
+type discardIndexStore struct{}
+
+func (discardIndexStore) QueryByShardKey(context.Context, string, index.Page, ...index.Filter) ([]index.Entry, error) {
+	return nil, nil
+}
+
+func (discardIndexStore) CountByShardKey(context.Context, string, ...index.Filter) (int64, error) {
+	return 0, nil
+}
+
+func (discardIndexStore) Count(context.Context, ...index.Filter) (int64, error) { return 0, nil }
+
+func (discardIndexStore) WriteEntry(context.Context, index.Entry) error { return nil }
@@ -0,0 +1,586 @@
+// Package cache is an optional in-process read cache for GetCellLatest and
+// GetRow. Cells are immutable, but "latest" changes with every write to a
+// column, so entries are invalidated by writes through this process, by
+// invalidations broadcast from other instances (see PGNotifier), and expire
+// after a TTL as a bound on staleness when a broadcast is lost. Reads marked
+// with storage.WithFreshRead bypass it.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+var (
+	lookupsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "mezzanine",
+			Name:      "cache_lookups_total",
+			Help:      "Read cache lookups by operation and result (hit or miss).",
+		},
+		[]string{"op", "result"},
+	)
+
+	evictionsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "mezzanine",
+			Name:      "cache_evictions_total",
+			Help:      "Read cache entries evicted to stay within the size limit.",
+		},
+	)
+
+	cachedBytes = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "mezzanine",
+			Name:      "cache_bytes",
+			Help:      "Approximate size of the read cache.",
+		},
+	)
+)
+
+const (
+	// numSegments splits the cache so concurrent readers of different rows
+	// rarely contend on a lock.
+	numSegments = 16
+	// cellOverhead approximates the memory a cached cell uses beyond its body.
+	cellOverhead = 128
+)
+
+// Options configures a Cache.
+type Options struct {
+	// MaxBytes bounds the approximate size of cached cells. Required.
+	MaxBytes int64
+	// TTL bounds how long an entry is served (default 1s).
+	TTL time.Duration
+	// Broadcaster, if set, is told about every successful local write so
+	// other instances can invalidate their caches.
+	Broadcaster Broadcaster
+	// PrimeWrites caches the cells written through this process instead of
+	// dropping their entries, so reads right after a write are hits. When a
+	// written column's latest cell is not cached, it is read back from the
+	// store as part of the write.
+	PrimeWrites bool
+}
+
+// Invalidation names a column whose latest cell changed.
+type Invalidation struct {
+	RowKey     uuid.UUID
+	ColumnName string
+}
+
+// Broadcaster publishes invalidations to other instances. Failures should be
+// logged rather than returned: the write has already succeeded, and the TTL
+// bounds how long other instances serve the old value.
+type Broadcaster interface {
+	Broadcast(ctx context.Context, shardID shard.ID, invs []Invalidation)
+}
+
+// Stats are cumulative cache counters.
+type Stats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Bytes     int64
+	Entries   int
+}
+
+// Cache is a segmented LRU of latest cells and rows, shared by every shard.
+type Cache struct {
+	ttl         time.Duration
+	bc          Broadcaster
+	primeWrites bool
+	now         func() time.Time
+	segments    [numSegments]segment
+}
+
+// New creates a Cache.
+func New(opts Options) *Cache {
+	if opts.TTL <= 0 {
+		opts.TTL = time.Second
+	}
+	c := &Cache{ttl: opts.TTL, bc: opts.Broadcaster, primeWrites: opts.PrimeWrites, now: time.Now}
+	for i := range c.segments {
+		c.segments[i] = segment{
+			maxBytes: opts.MaxBytes / numSegments,
+			items:    make(map[key]*list.Element),
+			lru:      list.New(),
+		}
+	}
+	return c
+}
+
+// Interceptor returns a shard.Router interceptor that serves GetCellLatest
+// and GetRow from the cache and invalidates on writes.
+func (c *Cache) Interceptor() shard.Interceptor {
+	return func(id shard.ID, store storage.CellStore) storage.CellStore {
+		return &cachingStore{CellStore: store, c: c, shardID: id}
+	}
+}
+
+// Purge drops every entry. It is used when invalidations may have been
+// missed, e.g. after the notification connection was re-established.
+func (c *Cache) Purge() {
+	for i := range c.segments {
+		s := &c.segments[i]
+		s.mu.Lock()
+		s.gen++
+		for s.lru.Len() > 0 {
+			s.remove(s.lru.Back())
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Stats returns the cache's counters.
+func (c *Cache) Stats() Stats {
+	var st Stats
+	for i := range c.segments {
+		s := &c.segments[i]
+		s.mu.Lock()
+		st.Hits += s.hits
+		st.Misses += s.misses
+		st.Evictions += s.evictions
+		st.Bytes += s.bytes
+		st.Entries += len(s.items)
+		s.mu.Unlock()
+	}
+	return st
+}
+
+// key identifies an entry: the latest cell of a column, or a whole row when
+// column is empty.
+type key struct {
+	row    uuid.UUID
+	column string
+	isRow  bool
+}
+
+type entry struct {
+	key     key
+	cells   []cell.Cell
+	size    int64
+	expires time.Time
+}
+
+type segment struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	items    map[key]*list.Element
+	lru      *list.List
+	// gen is bumped by every invalidation; a fill started under an older
+	// generation may hold data from before a write and is dropped.
+	gen uint64
+
+	hits, misses, evictions int64
+}
+
+func (c *Cache) segment(row uuid.UUID) *segment {
+	return &c.segments[int(row[15])%numSegments]
+}
+
+// get returns the cached cells for k, or the segment generation to pass to
+// put after reading from the store.
+func (c *Cache) get(k key, op string) ([]cell.Cell, uint64, bool) {
+	s := c.segment(k.row)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[k]; ok {
+		e := el.Value.(*entry)
+		if c.now().Before(e.expires) {
+			s.lru.MoveToFront(el)
+			s.hits++
+			lookupsTotal.WithLabelValues(op, "hit").Inc()
+			return e.cells, 0, true
+		}
+		s.remove(el)
+	}
+	s.misses++
+	lookupsTotal.WithLabelValues(op, "miss").Inc()
+	return nil, s.gen, false
+}
+
+func (c *Cache) put(k key, cells []cell.Cell, gen uint64) {
+	s := c.segment(k.row)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if gen != s.gen {
+		return
+	}
+	s.set(k, cells, c.now().Add(c.ttl))
+}
+
+// prime records cells just written through this process in their columns'
+// and rows' entries. A written cell replaces a cached latest cell only if
+// its ref_key is higher, since an older version may be written after a
+// newer one, and is added to a cached row that lacks its column. It returns
+// the cells whose column had no cached latest cell: whether they are now
+// the latest is unknown until the store is read.
+func (c *Cache) prime(written []cell.Cell) []cell.Cell {
+	var unknown []cell.Cell
+	now := c.now()
+	for _, w := range written {
+		s := c.segment(w.RowKey)
+		s.mu.Lock()
+		// Fills started before the write may hold the previous latest cell.
+		s.gen++
+		if cells, ok := s.live(key{row: w.RowKey, column: w.ColumnName}, now); !ok {
+			unknown = append(unknown, w)
+		} else if cells[0].RefKey < w.RefKey {
+			s.set(key{row: w.RowKey, column: w.ColumnName}, []cell.Cell{w}, now.Add(c.ttl))
+		}
+		if cells, ok := s.live(key{row: w.RowKey, isRow: true}, now); ok {
+			i := slices.IndexFunc(cells, func(cl cell.Cell) bool { return cl.ColumnName >= w.ColumnName })
+			switch {
+			case i < 0:
+				cells = append(slices.Clone(cells), w)
+			case cells[i].ColumnName != w.ColumnName:
+				cells = slices.Insert(slices.Clone(cells), i, w)
+			case cells[i].RefKey < w.RefKey:
+				cells = slices.Clone(cells)
+				cells[i] = w
+			}
+			s.set(key{row: w.RowKey, isRow: true}, cells, now.Add(c.ttl))
+		}
+		s.mu.Unlock()
+	}
+	return unknown
+}
+
+// invalidate drops the latest entry for (row, column) and the row entry.
+func (c *Cache) invalidate(row uuid.UUID, column string) {
+	s := c.segment(row)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gen++
+	for _, k := range []key{{row: row, column: column}, {row: row, isRow: true}} {
+		if el, ok := s.items[k]; ok {
+			s.remove(el)
+		}
+	}
+}
+
+// live returns the cells of an unexpired entry for k, dropping it if it has
+// expired. The caller holds s.mu.
+func (s *segment) live(k key, now time.Time) ([]cell.Cell, bool) {
+	el, ok := s.items[k]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if !now.Before(e.expires) {
+		s.remove(el)
+		return nil, false
+	}
+	return e.cells, true
+}
+
+// set caches cells under k, replacing any entry and evicting the least
+// recently used ones to make room. The caller holds s.mu.
+func (s *segment) set(k key, cells []cell.Cell, expires time.Time) {
+	size := int64(cellOverhead)
+	for _, cl := range cells {
+		size += int64(len(cl.Body)+len(cl.ColumnName)) + cellOverhead
+	}
+	if el, ok := s.items[k]; ok {
+		s.remove(el)
+	}
+	if size > s.maxBytes {
+		return
+	}
+	s.items[k] = s.lru.PushFront(&entry{key: k, cells: cells, size: size, expires: expires})
+	s.bytes += size
+	cachedBytes.Add(float64(size))
+	for s.bytes > s.maxBytes {
+		s.remove(s.lru.Back())
+		s.evictions++
+		evictionsTotal.Inc()
+	}
+}
+
+func (s *segment) remove(el *list.Element) {
+	e := el.Value.(*entry)
+	s.lru.Remove(el)
+	delete(s.items, e.key)
+	s.bytes -= e.size
+	cachedBytes.Sub(float64(e.size))
+}
+
+// cachingStore caches GetCellLatest, GetRow and GetRows; other reads pass
+// through.
+type cachingStore struct {
+	storage.CellStore
+	c       *Cache
+	shardID shard.ID
+}
+
+func (s *cachingStore) WriteCell(ctx context.Context, req cell.WriteCellRequest) (*cell.Cell, error) {
+	// The cache is updated after the write so a concurrent read cannot
+	// cache the previous latest cell, and invalidated even if the write
+	// fails, since it may have been stored part-way.
+	c, err := s.CellStore.WriteCell(ctx, req)
+	if err != nil {
+		s.c.invalidate(req.RowKey, req.ColumnName)
+		return c, err
+	}
+	s.written(ctx, []cell.Cell{*c})
+	return c, nil
+}
+
+func (s *cachingStore) WriteCells(ctx context.Context, reqs []cell.WriteCellRequest) ([]cell.Cell, error) {
+	cells, err := s.CellStore.WriteCells(ctx, reqs)
+	if err != nil {
+		for _, req := range reqs {
+			s.c.invalidate(req.RowKey, req.ColumnName)
+		}
+		return cells, err
+	}
+	s.written(ctx, cells)
+	return cells, nil
+}
+
+func (s *cachingStore) WriteBlob(ctx context.Context, req cell.WriteCellRequest, data []byte) (*cell.Cell, error) {
+	c, err := storage.WriteBlob(ctx, s.CellStore, req, data)
+	if err != nil {
+		s.c.invalidate(req.RowKey, req.ColumnName)
+		return c, err
+	}
+	s.written(ctx, []cell.Cell{*c})
+	return c, nil
+}
+
+func (s *cachingStore) UpdateCell(ctx context.Context, rowKey uuid.UUID, columnName string, apply storage.UpdateFunc) (*cell.Cell, error) {
+	var wrote bool
+	c, err := storage.UpdateCell(ctx, s.CellStore, rowKey, columnName, func(ctx context.Context, latest *cell.Cell) (json.RawMessage, error) {
+		body, err := apply(ctx, latest)
+		wrote = body != nil
+		return body, err
+	})
+	if err != nil {
+		s.c.invalidate(rowKey, columnName)
+		return nil, err
+	}
+	if wrote {
+		s.written(ctx, []cell.Cell{*c})
+	}
+	return c, nil
+}
+
+// GetBlob and GetBlobLatest bypass the cache, which holds bodies but not
+// bytes.
+func (s *cachingStore) GetBlob(ctx context.Context, ref cell.CellRef) (*cell.Cell, []byte, error) {
+	return storage.GetBlob(ctx, s.CellStore, ref)
+}
+
+func (s *cachingStore) GetBlobLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, []byte, error) {
+	return storage.GetBlobLatest(ctx, s.CellStore, rowKey, columnName)
+}
+
+// Aliases are not cached.
+func (s *cachingStore) PutAlias(ctx context.Context, alias string, rowKey uuid.UUID) (*storage.Alias, error) {
+	return storage.PutAlias(ctx, s.CellStore, alias, rowKey)
+}
+
+func (s *cachingStore) GetAlias(ctx context.Context, alias string) (*storage.Alias, error) {
+	return storage.GetAlias(ctx, s.CellStore, alias)
+}
+
+func (s *cachingStore) DeleteAlias(ctx context.Context, alias string) error {
+	return storage.DeleteAlias(ctx, s.CellStore, alias)
+}
+
+// Row tags are not cached.
+func (s *cachingStore) SetRowTags(ctx context.Context, rowKey uuid.UUID, tags []string) error {
+	return storage.SetRowTags(ctx, s.CellStore, rowKey, tags)
+}
+
+func (s *cachingStore) RecordIdempotencyKey(ctx context.Context, key string, hash []byte) error {
+	return storage.RecordIdempotencyKey(ctx, s.CellStore, key, hash)
+}
+
+func (s *cachingStore) IdempotencyKeyHash(ctx context.Context, key string) ([]byte, error) {
+	return storage.IdempotencyKeyHash(ctx, s.CellStore, key)
+}
+
+func (s *cachingStore) RowsByTag(ctx context.Context, tag string, after uuid.UUID, limit int) ([]uuid.UUID, error) {
+	return storage.RowsByTag(ctx, s.CellStore, tag, after, limit)
+}
+
+// Queries are not cached either.
+func (s *cachingStore) QueryCells(ctx context.Context, q storage.Query) ([]cell.Cell, error) {
+	return storage.QueryCells(ctx, s.CellStore, q)
+}
+
+// written updates the cache after cells were stored: their entries are
+// dropped, or primed with PrimeWrites, and other instances are told.
+func (s *cachingStore) written(ctx context.Context, cells []cell.Cell) {
+	if s.c.primeWrites {
+		for _, c := range s.c.prime(cells) {
+			// Fill the entry from the store now rather than on the first
+			// read. A failure leaves it to that read.
+			s.GetCellLatest(ctx, c.RowKey, c.ColumnName) //nolint:errcheck
+		}
+	} else {
+		for _, c := range cells {
+			s.c.invalidate(c.RowKey, c.ColumnName)
+		}
+	}
+	if s.c.bc != nil {
+		invs := make([]Invalidation, len(cells))
+		for i, c := range cells {
+			invs[i] = Invalidation{RowKey: c.RowKey, ColumnName: c.ColumnName}
+		}
+		s.c.bc.Broadcast(ctx, s.shardID, invs)
+	}
+}
+
+func (s *cachingStore) GetCellLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, error) {
+	if storage.FreshRead(ctx) {
+		return s.CellStore.GetCellLatest(ctx, rowKey, columnName)
+	}
+	k := key{row: rowKey, column: columnName}
+	cells, gen, ok := s.c.get(k, "latest")
+	if ok {
+		cl := cells[0]
+		return &cl, nil
+	}
+	got, err := s.CellStore.GetCellLatest(ctx, rowKey, columnName)
+	if err != nil {
+		return nil, err
+	}
+	s.c.put(k, []cell.Cell{*got}, gen)
+	return got, nil
+}
+
+func (s *cachingStore) GetRow(ctx context.Context, rowKey uuid.UUID) ([]cell.Cell, error) {
+	if storage.FreshRead(ctx) {
+		return s.CellStore.GetRow(ctx, rowKey)
+	}
+	k := key{row: rowKey, isRow: true}
+	cells, gen, ok := s.c.get(k, "row")
+	if ok {
+		return append([]cell.Cell(nil), cells...), nil
+	}
+	got, err := s.CellStore.GetRow(ctx, rowKey)
+	if err != nil {
+		return nil, err
+	}
+	s.c.put(k, append([]cell.Cell(nil), got...), gen)
+	return got, nil
+}
+
+// GetRows serves cached rows and fetches the rest from the store in one
+// call, caching them as GetRow would.
+func (s *cachingStore) GetRows(ctx context.Context, rowKeys []uuid.UUID) (map[uuid.UUID][]cell.Cell, error) {
+	if storage.FreshRead(ctx) {
+		return s.CellStore.GetRows(ctx, rowKeys)
+	}
+	out := make(map[uuid.UUID][]cell.Cell, len(rowKeys))
+	seen := make(map[uuid.UUID]bool, len(rowKeys))
+	gens := make(map[uuid.UUID]uint64)
+	var misses []uuid.UUID
+	for _, rowKey := range rowKeys {
+		if seen[rowKey] {
+			continue
+		}
+		seen[rowKey] = true
+		cells, gen, ok := s.c.get(key{row: rowKey, isRow: true}, "row")
+		if ok {
+			if len(cells) > 0 {
+				out[rowKey] = append([]cell.Cell(nil), cells...)
+			}
+			continue
+		}
+		gens[rowKey] = gen
+		misses = append(misses, rowKey)
+	}
+	if len(misses) == 0 {
+		return out, nil
+	}
+	got, err := s.CellStore.GetRows(ctx, misses)
+	if err != nil {
+		return nil, err
+	}
+	for _, rowKey := range misses {
+		cells := got[rowKey]
+		s.c.put(key{row: rowKey, isRow: true}, append([]cell.Cell(nil), cells...), gens[rowKey])
+		if len(cells) > 0 {
+			out[rowKey] = cells
+		}
+	}
+	return out, nil
+}
+
+// StreamRow serves the row through the cache, so rows are buffered as for
+// GetRow rather than streamed. Fresh reads are streamed from the store.
+func (s *cachingStore) StreamRow(ctx context.Context, rowKey uuid.UUID) (storage.CellIterator, error) {
+	if storage.FreshRead(ctx) {
+		return storage.StreamRow(ctx, s.CellStore, rowKey)
+	}
+	cells, err := s.GetRow(ctx, rowKey)
+	if err != nil {
+		return nil, err
+	}
+	return storage.SliceIterator(cells), nil
+}
+
+// StreamRowColumns filters the row when it is cached, and otherwise reads
+// just the columns from the store without caching them, as a partial row.
+func (s *cachingStore) StreamRowColumns(ctx context.Context, rowKey uuid.UUID, columns []string) (storage.CellIterator, error) {
+	if !storage.FreshRead(ctx) {
+		if cells, _, ok := s.c.get(key{row: rowKey, isRow: true}, "row"); ok {
+			return storage.FilterColumns(storage.SliceIterator(append([]cell.Cell(nil), cells...)), columns), nil
+		}
+	}
+	return storage.StreamRowColumns(ctx, s.CellStore, rowKey, columns)
+}
+
+// ProbeCellLatest answers from the cache when it can, and otherwise probes
+// the store without caching the result, which has no body.
+func (s *cachingStore) ProbeCellLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, error) {
+	if storage.FreshRead(ctx) {
+		return storage.ProbeCellLatest(ctx, s.CellStore, rowKey, columnName)
+	}
+	if cells, _, ok := s.c.get(key{row: rowKey, column: columnName}, "latest"); ok {
+		cl := cells[0]
+		return &cl, nil
+	}
+	return storage.ProbeCellLatest(ctx, s.CellStore, rowKey, columnName)
+}
+
+func (s *cachingStore) ProbeRow(ctx context.Context, rowKey uuid.UUID, withSystem bool) (storage.RowSummary, error) {
+	if storage.FreshRead(ctx) {
+		return storage.ProbeRow(ctx, s.CellStore, rowKey, withSystem)
+	}
+	if cells, _, ok := s.c.get(key{row: rowKey, isRow: true}, "row"); ok {
+		return storage.SummarizeRow(cells, withSystem), nil
+	}
+	return storage.ProbeRow(ctx, s.CellStore, rowKey, withSystem)
+}
+
+func (s *cachingStore) StreamPartition(ctx context.Context, partitionNumber int, readType int, addedID int64, createdAfter time.Time, limit int) (storage.CellIterator, error) {
+	return storage.StreamPartition(ctx, s.CellStore, partitionNumber, readType, addedID, createdAfter, limit)
+}
+
+func (s *cachingStore) WaitHead(ctx context.Context, afterAddedID int64) (int64, error) {
+	return storage.WaitHead(ctx, s.CellStore, afterAddedID)
+}
+
+func (s *cachingStore) CommittedHead(ctx context.Context) (int64, error) {
+	return storage.CommittedHead(ctx, s.CellStore)
+}
+
+func (s *cachingStore) ScanCommitLog(ctx context.Context, fromAddedID, afterSeq int64, limit int) ([]cell.Cell, int64, error) {
+	return storage.ScanCommitLog(ctx, s.CellStore, fromAddedID, afterSeq, limit)
+}
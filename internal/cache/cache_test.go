@@ -0,0 +1,400 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// countingStore keeps the latest cell per column, by ref_key, and counts
+// reads.
+type countingStore struct {
+	storage.CellStore
+
+	mu     sync.Mutex
+	latest map[uuid.UUID]map[string]cell.Cell
+	reads  int
+}
+
+func newCountingStore() *countingStore {
+	return &countingStore{latest: make(map[uuid.UUID]map[string]cell.Cell)}
+}
+
+func (s *countingStore) WriteCell(_ context.Context, req cell.WriteCellRequest) (*cell.Cell, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.latest[req.RowKey] == nil {
+		s.latest[req.RowKey] = make(map[string]cell.Cell)
+	}
+	c := cell.Cell{RowKey: req.RowKey, ColumnName: req.ColumnName, RefKey: req.RefKey, Body: req.Body}
+	if prev, ok := s.latest[req.RowKey][req.ColumnName]; !ok || prev.RefKey < c.RefKey {
+		s.latest[req.RowKey][req.ColumnName] = c
+	}
+	return &c, nil
+}
+
+func (s *countingStore) WriteCells(ctx context.Context, reqs []cell.WriteCellRequest) ([]cell.Cell, error) {
+	out := make([]cell.Cell, len(reqs))
+	for i, req := range reqs {
+		c, _ := s.WriteCell(ctx, req)
+		out[i] = *c
+	}
+	return out, nil
+}
+
+func (s *countingStore) GetCellLatest(_ context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reads++
+	c, ok := s.latest[rowKey][columnName]
+	if !ok {
+		return nil, storage.ErrCellNotFound
+	}
+	return &c, nil
+}
+
+func (s *countingStore) GetRow(_ context.Context, rowKey uuid.UUID) ([]cell.Cell, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reads++
+	var out []cell.Cell
+	for _, c := range s.latest[rowKey] {
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+func (s *countingStore) GetRows(ctx context.Context, rowKeys []uuid.UUID) (map[uuid.UUID][]cell.Cell, error) {
+	s.mu.Lock()
+	s.reads++
+	s.mu.Unlock()
+	out := make(map[uuid.UUID][]cell.Cell, len(rowKeys))
+	for _, rowKey := range rowKeys {
+		s.mu.Lock()
+		for _, c := range s.latest[rowKey] {
+			out[rowKey] = append(out[rowKey], c)
+		}
+		s.mu.Unlock()
+	}
+	return out, nil
+}
+
+func write(t *testing.T, store storage.CellStore, row uuid.UUID, column string, ref int64, body string) {
+	t.Helper()
+	_, err := store.WriteCell(context.Background(), cell.WriteCellRequest{RowKey: row, ColumnName: column, RefKey: ref, Body: json.RawMessage(body)})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCache_LatestHitAndInvalidate(t *testing.T) {
+	ctx := context.Background()
+	backing := newCountingStore()
+	c := New(Options{MaxBytes: 1 << 20, TTL: time.Minute})
+	store := c.Interceptor()(0, backing)
+	row := uuid.New()
+	write(t, store, row, "profile", 1, `{"v":1}`)
+
+	for i := 0; i < 3; i++ {
+		got, err := store.GetCellLatest(ctx, row, "profile")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.RefKey != 1 {
+			t.Fatalf("RefKey = %d, want 1", got.RefKey)
+		}
+	}
+	if backing.reads != 1 {
+		t.Errorf("backing reads = %d, want 1", backing.reads)
+	}
+
+	write(t, store, row, "profile", 2, `{"v":2}`)
+	got, err := store.GetCellLatest(ctx, row, "profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.RefKey != 2 {
+		t.Errorf("after write RefKey = %d, want 2", got.RefKey)
+	}
+
+	st := c.Stats()
+	if st.Hits != 2 || st.Misses != 2 {
+		t.Errorf("stats = %+v, want 2 hits and 2 misses", st)
+	}
+}
+
+func TestCache_FreshReadBypasses(t *testing.T) {
+	ctx := context.Background()
+	backing := newCountingStore()
+	c := New(Options{MaxBytes: 1 << 20, TTL: time.Minute})
+	store := c.Interceptor()(0, backing)
+	row := uuid.New()
+	write(t, store, row, "profile", 1, `{"v":1}`)
+	if _, err := store.GetCellLatest(ctx, row, "profile"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetRow(ctx, row); err != nil {
+		t.Fatal(err)
+	}
+
+	fresh := storage.WithFreshRead(ctx)
+	if _, err := store.GetCellLatest(fresh, row, "profile"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetRow(fresh, row); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetRows(fresh, []uuid.UUID{row}); err != nil {
+		t.Fatal(err)
+	}
+	if backing.reads != 5 {
+		t.Errorf("backing reads = %d, want 5", backing.reads)
+	}
+	if st := c.Stats(); st.Hits != 0 {
+		t.Errorf("stats = %+v, want no hits", st)
+	}
+}
+
+func TestCache_RowInvalidatedByColumnWrite(t *testing.T) {
+	ctx := context.Background()
+	backing := newCountingStore()
+	store := New(Options{MaxBytes: 1 << 20, TTL: time.Minute}).Interceptor()(0, backing)
+	row := uuid.New()
+	write(t, store, row, "a", 1, `{}`)
+
+	if _, err := store.GetRow(ctx, row); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetRow(ctx, row); err != nil {
+		t.Fatal(err)
+	}
+	if backing.reads != 1 {
+		t.Fatalf("backing reads = %d, want 1", backing.reads)
+	}
+
+	_, err := store.WriteCells(ctx, []cell.WriteCellRequest{{RowKey: row, ColumnName: "b", RefKey: 1, Body: json.RawMessage(`{}`)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cells, err := store.GetRow(ctx, row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cells) != 2 {
+		t.Errorf("row has %d cells after batch write, want 2", len(cells))
+	}
+}
+
+func TestCache_RowColumnsFilterCachedRow(t *testing.T) {
+	ctx := context.Background()
+	backing := newCountingStore()
+	store := New(Options{MaxBytes: 1 << 20, TTL: time.Minute}).Interceptor()(0, backing)
+	row := uuid.New()
+	write(t, store, row, "a", 1, `{}`)
+	write(t, store, row, "b", 1, `{}`)
+
+	columns := func() []string {
+		t.Helper()
+		it, err := storage.StreamRowColumns(ctx, store, row, []string{"b"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer it.Close()
+		var got []string
+		for it.Next() {
+			got = append(got, it.Cell().ColumnName)
+		}
+		return got
+	}
+
+	// A partial row read from the store is not cached.
+	for range 2 {
+		if got := columns(); len(got) != 1 || got[0] != "b" {
+			t.Fatalf("columns = %v, want [b]", got)
+		}
+	}
+	if backing.reads != 2 {
+		t.Fatalf("backing reads = %d, want 2", backing.reads)
+	}
+
+	if _, err := store.GetRow(ctx, row); err != nil {
+		t.Fatal(err)
+	}
+	if got := columns(); len(got) != 1 || got[0] != "b" {
+		t.Fatalf("columns from cached row = %v, want [b]", got)
+	}
+	if backing.reads != 3 {
+		t.Errorf("backing reads = %d, want 3", backing.reads)
+	}
+}
+
+func TestCache_GetRowsFetchesOnlyMisses(t *testing.T) {
+	ctx := context.Background()
+	backing := newCountingStore()
+	store := New(Options{MaxBytes: 1 << 20, TTL: time.Minute}).Interceptor()(0, backing)
+	cached, uncached := uuid.New(), uuid.New()
+	write(t, store, cached, "a", 1, `{}`)
+	write(t, store, uncached, "a", 1, `{}`)
+
+	if _, err := store.GetRow(ctx, cached); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := store.GetRows(ctx, []uuid.UUID{cached, uncached, cached})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || len(rows[cached]) != 1 || len(rows[uncached]) != 1 {
+		t.Fatalf("rows = %v, want one cell for each row", rows)
+	}
+	if backing.reads != 2 {
+		t.Fatalf("backing reads = %d, want 2", backing.reads)
+	}
+
+	// Both rows are now cached.
+	if _, err := store.GetRows(ctx, []uuid.UUID{cached, uncached}); err != nil {
+		t.Fatal(err)
+	}
+	if backing.reads != 2 {
+		t.Errorf("backing reads after refetch = %d, want 2", backing.reads)
+	}
+}
+
+func TestCache_NotFoundIsNotCached(t *testing.T) {
+	ctx := context.Background()
+	backing := newCountingStore()
+	store := New(Options{MaxBytes: 1 << 20}).Interceptor()(0, backing)
+	row := uuid.New()
+
+	for i := 0; i < 2; i++ {
+		if _, err := store.GetCellLatest(ctx, row, "x"); err != storage.ErrCellNotFound {
+			t.Fatalf("err = %v, want ErrCellNotFound", err)
+		}
+	}
+	if backing.reads != 2 {
+		t.Errorf("backing reads = %d, want 2", backing.reads)
+	}
+}
+
+func TestCache_TTL(t *testing.T) {
+	ctx := context.Background()
+	backing := newCountingStore()
+	c := New(Options{MaxBytes: 1 << 20, TTL: time.Second})
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	store := c.Interceptor()(0, backing)
+	row := uuid.New()
+	write(t, backing, row, "a", 1, `{}`)
+
+	store.GetCellLatest(ctx, row, "a")
+	store.GetCellLatest(ctx, row, "a")
+	now = now.Add(2 * time.Second)
+	store.GetCellLatest(ctx, row, "a")
+	if backing.reads != 2 {
+		t.Errorf("backing reads = %d, want 2 (one fill, one after expiry)", backing.reads)
+	}
+}
+
+func TestCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	backing := newCountingStore()
+	body := `"` + strings.Repeat("x", 1022) + `"`
+	// Each segment holds exactly two entries of body in column "a".
+	c := New(Options{MaxBytes: numSegments * 2 * int64(len(body)+len("a")+2*cellOverhead), TTL: time.Minute})
+	store := c.Interceptor()(0, backing)
+
+	// Rows with the same last byte share a segment.
+	rows := make([]uuid.UUID, 3)
+	for i := range rows {
+		rows[i] = uuid.New()
+		rows[i][15] = 7
+		write(t, backing, rows[i], "a", 1, body)
+	}
+	store.GetCellLatest(ctx, rows[0], "a")
+	store.GetCellLatest(ctx, rows[1], "a")
+	store.GetCellLatest(ctx, rows[0], "a") // rows[1] is now least recent
+	store.GetCellLatest(ctx, rows[2], "a")
+
+	st := c.Stats()
+	if st.Evictions != 1 || st.Entries != 2 {
+		t.Fatalf("stats = %+v, want 1 eviction and 2 entries", st)
+	}
+	reads := backing.reads
+	store.GetCellLatest(ctx, rows[0], "a")
+	if backing.reads != reads {
+		t.Error("recently used entry was evicted")
+	}
+	store.GetCellLatest(ctx, rows[1], "a")
+	if backing.reads != reads+1 {
+		t.Error("least recently used entry was not evicted")
+	}
+}
+
+func TestCache_StaleFillDropped(t *testing.T) {
+	c := New(Options{MaxBytes: 1 << 20, TTL: time.Minute})
+	row := uuid.New()
+	k := key{row: row, column: "a"}
+
+	_, gen, ok := c.get(k, "latest")
+	if ok {
+		t.Fatal("unexpected hit")
+	}
+	// A write lands between the read from the store and the fill.
+	c.invalidate(row, "a")
+	c.put(k, []cell.Cell{{RowKey: row, ColumnName: "a", RefKey: 1}}, gen)
+
+	if _, _, ok := c.get(k, "latest"); ok {
+		t.Error("fill from before the write was cached")
+	}
+}
+
+func TestCache_PrimeWrites(t *testing.T) {
+	ctx := context.Background()
+	backing := newCountingStore()
+	store := New(Options{MaxBytes: 1 << 20, TTL: time.Minute, PrimeWrites: true}).Interceptor()(0, backing)
+	row := uuid.New()
+
+	// The column is not cached, so the write reads its latest cell back.
+	write(t, store, row, "a", 1, `{"v":1}`)
+	if backing.reads != 1 {
+		t.Fatalf("backing reads after first write = %d, want 1", backing.reads)
+	}
+	// Later writes replace the cached cell, unless they are older versions.
+	write(t, store, row, "a", 3, `{"v":3}`)
+	write(t, store, row, "a", 2, `{"v":2}`)
+	got, err := store.GetCellLatest(ctx, row, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.RefKey != 3 {
+		t.Errorf("RefKey = %d, want 3", got.RefKey)
+	}
+	if backing.reads != 1 {
+		t.Errorf("backing reads = %d, want 1", backing.reads)
+	}
+
+	if _, err := store.GetRow(ctx, row); err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.WriteCells(ctx, []cell.WriteCellRequest{{RowKey: row, ColumnName: "b", RefKey: 1, Body: json.RawMessage(`{}`)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reads := backing.reads
+	cells, err := store.GetRow(ctx, row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cells) != 2 || cells[0].ColumnName != "a" || cells[0].RefKey != 3 || cells[1].ColumnName != "b" {
+		t.Errorf("row after batch write = %+v, want a@3 and b@1", cells)
+	}
+	if backing.reads != reads {
+		t.Errorf("row read after the write missed the cache")
+	}
+}
@@ -0,0 +1,172 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+)
+
+// NotifyChannel is the Postgres channel invalidations are published on.
+const NotifyChannel = "mezzanine_cache_invalidate"
+
+// maxPayloadBytes keeps each NOTIFY below Postgres' 8000-byte payload limit.
+const maxPayloadBytes = 7000
+
+var remoteInvalidationsTotal = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "mezzanine",
+		Name:      "cache_remote_invalidations_total",
+		Help:      "Cache invalidations received from other instances.",
+	},
+)
+
+// PGNotifier broadcasts invalidations with Postgres NOTIFY and applies those
+// of other instances with LISTEN, so every instance's cache stays coherent
+// within the notification latency. Each write is published on its shard's
+// backend; every instance listens on all backends.
+type PGNotifier struct {
+	pools      map[string]*pgxpool.Pool
+	backendFor func(shardID int) string
+	node       string
+	logger     *slog.Logger
+}
+
+// notification is the NOTIFY payload. Keys are [row_key, column_name] pairs.
+type notification struct {
+	Node string      `json:"node"`
+	Keys [][2]string `json:"keys"`
+}
+
+// NewPGNotifier creates a notifier for pools, keyed by backend name;
+// backendFor maps a shard to its backend.
+func NewPGNotifier(pools map[string]*pgxpool.Pool, backendFor func(shardID int) string, logger *slog.Logger) *PGNotifier {
+	return &PGNotifier{pools: pools, backendFor: backendFor, node: uuid.NewString(), logger: logger}
+}
+
+// Broadcast implements Broadcaster.
+func (n *PGNotifier) Broadcast(ctx context.Context, shardID shard.ID, invs []Invalidation) {
+	backend := n.backendFor(int(shardID))
+	pool, ok := n.pools[backend]
+	if !ok {
+		return
+	}
+	for _, payload := range encodeNotifications(n.node, invs) {
+		if _, err := pool.Exec(ctx, "SELECT pg_notify($1, $2)", NotifyChannel, payload); err != nil {
+			n.logger.Warn("cache invalidation broadcast failed", "backend", backend, "error", err)
+			return
+		}
+	}
+}
+
+// Listen applies other instances' invalidations to c until ctx is
+// cancelled, and returns once every listener has released its connection.
+// Lost connections are re-established; c is purged each time, since
+// invalidations sent while disconnected are gone.
+func (n *PGNotifier) Listen(ctx context.Context, c *Cache) {
+	var wg sync.WaitGroup
+	for name, pool := range n.pools {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n.listen(ctx, name, pool, c)
+		}()
+	}
+	wg.Wait()
+}
+
+func (n *PGNotifier) listen(ctx context.Context, backend string, pool *pgxpool.Pool, c *Cache) {
+	backoff := 100 * time.Millisecond
+	for ctx.Err() == nil {
+		err := n.listenOnce(ctx, pool, c, func() { backoff = 100 * time.Millisecond })
+		if ctx.Err() != nil {
+			return
+		}
+		n.logger.Warn("cache invalidation listener disconnected", "backend", backend, "error", err, "retry_in", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 10*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+func (n *PGNotifier) listenOnce(ctx context.Context, pool *pgxpool.Pool, c *Cache, connected func()) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// The connection's session state is LISTEN, so it is not returned to
+	// the pool for reuse.
+	pgc := conn.Hijack()
+	defer pgc.Close(ctx)
+
+	if _, err := pgc.Exec(ctx, "LISTEN "+NotifyChannel); err != nil {
+		return err
+	}
+	connected()
+	c.Purge()
+	for {
+		msg, err := pgc.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		n.apply(c, msg.Payload)
+	}
+}
+
+// apply invalidates the keys in payload unless this instance sent it.
+func (n *PGNotifier) apply(c *Cache, payload string) {
+	var msg notification
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+		n.logger.Warn("invalid cache invalidation payload", "error", err)
+		return
+	}
+	if msg.Node == n.node {
+		return
+	}
+	for _, k := range msg.Keys {
+		row, err := uuid.Parse(k[0])
+		if err != nil {
+			continue
+		}
+		c.invalidate(row, k[1])
+		remoteInvalidationsTotal.Inc()
+	}
+}
+
+// encodeNotifications splits invs into payloads below maxPayloadBytes.
+func encodeNotifications(node string, invs []Invalidation) []string {
+	var out []string
+	msg := notification{Node: node}
+	size := 0
+	flush := func() {
+		if len(msg.Keys) == 0 {
+			return
+		}
+		data, _ := json.Marshal(msg)
+		out = append(out, string(data))
+		msg.Keys, size = nil, 0
+	}
+	for _, inv := range invs {
+		// 36-byte UUID plus quoting and separators.
+		n := len(inv.ColumnName) + 48
+		if size+n > maxPayloadBytes {
+			flush()
+		}
+		msg.Keys = append(msg.Keys, [2]string{inv.RowKey.String(), inv.ColumnName})
+		size += n
+	}
+	flush()
+	return out
+}
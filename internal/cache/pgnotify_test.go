@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+)
+
+type recordingBroadcaster struct {
+	mu     sync.Mutex
+	shards []shard.ID
+	invs   []Invalidation
+}
+
+func (b *recordingBroadcaster) Broadcast(_ context.Context, id shard.ID, invs []Invalidation) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.shards = append(b.shards, id)
+	b.invs = append(b.invs, invs...)
+}
+
+func TestCache_BroadcastsWrites(t *testing.T) {
+	ctx := context.Background()
+	bc := &recordingBroadcaster{}
+	store := New(Options{MaxBytes: 1 << 20, Broadcaster: bc}).Interceptor()(7, newCountingStore())
+	row := uuid.New()
+
+	write(t, store, row, "a", 1, `{}`)
+	_, err := store.WriteCells(ctx, []cell.WriteCellRequest{
+		{RowKey: row, ColumnName: "b", RefKey: 1, Body: json.RawMessage(`{}`)},
+		{RowKey: row, ColumnName: "c", RefKey: 1, Body: json.RawMessage(`{}`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bc.shards) != 2 || bc.shards[0] != 7 {
+		t.Fatalf("broadcast shards = %v, want two broadcasts for shard 7", bc.shards)
+	}
+	want := []Invalidation{{row, "a"}, {row, "b"}, {row, "c"}}
+	if len(bc.invs) != len(want) {
+		t.Fatalf("invalidations = %v, want %v", bc.invs, want)
+	}
+	for i := range want {
+		if bc.invs[i] != want[i] {
+			t.Errorf("invalidation %d = %v, want %v", i, bc.invs[i], want[i])
+		}
+	}
+}
+
+func TestPGNotifier_Apply(t *testing.T) {
+	c := New(Options{MaxBytes: 1 << 20, TTL: time.Minute})
+	n := NewPGNotifier(nil, nil, slog.New(slog.DiscardHandler))
+	row := uuid.New()
+	k := key{row: row, column: "a"}
+	fill := func() {
+		_, gen, _ := c.get(k, "latest")
+		c.put(k, []cell.Cell{{RowKey: row, ColumnName: "a"}}, gen)
+	}
+
+	// Own notifications are ignored; the write was invalidated locally.
+	fill()
+	for _, p := range encodeNotifications(n.node, []Invalidation{{row, "a"}}) {
+		n.apply(c, p)
+	}
+	if _, _, ok := c.get(k, "latest"); !ok {
+		t.Error("own notification invalidated the entry")
+	}
+
+	for _, p := range encodeNotifications("other-node", []Invalidation{{row, "a"}}) {
+		n.apply(c, p)
+	}
+	if _, _, ok := c.get(k, "latest"); ok {
+		t.Error("notification from another node did not invalidate the entry")
+	}
+
+	n.apply(c, "not json") // logged and ignored
+}
+
+func TestEncodeNotifications_SplitsLargeBatches(t *testing.T) {
+	invs := make([]Invalidation, 1000)
+	for i := range invs {
+		invs[i] = Invalidation{RowKey: uuid.New(), ColumnName: strings.Repeat("c", 20)}
+	}
+	payloads := encodeNotifications("node", invs)
+	if len(payloads) < 2 {
+		t.Fatalf("got %d payloads, want the batch split", len(payloads))
+	}
+	total := 0
+	for _, p := range payloads {
+		if len(p) >= 8000 {
+			t.Errorf("payload of %d bytes exceeds the NOTIFY limit", len(p))
+		}
+		var msg notification
+		if err := json.Unmarshal([]byte(p), &msg); err != nil {
+			t.Fatal(err)
+		}
+		total += len(msg.Keys)
+	}
+	if total != len(invs) {
+		t.Errorf("payloads carry %d keys, want %d", total, len(invs))
+	}
+}
+
+func TestCache_Purge(t *testing.T) {
+	c := New(Options{MaxBytes: 1 << 20, TTL: time.Minute})
+	row := uuid.New()
+	k := key{row: row, column: "a"}
+	_, gen, _ := c.get(k, "latest")
+	c.put(k, []cell.Cell{{RowKey: row}}, gen)
+
+	c.Purge()
+	if st := c.Stats(); st.Entries != 0 || st.Bytes != 0 {
+		t.Errorf("after Purge: %+v", st)
+	}
+}
@@ -1,10 +1,21 @@
 package cell
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/rowkey"
 )
 
 // CellRef uniquely identifies a cell in the 3D hash map.
@@ -22,6 +33,9 @@ type Cell struct {
 	RefKey     int64           `json:"ref_key"`
 	Body       json.RawMessage `json:"body"`
 	CreatedAt  time.Time       `json:"created_at"`
+	// CommitSeq is the cell's position in its shard's commit log. Only
+	// reads in commit order set it.
+	CommitSeq int64 `json:"commit_seq,omitempty"`
 }
 
 // WriteCellRequest is what the caller provides to write a new cell.
@@ -31,3 +45,295 @@ type WriteCellRequest struct {
 	RefKey     int64           `json:"ref_key"`
 	Body       json.RawMessage `json:"body"`
 }
+
+// ReservedPrefix starts the names of system columns, such as tombstones and
+// internal markers, which share the cell model with client data but are
+// written only by Mezzanine itself.
+const ReservedPrefix = "_mezz."
+
+// MaxColumnNameLength is the longest column name, in bytes.
+const MaxColumnNameLength = 128
+
+// ColumnNamePattern is the grammar of column names: a letter or '_'
+// followed by letters, digits, '_', '.' or '-'. Column names end up in
+// JSON payloads, metric labels and log lines, so quotes, whitespace and
+// other punctuation are refused.
+const ColumnNamePattern = `^[A-Za-z_][A-Za-z0-9_.-]*$`
+
+var columnName = regexp.MustCompile(ColumnNamePattern)
+
+// ValidateColumnName reports whether name is a valid column name. Reserved
+// names are valid; callers that accept only client columns check IsReserved
+// as well.
+func ValidateColumnName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("column name is empty")
+	case len(name) > MaxColumnNameLength:
+		return fmt.Errorf("column name is longer than %d bytes", MaxColumnNameLength)
+	case !columnName.MatchString(name):
+		return fmt.Errorf("column name %q must be letters, digits, '_', '.' or '-', starting with a letter or '_'", name)
+	}
+	return nil
+}
+
+// IsReserved reports whether columnName is in the reserved namespace.
+func IsReserved(columnName string) bool {
+	return strings.HasPrefix(columnName, ReservedPrefix)
+}
+
+// MetaColumn is the system column holding a row's metadata, including the
+// tags the shard's tag index is built from.
+const MetaColumn = ReservedPrefix + "meta"
+
+// MetaTags returns the tags in the body of a MetaColumn cell.
+func MetaTags(body json.RawMessage) ([]string, error) {
+	var m struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, fmt.Errorf("invalid row metadata: %w", err)
+	}
+	return m.Tags, nil
+}
+
+// DeriveRowKey returns the UUIDv5 row key of a natural key in namespace,
+// as clients derive it with the SDK's DeriveRowKey (see rowkey.Derive).
+func DeriveRowKey(namespace, key string) uuid.UUID {
+	return rowkey.Derive(namespace, key)
+}
+
+// RowKeyFormat is how the server generates row keys for writes that omit
+// one.
+type RowKeyFormat string
+
+const (
+	// RowKeyUUIDv7 generates time-ordered UUIDv7 keys, as the SDK's
+	// NewRowKey does.
+	RowKeyUUIDv7 RowKeyFormat = "uuidv7"
+	// RowKeyULID generates time-ordered keys laid out as ULIDs, as the SDK's
+	// NewULIDRowKey does.
+	RowKeyULID RowKeyFormat = "ulid"
+	// RowKeyUUIDv4 generates random UUIDv4 keys, which scatter new rows
+	// across the shard tables' indexes.
+	RowKeyUUIDv4 RowKeyFormat = "uuidv4"
+)
+
+// Valid reports whether f is a known format.
+func (f RowKeyFormat) Valid() bool {
+	switch f {
+	case RowKeyUUIDv7, RowKeyULID, RowKeyUUIDv4:
+		return true
+	}
+	return false
+}
+
+// NewRowKey returns a new row key in format f; an empty or unknown format
+// generates UUIDv7 keys.
+func NewRowKey(f RowKeyFormat) uuid.UUID {
+	switch f {
+	case RowKeyULID:
+		return rowkey.NewULID()
+	case RowKeyUUIDv4:
+		return uuid.New()
+	}
+	return rowkey.NewV7()
+}
+
+// BlobKey is the only field of the body of a binary cell. Binary cells
+// keep their bytes beside the body, which describes them, so every reader
+// of bodies still sees JSON.
+const BlobKey = ReservedPrefix + "blob"
+
+// BlobInfo describes the bytes of a binary cell.
+type BlobInfo struct {
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	// SHA256 is the hex-encoded hash of the bytes.
+	SHA256 string `json:"sha256"`
+}
+
+// BlobBody returns the body of a binary cell holding data.
+func BlobBody(contentType string, data []byte) json.RawMessage {
+	sum := sha256.Sum256(data)
+	body, _ := json.Marshal(map[string]BlobInfo{BlobKey: {ContentType: contentType, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])}})
+	return body
+}
+
+// ParseBlobBody returns what body describes, if it is the body of a binary
+// cell.
+func ParseBlobBody(body json.RawMessage) (BlobInfo, bool) {
+	if !strings.Contains(string(body), BlobKey) {
+		return BlobInfo{}, false
+	}
+	var v map[string]BlobInfo
+	if json.Unmarshal(body, &v) != nil || len(v) != 1 {
+		return BlobInfo{}, false
+	}
+	info, ok := v[BlobKey]
+	return info, ok && info.ContentType != ""
+}
+
+// MergePatch applies an RFC 7386 JSON merge patch to target and returns the
+// result: objects in patch are merged into target recursively, null
+// removes a field, and any other value replaces what target has.
+func MergePatch(target, patch json.RawMessage) (json.RawMessage, error) {
+	var t, p any
+	if err := unmarshalNumbers(target, &t); err != nil {
+		return nil, fmt.Errorf("target: %w", err)
+	}
+	if err := unmarshalNumbers(patch, &p); err != nil {
+		return nil, fmt.Errorf("patch: %w", err)
+	}
+	return json.Marshal(mergePatch(t, p))
+}
+
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = make(map[string]any, len(p))
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
+
+// unmarshalNumbers decodes data into v keeping numbers as json.Number, so
+// large integers survive a round trip exactly.
+func unmarshalNumbers(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return fmt.Errorf("unexpected data after JSON value")
+	}
+	return nil
+}
+
+// Field operations, the ops of FieldOp.
+const (
+	// OpIncrement adds Value, a number, to a numeric field, which is taken
+	// to be 0 if missing.
+	OpIncrement = "increment"
+	// OpAppend appends Value to an array field, which is created if
+	// missing.
+	OpAppend = "append"
+)
+
+// FieldOp is a server-side update of one field of a body, applied to the
+// latest version of a cell without the client reading it.
+type FieldOp struct {
+	Op string `json:"op"`
+	// Field is a top-level key or a dotted path into nested objects, which
+	// are created if missing.
+	Field string          `json:"field"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ErrFieldOp is returned for field operations that are invalid or do not
+// fit the body they are applied to.
+var ErrFieldOp = errors.New("invalid field operation")
+
+// ApplyFieldOps applies ops in order to body, which must be a JSON object
+// or empty, and returns the result.
+func ApplyFieldOps(body json.RawMessage, ops []FieldOp) (json.RawMessage, error) {
+	var root any = map[string]any{}
+	if len(body) > 0 {
+		if err := unmarshalNumbers(body, &root); err != nil {
+			return nil, fmt.Errorf("body: %w", err)
+		}
+	}
+	obj, ok := root.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: body is not a JSON object", ErrFieldOp)
+	}
+	for i, op := range ops {
+		if err := applyFieldOp(obj, op); err != nil {
+			return nil, fmt.Errorf("%w: ops[%d] %s %q: %s", ErrFieldOp, i, op.Op, op.Field, err)
+		}
+	}
+	return json.Marshal(obj)
+}
+
+func applyFieldOp(obj map[string]any, op FieldOp) error {
+	if op.Op != OpIncrement && op.Op != OpAppend {
+		return fmt.Errorf("unknown op, want %s or %s", OpIncrement, OpAppend)
+	}
+	var value any
+	if err := unmarshalNumbers(op.Value, &value); err != nil {
+		return fmt.Errorf("value: %w", err)
+	}
+	path := strings.Split(op.Field, ".")
+	for _, name := range path[:len(path)-1] {
+		if name == "" {
+			return errors.New("empty field name")
+		}
+		next, ok := obj[name]
+		if !ok || next == nil {
+			next = map[string]any{}
+			obj[name] = next
+		}
+		if obj, ok = next.(map[string]any); !ok {
+			return fmt.Errorf("%s is not an object", name)
+		}
+	}
+	name := path[len(path)-1]
+	if name == "" {
+		return errors.New("empty field name")
+	}
+	switch op.Op {
+	case OpIncrement:
+		n, ok := value.(json.Number)
+		if !ok {
+			return errors.New("value is not a number")
+		}
+		cur := json.Number("0")
+		if v, ok := obj[name]; ok && v != nil {
+			if cur, ok = v.(json.Number); !ok {
+				return errors.New("field is not a number")
+			}
+		}
+		sum, err := addNumbers(cur, n)
+		if err != nil {
+			return err
+		}
+		obj[name] = sum
+	case OpAppend:
+		var arr []any
+		if v, ok := obj[name]; ok && v != nil {
+			if arr, ok = v.([]any); !ok {
+				return errors.New("field is not an array")
+			}
+		}
+		obj[name] = append(arr, value)
+	}
+	return nil
+}
+
+// addNumbers adds integers exactly, whatever their size, and other numbers
+// as float64.
+func addNumbers(a, b json.Number) (json.Number, error) {
+	x, okx := new(big.Int).SetString(string(a), 10)
+	y, oky := new(big.Int).SetString(string(b), 10)
+	if okx && oky {
+		return json.Number(x.Add(x, y).String()), nil
+	}
+	fa, _ := a.Float64()
+	fb, _ := b.Float64()
+	sum := fa + fb
+	if math.IsInf(sum, 0) {
+		return "", errors.New("result overflows")
+	}
+	return json.Number(strconv.FormatFloat(sum, 'g', -1, 64)), nil
+}
@@ -2,10 +2,13 @@ package cell
 
 import (
 	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/rowkey"
 )
 
 func TestCellRef_JSONRoundTrip(t *testing.T) {
@@ -216,3 +219,160 @@ func TestCell_BodyPreservesRawJSON(t *testing.T) {
 		t.Error("expected array key in body")
 	}
 }
+
+func TestIsReserved(t *testing.T) {
+	for name, want := range map[string]bool{
+		"_mezz.tombstone": true,
+		"_mezz.":          true,
+		"_mezz":           false,
+		"_mezzanine":      false,
+		"profile":         false,
+		"profile._mezz.x": false,
+	} {
+		if got := IsReserved(name); got != want {
+			t.Errorf("IsReserved(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestNewRowKey(t *testing.T) {
+	for _, tt := range []struct {
+		format  RowKeyFormat
+		version uuid.Version
+	}{
+		{"", 7},
+		{RowKeyUUIDv7, 7},
+		{RowKeyUUIDv4, 4},
+	} {
+		if got := NewRowKey(tt.format).Version(); got != tt.version {
+			t.Errorf("NewRowKey(%q) is version %d, want %d", tt.format, got, tt.version)
+		}
+	}
+	if !RowKeyULID.Valid() || RowKeyFormat("v7").Valid() {
+		t.Error("Valid: want ulid valid and v7 not")
+	}
+}
+
+func TestValidateColumnName(t *testing.T) {
+	for _, name := range []string{"profile", "profile_geo", "Orders.v2", "_mezz.tombstone", "a-b", strings.Repeat("a", MaxColumnNameLength)} {
+		if err := ValidateColumnName(name); err != nil {
+			t.Errorf("ValidateColumnName(%q): %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "1st", ".hidden", "-x", "a b", "a'b", `a"b`, "a;drop", "naïve", strings.Repeat("a", MaxColumnNameLength+1)} {
+		if err := ValidateColumnName(name); err == nil {
+			t.Errorf("ValidateColumnName(%q): got nil, want error", name)
+		}
+	}
+}
+
+func TestBlobBody(t *testing.T) {
+	body := BlobBody("image/png", []byte("data"))
+	info, ok := ParseBlobBody(body)
+	// sha256("data")
+	want := BlobInfo{ContentType: "image/png", Size: 4, SHA256: "3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7"}
+	if !ok || info != want {
+		t.Errorf("ParseBlobBody(%s) = %+v, %v; want %+v", body, info, ok, want)
+	}
+	for _, body := range []string{
+		`{"name":"Alice"}`,
+		`{"_mezz.blob":{"content_type":"image/png"},"name":"Alice"}`,
+		`{"_mezz.blob":{"size":4}}`,
+		`["_mezz.blob"]`,
+	} {
+		if _, ok := ParseBlobBody(json.RawMessage(body)); ok {
+			t.Errorf("ParseBlobBody(%s): got a binary cell", body)
+		}
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	// The examples of RFC 7386, appendix A.
+	tests := []struct{ target, patch, want string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		// Numbers are kept exactly.
+		{`{"id":9007199254740993}`, `{"n":1.50}`, `{"id":9007199254740993,"n":1.50}`},
+	}
+	for _, tt := range tests {
+		got, err := MergePatch(json.RawMessage(tt.target), json.RawMessage(tt.patch))
+		if err != nil || string(got) != tt.want {
+			t.Errorf("MergePatch(%s, %s) = %s, %v; want %s", tt.target, tt.patch, got, err, tt.want)
+		}
+	}
+	if _, err := MergePatch(json.RawMessage(`{}`), json.RawMessage(`{"a":`)); err == nil {
+		t.Error("malformed patch: expected error")
+	}
+}
+
+func TestApplyFieldOps(t *testing.T) {
+	tests := []struct {
+		body string
+		ops  []FieldOp
+		want string
+	}{
+		{`{"views":41}`, []FieldOp{{Op: OpIncrement, Field: "views", Value: json.RawMessage(`1`)}}, `{"views":42}`},
+		{``, []FieldOp{{Op: OpIncrement, Field: "stats.views", Value: json.RawMessage(`-2`)}}, `{"stats":{"views":-2}}`},
+		{`{"n":9007199254740993}`, []FieldOp{{Op: OpIncrement, Field: "n", Value: json.RawMessage(`1`)}}, `{"n":9007199254740994}`},
+		{`{"n":1.5}`, []FieldOp{{Op: OpIncrement, Field: "n", Value: json.RawMessage(`0.25`)}}, `{"n":1.75}`},
+		{`{"log":["a"]}`, []FieldOp{{Op: OpAppend, Field: "log", Value: json.RawMessage(`{"at":1}`)}}, `{"log":["a",{"at":1}]}`},
+		{`{"a":1}`, []FieldOp{
+			{Op: OpAppend, Field: "log", Value: json.RawMessage(`"x"`)},
+			{Op: OpAppend, Field: "log", Value: json.RawMessage(`"y"`)},
+			{Op: OpIncrement, Field: "a", Value: json.RawMessage(`2`)},
+		}, `{"a":3,"log":["x","y"]}`},
+	}
+	for _, tt := range tests {
+		got, err := ApplyFieldOps(json.RawMessage(tt.body), tt.ops)
+		if err != nil || string(got) != tt.want {
+			t.Errorf("ApplyFieldOps(%s, %+v) = %s, %v; want %s", tt.body, tt.ops, got, err, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		body string
+		op   FieldOp
+	}{
+		{`{"n":"x"}`, FieldOp{Op: OpIncrement, Field: "n", Value: json.RawMessage(`1`)}},
+		{`{}`, FieldOp{Op: OpIncrement, Field: "n", Value: json.RawMessage(`"1"`)}},
+		{`{"log":{}}`, FieldOp{Op: OpAppend, Field: "log", Value: json.RawMessage(`1`)}},
+		{`{"a":1}`, FieldOp{Op: OpAppend, Field: "a.b", Value: json.RawMessage(`1`)}},
+		{`{}`, FieldOp{Op: OpAppend, Field: "a..b", Value: json.RawMessage(`1`)}},
+		{`{}`, FieldOp{Op: "set", Field: "a", Value: json.RawMessage(`1`)}},
+		{`{}`, FieldOp{Op: OpAppend, Field: "a"}},
+		{`{"n":1e308}`, FieldOp{Op: OpIncrement, Field: "n", Value: json.RawMessage(`1e308`)}},
+		{`[1]`, FieldOp{Op: OpAppend, Field: "a", Value: json.RawMessage(`1`)}},
+	} {
+		if _, err := ApplyFieldOps(json.RawMessage(tt.body), []FieldOp{tt.op}); !errors.Is(err, ErrFieldOp) {
+			t.Errorf("ApplyFieldOps(%s, %+v): got %v, want ErrFieldOp", tt.body, tt.op, err)
+		}
+	}
+}
+
+func TestDeriveRowKey(t *testing.T) {
+	// A UUID namespace is used as the UUIDv5 namespace itself.
+	if got, want := DeriveRowKey(uuid.NameSpaceDNS.String(), "example.com"), uuid.NewSHA1(uuid.NameSpaceDNS, []byte("example.com")); got != want {
+		t.Errorf("UUID namespace: got %s, want %s", got, want)
+	}
+	// Any other namespace is named under rowkey.Namespace.
+	ns := uuid.NewSHA1(uuid.MustParse(rowkey.Namespace), []byte("user"))
+	if got, want := DeriveRowKey("user", "alice@example.com"), uuid.NewSHA1(ns, []byte("alice@example.com")); got != want {
+		t.Errorf("named namespace: got %s, want %s", got, want)
+	}
+	if DeriveRowKey("user", "alice") == DeriveRowKey("account", "alice") {
+		t.Error("namespaces do not separate keys")
+	}
+}
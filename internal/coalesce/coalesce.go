@@ -0,0 +1,251 @@
+// Package coalesce groups concurrent single-cell writes to a shard into
+// multi-row inserts (group commit). Each write waits up to a short window
+// for others to join it, trading that much latency for far fewer
+// round trips and transactions on hot shards.
+package coalesce
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+var (
+	batchSize = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "mezzanine",
+			Name:      "write_coalesce_batch_size",
+			Help:      "Number of single-cell writes combined into one insert.",
+			Buckets:   []float64{1, 2, 4, 8, 16, 32, 64, 128, 256},
+		},
+	)
+
+	fallbacksTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "mezzanine",
+			Name:      "write_coalesce_fallbacks_total",
+			Help:      "Coalesced batches that failed and were retried as individual writes.",
+		},
+	)
+)
+
+// Options configures write coalescing.
+type Options struct {
+	// Window is how long the first write of a batch waits for others.
+	Window time.Duration
+	// MaxBatch flushes a batch as soon as it holds this many writes
+	// (default 100).
+	MaxBatch int
+}
+
+// Interceptor returns a shard.Router interceptor that coalesces WriteCell
+// calls. Other calls, including WriteCells, pass through unchanged.
+func Interceptor(opts Options) shard.Interceptor {
+	if opts.MaxBatch <= 0 {
+		opts.MaxBatch = 100
+	}
+	return func(_ shard.ID, store storage.CellStore) storage.CellStore {
+		return &coalescingStore{CellStore: store, opts: opts}
+	}
+}
+
+// write is one pending WriteCell.
+type write struct {
+	ctx  context.Context
+	req  cell.WriteCellRequest
+	done chan result
+}
+
+type result struct {
+	cell *cell.Cell
+	err  error
+}
+
+type coalescingStore struct {
+	storage.CellStore
+	opts Options
+
+	mu      sync.Mutex
+	pending []*write
+	timer   *time.Timer
+}
+
+// WriteCell queues req and waits for its batch. If ctx ends first, WriteCell
+// returns ctx.Err() but the write may still be stored, as with any write
+// whose caller gives up while it is in flight.
+func (s *coalescingStore) WriteCell(ctx context.Context, req cell.WriteCellRequest) (*cell.Cell, error) {
+	w := &write{ctx: ctx, req: req, done: make(chan result, 1)}
+
+	s.mu.Lock()
+	s.pending = append(s.pending, w)
+	var batch []*write
+	switch {
+	case len(s.pending) >= s.opts.MaxBatch:
+		batch = s.take()
+	case len(s.pending) == 1:
+		s.timer = time.AfterFunc(s.opts.Window, s.flushPending)
+	}
+	s.mu.Unlock()
+
+	if batch != nil {
+		go s.flush(batch)
+	}
+
+	select {
+	case r := <-w.done:
+		return r.cell, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// take removes and returns the pending batch. s.mu must be held.
+func (s *coalescingStore) take() []*write {
+	batch := s.pending
+	s.pending = nil
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	return batch
+}
+
+func (s *coalescingStore) flushPending() {
+	s.mu.Lock()
+	batch := s.take()
+	s.mu.Unlock()
+	if len(batch) > 0 {
+		s.flush(batch)
+	}
+}
+
+func (s *coalescingStore) flush(batch []*write) {
+	batchSize.Observe(float64(len(batch)))
+	if len(batch) == 1 {
+		w := batch[0]
+		c, err := s.CellStore.WriteCell(w.ctx, w.req)
+		w.done <- result{c, err}
+		return
+	}
+
+	// The batch outlives any single caller, so it must not be cancelled by
+	// one of them; the store's own query timeout still applies.
+	ctx := context.WithoutCancel(batch[0].ctx)
+	reqs := make([]cell.WriteCellRequest, len(batch))
+	for i, w := range batch {
+		reqs[i] = w.req
+	}
+	cells, err := s.CellStore.WriteCells(ctx, reqs)
+	if err == nil && len(cells) == len(batch) {
+		for i, w := range batch {
+			w.done <- result{&cells[i], nil}
+		}
+		return
+	}
+
+	// WriteCells is all-or-nothing, so one duplicate cell fails the batch.
+	// Retry each write alone so every caller gets its own outcome.
+	fallbacksTotal.Inc()
+	var wg sync.WaitGroup
+	for _, w := range batch {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := s.CellStore.WriteCell(w.ctx, w.req)
+			w.done <- result{c, err}
+		}()
+	}
+	wg.Wait()
+}
+
+// Reads pass straight through; these keep the next store's streaming,
+// probes and head waits visible through the embedded interface.
+
+func (s *coalescingStore) StreamRow(ctx context.Context, rowKey uuid.UUID) (storage.CellIterator, error) {
+	return storage.StreamRow(ctx, s.CellStore, rowKey)
+}
+
+func (s *coalescingStore) StreamRowColumns(ctx context.Context, rowKey uuid.UUID, columns []string) (storage.CellIterator, error) {
+	return storage.StreamRowColumns(ctx, s.CellStore, rowKey, columns)
+}
+
+func (s *coalescingStore) StreamPartition(ctx context.Context, partitionNumber int, readType int, addedID int64, createdAfter time.Time, limit int) (storage.CellIterator, error) {
+	return storage.StreamPartition(ctx, s.CellStore, partitionNumber, readType, addedID, createdAfter, limit)
+}
+
+// Binary cells are written alone, not coalesced.
+func (s *coalescingStore) WriteBlob(ctx context.Context, req cell.WriteCellRequest, data []byte) (*cell.Cell, error) {
+	return storage.WriteBlob(ctx, s.CellStore, req, data)
+}
+
+// Updates are applied alone, not coalesced.
+func (s *coalescingStore) UpdateCell(ctx context.Context, rowKey uuid.UUID, columnName string, apply storage.UpdateFunc) (*cell.Cell, error) {
+	return storage.UpdateCell(ctx, s.CellStore, rowKey, columnName, apply)
+}
+
+func (s *coalescingStore) GetBlob(ctx context.Context, ref cell.CellRef) (*cell.Cell, []byte, error) {
+	return storage.GetBlob(ctx, s.CellStore, ref)
+}
+
+func (s *coalescingStore) GetBlobLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, []byte, error) {
+	return storage.GetBlobLatest(ctx, s.CellStore, rowKey, columnName)
+}
+
+func (s *coalescingStore) PutAlias(ctx context.Context, alias string, rowKey uuid.UUID) (*storage.Alias, error) {
+	return storage.PutAlias(ctx, s.CellStore, alias, rowKey)
+}
+
+func (s *coalescingStore) GetAlias(ctx context.Context, alias string) (*storage.Alias, error) {
+	return storage.GetAlias(ctx, s.CellStore, alias)
+}
+
+func (s *coalescingStore) DeleteAlias(ctx context.Context, alias string) error {
+	return storage.DeleteAlias(ctx, s.CellStore, alias)
+}
+
+func (s *coalescingStore) SetRowTags(ctx context.Context, rowKey uuid.UUID, tags []string) error {
+	return storage.SetRowTags(ctx, s.CellStore, rowKey, tags)
+}
+
+func (s *coalescingStore) RecordIdempotencyKey(ctx context.Context, key string, hash []byte) error {
+	return storage.RecordIdempotencyKey(ctx, s.CellStore, key, hash)
+}
+
+func (s *coalescingStore) IdempotencyKeyHash(ctx context.Context, key string) ([]byte, error) {
+	return storage.IdempotencyKeyHash(ctx, s.CellStore, key)
+}
+
+func (s *coalescingStore) RowsByTag(ctx context.Context, tag string, after uuid.UUID, limit int) ([]uuid.UUID, error) {
+	return storage.RowsByTag(ctx, s.CellStore, tag, after, limit)
+}
+
+func (s *coalescingStore) QueryCells(ctx context.Context, q storage.Query) ([]cell.Cell, error) {
+	return storage.QueryCells(ctx, s.CellStore, q)
+}
+
+func (s *coalescingStore) ProbeCellLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, error) {
+	return storage.ProbeCellLatest(ctx, s.CellStore, rowKey, columnName)
+}
+
+func (s *coalescingStore) ProbeRow(ctx context.Context, rowKey uuid.UUID, withSystem bool) (storage.RowSummary, error) {
+	return storage.ProbeRow(ctx, s.CellStore, rowKey, withSystem)
+}
+
+func (s *coalescingStore) WaitHead(ctx context.Context, afterAddedID int64) (int64, error) {
+	return storage.WaitHead(ctx, s.CellStore, afterAddedID)
+}
+
+func (s *coalescingStore) CommittedHead(ctx context.Context) (int64, error) {
+	return storage.CommittedHead(ctx, s.CellStore)
+}
+
+func (s *coalescingStore) ScanCommitLog(ctx context.Context, fromAddedID, afterSeq int64, limit int) ([]cell.Cell, int64, error) {
+	return storage.ScanCommitLog(ctx, s.CellStore, fromAddedID, afterSeq, limit)
+}
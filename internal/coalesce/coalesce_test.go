@@ -0,0 +1,166 @@
+package coalesce
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// batchStore records the batches it receives and rejects duplicate cells.
+type batchStore struct {
+	storage.CellStore
+
+	mu      sync.Mutex
+	nextID  int64
+	cells   map[cell.CellRef]bool
+	batches []int
+	singles int
+}
+
+func newBatchStore() *batchStore {
+	return &batchStore{cells: make(map[cell.CellRef]bool)}
+}
+
+func (s *batchStore) insert(req cell.WriteCellRequest) cell.Cell {
+	s.nextID++
+	s.cells[cell.CellRef{RowKey: req.RowKey, ColumnName: req.ColumnName, RefKey: req.RefKey}] = true
+	return cell.Cell{AddedID: s.nextID, RowKey: req.RowKey, ColumnName: req.ColumnName, RefKey: req.RefKey, Body: req.Body}
+}
+
+func (s *batchStore) exists(req cell.WriteCellRequest) bool {
+	return s.cells[cell.CellRef{RowKey: req.RowKey, ColumnName: req.ColumnName, RefKey: req.RefKey}]
+}
+
+func (s *batchStore) WriteCell(_ context.Context, req cell.WriteCellRequest) (*cell.Cell, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.singles++
+	if s.exists(req) {
+		return nil, storage.ErrCellExists
+	}
+	c := s.insert(req)
+	return &c, nil
+}
+
+func (s *batchStore) WriteCells(_ context.Context, reqs []cell.WriteCellRequest) ([]cell.Cell, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, len(reqs))
+	seen := make(map[cell.CellRef]bool)
+	for _, req := range reqs {
+		ref := cell.CellRef{RowKey: req.RowKey, ColumnName: req.ColumnName, RefKey: req.RefKey}
+		if s.exists(req) || seen[ref] {
+			return nil, storage.ErrCellExists
+		}
+		seen[ref] = true
+	}
+	out := make([]cell.Cell, len(reqs))
+	for i, req := range reqs {
+		out[i] = s.insert(req)
+	}
+	return out, nil
+}
+
+func writeConcurrently(store storage.CellStore, reqs []cell.WriteCellRequest) ([]*cell.Cell, []error) {
+	cells := make([]*cell.Cell, len(reqs))
+	errs := make([]error, len(reqs))
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cells[i], errs[i] = store.WriteCell(context.Background(), req)
+		}()
+	}
+	wg.Wait()
+	return cells, errs
+}
+
+func requests(n int) []cell.WriteCellRequest {
+	reqs := make([]cell.WriteCellRequest, n)
+	for i := range reqs {
+		reqs[i] = cell.WriteCellRequest{RowKey: uuid.New(), ColumnName: "c", RefKey: 1, Body: json.RawMessage(fmt.Sprintf(`{"i":%d}`, i))}
+	}
+	return reqs
+}
+
+func TestCoalesce_GroupsConcurrentWrites(t *testing.T) {
+	backing := newBatchStore()
+	store := Interceptor(Options{Window: 50 * time.Millisecond, MaxBatch: 10})(0, backing)
+
+	reqs := requests(10)
+	cells, errs := writeConcurrently(store, reqs)
+	for i := range reqs {
+		if errs[i] != nil {
+			t.Fatalf("write %d: %v", i, errs[i])
+		}
+		if cells[i].RowKey != reqs[i].RowKey {
+			t.Errorf("write %d got cell for row %s, want %s", i, cells[i].RowKey, reqs[i].RowKey)
+		}
+	}
+	if len(backing.batches) != 1 || backing.batches[0] != 10 || backing.singles != 0 {
+		t.Errorf("batches = %v, singles = %d; want one batch of 10", backing.batches, backing.singles)
+	}
+}
+
+func TestCoalesce_WindowFlushesPartialBatch(t *testing.T) {
+	backing := newBatchStore()
+	store := Interceptor(Options{Window: 5 * time.Millisecond, MaxBatch: 100})(0, backing)
+
+	start := time.Now()
+	if _, err := store.WriteCell(context.Background(), requests(1)[0]); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 5*time.Millisecond {
+		t.Errorf("write returned after %v, before the window", elapsed)
+	}
+	if backing.singles != 1 {
+		t.Errorf("singles = %d, want a lone write sent as WriteCell", backing.singles)
+	}
+}
+
+func TestCoalesce_DuplicateFallsBackToSingleWrites(t *testing.T) {
+	backing := newBatchStore()
+	store := Interceptor(Options{Window: 50 * time.Millisecond, MaxBatch: 4})(0, backing)
+
+	reqs := requests(3)
+	reqs = append(reqs, reqs[0]) // same coordinates as the first write
+
+	_, errs := writeConcurrently(store, reqs)
+	var ok, exists int
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			ok++
+		case errors.Is(err, storage.ErrCellExists):
+			exists++
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if ok != 3 || exists != 1 {
+		t.Errorf("got %d stored and %d duplicates, want 3 and 1", ok, exists)
+	}
+	if backing.singles != 4 {
+		t.Errorf("singles = %d, want every write retried alone", backing.singles)
+	}
+}
+
+func TestCoalesce_CallerCancellation(t *testing.T) {
+	backing := newBatchStore()
+	store := Interceptor(Options{Window: time.Second, MaxBatch: 100})(0, backing)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := store.WriteCell(ctx, requests(1)[0]); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,326 @@
+// Package column keeps a registry of the column names in use, with metadata
+// that teams maintain (owner, description, schema reference), write
+// statistics collected by the API and the storage each column uses.
+//
+// Columns are registered automatically the first time a cell is written to
+// them. Write counts are accumulated in memory and flushed to the backing
+// store periodically, so the write path never waits on the registry. Each
+// instance also estimates which columns it writes most, and at what rate,
+// without persisting it.
+//
+// Storage usage grows with every write the same way, but deletes and
+// garbage collection are not counted, so a periodic count of the shard
+// tables (see internal/accounting) replaces it with the truth.
+package column
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Metadata is the part of a column that teams edit.
+type Metadata struct {
+	Owner       string `json:"owner"`
+	Description string `json:"description"`
+	// SchemaRef points at the schema of the column's cell bodies, e.g. a
+	// URL or a path in a schema repository.
+	SchemaRef string `json:"schema_ref"`
+	// KeepVersions is how many versions of each row's cell garbage
+	// collection keeps once they are superseded (see internal/compaction);
+	// 0 keeps every version.
+	KeepVersions int `json:"keep_versions"`
+}
+
+// Stats are write statistics of a column, summed across instances.
+type Stats struct {
+	Writes int64 `json:"writes"`
+	// Bytes is the size of the bodies written, as clients sent them.
+	Bytes         int64     `json:"bytes"`
+	LastWrittenAt time.Time `json:"last_written_at,omitzero"`
+}
+
+// Usage is the storage a column uses: its cells, every version of every
+// row, and the size of their bodies and of the bytes of binary cells.
+// Writes add to it as they happen; it is exact only as of CountedAt, when
+// the shard tables were last counted, and otherwise misses deletes and
+// garbage collection since.
+type Usage struct {
+	Cells     int64     `json:"cells"`
+	Bytes     int64     `json:"bytes"`
+	CountedAt time.Time `json:"counted_at,omitzero"`
+}
+
+// Column is a registered column.
+type Column struct {
+	Name string `json:"name"`
+	Metadata
+	Stats     Stats     `json:"stats"`
+	Usage     Usage     `json:"usage"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Registry is a thread-safe registry of columns. When a Store is provided,
+// metadata edits are written through and write statistics are flushed to it
+// by Flush; otherwise the registry only knows this process's writes.
+type Registry struct {
+	mu      sync.RWMutex
+	columns map[string]*Column
+	pending map[string]Stats
+	store   Store // optional; nil means in-memory only
+	top     *topK // nil when SetTopK disabled it
+	// writeMu serializes Update and SetUsage, which persist their change
+	// without holding mu, so that Observe, on the write path, is never
+	// blocked on the store.
+	writeMu sync.Mutex
+}
+
+// NewRegistry creates an empty registry.
+// An optional Store enables persistence.
+func NewRegistry(store ...Store) *Registry {
+	r := &Registry{columns: make(map[string]*Column), pending: make(map[string]Stats), top: newTopK(DefaultTopK)}
+	if len(store) > 0 && store[0] != nil {
+		r.store = store[0]
+	}
+	return r
+}
+
+// LoadAll replaces the registry's columns with those in the backing store,
+// picking up registrations and edits made by other instances. It is a no-op
+// if no store is configured.
+func (r *Registry) LoadAll(ctx context.Context) error {
+	if r.store == nil {
+		return nil
+	}
+	columns, err := r.store.ListColumns(ctx)
+	if err != nil {
+		return fmt.Errorf("load columns: %w", err)
+	}
+	byName := make(map[string]*Column, len(columns))
+	for _, c := range columns {
+		byName[c.Name] = c
+	}
+	r.mu.Lock()
+	r.columns = byName
+	r.mu.Unlock()
+	return nil
+}
+
+// SetTopK sets how many of the columns written most the registry tracks the
+// throughput of; 0 disables tracking. It must be called before Observe.
+func (r *Registry) SetTopK(capacity int) {
+	r.top = nil
+	if capacity > 0 {
+		r.top = newTopK(capacity)
+	}
+}
+
+// Observe records n cells of bytes body bytes in all written to a column at
+// time at, registering the column if it is new.
+func (r *Registry) Observe(name string, n, bytes int, at time.Time) {
+	if r.top != nil {
+		r.top.observe(name, n, bytes, at)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.store != nil {
+		r.pending[name] = addStats(r.pending[name], int64(n), int64(bytes), at)
+		return
+	}
+	c, ok := r.columns[name]
+	if !ok {
+		c = &Column{Name: name, CreatedAt: at, UpdatedAt: at}
+		r.columns[name] = c
+	}
+	c.add(Stats{Writes: int64(n), Bytes: int64(bytes), LastWrittenAt: at})
+}
+
+// add counts writes in a column's statistics and usage.
+func (c *Column) add(s Stats) {
+	c.Stats = addStats(c.Stats, s.Writes, s.Bytes, s.LastWrittenAt)
+	c.Usage.Cells += s.Writes
+	c.Usage.Bytes += s.Bytes
+}
+
+func addStats(s Stats, n, bytes int64, at time.Time) Stats {
+	s.Writes += n
+	s.Bytes += bytes
+	if at.After(s.LastWrittenAt) {
+		s.LastWrittenAt = at
+	}
+	return s
+}
+
+// Top returns the throughput of up to n of the columns this instance has
+// written most, most cells first. It is empty when tracking is disabled.
+func (r *Registry) Top(n int) []TopColumn {
+	if r.top == nil {
+		return []TopColumn{}
+	}
+	return r.top.top(n, time.Now())
+}
+
+// Get returns a column by name.
+func (r *Registry) Get(name string) (Column, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.column(name)
+	if !ok {
+		return Column{}, false
+	}
+	return c, true
+}
+
+// List returns all columns sorted by name.
+func (r *Registry) List() []Column {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make(map[string]struct{}, len(r.columns)+len(r.pending))
+	for name := range r.columns {
+		names[name] = struct{}{}
+	}
+	for name := range r.pending {
+		names[name] = struct{}{}
+	}
+	out := make([]Column, 0, len(names))
+	for name := range names {
+		c, _ := r.column(name)
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// column returns a copy of a column with unflushed writes included. The
+// caller must hold r.mu.
+func (r *Registry) column(name string) (Column, bool) {
+	var c Column
+	stored, ok := r.columns[name]
+	if ok {
+		c = *stored
+	}
+	if p, pending := r.pending[name]; pending {
+		if !ok {
+			c = Column{Name: name, CreatedAt: p.LastWrittenAt, UpdatedAt: p.LastWrittenAt}
+		}
+		c.add(p)
+		ok = true
+	}
+	return c, ok
+}
+
+// Update sets the metadata of a column, registering it if it has not been
+// written to yet.
+func (r *Registry) Update(ctx context.Context, name string, meta Metadata) (Column, error) {
+	if name == "" {
+		return Column{}, fmt.Errorf("column name is required")
+	}
+	if meta.KeepVersions < 0 {
+		return Column{}, fmt.Errorf("keep_versions must not be negative, got %d", meta.KeepVersions)
+	}
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	var updated *Column
+	if r.store != nil {
+		c, err := r.store.SaveMetadata(ctx, name, meta)
+		if err != nil {
+			return Column{}, fmt.Errorf("persist column: %w", err)
+		}
+		updated = c
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if updated == nil {
+		now := time.Now()
+		updated = &Column{Name: name, CreatedAt: now}
+		if c, ok := r.columns[name]; ok {
+			*updated = *c
+		}
+		updated.Metadata = meta
+		updated.UpdatedAt = now
+	}
+	r.columns[name] = updated
+	c, _ := r.column(name)
+	return c, nil
+}
+
+// Flush writes the statistics accumulated since the last flush to the
+// backing store. Statistics that fail to flush are kept for the next
+// attempt.
+func (r *Registry) Flush(ctx context.Context) error {
+	if r.store == nil {
+		return nil
+	}
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[string]Stats)
+	r.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+	if err := r.store.AddStats(ctx, pending); err != nil {
+		r.mu.Lock()
+		for name, s := range pending {
+			r.pending[name] = addStats(r.pending[name], s.Writes, s.Bytes, s.LastWrittenAt)
+		}
+		r.mu.Unlock()
+		return fmt.Errorf("flush column stats: %w", err)
+	}
+	return nil
+}
+
+// SetUsage replaces the usage of every column with counts of the shard
+// tables taken at time at; columns counts leaves out have no cells. Writes
+// made while the tables were counted may be missed or counted twice until
+// the next count.
+func (r *Registry) SetUsage(ctx context.Context, counts map[string]Usage, at time.Time) error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	if r.store != nil {
+		if err := r.store.SetUsage(ctx, counts, at); err != nil {
+			return fmt.Errorf("persist column usage: %w", err)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.columns {
+		c.Usage = Usage{CountedAt: at}
+	}
+	for name, u := range counts {
+		c, ok := r.columns[name]
+		if !ok {
+			c = &Column{Name: name, CreatedAt: at, UpdatedAt: at}
+			r.columns[name] = c
+		}
+		c.Usage = Usage{Cells: u.Cells, Bytes: u.Bytes, CountedAt: at}
+	}
+	return nil
+}
+
+// Run flushes statistics and reloads the registry every interval until ctx
+// is cancelled. Callers should Flush once more on shutdown.
+func (r *Registry) Run(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	if r.store == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Flush(ctx); err != nil {
+				logger.Error("failed to flush column stats", "error", err)
+				continue
+			}
+			if err := r.LoadAll(ctx); err != nil {
+				logger.Error("failed to reload columns", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package column
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockStore is an in-memory implementation of Store for testing.
+type mockStore struct {
+	mu      sync.Mutex
+	columns map[string]*Column
+	failAdd bool
+}
+
+func newMockStore() *mockStore {
+	return &mockStore{columns: make(map[string]*Column)}
+}
+
+func (m *mockStore) ListColumns(context.Context) ([]*Column, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []*Column
+	for _, c := range m.columns {
+		cp := *c
+		out = append(out, &cp)
+	}
+	return out, nil
+}
+
+func (m *mockStore) SaveMetadata(_ context.Context, name string, meta Metadata) (*Column, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.columns[name]
+	if !ok {
+		c = &Column{Name: name, CreatedAt: time.Now()}
+		m.columns[name] = c
+	}
+	c.Metadata = meta
+	c.UpdatedAt = time.Now()
+	cp := *c
+	return &cp, nil
+}
+
+func (m *mockStore) AddStats(_ context.Context, stats map[string]Stats) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failAdd {
+		return errors.New("database is down")
+	}
+	for name, s := range stats {
+		c, ok := m.columns[name]
+		if !ok {
+			c = &Column{Name: name, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+			m.columns[name] = c
+		}
+		c.add(s)
+	}
+	return nil
+}
+
+func (m *mockStore) SetUsage(_ context.Context, counts map[string]Usage, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.columns {
+		c.Usage = Usage{CountedAt: at}
+	}
+	for name, u := range counts {
+		c, ok := m.columns[name]
+		if !ok {
+			c = &Column{Name: name, CreatedAt: at, UpdatedAt: at}
+			m.columns[name] = c
+		}
+		c.Usage = Usage{Cells: u.Cells, Bytes: u.Bytes, CountedAt: at}
+	}
+	return nil
+}
+
+func TestRegistry_ObserveInMemory(t *testing.T) {
+	r := NewRegistry()
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.Observe("profile", 1, 100, t0)
+	r.Observe("profile", 2, 200, t0.Add(time.Minute))
+	r.Observe("orders", 1, 100, t0)
+
+	list := r.List()
+	if len(list) != 2 || list[0].Name != "orders" || list[1].Name != "profile" {
+		t.Fatalf("List = %+v", list)
+	}
+	if list[1].Stats.Writes != 3 || !list[1].Stats.LastWrittenAt.Equal(t0.Add(time.Minute)) {
+		t.Errorf("profile stats = %+v", list[1].Stats)
+	}
+	if !list[1].CreatedAt.Equal(t0) {
+		t.Errorf("profile created_at = %v, want first write", list[1].CreatedAt)
+	}
+}
+
+func TestRegistry_TopEvictsLeastWritten(t *testing.T) {
+	r := NewRegistry()
+	r.SetTopK(2)
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.Observe("profile", 5, 500, t0)
+	r.Observe("orders", 2, 200, t0)
+	r.Observe("billing", 1, 10, t0.Add(time.Second))
+
+	top := r.Top(10)
+	if len(top) != 2 || top[0].Name != "profile" || top[1].Name != "billing" {
+		t.Fatalf("Top = %+v", top)
+	}
+	// billing displaced orders, so its counts include orders' as error.
+	if b := top[1]; b.Cells != 3 || b.CellsError != 2 || b.Bytes != 210 || b.BytesError != 200 || !b.Since.Equal(t0) {
+		t.Errorf("billing = %+v", b)
+	}
+	if top[0].CellsError != 0 {
+		t.Errorf("profile = %+v, want exact counts", top[0])
+	}
+	if top := r.Top(1); len(top) != 1 || top[0].Name != "profile" {
+		t.Errorf("Top(1) = %+v", top)
+	}
+
+	r = NewRegistry()
+	r.SetTopK(0)
+	r.Observe("profile", 1, 100, t0)
+	if top := r.Top(10); len(top) != 0 {
+		t.Errorf("disabled: Top = %+v", top)
+	}
+}
+
+func TestRegistry_UpdateKeepsStats(t *testing.T) {
+	r := NewRegistry()
+	r.Observe("billing", 5, 500, time.Now())
+
+	c, err := r.Update(context.Background(), "billing", Metadata{Owner: "payments", Description: "Invoices", SchemaRef: "schemas/billing.json"})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if c.Owner != "payments" || c.SchemaRef != "schemas/billing.json" || c.Stats.Writes != 5 {
+		t.Errorf("got %+v", c)
+	}
+	if _, err := r.Update(context.Background(), "", Metadata{}); err == nil {
+		t.Error("expected error for empty name")
+	}
+	if _, err := r.Update(context.Background(), "billing", Metadata{KeepVersions: -1}); err == nil {
+		t.Error("expected error for negative keep_versions")
+	}
+}
+
+func TestRegistry_FlushAndLoad(t *testing.T) {
+	store := newMockStore()
+	ctx := context.Background()
+	a, b := NewRegistry(store), NewRegistry(store)
+
+	a.Observe("profile", 2, 200, time.Now())
+	if c, ok := a.Get("profile"); !ok || c.Stats.Writes != 2 {
+		t.Fatalf("unflushed writes not visible: %+v, %v", c, ok)
+	}
+	if err := a.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	b.Observe("profile", 1, 100, time.Now())
+	if _, err := b.Update(ctx, "profile", Metadata{Owner: "accounts"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	if err := a.LoadAll(ctx); err != nil {
+		t.Fatalf("LoadAll: %v", err)
+	}
+	c, _ := a.Get("profile")
+	if c.Owner != "accounts" || c.Stats.Writes != 2 {
+		t.Errorf("a sees %+v", c)
+	}
+	c, _ = b.Get("profile")
+	if c.Stats.Writes != 3 {
+		t.Errorf("b sees %d writes, want 3 including its unflushed write", c.Stats.Writes)
+	}
+}
+
+func TestRegistry_FlushErrorKeepsStats(t *testing.T) {
+	store := newMockStore()
+	store.failAdd = true
+	r := NewRegistry(store)
+	r.Observe("profile", 4, 400, time.Now())
+
+	if err := r.Flush(context.Background()); err == nil {
+		t.Fatal("expected flush error")
+	}
+	store.failAdd = false
+	if err := r.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if store.columns["profile"].Stats.Writes != 4 {
+		t.Errorf("stored writes = %d, want 4", store.columns["profile"].Stats.Writes)
+	}
+}
+
+func TestRegistry_SetUsage(t *testing.T) {
+	store := newMockStore()
+	ctx := context.Background()
+	r := NewRegistry(store)
+	r.Observe("profile", 2, 200, time.Now())
+	r.Observe("orders", 1, 50, time.Now())
+	if err := r.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if err := r.LoadAll(ctx); err != nil {
+		t.Fatalf("LoadAll: %v", err)
+	}
+	if c, _ := r.Get("profile"); c.Usage.Cells != 2 || c.Usage.Bytes != 200 || c.Stats.Bytes != 200 {
+		t.Fatalf("profile after writes = %+v", c)
+	}
+
+	// Garbage collection removed the orders cell and an old profile version.
+	counted := time.Date(2026, 2, 6, 12, 0, 0, 0, time.UTC)
+	if err := r.SetUsage(ctx, map[string]Usage{"profile": {Cells: 1, Bytes: 90}}, counted); err != nil {
+		t.Fatalf("SetUsage: %v", err)
+	}
+	r.Observe("profile", 1, 100, time.Now())
+
+	c, _ := r.Get("profile")
+	if c.Usage.Cells != 2 || c.Usage.Bytes != 190 || !c.Usage.CountedAt.Equal(counted) {
+		t.Errorf("profile usage = %+v, want count plus the unflushed write", c.Usage)
+	}
+	if c.Stats.Writes != 3 {
+		t.Errorf("profile writes = %d, want 3; counting must not reset statistics", c.Stats.Writes)
+	}
+	if c, _ := r.Get("orders"); c.Usage.Cells != 0 || c.Usage.Bytes != 0 {
+		t.Errorf("orders usage = %+v, want zero", c.Usage)
+	}
+	if u := store.columns["orders"].Usage; u.Cells != 0 || !u.CountedAt.Equal(counted) {
+		t.Errorf("stored orders usage = %+v", u)
+	}
+}
+
+// slowUsageStore blocks SetUsage until release is closed.
+type slowUsageStore struct {
+	*mockStore
+	entered, release chan struct{}
+}
+
+func (s *slowUsageStore) SetUsage(ctx context.Context, counts map[string]Usage, at time.Time) error {
+	close(s.entered)
+	<-s.release
+	return s.mockStore.SetUsage(ctx, counts, at)
+}
+
+func TestRegistry_SetUsageDoesNotBlockObserve(t *testing.T) {
+	store := &slowUsageStore{mockStore: newMockStore(), entered: make(chan struct{}), release: make(chan struct{})}
+	r := NewRegistry(store)
+	done := make(chan error, 1)
+	go func() { done <- r.SetUsage(context.Background(), map[string]Usage{"profile": {Cells: 1}}, time.Now()) }()
+	<-store.entered
+
+	observed := make(chan struct{})
+	go func() {
+		r.Observe("profile", 1, 10, time.Now())
+		r.Get("profile")
+		close(observed)
+	}()
+	select {
+	case <-observed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Observe blocked while usage was being saved")
+	}
+	close(store.release)
+	if err := <-done; err != nil {
+		t.Fatalf("SetUsage: %v", err)
+	}
+}
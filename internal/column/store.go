@@ -0,0 +1,156 @@
+package column
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Store is a persistent storage interface for the column registry.
+type Store interface {
+	ListColumns(ctx context.Context) ([]*Column, error)
+	// SaveMetadata creates or updates a column's metadata and returns the
+	// stored column.
+	SaveMetadata(ctx context.Context, name string, meta Metadata) (*Column, error)
+	// AddStats adds write statistics to columns, and the cells written to
+	// their usage, creating missing ones.
+	AddStats(ctx context.Context, stats map[string]Stats) error
+	// SetUsage replaces the usage of every column with counts as of at,
+	// creating missing columns and zeroing those counts leaves out.
+	SetUsage(ctx context.Context, counts map[string]Usage, at time.Time) error
+}
+
+// PostgresStore implements Store backed by the column_registry table (see
+// storage.RunColumnMigration).
+type PostgresStore struct {
+	pool         *pgxpool.Pool
+	queryTimeout time.Duration
+}
+
+// NewPostgresStore creates a Store using the given connection pool.
+// queryTimeout sets the per-query context deadline; zero means no timeout.
+func NewPostgresStore(pool *pgxpool.Pool, queryTimeout time.Duration) *PostgresStore {
+	return &PostgresStore{pool: pool, queryTimeout: queryTimeout}
+}
+
+func (s *PostgresStore) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.queryTimeout > 0 {
+		return context.WithTimeout(ctx, s.queryTimeout)
+	}
+	return ctx, func() {}
+}
+
+const columnFields = `name, owner, description, schema_ref, keep_versions, writes, written_bytes, last_written_at,
+	stored_cells, stored_bytes, usage_counted_at, created_at, updated_at`
+
+func (s *PostgresStore) ListColumns(ctx context.Context) ([]*Column, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, `SELECT `+columnFields+` FROM column_registry ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("list columns: %w", err)
+	}
+	defer rows.Close()
+
+	var columns []*Column
+	for rows.Next() {
+		c, err := scanColumn(rows)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, c)
+	}
+	return columns, rows.Err()
+}
+
+func (s *PostgresStore) SaveMetadata(ctx context.Context, name string, meta Metadata) (*Column, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	row := s.pool.QueryRow(ctx, `
+		INSERT INTO column_registry (name, owner, description, schema_ref, keep_versions)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (name) DO UPDATE SET
+			owner = EXCLUDED.owner,
+			description = EXCLUDED.description,
+			schema_ref = EXCLUDED.schema_ref,
+			keep_versions = EXCLUDED.keep_versions,
+			updated_at = now()
+		RETURNING `+columnFields,
+		name, meta.Owner, meta.Description, meta.SchemaRef, meta.KeepVersions)
+	c, err := scanColumn(row)
+	if err != nil {
+		return nil, fmt.Errorf("save column: %w", err)
+	}
+	return c, nil
+}
+
+func (s *PostgresStore) AddStats(ctx context.Context, stats map[string]Stats) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	batch := &pgx.Batch{}
+	for name, st := range stats {
+		batch.Queue(`
+			INSERT INTO column_registry (name, writes, written_bytes, last_written_at, stored_cells, stored_bytes)
+			VALUES ($1, $2, $3, $4, $2, $3)
+			ON CONFLICT (name) DO UPDATE SET
+				writes = column_registry.writes + EXCLUDED.writes,
+				written_bytes = column_registry.written_bytes + EXCLUDED.written_bytes,
+				last_written_at = GREATEST(column_registry.last_written_at, EXCLUDED.last_written_at),
+				stored_cells = column_registry.stored_cells + EXCLUDED.stored_cells,
+				stored_bytes = column_registry.stored_bytes + EXCLUDED.stored_bytes
+		`, name, st.Writes, st.Bytes, st.LastWrittenAt)
+	}
+	if err := s.pool.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("add column stats: %w", err)
+	}
+	return nil
+}
+
+// SetUsage zeroes every column's usage and sets that of counted columns in
+// one transaction, so that readers never see a partial count.
+func (s *PostgresStore) SetUsage(ctx context.Context, counts map[string]Usage, at time.Time) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	batch := &pgx.Batch{}
+	batch.Queue(`UPDATE column_registry SET stored_cells = 0, stored_bytes = 0, usage_counted_at = $1`, at)
+	for name, u := range counts {
+		batch.Queue(`
+			INSERT INTO column_registry (name, stored_cells, stored_bytes, usage_counted_at)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (name) DO UPDATE SET
+				stored_cells = EXCLUDED.stored_cells,
+				stored_bytes = EXCLUDED.stored_bytes,
+				usage_counted_at = EXCLUDED.usage_counted_at
+		`, name, u.Cells, u.Bytes, at)
+	}
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		return tx.SendBatch(ctx, batch).Close()
+	})
+	if err != nil {
+		return fmt.Errorf("set column usage: %w", err)
+	}
+	return nil
+}
+
+func scanColumn(row pgx.Row) (*Column, error) {
+	var c Column
+	var lastWrittenAt, countedAt *time.Time
+	if err := row.Scan(&c.Name, &c.Owner, &c.Description, &c.SchemaRef, &c.KeepVersions, &c.Stats.Writes, &c.Stats.Bytes, &lastWrittenAt,
+		&c.Usage.Cells, &c.Usage.Bytes, &countedAt, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("scan column: %w", err)
+	}
+	if lastWrittenAt != nil {
+		c.Stats.LastWrittenAt = *lastWrittenAt
+	}
+	if countedAt != nil {
+		c.Usage.CountedAt = *countedAt
+	}
+	return &c, nil
+}
@@ -0,0 +1,120 @@
+package column
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	topWrites = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "mezzanine",
+			Name:      "column_writes_total",
+			Help:      "Cells written to the columns this instance writes most, while they are among them (see COLUMN_TOP_K).",
+		},
+		[]string{"column"},
+	)
+	topWriteBytes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "mezzanine",
+			Name:      "column_write_bytes_total",
+			Help:      "Body bytes written to the columns this instance writes most, while they are among them (see COLUMN_TOP_K).",
+		},
+		[]string{"column"},
+	)
+)
+
+// DefaultTopK is the number of columns a Registry tracks the throughput of
+// unless SetTopK says otherwise.
+const DefaultTopK = 100
+
+// TopColumn is the write throughput of one of the columns written most.
+type TopColumn struct {
+	Name string `json:"name"`
+	// Cells and Bytes are written since Since. They are estimates: a column
+	// that displaced another inherits its counts, so they may be too high by
+	// up to CellsError and BytesError.
+	Cells      int64     `json:"cells"`
+	Bytes      int64     `json:"bytes"`
+	CellsError int64     `json:"cells_error"`
+	BytesError int64     `json:"bytes_error"`
+	Since      time.Time `json:"since"`
+	// CellsPerSecond and BytesPerSecond average Cells and Bytes since Since.
+	CellsPerSecond float64 `json:"cells_per_second"`
+	BytesPerSecond float64 `json:"bytes_per_second"`
+}
+
+// topK estimates the columns written most with the Space-Saving algorithm:
+// it counts at most capacity columns, and a column not counted yet takes
+// the place of the one with the fewest cells, inheriting its counts. Any
+// column written more than 1/capacity of all cells is sure to be counted,
+// so counters and metric series stay bounded however many columns clients
+// write.
+type topK struct {
+	mu       sync.Mutex
+	capacity int
+	counters map[string]*TopColumn
+}
+
+func newTopK(capacity int) *topK {
+	return &topK{capacity: capacity, counters: make(map[string]*TopColumn, capacity)}
+}
+
+func (t *topK) observe(name string, cells, bytes int, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.counters[name]
+	if !ok {
+		c = &TopColumn{Name: name, Since: at}
+		if len(t.counters) >= t.capacity {
+			var least *TopColumn
+			for _, o := range t.counters {
+				if least == nil || o.Cells < least.Cells {
+					least = o
+				}
+			}
+			delete(t.counters, least.Name)
+			topWrites.DeleteLabelValues(least.Name)
+			topWriteBytes.DeleteLabelValues(least.Name)
+			c.Cells, c.Bytes = least.Cells, least.Bytes
+			c.CellsError, c.BytesError = least.Cells, least.Bytes
+			c.Since = least.Since
+		}
+		t.counters[name] = c
+	}
+	c.Cells += int64(cells)
+	c.Bytes += int64(bytes)
+	topWrites.WithLabelValues(name).Add(float64(cells))
+	topWriteBytes.WithLabelValues(name).Add(float64(bytes))
+}
+
+// top returns up to n counted columns, most cells first.
+func (t *topK) top(n int, now time.Time) []TopColumn {
+	t.mu.Lock()
+	out := make([]TopColumn, 0, len(t.counters))
+	for _, c := range t.counters {
+		out = append(out, *c)
+	}
+	t.mu.Unlock()
+	slices.SortFunc(out, func(a, b TopColumn) int {
+		if c := cmp.Compare(b.Cells, a.Cells); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	for i := range out {
+		if secs := now.Sub(out[i].Since).Seconds(); secs > 0 {
+			out[i].CellsPerSecond = float64(out[i].Cells) / secs
+			out[i].BytesPerSecond = float64(out[i].Bytes) / secs
+		}
+	}
+	return out
+}
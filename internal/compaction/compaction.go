@@ -0,0 +1,243 @@
+// Package compaction garbage-collects superseded versions of cells.
+//
+// A column's policy, column.Metadata.KeepVersions, is how many versions of
+// each row's cell survive once they are superseded; columns without one
+// keep every version. A version is collected once at least KeepVersions
+// newer versions (higher ref_key) of the same row were written more than
+// the safety window ago, and it was itself written before then. The newest
+// version is therefore never collected, and readers of latest versions see
+// no change.
+//
+// Versions that a plugin subscribed to the column may not have received are
+// never collected. A notification that fails after all retries holds the
+// plugin's trigger checkpoint on the shard at the cell's added_id (see
+// trigger.Checkpoint), and the column's cells from there on are kept until
+// the plugin releases it. Notifications still in flight finish well within
+// the safety window, which must outlast the trigger retry budget.
+//
+// Nor are versions that a reader following the shard's history by
+// added_id, such as a replication stream or an export, has yet to read:
+// the shard's cells after the lowest of their positions are kept, whatever
+// their column, until every reader has passed them.
+package compaction
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/ryanbastic/go-mezzanine/internal/column"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+)
+
+var (
+	deletedTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "mezzanine",
+			Name:      "compaction_deleted_cells_total",
+			Help:      "Superseded cell versions deleted by garbage collection.",
+		},
+	)
+	errorsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "mezzanine",
+			Name:      "compaction_errors_total",
+			Help:      "Garbage collection passes over a shard that failed; they are retried next interval.",
+		},
+	)
+)
+
+// Sweep selects the versions of one column that may be collected.
+type Sweep struct {
+	Column string
+	// Keep is the column's KeepVersions policy.
+	Keep int
+	// Cutoff is now minus the safety window: only versions written before
+	// it count as superseding, and only those are collected.
+	Cutoff time.Time
+	// Below excludes cells with added_id at or above it, held back by
+	// trigger checkpoints or Readers; math.MaxInt64 if none are held.
+	Below int64
+	// Rows is the number of rows examined per call.
+	Rows int
+}
+
+// Store deletes collectible versions from shard tables.
+type Store interface {
+	// Sweep deletes the collectible versions of the next s.Rows rows of
+	// shardID that have cells in s.Column, in row_key order after after (nil
+	// to start). It returns the last row examined, nil once there are no
+	// more rows, and the number of versions deleted.
+	Sweep(ctx context.Context, shardID int, s Sweep, after *uuid.UUID) (next *uuid.UUID, deleted int64, err error)
+}
+
+// Readers are the positions of readers that follow shards' history by
+// added_id.
+type Readers interface {
+	// Lowest returns the lowest added_id through which a reader has read
+	// shardID, and false if none follows it.
+	Lowest(ctx context.Context, shardID int) (int64, bool, error)
+}
+
+// Options configures a Compactor.
+type Options struct {
+	// NumShards is the number of shards.
+	NumShards int
+	// SafetyWindow is how long a version must have been superseded before
+	// it is collected (default 24h).
+	SafetyWindow time.Duration
+	// Interval is the time between passes over a shard (default 1h).
+	Interval time.Duration
+	// BatchSize is the number of rows examined per statement (default 1000).
+	BatchSize int
+	// Concurrency bounds the shards collected at once (default 2).
+	Concurrency int
+}
+
+// Compactor garbage-collects shards' superseded versions.
+type Compactor struct {
+	columns     *column.Registry
+	store       Store
+	checkpoints trigger.CheckpointStore
+	readers     []Readers
+	opts        Options
+	sem         chan struct{}
+	logger      *slog.Logger
+	now         func() time.Time
+}
+
+// New returns a compactor applying the policies in columns. checkpoints may
+// be nil when no trigger checkpoints are kept; readers hold back the cells
+// they have yet to read.
+func New(columns *column.Registry, store Store, checkpoints trigger.CheckpointStore, readers []Readers, opts Options, logger *slog.Logger) *Compactor {
+	if opts.SafetyWindow <= 0 {
+		opts.SafetyWindow = 24 * time.Hour
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Hour
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 2
+	}
+	return &Compactor{
+		columns:     columns,
+		store:       store,
+		checkpoints: checkpoints,
+		readers:     readers,
+		opts:        opts,
+		sem:         make(chan struct{}, opts.Concurrency),
+		logger:      logger,
+		now:         time.Now,
+	}
+}
+
+// Run collects every shard until ctx is cancelled. Use it when one instance
+// collects the whole cluster; with shard leases, register RunShard as a
+// lease handler instead.
+func (c *Compactor) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for id := range c.opts.NumShards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.RunShard(ctx, id)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// RunShard collects shardID once per interval until ctx is cancelled. It has
+// the signature of a lease.Handler.
+func (c *Compactor) RunShard(ctx context.Context, shardID int) {
+	for {
+		deleted, err := c.collectShard(ctx, shardID)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			errorsTotal.Inc()
+			c.logger.Warn("garbage collection failed; retrying next interval", "shard_id", shardID, "deleted", deleted, "error", err)
+		case deleted > 0:
+			c.logger.Info("garbage collected superseded versions", "shard_id", shardID, "deleted", deleted)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.opts.Interval):
+		}
+	}
+}
+
+// collectShard makes one pass over shardID's columns that have a policy and
+// returns the number of versions deleted.
+func (c *Compactor) collectShard(ctx context.Context, shardID int) (int64, error) {
+	select {
+	case c.sem <- struct{}{}:
+	case <-ctx.Done():
+		return 0, nil
+	}
+	defer func() { <-c.sem }()
+
+	// Checkpoints are read before the cutoff is taken: one held after this
+	// read is for a cell written at most the retry budget earlier, which is
+	// after the cutoff. Readers' positions only move forward.
+	var checkpoints []trigger.Checkpoint
+	if c.checkpoints != nil {
+		var err error
+		if checkpoints, err = c.checkpoints.ListCheckpoints(ctx); err != nil {
+			return 0, err
+		}
+	}
+	unread := int64(math.MaxInt64)
+	for _, r := range c.readers {
+		pos, ok, err := r.Lowest(ctx, shardID)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			unread = min(unread, pos+1)
+		}
+	}
+	cutoff := c.now().Add(-c.opts.SafetyWindow)
+
+	var total int64
+	for _, col := range c.columns.List() {
+		if col.KeepVersions <= 0 {
+			continue
+		}
+		s := Sweep{Column: col.Name, Keep: col.KeepVersions, Cutoff: cutoff, Below: min(unread, holdFor(checkpoints, shardID, col.Name)), Rows: c.opts.BatchSize}
+		var after *uuid.UUID
+		for {
+			next, deleted, err := c.store.Sweep(ctx, shardID, s, after)
+			total += deleted
+			deletedTotal.Add(float64(deleted))
+			if err != nil {
+				return total, err
+			}
+			if next == nil {
+				break
+			}
+			after = next
+		}
+	}
+	return total, nil
+}
+
+// holdFor returns the lowest added_id held on shardID by a checkpoint of a
+// plugin or internal handler subscribed to columnName, or math.MaxInt64.
+func holdFor(checkpoints []trigger.Checkpoint, shardID int, columnName string) int64 {
+	below := int64(math.MaxInt64)
+	for _, cp := range checkpoints {
+		if cp.ShardID == shardID && cp.Holds(columnName) {
+			below = min(below, cp.AddedID)
+		}
+	}
+	return below
+}
@@ -0,0 +1,157 @@
+package compaction
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/column"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// pagedStore records sweeps and serves pages rows at a time, deleting one
+// version per page.
+type pagedStore struct {
+	pages  int
+	sweeps []Sweep
+	calls  map[string]int
+}
+
+func (s *pagedStore) Sweep(_ context.Context, _ int, sw Sweep, after *uuid.UUID) (*uuid.UUID, int64, error) {
+	if s.calls == nil {
+		s.calls = make(map[string]int)
+	}
+	if (after == nil) != (s.calls[sw.Column] == 0) {
+		return nil, 0, errors.New("cursor not carried between pages")
+	}
+	s.sweeps = append(s.sweeps, sw)
+	s.calls[sw.Column]++
+	if s.calls[sw.Column] > s.pages {
+		return nil, 0, nil
+	}
+	next := uuid.New()
+	return &next, 1, nil
+}
+
+type fixedCheckpoints struct {
+	trigger.CheckpointStore
+	list []trigger.Checkpoint
+	err  error
+}
+
+func (f fixedCheckpoints) ListCheckpoints(context.Context) ([]trigger.Checkpoint, error) {
+	return f.list, f.err
+}
+
+func newRegistry(t *testing.T, policies map[string]int) *column.Registry {
+	t.Helper()
+	r := column.NewRegistry()
+	for name, keep := range policies {
+		if _, err := r.Update(context.Background(), name, column.Metadata{KeepVersions: keep}); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+	}
+	return r
+}
+
+func TestCompactor_SweepsColumnsWithPolicies(t *testing.T) {
+	store := &pagedStore{pages: 2}
+	now := time.Date(2026, 2, 6, 12, 0, 0, 0, time.UTC)
+	c := New(newRegistry(t, map[string]int{"profile": 3, "audit": 0}), store, nil, nil, Options{NumShards: 1, SafetyWindow: time.Hour, BatchSize: 10}, testLogger())
+	c.now = func() time.Time { return now }
+
+	deleted, err := c.collectShard(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("collectShard: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("deleted: got %d, want 2", deleted)
+	}
+	if len(store.sweeps) != 3 {
+		t.Fatalf("got %d sweeps, want 3 (two pages and the end)", len(store.sweeps))
+	}
+	want := Sweep{Column: "profile", Keep: 3, Cutoff: now.Add(-time.Hour), Below: math.MaxInt64, Rows: 10}
+	if store.sweeps[0] != want {
+		t.Errorf("sweep: got %+v, want %+v", store.sweeps[0], want)
+	}
+}
+
+func TestCompactor_HonoursTriggerCheckpoints(t *testing.T) {
+	store := &pagedStore{}
+	checkpoints := fixedCheckpoints{list: []trigger.Checkpoint{
+		{ShardID: 0, AddedID: 50, Columns: []string{"profile"}},
+		{ShardID: 0, AddedID: 20, Columns: []string{"profile", "settings"}},
+		{ShardID: 1, AddedID: 5, Columns: []string{"profile"}},
+		{ShardID: 0, AddedID: 1, Columns: []string{"billing"}},
+	}}
+	c := New(newRegistry(t, map[string]int{"profile": 1, "settings": 1, "notes": 1}), store, checkpoints, nil, Options{NumShards: 2}, testLogger())
+
+	if _, err := c.collectShard(context.Background(), 0); err != nil {
+		t.Fatalf("collectShard: %v", err)
+	}
+	below := make(map[string]int64)
+	for _, sw := range store.sweeps {
+		below[sw.Column] = sw.Below
+	}
+	if below["profile"] != 20 || below["settings"] != 20 || below["notes"] != math.MaxInt64 {
+		t.Errorf("holds: got %v, want profile 20, settings 20, notes unheld", below)
+	}
+}
+
+// fixedReaders holds the readers' positions by shard.
+type fixedReaders map[int]int64
+
+func (f fixedReaders) Lowest(_ context.Context, shardID int) (int64, bool, error) {
+	pos, ok := f[shardID]
+	return pos, ok, nil
+}
+
+func TestCompactor_HonoursReaders(t *testing.T) {
+	store := &pagedStore{}
+	checkpoints := fixedCheckpoints{list: []trigger.Checkpoint{{ShardID: 0, AddedID: 20, Columns: []string{"profile"}}}}
+	replica, export := fixedReaders{0: 40, 1: 5}, fixedReaders{0: 100}
+	c := New(newRegistry(t, map[string]int{"profile": 1, "notes": 1}), store, checkpoints, []Readers{replica, export}, Options{NumShards: 2}, testLogger())
+
+	if _, err := c.collectShard(context.Background(), 0); err != nil {
+		t.Fatalf("collectShard: %v", err)
+	}
+	below := make(map[string]int64)
+	for _, sw := range store.sweeps {
+		below[sw.Column] = sw.Below
+	}
+	// The lagging replica, at 40, holds every column from 41 on; the
+	// trigger checkpoint holds profile lower still.
+	if below["profile"] != 20 || below["notes"] != 41 {
+		t.Errorf("holds: got %v, want profile 20, notes 41", below)
+	}
+
+	store = &pagedStore{}
+	if _, err := New(newRegistry(t, map[string]int{"notes": 1}), store, nil, []Readers{export}, Options{NumShards: 2}, testLogger()).collectShard(context.Background(), 1); err != nil {
+		t.Fatalf("collectShard: %v", err)
+	}
+	if len(store.sweeps) == 0 || store.sweeps[0].Below != math.MaxInt64 {
+		t.Errorf("shard no reader follows: got %+v, want unheld", store.sweeps)
+	}
+}
+
+func TestCompactor_SkipsPassWhenCheckpointsUnavailable(t *testing.T) {
+	store := &pagedStore{}
+	checkpoints := fixedCheckpoints{err: errors.New("metadata database down")}
+	c := New(newRegistry(t, map[string]int{"profile": 1}), store, checkpoints, nil, Options{NumShards: 1}, testLogger())
+
+	if _, err := c.collectShard(context.Background(), 0); err == nil {
+		t.Fatal("collectShard: expected error")
+	}
+	if len(store.sweeps) != 0 {
+		t.Errorf("swept %d times without checkpoints, want 0", len(store.sweeps))
+	}
+}
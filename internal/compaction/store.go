@@ -0,0 +1,79 @@
+package compaction
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// PostgresStore implements Store with a DELETE on the shard tables. Deletes
+// go straight to the database, so read caches may serve collected versions
+// until their entries expire; the latest-cells tables are kept current by
+// their trigger.
+type PostgresStore struct {
+	poolFor      func(shardID int) *pgxpool.Pool
+	queryTimeout time.Duration
+}
+
+// NewPostgresStore creates a Store reaching each shard through the pool
+// poolFor returns. queryTimeout sets the per-query context deadline; zero
+// means no timeout.
+func NewPostgresStore(poolFor func(shardID int) *pgxpool.Pool, queryTimeout time.Duration) *PostgresStore {
+	return &PostgresStore{poolFor: poolFor, queryTimeout: queryTimeout}
+}
+
+func (s *PostgresStore) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.queryTimeout > 0 {
+		return context.WithTimeout(ctx, s.queryTimeout)
+	}
+	return ctx, func() {}
+}
+
+// sweepQuery deletes, among a page of rows, the versions with at least $5
+// newer versions written before the cutoff ($4), that were themselves
+// written before it and are below the trigger hold ($6). It returns the
+// page's last row_key, NULL for an empty page, and the number deleted.
+const sweepQuery = `
+	WITH page AS (
+		SELECT DISTINCT row_key FROM %[1]s
+		WHERE column_name = $1 AND ($2::uuid IS NULL OR row_key > $2)
+		ORDER BY row_key
+		LIMIT $3
+	), versions AS (
+		SELECT c.added_id, c.created_at,
+			count(*) FILTER (WHERE c.created_at < $4) OVER (
+				PARTITION BY c.row_key ORDER BY c.ref_key DESC
+				ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING
+			) AS superseded_by
+		FROM %[1]s c JOIN page USING (row_key)
+		WHERE c.column_name = $1
+	), deleted AS (
+		DELETE FROM %[1]s WHERE added_id IN (
+			SELECT added_id FROM versions
+			WHERE superseded_by >= $5 AND created_at < $4 AND added_id < $6
+		)
+		RETURNING 1
+	)
+	SELECT (SELECT row_key FROM page ORDER BY row_key DESC LIMIT 1), (SELECT count(*) FROM deleted)
+`
+
+func (s *PostgresStore) Sweep(ctx context.Context, shardID int, sw Sweep, after *uuid.UUID) (*uuid.UUID, int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	pool := s.poolFor(shardID)
+	if pool == nil {
+		return nil, 0, fmt.Errorf("no backend for shard %d", shardID)
+	}
+	var next *uuid.UUID
+	var deleted int64
+	q := fmt.Sprintf(sweepQuery, storage.ShardTable(shardID))
+	if err := pool.QueryRow(ctx, q, sw.Column, after, sw.Rows, sw.Cutoff, sw.Keep, sw.Below).Scan(&next, &deleted); err != nil {
+		return nil, 0, fmt.Errorf("sweep shard %d column %s: %w", shardID, sw.Column, err)
+	}
+	return next, deleted, nil
+}
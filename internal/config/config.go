@@ -10,15 +10,94 @@ import (
 type Config struct {
 	ShardConfigPath string
 	IndexConfigPath string
+	ViewConfigPath  string
 	Port            string
-	NumShards   int
-	LogLevel    string
+	NumShards       int
+	LogLevel        string
+
+	// AdminPort serves the admin dashboard and APIs on a separate listener.
+	// Empty disables it; the admin listener has no authentication.
+	AdminPort string
+
+	// MigrateOnStart runs shard/index/plugin migrations when serving. Disable
+	// it when migrations are applied separately (e.g. `mezzanine migrate` in
+	// a Kubernetes init container).
+	MigrateOnStart bool
+
+	// ShardTableCheck verifies on start that every backend holds exactly
+	// the shard tables its range claims, and refuses to start otherwise.
+	ShardTableCheck bool
 
 	// HTTP server timeouts
 	HTTPReadTimeout  time.Duration
 	HTTPWriteTimeout time.Duration
 	HTTPIdleTimeout  time.Duration
 
+	// HTTP server protocol and connection limits. HTTP2Enabled accepts
+	// cleartext HTTP/2 (h2c) next to HTTP/1.1; HTTPMaxConns of 0 is unlimited.
+	HTTP2Enabled       bool
+	HTTPMaxHeaderBytes int
+	HTTPMaxConns       int
+	// HTTPDrainPeriod is how long the server keeps serving after SIGTERM,
+	// failing readiness and closing keep-alive connections, before it stops
+	// accepting requests and waits up to HTTPShutdownTimeout for in-flight ones.
+	HTTPDrainPeriod     time.Duration
+	HTTPShutdownTimeout time.Duration
+
+	// Per-request budgets by endpoint kind (0 disables); when set they
+	// replace DBQueryTimeout for that kind's queries.
+	RequestTimeoutRead  time.Duration
+	RequestTimeoutWrite time.Duration
+	RequestTimeoutScan  time.Duration
+
+	// Page sizes of list endpoints: the limit used when a request has none,
+	// and the largest limit honored.
+	LimitPartitionReadDefault int
+	LimitPartitionReadMax     int
+	LimitWindowReadDefault    int
+	LimitWindowReadMax        int
+	LimitIndexQueryDefault    int
+	LimitIndexQueryMax        int
+	LimitRowListDefault       int
+	LimitRowListMax           int
+	LimitQueryDefault         int
+	LimitQueryMax             int
+
+	// PartitionReadMaxWait bounds how long partitionRead long-polls for new
+	// cells when asked to wait.
+	PartitionReadMaxWait time.Duration
+	// PartitionReadWaitNotify shares shards' heads between instances with
+	// Postgres LISTEN/NOTIFY, so that waiting reads are woken by writes
+	// through any instance (see storage.HeadNotifier).
+	PartitionReadWaitNotify bool
+
+	// Scatter-gather budgets (0 is unlimited): the most shards one multiget,
+	// batchGet or index total reads, and the most cells it returns.
+	ScatterMaxShards int
+	ScatterMaxCells  int
+
+	// Load shedding: in-flight request limits per route class (0 is
+	// unlimited); requests over a limit get 503 with Retry-After.
+	ShedMaxReads   int
+	ShedMaxWrites  int
+	ShedMaxAdmin   int
+	ShedRetryAfter time.Duration
+	// BackendRetryAfter is the least Retry-After of other 503 responses,
+	// such as those for transient database failures; it is jittered up to
+	// double.
+	BackendRetryAfter time.Duration
+
+	// Request bodies. MaxRequestBodyBytes bounds single writes and other
+	// requests; MaxBatchBodyBytes bounds batch writes, multiget and
+	// rows:batchGet. StrictRequestBodies rejects unknown JSON fields.
+	MaxRequestBodyBytes int64
+	MaxBatchBodyBytes   int64
+	StrictRequestBodies bool
+
+	// ServerTiming sends write responses a Server-Timing header breaking
+	// their latency down into store, index and notify phases.
+	ServerTiming bool
+
 	// Database connection pool
 	DBMaxConns          int
 	DBMinConns          int
@@ -26,26 +105,259 @@ type Config struct {
 	DBMaxConnIdleTime   time.Duration
 	DBHealthCheckPeriod time.Duration
 	DBQueryTimeout      time.Duration
+	// DBStatementTimeout and DBIdleInTransactionTimeout are set as
+	// statement_timeout and idle_in_transaction_session_timeout on every
+	// connection of the pools serving requests, so the database ends
+	// runaway queries and abandoned transactions itself; backends may
+	// override them. 0 leaves the database's own setting.
+	DBStatementTimeout         time.Duration
+	DBIdleInTransactionTimeout time.Duration
+	// DBStatementCacheCapacity is pgx's per-connection prepared statement
+	// cache size; 0 sizes it from the shards each backend serves.
+	DBStatementCacheCapacity int
+	// LatestCellsTable keeps a per-shard table of each column's newest
+	// version, maintained by trigger, and serves GetCellLatest/GetRow from it.
+	LatestCellsTable bool
+	// CommitLog keeps a per-shard log of cells in commit order, maintained
+	// by trigger, and serves partitionRead with read_type 3 from it.
+	CommitLog bool
+
+	// Read cache for GetCellLatest/GetRow (see internal/cache). CacheMaxBytes
+	// of 0 disables it; CacheTTL bounds staleness from other instances' writes.
+	// CacheInvalidation broadcasts invalidations between instances through
+	// Postgres LISTEN/NOTIFY. CachePrimeWrites caches written cells so
+	// reads right after a write are hits.
+	CacheMaxBytes     int64
+	CacheTTL          time.Duration
+	CacheInvalidation bool
+	CachePrimeWrites  bool
+
+	// Write coalescing (see internal/coalesce). WriteCoalesceWindow of 0
+	// disables it.
+	WriteCoalesceWindow   time.Duration
+	WriteCoalesceMaxBatch int
 
 	// Trigger framework
 	TriggerRetryMax     int
 	TriggerRetryBackoff time.Duration
 	TriggerRPCTimeout   time.Duration
+	// TriggerSigningSecret, if set, signs plugin notifications with an HMAC
+	// header that pkg/plugin verifies.
+	TriggerSigningSecret string
+	// TriggerWatchdogThreshold is how long a plugin's trigger checkpoint may
+	// stay where it is before the watchdog reports its lane stuck; zero
+	// disables the watchdog. With TriggerWatchdogMaxAttempts set, the
+	// watchdog redelivers stuck lanes itself and skips a cell that fails
+	// that many times.
+	TriggerWatchdogThreshold   time.Duration
+	TriggerWatchdogMaxAttempts int
+	// TriggerPluginRefreshInterval is how often plugins registered or
+	// changed on other instances, such as those the watchdog pauses, are
+	// picked up.
+	TriggerPluginRefreshInterval time.Duration
+	// TriggerSchemaValidation checks notified cell bodies against their
+	// column's latest registered schema: off, warn (log and count) or
+	// enforce (also withhold invalid cells from plugins).
+	TriggerSchemaValidation string
+	// TriggerHostMaxInflight caps the plugin calls in flight to each
+	// endpoint host; zero leaves them unlimited. Calls over the cap wait,
+	// up to TriggerHostMaxQueue per host (zero for no bound), and calls
+	// finding the queue full fail like a network error.
+	TriggerHostMaxInflight int
+	TriggerHostMaxQueue    int
+	// Transport of plugin calls: idle connections kept per host for reuse,
+	// connection timeouts, HTTP/2 over TLS (TriggerHTTP2) or cleartext
+	// (TriggerH2C, which every plugin must accept), and a proxy URL; an
+	// empty TriggerProxyURL uses the HTTP_PROXY environment variables.
+	TriggerMaxIdleConnsPerHost int
+	TriggerIdleConnTimeout     time.Duration
+	TriggerDialTimeout         time.Duration
+	TriggerTLSHandshakeTimeout time.Duration
+	TriggerHTTP2               bool
+	TriggerH2C                 bool
+	TriggerProxyURL            string
+	// TriggerMaxDerivationDepth bounds chains of cells plugins derive from
+	// one another's, counted from a client write.
+	TriggerMaxDerivationDepth int
+	// TriggerSyncTimeout bounds the wait for synchronous plugins to accept
+	// a write.
+	TriggerSyncTimeout time.Duration
+
+	// Secrets integration
+	SecretsRefreshInterval time.Duration
+
+	// ColumnStatsFlushInterval is how often column write statistics are
+	// flushed to the column registry and the registry is reloaded.
+	ColumnStatsFlushInterval time.Duration
+	// ColumnTopK is how many of the columns it writes most each instance
+	// tracks the throughput of; 0 disables tracking.
+	ColumnTopK int
+	// FenceRefreshInterval is how often write fences set on other instances
+	// are picked up (see internal/fence).
+	FenceRefreshInterval time.Duration
+
+	// ShardLeases divides per-shard background work among instances with
+	// leases lasting ShardLeaseTTL (see internal/lease).
+	ShardLeases   bool
+	ShardLeaseTTL time.Duration
 
+	// Shadow writes mirror every stored write to a secondary cluster: another
+	// Mezzanine server at ShadowWritesURL, or the backends of
+	// ShadowShardConfigPath holding ShadowNumShards shards (0 means
+	// NUM_SHARDS). At most ShadowQueueSize writes wait to be mirrored by
+	// ShadowWorkers workers; further ones are dropped.
+	ShadowWritesURL       string
+	ShadowAPIKey          string
+	ShadowShardConfigPath string
+	ShadowNumShards       int
+	ShadowQueueSize       int
+	ShadowWorkers         int
+
+	// Replication copies every shard's cells to the Mezzanine cluster at
+	// ReplicationURL (see internal/replication). ReplicationName keys its
+	// checkpoints.
+	ReplicationURL          string
+	ReplicationAPIKey       string
+	ReplicationName         string
+	ReplicationBatchSize    int
+	ReplicationPollInterval time.Duration
+	ReplicationSettle       time.Duration
+	ReplicationConcurrency  int
+
+	// Export writes every shard's cells as hourly Parquet files to the
+	// bucket at ExportURL, s3://bucket/prefix or gs://bucket/prefix (see
+	// internal/export). ExportName keys its checkpoints. ExportTimeout
+	// bounds each file upload.
+	ExportURL         string
+	ExportName        string
+	ExportBatchSize   int
+	ExportMaxFileRows int
+	ExportSettle      time.Duration
+	ExportConcurrency int
+	ExportTimeout     time.Duration
+
+	// Search indexes the columns listed in the file at SearchConfigPath
+	// into the Elasticsearch or OpenSearch cluster at SearchURL (see
+	// internal/search). SearchName keys its checkpoints.
+	SearchURL          string
+	SearchAPIKey       string
+	SearchConfigPath   string
+	SearchName         string
+	SearchBatchSize    int
+	SearchPollInterval time.Duration
+	SearchSettle       time.Duration
+	SearchConcurrency  int
+
+	// BodyOffload keeps cell bodies longer than BodyOffloadThreshold bytes
+	// in the bucket at BodyOffloadURL, s3://bucket/prefix or
+	// gs://bucket/prefix, and pointers to them in their cells (see
+	// internal/offload). An empty URL stores every body in PostgreSQL.
+	// BodyOffloadTimeout bounds each upload or fetch.
+	BodyOffloadURL       string
+	BodyOffloadThreshold int
+	BodyOffloadTimeout   time.Duration
+
+	// Compaction garbage-collects superseded versions of columns with a
+	// keep_versions policy once they are older than CompactionSafetyWindow
+	// (see internal/compaction).
+	CompactionEnabled      bool
+	CompactionSafetyWindow time.Duration
+	CompactionInterval     time.Duration
+	CompactionBatchSize    int
+
+	// TableHealth watches shard tables' dead tuples and planner statistics
+	// and advises vacuums and analyzes (see internal/tablehealth).
+	TableHealthEnabled        bool
+	TableHealthInterval       time.Duration
+	TableHealthDeadPercent    int
+	TableHealthAnalyzePercent int
+	TableHealthMinRows        int
+	TableHealthAutoAnalyze    bool
+
+	// UsageCount trues up the column registry's storage usage by counting
+	// the shard tables (see internal/accounting).
+	UsageCountEnabled  bool
+	UsageCountInterval time.Duration
+
+	// ShutdownComponentTimeout bounds how long each background component
+	// (see internal/lifecycle) may take to stop.
+	ShutdownComponentTimeout time.Duration
+
+	// APIKeysPath, if set, requires API requests to present a key from this
+	// file (see internal/apikey).
+	APIKeysPath string
+	// MaskHashSecret keys the HMAC of fields hashed by masking policies.
+	MaskHashSecret string
+	// RowACL is off, warn or enforce: whether API keys with a tenant own
+	// the rows they write and are kept from other tenants' rows.
+	RowACL string
+	// RowMetadata records each row's creation time, creating API key and
+	// tenant in its metadata column on first write.
+	RowMetadata bool
+	// RowKeyFormat is uuidv7, ulid or uuidv4: how row keys are generated
+	// for single writes that omit one.
+	RowKeyFormat string
+
+	// FaultConfigPath enables development-only fault injection (see
+	// internal/fault). Never set it in production.
+	FaultConfigPath string
 }
 
 func Load() Config {
 	return Config{
 		ShardConfigPath: getEnvRequired("SHARD_CONFIG_PATH"),
 		IndexConfigPath: getEnv("INDEX_CONFIG_PATH", ""),
+		ViewConfigPath:  getEnv("VIEW_CONFIG_PATH", ""),
 		Port:            getEnv("PORT", "8080"),
 		NumShards:       getEnvInt("NUM_SHARDS", 64),
 		LogLevel:        getEnv("LOG_LEVEL", "info"),
+		AdminPort:       getEnv("ADMIN_PORT", ""),
+		MigrateOnStart:  getEnvBool("MIGRATE_ON_START", true),
+		ShardTableCheck: getEnvBool("SHARD_TABLE_CHECK", true),
 
 		HTTPReadTimeout:  getEnvDuration("HTTP_READ_TIMEOUT", 5*time.Second),
 		HTTPWriteTimeout: getEnvDuration("HTTP_WRITE_TIMEOUT", 10*time.Second),
 		HTTPIdleTimeout:  getEnvDuration("HTTP_IDLE_TIMEOUT", 120*time.Second),
 
+		HTTP2Enabled:        getEnvBool("HTTP2_ENABLED", true),
+		HTTPMaxHeaderBytes:  getEnvInt("HTTP_MAX_HEADER_BYTES", 1<<20),
+		HTTPMaxConns:        getEnvInt("HTTP_MAX_CONNS", 0),
+		HTTPDrainPeriod:     getEnvDuration("HTTP_DRAIN_PERIOD", 5*time.Second),
+		HTTPShutdownTimeout: getEnvDuration("HTTP_SHUTDOWN_TIMEOUT", 10*time.Second),
+
+		RequestTimeoutRead:  getEnvDuration("REQUEST_TIMEOUT_READ", 0),
+		RequestTimeoutWrite: getEnvDuration("REQUEST_TIMEOUT_WRITE", 0),
+		RequestTimeoutScan:  getEnvDuration("REQUEST_TIMEOUT_SCAN", 0),
+
+		LimitPartitionReadDefault: getEnvInt("LIMIT_PARTITION_READ_DEFAULT", 100),
+		LimitPartitionReadMax:     getEnvInt("LIMIT_PARTITION_READ_MAX", 1000),
+		LimitWindowReadDefault:    getEnvInt("LIMIT_WINDOW_READ_DEFAULT", 100),
+		LimitWindowReadMax:        getEnvInt("LIMIT_WINDOW_READ_MAX", 1000),
+		LimitIndexQueryDefault:    getEnvInt("LIMIT_INDEX_QUERY_DEFAULT", 1000),
+		LimitIndexQueryMax:        getEnvInt("LIMIT_INDEX_QUERY_MAX", 10000),
+		LimitRowListDefault:       getEnvInt("LIMIT_ROW_LIST_DEFAULT", 1000),
+		LimitRowListMax:           getEnvInt("LIMIT_ROW_LIST_MAX", 10000),
+		LimitQueryDefault:         getEnvInt("LIMIT_QUERY_DEFAULT", 100),
+		LimitQueryMax:             getEnvInt("LIMIT_QUERY_MAX", 1000),
+		PartitionReadMaxWait:      getEnvDuration("PARTITION_READ_MAX_WAIT", 5*time.Second),
+		PartitionReadWaitNotify:   getEnvBool("PARTITION_READ_WAIT_NOTIFY", true),
+
+		ScatterMaxShards: getEnvInt("SCATTER_MAX_SHARDS", 0),
+		ScatterMaxCells:  getEnvInt("SCATTER_MAX_CELLS", 0),
+
+		ShedMaxReads:   getEnvInt("SHED_MAX_READS", 0),
+		ShedMaxWrites:  getEnvInt("SHED_MAX_WRITES", 0),
+		ShedMaxAdmin:   getEnvInt("SHED_MAX_ADMIN", 0),
+		ShedRetryAfter: getEnvDuration("SHED_RETRY_AFTER", time.Second),
+
+		BackendRetryAfter: getEnvDuration("BACKEND_RETRY_AFTER", time.Second),
+
+		MaxRequestBodyBytes: int64(getEnvInt("MAX_REQUEST_BODY_BYTES", 1<<20)),
+		MaxBatchBodyBytes:   int64(getEnvInt("MAX_BATCH_BODY_BYTES", 16<<20)),
+		StrictRequestBodies: getEnvBool("STRICT_REQUEST_BODIES", true),
+
+		ServerTiming: getEnvBool("SERVER_TIMING", false),
+
 		DBMaxConns:          getEnvInt("DB_MAX_CONNS", 20),
 		DBMinConns:          getEnvInt("DB_MIN_CONNS", 2),
 		DBMaxConnLifetime:   getEnvDuration("DB_MAX_CONN_LIFETIME", 30*time.Minute),
@@ -53,9 +365,111 @@ func Load() Config {
 		DBHealthCheckPeriod: getEnvDuration("DB_HEALTH_CHECK_PERIOD", 30*time.Second),
 		DBQueryTimeout:      getEnvDuration("DB_QUERY_TIMEOUT", 5*time.Second),
 
-		TriggerRetryMax:     getEnvInt("TRIGGER_RETRY_MAX", 3),
-		TriggerRetryBackoff: getEnvDuration("TRIGGER_RETRY_BACKOFF", 100*time.Millisecond),
-		TriggerRPCTimeout:   getEnvDuration("TRIGGER_RPC_TIMEOUT", 5*time.Second),
+		DBStatementTimeout:         getEnvDuration("DB_STATEMENT_TIMEOUT", 0),
+		DBIdleInTransactionTimeout: getEnvDuration("DB_IDLE_IN_TRANSACTION_TIMEOUT", 0),
+
+		DBStatementCacheCapacity: getEnvInt("DB_STATEMENT_CACHE_CAPACITY", 0),
+		LatestCellsTable:         getEnvBool("LATEST_CELLS_TABLE", false),
+		CommitLog:                getEnvBool("COMMIT_LOG", false),
+
+		CacheMaxBytes:     int64(getEnvInt("CACHE_MAX_BYTES", 0)),
+		CacheTTL:          getEnvDuration("CACHE_TTL", time.Second),
+		CacheInvalidation: getEnvBool("CACHE_INVALIDATION", true),
+		CachePrimeWrites:  getEnvBool("CACHE_PRIME_WRITES", false),
+
+		WriteCoalesceWindow:   getEnvDuration("WRITE_COALESCE_WINDOW", 0),
+		WriteCoalesceMaxBatch: getEnvInt("WRITE_COALESCE_MAX_BATCH", 100),
+
+		TriggerRetryMax:      getEnvInt("TRIGGER_RETRY_MAX", 3),
+		TriggerRetryBackoff:  getEnvDuration("TRIGGER_RETRY_BACKOFF", 100*time.Millisecond),
+		TriggerRPCTimeout:    getEnvDuration("TRIGGER_RPC_TIMEOUT", 5*time.Second),
+		TriggerSigningSecret: getEnv("TRIGGER_SIGNING_SECRET", ""),
+
+		TriggerWatchdogThreshold:     getEnvDuration("TRIGGER_WATCHDOG_THRESHOLD", 15*time.Minute),
+		TriggerWatchdogMaxAttempts:   getEnvInt("TRIGGER_WATCHDOG_MAX_ATTEMPTS", 0),
+		TriggerPluginRefreshInterval: getEnvDuration("TRIGGER_PLUGIN_REFRESH_INTERVAL", 5*time.Second),
+		TriggerSchemaValidation:      getEnv("TRIGGER_SCHEMA_VALIDATION", "off"),
+		TriggerHostMaxInflight:       getEnvInt("TRIGGER_HOST_MAX_INFLIGHT", 32),
+		TriggerHostMaxQueue:          getEnvInt("TRIGGER_HOST_MAX_QUEUE", 10000),
+		TriggerMaxIdleConnsPerHost:   getEnvInt("TRIGGER_MAX_IDLE_CONNS_PER_HOST", 64),
+		TriggerIdleConnTimeout:       getEnvDuration("TRIGGER_IDLE_CONN_TIMEOUT", 90*time.Second),
+		TriggerDialTimeout:           getEnvDuration("TRIGGER_DIAL_TIMEOUT", 5*time.Second),
+		TriggerTLSHandshakeTimeout:   getEnvDuration("TRIGGER_TLS_HANDSHAKE_TIMEOUT", 5*time.Second),
+		TriggerHTTP2:                 getEnvBool("TRIGGER_HTTP2", true),
+		TriggerH2C:                   getEnvBool("TRIGGER_H2C", false),
+		TriggerProxyURL:              getEnv("TRIGGER_PROXY_URL", ""),
+		TriggerMaxDerivationDepth:    getEnvInt("TRIGGER_MAX_DERIVATION_DEPTH", 4),
+		TriggerSyncTimeout:           getEnvDuration("TRIGGER_SYNC_TIMEOUT", 2*time.Second),
+
+		SecretsRefreshInterval: getEnvDuration("SECRETS_REFRESH_INTERVAL", 5*time.Minute),
+
+		ColumnStatsFlushInterval: getEnvDuration("COLUMN_STATS_FLUSH_INTERVAL", 10*time.Second),
+		ColumnTopK:               getEnvInt("COLUMN_TOP_K", 100),
+		FenceRefreshInterval:     getEnvDuration("FENCE_REFRESH_INTERVAL", 5*time.Second),
+
+		ShardLeases:   getEnvBool("SHARD_LEASES", false),
+		ShardLeaseTTL: getEnvDuration("SHARD_LEASE_TTL", 15*time.Second),
+
+		ShadowWritesURL:       getEnv("SHADOW_WRITES_URL", ""),
+		ShadowAPIKey:          getEnv("SHADOW_API_KEY", ""),
+		ShadowShardConfigPath: getEnv("SHADOW_SHARD_CONFIG_PATH", ""),
+		ShadowNumShards:       getEnvInt("SHADOW_NUM_SHARDS", 0),
+		ShadowQueueSize:       getEnvInt("SHADOW_QUEUE_SIZE", 10000),
+		ShadowWorkers:         getEnvInt("SHADOW_WORKERS", 4),
+
+		ReplicationURL:          getEnv("REPLICATION_URL", ""),
+		ReplicationAPIKey:       getEnv("REPLICATION_API_KEY", ""),
+		ReplicationName:         getEnv("REPLICATION_NAME", "default"),
+		ReplicationBatchSize:    getEnvInt("REPLICATION_BATCH_SIZE", 100),
+		ReplicationPollInterval: getEnvDuration("REPLICATION_POLL_INTERVAL", time.Second),
+		ReplicationSettle:       getEnvDuration("REPLICATION_SETTLE", 2*time.Second),
+		ReplicationConcurrency:  getEnvInt("REPLICATION_CONCURRENCY", 8),
+
+		ExportURL:         getEnv("EXPORT_URL", ""),
+		ExportName:        getEnv("EXPORT_NAME", "default"),
+		ExportBatchSize:   getEnvInt("EXPORT_BATCH_SIZE", 1000),
+		ExportMaxFileRows: getEnvInt("EXPORT_MAX_FILE_ROWS", 100000),
+		ExportSettle:      getEnvDuration("EXPORT_SETTLE", 5*time.Minute),
+		ExportConcurrency: getEnvInt("EXPORT_CONCURRENCY", 4),
+		ExportTimeout:     getEnvDuration("EXPORT_TIMEOUT", 5*time.Minute),
+
+		SearchURL:          getEnv("SEARCH_URL", ""),
+		SearchAPIKey:       getEnv("SEARCH_API_KEY", ""),
+		SearchConfigPath:   getEnv("SEARCH_CONFIG_PATH", ""),
+		SearchName:         getEnv("SEARCH_NAME", "default"),
+		SearchBatchSize:    getEnvInt("SEARCH_BATCH_SIZE", 500),
+		SearchPollInterval: getEnvDuration("SEARCH_POLL_INTERVAL", time.Second),
+		SearchSettle:       getEnvDuration("SEARCH_SETTLE", 2*time.Second),
+		SearchConcurrency:  getEnvInt("SEARCH_CONCURRENCY", 4),
+
+		BodyOffloadURL:       getEnv("BODY_OFFLOAD_URL", ""),
+		BodyOffloadThreshold: getEnvInt("BODY_OFFLOAD_THRESHOLD", 256<<10),
+		BodyOffloadTimeout:   getEnvDuration("BODY_OFFLOAD_TIMEOUT", 30*time.Second),
+
+		CompactionEnabled:      getEnvBool("COMPACTION_ENABLED", false),
+		CompactionSafetyWindow: getEnvDuration("COMPACTION_SAFETY_WINDOW", 24*time.Hour),
+		CompactionInterval:     getEnvDuration("COMPACTION_INTERVAL", time.Hour),
+		CompactionBatchSize:    getEnvInt("COMPACTION_BATCH_SIZE", 1000),
+
+		TableHealthEnabled:        getEnvBool("TABLE_HEALTH_ENABLED", false),
+		TableHealthInterval:       getEnvDuration("TABLE_HEALTH_INTERVAL", 10*time.Minute),
+		TableHealthDeadPercent:    getEnvInt("TABLE_HEALTH_DEAD_PERCENT", 20),
+		TableHealthAnalyzePercent: getEnvInt("TABLE_HEALTH_ANALYZE_PERCENT", 10),
+		TableHealthMinRows:        getEnvInt("TABLE_HEALTH_MIN_ROWS", 1000),
+		TableHealthAutoAnalyze:    getEnvBool("TABLE_HEALTH_AUTO_ANALYZE", false),
+
+		UsageCountEnabled:  getEnvBool("USAGE_COUNT_ENABLED", false),
+		UsageCountInterval: getEnvDuration("USAGE_COUNT_INTERVAL", 24*time.Hour),
+
+		ShutdownComponentTimeout: getEnvDuration("SHUTDOWN_COMPONENT_TIMEOUT", 5*time.Second),
+
+		APIKeysPath:    getEnv("API_KEYS_PATH", ""),
+		MaskHashSecret: getEnv("MASK_HASH_SECRET", ""),
+		RowACL:         getEnv("ROW_ACL", "off"),
+		RowMetadata:    getEnvBool("ROW_METADATA", false),
+		RowKeyFormat:   getEnv("ROW_KEY_FORMAT", "uuidv7"),
+
+		FaultConfigPath: getEnv("FAULT_CONFIG_PATH", ""),
 	}
 }
 
@@ -86,6 +500,18 @@ func getEnvInt(key string, fallback int) int {
 	return fallback
 }
 
+func getEnvBool(key string, fallback bool) bool {
+	if v := os.Getenv(key); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			slog.Warn("invalid boolean env var, using default", "key", key, "value", v, "error", err)
+			return fallback
+		}
+		return b
+	}
+	return fallback
+}
+
 func getEnvDuration(key string, fallback time.Duration) time.Duration {
 	if v := os.Getenv(key); v != "" {
 		d, err := time.ParseDuration(v)
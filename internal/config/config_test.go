@@ -17,6 +17,35 @@ func TestLoad_Defaults(t *testing.T) {
 		"HTTP_READ_TIMEOUT", "HTTP_WRITE_TIMEOUT", "HTTP_IDLE_TIMEOUT",
 		"DB_MAX_CONNS", "DB_MIN_CONNS", "DB_MAX_CONN_LIFETIME",
 		"DB_MAX_CONN_IDLE_TIME", "DB_HEALTH_CHECK_PERIOD", "DB_QUERY_TIMEOUT",
+		"DB_STATEMENT_TIMEOUT", "DB_IDLE_IN_TRANSACTION_TIMEOUT",
+		"SECRETS_REFRESH_INTERVAL", "MIGRATE_ON_START", "SHARD_TABLE_CHECK", "ADMIN_PORT", "FAULT_CONFIG_PATH",
+		"TRIGGER_SIGNING_SECRET", "TRIGGER_WATCHDOG_THRESHOLD", "TRIGGER_WATCHDOG_MAX_ATTEMPTS", "TRIGGER_PLUGIN_REFRESH_INTERVAL", "TRIGGER_SCHEMA_VALIDATION",
+		"TRIGGER_HOST_MAX_INFLIGHT", "TRIGGER_HOST_MAX_QUEUE", "TRIGGER_MAX_IDLE_CONNS_PER_HOST", "TRIGGER_IDLE_CONN_TIMEOUT",
+		"TRIGGER_DIAL_TIMEOUT", "TRIGGER_TLS_HANDSHAKE_TIMEOUT", "TRIGGER_HTTP2", "TRIGGER_H2C", "TRIGGER_PROXY_URL",
+		"TRIGGER_MAX_DERIVATION_DEPTH", "TRIGGER_SYNC_TIMEOUT",
+		"HTTP2_ENABLED", "HTTP_MAX_HEADER_BYTES", "HTTP_MAX_CONNS",
+		"HTTP_DRAIN_PERIOD", "HTTP_SHUTDOWN_TIMEOUT", "CACHE_MAX_BYTES", "CACHE_TTL",
+		"CACHE_INVALIDATION", "CACHE_PRIME_WRITES", "DB_STATEMENT_CACHE_CAPACITY", "LATEST_CELLS_TABLE", "COMMIT_LOG",
+		"WRITE_COALESCE_WINDOW", "WRITE_COALESCE_MAX_BATCH",
+		"REQUEST_TIMEOUT_READ", "REQUEST_TIMEOUT_WRITE", "REQUEST_TIMEOUT_SCAN",
+		"SHED_MAX_READS", "SHED_MAX_WRITES", "SHED_MAX_ADMIN", "SHED_RETRY_AFTER", "BACKEND_RETRY_AFTER",
+		"LIMIT_PARTITION_READ_DEFAULT", "LIMIT_PARTITION_READ_MAX", "LIMIT_WINDOW_READ_DEFAULT",
+		"LIMIT_WINDOW_READ_MAX", "LIMIT_INDEX_QUERY_DEFAULT", "LIMIT_INDEX_QUERY_MAX",
+		"LIMIT_ROW_LIST_DEFAULT", "LIMIT_ROW_LIST_MAX", "LIMIT_QUERY_DEFAULT", "LIMIT_QUERY_MAX",
+		"PARTITION_READ_MAX_WAIT", "PARTITION_READ_WAIT_NOTIFY", "SCATTER_MAX_SHARDS", "SCATTER_MAX_CELLS",
+		"API_KEYS_PATH", "MASK_HASH_SECRET", "ROW_ACL", "ROW_METADATA", "ROW_KEY_FORMAT", "COLUMN_STATS_FLUSH_INTERVAL", "COLUMN_TOP_K", "FENCE_REFRESH_INTERVAL",
+		"MAX_REQUEST_BODY_BYTES", "MAX_BATCH_BODY_BYTES", "STRICT_REQUEST_BODIES", "SERVER_TIMING",
+		"SHUTDOWN_COMPONENT_TIMEOUT", "SHARD_LEASES", "SHARD_LEASE_TTL",
+		"SHADOW_WRITES_URL", "SHADOW_API_KEY", "SHADOW_SHARD_CONFIG_PATH", "SHADOW_NUM_SHARDS",
+		"SHADOW_QUEUE_SIZE", "SHADOW_WORKERS", "REPLICATION_URL", "REPLICATION_API_KEY",
+		"REPLICATION_NAME", "REPLICATION_BATCH_SIZE", "REPLICATION_POLL_INTERVAL", "REPLICATION_SETTLE",
+		"REPLICATION_CONCURRENCY", "EXPORT_URL", "EXPORT_NAME", "EXPORT_BATCH_SIZE",
+		"EXPORT_MAX_FILE_ROWS", "EXPORT_SETTLE", "EXPORT_CONCURRENCY", "EXPORT_TIMEOUT", "SEARCH_URL", "SEARCH_API_KEY",
+		"SEARCH_CONFIG_PATH", "SEARCH_NAME", "SEARCH_BATCH_SIZE", "SEARCH_POLL_INTERVAL", "SEARCH_SETTLE",
+		"SEARCH_CONCURRENCY", "BODY_OFFLOAD_URL", "BODY_OFFLOAD_THRESHOLD", "BODY_OFFLOAD_TIMEOUT", "COMPACTION_ENABLED",
+		"COMPACTION_SAFETY_WINDOW", "COMPACTION_INTERVAL", "COMPACTION_BATCH_SIZE",
+		"TABLE_HEALTH_ENABLED", "TABLE_HEALTH_INTERVAL", "TABLE_HEALTH_DEAD_PERCENT", "TABLE_HEALTH_ANALYZE_PERCENT",
+		"TABLE_HEALTH_MIN_ROWS", "TABLE_HEALTH_AUTO_ANALYZE", "VIEW_CONFIG_PATH", "USAGE_COUNT_ENABLED", "USAGE_COUNT_INTERVAL",
 	} {
 		os.Unsetenv(k)
 	}
@@ -37,6 +66,18 @@ func TestLoad_Defaults(t *testing.T) {
 	if cfg.IndexConfigPath != "" {
 		t.Errorf("IndexConfigPath: got %q, want empty", cfg.IndexConfigPath)
 	}
+	if cfg.ViewConfigPath != "" {
+		t.Errorf("ViewConfigPath: got %q, want empty", cfg.ViewConfigPath)
+	}
+	if cfg.AdminPort != "" {
+		t.Errorf("AdminPort: got %q, want empty", cfg.AdminPort)
+	}
+	if !cfg.MigrateOnStart {
+		t.Error("MigrateOnStart: got false, want true")
+	}
+	if !cfg.ShardTableCheck {
+		t.Error("ShardTableCheck: got false, want true")
+	}
 
 	// HTTP timeout defaults
 	if cfg.HTTPReadTimeout != 5*time.Second {
@@ -48,6 +89,63 @@ func TestLoad_Defaults(t *testing.T) {
 	if cfg.HTTPIdleTimeout != 120*time.Second {
 		t.Errorf("HTTPIdleTimeout: got %v, want %v", cfg.HTTPIdleTimeout, 120*time.Second)
 	}
+	if !cfg.HTTP2Enabled {
+		t.Error("HTTP2Enabled: got false, want true")
+	}
+	if cfg.HTTPMaxHeaderBytes != 1<<20 {
+		t.Errorf("HTTPMaxHeaderBytes: got %d, want %d", cfg.HTTPMaxHeaderBytes, 1<<20)
+	}
+	if cfg.HTTPMaxConns != 0 {
+		t.Errorf("HTTPMaxConns: got %d, want 0", cfg.HTTPMaxConns)
+	}
+	if cfg.HTTPDrainPeriod != 5*time.Second {
+		t.Errorf("HTTPDrainPeriod: got %v, want %v", cfg.HTTPDrainPeriod, 5*time.Second)
+	}
+	if cfg.HTTPShutdownTimeout != 10*time.Second {
+		t.Errorf("HTTPShutdownTimeout: got %v, want %v", cfg.HTTPShutdownTimeout, 10*time.Second)
+	}
+
+	// Request timeout defaults
+	if cfg.RequestTimeoutRead != 0 || cfg.RequestTimeoutWrite != 0 || cfg.RequestTimeoutScan != 0 {
+		t.Errorf("Request timeouts: got %v/%v/%v, want disabled", cfg.RequestTimeoutRead, cfg.RequestTimeoutWrite, cfg.RequestTimeoutScan)
+	}
+
+	// List limit defaults
+	if cfg.LimitPartitionReadDefault != 100 || cfg.LimitPartitionReadMax != 1000 {
+		t.Errorf("Partition read limits: got %d/%d, want 100/1000", cfg.LimitPartitionReadDefault, cfg.LimitPartitionReadMax)
+	}
+	if cfg.LimitWindowReadDefault != 100 || cfg.LimitWindowReadMax != 1000 {
+		t.Errorf("Window read limits: got %d/%d, want 100/1000", cfg.LimitWindowReadDefault, cfg.LimitWindowReadMax)
+	}
+	if cfg.LimitIndexQueryDefault != 1000 || cfg.LimitIndexQueryMax != 10000 {
+		t.Errorf("Index query limits: got %d/%d, want 1000/10000", cfg.LimitIndexQueryDefault, cfg.LimitIndexQueryMax)
+	}
+	if cfg.LimitRowListDefault != 1000 || cfg.LimitRowListMax != 10000 {
+		t.Errorf("Row list limits: got %d/%d, want 1000/10000", cfg.LimitRowListDefault, cfg.LimitRowListMax)
+	}
+	if cfg.LimitQueryDefault != 100 || cfg.LimitQueryMax != 1000 {
+		t.Errorf("Query limits: got %d/%d, want 100/1000", cfg.LimitQueryDefault, cfg.LimitQueryMax)
+	}
+	if cfg.PartitionReadMaxWait != 5*time.Second {
+		t.Errorf("PartitionReadMaxWait: got %v, want 5s", cfg.PartitionReadMaxWait)
+	}
+	if !cfg.PartitionReadWaitNotify {
+		t.Error("PartitionReadWaitNotify: got false, want true")
+	}
+	if cfg.ScatterMaxShards != 0 || cfg.ScatterMaxCells != 0 {
+		t.Errorf("Scatter limits: got %d/%d, want unlimited", cfg.ScatterMaxShards, cfg.ScatterMaxCells)
+	}
+
+	// Load shedding defaults
+	if cfg.ShedMaxReads != 0 || cfg.ShedMaxWrites != 0 || cfg.ShedMaxAdmin != 0 {
+		t.Errorf("Shed limits: got %d/%d/%d, want unlimited", cfg.ShedMaxReads, cfg.ShedMaxWrites, cfg.ShedMaxAdmin)
+	}
+	if cfg.ShedRetryAfter != time.Second {
+		t.Errorf("ShedRetryAfter: got %v, want %v", cfg.ShedRetryAfter, time.Second)
+	}
+	if cfg.BackendRetryAfter != time.Second {
+		t.Errorf("BackendRetryAfter: got %v, want %v", cfg.BackendRetryAfter, time.Second)
+	}
 
 	// DB pool defaults
 	if cfg.DBMaxConns != 20 {
@@ -68,6 +166,158 @@ func TestLoad_Defaults(t *testing.T) {
 	if cfg.DBQueryTimeout != 5*time.Second {
 		t.Errorf("DBQueryTimeout: got %v, want %v", cfg.DBQueryTimeout, 5*time.Second)
 	}
+	if cfg.DBStatementTimeout != 0 || cfg.DBIdleInTransactionTimeout != 0 {
+		t.Errorf("DBStatementTimeout, DBIdleInTransactionTimeout: got %v, %v, want 0, 0", cfg.DBStatementTimeout, cfg.DBIdleInTransactionTimeout)
+	}
+	if cfg.DBStatementCacheCapacity != 0 {
+		t.Errorf("DBStatementCacheCapacity: got %d, want 0", cfg.DBStatementCacheCapacity)
+	}
+	if cfg.LatestCellsTable {
+		t.Error("LatestCellsTable: got true, want false")
+	}
+	if cfg.CommitLog {
+		t.Error("CommitLog: got true, want false")
+	}
+
+	// Read cache defaults
+	if cfg.CacheMaxBytes != 0 {
+		t.Errorf("CacheMaxBytes: got %d, want 0", cfg.CacheMaxBytes)
+	}
+	if cfg.CacheTTL != time.Second {
+		t.Errorf("CacheTTL: got %v, want %v", cfg.CacheTTL, time.Second)
+	}
+	if !cfg.CacheInvalidation {
+		t.Error("CacheInvalidation: got false, want true")
+	}
+	if cfg.CachePrimeWrites {
+		t.Error("CachePrimeWrites: got true, want false")
+	}
+
+	// Write coalescing defaults
+	if cfg.WriteCoalesceWindow != 0 {
+		t.Errorf("WriteCoalesceWindow: got %v, want 0", cfg.WriteCoalesceWindow)
+	}
+	if cfg.WriteCoalesceMaxBatch != 100 {
+		t.Errorf("WriteCoalesceMaxBatch: got %d, want %d", cfg.WriteCoalesceMaxBatch, 100)
+	}
+
+	// Secrets defaults
+	if cfg.ColumnStatsFlushInterval != 10*time.Second {
+		t.Errorf("ColumnStatsFlushInterval: got %v, want %v", cfg.ColumnStatsFlushInterval, 10*time.Second)
+	}
+	if cfg.ColumnTopK != 100 {
+		t.Errorf("ColumnTopK: got %d, want 100", cfg.ColumnTopK)
+	}
+	if cfg.FenceRefreshInterval != 5*time.Second {
+		t.Errorf("FenceRefreshInterval: got %v, want 5s", cfg.FenceRefreshInterval)
+	}
+	if cfg.MaxRequestBodyBytes != 1<<20 {
+		t.Errorf("MaxRequestBodyBytes: got %d, want %d", cfg.MaxRequestBodyBytes, 1<<20)
+	}
+	if cfg.MaxBatchBodyBytes != 16<<20 {
+		t.Errorf("MaxBatchBodyBytes: got %d, want %d", cfg.MaxBatchBodyBytes, 16<<20)
+	}
+	if !cfg.StrictRequestBodies {
+		t.Error("StrictRequestBodies: got false, want true")
+	}
+	if cfg.ServerTiming {
+		t.Error("ServerTiming: got true, want false")
+	}
+	if cfg.ShardLeases {
+		t.Error("ShardLeases: got true, want false")
+	}
+	if cfg.ShardLeaseTTL != 15*time.Second {
+		t.Errorf("ShardLeaseTTL: got %v, want %v", cfg.ShardLeaseTTL, 15*time.Second)
+	}
+	if cfg.ShadowWritesURL != "" || cfg.ShadowShardConfigPath != "" || cfg.ShadowNumShards != 0 {
+		t.Errorf("shadow writes: got %q, %q, %d; want disabled", cfg.ShadowWritesURL, cfg.ShadowShardConfigPath, cfg.ShadowNumShards)
+	}
+	if cfg.ShadowQueueSize != 10000 || cfg.ShadowWorkers != 4 {
+		t.Errorf("ShadowQueueSize, ShadowWorkers: got %d, %d; want 10000, 4", cfg.ShadowQueueSize, cfg.ShadowWorkers)
+	}
+	if cfg.ReplicationURL != "" || cfg.ReplicationName != "default" {
+		t.Errorf("replication: got URL %q, name %q; want disabled, \"default\"", cfg.ReplicationURL, cfg.ReplicationName)
+	}
+	if cfg.ReplicationBatchSize != 100 || cfg.ReplicationConcurrency != 8 {
+		t.Errorf("ReplicationBatchSize, ReplicationConcurrency: got %d, %d; want 100, 8", cfg.ReplicationBatchSize, cfg.ReplicationConcurrency)
+	}
+	if cfg.ReplicationPollInterval != time.Second || cfg.ReplicationSettle != 2*time.Second {
+		t.Errorf("ReplicationPollInterval, ReplicationSettle: got %v, %v; want 1s, 2s", cfg.ReplicationPollInterval, cfg.ReplicationSettle)
+	}
+	if cfg.ExportURL != "" || cfg.ExportName != "default" || cfg.ExportSettle != 5*time.Minute {
+		t.Errorf("export: got URL %q, name %q, settle %v; want disabled, \"default\", 5m", cfg.ExportURL, cfg.ExportName, cfg.ExportSettle)
+	}
+	if cfg.ExportBatchSize != 1000 || cfg.ExportMaxFileRows != 100000 || cfg.ExportConcurrency != 4 || cfg.ExportTimeout != 5*time.Minute {
+		t.Errorf("ExportBatchSize, ExportMaxFileRows, ExportConcurrency, ExportTimeout: got %d, %d, %d, %v; want 1000, 100000, 4, 5m", cfg.ExportBatchSize, cfg.ExportMaxFileRows, cfg.ExportConcurrency, cfg.ExportTimeout)
+	}
+	if cfg.SearchURL != "" || cfg.SearchConfigPath != "" || cfg.SearchName != "default" {
+		t.Errorf("search: got URL %q, config %q, name %q; want disabled, \"default\"", cfg.SearchURL, cfg.SearchConfigPath, cfg.SearchName)
+	}
+	if cfg.SearchBatchSize != 500 || cfg.SearchPollInterval != time.Second || cfg.SearchSettle != 2*time.Second || cfg.SearchConcurrency != 4 {
+		t.Errorf("Search: got %d, %v, %v, %d; want 500, 1s, 2s, 4", cfg.SearchBatchSize, cfg.SearchPollInterval, cfg.SearchSettle, cfg.SearchConcurrency)
+	}
+	if cfg.BodyOffloadURL != "" || cfg.BodyOffloadThreshold != 256<<10 || cfg.BodyOffloadTimeout != 30*time.Second {
+		t.Errorf("BodyOffload: got URL %q, threshold %d, timeout %v; want disabled, %d, 30s", cfg.BodyOffloadURL, cfg.BodyOffloadThreshold, cfg.BodyOffloadTimeout, 256<<10)
+	}
+	if cfg.CompactionEnabled || cfg.CompactionSafetyWindow != 24*time.Hour || cfg.CompactionInterval != time.Hour || cfg.CompactionBatchSize != 1000 {
+		t.Errorf("Compaction: got %v, %v, %v, %d; want false, 24h, 1h, 1000", cfg.CompactionEnabled, cfg.CompactionSafetyWindow, cfg.CompactionInterval, cfg.CompactionBatchSize)
+	}
+	if cfg.TableHealthEnabled || cfg.TableHealthInterval != 10*time.Minute || cfg.TableHealthDeadPercent != 20 || cfg.TableHealthAnalyzePercent != 10 || cfg.TableHealthMinRows != 1000 || cfg.TableHealthAutoAnalyze {
+		t.Errorf("TableHealth: got %v, %v, %d, %d, %d, %v; want false, 10m, 20, 10, 1000, false", cfg.TableHealthEnabled, cfg.TableHealthInterval, cfg.TableHealthDeadPercent, cfg.TableHealthAnalyzePercent, cfg.TableHealthMinRows, cfg.TableHealthAutoAnalyze)
+	}
+	if cfg.UsageCountEnabled || cfg.UsageCountInterval != 24*time.Hour {
+		t.Errorf("UsageCount: got %v, %v; want false, 24h", cfg.UsageCountEnabled, cfg.UsageCountInterval)
+	}
+	if cfg.ShutdownComponentTimeout != 5*time.Second {
+		t.Errorf("ShutdownComponentTimeout: got %v, want %v", cfg.ShutdownComponentTimeout, 5*time.Second)
+	}
+	if cfg.SecretsRefreshInterval != 5*time.Minute {
+		t.Errorf("SecretsRefreshInterval: got %v, want %v", cfg.SecretsRefreshInterval, 5*time.Minute)
+	}
+
+	if cfg.FaultConfigPath != "" {
+		t.Errorf("FaultConfigPath: got %q, want empty", cfg.FaultConfigPath)
+	}
+	if cfg.APIKeysPath != "" || cfg.MaskHashSecret != "" {
+		t.Errorf("API keys: got %q/%q, want empty", cfg.APIKeysPath, cfg.MaskHashSecret)
+	}
+	if cfg.RowACL != "off" {
+		t.Errorf("RowACL: got %q, want off", cfg.RowACL)
+	}
+	if cfg.RowMetadata {
+		t.Error("RowMetadata: got true, want false")
+	}
+	if cfg.RowKeyFormat != "uuidv7" {
+		t.Errorf("RowKeyFormat: got %q, want uuidv7", cfg.RowKeyFormat)
+	}
+	if cfg.TriggerSigningSecret != "" {
+		t.Errorf("TriggerSigningSecret: got %q, want empty", cfg.TriggerSigningSecret)
+	}
+	if cfg.TriggerWatchdogThreshold != 15*time.Minute || cfg.TriggerWatchdogMaxAttempts != 0 {
+		t.Errorf("TriggerWatchdog: got %v, %d; want 15m, 0", cfg.TriggerWatchdogThreshold, cfg.TriggerWatchdogMaxAttempts)
+	}
+	if cfg.TriggerPluginRefreshInterval != 5*time.Second {
+		t.Errorf("TriggerPluginRefreshInterval: got %v, want 5s", cfg.TriggerPluginRefreshInterval)
+	}
+	if cfg.TriggerSchemaValidation != "off" {
+		t.Errorf("TriggerSchemaValidation: got %q, want off", cfg.TriggerSchemaValidation)
+	}
+	if cfg.TriggerHostMaxInflight != 32 || cfg.TriggerHostMaxQueue != 10000 {
+		t.Errorf("TriggerHostMax: got %d, %d; want 32, 10000", cfg.TriggerHostMaxInflight, cfg.TriggerHostMaxQueue)
+	}
+	if cfg.TriggerMaxIdleConnsPerHost != 64 || cfg.TriggerIdleConnTimeout != 90*time.Second || cfg.TriggerDialTimeout != 5*time.Second || cfg.TriggerTLSHandshakeTimeout != 5*time.Second {
+		t.Errorf("Trigger transport: got %d idle conns, %v idle timeout, %v dial, %v TLS handshake; want 64, 90s, 5s, 5s",
+			cfg.TriggerMaxIdleConnsPerHost, cfg.TriggerIdleConnTimeout, cfg.TriggerDialTimeout, cfg.TriggerTLSHandshakeTimeout)
+	}
+	if !cfg.TriggerHTTP2 || cfg.TriggerH2C || cfg.TriggerProxyURL != "" {
+		t.Errorf("Trigger protocols: got HTTP2 %v, H2C %v, proxy %q; want true, false, none", cfg.TriggerHTTP2, cfg.TriggerH2C, cfg.TriggerProxyURL)
+	}
+	if cfg.TriggerMaxDerivationDepth != 4 {
+		t.Errorf("TriggerMaxDerivationDepth: got %d, want 4", cfg.TriggerMaxDerivationDepth)
+	}
+	if cfg.TriggerSyncTimeout != 2*time.Second {
+		t.Errorf("TriggerSyncTimeout: got %v, want 2s", cfg.TriggerSyncTimeout)
+	}
 }
 
 func TestLoad_CustomValues(t *testing.T) {
@@ -200,6 +450,24 @@ func TestGetEnvInt_Invalid_ReturnsFallback(t *testing.T) {
 	}
 }
 
+func TestGetEnvBool_Valid(t *testing.T) {
+	os.Setenv("TEST_BOOL_KEY", "false")
+	defer os.Unsetenv("TEST_BOOL_KEY")
+
+	if got := getEnvBool("TEST_BOOL_KEY", true); got {
+		t.Errorf("got %v, want false", got)
+	}
+}
+
+func TestGetEnvBool_Invalid_ReturnsFallback(t *testing.T) {
+	os.Setenv("TEST_BOOL_INVALID", "maybe")
+	defer os.Unsetenv("TEST_BOOL_INVALID")
+
+	if got := getEnvBool("TEST_BOOL_INVALID", true); !got {
+		t.Errorf("got %v, want fallback true", got)
+	}
+}
+
 func TestGetEnvDuration_Fallback(t *testing.T) {
 	os.Unsetenv("TEST_DUR_NONEXISTENT")
 	got := getEnvDuration("TEST_DUR_NONEXISTENT", 5*time.Second)
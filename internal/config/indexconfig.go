@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"slices"
 )
 
 // IndexDefinition describes a single secondary index to register at startup.
@@ -13,6 +14,10 @@ type IndexDefinition struct {
 	ShardKeyField string   `json:"shard_key_field"`
 	Fields        []string `json:"fields"`
 	UniqueFields  []string `json:"unique_fields"`
+	// FieldTypes declares the JSON types of fields, "string", "number" or
+	// "boolean"; only number fields can be summed and their minimum and
+	// maximum taken.
+	FieldTypes map[string]string `json:"field_types,omitempty"`
 }
 
 // IndexConfig holds the list of secondary index definitions.
@@ -20,6 +25,9 @@ type IndexConfig struct {
 	Indexes []IndexDefinition `json:"indexes"`
 }
 
+// fieldTypes are the types index fields can be declared.
+var fieldTypes = []string{"string", "number", "boolean"}
+
 // LoadIndexConfig reads a JSON index config file and validates it.
 func LoadIndexConfig(path string) (*IndexConfig, error) {
 	data, err := os.ReadFile(path)
@@ -51,6 +59,14 @@ func LoadIndexConfig(path string) (*IndexConfig, error) {
 		if idx.ShardKeyField == "" {
 			return nil, fmt.Errorf("index config: index %q has empty shard_key_field", idx.Name)
 		}
+		for f, typ := range idx.FieldTypes {
+			if !slices.Contains(idx.Fields, f) {
+				return nil, fmt.Errorf("index config: index %q declares the type of %q, which is not in fields", idx.Name, f)
+			}
+			if !slices.Contains(fieldTypes, typ) {
+				return nil, fmt.Errorf("index config: index %q field %q has type %q (want string, number or boolean)", idx.Name, f, typ)
+			}
+		}
 	}
 
 	return &cfg, nil
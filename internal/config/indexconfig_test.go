@@ -259,3 +259,25 @@ func TestLoadIndexConfig_EmptyFields_Succeeds(t *testing.T) {
 		t.Errorf("got %d fields, want 0", len(ic.Indexes[0].Fields))
 	}
 }
+
+func TestLoadIndexConfig_FieldTypes(t *testing.T) {
+	valid := `{"indexes": [{"name": "order_by_customer", "source_column": "orders", "shard_key_field": "customer_id",
+		"fields": ["total", "status"], "field_types": {"total": "number", "status": "string"}}]}`
+	ic, err := LoadIndexConfig(writeTempIndexConfig(t, valid))
+	if err != nil {
+		t.Fatalf("LoadIndexConfig: %v", err)
+	}
+	if ic.Indexes[0].FieldTypes["total"] != "number" {
+		t.Errorf("field_types: got %v", ic.Indexes[0].FieldTypes)
+	}
+
+	for _, tc := range []struct{ types, want string }{
+		{`{"email": "string"}`, "not in fields"},
+		{`{"total": "decimal"}`, `has type "decimal"`},
+	} {
+		cfg := `{"indexes": [{"name": "o", "source_column": "orders", "shard_key_field": "customer_id", "fields": ["total"], "field_types": ` + tc.types + `}]}`
+		if _, err := LoadIndexConfig(writeTempIndexConfig(t, cfg)); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got %v, want %q", tc.types, err, tc.want)
+		}
+	}
+}
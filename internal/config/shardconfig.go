@@ -4,19 +4,118 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"time"
+
+	mezzanine "github.com/ryanbastic/go-mezzanine/pkg/mezzanine"
 )
 
 // BackendConfig describes a single PostgreSQL backend and its shard range.
+// Either DatabaseURL or Secret must be set; when Secret is set the connection
+// string is fetched from the secrets provider at startup and on rotation.
 type BackendConfig struct {
-	Name        string `json:"name"`
-	DatabaseURL string `json:"database_url"`
-	ShardStart  int    `json:"shard_start"`
-	ShardEnd    int    `json:"shard_end"`
+	Name        string        `json:"name"`
+	DatabaseURL string        `json:"database_url"`
+	Secret      *SecretConfig `json:"secret,omitempty"`
+	ShardStart  int           `json:"shard_start"`
+	ShardEnd    int           `json:"shard_end"`
+	SessionTimeouts
+}
+
+// SessionTimeouts override DB_STATEMENT_TIMEOUT and
+// DB_IDLE_IN_TRANSACTION_TIMEOUT for one database; unset fields use them.
+type SessionTimeouts struct {
+	StatementTimeout         *Duration `json:"statement_timeout,omitempty"`
+	IdleInTransactionTimeout *Duration `json:"idle_in_transaction_timeout,omitempty"`
+}
+
+// Resolve returns the statement and idle-in-transaction timeouts of a
+// database under cfg.
+func (t SessionTimeouts) Resolve(cfg Config) (statement, idleInTransaction time.Duration) {
+	statement, idleInTransaction = cfg.DBStatementTimeout, cfg.DBIdleInTransactionTimeout
+	if t.StatementTimeout != nil {
+		statement = time.Duration(*t.StatementTimeout)
+	}
+	if t.IdleInTransactionTimeout != nil {
+		idleInTransaction = time.Duration(*t.IdleInTransactionTimeout)
+	}
+	return statement, idleInTransaction
+}
+
+func (t SessionTimeouts) validate() error {
+	if t.StatementTimeout != nil && *t.StatementTimeout < 0 {
+		return fmt.Errorf("negative statement_timeout")
+	}
+	if t.IdleInTransactionTimeout != nil && *t.IdleInTransactionTimeout < 0 {
+		return fmt.Errorf("negative idle_in_transaction_timeout")
+	}
+	return nil
+}
+
+// Duration is a time.Duration that unmarshals from a string like "30s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string: %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// SecretConfig locates a backend's database URL in an external secrets manager.
+type SecretConfig struct {
+	Provider string `json:"provider"`         // "vault" or "aws"
+	Path     string `json:"path"`             // Vault KV path or AWS secret ID/ARN
+	Key      string `json:"key,omitempty"`    // field within the secret holding the URL; empty means the whole value
+	Region   string `json:"region,omitempty"` // AWS region; defaults to AWS_REGION
+}
+
+// Secret providers supported by SecretConfig.Provider.
+const (
+	SecretProviderVault = "vault"
+	SecretProviderAWS   = "aws"
+)
+
+// MetadataBackend is the pool name of the metadata database. No backend may
+// use it when a metadata database is configured.
+const MetadataBackend = "metadata"
+
+// MetadataConfig locates a dedicated database for the cluster-wide tables:
+// plugins, the column registry and shard leases. Without one they live on
+// the first backend, whose loss then also stops plugin management. Either
+// DatabaseURL or Secret must be set, as for a backend.
+type MetadataConfig struct {
+	DatabaseURL string        `json:"database_url"`
+	Secret      *SecretConfig `json:"secret,omitempty"`
+	SessionTimeouts
+}
+
+// Backend returns the metadata database as a backend with no shards of its
+// own, named MetadataBackend.
+func (m *MetadataConfig) Backend() BackendConfig {
+	return BackendConfig{Name: MetadataBackend, DatabaseURL: m.DatabaseURL, Secret: m.Secret, SessionTimeouts: m.SessionTimeouts}
 }
 
-// ShardConfig holds the list of backends that together cover all shards.
+// ShardConfig holds the list of backends that together cover all shards,
+// optionally the metadata database, and the hash that places keys on
+// shards.
 type ShardConfig struct {
 	Backends []BackendConfig `json:"backends"`
+	Metadata *MetadataConfig `json:"metadata,omitempty"`
+	// Hash is the function, version and seed keys are hashed to shards
+	// with; unset is FNV-1a version 1. Data stays where its hash placed
+	// it, so changing the hash of a cluster that holds data needs a
+	// reshard onto a new shard config.
+	Hash mezzanine.ShardHash `json:"hash,omitzero"`
 }
 
 // LoadShardConfig reads a JSON shard config file and validates it against numShards.
@@ -35,12 +134,45 @@ func LoadShardConfig(path string, numShards int) (*ShardConfig, error) {
 		return nil, fmt.Errorf("shard config: no backends defined")
 	}
 
+	if err := cfg.Hash.Validate(); err != nil {
+		return nil, fmt.Errorf("shard config: hash: %w", err)
+	}
+
+	if m := cfg.Metadata; m != nil {
+		if m.Secret != nil {
+			if m.DatabaseURL != "" {
+				return nil, fmt.Errorf("shard config: metadata sets both database_url and secret")
+			}
+			if err := validateSecret(m.Secret); err != nil {
+				return nil, fmt.Errorf("shard config: metadata: %w", err)
+			}
+		} else if m.DatabaseURL == "" {
+			return nil, fmt.Errorf("shard config: metadata has empty database_url")
+		}
+		if err := m.SessionTimeouts.validate(); err != nil {
+			return nil, fmt.Errorf("shard config: metadata: %w", err)
+		}
+	}
+
 	covered := make([]bool, numShards)
 
 	for i, b := range cfg.Backends {
-		if b.DatabaseURL == "" {
+		if cfg.Metadata != nil && b.Name == MetadataBackend {
+			return nil, fmt.Errorf("shard config: backend name %q is reserved for the metadata database", b.Name)
+		}
+		if b.Secret != nil {
+			if b.DatabaseURL != "" {
+				return nil, fmt.Errorf("shard config: backend %q sets both database_url and secret", b.Name)
+			}
+			if err := validateSecret(b.Secret); err != nil {
+				return nil, fmt.Errorf("shard config: backend %q: %w", b.Name, err)
+			}
+		} else if b.DatabaseURL == "" {
 			return nil, fmt.Errorf("shard config: backend %q (#%d) has empty database_url", b.Name, i)
 		}
+		if err := b.SessionTimeouts.validate(); err != nil {
+			return nil, fmt.Errorf("shard config: backend %q: %w", b.Name, err)
+		}
 		if b.ShardStart < 0 || b.ShardEnd < 0 {
 			return nil, fmt.Errorf("shard config: backend %q has negative shard range", b.Name)
 		}
@@ -66,3 +198,25 @@ func LoadShardConfig(path string, numShards int) (*ShardConfig, error) {
 
 	return &cfg, nil
 }
+
+func validateSecret(s *SecretConfig) error {
+	switch s.Provider {
+	case SecretProviderVault, SecretProviderAWS:
+	default:
+		return fmt.Errorf("unknown secret provider %q", s.Provider)
+	}
+	if s.Path == "" {
+		return fmt.Errorf("secret has empty path")
+	}
+	return nil
+}
+
+// BackendFor returns the name of the backend owning shardID, or "" if none.
+func (c *ShardConfig) BackendFor(shardID int) string {
+	for _, b := range c.Backends {
+		if shardID >= b.ShardStart && shardID <= b.ShardEnd {
+			return b.Name
+		}
+	}
+	return ""
+}
@@ -5,6 +5,9 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	mezzanine "github.com/ryanbastic/go-mezzanine/pkg/mezzanine"
 )
 
 func writeTempConfig(t *testing.T, content string) string {
@@ -297,3 +300,177 @@ func TestBackendConfig_Fields(t *testing.T) {
 		t.Errorf("ShardEnd: got %d", b.ShardEnd)
 	}
 }
+
+func TestLoadShardConfig_SecretBackend(t *testing.T) {
+	cfg := `{
+		"backends": [{
+			"name": "vaulted",
+			"secret": {"provider": "vault", "path": "secret/data/mezzanine/db1", "key": "url"},
+			"shard_start": 0,
+			"shard_end": 3
+		}]
+	}`
+	path := writeTempConfig(t, cfg)
+
+	sc, err := LoadShardConfig(path, 4)
+	if err != nil {
+		t.Fatalf("LoadShardConfig: %v", err)
+	}
+	s := sc.Backends[0].Secret
+	if s == nil {
+		t.Fatal("Secret: got nil")
+	}
+	if s.Provider != SecretProviderVault || s.Path != "secret/data/mezzanine/db1" || s.Key != "url" {
+		t.Errorf("Secret: got %+v", *s)
+	}
+}
+
+func TestLoadShardConfig_SecretErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend string
+		wantErr string
+	}{
+		{
+			name:    "unknown provider",
+			backend: `"secret": {"provider": "gcp", "path": "x"}`,
+			wantErr: "unknown secret provider",
+		},
+		{
+			name:    "empty path",
+			backend: `"secret": {"provider": "aws"}`,
+			wantErr: "empty path",
+		},
+		{
+			name:    "both url and secret",
+			backend: `"database_url": "postgres://a/db", "secret": {"provider": "aws", "path": "x"}`,
+			wantErr: "both database_url and secret",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := `{"backends": [{"name": "b", ` + tt.backend + `, "shard_start": 0, "shard_end": 3}]}`
+			path := writeTempConfig(t, cfg)
+
+			_, err := LoadShardConfig(path, 4)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadShardConfig_Metadata(t *testing.T) {
+	path := writeTempConfig(t, `{
+		"backends": [{"name": "a", "database_url": "postgres://a/db", "shard_start": 0, "shard_end": 3}],
+		"metadata": {"database_url": "postgres://meta/db"}
+	}`)
+
+	sc, err := LoadShardConfig(path, 4)
+	if err != nil {
+		t.Fatalf("LoadShardConfig: %v", err)
+	}
+	if sc.Metadata == nil {
+		t.Fatal("Metadata: got nil")
+	}
+	b := sc.Metadata.Backend()
+	if b.Name != MetadataBackend || b.DatabaseURL != "postgres://meta/db" {
+		t.Errorf("Backend: got %+v", b)
+	}
+}
+
+func TestLoadShardConfig_Hash(t *testing.T) {
+	backends := `"backends": [{"name": "a", "database_url": "postgres://a/db", "shard_start": 0, "shard_end": 3}]`
+	sc, err := LoadShardConfig(writeTempConfig(t, `{`+backends+`, "hash": {"function": "murmur3", "version": 1, "seed": 42}}`), 4)
+	if err != nil {
+		t.Fatalf("LoadShardConfig: %v", err)
+	}
+	if want := (mezzanine.ShardHash{Function: "murmur3", Version: 1, Seed: 42}); sc.Hash != want {
+		t.Errorf("Hash: got %+v, want %+v", sc.Hash, want)
+	}
+
+	sc, err = LoadShardConfig(writeTempConfig(t, `{`+backends+`}`), 4)
+	if err != nil || sc.Hash != (mezzanine.ShardHash{}) {
+		t.Errorf("unset hash: got %+v, %v, want the default", sc.Hash, err)
+	}
+
+	_, err = LoadShardConfig(writeTempConfig(t, `{`+backends+`, "hash": {"function": "xxhash", "version": 2}}`), 4)
+	if err == nil || !strings.Contains(err.Error(), "unknown version 2") {
+		t.Errorf("unknown version: got %v", err)
+	}
+}
+
+func TestLoadShardConfig_MetadataErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		backend  string
+		metadata string
+		wantErr  string
+	}{
+		{"empty url", "a", `{}`, "metadata has empty database_url"},
+		{"bad secret", "a", `{"secret": {"provider": "gcp", "path": "x"}}`, "unknown secret provider"},
+		{"both url and secret", "a", `{"database_url": "postgres://m/db", "secret": {"provider": "aws", "path": "x"}}`, "both database_url and secret"},
+		{"reserved name", "metadata", `{"database_url": "postgres://m/db"}`, "reserved for the metadata database"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := `{"backends": [{"name": "` + tt.backend + `", "database_url": "postgres://a/db", "shard_start": 0, "shard_end": 3}], "metadata": ` + tt.metadata + `}`
+			_, err := LoadShardConfig(writeTempConfig(t, cfg), 4)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadShardConfig_SessionTimeouts(t *testing.T) {
+	path := writeTempConfig(t, `{
+		"backends": [
+			{"name": "a", "database_url": "postgres://a/db", "shard_start": 0, "shard_end": 1, "statement_timeout": "30s"},
+			{"name": "b", "database_url": "postgres://b/db", "shard_start": 2, "shard_end": 3, "statement_timeout": "0s", "idle_in_transaction_timeout": "1m"}
+		],
+		"metadata": {"database_url": "postgres://meta/db", "idle_in_transaction_timeout": "5m"}
+	}`)
+	sc, err := LoadShardConfig(path, 4)
+	if err != nil {
+		t.Fatalf("LoadShardConfig: %v", err)
+	}
+	env := Config{DBStatementTimeout: 10 * time.Second, DBIdleInTransactionTimeout: 20 * time.Second}
+	for _, tt := range []struct {
+		b                       BackendConfig
+		wantStatement, wantIdle time.Duration
+	}{
+		{sc.Backends[0], 30 * time.Second, 20 * time.Second},
+		{sc.Backends[1], 0, time.Minute},
+		{sc.Metadata.Backend(), 10 * time.Second, 5 * time.Minute},
+	} {
+		if statement, idle := tt.b.SessionTimeouts.Resolve(env); statement != tt.wantStatement || idle != tt.wantIdle {
+			t.Errorf("%s: got %v, %v, want %v, %v", tt.b.Name, statement, idle, tt.wantStatement, tt.wantIdle)
+		}
+	}
+
+	for _, bad := range []string{`"statement_timeout": "soon"`, `"statement_timeout": 30`, `"idle_in_transaction_timeout": "-1s"`} {
+		cfg := `{"backends": [{"name": "a", "database_url": "postgres://a/db", "shard_start": 0, "shard_end": 3, ` + bad + `}]}`
+		if _, err := LoadShardConfig(writeTempConfig(t, cfg), 4); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+}
+
+func TestShardConfig_BackendFor(t *testing.T) {
+	cfg := &ShardConfig{Backends: []BackendConfig{
+		{Name: "a", ShardStart: 0, ShardEnd: 3},
+		{Name: "b", ShardStart: 4, ShardEnd: 7},
+	}}
+	for shardID, want := range map[int]string{0: "a", 3: "a", 4: "b", 7: "b", 8: ""} {
+		if got := cfg.BackendFor(shardID); got != want {
+			t.Errorf("BackendFor(%d): got %q, want %q", shardID, got, want)
+		}
+	}
+}
@@ -0,0 +1,451 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Severity classifies a validation finding.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Finding is a single problem discovered while validating configuration.
+type Finding struct {
+	Severity Severity
+	Source   string // "env", "shards", "indexes", or a backend name for online checks
+	Message  string
+}
+
+// Report collects findings across all configuration sources. Unlike the
+// Load* functions, which stop at the first problem, validation keeps going
+// so a single run surfaces everything that needs fixing.
+type Report struct {
+	Findings []Finding
+}
+
+// Errorf records an error finding.
+func (r *Report) Errorf(source, format string, args ...any) {
+	r.Findings = append(r.Findings, Finding{Severity: SeverityError, Source: source, Message: fmt.Sprintf(format, args...)})
+}
+
+// Warnf records a warning finding.
+func (r *Report) Warnf(source, format string, args ...any) {
+	r.Findings = append(r.Findings, Finding{Severity: SeverityWarning, Source: source, Message: fmt.Sprintf(format, args...)})
+}
+
+// HasErrors reports whether any error-level findings were recorded.
+func (r *Report) HasErrors() bool {
+	for _, f := range r.Findings {
+		if f.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Write prints a human-readable summary of the report.
+func (r *Report) Write(w io.Writer) {
+	var errs, warns int
+	for _, f := range r.Findings {
+		if f.Severity == SeverityError {
+			errs++
+		} else {
+			warns++
+		}
+		fmt.Fprintf(w, "%-7s [%s] %s\n", strings.ToUpper(string(f.Severity)), f.Source, f.Message)
+	}
+	if len(r.Findings) > 0 {
+		fmt.Fprintln(w)
+	}
+	if errs == 0 {
+		fmt.Fprintf(w, "OK: configuration is valid (%d warnings)\n", warns)
+		return
+	}
+	fmt.Fprintf(w, "FAILED: %d errors, %d warnings\n", errs, warns)
+}
+
+// identifierPattern restricts names that end up in table names or SQL
+// expressions (index names, JSON field names used in unique indexes).
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// maxIdentifierLen is PostgreSQL's NAMEDATALEN - 1.
+const maxIdentifierLen = 63
+
+// ValidateEnv checks values loaded from the environment for consistency.
+func (r *Report) ValidateEnv(cfg Config) {
+	const src = "env"
+	if cfg.NumShards <= 0 {
+		r.Errorf(src, "NUM_SHARDS must be positive, got %d", cfg.NumShards)
+	}
+	if port, err := strconv.Atoi(cfg.Port); err != nil || port <= 0 || port > 65535 {
+		r.Errorf(src, "PORT %q is not a valid TCP port", cfg.Port)
+	}
+	switch cfg.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		r.Warnf(src, "LOG_LEVEL %q is not recognised, info will be used", cfg.LogLevel)
+	}
+	if cfg.DBMaxConns <= 0 {
+		r.Errorf(src, "DB_MAX_CONNS must be positive, got %d", cfg.DBMaxConns)
+	}
+	if cfg.DBMinConns < 0 || cfg.DBMinConns > cfg.DBMaxConns {
+		r.Errorf(src, "DB_MIN_CONNS (%d) must be between 0 and DB_MAX_CONNS (%d)", cfg.DBMinConns, cfg.DBMaxConns)
+	}
+	if cfg.DBQueryTimeout == 0 {
+		r.Warnf(src, "DB_QUERY_TIMEOUT is 0; queries will run without a deadline")
+	}
+	if cfg.HTTPWriteTimeout > 0 && cfg.DBQueryTimeout > cfg.HTTPWriteTimeout {
+		r.Warnf(src, "DB_QUERY_TIMEOUT (%s) exceeds HTTP_WRITE_TIMEOUT (%s)", cfg.DBQueryTimeout, cfg.HTTPWriteTimeout)
+	}
+	if cfg.DBStatementTimeout < 0 {
+		r.Errorf(src, "DB_STATEMENT_TIMEOUT must not be negative, got %s", cfg.DBStatementTimeout)
+	} else if cfg.DBStatementTimeout > 0 && cfg.DBStatementTimeout < cfg.DBQueryTimeout {
+		r.Warnf(src, "DB_STATEMENT_TIMEOUT (%s) is below DB_QUERY_TIMEOUT (%s); the database will cancel queries the server still waits for", cfg.DBStatementTimeout, cfg.DBQueryTimeout)
+	}
+	if cfg.DBIdleInTransactionTimeout < 0 {
+		r.Errorf(src, "DB_IDLE_IN_TRANSACTION_TIMEOUT must not be negative, got %s", cfg.DBIdleInTransactionTimeout)
+	}
+	if cfg.TriggerRetryMax < 0 {
+		r.Errorf(src, "TRIGGER_RETRY_MAX must not be negative, got %d", cfg.TriggerRetryMax)
+	}
+	if cfg.TriggerWatchdogMaxAttempts < 0 {
+		r.Errorf(src, "TRIGGER_WATCHDOG_MAX_ATTEMPTS must not be negative, got %d", cfg.TriggerWatchdogMaxAttempts)
+	}
+	if cfg.TriggerPluginRefreshInterval <= 0 {
+		r.Errorf(src, "TRIGGER_PLUGIN_REFRESH_INTERVAL must be positive, got %s", cfg.TriggerPluginRefreshInterval)
+	}
+	if cfg.TriggerMaxDerivationDepth < 1 {
+		r.Errorf(src, "TRIGGER_MAX_DERIVATION_DEPTH must be at least 1, got %d", cfg.TriggerMaxDerivationDepth)
+	}
+	if cfg.TriggerSyncTimeout <= 0 {
+		r.Errorf(src, "TRIGGER_SYNC_TIMEOUT must be positive, got %s", cfg.TriggerSyncTimeout)
+	} else if cfg.HTTPWriteTimeout > 0 && cfg.TriggerSyncTimeout >= cfg.HTTPWriteTimeout {
+		r.Warnf(src, "TRIGGER_SYNC_TIMEOUT (%s) is not below HTTP_WRITE_TIMEOUT (%s); writes waiting on synchronous plugins may be cut off", cfg.TriggerSyncTimeout, cfg.HTTPWriteTimeout)
+	}
+	if cfg.TriggerHostMaxInflight < 0 {
+		r.Errorf(src, "TRIGGER_HOST_MAX_INFLIGHT must not be negative, got %d", cfg.TriggerHostMaxInflight)
+	}
+	if cfg.TriggerHostMaxQueue < 0 {
+		r.Errorf(src, "TRIGGER_HOST_MAX_QUEUE must not be negative, got %d", cfg.TriggerHostMaxQueue)
+	}
+	switch cfg.TriggerSchemaValidation {
+	case "off", "warn", "enforce":
+	default:
+		r.Errorf(src, "TRIGGER_SCHEMA_VALIDATION must be off, warn or enforce, got %q", cfg.TriggerSchemaValidation)
+	}
+	switch cfg.RowACL {
+	case "off":
+	case "warn", "enforce":
+		if cfg.APIKeysPath == "" {
+			r.Warnf(src, "ROW_ACL is %s but API_KEYS_PATH is not set; no request has a tenant", cfg.RowACL)
+		}
+	default:
+		r.Errorf(src, "ROW_ACL must be off, warn or enforce, got %q", cfg.RowACL)
+	}
+	if cfg.ColumnStatsFlushInterval <= 0 {
+		r.Errorf(src, "COLUMN_STATS_FLUSH_INTERVAL must be positive, got %s", cfg.ColumnStatsFlushInterval)
+	}
+	if cfg.FenceRefreshInterval <= 0 {
+		r.Errorf(src, "FENCE_REFRESH_INTERVAL must be positive, got %s", cfg.FenceRefreshInterval)
+	}
+	if cfg.ShadowWritesURL != "" && cfg.ShadowShardConfigPath != "" {
+		r.Errorf(src, "SHADOW_WRITES_URL and SHADOW_SHARD_CONFIG_PATH are mutually exclusive")
+	}
+	for _, v := range []struct{ name, value string }{
+		{"SHADOW_WRITES_URL", cfg.ShadowWritesURL},
+		{"REPLICATION_URL", cfg.ReplicationURL},
+	} {
+		if v.value == "" {
+			continue
+		}
+		if u, err := url.Parse(v.value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			r.Errorf(src, "%s %q is not an http or https URL", v.name, v.value)
+		}
+	}
+	if cfg.TriggerProxyURL != "" {
+		if u, err := url.Parse(cfg.TriggerProxyURL); err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") || u.Host == "" {
+			r.Errorf(src, "TRIGGER_PROXY_URL %q is not an http, https or socks5 URL", cfg.TriggerProxyURL)
+		}
+	}
+	if cfg.TriggerH2C && !cfg.TriggerHTTP2 {
+		r.Warnf(src, "TRIGGER_H2C is ignored with TRIGGER_HTTP2=false")
+	}
+	if cfg.TriggerHostMaxInflight > cfg.TriggerMaxIdleConnsPerHost && !cfg.TriggerH2C {
+		r.Warnf(src, "TRIGGER_MAX_IDLE_CONNS_PER_HOST (%d) is below TRIGGER_HOST_MAX_INFLIGHT (%d); connections opened in bursts will be closed rather than reused", cfg.TriggerMaxIdleConnsPerHost, cfg.TriggerHostMaxInflight)
+	}
+	if cfg.ExportURL != "" {
+		if u, err := url.Parse(cfg.ExportURL); err != nil || (u.Scheme != "s3" && u.Scheme != "gs") || u.Host == "" {
+			r.Errorf(src, "EXPORT_URL %q is not an s3:// or gs:// bucket URL", cfg.ExportURL)
+		}
+		if cfg.ExportTimeout <= 0 {
+			r.Errorf(src, "EXPORT_TIMEOUT must be positive, got %v", cfg.ExportTimeout)
+		}
+	}
+	if cfg.BodyOffloadURL != "" {
+		if u, err := url.Parse(cfg.BodyOffloadURL); err != nil || (u.Scheme != "s3" && u.Scheme != "gs") || u.Host == "" {
+			r.Errorf(src, "BODY_OFFLOAD_URL %q is not an s3:// or gs:// bucket URL", cfg.BodyOffloadURL)
+		}
+		if cfg.BodyOffloadThreshold <= 0 {
+			r.Errorf(src, "BODY_OFFLOAD_THRESHOLD must be positive, got %d", cfg.BodyOffloadThreshold)
+		} else if limit := max(cfg.MaxRequestBodyBytes, cfg.MaxBatchBodyBytes); int64(cfg.BodyOffloadThreshold) >= limit {
+			r.Warnf(src, "BODY_OFFLOAD_THRESHOLD (%d) is not below the request body limits (%d); no body will be offloaded", cfg.BodyOffloadThreshold, limit)
+		}
+		if cfg.BodyOffloadTimeout <= 0 {
+			r.Errorf(src, "BODY_OFFLOAD_TIMEOUT must be positive, got %v", cfg.BodyOffloadTimeout)
+		}
+	}
+	if cfg.CompactionEnabled {
+		// Versions are only protected by the safety window until a failed
+		// notification holds a trigger checkpoint.
+		if budget := triggerDeliveryBudget(cfg); cfg.CompactionSafetyWindow <= budget {
+			r.Errorf(src, "COMPACTION_SAFETY_WINDOW (%s) must exceed the trigger delivery budget (%s) set by TRIGGER_RETRY_MAX, TRIGGER_RETRY_BACKOFF and TRIGGER_RPC_TIMEOUT", cfg.CompactionSafetyWindow, budget)
+		}
+		if cfg.CompactionBatchSize <= 0 {
+			r.Errorf(src, "COMPACTION_BATCH_SIZE must be positive, got %d", cfg.CompactionBatchSize)
+		}
+	}
+	if cfg.TableHealthEnabled {
+		if cfg.TableHealthDeadPercent <= 0 || cfg.TableHealthDeadPercent > 100 {
+			r.Errorf(src, "TABLE_HEALTH_DEAD_PERCENT must be between 1 and 100, got %d", cfg.TableHealthDeadPercent)
+		}
+		if cfg.TableHealthAnalyzePercent <= 0 {
+			r.Errorf(src, "TABLE_HEALTH_ANALYZE_PERCENT must be positive, got %d", cfg.TableHealthAnalyzePercent)
+		}
+		if cfg.TableHealthMinRows < 0 {
+			r.Errorf(src, "TABLE_HEALTH_MIN_ROWS must not be negative, got %d", cfg.TableHealthMinRows)
+		}
+	} else if cfg.TableHealthAutoAnalyze {
+		r.Warnf(src, "TABLE_HEALTH_AUTO_ANALYZE has no effect without TABLE_HEALTH_ENABLED")
+	}
+}
+
+// triggerDeliveryBudget is the longest a plugin notification can take to be
+// delivered or to fail: every attempt times out, with the backoff doubling
+// between them.
+func triggerDeliveryBudget(cfg Config) time.Duration {
+	retries := min(max(cfg.TriggerRetryMax, 0), 30)
+	return time.Duration(retries+1)*cfg.TriggerRPCTimeout + cfg.TriggerRetryBackoff*time.Duration(1<<retries-1)
+}
+
+// ValidateShardFile checks a shard config file: backend definitions,
+// duplicate names, overlapping ranges and gaps in coverage.
+func (r *Report) ValidateShardFile(path string, numShards int) {
+	const src = "shards"
+	data, err := os.ReadFile(path)
+	if err != nil {
+		r.Errorf(src, "read %s: %v", path, err)
+		return
+	}
+	var cfg ShardConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		r.Errorf(src, "parse %s: %v", path, err)
+		return
+	}
+	if len(cfg.Backends) == 0 {
+		r.Errorf(src, "no backends defined")
+		return
+	}
+
+	names := make(map[string]bool, len(cfg.Backends))
+	owner := make(map[int]string)
+	for i, b := range cfg.Backends {
+		label := b.Name
+		if label == "" {
+			label = fmt.Sprintf("#%d", i)
+			r.Errorf(src, "backend %s has empty name", label)
+		} else if names[b.Name] {
+			r.Errorf(src, "duplicate backend name %q", b.Name)
+		}
+		names[b.Name] = true
+
+		switch {
+		case b.Secret != nil && b.DatabaseURL != "":
+			r.Errorf(src, "backend %s sets both database_url and secret", label)
+		case b.Secret != nil:
+			if err := validateSecret(b.Secret); err != nil {
+				r.Errorf(src, "backend %s: %v", label, err)
+			}
+		case b.DatabaseURL == "":
+			r.Errorf(src, "backend %s has empty database_url", label)
+		default:
+			if err := checkDatabaseURL(b.DatabaseURL); err != nil {
+				r.Errorf(src, "backend %s: %v", label, err)
+			}
+		}
+		if err := b.SessionTimeouts.validate(); err != nil {
+			r.Errorf(src, "backend %s: %v", label, err)
+		}
+
+		if b.ShardStart < 0 || b.ShardEnd < 0 {
+			r.Errorf(src, "backend %s has negative shard range [%d, %d]", label, b.ShardStart, b.ShardEnd)
+			continue
+		}
+		if b.ShardStart > b.ShardEnd {
+			r.Errorf(src, "backend %s has shard_start (%d) > shard_end (%d)", label, b.ShardStart, b.ShardEnd)
+			continue
+		}
+		if b.ShardEnd >= numShards {
+			r.Errorf(src, "backend %s shard_end (%d) >= num_shards (%d)", label, b.ShardEnd, numShards)
+		}
+		for s := b.ShardStart; s <= b.ShardEnd && s < numShards; s++ {
+			if prev, ok := owner[s]; ok {
+				r.Errorf(src, "shard %d is claimed by both %s and %s", s, prev, label)
+				continue
+			}
+			owner[s] = label
+		}
+	}
+
+	for _, gap := range uncoveredRanges(owner, numShards) {
+		r.Errorf(src, "shard range %s is not covered by any backend", gap)
+	}
+
+	if m := cfg.Metadata; m != nil {
+		if names[MetadataBackend] {
+			r.Errorf(src, "backend name %q is reserved for the metadata database", MetadataBackend)
+		}
+		switch {
+		case m.Secret != nil && m.DatabaseURL != "":
+			r.Errorf(src, "metadata sets both database_url and secret")
+		case m.Secret != nil:
+			if err := validateSecret(m.Secret); err != nil {
+				r.Errorf(src, "metadata: %v", err)
+			}
+		case m.DatabaseURL == "":
+			r.Errorf(src, "metadata has empty database_url")
+		default:
+			if err := checkDatabaseURL(m.DatabaseURL); err != nil {
+				r.Errorf(src, "metadata: %v", err)
+			}
+		}
+		if err := m.SessionTimeouts.validate(); err != nil {
+			r.Errorf(src, "metadata: %v", err)
+		}
+	}
+}
+
+// checkDatabaseURL does a cheap syntactic check of a URL-style connection
+// string. Keyword/value DSNs are accepted as-is.
+func checkDatabaseURL(raw string) error {
+	if !strings.Contains(raw, "://") {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid database_url: %v", err)
+	}
+	if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+		return fmt.Errorf("database_url scheme %q is not postgres", u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("database_url has no host")
+	}
+	return nil
+}
+
+// uncoveredRanges returns the gaps in owner as "a-b" (or "a") strings.
+func uncoveredRanges(owner map[int]string, numShards int) []string {
+	var gaps []string
+	start := -1
+	for s := 0; s <= numShards; s++ {
+		_, covered := owner[s]
+		if s < numShards && !covered {
+			if start < 0 {
+				start = s
+			}
+			continue
+		}
+		if start >= 0 {
+			if start == s-1 {
+				gaps = append(gaps, strconv.Itoa(start))
+			} else {
+				gaps = append(gaps, fmt.Sprintf("%d-%d", start, s-1))
+			}
+			start = -1
+		}
+	}
+	return gaps
+}
+
+// ValidateIndexFile checks an index config file: duplicate names and the
+// syntax of every name and field path that is interpolated into DDL.
+func (r *Report) ValidateIndexFile(path string) {
+	const src = "indexes"
+	data, err := os.ReadFile(path)
+	if err != nil {
+		r.Errorf(src, "read %s: %v", path, err)
+		return
+	}
+	var cfg IndexConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		r.Errorf(src, "parse %s: %v", path, err)
+		return
+	}
+	if len(cfg.Indexes) == 0 {
+		r.Errorf(src, "no indexes defined")
+		return
+	}
+
+	seen := make(map[string]bool, len(cfg.Indexes))
+	for i, idx := range cfg.Indexes {
+		label := idx.Name
+		if label == "" {
+			label = fmt.Sprintf("#%d", i)
+			r.Errorf(src, "index %s has empty name", label)
+		} else {
+			if seen[idx.Name] {
+				r.Errorf(src, "duplicate index name %q", idx.Name)
+			}
+			seen[idx.Name] = true
+			if !identifierPattern.MatchString(idx.Name) {
+				r.Errorf(src, "index name %q must match %s", idx.Name, identifierPattern)
+			}
+			// Longest generated identifier is idx_index_<name>_NNNN_shard_key.
+			if n := len("idx_index_") + len(idx.Name) + len("_0000_shard_key"); n > maxIdentifierLen {
+				r.Errorf(src, "index name %q is too long; generated identifiers would exceed %d characters", idx.Name, maxIdentifierLen)
+			}
+		}
+		if idx.SourceColumn == "" {
+			r.Errorf(src, "index %s has empty source_column", label)
+		}
+		if idx.ShardKeyField == "" {
+			r.Errorf(src, "index %s has empty shard_key_field", label)
+		} else if !identifierPattern.MatchString(idx.ShardKeyField) {
+			r.Errorf(src, "index %s shard_key_field %q is not a valid field path", label, idx.ShardKeyField)
+		}
+		for _, f := range idx.Fields {
+			if !identifierPattern.MatchString(f) {
+				r.Errorf(src, "index %s field %q is not a valid field path", label, f)
+			}
+		}
+		for _, f := range idx.UniqueFields {
+			if !identifierPattern.MatchString(f) {
+				r.Errorf(src, "index %s unique field %q is not a valid field path", label, f)
+				continue
+			}
+			if !slices.Contains(idx.Fields, f) {
+				r.Warnf(src, "index %s unique field %q is not in fields; the unique constraint will never match", label, f)
+			}
+		}
+		for f, typ := range idx.FieldTypes {
+			if !slices.Contains(idx.Fields, f) {
+				r.Errorf(src, "index %s declares the type of %q, which is not in fields", label, f)
+			}
+			if !slices.Contains(fieldTypes, typ) {
+				r.Errorf(src, "index %s field %q has type %q (want string, number or boolean)", label, f, typ)
+			}
+		}
+	}
+}
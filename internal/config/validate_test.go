@@ -0,0 +1,211 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func findingMessages(r *Report, sev Severity) []string {
+	var out []string
+	for _, f := range r.Findings {
+		if f.Severity == sev {
+			out = append(out, f.Message)
+		}
+	}
+	return out
+}
+
+func assertFinding(t *testing.T, r *Report, sev Severity, substr string) {
+	t.Helper()
+	for _, m := range findingMessages(r, sev) {
+		if strings.Contains(m, substr) {
+			return
+		}
+	}
+	t.Errorf("no %s finding containing %q; got %+v", sev, substr, r.Findings)
+}
+
+func validEnvConfig() Config {
+	return Config{
+		Port:                         "8080",
+		NumShards:                    4,
+		LogLevel:                     "info",
+		HTTPWriteTimeout:             10 * time.Second,
+		DBMaxConns:                   20,
+		DBMinConns:                   2,
+		DBQueryTimeout:               5 * time.Second,
+		TriggerRetryMax:              3,
+		TriggerSchemaValidation:      "off",
+		RowACL:                       "off",
+		TriggerHostMaxInflight:       32,
+		TriggerMaxIdleConnsPerHost:   64,
+		TriggerMaxDerivationDepth:    4,
+		TriggerSyncTimeout:           2 * time.Second,
+		TriggerPluginRefreshInterval: 5 * time.Second,
+		FenceRefreshInterval:         5 * time.Second,
+		ColumnStatsFlushInterval:     10 * time.Second,
+	}
+}
+
+func TestReport_ValidateEnv_Valid(t *testing.T) {
+	var r Report
+	r.ValidateEnv(validEnvConfig())
+	if len(r.Findings) != 0 {
+		t.Errorf("unexpected findings: %+v", r.Findings)
+	}
+}
+
+func TestReport_ValidateEnv_Problems(t *testing.T) {
+	cfg := validEnvConfig()
+	cfg.Port = "http"
+	cfg.NumShards = 0
+	cfg.DBMinConns = 30
+	cfg.LogLevel = "verbose"
+	cfg.ShadowWritesURL = "shadow:8080"
+	cfg.ShadowShardConfigPath = "shadow.json"
+	cfg.ReplicationURL = "ftp://dr"
+	cfg.ExportURL = "https://bucket.example.com"
+	cfg.ExportTimeout = 0
+	cfg.CompactionEnabled = true
+	cfg.CompactionSafetyWindow = time.Second
+	cfg.TriggerRPCTimeout = 5 * time.Second
+	cfg.TriggerWatchdogMaxAttempts = -1
+	cfg.TriggerSchemaValidation = "strict"
+	cfg.TriggerHostMaxInflight = -1
+	cfg.TriggerProxyURL = "proxy:3128"
+	cfg.TriggerMaxDerivationDepth = 0
+	cfg.TriggerSyncTimeout = 0
+	cfg.TriggerPluginRefreshInterval = 0
+	cfg.FenceRefreshInterval = -time.Second
+	cfg.ColumnStatsFlushInterval = 0
+	cfg.RowACL = "on"
+	cfg.DBStatementTimeout = time.Second
+	cfg.DBIdleInTransactionTimeout = -time.Second
+	cfg.TableHealthEnabled = true
+	cfg.TableHealthDeadPercent = 150
+	cfg.BodyOffloadURL = "bodies"
+	cfg.BodyOffloadThreshold = 0
+	cfg.BodyOffloadTimeout = 0
+
+	var r Report
+	r.ValidateEnv(cfg)
+
+	assertFinding(t, &r, SeverityError, "PORT")
+	assertFinding(t, &r, SeverityError, "NUM_SHARDS")
+	assertFinding(t, &r, SeverityError, "DB_MIN_CONNS")
+	assertFinding(t, &r, SeverityWarning, "LOG_LEVEL")
+	assertFinding(t, &r, SeverityError, "mutually exclusive")
+	assertFinding(t, &r, SeverityError, "SHADOW_WRITES_URL")
+	assertFinding(t, &r, SeverityError, "REPLICATION_URL")
+	assertFinding(t, &r, SeverityError, "EXPORT_URL")
+	assertFinding(t, &r, SeverityError, "EXPORT_TIMEOUT")
+	assertFinding(t, &r, SeverityError, "COMPACTION_SAFETY_WINDOW")
+	assertFinding(t, &r, SeverityError, "TRIGGER_WATCHDOG_MAX_ATTEMPTS")
+	assertFinding(t, &r, SeverityError, "TRIGGER_SCHEMA_VALIDATION")
+	assertFinding(t, &r, SeverityError, "TRIGGER_HOST_MAX_INFLIGHT")
+	assertFinding(t, &r, SeverityError, "TRIGGER_PROXY_URL")
+	assertFinding(t, &r, SeverityError, "TRIGGER_MAX_DERIVATION_DEPTH")
+	assertFinding(t, &r, SeverityError, "TRIGGER_SYNC_TIMEOUT")
+	assertFinding(t, &r, SeverityError, "TRIGGER_PLUGIN_REFRESH_INTERVAL")
+	assertFinding(t, &r, SeverityError, "FENCE_REFRESH_INTERVAL")
+	assertFinding(t, &r, SeverityError, "COLUMN_STATS_FLUSH_INTERVAL")
+	assertFinding(t, &r, SeverityError, "ROW_ACL")
+	assertFinding(t, &r, SeverityWarning, "DB_STATEMENT_TIMEOUT")
+	assertFinding(t, &r, SeverityError, "DB_IDLE_IN_TRANSACTION_TIMEOUT")
+	assertFinding(t, &r, SeverityError, "TABLE_HEALTH_DEAD_PERCENT")
+	assertFinding(t, &r, SeverityError, "BODY_OFFLOAD_URL")
+	assertFinding(t, &r, SeverityError, "BODY_OFFLOAD_THRESHOLD")
+	assertFinding(t, &r, SeverityError, "BODY_OFFLOAD_TIMEOUT")
+}
+
+func TestReport_ValidateShardFile_CollectsAllProblems(t *testing.T) {
+	path := writeTempConfig(t, `{
+		"backends": [
+			{"name": "a", "database_url": "mysql://a/db", "shard_start": 0, "shard_end": 3},
+			{"name": "a", "database_url": "postgres://b/db", "shard_start": 2, "shard_end": 4},
+			{"name": "c", "database_url": "", "shard_start": 9, "shard_end": 9, "statement_timeout": "-1s"}
+		]
+	}`)
+
+	var r Report
+	r.ValidateShardFile(path, 12)
+
+	assertFinding(t, &r, SeverityError, `scheme "mysql"`)
+	assertFinding(t, &r, SeverityError, `duplicate backend name "a"`)
+	assertFinding(t, &r, SeverityError, "shard 2 is claimed by both a and a")
+	assertFinding(t, &r, SeverityError, "backend c has empty database_url")
+	assertFinding(t, &r, SeverityError, "backend c: negative statement_timeout")
+	assertFinding(t, &r, SeverityError, "shard range 5-8 is not covered")
+	assertFinding(t, &r, SeverityError, "shard range 10-11 is not covered")
+}
+
+func TestReport_ValidateShardFile_Valid(t *testing.T) {
+	path := writeTempConfig(t, `{
+		"backends": [
+			{"name": "a", "database_url": "postgres://a/db", "shard_start": 0, "shard_end": 1},
+			{"name": "b", "database_url": "host=b dbname=db", "shard_start": 2, "shard_end": 3}
+		]
+	}`)
+
+	var r Report
+	r.ValidateShardFile(path, 4)
+	if len(r.Findings) != 0 {
+		t.Errorf("unexpected findings: %+v", r.Findings)
+	}
+}
+
+func TestReport_ValidateShardFile_Metadata(t *testing.T) {
+	path := writeTempConfig(t, `{
+		"backends": [{"name": "metadata", "database_url": "postgres://a/db", "shard_start": 0, "shard_end": 3}],
+		"metadata": {"database_url": "mysql://m/db"}
+	}`)
+
+	var r Report
+	r.ValidateShardFile(path, 4)
+
+	assertFinding(t, &r, SeverityError, `backend name "metadata" is reserved`)
+	assertFinding(t, &r, SeverityError, `metadata: database_url scheme "mysql"`)
+}
+
+func TestReport_ValidateIndexFile(t *testing.T) {
+	path := writeTempIndexConfig(t, `{
+		"indexes": [
+			{"name": "user_by_email", "source_column": "profile", "shard_key_field": "email", "fields": ["email"], "unique_fields": ["email", "phone"]},
+			{"name": "user_by_email", "source_column": "profile", "shard_key_field": "email"},
+			{"name": "bad-name", "source_column": "", "shard_key_field": "a.b", "fields": ["x'; DROP"]},
+			{"name": "orders", "source_column": "orders", "shard_key_field": "customer_id", "fields": ["total"], "field_types": {"total": "money", "status": "string"}}
+		]
+	}`)
+
+	var r Report
+	r.ValidateIndexFile(path)
+
+	assertFinding(t, &r, SeverityError, `duplicate index name "user_by_email"`)
+	assertFinding(t, &r, SeverityError, `index name "bad-name" must match`)
+	assertFinding(t, &r, SeverityError, "has empty source_column")
+	assertFinding(t, &r, SeverityError, `shard_key_field "a.b"`)
+	assertFinding(t, &r, SeverityError, `field "x'; DROP"`)
+	assertFinding(t, &r, SeverityWarning, `unique field "phone" is not in fields`)
+	assertFinding(t, &r, SeverityError, `field "total" has type "money"`)
+	assertFinding(t, &r, SeverityError, `declares the type of "status", which is not in fields`)
+}
+
+func TestReport_Write(t *testing.T) {
+	var r Report
+	r.Warnf("env", "something odd")
+
+	var buf bytes.Buffer
+	r.Write(&buf)
+	if !strings.Contains(buf.String(), "WARNING [env] something odd") || !strings.Contains(buf.String(), "OK:") {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+
+	r.Errorf("shards", "broken")
+	buf.Reset()
+	r.Write(&buf)
+	if !r.HasErrors() || !strings.Contains(buf.String(), "FAILED: 1 errors, 1 warnings") {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+}
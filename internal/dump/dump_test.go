@@ -0,0 +1,199 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/config"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+)
+
+// writeSegment writes reqs as shardID's segment in dir.
+func writeSegment(t *testing.T, dir string, shardID int, cells ...Cell) Segment {
+	t.Helper()
+	w, err := createSegment(dir, shardID)
+	if err != nil {
+		t.Fatalf("createSegment: %v", err)
+	}
+	for _, c := range cells {
+		if err := w.write(c); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	seg, err := w.close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	return seg
+}
+
+func testCells() []Cell {
+	row := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+	return []Cell{
+		{WriteCellRequest: cell.WriteCellRequest{RowKey: row, ColumnName: "profile", RefKey: 1, Body: json.RawMessage(`{"name":"a"}`)}},
+		{WriteCellRequest: cell.WriteCellRequest{RowKey: row, ColumnName: "profile", RefKey: 2, Body: json.RawMessage(`{"name":"b"}`)}},
+	}
+}
+
+func TestSegment_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	seg := writeSegment(t, dir, 3, testCells()...)
+	if seg.File != "shards/0003.ndjson" || seg.Cells != 2 || len(seg.SHA256) != 64 {
+		t.Errorf("got %+v", seg)
+	}
+
+	var got []Cell
+	if err := ReadSegment(dir, seg, func(c Cell) error {
+		got = append(got, c)
+		return nil
+	}); err != nil {
+		t.Fatalf("ReadSegment: %v", err)
+	}
+	if len(got) != 2 || got[1].RefKey != 2 || string(got[1].Body) != `{"name":"b"}` {
+		t.Errorf("got %+v", got)
+	}
+
+	// The same cells give the same file.
+	other := t.TempDir()
+	if again := writeSegment(t, other, 3, testCells()...); again != seg {
+		t.Errorf("rewritten segment: got %+v, want %+v", again, seg)
+	}
+}
+
+func TestSegment_BinaryCell(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte{0x89, 'P', 'N', 'G', 0}
+	blob := Cell{WriteCellRequest: cell.WriteCellRequest{RowKey: uuid.New(), ColumnName: "avatar", RefKey: 1, Body: cell.BlobBody("image/png", data)}, Data: data}
+	seg := writeSegment(t, dir, 0, blob)
+
+	var got []Cell
+	if err := ReadSegment(dir, seg, func(c Cell) error {
+		got = append(got, c)
+		return nil
+	}); err != nil {
+		t.Fatalf("ReadSegment: %v", err)
+	}
+	if len(got) != 1 || !bytes.Equal(got[0].Data, data) || string(got[0].Body) != string(blob.Body) {
+		t.Errorf("got %+v, want the cell with its bytes", got)
+	}
+}
+
+func TestReadSegment_DetectsCorruption(t *testing.T) {
+	dir := t.TempDir()
+	seg := writeSegment(t, dir, 0, testCells()...)
+	path := filepath.Join(dir, seg.File)
+	data, _ := os.ReadFile(path)
+
+	os.WriteFile(path, bytes.Replace(data, []byte(`"a"`), []byte(`"x"`), 1), 0o644)
+	if err := ReadSegment(dir, seg, func(Cell) error { return nil }); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("edited segment: got %v, want checksum error", err)
+	}
+
+	os.WriteFile(path, data[:bytes.IndexByte(data, '\n')+1], 0o644)
+	if err := ReadSegment(dir, seg, func(Cell) error { return nil }); err == nil || !strings.Contains(err.Error(), "1 cells") {
+		t.Errorf("truncated segment: got %v, want count error", err)
+	}
+}
+
+func TestManifest_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManifest(2)
+	m.Segments = []Segment{writeSegment(t, dir, 0, testCells()...), writeSegment(t, dir, 1)}
+	if err := WriteManifest(dir, m); err != nil {
+		t.Fatalf("WriteManifest: %v", err)
+	}
+	got, err := ReadManifest(dir)
+	if err != nil {
+		t.Fatalf("ReadManifest: %v", err)
+	}
+	if got.NumShards != 2 || len(got.Segments) != 2 || got.Segments[0] != m.Segments[0] {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestReadManifest_Errors(t *testing.T) {
+	tests := []struct {
+		name, manifest, want string
+	}{
+		{"not a dump", `{"version": 1, "markers": {}}`, "not a mezzanine dump"},
+		{"version", `{"format": "mezzanine-dump", "version": 99}`, "version 99"},
+		{"missing segment", `{"format": "mezzanine-dump", "version": 1, "num_shards": 2, "segments": [{"shard": 0}]}`, "1 segments for 2 shards"},
+		{"misordered", `{"format": "mezzanine-dump", "version": 1, "num_shards": 2, "segments": [{"shard": 1}, {"shard": 0}]}`, "segment 0 is for shard 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			os.WriteFile(filepath.Join(dir, ManifestFile), []byte(tt.manifest), 0o644)
+			if _, err := ReadManifest(dir); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexes(t *testing.T) {
+	dir := t.TempDir()
+	defs := []config.IndexDefinition{
+		{Name: "b", SourceColumn: "profile", ShardKeyField: "email", Fields: []string{"email"}},
+		{Name: "a", SourceColumn: "orders", ShardKeyField: "user", Fields: []string{"user", "total"}},
+	}
+	if err := WriteIndexes(dir, defs); err != nil {
+		t.Fatalf("WriteIndexes: %v", err)
+	}
+	// The file is a valid INDEX_CONFIG_PATH.
+	cfg, err := config.LoadIndexConfig(filepath.Join(dir, IndexesFile))
+	if err != nil {
+		t.Fatalf("LoadIndexConfig: %v", err)
+	}
+	if cfg.Indexes[0].Name != "a" {
+		t.Errorf("indexes not sorted by name: %+v", cfg.Indexes)
+	}
+	got, err := ReadIndexes(dir)
+	if err != nil {
+		t.Fatalf("ReadIndexes: %v", err)
+	}
+	if !SameIndexes(got, defs) {
+		t.Errorf("SameIndexes(%+v, %+v) = false", got, defs)
+	}
+	changed := []config.IndexDefinition{defs[0], defs[1]}
+	changed[1].Fields = []string{"user"}
+	if SameIndexes(got, changed) || SameIndexes(got, nil) {
+		t.Error("SameIndexes matched different definitions")
+	}
+	if !SameIndexes(nil, []config.IndexDefinition{}) {
+		t.Error("SameIndexes(nil, empty) = false")
+	}
+}
+
+func TestPlugins_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	plugins := []*trigger.Plugin{
+		{ID: uuid.New(), Name: "search", Endpoint: "http://search", SubscribedColumns: []string{"profile"}, Status: trigger.PluginStatusActive, CreatedAt: created},
+		{ID: uuid.New(), Name: "audit", Endpoint: "http://audit", SubscribedColumns: []string{"orders"}, Status: trigger.PluginStatusActive, CreatedAt: created},
+	}
+	if err := WritePlugins(dir, plugins); err != nil {
+		t.Fatalf("WritePlugins: %v", err)
+	}
+	got, err := ReadPlugins(dir)
+	if err != nil {
+		t.Fatalf("ReadPlugins: %v", err)
+	}
+	if len(got) != 2 || got[0].Name != "audit" || got[1].ID != plugins[0].ID || !got[1].CreatedAt.Equal(created) {
+		t.Errorf("got %+v", got)
+	}
+
+	if err := WritePlugins(dir, nil); err != nil {
+		t.Fatalf("WritePlugins: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, PluginsFile)); string(data) != "[]\n" {
+		t.Errorf("no plugins: got %q, want []", data)
+	}
+}
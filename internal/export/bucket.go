@@ -0,0 +1,25 @@
+package export
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ryanbastic/go-mezzanine/internal/objstore"
+)
+
+// Bucket stores exported files.
+type Bucket interface {
+	// Put writes data to key, replacing any object already there.
+	Put(ctx context.Context, key string, data []byte) error
+}
+
+// NewS3Bucket returns the bucket at rawURL, as objstore.NewS3Bucket does,
+// writing objects as Parquet files.
+func NewS3Bucket(rawURL string, client *http.Client) (*objstore.S3Bucket, error) {
+	b, err := objstore.NewS3Bucket(rawURL, client)
+	if err != nil {
+		return nil, err
+	}
+	b.ContentType = "application/vnd.apache.parquet"
+	return b, nil
+}
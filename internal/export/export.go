@@ -0,0 +1,269 @@
+// Package export writes every shard's cells to object storage as hourly
+// Parquet files, so an analytics warehouse can ingest Mezzanine data
+// without going through the API.
+//
+// Each shard is tailed in added_id order, as replication does. Once an
+// hour has ended, and Settle has passed, the shard's cells created in that
+// hour are written to one file per column, at
+//
+//	date=YYYY-MM-DD/shard=N/column=NAME/HH-FIRST-LAST.parquet
+//
+// where HH is the UTC hour and FIRST and LAST are the added_ids of the
+// file's first and last cells. An hour's cells for a column are split over
+// several files if they exceed MaxFileRows, and a cell committed late
+// lands in a file of its own. Progress is checkpointed per shard after the
+// files are written, so a file may be written again after a failure, but
+// no cell is skipped.
+package export
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+var (
+	filesTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "mezzanine",
+			Name:      "export_files_total",
+			Help:      "Parquet files written to object storage.",
+		},
+	)
+	cellsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "mezzanine",
+			Name:      "export_cells_total",
+			Help:      "Cells written to object storage.",
+		},
+	)
+	errorsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "mezzanine",
+			Name:      "export_errors_total",
+			Help:      "Failed attempts to export a shard's cells; they are retried.",
+		},
+	)
+)
+
+// Options configures an Exporter.
+type Options struct {
+	// Name identifies the export's checkpoints, so that one cluster can
+	// export to several buckets (default "default").
+	Name string
+	// NumShards is the number of shards.
+	NumShards int
+	// BatchSize is the number of cells read per query (default 1000).
+	BatchSize int
+	// MaxFileRows bounds the cells held in memory before they are written,
+	// and so the rows of a file (default 100000).
+	MaxFileRows int
+	// Settle delays exporting an hour past its end, so that cells written by
+	// slow transactions are committed first (default 5m).
+	Settle time.Duration
+	// Concurrency bounds the shards exported at once (default 4).
+	Concurrency int
+	// RetryInterval is how long a shard waits after a failed export
+	// (default 1m).
+	RetryInterval time.Duration
+}
+
+// Exporter writes shards' cells to a Bucket.
+type Exporter struct {
+	router      *shard.Router
+	bucket      Bucket
+	checkpoints storage.Checkpoints
+	opts        Options
+	sem         chan struct{}
+	now         func() time.Time
+	logger      *slog.Logger
+}
+
+// New returns an exporter reading shards through router and writing files
+// to bucket. checkpoints keeps its position on each shard: the added_id of
+// the last cell written.
+func New(router *shard.Router, bucket Bucket, checkpoints storage.Checkpoints, opts Options, logger *slog.Logger) *Exporter {
+	if opts.Name == "" {
+		opts.Name = "default"
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+	if opts.MaxFileRows <= 0 {
+		opts.MaxFileRows = 100000
+	}
+	if opts.Settle <= 0 {
+		opts.Settle = 5 * time.Minute
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = time.Minute
+	}
+	return &Exporter{
+		router:      router,
+		bucket:      bucket,
+		checkpoints: checkpoints,
+		opts:        opts,
+		sem:         make(chan struct{}, opts.Concurrency),
+		now:         time.Now,
+		logger:      logger.With("export", opts.Name),
+	}
+}
+
+// Run exports every shard until ctx is cancelled. Use it when one instance
+// exports the whole cluster; with shard leases, register RunShard as a
+// lease handler instead.
+func (e *Exporter) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for id := range e.opts.NumShards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.RunShard(ctx, id)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// RunShard exports shardID's completed hours until ctx is cancelled, waking
+// as each hour becomes complete. It has the signature of a lease.Handler.
+func (e *Exporter) RunShard(ctx context.Context, shardID int) {
+	for ctx.Err() == nil {
+		wait := e.opts.RetryInterval
+		if err := e.exportShard(ctx, shardID); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			errorsTotal.Inc()
+			e.logger.Warn("export failed; retrying", "shard_id", shardID, "error", err)
+		} else {
+			now := e.now()
+			wait = e.cutoff(now).Add(time.Hour + e.opts.Settle).Sub(now)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+		}
+	}
+}
+
+// cutoff returns the end of the last hour that is complete at now: cells
+// created before it are exported.
+func (e *Exporter) cutoff(now time.Time) time.Time {
+	return now.Add(-e.opts.Settle).Truncate(time.Hour)
+}
+
+// exportShard writes shardID's cells from its checkpoint up to the cutoff,
+// checkpointing after every MaxFileRows cells.
+func (e *Exporter) exportShard(ctx context.Context, shardID int) error {
+	select {
+	case e.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-e.sem }()
+
+	store, err := e.router.StoreFor(shard.ID(shardID))
+	if err != nil {
+		return err
+	}
+	pos, err := e.checkpoints.Load(ctx, e.opts.Name, shardID)
+	if err != nil {
+		return err
+	}
+	cutoff := e.cutoff(e.now())
+	read := pos
+	var pending []cell.Cell
+	for {
+		cells, err := store.PartitionRead(ctx, shardID, storage.PartitionReadTypeAddedID, read, time.Time{}, e.opts.BatchSize)
+		if err != nil {
+			return err
+		}
+		done := len(cells) < e.opts.BatchSize
+		for _, c := range cells {
+			if !c.CreatedAt.Before(cutoff) {
+				done = true
+				break
+			}
+			pending = append(pending, c)
+			read = c.AddedID
+			// Flushing inside the batch keeps files within MaxFileRows
+			// whatever the BatchSize.
+			if len(pending) == e.opts.MaxFileRows {
+				if err := e.flush(ctx, shardID, pending); err != nil {
+					return err
+				}
+				pending = pending[:0]
+			}
+		}
+		if done {
+			if len(pending) > 0 {
+				return e.flush(ctx, shardID, pending)
+			}
+			return nil
+		}
+	}
+}
+
+// flush writes cells and checkpoints shardID past the last of them.
+func (e *Exporter) flush(ctx context.Context, shardID int, cells []cell.Cell) error {
+	if err := e.write(ctx, shardID, cells); err != nil {
+		return err
+	}
+	pos := cells[len(cells)-1].AddedID
+	if err := e.checkpoints.Save(ctx, e.opts.Name, shardID, pos); err != nil {
+		return err
+	}
+	e.logger.Debug("exported cells", "shard_id", shardID, "cells", len(cells), "position", pos)
+	return nil
+}
+
+// write writes cells to one file per hour and column.
+func (e *Exporter) write(ctx context.Context, shardID int, cells []cell.Cell) error {
+	type file struct {
+		hour   time.Time
+		column string
+	}
+	groups := make(map[file][]cell.Cell)
+	var files []file
+	for _, c := range cells {
+		f := file{hour: c.CreatedAt.UTC().Truncate(time.Hour), column: c.ColumnName}
+		if _, ok := groups[f]; !ok {
+			files = append(files, f)
+		}
+		groups[f] = append(groups[f], c)
+	}
+	for _, f := range files {
+		group := groups[f]
+		data, err := encodeParquet(group)
+		if err != nil {
+			return fmt.Errorf("encode shard %d column %s: %w", shardID, f.column, err)
+		}
+		key := objectKey(shardID, f.hour, f.column, group[0].AddedID, group[len(group)-1].AddedID)
+		if err := e.bucket.Put(ctx, key, data); err != nil {
+			return fmt.Errorf("write %s: %w", key, err)
+		}
+		filesTotal.Inc()
+		cellsTotal.Add(float64(len(group)))
+	}
+	return nil
+}
+
+// objectKey returns the key of the file holding shardID's cells of column
+// created in hour, from added_id first to last.
+func objectKey(shardID int, hour time.Time, column string, first, last int64) string {
+	return fmt.Sprintf("date=%s/shard=%d/column=%s/%02d-%d-%d.parquet",
+		hour.Format("2006-01-02"), shardID, url.PathEscape(column), hour.Hour(), first, last)
+}
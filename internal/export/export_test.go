@@ -0,0 +1,155 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/storetest"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// memBucket records the keys written to it, and fails while down is set.
+type memBucket struct {
+	mu   sync.Mutex
+	keys []string
+	down bool
+}
+
+func (b *memBucket) Put(_ context.Context, key string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.down {
+		return errors.New("bucket unavailable")
+	}
+	if len(data) == 0 {
+		return errors.New("empty file")
+	}
+	b.keys = append(b.keys, key)
+	return nil
+}
+
+var testNow = time.Date(2026, 3, 1, 15, 10, 0, 0, time.UTC)
+
+// at returns a cell with the given added_id and column, created at hh:mm on
+// testNow's day.
+func at(addedID int64, column string, hh, mm int) cell.Cell {
+	return cell.Cell{
+		AddedID: addedID, RowKey: uuid.New(), ColumnName: column, RefKey: 1, Body: json.RawMessage(`{}`),
+		CreatedAt: time.Date(2026, 3, 1, hh, mm, 0, 0, time.UTC),
+	}
+}
+
+func newTestExporter(cells []cell.Cell, opts Options) (*Exporter, *memBucket, *storetest.Checkpoints) {
+	r := shard.NewRouter()
+	r.Register(0, &storetest.Log{Cells: cells})
+	bucket := &memBucket{}
+	cp := &storetest.Checkpoints{}
+	opts.NumShards = 1
+	e := New(r, bucket, cp, opts, testLogger())
+	e.now = func() time.Time { return testNow }
+	return e, bucket, cp
+}
+
+func TestExporter_WritesCompleteHoursByColumn(t *testing.T) {
+	cells := []cell.Cell{
+		at(1, "profile", 13, 5), at(2, "profile", 13, 50), at(3, "profile", 14, 0),
+		at(4, "email/v2", 14, 59), at(5, "profile", 15, 2),
+	}
+	e, bucket, cp := newTestExporter(cells, Options{})
+
+	if err := e.exportShard(context.Background(), 0); err != nil {
+		t.Fatalf("exportShard: %v", err)
+	}
+	want := []string{
+		"date=2026-03-01/shard=0/column=profile/13-1-2.parquet",
+		"date=2026-03-01/shard=0/column=profile/14-3-3.parquet",
+		"date=2026-03-01/shard=0/column=email%2Fv2/14-4-4.parquet",
+	}
+	if !slices.Equal(bucket.keys, want) {
+		t.Errorf("keys:\n got %v\nwant %v", bucket.keys, want)
+	}
+	if cp.Position(0) != 4 {
+		t.Errorf("checkpoint: got %d, want 4", cp.Position(0))
+	}
+}
+
+func TestExporter_WaitsForSettle(t *testing.T) {
+	// At 15:03 the 14:00 hour has not settled, so nothing is written.
+	e, bucket, _ := newTestExporter([]cell.Cell{at(1, "profile", 14, 30)}, Options{})
+	e.now = func() time.Time { return testNow.Add(-7 * time.Minute) }
+	if err := e.exportShard(context.Background(), 0); err != nil {
+		t.Fatalf("exportShard: %v", err)
+	}
+	if len(bucket.keys) != 0 {
+		t.Errorf("wrote %v before the hour settled", bucket.keys)
+	}
+}
+
+func TestExporter_SplitsAtMaxFileRows(t *testing.T) {
+	cells := []cell.Cell{at(1, "a", 13, 0), at(2, "a", 13, 1), at(3, "a", 13, 2), at(4, "a", 13, 3), at(5, "a", 13, 4)}
+	e, bucket, cp := newTestExporter(cells, Options{BatchSize: 2, MaxFileRows: 2})
+
+	if err := e.exportShard(context.Background(), 0); err != nil {
+		t.Fatalf("exportShard: %v", err)
+	}
+	want := []string{
+		"date=2026-03-01/shard=0/column=a/13-1-2.parquet",
+		"date=2026-03-01/shard=0/column=a/13-3-4.parquet",
+		"date=2026-03-01/shard=0/column=a/13-5-5.parquet",
+	}
+	if !slices.Equal(bucket.keys, want) || cp.Position(0) != 5 {
+		t.Errorf("got keys %v and checkpoint %d, want %v and 5", bucket.keys, cp.Position(0), want)
+	}
+}
+
+func TestExporter_SplitsWithinABatch(t *testing.T) {
+	cells := []cell.Cell{at(1, "a", 13, 0), at(2, "a", 13, 1), at(3, "a", 13, 2), at(4, "a", 13, 3), at(5, "a", 13, 4)}
+	e, bucket, cp := newTestExporter(cells, Options{BatchSize: 5, MaxFileRows: 2})
+
+	if err := e.exportShard(context.Background(), 0); err != nil {
+		t.Fatalf("exportShard: %v", err)
+	}
+	want := []string{
+		"date=2026-03-01/shard=0/column=a/13-1-2.parquet",
+		"date=2026-03-01/shard=0/column=a/13-3-4.parquet",
+		"date=2026-03-01/shard=0/column=a/13-5-5.parquet",
+	}
+	if !slices.Equal(bucket.keys, want) || cp.Position(0) != 5 {
+		t.Errorf("got keys %v and checkpoint %d, want %v and 5", bucket.keys, cp.Position(0), want)
+	}
+}
+
+func TestExporter_RetriesFromCheckpoint(t *testing.T) {
+	cells := []cell.Cell{at(1, "a", 12, 0), at(2, "a", 13, 0), at(3, "a", 13, 1)}
+	e, bucket, cp := newTestExporter(cells, Options{})
+	_ = cp.Save(context.Background(), "", 0, 1)
+
+	bucket.down = true
+	if err := e.exportShard(context.Background(), 0); err == nil {
+		t.Fatal("exportShard: expected error")
+	}
+	if cp.Position(0) != 1 {
+		t.Errorf("checkpoint advanced to %d past a failed write", cp.Position(0))
+	}
+
+	bucket.down = false
+	if err := e.exportShard(context.Background(), 0); err != nil {
+		t.Fatalf("exportShard: %v", err)
+	}
+	if want := []string{"date=2026-03-01/shard=0/column=a/13-2-3.parquet"}; !slices.Equal(bucket.keys, want) || cp.Position(0) != 3 {
+		t.Errorf("got keys %v and checkpoint %d, want %v and 3", bucket.keys, cp.Position(0), want)
+	}
+}
@@ -0,0 +1,255 @@
+package export
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+)
+
+// Exported files are Parquet with a fixed, flat schema of required columns:
+//
+//	added_id     INT64
+//	row_key      BYTE_ARRAY (UTF8)
+//	column_name  BYTE_ARRAY (UTF8)
+//	ref_key      INT64
+//	body         BYTE_ARRAY (JSON)
+//	created_at   INT64 (TIMESTAMP_MICROS, UTC)
+//
+// Each file is a single row group with one Snappy-compressed, PLAIN-encoded
+// data page per column. That is the simplest layout every reader supports,
+// and files hold at most Options.MaxFileRows cells.
+
+// Parquet physical types, converted types and other enum values, from
+// parquet.thrift.
+const (
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	convertedNone            = -1
+	convertedUTF8            = 0
+	convertedTimestampMicros = 10
+	convertedJSON            = 19
+
+	repetitionRequired = 0
+	encodingPlain      = 0
+	encodingRLE        = 3
+	codecSnappy        = 1
+	pageTypeData       = 0
+)
+
+type parquetColumn struct {
+	name      string
+	typ       int32
+	converted int32
+	// appendValue appends c's value in PLAIN encoding.
+	appendValue func(b []byte, c *cell.Cell) []byte
+}
+
+var parquetColumns = []parquetColumn{
+	{"added_id", parquetInt64, convertedNone, func(b []byte, c *cell.Cell) []byte {
+		return binary.LittleEndian.AppendUint64(b, uint64(c.AddedID))
+	}},
+	{"row_key", parquetByteArray, convertedUTF8, func(b []byte, c *cell.Cell) []byte {
+		return appendByteArray(b, c.RowKey.String())
+	}},
+	{"column_name", parquetByteArray, convertedUTF8, func(b []byte, c *cell.Cell) []byte {
+		return appendByteArray(b, c.ColumnName)
+	}},
+	{"ref_key", parquetInt64, convertedNone, func(b []byte, c *cell.Cell) []byte {
+		return binary.LittleEndian.AppendUint64(b, uint64(c.RefKey))
+	}},
+	{"body", parquetByteArray, convertedJSON, func(b []byte, c *cell.Cell) []byte {
+		return appendByteArray(b, string(c.Body))
+	}},
+	{"created_at", parquetInt64, convertedTimestampMicros, func(b []byte, c *cell.Cell) []byte {
+		return binary.LittleEndian.AppendUint64(b, uint64(c.CreatedAt.UnixMicro()))
+	}},
+}
+
+func appendByteArray(b []byte, s string) []byte {
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+// encodeParquet returns cells as a Parquet file.
+func encodeParquet(cells []cell.Cell) ([]byte, error) {
+	type chunk struct {
+		offset                   int64
+		uncompressed, compressed int64
+	}
+	out := []byte("PAR1")
+	chunks := make([]chunk, len(parquetColumns))
+	var values []byte
+	for i, col := range parquetColumns {
+		values = values[:0]
+		for j := range cells {
+			values = col.appendValue(values, &cells[j])
+		}
+		if len(values) > math.MaxInt32 {
+			return nil, fmt.Errorf("column %s: %d bytes exceeds the maximum page size", col.name, len(values))
+		}
+		compressed := snappy.Encode(nil, values)
+
+		var h thriftWriter
+		h.begin()
+		h.i32(1, pageTypeData)
+		h.i32(2, int32(len(values)))
+		h.i32(3, int32(len(compressed)))
+		h.beginStruct(5) // DataPageHeader
+		h.i32(1, int32(len(cells)))
+		h.i32(2, encodingPlain)
+		h.i32(3, encodingRLE)
+		h.i32(4, encodingRLE)
+		h.end()
+		h.end()
+
+		chunks[i] = chunk{
+			offset:       int64(len(out)),
+			uncompressed: int64(len(h.buf) + len(values)),
+			compressed:   int64(len(h.buf) + len(compressed)),
+		}
+		out = append(out, h.buf...)
+		out = append(out, compressed...)
+	}
+
+	var m thriftWriter
+	m.begin() // FileMetaData
+	m.i32(1, 1)
+	m.beginList(2, thriftStruct, len(parquetColumns)+1)
+	m.begin() // root SchemaElement
+	m.str(4, "schema")
+	m.i32(5, int32(len(parquetColumns)))
+	m.end()
+	for _, col := range parquetColumns {
+		m.begin()
+		m.i32(1, col.typ)
+		m.i32(3, repetitionRequired)
+		m.str(4, col.name)
+		if col.converted != convertedNone {
+			m.i32(6, col.converted)
+		}
+		m.end()
+	}
+	m.i64(3, int64(len(cells)))
+	m.beginList(4, thriftStruct, 1)
+	m.begin() // RowGroup
+	m.beginList(1, thriftStruct, len(parquetColumns))
+	var totalSize int64
+	for i, col := range parquetColumns {
+		c := chunks[i]
+		totalSize += c.uncompressed
+		m.begin() // ColumnChunk
+		m.i64(2, c.offset)
+		m.beginStruct(3) // ColumnMetaData
+		m.i32(1, col.typ)
+		m.beginList(2, thriftI32, 2)
+		m.listI32(encodingPlain)
+		m.listI32(encodingRLE)
+		m.beginList(3, thriftBinary, 1)
+		m.listString(col.name)
+		m.i32(4, codecSnappy)
+		m.i64(5, int64(len(cells)))
+		m.i64(6, c.uncompressed)
+		m.i64(7, c.compressed)
+		m.i64(9, c.offset)
+		m.end()
+		m.end()
+	}
+	m.i64(2, totalSize)
+	m.i64(3, int64(len(cells)))
+	m.end()
+	m.str(6, "mezzanine")
+	m.end()
+
+	out = append(out, m.buf...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(m.buf)))
+	return append(out, "PAR1"...), nil
+}
+
+// Thrift compact protocol type codes.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes structs in the Thrift compact protocol, which
+// Parquet uses for its page headers and footer. Callers write a struct's
+// fields in increasing id order between begin and end.
+type thriftWriter struct {
+	buf []byte
+	// last holds the id of the last field written in each open struct.
+	last []int16
+}
+
+// begin opens a top-level struct or a struct list element.
+func (w *thriftWriter) begin() {
+	w.last = append(w.last, 0)
+}
+
+// beginStruct opens a struct-typed field.
+func (w *thriftWriter) beginStruct(id int16) {
+	w.field(id, thriftStruct)
+	w.begin()
+}
+
+func (w *thriftWriter) end() {
+	w.buf = append(w.buf, 0)
+	w.last = w.last[:len(w.last)-1]
+}
+
+func (w *thriftWriter) field(id int16, typ byte) {
+	last := &w.last[len(w.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		w.buf = append(w.buf, byte(delta)<<4|typ)
+	} else {
+		w.buf = append(w.buf, typ)
+		w.buf = binary.AppendUvarint(w.buf, zigzag(int64(id)))
+	}
+	*last = id
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.field(id, thriftI32)
+	w.buf = binary.AppendUvarint(w.buf, zigzag(int64(v)))
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.field(id, thriftI64)
+	w.buf = binary.AppendUvarint(w.buf, zigzag(v))
+}
+
+func (w *thriftWriter) str(id int16, s string) {
+	w.field(id, thriftBinary)
+	w.listString(s)
+}
+
+// beginList starts a list field of n elements, which the caller then
+// writes with listI32, listString or begin and end.
+func (w *thriftWriter) beginList(id int16, elem byte, n int) {
+	w.field(id, thriftList)
+	if n < 15 {
+		w.buf = append(w.buf, byte(n)<<4|elem)
+	} else {
+		w.buf = append(w.buf, 0xf0|elem)
+		w.buf = binary.AppendUvarint(w.buf, uint64(n))
+	}
+}
+
+func (w *thriftWriter) listI32(v int32) {
+	w.buf = binary.AppendUvarint(w.buf, zigzag(int64(v)))
+}
+
+func (w *thriftWriter) listString(s string) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
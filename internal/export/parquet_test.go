@@ -0,0 +1,149 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/klauspost/compress/snappy"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+)
+
+// thriftReader decodes Thrift compact structs into maps from field id to
+// value, enough to read back what encodeParquet writes.
+type thriftReader struct {
+	b []byte
+	i int
+}
+
+func (r *thriftReader) byte() byte {
+	c := r.b[r.i]
+	r.i++
+	return c
+}
+
+func (r *thriftReader) varint() uint64 {
+	v, n := binary.Uvarint(r.b[r.i:])
+	r.i += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	u := r.varint()
+	return int64(u>>1) ^ -int64(u&1)
+}
+
+func (r *thriftReader) value(typ byte) any {
+	switch typ {
+	case thriftI32, thriftI64:
+		return r.zigzag()
+	case thriftBinary:
+		n := int(r.varint())
+		s := string(r.b[r.i : r.i+n])
+		r.i += n
+		return s
+	case thriftList:
+		h := r.byte()
+		n := int(h >> 4)
+		if n == 15 {
+			n = int(r.varint())
+		}
+		out := make([]any, n)
+		for k := range out {
+			out[k] = r.value(h & 0x0f)
+		}
+		return out
+	case thriftStruct:
+		return r.strct()
+	}
+	panic("unexpected thrift type")
+}
+
+func (r *thriftReader) strct() map[int16]any {
+	out := make(map[int16]any)
+	var id int16
+	for {
+		h := r.byte()
+		if h == 0 {
+			return out
+		}
+		if delta := h >> 4; delta != 0 {
+			id += int16(delta)
+		} else {
+			id = int16(r.zigzag())
+		}
+		out[id] = r.value(h & 0x0f)
+	}
+}
+
+func TestEncodeParquet_RoundTrip(t *testing.T) {
+	created := time.Date(2026, 3, 1, 14, 30, 0, 123456000, time.UTC)
+	cells := []cell.Cell{
+		{AddedID: 7, RowKey: uuid.New(), ColumnName: "profile", RefKey: 1, Body: json.RawMessage(`{"a":1}`), CreatedAt: created},
+		{AddedID: 9, RowKey: uuid.New(), ColumnName: "profile", RefKey: -2, Body: json.RawMessage(`[]`), CreatedAt: created.Add(time.Second)},
+	}
+	data, err := encodeParquet(cells)
+	if err != nil {
+		t.Fatalf("encodeParquet: %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte("PAR1")) || !bytes.HasSuffix(data, []byte("PAR1")) {
+		t.Fatal("missing PAR1 magic")
+	}
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := &thriftReader{b: data[len(data)-8-footerLen : len(data)-8]}
+	meta := footer.strct()
+
+	if meta[3] != int64(2) {
+		t.Errorf("num_rows: got %v, want 2", meta[3])
+	}
+	schema := meta[2].([]any)
+	if len(schema) != len(parquetColumns)+1 || schema[0].(map[int16]any)[5] != int64(len(parquetColumns)) {
+		t.Fatalf("schema: got %v", schema)
+	}
+	chunks := meta[4].([]any)[0].(map[int16]any)[1].([]any)
+	if len(chunks) != len(parquetColumns) {
+		t.Fatalf("got %d column chunks, want %d", len(chunks), len(parquetColumns))
+	}
+
+	values := make(map[string][]byte)
+	for i, col := range parquetColumns {
+		if name := schema[i+1].(map[int16]any)[4]; name != col.name {
+			t.Errorf("schema element %d: got %v, want %s", i+1, name, col.name)
+		}
+		cm := chunks[i].(map[int16]any)[3].(map[int16]any)
+		page := &thriftReader{b: data, i: int(cm[9].(int64))}
+		header := page.strct()
+		compressed := data[page.i : page.i+int(header[3].(int64))]
+		raw, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			t.Fatalf("%s: decode page: %v", col.name, err)
+		}
+		if int64(len(raw)) != header[2].(int64) || header[5].(map[int16]any)[1] != int64(2) {
+			t.Errorf("%s: page header %v does not match %d bytes, 2 values", col.name, header, len(raw))
+		}
+		if want := int64(page.i+len(compressed)) - cm[9].(int64); cm[7] != want {
+			t.Errorf("%s: total_compressed_size: got %v, want %d", col.name, cm[7], want)
+		}
+		values[col.name] = raw
+	}
+
+	if got := int64(binary.LittleEndian.Uint64(values["added_id"][8:])); got != 9 {
+		t.Errorf("added_id[1]: got %d, want 9", got)
+	}
+	if got := int64(binary.LittleEndian.Uint64(values["ref_key"][8:])); got != -2 {
+		t.Errorf("ref_key[1]: got %d, want -2", got)
+	}
+	if got := int64(binary.LittleEndian.Uint64(values["created_at"])); got != created.UnixMicro() {
+		t.Errorf("created_at[0]: got %d, want %d", got, created.UnixMicro())
+	}
+	wantBody := appendByteArray(appendByteArray(nil, `{"a":1}`), `[]`)
+	if !bytes.Equal(values["body"], wantBody) {
+		t.Errorf("body: got %q, want %q", values["body"], wantBody)
+	}
+	if got := string(values["row_key"][4:40]); got != cells[0].RowKey.String() {
+		t.Errorf("row_key[0]: got %q, want %q", got, cells[0].RowKey)
+	}
+}
@@ -0,0 +1,168 @@
+// Package fault injects latency and errors into shard stores and plugin
+// calls so resilience behaviour (retries, timeouts, failover) can be
+// exercised in integration tests. It is for development only and is enabled
+// by pointing FAULT_CONFIG_PATH at a rules file.
+package fault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrInjected is wrapped by every error the injector produces.
+var ErrInjected = errors.New("injected fault")
+
+// Store operations a rule can target.
+const (
+	OpWrite = "write" // WriteCell, WriteCells
+	OpRead  = "read"  // GetCell, GetCells, GetCellLatest, GetRow, GetRows
+	OpScan  = "scan"  // PartitionRead, ScanCells, ScanCellsWindow, ScanCommitLog, QueryCells
+	OpRPC   = "rpc"   // plugin JSON-RPC calls
+)
+
+// Config is the contents of a fault rules file.
+type Config struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Rule injects Latency and/or an error with probability ErrorRate into
+// matching calls. Selectors are ANDed; an empty selector matches everything.
+// Store rules use Shards/Backend; plugin rules use Endpoint.
+type Rule struct {
+	Shards     []int    `json:"shards,omitempty"`
+	Backend    string   `json:"backend,omitempty"`
+	Endpoint   string   `json:"endpoint,omitempty"` // plugin endpoint URL prefix
+	Operations []string `json:"operations,omitempty"`
+
+	Latency   Duration `json:"latency,omitempty"`
+	ErrorRate float64  `json:"error_rate,omitempty"` // 0.0–1.0
+	Error     string   `json:"error,omitempty"`      // message for injected errors
+}
+
+// Duration is a time.Duration that unmarshals from a string like "250ms".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string: %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Load reads and validates a rules file.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read fault config: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse fault config: %w", err)
+	}
+	for i, r := range cfg.Rules {
+		if r.ErrorRate < 0 || r.ErrorRate > 1 {
+			return nil, fmt.Errorf("rule %d: error_rate must be between 0 and 1", i)
+		}
+		if r.Latency < 0 {
+			return nil, fmt.Errorf("rule %d: latency must not be negative", i)
+		}
+		if r.Endpoint != "" && (len(r.Shards) > 0 || r.Backend != "") {
+			return nil, fmt.Errorf("rule %d: endpoint cannot be combined with shards or backend", i)
+		}
+		for _, op := range r.Operations {
+			if !slices.Contains([]string{OpWrite, OpRead, OpScan, OpRPC}, op) {
+				return nil, fmt.Errorf("rule %d: unknown operation %q", i, op)
+			}
+		}
+	}
+	return &cfg, nil
+}
+
+// Injector applies a Config.
+type Injector struct {
+	rules     []Rule
+	backendOf func(shardID int) string
+}
+
+// NewInjector creates an Injector. backendOf resolves a shard to its backend
+// name for Backend selectors; it may be nil if no rule uses one.
+func NewInjector(cfg *Config, backendOf func(shardID int) string) *Injector {
+	return &Injector{rules: cfg.Rules, backendOf: backendOf}
+}
+
+// storeFault applies every rule matching a store call.
+func (in *Injector) storeFault(ctx context.Context, shardID int, op string) error {
+	for _, r := range in.rules {
+		if r.Endpoint != "" || !matchesOp(r, op) {
+			continue
+		}
+		if len(r.Shards) > 0 && !slices.Contains(r.Shards, shardID) {
+			continue
+		}
+		if r.Backend != "" && (in.backendOf == nil || in.backendOf(shardID) != r.Backend) {
+			continue
+		}
+		if err := apply(ctx, r, fmt.Sprintf("shard %d %s", shardID, op)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rpcFault applies every rule matching a plugin call to endpoint.
+func (in *Injector) rpcFault(ctx context.Context, endpoint string) error {
+	for _, r := range in.rules {
+		if len(r.Shards) > 0 || r.Backend != "" || !matchesOp(r, OpRPC) {
+			continue
+		}
+		if !strings.HasPrefix(endpoint, r.Endpoint) {
+			continue
+		}
+		if err := apply(ctx, r, "plugin "+endpoint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func matchesOp(r Rule, op string) bool {
+	return len(r.Operations) == 0 || slices.Contains(r.Operations, op)
+}
+
+// apply sleeps for the rule's latency, then fails with its error rate.
+func apply(ctx context.Context, r Rule, target string) error {
+	if r.Latency > 0 {
+		t := time.NewTimer(time.Duration(r.Latency))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	if r.ErrorRate > 0 && rand.Float64() < r.ErrorRate {
+		msg := r.Error
+		if msg == "" {
+			msg = "simulated failure"
+		}
+		return fmt.Errorf("%s: %s: %w", target, msg, ErrInjected)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package fault
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// nopStore succeeds at everything.
+type nopStore struct{}
+
+func (nopStore) WriteCell(_ context.Context, req cell.WriteCellRequest) (*cell.Cell, error) {
+	return &cell.Cell{RowKey: req.RowKey}, nil
+}
+func (nopStore) WriteCells(context.Context, []cell.WriteCellRequest) ([]cell.Cell, error) {
+	return nil, nil
+}
+func (nopStore) GetCell(context.Context, cell.CellRef) (*cell.Cell, error) { return &cell.Cell{}, nil }
+func (nopStore) GetCells(_ context.Context, refs []cell.CellRef) ([]*cell.Cell, error) {
+	return make([]*cell.Cell, len(refs)), nil
+}
+func (nopStore) GetCellLatest(context.Context, uuid.UUID, string) (*cell.Cell, error) {
+	return &cell.Cell{}, nil
+}
+func (nopStore) GetRow(context.Context, uuid.UUID) ([]cell.Cell, error) { return nil, nil }
+func (nopStore) GetRows(context.Context, []uuid.UUID) (map[uuid.UUID][]cell.Cell, error) {
+	return nil, nil
+}
+func (nopStore) PartitionRead(context.Context, int, int, int64, time.Time, int) ([]cell.Cell, error) {
+	return nil, nil
+}
+func (nopStore) ScanCells(context.Context, string, int64, int) ([]cell.Cell, error) { return nil, nil }
+func (nopStore) ScanCellsWindow(context.Context, string, time.Time, time.Time, int64, int) ([]cell.Cell, error) {
+	return nil, nil
+}
+func (nopStore) Head(context.Context) (storage.Head, error) { return storage.Head{}, nil }
+
+func routerWith(in *Injector, shards int) *shard.Router {
+	r := shard.NewRouter()
+	r.Use(in.Interceptor())
+	for i := range shards {
+		r.Register(shard.ID(i), nopStore{})
+	}
+	return r
+}
+
+func storeFor(t *testing.T, r *shard.Router, id int) storage.CellStore {
+	t.Helper()
+	s, err := r.StoreFor(shard.ID(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestInterceptor_ErrorsOnMatchingShardAndOperation(t *testing.T) {
+	in := NewInjector(&Config{Rules: []Rule{{Shards: []int{1}, Operations: []string{OpWrite}, ErrorRate: 1}}}, nil)
+	r := routerWith(in, 2)
+	ctx := context.Background()
+
+	if _, err := storeFor(t, r, 1).WriteCell(ctx, cell.WriteCellRequest{}); !errors.Is(err, ErrInjected) {
+		t.Errorf("shard 1 write: expected ErrInjected, got %v", err)
+	}
+	if _, err := storeFor(t, r, 1).GetRow(ctx, uuid.New()); err != nil {
+		t.Errorf("shard 1 read: expected no fault, got %v", err)
+	}
+	if _, err := storeFor(t, r, 0).WriteCell(ctx, cell.WriteCellRequest{}); err != nil {
+		t.Errorf("shard 0 write: expected no fault, got %v", err)
+	}
+}
+
+func TestInterceptor_BackendSelector(t *testing.T) {
+	backendOf := func(id int) string {
+		if id < 2 {
+			return "a"
+		}
+		return "b"
+	}
+	in := NewInjector(&Config{Rules: []Rule{{Backend: "b", ErrorRate: 1, Error: "backend down"}}}, backendOf)
+	r := routerWith(in, 4)
+
+	if _, err := storeFor(t, r, 0).GetRow(context.Background(), uuid.New()); err != nil {
+		t.Errorf("backend a: expected no fault, got %v", err)
+	}
+	_, err := storeFor(t, r, 3).GetRow(context.Background(), uuid.New())
+	if !errors.Is(err, ErrInjected) {
+		t.Fatalf("backend b: expected ErrInjected, got %v", err)
+	}
+	if got := err.Error(); got != "shard 3 read: backend down: injected fault" {
+		t.Errorf("error message: got %q", got)
+	}
+}
+
+func TestInterceptor_LatencyRespectsContext(t *testing.T) {
+	in := NewInjector(&Config{Rules: []Rule{{Latency: Duration(time.Hour)}}}, nil)
+	r := routerWith(in, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := storeFor(t, r, 0).ScanCells(ctx, "col", 0, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestTransport_MatchesEndpointPrefix(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	in := NewInjector(&Config{Rules: []Rule{{Endpoint: srv.URL + "/billing", ErrorRate: 1}}}, nil)
+	client := &http.Client{Transport: in.Transport(nil)}
+
+	if _, err := client.Get(srv.URL + "/billing/rpc"); !errors.Is(err, ErrInjected) {
+		t.Errorf("billing: expected ErrInjected, got %v", err)
+	}
+	resp, err := client.Get(srv.URL + "/audit")
+	if err != nil {
+		t.Fatalf("audit: expected no fault, got %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "faults.json")
+	os.WriteFile(path, []byte(`{"rules":[{"shards":[0],"latency":"250ms","error_rate":0.5}]}`), 0o644) //nolint:errcheck
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(cfg.Rules) != 1 || time.Duration(cfg.Rules[0].Latency) != 250*time.Millisecond || cfg.Rules[0].ErrorRate != 0.5 {
+		t.Errorf("got %+v", cfg.Rules)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	for name, body := range map[string]string{
+		"error rate":         `{"rules":[{"error_rate":2}]}`,
+		"operation":          `{"rules":[{"operations":["delete"]}]}`,
+		"latency":            `{"rules":[{"latency":"soon"}]}`,
+		"endpoint and shard": `{"rules":[{"endpoint":"http://x","shards":[1]}]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "faults.json")
+			os.WriteFile(path, []byte(body), 0o644) //nolint:errcheck
+			if _, err := Load(path); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package fault
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// Interceptor returns a shard.Router interceptor that applies store rules.
+func (in *Injector) Interceptor() shard.Interceptor {
+	return func(id shard.ID, store storage.CellStore) storage.CellStore {
+		return &faultStore{next: store, shardID: int(id), in: in}
+	}
+}
+
+// faultStore runs matching rules before delegating each call.
+type faultStore struct {
+	next    storage.CellStore
+	shardID int
+	in      *Injector
+}
+
+func (s *faultStore) WriteCell(ctx context.Context, req cell.WriteCellRequest) (*cell.Cell, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpWrite); err != nil {
+		return nil, err
+	}
+	return s.next.WriteCell(ctx, req)
+}
+
+func (s *faultStore) WriteCells(ctx context.Context, reqs []cell.WriteCellRequest) ([]cell.Cell, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpWrite); err != nil {
+		return nil, err
+	}
+	return s.next.WriteCells(ctx, reqs)
+}
+
+func (s *faultStore) GetCell(ctx context.Context, ref cell.CellRef) (*cell.Cell, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpRead); err != nil {
+		return nil, err
+	}
+	return s.next.GetCell(ctx, ref)
+}
+
+func (s *faultStore) GetCells(ctx context.Context, refs []cell.CellRef) ([]*cell.Cell, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpRead); err != nil {
+		return nil, err
+	}
+	return s.next.GetCells(ctx, refs)
+}
+
+func (s *faultStore) GetCellLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpRead); err != nil {
+		return nil, err
+	}
+	return s.next.GetCellLatest(ctx, rowKey, columnName)
+}
+
+func (s *faultStore) GetRow(ctx context.Context, rowKey uuid.UUID) ([]cell.Cell, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpRead); err != nil {
+		return nil, err
+	}
+	return s.next.GetRow(ctx, rowKey)
+}
+
+func (s *faultStore) GetRows(ctx context.Context, rowKeys []uuid.UUID) (map[uuid.UUID][]cell.Cell, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpRead); err != nil {
+		return nil, err
+	}
+	return s.next.GetRows(ctx, rowKeys)
+}
+
+func (s *faultStore) PartitionRead(ctx context.Context, partitionNumber int, readType int, addedID int64, createdAfter time.Time, limit int) ([]cell.Cell, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpScan); err != nil {
+		return nil, err
+	}
+	return s.next.PartitionRead(ctx, partitionNumber, readType, addedID, createdAfter, limit)
+}
+
+func (s *faultStore) ScanCells(ctx context.Context, columnName string, afterAddedID int64, limit int) ([]cell.Cell, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpScan); err != nil {
+		return nil, err
+	}
+	return s.next.ScanCells(ctx, columnName, afterAddedID, limit)
+}
+
+func (s *faultStore) ScanCellsWindow(ctx context.Context, columnName string, from, to time.Time, afterAddedID int64, limit int) ([]cell.Cell, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpScan); err != nil {
+		return nil, err
+	}
+	return s.next.ScanCellsWindow(ctx, columnName, from, to, afterAddedID, limit)
+}
+
+func (s *faultStore) Head(ctx context.Context) (storage.Head, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpRead); err != nil {
+		return storage.Head{}, err
+	}
+	return s.next.Head(ctx)
+}
+
+func (s *faultStore) CommittedHead(ctx context.Context) (int64, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpRead); err != nil {
+		return 0, err
+	}
+	return storage.CommittedHead(ctx, s.next)
+}
+
+func (s *faultStore) ScanCommitLog(ctx context.Context, fromAddedID, afterSeq int64, limit int) ([]cell.Cell, int64, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpScan); err != nil {
+		return nil, 0, err
+	}
+	return storage.ScanCommitLog(ctx, s.next, fromAddedID, afterSeq, limit)
+}
+
+func (s *faultStore) StreamRow(ctx context.Context, rowKey uuid.UUID) (storage.CellIterator, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpRead); err != nil {
+		return nil, err
+	}
+	return storage.StreamRow(ctx, s.next, rowKey)
+}
+
+func (s *faultStore) StreamRowColumns(ctx context.Context, rowKey uuid.UUID, columns []string) (storage.CellIterator, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpRead); err != nil {
+		return nil, err
+	}
+	return storage.StreamRowColumns(ctx, s.next, rowKey, columns)
+}
+
+func (s *faultStore) StreamPartition(ctx context.Context, partitionNumber int, readType int, addedID int64, createdAfter time.Time, limit int) (storage.CellIterator, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpScan); err != nil {
+		return nil, err
+	}
+	return storage.StreamPartition(ctx, s.next, partitionNumber, readType, addedID, createdAfter, limit)
+}
+
+func (s *faultStore) WriteBlob(ctx context.Context, req cell.WriteCellRequest, data []byte) (*cell.Cell, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpWrite); err != nil {
+		return nil, err
+	}
+	return storage.WriteBlob(ctx, s.next, req, data)
+}
+
+func (s *faultStore) UpdateCell(ctx context.Context, rowKey uuid.UUID, columnName string, apply storage.UpdateFunc) (*cell.Cell, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpWrite); err != nil {
+		return nil, err
+	}
+	return storage.UpdateCell(ctx, s.next, rowKey, columnName, apply)
+}
+
+func (s *faultStore) GetBlob(ctx context.Context, ref cell.CellRef) (*cell.Cell, []byte, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpRead); err != nil {
+		return nil, nil, err
+	}
+	return storage.GetBlob(ctx, s.next, ref)
+}
+
+func (s *faultStore) GetBlobLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, []byte, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpRead); err != nil {
+		return nil, nil, err
+	}
+	return storage.GetBlobLatest(ctx, s.next, rowKey, columnName)
+}
+
+func (s *faultStore) PutAlias(ctx context.Context, alias string, rowKey uuid.UUID) (*storage.Alias, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpWrite); err != nil {
+		return nil, err
+	}
+	return storage.PutAlias(ctx, s.next, alias, rowKey)
+}
+
+func (s *faultStore) GetAlias(ctx context.Context, alias string) (*storage.Alias, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpRead); err != nil {
+		return nil, err
+	}
+	return storage.GetAlias(ctx, s.next, alias)
+}
+
+func (s *faultStore) DeleteAlias(ctx context.Context, alias string) error {
+	if err := s.in.storeFault(ctx, s.shardID, OpWrite); err != nil {
+		return err
+	}
+	return storage.DeleteAlias(ctx, s.next, alias)
+}
+
+func (s *faultStore) SetRowTags(ctx context.Context, rowKey uuid.UUID, tags []string) error {
+	if err := s.in.storeFault(ctx, s.shardID, OpWrite); err != nil {
+		return err
+	}
+	return storage.SetRowTags(ctx, s.next, rowKey, tags)
+}
+
+func (s *faultStore) RecordIdempotencyKey(ctx context.Context, key string, hash []byte) error {
+	if err := s.in.storeFault(ctx, s.shardID, OpWrite); err != nil {
+		return err
+	}
+	return storage.RecordIdempotencyKey(ctx, s.next, key, hash)
+}
+
+func (s *faultStore) IdempotencyKeyHash(ctx context.Context, key string) ([]byte, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpRead); err != nil {
+		return nil, err
+	}
+	return storage.IdempotencyKeyHash(ctx, s.next, key)
+}
+
+func (s *faultStore) RowsByTag(ctx context.Context, tag string, after uuid.UUID, limit int) ([]uuid.UUID, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpRead); err != nil {
+		return nil, err
+	}
+	return storage.RowsByTag(ctx, s.next, tag, after, limit)
+}
+
+func (s *faultStore) QueryCells(ctx context.Context, q storage.Query) ([]cell.Cell, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpScan); err != nil {
+		return nil, err
+	}
+	return storage.QueryCells(ctx, s.next, q)
+}
+
+func (s *faultStore) ProbeCellLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpRead); err != nil {
+		return nil, err
+	}
+	return storage.ProbeCellLatest(ctx, s.next, rowKey, columnName)
+}
+
+func (s *faultStore) ProbeRow(ctx context.Context, rowKey uuid.UUID, withSystem bool) (storage.RowSummary, error) {
+	if err := s.in.storeFault(ctx, s.shardID, OpRead); err != nil {
+		return storage.RowSummary{}, err
+	}
+	return storage.ProbeRow(ctx, s.next, rowKey, withSystem)
+}
+
+// WaitHead passes through: waiting issues no query to fail.
+func (s *faultStore) WaitHead(ctx context.Context, afterAddedID int64) (int64, error) {
+	return storage.WaitHead(ctx, s.next, afterAddedID)
+}
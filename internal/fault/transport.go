@@ -0,0 +1,26 @@
+package fault
+
+import (
+	"net/http"
+)
+
+// Transport returns an http.RoundTripper that applies plugin rules before
+// delegating to next (http.DefaultTransport if nil). Install it on the
+// trigger RPC client.
+func (in *Injector) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if err := in.rpcFault(req.Context(), req.URL.String()); err != nil {
+			return nil, err
+		}
+		return next.RoundTrip(req)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,260 @@
+// Package fence rejects writes to columns or shards under maintenance.
+//
+// An operator fences a column, a shard, or one column on one shard before
+// maintenance such as a compaction or a migration cutover, and removes the
+// fence afterwards. Writes the fence covers fail with an *Error, which the
+// API answers with 503 and the fence's Retry-After, while reads and every
+// other write carry on. Fences are kept in the metadata database and
+// reloaded periodically, so a fence set on one instance takes up to the
+// refresh interval to reach the others. A fence may expire, so that one
+// forgotten after maintenance does not block writes for good.
+package fence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	fencedWrites = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "mezzanine",
+			Name:      "fenced_writes_total",
+			Help:      "Writes rejected because their column or shard was fenced for maintenance.",
+		},
+	)
+	activeFences = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "mezzanine",
+			Name:      "write_fences",
+			Help:      "Write fences this instance enforces, as of its last reload.",
+		},
+	)
+)
+
+// DefaultRetryAfter is the Retry-After of writes rejected by a fence that
+// does not set one.
+const DefaultRetryAfter = time.Minute
+
+// Fence rejects writes to Column on Shard. An empty Column covers every
+// column and a nil Shard every shard, but not both.
+type Fence struct {
+	Column string `json:"column,omitempty"`
+	Shard  *int   `json:"shard,omitempty"`
+	// Reason is shown to rejected clients.
+	Reason string `json:"reason"`
+	// RetryAfterSeconds is how long rejected clients are told to wait;
+	// zero means DefaultRetryAfter.
+	RetryAfterSeconds int `json:"retry_after_seconds"`
+	// ExpiresAt lifts the fence at that time; zero never does.
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Check reports an error if the fence covers nothing or has a negative
+// shard or Retry-After.
+func (f Fence) Check() error {
+	if f.Column == "" && f.Shard == nil {
+		return errors.New("a fence needs a column, a shard or both")
+	}
+	if f.Shard != nil && *f.Shard < 0 {
+		return fmt.Errorf("shard must not be negative, got %d", *f.Shard)
+	}
+	if f.RetryAfterSeconds < 0 {
+		return fmt.Errorf("retry_after_seconds must not be negative, got %d", f.RetryAfterSeconds)
+	}
+	return nil
+}
+
+// RetryAfter is how long clients rejected by the fence should wait.
+func (f Fence) RetryAfter() time.Duration {
+	if f.RetryAfterSeconds == 0 {
+		return DefaultRetryAfter
+	}
+	return time.Duration(f.RetryAfterSeconds) * time.Second
+}
+
+// covers reports whether the fence rejects a write to column on shardID at
+// time now. Writes without a column, such as aliases, are covered only by
+// fences of a whole shard.
+func (f Fence) covers(shardID int, column string, now time.Time) bool {
+	if !f.ExpiresAt.IsZero() && !now.Before(f.ExpiresAt) {
+		return false
+	}
+	return (f.Shard == nil || *f.Shard == shardID) && (f.Column == "" || f.Column == column)
+}
+
+// sameScope reports whether two fences cover the same column and shard.
+func (f Fence) sameScope(g Fence) bool {
+	return f.Column == g.Column && shardKey(f.Shard) == shardKey(g.Shard)
+}
+
+// shardKey is the shard of a fence as stored: -1 for every shard.
+func shardKey(shard *int) int {
+	if shard == nil {
+		return -1
+	}
+	return *shard
+}
+
+// Error is returned for writes a fence rejects.
+type Error struct {
+	Fence Fence
+}
+
+func (e *Error) Error() string {
+	var scope []string
+	if e.Fence.Column != "" {
+		scope = append(scope, fmt.Sprintf("column %q", e.Fence.Column))
+	}
+	if e.Fence.Shard != nil {
+		scope = append(scope, fmt.Sprintf("shard %d", *e.Fence.Shard))
+	}
+	msg := "writes to " + strings.Join(scope, " on ") + " are fenced for maintenance"
+	if e.Fence.Reason != "" {
+		msg += ": " + e.Fence.Reason
+	}
+	return msg
+}
+
+// Registry holds the fences in force. Check is lock-free, since every
+// write calls it.
+type Registry struct {
+	mu     sync.Mutex // serializes changes
+	fences atomic.Pointer[[]Fence]
+	store  Store // optional; nil means in-memory only
+	now    func() time.Time
+}
+
+// NewRegistry creates a registry without fences.
+// An optional Store enables persistence.
+func NewRegistry(store ...Store) *Registry {
+	r := &Registry{now: time.Now}
+	if len(store) > 0 && store[0] != nil {
+		r.store = store[0]
+	}
+	r.fences.Store(&[]Fence{})
+	return r
+}
+
+// LoadAll replaces the registry's fences with those in the backing store,
+// picking up fences set and removed on other instances. It is a no-op if
+// no store is configured.
+func (r *Registry) LoadAll(ctx context.Context) error {
+	if r.store == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fences, err := r.store.ListFences(ctx)
+	if err != nil {
+		return fmt.Errorf("load fences: %w", err)
+	}
+	r.fences.Store(&fences)
+	activeFences.Set(float64(len(fences)))
+	return nil
+}
+
+// List returns the fences in force, by column then shard.
+func (r *Registry) List() []Fence {
+	now := r.now()
+	out := []Fence{}
+	for _, f := range *r.fences.Load() {
+		if f.ExpiresAt.IsZero() || now.Before(f.ExpiresAt) {
+			out = append(out, f)
+		}
+	}
+	slices.SortFunc(out, func(a, b Fence) int {
+		if c := strings.Compare(a.Column, b.Column); c != 0 {
+			return c
+		}
+		return shardKey(a.Shard) - shardKey(b.Shard)
+	})
+	return out
+}
+
+// Set fences writes, replacing any fence of the same column and shard.
+func (r *Registry) Set(ctx context.Context, f Fence) (Fence, error) {
+	if err := f.Check(); err != nil {
+		return Fence{}, err
+	}
+	f.CreatedAt = r.now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.store != nil {
+		if err := r.store.SaveFence(ctx, f); err != nil {
+			return Fence{}, fmt.Errorf("persist fence: %w", err)
+		}
+	}
+	fences := slices.DeleteFunc(slices.Clone(*r.fences.Load()), f.sameScope)
+	fences = append(fences, f)
+	r.fences.Store(&fences)
+	activeFences.Set(float64(len(fences)))
+	return f, nil
+}
+
+// Remove lifts the fence of column on shard (nil for every shard). It
+// reports whether there was one, on any instance.
+func (r *Registry) Remove(ctx context.Context, column string, shard *int) (bool, error) {
+	scope := Fence{Column: column, Shard: shard}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := *r.fences.Load()
+	fences := slices.DeleteFunc(slices.Clone(old), scope.sameScope)
+	removed := len(fences) < len(old)
+	if r.store != nil {
+		var err error
+		if removed, err = r.store.DeleteFence(ctx, column, shardKey(shard)); err != nil {
+			return false, fmt.Errorf("delete fence: %w", err)
+		}
+	}
+	r.fences.Store(&fences)
+	activeFences.Set(float64(len(fences)))
+	return removed, nil
+}
+
+// Check returns an *Error if a fence rejects a write to column on shardID;
+// column is empty for writes that belong to no column.
+func (r *Registry) Check(shardID int, column string) error {
+	fences := *r.fences.Load()
+	if len(fences) == 0 {
+		return nil
+	}
+	now := r.now()
+	for _, f := range fences {
+		if f.covers(shardID, column, now) {
+			fencedWrites.Inc()
+			return &Error{Fence: f}
+		}
+	}
+	return nil
+}
+
+// Run reloads the fences every interval until ctx is cancelled.
+func (r *Registry) Run(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	if r.store == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.LoadAll(ctx); err != nil {
+				logger.Error("failed to reload write fences", "error", err)
+			}
+		}
+	}
+}
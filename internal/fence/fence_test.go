@@ -0,0 +1,178 @@
+package fence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+)
+
+// mockStore is an in-memory implementation of Store for testing.
+type mockStore struct {
+	fences []Fence
+}
+
+func (m *mockStore) ListFences(context.Context) ([]Fence, error) {
+	return append([]Fence{}, m.fences...), nil
+}
+
+func (m *mockStore) SaveFence(ctx context.Context, f Fence) error {
+	m.DeleteFence(ctx, f.Column, shardKey(f.Shard)) //nolint:errcheck
+	m.fences = append(m.fences, f)
+	return nil
+}
+
+func (m *mockStore) DeleteFence(_ context.Context, column string, shard int) (bool, error) {
+	for i, f := range m.fences {
+		if f.Column == column && shardKey(f.Shard) == shard {
+			m.fences = append(m.fences[:i], m.fences[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func ptr(i int) *int { return &i }
+
+func storeFor(t *testing.T, r *shard.Router, id int) storage.CellStore {
+	t.Helper()
+	s, err := r.StoreFor(shard.ID(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func write(column string) cell.WriteCellRequest {
+	return cell.WriteCellRequest{RowKey: uuid.New(), ColumnName: column, RefKey: 1, Body: json.RawMessage(`{}`)}
+}
+
+func TestFence_Check(t *testing.T) {
+	for _, f := range []Fence{
+		{},
+		{Shard: ptr(-1)},
+		{Column: "profile", RetryAfterSeconds: -1},
+	} {
+		if err := f.Check(); err == nil {
+			t.Errorf("%+v: expected error", f)
+		}
+	}
+	if err := (Fence{Column: "profile", Shard: ptr(3)}).Check(); err != nil {
+		t.Errorf("column on shard: %v", err)
+	}
+}
+
+func TestInterceptor_RejectsFencedWrites(t *testing.T) {
+	fences := NewRegistry()
+	r := shard.NewRouter()
+	r.Use(fences.Interceptor())
+	for i := range 2 {
+		r.Register(shard.ID(i), memory.New())
+	}
+	ctx := context.Background()
+	if _, err := fences.Set(ctx, Fence{Column: "profile", Reason: "migrating", RetryAfterSeconds: 30}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if _, err := fences.Set(ctx, Fence{Shard: ptr(1)}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	var fe *Error
+	if _, err := storeFor(t, r, 0).WriteCell(ctx, write("profile")); !errors.As(err, &fe) || fe.Fence.RetryAfter() != 30*time.Second {
+		t.Errorf("fenced column: got %v", err)
+	} else if want := `writes to column "profile" are fenced for maintenance: migrating`; err.Error() != want {
+		t.Errorf("message: got %q, want %q", err, want)
+	}
+	if _, err := storeFor(t, r, 0).WriteCells(ctx, []cell.WriteCellRequest{write("orders"), write("profile")}); !errors.As(err, &fe) {
+		t.Errorf("batch with a fenced cell: got %v", err)
+	}
+	if _, err := storeFor(t, r, 0).WriteCell(ctx, write("orders")); err != nil {
+		t.Errorf("other column: %v", err)
+	}
+	if err := storage.SetRowTags(ctx, storeFor(t, r, 0), uuid.New(), []string{"vip"}); err != nil {
+		t.Errorf("tags on an unfenced shard: %v", err)
+	}
+	if _, err := storeFor(t, r, 1).WriteCell(ctx, write("orders")); !errors.As(err, &fe) || fe.Fence.RetryAfter() != DefaultRetryAfter {
+		t.Errorf("fenced shard: got %v", err)
+	}
+	if _, err := storage.PutAlias(ctx, storeFor(t, r, 1), "alice", uuid.New()); !errors.As(err, &fe) {
+		t.Errorf("alias on a fenced shard: got %v", err)
+	}
+	if _, err := storeFor(t, r, 1).GetRow(ctx, uuid.New()); err != nil {
+		t.Errorf("read on a fenced shard: %v", err)
+	}
+
+	if ok, err := fences.Remove(ctx, "", ptr(1)); err != nil || !ok {
+		t.Fatalf("Remove: %v, %v", ok, err)
+	}
+	if _, err := storeFor(t, r, 1).WriteCell(ctx, write("orders")); err != nil {
+		t.Errorf("after removal: %v", err)
+	}
+}
+
+func TestRegistry_Expiry(t *testing.T) {
+	fences := NewRegistry()
+	now := time.Date(2026, 2, 6, 12, 0, 0, 0, time.UTC)
+	fences.now = func() time.Time { return now }
+	if _, err := fences.Set(context.Background(), Fence{Column: "profile", ExpiresAt: now.Add(time.Hour)}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := fences.Check(0, "profile"); err == nil {
+		t.Error("expected the fence to hold before it expires")
+	}
+	now = now.Add(time.Hour)
+	if err := fences.Check(0, "profile"); err != nil {
+		t.Errorf("expired fence: %v", err)
+	}
+	if list := fences.List(); len(list) != 0 {
+		t.Errorf("List = %+v, want no expired fences", list)
+	}
+}
+
+func TestRegistry_SetReplacesAndLoads(t *testing.T) {
+	store := &mockStore{}
+	ctx := context.Background()
+	a, b := NewRegistry(store), NewRegistry(store)
+
+	if _, err := a.Set(ctx, Fence{Column: "profile", Shard: ptr(2), Reason: "first"}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if _, err := a.Set(ctx, Fence{Column: "profile", Shard: ptr(2), Reason: "second"}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if list := a.List(); len(list) != 1 || list[0].Reason != "second" {
+		t.Errorf("List = %+v, want the fence replaced", list)
+	}
+
+	if err := b.Check(2, "profile"); err != nil {
+		t.Fatalf("b enforces a fence before loading it: %v", err)
+	}
+	if err := b.LoadAll(ctx); err != nil {
+		t.Fatalf("LoadAll: %v", err)
+	}
+	if err := b.Check(2, "profile"); err == nil {
+		t.Error("b does not enforce a loaded fence")
+	}
+	if err := b.Check(1, "profile"); err != nil {
+		t.Errorf("other shard: %v", err)
+	}
+
+	// A fence set elsewhere can be removed before it is loaded.
+	c := NewRegistry(store)
+	if ok, err := c.Remove(ctx, "profile", ptr(2)); err != nil || !ok {
+		t.Errorf("Remove: %v, %v; want removed", ok, err)
+	}
+}
+
+func TestRegistry_SetRejectsInvalid(t *testing.T) {
+	if _, err := NewRegistry().Set(context.Background(), Fence{Reason: "everything"}); err == nil {
+		t.Error("expected error for a fence without column or shard")
+	}
+}
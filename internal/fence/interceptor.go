@@ -0,0 +1,178 @@
+package fence
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// Interceptor returns a shard.Router interceptor that rejects fenced
+// writes before they reach the store.
+func (r *Registry) Interceptor() shard.Interceptor {
+	return func(id shard.ID, store storage.CellStore) storage.CellStore {
+		return &fencedStore{next: store, shardID: int(id), fences: r}
+	}
+}
+
+// fencedStore checks writes against the fences and passes reads through.
+type fencedStore struct {
+	next    storage.CellStore
+	shardID int
+	fences  *Registry
+}
+
+func (s *fencedStore) WriteCell(ctx context.Context, req cell.WriteCellRequest) (*cell.Cell, error) {
+	if err := s.fences.Check(s.shardID, req.ColumnName); err != nil {
+		return nil, err
+	}
+	return s.next.WriteCell(ctx, req)
+}
+
+// WriteCells rejects the whole batch if any of its cells is fenced, since
+// batches are stored entirely or not at all.
+func (s *fencedStore) WriteCells(ctx context.Context, reqs []cell.WriteCellRequest) ([]cell.Cell, error) {
+	for _, req := range reqs {
+		if err := s.fences.Check(s.shardID, req.ColumnName); err != nil {
+			return nil, err
+		}
+	}
+	return s.next.WriteCells(ctx, reqs)
+}
+
+func (s *fencedStore) GetCell(ctx context.Context, ref cell.CellRef) (*cell.Cell, error) {
+	return s.next.GetCell(ctx, ref)
+}
+
+func (s *fencedStore) GetCells(ctx context.Context, refs []cell.CellRef) ([]*cell.Cell, error) {
+	return s.next.GetCells(ctx, refs)
+}
+
+func (s *fencedStore) GetCellLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, error) {
+	return s.next.GetCellLatest(ctx, rowKey, columnName)
+}
+
+func (s *fencedStore) GetRow(ctx context.Context, rowKey uuid.UUID) ([]cell.Cell, error) {
+	return s.next.GetRow(ctx, rowKey)
+}
+
+func (s *fencedStore) GetRows(ctx context.Context, rowKeys []uuid.UUID) (map[uuid.UUID][]cell.Cell, error) {
+	return s.next.GetRows(ctx, rowKeys)
+}
+
+func (s *fencedStore) PartitionRead(ctx context.Context, partitionNumber int, readType int, addedID int64, createdAfter time.Time, limit int) ([]cell.Cell, error) {
+	return s.next.PartitionRead(ctx, partitionNumber, readType, addedID, createdAfter, limit)
+}
+
+func (s *fencedStore) ScanCells(ctx context.Context, columnName string, afterAddedID int64, limit int) ([]cell.Cell, error) {
+	return s.next.ScanCells(ctx, columnName, afterAddedID, limit)
+}
+
+func (s *fencedStore) ScanCellsWindow(ctx context.Context, columnName string, from, to time.Time, afterAddedID int64, limit int) ([]cell.Cell, error) {
+	return s.next.ScanCellsWindow(ctx, columnName, from, to, afterAddedID, limit)
+}
+
+func (s *fencedStore) Head(ctx context.Context) (storage.Head, error) {
+	return s.next.Head(ctx)
+}
+
+func (s *fencedStore) CommittedHead(ctx context.Context) (int64, error) {
+	return storage.CommittedHead(ctx, s.next)
+}
+
+func (s *fencedStore) ScanCommitLog(ctx context.Context, fromAddedID, afterSeq int64, limit int) ([]cell.Cell, int64, error) {
+	return storage.ScanCommitLog(ctx, s.next, fromAddedID, afterSeq, limit)
+}
+
+func (s *fencedStore) StreamRow(ctx context.Context, rowKey uuid.UUID) (storage.CellIterator, error) {
+	return storage.StreamRow(ctx, s.next, rowKey)
+}
+
+func (s *fencedStore) StreamRowColumns(ctx context.Context, rowKey uuid.UUID, columns []string) (storage.CellIterator, error) {
+	return storage.StreamRowColumns(ctx, s.next, rowKey, columns)
+}
+
+func (s *fencedStore) StreamPartition(ctx context.Context, partitionNumber int, readType int, addedID int64, createdAfter time.Time, limit int) (storage.CellIterator, error) {
+	return storage.StreamPartition(ctx, s.next, partitionNumber, readType, addedID, createdAfter, limit)
+}
+
+func (s *fencedStore) WriteBlob(ctx context.Context, req cell.WriteCellRequest, data []byte) (*cell.Cell, error) {
+	if err := s.fences.Check(s.shardID, req.ColumnName); err != nil {
+		return nil, err
+	}
+	return storage.WriteBlob(ctx, s.next, req, data)
+}
+
+func (s *fencedStore) UpdateCell(ctx context.Context, rowKey uuid.UUID, columnName string, apply storage.UpdateFunc) (*cell.Cell, error) {
+	if err := s.fences.Check(s.shardID, columnName); err != nil {
+		return nil, err
+	}
+	return storage.UpdateCell(ctx, s.next, rowKey, columnName, apply)
+}
+
+func (s *fencedStore) GetBlob(ctx context.Context, ref cell.CellRef) (*cell.Cell, []byte, error) {
+	return storage.GetBlob(ctx, s.next, ref)
+}
+
+func (s *fencedStore) GetBlobLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, []byte, error) {
+	return storage.GetBlobLatest(ctx, s.next, rowKey, columnName)
+}
+
+func (s *fencedStore) PutAlias(ctx context.Context, alias string, rowKey uuid.UUID) (*storage.Alias, error) {
+	if err := s.fences.Check(s.shardID, ""); err != nil {
+		return nil, err
+	}
+	return storage.PutAlias(ctx, s.next, alias, rowKey)
+}
+
+func (s *fencedStore) GetAlias(ctx context.Context, alias string) (*storage.Alias, error) {
+	return storage.GetAlias(ctx, s.next, alias)
+}
+
+func (s *fencedStore) DeleteAlias(ctx context.Context, alias string) error {
+	if err := s.fences.Check(s.shardID, ""); err != nil {
+		return err
+	}
+	return storage.DeleteAlias(ctx, s.next, alias)
+}
+
+func (s *fencedStore) SetRowTags(ctx context.Context, rowKey uuid.UUID, tags []string) error {
+	if err := s.fences.Check(s.shardID, ""); err != nil {
+		return err
+	}
+	return storage.SetRowTags(ctx, s.next, rowKey, tags)
+}
+
+func (s *fencedStore) RecordIdempotencyKey(ctx context.Context, key string, hash []byte) error {
+	if err := s.fences.Check(s.shardID, ""); err != nil {
+		return err
+	}
+	return storage.RecordIdempotencyKey(ctx, s.next, key, hash)
+}
+
+func (s *fencedStore) IdempotencyKeyHash(ctx context.Context, key string) ([]byte, error) {
+	return storage.IdempotencyKeyHash(ctx, s.next, key)
+}
+
+func (s *fencedStore) RowsByTag(ctx context.Context, tag string, after uuid.UUID, limit int) ([]uuid.UUID, error) {
+	return storage.RowsByTag(ctx, s.next, tag, after, limit)
+}
+
+func (s *fencedStore) QueryCells(ctx context.Context, q storage.Query) ([]cell.Cell, error) {
+	return storage.QueryCells(ctx, s.next, q)
+}
+
+func (s *fencedStore) ProbeCellLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, error) {
+	return storage.ProbeCellLatest(ctx, s.next, rowKey, columnName)
+}
+
+func (s *fencedStore) ProbeRow(ctx context.Context, rowKey uuid.UUID, withSystem bool) (storage.RowSummary, error) {
+	return storage.ProbeRow(ctx, s.next, rowKey, withSystem)
+}
+
+func (s *fencedStore) WaitHead(ctx context.Context, afterAddedID int64) (int64, error) {
+	return storage.WaitHead(ctx, s.next, afterAddedID)
+}
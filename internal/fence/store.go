@@ -0,0 +1,108 @@
+package fence
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Store is a persistent storage interface for write fences.
+type Store interface {
+	// ListFences returns the fences that have not expired.
+	ListFences(ctx context.Context) ([]Fence, error)
+	// SaveFence creates or replaces the fence of f's column and shard.
+	SaveFence(ctx context.Context, f Fence) error
+	// DeleteFence removes the fence of column on shard, -1 for every shard,
+	// and reports whether there was one.
+	DeleteFence(ctx context.Context, column string, shard int) (bool, error)
+}
+
+// PostgresStore implements Store backed by the write_fences table (see
+// storage.RunFenceMigration). Fences of every column or every shard are
+// stored with an empty column or shard -1, so that each scope has one key.
+type PostgresStore struct {
+	pool         *pgxpool.Pool
+	queryTimeout time.Duration
+}
+
+// NewPostgresStore creates a Store using the given connection pool.
+// queryTimeout sets the per-query context deadline; zero means no timeout.
+func NewPostgresStore(pool *pgxpool.Pool, queryTimeout time.Duration) *PostgresStore {
+	return &PostgresStore{pool: pool, queryTimeout: queryTimeout}
+}
+
+func (s *PostgresStore) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.queryTimeout > 0 {
+		return context.WithTimeout(ctx, s.queryTimeout)
+	}
+	return ctx, func() {}
+}
+
+func (s *PostgresStore) ListFences(ctx context.Context) ([]Fence, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT column_name, shard_id, reason, retry_after_seconds, expires_at, created_at
+		FROM write_fences
+		WHERE expires_at IS NULL OR expires_at > now()
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("list fences: %w", err)
+	}
+	defer rows.Close()
+
+	fences := []Fence{}
+	for rows.Next() {
+		var f Fence
+		var shard int
+		var expiresAt *time.Time
+		if err := rows.Scan(&f.Column, &shard, &f.Reason, &f.RetryAfterSeconds, &expiresAt, &f.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan fence: %w", err)
+		}
+		if shard >= 0 {
+			f.Shard = &shard
+		}
+		if expiresAt != nil {
+			f.ExpiresAt = *expiresAt
+		}
+		fences = append(fences, f)
+	}
+	return fences, rows.Err()
+}
+
+func (s *PostgresStore) SaveFence(ctx context.Context, f Fence) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var expiresAt *time.Time
+	if !f.ExpiresAt.IsZero() {
+		expiresAt = &f.ExpiresAt
+	}
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO write_fences (column_name, shard_id, reason, retry_after_seconds, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (column_name, shard_id) DO UPDATE SET
+			reason = EXCLUDED.reason,
+			retry_after_seconds = EXCLUDED.retry_after_seconds,
+			expires_at = EXCLUDED.expires_at,
+			created_at = EXCLUDED.created_at
+	`, f.Column, shardKey(f.Shard), f.Reason, f.RetryAfterSeconds, expiresAt, f.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("save fence: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) DeleteFence(ctx context.Context, column string, shard int) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := s.pool.Exec(ctx, `DELETE FROM write_fences WHERE column_name = $1 AND shard_id = $2`, column, shard)
+	if err != nil {
+		return false, fmt.Errorf("delete fence: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
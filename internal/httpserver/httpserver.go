@@ -0,0 +1,159 @@
+// Package httpserver builds the public HTTP server: protocol selection
+// (HTTP/1.1 plus cleartext HTTP/2), header and connection limits, and
+// connection draining for rolling deploys.
+package httpserver
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Options configures New and Listen.
+type Options struct {
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// MaxHeaderBytes bounds request headers; 0 uses net/http's 1 MiB default.
+	MaxHeaderBytes int
+	// HTTP2 accepts cleartext HTTP/2 (h2c, prior knowledge) alongside
+	// HTTP/1.1, for load balancers and clients that multiplex requests.
+	HTTP2 bool
+	// MaxConns bounds concurrently open connections; 0 is unlimited.
+	// Connections beyond the limit wait in the kernel accept queue.
+	MaxConns int
+}
+
+// New returns an http.Server for handler configured from opts.
+func New(addr string, handler http.Handler, opts Options) *http.Server {
+	srv := &http.Server{
+		Addr:           addr,
+		Handler:        handler,
+		ReadTimeout:    opts.ReadTimeout,
+		WriteTimeout:   opts.WriteTimeout,
+		IdleTimeout:    opts.IdleTimeout,
+		MaxHeaderBytes: opts.MaxHeaderBytes,
+	}
+	if opts.HTTP2 {
+		var p http.Protocols
+		p.SetHTTP1(true)
+		p.SetUnencryptedHTTP2(true)
+		srv.Protocols = &p
+	}
+	return srv
+}
+
+// Listen opens a TCP listener on addr, limited to opts.MaxConns open
+// connections when set.
+func Listen(addr string, opts Options) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxConns > 0 {
+		ln = &limitListener{Listener: ln, sem: make(chan struct{}, opts.MaxConns), done: make(chan struct{})}
+	}
+	return ln, nil
+}
+
+// limitListener blocks Accept while max connections are open.
+type limitListener struct {
+	net.Listener
+	sem       chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	select {
+	case l.sem <- struct{}{}:
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+	c, err := l.Listener.Accept()
+	if err != nil {
+		<-l.sem
+		return nil, err
+	}
+	return &limitConn{Conn: c, release: func() { <-l.sem }}, nil
+}
+
+func (l *limitListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+// Drainer signals an upcoming shutdown to clients and load balancers. While
+// draining, HTTP/1.x responses carry "Connection: close" so keep-alive
+// clients reconnect elsewhere instead of reusing a connection that is about
+// to be closed, and readiness probes fail so the instance is taken out of
+// rotation. HTTP/2 clients are told by the GOAWAY that Shutdown sends.
+type Drainer struct {
+	readiness map[string]bool
+	draining  atomic.Bool
+}
+
+// NewDrainer creates a Drainer that fails the given readiness probe paths
+// while draining.
+func NewDrainer(readinessPaths ...string) *Drainer {
+	d := &Drainer{readiness: make(map[string]bool, len(readinessPaths))}
+	for _, p := range readinessPaths {
+		d.readiness[p] = true
+	}
+	return d
+}
+
+// Draining reports whether Shutdown has started draining.
+func (d *Drainer) Draining() bool {
+	return d.draining.Load()
+}
+
+// Middleware applies the draining behaviour to next.
+func (d *Drainer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d.draining.Load() {
+			if d.readiness[r.URL.Path] {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Connection", "close")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_, _ = w.Write([]byte(`{"status":"draining"}`))
+				return
+			}
+			if r.ProtoMajor == 1 {
+				w.Header().Set("Connection", "close")
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Shutdown drains srv: it starts draining, keeps serving for period so load
+// balancers notice the failing readiness probe and clients move off their
+// keep-alive connections, then shuts srv down, waiting up to timeout for
+// in-flight requests.
+func (d *Drainer) Shutdown(srv *http.Server, period, timeout time.Duration, logger *slog.Logger) error {
+	d.draining.Store(true)
+	if period > 0 {
+		logger.Info("draining connections", "period", period)
+		time.Sleep(period)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
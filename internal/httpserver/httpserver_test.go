@@ -0,0 +1,161 @@
+package httpserver
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func okHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Proto)
+	})
+}
+
+func TestNew_ServesH2C(t *testing.T) {
+	srv := New("127.0.0.1:0", okHandler(), Options{HTTP2: true})
+	ln, err := Listen(srv.Addr, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	var p http.Protocols
+	p.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: &p}}
+	resp, err := client.Get("http://" + ln.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "HTTP/2.0" {
+		t.Errorf("got protocol %q, want HTTP/2.0", body)
+	}
+}
+
+func TestNew_HTTP2Disabled(t *testing.T) {
+	srv := New("127.0.0.1:0", okHandler(), Options{MaxHeaderBytes: 4096})
+	if srv.Protocols != nil {
+		t.Errorf("Protocols = %v, want nil", srv.Protocols)
+	}
+	if srv.MaxHeaderBytes != 4096 {
+		t.Errorf("MaxHeaderBytes = %d, want 4096", srv.MaxHeaderBytes)
+	}
+}
+
+func TestListen_LimitsConnections(t *testing.T) {
+	ln, err := Listen("127.0.0.1:0", Options{MaxConns: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	for i := 0; i < 2; i++ {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+	}
+
+	first := <-accepted
+	select {
+	case <-accepted:
+		t.Fatal("second connection accepted while the first was open")
+	case <-time.After(50 * time.Millisecond):
+	}
+	first.Close()
+	select {
+	case c := <-accepted:
+		c.Close()
+	case <-time.After(time.Second):
+		t.Fatal("second connection not accepted after the first closed")
+	}
+}
+
+func TestDrainer_Middleware(t *testing.T) {
+	d := NewDrainer("/v1/readyz")
+	h := d.Middleware(okHandler())
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/readyz", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Connection") != "" {
+		t.Fatalf("before draining: status %d, Connection %q", rec.Code, rec.Header().Get("Connection"))
+	}
+
+	d.draining.Store(true)
+	if !d.Draining() {
+		t.Fatal("Draining() = false")
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("readyz while draining: status %d, want 503", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/cells", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("request while draining: status %d, want 200", rec.Code)
+	}
+	if got := rec.Header().Get("Connection"); got != "close" {
+		t.Errorf("HTTP/1.1 Connection = %q, want close", got)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/cells", nil)
+	req.Proto, req.ProtoMajor, req.ProtoMinor = "HTTP/2.0", 2, 0
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Connection"); got != "" {
+		t.Errorf("HTTP/2 Connection = %q, want empty", got)
+	}
+}
+
+func TestDrainer_ShutdownClosesKeepAlive(t *testing.T) {
+	d := NewDrainer()
+	srv := New("127.0.0.1:0", d.Middleware(okHandler()), Options{})
+	ln, err := Listen(srv.Addr, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	url := "http://" + ln.Addr().String() + "/"
+
+	done := make(chan error, 1)
+	go func() { done <- d.Shutdown(srv, 200*time.Millisecond, time.Second, slog.New(slog.DiscardHandler)) }()
+	for !d.Draining() {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Requests during the drain period still succeed, but ask the client to
+	// close the connection.
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("request while draining: %v", err)
+	}
+	resp.Body.Close()
+	if !resp.Close {
+		t.Error("response while draining does not close the connection")
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+}
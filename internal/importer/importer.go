@@ -0,0 +1,228 @@
+// Package importer copies rows from an existing PostgreSQL table into cells,
+// so teams with legacy schemas can move data into Mezzanine without writing
+// a custom migration job.
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// LegacyRowKeyNamespace is the namespace non-UUID source keys were derived
+// in before Config.RowKeyNamespace could be set, and still are by default,
+// so that imports started earlier can be rerun onto the same rows.
+const LegacyRowKeyNamespace = "5b0d3c1e-7a0f-4c55-9d8e-6d657a7a616e"
+
+// Config maps a source table onto cells.
+type Config struct {
+	// Table is the source table, optionally schema-qualified ("legacy.users").
+	Table string
+	// RowKeyColumn supplies each cell's row_key. UUID values are used as-is;
+	// anything else is hashed into a deterministic UUIDv5 (see RowKey).
+	RowKeyColumn string
+	// RowKeyNamespace is the namespace non-UUID keys are derived in, as by
+	// the SDK's DeriveRowKey; empty means LegacyRowKeyNamespace.
+	RowKeyNamespace string
+	// ColumnName is the cell column every imported row is written to.
+	ColumnName string
+	// RefKeyColumn, if set, supplies each cell's ref_key (cast to bigint).
+	// Otherwise every cell gets RefKey.
+	RefKeyColumn string
+	RefKey       int64
+	// BodyColumns are projected into the cell body as a JSON object. Empty
+	// means the whole row (to_jsonb).
+	BodyColumns []string
+	// Where is an optional SQL filter appended to the source query.
+	Where string
+	// BatchSize is how many source rows are written per batch.
+	BatchSize int
+}
+
+// Stats summarises an import run.
+type Stats struct {
+	Read          int
+	Written       int
+	Skipped       int // cells that already existed (e.g. from an earlier run)
+	IndexFailures int
+}
+
+// Rows is the subset of pgx.Rows the importer consumes.
+type Rows interface {
+	Next() bool
+	Scan(dest ...any) error
+	Err() error
+}
+
+// Importer writes source rows into the shard stores and indexes them.
+type Importer struct {
+	router    *shard.Router
+	registry  *index.Registry
+	numShards int
+	logger    *slog.Logger
+}
+
+// New creates an Importer that writes through router and indexes through
+// registry.
+func New(router *shard.Router, registry *index.Registry, numShards int, logger *slog.Logger) *Importer {
+	return &Importer{router: router, registry: registry, numShards: numShards, logger: logger}
+}
+
+// Query builds the source SELECT for cfg. Each result row has three columns:
+// the row key as text, the ref key as bigint, and the body as jsonb.
+func Query(cfg Config) (string, error) {
+	if cfg.Table == "" || cfg.RowKeyColumn == "" || cfg.ColumnName == "" {
+		return "", errors.New("table, row key column and column name are required")
+	}
+	if cell.IsReserved(cfg.ColumnName) {
+		return "", fmt.Errorf("column %q is reserved for system use", cfg.ColumnName)
+	}
+
+	refKey := fmt.Sprintf("%d::bigint", cfg.RefKey)
+	if cfg.RefKeyColumn != "" {
+		refKey = fmt.Sprintf("(src.%s)::bigint", quoteIdent(cfg.RefKeyColumn))
+	}
+
+	body := "to_jsonb(src)"
+	if len(cfg.BodyColumns) > 0 {
+		pairs := make([]string, len(cfg.BodyColumns))
+		for i, col := range cfg.BodyColumns {
+			pairs[i] = fmt.Sprintf("'%s', src.%s", strings.ReplaceAll(col, "'", "''"), quoteIdent(col))
+		}
+		body = "jsonb_build_object(" + strings.Join(pairs, ", ") + ")"
+	}
+
+	q := fmt.Sprintf("SELECT (src.%s)::text, %s, %s FROM %s AS src",
+		quoteIdent(cfg.RowKeyColumn), refKey, body, pgx.Identifier(strings.Split(cfg.Table, ".")).Sanitize())
+	if cfg.Where != "" {
+		q += " WHERE " + cfg.Where
+	}
+	return q, nil
+}
+
+func quoteIdent(name string) string {
+	return pgx.Identifier{name}.Sanitize()
+}
+
+// RowKey converts a source key to a row_key. UUIDs are kept; other values map
+// to the UUIDv5 of the key in namespace (see cell.DeriveRowKey), so the same
+// key always lands on the same row, rows from related tables sharing a key
+// (users.id, settings.user_id) share a row, and clients deriving the key in
+// the same namespace reach it.
+func RowKey(namespace, v string) uuid.UUID {
+	if id, err := uuid.Parse(v); err == nil {
+		return id
+	}
+	if namespace == "" {
+		namespace = LegacyRowKeyNamespace
+	}
+	return cell.DeriveRowKey(namespace, v)
+}
+
+// Run reads every row from rows and writes it as a cell. Cells that already
+// exist are skipped, so an interrupted import can simply be re-run. Imported
+// cells are indexed but do not fire trigger plugins.
+func (im *Importer) Run(ctx context.Context, cfg Config, rows Rows) (Stats, error) {
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	var stats Stats
+	batch := make([]cell.WriteCellRequest, 0, batchSize)
+	for rows.Next() {
+		var (
+			key    *string
+			refKey int64
+			body   []byte
+		)
+		if err := rows.Scan(&key, &refKey, &body); err != nil {
+			return stats, fmt.Errorf("scan source row: %w", err)
+		}
+		stats.Read++
+		if key == nil {
+			return stats, fmt.Errorf("source row %d has a NULL %s", stats.Read, cfg.RowKeyColumn)
+		}
+		batch = append(batch, cell.WriteCellRequest{
+			RowKey:     RowKey(cfg.RowKeyNamespace, *key),
+			ColumnName: cfg.ColumnName,
+			RefKey:     refKey,
+			Body:       json.RawMessage(body),
+		})
+		if len(batch) == batchSize {
+			if err := im.flush(ctx, batch, &stats); err != nil {
+				return stats, err
+			}
+			batch = batch[:0]
+			im.logger.Info("import progress", "read", stats.Read, "written", stats.Written, "skipped", stats.Skipped)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return stats, fmt.Errorf("read source rows: %w", err)
+	}
+	if err := im.flush(ctx, batch, &stats); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+// flush groups a batch by shard and writes each group with one WriteCells
+// call. If a group contains an existing cell, it falls back to writing that
+// group's cells one at a time and skipping the duplicates.
+func (im *Importer) flush(ctx context.Context, batch []cell.WriteCellRequest, stats *Stats) error {
+	byShard := make(map[shard.ID][]cell.WriteCellRequest)
+	for _, req := range batch {
+		id := im.router.ForRowKey(req.RowKey, im.numShards)
+		byShard[id] = append(byShard[id], req)
+	}
+
+	for id, reqs := range byShard {
+		store, err := im.router.StoreFor(id)
+		if err != nil {
+			return fmt.Errorf("route shard %d: %w", id, err)
+		}
+
+		written, err := store.WriteCells(ctx, reqs)
+		if errors.Is(err, storage.ErrCellExists) {
+			written, err = im.writeEach(ctx, store, reqs, stats)
+		}
+		if err != nil {
+			return fmt.Errorf("write shard %d: %w", id, err)
+		}
+
+		stats.Written += len(written)
+		for i := range written {
+			if err := im.registry.IndexCell(ctx, &written[i], im.numShards); err != nil {
+				stats.IndexFailures++
+				im.logger.Warn("index write failed", "row_key", written[i].RowKey, "error", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (im *Importer) writeEach(ctx context.Context, store storage.CellStore, reqs []cell.WriteCellRequest, stats *Stats) ([]cell.Cell, error) {
+	written := make([]cell.Cell, 0, len(reqs))
+	for _, req := range reqs {
+		c, err := store.WriteCell(ctx, req)
+		if errors.Is(err, storage.ErrCellExists) {
+			stats.Skipped++
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		written = append(written, *c)
+	}
+	return written, nil
+}
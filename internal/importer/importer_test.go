@@ -0,0 +1,170 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+)
+
+// fakeRows yields (key, ref_key, body) tuples.
+type fakeRows struct {
+	rows [][3]any
+	pos  int
+}
+
+func (r *fakeRows) Next() bool {
+	r.pos++
+	return r.pos <= len(r.rows)
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	row := r.rows[r.pos-1]
+	*dest[0].(**string) = row[0].(*string)
+	*dest[1].(*int64) = row[1].(int64)
+	*dest[2].(*[]byte) = []byte(row[2].(string))
+	return nil
+}
+
+func (r *fakeRows) Err() error { return nil }
+
+func strPtr(s string) *string { return &s }
+
+func newTestImporter(numShards int) (*Importer, []*memory.Store) {
+	router := shard.NewRouter()
+	stores := make([]*memory.Store, numShards)
+	for i := range stores {
+		stores[i] = memory.New()
+		router.Register(shard.ID(i), stores[i])
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return New(router, index.NewRegistry(), numShards, logger), stores
+}
+
+func TestQuery_WholeRow(t *testing.T) {
+	q, err := Query(Config{Table: "legacy.users", RowKeyColumn: "id", ColumnName: "profile", RefKey: 1})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	want := `SELECT (src."id")::text, 1::bigint, to_jsonb(src) FROM "legacy"."users" AS src`
+	if q != want {
+		t.Errorf("got  %s\nwant %s", q, want)
+	}
+}
+
+func TestQuery_ProjectionAndFilter(t *testing.T) {
+	q, err := Query(Config{
+		Table:        "users",
+		RowKeyColumn: "id",
+		ColumnName:   "profile",
+		RefKeyColumn: "version",
+		BodyColumns:  []string{"name", "email"},
+		Where:        "deleted_at IS NULL",
+	})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	for _, want := range []string{
+		`(src."version")::bigint`,
+		`jsonb_build_object('name', src."name", 'email', src."email")`,
+		`WHERE deleted_at IS NULL`,
+	} {
+		if !strings.Contains(q, want) {
+			t.Errorf("query %q missing %q", q, want)
+		}
+	}
+}
+
+func TestQuery_MissingFields(t *testing.T) {
+	if _, err := Query(Config{Table: "users"}); err == nil {
+		t.Error("expected error for missing row key column and column name")
+	}
+}
+
+func TestQuery_ReservedColumn(t *testing.T) {
+	if _, err := Query(Config{Table: "users", RowKeyColumn: "id", ColumnName: "_mezz.tombstone"}); err == nil {
+		t.Error("expected error for a reserved column")
+	}
+}
+
+func TestRowKey(t *testing.T) {
+	id := uuid.New()
+	if got := RowKey("user", id.String()); got != id {
+		t.Errorf("UUID key: got %v, want %v", got, id)
+	}
+	if RowKey("user", "42") != RowKey("user", "42") {
+		t.Error("non-UUID keys must map deterministically")
+	}
+	if RowKey("user", "42") == RowKey("user", "43") {
+		t.Error("distinct keys must map to distinct row keys")
+	}
+	// Keys are derived as clients derive them.
+	if got, want := RowKey("user", "42"), cell.DeriveRowKey("user", "42"); got != want {
+		t.Errorf("namespaced key: got %v, want %v", got, want)
+	}
+	// Without a namespace, keys land where earlier imports put them.
+	if got, want := RowKey("", "42"), uuid.MustParse("38ad8bdc-9d88-56d0-b981-7e8e56a4e09f"); got != want {
+		t.Errorf("legacy key: got %v, want %v", got, want)
+	}
+}
+
+func TestRun_WritesEveryRow(t *testing.T) {
+	im, stores := newTestImporter(4)
+	rows := &fakeRows{}
+	for i := range 10 {
+		rows.rows = append(rows.rows, [3]any{strPtr(fmt.Sprint(i)), int64(1), `{"n":1}`})
+	}
+
+	stats, err := im.Run(context.Background(), Config{ColumnName: "profile", BatchSize: 3}, rows)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if stats.Read != 10 || stats.Written != 10 || stats.Skipped != 0 {
+		t.Errorf("stats: got %+v", stats)
+	}
+	total := 0
+	for _, s := range stores {
+		total += s.Len()
+	}
+	if total != 10 {
+		t.Errorf("stored %d cells, want 10", total)
+	}
+}
+
+func TestRun_RerunSkipsExisting(t *testing.T) {
+	im, _ := newTestImporter(2)
+	mkRows := func() *fakeRows {
+		return &fakeRows{rows: [][3]any{
+			{strPtr("a"), int64(1), `{}`},
+			{strPtr("b"), int64(1), `{}`},
+		}}
+	}
+	cfg := Config{ColumnName: "profile"}
+	if _, err := im.Run(context.Background(), cfg, mkRows()); err != nil {
+		t.Fatalf("first Run: %v", err)
+	}
+
+	stats, err := im.Run(context.Background(), cfg, mkRows())
+	if err != nil {
+		t.Fatalf("second Run: %v", err)
+	}
+	if stats.Written != 0 || stats.Skipped != 2 {
+		t.Errorf("stats: got %+v, want 0 written, 2 skipped", stats)
+	}
+}
+
+func TestRun_NullRowKey(t *testing.T) {
+	im, _ := newTestImporter(1)
+	rows := &fakeRows{rows: [][3]any{{(*string)(nil), int64(1), `{}`}}}
+	if _, err := im.Run(context.Background(), Config{RowKeyColumn: "id", ColumnName: "profile"}, rows); err == nil {
+		t.Error("expected error for NULL row key")
+	}
+}
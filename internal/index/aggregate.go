@@ -0,0 +1,228 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrAggregateUnsupported is returned by Aggregate for stores that cannot
+// aggregate their entries.
+var ErrAggregateUnsupported = errors.New("index store does not support aggregation")
+
+// FieldType is the JSON type of a denormalized field, declared so that the
+// field can be aggregated.
+type FieldType string
+
+const (
+	FieldString  FieldType = "string"
+	FieldNumber  FieldType = "number"
+	FieldBoolean FieldType = "boolean"
+)
+
+// AggregateFunc is a function computed over the entries of each group.
+type AggregateFunc string
+
+const (
+	AggCount AggregateFunc = "count" // entries with the field
+	AggSum   AggregateFunc = "sum"
+	AggMin   AggregateFunc = "min"
+	AggMax   AggregateFunc = "max"
+)
+
+// Metric is a function of one denormalized field.
+type Metric struct {
+	Func  AggregateFunc
+	Field string
+}
+
+// String renders m as "func:field", the syntax ParseMetric reads.
+func (m Metric) String() string {
+	return string(m.Func) + ":" + m.Field
+}
+
+// ParseMetric parses "func:field", where func is count, sum, min or max.
+func ParseMetric(s string) (Metric, error) {
+	fn, field, ok := strings.Cut(s, ":")
+	if !ok || field == "" {
+		return Metric{}, fmt.Errorf("metric %q: want func:field", s)
+	}
+	m := Metric{Func: AggregateFunc(fn), Field: field}
+	switch m.Func {
+	case AggCount, AggSum, AggMin, AggMax:
+	default:
+		return Metric{}, fmt.Errorf("metric %q: unknown func %q (want count, sum, min or max)", s, fn)
+	}
+	return m, nil
+}
+
+// Aggregation groups entries by the text of GroupBy fields, like
+// body->>'field', and computes Metrics over each group. With no GroupBy
+// fields, all entries form one group.
+type Aggregation struct {
+	GroupBy []string
+	Metrics []Metric
+	// MaxGroups bounds the groups returned; a store with more returns
+	// MaxGroups+1 of them, so the caller can tell. Zero means no limit.
+	MaxGroups int
+}
+
+// Group is one group of entries: its GroupBy fields, nil where missing, the
+// number of entries in it, and the value of each metric, nil when no entry
+// has a value for it. Non-numeric values are left out of sum, min and max.
+type Group struct {
+	Key    []*string
+	Count  int64
+	Values []*float64
+}
+
+// Aggregator is implemented by index stores that can aggregate their
+// entries.
+type Aggregator interface {
+	Aggregate(ctx context.Context, agg Aggregation, filters ...Filter) ([]Group, error)
+}
+
+// Aggregate aggregates the entries of store that match every filter, or
+// returns ErrAggregateUnsupported.
+func Aggregate(ctx context.Context, store IndexStore, agg Aggregation, filters ...Filter) ([]Group, error) {
+	a, ok := store.(Aggregator)
+	if !ok {
+		return nil, ErrAggregateUnsupported
+	}
+	return a.Aggregate(ctx, agg, filters...)
+}
+
+// CheckAggregation reports an error if agg groups by a field the index does
+// not denormalize, or computes sum, min or max over a field not declared a
+// number.
+func (d Definition) CheckAggregation(agg Aggregation) error {
+	for _, f := range agg.GroupBy {
+		if !slices.Contains(d.Fields, f) {
+			return fmt.Errorf("field %q is not denormalized into index %s", f, d.Name)
+		}
+	}
+	for _, m := range agg.Metrics {
+		if !slices.Contains(d.Fields, m.Field) {
+			return fmt.Errorf("field %q is not denormalized into index %s", m.Field, d.Name)
+		}
+		if m.Func != AggCount && d.FieldTypes[m.Field] != FieldNumber {
+			return fmt.Errorf("%s: field %q of index %s is not declared a number", m, m.Field, d.Name)
+		}
+	}
+	return nil
+}
+
+// MergeGroups merges the groups of several shards of one aggregation.
+func MergeGroups(agg Aggregation, shards ...[]Group) []Group {
+	var out []Group
+	byKey := make(map[string]int)
+	for _, groups := range shards {
+		for _, g := range groups {
+			k := groupKey(g.Key)
+			i, ok := byKey[k]
+			if !ok {
+				byKey[k] = len(out)
+				g.Values = slices.Clone(g.Values)
+				out = append(out, g)
+				continue
+			}
+			out[i].Count += g.Count
+			for j, m := range agg.Metrics {
+				out[i].Values[j] = mergeValue(m.Func, out[i].Values[j], g.Values[j])
+			}
+		}
+	}
+	return out
+}
+
+func mergeValue(fn AggregateFunc, a, b *float64) *float64 {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	var v float64
+	switch fn {
+	case AggCount, AggSum:
+		v = *a + *b
+	case AggMin:
+		v = min(*a, *b)
+	case AggMax:
+		v = max(*a, *b)
+	}
+	return &v
+}
+
+// groupKey encodes a group's key, telling missing fields from empty ones.
+func groupKey(key []*string) string {
+	data, _ := json.Marshal(key)
+	return string(data)
+}
+
+// Aggregate implements Aggregator with one GROUP BY query. Numbers are read
+// only from fields whose JSON type is number.
+func (s *Store) Aggregate(ctx context.Context, agg Aggregation, filters ...Filter) ([]Group, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var cols []string
+	var args []any
+	param := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	for _, f := range agg.GroupBy {
+		cols = append(cols, "body->>"+param(f)+"::text")
+	}
+	cols = append(cols, "count(*)")
+	for _, m := range agg.Metrics {
+		p := param(m.Field) + "::text"
+		if m.Func == AggCount {
+			cols = append(cols, fmt.Sprintf("count(body->>%s)::float8", p))
+			continue
+		}
+		number := fmt.Sprintf("CASE WHEN jsonb_typeof(body->%s) = 'number' THEN (body->>%s)::float8 END", p, p)
+		cols = append(cols, fmt.Sprintf("%s(%s)", m.Func, number))
+	}
+	where, filterArgs := filterClause(filters, len(args)+1)
+	args = append(args, filterArgs...)
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE TRUE%s`, strings.Join(cols, ", "), s.table, where)
+	if len(agg.GroupBy) > 0 {
+		ordinals := make([]string, len(agg.GroupBy))
+		for i := range ordinals {
+			ordinals[i] = fmt.Sprint(i + 1)
+		}
+		query += " GROUP BY " + strings.Join(ordinals, ", ")
+	}
+	if agg.MaxGroups > 0 {
+		query += " LIMIT " + param(agg.MaxGroups+1)
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("aggregate index: %w", err)
+	}
+	defer rows.Close()
+
+	var groups []Group
+	for rows.Next() {
+		g := Group{Key: make([]*string, len(agg.GroupBy)), Values: make([]*float64, len(agg.Metrics))}
+		dest := make([]any, 0, len(cols))
+		for i := range g.Key {
+			dest = append(dest, &g.Key[i])
+		}
+		dest = append(dest, &g.Count)
+		for i := range g.Values {
+			dest = append(dest, &g.Values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("scan index aggregate: %w", err)
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
@@ -0,0 +1,62 @@
+package index
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMetric(t *testing.T) {
+	m, err := ParseMetric("sum:total")
+	if err != nil || m != (Metric{Func: AggSum, Field: "total"}) || m.String() != "sum:total" {
+		t.Errorf("sum:total: got %+v, %v", m, err)
+	}
+	for _, in := range []string{"sum", "sum:", "avg:total", ":total"} {
+		if _, err := ParseMetric(in); err == nil {
+			t.Errorf("%q: no error", in)
+		}
+	}
+}
+
+func TestCheckAggregation(t *testing.T) {
+	def := Definition{Name: "orders", Fields: []string{"status", "total", "note"}, FieldTypes: map[string]FieldType{"total": FieldNumber, "status": FieldString}}
+	ok := Aggregation{GroupBy: []string{"status"}, Metrics: []Metric{{AggSum, "total"}, {AggCount, "note"}}}
+	if err := def.CheckAggregation(ok); err != nil {
+		t.Errorf("valid aggregation: %v", err)
+	}
+	for _, tc := range []struct {
+		agg  Aggregation
+		want string
+	}{
+		{Aggregation{GroupBy: []string{"email"}}, "not denormalized"},
+		{Aggregation{Metrics: []Metric{{AggCount, "email"}}}, "not denormalized"},
+		{Aggregation{Metrics: []Metric{{AggMax, "status"}}}, "not declared a number"},
+		{Aggregation{Metrics: []Metric{{AggSum, "note"}}}, "not declared a number"},
+	} {
+		if err := def.CheckAggregation(tc.agg); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%+v: got %v, want %q", tc.agg, err, tc.want)
+		}
+	}
+}
+
+func TestMergeGroups(t *testing.T) {
+	agg := Aggregation{GroupBy: []string{"status"}, Metrics: []Metric{{AggSum, "total"}, {AggMin, "total"}, {AggMax, "total"}}}
+	open, empty := "open", ""
+	f := func(v float64) *float64 { return &v }
+	groups := MergeGroups(agg,
+		[]Group{{Key: []*string{&open}, Count: 2, Values: []*float64{f(3), f(1), f(2)}}, {Key: []*string{nil}, Count: 1, Values: []*float64{nil, nil, nil}}},
+		[]Group{{Key: []*string{&open}, Count: 1, Values: []*float64{f(5), f(5), f(5)}}, {Key: []*string{&empty}, Count: 4, Values: []*float64{f(1), f(1), f(1)}}},
+		[]Group{{Key: []*string{nil}, Count: 2, Values: []*float64{f(7), f(7), f(7)}}},
+	)
+	if len(groups) != 3 {
+		t.Fatalf("got %d groups, want open, missing and empty", len(groups))
+	}
+	if g := groups[0]; g.Count != 3 || *g.Values[0] != 8 || *g.Values[1] != 1 || *g.Values[2] != 5 {
+		t.Errorf("open: got %d %v %v %v", g.Count, *g.Values[0], *g.Values[1], *g.Values[2])
+	}
+	if g := groups[1]; g.Key[0] != nil || g.Count != 3 || *g.Values[0] != 7 {
+		t.Errorf("missing: got %+v", g)
+	}
+	if g := groups[2]; *g.Key[0] != "" || g.Count != 4 {
+		t.Errorf("empty: got %+v", g)
+	}
+}
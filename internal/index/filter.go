@@ -0,0 +1,121 @@
+package index
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// FilterOp is a comparison applied to one denormalized body field.
+type FilterOp string
+
+const (
+	FilterEq FilterOp = "eq" // field equals the value
+	FilterNe FilterOp = "ne" // field is missing or differs from the value
+	FilterIn FilterOp = "in" // field equals one of the values
+)
+
+// Filter narrows an index query to entries whose denormalized body field
+// matches. Fields compare as text, the way body->>'field' renders them, so
+// {"age": 42} matches the value "42" and {"admin": true} matches "true".
+type Filter struct {
+	Field  string
+	Op     FilterOp
+	Values []string
+}
+
+// ParseFilter parses "field:op:value", where op is eq, ne or in and the
+// values of an in filter are comma-separated.
+func ParseFilter(s string) (Filter, error) {
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) != 3 || parts[0] == "" {
+		return Filter{}, fmt.Errorf("filter %q: want field:op:value", s)
+	}
+	f := Filter{Field: parts[0], Op: FilterOp(parts[1])}
+	switch f.Op {
+	case FilterEq, FilterNe:
+		f.Values = []string{parts[2]}
+	case FilterIn:
+		f.Values = strings.Split(parts[2], ",")
+	default:
+		return Filter{}, fmt.Errorf("filter %q: unknown op %q (want eq, ne or in)", s, parts[1])
+	}
+	return f, nil
+}
+
+// CheckFilters reports an error if a filter names a field that the index
+// does not denormalize into its entries.
+func (d Definition) CheckFilters(filters []Filter) error {
+	for _, f := range filters {
+		if !slices.Contains(d.Fields, f.Field) {
+			return fmt.Errorf("field %q is not denormalized into index %s", f.Field, d.Name)
+		}
+	}
+	return nil
+}
+
+// Match reports whether an entry body satisfies the filter, with the same
+// semantics as the SQL the Store runs. It lets stores that are not backed by
+// PostgreSQL apply filters in memory.
+func (f Filter) Match(body json.RawMessage) bool {
+	v, ok := fieldText(body, f.Field)
+	switch f.Op {
+	case FilterEq:
+		return ok && v == f.Values[0]
+	case FilterNe:
+		return !ok || v != f.Values[0]
+	case FilterIn:
+		return ok && slices.Contains(f.Values, v)
+	}
+	return false
+}
+
+// fieldText renders a body field like body->>'field' does for scalars:
+// strings unquoted, numbers and booleans as their JSON text. ok is false for
+// missing and null fields.
+func fieldText(body json.RawMessage, field string) (string, bool) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(body, &obj); err != nil {
+		return "", false
+	}
+	raw, ok := obj[field]
+	if !ok || string(raw) == "null" {
+		return "", false
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, true
+	}
+	var b bytes.Buffer
+	if err := json.Compact(&b, raw); err != nil {
+		return "", false
+	}
+	return b.String(), true
+}
+
+// filterClause renders filters as SQL conditions on the body column,
+// numbering parameters from next. Field names are bound as parameters too,
+// so neither names nor values are spliced into the query.
+func filterClause(filters []Filter, next int) (string, []any) {
+	var b strings.Builder
+	args := make([]any, 0, 2*len(filters))
+	for _, f := range filters {
+		switch f.Op {
+		case FilterEq:
+			fmt.Fprintf(&b, " AND body->>$%d = $%d", next, next+1)
+			args = append(args, f.Field, f.Values[0])
+		case FilterNe:
+			fmt.Fprintf(&b, " AND body->>$%d IS DISTINCT FROM $%d", next, next+1)
+			args = append(args, f.Field, f.Values[0])
+		case FilterIn:
+			fmt.Fprintf(&b, " AND body->>$%d = ANY($%d::text[])", next, next+1)
+			args = append(args, f.Field, f.Values)
+		default:
+			continue
+		}
+		next += 2
+	}
+	return b.String(), args
+}
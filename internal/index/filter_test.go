@@ -0,0 +1,96 @@
+package index
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Filter
+	}{
+		{"status:eq:active", Filter{Field: "status", Op: FilterEq, Values: []string{"active"}}},
+		{"status:ne:", Filter{Field: "status", Op: FilterNe, Values: []string{""}}},
+		{"country:in:US,CA", Filter{Field: "country", Op: FilterIn, Values: []string{"US", "CA"}}},
+		{"url:eq:https://example.com", Filter{Field: "url", Op: FilterEq, Values: []string{"https://example.com"}}},
+	}
+	for _, tt := range tests {
+		got, err := ParseFilter(tt.in)
+		if err != nil {
+			t.Errorf("ParseFilter(%q): %v", tt.in, err)
+			continue
+		}
+		if got.Field != tt.want.Field || got.Op != tt.want.Op || !slices.Equal(got.Values, tt.want.Values) {
+			t.Errorf("ParseFilter(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseFilter_Invalid(t *testing.T) {
+	for _, in := range []string{"", "status", "status:eq", ":eq:x", "status:like:x"} {
+		if _, err := ParseFilter(in); err == nil {
+			t.Errorf("ParseFilter(%q): expected error", in)
+		}
+	}
+}
+
+func TestFilter_Match(t *testing.T) {
+	body := json.RawMessage(`{"status":"active","age":42,"admin":true,"note":null}`)
+	tests := []struct {
+		filter Filter
+		want   bool
+	}{
+		{Filter{Field: "status", Op: FilterEq, Values: []string{"active"}}, true},
+		{Filter{Field: "status", Op: FilterEq, Values: []string{"closed"}}, false},
+		{Filter{Field: "age", Op: FilterEq, Values: []string{"42"}}, true},
+		{Filter{Field: "admin", Op: FilterEq, Values: []string{"true"}}, true},
+		{Filter{Field: "status", Op: FilterNe, Values: []string{"closed"}}, true},
+		{Filter{Field: "missing", Op: FilterNe, Values: []string{"x"}}, true},
+		{Filter{Field: "note", Op: FilterNe, Values: []string{"x"}}, true},
+		{Filter{Field: "note", Op: FilterEq, Values: []string{"null"}}, false},
+		{Filter{Field: "status", Op: FilterIn, Values: []string{"closed", "active"}}, true},
+		{Filter{Field: "missing", Op: FilterIn, Values: []string{""}}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Match(body); got != tt.want {
+			t.Errorf("%+v.Match = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestDefinition_CheckFilters(t *testing.T) {
+	def := Definition{Name: "user_by_email", Fields: []string{"email", "display_name"}}
+	if err := def.CheckFilters([]Filter{{Field: "display_name", Op: FilterEq, Values: []string{"Alice"}}}); err != nil {
+		t.Errorf("CheckFilters: %v", err)
+	}
+	if err := def.CheckFilters([]Filter{{Field: "password", Op: FilterEq, Values: []string{"x"}}}); err == nil {
+		t.Error("CheckFilters: expected error for a field that is not denormalized")
+	}
+}
+
+func TestFilterClause(t *testing.T) {
+	where, args := filterClause([]Filter{
+		{Field: "status", Op: FilterEq, Values: []string{"active"}},
+		{Field: "tier", Op: FilterNe, Values: []string{"free"}},
+		{Field: "country", Op: FilterIn, Values: []string{"US", "CA"}},
+	}, 2)
+
+	for _, want := range []string{
+		"body->>$2 = $3",
+		"body->>$4 IS DISTINCT FROM $5",
+		"body->>$6 = ANY($7::text[])",
+	} {
+		if !strings.Contains(where, want) {
+			t.Errorf("clause %q missing %q", where, want)
+		}
+	}
+	if len(args) != 6 || args[0] != "status" || args[4] != "country" {
+		t.Errorf("args = %v", args)
+	}
+	if where, args := filterClause(nil, 2); where != "" || len(args) != 0 {
+		t.Errorf("no filters: got %q, %v", where, args)
+	}
+}
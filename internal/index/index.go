@@ -3,16 +3,24 @@ package index
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/ryanbastic/go-mezzanine/internal/cell"
 	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+	mezzanine "github.com/ryanbastic/go-mezzanine/pkg/mezzanine"
 )
 
+// ErrUniqueViolation is returned by WriteEntry when the entry has the same
+// value of one of the index's unique fields as an existing entry.
+var ErrUniqueViolation = errors.New("index entry violates a unique field")
+
 // Entry is a single row in a secondary index table.
 type Entry struct {
 	AddedID   int64           `json:"added_id"`
@@ -29,11 +37,23 @@ type Definition struct {
 	ShardKeyField string   // JSON field path in the body used for sharding the index
 	Fields        []string // JSON fields to denormalize into index body
 	UniqueFields  []string // JSON fields that get a UNIQUE index on (body->>'field')
+	// FieldTypes declares the JSON types of fields, so that numbers can be
+	// summed, and their minimum and maximum taken, by Aggregate.
+	FieldTypes map[string]FieldType
+}
+
+// Page selects a slice of a shard key's entries in added_id order: those
+// after AfterAddedID, at most Limit of them. Limit 0 means no limit.
+type Page struct {
+	AfterAddedID int64
+	Limit        int
 }
 
 // IndexStore is the interface for index read/write operations on a single shard.
 type IndexStore interface {
-	QueryByShardKey(ctx context.Context, shardKey string) ([]Entry, error)
+	QueryByShardKey(ctx context.Context, shardKey string, page Page, filters ...Filter) ([]Entry, error)
+	CountByShardKey(ctx context.Context, shardKey string, filters ...Filter) (int64, error)
+	Count(ctx context.Context, filters ...Filter) (int64, error)
 	WriteEntry(ctx context.Context, entry Entry) error
 }
 
@@ -54,13 +74,11 @@ func NewStore(pool *pgxpool.Pool, indexName string, shardID int, queryTimeout ti
 	}
 }
 
-// withTimeout derives a child context with the configured query timeout.
-// If queryTimeout is zero, the parent context is returned unchanged.
+// withTimeout bounds a query by the configured query timeout and the
+// caller's deadline, whichever comes first; a per-endpoint request budget
+// replaces the query timeout (see storage.QueryContext).
 func (s *Store) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
-	if s.queryTimeout > 0 {
-		return context.WithTimeout(ctx, s.queryTimeout)
-	}
-	return ctx, func() {}
+	return storage.QueryContext(ctx, s.queryTimeout)
 }
 
 // IndexTable returns the table name for a given index and shard.
@@ -80,24 +98,35 @@ func (s *Store) WriteEntry(ctx context.Context, entry Entry) error {
 
 	_, err := s.pool.Exec(ctx, query, entry.ShardKey, entry.RowKey, entry.Body)
 	if err != nil {
+		if pgErr := (*pgconn.PgError)(nil); errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return fmt.Errorf("write index entry: %s: %w", pgErr.ConstraintName, ErrUniqueViolation)
+		}
 		return fmt.Errorf("write index entry: %w", err)
 	}
 	return nil
 }
 
-// QueryByShardKey returns all index entries for a given shard key.
-func (s *Store) QueryByShardKey(ctx context.Context, shardKey string) ([]Entry, error) {
+// QueryByShardKey returns a page of the index entries for a given shard key
+// that match every filter.
+func (s *Store) QueryByShardKey(ctx context.Context, shardKey string, page Page, filters ...Filter) ([]Entry, error) {
 	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 
+	// LIMIT NULL is no limit.
+	var limit *int
+	if page.Limit > 0 {
+		limit = &page.Limit
+	}
+	where, args := filterClause(filters, 4)
 	query := fmt.Sprintf(`
 		SELECT added_id, shard_key, row_key, body, created_at
 		FROM %s
-		WHERE shard_key = $1
+		WHERE shard_key = $1 AND added_id > $2%s
 		ORDER BY added_id ASC
-	`, s.table)
+		LIMIT $3
+	`, s.table, where)
 
-	rows, err := s.pool.Query(ctx, query, shardKey)
+	rows, err := s.pool.Query(ctx, query, append([]any{shardKey, page.AfterAddedID, limit}, args...)...)
 	if err != nil {
 		return nil, fmt.Errorf("query index: %w", err)
 	}
@@ -114,11 +143,38 @@ func (s *Store) QueryByShardKey(ctx context.Context, shardKey string) ([]Entry,
 	return entries, rows.Err()
 }
 
+// CountByShardKey returns the number of index entries for a given shard key
+// that match every filter.
+func (s *Store) CountByShardKey(ctx context.Context, shardKey string, filters ...Filter) (int64, error) {
+	where, args := filterClause(filters, 2)
+	return s.count(ctx, "shard_key = $1"+where, append([]any{shardKey}, args...))
+}
+
+// Count returns the number of entries in this shard of the index that match
+// every filter, whatever their shard key.
+func (s *Store) Count(ctx context.Context, filters ...Filter) (int64, error) {
+	where, args := filterClause(filters, 1)
+	return s.count(ctx, "TRUE"+where, args)
+}
+
+func (s *Store) count(ctx context.Context, where string, args []any) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var n int64
+	query := fmt.Sprintf(`SELECT count(*) FROM %s WHERE %s`, s.table, where)
+	if err := s.pool.QueryRow(ctx, query, args...).Scan(&n); err != nil {
+		return 0, fmt.Errorf("count index: %w", err)
+	}
+	return n, nil
+}
+
 // Registry holds all index definitions and their per-shard stores.
 type Registry struct {
 	definitions  map[string]Definition
 	stores       map[string]map[shard.ID]IndexStore // indexName -> shardID -> IndexStore
 	queryTimeout time.Duration
+	hash         mezzanine.ShardHash
 }
 
 // NewRegistry creates an empty index Registry.
@@ -135,6 +191,18 @@ func (r *Registry) SetQueryTimeout(d time.Duration) {
 	r.queryTimeout = d
 }
 
+// SetHash sets the hash entries are placed on shards with by their shard
+// key, which must be the one the shard router places keys with. The default
+// is the zero mezzanine.ShardHash.
+func (r *Registry) SetHash(h mezzanine.ShardHash) {
+	r.hash = h
+}
+
+// ForKey returns the shard the entries of a shard key value are stored on.
+func (r *Registry) ForKey(shardKeyValue string, numShards int) shard.ID {
+	return shard.ForKey(r.hash, shardKeyValue, numShards)
+}
+
 // Register adds an index definition and creates stores for all shards.
 func (r *Registry) Register(pool *pgxpool.Pool, def Definition, numShards int) {
 	r.definitions[def.Name] = def
@@ -187,33 +255,62 @@ func (r *Registry) ForColumn(columnName string) []Definition {
 func (r *Registry) IndexCell(ctx context.Context, c *cell.Cell, numShards int) error {
 	defs := r.ForColumn(c.ColumnName)
 	for _, def := range defs {
-		shardKeyValue, err := extractString(c.Body, def.ShardKeyField)
-		if err != nil {
-			return fmt.Errorf("index %s: extract shard key: %w", def.Name, err)
+		if err := r.indexInto(ctx, def, c, numShards); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		body, err := extractFields(c.Body, def.Fields)
-		if err != nil {
-			return fmt.Errorf("index %s: extract fields: %w", def.Name, err)
-		}
+// IndexCellFor writes c into a single named index, regardless of which other
+// indexes share its source column. Used when rebuilding one index at a time.
+func (r *Registry) IndexCellFor(ctx context.Context, indexName string, c *cell.Cell, numShards int) error {
+	def, ok := r.definitions[indexName]
+	if !ok {
+		return fmt.Errorf("index %s: not registered", indexName)
+	}
+	if def.SourceColumn != c.ColumnName {
+		return nil
+	}
+	return r.indexInto(ctx, def, c, numShards)
+}
 
-		shardID := shard.ForKey(shardKeyValue, numShards)
-		store, ok := r.StoreFor(def.Name, shardID)
-		if !ok {
-			return fmt.Errorf("index %s: no store for shard %d", def.Name, shardID)
-		}
+func (r *Registry) indexInto(ctx context.Context, def Definition, c *cell.Cell, numShards int) error {
+	shardKeyValue, err := extractString(c.Body, def.ShardKeyField)
+	if err != nil {
+		return fmt.Errorf("index %s: extract shard key: %w", def.Name, err)
+	}
 
-		if err := store.WriteEntry(ctx, Entry{
-			ShardKey: shardKeyValue,
-			RowKey:   c.RowKey,
-			Body:     body,
-		}); err != nil {
-			return fmt.Errorf("index %s: %w", def.Name, err)
-		}
+	body, err := extractFields(c.Body, def.Fields)
+	if err != nil {
+		return fmt.Errorf("index %s: extract fields: %w", def.Name, err)
+	}
+
+	shardID := r.ForKey(shardKeyValue, numShards)
+	store, ok := r.StoreFor(def.Name, shardID)
+	if !ok {
+		return fmt.Errorf("index %s: no store for shard %d", def.Name, shardID)
+	}
+
+	if err := store.WriteEntry(ctx, Entry{
+		ShardKey: shardKeyValue,
+		RowKey:   c.RowKey,
+		Body:     body,
+	}); err != nil {
+		return fmt.Errorf("index %s: %w", def.Name, err)
 	}
 	return nil
 }
 
+// Definitions returns all registered index definitions.
+func (r *Registry) Definitions() []Definition {
+	defs := make([]Definition, 0, len(r.definitions))
+	for _, def := range r.definitions {
+		defs = append(defs, def)
+	}
+	return defs
+}
+
 // extractString reads a string field from a JSON object.
 func extractString(body json.RawMessage, field string) (string, error) {
 	var obj map[string]json.RawMessage
@@ -292,12 +389,12 @@ func buildTableDDL(table string, uniqueFields []string) string {
 	return b.String()
 }
 
-// CreateTablesRange creates index tables for shards [shardStart, shardEnd] using the given pool.
-func (r *Registry) CreateTablesRange(ctx context.Context, pool *pgxpool.Pool, shardStart, shardEnd int) error {
+// CreateTablesRange creates index tables for shards [shardStart, shardEnd] on db.
+func (r *Registry) CreateTablesRange(ctx context.Context, db storage.DB, shardStart, shardEnd int) error {
 	for indexName, def := range r.definitions {
 		for i := shardStart; i <= shardEnd; i++ {
 			table := IndexTable(indexName, i)
-			if _, err := pool.Exec(ctx, buildTableDDL(table, def.UniqueFields)); err != nil {
+			if _, err := db.Exec(ctx, buildTableDDL(table, def.UniqueFields)); err != nil {
 				return fmt.Errorf("create index table %s: %w", table, err)
 			}
 		}
@@ -317,3 +414,14 @@ func (r *Registry) CreateTables(ctx context.Context, pool *pgxpool.Pool, numShar
 	}
 	return nil
 }
+
+// TruncateRange empties the tables of one index for shards [shardStart, shardEnd].
+func (r *Registry) TruncateRange(ctx context.Context, pool *pgxpool.Pool, indexName string, shardStart, shardEnd int) error {
+	for i := shardStart; i <= shardEnd; i++ {
+		table := IndexTable(indexName, i)
+		if _, err := pool.Exec(ctx, fmt.Sprintf("TRUNCATE %s", table)); err != nil {
+			return fmt.Errorf("truncate index table %s: %w", table, err)
+		}
+	}
+	return nil
+}
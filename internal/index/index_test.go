@@ -8,6 +8,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/ryanbastic/go-mezzanine/internal/cell"
 	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	mezzanine "github.com/ryanbastic/go-mezzanine/pkg/mezzanine"
 )
 
 func TestIndexTable(t *testing.T) {
@@ -358,6 +359,19 @@ func TestRegistry_IndexCell_NoMatchingDefs(t *testing.T) {
 	}
 }
 
+func TestRegistry_SetHash(t *testing.T) {
+	r := NewRegistry()
+	if got, want := r.ForKey("alice@example.com", 64), shard.ForKey(mezzanine.ShardHash{}, "alice@example.com", 64); got != want {
+		t.Fatalf("default hash: got shard %d, want %d", got, want)
+	}
+
+	h := mezzanine.ShardHash{Function: mezzanine.HashXXHash, Seed: 7}
+	r.SetHash(h)
+	if got, want := r.ForKey("alice@example.com", 64), shard.ForKey(h, "alice@example.com", 64); got != want {
+		t.Errorf("ForKey with %s: got shard %d, want %d", h, got, want)
+	}
+}
+
 // --- RegisterRange Tests ---
 
 func TestRegistry_RegisterRange_SingleRange(t *testing.T) {
@@ -516,7 +530,7 @@ func TestRegistry_UserByEmail_IndexCell_FieldExtraction(t *testing.T) {
 	}
 
 	// Verify shard routing for the index entry.
-	shardID := shard.ForKey("alice@example.com", 4)
+	shardID := r.ForKey("alice@example.com", 4)
 	store, ok := r.StoreFor("user_by_email", shardID)
 	if !ok {
 		t.Fatalf("StoreFor shard %d: not found", shardID)
@@ -579,3 +593,42 @@ func TestRegistry_IndexCell_ExtractStringError(t *testing.T) {
 		t.Fatal("expected error for missing shard key field")
 	}
 }
+
+func TestRegistry_IndexCellFor_OnlyNamedIndex(t *testing.T) {
+	r := NewRegistry()
+	byEmail := NewMemoryStore()
+	byCity := NewMemoryStore()
+	r.Register(nil, Definition{Name: "by_email", SourceColumn: "profile", ShardKeyField: "email"}, 1)
+	r.Register(nil, Definition{Name: "by_city", SourceColumn: "profile", ShardKeyField: "city"}, 1)
+	r.RegisterStore("by_email", shard.ID(0), byEmail)
+	r.RegisterStore("by_city", shard.ID(0), byCity)
+
+	c := &cell.Cell{
+		RowKey:     uuid.New(),
+		ColumnName: "profile",
+		Body:       json.RawMessage(`{"email":"a@example.com","city":"Oslo"}`),
+	}
+	if err := r.IndexCellFor(t.Context(), "by_city", c, 1); err != nil {
+		t.Fatalf("IndexCellFor: %v", err)
+	}
+	if entries, _ := byCity.QueryByShardKey(t.Context(), "Oslo", Page{}); len(entries) != 1 {
+		t.Errorf("by_city entries: got %+v", entries)
+	}
+	if n, _ := byEmail.Count(t.Context()); n != 0 {
+		t.Errorf("by_email should be untouched, got %d entries", n)
+	}
+
+	if err := r.IndexCellFor(t.Context(), "missing", c, 1); err == nil {
+		t.Error("expected error for unregistered index")
+	}
+}
+
+func TestRegistry_Definitions(t *testing.T) {
+	r := NewRegistry()
+	r.Register(nil, Definition{Name: "a"}, 1)
+	r.Register(nil, Definition{Name: "b"}, 1)
+
+	if got := len(r.Definitions()); got != 2 {
+		t.Errorf("Definitions: got %d, want 2", got)
+	}
+}
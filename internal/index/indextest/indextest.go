@@ -0,0 +1,277 @@
+// Package indextest is a conformance suite for index.IndexStore
+// implementations, so the in-memory store the tests and embedders use
+// cannot drift from the Postgres one in paging, filtering, counting or
+// unique violations.
+//
+//	func TestConformance(t *testing.T) {
+//		indextest.Run(t, func(t *testing.T, unique []string) index.IndexStore { return newEmptyStore(t, unique) })
+//	}
+package indextest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+)
+
+// Run runs the suite. newStore must return an empty store for one shard of
+// an index whose uniqueFields have a unique constraint, each time it is
+// called.
+func Run(t *testing.T, newStore func(t *testing.T, uniqueFields []string) index.IndexStore) {
+	for _, tc := range []struct {
+		name   string
+		unique []string
+		fn     func(*testing.T, index.IndexStore)
+	}{
+		{"QueryByShardKey", nil, testQueryByShardKey},
+		{"Pages", nil, testPages},
+		{"Filters", nil, testFilters},
+		{"Counts", nil, testCounts},
+		{"Aggregate", nil, testAggregate},
+		{"UniqueViolation", []string{"email"}, testUniqueViolation},
+		{"UniqueMissingField", []string{"email"}, testUniqueMissingField},
+		{"CanceledContext", nil, testCanceledContext},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.fn(t, newStore(t, tc.unique))
+		})
+	}
+}
+
+func entry(shardKey, body string) index.Entry {
+	return index.Entry{ShardKey: shardKey, RowKey: uuid.New(), Body: json.RawMessage(body)}
+}
+
+func write(t *testing.T, store index.IndexStore, entries ...index.Entry) {
+	t.Helper()
+	for _, e := range entries {
+		if err := store.WriteEntry(context.Background(), e); err != nil {
+			t.Fatalf("WriteEntry(%s): %v", e.Body, err)
+		}
+	}
+}
+
+func query(t *testing.T, store index.IndexStore, shardKey string, page index.Page, filters ...index.Filter) []index.Entry {
+	t.Helper()
+	entries, err := store.QueryByShardKey(context.Background(), shardKey, page, filters...)
+	if err != nil {
+		t.Fatalf("QueryByShardKey(%q, %+v): %v", shardKey, page, err)
+	}
+	return entries
+}
+
+// rowKeys returns the row keys of entries, for comparing results.
+func rowKeys(entries []index.Entry) []uuid.UUID {
+	out := make([]uuid.UUID, len(entries))
+	for i, e := range entries {
+		out[i] = e.RowKey
+	}
+	return out
+}
+
+func testQueryByShardKey(t *testing.T, store index.IndexStore) {
+	a1, b, a2 := entry("a", `{"n":1}`), entry("b", `{"n":2}`), entry("a", `{"n":3}`)
+	write(t, store, a1, b, a2)
+
+	got := query(t, store, "a", index.Page{})
+	if fmt.Sprint(rowKeys(got)) != fmt.Sprint([]uuid.UUID{a1.RowKey, a2.RowKey}) {
+		t.Fatalf("shard key a: got %+v, want the two a entries in write order", got)
+	}
+	if got[0].AddedID <= 0 || got[1].AddedID <= got[0].AddedID {
+		t.Errorf("added_ids %d, %d: want positive and increasing", got[0].AddedID, got[1].AddedID)
+	}
+	if got[0].ShardKey != "a" || got[0].CreatedAt.IsZero() {
+		t.Errorf("entry: got %+v, want shard key a and created_at set", got[0])
+	}
+	var body map[string]int
+	if err := json.Unmarshal(got[0].Body, &body); err != nil || body["n"] != 1 {
+		t.Errorf("body: got %s, want {\"n\":1}", got[0].Body)
+	}
+	if got := query(t, store, "missing", index.Page{}); len(got) != 0 {
+		t.Errorf("unknown shard key: got %+v, want none", got)
+	}
+}
+
+func testPages(t *testing.T, store index.IndexStore) {
+	var want []uuid.UUID
+	for i := range 5 {
+		e := entry("k", fmt.Sprintf(`{"n":%d}`, i))
+		write(t, store, e, entry("other", `{}`))
+		want = append(want, e.RowKey)
+	}
+
+	var got []uuid.UUID
+	page := index.Page{Limit: 2}
+	for range 5 {
+		entries := query(t, store, "k", page)
+		if len(entries) > page.Limit {
+			t.Fatalf("page of %d entries, limit %d", len(entries), page.Limit)
+		}
+		if len(entries) == 0 {
+			break
+		}
+		got = append(got, rowKeys(entries)...)
+		page.AfterAddedID = entries[len(entries)-1].AddedID
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("paged entries: got %v, want %v", got, want)
+	}
+	if got := query(t, store, "k", index.Page{AfterAddedID: page.AfterAddedID}); len(got) != 0 {
+		t.Errorf("page after the last entry: got %+v, want none", got)
+	}
+}
+
+func testFilters(t *testing.T, store index.IndexStore) {
+	oslo, bergen, none := entry("k", `{"city":"Oslo","age":42}`), entry("k", `{"city":"Bergen"}`), entry("k", `{}`)
+	write(t, store, oslo, bergen, none)
+
+	for _, tc := range []struct {
+		filter index.Filter
+		want   []uuid.UUID
+	}{
+		{index.Filter{Field: "city", Op: index.FilterEq, Values: []string{"Oslo"}}, []uuid.UUID{oslo.RowKey}},
+		{index.Filter{Field: "age", Op: index.FilterEq, Values: []string{"42"}}, []uuid.UUID{oslo.RowKey}},
+		{index.Filter{Field: "city", Op: index.FilterNe, Values: []string{"Oslo"}}, []uuid.UUID{bergen.RowKey, none.RowKey}},
+		{index.Filter{Field: "city", Op: index.FilterIn, Values: []string{"Bergen", "Oslo"}}, []uuid.UUID{oslo.RowKey, bergen.RowKey}},
+	} {
+		if got := rowKeys(query(t, store, "k", index.Page{}, tc.filter)); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("filter %+v: got %v, want %v", tc.filter, got, tc.want)
+		}
+	}
+}
+
+func testCounts(t *testing.T, store index.IndexStore) {
+	ctx := context.Background()
+	write(t, store, entry("a", `{"x":"1"}`), entry("a", `{"x":"2"}`), entry("b", `{"x":"1"}`))
+	x1 := index.Filter{Field: "x", Op: index.FilterEq, Values: []string{"1"}}
+
+	for _, tc := range []struct {
+		name string
+		fn   func() (int64, error)
+		want int64
+	}{
+		{"CountByShardKey", func() (int64, error) { return store.CountByShardKey(ctx, "a") }, 2},
+		{"CountByShardKey filtered", func() (int64, error) { return store.CountByShardKey(ctx, "a", x1) }, 1},
+		{"CountByShardKey unknown", func() (int64, error) { return store.CountByShardKey(ctx, "c") }, 0},
+		{"Count", func() (int64, error) { return store.Count(ctx) }, 3},
+		{"Count filtered", func() (int64, error) { return store.Count(ctx, x1) }, 2},
+	} {
+		if n, err := tc.fn(); err != nil || n != tc.want {
+			t.Errorf("%s: got %d, %v, want %d", tc.name, n, err, tc.want)
+		}
+	}
+}
+
+func testAggregate(t *testing.T, store index.IndexStore) {
+	ctx := context.Background()
+	if _, err := index.Aggregate(ctx, store, index.Aggregation{}); errors.Is(err, index.ErrAggregateUnsupported) {
+		t.Skip("store does not aggregate")
+	}
+	write(t, store,
+		entry("a", `{"status":"open","total":10}`),
+		entry("a", `{"status":"open","total":2.5}`),
+		entry("b", `{"status":"closed","total":"n/a"}`),
+		entry("b", `{"total":4}`),
+	)
+	agg := index.Aggregation{
+		GroupBy: []string{"status"},
+		Metrics: []index.Metric{{Func: index.AggSum, Field: "total"}, {Func: index.AggMax, Field: "total"}, {Func: index.AggCount, Field: "total"}},
+	}
+	groups, err := index.Aggregate(ctx, store, agg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, g := range groups {
+		got[str(g.Key[0])] = fmt.Sprintf("%d %s %s %s", g.Count, num(g.Values[0]), num(g.Values[1]), num(g.Values[2]))
+	}
+	want := map[string]string{"open": "2 12.5 10 2", "closed": "1 null null 1", "null": "1 4 4 1"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("groups: got %v, want %v", got, want)
+	}
+
+	// Without group_by fields, every matching entry is in one group, even
+	// when none match.
+	open := index.Filter{Field: "status", Op: index.FilterEq, Values: []string{"open"}}
+	for filter, want := range map[string]string{"open": "2 2.5", "none": "0 null"} {
+		f := open
+		if filter == "none" {
+			f.Values = []string{"nobody"}
+		}
+		groups, err := index.Aggregate(ctx, store, index.Aggregation{Metrics: []index.Metric{{Func: index.AggMin, Field: "total"}}}, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(groups) != 1 || fmt.Sprintf("%d %s", groups[0].Count, num(groups[0].Values[0])) != want {
+			t.Errorf("%s: got %+v, want one group %s", filter, groups, want)
+		}
+	}
+
+	groups, err = index.Aggregate(ctx, store, index.Aggregation{GroupBy: []string{"total"}, MaxGroups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 3 {
+		t.Errorf("MaxGroups 2 of 4 groups: got %d, want 3", len(groups))
+	}
+}
+
+func str(s *string) string {
+	if s == nil {
+		return "null"
+	}
+	return *s
+}
+
+func num(v *float64) string {
+	if v == nil {
+		return "null"
+	}
+	return fmt.Sprint(*v)
+}
+
+func testUniqueViolation(t *testing.T, store index.IndexStore) {
+	ctx := context.Background()
+	first := entry("a@example.com", `{"email":"a@example.com"}`)
+	write(t, store, first)
+
+	err := store.WriteEntry(ctx, entry("a@example.com", `{"email":"a@example.com","name":"again"}`))
+	if !errors.Is(err, index.ErrUniqueViolation) {
+		t.Fatalf("duplicate email: got %v, want ErrUniqueViolation", err)
+	}
+	got := query(t, store, "a@example.com", index.Page{})
+	if len(got) != 1 || got[0].RowKey != first.RowKey {
+		t.Errorf("after the violation: got %+v, want only the first entry", got)
+	}
+	write(t, store, entry("b@example.com", `{"email":"b@example.com"}`))
+}
+
+func testUniqueMissingField(t *testing.T, store index.IndexStore) {
+	// Like NULLs in a UNIQUE index, entries without the field never conflict.
+	write(t, store, entry("k", `{}`), entry("k", `{"email":null}`), entry("k", `{}`))
+	if n, err := store.CountByShardKey(context.Background(), "k"); err != nil || n != 3 {
+		t.Errorf("CountByShardKey: got %d, %v, want 3", n, err)
+	}
+}
+
+func testCanceledContext(t *testing.T, store index.IndexStore) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := store.WriteEntry(ctx, entry("k", `{}`)); err == nil {
+		t.Error("WriteEntry with a canceled context succeeded")
+	}
+	if _, err := store.QueryByShardKey(ctx, "k", index.Page{}); err == nil {
+		t.Error("QueryByShardKey with a canceled context succeeded")
+	}
+	if _, err := store.CountByShardKey(ctx, "k"); err == nil {
+		t.Error("CountByShardKey with a canceled context succeeded")
+	}
+	if _, err := store.Count(ctx); err == nil {
+		t.Error("Count with a canceled context succeeded")
+	}
+}
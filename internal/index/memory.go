@@ -0,0 +1,162 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-memory IndexStore for one shard of an index, for
+// tests, examples and embedding without a database. It enforces unique
+// fields like the UNIQUE indexes of a Store's table.
+type MemoryStore struct {
+	mu           sync.RWMutex
+	uniqueFields []string
+	entries      []Entry
+}
+
+// NewMemoryStore creates an empty MemoryStore whose entries must not share
+// a value of any of uniqueFields.
+func NewMemoryStore(uniqueFields ...string) *MemoryStore {
+	return &MemoryStore{uniqueFields: uniqueFields}
+}
+
+func (s *MemoryStore) WriteEntry(ctx context.Context, entry Entry) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("write index entry: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range s.uniqueFields {
+		// Like a UNIQUE index, missing and null fields never conflict.
+		v, ok := fieldText(entry.Body, f)
+		if !ok {
+			continue
+		}
+		for _, e := range s.entries {
+			if ev, ok := fieldText(e.Body, f); ok && ev == v {
+				return fmt.Errorf("write index entry: %s %q: %w", f, v, ErrUniqueViolation)
+			}
+		}
+	}
+	entry.AddedID = int64(len(s.entries) + 1)
+	entry.Body = slices.Clone(entry.Body)
+	entry.CreatedAt = time.Now()
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func (s *MemoryStore) QueryByShardKey(ctx context.Context, shardKey string, page Page, filters ...Filter) ([]Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("query index: %w", err)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []Entry
+	for _, e := range s.entries[min(max(page.AfterAddedID, 0), int64(len(s.entries))):] {
+		if page.Limit > 0 && len(out) == page.Limit {
+			break
+		}
+		if e.ShardKey == shardKey && matchAll(e, filters) {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) CountByShardKey(ctx context.Context, shardKey string, filters ...Filter) (int64, error) {
+	return s.count(ctx, func(e Entry) bool { return e.ShardKey == shardKey && matchAll(e, filters) })
+}
+
+func (s *MemoryStore) Count(ctx context.Context, filters ...Filter) (int64, error) {
+	return s.count(ctx, func(e Entry) bool { return matchAll(e, filters) })
+}
+
+func (s *MemoryStore) count(ctx context.Context, match func(Entry) bool) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("count index: %w", err)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var n int64
+	for _, e := range s.entries {
+		if match(e) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) Aggregate(ctx context.Context, agg Aggregation, filters ...Filter) ([]Group, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("aggregate index: %w", err)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var entries []Group
+	for _, e := range s.entries {
+		if !matchAll(e, filters) {
+			continue
+		}
+		g := Group{Key: make([]*string, len(agg.GroupBy)), Count: 1, Values: make([]*float64, len(agg.Metrics))}
+		for i, f := range agg.GroupBy {
+			if v, ok := fieldText(e.Body, f); ok {
+				g.Key[i] = &v
+			}
+		}
+		for i, m := range agg.Metrics {
+			g.Values[i] = metricValue(m, e.Body)
+		}
+		entries = append(entries, g)
+	}
+	groups := MergeGroups(agg, entries)
+	if len(agg.GroupBy) == 0 && len(groups) == 0 {
+		// Like SQL, an aggregate without GROUP BY has one row, even over no
+		// entries.
+		groups = []Group{{Values: make([]*float64, len(agg.Metrics))}}
+	}
+	for _, g := range groups {
+		for i, m := range agg.Metrics {
+			if m.Func == AggCount && g.Values[i] == nil {
+				g.Values[i] = new(float64)
+			}
+		}
+	}
+	if agg.MaxGroups > 0 && len(groups) > agg.MaxGroups+1 {
+		groups = groups[:agg.MaxGroups+1]
+	}
+	return groups, nil
+}
+
+// metricValue returns what one entry contributes to m: 1 for count when the
+// field is present, the field's number otherwise, or nil.
+func metricValue(m Metric, body json.RawMessage) *float64 {
+	if m.Func == AggCount {
+		if _, ok := fieldText(body, m.Field); !ok {
+			return nil
+		}
+		one := 1.0
+		return &one
+	}
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(body, &obj) != nil {
+		return nil
+	}
+	var v float64
+	if json.Unmarshal(obj[m.Field], &v) != nil {
+		return nil
+	}
+	return &v
+}
+
+func matchAll(e Entry, filters []Filter) bool {
+	for _, f := range filters {
+		if !f.Match(e.Body) {
+			return false
+		}
+	}
+	return true
+}
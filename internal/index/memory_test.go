@@ -0,0 +1,14 @@
+package index_test
+
+import (
+	"testing"
+
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/index/indextest"
+)
+
+func TestMemoryStore_Conformance(t *testing.T) {
+	indextest.Run(t, func(_ *testing.T, uniqueFields []string) index.IndexStore {
+		return index.NewMemoryStore(uniqueFields...)
+	})
+}
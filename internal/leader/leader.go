@@ -0,0 +1,191 @@
+// Package leader elects one instance to run each singleton background job.
+//
+// Every instance runs an Elector for the job; the elector that holds the
+// job's Postgres advisory lock runs it, and the others wait to take over. The
+// lock belongs to a database session, so it is released as soon as the
+// leader's connection ends — on shutdown, crash or network partition —
+// without any lease to expire. A leader that loses its connection stops the
+// job before another instance can start it only if it notices first, so jobs
+// should still be safe to overlap briefly, e.g. by writing idempotently.
+package leader
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var isLeader = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: "mezzanine",
+		Name:      "leader",
+		Help:      "1 while this instance is the leader of a singleton job.",
+	},
+	[]string{"job"},
+)
+
+// DefaultInterval is how often a follower retries the lock and a leader
+// checks its connection.
+const DefaultInterval = 5 * time.Second
+
+// Elector campaigns for leadership of one job.
+type Elector struct {
+	job      string
+	key      int64
+	locker   locker
+	interval time.Duration
+	leading  atomic.Bool
+	logger   *slog.Logger
+}
+
+// New returns an elector for job that takes its lock on pool's database.
+// Instances must use the same job name and database to compete for it.
+// interval <= 0 uses DefaultInterval.
+func New(pool *pgxpool.Pool, job string, interval time.Duration, logger *slog.Logger) *Elector {
+	return newElector(pgLocker{pool: pool}, job, interval, logger)
+}
+
+func newElector(l locker, job string, interval time.Duration, logger *slog.Logger) *Elector {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Elector{job: job, key: LockKey(job), locker: l, interval: interval, logger: logger.With("job", job)}
+}
+
+// LockKey returns the advisory lock key of job.
+func LockKey(job string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("mezzanine/leader/" + job))
+	return int64(h.Sum64())
+}
+
+// Leading reports whether this instance is currently the job's leader.
+func (e *Elector) Leading() bool {
+	return e.leading.Load()
+}
+
+// Run campaigns for leadership until ctx is cancelled, and runs fn whenever
+// this instance is the leader. fn's context is cancelled when leadership is
+// lost; the lock is released once fn returns. If fn returns on its own, with
+// or without an error, leadership is given up and contested again after the
+// interval, so the job runs again on whichever instance wins.
+func (e *Elector) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for ctx.Err() == nil {
+		l, ok, err := e.locker.tryAcquire(ctx, e.key)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			e.logger.Warn("leader election failed", "error", err)
+		case ok:
+			e.lead(ctx, l, fn)
+		}
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// lead runs fn while l is held and releases l when fn returns.
+func (e *Elector) lead(ctx context.Context, l lock, fn func(ctx context.Context) error) {
+	e.logger.Info("became leader")
+	e.leading.Store(true)
+	isLeader.WithLabelValues(e.job).Set(1)
+	defer func() {
+		e.leading.Store(false)
+		isLeader.WithLabelValues(e.job).Set(0)
+	}()
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- fn(jobCtx) }()
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			if err != nil && ctx.Err() == nil {
+				e.logger.Error("singleton job failed", "error", err)
+			}
+			l.release()
+			e.logger.Info("gave up leadership")
+			return
+		case <-ticker.C:
+			if err := l.check(ctx); err != nil && ctx.Err() == nil {
+				e.logger.Warn("lost leadership", "error", err)
+				cancel()
+				<-done
+				l.release()
+				return
+			}
+		}
+	}
+}
+
+// locker takes advisory locks; it is an interface so the election can be
+// tested without a database.
+type locker interface {
+	// tryAcquire takes the lock on key if it is free.
+	tryAcquire(ctx context.Context, key int64) (lock, bool, error)
+}
+
+// lock is a held advisory lock.
+type lock interface {
+	// check reports an error if the lock may no longer be held.
+	check(ctx context.Context) error
+	release()
+}
+
+type pgLocker struct {
+	pool *pgxpool.Pool
+}
+
+func (p pgLocker) tryAcquire(ctx context.Context, key int64) (lock, bool, error) {
+	conn, err := p.pool.Acquire(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("acquire connection: %w", err)
+	}
+	var ok bool
+	if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&ok); err != nil {
+		conn.Release()
+		return nil, false, fmt.Errorf("try advisory lock: %w", err)
+	}
+	if !ok {
+		conn.Release()
+		return nil, false, nil
+	}
+	return &pgLock{conn: conn, key: key}, true, nil
+}
+
+type pgLock struct {
+	conn *pgxpool.Conn
+	key  int64
+}
+
+func (l *pgLock) check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	return l.conn.Ping(ctx)
+}
+
+func (l *pgLock) release() {
+	// Use a fresh context so the lock is released even if ctx was cancelled.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := l.conn.Exec(ctx, "SELECT pg_advisory_unlock($1)", l.key); err != nil {
+		// Drop the connection so the session (and its lock) ends.
+		l.conn.Conn().Close(context.Background())
+	}
+	l.conn.Release()
+}
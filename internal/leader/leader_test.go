@@ -0,0 +1,177 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// memLocker is an in-process stand-in for Postgres advisory locks.
+type memLocker struct {
+	mu   sync.Mutex
+	held map[int64]*memLock
+}
+
+func newMemLocker() *memLocker {
+	return &memLocker{held: make(map[int64]*memLock)}
+}
+
+func (m *memLocker) tryAcquire(ctx context.Context, key int64) (lock, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.held[key] != nil {
+		return nil, false, nil
+	}
+	l := &memLock{locker: m, key: key}
+	m.held[key] = l
+	return l, true, nil
+}
+
+type memLock struct {
+	locker *memLocker
+	key    int64
+	lost   atomic.Bool
+}
+
+func (l *memLock) check(context.Context) error {
+	if l.lost.Load() {
+		return errors.New("connection closed")
+	}
+	return nil
+}
+
+func (l *memLock) release() {
+	l.locker.mu.Lock()
+	defer l.locker.mu.Unlock()
+	if l.locker.held[l.key] == l {
+		delete(l.locker.held, l.key)
+	}
+}
+
+// drop simulates the leader's session ending: the lock is freed in the
+// database before the leader notices.
+func (m *memLocker) drop(key int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if l := m.held[key]; l != nil {
+		l.lost.Store(true)
+		delete(m.held, key)
+	}
+}
+
+const interval = 10 * time.Millisecond
+
+func testElector(l locker) *Elector {
+	return newElector(l, "reaper", interval, slog.New(slog.DiscardHandler))
+}
+
+// job counts how many instances run it at once.
+type job struct {
+	running, max, runs atomic.Int32
+}
+
+func (j *job) run(ctx context.Context) error {
+	n := j.running.Add(1)
+	defer j.running.Add(-1)
+	j.runs.Add(1)
+	for {
+		m := j.max.Load()
+		if n <= m || j.max.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestElector_OneLeaderAndFailover(t *testing.T) {
+	locker := newMemLocker()
+	var j job
+	a, b := testElector(locker), testElector(locker)
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+	doneA := make(chan struct{})
+	go func() { a.Run(ctxA, j.run); close(doneA) }() //nolint:errcheck
+	waitFor(t, "a to lead", a.Leading)
+	go b.Run(ctxB, j.run) //nolint:errcheck
+
+	time.Sleep(5 * interval)
+	if b.Leading() {
+		t.Fatal("both instances lead")
+	}
+
+	// The leader shuts down; the follower takes over.
+	cancelA()
+	<-doneA
+	waitFor(t, "b to lead", func() bool { return b.Leading() && j.runs.Load() == 2 })
+	if a.Leading() {
+		t.Error("a still leads after shutting down")
+	}
+	if got := j.max.Load(); got != 1 {
+		t.Errorf("job ran on %d instances at once", got)
+	}
+}
+
+func TestElector_LostLockCancelsJob(t *testing.T) {
+	locker := newMemLocker()
+	e := testElector(locker)
+	var j job
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx, j.run) //nolint:errcheck
+	waitFor(t, "leadership", e.Leading)
+
+	// The lock is free again once the job has stopped, so the elector wins
+	// it back and restarts the job.
+	locker.drop(e.key)
+	waitFor(t, "the job to restart", func() bool { return j.runs.Load() == 2 })
+	if got := j.max.Load(); got != 1 {
+		t.Errorf("job ran %d times at once", got)
+	}
+}
+
+func TestElector_FinishedJobReleasesLock(t *testing.T) {
+	locker := newMemLocker()
+	e := testElector(locker)
+	var runs atomic.Int32
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx, func(context.Context) error { //nolint:errcheck
+		runs.Add(1)
+		return errors.New("boom")
+	})
+
+	waitFor(t, "the job to be retried", func() bool { return runs.Load() >= 2 })
+	cancel()
+	waitFor(t, "the lock to be released", func() bool {
+		locker.mu.Lock()
+		defer locker.mu.Unlock()
+		return locker.held[e.key] == nil
+	})
+}
+
+func TestLockKey(t *testing.T) {
+	if LockKey("reaper") != LockKey("reaper") {
+		t.Error("LockKey is not deterministic")
+	}
+	if LockKey("reaper") == LockKey("backfill") {
+		t.Error("different jobs share a key")
+	}
+}
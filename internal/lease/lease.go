@@ -0,0 +1,311 @@
+// Package lease divides the shards among running instances, so that
+// per-shard background work is done by exactly one instance at a time. In
+// serve that is replication, export, search indexing, garbage collection
+// and table health checks; jobs spanning shards, such as the trigger
+// watchdog, stay leader-elected.
+//
+// Every instance runs a Coordinator. It heartbeats into a shared members
+// table and holds time-limited leases on its shards, renewing them well
+// before they expire. Each instance aims for an even share of the shards:
+// when an instance joins, the others release their surplus for it to
+// claim; when one stops, it releases its leases at once, and when one
+// dies, its leases expire and the survivors claim them. Handlers
+// registered with Handle run once per owned shard and are cancelled when
+// the lease is released or lost.
+package lease
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ownedShards = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "mezzanine",
+			Name:      "shard_leases_owned",
+			Help:      "Shards this instance holds a lease on.",
+		},
+	)
+	leaseChangesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "mezzanine",
+			Name:      "shard_lease_changes_total",
+			Help:      "Shard leases acquired, released and lost by this instance.",
+		},
+		[]string{"change"},
+	)
+)
+
+// DefaultTTL is how long a lease or heartbeat lasts without renewal.
+const DefaultTTL = 15 * time.Second
+
+// Lease is one shard's lease as stored.
+type Lease struct {
+	ShardID   int       `json:"shard_id"`
+	Owner     string    `json:"owner,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+// Store persists members and leases. Times are the store's, so instances'
+// clocks need not agree.
+type Store interface {
+	// Heartbeat marks node live for ttl and returns the number of live
+	// nodes, including node.
+	Heartbeat(ctx context.Context, node string, ttl time.Duration) (int, error)
+	// Renew extends node's unexpired leases by ttl and returns their shards.
+	Renew(ctx context.Context, node string, ttl time.Duration) ([]int, error)
+	// Claim leases up to n unowned or expired shards to node for ttl and
+	// returns them.
+	Claim(ctx context.Context, node string, n int, ttl time.Duration) ([]int, error)
+	// Release gives up node's leases on shards.
+	Release(ctx context.Context, node string, shards []int) error
+	// Leave releases all of node's leases and removes it from the members.
+	Leave(ctx context.Context, node string) error
+	// List returns every shard's lease.
+	List(ctx context.Context) ([]Lease, error)
+}
+
+// Handler does a shard's background work. It runs while this instance owns
+// the shard and must return promptly once ctx is cancelled.
+type Handler func(ctx context.Context, shardID int)
+
+// Options configures a Coordinator.
+type Options struct {
+	// Node identifies this instance; empty uses the host name and a random
+	// suffix.
+	Node string
+	// NumShards is the number of shards to divide.
+	NumShards int
+	// TTL is how long leases and heartbeats last; they are renewed every
+	// TTL/3. Zero uses DefaultTTL.
+	TTL time.Duration
+}
+
+// owned is a shard this instance holds and the handlers running for it.
+type owned struct {
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Coordinator holds this instance's shard leases.
+type Coordinator struct {
+	store    Store
+	opts     Options
+	handlers []Handler
+	logger   *slog.Logger
+
+	mu    sync.Mutex
+	owned map[int]*owned
+	// renewed is when the leases were last renewed; once TTL has passed
+	// since, they may have been claimed by others.
+	renewed time.Time
+}
+
+// New returns a coordinator that keeps its leases in store.
+func New(store Store, opts Options, logger *slog.Logger) *Coordinator {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultTTL
+	}
+	if opts.Node == "" {
+		host, _ := os.Hostname()
+		opts.Node = fmt.Sprintf("%s-%s", host, uuid.NewString()[:8])
+	}
+	return &Coordinator{store: store, opts: opts, owned: make(map[int]*owned), logger: logger.With("node", opts.Node)}
+}
+
+// Node returns the name this instance holds leases under.
+func (c *Coordinator) Node() string {
+	return c.opts.Node
+}
+
+// Handle runs fn for every shard this instance owns. Handlers must be
+// registered before Run.
+func (c *Coordinator) Handle(fn Handler) {
+	c.handlers = append(c.handlers, fn)
+}
+
+// Owns reports whether this instance holds the lease on shardID.
+func (c *Coordinator) Owns(shardID int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.owned[shardID]
+	return ok
+}
+
+// Owned returns the shards this instance holds leases on, in order.
+func (c *Coordinator) Owned() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	shards := make([]int, 0, len(c.owned))
+	for id := range c.owned {
+		shards = append(shards, id)
+	}
+	slices.Sort(shards)
+	return shards
+}
+
+// Leases returns every shard's lease, across all instances.
+func (c *Coordinator) Leases(ctx context.Context) ([]Lease, error) {
+	return c.store.List(ctx)
+}
+
+// Run holds and rebalances leases until ctx is cancelled, then stops the
+// handlers and releases every lease so other instances can take over at
+// once.
+func (c *Coordinator) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.opts.TTL / 3)
+	defer ticker.Stop()
+	for {
+		c.tick(ctx)
+		select {
+		case <-ctx.Done():
+			c.stopAll("released")
+			leaveCtx, cancel := context.WithTimeout(context.Background(), c.opts.TTL/3)
+			defer cancel()
+			if err := c.store.Leave(leaveCtx, c.opts.Node); err != nil {
+				// The leases expire on their own within the TTL.
+				c.logger.Warn("failed to release shard leases", "error", err)
+			}
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick renews this instance's leases and moves it toward its share of the
+// shards.
+func (c *Coordinator) tick(ctx context.Context) {
+	live, err := c.store.Heartbeat(ctx, c.opts.Node, c.opts.TTL)
+	if err == nil {
+		var held []int
+		if held, err = c.store.Renew(ctx, c.opts.Node, c.opts.TTL); err == nil {
+			c.mu.Lock()
+			c.renewed = time.Now()
+			c.mu.Unlock()
+			c.rebalance(ctx, live, held)
+			return
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	c.logger.Warn("failed to renew shard leases", "error", err)
+	c.mu.Lock()
+	expired := len(c.owned) > 0 && time.Since(c.renewed) >= c.opts.TTL
+	c.mu.Unlock()
+	if expired {
+		// Others may own these shards by now; stop rather than overlap.
+		c.logger.Error("shard leases expired; stopping shard handlers")
+		c.stopAll("lost")
+	}
+}
+
+func (c *Coordinator) rebalance(ctx context.Context, live int, held []int) {
+	// Shards the store no longer lists as ours were lost, e.g. because a
+	// renewal came too late.
+	heldSet := make(map[int]bool, len(held))
+	for _, id := range held {
+		heldSet[id] = true
+	}
+	for _, id := range c.Owned() {
+		if !heldSet[id] {
+			c.logger.Warn("lost shard lease", "shard", id)
+			c.stop(id, "lost")
+		}
+	}
+	for _, id := range held {
+		if !c.Owns(id) {
+			// Held in the store but not running, e.g. after a restart with
+			// the same node name.
+			c.start(ctx, id)
+		}
+	}
+
+	target := share(c.opts.NumShards, live)
+	switch {
+	case len(held) > target:
+		slices.Sort(held)
+		surplus := held[target:]
+		for _, id := range surplus {
+			c.stop(id, "released")
+		}
+		if err := c.store.Release(ctx, c.opts.Node, surplus); err != nil {
+			// They expire within the TTL since they are no longer renewed.
+			if ctx.Err() == nil {
+				c.logger.Warn("failed to release shard leases", "shards", surplus, "error", err)
+			}
+			return
+		}
+		c.logger.Info("released shard leases", "shards", surplus, "live_nodes", live)
+	case len(held) < target:
+		claimed, err := c.store.Claim(ctx, c.opts.Node, target-len(held), c.opts.TTL)
+		if err != nil {
+			if ctx.Err() == nil {
+				c.logger.Warn("failed to claim shard leases", "error", err)
+			}
+			return
+		}
+		for _, id := range claimed {
+			c.start(ctx, id)
+		}
+		if len(claimed) > 0 {
+			c.logger.Info("acquired shard leases", "shards", claimed, "live_nodes", live)
+		}
+	}
+}
+
+// share is the most shards one of live instances should hold.
+func share(numShards, live int) int {
+	if live < 1 {
+		live = 1
+	}
+	return (numShards + live - 1) / live
+}
+
+func (c *Coordinator) start(ctx context.Context, id int) {
+	hctx, cancel := context.WithCancel(ctx)
+	o := &owned{cancel: cancel}
+	for _, h := range c.handlers {
+		o.wg.Add(1)
+		go func() {
+			defer o.wg.Done()
+			h(hctx, id)
+		}()
+	}
+	c.mu.Lock()
+	c.owned[id] = o
+	ownedShards.Set(float64(len(c.owned)))
+	c.mu.Unlock()
+	leaseChangesTotal.WithLabelValues("acquired").Inc()
+}
+
+// stop cancels shardID's handlers and waits for them to return.
+func (c *Coordinator) stop(id int, change string) {
+	c.mu.Lock()
+	o, ok := c.owned[id]
+	delete(c.owned, id)
+	ownedShards.Set(float64(len(c.owned)))
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	o.cancel()
+	o.wg.Wait()
+	leaseChangesTotal.WithLabelValues(change).Inc()
+}
+
+func (c *Coordinator) stopAll(change string) {
+	for _, id := range c.Owned() {
+		c.stop(id, change)
+	}
+}
@@ -0,0 +1,253 @@
+package lease
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// memStore is an in-memory Store with the same semantics as PostgresStore.
+type memStore struct {
+	mu      sync.Mutex
+	members map[string]time.Time
+	leases  []Lease
+	fail    atomic.Bool
+}
+
+func newMemStore(numShards int) *memStore {
+	s := &memStore{members: make(map[string]time.Time), leases: make([]Lease, numShards)}
+	for i := range s.leases {
+		s.leases[i].ShardID = i
+	}
+	return s
+}
+
+var errStoreDown = errors.New("store down")
+
+func (s *memStore) Heartbeat(ctx context.Context, node string, ttl time.Duration) (int, error) {
+	if s.fail.Load() {
+		return 0, errStoreDown
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.members[node] = now.Add(ttl)
+	live := 0
+	for _, exp := range s.members {
+		if exp.After(now) {
+			live++
+		}
+	}
+	return live, nil
+}
+
+func (s *memStore) Renew(ctx context.Context, node string, ttl time.Duration) ([]int, error) {
+	if s.fail.Load() {
+		return nil, errStoreDown
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var held []int
+	for i := range s.leases {
+		if s.leases[i].Owner == node && s.leases[i].ExpiresAt.After(now) {
+			s.leases[i].ExpiresAt = now.Add(ttl)
+			held = append(held, i)
+		}
+	}
+	return held, nil
+}
+
+func (s *memStore) Claim(ctx context.Context, node string, n int, ttl time.Duration) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var claimed []int
+	for i := range s.leases {
+		if len(claimed) == n {
+			break
+		}
+		if s.leases[i].Owner == "" || !s.leases[i].ExpiresAt.After(now) {
+			s.leases[i] = Lease{ShardID: i, Owner: node, ExpiresAt: now.Add(ttl)}
+			claimed = append(claimed, i)
+		}
+	}
+	return claimed, nil
+}
+
+func (s *memStore) Release(ctx context.Context, node string, shards []int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range shards {
+		if s.leases[id].Owner == node {
+			s.leases[id] = Lease{ShardID: id}
+		}
+	}
+	return nil
+}
+
+func (s *memStore) Leave(ctx context.Context, node string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.leases {
+		if s.leases[i].Owner == node {
+			s.leases[i] = Lease{ShardID: i}
+		}
+	}
+	delete(s.members, node)
+	return nil
+}
+
+func (s *memStore) List(ctx context.Context) ([]Lease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.leases), nil
+}
+
+const (
+	numShards = 8
+	ttl       = 60 * time.Millisecond
+)
+
+// workers records which shards have a handler running, and fails the test
+// if two instances ever work on the same shard at once.
+type workers struct {
+	t       *testing.T
+	mu      sync.Mutex
+	running map[int]string
+}
+
+func (w *workers) handler(node string) Handler {
+	return func(ctx context.Context, shardID int) {
+		w.mu.Lock()
+		if other, ok := w.running[shardID]; ok {
+			w.t.Errorf("shard %d handled by %s and %s at once", shardID, other, node)
+		}
+		w.running[shardID] = node
+		w.mu.Unlock()
+		<-ctx.Done()
+		w.mu.Lock()
+		delete(w.running, shardID)
+		w.mu.Unlock()
+	}
+}
+
+func (w *workers) count(node string) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n := 0
+	for _, owner := range w.running {
+		if owner == node {
+			n++
+		}
+	}
+	return n
+}
+
+type instance struct {
+	*Coordinator
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func startInstance(store Store, w *workers, node string) *instance {
+	c := New(store, Options{Node: node, NumShards: numShards, TTL: ttl}, slog.New(slog.DiscardHandler))
+	c.Handle(w.handler(node))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx) //nolint:errcheck
+		close(done)
+	}()
+	return &instance{Coordinator: c, cancel: cancel, done: done}
+}
+
+func (i *instance) stop() {
+	i.cancel()
+	<-i.done
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCoordinator_RebalancesAsInstancesComeAndGo(t *testing.T) {
+	store := newMemStore(numShards)
+	w := &workers{t: t, running: make(map[int]string)}
+
+	a := startInstance(store, w, "a")
+	defer a.stop()
+	waitFor(t, "a to own every shard", func() bool { return len(a.Owned()) == numShards && w.count("a") == numShards })
+
+	b := startInstance(store, w, "b")
+	waitFor(t, "an even split", func() bool {
+		return len(a.Owned()) == numShards/2 && len(b.Owned()) == numShards/2 && w.count("b") == numShards/2
+	})
+	if slices.ContainsFunc(a.Owned(), b.Owns) {
+		t.Errorf("a owns %v and b owns %v", a.Owned(), b.Owned())
+	}
+
+	// b leaves cleanly; a takes its shards back without waiting for them to
+	// expire.
+	b.stop()
+	if w.count("b") != 0 {
+		t.Errorf("b still runs %d handlers after stopping", w.count("b"))
+	}
+	waitFor(t, "a to own every shard again", func() bool { return len(a.Owned()) == numShards })
+}
+
+func TestCoordinator_TakesOverExpiredLeases(t *testing.T) {
+	store := newMemStore(numShards)
+	w := &workers{t: t, running: make(map[int]string)}
+
+	// A dead instance left leases behind without leaving.
+	store.Claim(context.Background(), "dead", numShards, ttl) //nolint:errcheck
+	store.Heartbeat(context.Background(), "dead", ttl)        //nolint:errcheck
+
+	a := startInstance(store, w, "a")
+	defer a.stop()
+	waitFor(t, "a to own every shard", func() bool { return len(a.Owned()) == numShards })
+}
+
+func TestCoordinator_StopsHandlersWhenLeasesExpire(t *testing.T) {
+	store := newMemStore(numShards)
+	w := &workers{t: t, running: make(map[int]string)}
+
+	a := startInstance(store, w, "a")
+	defer a.stop()
+	waitFor(t, "a to own every shard", func() bool { return w.count("a") == numShards })
+
+	store.fail.Store(true)
+	waitFor(t, "handlers to stop", func() bool { return w.count("a") == 0 })
+	if len(a.Owned()) != 0 {
+		t.Errorf("a still owns %v", a.Owned())
+	}
+
+	store.fail.Store(false)
+	waitFor(t, "a to recover its shards", func() bool { return w.count("a") == numShards })
+}
+
+func TestShare(t *testing.T) {
+	for _, tt := range []struct{ shards, live, want int }{
+		{64, 1, 64},
+		{64, 3, 22},
+		{64, 64, 1},
+		{8, 0, 8},
+	} {
+		if got := share(tt.shards, tt.live); got != tt.want {
+			t.Errorf("share(%d, %d) = %d, want %d", tt.shards, tt.live, got, tt.want)
+		}
+	}
+}
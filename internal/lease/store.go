@@ -0,0 +1,150 @@
+package lease
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresStore implements Store backed by the shard_leases and
+// shard_lease_members tables (see storage.RunShardLeaseMigration).
+type PostgresStore struct {
+	pool         *pgxpool.Pool
+	queryTimeout time.Duration
+}
+
+// NewPostgresStore creates a Store using the given connection pool.
+// queryTimeout sets the per-query context deadline; zero means no timeout.
+func NewPostgresStore(pool *pgxpool.Pool, queryTimeout time.Duration) *PostgresStore {
+	return &PostgresStore{pool: pool, queryTimeout: queryTimeout}
+}
+
+func (s *PostgresStore) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.queryTimeout > 0 {
+		return context.WithTimeout(ctx, s.queryTimeout)
+	}
+	return ctx, func() {}
+}
+
+func (s *PostgresStore) Heartbeat(ctx context.Context, node string, ttl time.Duration) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	batch := &pgx.Batch{}
+	batch.Queue(`
+		INSERT INTO shard_lease_members (node, expires_at)
+		VALUES ($1, now() + make_interval(secs => $2))
+		ON CONFLICT (node) DO UPDATE SET expires_at = EXCLUDED.expires_at
+	`, node, ttl.Seconds())
+	// Members that stopped without leaving are forgotten after a while.
+	batch.Queue(`DELETE FROM shard_lease_members WHERE expires_at < now() - interval '1 hour'`)
+	var live int
+	batch.Queue(`SELECT count(*) FROM shard_lease_members WHERE expires_at > now()`).QueryRow(func(row pgx.Row) error {
+		return row.Scan(&live)
+	})
+	if err := s.pool.SendBatch(ctx, batch).Close(); err != nil {
+		return 0, fmt.Errorf("heartbeat: %w", err)
+	}
+	return live, nil
+}
+
+func (s *PostgresStore) Renew(ctx context.Context, node string, ttl time.Duration) ([]int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, `
+		UPDATE shard_leases SET expires_at = now() + make_interval(secs => $2)
+		WHERE owner = $1 AND expires_at > now()
+		RETURNING shard_id
+	`, node, ttl.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("renew shard leases: %w", err)
+	}
+	return collectShards(rows)
+}
+
+func (s *PostgresStore) Claim(ctx context.Context, node string, n int, ttl time.Duration) ([]int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, `
+		UPDATE shard_leases SET owner = $1, expires_at = now() + make_interval(secs => $3)
+		WHERE shard_id IN (
+			SELECT shard_id FROM shard_leases
+			WHERE owner = '' OR expires_at <= now()
+			ORDER BY shard_id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING shard_id
+	`, node, n, ttl.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("claim shard leases: %w", err)
+	}
+	return collectShards(rows)
+}
+
+func (s *PostgresStore) Release(ctx context.Context, node string, shards []int) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.pool.Exec(ctx, `
+		UPDATE shard_leases SET owner = '', expires_at = 'epoch'
+		WHERE owner = $1 AND shard_id = ANY($2)
+	`, node, shards); err != nil {
+		return fmt.Errorf("release shard leases: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Leave(ctx context.Context, node string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	batch := &pgx.Batch{}
+	batch.Queue(`UPDATE shard_leases SET owner = '', expires_at = 'epoch' WHERE owner = $1`, node)
+	batch.Queue(`DELETE FROM shard_lease_members WHERE node = $1`, node)
+	if err := s.pool.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("leave: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) List(ctx context.Context) ([]Lease, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT shard_id, owner, CASE WHEN owner = '' THEN NULL ELSE expires_at END
+		FROM shard_leases ORDER BY shard_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("list shard leases: %w", err)
+	}
+	defer rows.Close()
+
+	var leases []Lease
+	for rows.Next() {
+		var l Lease
+		var expiresAt *time.Time
+		if err := rows.Scan(&l.ShardID, &l.Owner, &expiresAt); err != nil {
+			return nil, fmt.Errorf("scan shard lease: %w", err)
+		}
+		if expiresAt != nil {
+			l.ExpiresAt = *expiresAt
+		}
+		leases = append(leases, l)
+	}
+	return leases, rows.Err()
+}
+
+func collectShards(rows pgx.Rows) ([]int, error) {
+	shards, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, fmt.Errorf("scan shard ids: %w", err)
+	}
+	return shards, nil
+}
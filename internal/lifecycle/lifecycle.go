@@ -0,0 +1,217 @@
+// Package lifecycle runs the server's long-lived components — listeners,
+// watchers, dispatchers, flushers — and stops them in dependency order on
+// shutdown, each within its own deadline, reporting those that did not
+// stop cleanly.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds stopping a component that sets no Timeout.
+const DefaultTimeout = 5 * time.Second
+
+// Component is one part of the server that runs in the background.
+type Component struct {
+	// Name identifies the component in logs, errors and DependsOn.
+	Name string
+	// Run, if set, runs the component until ctx is cancelled. An error
+	// returned before shutdown is reported on Manager.Failed.
+	Run func(ctx context.Context) error
+	// Stop, if set, is called on shutdown once Run's context is cancelled,
+	// to finish outstanding work: drain requests, flush buffers.
+	Stop func(ctx context.Context) error
+	// Timeout bounds shutting the component down: Stop and waiting for Run
+	// to return. Zero uses the manager's default.
+	Timeout time.Duration
+	// DependsOn names the components this one uses. They are started
+	// before it and stopped after it.
+	DependsOn []string
+}
+
+type running struct {
+	Component
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Manager starts components and shuts them down in reverse dependency
+// order.
+type Manager struct {
+	components []*running
+	byName     map[string]*running
+	order      []*running
+	timeout    time.Duration
+	failed     chan error
+	stopping   chan struct{}
+	logger     *slog.Logger
+}
+
+// New returns a manager whose components stop within timeout unless they
+// set their own; timeout <= 0 uses DefaultTimeout.
+func New(timeout time.Duration, logger *slog.Logger) *Manager {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Manager{
+		byName:   make(map[string]*running),
+		timeout:  timeout,
+		failed:   make(chan error, 1),
+		stopping: make(chan struct{}),
+		logger:   logger,
+	}
+}
+
+// Add registers c. Components must be added before Start.
+func (m *Manager) Add(c Component) error {
+	if c.Name == "" {
+		return errors.New("component name is required")
+	}
+	if _, ok := m.byName[c.Name]; ok {
+		return fmt.Errorf("duplicate component %q", c.Name)
+	}
+	r := &running{Component: c, done: make(chan struct{})}
+	m.components = append(m.components, r)
+	m.byName[c.Name] = r
+	return nil
+}
+
+// Start orders the components by their dependencies and starts their Run
+// functions. It starts nothing if a dependency is unknown or circular.
+func (m *Manager) Start(ctx context.Context) error {
+	order, err := m.sort()
+	if err != nil {
+		return err
+	}
+	m.order = order
+	for _, r := range order {
+		if r.Run == nil {
+			close(r.done)
+			continue
+		}
+		runCtx, cancel := context.WithCancel(ctx)
+		r.cancel = cancel
+		go func() {
+			defer close(r.done)
+			err := r.Run(runCtx)
+			if err == nil || errors.Is(err, context.Canceled) {
+				return
+			}
+			select {
+			case <-m.stopping:
+				m.logger.Error("component failed while stopping", "component", r.Name, "error", err)
+			default:
+				select {
+				case m.failed <- fmt.Errorf("%s: %w", r.Name, err):
+				default:
+				}
+			}
+		}()
+		m.logger.Debug("started component", "component", r.Name)
+	}
+	return nil
+}
+
+// Failed delivers the first error returned by a component's Run before
+// shutdown, meaning the component has stopped working and the server
+// should shut down.
+func (m *Manager) Failed() <-chan error {
+	return m.failed
+}
+
+// Shutdown stops the components one at a time, each before the components
+// it depends on. A component that fails to stop, or does not stop within
+// its timeout, is reported and left behind so the others can still stop.
+// The error lists every such component.
+func (m *Manager) Shutdown() error {
+	close(m.stopping)
+	var errs []error
+	for i := len(m.order) - 1; i >= 0; i-- {
+		r := m.order[i]
+		start := time.Now()
+		if err := m.stop(r); err != nil {
+			m.logger.Error("component did not stop cleanly", "component", r.Name, "error", err, "elapsed", time.Since(start))
+			errs = append(errs, fmt.Errorf("%s: %w", r.Name, err))
+			continue
+		}
+		m.logger.Info("stopped component", "component", r.Name, "elapsed", time.Since(start))
+	}
+	return errors.Join(errs...)
+}
+
+func (m *Manager) stop(r *running) error {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = m.timeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if r.cancel != nil {
+		r.cancel()
+	}
+	stopped := make(chan error, 1)
+	if r.Stop != nil {
+		go func() { stopped <- r.Stop(ctx) }()
+	} else {
+		stopped <- nil
+	}
+
+	var stopErr error
+	select {
+	case stopErr = <-stopped:
+	case <-ctx.Done():
+		return fmt.Errorf("did not stop within %s", timeout)
+	}
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		return fmt.Errorf("did not stop within %s", timeout)
+	}
+	return stopErr
+}
+
+// sort returns the components with each after its dependencies, otherwise
+// in the order they were added.
+func (m *Manager) sort() ([]*running, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[*running]int, len(m.components))
+	order := make([]*running, 0, len(m.components))
+	var visit func(r *running, path []string) error
+	visit = func(r *running, path []string) error {
+		switch state[r] {
+		case visiting:
+			return fmt.Errorf("dependency cycle: %s", strings.Join(append(path, r.Name), " -> "))
+		case visited:
+			return nil
+		}
+		state[r] = visiting
+		for _, name := range r.DependsOn {
+			dep, ok := m.byName[name]
+			if !ok {
+				return fmt.Errorf("component %q depends on unknown component %q", r.Name, name)
+			}
+			if err := visit(dep, append(path, r.Name)); err != nil {
+				return err
+			}
+		}
+		state[r] = visited
+		order = append(order, r)
+		return nil
+	}
+	for _, r := range m.components {
+		if err := visit(r, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
@@ -0,0 +1,166 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newManager(timeout time.Duration) *Manager {
+	return New(timeout, slog.New(slog.DiscardHandler))
+}
+
+// recorder records the order in which components stop.
+type recorder struct {
+	mu    sync.Mutex
+	order []string
+}
+
+func (r *recorder) stop(name string) func(context.Context) error {
+	return func(context.Context) error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.order = append(r.order, name)
+		return nil
+	}
+}
+
+func TestShutdown_ReverseDependencyOrder(t *testing.T) {
+	m := newManager(time.Second)
+	var rec recorder
+	// Added out of order: the HTTP server uses the notifier, which uses
+	// the registry.
+	m.Add(Component{Name: "http", Stop: rec.stop("http"), DependsOn: []string{"notifier", "registry"}}) //nolint:errcheck
+	m.Add(Component{Name: "notifier", Stop: rec.stop("notifier"), DependsOn: []string{"registry"}})     //nolint:errcheck
+	m.Add(Component{Name: "registry", Stop: rec.stop("registry")})                                      //nolint:errcheck
+	m.Add(Component{Name: "listener", Stop: rec.stop("listener")})                                      //nolint:errcheck
+
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if err := m.Shutdown(); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	want := "listener,http,notifier,registry"
+	if got := strings.Join(rec.order, ","); got != want {
+		t.Errorf("stop order: got %s, want %s", got, want)
+	}
+}
+
+func TestShutdown_CancelsRun(t *testing.T) {
+	m := newManager(time.Second)
+	flushed := false
+	m.Add(Component{ //nolint:errcheck
+		Name: "flusher",
+		Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		Stop: func(context.Context) error {
+			flushed = true
+			return nil
+		},
+	})
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if err := m.Shutdown(); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if !flushed {
+		t.Error("Stop was not called")
+	}
+}
+
+func TestShutdown_ReportsComponentsThatDoNotStop(t *testing.T) {
+	m := newManager(time.Second)
+	var rec recorder
+	block := make(chan struct{})
+	defer close(block)
+	m.Add(Component{Name: "db", Stop: rec.stop("db")}) //nolint:errcheck
+	m.Add(Component{                                   //nolint:errcheck
+		Name:      "stuck",
+		Run:       func(context.Context) error { <-block; return nil },
+		Timeout:   20 * time.Millisecond,
+		DependsOn: []string{"db"},
+	})
+	m.Add(Component{ //nolint:errcheck
+		Name:      "broken",
+		Stop:      func(context.Context) error { return errors.New("flush failed") },
+		DependsOn: []string{"db"},
+	})
+
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	err := m.Shutdown()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{"stuck: did not stop within 20ms", "broken: flush failed"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+	// Components that failed to stop do not keep their dependencies running.
+	if strings.Join(rec.order, ",") != "db" {
+		t.Errorf("stopped: got %v, want [db]", rec.order)
+	}
+}
+
+func TestFailed(t *testing.T) {
+	m := newManager(time.Second)
+	m.Add(Component{Name: "server", Run: func(context.Context) error { return errors.New("address in use") }}) //nolint:errcheck
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	select {
+	case err := <-m.Failed():
+		if err.Error() != "server: address in use" {
+			t.Errorf("got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no failure reported")
+	}
+	if err := m.Shutdown(); err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+}
+
+func TestStart_InvalidDependencies(t *testing.T) {
+	tests := map[string][]Component{
+		"unknown": {{Name: "a", DependsOn: []string{"b"}}},
+		"cycle":   {{Name: "a", DependsOn: []string{"b"}}, {Name: "b", DependsOn: []string{"a"}}},
+	}
+	for name, components := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := newManager(time.Second)
+			started := false
+			for _, c := range components {
+				c.Run = func(context.Context) error { started = true; return nil }
+				m.Add(c) //nolint:errcheck
+			}
+			if err := m.Start(context.Background()); err == nil {
+				t.Error("expected error")
+			}
+			if started {
+				t.Error("components started despite the error")
+			}
+		})
+	}
+}
+
+func TestAdd_Invalid(t *testing.T) {
+	m := newManager(time.Second)
+	if err := m.Add(Component{}); err == nil {
+		t.Error("expected error for missing name")
+	}
+	m.Add(Component{Name: "a"}) //nolint:errcheck
+	if err := m.Add(Component{Name: "a"}); err == nil {
+		t.Error("expected error for duplicate name")
+	}
+}
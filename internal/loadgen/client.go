@@ -0,0 +1,47 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	mezzanine "github.com/ryanbastic/go-mezzanine/pkg/mezzanine"
+)
+
+// ClientTarget runs operations through the generated pkg/mezzanine client.
+type ClientTarget struct {
+	client    *mezzanine.APIClient
+	column    string
+	indexName string
+}
+
+// NewClientTarget creates a Target for the server at baseURL that writes and
+// reads column and queries indexName. httpClient may be nil.
+func NewClientTarget(baseURL, column, indexName string, httpClient *http.Client) *ClientTarget {
+	cfg := mezzanine.NewConfiguration()
+	cfg.Servers = mezzanine.ServerConfigurations{{URL: baseURL}}
+	if httpClient != nil {
+		cfg.HTTPClient = httpClient
+	}
+	return &ClientTarget{client: mezzanine.NewAPIClient(cfg), column: column, indexName: indexName}
+}
+
+func (t *ClientTarget) Write(ctx context.Context, rowKey uuid.UUID, refKey int64, body map[string]any) error {
+	req := mezzanine.NewWriteCellBody(body, t.column, refKey, rowKey.String())
+	_, _, err := t.client.CellsAPI.WriteCell(ctx).WriteCellBody(*req).Execute()
+	return err
+}
+
+func (t *ClientTarget) Read(ctx context.Context, rowKey uuid.UUID) error {
+	_, _, err := t.client.CellsAPI.GetCellLatest(ctx, rowKey.String(), t.column).Execute()
+	return err
+}
+
+func (t *ClientTarget) QueryIndex(ctx context.Context, value string) error {
+	if t.indexName == "" {
+		return errors.New("no index configured for index operations")
+	}
+	_, _, err := t.client.IndexAPI.QueryIndex(ctx, t.indexName, value).Execute()
+	return err
+}
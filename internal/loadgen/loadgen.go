@@ -0,0 +1,238 @@
+// Package loadgen drives a configurable mix of writes, reads and index
+// queries against a running Mezzanine server in stages of increasing
+// concurrency, and reports throughput, errors and latency percentiles per
+// stage so breaking points can be found.
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Operation kinds.
+const (
+	OpWrite = "write"
+	OpRead  = "read"
+	OpIndex = "index"
+)
+
+// Target performs single operations against a server.
+type Target interface {
+	Write(ctx context.Context, rowKey uuid.UUID, refKey int64, body map[string]any) error
+	Read(ctx context.Context, rowKey uuid.UUID) error
+	QueryIndex(ctx context.Context, value string) error
+}
+
+// Mix weights the operation kinds; an operation is chosen with probability
+// weight / sum of weights.
+type Mix struct {
+	Write int
+	Read  int
+	Index int
+}
+
+// ParseMix parses "write=70,read=25,index=5".
+func ParseMix(s string) (Mix, error) {
+	var m Mix
+	for _, part := range strings.Split(s, ",") {
+		name, val, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return m, fmt.Errorf("invalid mix entry %q, want op=weight", part)
+		}
+		w, err := strconv.Atoi(val)
+		if err != nil || w < 0 {
+			return m, fmt.Errorf("invalid weight for %s: %q", name, val)
+		}
+		switch name {
+		case OpWrite:
+			m.Write = w
+		case OpRead:
+			m.Read = w
+		case OpIndex:
+			m.Index = w
+		default:
+			return m, fmt.Errorf("unknown operation %q", name)
+		}
+	}
+	if m.Write+m.Read+m.Index == 0 {
+		return m, fmt.Errorf("mix must have at least one non-zero weight")
+	}
+	return m, nil
+}
+
+// pick chooses an operation given a uniform value in [0, 1).
+func (m Mix) pick(r float64) string {
+	total := float64(m.Write + m.Read + m.Index)
+	switch x := r * total; {
+	case x < float64(m.Write):
+		return OpWrite
+	case x < float64(m.Write+m.Read):
+		return OpRead
+	default:
+		return OpIndex
+	}
+}
+
+// Stage runs Concurrency workers for Duration.
+type Stage struct {
+	Concurrency int
+	Duration    time.Duration
+}
+
+// ParseStages parses a ramp like "8:30s,32:30s,64:1m".
+func ParseStages(s string) ([]Stage, error) {
+	var stages []Stage
+	for _, part := range strings.Split(s, ",") {
+		c, d, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid stage %q, want concurrency:duration", part)
+		}
+		n, err := strconv.Atoi(c)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid concurrency in stage %q", part)
+		}
+		dur, err := time.ParseDuration(d)
+		if err != nil || dur <= 0 {
+			return nil, fmt.Errorf("invalid duration in stage %q", part)
+		}
+		stages = append(stages, Stage{Concurrency: n, Duration: dur})
+	}
+	return stages, nil
+}
+
+// Config configures a run.
+type Config struct {
+	Mix    Mix
+	Stages []Stage
+	// BodySize is the length of the random payload string in written bodies.
+	BodySize int
+	// IndexField is the body field holding the value queried by index
+	// operations; it must be the index's shard key field.
+	IndexField string
+}
+
+// Runner executes a load test.
+type Runner struct {
+	target Target
+	cfg    Config
+
+	seq  atomic.Int64
+	mu   sync.RWMutex
+	keys []uuid.UUID // recently written row keys, used by reads and index queries
+}
+
+// maxKeys bounds the pool of written row keys reused by reads.
+const maxKeys = 10000
+
+// NewRunner creates a Runner.
+func NewRunner(target Target, cfg Config) *Runner {
+	if cfg.IndexField == "" {
+		cfg.IndexField = "email"
+	}
+	return &Runner{target: target, cfg: cfg}
+}
+
+// Run executes every stage in order and returns one report per stage. A
+// cancelled ctx ends the current stage early and skips the rest.
+func (r *Runner) Run(ctx context.Context) []StageReport {
+	reports := make([]StageReport, 0, len(r.cfg.Stages))
+	for _, st := range r.cfg.Stages {
+		if ctx.Err() != nil {
+			break
+		}
+		reports = append(reports, r.runStage(ctx, st))
+	}
+	return reports
+}
+
+func (r *Runner) runStage(ctx context.Context, st Stage) StageReport {
+	ctx, cancel := context.WithTimeout(ctx, st.Duration)
+	defer cancel()
+
+	rec := newRecorder()
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range st.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				op := r.cfg.Mix.pick(rand.Float64())
+				t0 := time.Now()
+				err := r.do(ctx, op)
+				if ctx.Err() != nil {
+					return // don't count calls cut off by the stage ending
+				}
+				rec.record(op, time.Since(t0), err)
+			}
+		}()
+	}
+	wg.Wait()
+	return rec.report(st, time.Since(start))
+}
+
+func (r *Runner) do(ctx context.Context, op string) error {
+	if op != OpWrite {
+		if key, ok := r.randomKey(); ok {
+			if op == OpRead {
+				return r.target.Read(ctx, key)
+			}
+			return r.target.QueryIndex(ctx, indexValue(key))
+		}
+		// Nothing written yet: seed with a write instead.
+	}
+	n := r.seq.Add(1)
+	key := uuid.New()
+	body := map[string]any{
+		"seq":            n,
+		r.cfg.IndexField: indexValue(key),
+		"payload":        randomString(r.cfg.BodySize),
+	}
+	if err := r.target.Write(ctx, key, 1, body); err != nil {
+		return err
+	}
+	r.remember(key)
+	return nil
+}
+
+func (r *Runner) remember(key uuid.UUID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.keys) < maxKeys {
+		r.keys = append(r.keys, key)
+		return
+	}
+	r.keys[rand.IntN(len(r.keys))] = key
+}
+
+func (r *Runner) randomKey() (uuid.UUID, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.keys) == 0 {
+		return uuid.UUID{}, false
+	}
+	return r.keys[rand.IntN(len(r.keys))], true
+}
+
+// indexValue is the index field value written for a row key.
+func indexValue(key uuid.UUID) string {
+	return key.String() + "@loadgen.test"
+}
+
+const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = letters[rand.IntN(len(letters))]
+	}
+	return string(b)
+}
@@ -0,0 +1,135 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// fakeTarget counts calls and fails reads when failReads is set.
+type fakeTarget struct {
+	mu        sync.Mutex
+	calls     map[string]int
+	failReads bool
+}
+
+func (f *fakeTarget) count(op string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.calls == nil {
+		f.calls = make(map[string]int)
+	}
+	f.calls[op]++
+}
+
+func (f *fakeTarget) Write(context.Context, uuid.UUID, int64, map[string]any) error {
+	f.count(OpWrite)
+	return nil
+}
+
+func (f *fakeTarget) Read(context.Context, uuid.UUID) error {
+	f.count(OpRead)
+	if f.failReads {
+		return errors.New("read failed")
+	}
+	return nil
+}
+
+func (f *fakeTarget) QueryIndex(context.Context, string) error {
+	f.count(OpIndex)
+	return nil
+}
+
+func TestParseMix(t *testing.T) {
+	m, err := ParseMix("write=70, read=25,index=5")
+	if err != nil {
+		t.Fatalf("ParseMix: %v", err)
+	}
+	if m != (Mix{Write: 70, Read: 25, Index: 5}) {
+		t.Errorf("got %+v", m)
+	}
+	for _, bad := range []string{"write", "write=x", "delete=1", "write=0,read=0"} {
+		if _, err := ParseMix(bad); err == nil {
+			t.Errorf("ParseMix(%q): expected error", bad)
+		}
+	}
+}
+
+func TestMix_Pick(t *testing.T) {
+	m := Mix{Write: 1, Read: 1, Index: 2}
+	for r, want := range map[float64]string{0.0: OpWrite, 0.3: OpRead, 0.5: OpIndex, 0.99: OpIndex} {
+		if got := m.pick(r); got != want {
+			t.Errorf("pick(%v): got %s, want %s", r, got, want)
+		}
+	}
+}
+
+func TestParseStages(t *testing.T) {
+	stages, err := ParseStages("8:30s,64:1m")
+	if err != nil {
+		t.Fatalf("ParseStages: %v", err)
+	}
+	want := []Stage{{8, 30 * time.Second}, {64, time.Minute}}
+	if len(stages) != 2 || stages[0] != want[0] || stages[1] != want[1] {
+		t.Errorf("got %+v, want %+v", stages, want)
+	}
+	for _, bad := range []string{"8", "0:1s", "4:soon"} {
+		if _, err := ParseStages(bad); err == nil {
+			t.Errorf("ParseStages(%q): expected error", bad)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var samples []time.Duration
+	for i := 1; i <= 100; i++ {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+	if got := percentile(samples, 0.5); got != 50*time.Millisecond {
+		t.Errorf("p50: got %v", got)
+	}
+	if got := percentile(samples, 0.99); got != 99*time.Millisecond {
+		t.Errorf("p99: got %v", got)
+	}
+	if got := percentile(nil, 0.5); got != 0 {
+		t.Errorf("empty: got %v", got)
+	}
+}
+
+func TestRunner_RunsStagesAndCountsErrors(t *testing.T) {
+	target := &fakeTarget{failReads: true}
+	r := NewRunner(target, Config{
+		Mix:    Mix{Write: 1, Read: 1},
+		Stages: []Stage{{Concurrency: 2, Duration: 30 * time.Millisecond}, {Concurrency: 4, Duration: 30 * time.Millisecond}},
+	})
+
+	reports := r.Run(context.Background())
+	if len(reports) != 2 {
+		t.Fatalf("got %d reports, want 2", len(reports))
+	}
+	writes := reports[0].Ops[OpWrite]
+	if writes.Count == 0 || writes.Errors != 0 {
+		t.Errorf("writes: got %+v", writes)
+	}
+	reads := reports[1].Ops[OpRead]
+	if reads.Count == 0 || reads.Errors != reads.Count {
+		t.Errorf("reads: expected all to fail, got %+v", reads)
+	}
+	if reports[1].FirstError != "read failed" {
+		t.Errorf("FirstError: got %q", reports[1].FirstError)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteReport(&buf, reports); err != nil {
+		t.Fatalf("WriteReport: %v", err)
+	}
+	if !strings.Contains(buf.String(), "p99") || !strings.Contains(buf.String(), "read failed") {
+		t.Errorf("unexpected report:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,122 @@
+package loadgen
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// OpStats summarises one operation kind within a stage.
+type OpStats struct {
+	Count  int
+	Errors int
+	P50    time.Duration
+	P95    time.Duration
+	P99    time.Duration
+	Max    time.Duration
+}
+
+// StageReport summarises a completed stage.
+type StageReport struct {
+	Stage   Stage
+	Elapsed time.Duration
+	Ops     map[string]OpStats
+	// FirstError is an example error message, if any call failed.
+	FirstError string
+}
+
+// Throughput returns completed operations per second across all kinds.
+func (s StageReport) Throughput() float64 {
+	var n int
+	for _, op := range s.Ops {
+		n += op.Count
+	}
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(n) / s.Elapsed.Seconds()
+}
+
+type recorder struct {
+	mu        sync.Mutex
+	latencies map[string][]time.Duration
+	errors    map[string]int
+	firstErr  string
+}
+
+func newRecorder() *recorder {
+	return &recorder{latencies: make(map[string][]time.Duration), errors: make(map[string]int)}
+}
+
+func (r *recorder) record(op string, d time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latencies[op] = append(r.latencies[op], d)
+	if err != nil {
+		r.errors[op]++
+		if r.firstErr == "" {
+			r.firstErr = err.Error()
+		}
+	}
+}
+
+func (r *recorder) report(st Stage, elapsed time.Duration) StageReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rep := StageReport{Stage: st, Elapsed: elapsed, Ops: make(map[string]OpStats), FirstError: r.firstErr}
+	for op, lat := range r.latencies {
+		slices.Sort(lat)
+		rep.Ops[op] = OpStats{
+			Count:  len(lat),
+			Errors: r.errors[op],
+			P50:    percentile(lat, 0.50),
+			P95:    percentile(lat, 0.95),
+			P99:    percentile(lat, 0.99),
+			Max:    lat[len(lat)-1],
+		}
+	}
+	return rep
+}
+
+// percentile returns the nearest-rank percentile p (0–1) of sorted samples.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted))*p+0.5) - 1
+	idx = max(0, min(idx, len(sorted)-1))
+	return sorted[idx]
+}
+
+// WriteReport prints one table row per stage and operation kind.
+func WriteReport(w io.Writer, reports []StageReport) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "stage\tconc\tops/s\top\tcount\terrors\tp50\tp95\tp99\tmax\t")
+	for i, rep := range reports {
+		for _, op := range []string{OpWrite, OpRead, OpIndex} {
+			s, ok := rep.Ops[op]
+			if !ok {
+				continue
+			}
+			fmt.Fprintf(tw, "%d\t%d\t%.0f\t%s\t%d\t%d\t%s\t%s\t%s\t%s\t\n",
+				i+1, rep.Stage.Concurrency, rep.Throughput(), op, s.Count, s.Errors,
+				round(s.P50), round(s.P95), round(s.P99), round(s.Max))
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for i, rep := range reports {
+		if rep.FirstError != "" {
+			fmt.Fprintf(w, "stage %d first error: %s\n", i+1, rep.FirstError)
+		}
+	}
+	return nil
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(10 * time.Microsecond)
+}
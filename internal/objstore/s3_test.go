@@ -0,0 +1,127 @@
+package objstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewS3Bucket(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "SECRET")
+	t.Setenv("AWS_REGION", "eu-west-1")
+	t.Setenv("AWS_ENDPOINT_URL_S3", "")
+
+	tests := []struct {
+		url, base, prefix, region string
+	}{
+		{"s3://lake/mezzanine/", "https://lake.s3.eu-west-1.amazonaws.com/", "mezzanine/", "eu-west-1"},
+		{"gs://lake", "https://storage.googleapis.com/lake/", "", "auto"},
+	}
+	for _, tt := range tests {
+		b, err := NewS3Bucket(tt.url, http.DefaultClient)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.url, err)
+		}
+		if b.base != tt.base || b.prefix != tt.prefix || b.region != tt.region {
+			t.Errorf("%s: got base %q, prefix %q, region %q", tt.url, b.base, b.prefix, b.region)
+		}
+	}
+
+	for _, bad := range []string{"https://lake/x", "s3:///x", "lake"} {
+		if _, err := NewS3Bucket(bad, http.DefaultClient); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	if _, err := NewS3Bucket("s3://lake", http.DefaultClient); err == nil {
+		t.Error("missing credentials: expected error")
+	}
+}
+
+func TestS3Bucket_Put(t *testing.T) {
+	var gotPath, gotAuth, gotHash, gotBody, gotType string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		gotAuth = r.Header.Get("Authorization")
+		gotHash = r.Header.Get("X-Amz-Content-Sha256")
+		gotType = r.Header.Get("Content-Type")
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "SECRET")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ENDPOINT_URL_S3", srv.URL+"/")
+
+	b, err := NewS3Bucket("s3://lake/cdc", srv.Client())
+	if err != nil {
+		t.Fatalf("NewS3Bucket: %v", err)
+	}
+	if err := b.Put(context.Background(), "date=2026-03-01/column=a b/x.parquet", []byte("data")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if want := "/lake/cdc/date%3D2026-03-01/column%3Da%20b/x.parquet"; gotPath != want {
+		t.Errorf("path: got %q, want %q", gotPath, want)
+	}
+	if !strings.HasPrefix(gotAuth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(gotAuth, "/us-east-1/s3/") {
+		t.Errorf("Authorization: got %q", gotAuth)
+	}
+	// sha256("data")
+	if gotHash != "3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7" || gotBody != "data" {
+		t.Errorf("got hash %q, body %q", gotHash, gotBody)
+	}
+	if gotType != "application/octet-stream" {
+		t.Errorf("Content-Type: got %q", gotType)
+	}
+
+	status = http.StatusForbidden
+	if err := b.Put(context.Background(), "k", nil); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("403: got %v", err)
+	}
+}
+
+func TestS3Bucket_Get(t *testing.T) {
+	var gotMethod, gotPath, gotHash string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath, gotHash = r.Method, r.URL.EscapedPath(), r.Header.Get("X-Amz-Content-Sha256")
+		switch r.URL.Path {
+		case "/lake/bodies/found":
+			io.WriteString(w, "data") //nolint:errcheck
+		case "/lake/bodies/denied":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "SECRET")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ENDPOINT_URL_S3", srv.URL)
+
+	b, err := NewS3Bucket("s3://lake/bodies", srv.Client())
+	if err != nil {
+		t.Fatalf("NewS3Bucket: %v", err)
+	}
+	data, err := b.Get(context.Background(), "found")
+	if err != nil || string(data) != "data" {
+		t.Fatalf("Get: got %q, %v", data, err)
+	}
+	if gotMethod != http.MethodGet || gotPath != "/lake/bodies/found" || gotHash != emptyHash {
+		t.Errorf("got %s %s with hash %q", gotMethod, gotPath, gotHash)
+	}
+	if _, err := b.Get(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing: got %v, want ErrNotFound", err)
+	}
+	if _, err := b.Get(context.Background(), "denied"); err == nil || errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "403") {
+		t.Errorf("403: got %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+// Package offload keeps large cell bodies in object storage.
+//
+// A body above the threshold is uploaded to a bucket under a key derived
+// from its SHA-256, and the cell stores a pointer in its place:
+//
+//	{"_mezz.offload":{"url":"s3://bucket/prefix/sha256/HEX","sha256":"HEX","size":N}}
+//
+// so PostgreSQL rows stay small however big documents get. Objects are
+// content-addressed: writing the same body twice uploads the same object,
+// and an idempotent retry stores the same pointer. Readers that ask for it
+// get the original body back; the object is checked against the pointer's
+// hash and size before it is returned.
+package offload
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+)
+
+var opsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "mezzanine",
+		Name:      "body_offload_total",
+		Help:      "Cell bodies written to or read from object storage, by op (put or get) and result (ok or error).",
+	},
+	[]string{"op", "result"},
+)
+
+// Key is the only field of a pointer body.
+const Key = cell.ReservedPrefix + "offload"
+
+// ErrResolve wraps the errors of Resolve.
+var ErrResolve = errors.New("resolve offloaded body")
+
+// Pointer locates an offloaded body.
+type Pointer struct {
+	// URL is the object's location when it was written.
+	URL string `json:"url"`
+	// SHA256 is the hex-encoded hash of the body.
+	SHA256 string `json:"sha256"`
+	// Size is the body's length in bytes.
+	Size int64 `json:"size"`
+}
+
+// Bucket stores offloaded bodies.
+type Bucket interface {
+	// Put writes data to key, replacing any object already there.
+	Put(ctx context.Context, key string, data []byte) error
+	// Get reads the object at key.
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// Offloader moves bodies above a threshold to a bucket.
+type Offloader struct {
+	bucket    Bucket
+	url       string
+	threshold int
+}
+
+// New returns an Offloader writing bodies longer than threshold bytes to
+// bucket, which is at url (recorded in pointers).
+func New(bucket Bucket, url string, threshold int) *Offloader {
+	return &Offloader{bucket: bucket, url: strings.TrimRight(url, "/"), threshold: threshold}
+}
+
+// Pointer returns the pointer body that would replace body, or nil if body
+// is small enough to store as it is. Nothing is uploaded.
+func (o *Offloader) Pointer(body json.RawMessage) json.RawMessage {
+	ptr, _, _ := o.pointer(body)
+	return ptr
+}
+
+// pointer is Pointer, also returning the body as it is uploaded and the
+// key it is uploaded to.
+func (o *Offloader) pointer(body json.RawMessage) (ptr json.RawMessage, data []byte, key string) {
+	if len(body) <= o.threshold {
+		return nil, nil, ""
+	}
+	// Compacting makes the hash, and so the pointer, independent of the
+	// client's formatting.
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, body); err != nil {
+		buf.Reset()
+		buf.Write(body)
+	}
+	data = buf.Bytes()
+	if len(data) <= o.threshold {
+		return nil, nil, ""
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	key = objectKey(hash)
+	ptr, _ = json.Marshal(map[string]Pointer{Key: {URL: o.url + "/" + key, SHA256: hash, Size: int64(len(data))}})
+	return ptr, data, key
+}
+
+// Offload uploads body if it is above the threshold and returns the pointer
+// body to store instead, or body itself if it is not.
+func (o *Offloader) Offload(ctx context.Context, body json.RawMessage) (json.RawMessage, error) {
+	ptr, data, key := o.pointer(body)
+	if ptr == nil {
+		return body, nil
+	}
+	if err := o.bucket.Put(ctx, key, data); err != nil {
+		opsTotal.WithLabelValues("put", "error").Inc()
+		return nil, fmt.Errorf("offload body: %w", err)
+	}
+	opsTotal.WithLabelValues("put", "ok").Inc()
+	return ptr, nil
+}
+
+// Resolve returns the body a pointer body stands for, or body itself if it
+// is not a pointer. The object is read by hash from the Offloader's bucket,
+// wherever the pointer's URL says it was written.
+func (o *Offloader) Resolve(ctx context.Context, body json.RawMessage) (json.RawMessage, error) {
+	p, ok := Parse(body)
+	if !ok {
+		return body, nil
+	}
+	data, err := o.bucket.Get(ctx, objectKey(p.SHA256))
+	if err != nil {
+		opsTotal.WithLabelValues("get", "error").Inc()
+		return nil, fmt.Errorf("%w %s: %w", ErrResolve, p.SHA256, err)
+	}
+	if sum := sha256.Sum256(data); int64(len(data)) != p.Size || hex.EncodeToString(sum[:]) != p.SHA256 {
+		opsTotal.WithLabelValues("get", "error").Inc()
+		return nil, fmt.Errorf("%w %s: object does not match its pointer", ErrResolve, p.SHA256)
+	}
+	opsTotal.WithLabelValues("get", "ok").Inc()
+	return data, nil
+}
+
+// Parse returns the pointer body holds, if it is a pointer body: an object
+// whose only field is Key, with a well-formed hash.
+func Parse(body json.RawMessage) (Pointer, bool) {
+	if !bytes.Contains(body, []byte(Key)) {
+		return Pointer{}, false
+	}
+	var v map[string]Pointer
+	if json.Unmarshal(body, &v) != nil || len(v) != 1 {
+		return Pointer{}, false
+	}
+	p, ok := v[Key]
+	if !ok || len(p.SHA256) != sha256.Size*2 || p.SHA256 != strings.ToLower(p.SHA256) {
+		return Pointer{}, false
+	}
+	if _, err := hex.DecodeString(p.SHA256); err != nil {
+		return Pointer{}, false
+	}
+	return p, true
+}
+
+// objectKey is where the body with hash is kept, relative to the bucket
+// URL.
+func objectKey(hash string) string {
+	return "sha256/" + hash
+}
@@ -0,0 +1,113 @@
+package offload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type memBucket struct {
+	objects map[string][]byte
+	err     error
+}
+
+func (b *memBucket) Put(_ context.Context, key string, data []byte) error {
+	if b.err != nil {
+		return b.err
+	}
+	b.objects[key] = append([]byte(nil), data...)
+	return nil
+}
+
+func (b *memBucket) Get(_ context.Context, key string) ([]byte, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	data, ok := b.objects[key]
+	if !ok {
+		return nil, errors.New("object not found")
+	}
+	return data, nil
+}
+
+func TestOffload_SmallBodyStays(t *testing.T) {
+	bucket := &memBucket{objects: map[string][]byte{}}
+	o := New(bucket, "s3://lake/bodies/", 32)
+	body := json.RawMessage(`{"name": "Alice"}`)
+	got, err := o.Offload(context.Background(), body)
+	if err != nil || string(got) != string(body) || len(bucket.objects) != 0 {
+		t.Errorf("got %s, %v with %d objects, want the body kept", got, err, len(bucket.objects))
+	}
+	// Whitespace does not count towards the threshold.
+	if ptr := o.Pointer(json.RawMessage(`{"name":    "Alice",   "email":   "a@b"}`)); ptr != nil {
+		t.Errorf("compacted body under the threshold: got pointer %s", ptr)
+	}
+}
+
+func TestOffload_RoundTrip(t *testing.T) {
+	bucket := &memBucket{objects: map[string][]byte{}}
+	o := New(bucket, "s3://lake/bodies/", 32)
+	body := json.RawMessage(`{"text": "` + strings.Repeat("x", 100) + `"}`)
+
+	ptr, err := o.Offload(context.Background(), body)
+	if err != nil {
+		t.Fatalf("Offload: %v", err)
+	}
+	p, ok := Parse(ptr)
+	if !ok {
+		t.Fatalf("Parse(%s): not a pointer", ptr)
+	}
+	if p.Size != 111 || p.URL != "s3://lake/bodies/sha256/"+p.SHA256 || len(bucket.objects) != 1 {
+		t.Errorf("got pointer %+v with %d objects", p, len(bucket.objects))
+	}
+	if dry := o.Pointer(body); string(dry) != string(ptr) {
+		t.Errorf("Pointer: got %s, want %s", dry, ptr)
+	}
+	// The same body, formatted differently, has the same pointer.
+	if again, _ := o.Offload(context.Background(), json.RawMessage(`{ "text":"`+strings.Repeat("x", 100)+`" }`)); string(again) != string(ptr) {
+		t.Errorf("reformatted body: got %s, want %s", again, ptr)
+	}
+
+	got, err := o.Resolve(context.Background(), ptr)
+	if err != nil || string(got) != `{"text":"`+strings.Repeat("x", 100)+`"}` {
+		t.Errorf("Resolve: got %s, %v", got, err)
+	}
+	if got, err := o.Resolve(context.Background(), json.RawMessage(`{"a":1}`)); err != nil || string(got) != `{"a":1}` {
+		t.Errorf("Resolve of a plain body: got %s, %v", got, err)
+	}
+
+	bucket.objects["sha256/"+p.SHA256] = []byte(`{"text":"tampered"}`)
+	if _, err := o.Resolve(context.Background(), ptr); !errors.Is(err, ErrResolve) {
+		t.Errorf("tampered object: got %v, want ErrResolve", err)
+	}
+	bucket.err = errors.New("status 503")
+	if _, err := o.Resolve(context.Background(), ptr); !errors.Is(err, ErrResolve) {
+		t.Errorf("unavailable bucket: got %v, want ErrResolve", err)
+	}
+	if _, err := o.Offload(context.Background(), body); err == nil {
+		t.Error("failed upload: expected error")
+	}
+}
+
+func TestParse(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+	tests := []struct {
+		body string
+		ok   bool
+	}{
+		{`{"_mezz.offload":{"url":"s3://b/sha256/` + hash + `","sha256":"` + hash + `","size":3}}`, true},
+		{`{"_mezz.offload":{"sha256":"` + hash + `"},"other":1}`, false},
+		{`{"_mezz.offload":{"sha256":"../../etc"}}`, false},
+		{`{"_mezz.offload":{"sha256":"` + strings.ToUpper(hash) + `"}}`, false},
+		{`{"_mezz.offload":"x"}`, false},
+		{`["_mezz.offload"]`, false},
+		{`{"name":"Alice"}`, false},
+	}
+	for _, tt := range tests {
+		if _, ok := Parse(json.RawMessage(tt.body)); ok != tt.ok {
+			t.Errorf("Parse(%s): got %v, want %v", tt.body, ok, tt.ok)
+		}
+	}
+}
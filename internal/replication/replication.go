@@ -0,0 +1,281 @@
+// Package replication copies every shard's cells to a remote Mezzanine
+// cluster, as groundwork for disaster recovery.
+//
+// Each shard is tailed in added_id order, as partitionRead does, and its
+// cells are written to the remote cluster one at a time. Cells are
+// immutable, so replication only ever appends: a cell the remote already
+// holds with the same body is accepted again, which makes redelivery after
+// a restart harmless, and one it holds with a different body is a conflict
+// that is counted and skipped rather than overwritten. The remote assigns
+// its own added_id and created_at. Progress is checkpointed per shard.
+package replication
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/shadow"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+var (
+	cellsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "mezzanine",
+			Name:      "replication_cells_total",
+			Help:      "Cells replicated to the remote cluster, by result: applied or conflict.",
+		},
+		[]string{"result"},
+	)
+	errorsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "mezzanine",
+			Name:      "replication_errors_total",
+			Help:      "Failed attempts to read, apply or checkpoint a shard's cells; they are retried.",
+		},
+	)
+	lagSeconds = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "mezzanine",
+			Name:      "replication_lag_seconds",
+			Help:      "Age of the oldest cell not yet replicated, across the shards this instance replicates.",
+		},
+	)
+)
+
+// Options configures a Replicator.
+type Options struct {
+	// Name identifies the replication stream's checkpoints, so that one
+	// cluster can replicate to several remotes (default "default").
+	Name string
+	// NumShards is the number of local shards.
+	NumShards int
+	// BatchSize is the number of cells read per query (default 100).
+	BatchSize int
+	// PollInterval is how long a caught-up shard waits before it is read
+	// again (default 1s).
+	PollInterval time.Duration
+	// Settle holds back cells younger than this (default 2s). PartitionRead
+	// already never passes a slow transaction's cell; this is a margin on
+	// top.
+	Settle time.Duration
+	// Concurrency bounds the shards read and applied at once (default 8).
+	Concurrency int
+	// Timeout bounds each remote write (default 5s).
+	Timeout time.Duration
+}
+
+// Replicator copies shards' cells to a remote cluster.
+type Replicator struct {
+	router      *shard.Router
+	target      shadow.Target
+	checkpoints storage.Checkpoints
+	opts        Options
+	sem         chan struct{}
+	logger      *slog.Logger
+
+	mu  sync.Mutex
+	lag map[int]time.Duration
+}
+
+// New returns a replicator reading shards through router and writing to
+// target, typically a shadow.HTTPTarget for the remote cluster. checkpoints
+// keeps its position on each shard: the added_id of the last cell applied.
+func New(router *shard.Router, target shadow.Target, checkpoints storage.Checkpoints, opts Options, logger *slog.Logger) *Replicator {
+	if opts.Name == "" {
+		opts.Name = "default"
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.Settle <= 0 {
+		opts.Settle = 2 * time.Second
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 8
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	return &Replicator{
+		router:      router,
+		target:      target,
+		checkpoints: checkpoints,
+		opts:        opts,
+		sem:         make(chan struct{}, opts.Concurrency),
+		lag:         make(map[int]time.Duration),
+		logger:      logger.With("replication", opts.Name),
+	}
+}
+
+// Run replicates every shard until ctx is cancelled. Use it when one
+// instance replicates the whole cluster; with shard leases, register
+// RunShard as a lease handler instead.
+func (r *Replicator) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for id := range r.opts.NumShards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.RunShard(ctx, id)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// RunShard replicates shardID until ctx is cancelled. It has the signature
+// of a lease.Handler.
+func (r *Replicator) RunShard(ctx context.Context, shardID int) {
+	defer r.setLag(shardID, -1)
+	var pos int64
+	loaded := false
+	for ctx.Err() == nil {
+		var caughtUp bool
+		var err error
+		if !loaded {
+			pos, err = r.checkpoints.Load(ctx, r.opts.Name, shardID)
+			loaded = err == nil
+		}
+		if loaded {
+			caughtUp, err = r.step(ctx, shardID, &pos)
+		}
+		if err != nil && ctx.Err() == nil {
+			errorsTotal.Inc()
+			r.logger.Warn("replication failed; retrying", "shard_id", shardID, "position", pos, "error", err)
+		}
+		if caughtUp || err != nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(r.opts.PollInterval):
+			}
+		}
+	}
+}
+
+// step applies the next batch of shardID's cells after *pos and advances
+// *pos past those applied. It reports whether the shard is caught up.
+func (r *Replicator) step(ctx context.Context, shardID int, pos *int64) (bool, error) {
+	select {
+	case r.sem <- struct{}{}:
+	case <-ctx.Done():
+		return false, nil
+	}
+	defer func() { <-r.sem }()
+
+	store, err := r.router.StoreFor(shard.ID(shardID))
+	if err != nil {
+		return false, err
+	}
+	cells, err := store.PartitionRead(ctx, shardID, storage.PartitionReadTypeAddedID, *pos, time.Time{}, r.opts.BatchSize)
+	if err != nil {
+		return false, err
+	}
+
+	start := *pos
+	caughtUp := len(cells) < r.opts.BatchSize
+	var applyErr error
+	for _, c := range cells {
+		if time.Since(c.CreatedAt) < r.opts.Settle {
+			caughtUp = true
+			break
+		}
+		if applyErr = r.apply(ctx, shardID, store, c); applyErr != nil {
+			break
+		}
+		*pos = c.AddedID
+	}
+
+	// The lag is the age of the oldest cell still to replicate: the next one,
+	// if it has settled.
+	switch {
+	case applyErr != nil || !caughtUp:
+		if next := nextAfter(cells, *pos); next != nil {
+			r.setLag(shardID, time.Since(next.CreatedAt))
+		}
+	default:
+		r.setLag(shardID, 0)
+	}
+
+	if *pos != start {
+		if err := r.checkpoints.Save(ctx, r.opts.Name, shardID, *pos); err != nil {
+			// Cells since the last saved position are replicated again after
+			// a restart, which the remote accepts.
+			return false, err
+		}
+	}
+	return caughtUp && applyErr == nil, applyErr
+}
+
+// apply writes c, read from store, to the remote, with its bytes if it is
+// a binary cell.
+func (r *Replicator) apply(ctx context.Context, shardID int, store storage.CellStore, c cell.Cell) error {
+	ctx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+	defer cancel()
+	data, err := storage.BlobData(ctx, store, c)
+	if err != nil {
+		return err
+	}
+	err = shadow.Write(ctx, r.target, cell.WriteCellRequest{RowKey: c.RowKey, ColumnName: c.ColumnName, RefKey: c.RefKey, Body: c.Body}, data)
+	switch {
+	case err == nil:
+		cellsTotal.WithLabelValues("applied").Inc()
+		return nil
+	case errors.Is(err, shadow.ErrConflict):
+		cellsTotal.WithLabelValues("conflict").Inc()
+		r.logger.Warn("replication conflict: remote cell has a different body; skipping",
+			"shard_id", shardID, "row_key", c.RowKey, "column_name", c.ColumnName, "ref_key", c.RefKey, "added_id", c.AddedID)
+		return nil
+	default:
+		return err
+	}
+}
+
+// nextAfter returns the first of cells after pos, or nil.
+func nextAfter(cells []cell.Cell, pos int64) *cell.Cell {
+	for i := range cells {
+		if cells[i].AddedID > pos {
+			return &cells[i]
+		}
+	}
+	return nil
+}
+
+// setLag records shardID's lag, or forgets the shard if lag is negative,
+// and publishes the largest.
+func (r *Replicator) setLag(shardID int, lag time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if lag < 0 {
+		delete(r.lag, shardID)
+	} else {
+		r.lag[shardID] = lag
+	}
+	var most time.Duration
+	for _, l := range r.lag {
+		most = max(most, l)
+	}
+	lagSeconds.Set(most.Seconds())
+}
+
+// Lag returns the age of the oldest cell not yet replicated, across the
+// shards this instance replicates.
+func (r *Replicator) Lag() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var most time.Duration
+	for _, l := range r.lag {
+		most = max(most, l)
+	}
+	return most
+}
@@ -0,0 +1,227 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/shadow"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/storetest"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// blobLogStore is a storetest.Log whose binary cells are kept in blobs.
+type blobLogStore struct {
+	*storetest.Log
+	blobs *memory.Store
+}
+
+func (s blobLogStore) WriteBlob(ctx context.Context, req cell.WriteCellRequest, data []byte) (*cell.Cell, error) {
+	return s.blobs.WriteBlob(ctx, req, data)
+}
+
+func (s blobLogStore) GetBlob(ctx context.Context, ref cell.CellRef) (*cell.Cell, []byte, error) {
+	return s.blobs.GetBlob(ctx, ref)
+}
+
+func (s blobLogStore) GetBlobLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, []byte, error) {
+	return s.blobs.GetBlobLatest(ctx, rowKey, columnName)
+}
+
+// remote records applied cells; it reports a conflict for column
+// "diverged" and fails while down is set.
+type remote struct {
+	mu      sync.Mutex
+	applied []int64
+	down    bool
+}
+
+func (r *remote) Write(_ context.Context, req cell.WriteCellRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.down {
+		return errors.New("remote unavailable")
+	}
+	if req.ColumnName == "diverged" {
+		return shadow.ErrConflict
+	}
+	r.applied = append(r.applied, req.RefKey)
+	return nil
+}
+
+// blobRemote records the bytes of the binary cells applied to it.
+type blobRemote struct {
+	remote
+	blobs map[int64][]byte
+}
+
+func (r *blobRemote) WriteBlob(_ context.Context, req cell.WriteCellRequest, data []byte) error {
+	r.blobs[req.RefKey] = data
+	return nil
+}
+
+// newLog returns cells with added_id and ref_key 1..n, created age ago.
+func newLog(n int, age time.Duration) []cell.Cell {
+	cells := make([]cell.Cell, n)
+	for i := range cells {
+		cells[i] = cell.Cell{AddedID: int64(i + 1), RowKey: uuid.New(), ColumnName: "profile", RefKey: int64(i + 1), Body: json.RawMessage(`{}`), CreatedAt: time.Now().Add(-age)}
+	}
+	return cells
+}
+
+func newTestReplicator(store *storetest.Log, target shadow.Target, opts Options) (*Replicator, *storetest.Checkpoints) {
+	r := shard.NewRouter()
+	r.Register(0, store)
+	cp := &storetest.Checkpoints{}
+	opts.NumShards = 1
+	return New(r, target, cp, opts, testLogger()), cp
+}
+
+func TestReplicator_AppliesInOrder(t *testing.T) {
+	store := &storetest.Log{Cells: newLog(5, time.Minute)}
+	target := &remote{}
+	rep, cp := newTestReplicator(store, target, Options{BatchSize: 2})
+
+	var pos int64
+	for range 3 {
+		if _, err := rep.step(context.Background(), 0, &pos); err != nil {
+			t.Fatalf("step: %v", err)
+		}
+	}
+	caughtUp, err := rep.step(context.Background(), 0, &pos)
+	if err != nil || !caughtUp {
+		t.Fatalf("last step: caught up %v, err %v", caughtUp, err)
+	}
+	if len(target.applied) != 5 || target.applied[0] != 1 || target.applied[4] != 5 {
+		t.Errorf("applied: got %v, want 1..5", target.applied)
+	}
+	if cp.Position(0) != 5 {
+		t.Errorf("checkpoint: got %d, want 5", cp.Position(0))
+	}
+	if rep.Lag() != 0 {
+		t.Errorf("Lag: got %v, want 0", rep.Lag())
+	}
+}
+
+func TestReplicator_CarriesBlobBytes(t *testing.T) {
+	src := memory.New()
+	data := []byte("bytes")
+	c, err := src.WriteBlob(context.Background(), cell.WriteCellRequest{RowKey: uuid.New(), ColumnName: "avatar", RefKey: 1, Body: cell.BlobBody("image/png", data)}, data)
+	if err != nil {
+		t.Fatalf("WriteBlob: %v", err)
+	}
+	c.CreatedAt = time.Now().Add(-time.Minute)
+	target := &blobRemote{blobs: make(map[int64][]byte)}
+	r := shard.NewRouter()
+	r.Register(0, blobLogStore{Log: &storetest.Log{Cells: []cell.Cell{*c}}, blobs: src})
+	rep := New(r, target, &storetest.Checkpoints{}, Options{NumShards: 1, BatchSize: 10}, testLogger())
+
+	var pos int64
+	if _, err := rep.step(context.Background(), 0, &pos); err != nil {
+		t.Fatalf("step: %v", err)
+	}
+	if string(target.blobs[1]) != "bytes" || len(target.applied) != 0 {
+		t.Errorf("got blobs %q and cells %v, want the binary cell with its bytes", target.blobs, target.applied)
+	}
+}
+
+func TestReplicator_HoldsBackUnsettledCells(t *testing.T) {
+	cells := append(newLog(2, time.Minute), newLog(1, 0)...)
+	cells[2].AddedID = 3
+	store := &storetest.Log{Cells: cells}
+	target := &remote{}
+	rep, _ := newTestReplicator(store, target, Options{Settle: 30 * time.Second})
+
+	var pos int64
+	caughtUp, err := rep.step(context.Background(), 0, &pos)
+	if err != nil || !caughtUp {
+		t.Fatalf("step: caught up %v, err %v", caughtUp, err)
+	}
+	if pos != 2 || len(target.applied) != 2 {
+		t.Errorf("got position %d and %d applied, want 2 and 2", pos, len(target.applied))
+	}
+}
+
+func TestReplicator_SkipsConflicts(t *testing.T) {
+	cells := newLog(3, time.Minute)
+	cells[1].ColumnName = "diverged"
+	rep, cp := newTestReplicator(&storetest.Log{Cells: cells}, &remote{}, Options{})
+
+	var pos int64
+	if _, err := rep.step(context.Background(), 0, &pos); err != nil {
+		t.Fatalf("step: %v", err)
+	}
+	if cp.Position(0) != 3 {
+		t.Errorf("checkpoint: got %d, want 3", cp.Position(0))
+	}
+}
+
+func TestReplicator_RetriesFailedCells(t *testing.T) {
+	store := &storetest.Log{Cells: newLog(3, time.Minute)}
+	target := &remote{down: true}
+	rep, cp := newTestReplicator(store, target, Options{})
+
+	var pos int64
+	if _, err := rep.step(context.Background(), 0, &pos); err == nil {
+		t.Fatal("step: expected error")
+	}
+	if pos != 0 || cp.Position(0) != 0 {
+		t.Errorf("position advanced to %d (checkpoint %d) past a failed cell", pos, cp.Position(0))
+	}
+	if rep.Lag() < time.Minute {
+		t.Errorf("Lag: got %v, want at least 1m", rep.Lag())
+	}
+
+	target.down = false
+	if _, err := rep.step(context.Background(), 0, &pos); err != nil {
+		t.Fatalf("step: %v", err)
+	}
+	if len(target.applied) != 3 || cp.Position(0) != 3 {
+		t.Errorf("got %v applied and checkpoint %d, want 3 and 3", target.applied, cp.Position(0))
+	}
+}
+
+func TestReplicator_RunShardResumesFromCheckpoint(t *testing.T) {
+	store := &storetest.Log{Cells: newLog(4, time.Minute)}
+	target := &remote{}
+	rep, cp := newTestReplicator(store, target, Options{PollInterval: time.Millisecond})
+	_ = cp.Save(context.Background(), "", 0, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		rep.RunShard(ctx, 0)
+		close(done)
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		pos := cp.Position(0)
+		if pos == 4 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	target.mu.Lock()
+	defer target.mu.Unlock()
+	if len(target.applied) != 2 || target.applied[0] != 3 {
+		t.Errorf("applied: got %v, want [3 4]", target.applied)
+	}
+}
@@ -0,0 +1,60 @@
+// Package rowkey derives and generates row keys the way the Go SDK's
+// DeriveRowKey, NewRowKey and NewULIDRowKey do, so the server, the importer
+// and clients arrive at the same keys. The SDK is a module of its own that
+// cannot import this one; the tests check the two against each other.
+package rowkey
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Namespace is the UUID under which Derive names namespaces given as plain
+// strings: the UUIDv5 of the URL
+// "https://github.com/ryanbastic/go-mezzanine/row-keys".
+const Namespace = "1d01adc3-00a8-5822-9459-4f28f60c3f10"
+
+var namespace = uuid.MustParse(Namespace)
+
+// Derive returns the UUIDv5 row key of a natural key in namespace. A
+// namespace in UUID form is the UUIDv5 namespace itself; any other string
+// names one, itself derived under Namespace.
+func Derive(ns, key string) uuid.UUID {
+	id, err := uuid.Parse(ns)
+	if err != nil {
+		id = uuid.NewSHA1(namespace, []byte(ns))
+	}
+	return uuid.NewSHA1(id, []byte(key))
+}
+
+// NewV7 returns a new time-ordered UUIDv7 row key.
+func NewV7() uuid.UUID {
+	return newTimeOrdered(time.Now(), true)
+}
+
+// NewULID returns a new time-ordered row key laid out as a ULID: 48 bits of
+// Unix milliseconds followed by 80 random bits, without the version and
+// variant bits of a UUID.
+func NewULID() uuid.UUID {
+	return newTimeOrdered(time.Now(), false)
+}
+
+// newTimeOrdered returns a random key whose first 48 bits are the Unix
+// milliseconds of t, marked as a UUIDv7 if v7 is set.
+func newTimeOrdered(t time.Time, v7 bool) uuid.UUID {
+	var u uuid.UUID
+	if _, err := rand.Read(u[6:]); err != nil {
+		panic("rowkey: reading random bytes: " + err.Error())
+	}
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(t.UnixMilli()))
+	copy(u[:6], ms[2:])
+	if v7 {
+		u[6] = u[6]&0x0f | 0x70
+		u[8] = u[8]&0x3f | 0x80
+	}
+	return u
+}
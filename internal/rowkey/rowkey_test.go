@@ -0,0 +1,44 @@
+package rowkey
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	mezzanine "github.com/ryanbastic/go-mezzanine/pkg/mezzanine"
+)
+
+func TestDerive_MatchesSDK(t *testing.T) {
+	if Namespace != mezzanine.RowKeyNamespace {
+		t.Errorf("Namespace %s, SDK's %s", Namespace, mezzanine.RowKeyNamespace)
+	}
+	for _, tt := range []struct{ ns, key string }{
+		{"user", "alice@example.com"},
+		{"account", "alice@example.com"},
+		{uuid.NameSpaceDNS.String(), "example.com"},
+		{"", ""},
+	} {
+		if got, want := Derive(tt.ns, tt.key), uuid.UUID(mezzanine.DeriveRowKey(tt.ns, tt.key)); got != want {
+			t.Errorf("Derive(%q, %q): got %s, SDK derives %s", tt.ns, tt.key, got, want)
+		}
+	}
+}
+
+func TestNewTimeOrdered(t *testing.T) {
+	at := time.UnixMilli(1700000000123)
+	v7 := newTimeOrdered(at, true)
+	if v7.Version() != 7 || v7.Variant() != uuid.RFC4122 {
+		t.Errorf("v7 key %s: version %d, variant %s", v7, v7.Version(), v7.Variant())
+	}
+	sec, nsec := v7.Time().UnixTime()
+	if got := time.Unix(sec, nsec).UnixMilli(); got != at.UnixMilli() {
+		t.Errorf("v7 key time: got %d, want %d", got, at.UnixMilli())
+	}
+	ulid := newTimeOrdered(at, false)
+	if ulid[0] != v7[0] || ulid[5] != v7[5] {
+		t.Errorf("ULID %s does not lead with the time of %s", ulid, v7)
+	}
+	if NewV7() == NewV7() {
+		t.Error("keys repeat")
+	}
+}
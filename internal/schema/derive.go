@@ -0,0 +1,83 @@
+package schema
+
+// derivation is a column's schema derived from the bodies it has seen.
+type derivation struct {
+	root   *node
+	schema *Schema
+}
+
+// node is a derived JSON Schema. A node without a type admits any value:
+// it is what a value seen with two different types widens to.
+type node struct {
+	Type       string           `json:"type,omitempty"`
+	Properties map[string]*node `json:"properties,omitempty"`
+	Items      *node            `json:"items,omitempty"`
+
+	any bool
+}
+
+// derive returns the schema of a decoded JSON value found depth levels
+// down a body.
+func derive(v any, depth int) *node {
+	if depth >= maxDerivedDepth {
+		return &node{any: true}
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		n := &node{Type: "object", Properties: make(map[string]*node, min(len(v), maxDerivedProperties))}
+		for k, e := range v {
+			if len(n.Properties) == maxDerivedProperties {
+				break
+			}
+			n.Properties[k] = derive(e, depth+1)
+		}
+		return n
+	case []any:
+		n := &node{Type: "array"}
+		for _, e := range v {
+			if n.Items == nil {
+				n.Items = derive(e, depth+1)
+			} else {
+				n.Items.merge(derive(e, depth+1))
+			}
+		}
+		return n
+	case string:
+		return &node{Type: "string"}
+	case float64:
+		return &node{Type: "number"}
+	case bool:
+		return &node{Type: "boolean"}
+	default:
+		return &node{Type: "null"}
+	}
+}
+
+// merge widens n to admit the values o does. It reports whether n changed.
+func (n *node) merge(o *node) bool {
+	switch {
+	case n.any:
+		return false
+	case o.any || n.Type != o.Type:
+		*n = node{any: true}
+		return true
+	}
+	changed := false
+	for k, p := range o.Properties {
+		if existing, ok := n.Properties[k]; ok {
+			changed = existing.merge(p) || changed
+		} else if len(n.Properties) < maxDerivedProperties {
+			n.Properties[k] = p
+			changed = true
+		}
+	}
+	if o.Items != nil {
+		if n.Items == nil {
+			n.Items = o.Items
+			changed = true
+		} else {
+			changed = n.Items.merge(o.Items) || changed
+		}
+	}
+	return changed
+}
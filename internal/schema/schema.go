@@ -0,0 +1,392 @@
+// Package schema keeps versioned JSON Schemas of the cell bodies of each
+// column: the payloads of the cell.written notifications plugins receive.
+// Operators register a column's schema as the contract plugins code
+// against; each change registers a new version, and earlier versions stay
+// readable. For columns without one, a schema is derived from the bodies
+// notified, so plugin authors can see what a column carries before it has a
+// contract.
+//
+// Schemas are validated with the JSON Schema support of the API's OpenAPI
+// layer: type, properties, required, items, enum, bounds, lengths, pattern,
+// additionalProperties and the oneOf/anyOf/allOf/not combinators. Other
+// keywords, such as $ref, are ignored.
+package schema
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// ErrInvalid is returned when registering a document that is not a JSON
+	// Schema object.
+	ErrInvalid = errors.New("invalid schema")
+)
+
+var observationsDropped = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "mezzanine",
+		Name:      "schema_observations_dropped_total",
+		Help:      "Notified bodies not used to derive schemas because the derivation queue was full.",
+	},
+)
+
+// Derivation is bounded: it runs on a worker fed by a queue of
+// observeQueueSize bodies, for up to maxDerivedColumns columns, and
+// derived schemas describe up to maxDerivedProperties properties per
+// object, nested up to maxDerivedDepth levels; deeper values admit any
+// value.
+const (
+	observeQueueSize     = 1024
+	maxDerivedColumns    = 1024
+	maxDerivedProperties = 256
+	maxDerivedDepth      = 16
+)
+
+// Schema is one version of a column's schema.
+type Schema struct {
+	Column string `json:"column"`
+	// Version counts the column's registered schemas from 1. Derived
+	// schemas have version 0.
+	Version   int             `json:"version"`
+	Document  json.RawMessage `json:"document"`
+	CreatedAt time.Time       `json:"created_at"`
+
+	compiled *huma.Schema
+}
+
+// Derived reports whether the schema was derived from notified bodies
+// rather than registered.
+func (s *Schema) Derived() bool {
+	return s.Version == 0
+}
+
+// compile parses the schema's document.
+func (s *Schema) compile() error {
+	var doc map[string]any
+	if err := json.Unmarshal(s.Document, &doc); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	var compiled huma.Schema
+	if err := json.Unmarshal(s.Document, &compiled); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	declareRequired(&compiled)
+	s.compiled = &compiled
+	return nil
+}
+
+// declareRequired adds a property admitting any value for each required
+// field a schema does not describe: the validator only checks required
+// fields that are properties. It then precomputes the schema's messages.
+func declareRequired(s *huma.Schema) {
+	if s == nil {
+		return
+	}
+	for _, name := range s.Required {
+		if _, ok := s.Properties[name]; !ok {
+			if s.Properties == nil {
+				s.Properties = make(map[string]*huma.Schema)
+			}
+			s.Properties[name] = &huma.Schema{}
+		}
+	}
+	for _, p := range s.Properties {
+		declareRequired(p)
+	}
+	declareRequired(s.Items)
+	declareRequired(s.Not)
+	for _, sub := range [][]*huma.Schema{s.OneOf, s.AnyOf, s.AllOf} {
+		for _, c := range sub {
+			declareRequired(c)
+		}
+	}
+	s.PrecomputeMessages()
+}
+
+// registry resolves the (unsupported) references of compiled schemas.
+var registry = huma.NewMapRegistry("#/components/schemas/", huma.DefaultSchemaNamer)
+
+// Validate checks body against the schema. Its error lists every violation.
+func (s *Schema) Validate(body json.RawMessage) error {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return fmt.Errorf("body is not JSON: %w", err)
+	}
+	res := &huma.ValidateResult{}
+	huma.Validate(registry, s.compiled, huma.NewPathBuffer([]byte{}, 0), huma.ModeWriteToServer, v, res)
+	if len(res.Errors) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(res.Errors))
+	for i, e := range res.Errors {
+		msgs[i] = e.Error()
+	}
+	return fmt.Errorf("body does not match %s schema v%d: %s", s.Column, s.Version, strings.Join(msgs, "; "))
+}
+
+// FieldType returns the type the schema declares for the field at a dotted
+// path of a body, through the properties of nested objects: "string",
+// "number", "integer" or "boolean". It is empty where the schema declares no
+// such type.
+func (s *Schema) FieldType(path string) string {
+	node := s.compiled
+	for _, name := range strings.Split(path, ".") {
+		if node == nil {
+			return ""
+		}
+		node = node.Properties[name]
+	}
+	if node == nil {
+		return ""
+	}
+	switch node.Type {
+	case huma.TypeString, huma.TypeNumber, huma.TypeInteger, huma.TypeBoolean:
+		return node.Type
+	}
+	return ""
+}
+
+// Store is a persistent storage interface for registered schemas.
+type Store interface {
+	SaveSchema(ctx context.Context, s *Schema) error
+	ListSchemas(ctx context.Context) ([]*Schema, error)
+}
+
+// Registry is a thread-safe registry of column schemas. When a Store is
+// provided, registered schemas are written through to it; derived schemas
+// are kept in memory and reflect the bodies this instance has notified
+// since it started.
+type Registry struct {
+	mu       sync.RWMutex
+	versions map[string][]*Schema // registered, oldest first
+	derived  map[string]*derivation
+	store    Store // optional; nil means in-memory only
+	// registerMu serializes Register, which persists a version without
+	// holding mu, so that readers are never blocked on the store.
+	registerMu sync.Mutex
+	// observations queue the bodies Observe hands to the derivation
+	// worker, started by the first Observe.
+	observations chan observation
+	startWorker  sync.Once
+}
+
+// NewRegistry creates an empty registry.
+// An optional Store enables persistence.
+func NewRegistry(store ...Store) *Registry {
+	r := &Registry{
+		versions:     make(map[string][]*Schema),
+		derived:      make(map[string]*derivation),
+		observations: make(chan observation, observeQueueSize),
+	}
+	if len(store) > 0 && store[0] != nil {
+		r.store = store[0]
+	}
+	return r
+}
+
+// LoadAll populates the registry from the backing store. It is a no-op if
+// no store is configured.
+func (r *Registry) LoadAll(ctx context.Context) error {
+	if r.store == nil {
+		return nil
+	}
+	schemas, err := r.store.ListSchemas(ctx)
+	if err != nil {
+		return fmt.Errorf("load schemas: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range schemas {
+		if err := s.compile(); err != nil {
+			return fmt.Errorf("load schema %s v%d: %w", s.Column, s.Version, err)
+		}
+		r.versions[s.Column] = append(r.versions[s.Column], s)
+	}
+	for _, versions := range r.versions {
+		sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	}
+	return nil
+}
+
+// Register records doc as the latest schema of column. A document equal to
+// the latest version is not registered again: that version is returned with
+// created false.
+func (r *Registry) Register(ctx context.Context, column string, doc json.RawMessage) (s *Schema, created bool, err error) {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, doc); err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	s = &Schema{Column: column, Document: compact.Bytes()}
+	if err := s.compile(); err != nil {
+		return nil, false, err
+	}
+
+	r.registerMu.Lock()
+	defer r.registerMu.Unlock()
+	if latest, ok := r.Latest(column); ok {
+		if equalJSON(latest.Document, s.Document) {
+			return latest, false, nil
+		}
+		s.Version = latest.Version + 1
+	} else {
+		s.Version = 1
+	}
+	s.CreatedAt = time.Now()
+	if r.store != nil {
+		if err := r.store.SaveSchema(ctx, s); err != nil {
+			return nil, false, fmt.Errorf("persist schema: %w", err)
+		}
+	}
+	r.mu.Lock()
+	r.versions[column] = append(r.versions[column], s)
+	r.mu.Unlock()
+	return s, true, nil
+}
+
+// Latest returns the latest registered schema of column.
+func (r *Registry) Latest(column string) (*Schema, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	versions := r.versions[column]
+	if len(versions) == 0 {
+		return nil, false
+	}
+	return versions[len(versions)-1], true
+}
+
+// Versions returns the registered schemas of column, oldest first.
+func (r *Registry) Versions(column string) []*Schema {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]*Schema(nil), r.versions[column]...)
+}
+
+// Derived returns the schema derived from the bodies of column notified so
+// far.
+func (r *Registry) Derived(column string) (*Schema, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	d, ok := r.derived[column]
+	if !ok {
+		return nil, false
+	}
+	return d.schema, true
+}
+
+// Columns returns the columns with a registered or derived schema, sorted.
+func (r *Registry) Columns() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	seen := make(map[string]bool, len(r.versions)+len(r.derived))
+	for c := range r.versions {
+		seen[c] = true
+	}
+	for c := range r.derived {
+		seen[c] = true
+	}
+	out := make([]string, 0, len(seen))
+	for c := range seen {
+		out = append(out, c)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Observe queues body to widen column's derived schema to admit it, and
+// returns without waiting. Bodies are dropped while observeQueueSize are
+// already queued, and bodies that are not JSON are ignored. Schemas are
+// derived for up to maxDerivedColumns columns.
+func (r *Registry) Observe(column string, body json.RawMessage) {
+	r.startWorker.Do(func() { go r.observeLoop() })
+	select {
+	case r.observations <- observation{column: column, body: body}:
+	default:
+		observationsDropped.Inc()
+	}
+}
+
+// Flush waits for the bodies observed so far to be applied to derived
+// schemas, or for ctx to be done.
+func (r *Registry) Flush(ctx context.Context) error {
+	r.startWorker.Do(func() { go r.observeLoop() })
+	done := make(chan struct{})
+	select {
+	case r.observations <- observation{done: done}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// observation is a body queued by Observe, or a Flush marker with done.
+type observation struct {
+	column string
+	body   json.RawMessage
+	done   chan struct{}
+}
+
+// observeLoop applies queued observations for the life of the process.
+func (r *Registry) observeLoop() {
+	for o := range r.observations {
+		if o.done != nil {
+			close(o.done)
+			continue
+		}
+		r.observe(o.column, o.body)
+	}
+}
+
+// observe widens column's derived schema to admit body.
+func (r *Registry) observe(column string, body json.RawMessage) {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return
+	}
+	observed := derive(v, 0)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d, ok := r.derived[column]
+	if !ok {
+		if len(r.derived) >= maxDerivedColumns {
+			return
+		}
+		d = &derivation{root: observed}
+	} else if !d.root.merge(observed) {
+		return
+	}
+	doc, err := json.Marshal(d.root)
+	if err != nil {
+		return
+	}
+	d.schema = &Schema{Column: column, Document: doc, CreatedAt: time.Now()}
+	r.derived[column] = d
+}
+
+// equalJSON reports whether two JSON documents are equal, ignoring key
+// order.
+func equalJSON(a, b json.RawMessage) bool {
+	var va, vb any
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
@@ -0,0 +1,206 @@
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+type memStore struct {
+	saved []*Schema
+}
+
+func (m *memStore) SaveSchema(_ context.Context, s *Schema) error {
+	m.saved = append(m.saved, s)
+	return nil
+}
+
+func (m *memStore) ListSchemas(context.Context) ([]*Schema, error) {
+	out := make([]*Schema, len(m.saved))
+	for i, s := range m.saved {
+		out[i] = &Schema{Column: s.Column, Version: s.Version, Document: s.Document, CreatedAt: s.CreatedAt}
+	}
+	return out, nil
+}
+
+const orderV1 = `{
+	"type": "object",
+	"required": ["order_id", "amount"],
+	"properties": {
+		"order_id": {"type": "string"},
+		"amount": {"type": "integer", "minimum": 0},
+		"status": {"type": "string", "enum": ["paid", "shipped"]}
+	}
+}`
+
+func TestRegistry_RegisterVersions(t *testing.T) {
+	store := &memStore{}
+	r := NewRegistry(store)
+
+	s, created, err := r.Register(context.Background(), "orders", json.RawMessage(orderV1))
+	if err != nil || !created || s.Version != 1 {
+		t.Fatalf("Register: got v%d created %v err %v, want v1 created", s.Version, created, err)
+	}
+	// The same document, formatted differently, is not a new version.
+	if s, created, _ := r.Register(context.Background(), "orders", json.RawMessage(strings.Join(strings.Fields(orderV1), ""))); created || s.Version != 1 {
+		t.Errorf("re-Register: got v%d created %v, want v1 not created", s.Version, created)
+	}
+	if s, created, _ := r.Register(context.Background(), "orders", json.RawMessage(`{"type":"object"}`)); !created || s.Version != 2 {
+		t.Errorf("Register changed schema: got v%d created %v, want v2 created", s.Version, created)
+	}
+	if _, _, err := r.Register(context.Background(), "orders", json.RawMessage(`["not", "a", "schema"]`)); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Register array: got %v, want ErrInvalid", err)
+	}
+
+	loaded := NewRegistry(store)
+	if err := loaded.LoadAll(context.Background()); err != nil {
+		t.Fatalf("LoadAll: %v", err)
+	}
+	if latest, ok := loaded.Latest("orders"); !ok || latest.Version != 2 {
+		t.Errorf("Latest after load: got %+v", latest)
+	}
+	if v := loaded.Versions("orders"); len(v) != 2 || v[0].Version != 1 {
+		t.Errorf("Versions after load: got %d versions", len(v))
+	}
+}
+
+func TestSchema_Validate(t *testing.T) {
+	r := NewRegistry()
+	s, _, err := r.Register(context.Background(), "orders", json.RawMessage(orderV1))
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	tests := []struct {
+		body  string
+		valid bool
+	}{
+		{`{"order_id":"o-1","amount":1200,"status":"paid"}`, true},
+		{`{"order_id":"o-1","amount":1200,"note":"extra fields are allowed"}`, true},
+		{`{"order_id":"o-1"}`, false},
+		{`{"order_id":"o-1","amount":-5}`, false},
+		{`{"order_id":"o-1","amount":1.5}`, false},
+		{`{"order_id":"o-1","amount":1,"status":"lost"}`, false},
+		{`[1,2]`, false},
+	}
+	for _, tt := range tests {
+		err := s.Validate(json.RawMessage(tt.body))
+		if (err == nil) != tt.valid {
+			t.Errorf("Validate(%s): got %v, want valid %v", tt.body, err, tt.valid)
+		}
+	}
+}
+
+func TestSchema_FieldType(t *testing.T) {
+	doc := `{"type": "object", "properties": {
+		"amount": {"type": "integer"},
+		"paid": {"type": "boolean"},
+		"ship": {"type": "object", "properties": {"country": {"type": "string"}}},
+		"lines": {"type": "array"}
+	}}`
+	s, _, err := NewRegistry().Register(context.Background(), "orders", json.RawMessage(doc))
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	for path, want := range map[string]string{
+		"amount":       "integer",
+		"paid":         "boolean",
+		"ship.country": "string",
+		"ship":         "",
+		"lines":        "",
+		"missing":      "",
+		"amount.x":     "",
+	} {
+		if got := s.FieldType(path); got != want {
+			t.Errorf("FieldType(%q): got %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestRegistry_ObserveDerives(t *testing.T) {
+	r := NewRegistry()
+	r.Observe("orders", json.RawMessage(`{"order_id":"o-1","amount":12,"items":[{"sku":"a"}]}`))
+	flush(t, r)
+	first, ok := r.Derived("orders")
+	if !ok || !first.Derived() {
+		t.Fatalf("Derived: got %+v, %v", first, ok)
+	}
+	want := `{"type":"object","properties":{"amount":{"type":"number"},"items":{"type":"array","items":{"type":"object","properties":{"sku":{"type":"string"}}}},"order_id":{"type":"string"}}}`
+	if string(first.Document) != want {
+		t.Errorf("derived:\n got %s\nwant %s", first.Document, want)
+	}
+
+	// A body within the derived schema leaves it as it is.
+	r.Observe("orders", json.RawMessage(`{"order_id":"o-2"}`))
+	flush(t, r)
+	if same, _ := r.Derived("orders"); same != first {
+		t.Error("derived schema replaced by a conforming body")
+	}
+
+	// New fields are added and fields seen with two types admit any value.
+	r.Observe("orders", json.RawMessage(`{"order_id":7,"region":"eu"}`))
+	flush(t, r)
+	widened, _ := r.Derived("orders")
+	want = `{"type":"object","properties":{"amount":{"type":"number"},"items":{"type":"array","items":{"type":"object","properties":{"sku":{"type":"string"}}}},"order_id":{},"region":{"type":"string"}}}`
+	if string(widened.Document) != want {
+		t.Errorf("widened:\n got %s\nwant %s", widened.Document, want)
+	}
+
+	if cols := r.Columns(); len(cols) != 1 || cols[0] != "orders" {
+		t.Errorf("Columns: got %v", cols)
+	}
+}
+
+func TestRegistry_ObserveBounded(t *testing.T) {
+	r := NewRegistry()
+	deep := strings.Repeat(`{"a":`, maxDerivedDepth+4) + "1" + strings.Repeat("}", maxDerivedDepth+4)
+	r.Observe("deep", json.RawMessage(deep))
+	fields := make([]string, maxDerivedProperties+10)
+	for i := range fields {
+		fields[i] = fmt.Sprintf(`"f%d":%d`, i, i)
+	}
+	r.Observe("wide", json.RawMessage("{"+strings.Join(fields, ",")+"}"))
+	flush(t, r)
+
+	d, ok := r.Derived("deep")
+	if !ok {
+		t.Fatal("no schema derived for deep")
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(d.Document, &doc); err != nil {
+		t.Fatal(err)
+	}
+	depth := 0
+	for {
+		props, ok := doc["properties"].(map[string]any)
+		if !ok {
+			break
+		}
+		doc = props["a"].(map[string]any)
+		depth++
+	}
+	if depth != maxDerivedDepth {
+		t.Errorf("deep: derived %d levels, want %d", depth, maxDerivedDepth)
+	}
+
+	w, _ := r.Derived("wide")
+	if err := json.Unmarshal(w.Document, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(doc["properties"].(map[string]any)); n != maxDerivedProperties {
+		t.Errorf("wide: derived %d properties, want %d", n, maxDerivedProperties)
+	}
+}
+
+func flush(t *testing.T, r *Registry) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresStore implements Store backed by the column_schemas table (see
+// storage.RunColumnMigration).
+type PostgresStore struct {
+	pool         *pgxpool.Pool
+	queryTimeout time.Duration
+}
+
+// NewPostgresStore creates a Store using the given connection pool.
+// queryTimeout sets the per-query context deadline; zero means no timeout.
+func NewPostgresStore(pool *pgxpool.Pool, queryTimeout time.Duration) *PostgresStore {
+	return &PostgresStore{pool: pool, queryTimeout: queryTimeout}
+}
+
+func (s *PostgresStore) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.queryTimeout > 0 {
+		return context.WithTimeout(ctx, s.queryTimeout)
+	}
+	return ctx, func() {}
+}
+
+func (s *PostgresStore) SaveSchema(ctx context.Context, sc *Schema) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.pool.Exec(ctx, `
+		INSERT INTO column_schemas (column_name, version, document, created_at)
+		VALUES ($1, $2, $3, $4)
+	`, sc.Column, sc.Version, []byte(sc.Document), sc.CreatedAt); err != nil {
+		return fmt.Errorf("save schema: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) ListSchemas(ctx context.Context) ([]*Schema, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT column_name, version, document, created_at
+		FROM column_schemas
+		ORDER BY column_name, version
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("list schemas: %w", err)
+	}
+	defer rows.Close()
+
+	var out []*Schema
+	for rows.Next() {
+		var sc Schema
+		var doc []byte
+		if err := rows.Scan(&sc.Column, &sc.Version, &doc, &sc.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan schema: %w", err)
+		}
+		sc.Document = doc
+		out = append(out, &sc)
+	}
+	return out, rows.Err()
+}
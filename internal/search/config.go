@@ -0,0 +1,113 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+)
+
+// Column is how one column is indexed: its latest version per row is a
+// document in Index, holding Fields of the cell body, or the whole body
+// when Fields is empty.
+type Column struct {
+	Column string   `json:"column"`
+	Index  string   `json:"index"`
+	Fields []string `json:"fields,omitempty"`
+	// Settings and Mappings are sent when Index is created, as the bodies
+	// of its "settings" and "mappings"; an existing index is left alone.
+	Settings json.RawMessage `json:"settings,omitempty"`
+	Mappings json.RawMessage `json:"mappings,omitempty"`
+}
+
+// Config is the contents of a search config file.
+type Config struct {
+	Columns []Column `json:"columns"`
+}
+
+// Load reads and validates a search config file.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read search config: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse search config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate checks that every column is a client column indexed once, each
+// into an index of its own with a valid name.
+func (c *Config) Validate() error {
+	if len(c.Columns) == 0 {
+		return fmt.Errorf("search config: no columns")
+	}
+	columns := make(map[string]bool, len(c.Columns))
+	indexes := make(map[string]bool, len(c.Columns))
+	for i, col := range c.Columns {
+		if err := cell.ValidateColumnName(col.Column); err != nil {
+			return fmt.Errorf("column %d: %w", i, err)
+		}
+		if cell.IsReserved(col.Column) {
+			return fmt.Errorf("column %s: system columns cannot be indexed", col.Column)
+		}
+		if columns[col.Column] {
+			return fmt.Errorf("column %s: indexed twice", col.Column)
+		}
+		columns[col.Column] = true
+		if err := validateIndexName(col.Index); err != nil {
+			return fmt.Errorf("column %s: %w", col.Column, err)
+		}
+		// Documents are keyed by row_key alone, so columns sharing an index
+		// would overwrite each other's.
+		if indexes[col.Index] {
+			return fmt.Errorf("column %s: index %q is used by another column", col.Column, col.Index)
+		}
+		indexes[col.Index] = true
+		for _, f := range col.Fields {
+			if f == "" {
+				return fmt.Errorf("column %s: empty field", col.Column)
+			}
+		}
+		if !isObject(col.Settings) {
+			return fmt.Errorf("column %s: settings must be an object", col.Column)
+		}
+		if !isObject(col.Mappings) {
+			return fmt.Errorf("column %s: mappings must be an object", col.Column)
+		}
+	}
+	return nil
+}
+
+// validateIndexName applies Elasticsearch's rules for index names.
+func validateIndexName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("index is required")
+	case len(name) > 255:
+		return fmt.Errorf("index %q is longer than 255 bytes", name)
+	case name != strings.ToLower(name):
+		return fmt.Errorf("index %q must be lowercase", name)
+	case strings.ContainsAny(name, `\/*?"<>| ,#:`):
+		return fmt.Errorf("index %q contains a forbidden character", name)
+	case strings.ContainsAny(name[:1], "-_+"), name == ".", name == "..":
+		return fmt.Errorf("index %q is not a valid index name", name)
+	}
+	return nil
+}
+
+// isObject reports whether raw is absent or a JSON object.
+func isObject(raw json.RawMessage) bool {
+	if raw == nil {
+		return true
+	}
+	var obj map[string]json.RawMessage
+	return json.Unmarshal(raw, &obj) == nil && obj != nil
+}
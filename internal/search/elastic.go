@@ -0,0 +1,139 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Document is one document sent to the search cluster.
+type Document struct {
+	Index string
+	ID    string
+	// Version is compared with the indexed document's: the document is
+	// written only if Version is greater.
+	Version int64
+	Source  json.RawMessage
+}
+
+// Target is a search cluster.
+type Target interface {
+	// EnsureIndex creates index with settings and mappings, either of which
+	// may be nil, unless it exists.
+	EnsureIndex(ctx context.Context, index string, settings, mappings json.RawMessage) error
+	// Bulk writes docs and returns the HTTP status of each; an error means
+	// none were written.
+	Bulk(ctx context.Context, docs []Document) ([]int, error)
+}
+
+// ElasticTarget is an Elasticsearch or OpenSearch cluster, reached over its
+// REST API.
+type ElasticTarget struct {
+	baseURL string
+	user    *url.Userinfo
+	apiKey  string
+	client  *http.Client
+}
+
+// NewElasticTarget returns the cluster at rawURL. Credentials in the URL
+// are sent with basic authentication; a non-empty apiKey is sent instead as
+// an Elasticsearch API key.
+func NewElasticTarget(rawURL, apiKey string, client *http.Client) (*ElasticTarget, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse search url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("search url %q: want http(s)://host[:port]", rawURL)
+	}
+	user := u.User
+	u.User = nil
+	return &ElasticTarget{baseURL: strings.TrimSuffix(u.String(), "/"), user: user, apiKey: apiKey, client: client}, nil
+}
+
+func (t *ElasticTarget) do(ctx context.Context, method, path, contentType string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, t.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	switch {
+	case t.apiKey != "":
+		req.Header.Set("Authorization", "ApiKey "+t.apiKey)
+	case t.user != nil:
+		password, _ := t.user.Password()
+		req.SetBasicAuth(t.user.Username(), password)
+	}
+	return t.client.Do(req)
+}
+
+// EnsureIndex implements Target.
+func (t *ElasticTarget) EnsureIndex(ctx context.Context, index string, settings, mappings json.RawMessage) error {
+	body, err := json.Marshal(struct {
+		Settings json.RawMessage `json:"settings,omitempty"`
+		Mappings json.RawMessage `json:"mappings,omitempty"`
+	}{settings, mappings})
+	if err != nil {
+		return fmt.Errorf("encode index %s: %w", index, err)
+	}
+	resp, err := t.do(ctx, http.MethodPut, "/"+url.PathEscape(index), "application/json", body)
+	if err != nil {
+		return fmt.Errorf("create index %s: %w", index, err)
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusBadRequest && bytes.Contains(msg, []byte("resource_already_exists_exception")) {
+		return nil
+	}
+	return fmt.Errorf("create index %s: status %d: %s", index, resp.StatusCode, msg)
+}
+
+// Bulk implements Target, with one request to the bulk API. Documents are
+// versioned externally.
+func (t *ElasticTarget) Bulk(ctx context.Context, docs []Document) ([]int, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, d := range docs {
+		action := map[string]any{"index": map[string]any{
+			"_index":       d.Index,
+			"_id":          d.ID,
+			"version":      d.Version,
+			"version_type": "external",
+		}}
+		if err := enc.Encode(action); err != nil {
+			return nil, fmt.Errorf("encode bulk action: %w", err)
+		}
+		buf.Write(d.Source)
+		buf.WriteByte('\n')
+	}
+	resp, err := t.do(ctx, http.MethodPost, "/_bulk", "application/x-ndjson", buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("bulk: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("bulk: status %d: %s", resp.StatusCode, msg)
+	}
+	var result struct {
+		Items []map[string]struct {
+			Status int `json:"status"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("bulk: decode response: %w", err)
+	}
+	if len(result.Items) != len(docs) {
+		return nil, fmt.Errorf("bulk: %d results for %d documents", len(result.Items), len(docs))
+	}
+	statuses := make([]int, len(docs))
+	for i, item := range result.Items {
+		statuses[i] = item["index"].Status
+	}
+	return statuses, nil
+}
@@ -0,0 +1,100 @@
+package search
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestElasticTarget_Bulk(t *testing.T) {
+	var lines []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("got %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		if user, pass, ok := r.BasicAuth(); !ok || user != "elastic" || pass != "secret" {
+			t.Errorf("basic auth: got %q %q %v", user, pass, ok)
+		}
+		sc := bufio.NewScanner(r.Body)
+		for sc.Scan() {
+			lines = append(lines, sc.Text())
+		}
+		io.WriteString(w, `{"errors":true,"items":[{"index":{"status":201}},{"index":{"status":409}}]}`) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	target, err := NewElasticTarget(strings.Replace(srv.URL, "http://", "http://elastic:secret@", 1), "", srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses, err := target.Bulk(context.Background(), []Document{
+		{Index: "profiles", ID: "a", Version: 3, Source: json.RawMessage(`{"name":"Alice"}`)},
+		{Index: "profiles", ID: "b", Version: 1, Source: json.RawMessage(`{"name":"Bob"}`)},
+	})
+	if err != nil || len(statuses) != 2 || statuses[0] != 201 || statuses[1] != 409 {
+		t.Fatalf("Bulk: got %v, %v", statuses, err)
+	}
+	if len(lines) != 4 || lines[1] != `{"name":"Alice"}` {
+		t.Fatalf("request: got %q", lines)
+	}
+	var action struct {
+		Index struct {
+			Index       string `json:"_index"`
+			ID          string `json:"_id"`
+			Version     int64  `json:"version"`
+			VersionType string `json:"version_type"`
+		} `json:"index"`
+	}
+	_ = json.Unmarshal([]byte(lines[0]), &action)
+	if action.Index.Index != "profiles" || action.Index.ID != "a" || action.Index.Version != 3 || action.Index.VersionType != "external" {
+		t.Errorf("action: got %+v", action.Index)
+	}
+}
+
+func TestElasticTarget_EnsureIndex(t *testing.T) {
+	var body string
+	exists := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/profiles" || r.Header.Get("Authorization") != "ApiKey k3y" {
+			t.Errorf("got %s %s, Authorization %q", r.Method, r.URL.Path, r.Header.Get("Authorization"))
+		}
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		if exists {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":{"type":"resource_already_exists_exception"},"status":400}`) //nolint:errcheck
+			return
+		}
+		exists = true
+		io.WriteString(w, `{"acknowledged":true}`) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	target, err := NewElasticTarget(srv.URL, "k3y", srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mappings := json.RawMessage(`{"properties":{"bio":{"type":"text"}}}`)
+	if err := target.EnsureIndex(context.Background(), "profiles", nil, mappings); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if body != `{"mappings":{"properties":{"bio":{"type":"text"}}}}` {
+		t.Errorf("body: got %s", body)
+	}
+	if err := target.EnsureIndex(context.Background(), "profiles", nil, mappings); err != nil {
+		t.Errorf("existing index: %v", err)
+	}
+}
+
+func TestNewElasticTarget_InvalidURL(t *testing.T) {
+	for _, u := range []string{"", "localhost:9200", "ftp://host"} {
+		if _, err := NewElasticTarget(u, "", http.DefaultClient); err == nil {
+			t.Errorf("%q: want an error", u)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+// Package search indexes chosen columns into Elasticsearch or OpenSearch,
+// for full-text queries that the JSONB secondary indexes cannot answer.
+//
+// Each shard is tailed in added_id order, as replication does, and the
+// cells of the configured columns are sent to the search cluster with its
+// bulk API: a row's latest version of a column is one document in the
+// column's index, with the row_key as its ID. Documents are versioned
+// externally by ref_key, so a version delivered late never replaces a newer
+// one, and a version indexed again after a restart is refused as stale,
+// which is harmless. Progress is checkpointed per shard.
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/offload"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+var (
+	documentsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "mezzanine",
+			Name:      "search_documents_total",
+			Help:      "Cells sent to the search cluster, by result: indexed, stale (a newer version is indexed), rejected (by the cluster, e.g. for a mapping conflict) or skipped (binary and offloaded bodies).",
+		},
+		[]string{"result"},
+	)
+	errorsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "mezzanine",
+			Name:      "search_errors_total",
+			Help:      "Failed attempts to read, index or checkpoint a shard's cells; they are retried.",
+		},
+	)
+	lagSeconds = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "mezzanine",
+			Name:      "search_lag_seconds",
+			Help:      "Age of the oldest cell not yet indexed, across the shards this instance indexes.",
+		},
+	)
+)
+
+// Options configures an Indexer.
+type Options struct {
+	// Name identifies the indexer's checkpoints, so that one cluster can
+	// feed several search clusters (default "default").
+	Name string
+	// NumShards is the number of shards.
+	NumShards int
+	// BatchSize is the number of cells read per query, and so the most
+	// documents in a bulk request (default 500).
+	BatchSize int
+	// PollInterval is how long a caught-up shard waits before it is read
+	// again (default 1s).
+	PollInterval time.Duration
+	// Settle holds back cells younger than this (default 2s), a margin on
+	// top of PartitionRead never passing a slow transaction's cell.
+	Settle time.Duration
+	// Concurrency bounds the shards read and indexed at once (default 4).
+	Concurrency int
+	// Timeout bounds each request to the search cluster (default 10s).
+	Timeout time.Duration
+}
+
+// Indexer indexes shards' cells into a search cluster.
+type Indexer struct {
+	router      *shard.Router
+	target      Target
+	checkpoints storage.Checkpoints
+	columns     map[string]Column
+	opts        Options
+	sem         chan struct{}
+	logger      *slog.Logger
+
+	mu  sync.Mutex
+	lag map[int]time.Duration
+
+	// ensureMu guards ready, set once the indexes exist.
+	ensureMu sync.Mutex
+	ready    bool
+}
+
+// New returns an indexer reading shards through router and indexing the
+// columns of cfg, which must be valid, into target. checkpoints keeps its
+// position on each shard: the added_id of the last cell indexed.
+func New(router *shard.Router, target Target, checkpoints storage.Checkpoints, cfg *Config, opts Options, logger *slog.Logger) *Indexer {
+	if opts.Name == "" {
+		opts.Name = "default"
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.Settle <= 0 {
+		opts.Settle = 2 * time.Second
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	columns := make(map[string]Column, len(cfg.Columns))
+	for _, c := range cfg.Columns {
+		columns[c.Column] = c
+	}
+	return &Indexer{
+		router:      router,
+		target:      target,
+		checkpoints: checkpoints,
+		columns:     columns,
+		opts:        opts,
+		sem:         make(chan struct{}, opts.Concurrency),
+		lag:         make(map[int]time.Duration),
+		logger:      logger.With("search", opts.Name),
+	}
+}
+
+// Run indexes every shard until ctx is cancelled. Use it when one instance
+// indexes the whole cluster; with shard leases, register RunShard as a
+// lease handler instead.
+func (x *Indexer) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for id := range x.opts.NumShards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			x.RunShard(ctx, id)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// RunShard indexes shardID until ctx is cancelled. It has the signature of
+// a lease.Handler.
+func (x *Indexer) RunShard(ctx context.Context, shardID int) {
+	defer x.setLag(shardID, -1)
+	var pos int64
+	loaded := false
+	for ctx.Err() == nil {
+		var caughtUp bool
+		err := x.ensureIndexes(ctx)
+		if err == nil && !loaded {
+			pos, err = x.checkpoints.Load(ctx, x.opts.Name, shardID)
+			loaded = err == nil
+		}
+		if err == nil && loaded {
+			caughtUp, err = x.step(ctx, shardID, &pos)
+		}
+		if err != nil && ctx.Err() == nil {
+			errorsTotal.Inc()
+			x.logger.Warn("search indexing failed; retrying", "shard_id", shardID, "position", pos, "error", err)
+		}
+		if caughtUp || err != nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(x.opts.PollInterval):
+			}
+		}
+	}
+}
+
+// ensureIndexes creates the configured indexes that do not exist, once.
+func (x *Indexer) ensureIndexes(ctx context.Context) error {
+	x.ensureMu.Lock()
+	defer x.ensureMu.Unlock()
+	if x.ready {
+		return nil
+	}
+	for _, c := range x.columns {
+		reqCtx, cancel := context.WithTimeout(ctx, x.opts.Timeout)
+		err := x.target.EnsureIndex(reqCtx, c.Index, c.Settings, c.Mappings)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+	x.ready = true
+	return nil
+}
+
+// step indexes the next batch of shardID's cells after *pos and advances
+// *pos past them. It reports whether the shard is caught up.
+func (x *Indexer) step(ctx context.Context, shardID int, pos *int64) (bool, error) {
+	select {
+	case x.sem <- struct{}{}:
+	case <-ctx.Done():
+		return false, nil
+	}
+	defer func() { <-x.sem }()
+
+	store, err := x.router.StoreFor(shard.ID(shardID))
+	if err != nil {
+		return false, err
+	}
+	cells, err := store.PartitionRead(ctx, shardID, storage.PartitionReadTypeAddedID, *pos, time.Time{}, x.opts.BatchSize)
+	if err != nil {
+		return false, err
+	}
+
+	caughtUp := len(cells) < x.opts.BatchSize
+	var docs []Document
+	var sent []cell.Cell
+	next := *pos
+	for _, c := range cells {
+		if time.Since(c.CreatedAt) < x.opts.Settle {
+			caughtUp = true
+			break
+		}
+		next = c.AddedID
+		col, ok := x.columns[c.ColumnName]
+		if !ok {
+			continue
+		}
+		doc, ok, err := document(col, c)
+		if err != nil {
+			documentsTotal.WithLabelValues("rejected").Inc()
+			x.logger.Warn("cell cannot be indexed; skipping", "shard_id", shardID, "row_key", c.RowKey, "column_name", c.ColumnName, "ref_key", c.RefKey, "error", err)
+			continue
+		}
+		if !ok {
+			documentsTotal.WithLabelValues("skipped").Inc()
+			continue
+		}
+		docs = append(docs, doc)
+		sent = append(sent, c)
+	}
+
+	if len(docs) > 0 {
+		if err := x.index(ctx, shardID, docs, sent); err != nil {
+			// The lag is the age of the oldest cell still to index: the
+			// first of the batch.
+			if first := nextAfter(cells, *pos); first != nil {
+				x.setLag(shardID, time.Since(first.CreatedAt))
+			}
+			return false, err
+		}
+	}
+	if caughtUp {
+		x.setLag(shardID, 0)
+	} else {
+		// The next cell is unread; it is at most as old as the batch's last.
+		x.setLag(shardID, time.Since(cells[len(cells)-1].CreatedAt))
+	}
+
+	if next != *pos {
+		if err := x.checkpoints.Save(ctx, x.opts.Name, shardID, next); err != nil {
+			// The batch is indexed again after a restart, and refused as
+			// stale.
+			return false, err
+		}
+		*pos = next
+	}
+	return caughtUp, nil
+}
+
+// index sends docs, the documents of cells sent, in one bulk request. It
+// fails if any document should be retried, so the batch is sent again.
+func (x *Indexer) index(ctx context.Context, shardID int, docs []Document, sent []cell.Cell) error {
+	ctx, cancel := context.WithTimeout(ctx, x.opts.Timeout)
+	defer cancel()
+	statuses, err := x.target.Bulk(ctx, docs)
+	if err != nil {
+		return err
+	}
+	var retry int
+	for i, status := range statuses {
+		c := sent[i]
+		switch {
+		case status >= 200 && status < 300:
+			documentsTotal.WithLabelValues("indexed").Inc()
+		case status == http.StatusConflict:
+			documentsTotal.WithLabelValues("stale").Inc()
+		case status == http.StatusTooManyRequests || status >= 500:
+			retry++
+		default:
+			documentsTotal.WithLabelValues("rejected").Inc()
+			x.logger.Warn("search cluster rejected a document; skipping",
+				"shard_id", shardID, "index", docs[i].Index, "row_key", c.RowKey, "column_name", c.ColumnName, "ref_key", c.RefKey, "status", status)
+		}
+	}
+	if retry > 0 {
+		return fmt.Errorf("bulk: %d of %d documents failed", retry, len(docs))
+	}
+	return nil
+}
+
+// document returns the document of c in col's index. Binary and offloaded
+// bodies are not indexed, and report false.
+func document(col Column, c cell.Cell) (Document, bool, error) {
+	if _, ok := cell.ParseBlobBody(c.Body); ok {
+		return Document{}, false, nil
+	}
+	if _, ok := offload.Parse(c.Body); ok {
+		return Document{}, false, nil
+	}
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(c.Body, &body); err != nil || body == nil {
+		return Document{}, false, fmt.Errorf("body is not a JSON object")
+	}
+	source := body
+	if len(col.Fields) > 0 {
+		source = make(map[string]json.RawMessage, len(col.Fields)+1)
+		for _, f := range col.Fields {
+			if v, ok := body[f]; ok {
+				source[f] = v
+			}
+		}
+	}
+	meta, err := json.Marshal(struct {
+		RowKey    string    `json:"row_key"`
+		RefKey    int64     `json:"ref_key"`
+		CreatedAt time.Time `json:"created_at"`
+	}{c.RowKey.String(), c.RefKey, c.CreatedAt.UTC()})
+	if err != nil {
+		return Document{}, false, err
+	}
+	source[metaField] = meta
+	data, err := json.Marshal(source)
+	if err != nil {
+		return Document{}, false, err
+	}
+	return Document{Index: col.Index, ID: c.RowKey.String(), Version: c.RefKey, Source: data}, true, nil
+}
+
+// metaField holds the cell's row_key, ref_key and created_at in every
+// document, replacing a body field of the same name.
+const metaField = "mezzanine"
+
+// nextAfter returns the first of cells after pos, or nil.
+func nextAfter(cells []cell.Cell, pos int64) *cell.Cell {
+	for i := range cells {
+		if cells[i].AddedID > pos {
+			return &cells[i]
+		}
+	}
+	return nil
+}
+
+// setLag records shardID's lag, or forgets the shard if lag is negative,
+// and publishes the largest.
+func (x *Indexer) setLag(shardID int, lag time.Duration) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if lag < 0 {
+		delete(x.lag, shardID)
+	} else {
+		x.lag[shardID] = lag
+	}
+	var most time.Duration
+	for _, l := range x.lag {
+		most = max(most, l)
+	}
+	lagSeconds.Set(most.Seconds())
+}
+
+// Lag returns the age of the oldest cell not yet indexed, across the shards
+// this instance indexes.
+func (x *Indexer) Lag() time.Duration {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	var most time.Duration
+	for _, l := range x.lag {
+		most = max(most, l)
+	}
+	return most
+}
@@ -0,0 +1,226 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/storetest"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// cluster records indexed documents, answering each with status[ref_key]
+// or 201; it fails while down is set.
+type cluster struct {
+	mu      sync.Mutex
+	indexes []string
+	docs    []Document
+	status  map[int64]int
+	down    bool
+}
+
+func (c *cluster) EnsureIndex(_ context.Context, index string, _, _ json.RawMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.down {
+		return errors.New("cluster unavailable")
+	}
+	c.indexes = append(c.indexes, index)
+	return nil
+}
+
+func (c *cluster) Bulk(_ context.Context, docs []Document) ([]int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.down {
+		return nil, errors.New("cluster unavailable")
+	}
+	statuses := make([]int, len(docs))
+	for i, d := range docs {
+		statuses[i] = http.StatusCreated
+		if s, ok := c.status[d.Version]; ok {
+			statuses[i] = s
+			continue
+		}
+		c.docs = append(c.docs, d)
+	}
+	return statuses, nil
+}
+
+// newLog returns cells of column with added_id and ref_key 1..n, created
+// age ago.
+func newLog(n int, column string, age time.Duration) []cell.Cell {
+	cells := make([]cell.Cell, n)
+	for i := range cells {
+		cells[i] = cell.Cell{AddedID: int64(i + 1), RowKey: uuid.New(), ColumnName: column, RefKey: int64(i + 1), Body: json.RawMessage(`{"name":"Alice","bio":"likes tea","ssn":"123"}`), CreatedAt: time.Now().Add(-age)}
+	}
+	return cells
+}
+
+var testConfig = &Config{Columns: []Column{{Column: "profile", Index: "profiles", Fields: []string{"name", "bio"}}}}
+
+func newTestIndexer(store *storetest.Log, target Target, opts Options) (*Indexer, *storetest.Checkpoints) {
+	r := shard.NewRouter()
+	r.Register(0, store)
+	cp := &storetest.Checkpoints{}
+	opts.NumShards = 1
+	return New(r, target, cp, testConfig, opts, testLogger()), cp
+}
+
+func TestIndexer_IndexesConfiguredColumns(t *testing.T) {
+	cells := newLog(4, "profile", time.Minute)
+	cells[1].ColumnName = "orders"
+	cells[2].Body = cell.BlobBody("image/png", []byte("png"))
+	store := &storetest.Log{Cells: cells}
+	target := &cluster{}
+	x, cp := newTestIndexer(store, target, Options{})
+
+	var pos int64
+	caughtUp, err := x.step(context.Background(), 0, &pos)
+	if err != nil || !caughtUp {
+		t.Fatalf("step: caught up %v, err %v", caughtUp, err)
+	}
+	if len(target.docs) != 2 || target.docs[0].Version != 1 || target.docs[1].Version != 4 {
+		t.Fatalf("indexed: got %+v, want ref_keys 1 and 4", target.docs)
+	}
+	d := target.docs[0]
+	if d.Index != "profiles" || d.ID != cells[0].RowKey.String() {
+		t.Errorf("document: got index %q, id %q", d.Index, d.ID)
+	}
+	var source map[string]any
+	_ = json.Unmarshal(d.Source, &source)
+	meta, _ := source["mezzanine"].(map[string]any)
+	if source["name"] != "Alice" || source["bio"] != "likes tea" || source["ssn"] != nil || meta["row_key"] != cells[0].RowKey.String() || meta["ref_key"] != 1.0 {
+		t.Errorf("source: got %s", d.Source)
+	}
+	if cp.Position(0) != 4 || pos != 4 {
+		t.Errorf("checkpoint: got %d, position %d; want 4", cp.Position(0), pos)
+	}
+}
+
+func TestIndexer_StaleAndRejectedAreSkipped(t *testing.T) {
+	store := &storetest.Log{Cells: newLog(3, "profile", time.Minute)}
+	target := &cluster{status: map[int64]int{1: http.StatusConflict, 2: http.StatusBadRequest}}
+	x, cp := newTestIndexer(store, target, Options{})
+
+	var pos int64
+	if _, err := x.step(context.Background(), 0, &pos); err != nil {
+		t.Fatalf("step: %v", err)
+	}
+	if len(target.docs) != 1 || cp.Position(0) != 3 {
+		t.Errorf("got %d documents, checkpoint %d; want 1, 3", len(target.docs), cp.Position(0))
+	}
+}
+
+func TestIndexer_RetriesFailedBatch(t *testing.T) {
+	store := &storetest.Log{Cells: newLog(3, "profile", time.Minute)}
+	target := &cluster{status: map[int64]int{2: http.StatusTooManyRequests}}
+	x, cp := newTestIndexer(store, target, Options{})
+
+	var pos int64
+	if _, err := x.step(context.Background(), 0, &pos); err == nil {
+		t.Fatal("step with a throttled document: want an error")
+	}
+	if pos != 0 || cp.Position(0) != 0 {
+		t.Errorf("position moved to %d, checkpoint %d; want 0", pos, cp.Position(0))
+	}
+	if x.Lag() < time.Minute {
+		t.Errorf("lag: got %v, want at least 1m", x.Lag())
+	}
+
+	delete(target.status, 2)
+	if _, err := x.step(context.Background(), 0, &pos); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if pos != 3 || x.Lag() != 0 {
+		t.Errorf("after retry: position %d, lag %v; want 3, 0", pos, x.Lag())
+	}
+}
+
+func TestIndexer_HoldsBackUnsettledCells(t *testing.T) {
+	cells := newLog(3, "profile", time.Minute)
+	cells[2].CreatedAt = time.Now()
+	store := &storetest.Log{Cells: cells}
+	target := &cluster{}
+	x, _ := newTestIndexer(store, target, Options{Settle: 30 * time.Second})
+
+	var pos int64
+	caughtUp, err := x.step(context.Background(), 0, &pos)
+	if err != nil || !caughtUp || pos != 2 || len(target.docs) != 2 {
+		t.Errorf("got caught up %v, err %v, position %d, %d documents; want true, nil, 2, 2", caughtUp, err, pos, len(target.docs))
+	}
+}
+
+func TestIndexer_RunShardCreatesIndexes(t *testing.T) {
+	store := &storetest.Log{Cells: newLog(2, "profile", time.Minute)}
+	target := &cluster{}
+	x, cp := newTestIndexer(store, target, Options{PollInterval: time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		x.RunShard(ctx, 0)
+		close(done)
+	}()
+	deadline := time.After(5 * time.Second)
+	for {
+		pos := cp.Position(0)
+		if pos == 2 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("shard was not indexed")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	cancel()
+	<-done
+	target.mu.Lock()
+	defer target.mu.Unlock()
+	if len(target.indexes) != 1 || target.indexes[0] != "profiles" {
+		t.Errorf("indexes created: got %v", target.indexes)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	for _, tt := range []struct {
+		name, config, wantErr string
+	}{
+		{"valid", `{"columns":[{"column":"profile","index":"profiles","fields":["bio"],"mappings":{"properties":{"bio":{"type":"text"}}}}]}`, ""},
+		{"no columns", `{"columns":[]}`, "no columns"},
+		{"system column", `{"columns":[{"column":"_mezz.meta","index":"meta"}]}`, "system columns"},
+		{"column twice", `{"columns":[{"column":"a","index":"a"},{"column":"a","index":"b"}]}`, "indexed twice"},
+		{"shared index", `{"columns":[{"column":"a","index":"x"},{"column":"b","index":"x"}]}`, "used by another column"},
+		{"uppercase index", `{"columns":[{"column":"a","index":"Profiles"}]}`, "lowercase"},
+		{"index with slash", `{"columns":[{"column":"a","index":"a/b"}]}`, "forbidden character"},
+		{"index with underscore", `{"columns":[{"column":"a","index":"_a"}]}`, "not a valid index name"},
+		{"mappings not an object", `{"columns":[{"column":"a","index":"a","mappings":[]}]}`, "mappings must be an object"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "search.json")
+			if err := os.WriteFile(path, []byte(tt.config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Load(path)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("got %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ryanbastic/go-mezzanine/internal/awssig"
+	"github.com/ryanbastic/go-mezzanine/internal/config"
+)
+
+// AWSProvider reads a database URL from AWS Secrets Manager.
+// Requests are signed with SigV4 using static credentials from the standard
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN variables.
+type AWSProvider struct {
+	httpClient *http.Client
+	endpoint   string
+	region     string
+	creds      awssig.Credentials
+	secretID   string
+	key        string
+	now        func() time.Time
+}
+
+// NewAWSProvider creates a provider for the secret named by cfg.Path.
+// AWS_ENDPOINT_URL_SECRETS_MANAGER overrides the regional endpoint
+// (useful for LocalStack and VPC endpoints).
+func NewAWSProvider(cfg config.SecretConfig, httpClient *http.Client) (*AWSProvider, error) {
+	region := cfg.Region
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		return nil, fmt.Errorf("aws: region not set (secret.region or AWS_REGION)")
+	}
+	creds, ok := awssig.CredentialsFromEnv()
+	if !ok {
+		return nil, fmt.Errorf("aws: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_SECRETS_MANAGER")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com", region)
+	}
+	return &AWSProvider{
+		httpClient: httpClient,
+		endpoint:   strings.TrimRight(endpoint, "/") + "/",
+		region:     region,
+		creds:      creds,
+		secretID:   cfg.Path,
+		key:        cfg.Key,
+		now:        time.Now,
+	}, nil
+}
+
+func (p *AWSProvider) Fetch(ctx context.Context) (string, error) {
+	payload, err := json.Marshal(map[string]string{"SecretId": p.secretID})
+	if err != nil {
+		return "", fmt.Errorf("aws: marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("aws: create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	awssig.Sign(req, payload, p.creds, p.region, "secretsmanager", p.now().UTC())
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("aws: request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("aws: read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("aws: unexpected status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var out struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return "", fmt.Errorf("aws: unmarshal response: %w", err)
+	}
+	if out.SecretString == "" {
+		return "", fmt.Errorf("aws: secret %s has no SecretString", p.secretID)
+	}
+	if p.key == "" {
+		return out.SecretString, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(out.SecretString), &fields); err != nil {
+		return "", fmt.Errorf("aws: secret %s is not a JSON object: %w", p.secretID, err)
+	}
+	raw, ok := fields[p.key]
+	if !ok {
+		return "", fmt.Errorf("aws: key %q not found in %s", p.key, p.secretID)
+	}
+	var url string
+	if err := json.Unmarshal(raw, &url); err != nil {
+		return "", fmt.Errorf("aws: key %q is not a string: %w", p.key, err)
+	}
+	return url, nil
+}
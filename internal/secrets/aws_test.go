@@ -0,0 +1,78 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ryanbastic/go-mezzanine/internal/config"
+)
+
+func TestAWSProvider_Fetch(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    string
+		secret string
+		want   string
+	}{
+		{name: "plain string", secret: "postgres://u:p@rds/db", want: "postgres://u:p@rds/db"},
+		{name: "json key", key: "url", secret: `{"url":"postgres://k/db"}`, want: "postgres://k/db"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("X-Amz-Target"); got != "secretsmanager.GetSecretValue" {
+					t.Errorf("X-Amz-Target: got %q", got)
+				}
+				if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+					t.Errorf("Authorization: got %q", r.Header.Get("Authorization"))
+				}
+				if got := r.Header.Get("X-Amz-Security-Token"); got != "session" {
+					t.Errorf("X-Amz-Security-Token: got %q", got)
+				}
+				var in map[string]string
+				json.NewDecoder(r.Body).Decode(&in)
+				if in["SecretId"] != "prod/db1" {
+					t.Errorf("SecretId: got %q", in["SecretId"])
+				}
+				json.NewEncoder(w).Encode(map[string]string{"SecretString": tt.secret})
+			}))
+			defer srv.Close()
+
+			t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+			t.Setenv("AWS_SECRET_ACCESS_KEY", "SECRET")
+			t.Setenv("AWS_SESSION_TOKEN", "session")
+			t.Setenv("AWS_ENDPOINT_URL_SECRETS_MANAGER", srv.URL)
+
+			p, err := NewAWSProvider(config.SecretConfig{Provider: "aws", Path: "prod/db1", Key: tt.key, Region: "eu-west-1"}, srv.Client())
+			if err != nil {
+				t.Fatalf("NewAWSProvider: %v", err)
+			}
+			got, err := p.Fetch(context.Background())
+			if err != nil {
+				t.Fatalf("Fetch: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAWSProvider_RequiresRegionAndCredentials(t *testing.T) {
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "SECRET")
+	if _, err := NewAWSProvider(config.SecretConfig{Provider: "aws", Path: "x"}, nil); err == nil {
+		t.Error("expected error without region")
+	}
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	if _, err := NewAWSProvider(config.SecretConfig{Provider: "aws", Path: "x"}, nil); err == nil {
+		t.Error("expected error without credentials")
+	}
+}
@@ -0,0 +1,120 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ryanbastic/go-mezzanine/internal/config"
+)
+
+// Provider fetches a backend database URL from an external secrets manager.
+type Provider interface {
+	Fetch(ctx context.Context) (string, error)
+}
+
+// defaultKey is the secret field read when SecretConfig.Key is empty and the
+// provider only stores key/value maps (e.g. Vault KV).
+const defaultKey = "database_url"
+
+// New builds the Provider described by cfg. Provider-specific connection
+// settings (addresses, tokens, AWS credentials) come from the standard
+// environment variables for each provider.
+func New(cfg config.SecretConfig, httpClient *http.Client) (Provider, error) {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	switch cfg.Provider {
+	case config.SecretProviderVault:
+		return NewVaultProvider(cfg, httpClient)
+	case config.SecretProviderAWS:
+		return NewAWSProvider(cfg, httpClient)
+	default:
+		return nil, fmt.Errorf("unknown secret provider %q", cfg.Provider)
+	}
+}
+
+// Rotator caches the current database URL for a backend and periodically
+// re-fetches it so credential rotations are picked up without a restart.
+type Rotator struct {
+	provider Provider
+	logger   *slog.Logger
+
+	mu      sync.RWMutex
+	current string
+}
+
+// NewRotator fetches the initial database URL from provider.
+func NewRotator(ctx context.Context, provider Provider, logger *slog.Logger) (*Rotator, error) {
+	url, err := provider.Fetch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetch secret: %w", err)
+	}
+	return &Rotator{provider: provider, logger: logger, current: url}, nil
+}
+
+// Current returns the most recently fetched database URL.
+func (r *Rotator) Current() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current
+}
+
+// Refresh re-fetches the secret and reports whether the value changed.
+func (r *Rotator) Refresh(ctx context.Context) (bool, error) {
+	url, err := r.provider.Fetch(ctx)
+	if err != nil {
+		return false, fmt.Errorf("fetch secret: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if url == r.current {
+		return false, nil
+	}
+	r.current = url
+	return true, nil
+}
+
+// Watch calls Refresh every interval until ctx is cancelled, invoking
+// onChange after each rotation. Fetch errors are logged and the previous
+// value is kept, so a flapping secrets manager never drops credentials.
+func (r *Rotator) Watch(ctx context.Context, interval time.Duration, onChange func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := r.Refresh(ctx)
+			if err != nil {
+				r.logger.Error("secret refresh failed", "error", err)
+				continue
+			}
+			if changed {
+				r.logger.Info("database credentials rotated")
+				onChange()
+			}
+		}
+	}
+}
+
+// BeforeConnect returns a pgxpool BeforeConnect hook that applies the
+// rotator's current credentials to every new connection. Combined with
+// pool.Reset on rotation, this re-creates all pool connections with the
+// new credentials while keeping the *pgxpool.Pool shared by the stores.
+func (r *Rotator) BeforeConnect() func(context.Context, *pgx.ConnConfig) error {
+	return func(_ context.Context, cc *pgx.ConnConfig) error {
+		latest, err := pgx.ParseConfig(r.Current())
+		if err != nil {
+			return fmt.Errorf("parse rotated database url: %w", err)
+		}
+		cc.User = latest.User
+		cc.Password = latest.Password
+		return nil
+	}
+}
@@ -0,0 +1,126 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ryanbastic/go-mezzanine/internal/config"
+)
+
+type fakeProvider struct {
+	mu  sync.Mutex
+	url string
+	err error
+}
+
+func (f *fakeProvider) Fetch(context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.url, f.err
+}
+
+func (f *fakeProvider) set(url string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.url, f.err = url, err
+}
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestNew_UnknownProvider(t *testing.T) {
+	if _, err := New(config.SecretConfig{Provider: "gcp", Path: "x"}, nil); err == nil {
+		t.Fatal("expected error for unknown provider")
+	}
+}
+
+func TestRotator_Refresh(t *testing.T) {
+	p := &fakeProvider{url: "postgres://a:1@h/db"}
+	r, err := NewRotator(context.Background(), p, testLogger())
+	if err != nil {
+		t.Fatalf("NewRotator: %v", err)
+	}
+
+	changed, err := r.Refresh(context.Background())
+	if err != nil || changed {
+		t.Fatalf("Refresh unchanged: changed=%v err=%v", changed, err)
+	}
+
+	p.set("postgres://a:2@h/db", nil)
+	changed, err = r.Refresh(context.Background())
+	if err != nil || !changed {
+		t.Fatalf("Refresh rotated: changed=%v err=%v", changed, err)
+	}
+	if r.Current() != "postgres://a:2@h/db" {
+		t.Errorf("Current: got %q", r.Current())
+	}
+
+	p.set("", errors.New("unavailable"))
+	if _, err := r.Refresh(context.Background()); err == nil {
+		t.Fatal("expected refresh error")
+	}
+	if r.Current() != "postgres://a:2@h/db" {
+		t.Errorf("Current after failed refresh: got %q", r.Current())
+	}
+}
+
+func TestRotator_WatchCallsOnChange(t *testing.T) {
+	p := &fakeProvider{url: "postgres://a:1@h/db"}
+	r, err := NewRotator(context.Background(), p, testLogger())
+	if err != nil {
+		t.Fatalf("NewRotator: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls atomic.Int32
+	done := make(chan struct{})
+	go func() {
+		r.Watch(ctx, 5*time.Millisecond, func() { calls.Add(1) })
+		close(done)
+	}()
+
+	p.set("postgres://a:2@h/db", nil)
+	deadline := time.After(2 * time.Second)
+	for calls.Load() == 0 {
+		select {
+		case <-deadline:
+			t.Fatal("onChange not called")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	cancel()
+	<-done
+
+	if calls.Load() != 1 {
+		t.Errorf("onChange calls: got %d, want 1", calls.Load())
+	}
+}
+
+func TestRotator_BeforeConnectAppliesCredentials(t *testing.T) {
+	p := &fakeProvider{url: "postgres://rotated:newpass@h/db"}
+	r, err := NewRotator(context.Background(), p, testLogger())
+	if err != nil {
+		t.Fatalf("NewRotator: %v", err)
+	}
+
+	cc, err := pgx.ParseConfig("postgres://old:oldpass@h/db")
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	if err := r.BeforeConnect()(context.Background(), cc); err != nil {
+		t.Fatalf("BeforeConnect: %v", err)
+	}
+	if cc.User != "rotated" || cc.Password != "newpass" {
+		t.Errorf("credentials: got %s/%s", cc.User, cc.Password)
+	}
+}
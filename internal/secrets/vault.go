@@ -0,0 +1,102 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/ryanbastic/go-mezzanine/internal/config"
+)
+
+// VaultProvider reads a database URL from a HashiCorp Vault KV secret.
+// Both KV v1 and v2 mounts are supported; for v2 the path must include the
+// "data/" segment (e.g. "secret/data/mezzanine/db1").
+type VaultProvider struct {
+	httpClient *http.Client
+	addr       string
+	token      string
+	namespace  string
+	path       string
+	key        string
+}
+
+// NewVaultProvider creates a provider using VAULT_ADDR, VAULT_TOKEN and the
+// optional VAULT_NAMESPACE environment variables.
+func NewVaultProvider(cfg config.SecretConfig, httpClient *http.Client) (*VaultProvider, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return nil, fmt.Errorf("vault: VAULT_ADDR is not set")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("vault: VAULT_TOKEN is not set")
+	}
+	key := cfg.Key
+	if key == "" {
+		key = defaultKey
+	}
+	return &VaultProvider{
+		httpClient: httpClient,
+		addr:       strings.TrimRight(addr, "/"),
+		token:      token,
+		namespace:  os.Getenv("VAULT_NAMESPACE"),
+		path:       strings.Trim(cfg.Path, "/"),
+		key:        key,
+	}, nil
+}
+
+func (p *VaultProvider) Fetch(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.addr+"/v1/"+p.path, nil)
+	if err != nil {
+		return "", fmt.Errorf("vault: create request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+	if p.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault: request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("vault: read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault: unexpected status %d for %s", resp.StatusCode, p.path)
+	}
+
+	var envelope struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return "", fmt.Errorf("vault: unmarshal response: %w", err)
+	}
+
+	// KV v2 nests the secret under data.data alongside data.metadata.
+	fields := envelope.Data
+	if nested, ok := envelope.Data["data"]; ok {
+		if _, hasMeta := envelope.Data["metadata"]; hasMeta {
+			if err := json.Unmarshal(nested, &fields); err != nil {
+				return "", fmt.Errorf("vault: unmarshal kv v2 data: %w", err)
+			}
+		}
+	}
+
+	raw, ok := fields[p.key]
+	if !ok {
+		return "", fmt.Errorf("vault: key %q not found in %s", p.key, p.path)
+	}
+	var url string
+	if err := json.Unmarshal(raw, &url); err != nil {
+		return "", fmt.Errorf("vault: key %q is not a string: %w", p.key, err)
+	}
+	return url, nil
+}
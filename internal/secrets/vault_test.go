@@ -0,0 +1,106 @@
+package secrets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ryanbastic/go-mezzanine/internal/config"
+)
+
+func TestVaultProvider_FetchKVv2(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/secret/data/mezzanine/db1" {
+			t.Errorf("path: got %q", r.URL.Path)
+		}
+		if got := r.Header.Get("X-Vault-Token"); got != "s.token" {
+			t.Errorf("token: got %q", got)
+		}
+		w.Write([]byte(`{"data":{"data":{"database_url":"postgres://u:p@db1/mezzanine"},"metadata":{"version":3}}}`))
+	}))
+	defer srv.Close()
+
+	t.Setenv("VAULT_ADDR", srv.URL)
+	t.Setenv("VAULT_TOKEN", "s.token")
+
+	p, err := NewVaultProvider(config.SecretConfig{Provider: "vault", Path: "/secret/data/mezzanine/db1"}, srv.Client())
+	if err != nil {
+		t.Fatalf("NewVaultProvider: %v", err)
+	}
+	url, err := p.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if url != "postgres://u:p@db1/mezzanine" {
+		t.Errorf("url: got %q", url)
+	}
+}
+
+func TestVaultProvider_FetchKVv1CustomKey(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"dsn":"postgres://v1/db"}}`))
+	}))
+	defer srv.Close()
+
+	t.Setenv("VAULT_ADDR", srv.URL)
+	t.Setenv("VAULT_TOKEN", "s.token")
+
+	p, err := NewVaultProvider(config.SecretConfig{Provider: "vault", Path: "kv/db", Key: "dsn"}, srv.Client())
+	if err != nil {
+		t.Fatalf("NewVaultProvider: %v", err)
+	}
+	url, err := p.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if url != "postgres://v1/db" {
+		t.Errorf("url: got %q", url)
+	}
+}
+
+func TestVaultProvider_MissingKey(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"other":"x"}}`))
+	}))
+	defer srv.Close()
+
+	t.Setenv("VAULT_ADDR", srv.URL)
+	t.Setenv("VAULT_TOKEN", "s.token")
+
+	p, err := NewVaultProvider(config.SecretConfig{Provider: "vault", Path: "kv/db"}, srv.Client())
+	if err != nil {
+		t.Fatalf("NewVaultProvider: %v", err)
+	}
+	_, err = p.Fetch(context.Background())
+	if err == nil || !strings.Contains(err.Error(), `key "database_url" not found`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestVaultProvider_ErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	t.Setenv("VAULT_ADDR", srv.URL)
+	t.Setenv("VAULT_TOKEN", "s.token")
+
+	p, err := NewVaultProvider(config.SecretConfig{Provider: "vault", Path: "kv/db"}, srv.Client())
+	if err != nil {
+		t.Fatalf("NewVaultProvider: %v", err)
+	}
+	if _, err := p.Fetch(context.Background()); err == nil {
+		t.Fatal("expected error for 403")
+	}
+}
+
+func TestNewVaultProvider_RequiresEnv(t *testing.T) {
+	t.Setenv("VAULT_ADDR", "")
+	t.Setenv("VAULT_TOKEN", "")
+	if _, err := NewVaultProvider(config.SecretConfig{Provider: "vault", Path: "kv/db"}, nil); err == nil {
+		t.Fatal("expected error without VAULT_ADDR")
+	}
+}
@@ -0,0 +1,332 @@
+// Package shadow mirrors the writes a server stores to a secondary cluster,
+// for rehearsing a migration or burning in new backends with production
+// traffic. Mirroring is asynchronous and best effort: the primary response
+// never waits for the secondary, and writes the secondary cannot keep up
+// with are dropped and counted rather than slowing the primary down.
+package shadow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+var (
+	writesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "mezzanine",
+			Name:      "shadow_writes_total",
+			Help:      "Writes mirrored to the shadow cluster, by result: mirrored, failed or dropped.",
+		},
+		[]string{"result"},
+	)
+	queueDepth = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "mezzanine",
+			Name:      "shadow_queue_depth",
+			Help:      "Writes waiting to be mirrored to the shadow cluster.",
+		},
+	)
+)
+
+// Target is the secondary cluster writes are mirrored to.
+type Target interface {
+	// Write stores req. A cell that already exists is not an error, so a
+	// write can be mirrored again safely.
+	Write(ctx context.Context, req cell.WriteCellRequest) error
+}
+
+// BlobTarget is implemented by targets that store binary cells with their
+// bytes. Binary cells are not mirrored to targets that do not implement
+// it, since their bodies only describe the bytes.
+type BlobTarget interface {
+	// WriteBlob stores req, a binary cell, with data, its bytes. A cell
+	// that already exists is not an error.
+	WriteBlob(ctx context.Context, req cell.WriteCellRequest, data []byte) error
+}
+
+// ErrBlobsUnsupported is returned by Write for a binary cell and a target
+// that is not a BlobTarget.
+var ErrBlobsUnsupported = errors.New("target does not support binary cells")
+
+// Write stores req on target, with data, the bytes of a binary cell, unless
+// it is nil.
+func Write(ctx context.Context, target Target, req cell.WriteCellRequest, data []byte) error {
+	if data == nil {
+		return target.Write(ctx, req)
+	}
+	bt, ok := target.(BlobTarget)
+	if !ok {
+		return ErrBlobsUnsupported
+	}
+	return bt.WriteBlob(ctx, req, data)
+}
+
+// Options configures a Mirror.
+type Options struct {
+	// QueueSize is how many writes may wait to be mirrored before further
+	// writes are dropped (default 10000).
+	QueueSize int
+	// Workers is the number of writes mirrored concurrently (default 4).
+	Workers int
+	// Timeout bounds each mirrored write (default 5s).
+	Timeout time.Duration
+}
+
+// Mirror copies successful writes to a Target in the background.
+type Mirror struct {
+	target Target
+	opts   Options
+	queue  chan mirrored
+	logger *slog.Logger
+
+	// dropMu rate-limits the warning logged when writes are dropped.
+	dropMu     sync.Mutex
+	lastDropAt time.Time
+}
+
+// New returns a mirror to target. Writes are queued once Interceptor is
+// installed and sent once Run starts.
+func New(target Target, opts Options, logger *slog.Logger) *Mirror {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 10000
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	return &Mirror{target: target, opts: opts, queue: make(chan mirrored, opts.QueueSize), logger: logger}
+}
+
+// mirrored is a queued write: a cell, and its bytes if it is binary.
+type mirrored struct {
+	req  cell.WriteCellRequest
+	data []byte
+}
+
+// Interceptor returns a shard.Router interceptor that queues every
+// successful WriteCell and WriteCells for mirroring. Failed writes, including
+// conflicts, are not mirrored.
+func (m *Mirror) Interceptor() shard.Interceptor {
+	return func(_ shard.ID, store storage.CellStore) storage.CellStore {
+		return &mirroringStore{CellStore: store, mirror: m}
+	}
+}
+
+// Run mirrors queued writes until ctx is cancelled. Writes still queued
+// then are left for Drain.
+func (m *Mirror) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for range m.opts.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case w := <-m.queue:
+					m.send(w)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// Drain mirrors the writes still queued, once no more are being made, until
+// the queue is empty or ctx ends; writes left over are dropped.
+func (m *Mirror) Drain(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			left := len(m.queue)
+			if left == 0 {
+				return nil
+			}
+			writesTotal.WithLabelValues("dropped").Add(float64(left))
+			return fmt.Errorf("drop %d shadow writes: %w", left, err)
+		}
+		select {
+		case w := <-m.queue:
+			m.send(w)
+		default:
+			return nil
+		}
+	}
+}
+
+func (m *Mirror) enqueue(reqs ...cell.WriteCellRequest) {
+	for _, req := range reqs {
+		m.push(mirrored{req: req})
+	}
+}
+
+func (m *Mirror) push(w mirrored) {
+	select {
+	case m.queue <- w:
+	default:
+		writesTotal.WithLabelValues("dropped").Inc()
+		m.warnDropped()
+	}
+	queueDepth.Set(float64(len(m.queue)))
+}
+
+func (m *Mirror) send(w mirrored) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.opts.Timeout)
+	defer cancel()
+	queueDepth.Set(float64(len(m.queue)))
+	req := w.req
+	if err := Write(ctx, m.target, req, w.data); err != nil {
+		writesTotal.WithLabelValues("failed").Inc()
+		m.logger.Warn("shadow write failed", "row_key", req.RowKey, "column_name", req.ColumnName, "ref_key", req.RefKey, "error", err)
+		return
+	}
+	writesTotal.WithLabelValues("mirrored").Inc()
+}
+
+// warnDropped logs at most once a minute that the queue is full.
+func (m *Mirror) warnDropped() {
+	m.dropMu.Lock()
+	defer m.dropMu.Unlock()
+	if time.Since(m.lastDropAt) < time.Minute {
+		return
+	}
+	m.lastDropAt = time.Now()
+	m.logger.Warn("shadow write queue is full; dropping writes", "queue_size", m.opts.QueueSize)
+}
+
+type mirroringStore struct {
+	storage.CellStore
+	mirror *Mirror
+}
+
+func (s *mirroringStore) WriteCell(ctx context.Context, req cell.WriteCellRequest) (*cell.Cell, error) {
+	c, err := s.CellStore.WriteCell(ctx, req)
+	if err == nil {
+		s.mirror.enqueue(req)
+	}
+	return c, err
+}
+
+func (s *mirroringStore) WriteCells(ctx context.Context, reqs []cell.WriteCellRequest) ([]cell.Cell, error) {
+	cells, err := s.CellStore.WriteCells(ctx, reqs)
+	if err == nil {
+		s.mirror.enqueue(reqs...)
+	}
+	return cells, err
+}
+
+// UpdateCell mirrors the version an update writes.
+func (s *mirroringStore) UpdateCell(ctx context.Context, rowKey uuid.UUID, columnName string, apply storage.UpdateFunc) (*cell.Cell, error) {
+	var wrote bool
+	c, err := storage.UpdateCell(ctx, s.CellStore, rowKey, columnName, func(ctx context.Context, latest *cell.Cell) (json.RawMessage, error) {
+		body, err := apply(ctx, latest)
+		wrote = body != nil
+		return body, err
+	})
+	if err == nil && wrote {
+		s.mirror.enqueue(cell.WriteCellRequest{RowKey: c.RowKey, ColumnName: c.ColumnName, RefKey: c.RefKey, Body: c.Body})
+	}
+	return c, err
+}
+
+// WriteBlob mirrors binary cells with their bytes.
+func (s *mirroringStore) WriteBlob(ctx context.Context, req cell.WriteCellRequest, data []byte) (*cell.Cell, error) {
+	c, err := storage.WriteBlob(ctx, s.CellStore, req, data)
+	if err == nil {
+		s.mirror.push(mirrored{req: req, data: data})
+	}
+	return c, err
+}
+
+func (s *mirroringStore) GetBlob(ctx context.Context, ref cell.CellRef) (*cell.Cell, []byte, error) {
+	return storage.GetBlob(ctx, s.CellStore, ref)
+}
+
+func (s *mirroringStore) GetBlobLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, []byte, error) {
+	return storage.GetBlobLatest(ctx, s.CellStore, rowKey, columnName)
+}
+
+// Aliases are not mirrored: the shadow cluster is written through the cells
+// API, and shadow reads address rows by row_key.
+func (s *mirroringStore) PutAlias(ctx context.Context, alias string, rowKey uuid.UUID) (*storage.Alias, error) {
+	return storage.PutAlias(ctx, s.CellStore, alias, rowKey)
+}
+
+func (s *mirroringStore) GetAlias(ctx context.Context, alias string) (*storage.Alias, error) {
+	return storage.GetAlias(ctx, s.CellStore, alias)
+}
+
+func (s *mirroringStore) DeleteAlias(ctx context.Context, alias string) error {
+	return storage.DeleteAlias(ctx, s.CellStore, alias)
+}
+
+// Row tags are not mirrored either.
+func (s *mirroringStore) SetRowTags(ctx context.Context, rowKey uuid.UUID, tags []string) error {
+	return storage.SetRowTags(ctx, s.CellStore, rowKey, tags)
+}
+
+func (s *mirroringStore) RecordIdempotencyKey(ctx context.Context, key string, hash []byte) error {
+	return storage.RecordIdempotencyKey(ctx, s.CellStore, key, hash)
+}
+
+func (s *mirroringStore) IdempotencyKeyHash(ctx context.Context, key string) ([]byte, error) {
+	return storage.IdempotencyKeyHash(ctx, s.CellStore, key)
+}
+
+func (s *mirroringStore) RowsByTag(ctx context.Context, tag string, after uuid.UUID, limit int) ([]uuid.UUID, error) {
+	return storage.RowsByTag(ctx, s.CellStore, tag, after, limit)
+}
+
+func (s *mirroringStore) QueryCells(ctx context.Context, q storage.Query) ([]cell.Cell, error) {
+	return storage.QueryCells(ctx, s.CellStore, q)
+}
+
+// The remaining optional interfaces pass through, so mirroring does not
+// cost readers streaming, projection, probes or long polls.
+
+func (s *mirroringStore) StreamRow(ctx context.Context, rowKey uuid.UUID) (storage.CellIterator, error) {
+	return storage.StreamRow(ctx, s.CellStore, rowKey)
+}
+
+func (s *mirroringStore) StreamRowColumns(ctx context.Context, rowKey uuid.UUID, columns []string) (storage.CellIterator, error) {
+	return storage.StreamRowColumns(ctx, s.CellStore, rowKey, columns)
+}
+
+func (s *mirroringStore) StreamPartition(ctx context.Context, partitionNumber int, readType int, addedID int64, createdAfter time.Time, limit int) (storage.CellIterator, error) {
+	return storage.StreamPartition(ctx, s.CellStore, partitionNumber, readType, addedID, createdAfter, limit)
+}
+
+func (s *mirroringStore) ProbeCellLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, error) {
+	return storage.ProbeCellLatest(ctx, s.CellStore, rowKey, columnName)
+}
+
+func (s *mirroringStore) ProbeRow(ctx context.Context, rowKey uuid.UUID, withSystem bool) (storage.RowSummary, error) {
+	return storage.ProbeRow(ctx, s.CellStore, rowKey, withSystem)
+}
+
+func (s *mirroringStore) WaitHead(ctx context.Context, afterAddedID int64) (int64, error) {
+	return storage.WaitHead(ctx, s.CellStore, afterAddedID)
+}
+
+func (s *mirroringStore) CommittedHead(ctx context.Context) (int64, error) {
+	return storage.CommittedHead(ctx, s.CellStore)
+}
+
+func (s *mirroringStore) ScanCommitLog(ctx context.Context, fromAddedID, afterSeq int64, limit int) ([]cell.Cell, int64, error) {
+	return storage.ScanCommitLog(ctx, s.CellStore, fromAddedID, afterSeq, limit)
+}
@@ -0,0 +1,316 @@
+package shadow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/offload"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+)
+
+// mirroringStore forwards every optional store interface.
+var (
+	_ storage.Streamer         = (*mirroringStore)(nil)
+	_ storage.ColumnStreamer   = (*mirroringStore)(nil)
+	_ storage.Prober           = (*mirroringStore)(nil)
+	_ storage.HeadWaiter       = (*mirroringStore)(nil)
+	_ storage.CommittedHeader  = (*mirroringStore)(nil)
+	_ storage.Updater          = (*mirroringStore)(nil)
+	_ storage.BlobStore        = (*mirroringStore)(nil)
+	_ storage.AliasStore       = (*mirroringStore)(nil)
+	_ storage.TagStore         = (*mirroringStore)(nil)
+	_ storage.IdempotencyStore = (*mirroringStore)(nil)
+	_ storage.Querier          = (*mirroringStore)(nil)
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// recordingTarget records the writes mirrored to it.
+type recordingTarget struct {
+	mu   sync.Mutex
+	reqs []cell.WriteCellRequest
+	err  error
+}
+
+func (t *recordingTarget) Write(_ context.Context, req cell.WriteCellRequest) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.reqs = append(t.reqs, req)
+	return t.err
+}
+
+func (t *recordingTarget) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.reqs)
+}
+
+// primaryStore accepts every write except those of column "taken".
+type primaryStore struct {
+	storage.CellStore
+}
+
+func (primaryStore) WriteCell(_ context.Context, req cell.WriteCellRequest) (*cell.Cell, error) {
+	if req.ColumnName == "taken" {
+		return nil, storage.ErrCellExists
+	}
+	return &cell.Cell{AddedID: 1, RowKey: req.RowKey, ColumnName: req.ColumnName, RefKey: req.RefKey, Body: req.Body}, nil
+}
+
+func (s primaryStore) WriteCells(ctx context.Context, reqs []cell.WriteCellRequest) ([]cell.Cell, error) {
+	out := make([]cell.Cell, len(reqs))
+	for i, req := range reqs {
+		c, err := s.WriteCell(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = *c
+	}
+	return out, nil
+}
+
+func writeReq(column string) cell.WriteCellRequest {
+	return cell.WriteCellRequest{RowKey: uuid.New(), ColumnName: column, RefKey: 1, Body: json.RawMessage(`{"a":1}`)}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMirror_MirrorsSuccessfulWrites(t *testing.T) {
+	target := &recordingTarget{}
+	m := New(target, Options{}, testLogger())
+	store := m.Interceptor()(0, primaryStore{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.Run(ctx) //nolint:errcheck
+		close(done)
+	}()
+
+	if _, err := store.WriteCell(ctx, writeReq("profile")); err != nil {
+		t.Fatalf("WriteCell: %v", err)
+	}
+	if _, err := store.WriteCell(ctx, writeReq("taken")); !errors.Is(err, storage.ErrCellExists) {
+		t.Fatalf("WriteCell: got %v, want ErrCellExists", err)
+	}
+	if _, err := store.WriteCells(ctx, []cell.WriteCellRequest{writeReq("a"), writeReq("b")}); err != nil {
+		t.Fatalf("WriteCells: %v", err)
+	}
+	if _, err := store.WriteCells(ctx, []cell.WriteCellRequest{writeReq("c"), writeReq("taken")}); err == nil {
+		t.Fatal("WriteCells: expected error")
+	}
+
+	waitFor(t, func() bool { return target.count() == 3 })
+	cancel()
+	<-done
+	time.Sleep(10 * time.Millisecond)
+	if n := target.count(); n != 3 {
+		t.Errorf("mirrored %d writes, want 3", n)
+	}
+}
+
+func TestMirror_DropsWhenQueueFull(t *testing.T) {
+	target := &recordingTarget{}
+	m := New(target, Options{QueueSize: 2}, testLogger())
+	store := m.Interceptor()(0, primaryStore{})
+
+	// Nothing is sending, so the third write finds the queue full.
+	for range 3 {
+		if _, err := store.WriteCell(context.Background(), writeReq("profile")); err != nil {
+			t.Fatalf("WriteCell: %v", err)
+		}
+	}
+	if err := m.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	if n := target.count(); n != 2 {
+		t.Errorf("mirrored %d writes, want 2", n)
+	}
+}
+
+func TestMirror_DrainStopsAtDeadline(t *testing.T) {
+	target := &recordingTarget{}
+	m := New(target, Options{}, testLogger())
+	m.enqueue(writeReq("profile"))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.Drain(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Drain: got %v, want context.Canceled", err)
+	}
+	if n := target.count(); n != 0 {
+		t.Errorf("mirrored %d writes after the deadline, want 0", n)
+	}
+}
+
+func TestHTTPTarget_Write(t *testing.T) {
+	var got struct {
+		path, key, auth string
+		body            cell.WriteCellRequest
+	}
+	status := http.StatusCreated
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.path = r.URL.Path
+		got.key = r.Header.Get("Idempotency-Key")
+		got.auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&got.body) //nolint:errcheck
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	target := NewHTTPTarget(srv.URL+"/", "secret")
+	req := writeReq("profile")
+	if err := target.Write(context.Background(), req); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if got.path != "/v1/cells" || got.auth != "Bearer secret" {
+		t.Errorf("request: got path %q, auth %q", got.path, got.auth)
+	}
+	if want := "shadow:" + req.RowKey.String() + ":profile:1"; got.key != want {
+		t.Errorf("Idempotency-Key: got %q, want %q", got.key, want)
+	}
+	if got.body.RowKey != req.RowKey || string(got.body.Body) != `{"a":1}` {
+		t.Errorf("body: got %+v", got.body)
+	}
+
+	status = http.StatusConflict
+	if err := target.Write(context.Background(), req); !errors.Is(err, ErrConflict) {
+		t.Errorf("409: got %v, want ErrConflict", err)
+	}
+	status = http.StatusServiceUnavailable
+	if err := target.Write(context.Background(), req); err == nil || errors.Is(err, ErrConflict) {
+		t.Errorf("503: got %v, want a non-conflict error", err)
+	}
+
+	// System columns are skipped rather than refused by the target.
+	got.path = ""
+	if err := target.Write(context.Background(), writeReq("_mezz.owner")); err != nil || got.path != "" {
+		t.Errorf("system column: got %v, path %q, want it skipped", err, got.path)
+	}
+}
+
+func TestHTTPTarget_WriteBlob(t *testing.T) {
+	var method, path, contentType, key string
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path, contentType, key = r.Method, r.URL.Path, r.Header.Get("Content-Type"), r.Header.Get("Idempotency-Key")
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	data := []byte{0x89, 'P', 'N', 'G'}
+	req := cell.WriteCellRequest{RowKey: uuid.New(), ColumnName: "avatar", RefKey: 2, Body: cell.BlobBody("image/png", data)}
+	if err := Write(context.Background(), NewHTTPTarget(srv.URL, ""), req, data); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if method != http.MethodPut || path != "/v1/blobs/"+req.RowKey.String()+"/avatar/2" || contentType != "image/png" || string(body) != string(data) {
+		t.Errorf("request: got %s %s (%s) %q", method, path, contentType, body)
+	}
+	if want := "shadow:" + req.RowKey.String() + ":avatar:2"; key != want {
+		t.Errorf("Idempotency-Key: got %q, want %q", key, want)
+	}
+	if err := Write(context.Background(), &recordingTarget{}, req, data); !errors.Is(err, ErrBlobsUnsupported) {
+		t.Errorf("target without blobs: got %v, want ErrBlobsUnsupported", err)
+	}
+}
+
+func TestMirror_MirrorsBinaryCells(t *testing.T) {
+	secondary := memory.New()
+	r := shard.NewRouter()
+	for i := range 4 {
+		r.Register(shard.ID(i), secondary)
+	}
+	m := New(NewStoreTarget(r, 4), Options{}, testLogger())
+	store := m.Interceptor()(0, memory.New())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Run(ctx) //nolint:errcheck
+
+	data := []byte("bytes")
+	req := cell.WriteCellRequest{RowKey: uuid.New(), ColumnName: "avatar", RefKey: 1, Body: cell.BlobBody("application/octet-stream", data)}
+	if _, err := storage.WriteBlob(ctx, store, req, data); err != nil {
+		t.Fatalf("WriteBlob: %v", err)
+	}
+	waitFor(t, func() bool {
+		_, got, err := secondary.GetBlob(ctx, cell.CellRef{RowKey: req.RowKey, ColumnName: "avatar", RefKey: 1})
+		return err == nil && string(got) == "bytes"
+	})
+}
+
+type mapBucket map[string][]byte
+
+func (b mapBucket) Put(_ context.Context, key string, data []byte) error {
+	b[key] = data
+	return nil
+}
+
+func (b mapBucket) Get(_ context.Context, key string) ([]byte, error) {
+	return b[key], nil
+}
+
+func TestHTTPTarget_ResolvesOffloadedBodies(t *testing.T) {
+	var got cell.WriteCellRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got) //nolint:errcheck
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	o := offload.New(mapBucket{}, "s3://lake/bodies", 8)
+	req := writeReq("doc")
+	req.Body = json.RawMessage(`{"text":"a long enough body"}`)
+	ptr, err := o.Offload(context.Background(), req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := NewHTTPTarget(srv.URL, "")
+	target.ResolveOffloaded(o)
+	req.Body = ptr
+	if err := target.Write(context.Background(), req); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if string(got.Body) != `{"text":"a long enough body"}` {
+		t.Errorf("sent body %s, want the offloaded one", got.Body)
+	}
+}
+
+func TestStoreTarget_IgnoresExistingCells(t *testing.T) {
+	r := shard.NewRouter()
+	for i := range 4 {
+		r.Register(shard.ID(i), primaryStore{})
+	}
+	target := NewStoreTarget(r, 4)
+	if err := target.Write(context.Background(), writeReq("profile")); err != nil {
+		t.Errorf("new cell: %v", err)
+	}
+	if err := target.Write(context.Background(), writeReq("taken")); err != nil {
+		t.Errorf("existing cell: %v", err)
+	}
+
+	empty := NewStoreTarget(shard.NewRouter(), 4)
+	if err := empty.Write(context.Background(), writeReq("profile")); err == nil {
+		t.Error("unrouted shard: expected error")
+	}
+}
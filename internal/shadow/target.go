@@ -0,0 +1,158 @@
+package shadow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/offload"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// ErrConflict is returned by HTTPTarget when the cell already exists on the
+// target with a different body.
+var ErrConflict = errors.New("cell exists on the target with a different body")
+
+// HTTPTarget mirrors writes to another Mezzanine server through its API.
+type HTTPTarget struct {
+	baseURL   string
+	apiKey    string
+	client    *http.Client
+	offloader *offload.Offloader
+}
+
+// NewHTTPTarget returns a target that posts writes to the server at baseURL,
+// authenticating with apiKey if it is set.
+func NewHTTPTarget(baseURL, apiKey string) *HTTPTarget {
+	return &HTTPTarget{baseURL: strings.TrimSuffix(baseURL, "/"), apiKey: apiKey, client: &http.Client{}}
+}
+
+// ResolveOffloaded has offloaded bodies fetched with o and sent in place of
+// their pointers, which the target's API refuses; the target offloads them
+// again by its own threshold.
+func (t *HTTPTarget) ResolveOffloaded(o *offload.Offloader) {
+	t.offloader = o
+}
+
+// Write implements Target. Each write carries an Idempotency-Key derived
+// from the cell, so the target accepts it again when the cell already
+// exists with the same body. Cells of system columns are skipped: the
+// cells API refuses them, and the target records row owners and metadata
+// of its own for the writes it is sent, while provenance is not carried
+// over.
+func (t *HTTPTarget) Write(ctx context.Context, req cell.WriteCellRequest) error {
+	if cell.IsReserved(req.ColumnName) {
+		return nil
+	}
+	if t.offloader != nil {
+		body, err := t.offloader.Resolve(ctx, req.Body)
+		if err != nil {
+			return err
+		}
+		req.Body = body
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("encode cell: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.baseURL+"/v1/cells", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if err := t.do(httpReq, req); err != nil {
+		return fmt.Errorf("post cell: %w", err)
+	}
+	return nil
+}
+
+// WriteBlob implements BlobTarget, putting the bytes of a binary cell
+// through the blobs API, under the same Idempotency-Key as Write.
+func (t *HTTPTarget) WriteBlob(ctx context.Context, req cell.WriteCellRequest, data []byte) error {
+	if cell.IsReserved(req.ColumnName) {
+		return nil
+	}
+	info, ok := cell.ParseBlobBody(req.Body)
+	if !ok {
+		return fmt.Errorf("put blob: body of %s/%s/%d does not describe a binary cell", req.RowKey, req.ColumnName, req.RefKey)
+	}
+	path := "/v1/blobs/" + req.RowKey.String() + "/" + url.PathEscape(req.ColumnName) + "/" + strconv.FormatInt(req.RefKey, 10)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPut, t.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", info.ContentType)
+	if err := t.do(httpReq, req); err != nil {
+		return fmt.Errorf("put blob: %w", err)
+	}
+	return nil
+}
+
+// do sends httpReq, the write of req, and maps its response to an error.
+func (t *HTTPTarget) do(httpReq *http.Request, req cell.WriteCellRequest) error {
+	httpReq.Header.Set("Idempotency-Key", "shadow:"+req.RowKey.String()+":"+req.ColumnName+":"+strconv.FormatInt(req.RefKey, 10))
+	if t.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+t.apiKey)
+	}
+	resp, err := t.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusCreated || resp.StatusCode == http.StatusOK {
+		io.Copy(io.Discard, resp.Body) //nolint:errcheck
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode == http.StatusConflict {
+		return ErrConflict
+	}
+	return fmt.Errorf("status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+}
+
+// StoreTarget mirrors writes straight to another set of backends, routed by
+// their own shard layout.
+type StoreTarget struct {
+	router    *shard.Router
+	numShards int
+}
+
+// NewStoreTarget returns a target that writes through router, which holds
+// numShards shards.
+func NewStoreTarget(router *shard.Router, numShards int) *StoreTarget {
+	return &StoreTarget{router: router, numShards: numShards}
+}
+
+// Write implements Target. A cell that already exists is left as it is,
+// whatever its body.
+func (t *StoreTarget) Write(ctx context.Context, req cell.WriteCellRequest) error {
+	store, err := t.router.StoreFor(t.router.ForRowKey(req.RowKey, t.numShards))
+	if err != nil {
+		return err
+	}
+	if _, err := store.WriteCell(ctx, req); err != nil && !errors.Is(err, storage.ErrCellExists) {
+		return err
+	}
+	return nil
+}
+
+// WriteBlob implements BlobTarget.
+func (t *StoreTarget) WriteBlob(ctx context.Context, req cell.WriteCellRequest, data []byte) error {
+	store, err := t.router.StoreFor(t.router.ForRowKey(req.RowKey, t.numShards))
+	if err != nil {
+		return err
+	}
+	if _, err := storage.WriteBlob(ctx, store, req, data); err != nil && !errors.Is(err, storage.ErrCellExists) {
+		return err
+	}
+	return nil
+}
@@ -4,31 +4,91 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/google/uuid"
 	"github.com/ryanbastic/go-mezzanine/internal/storage"
+	mezzanine "github.com/ryanbastic/go-mezzanine/pkg/mezzanine"
 )
 
-// Router maps shard IDs to CellStore instances.
+// Interceptor wraps the CellStore of a shard, e.g. to add caching or fault
+// injection. It is called once per shard when the store or interceptor is
+// registered, not on every lookup.
+type Interceptor func(id ID, store storage.CellStore) storage.CellStore
+
+// Router maps keys to shard IDs with its hash, and shard IDs to CellStore
+// instances.
 type Router struct {
-	mu     sync.RWMutex
-	stores map[ID]storage.CellStore
+	mu           sync.RWMutex
+	hash         mezzanine.ShardHash
+	stores       map[ID]storage.CellStore // as registered
+	wrapped      map[ID]storage.CellStore // with interceptors applied
+	interceptors []Interceptor
 }
 
 func NewRouter() *Router {
-	return &Router{stores: make(map[ID]storage.CellStore)}
+	return &Router{
+		stores:  make(map[ID]storage.CellStore),
+		wrapped: make(map[ID]storage.CellStore),
+	}
 }
 
 // Register associates a shard ID with a CellStore.
 func (r *Router) Register(id ID, store storage.CellStore) {
 	r.mu.Lock()
 	r.stores[id] = store
+	r.wrapped[id] = r.wrap(id, store)
+	r.mu.Unlock()
+}
+
+// SetHash sets the hash ForRowKey and ForKey place keys with, from the
+// shard config. Set it before routing anything; the default is the zero
+// mezzanine.ShardHash. h must be valid.
+func (r *Router) SetHash(h mezzanine.ShardHash) {
+	r.mu.Lock()
+	r.hash = h
 	r.mu.Unlock()
 }
 
+// Hash returns the hash set by SetHash.
+func (r *Router) Hash() mezzanine.ShardHash {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.hash
+}
+
+// ForRowKey computes the shard of a row_key UUID with the router's hash.
+func (r *Router) ForRowKey(rowKey uuid.UUID, numShards int) ID {
+	return ForRowKey(r.Hash(), rowKey, numShards)
+}
+
+// ForKey computes the shard of an arbitrary string key with the router's
+// hash.
+func (r *Router) ForKey(key string, numShards int) ID {
+	return ForKey(r.Hash(), key, numShards)
+}
+
+// Use adds an interceptor around every shard's store, including shards
+// registered later. Interceptors added first are outermost.
+func (r *Router) Use(i Interceptor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interceptors = append(r.interceptors, i)
+	for id, store := range r.stores {
+		r.wrapped[id] = r.wrap(id, store)
+	}
+}
+
+func (r *Router) wrap(id ID, store storage.CellStore) storage.CellStore {
+	for i := len(r.interceptors) - 1; i >= 0; i-- {
+		store = r.interceptors[i](id, store)
+	}
+	return store
+}
+
 // StoreFor returns the CellStore for the given shard ID.
 func (r *Router) StoreFor(id ID) (storage.CellStore, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	s, ok := r.stores[id]
+	s, ok := r.wrapped[id]
 	if !ok {
 		return nil, fmt.Errorf("no store registered for shard %d", id)
 	}
@@ -5,49 +5,14 @@ import (
 	"encoding/json"
 	"sync"
 	"testing"
-	"time"
 
 	"github.com/google/uuid"
 	"github.com/ryanbastic/go-mezzanine/internal/cell"
 	"github.com/ryanbastic/go-mezzanine/internal/storage"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+	mezzanine "github.com/ryanbastic/go-mezzanine/pkg/mezzanine"
 )
 
-// mockCellStore implements storage.CellStore for testing.
-type mockCellStore struct {
-	id string // identifier for this mock
-}
-
-func (m *mockCellStore) WriteCell(ctx context.Context, req cell.WriteCellRequest) (*cell.Cell, error) {
-	return &cell.Cell{
-		AddedID:    1,
-		RowKey:     req.RowKey,
-		ColumnName: req.ColumnName,
-		RefKey:     req.RefKey,
-		Body:       req.Body,
-		CreatedAt:  time.Now(),
-	}, nil
-}
-
-func (m *mockCellStore) GetCell(ctx context.Context, ref cell.CellRef) (*cell.Cell, error) {
-	return nil, storage.ErrCellNotFound
-}
-
-func (m *mockCellStore) GetCellLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, error) {
-	return nil, storage.ErrCellNotFound
-}
-
-func (m *mockCellStore) GetRow(ctx context.Context, rowKey uuid.UUID) ([]cell.Cell, error) {
-	return nil, nil
-}
-
-func (m *mockCellStore) PartitionRead(ctx context.Context, partitionNumber int, readType int, addedID int64, createdAfter time.Time, limit int) ([]cell.Cell, error) {
-	return nil, nil
-}
-
-func (m *mockCellStore) ScanCells(ctx context.Context, columnName string, afterAddedID int64, limit int) ([]cell.Cell, error) {
-	return nil, nil
-}
-
 func TestNewRouter(t *testing.T) {
 	r := NewRouter()
 	if r == nil {
@@ -57,7 +22,7 @@ func TestNewRouter(t *testing.T) {
 
 func TestRouter_RegisterAndStoreFor(t *testing.T) {
 	r := NewRouter()
-	store := &mockCellStore{id: "store-0"}
+	store := memory.New()
 	r.Register(ID(0), store)
 
 	got, err := r.StoreFor(ID(0))
@@ -92,9 +57,9 @@ func TestRouter_StoreFor_NotRegistered(t *testing.T) {
 
 func TestRouter_MultipleShards(t *testing.T) {
 	r := NewRouter()
-	stores := make([]*mockCellStore, 4)
+	stores := make([]*memory.Store, 4)
 	for i := range stores {
-		stores[i] = &mockCellStore{id: "store-" + string(rune('0'+i))}
+		stores[i] = memory.New()
 		r.Register(ID(i), stores[i])
 	}
 
@@ -108,8 +73,8 @@ func TestRouter_MultipleShards(t *testing.T) {
 
 func TestRouter_OverwriteRegistration(t *testing.T) {
 	r := NewRouter()
-	store1 := &mockCellStore{id: "first"}
-	store2 := &mockCellStore{id: "second"}
+	store1 := memory.New()
+	store2 := memory.New()
 
 	r.Register(ID(0), store1)
 	r.Register(ID(0), store2)
@@ -128,7 +93,7 @@ func TestRouter_OverwriteRegistration(t *testing.T) {
 func TestRouter_ConcurrentAccess(t *testing.T) {
 	r := NewRouter()
 	for i := 0; i < 64; i++ {
-		r.Register(ID(i), &mockCellStore{id: "store"})
+		r.Register(ID(i), memory.New())
 	}
 
 	var wg sync.WaitGroup
@@ -155,7 +120,7 @@ func TestRouter_ConcurrentRegisterAndRead(t *testing.T) {
 		wg.Add(1)
 		go func(id int) {
 			defer wg.Done()
-			r.Register(ID(id), &mockCellStore{id: "store"})
+			r.Register(ID(id), memory.New())
 		}(i)
 	}
 
@@ -170,3 +135,62 @@ func TestRouter_ConcurrentRegisterAndRead(t *testing.T) {
 
 	wg.Wait()
 }
+
+// taggedStore records the interceptor that wrapped it.
+type taggedStore struct {
+	storage.CellStore
+	tag string
+}
+
+func TestRouter_Use_WrapsExistingAndLaterStores(t *testing.T) {
+	r := NewRouter()
+	r.Register(ID(0), memory.New())
+	r.Use(func(id ID, s storage.CellStore) storage.CellStore {
+		return &taggedStore{CellStore: s, tag: "outer"}
+	})
+	r.Register(ID(1), memory.New())
+
+	for _, id := range []ID{0, 1} {
+		got, err := r.StoreFor(id)
+		if err != nil {
+			t.Fatalf("StoreFor(%d): %v", id, err)
+		}
+		if ts, ok := got.(*taggedStore); !ok || ts.tag != "outer" {
+			t.Errorf("shard %d: expected intercepted store, got %T", id, got)
+		}
+	}
+}
+
+func TestRouter_Use_FirstInterceptorIsOutermost(t *testing.T) {
+	r := NewRouter()
+	r.Use(func(id ID, s storage.CellStore) storage.CellStore { return &taggedStore{CellStore: s, tag: "first"} })
+	r.Use(func(id ID, s storage.CellStore) storage.CellStore { return &taggedStore{CellStore: s, tag: "second"} })
+	r.Register(ID(0), memory.New())
+
+	got, _ := r.StoreFor(ID(0))
+	outer := got.(*taggedStore)
+	inner, ok := outer.CellStore.(*taggedStore)
+	if outer.tag != "first" || !ok || inner.tag != "second" {
+		t.Errorf("unexpected interceptor order")
+	}
+}
+
+func TestRouter_SetHash(t *testing.T) {
+	r := NewRouter()
+	key := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	if got, want := r.ForRowKey(key, 64), ForRowKey(mezzanine.ShardHash{}, key, 64); got != want {
+		t.Fatalf("default hash: got shard %d, want %d", got, want)
+	}
+
+	h := mezzanine.ShardHash{Function: mezzanine.HashMurmur3, Seed: 7}
+	r.SetHash(h)
+	if r.Hash() != h {
+		t.Errorf("Hash() = %s, want %s", r.Hash(), h)
+	}
+	if got, want := r.ForRowKey(key, 64), ForRowKey(h, key, 64); got != want {
+		t.Errorf("ForRowKey: got shard %d, want %d", got, want)
+	}
+	if got, want := r.ForKey("alice", 64), ForKey(h, "alice", 64); got != want {
+		t.Errorf("ForKey: got shard %d, want %d", got, want)
+	}
+}
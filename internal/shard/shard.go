@@ -1,25 +1,21 @@
 package shard
 
 import (
-	"hash/fnv"
-
 	"github.com/google/uuid"
+	mezzanine "github.com/ryanbastic/go-mezzanine/pkg/mezzanine"
 )
 
 // ID represents a shard number in [0, NumShards).
 type ID int
 
-// ForRowKey computes the shard for a given row_key UUID.
-func ForRowKey(rowKey uuid.UUID, numShards int) ID {
-	h := fnv.New32a()
-	b := [16]byte(rowKey)
-	h.Write(b[:])
-	return ID(int(h.Sum32()) % numShards)
+// ForRowKey computes the shard h places a row_key UUID on. The hash lives in
+// the client package so clients can group writes by shard with the same
+// function the server routes with.
+func ForRowKey(h mezzanine.ShardHash, rowKey uuid.UUID, numShards int) ID {
+	return ID(h.Shard(rowKey[:], numShards))
 }
 
-// ForKey computes the shard for an arbitrary string key.
-func ForKey(key string, numShards int) ID {
-	h := fnv.New32a()
-	h.Write([]byte(key))
-	return ID(int(h.Sum32()) % numShards)
+// ForKey computes the shard h places an arbitrary string key on.
+func ForKey(h mezzanine.ShardHash, key string, numShards int) ID {
+	return ID(h.Shard([]byte(key), numShards))
 }
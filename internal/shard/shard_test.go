@@ -4,15 +4,19 @@ import (
 	"testing"
 
 	"github.com/google/uuid"
+	mezzanine "github.com/ryanbastic/go-mezzanine/pkg/mezzanine"
 )
 
+// defaultHash is the hash of clusters whose shard config sets none.
+var defaultHash mezzanine.ShardHash
+
 func TestForRowKey_Deterministic(t *testing.T) {
 	key := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
 	numShards := 64
 
-	first := ForRowKey(key, numShards)
+	first := ForRowKey(defaultHash, key, numShards)
 	for i := 0; i < 100; i++ {
-		got := ForRowKey(key, numShards)
+		got := ForRowKey(defaultHash, key, numShards)
 		if got != first {
 			t.Fatalf("iteration %d: got shard %d, want %d", i, got, first)
 		}
@@ -24,7 +28,7 @@ func TestForRowKey_InRange(t *testing.T) {
 	for _, numShards := range shardCounts {
 		for i := 0; i < 100; i++ {
 			key := uuid.New()
-			got := ForRowKey(key, numShards)
+			got := ForRowKey(defaultHash, key, numShards)
 			if int(got) < 0 || int(got) >= numShards {
 				t.Errorf("numShards=%d key=%s: got shard %d out of range [0,%d)", numShards, key, got, numShards)
 			}
@@ -39,7 +43,7 @@ func TestForRowKey_DifferentKeysDistribute(t *testing.T) {
 	// Generate enough keys that we expect to see multiple distinct shards
 	for i := 0; i < 1000; i++ {
 		key := uuid.New()
-		s := ForRowKey(key, numShards)
+		s := ForRowKey(defaultHash, key, numShards)
 		seen[s] = true
 	}
 
@@ -51,7 +55,7 @@ func TestForRowKey_DifferentKeysDistribute(t *testing.T) {
 
 func TestForRowKey_SingleShard(t *testing.T) {
 	key := uuid.New()
-	got := ForRowKey(key, 1)
+	got := ForRowKey(defaultHash, key, 1)
 	if got != 0 {
 		t.Errorf("with 1 shard, expected 0 but got %d", got)
 	}
@@ -60,8 +64,8 @@ func TestForRowKey_SingleShard(t *testing.T) {
 func TestForRowKey_SameKeyDifferentShardCounts(t *testing.T) {
 	key := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
 
-	s64 := ForRowKey(key, 64)
-	s128 := ForRowKey(key, 128)
+	s64 := ForRowKey(defaultHash, key, 64)
+	s128 := ForRowKey(defaultHash, key, 128)
 
 	// Different shard counts may produce different results — just verify they're valid
 	if int(s64) < 0 || int(s64) >= 64 {
@@ -73,7 +77,7 @@ func TestForRowKey_SameKeyDifferentShardCounts(t *testing.T) {
 }
 
 func TestForRowKey_NilUUID(t *testing.T) {
-	got := ForRowKey(uuid.Nil, 64)
+	got := ForRowKey(defaultHash, uuid.Nil, 64)
 	if int(got) < 0 || int(got) >= 64 {
 		t.Errorf("nil UUID: shard %d out of range [0,64)", got)
 	}
@@ -90,9 +94,9 @@ func TestForKey_Deterministic(t *testing.T) {
 	key := "alice@example.com"
 	numShards := 64
 
-	first := ForKey(key, numShards)
+	first := ForKey(defaultHash, key, numShards)
 	for i := 0; i < 100; i++ {
-		got := ForKey(key, numShards)
+		got := ForKey(defaultHash, key, numShards)
 		if got != first {
 			t.Fatalf("iteration %d: got shard %d, want %d", i, got, first)
 		}
@@ -104,7 +108,7 @@ func TestForKey_InRange(t *testing.T) {
 	shardCounts := []int{1, 2, 4, 8, 16, 32, 64}
 	for _, numShards := range shardCounts {
 		for _, key := range keys {
-			got := ForKey(key, numShards)
+			got := ForKey(defaultHash, key, numShards)
 			if int(got) < 0 || int(got) >= numShards {
 				t.Errorf("numShards=%d key=%q: got shard %d out of range [0,%d)", numShards, key, got, numShards)
 			}
@@ -113,7 +117,7 @@ func TestForKey_InRange(t *testing.T) {
 }
 
 func TestForKey_SingleShard(t *testing.T) {
-	got := ForKey("anything", 1)
+	got := ForKey(defaultHash, "anything", 1)
 	if got != 0 {
 		t.Errorf("with 1 shard, expected 0 but got %d", got)
 	}
@@ -122,12 +126,27 @@ func TestForKey_SingleShard(t *testing.T) {
 func BenchmarkForRowKey(b *testing.B) {
 	key := uuid.New()
 	for i := 0; i < b.N; i++ {
-		ForRowKey(key, 64)
+		ForRowKey(defaultHash, key, 64)
 	}
 }
 
 func BenchmarkForKey(b *testing.B) {
 	for i := 0; i < b.N; i++ {
-		ForKey("alice@example.com", 64)
+		ForKey(defaultHash, "alice@example.com", 64)
+	}
+}
+
+func TestForRowKey_Hash(t *testing.T) {
+	key := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	if got := ForRowKey(defaultHash, key, 64); got != 50 {
+		t.Fatalf("default hash: got shard %d, want 50", got)
+	}
+
+	h := mezzanine.ShardHash{Function: mezzanine.HashXXHash, Seed: 7}
+	if got, want := ForRowKey(h, key, 64), ID(h.Shard(key[:], 64)); got != want {
+		t.Errorf("ForRowKey with %s: got shard %d, want %d", h, got, want)
+	}
+	if got, want := ForKey(h, "alice", 64), ID(h.Shard([]byte("alice"), 64)); got != want {
+		t.Errorf("ForKey with %s: got shard %d, want %d", h, got, want)
 	}
 }
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrAliasNotFound is returned when an alias lookup finds no alias.
+var ErrAliasNotFound = errors.New("alias not found")
+
+// ErrAliasExists is returned when an alias is registered for a row while it
+// already names a different one. Aliases are not repointed; delete one
+// first.
+var ErrAliasExists = errors.New("alias already names another row")
+
+// ErrAliasesUnsupported is returned for aliases on a store that cannot keep
+// them.
+var ErrAliasesUnsupported = errors.New("store does not support aliases")
+
+// Alias is a name for a row, stored on the shard the name hashes to (see
+// shard.ForKey), not the row's.
+type Alias struct {
+	Alias     string
+	RowKey    uuid.UUID
+	CreatedAt time.Time
+}
+
+// AliasStore is implemented by stores that keep row aliases. Use PutAlias,
+// GetAlias and DeleteAlias, which fail with ErrAliasesUnsupported for
+// stores that do not implement it.
+type AliasStore interface {
+	// PutAlias registers alias for rowKey. Registering an alias again for
+	// the row it names returns it unchanged; for another row it fails with
+	// ErrAliasExists.
+	PutAlias(ctx context.Context, alias string, rowKey uuid.UUID) (*Alias, error)
+	// GetAlias returns an alias, or ErrAliasNotFound.
+	GetAlias(ctx context.Context, alias string) (*Alias, error)
+	// DeleteAlias removes an alias, or fails with ErrAliasNotFound.
+	DeleteAlias(ctx context.Context, alias string) error
+}
+
+// AliasLister is implemented by alias stores that can list their aliases,
+// as reshard does to move them. Use ListAliases.
+type AliasLister interface {
+	// ListAliases returns up to limit aliases ordered by name, starting
+	// after the alias after.
+	ListAliases(ctx context.Context, after string, limit int) ([]Alias, error)
+}
+
+// PutAlias registers an alias for a row.
+func PutAlias(ctx context.Context, store CellStore, alias string, rowKey uuid.UUID) (*Alias, error) {
+	if a, ok := store.(AliasStore); ok {
+		return a.PutAlias(ctx, alias, rowKey)
+	}
+	return nil, ErrAliasesUnsupported
+}
+
+// GetAlias looks an alias up.
+func GetAlias(ctx context.Context, store CellStore, alias string) (*Alias, error) {
+	if a, ok := store.(AliasStore); ok {
+		return a.GetAlias(ctx, alias)
+	}
+	return nil, ErrAliasesUnsupported
+}
+
+// DeleteAlias removes an alias.
+func DeleteAlias(ctx context.Context, store CellStore, alias string) error {
+	if a, ok := store.(AliasStore); ok {
+		return a.DeleteAlias(ctx, alias)
+	}
+	return ErrAliasesUnsupported
+}
+
+// ListAliases pages through a store's aliases.
+func ListAliases(ctx context.Context, store CellStore, after string, limit int) ([]Alias, error) {
+	if a, ok := store.(AliasLister); ok {
+		return a.ListAliases(ctx, after, limit)
+	}
+	return nil, ErrAliasesUnsupported
+}
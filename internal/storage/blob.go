@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+)
+
+// ErrBlobsUnsupported is returned for binary cells on a store that cannot
+// keep their bytes.
+var ErrBlobsUnsupported = errors.New("store does not support binary cells")
+
+// BlobStore is implemented by stores that keep the bytes of binary cells
+// (see cell.BlobBody) beside their bodies. Use WriteBlob, GetBlob and
+// GetBlobLatest, which fail with ErrBlobsUnsupported for stores that do not
+// implement it.
+type BlobStore interface {
+	// WriteBlob is WriteCell for a binary cell whose body, req.Body,
+	// describes data.
+	WriteBlob(ctx context.Context, req cell.WriteCellRequest, data []byte) (*cell.Cell, error)
+	// GetBlob is GetCell, also returning the cell's bytes; they are nil if
+	// the cell is not binary.
+	GetBlob(ctx context.Context, ref cell.CellRef) (*cell.Cell, []byte, error)
+	// GetBlobLatest is GetCellLatest, also returning the cell's bytes.
+	GetBlobLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, []byte, error)
+}
+
+// WriteBlob writes a binary cell.
+func WriteBlob(ctx context.Context, store CellStore, req cell.WriteCellRequest, data []byte) (*cell.Cell, error) {
+	if b, ok := store.(BlobStore); ok {
+		return b.WriteBlob(ctx, req, data)
+	}
+	return nil, ErrBlobsUnsupported
+}
+
+// GetBlob reads a cell with its bytes.
+func GetBlob(ctx context.Context, store CellStore, ref cell.CellRef) (*cell.Cell, []byte, error) {
+	if b, ok := store.(BlobStore); ok {
+		return b.GetBlob(ctx, ref)
+	}
+	return nil, nil, ErrBlobsUnsupported
+}
+
+// GetBlobLatest reads the latest version of a cell with its bytes.
+func GetBlobLatest(ctx context.Context, store CellStore, rowKey uuid.UUID, columnName string) (*cell.Cell, []byte, error) {
+	if b, ok := store.(BlobStore); ok {
+		return b.GetBlobLatest(ctx, rowKey, columnName)
+	}
+	return nil, nil, ErrBlobsUnsupported
+}
+
+// CopyCell writes c, a cell read from src, to dst: a binary cell with its
+// bytes, read from src, and any other cell with its body.
+func CopyCell(ctx context.Context, src, dst CellStore, c cell.Cell) (*cell.Cell, error) {
+	req := cell.WriteCellRequest{RowKey: c.RowKey, ColumnName: c.ColumnName, RefKey: c.RefKey, Body: c.Body}
+	data, err := BlobData(ctx, src, c)
+	if err != nil {
+		return nil, err
+	}
+	if data != nil {
+		return WriteBlob(ctx, dst, req, data)
+	}
+	return dst.WriteCell(ctx, req)
+}
+
+// BlobData returns the bytes of c, a cell read from store, or nil if it is
+// not a binary cell.
+func BlobData(ctx context.Context, store CellStore, c cell.Cell) ([]byte, error) {
+	info, ok := cell.ParseBlobBody(c.Body)
+	if !ok {
+		return nil, nil
+	}
+	_, data, err := GetBlob(ctx, store, cell.CellRef{RowKey: c.RowKey, ColumnName: c.ColumnName, RefKey: c.RefKey})
+	if errors.Is(err, ErrBlobsUnsupported) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read blob: %w", err)
+	}
+	if data == nil && info.Size == 0 {
+		data = []byte{}
+	}
+	return data, nil
+}
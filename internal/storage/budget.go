@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+type queryBudgetKey struct{}
+
+// WithQueryBudget marks ctx's deadline as a request budget, which replaces
+// stores' own per-query timeouts (see QueryContext), so that a scan given a
+// budget may run longer than DB_QUERY_TIMEOUT while point reads fail fast.
+func WithQueryBudget(ctx context.Context) context.Context {
+	return context.WithValue(ctx, queryBudgetKey{}, true)
+}
+
+// QueryContext derives the context of one query from ctx, bounded by
+// timeout as well as any deadline ctx already has, whichever comes first.
+// A request budget set with WithQueryBudget replaces timeout; so does a
+// timeout of zero.
+func QueryContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if budget, _ := ctx.Value(queryBudgetKey{}).(bool); budget || timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
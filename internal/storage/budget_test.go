@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestQueryContext(t *testing.T) {
+	remaining := func(ctx context.Context) time.Duration {
+		dl, ok := ctx.Deadline()
+		if !ok {
+			return 0
+		}
+		return time.Until(dl).Round(time.Second)
+	}
+
+	ctx, cancel := QueryContext(context.Background(), 5*time.Second)
+	defer cancel()
+	if got := remaining(ctx); got != 5*time.Second {
+		t.Errorf("no deadline: got %v, want the query timeout", got)
+	}
+
+	// A longer deadline does not lift the query timeout; a shorter one wins.
+	long, cancelLong := context.WithTimeout(context.Background(), time.Minute)
+	defer cancelLong()
+	ctx, cancel = QueryContext(long, 5*time.Second)
+	defer cancel()
+	if got := remaining(ctx); got != 5*time.Second {
+		t.Errorf("longer deadline: got %v, want the query timeout", got)
+	}
+	short, cancelShort := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancelShort()
+	ctx, cancel = QueryContext(short, 5*time.Second)
+	defer cancel()
+	if got := remaining(ctx); got != 2*time.Second {
+		t.Errorf("shorter deadline: got %v, want the deadline", got)
+	}
+
+	// A request budget replaces it.
+	budget, cancelBudget := context.WithTimeout(WithQueryBudget(context.Background()), 30*time.Second)
+	defer cancelBudget()
+	ctx, cancel = QueryContext(budget, 5*time.Second)
+	defer cancel()
+	if got := remaining(ctx); got != 30*time.Second {
+		t.Errorf("request budget: got %v, want the budget", got)
+	}
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Checkpoint tables, each holding the positions of one kind of reader that
+// tails shards' history in added_id order.
+const (
+	// ReplicationCheckpoints holds replication streams' positions (see
+	// internal/replication and RunReplicationMigration).
+	ReplicationCheckpoints = "replication_checkpoints"
+	// ExportCheckpoints holds exports' positions (see internal/export and
+	// RunExportMigration).
+	ExportCheckpoints = "export_checkpoints"
+	// SearchCheckpoints holds search indexers' positions (see
+	// internal/search and RunSearchMigration).
+	SearchCheckpoints = "search_checkpoints"
+)
+
+// Checkpoints persists the positions of named readers that tail shards'
+// history: on each shard, the added_id of the last cell a reader has
+// handled.
+type Checkpoints interface {
+	// Load returns name's position on shardID, 0 if it has none.
+	Load(ctx context.Context, name string, shardID int) (int64, error)
+	Save(ctx context.Context, name string, shardID int, addedID int64) error
+}
+
+// PostgresCheckpoints implements Checkpoints backed by one of the
+// checkpoint tables.
+type PostgresCheckpoints struct {
+	pool         *pgxpool.Pool
+	table        string
+	queryTimeout time.Duration
+}
+
+// NewPostgresCheckpoints creates Checkpoints kept in table, such as
+// ReplicationCheckpoints, using the given connection pool. queryTimeout
+// sets the per-query context deadline; zero means no timeout.
+func NewPostgresCheckpoints(pool *pgxpool.Pool, table string, queryTimeout time.Duration) *PostgresCheckpoints {
+	return &PostgresCheckpoints{pool: pool, table: table, queryTimeout: queryTimeout}
+}
+
+func (s *PostgresCheckpoints) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.queryTimeout > 0 {
+		return context.WithTimeout(ctx, s.queryTimeout)
+	}
+	return ctx, func() {}
+}
+
+func (s *PostgresCheckpoints) Load(ctx context.Context, name string, shardID int) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var addedID int64
+	err := s.pool.QueryRow(ctx, fmt.Sprintf(`
+		SELECT added_id FROM %s WHERE name = $1 AND shard_id = $2
+	`, s.table), name, shardID).Scan(&addedID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("load checkpoint from %s: %w", s.table, err)
+	}
+	return addedID, nil
+}
+
+func (s *PostgresCheckpoints) Save(ctx context.Context, name string, shardID int, addedID int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.pool.Exec(ctx, fmt.Sprintf(`
+		INSERT INTO %s (name, shard_id, added_id, updated_at)
+		VALUES ($1, $2, $3, now())
+		ON CONFLICT (name, shard_id) DO UPDATE SET added_id = EXCLUDED.added_id, updated_at = EXCLUDED.updated_at
+	`, s.table), name, shardID, addedID); err != nil {
+		return fmt.Errorf("save checkpoint to %s: %w", s.table, err)
+	}
+	return nil
+}
+
+// Lowest returns the lowest position on shardID of any reader, and false
+// if none has one. It implements compaction.Readers.
+func (s *PostgresCheckpoints) Lowest(ctx context.Context, shardID int) (int64, bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var addedID *int64
+	if err := s.pool.QueryRow(ctx, fmt.Sprintf(`
+		SELECT min(added_id) FROM %s WHERE shard_id = $1
+	`, s.table), shardID).Scan(&addedID); err != nil {
+		return 0, false, fmt.Errorf("load lowest checkpoint from %s: %w", s.table, err)
+	}
+	if addedID == nil {
+		return 0, false, nil
+	}
+	return *addedID, true, nil
+}
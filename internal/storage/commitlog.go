@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// The commit log of a shard lists its cells in the order their
+// transactions committed. A constraint trigger deferred to commit appends
+// each new cell's added_id under a per-shard lock held until the commit
+// ends, so a log entry's seq is only drawn once every lower seq has
+// committed (or rolled back). Reading the log by seq never skips a cell,
+// with no need for PartitionRead's fence. The lock serializes the commits
+// of a shard's writes, but only from the trigger on, once their
+// statements have run. An index on added_id lets the trigger watchdog
+// find a lane's cells in the log (see ScanCommitLog).
+
+// commitLogTrigger names both the trigger function and the triggers.
+const commitLogTrigger = "mezzanine_commit_log"
+
+// ErrNoCommitLog is returned by PartitionRead with PartitionReadTypeCommitSeq
+// from a store without a commit log.
+var ErrNoCommitLog = errors.New("commit log not enabled")
+
+// commitLogFunction appends to <shard table>_log. Like the latest-cells
+// function, it does nothing when that table does not exist.
+const commitLogFunction = `
+	CREATE OR REPLACE FUNCTION mezzanine_commit_log() RETURNS trigger
+	LANGUAGE plpgsql AS $fn$
+	DECLARE
+		log text := quote_ident(TG_TABLE_SCHEMA) || '.' || quote_ident(TG_TABLE_NAME || '_log');
+	BEGIN
+		IF to_regclass(log) IS NULL THEN
+			RETURN NULL;
+		END IF;
+		-- Released when the transaction ends: committers append one at a
+		-- time. The two-key form, namespaced by the trigger's name, keeps
+		-- it apart from other advisory locks.
+		PERFORM pg_advisory_xact_lock(hashtext('mezzanine_commit_log'), TG_RELID::integer);
+		EXECUTE format('INSERT INTO %s (added_id) VALUES ($1)', log) USING NEW.added_id;
+		RETURN NULL;
+	END
+	$fn$
+`
+
+// CommitLogTable returns the commit log table name for a given shard number.
+func CommitLogTable(shardID int) string {
+	return ShardTable(shardID) + "_log"
+}
+
+// CreateCommitLogFunction creates (or replaces) the trigger function that
+// appends to commit logs. Restore calls it before pg_restore, since a dump
+// of a shard table includes its triggers.
+func CreateCommitLogFunction(ctx context.Context, db DB) error {
+	if _, err := db.Exec(ctx, commitLogFunction); err != nil {
+		return fmt.Errorf("create commit log function: %w", err)
+	}
+	return nil
+}
+
+// RunCommitLogMigration creates the commit log and its trigger for shards
+// [shardStart, shardEnd], which must already have cell tables. A log that
+// is new, or whose shard table lacks the trigger, is filled with the
+// existing cells in added_id order while writes to the shard are blocked.
+func RunCommitLogMigration(ctx context.Context, db DB, shardStart, shardEnd int) error {
+	if err := CreateCommitLogFunction(ctx, db); err != nil {
+		return err
+	}
+	for i := shardStart; i <= shardEnd; i++ {
+		if err := migrateCommitLog(ctx, db, i); err != nil {
+			return fmt.Errorf("migrate commit log for shard %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func migrateCommitLog(ctx context.Context, db DB, shardID int) error {
+	table, log := ShardTable(shardID), CommitLogTable(shardID)
+
+	var exists, hasTrigger bool
+	err := db.QueryRow(ctx, `
+		SELECT to_regclass($1) IS NOT NULL,
+			EXISTS (SELECT 1 FROM pg_trigger WHERE tgrelid = $2::regclass AND tgname = $3)
+	`, log, table, commitLogTrigger).Scan(&exists, &hasTrigger)
+	if err != nil {
+		return err
+	}
+	if exists && hasTrigger {
+		_, err := db.Exec(ctx, commitLogIndex(log))
+		return err
+	}
+
+	return pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		// Blocks writers (but not readers) until the backfill commits.
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`LOCK TABLE %s IN SHARE ROW EXCLUSIVE MODE`, table)); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %s (
+				seq      BIGSERIAL PRIMARY KEY,
+				added_id BIGINT NOT NULL
+			)
+		`, log)); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, commitLogIndex(log)); err != nil {
+			return err
+		}
+		if !hasTrigger {
+			if _, err := tx.Exec(ctx, fmt.Sprintf(`
+				CREATE CONSTRAINT TRIGGER %s AFTER INSERT ON %s
+				DEFERRABLE INITIALLY DEFERRED
+				FOR EACH ROW EXECUTE FUNCTION %s()
+			`, commitLogTrigger, table, commitLogTrigger)); err != nil {
+				return err
+			}
+		}
+		return rebuildCommitLog(ctx, tx, table, log)
+	})
+}
+
+func commitLogIndex(log string) string {
+	return fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_added_id_idx ON %s (added_id)`, log, log)
+}
+
+// RebuildCommitLog refills a shard's commit log from its cells in added_id
+// order, if the shard has one. Restore uses it: pg_restore replaces the
+// shard table but leaves the log as it was. seq starts over, so consumers
+// reading the log must start from the beginning.
+func RebuildCommitLog(ctx context.Context, pool *pgxpool.Pool, shardID int) error {
+	table, log := ShardTable(shardID), CommitLogTable(shardID)
+	var exists bool
+	if err := pool.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, log).Scan(&exists); err != nil {
+		return fmt.Errorf("rebuild commit log for shard %d: %w", shardID, err)
+	}
+	if !exists {
+		return nil
+	}
+	err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`LOCK TABLE %s IN SHARE ROW EXCLUSIVE MODE`, table)); err != nil {
+			return err
+		}
+		return rebuildCommitLog(ctx, tx, table, log)
+	})
+	if err != nil {
+		return fmt.Errorf("rebuild commit log for shard %d: %w", shardID, err)
+	}
+	return nil
+}
+
+func rebuildCommitLog(ctx context.Context, tx pgx.Tx, table, log string) error {
+	_, err := tx.Exec(ctx, fmt.Sprintf(`
+		TRUNCATE %s RESTART IDENTITY;
+		INSERT INTO %s (added_id)
+		SELECT added_id FROM %s ORDER BY added_id
+	`, log, log, table))
+	return err
+}
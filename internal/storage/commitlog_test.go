@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+)
+
+// commitLogShard is freshShard with a commit log and a store reading it.
+func commitLogShard(t *testing.T) (*PostgresStore, int) {
+	t.Helper()
+	store := freshShard(t)
+	shardID := 10000 + shardCounter
+	if err := RunCommitLogMigration(context.Background(), testPool, shardID, shardID); err != nil {
+		t.Fatalf("RunCommitLogMigration: %v", err)
+	}
+	store.UseCommitLog(true)
+	return store, shardID
+}
+
+func readCommitLog(t *testing.T, store *PostgresStore, afterSeq int64) []cell.Cell {
+	t.Helper()
+	cells, err := store.PartitionRead(context.Background(), 0, PartitionReadTypeCommitSeq, afterSeq, time.Time{}, 100)
+	if err != nil {
+		t.Fatalf("PartitionRead by commit seq: %v", err)
+	}
+	return cells
+}
+
+func TestCommitLog_CommitOrder(t *testing.T) {
+	store, _ := commitLogShard(t)
+	ctx := context.Background()
+
+	// The first added_id commits last, so it is logged last.
+	tx, err := testPool.Begin(ctx)
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	defer tx.Rollback(ctx)
+	slow := uuid.New()
+	if _, err := tx.Exec(ctx, store.q.writeCell, slow, "col", 1, json.RawMessage(`{}`)); err != nil {
+		t.Fatalf("insert in transaction: %v", err)
+	}
+	fast := writeRef(t, store, uuid.New())
+
+	cells := readCommitLog(t, store, 0)
+	if len(cells) != 1 || cells[0].AddedID != fast.AddedID || cells[0].CommitSeq != 1 {
+		t.Fatalf("log before the slow commit: got %+v, want only the fast cell at seq 1", cells)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	cells = readCommitLog(t, store, cells[0].CommitSeq)
+	if len(cells) != 1 || cells[0].RowKey != slow || cells[0].CommitSeq != 2 || cells[0].AddedID >= fast.AddedID {
+		t.Errorf("log after the slow commit: got %+v, want the slow cell at seq 2", cells)
+	}
+}
+
+func TestCommitLog_RolledBackNotLogged(t *testing.T) {
+	store, _ := commitLogShard(t)
+	ctx := context.Background()
+
+	tx, err := testPool.Begin(ctx)
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if _, err := tx.Exec(ctx, store.q.writeCell, uuid.New(), "col", 1, json.RawMessage(`{}`)); err != nil {
+		t.Fatalf("insert in transaction: %v", err)
+	}
+	if err := tx.Rollback(ctx); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	c := writeRef(t, store, uuid.New())
+
+	if cells := readCommitLog(t, store, 0); len(cells) != 1 || cells[0].AddedID != c.AddedID {
+		t.Errorf("log: got %+v, want only the committed cell", cells)
+	}
+}
+
+func TestCommitLog_BackfillsAndRebuilds(t *testing.T) {
+	store := freshShard(t)
+	shardID := 10000 + shardCounter
+	ctx := context.Background()
+
+	var want []int64
+	for range 3 {
+		want = append(want, writeRef(t, store, uuid.New()).AddedID)
+	}
+	if err := RunCommitLogMigration(ctx, testPool, shardID, shardID); err != nil {
+		t.Fatalf("RunCommitLogMigration: %v", err)
+	}
+	// Running it again leaves the log alone.
+	if err := RunCommitLogMigration(ctx, testPool, shardID, shardID); err != nil {
+		t.Fatalf("RunCommitLogMigration again: %v", err)
+	}
+	store.UseCommitLog(true)
+	want = append(want, writeRef(t, store, uuid.New()).AddedID)
+
+	logged := func() []int64 {
+		var ids []int64
+		for i, c := range readCommitLog(t, store, 0) {
+			if c.CommitSeq != int64(i+1) {
+				t.Errorf("cell %d: commit_seq %d, want %d", c.AddedID, c.CommitSeq, i+1)
+			}
+			ids = append(ids, c.AddedID)
+		}
+		return ids
+	}
+	if got := logged(); !reflect.DeepEqual(got, want) {
+		t.Errorf("log after backfill: got added_ids %v, want %v", got, want)
+	}
+
+	if _, err := testPool.Exec(ctx, "DELETE FROM "+ShardTable(shardID)+" WHERE added_id = $1", want[1]); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := RebuildCommitLog(ctx, testPool, shardID); err != nil {
+		t.Fatalf("RebuildCommitLog: %v", err)
+	}
+	if got, want := logged(), []int64{want[0], want[2], want[3]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("log after rebuild: got added_ids %v, want %v", got, want)
+	}
+}
+
+func TestCommitLog_Scan(t *testing.T) {
+	store, _ := commitLogShard(t)
+	ctx := context.Background()
+
+	var ids []int64
+	for range 4 {
+		ids = append(ids, writeRef(t, store, uuid.New()).AddedID)
+	}
+	cells, floor, err := store.ScanCommitLog(ctx, ids[1], 0, 2)
+	if err != nil {
+		t.Fatalf("ScanCommitLog: %v", err)
+	}
+	if len(cells) != 2 || cells[0].AddedID != ids[1] || cells[1].AddedID != ids[2] || floor != ids[3] {
+		t.Fatalf("first page from %d: got %+v and floor %d, want %v and %d", ids[1], cells, floor, ids[1:3], ids[3])
+	}
+	cells, floor, err = store.ScanCommitLog(ctx, ids[1], cells[1].CommitSeq, 2)
+	if err != nil {
+		t.Fatalf("ScanCommitLog: %v", err)
+	}
+	if len(cells) != 1 || cells[0].AddedID != ids[3] || floor != 0 {
+		t.Errorf("last page: got %+v and floor %d, want %d and 0", cells, floor, ids[3])
+	}
+}
+
+func TestCommitLog_NotEnabled(t *testing.T) {
+	store := freshShard(t)
+	_, err := store.PartitionRead(context.Background(), 0, PartitionReadTypeCommitSeq, 0, time.Time{}, 10)
+	if !errors.Is(err, ErrNoCommitLog) {
+		t.Errorf("PartitionRead by commit seq without a log: got %v, want ErrNoCommitLog", err)
+	}
+	if _, _, err := store.ScanCommitLog(context.Background(), 1, 0, 10); !errors.Is(err, ErrNoCommitLog) {
+		t.Errorf("ScanCommitLog without a log: got %v, want ErrNoCommitLog", err)
+	}
+}
+
+func writeRef(t *testing.T, store *PostgresStore, rowKey uuid.UUID) *cell.Cell {
+	t.Helper()
+	c, err := store.WriteCell(context.Background(), cell.WriteCellRequest{RowKey: rowKey, ColumnName: "col", RefKey: 1, Body: json.RawMessage(`{}`)})
+	if err != nil {
+		t.Fatalf("WriteCell: %v", err)
+	}
+	return c
+}
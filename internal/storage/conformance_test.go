@@ -0,0 +1,46 @@
+package storage_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/index/indextest"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/storetest"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger/pluginstoretest"
+)
+
+func TestPostgresStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storage.CellStore { return storage.FreshShard(t) })
+}
+
+func TestPostgresIndexStore_Conformance(t *testing.T) {
+	n := 0
+	indextest.Run(t, func(t *testing.T, uniqueFields []string) index.IndexStore {
+		n++
+		def := index.Definition{Name: fmt.Sprintf("conformance_%d", n), UniqueFields: uniqueFields}
+		r := index.NewRegistry()
+		r.Register(storage.Pool(), def, 1)
+		if err := r.CreateTablesRange(context.Background(), storage.Pool(), 0, 0); err != nil {
+			t.Fatalf("create index table: %v", err)
+		}
+		return index.NewStore(storage.Pool(), def.Name, 0, 5*time.Second)
+	})
+}
+
+func TestPostgresPluginStore_Conformance(t *testing.T) {
+	pluginstoretest.Run(t, func(t *testing.T) trigger.PluginStore {
+		ctx := context.Background()
+		if err := storage.RunPluginMigration(ctx, storage.Pool()); err != nil {
+			t.Fatalf("RunPluginMigration: %v", err)
+		}
+		if _, err := storage.Pool().Exec(ctx, `TRUNCATE plugins`); err != nil {
+			t.Fatalf("truncate plugins: %v", err)
+		}
+		return trigger.NewPostgresPluginStore(storage.Pool(), 5*time.Second)
+	})
+}
@@ -0,0 +1,10 @@
+package storage
+
+import "github.com/jackc/pgx/v5/pgxpool"
+
+// FreshShard is freshShard for tests in package storage_test, which cannot
+// be in package storage because storetest imports it.
+var FreshShard = freshShard
+
+// Pool returns the pool of the test database, for the same tests.
+func Pool() *pgxpool.Pool { return testPool }
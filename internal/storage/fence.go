@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// added_id comes from a sequence when a row is inserted but becomes visible
+// when its transaction commits, so a slow transaction can commit a lower
+// added_id after a faster one with a higher id has been read. A changefeed
+// paging by added_id would move past it and never see it.
+//
+// PartitionRead by added_id therefore stops at a fence: the highest added_id
+// below which every row that will ever commit already has. The fence is
+// found without blocking writers. Read the sequence's last value, then the
+// transactions in progress; once all of those have ended, every id up to
+// that value is committed or rolled back. Ids are drawn after the writing
+// transaction has its transaction id (see mezzanine_next_added_id), so a
+// transaction holding such an id is in that list or has already committed.
+
+// nextAddedIDFunction is the added_id default of shard tables. It assigns
+// the transaction its id before drawing from the sequence.
+const nextAddedIDFunction = `
+	CREATE OR REPLACE FUNCTION mezzanine_next_added_id(seq regclass) RETURNS bigint
+	LANGUAGE plpgsql AS $fn$
+	BEGIN
+		PERFORM pg_current_xact_id();
+		RETURN nextval(seq);
+	END
+	$fn$
+`
+
+const (
+	// runningXIDsQuery lists the transactions in progress, on any table.
+	runningXIDsQuery = `
+		SELECT coalesce(array_agg(x::text::bigint), '{}')
+		FROM pg_snapshot_xip(pg_current_snapshot()) AS x
+		WHERE pg_xact_status(x) = 'in progress'
+	`
+	// stillRunningQuery counts the transactions of $1 still in progress.
+	stillRunningQuery = `
+		SELECT count(*)
+		FROM unnest($1::bigint[]) AS x
+		WHERE pg_xact_status(x::text::xid8) = 'in progress'
+	`
+)
+
+// CreateNextAddedIDFunction creates (or replaces) the function shard tables
+// draw added_id from. Restore calls it before pg_restore, since a dump of a
+// shard table refers to it.
+func CreateNextAddedIDFunction(ctx context.Context, db DB) error {
+	if _, err := db.Exec(ctx, nextAddedIDFunction); err != nil {
+		return fmt.Errorf("create next added_id function: %w", err)
+	}
+	return nil
+}
+
+// addedIDFence tracks a shard's fence. pending is a candidate waiting for
+// xids, the transactions that were running when it was read, to end.
+type addedIDFence struct {
+	mu      sync.Mutex
+	settled int64
+	pending int64
+	xids    []int64
+}
+
+// settleWait bounds how long settledAddedID waits for the transactions
+// running when it read the sequence to end. Past it, the fence it has is
+// returned and the candidate is settled by a later call.
+const settleWait = time.Second
+
+// settledAddedID returns the shard's fence, advancing it as far as the
+// database allows. When transactions are running it waits for them to end,
+// up to settleWait, so a reader is not answered with a fence that trails
+// every cell committed before it asked.
+func (s *PostgresStore) settledAddedID(ctx context.Context) (int64, error) {
+	f := s.fence
+	f.mu.Lock()
+	pending, xids := f.pending, f.xids
+	f.mu.Unlock()
+
+	// Statements run in order, each with its own snapshot, so the sequence
+	// is read before the running transactions are listed.
+	batch := &pgx.Batch{}
+	if xids != nil {
+		batch.Queue(stillRunningQuery, xids)
+	}
+	batch.Queue(s.q.lastAddedID)
+	batch.Queue(runningXIDsQuery)
+	stillRunning := int64(-1)
+	var last int64
+	var running []int64
+	err := func() error {
+		br := s.pool.SendBatch(ctx, batch)
+		defer br.Close()
+		if xids != nil {
+			if err := br.QueryRow().Scan(&stillRunning); err != nil {
+				return fmt.Errorf("check running transactions: %w", err)
+			}
+		}
+		if err := br.QueryRow().Scan(&last); err != nil {
+			return fmt.Errorf("read last added_id: %w", err)
+		}
+		if err := br.QueryRow().Scan(&running); err != nil {
+			return fmt.Errorf("list running transactions: %w", err)
+		}
+		return nil
+	}()
+	if err != nil {
+		return 0, err
+	}
+
+	f.mu.Lock()
+	if stillRunning == 0 {
+		f.settle(pending)
+	}
+	if len(running) == 0 {
+		f.settle(last)
+	} else if f.xids == nil {
+		f.pending, f.xids = last, running
+	}
+	settled := f.settled
+	f.mu.Unlock()
+	if len(running) == 0 || settled >= last {
+		return settled, nil
+	}
+
+	ended, err := s.awaitTransactions(ctx, running)
+	if err != nil {
+		return 0, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if ended {
+		f.settle(last)
+	}
+	return f.settled, nil
+}
+
+// awaitTransactions polls until none of xids is in progress, reporting
+// false if some still are after settleWait.
+func (s *PostgresStore) awaitTransactions(ctx context.Context, xids []int64) (bool, error) {
+	deadline := time.Now().Add(settleWait)
+	backoff := time.Millisecond
+	for {
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return false, ctx.Err()
+		case <-t.C:
+		}
+		var n int64
+		if err := s.pool.QueryRow(ctx, stillRunningQuery, xids).Scan(&n); err != nil {
+			return false, fmt.Errorf("check running transactions: %w", err)
+		}
+		if n == 0 {
+			return true, nil
+		}
+		if time.Now().After(deadline) {
+			return false, nil
+		}
+		backoff = min(2*backoff, 50*time.Millisecond)
+	}
+}
+
+// settle moves the fence up to id and drops the pending candidate if id
+// covers it.
+func (f *addedIDFence) settle(id int64) {
+	f.settled = max(f.settled, id)
+	if f.xids != nil && f.pending <= id {
+		f.pending, f.xids = 0, nil
+	}
+}
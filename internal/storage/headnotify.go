@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// HeadChannel is the Postgres channel shards' heads are published on.
+const HeadChannel = "mezzanine_head"
+
+// headPublishInterval is how often each instance publishes the heads its
+// writes moved, so that a burst of writes costs one NOTIFY per shard.
+const headPublishInterval = 50 * time.Millisecond
+
+// HeadNotifier shares the heads of PostgresStores between instances with
+// Postgres NOTIFY and LISTEN, so that WaitHead is woken by writes through
+// any instance, not only its own. Each instance publishes the heads its
+// writes moved on the shard's backend, at most every headPublishInterval,
+// and listens on every backend. Writes by import and restore are still
+// not seen.
+type HeadNotifier struct {
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	pools  map[*pgxpool.Pool][]int // shards of each backend
+	stores map[int]*PostgresStore
+}
+
+// NewHeadNotifier creates a notifier with no stores.
+func NewHeadNotifier(logger *slog.Logger) *HeadNotifier {
+	return &HeadNotifier{logger: logger, pools: make(map[*pgxpool.Pool][]int), stores: make(map[int]*PostgresStore)}
+}
+
+// Add shares the head of s, the store of shardID. It must be called before
+// Run.
+func (n *HeadNotifier) Add(shardID int, s *PostgresStore) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.stores[shardID] = s
+	n.pools[s.pool] = append(n.pools[s.pool], shardID)
+}
+
+// Run publishes and listens for heads until ctx is cancelled, and returns
+// once every listener has released its connection. Lost connections are
+// re-established; heads published while disconnected are only seen by
+// waits that start after the next write.
+func (n *HeadNotifier) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for pool, shards := range n.pools {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			n.listen(ctx, pool)
+		}()
+		go func() {
+			defer wg.Done()
+			n.publish(ctx, pool, shards)
+		}()
+	}
+	wg.Wait()
+}
+
+// publish sends the heads of shards, all on pool, whenever a write through
+// this instance moved them.
+func (n *HeadNotifier) publish(ctx context.Context, pool *pgxpool.Pool, shards []int) {
+	published := make(map[int]int64, len(shards))
+	ticker := time.NewTicker(headPublishInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		moved := make(map[int]int64)
+		var payloads []string
+		for _, id := range shards {
+			if head := n.stores[id].written.local(); head > published[id] {
+				moved[id] = head
+				payloads = append(payloads, fmt.Sprintf("%d:%d", id, head))
+			}
+		}
+		if len(payloads) == 0 {
+			continue
+		}
+		if _, err := pool.Exec(ctx, `SELECT pg_notify($1, p) FROM unnest($2::text[]) p`, HeadChannel, payloads); err != nil {
+			if ctx.Err() == nil {
+				n.logger.Warn("head publish failed", "error", err)
+			}
+			continue
+		}
+		for id, head := range moved {
+			published[id] = head
+		}
+	}
+}
+
+func (n *HeadNotifier) listen(ctx context.Context, pool *pgxpool.Pool) {
+	backoff := 100 * time.Millisecond
+	for ctx.Err() == nil {
+		err := n.listenOnce(ctx, pool, func() { backoff = 100 * time.Millisecond })
+		if ctx.Err() != nil {
+			return
+		}
+		n.logger.Warn("head listener disconnected", "error", err, "retry_in", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 10*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+func (n *HeadNotifier) listenOnce(ctx context.Context, pool *pgxpool.Pool, connected func()) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// The connection's session state is LISTEN, so it is not returned to
+	// the pool for reuse.
+	pgc := conn.Hijack()
+	defer pgc.Close(context.Background())
+
+	if _, err := pgc.Exec(ctx, "LISTEN "+HeadChannel); err != nil {
+		return err
+	}
+	connected()
+	for {
+		msg, err := pgc.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		n.apply(msg.Payload)
+	}
+}
+
+// apply wakes the waiters of the shard whose head payload carries.
+func (n *HeadNotifier) apply(payload string) {
+	shardPart, headPart, ok := strings.Cut(payload, ":")
+	if !ok {
+		return
+	}
+	id, err1 := strconv.Atoi(shardPart)
+	head, err2 := strconv.ParseInt(headPart, 10, 64)
+	if err1 != nil || err2 != nil {
+		n.logger.Warn("invalid head payload", "payload", payload)
+		return
+	}
+	if s, ok := n.stores[id]; ok {
+		s.written.observe(head)
+	}
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestHeadNotifier_ApplyWakesWaiters(t *testing.T) {
+	n := NewHeadNotifier(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	s := NewPostgresStore(nil, 3, time.Second)
+	n.Add(3, s)
+
+	done := make(chan int64, 1)
+	go func() {
+		head, _ := s.WaitHead(context.Background(), 10)
+		done <- head
+	}()
+	n.apply("4:99")  // another shard
+	n.apply("3:bad") // malformed
+	n.apply("3:42")
+	select {
+	case head := <-done:
+		if head != 42 {
+			t.Errorf("WaitHead: got %d, want 42", head)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitHead was not woken by a published head")
+	}
+	if own := s.written.local(); own != 0 {
+		t.Errorf("local head: got %d, want 0 for heads published by others", own)
+	}
+}
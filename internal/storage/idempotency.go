@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// IdempotencyKeyTTL is how long a store remembers an Idempotency-Key. A
+// retry arriving later is compared with the stored cells instead.
+const IdempotencyKeyTTL = 24 * time.Hour
+
+// ErrIdempotencyKeyNotFound is returned when an Idempotency-Key is not
+// remembered, because it was never recorded, has expired, or the store
+// keeps no keys.
+var ErrIdempotencyKeyNotFound = errors.New("idempotency key not found")
+
+// IdempotencyStore is implemented by stores that remember the
+// Idempotency-Keys of the writes to their shard, each with a hash of the
+// request it was sent with, so that a retry can be told from another
+// request reusing its key. Keys are forgotten after IdempotencyKeyTTL. Use
+// RecordIdempotencyKey and IdempotencyKeyHash; stores that do not
+// implement it remember no keys.
+type IdempotencyStore interface {
+	// RecordIdempotencyKey records hash as the request made with key,
+	// unless key is already recorded with a request of its own.
+	RecordIdempotencyKey(ctx context.Context, key string, hash []byte) error
+	// IdempotencyKeyHash returns the hash recorded with key, or
+	// ErrIdempotencyKeyNotFound.
+	IdempotencyKeyHash(ctx context.Context, key string) ([]byte, error)
+}
+
+// RecordIdempotencyKey records the request made with an Idempotency-Key.
+// It does nothing on a store that keeps no keys.
+func RecordIdempotencyKey(ctx context.Context, store CellStore, key string, hash []byte) error {
+	if s, ok := store.(IdempotencyStore); ok {
+		return s.RecordIdempotencyKey(ctx, key, hash)
+	}
+	return nil
+}
+
+// IdempotencyKeyHash returns the hash of the request recorded with an
+// Idempotency-Key.
+func IdempotencyKeyHash(ctx context.Context, store CellStore, key string) ([]byte, error) {
+	if s, ok := store.(IdempotencyStore); ok {
+		return s.IdempotencyKeyHash(ctx, key)
+	}
+	return nil, ErrIdempotencyKeyNotFound
+}
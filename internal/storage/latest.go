@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// The latest-cells table of a shard holds only the newest version of each
+// (row_key, column_name), so GetCellLatest and GetRow read one row per
+// column instead of walking the version history. A trigger on the shard
+// table keeps it current on every insert and delete, whoever the writer is
+// (API, importer, reshard or restore trimming).
+
+// latestCellsTrigger names both the trigger function and the triggers.
+const latestCellsTrigger = "mezzanine_latest_cells"
+
+// latestCellsFunction maintains <shard table>_latest. It does nothing when
+// that table does not exist, so restoring a dump that carries the trigger
+// into a cluster without latest-cells tables keeps writes working.
+const latestCellsFunction = `
+	CREATE OR REPLACE FUNCTION mezzanine_latest_cells() RETURNS trigger
+	LANGUAGE plpgsql AS $fn$
+	DECLARE
+		latest text := quote_ident(TG_TABLE_SCHEMA) || '.' || quote_ident(TG_TABLE_NAME || '_latest');
+		n      bigint;
+	BEGIN
+		IF to_regclass(latest) IS NULL THEN
+			RETURN NULL;
+		END IF;
+		IF TG_OP = 'INSERT' THEN
+			EXECUTE format($q$
+				INSERT INTO %s AS l (row_key, column_name, added_id, ref_key, body, created_at)
+				VALUES ($1, $2, $3, $4, $5, $6)
+				ON CONFLICT (row_key, column_name) DO UPDATE
+				SET added_id = EXCLUDED.added_id, ref_key = EXCLUDED.ref_key,
+					body = EXCLUDED.body, created_at = EXCLUDED.created_at
+				WHERE l.ref_key < EXCLUDED.ref_key
+			$q$, latest)
+			USING NEW.row_key, NEW.column_name, NEW.added_id, NEW.ref_key, NEW.body, NEW.created_at;
+			RETURN NULL;
+		END IF;
+
+		-- DELETE: if the newest version went, fall back to the next newest.
+		EXECUTE format($q$
+			DELETE FROM %s WHERE row_key = $1 AND column_name = $2 AND added_id = $3
+		$q$, latest)
+		USING OLD.row_key, OLD.column_name, OLD.added_id;
+		GET DIAGNOSTICS n = ROW_COUNT;
+		IF n > 0 THEN
+			EXECUTE format($q$
+				INSERT INTO %s (row_key, column_name, added_id, ref_key, body, created_at)
+				SELECT row_key, column_name, added_id, ref_key, body, created_at
+				FROM %I.%I
+				WHERE row_key = $1 AND column_name = $2
+				ORDER BY ref_key DESC
+				LIMIT 1
+				ON CONFLICT (row_key, column_name) DO NOTHING
+			$q$, latest, TG_TABLE_SCHEMA, TG_TABLE_NAME)
+			USING OLD.row_key, OLD.column_name;
+		END IF;
+		RETURN NULL;
+	END
+	$fn$
+`
+
+// LatestTable returns the latest-cells table name for a given shard number.
+func LatestTable(shardID int) string {
+	return ShardTable(shardID) + "_latest"
+}
+
+// CreateLatestCellsFunction creates (or replaces) the trigger function that
+// maintains latest-cells tables. Restore calls it before pg_restore, since a
+// dump of a shard table includes its triggers.
+func CreateLatestCellsFunction(ctx context.Context, db DB) error {
+	if _, err := db.Exec(ctx, latestCellsFunction); err != nil {
+		return fmt.Errorf("create latest cells function: %w", err)
+	}
+	return nil
+}
+
+// RunLatestCellsMigration creates the latest-cells table and its trigger for
+// shards [shardStart, shardEnd], which must already have cell tables. A
+// table that is new, or whose shard table lacks the trigger, is filled from
+// the full history while writes to the shard are blocked, so no write falls
+// between the backfill and the trigger.
+func RunLatestCellsMigration(ctx context.Context, db DB, shardStart, shardEnd int) error {
+	if err := CreateLatestCellsFunction(ctx, db); err != nil {
+		return err
+	}
+	for i := shardStart; i <= shardEnd; i++ {
+		if err := migrateLatestCells(ctx, db, i); err != nil {
+			return fmt.Errorf("migrate latest cells for shard %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func migrateLatestCells(ctx context.Context, db DB, shardID int) error {
+	table, latest := ShardTable(shardID), LatestTable(shardID)
+
+	var exists, hasTrigger bool
+	err := db.QueryRow(ctx, `
+		SELECT to_regclass($1) IS NOT NULL,
+			EXISTS (SELECT 1 FROM pg_trigger WHERE tgrelid = $2::regclass AND tgname = $3)
+	`, latest, table, latestCellsTrigger).Scan(&exists, &hasTrigger)
+	if err != nil {
+		return err
+	}
+	if exists && hasTrigger {
+		return nil
+	}
+
+	return pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		// Blocks writers (but not readers) until the backfill commits.
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`LOCK TABLE %s IN SHARE ROW EXCLUSIVE MODE`, table)); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %s (
+				row_key     UUID NOT NULL,
+				column_name TEXT NOT NULL,
+				added_id    BIGINT NOT NULL,
+				ref_key     BIGINT NOT NULL,
+				body        JSONB NOT NULL,
+				created_at  TIMESTAMPTZ NOT NULL,
+
+				PRIMARY KEY (row_key, column_name)
+			)
+		`, latest)); err != nil {
+			return err
+		}
+		if !hasTrigger {
+			if _, err := tx.Exec(ctx, fmt.Sprintf(`
+				CREATE TRIGGER %s AFTER INSERT OR DELETE ON %s
+				FOR EACH ROW EXECUTE FUNCTION %s()
+			`, latestCellsTrigger, table, latestCellsTrigger)); err != nil {
+				return err
+			}
+		}
+		return rebuildLatestCells(ctx, tx, table, latest)
+	})
+}
+
+// RebuildLatestCells refills a shard's latest-cells table from its full
+// history, if the shard has one. Restore uses it: pg_restore replaces the
+// shard table but leaves the derived latest-cells table as it was.
+func RebuildLatestCells(ctx context.Context, pool *pgxpool.Pool, shardID int) error {
+	table, latest := ShardTable(shardID), LatestTable(shardID)
+	var exists bool
+	if err := pool.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, latest).Scan(&exists); err != nil {
+		return fmt.Errorf("rebuild latest cells for shard %d: %w", shardID, err)
+	}
+	if !exists {
+		return nil
+	}
+	err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`LOCK TABLE %s IN SHARE ROW EXCLUSIVE MODE`, table)); err != nil {
+			return err
+		}
+		return rebuildLatestCells(ctx, tx, table, latest)
+	})
+	if err != nil {
+		return fmt.Errorf("rebuild latest cells for shard %d: %w", shardID, err)
+	}
+	return nil
+}
+
+func rebuildLatestCells(ctx context.Context, tx pgx.Tx, table, latest string) error {
+	_, err := tx.Exec(ctx, fmt.Sprintf(`
+		DELETE FROM %s;
+		INSERT INTO %s (row_key, column_name, added_id, ref_key, body, created_at)
+		SELECT DISTINCT ON (row_key, column_name)
+			row_key, column_name, added_id, ref_key, body, created_at
+		FROM %s
+		ORDER BY row_key, column_name, ref_key DESC
+	`, latest, latest, table))
+	return err
+}
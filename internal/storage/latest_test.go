@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+)
+
+// latestShard is freshShard with a latest-cells table and a store reading it.
+func latestShard(t *testing.T) (*PostgresStore, int) {
+	t.Helper()
+	store := freshShard(t)
+	shardID := 10000 + shardCounter
+	if err := RunLatestCellsMigration(context.Background(), testPool, shardID, shardID); err != nil {
+		t.Fatalf("RunLatestCellsMigration: %v", err)
+	}
+	store.UseLatestTable(true)
+	return store, shardID
+}
+
+func writeVersion(t *testing.T, store *PostgresStore, rowKey uuid.UUID, column string, refKey int64) {
+	t.Helper()
+	_, err := store.WriteCell(context.Background(), cell.WriteCellRequest{
+		RowKey: rowKey, ColumnName: column, RefKey: refKey,
+		Body: json.RawMessage(fmt.Sprintf(`{"v":%d}`, refKey)),
+	})
+	if err != nil {
+		t.Fatalf("WriteCell: %v", err)
+	}
+}
+
+func TestLatestTable_TracksWrites(t *testing.T) {
+	store, _ := latestShard(t)
+	ctx := context.Background()
+	rowKey := uuid.New()
+
+	// Out of order, so the trigger must keep the highest ref_key.
+	writeVersion(t, store, rowKey, "email", 2)
+	writeVersion(t, store, rowKey, "email", 3)
+	writeVersion(t, store, rowKey, "email", 1)
+	if _, err := store.WriteCells(ctx, []cell.WriteCellRequest{
+		{RowKey: rowKey, ColumnName: "name", RefKey: 1, Body: json.RawMessage(`{}`)},
+		{RowKey: rowKey, ColumnName: "name", RefKey: 5, Body: json.RawMessage(`{}`)},
+	}); err != nil {
+		t.Fatalf("WriteCells: %v", err)
+	}
+
+	c, err := store.GetCellLatest(ctx, rowKey, "email")
+	if err != nil {
+		t.Fatalf("GetCellLatest: %v", err)
+	}
+	if c.RefKey != 3 {
+		t.Errorf("latest email = ref %d %s, want ref 3", c.RefKey, c.Body)
+	}
+
+	cells, err := store.GetRow(ctx, rowKey)
+	if err != nil {
+		t.Fatalf("GetRow: %v", err)
+	}
+	if len(cells) != 2 || cells[0].ColumnName != "email" || cells[1].RefKey != 5 {
+		t.Errorf("GetRow = %+v", cells)
+	}
+
+	if _, err := store.GetCellLatest(ctx, rowKey, "missing"); err != ErrCellNotFound {
+		t.Errorf("GetCellLatest(missing) error = %v, want ErrCellNotFound", err)
+	}
+
+	if p, err := store.ProbeCellLatest(ctx, rowKey, "email"); err != nil || p.RefKey != 3 {
+		t.Errorf("ProbeCellLatest = %+v, %v; want ref 3", p, err)
+	}
+	if sum, err := store.ProbeRow(ctx, rowKey, true); err != nil || sum.Columns != 2 {
+		t.Errorf("ProbeRow = %+v, %v; want 2 columns", sum, err)
+	}
+}
+
+func TestLatestTable_BackfillsExistingHistory(t *testing.T) {
+	store := freshShard(t)
+	shardID := 10000 + shardCounter
+	ctx := context.Background()
+	rowKey := uuid.New()
+	writeVersion(t, store, rowKey, "email", 1)
+	writeVersion(t, store, rowKey, "email", 2)
+
+	if err := RunLatestCellsMigration(ctx, testPool, shardID, shardID); err != nil {
+		t.Fatalf("RunLatestCellsMigration: %v", err)
+	}
+	// Running again must be a no-op.
+	if err := RunLatestCellsMigration(ctx, testPool, shardID, shardID); err != nil {
+		t.Fatalf("RunLatestCellsMigration again: %v", err)
+	}
+	store.UseLatestTable(true)
+
+	c, err := store.GetCellLatest(ctx, rowKey, "email")
+	if err != nil || c.RefKey != 2 {
+		t.Fatalf("GetCellLatest = %+v, %v; want ref 2", c, err)
+	}
+}
+
+func TestLatestTable_DeleteFallsBack(t *testing.T) {
+	store, shardID := latestShard(t)
+	ctx := context.Background()
+	rowKey := uuid.New()
+	writeVersion(t, store, rowKey, "email", 1)
+	writeVersion(t, store, rowKey, "email", 2)
+	writeVersion(t, store, rowKey, "name", 1)
+
+	// As restore trims a shard back to its marker.
+	if _, err := testPool.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE ref_key = 2`, ShardTable(shardID))); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	c, err := store.GetCellLatest(ctx, rowKey, "email")
+	if err != nil || c.RefKey != 1 {
+		t.Fatalf("GetCellLatest after delete = %+v, %v; want ref 1", c, err)
+	}
+
+	if _, err := testPool.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE column_name = 'name'`, ShardTable(shardID))); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := store.GetCellLatest(ctx, rowKey, "name"); err != ErrCellNotFound {
+		t.Errorf("GetCellLatest after deleting every version: error = %v, want ErrCellNotFound", err)
+	}
+}
+
+func TestRebuildLatestCells(t *testing.T) {
+	store, shardID := latestShard(t)
+	ctx := context.Background()
+	rowKey := uuid.New()
+	writeVersion(t, store, rowKey, "email", 1)
+
+	// Simulate a stale table, as left behind by pg_restore.
+	if _, err := testPool.Exec(ctx, fmt.Sprintf(`UPDATE %s SET ref_key = 99`, LatestTable(shardID))); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := RebuildLatestCells(ctx, testPool, shardID); err != nil {
+		t.Fatalf("RebuildLatestCells: %v", err)
+	}
+	c, err := store.GetCellLatest(ctx, rowKey, "email")
+	if err != nil || c.RefKey != 1 {
+		t.Fatalf("GetCellLatest = %+v, %v; want ref 1", c, err)
+	}
+
+	// Shards without a latest-cells table are left alone.
+	freshShard(t)
+	if err := RebuildLatestCells(ctx, testPool, 10000+shardCounter); err != nil {
+		t.Errorf("RebuildLatestCells without a table: %v", err)
+	}
+}
@@ -0,0 +1,563 @@
+// Package memory is an in-memory CellStore for one shard. It follows
+// PostgresStore's semantics (immutable cells, atomic batches, added_id and
+// created_at ordering, ErrCellExists and ErrCellNotFound, failing once the
+// context is done), so embedders, examples and tests can run without a
+// database. Nothing is persisted. storetest checks it against the same
+// contract as PostgresStore.
+package memory
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// Store is an in-memory CellStore. It is safe for concurrent use.
+type Store struct {
+	mu sync.RWMutex
+	// cells are in added_id order: the cell at index i has added_id i+1.
+	cells  []cell.Cell
+	byRef  map[cell.CellRef]int
+	latest map[uuid.UUID]map[string]int
+	// blobs holds the bytes of binary cells by index in cells.
+	blobs map[int][]byte
+	// aliases are the row aliases stored on the shard.
+	aliases map[string]storage.Alias
+	// tags are the rows carrying each tag.
+	tags map[string]map[uuid.UUID]struct{}
+	// keys are the recorded Idempotency-Keys. Expired keys are dropped
+	// when looked up or recorded again.
+	keys map[string]idempotencyKey
+	now  func() time.Time
+	// moved is closed and replaced on every write, waking WaitHead.
+	moved chan struct{}
+	// updateMu serializes UpdateCell. It is not mu, which apply may need
+	// to read the store.
+	updateMu sync.Mutex
+}
+
+// New creates an empty Store.
+func New() *Store {
+	return &Store{
+		byRef:   make(map[cell.CellRef]int),
+		latest:  make(map[uuid.UUID]map[string]int),
+		blobs:   make(map[int][]byte),
+		aliases: make(map[string]storage.Alias),
+		tags:    make(map[string]map[uuid.UUID]struct{}),
+		keys:    make(map[string]idempotencyKey),
+		now:     time.Now,
+		moved:   make(chan struct{}),
+	}
+}
+
+// SetClock sets the source of created_at for later writes, for tests that
+// need reproducible timestamps. Times must not go backwards, or partition
+// and window reads page incorrectly.
+func (s *Store) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = now
+}
+
+// Len returns the number of cells stored.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.cells)
+}
+
+func (s *Store) WriteCell(ctx context.Context, req cell.WriteCellRequest) (*cell.Cell, error) {
+	cells, err := s.write(ctx, []cell.WriteCellRequest{req}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("write cell: %w", err)
+	}
+	return &cells[0], nil
+}
+
+func (s *Store) WriteCells(ctx context.Context, reqs []cell.WriteCellRequest) ([]cell.Cell, error) {
+	if len(reqs) == 0 {
+		return nil, nil
+	}
+	cells, err := s.write(ctx, reqs, nil)
+	if err != nil {
+		return nil, fmt.Errorf("write cells: %w", err)
+	}
+	return cells, nil
+}
+
+// write stores reqs in order, or none of them if any already exists. blobs,
+// if not nil, holds the bytes of each request's binary cell.
+func (s *Store) write(ctx context.Context, reqs []cell.WriteCellRequest, blobs [][]byte) ([]cell.Cell, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(map[cell.CellRef]bool, len(reqs))
+	for _, req := range reqs {
+		ref := cell.CellRef{RowKey: req.RowKey, ColumnName: req.ColumnName, RefKey: req.RefKey}
+		if _, ok := s.byRef[ref]; ok || seen[ref] {
+			return nil, storage.ErrCellExists
+		}
+		seen[ref] = true
+	}
+
+	now := s.now()
+	out := make([]cell.Cell, len(reqs))
+	for i, req := range reqs {
+		c := cell.Cell{
+			AddedID:    int64(len(s.cells) + 1),
+			RowKey:     req.RowKey,
+			ColumnName: req.ColumnName,
+			RefKey:     req.RefKey,
+			Body:       slices.Clone(req.Body),
+			CreatedAt:  now,
+		}
+		idx := len(s.cells)
+		s.cells = append(s.cells, c)
+		if blobs != nil && blobs[i] != nil {
+			s.blobs[idx] = slices.Clone(blobs[i])
+		}
+		s.byRef[cell.CellRef{RowKey: c.RowKey, ColumnName: c.ColumnName, RefKey: c.RefKey}] = idx
+		cols := s.latest[c.RowKey]
+		if cols == nil {
+			cols = make(map[string]int)
+			s.latest[c.RowKey] = cols
+		}
+		if l, ok := cols[c.ColumnName]; !ok || s.cells[l].RefKey < c.RefKey {
+			cols[c.ColumnName] = idx
+		}
+		out[i] = c
+	}
+	close(s.moved)
+	s.moved = make(chan struct{})
+	return out, nil
+}
+
+func (s *Store) GetCell(ctx context.Context, ref cell.CellRef) (*cell.Cell, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i, ok := s.byRef[ref]
+	if !ok {
+		return nil, storage.ErrCellNotFound
+	}
+	c := s.cells[i]
+	return &c, nil
+}
+
+func (s *Store) GetCells(ctx context.Context, refs []cell.CellRef) ([]*cell.Cell, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*cell.Cell, len(refs))
+	for i, ref := range refs {
+		if j, ok := s.byRef[ref]; ok {
+			c := s.cells[j]
+			out[i] = &c
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) GetCellLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i, ok := s.latest[rowKey][columnName]
+	if !ok {
+		return nil, storage.ErrCellNotFound
+	}
+	c := s.cells[i]
+	return &c, nil
+}
+
+func (s *Store) WriteBlob(ctx context.Context, req cell.WriteCellRequest, data []byte) (*cell.Cell, error) {
+	cells, err := s.write(ctx, []cell.WriteCellRequest{req}, [][]byte{data})
+	if err != nil {
+		return nil, fmt.Errorf("write blob: %w", err)
+	}
+	return &cells[0], nil
+}
+
+// UpdateCell applies updates one at a time.
+func (s *Store) UpdateCell(ctx context.Context, rowKey uuid.UUID, columnName string, apply storage.UpdateFunc) (*cell.Cell, error) {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+	latest, err := s.GetCellLatest(ctx, rowKey, columnName)
+	if err != nil && !errors.Is(err, storage.ErrCellNotFound) {
+		return nil, err
+	}
+	var refKey int64 = storage.FirstRefKey
+	if latest != nil {
+		refKey = latest.RefKey + 1
+	}
+	body, err := apply(ctx, latest)
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		return latest, nil
+	}
+	c, err := s.WriteCell(ctx, cell.WriteCellRequest{RowKey: rowKey, ColumnName: columnName, RefKey: refKey, Body: body})
+	if err != nil {
+		return nil, fmt.Errorf("update cell: %w", err)
+	}
+	return c, nil
+}
+
+func (s *Store) GetBlob(ctx context.Context, ref cell.CellRef) (*cell.Cell, []byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i, ok := s.byRef[ref]
+	if !ok {
+		return nil, nil, storage.ErrCellNotFound
+	}
+	c := s.cells[i]
+	return &c, s.blobs[i], nil
+}
+
+func (s *Store) GetBlobLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, []byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i, ok := s.latest[rowKey][columnName]
+	if !ok {
+		return nil, nil, storage.ErrCellNotFound
+	}
+	c := s.cells[i]
+	return &c, s.blobs[i], nil
+}
+
+func (s *Store) PutAlias(ctx context.Context, alias string, rowKey uuid.UUID) (*storage.Alias, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.aliases[alias]
+	if !ok {
+		a = storage.Alias{Alias: alias, RowKey: rowKey, CreatedAt: s.now()}
+		s.aliases[alias] = a
+	}
+	if a.RowKey != rowKey {
+		return nil, storage.ErrAliasExists
+	}
+	return &a, nil
+}
+
+func (s *Store) GetAlias(ctx context.Context, alias string) (*storage.Alias, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, ok := s.aliases[alias]
+	if !ok {
+		return nil, storage.ErrAliasNotFound
+	}
+	return &a, nil
+}
+
+func (s *Store) DeleteAlias(ctx context.Context, alias string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.aliases[alias]; !ok {
+		return storage.ErrAliasNotFound
+	}
+	delete(s.aliases, alias)
+	return nil
+}
+
+func (s *Store) ListAliases(ctx context.Context, after string, limit int) ([]storage.Alias, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []storage.Alias
+	for _, a := range s.aliases {
+		if a.Alias > after {
+			out = append(out, a)
+		}
+	}
+	slices.SortFunc(out, func(a, b storage.Alias) int { return strings.Compare(a.Alias, b.Alias) })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (s *Store) SetRowTags(ctx context.Context, rowKey uuid.UUID, tags []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for tag, rows := range s.tags {
+		if _, ok := rows[rowKey]; ok && !slices.Contains(tags, tag) {
+			delete(rows, rowKey)
+			if len(rows) == 0 {
+				delete(s.tags, tag)
+			}
+		}
+	}
+	for _, tag := range tags {
+		if s.tags[tag] == nil {
+			s.tags[tag] = make(map[uuid.UUID]struct{})
+		}
+		s.tags[tag][rowKey] = struct{}{}
+	}
+	return nil
+}
+
+type idempotencyKey struct {
+	hash      []byte
+	createdAt time.Time
+}
+
+func (s *Store) RecordIdempotencyKey(ctx context.Context, key string, hash []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if k, ok := s.keys[key]; !ok || now.Sub(k.createdAt) >= storage.IdempotencyKeyTTL {
+		s.keys[key] = idempotencyKey{hash: bytes.Clone(hash), createdAt: now}
+	}
+	return nil
+}
+
+func (s *Store) IdempotencyKeyHash(ctx context.Context, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[key]
+	if ok && s.now().Sub(k.createdAt) >= storage.IdempotencyKeyTTL {
+		delete(s.keys, key)
+		ok = false
+	}
+	if !ok {
+		return nil, storage.ErrIdempotencyKeyNotFound
+	}
+	return bytes.Clone(k.hash), nil
+}
+
+func (s *Store) RowsByTag(ctx context.Context, tag string, after uuid.UUID, limit int) ([]uuid.UUID, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	var keys []uuid.UUID
+	for row := range s.tags[tag] {
+		if bytes.Compare(row[:], after[:]) > 0 {
+			keys = append(keys, row)
+		}
+	}
+	s.mu.RUnlock()
+	slices.SortFunc(keys, func(a, b uuid.UUID) int { return bytes.Compare(a[:], b[:]) })
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys, nil
+}
+
+func (s *Store) QueryCells(ctx context.Context, q storage.Query) ([]cell.Cell, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	var cells []cell.Cell
+	for _, cols := range s.latest {
+		i, ok := cols[q.Column]
+		if !ok {
+			continue
+		}
+		c := s.cells[i]
+		if !slices.ContainsFunc(q.Where, func(p storage.Predicate) bool { return !p.Match(c.Body) }) {
+			cells = append(cells, c)
+		}
+	}
+	s.mu.RUnlock()
+	storage.SortQueryResults(cells, q)
+	if len(cells) > q.Limit {
+		cells = cells[:q.Limit]
+	}
+	return cells, nil
+}
+
+func (s *Store) GetRow(ctx context.Context, rowKey uuid.UUID) ([]cell.Cell, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.row(rowKey), nil
+}
+
+func (s *Store) GetRows(ctx context.Context, rowKeys []uuid.UUID) (map[uuid.UUID][]cell.Cell, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make(map[uuid.UUID][]cell.Cell, len(rowKeys))
+	for _, rowKey := range rowKeys {
+		if cells := s.row(rowKey); len(cells) > 0 {
+			out[rowKey] = cells
+		}
+	}
+	return out, nil
+}
+
+// row returns the latest cell of each column of a row, ordered by column
+// name. The caller holds s.mu.
+func (s *Store) row(rowKey uuid.UUID) []cell.Cell {
+	cols := s.latest[rowKey]
+	if len(cols) == 0 {
+		return nil
+	}
+	out := make([]cell.Cell, 0, len(cols))
+	for _, i := range cols {
+		out = append(out, s.cells[i])
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ColumnName < out[j].ColumnName })
+	return out
+}
+
+func (s *Store) PartitionRead(ctx context.Context, partitionNumber int, readType int, addedID int64, createdAfter time.Time, limit int) ([]cell.Cell, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	switch readType {
+	case storage.PartitionReadTypeCreatedAt:
+		// Cells are appended in (created_at, added_id) order, so the first
+		// one after the cursor starts the page.
+		i := sort.Search(len(s.cells), func(i int) bool {
+			c := s.cells[i]
+			return c.CreatedAt.After(createdAfter) || (addedID > 0 && c.CreatedAt.Equal(createdAfter) && c.AddedID > addedID)
+		})
+		return page(s.cells[i:], limit), nil
+	case storage.PartitionReadTypeAddedID:
+		return page(s.cells[min(max(addedID, 0), int64(len(s.cells))):], limit), nil
+	case storage.PartitionReadTypeCommitSeq:
+		// Writes commit in added_id order, so the log is the cells
+		// themselves.
+		out := page(s.cells[min(max(addedID, 0), int64(len(s.cells))):], limit)
+		for i := range out {
+			out[i].CommitSeq = out[i].AddedID
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("invalid read type: %d", readType)
+	}
+}
+
+func (s *Store) ScanCells(ctx context.Context, columnName string, afterAddedID int64, limit int) ([]cell.Cell, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []cell.Cell
+	for _, c := range s.cells[min(max(afterAddedID, 0), int64(len(s.cells))):] {
+		if len(out) == limit {
+			break
+		}
+		if c.ColumnName == columnName {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) ScanCellsWindow(ctx context.Context, columnName string, from, to time.Time, afterAddedID int64, limit int) ([]cell.Cell, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i := sort.Search(len(s.cells), func(i int) bool { return !s.cells[i].CreatedAt.Before(from) })
+	var out []cell.Cell
+	for _, c := range s.cells[i:] {
+		if len(out) == limit || !c.CreatedAt.Before(to) {
+			break
+		}
+		if c.ColumnName == columnName && (c.CreatedAt.After(from) || c.AddedID > afterAddedID) {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) Head(ctx context.Context) (storage.Head, error) {
+	if err := ctx.Err(); err != nil {
+		return storage.Head{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.cells) == 0 {
+		return storage.Head{}, nil
+	}
+	last := s.cells[len(s.cells)-1]
+	return storage.Head{AddedID: last.AddedID, CreatedAt: last.CreatedAt}, nil
+}
+
+// WaitHead implements storage.HeadWaiter: every write is seen.
+func (s *Store) WaitHead(ctx context.Context, afterAddedID int64) (int64, error) {
+	for {
+		s.mu.RLock()
+		head, moved := int64(len(s.cells)), s.moved
+		s.mu.RUnlock()
+		if head > afterAddedID {
+			return head, nil
+		}
+		select {
+		case <-moved:
+		case <-ctx.Done():
+			return head, ctx.Err()
+		}
+	}
+}
+
+// page returns at most limit of cells, copied so callers cannot alias the
+// store's slice.
+func page(cells []cell.Cell, limit int) []cell.Cell {
+	if limit >= 0 && len(cells) > limit {
+		cells = cells[:limit]
+	}
+	if len(cells) == 0 {
+		return nil
+	}
+	return slices.Clone(cells)
+}
@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/storetest"
+)
+
+var (
+	_ storage.CellStore  = (*Store)(nil)
+	_ storage.HeadWaiter = (*Store)(nil)
+)
+
+// newTestStore returns a Store whose clock advances a second per write.
+func newTestStore() *Store {
+	s := New()
+	t := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.SetClock(func() time.Time {
+		t = t.Add(time.Second)
+		return t
+	})
+	return s
+}
+
+func req(row uuid.UUID, column string, ref int64) cell.WriteCellRequest {
+	return cell.WriteCellRequest{RowKey: row, ColumnName: column, RefKey: ref, Body: json.RawMessage(`{}`)}
+}
+
+func TestStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(*testing.T) storage.CellStore { return New() })
+}
+
+func TestStore_ScanCellsWindowWithClock(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore()
+	row := uuid.New()
+	for i, column := range []string{"a", "b", "a", "a", "b"} {
+		s.WriteCell(ctx, req(row, column, int64(i))) //nolint:errcheck
+	}
+
+	// The window [from, to) holds added_ids 2 to 4, and only 2, created at
+	// from, is in column b.
+	from := time.Date(2026, 1, 1, 0, 0, 2, 0, time.UTC)
+	to := from.Add(3 * time.Second)
+	cells, _ := s.ScanCellsWindow(ctx, "a", from, to, 0, 10)
+	if len(cells) != 2 || cells[0].AddedID != 3 || cells[1].AddedID != 4 {
+		t.Errorf("ScanCellsWindow: got %+v, want added_ids 3 and 4", cells)
+	}
+	cells, _ = s.ScanCellsWindow(ctx, "b", from, to, 2, 10)
+	if len(cells) != 0 {
+		t.Errorf("ScanCellsWindow resumed past the only cell: got %+v", cells)
+	}
+}
+
+func TestStore_WaitHead(t *testing.T) {
+	s := newTestStore()
+	done := make(chan int64)
+	go func() {
+		head, _ := s.WaitHead(context.Background(), 0)
+		done <- head
+	}()
+	s.WriteCell(context.Background(), req(uuid.New(), "a", 1)) //nolint:errcheck
+	select {
+	case head := <-done:
+		if head != 1 {
+			t.Errorf("WaitHead: got %d, want 1", head)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WaitHead was not woken by a write")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := s.WaitHead(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitHead without writes: got %v, want DeadlineExceeded", err)
+	}
+}
@@ -4,11 +4,56 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// RunMigrationsForPool creates shard cell tables for the given range
-func RunMigrationsForPool(ctx context.Context, pool *pgxpool.Pool, shardStart, shardEnd int) error {
+// migrationLockKey is the PostgreSQL advisory lock key held while migrating a
+// backend, so pods started together apply DDL one at a time instead of racing.
+const migrationLockKey int64 = 0x6d657a7a616e696e // "mezzanin"
+
+// DB runs statements: a pool, or the connection holding the migration lock
+// that WithMigrationLock passes to its fn.
+type DB interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// WithMigrationLock runs fn while holding a session-level advisory lock on
+// pool's database. Concurrent callers block until the lock is released or
+// ctx is cancelled. fn is given the connection holding the lock to run its
+// DDL on, so migrating needs a single connection from pool.
+func WithMigrationLock(ctx context.Context, pool *pgxpool.Pool, fn func(db DB) error) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("acquire migration lock connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		// Use a fresh context so the lock is released even if ctx was cancelled.
+		if _, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey); err != nil {
+			// Drop the connection so the session (and its lock) ends.
+			conn.Conn().Close(context.Background())
+		}
+	}()
+
+	return fn(conn)
+}
+
+// RunMigrationsForPool creates shard cell tables for the given range, with
+// added_id drawn through mezzanine_next_added_id (see fence.go), and the
+// shards' alias, tag and idempotency key tables.
+func RunMigrationsForPool(ctx context.Context, db DB, shardStart, shardEnd int) error {
+	if err := CreateNextAddedIDFunction(ctx, db); err != nil {
+		return err
+	}
 	for i := shardStart; i <= shardEnd; i++ {
 		table := ShardTable(i)
 		ddl := fmt.Sprintf(`
@@ -19,6 +64,7 @@ func RunMigrationsForPool(ctx context.Context, pool *pgxpool.Pool, shardStart, s
 				ref_key     BIGINT NOT NULL,
 				body        JSONB NOT NULL,
 				created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+				data        BYTEA,
 
 				CONSTRAINT uq_%s_ref UNIQUE (row_key, column_name, ref_key)
 			);
@@ -33,16 +79,106 @@ func RunMigrationsForPool(ctx context.Context, pool *pgxpool.Pool, shardStart, s
 				ON %s (column_name, created_at);
 		`, table, table, table, table, table, table, table, table)
 
-		if _, err := pool.Exec(ctx, ddl); err != nil {
+		if _, err := db.Exec(ctx, ddl); err != nil {
 			return fmt.Errorf("migrate shard %d: %w", i, err)
 		}
+		if _, err := db.Exec(ctx, fmt.Sprintf(addedIDDefault, table)); err != nil {
+			return fmt.Errorf("migrate shard %d added_id default: %w", i, err)
+		}
+		if _, err := db.Exec(ctx, fmt.Sprintf(dataColumn, table)); err != nil {
+			return fmt.Errorf("migrate shard %d data column: %w", i, err)
+		}
+		if _, err := db.Exec(ctx, fmt.Sprintf(aliasTable, AliasTable(i))); err != nil {
+			return fmt.Errorf("migrate shard %d alias table: %w", i, err)
+		}
+		if _, err := db.Exec(ctx, fmt.Sprintf(tagTable, TagTable(i))); err != nil {
+			return fmt.Errorf("migrate shard %d tag table: %w", i, err)
+		}
+		if _, err := db.Exec(ctx, fmt.Sprintf(idempotencyTable, IdempotencyTable(i))); err != nil {
+			return fmt.Errorf("migrate shard %d idempotency key table: %w", i, err)
+		}
 	}
 
 	return nil
 }
 
-// RunPluginMigration creates the plugins table for persistent trigger plugin storage.
-func RunPluginMigration(ctx context.Context, pool *pgxpool.Pool) error {
+// addedIDDefault points a shard table's added_id at mezzanine_next_added_id,
+// unless it already is, so existing tables are not locked on every start.
+const addedIDDefault = `
+	DO $do$
+	DECLARE
+		tbl regclass := '%s';
+	BEGIN
+		IF NOT EXISTS (
+			SELECT 1
+			FROM pg_attrdef d
+			JOIN pg_attribute a ON a.attrelid = d.adrelid AND a.attnum = d.adnum
+			WHERE d.adrelid = tbl AND a.attname = 'added_id'
+				AND pg_get_expr(d.adbin, d.adrelid) LIKE 'mezzanine_next_added_id(%%'
+		) THEN
+			EXECUTE format('ALTER TABLE %%s ALTER COLUMN added_id SET DEFAULT mezzanine_next_added_id(%%L)',
+				tbl, pg_get_serial_sequence(tbl::text, 'added_id'));
+		END IF;
+	END
+	$do$
+`
+
+// dataColumn adds the data column, which holds the bytes of binary cells, to
+// a shard table created before it existed, unless it already has it, so
+// existing tables are not locked on every start.
+const dataColumn = `
+	DO $do$
+	BEGIN
+		IF NOT EXISTS (
+			SELECT 1 FROM pg_attribute
+			WHERE attrelid = '%[1]s'::regclass AND attname = 'data' AND NOT attisdropped
+		) THEN
+			ALTER TABLE %[1]s ADD COLUMN data BYTEA;
+		END IF;
+	END
+	$do$
+`
+
+// aliasTable holds the aliases that hash to a shard (see shard.ForKey); the
+// rows they name are usually on other shards.
+const aliasTable = `
+	CREATE TABLE IF NOT EXISTS %s (
+		alias      TEXT PRIMARY KEY,
+		row_key    UUID NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)
+`
+
+// tagTable indexes the tags of a shard's rows, which are kept in their
+// metadata cells: the primary key lists a tag's rows, the row_key index a
+// row's tags.
+const tagTable = `
+	CREATE TABLE IF NOT EXISTS %[1]s (
+		tag     TEXT NOT NULL,
+		row_key UUID NOT NULL,
+		PRIMARY KEY (tag, row_key)
+	);
+	CREATE INDEX IF NOT EXISTS idx_%[1]s_row_key ON %[1]s (row_key)
+`
+
+// idempotencyTable remembers the Idempotency-Keys of the writes to a shard
+// with a hash of their requests; the created_at index finds expired keys.
+const idempotencyTable = `
+	CREATE TABLE IF NOT EXISTS %[1]s (
+		idempotency_key TEXT PRIMARY KEY,
+		request_hash    BYTEA NOT NULL,
+		created_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	CREATE INDEX IF NOT EXISTS idx_%[1]s_created_at ON %[1]s (created_at)
+`
+
+// RunPluginMigration creates the plugins table for persistent trigger plugin
+// storage, with each plugin's poison policy, the streams table of named
+// cell selections plugins subscribe to (see internal/stream), and the
+// trigger_checkpoints table recording each plugin's oldest undelivered cell
+// per shard, and handler_checkpoints, the same for internal trigger
+// handlers such as materialized views.
+func RunPluginMigration(ctx context.Context, db DB) error {
 	ddl := `
 		CREATE TABLE IF NOT EXISTS plugins (
 			id                UUID PRIMARY KEY,
@@ -50,15 +186,180 @@ func RunPluginMigration(ctx context.Context, pool *pgxpool.Pool) error {
 			endpoint          TEXT NOT NULL,
 			subscribed_columns TEXT[] NOT NULL,
 			status            TEXT NOT NULL DEFAULT 'active',
-			created_at        TIMESTAMPTZ NOT NULL DEFAULT now()
+			created_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+			poison_policy     TEXT NOT NULL DEFAULT 'block',
+			max_attempts      INT NOT NULL DEFAULT 0
+		);
+		ALTER TABLE plugins ADD COLUMN IF NOT EXISTS poison_policy TEXT NOT NULL DEFAULT 'block';
+		ALTER TABLE plugins ADD COLUMN IF NOT EXISTS max_attempts INT NOT NULL DEFAULT 0;
+		ALTER TABLE plugins ADD COLUMN IF NOT EXISTS subscribed_streams TEXT[] NOT NULL DEFAULT '{}';
+		ALTER TABLE plugins ADD COLUMN IF NOT EXISTS encoding TEXT NOT NULL DEFAULT 'json';
+		ALTER TABLE plugins ADD COLUMN IF NOT EXISTS after TEXT NOT NULL DEFAULT '';
+		ALTER TABLE plugins ADD COLUMN IF NOT EXISTS writable_columns TEXT[] NOT NULL DEFAULT '{}';
+		ALTER TABLE plugins ADD COLUMN IF NOT EXISTS synchronous_columns TEXT[] NOT NULL DEFAULT '{}';
+		CREATE TABLE IF NOT EXISTS streams (
+			name        TEXT PRIMARY KEY,
+			columns     TEXT[] NOT NULL,
+			filters     TEXT[] NOT NULL DEFAULT '{}',
+			description TEXT NOT NULL DEFAULT '',
+			created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+		CREATE TABLE IF NOT EXISTS trigger_checkpoints (
+			plugin_id  UUID NOT NULL REFERENCES plugins (id) ON DELETE CASCADE,
+			shard_id   INT NOT NULL,
+			added_id   BIGINT NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (plugin_id, shard_id)
+		);
+		CREATE TABLE IF NOT EXISTS handler_checkpoints (
+			handler    TEXT NOT NULL,
+			shard_id   INT NOT NULL,
+			added_id   BIGINT NOT NULL,
+			columns    TEXT[] NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (handler, shard_id)
 		);
 	`
-	if _, err := pool.Exec(ctx, ddl); err != nil {
+	if _, err := db.Exec(ctx, ddl); err != nil {
 		return fmt.Errorf("migrate plugins table: %w", err)
 	}
 	return nil
 }
 
+// RunColumnMigration creates the column_registry table that backs the
+// column registry (see internal/column) and the column_schemas table of
+// registered schema versions (see internal/schema).
+func RunColumnMigration(ctx context.Context, db DB) error {
+	ddl := `
+		CREATE TABLE IF NOT EXISTS column_registry (
+			name            TEXT PRIMARY KEY,
+			owner           TEXT NOT NULL DEFAULT '',
+			description     TEXT NOT NULL DEFAULT '',
+			schema_ref      TEXT NOT NULL DEFAULT '',
+			keep_versions   INT NOT NULL DEFAULT 0,
+			writes          BIGINT NOT NULL DEFAULT 0,
+			last_written_at TIMESTAMPTZ,
+			created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+			updated_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+		ALTER TABLE column_registry ADD COLUMN IF NOT EXISTS keep_versions INT NOT NULL DEFAULT 0;
+		ALTER TABLE column_registry ADD COLUMN IF NOT EXISTS written_bytes BIGINT NOT NULL DEFAULT 0;
+		ALTER TABLE column_registry ADD COLUMN IF NOT EXISTS stored_cells BIGINT NOT NULL DEFAULT 0;
+		ALTER TABLE column_registry ADD COLUMN IF NOT EXISTS stored_bytes BIGINT NOT NULL DEFAULT 0;
+		ALTER TABLE column_registry ADD COLUMN IF NOT EXISTS usage_counted_at TIMESTAMPTZ;
+		CREATE TABLE IF NOT EXISTS column_schemas (
+			column_name TEXT NOT NULL,
+			version     INT NOT NULL,
+			document    JSONB NOT NULL,
+			created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (column_name, version)
+		);
+	`
+	if _, err := db.Exec(ctx, ddl); err != nil {
+		return fmt.Errorf("migrate column registry table: %w", err)
+	}
+	return nil
+}
+
+// RunFenceMigration creates the write_fences table that backs write
+// fences (see internal/fence).
+func RunFenceMigration(ctx context.Context, db DB) error {
+	ddl := `
+		CREATE TABLE IF NOT EXISTS write_fences (
+			column_name         TEXT NOT NULL DEFAULT '',
+			shard_id            INT NOT NULL DEFAULT -1,
+			reason              TEXT NOT NULL DEFAULT '',
+			retry_after_seconds INT NOT NULL DEFAULT 0,
+			expires_at          TIMESTAMPTZ,
+			created_at          TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (column_name, shard_id)
+		);
+	`
+	if _, err := db.Exec(ctx, ddl); err != nil {
+		return fmt.Errorf("migrate write fences table: %w", err)
+	}
+	return nil
+}
+
+// RunShardLeaseMigration creates the shard lease tables used to divide
+// per-shard background work among instances (see internal/lease), with one
+// lease row per shard.
+func RunShardLeaseMigration(ctx context.Context, db DB, numShards int) error {
+	ddl := `
+		CREATE TABLE IF NOT EXISTS shard_lease_members (
+			node       TEXT PRIMARY KEY,
+			expires_at TIMESTAMPTZ NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS shard_leases (
+			shard_id   INT PRIMARY KEY,
+			owner      TEXT NOT NULL DEFAULT '',
+			expires_at TIMESTAMPTZ NOT NULL DEFAULT 'epoch'
+		);
+	`
+	if _, err := db.Exec(ctx, ddl); err != nil {
+		return fmt.Errorf("migrate shard lease tables: %w", err)
+	}
+	if _, err := db.Exec(ctx, `
+		INSERT INTO shard_leases (shard_id) SELECT generate_series(0, $1 - 1)
+		ON CONFLICT (shard_id) DO NOTHING
+	`, numShards); err != nil {
+		return fmt.Errorf("create shard leases: %w", err)
+	}
+	return nil
+}
+
+// RunReplicationMigration creates the table holding each shard's position
+// in every replication stream (see internal/replication).
+func RunReplicationMigration(ctx context.Context, db DB) error {
+	return runCheckpointMigration(ctx, db, ReplicationCheckpoints)
+}
+
+// RunExportMigration creates the table holding each shard's position in
+// every export to object storage (see internal/export).
+func RunExportMigration(ctx context.Context, db DB) error {
+	return runCheckpointMigration(ctx, db, ExportCheckpoints)
+}
+
+// runCheckpointMigration creates a checkpoint table, as PostgresCheckpoints
+// uses it.
+func runCheckpointMigration(ctx context.Context, db DB, table string) error {
+	ddl := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			name       TEXT NOT NULL,
+			shard_id   INT NOT NULL,
+			added_id   BIGINT NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (name, shard_id)
+		);
+	`, table)
+	if _, err := db.Exec(ctx, ddl); err != nil {
+		return fmt.Errorf("migrate %s table: %w", table, err)
+	}
+	return nil
+}
+
+// RunSearchMigration creates the table holding each shard's position in
+// every search indexer (see internal/search).
+func RunSearchMigration(ctx context.Context, db DB) error {
+	return runCheckpointMigration(ctx, db, SearchCheckpoints)
+}
+
+// AliasTable returns the alias table name for a given shard number.
+func AliasTable(shardID int) string {
+	return ShardTable(shardID) + "_aliases"
+}
+
+// TagTable returns the row tag table name for a given shard number.
+func TagTable(shardID int) string {
+	return ShardTable(shardID) + "_tags"
+}
+
+// IdempotencyTable returns the idempotency key table name for a given shard
+// number.
+func IdempotencyTable(shardID int) string {
+	return ShardTable(shardID) + "_idempotency"
+}
+
 // ShardTable returns the table name for a given shard number.
 func ShardTable(shardID int) string {
 	return fmt.Sprintf("cells_%04d", shardID)
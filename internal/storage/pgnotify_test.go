@@ -0,0 +1,65 @@
+package storage_test
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/ryanbastic/go-mezzanine/internal/cache"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// TestPGNotifier_Listen runs the cache invalidation listener against the
+// test database and broadcasts to it from another instance's notifier.
+func TestPGNotifier_Listen(t *testing.T) {
+	pools := map[string]*pgxpool.Pool{"primary": storage.Pool()}
+	backendFor := func(int) string { return "primary" }
+	logger := slog.New(slog.DiscardHandler)
+	listener := cache.NewPGNotifier(pools, backendFor, logger)
+	sender := cache.NewPGNotifier(pools, backendFor, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		listener.Listen(ctx, cache.New(cache.Options{MaxBytes: 1 << 20}))
+	}()
+
+	// The listener subscribes asynchronously, so broadcast until one of
+	// the invalidations arrives.
+	before := remoteInvalidations(t)
+	deadline := time.Now().Add(10 * time.Second)
+	for remoteInvalidations(t) == before {
+		if time.Now().After(deadline) {
+			t.Fatal("listener received no invalidation")
+		}
+		sender.Broadcast(ctx, shard.ID(0), []cache.Invalidation{{RowKey: uuid.New(), ColumnName: "a"}})
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Listen did not return after cancellation")
+	}
+}
+
+func remoteInvalidations(t *testing.T) float64 {
+	t.Helper()
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, mf := range metrics {
+		if mf.GetName() == "mezzanine_cache_remote_invalidations_total" {
+			return mf.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	return 0
+}
@@ -1,13 +1,19 @@
 package storage
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
+	"math"
+	"net"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/ryanbastic/go-mezzanine/internal/cell"
 )
@@ -15,8 +21,12 @@ import (
 // PostgresStore implements CellStore for a single shard using PostgreSQL.
 type PostgresStore struct {
 	pool         *pgxpool.Pool
-	table        string
+	q            shardQueries
 	queryTimeout time.Duration
+	latestTable  bool
+	commitLog    bool
+	written      *headSignal
+	fence        *addedIDFence
 }
 
 // NewPostgresStore creates a CellStore backed by a specific shard table.
@@ -24,52 +34,475 @@ type PostgresStore struct {
 func NewPostgresStore(pool *pgxpool.Pool, shardID int, queryTimeout time.Duration) *PostgresStore {
 	return &PostgresStore{
 		pool:         pool,
-		table:        ShardTable(shardID),
+		q:            newShardQueries(ShardTable(shardID)),
 		queryTimeout: queryTimeout,
+		written:      newHeadSignal(),
+		fence:        &addedIDFence{},
 	}
 }
 
-// withTimeout derives a child context with the configured query timeout.
-// If queryTimeout is zero, the parent context is returned unchanged.
-func (s *PostgresStore) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
-	if s.queryTimeout > 0 {
-		return context.WithTimeout(ctx, s.queryTimeout)
+// UseLatestTable serves GetCellLatest and GetRow (and StreamRow) from the
+// shard's latest-cells table instead of the version history. The table must
+// have been created with RunLatestCellsMigration. Call it before the store
+// is used.
+func (s *PostgresStore) UseLatestTable(enabled bool) {
+	s.latestTable = enabled
+}
+
+// UseCommitLog serves PartitionRead with PartitionReadTypeCommitSeq from
+// the shard's commit log. The log must have been created with
+// RunCommitLogMigration. Call it before the store is used.
+func (s *PostgresStore) UseCommitLog(enabled bool) {
+	s.commitLog = enabled
+}
+
+// StatementsPerShard is the number of distinct statements a PostgresStore
+// issues. pgx prepares each statement once per connection and caches it by
+// its SQL text (QueryExecModeCacheStatement, the default), so a backend
+// needs a statement cache of about StatementsPerShard per shard it serves to
+// avoid re-preparing hot queries; see StatementCacheCapacity.
+const StatementsPerShard = 32
+
+// StatementCacheCapacity returns a per-connection statement cache size for
+// a backend serving numShards shards, with headroom for index and plugin
+// queries.
+func StatementCacheCapacity(numShards int) int {
+	return numShards*StatementsPerShard + 128
+}
+
+// SessionTimeouts returns a pgxpool AfterConnect hook that sets
+// statement_timeout and idle_in_transaction_session_timeout on each new
+// connection, or nil if both are zero. The database then cancels runaway
+// queries and ends abandoned transactions itself, even on a path that
+// misses its context deadline.
+func SessionTimeouts(statement, idleInTransaction time.Duration) func(context.Context, *pgx.Conn) error {
+	if statement <= 0 && idleInTransaction <= 0 {
+		return nil
+	}
+	return func(ctx context.Context, conn *pgx.Conn) error {
+		for _, p := range []struct {
+			name string
+			d    time.Duration
+		}{
+			{"statement_timeout", statement},
+			{"idle_in_transaction_session_timeout", idleInTransaction},
+		} {
+			if p.d <= 0 {
+				continue
+			}
+			ms := strconv.FormatInt(max(p.d.Milliseconds(), 1), 10)
+			if _, err := conn.Exec(ctx, "SELECT set_config($1, $2, false)", p.name, ms); err != nil {
+				return fmt.Errorf("set %s: %w", p.name, err)
+			}
+		}
+		return nil
+	}
+}
+
+// WithoutStatementTimeout runs fn in a transaction on pool with
+// statement_timeout off, for maintenance queries that take as long as the
+// table needs on a pool whose connections cap statements (see
+// SessionTimeouts).
+func WithoutStatementTimeout(ctx context.Context, pool *pgxpool.Pool, fn func(tx pgx.Tx) error) error {
+	return pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "SET LOCAL statement_timeout = 0"); err != nil {
+			return fmt.Errorf("disable statement timeout: %w", err)
+		}
+		return fn(tx)
+	})
+}
+
+// shardQueries holds a shard's SQL, built once so every call sends the same
+// text and hits the connection's prepared statement cache.
+type shardQueries struct {
+	writeCell          string
+	writeCells         string
+	writeBlob          string
+	lockCell           string
+	getCell            string
+	getCellLatest      string
+	getBlob            string
+	getBlobLatest      string
+	getRow             string
+	getRowColumns      string
+	latestCell         string
+	latestRow          string
+	latestRowColumns   string
+	getRows            string
+	latestRows         string
+	probeCell          string
+	probeRow           string
+	latestProbeCell    string
+	latestProbeRow     string
+	scanCells          string
+	scanCellsWindow    string
+	partitionCreatedAt string
+	partitionAddedID   string
+	partitionCommitSeq string
+	scanCommitLog      string
+	commitLogFloor     string
+	lastAddedID        string
+	head               string
+	putAlias           string
+	getAlias           string
+	deleteAlias        string
+	listAliases        string
+	setRowTags         string
+	rowsByTag          string
+	recordIdempotency  string
+	idempotencyHash    string
+	// queryFrom and queryLatestFrom select a column's latest cells for
+	// QueryCells, whose conditions vary.
+	queryFrom       string
+	queryLatestFrom string
+}
+
+func newShardQueries(table string) shardQueries {
+	latest, log, aliases, tags, keys := table+"_latest", table+"_log", table+"_aliases", table+"_tags", table+"_idempotency"
+	return shardQueries{
+		writeCell: fmt.Sprintf(`
+			INSERT INTO %s (row_key, column_name, ref_key, body)
+			VALUES ($1, $2, $3, $4)
+			RETURNING added_id, row_key, column_name, ref_key, body, created_at
+		`, table),
+		// A single statement is atomic; WITH ORDINALITY keeps request order so
+		// added_ids are assigned in the order the caller supplied.
+		writeCells: fmt.Sprintf(`
+			INSERT INTO %s (row_key, column_name, ref_key, body)
+			SELECT row_key, column_name, ref_key, body::jsonb
+			FROM unnest($1::uuid[], $2::text[], $3::bigint[], $4::text[])
+				WITH ORDINALITY AS b(row_key, column_name, ref_key, body, ord)
+			ORDER BY ord
+			RETURNING added_id, row_key, column_name, ref_key, body, created_at
+		`, table),
+		writeBlob: fmt.Sprintf(`
+			INSERT INTO %s (row_key, column_name, ref_key, body, data)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING added_id, row_key, column_name, ref_key, body, created_at
+		`, table),
+		// The two-key form keeps these locks apart from single-key ones
+		// such as leader election's.
+		lockCell: fmt.Sprintf(`
+			SELECT pg_advisory_xact_lock(hashtext('%s'), hashtext($1::text || '/' || $2))
+		`, table),
+		getCell: fmt.Sprintf(`
+			SELECT added_id, row_key, column_name, ref_key, body, created_at
+			FROM %s
+			WHERE row_key = $1 AND column_name = $2 AND ref_key = $3
+		`, table),
+		getCellLatest: fmt.Sprintf(`
+			SELECT added_id, row_key, column_name, ref_key, body, created_at
+			FROM %s
+			WHERE row_key = $1 AND column_name = $2
+			ORDER BY ref_key DESC
+			LIMIT 1
+		`, table),
+		getBlob: fmt.Sprintf(`
+			SELECT added_id, row_key, column_name, ref_key, body, created_at, data
+			FROM %s
+			WHERE row_key = $1 AND column_name = $2 AND ref_key = $3
+		`, table),
+		getBlobLatest: fmt.Sprintf(`
+			SELECT added_id, row_key, column_name, ref_key, body, created_at, data
+			FROM %s
+			WHERE row_key = $1 AND column_name = $2
+			ORDER BY ref_key DESC
+			LIMIT 1
+		`, table),
+		getRow: fmt.Sprintf(`
+			SELECT DISTINCT ON (column_name)
+				added_id, row_key, column_name, ref_key, body, created_at
+			FROM %s
+			WHERE row_key = $1
+			ORDER BY column_name, ref_key DESC
+		`, table),
+		getRowColumns: fmt.Sprintf(`
+			SELECT DISTINCT ON (column_name)
+				added_id, row_key, column_name, ref_key, body, created_at
+			FROM %s
+			WHERE row_key = $1 AND column_name = ANY($2)
+			ORDER BY column_name, ref_key DESC
+		`, table),
+		latestCell: fmt.Sprintf(`
+			SELECT added_id, row_key, column_name, ref_key, body, created_at
+			FROM %s
+			WHERE row_key = $1 AND column_name = $2
+		`, latest),
+		latestRow: fmt.Sprintf(`
+			SELECT added_id, row_key, column_name, ref_key, body, created_at
+			FROM %s
+			WHERE row_key = $1
+			ORDER BY column_name
+		`, latest),
+		latestRowColumns: fmt.Sprintf(`
+			SELECT added_id, row_key, column_name, ref_key, body, created_at
+			FROM %s
+			WHERE row_key = $1 AND column_name = ANY($2)
+			ORDER BY column_name
+		`, latest),
+		getRows: fmt.Sprintf(`
+			SELECT DISTINCT ON (row_key, column_name)
+				added_id, row_key, column_name, ref_key, body, created_at
+			FROM %s
+			WHERE row_key = ANY($1)
+			ORDER BY row_key, column_name, ref_key DESC
+		`, table),
+		latestRows: fmt.Sprintf(`
+			SELECT added_id, row_key, column_name, ref_key, body, created_at
+			FROM %s
+			WHERE row_key = ANY($1)
+			ORDER BY row_key, column_name
+		`, latest),
+		probeCell: fmt.Sprintf(`
+			SELECT added_id, ref_key, created_at
+			FROM %s
+			WHERE row_key = $1 AND column_name = $2
+			ORDER BY ref_key DESC
+			LIMIT 1
+		`, table),
+		probeRow: fmt.Sprintf(`
+			SELECT count(DISTINCT column_name), COALESCE(max(created_at), 'epoch')
+			FROM %s
+			WHERE row_key = $1 AND ($2 OR left(column_name, length($3::text)) <> $3::text)
+		`, table),
+		latestProbeCell: fmt.Sprintf(`
+			SELECT added_id, ref_key, created_at
+			FROM %s
+			WHERE row_key = $1 AND column_name = $2
+		`, latest),
+		latestProbeRow: fmt.Sprintf(`
+			SELECT count(*), COALESCE(max(created_at), 'epoch')
+			FROM %s
+			WHERE row_key = $1 AND ($2 OR left(column_name, length($3::text)) <> $3::text)
+		`, latest),
+		scanCells: fmt.Sprintf(`
+			SELECT added_id, row_key, column_name, ref_key, body, created_at
+			FROM %s
+			WHERE column_name = $1 AND added_id > $2 AND added_id <= $3
+			ORDER BY added_id ASC
+			LIMIT $4
+		`, table),
+		// created_at >= $2 bounds the range on the (column_name, created_at)
+		// index; the row comparison resumes within a timestamp.
+		scanCellsWindow: fmt.Sprintf(`
+			SELECT added_id, row_key, column_name, ref_key, body, created_at
+			FROM %s
+			WHERE column_name = $1 AND created_at >= $2 AND created_at < $3
+				AND (created_at, added_id) > ($2, $4)
+			ORDER BY created_at ASC, added_id ASC
+			LIMIT $5
+		`, table),
+		// TODO FIXME $1::timestamp ?
+		// As in scanCellsWindow, created_at >= $1 bounds the range on the
+		// created_at index; the row comparison resumes within a timestamp.
+		partitionCreatedAt: fmt.Sprintf(`
+			SELECT added_id, row_key, column_name, ref_key, body, created_at
+			FROM %s
+			WHERE created_at >= $1 AND (created_at, added_id) > ($1, $2)
+			ORDER BY created_at ASC, added_id ASC
+			LIMIT $3
+		`, table),
+		partitionAddedID: fmt.Sprintf(`
+			SELECT added_id, row_key, column_name, ref_key, body, created_at
+			FROM %s
+			WHERE added_id > $1 AND added_id <= $2
+			ORDER BY added_id ASC
+			LIMIT $3
+		`, table),
+		partitionCommitSeq: fmt.Sprintf(`
+			SELECT l.seq, c.added_id, c.row_key, c.column_name, c.ref_key, c.body, c.created_at
+			FROM %s l
+			JOIN %s c ON c.added_id = l.added_id
+			WHERE l.seq > $1
+			ORDER BY l.seq ASC
+			LIMIT $2
+		`, log, table),
+		scanCommitLog: fmt.Sprintf(`
+			SELECT l.seq, c.added_id, c.row_key, c.column_name, c.ref_key, c.body, c.created_at
+			FROM %s l
+			JOIN %s c ON c.added_id = l.added_id
+			WHERE l.added_id >= $1 AND l.seq > $2
+			ORDER BY l.seq ASC
+			LIMIT $3
+		`, log, table),
+		commitLogFloor: fmt.Sprintf(`
+			SELECT coalesce(min(added_id), 0) FROM %s WHERE added_id >= $1 AND seq > $2
+		`, log),
+		lastAddedID: fmt.Sprintf(`
+			SELECT coalesce(pg_sequence_last_value(pg_get_serial_sequence('%s', 'added_id')::regclass), 0)
+		`, table),
+		head: fmt.Sprintf(`
+			SELECT added_id, created_at FROM %s WHERE added_id <= $1 ORDER BY added_id DESC LIMIT 1
+		`, table),
+		// The no-op update returns the alias when it already names the
+		// row, waiting out a concurrent insert; when it names another row
+		// nothing is returned.
+		putAlias: fmt.Sprintf(`
+			INSERT INTO %[1]s AS a (alias, row_key)
+			VALUES ($1, $2)
+			ON CONFLICT (alias) DO UPDATE SET row_key = EXCLUDED.row_key
+				WHERE a.row_key = EXCLUDED.row_key
+			RETURNING alias, row_key, created_at
+		`, aliases),
+		getAlias: fmt.Sprintf(`
+			SELECT alias, row_key, created_at FROM %s WHERE alias = $1
+		`, aliases),
+		deleteAlias: fmt.Sprintf(`
+			DELETE FROM %s WHERE alias = $1
+		`, aliases),
+		listAliases: fmt.Sprintf(`
+			SELECT alias, row_key, created_at FROM %s WHERE alias > $1 ORDER BY alias LIMIT $2
+		`, aliases),
+		// One statement, so a row's tags are replaced atomically.
+		setRowTags: fmt.Sprintf(`
+			WITH removed AS (
+				DELETE FROM %[1]s WHERE row_key = $1 AND tag <> ALL($2::text[])
+			)
+			INSERT INTO %[1]s (tag, row_key)
+			SELECT unnest($2::text[]), $1
+			ON CONFLICT DO NOTHING
+		`, tags),
+		rowsByTag: fmt.Sprintf(`
+			SELECT row_key FROM %s WHERE tag = $1 AND row_key > $2 ORDER BY row_key LIMIT $3
+		`, tags),
+		// Each write recording a key deletes a few expired ones, so the
+		// table holds about a TTL's worth of keys without a sweeper. An
+		// expired key is recorded again as if new.
+		recordIdempotency: fmt.Sprintf(`
+			WITH expired AS (
+				DELETE FROM %[1]s WHERE idempotency_key IN (
+					SELECT idempotency_key FROM %[1]s
+					WHERE created_at < now() - $3::interval AND idempotency_key <> $1
+					ORDER BY created_at LIMIT 4
+				)
+			)
+			INSERT INTO %[1]s AS k (idempotency_key, request_hash)
+			VALUES ($1, $2)
+			ON CONFLICT (idempotency_key) DO UPDATE
+				SET request_hash = EXCLUDED.request_hash, created_at = now()
+				WHERE k.created_at < now() - $3::interval
+		`, keys),
+		idempotencyHash: fmt.Sprintf(`
+			SELECT request_hash FROM %s WHERE idempotency_key = $1 AND created_at >= now() - $2::interval
+		`, keys),
+		queryFrom: fmt.Sprintf(`(
+			SELECT DISTINCT ON (row_key) added_id, row_key, column_name, ref_key, body, created_at
+			FROM %s WHERE column_name = $1
+			ORDER BY row_key, ref_key DESC
+		) c`, table),
+		queryLatestFrom: latest,
 	}
-	return ctx, func() {}
+}
+
+// withTimeout bounds a query by the configured query timeout and the
+// caller's deadline, whichever comes first; a per-endpoint request budget
+// replaces the query timeout (see QueryContext).
+func (s *PostgresStore) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return QueryContext(ctx, s.queryTimeout)
 }
 
 func (s *PostgresStore) WriteCell(ctx context.Context, req cell.WriteCellRequest) (*cell.Cell, error) {
 	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 
-	query := fmt.Sprintf(`
-		INSERT INTO %s (row_key, column_name, ref_key, body)
-		VALUES ($1, $2, $3, $4)
-		RETURNING added_id, row_key, column_name, ref_key, body, created_at
-	`, s.table)
-
 	var c cell.Cell
-	err := s.pool.QueryRow(ctx, query,
+	err := s.pool.QueryRow(ctx, s.q.writeCell,
 		req.RowKey, req.ColumnName, req.RefKey, req.Body,
 	).Scan(&c.AddedID, &c.RowKey, &c.ColumnName, &c.RefKey, &c.Body, &c.CreatedAt)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("write cell: %w", ErrCellExists)
+		}
 		return nil, fmt.Errorf("write cell: %w", err)
 	}
+	s.written.advance(c.AddedID)
 	return &c, nil
 }
 
-func (s *PostgresStore) GetCell(ctx context.Context, ref cell.CellRef) (*cell.Cell, error) {
+func (s *PostgresStore) WriteCells(ctx context.Context, reqs []cell.WriteCellRequest) ([]cell.Cell, error) {
+	if len(reqs) == 0 {
+		return nil, nil
+	}
 	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 
-	query := fmt.Sprintf(`
-		SELECT added_id, row_key, column_name, ref_key, body, created_at
-		FROM %s
-		WHERE row_key = $1 AND column_name = $2 AND ref_key = $3
-	`, s.table)
+	rowKeys := make([]uuid.UUID, len(reqs))
+	columns := make([]string, len(reqs))
+	refKeys := make([]int64, len(reqs))
+	bodies := make([]string, len(reqs))
+	for i, req := range reqs {
+		rowKeys[i], columns[i], refKeys[i], bodies[i] = req.RowKey, req.ColumnName, req.RefKey, string(req.Body)
+	}
+
+	rows, err := s.pool.Query(ctx, s.q.writeCells, rowKeys, columns, refKeys, bodies)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("write cells: %w", ErrCellExists)
+		}
+		return nil, fmt.Errorf("write cells: %w", err)
+	}
+	defer rows.Close()
+
+	cells := make([]cell.Cell, 0, len(reqs))
+	for rows.Next() {
+		var c cell.Cell
+		if err := rows.Scan(&c.AddedID, &c.RowKey, &c.ColumnName, &c.RefKey, &c.Body, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan written cell: %w", err)
+		}
+		cells = append(cells, c)
+	}
+	if err := rows.Err(); err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("write cells: %w", ErrCellExists)
+		}
+		return nil, fmt.Errorf("write cells: %w", err)
+	}
+	// RETURNING order is not guaranteed; added_id follows insertion order.
+	slices.SortFunc(cells, func(a, b cell.Cell) int { return cmp.Compare(a.AddedID, b.AddedID) })
+	if len(cells) > 0 {
+		s.written.advance(cells[len(cells)-1].AddedID)
+	}
+	return cells, nil
+}
+
+// isUniqueViolation reports whether err is a PostgreSQL unique_violation (23505).
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// IsTransient reports whether err is a failure of the database rather than
+// of the request: a lost or refused connection, a query timeout (including
+// statement_timeout), too many connections, a serialization failure or
+// deadlock, or a server shutting down. The same request may succeed if it
+// is repeated.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, ErrCellExists) || errors.Is(err, ErrCellNotFound) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code[:min(2, len(pgErr.Code))] {
+		case "08", "53": // connection_exception, insufficient_resources
+			return true
+		}
+		switch pgErr.Code {
+		case "40001", "40P01", "57014", "57P01", "57P02", "57P03": // serialization_failure, deadlock_detected, query_canceled, shutdowns, cannot_connect_now
+			return true
+		}
+		return false
+	}
+	var connErr *pgconn.ConnectError
+	var netErr net.Error
+	return errors.As(err, &connErr) || errors.As(err, &netErr) || pgconn.SafeToRetry(err) || pgconn.Timeout(err)
+}
+
+func (s *PostgresStore) GetCell(ctx context.Context, ref cell.CellRef) (*cell.Cell, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
 	var c cell.Cell
-	err := s.pool.QueryRow(ctx, query, ref.RowKey, ref.ColumnName, ref.RefKey).
+	err := s.pool.QueryRow(ctx, s.q.getCell, ref.RowKey, ref.ColumnName, ref.RefKey).
 		Scan(&c.AddedID, &c.RowKey, &c.ColumnName, &c.RefKey, &c.Body, &c.CreatedAt)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -80,18 +513,48 @@ func (s *PostgresStore) GetCell(ctx context.Context, ref cell.CellRef) (*cell.Ce
 	return &c, nil
 }
 
-func (s *PostgresStore) GetCellLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, error) {
+func (s *PostgresStore) GetCells(ctx context.Context, refs []cell.CellRef) ([]*cell.Cell, error) {
+	if len(refs) == 0 {
+		return nil, nil
+	}
 	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 
-	query := fmt.Sprintf(`
-		SELECT added_id, row_key, column_name, ref_key, body, created_at
-		FROM %s
-		WHERE row_key = $1 AND column_name = $2
-		ORDER BY ref_key DESC
-		LIMIT 1
-	`, s.table)
+	// Queue every lookup and send them together: one network round trip
+	// instead of one per cell, which dominates on high-latency links.
+	batch := &pgx.Batch{}
+	for _, ref := range refs {
+		batch.Queue(s.q.getCell, ref.RowKey, ref.ColumnName, ref.RefKey)
+	}
+	br := s.pool.SendBatch(ctx, batch)
+
+	out := make([]*cell.Cell, len(refs))
+	for i := range refs {
+		var c cell.Cell
+		err := br.QueryRow().Scan(&c.AddedID, &c.RowKey, &c.ColumnName, &c.RefKey, &c.Body, &c.CreatedAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			br.Close()
+			return nil, fmt.Errorf("get cells: %w", err)
+		}
+		out[i] = &c
+	}
+	if err := br.Close(); err != nil {
+		return nil, fmt.Errorf("get cells: %w", err)
+	}
+	return out, nil
+}
+
+func (s *PostgresStore) GetCellLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
+	query := s.q.getCellLatest
+	if s.latestTable {
+		query = s.q.latestCell
+	}
 	var c cell.Cell
 	err := s.pool.QueryRow(ctx, query, rowKey, columnName).
 		Scan(&c.AddedID, &c.RowKey, &c.ColumnName, &c.RefKey, &c.Body, &c.CreatedAt)
@@ -104,50 +567,442 @@ func (s *PostgresStore) GetCellLatest(ctx context.Context, rowKey uuid.UUID, col
 	return &c, nil
 }
 
-func (s *PostgresStore) GetRow(ctx context.Context, rowKey uuid.UUID) ([]cell.Cell, error) {
+func (s *PostgresStore) WriteBlob(ctx context.Context, req cell.WriteCellRequest, data []byte) (*cell.Cell, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var c cell.Cell
+	err := s.pool.QueryRow(ctx, s.q.writeBlob,
+		req.RowKey, req.ColumnName, req.RefKey, req.Body, data,
+	).Scan(&c.AddedID, &c.RowKey, &c.ColumnName, &c.RefKey, &c.Body, &c.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("write blob: %w", ErrCellExists)
+		}
+		return nil, fmt.Errorf("write blob: %w", err)
+	}
+	s.written.advance(c.AddedID)
+	return &c, nil
+}
+
+// UpdateCell serializes the updates of a cell with a transaction-scoped
+// advisory lock, and reads the latest version and writes the next one in
+// that transaction.
+func (s *PostgresStore) UpdateCell(ctx context.Context, rowKey uuid.UUID, columnName string, apply UpdateFunc) (*cell.Cell, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var out *cell.Cell
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, s.q.lockCell, rowKey, columnName); err != nil {
+			return fmt.Errorf("lock cell: %w", err)
+		}
+		// Under READ COMMITTED this statement sees every update committed
+		// before the lock was granted.
+		var latest *cell.Cell
+		var c cell.Cell
+		err := tx.QueryRow(ctx, s.q.getCellLatest, rowKey, columnName).
+			Scan(&c.AddedID, &c.RowKey, &c.ColumnName, &c.RefKey, &c.Body, &c.CreatedAt)
+		switch {
+		case err == nil:
+			latest = &c
+		case !errors.Is(err, pgx.ErrNoRows):
+			return fmt.Errorf("get cell latest: %w", err)
+		}
+		out, err = writeNext(ctx, latest, rowKey, columnName, apply, func(ctx context.Context, req cell.WriteCellRequest) (*cell.Cell, error) {
+			var c cell.Cell
+			err := tx.QueryRow(ctx, s.q.writeCell, req.RowKey, req.ColumnName, req.RefKey, req.Body).
+				Scan(&c.AddedID, &c.RowKey, &c.ColumnName, &c.RefKey, &c.Body, &c.CreatedAt)
+			if isUniqueViolation(err) {
+				return nil, ErrCellExists
+			}
+			return &c, err
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("update cell: %w", err)
+	}
+	if out != nil {
+		s.written.advance(out.AddedID)
+	}
+	return out, nil
+}
+
+func (s *PostgresStore) GetBlob(ctx context.Context, ref cell.CellRef) (*cell.Cell, []byte, error) {
+	return s.getBlob(ctx, s.q.getBlob, ref.RowKey, ref.ColumnName, ref.RefKey)
+}
+
+// GetBlobLatest reads the version history even with UseLatestTable, since
+// the latest-cells table does not carry bytes.
+func (s *PostgresStore) GetBlobLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, []byte, error) {
+	return s.getBlob(ctx, s.q.getBlobLatest, rowKey, columnName)
+}
+
+func (s *PostgresStore) getBlob(ctx context.Context, query string, args ...any) (*cell.Cell, []byte, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var c cell.Cell
+	var data []byte
+	err := s.pool.QueryRow(ctx, query, args...).
+		Scan(&c.AddedID, &c.RowKey, &c.ColumnName, &c.RefKey, &c.Body, &c.CreatedAt, &data)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, ErrCellNotFound
+		}
+		return nil, nil, fmt.Errorf("get blob: %w", err)
+	}
+	return &c, data, nil
+}
+
+func (s *PostgresStore) PutAlias(ctx context.Context, alias string, rowKey uuid.UUID) (*Alias, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var a Alias
+	err := s.pool.QueryRow(ctx, s.q.putAlias, alias, rowKey).Scan(&a.Alias, &a.RowKey, &a.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAliasExists
+		}
+		return nil, fmt.Errorf("put alias: %w", err)
+	}
+	return &a, nil
+}
+
+func (s *PostgresStore) GetAlias(ctx context.Context, alias string) (*Alias, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var a Alias
+	err := s.pool.QueryRow(ctx, s.q.getAlias, alias).Scan(&a.Alias, &a.RowKey, &a.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAliasNotFound
+		}
+		return nil, fmt.Errorf("get alias: %w", err)
+	}
+	return &a, nil
+}
+
+func (s *PostgresStore) DeleteAlias(ctx context.Context, alias string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := s.pool.Exec(ctx, s.q.deleteAlias, alias)
+	if err != nil {
+		return fmt.Errorf("delete alias: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAliasNotFound
+	}
+	return nil
+}
+
+func (s *PostgresStore) ListAliases(ctx context.Context, after string, limit int) ([]Alias, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, s.q.listAliases, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list aliases: %w", err)
+	}
+	defer rows.Close()
+	var out []Alias
+	for rows.Next() {
+		var a Alias
+		if err := rows.Scan(&a.Alias, &a.RowKey, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan alias: %w", err)
+		}
+		out = append(out, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list aliases: %w", err)
+	}
+	return out, nil
+}
+
+func (s *PostgresStore) SetRowTags(ctx context.Context, rowKey uuid.UUID, tags []string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if tags == nil {
+		tags = []string{}
+	}
+	if _, err := s.pool.Exec(ctx, s.q.setRowTags, rowKey, tags); err != nil {
+		return fmt.Errorf("set row tags: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) RecordIdempotencyKey(ctx context.Context, key string, hash []byte) error {
 	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 
-	query := fmt.Sprintf(`
-		SELECT DISTINCT ON (column_name)
-			added_id, row_key, column_name, ref_key, body, created_at
-		FROM %s
-		WHERE row_key = $1
-		ORDER BY column_name, ref_key DESC
-	`, s.table)
+	if _, err := s.pool.Exec(ctx, s.q.recordIdempotency, key, hash, IdempotencyKeyTTL); err != nil {
+		return fmt.Errorf("record idempotency key: %w", err)
+	}
+	return nil
+}
 
+func (s *PostgresStore) IdempotencyKeyHash(ctx context.Context, key string) ([]byte, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var hash []byte
+	if err := s.pool.QueryRow(ctx, s.q.idempotencyHash, key, IdempotencyKeyTTL).Scan(&hash); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrIdempotencyKeyNotFound
+		}
+		return nil, fmt.Errorf("get idempotency key: %w", err)
+	}
+	return hash, nil
+}
+
+func (s *PostgresStore) RowsByTag(ctx context.Context, tag string, after uuid.UUID, limit int) ([]uuid.UUID, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, s.q.rowsByTag, tag, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("rows by tag: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []uuid.UUID
+	for rows.Next() {
+		var k uuid.UUID
+		if err := rows.Scan(&k); err != nil {
+			return nil, fmt.Errorf("rows by tag scan: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows by tag: %w", err)
+	}
+	return keys, nil
+}
+
+func (s *PostgresStore) GetRow(ctx context.Context, rowKey uuid.UUID) ([]cell.Cell, error) {
+	it, err := s.StreamRow(ctx, rowKey)
+	if err != nil {
+		return nil, err
+	}
+	return collect(it)
+}
+
+// StreamRow is GetRow as an iterator over the open query.
+func (s *PostgresStore) StreamRow(ctx context.Context, rowKey uuid.UUID) (CellIterator, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	query := s.q.getRow
+	if s.latestTable {
+		query = s.q.latestRow
+	}
 	rows, err := s.pool.Query(ctx, query, rowKey)
 	if err != nil {
+		cancel()
 		return nil, fmt.Errorf("get row: %w", err)
 	}
+	return &rowsIterator{rows: rows, cancel: cancel, op: "get row"}, nil
+}
+
+// StreamRowColumns is StreamRow restricted to columns in the query, which
+// the (row_key, column_name, ref_key DESC) index serves without reading the
+// row's other columns.
+func (s *PostgresStore) StreamRowColumns(ctx context.Context, rowKey uuid.UUID, columns []string) (CellIterator, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	query := s.q.getRowColumns
+	if s.latestTable {
+		query = s.q.latestRowColumns
+	}
+	rows, err := s.pool.Query(ctx, query, rowKey, columns)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("get row: %w", err)
+	}
+	return &rowsIterator{rows: rows, cancel: cancel, op: "get row"}, nil
+}
+
+func (s *PostgresStore) GetRows(ctx context.Context, rowKeys []uuid.UUID) (map[uuid.UUID][]cell.Cell, error) {
+	out := make(map[uuid.UUID][]cell.Cell)
+	if len(rowKeys) == 0 {
+		return out, nil
+	}
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	query := s.q.getRows
+	if s.latestTable {
+		query = s.q.latestRows
+	}
+	rows, err := s.pool.Query(ctx, query, rowKeys)
+	if err != nil {
+		return nil, fmt.Errorf("get rows: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c cell.Cell
+		if err := rows.Scan(&c.AddedID, &c.RowKey, &c.ColumnName, &c.RefKey, &c.Body, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("get rows scan: %w", err)
+		}
+		out[c.RowKey] = append(out[c.RowKey], c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("get rows: %w", err)
+	}
+	return out, nil
+}
+
+// ProbeCellLatest is GetCellLatest without reading the body.
+func (s *PostgresStore) ProbeCellLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	query := s.q.probeCell
+	if s.latestTable {
+		query = s.q.latestProbeCell
+	}
+	c := cell.Cell{RowKey: rowKey, ColumnName: columnName}
+	err := s.pool.QueryRow(ctx, query, rowKey, columnName).Scan(&c.AddedID, &c.RefKey, &c.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrCellNotFound
+		}
+		return nil, fmt.Errorf("probe cell: %w", err)
+	}
+	return &c, nil
+}
+
+// ProbeRow counts a row's columns without reading its cells.
+func (s *PostgresStore) ProbeRow(ctx context.Context, rowKey uuid.UUID, withSystem bool) (RowSummary, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	query := s.q.probeRow
+	if s.latestTable {
+		query = s.q.latestProbeRow
+	}
+	var sum RowSummary
+	if err := s.pool.QueryRow(ctx, query, rowKey, withSystem, cell.ReservedPrefix).Scan(&sum.Columns, &sum.UpdatedAt); err != nil {
+		return RowSummary{}, fmt.Errorf("probe row: %w", err)
+	}
+	if sum.Columns == 0 {
+		return RowSummary{}, nil
+	}
+	return sum, nil
+}
+
+func (s *PostgresStore) ScanCells(ctx context.Context, columnName string, afterAddedID int64, limit int) ([]cell.Cell, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	fence, err := s.settledAddedID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("scan cells: %w", err)
+	}
+	rows, err := s.pool.Query(ctx, s.q.scanCells, columnName, afterAddedID, fence, limit)
+	if err != nil {
+		return nil, fmt.Errorf("scan cells: %w", err)
+	}
 	defer rows.Close()
 
 	var cells []cell.Cell
 	for rows.Next() {
 		var c cell.Cell
 		if err := rows.Scan(&c.AddedID, &c.RowKey, &c.ColumnName, &c.RefKey, &c.Body, &c.CreatedAt); err != nil {
-			return nil, fmt.Errorf("get row scan: %w", err)
+			return nil, fmt.Errorf("scan cells scan: %w", err)
 		}
 		cells = append(cells, c)
 	}
 	return cells, rows.Err()
 }
 
-func (s *PostgresStore) ScanCells(ctx context.Context, columnName string, afterAddedID int64, limit int) ([]cell.Cell, error) {
+func (s *PostgresStore) Head(ctx context.Context) (Head, error) {
 	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 
-	query := fmt.Sprintf(`
-		SELECT added_id, row_key, column_name, ref_key, body, created_at
-		FROM %s
-		WHERE column_name = $1 AND added_id > $2
-		ORDER BY added_id ASC
-		LIMIT $3
-	`, s.table)
+	fence, err := s.settledAddedID(ctx)
+	if err != nil {
+		return Head{}, fmt.Errorf("read head: %w", err)
+	}
+	var h Head
+	err = s.pool.QueryRow(ctx, s.q.head, fence).Scan(&h.AddedID, &h.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Head{}, nil
+	}
+	if err != nil {
+		return Head{}, fmt.Errorf("read head: %w", err)
+	}
+	return h, nil
+}
 
-	rows, err := s.pool.Query(ctx, query, columnName, afterAddedID, limit)
+// CommittedHead implements CommittedHeader.
+func (s *PostgresStore) CommittedHead(ctx context.Context) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var h Head
+	err := s.pool.QueryRow(ctx, s.q.head, int64(math.MaxInt64)).Scan(&h.AddedID, &h.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("scan cells: %w", err)
+		return 0, fmt.Errorf("read committed head: %w", err)
+	}
+	return h.AddedID, nil
+}
+
+// WaitHead waits for a write through this store past afterAddedID, or,
+// with a HeadNotifier, through another instance's. Writes by other
+// processes, such as import, are not seen.
+func (s *PostgresStore) WaitHead(ctx context.Context, afterAddedID int64) (int64, error) {
+	return s.written.wait(ctx, afterAddedID)
+}
+
+// ScanCommitLog implements CommitLogScanner.
+func (s *PostgresStore) ScanCommitLog(ctx context.Context, fromAddedID, afterSeq int64, limit int) ([]cell.Cell, int64, error) {
+	if !s.commitLog {
+		return nil, 0, ErrNoCommitLog
+	}
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, s.q.scanCommitLog, fromAddedID, afterSeq, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("scan commit log: %w", err)
+	}
+	var cells []cell.Cell
+	for rows.Next() {
+		var c cell.Cell
+		if err := rows.Scan(&c.CommitSeq, &c.AddedID, &c.RowKey, &c.ColumnName, &c.RefKey, &c.Body, &c.CreatedAt); err != nil {
+			rows.Close()
+			return nil, 0, fmt.Errorf("scan commit log scan: %w", err)
+		}
+		cells = append(cells, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("scan commit log: %w", err)
+	}
+	if len(cells) > 0 {
+		afterSeq = cells[len(cells)-1].CommitSeq
+	}
+	var floor int64
+	if err := s.pool.QueryRow(ctx, s.q.commitLogFloor, fromAddedID, afterSeq).Scan(&floor); err != nil {
+		return nil, 0, fmt.Errorf("scan commit log: %w", err)
+	}
+	return cells, floor, nil
+}
+
+func (s *PostgresStore) ScanCellsWindow(ctx context.Context, columnName string, from, to time.Time, afterAddedID int64, limit int) ([]cell.Cell, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, s.q.scanCellsWindow, columnName, from, to, afterAddedID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("scan cells window: %w", err)
 	}
 	defer rows.Close()
 
@@ -155,7 +1010,7 @@ func (s *PostgresStore) ScanCells(ctx context.Context, columnName string, afterA
 	for rows.Next() {
 		var c cell.Cell
 		if err := rows.Scan(&c.AddedID, &c.RowKey, &c.ColumnName, &c.RefKey, &c.Body, &c.CreatedAt); err != nil {
-			return nil, fmt.Errorf("scan cells scan: %w", err)
+			return nil, fmt.Errorf("scan cells window scan: %w", err)
 		}
 		cells = append(cells, c)
 	}
@@ -165,58 +1020,62 @@ func (s *PostgresStore) ScanCells(ctx context.Context, columnName string, afterA
 type ReadType int
 
 const (
-	_                          = iota
+	_ = iota
+	// PartitionReadTypeCreatedAt reads in (created_at, added_id) order,
+	// after the given created_at and, among cells created exactly then,
+	// after the given added_id; without one, after all of them.
 	PartitionReadTypeCreatedAt = 1
 	PartitionReadTypeAddedID   = 2
+	// PartitionReadTypeCommitSeq reads in commit order from the shard's
+	// commit log, after the given seq instead of added_id.
+	PartitionReadTypeCommitSeq = 3
 )
 
 func (s *PostgresStore) PartitionRead(ctx context.Context, partitionNumber int, readType int, addedID int64, createdAfter time.Time, limit int) ([]cell.Cell, error) {
-	ctx, cancel := s.withTimeout(ctx)
-	defer cancel()
+	it, err := s.StreamPartition(ctx, partitionNumber, readType, addedID, createdAfter, limit)
+	if err != nil {
+		return nil, err
+	}
+	return collect(it)
+}
 
-	var query string
+// StreamPartition is PartitionRead as an iterator over the open query.
+func (s *PostgresStore) StreamPartition(ctx context.Context, partitionNumber int, readType int, addedID int64, createdAfter time.Time, limit int) (CellIterator, error) {
+	ctx, cancel := s.withTimeout(ctx)
 
 	var rows pgx.Rows
 	var err error
 	switch readType {
 	case PartitionReadTypeCreatedAt:
-		// TODO FIXME $1::timestamp ?
-		query = fmt.Sprintf(`
-			SELECT added_id, row_key, column_name, ref_key, body, created_at
-			FROM %s
-			WHERE created_at > $1
-			ORDER BY created_at ASC
-			LIMIT $2
-		`, s.table)
-
-		rows, err = s.pool.Query(ctx, query, createdAfter, limit)
-
+		// Without an added_id every cell created at createdAfter is
+		// skipped, as it always was.
+		after := addedID
+		if after <= 0 {
+			after = math.MaxInt64
+		}
+		rows, err = s.pool.Query(ctx, s.q.partitionCreatedAt, createdAfter, after, limit)
 	case PartitionReadTypeAddedID:
-		query = fmt.Sprintf(`
-			SELECT added_id, row_key, column_name, ref_key, body, created_at
-			FROM %s
-			WHERE added_id > $1
-			ORDER BY added_id ASC
-			LIMIT $2
-		`, s.table)
-
-		rows, err = s.pool.Query(ctx, query, addedID, limit)
+		var fence int64
+		if fence, err = s.settledAddedID(ctx); err == nil {
+			rows, err = s.pool.Query(ctx, s.q.partitionAddedID, addedID, fence, limit)
+		}
+	case PartitionReadTypeCommitSeq:
+		if !s.commitLog {
+			cancel()
+			return nil, ErrNoCommitLog
+		}
+		rows, err = s.pool.Query(ctx, s.q.partitionCommitSeq, addedID, limit)
+		if err == nil {
+			return &rowsIterator{rows: rows, cancel: cancel, op: "partition read", seq: true}, nil
+		}
 	default:
+		cancel()
 		return nil, fmt.Errorf("invalid read type: %d", readType)
 	}
 
 	if err != nil {
+		cancel()
 		return nil, fmt.Errorf("partition read: %w", err)
 	}
-	defer rows.Close()
-
-	var cells []cell.Cell
-	for rows.Next() {
-		var c cell.Cell
-		if err := rows.Scan(&c.AddedID, &c.RowKey, &c.ColumnName, &c.RefKey, &c.Body, &c.CreatedAt); err != nil {
-			return nil, fmt.Errorf("partition read scan: %w", err)
-		}
-		cells = append(cells, c)
-	}
-	return cells, rows.Err()
+	return &rowsIterator{rows: rows, cancel: cancel, op: "partition read"}, nil
 }
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+)
+
+// The benchmarks compare pgx's cached prepared statements (the default, used
+// in production) with the extended protocol without a statement cache, which
+// is what queries rebuilt per call or a too-small cache degrade to: every
+// execution pays a parse and plan on the server.
+//
+//	go test ./internal/storage -run '^$' -bench . -benchmem
+var benchModes = []struct {
+	name string
+	mode pgx.QueryExecMode
+}{
+	{"cache_statement", pgx.QueryExecModeCacheStatement},
+	{"describe_exec", pgx.QueryExecModeDescribeExec},
+}
+
+var benchShard = 20000
+
+// benchStore returns a store for a fresh shard on a pool using mode.
+func benchStore(b *testing.B, mode pgx.QueryExecMode) *PostgresStore {
+	b.Helper()
+	ctx := context.Background()
+	cfg, err := pgxpool.ParseConfig(testPool.Config().ConnString())
+	if err != nil {
+		b.Fatal(err)
+	}
+	cfg.ConnConfig.DefaultQueryExecMode = mode
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(pool.Close)
+
+	benchShard++
+	if err := RunMigrationsForPool(ctx, pool, benchShard, benchShard); err != nil {
+		b.Fatalf("run migrations for shard %d: %v", benchShard, err)
+	}
+	return NewPostgresStore(pool, benchShard, 5*time.Second)
+}
+
+// seedRow writes columns cells of one version each to a new row.
+func seedRow(b *testing.B, store *PostgresStore, columns int) uuid.UUID {
+	b.Helper()
+	row := uuid.New()
+	for i := 0; i < columns; i++ {
+		_, err := store.WriteCell(context.Background(), cell.WriteCellRequest{
+			RowKey: row, ColumnName: "col" + string(rune('a'+i)), RefKey: 1,
+			Body: json.RawMessage(`{"name":"alice","email":"alice@example.com"}`),
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	return row
+}
+
+func BenchmarkWriteCell(b *testing.B) {
+	for _, m := range benchModes {
+		b.Run(m.name, func(b *testing.B) {
+			store := benchStore(b, m.mode)
+			ctx := context.Background()
+			body := json.RawMessage(`{"name":"alice","email":"alice@example.com"}`)
+			row := uuid.New()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := store.WriteCell(ctx, cell.WriteCellRequest{RowKey: row, ColumnName: "profile", RefKey: int64(i + 1), Body: body})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetCell(b *testing.B) {
+	for _, m := range benchModes {
+		b.Run(m.name, func(b *testing.B) {
+			store := benchStore(b, m.mode)
+			ctx := context.Background()
+			ref := cell.CellRef{RowKey: seedRow(b, store, 1), ColumnName: "cola", RefKey: 1}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := store.GetCell(ctx, ref); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetCellLatest(b *testing.B) {
+	for _, m := range benchModes {
+		b.Run(m.name, func(b *testing.B) {
+			store := benchStore(b, m.mode)
+			ctx := context.Background()
+			row := seedRow(b, store, 1)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := store.GetCellLatest(ctx, row, "cola"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetRow(b *testing.B) {
+	for _, m := range benchModes {
+		b.Run(m.name, func(b *testing.B) {
+			store := benchStore(b, m.mode)
+			ctx := context.Background()
+			row := seedRow(b, store, 8)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				cells, err := store.GetRow(ctx, row)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(cells) != 8 {
+					b.Fatalf("got %d cells, want 8", len(cells))
+				}
+			}
+		})
+	}
+}
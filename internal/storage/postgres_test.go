@@ -3,14 +3,20 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	mezzanine "github.com/ryanbastic/go-mezzanine/pkg/mezzanine"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/modules/postgres"
 	"github.com/testcontainers/testcontainers-go/wait"
@@ -123,6 +129,56 @@ func TestWriteCell_DuplicateRefKey(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error on duplicate (row_key, column_name, ref_key)")
 	}
+	if !errors.Is(err, ErrCellExists) {
+		t.Errorf("expected ErrCellExists, got %v", err)
+	}
+}
+
+func TestWriteCells(t *testing.T) {
+	store := freshShard(t)
+	ctx := context.Background()
+
+	rowKey := uuid.New()
+	reqs := []cell.WriteCellRequest{
+		{RowKey: rowKey, ColumnName: "col", RefKey: 1, Body: json.RawMessage(`{"v":1}`)},
+		{RowKey: rowKey, ColumnName: "col", RefKey: 2, Body: json.RawMessage(`{"v":2}`)},
+		{RowKey: uuid.New(), ColumnName: "other", RefKey: 1, Body: json.RawMessage(`{"v":3}`)},
+	}
+
+	cells, err := store.WriteCells(ctx, reqs)
+	if err != nil {
+		t.Fatalf("WriteCells: %v", err)
+	}
+	if len(cells) != len(reqs) {
+		t.Fatalf("got %d cells, want %d", len(cells), len(reqs))
+	}
+	for i, c := range cells {
+		if c.RowKey != reqs[i].RowKey || c.RefKey != reqs[i].RefKey {
+			t.Errorf("cell %d: got (%v, %d), want (%v, %d)", i, c.RowKey, c.RefKey, reqs[i].RowKey, reqs[i].RefKey)
+		}
+		if i > 0 && c.AddedID <= cells[i-1].AddedID {
+			t.Errorf("cell %d: added_id %d not after %d", i, c.AddedID, cells[i-1].AddedID)
+		}
+	}
+}
+
+func TestWriteCells_DuplicateIsAtomic(t *testing.T) {
+	store := freshShard(t)
+	ctx := context.Background()
+
+	existing := cell.WriteCellRequest{RowKey: uuid.New(), ColumnName: "col", RefKey: 1, Body: json.RawMessage(`{}`)}
+	if _, err := store.WriteCell(ctx, existing); err != nil {
+		t.Fatalf("WriteCell: %v", err)
+	}
+
+	fresh := cell.WriteCellRequest{RowKey: uuid.New(), ColumnName: "col", RefKey: 1, Body: json.RawMessage(`{}`)}
+	_, err := store.WriteCells(ctx, []cell.WriteCellRequest{fresh, existing})
+	if !errors.Is(err, ErrCellExists) {
+		t.Fatalf("expected ErrCellExists, got %v", err)
+	}
+	if _, err := store.GetCell(ctx, cell.CellRef{RowKey: fresh.RowKey, ColumnName: "col", RefKey: 1}); !errors.Is(err, ErrCellNotFound) {
+		t.Errorf("expected the batch to be rolled back, got %v", err)
+	}
 }
 
 func TestGetCell(t *testing.T) {
@@ -273,6 +329,95 @@ func TestGetRow_Empty(t *testing.T) {
 	}
 }
 
+func TestGetRows(t *testing.T) {
+	store := freshShard(t)
+	ctx := context.Background()
+
+	a, b, missing := uuid.New(), uuid.New(), uuid.New()
+	for _, req := range []cell.WriteCellRequest{
+		{RowKey: a, ColumnName: "email", RefKey: 1, Body: json.RawMessage(`{"v":"old@example.com"}`)},
+		{RowKey: a, ColumnName: "email", RefKey: 2, Body: json.RawMessage(`{"v":"new@example.com"}`)},
+		{RowKey: a, ColumnName: "name", RefKey: 1, Body: json.RawMessage(`{"v":"alice"}`)},
+		{RowKey: b, ColumnName: "name", RefKey: 1, Body: json.RawMessage(`{"v":"bob"}`)},
+	} {
+		if _, err := store.WriteCell(ctx, req); err != nil {
+			t.Fatalf("WriteCell: %v", err)
+		}
+	}
+
+	rows, err := store.GetRows(ctx, []uuid.UUID{a, b, missing})
+	if err != nil {
+		t.Fatalf("GetRows: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("len(rows) = %d, want 2", len(rows))
+	}
+	if len(rows[a]) != 2 || len(rows[b]) != 1 {
+		t.Errorf("cells per row = %d, %d, want 2, 1", len(rows[a]), len(rows[b]))
+	}
+	for _, c := range rows[a] {
+		if c.ColumnName == "email" && c.RefKey != 2 {
+			t.Errorf("email RefKey = %d, want 2 (latest)", c.RefKey)
+		}
+	}
+	if _, ok := rows[missing]; ok {
+		t.Error("missing row should not be in the result")
+	}
+}
+
+func TestProbe(t *testing.T) {
+	store := freshShard(t)
+	ctx := context.Background()
+	rowKey := uuid.New()
+
+	if sum, err := store.ProbeRow(ctx, rowKey, true); err != nil || sum.Columns != 0 || !sum.UpdatedAt.IsZero() {
+		t.Fatalf("ProbeRow(empty) = %+v, %v", sum, err)
+	}
+	if _, err := store.ProbeCellLatest(ctx, rowKey, "email"); !errors.Is(err, ErrCellNotFound) {
+		t.Fatalf("ProbeCellLatest(empty) error = %v, want ErrCellNotFound", err)
+	}
+
+	var last *cell.Cell
+	for _, req := range []cell.WriteCellRequest{
+		{RowKey: rowKey, ColumnName: "email", RefKey: 1, Body: json.RawMessage(`{}`)},
+		{RowKey: rowKey, ColumnName: "email", RefKey: 2, Body: json.RawMessage(`{}`)},
+		{RowKey: rowKey, ColumnName: "name", RefKey: 1, Body: json.RawMessage(`{}`)},
+	} {
+		c, err := store.WriteCell(ctx, req)
+		if err != nil {
+			t.Fatalf("WriteCell: %v", err)
+		}
+		last = c
+	}
+
+	c, err := store.ProbeCellLatest(ctx, rowKey, "email")
+	if err != nil {
+		t.Fatalf("ProbeCellLatest: %v", err)
+	}
+	if c.RefKey != 2 || c.Body != nil {
+		t.Errorf("ProbeCellLatest = ref %d body %s, want ref 2 and no body", c.RefKey, c.Body)
+	}
+
+	sum, err := store.ProbeRow(ctx, rowKey, true)
+	if err != nil {
+		t.Fatalf("ProbeRow: %v", err)
+	}
+	if sum.Columns != 2 || !sum.UpdatedAt.Equal(last.CreatedAt) {
+		t.Errorf("ProbeRow = %+v, want 2 columns updated at %v", sum, last.CreatedAt)
+	}
+
+	owner := uuid.New()
+	if _, err := store.WriteCell(ctx, cell.WriteCellRequest{RowKey: owner, ColumnName: cell.ReservedPrefix + "owner", RefKey: 1, Body: json.RawMessage(`{}`)}); err != nil {
+		t.Fatalf("WriteCell: %v", err)
+	}
+	if sum, err := store.ProbeRow(ctx, owner, false); err != nil || sum.Columns != 0 {
+		t.Errorf("ProbeRow(system only, without system) = %+v, %v, want no columns", sum, err)
+	}
+	if sum, err := store.ProbeRow(ctx, owner, true); err != nil || sum.Columns != 1 {
+		t.Errorf("ProbeRow(system only, with system) = %+v, %v, want 1 column", sum, err)
+	}
+}
+
 func TestScanCells(t *testing.T) {
 	store := freshShard(t)
 	ctx := context.Background()
@@ -334,6 +479,101 @@ func TestScanCells(t *testing.T) {
 	}
 }
 
+func TestScanCellsWait(t *testing.T) {
+	store := freshShard(t)
+	ctx := context.Background()
+
+	write := func(column string) {
+		if _, err := store.WriteCell(ctx, cell.WriteCellRequest{
+			RowKey:     uuid.New(),
+			ColumnName: column,
+			RefKey:     1,
+			Body:       json.RawMessage(`{}`),
+		}); err != nil {
+			t.Errorf("WriteCell: %v", err)
+		}
+	}
+
+	// Nothing is written: the wait runs out and the page is empty.
+	start := time.Now()
+	cells, err := ScanCellsWait(ctx, store, "events", 0, 10, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("ScanCellsWait: %v", err)
+	}
+	if len(cells) != 0 || time.Since(start) < 50*time.Millisecond {
+		t.Errorf("got %d cells after %v, want none after the wait", len(cells), time.Since(start))
+	}
+
+	// A write to another column keeps it waiting; one to the column ends it.
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		write("other")
+		time.Sleep(20 * time.Millisecond)
+		write("events")
+	}()
+	cells, err = ScanCellsWait(ctx, store, "events", 0, 10, 5*time.Second)
+	if err != nil {
+		t.Fatalf("ScanCellsWait: %v", err)
+	}
+	if len(cells) != 1 || cells[0].ColumnName != "events" {
+		t.Errorf("got %+v, want the events cell", cells)
+	}
+}
+
+func TestScanCellsWindow(t *testing.T) {
+	store := freshShard(t)
+	ctx := context.Background()
+
+	var written []cell.Cell
+	for i := int64(1); i <= 5; i++ {
+		c, err := store.WriteCell(ctx, cell.WriteCellRequest{
+			RowKey:     uuid.New(),
+			ColumnName: "events",
+			RefKey:     i,
+			Body:       json.RawMessage(fmt.Sprintf(`{"seq":%d}`, i)),
+		})
+		if err != nil {
+			t.Fatalf("WriteCell: %v", err)
+		}
+		written = append(written, *c)
+	}
+	from, to := written[0].CreatedAt, written[4].CreatedAt
+
+	// Page through [from, to) two cells at a time.
+	var got []int64
+	after, cursor := int64(0), from
+	for {
+		cells, err := store.ScanCellsWindow(ctx, "events", cursor, to, after, 2)
+		if err != nil {
+			t.Fatalf("ScanCellsWindow: %v", err)
+		}
+		if len(cells) == 0 {
+			break
+		}
+		for _, c := range cells {
+			got = append(got, c.AddedID)
+		}
+		last := cells[len(cells)-1]
+		cursor, after = last.CreatedAt, last.AddedID
+	}
+	if len(got) != 4 {
+		t.Fatalf("got %d cells, want 4 (to is exclusive)", len(got))
+	}
+	for i, id := range got {
+		if id != written[i].AddedID {
+			t.Errorf("cell %d: added_id = %d, want %d", i, id, written[i].AddedID)
+		}
+	}
+
+	cells, err := store.ScanCellsWindow(ctx, "other", from, to.Add(time.Second), 0, 100)
+	if err != nil {
+		t.Fatalf("ScanCellsWindow other: %v", err)
+	}
+	if len(cells) != 0 {
+		t.Errorf("other column: got %d cells, want 0", len(cells))
+	}
+}
+
 func TestPartitionRead_ByAddedID(t *testing.T) {
 	store := freshShard(t)
 	ctx := context.Background()
@@ -369,6 +609,105 @@ func TestPartitionRead_ByAddedID(t *testing.T) {
 	}
 }
 
+func TestPartitionRead_ByCreatedAtResumesWithinATimestamp(t *testing.T) {
+	store := freshShard(t)
+	ctx := context.Background()
+
+	for i := int64(1); i <= 3; i++ {
+		if _, err := store.WriteCell(ctx, cell.WriteCellRequest{RowKey: uuid.New(), ColumnName: "col", RefKey: i, Body: json.RawMessage(`{}`)}); err != nil {
+			t.Fatalf("WriteCell: %v", err)
+		}
+	}
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := testPool.Exec(ctx, "UPDATE "+ShardTable(10000+shardCounter)+" SET created_at = $1", at); err != nil {
+		t.Fatalf("update created_at: %v", err)
+	}
+
+	first, err := store.PartitionRead(ctx, 0, PartitionReadTypeCreatedAt, 0, at.Add(-time.Second), 2)
+	if err != nil || len(first) != 2 {
+		t.Fatalf("first page: got %d cells, %v; want 2", len(first), err)
+	}
+	rest, err := store.PartitionRead(ctx, 0, PartitionReadTypeCreatedAt, first[1].AddedID, at, 2)
+	if err != nil || len(rest) != 1 || rest[0].AddedID <= first[1].AddedID {
+		t.Errorf("page after the first: got %+v, %v; want the third cell", rest, err)
+	}
+	if none, err := store.PartitionRead(ctx, 0, PartitionReadTypeCreatedAt, 0, at, 2); err != nil || len(none) != 0 {
+		t.Errorf("page after the timestamp without an added_id: got %d cells, %v; want none", len(none), err)
+	}
+}
+
+func TestPartitionRead_HoldsBackUncommitted(t *testing.T) {
+	store := freshShard(t)
+	ctx := context.Background()
+
+	// A slow transaction draws the first added_id and commits last.
+	tx, err := testPool.Begin(ctx)
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, store.q.writeCell, uuid.New(), "col", 1, json.RawMessage(`{}`)); err != nil {
+		t.Fatalf("insert in transaction: %v", err)
+	}
+	c, err := store.WriteCell(ctx, cell.WriteCellRequest{RowKey: uuid.New(), ColumnName: "col", RefKey: 1, Body: json.RawMessage(`{}`)})
+	if err != nil {
+		t.Fatalf("WriteCell: %v", err)
+	}
+
+	cells, err := store.PartitionRead(ctx, 0, PartitionReadTypeAddedID, 0, time.Time{}, 100)
+	if err != nil {
+		t.Fatalf("PartitionRead: %v", err)
+	}
+	if len(cells) != 0 {
+		t.Errorf("PartitionRead with a lower added_id uncommitted: got %d cells, want none", len(cells))
+	}
+	if head, err := store.Head(ctx); err != nil || head.AddedID != 0 {
+		t.Errorf("Head with a lower added_id uncommitted: got %+v, %v, want zero", head, err)
+	}
+	if head, err := store.CommittedHead(ctx); err != nil || head != c.AddedID {
+		t.Errorf("CommittedHead with a lower added_id uncommitted: got %d, %v, want %d", head, err, c.AddedID)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	cells, err = store.PartitionRead(ctx, 0, PartitionReadTypeAddedID, 0, time.Time{}, 100)
+	if err != nil {
+		t.Fatalf("PartitionRead: %v", err)
+	}
+	if len(cells) != 2 || cells[1].AddedID != c.AddedID {
+		t.Errorf("PartitionRead after commit: got %d cells, want both, the write last", len(cells))
+	}
+}
+
+func TestPartitionRead_WaitsForRunningTransactions(t *testing.T) {
+	store := freshShard(t)
+	ctx := context.Background()
+
+	tx, err := testPool.Begin(ctx)
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, store.q.writeCell, uuid.New(), "col", 1, json.RawMessage(`{}`)); err != nil {
+		t.Fatalf("insert in transaction: %v", err)
+	}
+	if _, err := store.WriteCell(ctx, cell.WriteCellRequest{RowKey: uuid.New(), ColumnName: "col", RefKey: 1, Body: json.RawMessage(`{}`)}); err != nil {
+		t.Fatalf("WriteCell: %v", err)
+	}
+
+	// The read waits for the slow transaction instead of answering with
+	// the fence from before it.
+	time.AfterFunc(100*time.Millisecond, func() { tx.Commit(ctx) })
+	cells, err := store.PartitionRead(ctx, 0, PartitionReadTypeAddedID, 0, time.Time{}, 100)
+	if err != nil {
+		t.Fatalf("PartitionRead: %v", err)
+	}
+	if len(cells) != 2 {
+		t.Errorf("PartitionRead while a transaction commits: got %d cells, want 2", len(cells))
+	}
+}
+
 func TestPartitionRead_InvalidType(t *testing.T) {
 	store := freshShard(t)
 	ctx := context.Background()
@@ -379,6 +718,78 @@ func TestPartitionRead_InvalidType(t *testing.T) {
 	}
 }
 
+func TestStreamPartition(t *testing.T) {
+	store := freshShard(t)
+	ctx := context.Background()
+
+	var want []int64
+	for i := int64(1); i <= 3; i++ {
+		c, err := store.WriteCell(ctx, cell.WriteCellRequest{
+			RowKey:     uuid.New(),
+			ColumnName: "col",
+			RefKey:     i,
+			Body:       json.RawMessage(`{}`),
+		})
+		if err != nil {
+			t.Fatalf("WriteCell: %v", err)
+		}
+		want = append(want, c.AddedID)
+	}
+
+	it, err := store.StreamPartition(ctx, 0, PartitionReadTypeAddedID, 0, time.Time{}, 100)
+	if err != nil {
+		t.Fatalf("StreamPartition: %v", err)
+	}
+	defer it.Close()
+	var got []int64
+	for it.Next() {
+		got = append(got, it.Cell().AddedID)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("streamed %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("cell %d: added_id %d, want %d", i, got[i], want[i])
+		}
+	}
+}
+
+func TestStreamRow_FallsBackToGetRow(t *testing.T) {
+	rowKey := uuid.New()
+	it, err := StreamRow(context.Background(), rowStore{cells: []cell.Cell{
+		{RowKey: rowKey, ColumnName: "a"},
+		{RowKey: rowKey, ColumnName: "b"},
+	}}, rowKey)
+	if err != nil {
+		t.Fatalf("StreamRow: %v", err)
+	}
+	var cols []string
+	for it.Next() {
+		cols = append(cols, it.Cell().ColumnName)
+	}
+	it.Close()
+	if len(cols) != 2 || cols[0] != "a" || cols[1] != "b" {
+		t.Errorf("columns = %v, want [a b]", cols)
+	}
+	if it.Next() {
+		t.Error("Next after the end returned true")
+	}
+}
+
+// rowStore is a CellStore that only answers GetRow, without streaming.
+type rowStore struct {
+	CellStore
+	cells []cell.Cell
+}
+
+func (s rowStore) GetRow(context.Context, uuid.UUID) ([]cell.Cell, error) {
+	return s.cells, nil
+}
+
 func TestRunMigrationsForPool_MultipleShards(t *testing.T) {
 	ctx := context.Background()
 
@@ -402,6 +813,33 @@ func TestRunMigrationsForPool_MultipleShards(t *testing.T) {
 	}
 }
 
+func TestListShardTables(t *testing.T) {
+	ctx := context.Background()
+
+	shardCounter++
+	base := 20000 + shardCounter*10
+	if err := RunMigrationsForPool(ctx, testPool, base, base+1); err != nil {
+		t.Fatalf("RunMigrationsForPool: %v", err)
+	}
+	if _, err := testPool.Exec(ctx, "CREATE TABLE IF NOT EXISTS cells_01 (id INT)"); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+
+	shards, err := ListShardTables(ctx, testPool)
+	if err != nil {
+		t.Fatalf("ListShardTables: %v", err)
+	}
+	if !slices.Contains(shards, base) || !slices.Contains(shards, base+1) {
+		t.Errorf("got %v, want it to include %d and %d", shards, base, base+1)
+	}
+	if slices.Contains(shards, 1) {
+		t.Errorf("got %v, want cells_01 left out", shards)
+	}
+	if !slices.IsSorted(shards) {
+		t.Errorf("got %v, want sorted", shards)
+	}
+}
+
 func TestRunMigrationsForPool_Idempotent(t *testing.T) {
 	ctx := context.Background()
 
@@ -415,6 +853,69 @@ func TestRunMigrationsForPool_Idempotent(t *testing.T) {
 	}
 }
 
+func TestWithMigrationLock_Serializes(t *testing.T) {
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := WithMigrationLock(ctx, testPool, func(DB) error {
+				mu.Lock()
+				running++
+				maxRunning = max(maxRunning, running)
+				mu.Unlock()
+				time.Sleep(50 * time.Millisecond)
+				mu.Lock()
+				running--
+				mu.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Errorf("WithMigrationLock: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxRunning != 1 {
+		t.Errorf("max concurrent holders: got %d, want 1", maxRunning)
+	}
+}
+
+func TestWithMigrationLock_ReturnsFnError(t *testing.T) {
+	want := errors.New("boom")
+	err := WithMigrationLock(context.Background(), testPool, func(DB) error { return want })
+	if !errors.Is(err, want) {
+		t.Errorf("got %v, want %v", err, want)
+	}
+}
+
+func TestWithMigrationLock_SingleConnection(t *testing.T) {
+	ctx := context.Background()
+	cfg := testPool.Config().Copy()
+	cfg.MaxConns = 1
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatalf("create pool: %v", err)
+	}
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if err := WithMigrationLock(ctx, pool, func(db DB) error {
+		if err := RunMigrationsForPool(ctx, db, 19000, 19001); err != nil {
+			return err
+		}
+		return RunPluginMigration(ctx, db)
+	}); err != nil {
+		t.Fatalf("migrate with one connection: %v", err)
+	}
+}
+
 func TestRunPluginMigration(t *testing.T) {
 	ctx := context.Background()
 
@@ -422,16 +923,221 @@ func TestRunPluginMigration(t *testing.T) {
 		t.Fatalf("RunPluginMigration: %v", err)
 	}
 
+	id := uuid.New()
 	_, err := testPool.Exec(ctx, `
-		INSERT INTO plugins (id, name, endpoint, subscribed_columns, status)
-		VALUES ($1, $2, $3, $4, $5)
-	`, uuid.New(), fmt.Sprintf("test-plugin-%d", time.Now().UnixNano()), "http://localhost:9090", []string{"col1"}, "active")
+		INSERT INTO plugins (id, name, endpoint, subscribed_columns, status, poison_policy, max_attempts)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, id, fmt.Sprintf("test-plugin-%d", time.Now().UnixNano()), "http://localhost:9090", []string{"col1"}, "active", "skip", 5)
 	if err != nil {
 		t.Fatalf("insert into plugins: %v", err)
 	}
+	if _, err := testPool.Exec(ctx, `INSERT INTO trigger_checkpoints (plugin_id, shard_id, added_id) VALUES ($1, 0, 42)`, id); err != nil {
+		t.Fatalf("insert into trigger_checkpoints: %v", err)
+	}
+	if _, err := testPool.Exec(ctx, `INSERT INTO streams (name, columns, filters) VALUES ($1, '{orders}', '{region:eq:eu}')`, fmt.Sprintf("stream-%d", time.Now().UnixNano())); err != nil {
+		t.Fatalf("insert into streams: %v", err)
+	}
 
 	// Idempotent
 	if err := RunPluginMigration(ctx, testPool); err != nil {
 		t.Fatalf("second RunPluginMigration: %v", err)
 	}
 }
+
+func TestRunColumnMigration(t *testing.T) {
+	ctx := context.Background()
+
+	if err := RunColumnMigration(ctx, testPool); err != nil {
+		t.Fatalf("RunColumnMigration: %v", err)
+	}
+	_, err := testPool.Exec(ctx, `INSERT INTO column_registry (name, owner, keep_versions) VALUES ($1, 'billing', 3)`, fmt.Sprintf("col-%d", time.Now().UnixNano()))
+	if err != nil {
+		t.Fatalf("insert into column_registry: %v", err)
+	}
+	_, err = testPool.Exec(ctx, `INSERT INTO column_schemas (column_name, version, document) VALUES ($1, 1, '{"type":"object"}')`, fmt.Sprintf("col-%d", time.Now().UnixNano()))
+	if err != nil {
+		t.Fatalf("insert into column_schemas: %v", err)
+	}
+	if err := RunColumnMigration(ctx, testPool); err != nil {
+		t.Fatalf("second RunColumnMigration: %v", err)
+	}
+}
+
+func TestRunFenceMigration(t *testing.T) {
+	ctx := context.Background()
+
+	if err := RunFenceMigration(ctx, testPool); err != nil {
+		t.Fatalf("RunFenceMigration: %v", err)
+	}
+	_, err := testPool.Exec(ctx, `INSERT INTO write_fences (column_name, reason) VALUES ($1, 'cutover')`, fmt.Sprintf("col-%d", time.Now().UnixNano()))
+	if err != nil {
+		t.Fatalf("insert into write_fences: %v", err)
+	}
+	if err := RunFenceMigration(ctx, testPool); err != nil {
+		t.Fatalf("second RunFenceMigration: %v", err)
+	}
+}
+
+func TestCheckShardHash(t *testing.T) {
+	ctx := context.Background()
+
+	if err := RunShardHashMigration(ctx, testPool); err != nil {
+		t.Fatalf("RunShardHashMigration: %v", err)
+	}
+	xxh := mezzanine.ShardHash{Function: mezzanine.HashXXHash, Seed: 42}
+	if err := CheckShardHash(ctx, testPool, xxh); err != nil {
+		t.Fatalf("first CheckShardHash records the hash: %v", err)
+	}
+	if err := CheckShardHash(ctx, testPool, mezzanine.ShardHash{Function: mezzanine.HashXXHash, Version: 1, Seed: 42}); err != nil {
+		t.Errorf("same hash with its version spelled out: %v", err)
+	}
+	if err := CheckShardHash(ctx, testPool, mezzanine.ShardHash{}); !errors.Is(err, ErrShardHashMismatch) {
+		t.Errorf("other hash: got %v, want ErrShardHashMismatch", err)
+	}
+
+	if err := ReplaceShardHash(ctx, testPool, mezzanine.ShardHash{}); err != nil {
+		t.Fatalf("ReplaceShardHash: %v", err)
+	}
+	if err := CheckShardHash(ctx, testPool, mezzanine.ShardHash{Function: mezzanine.HashFNV1a}); err != nil {
+		t.Errorf("replaced hash: %v", err)
+	}
+	if err := CheckShardHash(ctx, testPool, xxh); !errors.Is(err, ErrShardHashMismatch) {
+		t.Errorf("previous hash after replace: got %v, want ErrShardHashMismatch", err)
+	}
+}
+
+func TestRunShardLeaseMigration(t *testing.T) {
+	ctx := context.Background()
+
+	for range 2 {
+		if err := RunShardLeaseMigration(ctx, testPool, 8); err != nil {
+			t.Fatalf("RunShardLeaseMigration: %v", err)
+		}
+	}
+	var n int
+	if err := testPool.QueryRow(ctx, `SELECT count(*) FROM shard_leases WHERE owner = ''`).Scan(&n); err != nil {
+		t.Fatalf("count shard leases: %v", err)
+	}
+	if n != 8 {
+		t.Errorf("unowned leases: got %d, want 8", n)
+	}
+}
+
+func TestRunReplicationMigration(t *testing.T) {
+	ctx := context.Background()
+
+	for range 2 {
+		if err := RunReplicationMigration(ctx, testPool); err != nil {
+			t.Fatalf("RunReplicationMigration: %v", err)
+		}
+	}
+	if _, err := testPool.Exec(ctx, `INSERT INTO replication_checkpoints (name, shard_id, added_id) VALUES ('t', 0, 5)`); err != nil {
+		t.Fatalf("insert checkpoint: %v", err)
+	}
+}
+
+func TestRunExportMigration(t *testing.T) {
+	ctx := context.Background()
+
+	for range 2 {
+		if err := RunExportMigration(ctx, testPool); err != nil {
+			t.Fatalf("RunExportMigration: %v", err)
+		}
+	}
+	if _, err := testPool.Exec(ctx, `INSERT INTO export_checkpoints (name, shard_id, added_id) VALUES ('t', 0, 5)`); err != nil {
+		t.Fatalf("insert checkpoint: %v", err)
+	}
+}
+
+func TestPostgresCheckpoints(t *testing.T) {
+	ctx := context.Background()
+	if err := RunExportMigration(ctx, testPool); err != nil {
+		t.Fatalf("RunExportMigration: %v", err)
+	}
+	cp := NewPostgresCheckpoints(testPool, ExportCheckpoints, 5*time.Second)
+	const shardID = 7001
+
+	if pos, err := cp.Load(ctx, "warehouse", shardID); err != nil || pos != 0 {
+		t.Fatalf("Load(none) = %d, %v; want 0", pos, err)
+	}
+	if _, ok, err := cp.Lowest(ctx, shardID); err != nil || ok {
+		t.Fatalf("Lowest(none) = %v, %v; want none", ok, err)
+	}
+	for _, save := range []struct {
+		name    string
+		addedID int64
+	}{{"warehouse", 10}, {"warehouse", 40}, {"lake", 25}} {
+		if err := cp.Save(ctx, save.name, shardID, save.addedID); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	if pos, err := cp.Load(ctx, "warehouse", shardID); err != nil || pos != 40 {
+		t.Errorf("Load = %d, %v; want 40", pos, err)
+	}
+	if pos, ok, err := cp.Lowest(ctx, shardID); err != nil || !ok || pos != 25 {
+		t.Errorf("Lowest = %d, %v, %v; want 25", pos, ok, err)
+	}
+}
+
+func TestGetCells(t *testing.T) {
+	store := freshShard(t)
+	ctx := context.Background()
+
+	rowKey := uuid.New()
+	for ref := int64(1); ref <= 3; ref++ {
+		_, err := store.WriteCell(ctx, cell.WriteCellRequest{
+			RowKey: rowKey, ColumnName: "data", RefKey: ref, Body: json.RawMessage(fmt.Sprintf(`{"v":%d}`, ref)),
+		})
+		if err != nil {
+			t.Fatalf("WriteCell: %v", err)
+		}
+	}
+
+	refs := []cell.CellRef{
+		{RowKey: rowKey, ColumnName: "data", RefKey: 3},
+		{RowKey: rowKey, ColumnName: "data", RefKey: 99},
+		{RowKey: rowKey, ColumnName: "data", RefKey: 1},
+	}
+	got, err := store.GetCells(ctx, refs)
+	if err != nil {
+		t.Fatalf("GetCells: %v", err)
+	}
+	if len(got) != len(refs) {
+		t.Fatalf("got %d results, want %d", len(got), len(refs))
+	}
+	if got[0] == nil || got[0].RefKey != 3 {
+		t.Errorf("result 0 = %+v, want ref_key 3", got[0])
+	}
+	if got[1] != nil {
+		t.Errorf("result 1 = %+v, want nil for a missing cell", got[1])
+	}
+	if got[2] == nil || got[2].RefKey != 1 {
+		t.Errorf("result 2 = %+v, want ref_key 1", got[2])
+	}
+
+	if got, err := store.GetCells(ctx, nil); err != nil || got != nil {
+		t.Errorf("GetCells(nil) = %v, %v", got, err)
+	}
+}
+
+func TestStatementCacheCapacity(t *testing.T) {
+	if got := StatementCacheCapacity(64); got < 64*StatementsPerShard {
+		t.Errorf("StatementCacheCapacity(64) = %d, want at least %d", got, 64*StatementsPerShard)
+	}
+}
+
+func TestShardQueries_Count(t *testing.T) {
+	// StatementsPerShard must track the number of queries a store issues.
+	q := reflect.ValueOf(newShardQueries("cells_0000"))
+	if q.NumField() != StatementsPerShard {
+		t.Errorf("shardQueries has %d statements, StatementsPerShard is %d", q.NumField(), StatementsPerShard)
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < q.NumField(); i++ {
+		sql := q.Field(i).String()
+		if !strings.Contains(sql, "cells_0000") || seen[sql] {
+			t.Errorf("statement %s is not a distinct query on the shard table", q.Type().Field(i).Name)
+		}
+		seen[sql] = true
+	}
+}
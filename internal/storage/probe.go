@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+)
+
+// RowSummary describes a row without reading its cells.
+type RowSummary struct {
+	// Columns is the number of columns with at least one version; zero
+	// means the row does not exist.
+	Columns int
+	// UpdatedAt is the created_at of the row's newest cell.
+	UpdatedAt time.Time
+}
+
+// Prober is implemented by stores that can answer presence checks without
+// reading cell bodies. Use ProbeCellLatest and ProbeRow, which fall back to
+// GetCellLatest and GetRow for stores that do not implement it.
+type Prober interface {
+	// ProbeCellLatest is GetCellLatest without the body.
+	ProbeCellLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, error)
+	// ProbeRow summarizes a row, counting its system columns (see
+	// cell.ReservedPrefix) only if withSystem is set.
+	ProbeRow(ctx context.Context, rowKey uuid.UUID, withSystem bool) (RowSummary, error)
+}
+
+// ProbeCellLatest returns the latest version of a cell, possibly without its
+// body, or ErrCellNotFound.
+func ProbeCellLatest(ctx context.Context, store CellStore, rowKey uuid.UUID, columnName string) (*cell.Cell, error) {
+	if p, ok := store.(Prober); ok {
+		return p.ProbeCellLatest(ctx, rowKey, columnName)
+	}
+	return store.GetCellLatest(ctx, rowKey, columnName)
+}
+
+// ProbeRow summarizes a row, with its system columns only if withSystem
+// is set.
+func ProbeRow(ctx context.Context, store CellStore, rowKey uuid.UUID, withSystem bool) (RowSummary, error) {
+	if p, ok := store.(Prober); ok {
+		return p.ProbeRow(ctx, rowKey, withSystem)
+	}
+	cells, err := store.GetRow(ctx, rowKey)
+	if err != nil {
+		return RowSummary{}, err
+	}
+	return SummarizeRow(cells, withSystem), nil
+}
+
+// SummarizeRow builds the RowSummary of cells returned by GetRow, leaving
+// out system columns unless withSystem is set.
+func SummarizeRow(cells []cell.Cell, withSystem bool) RowSummary {
+	var s RowSummary
+	for _, c := range cells {
+		if !withSystem && cell.IsReserved(c.ColumnName) {
+			continue
+		}
+		s.Columns++
+		if c.CreatedAt.After(s.UpdatedAt) {
+			s.UpdatedAt = c.CreatedAt
+		}
+	}
+	return s
+}
@@ -0,0 +1,335 @@
+package storage
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+)
+
+// ErrQueryUnsupported is returned by QueryCells for stores that cannot
+// query cell bodies.
+var ErrQueryUnsupported = errors.New("store does not support queries")
+
+// FieldType is the JSON type a query compares a body field as.
+type FieldType string
+
+const (
+	TypeString  FieldType = "string"
+	TypeNumber  FieldType = "number"
+	TypeBoolean FieldType = "boolean"
+)
+
+// QueryOp is a comparison of a body field with values.
+type QueryOp string
+
+const (
+	QueryEq  QueryOp = "eq"  // field holds the value
+	QueryNe  QueryOp = "ne"  // field does not hold the value, or is missing
+	QueryLt  QueryOp = "lt"  // field is less than the value
+	QueryLte QueryOp = "lte" // field is at most the value
+	QueryGt  QueryOp = "gt"  // field is greater than the value
+	QueryGte QueryOp = "gte" // field is at least the value
+	QueryIn  QueryOp = "in"  // field holds one of the values
+)
+
+// Predicate compares a body field, at a dotted path, as its Type. Only
+// values of that JSON type count: a field holding another type, or null,
+// matches ne and nothing else. Values are strings, float64s or bools to
+// match Type; ordering ops on strings compare bytes.
+type Predicate struct {
+	Field  string
+	Type   FieldType
+	Op     QueryOp
+	Values []any
+}
+
+// QueryOrder sorts query results by a body field, as its Type. Cells
+// without a value of that type come last either way; ties go by row_key.
+type QueryOrder struct {
+	Field string
+	Type  FieldType
+	Desc  bool
+}
+
+// Query selects, among the latest cells of Column on one shard, the first
+// Limit that match every predicate, in row_key order unless OrderBy is set.
+type Query struct {
+	Column  string
+	Where   []Predicate
+	OrderBy *QueryOrder
+	Limit   int
+}
+
+// Check reports an error if an op does not apply to its type or has the
+// wrong number of values, or a value does not have the type.
+func (q Query) Check() error {
+	for _, p := range q.Where {
+		switch p.Op {
+		case QueryEq, QueryNe:
+			if len(p.Values) != 1 {
+				return fmt.Errorf("%s on %q takes one value", p.Op, p.Field)
+			}
+		case QueryLt, QueryLte, QueryGt, QueryGte:
+			if p.Type == TypeBoolean {
+				return fmt.Errorf("%s on %q: booleans are not ordered", p.Op, p.Field)
+			}
+			if len(p.Values) != 1 {
+				return fmt.Errorf("%s on %q takes one value", p.Op, p.Field)
+			}
+		case QueryIn:
+			if len(p.Values) == 0 {
+				return fmt.Errorf("in on %q takes at least one value", p.Field)
+			}
+		default:
+			return fmt.Errorf("unknown op %q on %q", p.Op, p.Field)
+		}
+		for _, v := range p.Values {
+			if !hasType(v, p.Type) {
+				return fmt.Errorf("%s on %q: value %v is not a %s", p.Op, p.Field, v, p.Type)
+			}
+		}
+	}
+	if o := q.OrderBy; o != nil && o.Type == TypeBoolean {
+		return fmt.Errorf("order by %q: booleans are not ordered", o.Field)
+	}
+	return nil
+}
+
+func hasType(v any, t FieldType) bool {
+	switch v.(type) {
+	case string:
+		return t == TypeString
+	case float64:
+		return t == TypeNumber
+	case bool:
+		return t == TypeBoolean
+	}
+	return false
+}
+
+// Querier is implemented by stores that can query the latest cells of a
+// column by their bodies. Use QueryCells, which fails with
+// ErrQueryUnsupported for stores that do not implement it.
+type Querier interface {
+	QueryCells(ctx context.Context, q Query) ([]cell.Cell, error)
+}
+
+// QueryCells runs a checked query on store.
+func QueryCells(ctx context.Context, store CellStore, q Query) ([]cell.Cell, error) {
+	if s, ok := store.(Querier); ok {
+		return s.QueryCells(ctx, q)
+	}
+	return nil, ErrQueryUnsupported
+}
+
+// fieldValue returns the value of the field at a dotted path of body, if it
+// has type t.
+func fieldValue(body json.RawMessage, path string, t FieldType) (any, bool) {
+	raw := body
+	for _, name := range strings.Split(path, ".") {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return nil, false
+		}
+		var ok bool
+		if raw, ok = obj[name]; !ok {
+			return nil, false
+		}
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil || !hasType(v, t) {
+		return nil, false
+	}
+	return v, true
+}
+
+// compareValues compares two values of one type.
+func compareValues(a, b any) int {
+	switch a := a.(type) {
+	case string:
+		return strings.Compare(a, b.(string))
+	case float64:
+		return cmp.Compare(a, b.(float64))
+	case bool:
+		if a == b.(bool) {
+			return 0
+		}
+		if a {
+			return 1
+		}
+		return -1
+	}
+	return 0
+}
+
+// Match reports whether body satisfies the predicate, with the same
+// semantics as the SQL PostgresStore runs, for stores that query in memory.
+func (p Predicate) Match(body json.RawMessage) bool {
+	v, ok := fieldValue(body, p.Field, p.Type)
+	if p.Op == QueryNe {
+		return !ok || compareValues(v, p.Values[0]) != 0
+	}
+	if !ok {
+		return false
+	}
+	switch p.Op {
+	case QueryEq:
+		return compareValues(v, p.Values[0]) == 0
+	case QueryLt:
+		return compareValues(v, p.Values[0]) < 0
+	case QueryLte:
+		return compareValues(v, p.Values[0]) <= 0
+	case QueryGt:
+		return compareValues(v, p.Values[0]) > 0
+	case QueryGte:
+		return compareValues(v, p.Values[0]) >= 0
+	case QueryIn:
+		return slices.ContainsFunc(p.Values, func(w any) bool { return compareValues(v, w) == 0 })
+	}
+	return false
+}
+
+// SortQueryResults sorts cells as q orders them, for stores that query in
+// memory.
+func SortQueryResults(cells []cell.Cell, q Query) {
+	byRow := func(a, b cell.Cell) int { return bytes.Compare(a.RowKey[:], b.RowKey[:]) }
+	o := q.OrderBy
+	if o == nil {
+		slices.SortFunc(cells, byRow)
+		return
+	}
+	slices.SortFunc(cells, func(a, b cell.Cell) int {
+		va, oka := fieldValue(a.Body, o.Field, o.Type)
+		vb, okb := fieldValue(b.Body, o.Field, o.Type)
+		switch {
+		case oka && okb:
+			c := compareValues(va, vb)
+			if o.Desc {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		case oka:
+			return -1
+		case okb:
+			return 1
+		}
+		return byRow(a, b)
+	})
+}
+
+// queryOps renders ops as SQL operators.
+var queryOps = map[QueryOp]string{QueryEq: "=", QueryLt: "<", QueryLte: "<=", QueryGt: ">", QueryGte: ">="}
+
+// QueryCells implements Querier. Field paths and values are bound as
+// parameters, so nothing from the query is spliced into the SQL. Query
+// shapes vary, so they are run unprepared rather than crowding the shard's
+// hot statements out of the statement cache.
+func (s *PostgresStore) QueryCells(ctx context.Context, q Query) ([]cell.Cell, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	args := []any{pgx.QueryExecModeExec, q.Column}
+	param := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args)-1)
+	}
+	// value renders a field as SQL of its type: NULL unless the body holds
+	// a value of that type there.
+	value := func(field string, t FieldType) string {
+		p := param(strings.Split(field, ".")) + "::text[]"
+		switch t {
+		case TypeNumber:
+			return fmt.Sprintf("(CASE WHEN jsonb_typeof(body #> %s) = 'number' THEN (body #>> %s)::float8 END)", p, p)
+		case TypeBoolean:
+			return fmt.Sprintf("(CASE WHEN jsonb_typeof(body #> %s) = 'boolean' THEN (body #>> %s)::boolean END)", p, p)
+		}
+		return fmt.Sprintf(`(CASE WHEN jsonb_typeof(body #> %s) = 'string' THEN body #>> %s END) COLLATE "C"`, p, p)
+	}
+	sqlType := map[FieldType]string{TypeString: "text", TypeNumber: "float8", TypeBoolean: "boolean"}
+
+	var where strings.Builder
+	for _, p := range q.Where {
+		v := value(p.Field, p.Type)
+		switch p.Op {
+		case QueryNe:
+			fmt.Fprintf(&where, " AND %s IS DISTINCT FROM %s::%s", v, param(p.Values[0]), sqlType[p.Type])
+		case QueryIn:
+			fmt.Fprintf(&where, " AND %s = ANY(%s::%s[])", v, param(typedSlice(p.Type, p.Values)), sqlType[p.Type])
+		default:
+			fmt.Fprintf(&where, " AND %s %s %s::%s", v, queryOps[p.Op], param(p.Values[0]), sqlType[p.Type])
+		}
+	}
+	order := "row_key"
+	if o := q.OrderBy; o != nil {
+		dir := "ASC"
+		if o.Desc {
+			dir = "DESC"
+		}
+		order = fmt.Sprintf("%s %s NULLS LAST, row_key", value(o.Field, o.Type), dir)
+	}
+
+	from := s.q.queryFrom
+	if s.latestTable {
+		from = s.q.queryLatestFrom
+	}
+	query := fmt.Sprintf(`
+		SELECT added_id, row_key, column_name, ref_key, body, created_at
+		FROM %s
+		WHERE column_name = $1%s
+		ORDER BY %s
+		LIMIT %s
+	`, from, where.String(), order, param(q.Limit))
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query cells: %w", err)
+	}
+	defer rows.Close()
+
+	var cells []cell.Cell
+	for rows.Next() {
+		var c cell.Cell
+		if err := rows.Scan(&c.AddedID, &c.RowKey, &c.ColumnName, &c.RefKey, &c.Body, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("query cells scan: %w", err)
+		}
+		cells = append(cells, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query cells: %w", err)
+	}
+	return cells, nil
+}
+
+// typedSlice converts the values of an in predicate to a slice pgx encodes
+// as an array of type t.
+func typedSlice(t FieldType, values []any) any {
+	switch t {
+	case TypeNumber:
+		out := make([]float64, len(values))
+		for i, v := range values {
+			out[i] = v.(float64)
+		}
+		return out
+	case TypeBoolean:
+		out := make([]bool, len(values))
+		for i, v := range values {
+			out[i] = v.(bool)
+		}
+		return out
+	}
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = v.(string)
+	}
+	return out
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	mezzanine "github.com/ryanbastic/go-mezzanine/pkg/mezzanine"
+)
+
+// ErrShardHashMismatch is returned by CheckShardHash when the cluster's
+// recorded shard hash is not the one it was given.
+var ErrShardHashMismatch = errors.New("shard hash does not match the one recorded for the cluster")
+
+// RunShardHashMigration creates the single-row table recording the hash the
+// cluster's keys were placed on shards with (see CheckShardHash).
+func RunShardHashMigration(ctx context.Context, db DB) error {
+	ddl := `
+		CREATE TABLE IF NOT EXISTS shard_hash (
+			id          BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+			hash        TEXT NOT NULL,
+			recorded_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+	`
+	if _, err := db.Exec(ctx, ddl); err != nil {
+		return fmt.Errorf("migrate shard hash table: %w", err)
+	}
+	return nil
+}
+
+// CheckShardHash records h as the cluster's shard hash if none is recorded
+// yet, and returns ErrShardHashMismatch if another one is. Hashes are
+// compared by their String, so an unset function or version equals its
+// default.
+func CheckShardHash(ctx context.Context, pool *pgxpool.Pool, h mezzanine.ShardHash) error {
+	if _, err := pool.Exec(ctx, `INSERT INTO shard_hash (hash) VALUES ($1) ON CONFLICT (id) DO NOTHING`, h.String()); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "42P01" {
+			return errors.New("record shard hash: the shard_hash table does not exist; run `mezzanine migrate`")
+		}
+		return fmt.Errorf("record shard hash: %w", err)
+	}
+	var recorded string
+	if err := pool.QueryRow(ctx, `SELECT hash FROM shard_hash`).Scan(&recorded); err != nil {
+		return fmt.Errorf("read shard hash: %w", err)
+	}
+	if recorded != h.String() {
+		return fmt.Errorf("%w: the shard config has %s but the cluster's keys were placed with %s", ErrShardHashMismatch, h, recorded)
+	}
+	return nil
+}
+
+// ReplaceShardHash records h as the cluster's shard hash, whatever was
+// recorded before. It is for switching a cluster onto a shard config its
+// data was resharded onto with another hash.
+func ReplaceShardHash(ctx context.Context, pool *pgxpool.Pool, h mezzanine.ShardHash) error {
+	if _, err := pool.Exec(ctx, `
+		INSERT INTO shard_hash (hash) VALUES ($1)
+		ON CONFLICT (id) DO UPDATE SET hash = EXCLUDED.hash, recorded_at = now()
+	`, h.String()); err != nil {
+		return fmt.Errorf("replace shard hash: %w", err)
+	}
+	return nil
+}
@@ -12,24 +12,117 @@ import (
 // ErrCellNotFound is returned when a cell lookup finds no matching row.
 var ErrCellNotFound = errors.New("cell not found")
 
+// ErrCellExists is returned when a write targets a (row_key, column_name,
+// ref_key) that is already stored. Cells are immutable, so the write is rejected.
+var ErrCellExists = errors.New("cell already exists")
+
 // CellStore is the primary storage interface for a single shard.
 type CellStore interface {
 	// WriteCell inserts a new immutable cell. Returns the stored cell with added_id.
 	WriteCell(ctx context.Context, req cell.WriteCellRequest) (*cell.Cell, error)
 
+	// WriteCells inserts a batch of cells atomically: if any cell already
+	// exists (ErrCellExists) or fails, none are written. Returns the stored
+	// cells in request order.
+	WriteCells(ctx context.Context, reqs []cell.WriteCellRequest) ([]cell.Cell, error)
+
 	// GetCell returns the cell at an exact (row_key, column_name, ref_key).
 	GetCell(ctx context.Context, ref cell.CellRef) (*cell.Cell, error)
 
+	// GetCells returns the cells at refs, in request order, with nil for refs
+	// that do not exist. Implementations should fetch them together;
+	// PostgresStore pipelines the lookups in one round trip.
+	GetCells(ctx context.Context, refs []cell.CellRef) ([]*cell.Cell, error)
+
 	// GetCellLatest returns the cell with the highest ref_key for (row_key, column_name).
 	GetCellLatest(ctx context.Context, rowKey uuid.UUID, columnName string) (*cell.Cell, error)
 
 	// GetRow returns the latest cell for every column_name in a row.
 	GetRow(ctx context.Context, rowKey uuid.UUID) ([]cell.Cell, error)
 
-	// PartitionRead reads a partition of cells.
+	// GetRows is GetRow for many rows at once, keyed by row_key. Rows without
+	// cells are left out. PostgresStore reads them with a single query.
+	GetRows(ctx context.Context, rowKeys []uuid.UUID) (map[uuid.UUID][]cell.Cell, error)
+
+	// PartitionRead reads a partition of cells. By added_id, pages are
+	// gap-free and monotonic: a cell is only returned once every cell with a
+	// lower added_id that will ever commit has, so a reader resuming after
+	// the last cell it saw never skips one, however writes interleave.
 	PartitionRead(ctx context.Context, partitionNumber int, readType int, addedID int64, createdAfter time.Time, limit int) ([]cell.Cell, error)
 
 	// ScanCells returns cells with added_id > afterAddedID for a given column,
-	// ordered by added_id ASC. Used by the trigger framework.
+	// ordered by added_id ASC. Used by the trigger framework. Like
+	// PartitionRead by added_id, it never skips a cell committed late.
 	ScanCells(ctx context.Context, columnName string, afterAddedID int64, limit int) ([]cell.Cell, error)
+
+	// ScanCellsWindow returns cells of a column created in [from, to),
+	// ordered by (created_at, added_id). Cells created exactly at from are
+	// only returned if their added_id is greater than afterAddedID, so the
+	// next page starts at the last cell's created_at and added_id.
+	ScanCellsWindow(ctx context.Context, columnName string, from, to time.Time, afterAddedID int64, limit int) ([]cell.Cell, error)
+
+	// Head returns the shard's write position: the added_id and created_at
+	// of its newest cell PartitionRead returns, zero if it has none.
+	Head(ctx context.Context) (Head, error)
+}
+
+// Head is a shard's write position. A reader that has reached AddedID has
+// seen every cell committed before Head was read; cells above it may
+// already be committed but held back behind slower transactions.
+type Head struct {
+	AddedID   int64     `json:"added_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CommittedHeader is implemented by stores whose Head is held back behind
+// transactions in progress. Use CommittedHead, which falls back to Head for
+// stores that do not implement it.
+type CommittedHeader interface {
+	// CommittedHead returns the highest added_id committed, though a
+	// slower transaction may still commit a lower one.
+	CommittedHead(ctx context.Context) (int64, error)
+}
+
+// CommittedHead returns the highest added_id committed on store. A reader
+// that has reached it has been through every cell committed before it was
+// read, which Head, trailing the transactions in progress, cannot tell.
+func CommittedHead(ctx context.Context, store CellStore) (int64, error) {
+	if s, ok := store.(CommittedHeader); ok {
+		return s.CommittedHead(ctx)
+	}
+	h, err := store.Head(ctx)
+	return h.AddedID, err
+}
+
+// CommitLogScanner is implemented by stores that can keep a commit log
+// (see RunCommitLogMigration). Use ScanCommitLog, which reports
+// ErrNoCommitLog for stores that do not implement it.
+type CommitLogScanner interface {
+	// ScanCommitLog returns up to limit cells with added_id >= fromAddedID
+	// logged after afterSeq, in commit order with CommitSeq set, and the
+	// lowest added_id >= fromAddedID logged after the last of them, 0 if
+	// there is none. It returns ErrNoCommitLog if the store keeps no log.
+	ScanCommitLog(ctx context.Context, fromAddedID, afterSeq int64, limit int) ([]cell.Cell, int64, error)
+}
+
+// ScanCommitLog reads store's commit log with its CommitLogScanner.
+func ScanCommitLog(ctx context.Context, store CellStore, fromAddedID, afterSeq int64, limit int) ([]cell.Cell, int64, error) {
+	if s, ok := store.(CommitLogScanner); ok {
+		return s.ScanCommitLog(ctx, fromAddedID, afterSeq, limit)
+	}
+	return nil, 0, ErrNoCommitLog
+}
+
+type freshReadKey struct{}
+
+// WithFreshRead marks reads made with ctx as having to reflect every write
+// committed before them, so read caches pass them to the store.
+func WithFreshRead(ctx context.Context) context.Context {
+	return context.WithValue(ctx, freshReadKey{}, true)
+}
+
+// FreshRead reports whether ctx was marked by WithFreshRead.
+func FreshRead(ctx context.Context) bool {
+	fresh, _ := ctx.Value(freshReadKey{}).(bool)
+	return fresh
 }
@@ -0,0 +1,62 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// Log is a shard's history, for tests of the readers that tail it, such
+// as replication, export and search indexing. It serves PartitionRead by
+// added_id from Cells, which must be in added_id order; other methods go
+// to the embedded CellStore, nil unless set.
+type Log struct {
+	storage.CellStore
+	Cells []cell.Cell
+}
+
+func (l *Log) PartitionRead(_ context.Context, _ int, readType int, addedID int64, _ time.Time, limit int) ([]cell.Cell, error) {
+	if readType != storage.PartitionReadTypeAddedID {
+		return nil, errors.New("unexpected read type")
+	}
+	var out []cell.Cell
+	for _, c := range l.Cells {
+		if c.AddedID > addedID && len(out) < limit {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+// Checkpoints is a storage.Checkpoints in memory for a single reader: it
+// keeps one position per shard, whatever the name. The zero value is
+// ready to use.
+type Checkpoints struct {
+	mu  sync.Mutex
+	pos map[int]int64
+}
+
+func (c *Checkpoints) Load(_ context.Context, _ string, shardID int) (int64, error) {
+	return c.Position(shardID), nil
+}
+
+func (c *Checkpoints) Save(_ context.Context, _ string, shardID int, addedID int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pos == nil {
+		c.pos = make(map[int]int64)
+	}
+	c.pos[shardID] = addedID
+	return nil
+}
+
+// Position returns the position saved for shardID, 0 if none is.
+func (c *Checkpoints) Position(shardID int) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pos[shardID]
+}
@@ -0,0 +1,811 @@
+// Package storetest is a conformance suite for storage.CellStore
+// implementations. Every backend runs it, so one cannot drift from the
+// others in the behavior the API, triggers, replication and export rely
+// on: ordering, pagination, duplicate and not-found errors, atomic batches
+// and honoring the context.
+//
+//	func TestConformance(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) storage.CellStore { return newEmptyStore(t) })
+//	}
+//
+// It also has the fakes shared by tests of the readers that tail shards'
+// history: Log and Checkpoints.
+package storetest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// Run runs the suite. newStore must return an empty store for one shard
+// each time it is called.
+func Run(t *testing.T, newStore func(t *testing.T) storage.CellStore) {
+	for _, tc := range []struct {
+		name string
+		fn   func(*testing.T, storage.CellStore)
+	}{
+		{"WriteAndGet", testWriteAndGet},
+		{"DuplicateRefKey", testDuplicateRefKey},
+		{"WriteCellsOrder", testWriteCellsOrder},
+		{"WriteCellsAtomic", testWriteCellsAtomic},
+		{"NotFound", testNotFound},
+		{"LatestByRefKey", testLatestByRefKey},
+		{"Rows", testRows},
+		{"RowColumns", testRowColumns},
+		{"ScanCells", testScanCells},
+		{"ScanCellsWindowPages", testScanCellsWindowPages},
+		{"PartitionReadPages", testPartitionReadPages},
+		{"PartitionReadConcurrentWrites", testPartitionReadConcurrentWrites},
+		{"PartitionReadInvalidType", testPartitionReadInvalidType},
+		{"Head", testHead},
+		{"Blobs", testBlobs},
+		{"UpdateCell", testUpdateCell},
+		{"Aliases", testAliases},
+		{"RowTags", testRowTags},
+		{"IdempotencyKeys", testIdempotencyKeys},
+		{"QueryCells", testQueryCells},
+		{"CanceledContext", testCanceledContext},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.fn(t, newStore(t))
+		})
+	}
+}
+
+func req(row uuid.UUID, column string, ref int64, body string) cell.WriteCellRequest {
+	return cell.WriteCellRequest{RowKey: row, ColumnName: column, RefKey: ref, Body: json.RawMessage(body)}
+}
+
+func write(t *testing.T, store storage.CellStore, reqs ...cell.WriteCellRequest) []cell.Cell {
+	t.Helper()
+	out := make([]cell.Cell, len(reqs))
+	for i, r := range reqs {
+		c, err := store.WriteCell(context.Background(), r)
+		if err != nil {
+			t.Fatalf("WriteCell(%s/%s/%d): %v", r.RowKey, r.ColumnName, r.RefKey, err)
+		}
+		out[i] = *c
+	}
+	return out
+}
+
+// sameJSON reports whether two bodies hold the same JSON value. Stores may
+// normalize a body, as jsonb does with whitespace and key order.
+func sameJSON(t *testing.T, got, want json.RawMessage) bool {
+	t.Helper()
+	var g, w any
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("stored body %s is not JSON: %v", got, err)
+	}
+	if err := json.Unmarshal(want, &w); err != nil {
+		t.Fatalf("body %s is not JSON: %v", want, err)
+	}
+	return reflect.DeepEqual(g, w)
+}
+
+func addedIDs(cells []cell.Cell) []int64 {
+	ids := make([]int64, len(cells))
+	for i, c := range cells {
+		ids[i] = c.AddedID
+	}
+	return ids
+}
+
+func testWriteAndGet(t *testing.T, store storage.CellStore) {
+	ctx := context.Background()
+	row := uuid.New()
+	body := `{"name": "alice", "tags": ["a", "b"], "n": 1}`
+	c, err := store.WriteCell(ctx, req(row, "profile", 1, body))
+	if err != nil {
+		t.Fatalf("WriteCell: %v", err)
+	}
+	if c.AddedID <= 0 || c.CreatedAt.IsZero() {
+		t.Errorf("written cell: got added_id %d, created_at %v, want both set", c.AddedID, c.CreatedAt)
+	}
+	if c.RowKey != row || c.ColumnName != "profile" || c.RefKey != 1 || !sameJSON(t, c.Body, json.RawMessage(body)) {
+		t.Errorf("written cell: got %+v", c)
+	}
+
+	got, err := store.GetCell(ctx, cell.CellRef{RowKey: row, ColumnName: "profile", RefKey: 1})
+	if err != nil {
+		t.Fatalf("GetCell: %v", err)
+	}
+	if got.AddedID != c.AddedID || !got.CreatedAt.Equal(c.CreatedAt) || !sameJSON(t, got.Body, c.Body) {
+		t.Errorf("GetCell: got %+v, want %+v", got, c)
+	}
+
+	next := write(t, store, req(row, "profile", 2, `{}`))[0]
+	if next.AddedID <= c.AddedID {
+		t.Errorf("added_id: got %d after %d, want it to increase", next.AddedID, c.AddedID)
+	}
+	if next.CreatedAt.Before(c.CreatedAt) {
+		t.Errorf("created_at: got %v after %v, want it not to go back", next.CreatedAt, c.CreatedAt)
+	}
+}
+
+func testDuplicateRefKey(t *testing.T, store storage.CellStore) {
+	ctx := context.Background()
+	row := uuid.New()
+	first := write(t, store, req(row, "profile", 1, `{"v":1}`))[0]
+	if _, err := store.WriteCell(ctx, req(row, "profile", 1, `{"v":2}`)); !errors.Is(err, storage.ErrCellExists) {
+		t.Errorf("duplicate WriteCell: got %v, want ErrCellExists", err)
+	}
+	got, err := store.GetCell(ctx, cell.CellRef{RowKey: row, ColumnName: "profile", RefKey: 1})
+	if err != nil {
+		t.Fatalf("GetCell: %v", err)
+	}
+	if got.AddedID != first.AddedID || !sameJSON(t, got.Body, json.RawMessage(`{"v":1}`)) {
+		t.Errorf("duplicate overwrote the cell: got %+v", got)
+	}
+	// The same ref_key in another column or row is a different cell.
+	write(t, store, req(row, "orders", 1, `{}`), req(uuid.New(), "profile", 1, `{}`))
+}
+
+func testWriteCellsOrder(t *testing.T, store storage.CellStore) {
+	ctx := context.Background()
+	rows := []uuid.UUID{uuid.New(), uuid.New()}
+	reqs := []cell.WriteCellRequest{req(rows[1], "b", 1, `{"i":0}`), req(rows[0], "a", 1, `{"i":1}`), req(rows[1], "a", 1, `{"i":2}`)}
+	cells, err := store.WriteCells(ctx, reqs)
+	if err != nil {
+		t.Fatalf("WriteCells: %v", err)
+	}
+	if len(cells) != len(reqs) {
+		t.Fatalf("WriteCells: got %d cells, want %d", len(cells), len(reqs))
+	}
+	for i, c := range cells {
+		if c.RowKey != reqs[i].RowKey || c.ColumnName != reqs[i].ColumnName || !sameJSON(t, c.Body, reqs[i].Body) {
+			t.Errorf("cell %d: got %+v, want request order", i, c)
+		}
+		if i > 0 && c.AddedID <= cells[i-1].AddedID {
+			t.Errorf("added_ids %v do not increase in request order", addedIDs(cells))
+		}
+	}
+
+	empty, err := store.WriteCells(ctx, nil)
+	if err != nil || len(empty) != 0 {
+		t.Errorf("empty WriteCells: got %v, %v, want nothing", empty, err)
+	}
+}
+
+func testWriteCellsAtomic(t *testing.T, store storage.CellStore) {
+	ctx := context.Background()
+	row := uuid.New()
+	write(t, store, req(row, "a", 1, `{}`))
+	for name, reqs := range map[string][]cell.WriteCellRequest{
+		"existing cell":  {req(row, "b", 1, `{}`), req(row, "a", 1, `{}`)},
+		"within a batch": {req(row, "c", 1, `{}`), req(row, "c", 1, `{}`)},
+	} {
+		if _, err := store.WriteCells(ctx, reqs); !errors.Is(err, storage.ErrCellExists) {
+			t.Errorf("%s: got %v, want ErrCellExists", name, err)
+		}
+	}
+	cells, err := store.GetRow(ctx, row)
+	if err != nil {
+		t.Fatalf("GetRow: %v", err)
+	}
+	if len(cells) != 1 {
+		t.Errorf("failed batches stored cells: row has %d columns, want 1", len(cells))
+	}
+}
+
+func testNotFound(t *testing.T, store storage.CellStore) {
+	ctx := context.Background()
+	row := uuid.New()
+	write(t, store, req(row, "a", 1, `{}`))
+
+	if _, err := store.GetCell(ctx, cell.CellRef{RowKey: row, ColumnName: "a", RefKey: 2}); !errors.Is(err, storage.ErrCellNotFound) {
+		t.Errorf("GetCell: got %v, want ErrCellNotFound", err)
+	}
+	if _, err := store.GetCellLatest(ctx, row, "b"); !errors.Is(err, storage.ErrCellNotFound) {
+		t.Errorf("GetCellLatest: got %v, want ErrCellNotFound", err)
+	}
+	got, err := store.GetCells(ctx, []cell.CellRef{
+		{RowKey: row, ColumnName: "a", RefKey: 2},
+		{RowKey: row, ColumnName: "a", RefKey: 1},
+		{RowKey: uuid.New(), ColumnName: "a", RefKey: 1},
+	})
+	if err != nil {
+		t.Fatalf("GetCells: %v", err)
+	}
+	if len(got) != 3 || got[0] != nil || got[1] == nil || got[1].RefKey != 1 || got[2] != nil {
+		t.Errorf("GetCells: got %v, want nil, the cell and nil in request order", got)
+	}
+}
+
+func testLatestByRefKey(t *testing.T, store storage.CellStore) {
+	ctx := context.Background()
+	row := uuid.New()
+	// Versions may arrive out of order: the latest has the highest ref_key,
+	// not the highest added_id.
+	write(t, store, req(row, "a", 5, `{"v":5}`), req(row, "a", 9, `{"v":9}`), req(row, "a", 7, `{"v":7}`))
+	got, err := store.GetCellLatest(ctx, row, "a")
+	if err != nil {
+		t.Fatalf("GetCellLatest: %v", err)
+	}
+	if got.RefKey != 9 || !sameJSON(t, got.Body, json.RawMessage(`{"v":9}`)) {
+		t.Errorf("GetCellLatest: got ref_key %d, want 9", got.RefKey)
+	}
+}
+
+func testBlobs(t *testing.T, store storage.CellStore) {
+	if _, ok := store.(storage.BlobStore); !ok {
+		t.Skip("store does not support binary cells")
+	}
+	ctx := context.Background()
+	row := uuid.New()
+	data := []byte{0x89, 'P', 'N', 'G', 0, 0xff}
+	body := cell.BlobBody("image/png", data)
+	c, err := storage.WriteBlob(ctx, store, cell.WriteCellRequest{RowKey: row, ColumnName: "avatar", RefKey: 1, Body: body}, data)
+	if err != nil {
+		t.Fatalf("WriteBlob: %v", err)
+	}
+	if _, err := storage.WriteBlob(ctx, store, cell.WriteCellRequest{RowKey: row, ColumnName: "avatar", RefKey: 1, Body: body}, data); !errors.Is(err, storage.ErrCellExists) {
+		t.Errorf("duplicate WriteBlob: got %v, want ErrCellExists", err)
+	}
+	write(t, store, req(row, "profile", 1, `{"name":"alice"}`))
+
+	got, gotData, err := storage.GetBlob(ctx, store, cell.CellRef{RowKey: row, ColumnName: "avatar", RefKey: 1})
+	if err != nil || got.AddedID != c.AddedID || !sameJSON(t, got.Body, body) || string(gotData) != string(data) {
+		t.Errorf("GetBlob: got %+v, %x, %v", got, gotData, err)
+	}
+	if got, gotData, err := storage.GetBlobLatest(ctx, store, row, "avatar"); err != nil || got.RefKey != 1 || string(gotData) != string(data) {
+		t.Errorf("GetBlobLatest: got %+v, %x, %v", got, gotData, err)
+	}
+	// A binary cell reads as its body everywhere else.
+	if got, err := store.GetCellLatest(ctx, row, "avatar"); err != nil || !sameJSON(t, got.Body, body) {
+		t.Errorf("GetCellLatest: got %+v, %v", got, err)
+	}
+	if _, gotData, err := storage.GetBlobLatest(ctx, store, row, "profile"); err != nil || gotData != nil {
+		t.Errorf("GetBlobLatest of a JSON cell: got %x, %v; want no bytes", gotData, err)
+	}
+	if _, _, err := storage.GetBlob(ctx, store, cell.CellRef{RowKey: row, ColumnName: "avatar", RefKey: 2}); !errors.Is(err, storage.ErrCellNotFound) {
+		t.Errorf("GetBlob of a missing cell: got %v, want ErrCellNotFound", err)
+	}
+}
+
+func testRows(t *testing.T, store storage.CellStore) {
+	ctx := context.Background()
+	rows := []uuid.UUID{uuid.New(), uuid.New()}
+	write(t, store,
+		req(rows[0], "orders", 1, `{}`),
+		req(rows[0], "profile", 2, `{}`),
+		req(rows[0], "profile", 1, `{}`),
+		req(rows[0], "billing", 1, `{}`),
+		req(rows[1], "profile", 1, `{}`),
+	)
+
+	cells, err := store.GetRow(ctx, rows[0])
+	if err != nil {
+		t.Fatalf("GetRow: %v", err)
+	}
+	var got []string
+	for _, c := range cells {
+		got = append(got, c.ColumnName)
+		if c.ColumnName == "profile" && c.RefKey != 2 {
+			t.Errorf("GetRow: profile has ref_key %d, want the latest, 2", c.RefKey)
+		}
+	}
+	if want := []string{"billing", "orders", "profile"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetRow columns: got %v, want %v in column order", got, want)
+	}
+
+	empty, err := store.GetRow(ctx, uuid.New())
+	if err != nil || len(empty) != 0 {
+		t.Errorf("GetRow(missing): got %v, %v, want no cells", empty, err)
+	}
+
+	missing := uuid.New()
+	byRow, err := store.GetRows(ctx, []uuid.UUID{rows[0], rows[1], missing})
+	if err != nil {
+		t.Fatalf("GetRows: %v", err)
+	}
+	if len(byRow) != 2 || len(byRow[rows[0]]) != 3 || len(byRow[rows[1]]) != 1 {
+		t.Errorf("GetRows: got %d rows, want the 2 with cells", len(byRow))
+	}
+	if _, ok := byRow[missing]; ok {
+		t.Error("GetRows included a row without cells")
+	}
+}
+
+func testRowColumns(t *testing.T, store storage.CellStore) {
+	ctx := context.Background()
+	row := uuid.New()
+	write(t, store,
+		req(row, "orders", 1, `{}`),
+		req(row, "profile", 1, `{}`),
+		req(row, "profile", 2, `{}`),
+		req(row, "billing", 1, `{}`),
+	)
+
+	it, err := storage.StreamRowColumns(ctx, store, row, []string{"profile", "billing", "missing"})
+	if err != nil {
+		t.Fatalf("StreamRowColumns: %v", err)
+	}
+	defer it.Close()
+	var got []string
+	for it.Next() {
+		c := it.Cell()
+		got = append(got, c.ColumnName)
+		if c.ColumnName == "profile" && c.RefKey != 2 {
+			t.Errorf("StreamRowColumns: profile has ref_key %d, want the latest, 2", c.RefKey)
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if want := []string{"billing", "profile"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("StreamRowColumns columns: got %v, want %v in column order", got, want)
+	}
+}
+
+func testScanCells(t *testing.T, store storage.CellStore) {
+	ctx := context.Background()
+	row := uuid.New()
+	var want []int64
+	for i, column := range []string{"a", "b", "a", "a", "b", "a"} {
+		c := write(t, store, req(row, column, int64(i), `{}`))[0]
+		if column == "a" {
+			want = append(want, c.AddedID)
+		}
+	}
+
+	all, err := store.ScanCells(ctx, "a", 0, 100)
+	if err != nil {
+		t.Fatalf("ScanCells: %v", err)
+	}
+	if !reflect.DeepEqual(addedIDs(all), want) {
+		t.Errorf("ScanCells: got added_ids %v, want %v", addedIDs(all), want)
+	}
+
+	var paged []int64
+	for after := int64(0); ; {
+		page, err := store.ScanCells(ctx, "a", after, 3)
+		if err != nil {
+			t.Fatalf("ScanCells: %v", err)
+		}
+		if len(page) > 3 {
+			t.Fatalf("ScanCells: got %d cells, want at most the limit of 3", len(page))
+		}
+		if len(page) == 0 {
+			break
+		}
+		paged = append(paged, addedIDs(page)...)
+		after = page[len(page)-1].AddedID
+	}
+	if !reflect.DeepEqual(paged, want) {
+		t.Errorf("paged ScanCells: got added_ids %v, want %v", paged, want)
+	}
+}
+
+func testScanCellsWindowPages(t *testing.T, store storage.CellStore) {
+	ctx := context.Background()
+	row := uuid.New()
+	from := time.Now().Add(-time.Hour)
+	to := time.Now().Add(time.Hour)
+	// A batch shares one created_at in PostgresStore, so pages must resume
+	// within a timestamp.
+	batch := make([]cell.WriteCellRequest, 5)
+	for i := range batch {
+		batch[i] = req(row, "a", int64(i), `{}`)
+	}
+	cells, err := store.WriteCells(ctx, batch)
+	if err != nil {
+		t.Fatalf("WriteCells: %v", err)
+	}
+	want := addedIDs(cells)
+	want = append(want, write(t, store, req(row, "b", 1, `{}`), req(row, "a", 10, `{}`))[1].AddedID)
+
+	var paged []int64
+	cursor, after := from, int64(0)
+	for range 10 {
+		page, err := store.ScanCellsWindow(ctx, "a", cursor, to, after, 2)
+		if err != nil {
+			t.Fatalf("ScanCellsWindow: %v", err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		paged = append(paged, addedIDs(page)...)
+		last := page[len(page)-1]
+		cursor, after = last.CreatedAt, last.AddedID
+	}
+	if !reflect.DeepEqual(paged, want) {
+		t.Errorf("paged ScanCellsWindow: got added_ids %v, want %v", paged, want)
+	}
+
+	if page, err := store.ScanCellsWindow(ctx, "a", to, to.Add(time.Hour), 0, 10); err != nil || len(page) != 0 {
+		t.Errorf("ScanCellsWindow after the writes: got %v, %v, want no cells", page, err)
+	}
+}
+
+func testPartitionReadPages(t *testing.T, store storage.CellStore) {
+	ctx := context.Background()
+	var want []int64
+	for i := range 7 {
+		want = append(want, write(t, store, req(uuid.New(), "a", int64(i), `{}`))[0].AddedID)
+	}
+
+	var paged []int64
+	for after := int64(0); ; {
+		page, err := store.PartitionRead(ctx, 0, storage.PartitionReadTypeAddedID, after, time.Time{}, 3)
+		if err != nil {
+			t.Fatalf("PartitionRead: %v", err)
+		}
+		if len(page) > 3 {
+			t.Fatalf("PartitionRead: got %d cells, want at most the limit of 3", len(page))
+		}
+		if len(page) == 0 {
+			break
+		}
+		paged = append(paged, addedIDs(page)...)
+		after = page[len(page)-1].AddedID
+	}
+	if !reflect.DeepEqual(paged, want) {
+		t.Errorf("paged PartitionRead by added_id: got %v, want %v", paged, want)
+	}
+
+	byTime, err := store.PartitionRead(ctx, 0, storage.PartitionReadTypeCreatedAt, 0, time.Now().Add(-time.Hour), 100)
+	if err != nil {
+		t.Fatalf("PartitionRead by created_at: %v", err)
+	}
+	if !reflect.DeepEqual(addedIDs(byTime), want) {
+		t.Errorf("PartitionRead by created_at: got %v, want %v", addedIDs(byTime), want)
+	}
+	if later, err := store.PartitionRead(ctx, 0, storage.PartitionReadTypeCreatedAt, 0, time.Now().Add(time.Hour), 100); err != nil || len(later) != 0 {
+		t.Errorf("PartitionRead after the writes: got %v, %v, want no cells", later, err)
+	}
+}
+
+// testPartitionReadConcurrentWrites tails the store by added_id while
+// several writers race, as a changefeed does. Commits land out of added_id
+// order, which must not make the reader skip a cell.
+func testPartitionReadConcurrentWrites(t *testing.T, store storage.CellStore) {
+	ctx := context.Background()
+	const writers, perWriter = 8, 25
+
+	var wg sync.WaitGroup
+	for range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perWriter {
+				if _, err := store.WriteCell(ctx, req(uuid.New(), "a", int64(i), `{}`)); err != nil {
+					t.Errorf("WriteCell: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var seen []int64
+	after := int64(0)
+	for finished := false; ; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		page, err := store.PartitionRead(ctx, 0, storage.PartitionReadTypeAddedID, after, time.Time{}, 10)
+		if err != nil {
+			t.Fatalf("PartitionRead: %v", err)
+		}
+		for _, c := range page {
+			if c.AddedID <= after {
+				t.Fatalf("PartitionRead after %d returned added_id %d", after, c.AddedID)
+			}
+			after = c.AddedID
+			seen = append(seen, c.AddedID)
+		}
+		// Once the writers are done, read until a page comes back empty.
+		if finished && len(page) == 0 {
+			break
+		}
+	}
+
+	all, err := store.PartitionRead(ctx, 0, storage.PartitionReadTypeAddedID, 0, time.Time{}, writers*perWriter+1)
+	if err != nil {
+		t.Fatalf("PartitionRead: %v", err)
+	}
+	if want := addedIDs(all); !reflect.DeepEqual(seen, want) {
+		t.Errorf("tailing reader saw %d cells, want all %d in order; missed some committed out of order", len(seen), len(want))
+	}
+	if len(all) != writers*perWriter {
+		t.Errorf("PartitionRead: got %d cells, want %d", len(all), writers*perWriter)
+	}
+}
+
+func testPartitionReadInvalidType(t *testing.T, store storage.CellStore) {
+	if _, err := store.PartitionRead(context.Background(), 0, 99, 0, time.Time{}, 10); err == nil {
+		t.Error("PartitionRead with an unknown read type: got nil error")
+	}
+}
+
+func testHead(t *testing.T, store storage.CellStore) {
+	ctx := context.Background()
+	head, err := store.Head(ctx)
+	if err != nil {
+		t.Fatalf("Head: %v", err)
+	}
+	if head != (storage.Head{}) {
+		t.Errorf("Head of an empty store: got %+v, want zero", head)
+	}
+	cells := write(t, store, req(uuid.New(), "a", 1, `{}`), req(uuid.New(), "a", 1, `{}`))
+	head, err = store.Head(ctx)
+	if err != nil {
+		t.Fatalf("Head: %v", err)
+	}
+	if last := cells[len(cells)-1]; head.AddedID != last.AddedID || !head.CreatedAt.Equal(last.CreatedAt) {
+		t.Errorf("Head: got %+v, want the last cell's added_id %d and created_at", head, last.AddedID)
+	}
+}
+
+func testCanceledContext(t *testing.T, store storage.CellStore) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	row := uuid.New()
+
+	if _, err := store.WriteCell(ctx, req(row, "a", 1, `{}`)); err == nil {
+		t.Error("WriteCell: got nil error with a canceled context")
+	}
+	if _, err := store.WriteCells(ctx, []cell.WriteCellRequest{req(row, "b", 1, `{}`)}); err == nil {
+		t.Error("WriteCells: got nil error with a canceled context")
+	}
+	if _, err := store.GetCellLatest(ctx, row, "a"); err == nil || errors.Is(err, storage.ErrCellNotFound) {
+		t.Errorf("GetCellLatest: got %v, want the context's error", err)
+	}
+	if _, err := store.ScanCells(ctx, "a", 0, 10); err == nil {
+		t.Error("ScanCells: got nil error with a canceled context")
+	}
+	if _, err := store.PartitionRead(ctx, 0, storage.PartitionReadTypeAddedID, 0, time.Time{}, 10); err == nil {
+		t.Error("PartitionRead: got nil error with a canceled context")
+	}
+
+	// Nothing was stored by the failed writes.
+	if cells, err := store.GetRow(context.Background(), row); err != nil || len(cells) != 0 {
+		t.Errorf("GetRow after canceled writes: got %v, %v, want no cells", cells, err)
+	}
+}
+
+func testUpdateCell(t *testing.T, store storage.CellStore) {
+	if _, ok := store.(storage.Updater); !ok {
+		t.Skip("store does not serialize updates")
+	}
+	ctx := context.Background()
+	row := uuid.New()
+	increment := func(_ context.Context, latest *cell.Cell) (json.RawMessage, error) {
+		var body struct{ N int }
+		if latest != nil {
+			if err := json.Unmarshal(latest.Body, &body); err != nil {
+				return nil, err
+			}
+		}
+		body.N++
+		return json.Marshal(body)
+	}
+
+	c, err := storage.UpdateCell(ctx, store, row, "counter", increment)
+	if err != nil || c.RefKey != storage.FirstRefKey {
+		t.Fatalf("first update: got %+v, %v; want ref_key %d", c, err, storage.FirstRefKey)
+	}
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := storage.UpdateCell(ctx, store, row, "counter", increment); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent update: %v", err)
+	}
+	latest, err := store.GetCellLatest(ctx, row, "counter")
+	if err != nil || latest.RefKey != n+1 || string(latest.Body) != fmt.Sprintf(`{"N":%d}`, n+1) {
+		t.Fatalf("after %d concurrent updates: got %+v, %v", n, latest, err)
+	}
+
+	unchanged, err := storage.UpdateCell(ctx, store, row, "counter", func(context.Context, *cell.Cell) (json.RawMessage, error) { return nil, nil })
+	if err != nil || unchanged.AddedID != latest.AddedID {
+		t.Errorf("nil body: got %+v, %v; want the latest cell", unchanged, err)
+	}
+	boom := errors.New("boom")
+	if _, err := storage.UpdateCell(ctx, store, row, "counter", func(context.Context, *cell.Cell) (json.RawMessage, error) { return nil, boom }); !errors.Is(err, boom) {
+		t.Errorf("failing update: got %v, want %v", err, boom)
+	}
+}
+
+func testAliases(t *testing.T, store storage.CellStore) {
+	if _, ok := store.(storage.AliasStore); !ok {
+		t.Skip("store does not support aliases")
+	}
+	ctx := context.Background()
+	row, other := uuid.New(), uuid.New()
+
+	a, err := storage.PutAlias(ctx, store, "user:alice@example.com", row)
+	if err != nil || a.RowKey != row || a.CreatedAt.IsZero() {
+		t.Fatalf("PutAlias: got %+v, %v", a, err)
+	}
+	if again, err := storage.PutAlias(ctx, store, "user:alice@example.com", row); err != nil || !again.CreatedAt.Equal(a.CreatedAt) {
+		t.Errorf("PutAlias for the same row: got %+v, %v; want the alias unchanged", again, err)
+	}
+	if _, err := storage.PutAlias(ctx, store, "user:alice@example.com", other); !errors.Is(err, storage.ErrAliasExists) {
+		t.Errorf("PutAlias for another row: got %v, want ErrAliasExists", err)
+	}
+	if got, err := storage.GetAlias(ctx, store, "user:alice@example.com"); err != nil || got.RowKey != row {
+		t.Errorf("GetAlias: got %+v, %v", got, err)
+	}
+	if _, err := storage.GetAlias(ctx, store, "user:bob@example.com"); !errors.Is(err, storage.ErrAliasNotFound) {
+		t.Errorf("GetAlias of a missing alias: got %v, want ErrAliasNotFound", err)
+	}
+
+	if err := storage.DeleteAlias(ctx, store, "user:alice@example.com"); err != nil {
+		t.Fatalf("DeleteAlias: %v", err)
+	}
+	if err := storage.DeleteAlias(ctx, store, "user:alice@example.com"); !errors.Is(err, storage.ErrAliasNotFound) {
+		t.Errorf("DeleteAlias twice: got %v, want ErrAliasNotFound", err)
+	}
+	// A deleted alias can name another row.
+	if got, err := storage.PutAlias(ctx, store, "user:alice@example.com", other); err != nil || got.RowKey != other {
+		t.Errorf("PutAlias after delete: got %+v, %v", got, err)
+	}
+
+	if _, ok := store.(storage.AliasLister); !ok {
+		return
+	}
+	if _, err := storage.PutAlias(ctx, store, "user:bob@example.com", row); err != nil {
+		t.Fatalf("PutAlias: %v", err)
+	}
+	first, err := storage.ListAliases(ctx, store, "", 1)
+	if err != nil || len(first) != 1 || first[0].Alias != "user:alice@example.com" || first[0].RowKey != other {
+		t.Fatalf("ListAliases: got %+v, %v", first, err)
+	}
+	rest, err := storage.ListAliases(ctx, store, first[0].Alias, 10)
+	if err != nil || len(rest) != 1 || rest[0].Alias != "user:bob@example.com" {
+		t.Errorf("ListAliases after %s: got %+v, %v", first[0].Alias, rest, err)
+	}
+}
+
+func testRowTags(t *testing.T, store storage.CellStore) {
+	if _, ok := store.(storage.TagStore); !ok {
+		t.Skip("store does not support row tags")
+	}
+	ctx := context.Background()
+	rows := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	slices.SortFunc(rows, func(a, b uuid.UUID) int { return bytes.Compare(a[:], b[:]) })
+
+	for _, row := range rows {
+		if err := storage.SetRowTags(ctx, store, row, []string{"backfill", "vip"}); err != nil {
+			t.Fatalf("SetRowTags: %v", err)
+		}
+	}
+	// Replacing a row's tags drops those not given again.
+	if err := storage.SetRowTags(ctx, store, rows[1], []string{"backfill"}); err != nil {
+		t.Fatalf("SetRowTags: %v", err)
+	}
+	if err := storage.SetRowTags(ctx, store, rows[2], nil); err != nil {
+		t.Fatalf("SetRowTags without tags: %v", err)
+	}
+
+	if got, err := storage.RowsByTag(ctx, store, "backfill", uuid.Nil, 10); err != nil || !slices.Equal(got, rows[:2]) {
+		t.Errorf("RowsByTag(backfill): got %v, %v; want %v", got, err, rows[:2])
+	}
+	if got, err := storage.RowsByTag(ctx, store, "vip", uuid.Nil, 10); err != nil || !slices.Equal(got, rows[:1]) {
+		t.Errorf("RowsByTag(vip): got %v, %v; want %v", got, err, rows[:1])
+	}
+	if got, err := storage.RowsByTag(ctx, store, "backfill", uuid.Nil, 1); err != nil || !slices.Equal(got, rows[:1]) {
+		t.Errorf("RowsByTag page 1: got %v, %v", got, err)
+	}
+	if got, err := storage.RowsByTag(ctx, store, "backfill", rows[0], 1); err != nil || !slices.Equal(got, rows[1:2]) {
+		t.Errorf("RowsByTag page 2: got %v, %v", got, err)
+	}
+	if got, err := storage.RowsByTag(ctx, store, "missing", uuid.Nil, 10); err != nil || len(got) != 0 {
+		t.Errorf("RowsByTag of an unused tag: got %v, %v", got, err)
+	}
+}
+
+func testIdempotencyKeys(t *testing.T, store storage.CellStore) {
+	if _, ok := store.(storage.IdempotencyStore); !ok {
+		t.Skip("store does not keep idempotency keys")
+	}
+	ctx := context.Background()
+	key := "key-" + uuid.NewString()
+
+	if _, err := storage.IdempotencyKeyHash(ctx, store, key); !errors.Is(err, storage.ErrIdempotencyKeyNotFound) {
+		t.Fatalf("unrecorded key: got %v, want ErrIdempotencyKeyNotFound", err)
+	}
+	if err := storage.RecordIdempotencyKey(ctx, store, key, []byte("first")); err != nil {
+		t.Fatalf("RecordIdempotencyKey: %v", err)
+	}
+	// The first request made with a key stays recorded.
+	if err := storage.RecordIdempotencyKey(ctx, store, key, []byte("second")); err != nil {
+		t.Fatalf("RecordIdempotencyKey again: %v", err)
+	}
+	if got, err := storage.IdempotencyKeyHash(ctx, store, key); err != nil || string(got) != "first" {
+		t.Errorf("IdempotencyKeyHash: got %q, %v; want first", got, err)
+	}
+}
+
+func testQueryCells(t *testing.T, store storage.CellStore) {
+	if _, ok := store.(storage.Querier); !ok {
+		t.Skip("store does not support queries")
+	}
+	ctx := context.Background()
+	rows := []uuid.UUID{uuid.New(), uuid.New(), uuid.New(), uuid.New()}
+	slices.SortFunc(rows, func(a, b uuid.UUID) int { return bytes.Compare(a[:], b[:]) })
+	write(t, store,
+		req(rows[0], "orders", 1, `{"status":"open","total":5,"ship":{"country":"DE"}}`),
+		req(rows[0], "orders", 2, `{"status":"open","total":50,"ship":{"country":"DE"}}`),
+		req(rows[1], "orders", 1, `{"status":"closed","total":20,"ship":{"country":"FR"}}`),
+		req(rows[2], "orders", 1, `{"status":"open","total":"30"}`),
+		req(rows[3], "profile", 1, `{"status":"open","total":1}`),
+	)
+
+	rowKeys := func(cells []cell.Cell) []uuid.UUID {
+		keys := make([]uuid.UUID, len(cells))
+		for i, c := range cells {
+			keys[i] = c.RowKey
+		}
+		return keys
+	}
+	for _, tc := range []struct {
+		name string
+		q    storage.Query
+		want []uuid.UUID
+	}{
+		{"all", storage.Query{Column: "orders", Limit: 10}, rows[:3]},
+		{"eq", storage.Query{Column: "orders", Limit: 10, Where: []storage.Predicate{
+			{Field: "status", Type: storage.TypeString, Op: storage.QueryEq, Values: []any{"open"}},
+		}}, []uuid.UUID{rows[0], rows[2]}},
+		// The latest version only; "30" is a string, not a number.
+		{"gt", storage.Query{Column: "orders", Limit: 10, Where: []storage.Predicate{
+			{Field: "total", Type: storage.TypeNumber, Op: storage.QueryGt, Values: []any{float64(10)}},
+		}}, rows[:2]},
+		{"ne", storage.Query{Column: "orders", Limit: 10, Where: []storage.Predicate{
+			{Field: "total", Type: storage.TypeNumber, Op: storage.QueryNe, Values: []any{float64(20)}},
+		}}, []uuid.UUID{rows[0], rows[2]}},
+		{"nested in", storage.Query{Column: "orders", Limit: 10, Where: []storage.Predicate{
+			{Field: "ship.country", Type: storage.TypeString, Op: storage.QueryIn, Values: []any{"FR", "IT"}},
+		}}, rows[1:2]},
+		{"order desc", storage.Query{Column: "orders", Limit: 10, OrderBy: &storage.QueryOrder{Field: "total", Type: storage.TypeNumber, Desc: true}},
+			[]uuid.UUID{rows[0], rows[1], rows[2]}},
+		{"order asc", storage.Query{Column: "orders", Limit: 2, OrderBy: &storage.QueryOrder{Field: "total", Type: storage.TypeNumber}},
+			[]uuid.UUID{rows[1], rows[0]}},
+	} {
+		got, err := storage.QueryCells(ctx, store, tc.q)
+		if err != nil {
+			t.Fatalf("%s: QueryCells: %v", tc.name, err)
+		}
+		if !slices.Equal(rowKeys(got), tc.want) {
+			t.Errorf("%s: got rows %v, want %v", tc.name, rowKeys(got), tc.want)
+		}
+	}
+	got, err := storage.QueryCells(ctx, store, storage.Query{Column: "orders", Limit: 1, Where: []storage.Predicate{
+		{Field: "total", Type: storage.TypeNumber, Op: storage.QueryEq, Values: []any{float64(50)}},
+	}})
+	if err != nil || len(got) != 1 || got[0].RefKey != 2 {
+		t.Errorf("QueryCells returns the latest version: got %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+)
+
+// CellIterator walks the result of a read one cell at a time, so a large
+// row or partition never has to be held in memory as a whole.
+type CellIterator interface {
+	// Next advances to the next cell. It returns false at the end of the
+	// results or on error; check Err afterwards.
+	Next() bool
+	// Cell returns the current cell. It is only valid until the next call
+	// to Next.
+	Cell() *cell.Cell
+	// Err returns the error that stopped iteration, if any.
+	Err() error
+	// Close releases the underlying query. It is safe to call more than once.
+	Close()
+}
+
+// Streamer is implemented by stores that can return GetRow and
+// PartitionRead results as iterators over an open query instead of slices.
+// Use StreamRow and StreamPartition, which fall back to the slice methods
+// for stores that do not implement it.
+type Streamer interface {
+	StreamRow(ctx context.Context, rowKey uuid.UUID) (CellIterator, error)
+	StreamPartition(ctx context.Context, partitionNumber int, readType int, addedID int64, createdAfter time.Time, limit int) (CellIterator, error)
+}
+
+// StreamRow returns an iterator over the cells GetRow would return.
+func StreamRow(ctx context.Context, store CellStore, rowKey uuid.UUID) (CellIterator, error) {
+	if s, ok := store.(Streamer); ok {
+		return s.StreamRow(ctx, rowKey)
+	}
+	cells, err := store.GetRow(ctx, rowKey)
+	if err != nil {
+		return nil, err
+	}
+	return SliceIterator(cells), nil
+}
+
+// ColumnStreamer is implemented by stores that can read some of a row's
+// columns in the query itself. Use StreamRowColumns, which filters the whole
+// row for stores that do not implement it.
+type ColumnStreamer interface {
+	StreamRowColumns(ctx context.Context, rowKey uuid.UUID, columns []string) (CellIterator, error)
+}
+
+// StreamRowColumns returns an iterator over the cells GetRow would return
+// for the given columns. An empty columns reads the whole row.
+func StreamRowColumns(ctx context.Context, store CellStore, rowKey uuid.UUID, columns []string) (CellIterator, error) {
+	if len(columns) == 0 {
+		return StreamRow(ctx, store, rowKey)
+	}
+	if s, ok := store.(ColumnStreamer); ok {
+		return s.StreamRowColumns(ctx, rowKey, columns)
+	}
+	it, err := StreamRow(ctx, store, rowKey)
+	if err != nil {
+		return nil, err
+	}
+	return FilterColumns(it, columns), nil
+}
+
+// FilterColumns returns an iterator over the cells of it in the given
+// columns.
+func FilterColumns(it CellIterator, columns []string) CellIterator {
+	return &columnIterator{CellIterator: it, columns: columns}
+}
+
+type columnIterator struct {
+	CellIterator
+	columns []string
+}
+
+func (it *columnIterator) Next() bool {
+	for it.CellIterator.Next() {
+		if slices.Contains(it.columns, it.Cell().ColumnName) {
+			return true
+		}
+	}
+	return false
+}
+
+// StreamPartition returns an iterator over the cells PartitionRead would
+// return.
+func StreamPartition(ctx context.Context, store CellStore, partitionNumber int, readType int, addedID int64, createdAfter time.Time, limit int) (CellIterator, error) {
+	if s, ok := store.(Streamer); ok {
+		return s.StreamPartition(ctx, partitionNumber, readType, addedID, createdAfter, limit)
+	}
+	cells, err := store.PartitionRead(ctx, partitionNumber, readType, addedID, createdAfter, limit)
+	if err != nil {
+		return nil, err
+	}
+	return SliceIterator(cells), nil
+}
+
+// SliceIterator returns an iterator over cells that are already in memory.
+func SliceIterator(cells []cell.Cell) CellIterator {
+	return &sliceIterator{cells: cells, i: -1}
+}
+
+type sliceIterator struct {
+	cells []cell.Cell
+	i     int
+}
+
+func (it *sliceIterator) Next() bool {
+	if it.i+1 >= len(it.cells) {
+		it.i = len(it.cells)
+		return false
+	}
+	it.i++
+	return true
+}
+
+func (it *sliceIterator) Cell() *cell.Cell { return &it.cells[it.i] }
+func (it *sliceIterator) Err() error       { return nil }
+func (it *sliceIterator) Close()           {}
+
+// collect drains it into a slice and closes it.
+func collect(it CellIterator) ([]cell.Cell, error) {
+	defer it.Close()
+	var cells []cell.Cell
+	for it.Next() {
+		cells = append(cells, *it.Cell())
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return cells, nil
+}
+
+// rowsIterator scans cells from an open query. op prefixes its errors, as
+// in the slice methods.
+type rowsIterator struct {
+	rows   pgx.Rows
+	cancel context.CancelFunc
+	op     string
+	c      cell.Cell
+	err    error
+	// seq is set for commit log queries, which select seq first.
+	seq bool
+}
+
+func (it *rowsIterator) Next() bool {
+	if it.err != nil || !it.rows.Next() {
+		return false
+	}
+	it.c = cell.Cell{}
+	dest := []any{&it.c.AddedID, &it.c.RowKey, &it.c.ColumnName, &it.c.RefKey, &it.c.Body, &it.c.CreatedAt}
+	if it.seq {
+		dest = append([]any{&it.c.CommitSeq}, dest...)
+	}
+	if err := it.rows.Scan(dest...); err != nil {
+		it.err = fmt.Errorf("%s scan: %w", it.op, err)
+		return false
+	}
+	return true
+}
+
+func (it *rowsIterator) Cell() *cell.Cell { return &it.c }
+
+func (it *rowsIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	if err := it.rows.Err(); err != nil {
+		return fmt.Errorf("%s: %w", it.op, err)
+	}
+	return nil
+}
+
+func (it *rowsIterator) Close() {
+	it.rows.Close()
+	it.cancel()
+}
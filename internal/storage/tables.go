@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ListShardTables returns the shards whose cell tables exist in the current
+// schema of pool's database, in order.
+func ListShardTables(ctx context.Context, pool *pgxpool.Pool) ([]int, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT tablename FROM pg_tables
+		WHERE schemaname = current_schema() AND tablename ~ '^cells_[0-9]+$'
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("list shard tables: %w", err)
+	}
+	defer rows.Close()
+
+	var shards []int
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("scan shard table: %w", err)
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(name, "cells_"))
+		if err != nil || ShardTable(id) != name {
+			// Not a name ShardTable produces, e.g. cells_01.
+			continue
+		}
+		shards = append(shards, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list shard tables: %w", err)
+	}
+	slices.Sort(shards)
+	return shards, nil
+}
+
+// DiffShardTables compares the shard tables present in a database with the
+// shards it should hold: the union of ranges, each [start, end] inclusive.
+// Both results are in order.
+func DiffShardTables(present []int, ranges ...[2]int) (missing, unexpected []int) {
+	want := make(map[int]bool)
+	for _, r := range ranges {
+		for i := r[0]; i <= r[1]; i++ {
+			want[i] = true
+		}
+	}
+	have := make(map[int]bool, len(present))
+	for _, id := range present {
+		have[id] = true
+		if !want[id] {
+			unexpected = append(unexpected, id)
+		}
+	}
+	for id := range want {
+		if !have[id] {
+			missing = append(missing, id)
+		}
+	}
+	slices.Sort(missing)
+	slices.Sort(unexpected)
+	return missing, unexpected
+}
+
+// FormatShards writes sorted shard IDs compactly, collapsing runs into
+// ranges: "0-31, 40, 42-43".
+func FormatShards(shards []int) string {
+	var b strings.Builder
+	for i := 0; i < len(shards); {
+		j := i
+		for j+1 < len(shards) && shards[j+1] == shards[j]+1 {
+			j++
+		}
+		if b.Len() > 0 {
+			b.WriteString(", ")
+		}
+		if i == j {
+			fmt.Fprintf(&b, "%d", shards[i])
+		} else {
+			fmt.Fprintf(&b, "%d-%d", shards[i], shards[j])
+		}
+		i = j + 1
+	}
+	return b.String()
+}
@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiffShardTables(t *testing.T) {
+	missing, unexpected := DiffShardTables([]int{0, 1, 3, 8, 9}, [2]int{0, 3}, [2]int{5, 5})
+	if !slices.Equal(missing, []int{2, 5}) {
+		t.Errorf("missing: got %v, want [2 5]", missing)
+	}
+	if !slices.Equal(unexpected, []int{8, 9}) {
+		t.Errorf("unexpected: got %v, want [8 9]", unexpected)
+	}
+
+	missing, unexpected = DiffShardTables([]int{0, 1}, [2]int{0, 1})
+	if missing != nil || unexpected != nil {
+		t.Errorf("matching: got missing %v, unexpected %v", missing, unexpected)
+	}
+}
+
+func TestFormatShards(t *testing.T) {
+	tests := []struct {
+		shards []int
+		want   string
+	}{
+		{nil, ""},
+		{[]int{7}, "7"},
+		{[]int{0, 1, 2, 3}, "0-3"},
+		{[]int{0, 1, 2, 5, 7, 8}, "0-2, 5, 7-8"},
+	}
+	for _, tt := range tests {
+		if got := FormatShards(tt.shards); got != tt.want {
+			t.Errorf("FormatShards(%v) = %q, want %q", tt.shards, got, tt.want)
+		}
+	}
+}
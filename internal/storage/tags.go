@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// ErrTagsUnsupported is returned for row tags on a store that cannot index
+// them.
+var ErrTagsUnsupported = errors.New("store does not support row tags")
+
+// TagStore is implemented by stores that index the tags of their shard's
+// rows. The tags themselves are kept in the row's metadata cell; the index
+// only answers which rows carry a tag. Use SetRowTags and RowsByTag, which
+// fail with ErrTagsUnsupported for stores that do not implement it.
+type TagStore interface {
+	// SetRowTags replaces the indexed tags of rowKey with tags; no tags
+	// removes the row from the index.
+	SetRowTags(ctx context.Context, rowKey uuid.UUID, tags []string) error
+	// RowsByTag returns up to limit rows tagged with tag whose row_key is
+	// greater than after, in row_key order.
+	RowsByTag(ctx context.Context, tag string, after uuid.UUID, limit int) ([]uuid.UUID, error)
+}
+
+// SetRowTags replaces the indexed tags of a row.
+func SetRowTags(ctx context.Context, store CellStore, rowKey uuid.UUID, tags []string) error {
+	if t, ok := store.(TagStore); ok {
+		return t.SetRowTags(ctx, rowKey, tags)
+	}
+	return ErrTagsUnsupported
+}
+
+// RowsByTag pages through the rows tagged with tag.
+func RowsByTag(ctx context.Context, store CellStore, tag string, after uuid.UUID, limit int) ([]uuid.UUID, error) {
+	if t, ok := store.(TagStore); ok {
+		return t.RowsByTag(ctx, tag, after, limit)
+	}
+	return nil, ErrTagsUnsupported
+}
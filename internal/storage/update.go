@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+)
+
+// FirstRefKey is the ref_key UpdateCell writes for a cell with no versions.
+const FirstRefKey = 1
+
+// updateAttempts bounds how often UpdateCell reapplies an update on a store
+// that is not an Updater, when another write takes the ref_key it was about
+// to write.
+const updateAttempts = 5
+
+// UpdateFunc returns the body of the version of a cell that follows latest,
+// which is nil if the cell has no versions. A nil body writes nothing.
+type UpdateFunc func(ctx context.Context, latest *cell.Cell) (json.RawMessage, error)
+
+// Updater is implemented by stores that write the next version of a cell
+// from its latest one atomically: updates of a cell are serialized, so
+// each is applied to the version the previous one wrote. Use UpdateCell,
+// which falls back to reading and retrying on stores that do not implement
+// it.
+type Updater interface {
+	// UpdateCell writes the body apply returns as the next version of the
+	// cell, with the ref_key after the latest one's, or FirstRefKey. It
+	// returns the cell written, or the latest one if apply returned nil. A
+	// plain write taking that ref_key first fails it with ErrCellExists.
+	UpdateCell(ctx context.Context, rowKey uuid.UUID, columnName string, apply UpdateFunc) (*cell.Cell, error)
+}
+
+// UpdateCell writes the next version of a cell from its latest one. On a
+// store that is not an Updater, apply may run more than once: the update
+// is reapplied to the version a concurrent write took.
+func UpdateCell(ctx context.Context, store CellStore, rowKey uuid.UUID, columnName string, apply UpdateFunc) (*cell.Cell, error) {
+	if u, ok := store.(Updater); ok {
+		return u.UpdateCell(ctx, rowKey, columnName, apply)
+	}
+	var err error
+	for range updateAttempts {
+		var latest *cell.Cell
+		latest, err = store.GetCellLatest(WithFreshRead(ctx), rowKey, columnName)
+		if err != nil && !errors.Is(err, ErrCellNotFound) {
+			return nil, err
+		}
+		var c *cell.Cell
+		c, err = writeNext(ctx, latest, rowKey, columnName, apply, store.WriteCell)
+		if !errors.Is(err, ErrCellExists) {
+			return c, err
+		}
+	}
+	return nil, err
+}
+
+// writeNext applies an update to latest and writes the result with write.
+func writeNext(ctx context.Context, latest *cell.Cell, rowKey uuid.UUID, columnName string, apply UpdateFunc, write func(context.Context, cell.WriteCellRequest) (*cell.Cell, error)) (*cell.Cell, error) {
+	body, err := apply(ctx, latest)
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		return latest, nil
+	}
+	refKey := int64(FirstRefKey)
+	if latest != nil {
+		refKey = latest.RefKey + 1
+	}
+	return write(ctx, cell.WriteCellRequest{RowKey: rowKey, ColumnName: columnName, RefKey: refKey, Body: body})
+}
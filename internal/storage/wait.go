@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+)
+
+// HeadWaiter is implemented by stores that can tell when cells are written,
+// so tailing readers wait for them instead of polling. Use WaitHead and
+// ScanCellsWait, which fall back to sleeping for stores that do not
+// implement it.
+type HeadWaiter interface {
+	// WaitHead blocks until a cell with an added_id greater than
+	// afterAddedID may have been written, and returns the highest added_id
+	// written as far as the store knows. It returns ctx.Err() if ctx ends
+	// first.
+	WaitHead(ctx context.Context, afterAddedID int64) (int64, error)
+}
+
+// WaitHead waits for store to be written past afterAddedID. Stores that
+// are not HeadWaiters cannot tell, so it waits for ctx to end.
+func WaitHead(ctx context.Context, store CellStore, afterAddedID int64) (int64, error) {
+	if w, ok := store.(HeadWaiter); ok {
+		return w.WaitHead(ctx, afterAddedID)
+	}
+	<-ctx.Done()
+	return afterAddedID, ctx.Err()
+}
+
+// ScanCellsWait is ScanCells as a long poll: when there are no cells past
+// afterAddedID, it waits up to wait for some to be written before it
+// returns an empty page. A wait of zero is ScanCells. Writes through this
+// process wake it early, and with a HeadNotifier writes through other
+// instances too; cells written otherwise are returned by the next call.
+func ScanCellsWait(ctx context.Context, store CellStore, columnName string, afterAddedID int64, limit int, wait time.Duration) ([]cell.Cell, error) {
+	cells, err := store.ScanCells(ctx, columnName, afterAddedID, limit)
+	if err != nil || len(cells) > 0 || wait <= 0 {
+		return cells, err
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	head := afterAddedID
+	for {
+		if head, err = WaitHead(waitCtx, store, head); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				return nil, nil
+			}
+			return nil, err
+		}
+		// The write may have been to another column: keep waiting for
+		// those after it.
+		cells, err = store.ScanCells(ctx, columnName, afterAddedID, limit)
+		if err != nil || len(cells) > 0 {
+			return cells, err
+		}
+	}
+}
+
+// headSignal is a condition variable on a shard's head: waiters are woken
+// whenever a write moves it, through this process or, observed by a
+// HeadNotifier, another.
+type headSignal struct {
+	mu    sync.Mutex
+	head  int64
+	own   int64 // the highest added_id written through this process
+	moved chan struct{}
+}
+
+func newHeadSignal() *headSignal {
+	return &headSignal{moved: make(chan struct{})}
+}
+
+// advance records that cells up to addedID were written through this
+// process.
+func (h *headSignal) advance(addedID int64) {
+	h.mu.Lock()
+	h.own = max(h.own, addedID)
+	h.mu.Unlock()
+	h.observe(addedID)
+}
+
+// local returns the highest added_id written through this process.
+func (h *headSignal) local() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.own
+}
+
+// observe records that cells up to addedID were written.
+func (h *headSignal) observe(addedID int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if addedID <= h.head {
+		return
+	}
+	h.head = addedID
+	close(h.moved)
+	h.moved = make(chan struct{})
+}
+
+// wait blocks until the head passes afterAddedID or ctx ends.
+func (h *headSignal) wait(ctx context.Context, afterAddedID int64) (int64, error) {
+	for {
+		h.mu.Lock()
+		head, moved := h.head, h.moved
+		h.mu.Unlock()
+		if head > afterAddedID {
+			return head, nil
+		}
+		select {
+		case <-moved:
+		case <-ctx.Done():
+			return head, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Store is a persistent storage interface for streams.
+type Store interface {
+	SaveStream(ctx context.Context, s *Stream) error
+	DeleteStream(ctx context.Context, name string) error
+	ListStreams(ctx context.Context) ([]*Stream, error)
+}
+
+// PostgresStore implements Store backed by the streams table (see
+// storage.RunPluginMigration).
+type PostgresStore struct {
+	pool         *pgxpool.Pool
+	queryTimeout time.Duration
+}
+
+// NewPostgresStore creates a Store using the given connection pool.
+// queryTimeout sets the per-query context deadline; zero means no timeout.
+func NewPostgresStore(pool *pgxpool.Pool, queryTimeout time.Duration) *PostgresStore {
+	return &PostgresStore{pool: pool, queryTimeout: queryTimeout}
+}
+
+func (s *PostgresStore) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.queryTimeout > 0 {
+		return context.WithTimeout(ctx, s.queryTimeout)
+	}
+	return ctx, func() {}
+}
+
+func (s *PostgresStore) SaveStream(ctx context.Context, st *Stream) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	filters := st.Filters
+	if filters == nil {
+		filters = []string{}
+	}
+	if _, err := s.pool.Exec(ctx, `
+		INSERT INTO streams (name, columns, filters, description, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, st.Name, st.Columns, filters, st.Description, st.CreatedAt); err != nil {
+		return fmt.Errorf("save stream: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) DeleteStream(ctx context.Context, name string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.pool.Exec(ctx, `DELETE FROM streams WHERE name = $1`, name); err != nil {
+		return fmt.Errorf("delete stream: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) ListStreams(ctx context.Context) ([]*Stream, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, `SELECT name, columns, filters, description, created_at FROM streams ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("list streams: %w", err)
+	}
+	defer rows.Close()
+
+	var out []*Stream
+	for rows.Next() {
+		var st Stream
+		if err := rows.Scan(&st.Name, &st.Columns, &st.Filters, &st.Description, &st.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan stream: %w", err)
+		}
+		out = append(out, &st)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,209 @@
+// Package stream keeps named streams: selections of cells by column and
+// body filter that trigger plugins subscribe to instead of raw column names.
+// Several plugins can then share one definition of "orders over the EU
+// region" without each repeating the filter, and a filter is changed in one
+// place.
+//
+// Streams are evaluated when a cell's notifications are dispatched; a cell
+// belongs to a stream if its column is one of the stream's and its body
+// matches every filter.
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+)
+
+var (
+	// ErrNotFound is returned for a stream name that is not registered.
+	ErrNotFound = errors.New("stream not found")
+	// ErrExists is returned when creating a stream whose name is taken.
+	ErrExists = errors.New("stream already exists")
+	// ErrInvalid is returned for a stream with a bad name, no columns or a
+	// filter that does not parse.
+	ErrInvalid = errors.New("invalid stream")
+)
+
+var validName = regexp.MustCompile(`^[a-z][a-z0-9_.-]{0,62}$`)
+
+// Stream is a named selection of cells.
+type Stream struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	// Filters are conditions on top-level body fields, written
+	// field:op:value as in index queries (see index.ParseFilter); a cell
+	// must match all of them.
+	Filters     []string  `json:"filters,omitempty"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	filters []index.Filter
+}
+
+// compile validates the stream and parses its filters.
+func (s *Stream) compile() error {
+	if !validName.MatchString(s.Name) {
+		return fmt.Errorf("%w: name %q must be lowercase letters, digits, '_', '.' or '-', starting with a letter", ErrInvalid, s.Name)
+	}
+	if len(s.Columns) == 0 {
+		return fmt.Errorf("%w: %s selects no columns", ErrInvalid, s.Name)
+	}
+	filters := make([]index.Filter, 0, len(s.Filters))
+	for _, raw := range s.Filters {
+		f, err := index.ParseFilter(raw)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalid, s.Name, err)
+		}
+		filters = append(filters, f)
+	}
+	s.filters = filters
+	return nil
+}
+
+// CheckColumns reports a column of the stream whose name writes refuse (see
+// cell.ValidateColumnName). Streams created before names were checked may
+// select one; they still load, so that a typo does not stop the server.
+func (s *Stream) CheckColumns() error {
+	for _, c := range s.Columns {
+		if err := cell.ValidateColumnName(c); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalid, s.Name, err)
+		}
+	}
+	return nil
+}
+
+// Match reports whether c belongs to the stream.
+func (s *Stream) Match(c *cell.Cell) bool {
+	if !slices.Contains(s.Columns, c.ColumnName) {
+		return false
+	}
+	for _, f := range s.filters {
+		if !f.Match(c.Body) {
+			return false
+		}
+	}
+	return true
+}
+
+// Registry is a thread-safe registry of streams. When a Store is provided,
+// changes are written through to it.
+type Registry struct {
+	mu      sync.RWMutex
+	streams map[string]*Stream
+	store   Store // optional; nil means in-memory only
+}
+
+// NewRegistry creates an empty registry.
+// An optional Store enables persistence.
+func NewRegistry(store ...Store) *Registry {
+	r := &Registry{streams: make(map[string]*Stream)}
+	if len(store) > 0 && store[0] != nil {
+		r.store = store[0]
+	}
+	return r
+}
+
+// LoadAll populates the registry from the backing store. It is a no-op if
+// no store is configured.
+func (r *Registry) LoadAll(ctx context.Context) error {
+	if r.store == nil {
+		return nil
+	}
+	streams, err := r.store.ListStreams(ctx)
+	if err != nil {
+		return fmt.Errorf("load streams: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range streams {
+		if err := s.compile(); err != nil {
+			return fmt.Errorf("load streams: %w", err)
+		}
+		r.streams[s.Name] = s
+	}
+	return nil
+}
+
+// Create validates and registers a stream, setting its creation time. It
+// returns ErrExists if the name is taken.
+func (r *Registry) Create(ctx context.Context, s *Stream) error {
+	if err := s.compile(); err != nil {
+		return err
+	}
+	if err := s.CheckColumns(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.streams[s.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrExists, s.Name)
+	}
+	s.CreatedAt = time.Now()
+	if r.store != nil {
+		if err := r.store.SaveStream(ctx, s); err != nil {
+			return fmt.Errorf("persist stream: %w", err)
+		}
+	}
+	r.streams[s.Name] = s
+	return nil
+}
+
+// Get returns the stream with the given name.
+func (r *Registry) Get(name string) (*Stream, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.streams[name]
+	return s, ok
+}
+
+// List returns all streams ordered by name.
+func (r *Registry) List() []*Stream {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]*Stream, 0, len(r.streams))
+	for _, s := range r.streams {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Delete removes a stream. It returns ErrNotFound if there is none by that
+// name.
+func (r *Registry) Delete(ctx context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.streams[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if r.store != nil {
+		if err := r.store.DeleteStream(ctx, name); err != nil {
+			return fmt.Errorf("persist delete: %w", err)
+		}
+	}
+	delete(r.streams, name)
+	return nil
+}
+
+// Matching returns the names of the streams c belongs to.
+func (r *Registry) Matching(c *cell.Cell) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []string
+	for name, s := range r.streams {
+		if s.Match(c) {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
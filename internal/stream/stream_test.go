@@ -0,0 +1,123 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+)
+
+// memStore is an in-memory Store.
+type memStore struct {
+	streams map[string]*Stream
+}
+
+func (m *memStore) SaveStream(_ context.Context, s *Stream) error {
+	m.streams[s.Name] = s
+	return nil
+}
+
+func (m *memStore) DeleteStream(_ context.Context, name string) error {
+	delete(m.streams, name)
+	return nil
+}
+
+func (m *memStore) ListStreams(context.Context) ([]*Stream, error) {
+	var out []*Stream
+	for _, s := range m.streams {
+		out = append(out, &Stream{Name: s.Name, Columns: s.Columns, Filters: s.Filters})
+	}
+	return out, nil
+}
+
+func TestStream_Match(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Create(context.Background(), &Stream{Name: "eu-orders", Columns: []string{"orders", "returns"}, Filters: []string{"region:eq:eu", "status:in:paid,shipped"}}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	s, _ := r.Get("eu-orders")
+
+	tests := []struct {
+		column string
+		body   string
+		want   bool
+	}{
+		{"orders", `{"region":"eu","status":"paid"}`, true},
+		{"returns", `{"region":"eu","status":"shipped"}`, true},
+		{"orders", `{"region":"us","status":"paid"}`, false},
+		{"orders", `{"region":"eu","status":"cancelled"}`, false},
+		{"profile", `{"region":"eu","status":"paid"}`, false},
+	}
+	for _, tt := range tests {
+		c := &cell.Cell{ColumnName: tt.column, Body: json.RawMessage(tt.body)}
+		if got := s.Match(c); got != tt.want {
+			t.Errorf("Match(%s %s): got %v, want %v", tt.column, tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestRegistry_CreateValidates(t *testing.T) {
+	r := NewRegistry()
+	for _, s := range []*Stream{
+		{Name: "Orders", Columns: []string{"orders"}},
+		{Name: "orders"},
+		{Name: "orders", Columns: []string{"orders;"}},
+		{Name: "orders", Columns: []string{"orders"}, Filters: []string{"region"}},
+	} {
+		if err := r.Create(context.Background(), s); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Create(%+v): got %v, want ErrInvalid", s, err)
+		}
+	}
+	if err := r.Create(context.Background(), &Stream{Name: "orders", Columns: []string{"orders"}}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := r.Create(context.Background(), &Stream{Name: "orders", Columns: []string{"orders"}}); !errors.Is(err, ErrExists) {
+		t.Errorf("duplicate Create: got %v, want ErrExists", err)
+	}
+	if err := r.Delete(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete(missing): got %v, want ErrNotFound", err)
+	}
+}
+
+func TestRegistry_MatchingAfterLoad(t *testing.T) {
+	store := &memStore{streams: make(map[string]*Stream)}
+	r := NewRegistry(store)
+	for _, s := range []*Stream{
+		{Name: "us-orders", Columns: []string{"orders"}, Filters: []string{"region:eq:us"}},
+		{Name: "eu-orders", Columns: []string{"orders"}, Filters: []string{"region:eq:eu"}},
+		{Name: "all-orders", Columns: []string{"orders"}},
+	} {
+		if err := r.Create(context.Background(), s); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	// A registry loaded from the store compiles the filters again.
+	loaded := NewRegistry(store)
+	if err := loaded.LoadAll(context.Background()); err != nil {
+		t.Fatalf("LoadAll: %v", err)
+	}
+	got := loaded.Matching(&cell.Cell{ColumnName: "orders", Body: json.RawMessage(`{"region":"eu"}`)})
+	if len(got) != 2 || got[0] != "all-orders" || got[1] != "eu-orders" {
+		t.Errorf("Matching: got %v, want [all-orders eu-orders]", got)
+	}
+}
+
+func TestRegistry_LoadsStreamsOfInvalidColumns(t *testing.T) {
+	// Saved before column names were checked.
+	legacy := &Stream{Name: "legacy", Columns: []string{"Orders EU"}}
+	store := &memStore{streams: map[string]*Stream{legacy.Name: legacy}}
+	r := NewRegistry(store)
+	if err := r.LoadAll(context.Background()); err != nil {
+		t.Fatalf("LoadAll: %v", err)
+	}
+	s, ok := r.Get("legacy")
+	if !ok {
+		t.Fatal("stream of an invalid column not loaded")
+	}
+	if err := s.CheckColumns(); !errors.Is(err, ErrInvalid) {
+		t.Errorf("CheckColumns: got %v, want ErrInvalid", err)
+	}
+}
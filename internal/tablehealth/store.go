@@ -0,0 +1,80 @@
+package tablehealth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// PostgresStore implements Store with pg_stat_user_tables and ANALYZE.
+type PostgresStore struct {
+	poolFor      func(shardID int) *pgxpool.Pool
+	queryTimeout time.Duration
+}
+
+// NewPostgresStore creates a Store reaching each shard through the pool
+// poolFor returns. queryTimeout sets the context deadline of statistics
+// reads, not of ANALYZE, which takes as long as the table needs; zero means
+// no timeout.
+func NewPostgresStore(poolFor func(shardID int) *pgxpool.Pool, queryTimeout time.Duration) *PostgresStore {
+	return &PostgresStore{poolFor: poolFor, queryTimeout: queryTimeout}
+}
+
+// statsQuery reads a table's counters. greatest ignores NULLs, so the last
+// vacuum and analyze are NULL only if neither kind ever ran.
+const statsQuery = `
+	SELECT n_live_tup, n_dead_tup, n_mod_since_analyze,
+		greatest(last_vacuum, last_autovacuum), greatest(last_analyze, last_autoanalyze)
+	FROM pg_stat_user_tables
+	WHERE relid = to_regclass($1)
+`
+
+func (s *PostgresStore) TableStats(ctx context.Context, shardID int) (TableStats, error) {
+	pool := s.poolFor(shardID)
+	if pool == nil {
+		return TableStats{}, fmt.Errorf("no backend for shard %d", shardID)
+	}
+	if s.queryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.queryTimeout)
+		defer cancel()
+	}
+	var out TableStats
+	var vacuum, analyze *time.Time
+	err := pool.QueryRow(ctx, statsQuery, storage.ShardTable(shardID)).
+		Scan(&out.LiveTuples, &out.DeadTuples, &out.ModsSinceAnalyze, &vacuum, &analyze)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The statistics collector has not seen the table yet.
+		return TableStats{}, nil
+	}
+	if err != nil {
+		return TableStats{}, fmt.Errorf("read statistics of shard %d: %w", shardID, err)
+	}
+	if vacuum != nil {
+		out.LastVacuum = *vacuum
+	}
+	if analyze != nil {
+		out.LastAnalyze = *analyze
+	}
+	return out, nil
+}
+
+func (s *PostgresStore) Analyze(ctx context.Context, shardID int) error {
+	pool := s.poolFor(shardID)
+	if pool == nil {
+		return fmt.Errorf("no backend for shard %d", shardID)
+	}
+	err := storage.WithoutStatementTimeout(ctx, pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "ANALYZE "+storage.ShardTable(shardID))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("analyze shard %d: %w", shardID, err)
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+// Package tablehealth watches the planner statistics and dead tuples of the
+// shard tables.
+//
+// A cluster has thousands of small shard tables, and autovacuum's default
+// thresholds treat each on its own: a table can carry a large share of dead
+// versions, left by garbage collection, or statistics from before a bulk
+// import, without any one of them looking unusual. Plans on stale
+// statistics degrade quietly. The Advisor reads each table's counters from
+// pg_stat_user_tables once per interval, exports them, and advises a VACUUM
+// when dead tuples make up too much of the table or an ANALYZE when too
+// many rows changed since its statistics were gathered. It can run the
+// ANALYZE itself; vacuuming is left to autovacuum or an operator, since it
+// competes with the workload for I/O.
+package tablehealth
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	liveTuples = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "mezzanine",
+			Name:      "shard_table_live_tuples",
+			Help:      "Estimated live rows of a shard table, by shard.",
+		},
+		[]string{"shard"},
+	)
+	deadTuples = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "mezzanine",
+			Name:      "shard_table_dead_tuples",
+			Help:      "Estimated dead rows of a shard table awaiting vacuum, by shard.",
+		},
+		[]string{"shard"},
+	)
+	modsSinceAnalyze = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "mezzanine",
+			Name:      "shard_table_mods_since_analyze",
+			Help:      "Rows of a shard table inserted, updated or deleted since its statistics were gathered, by shard.",
+		},
+		[]string{"shard"},
+	)
+	advisories = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "mezzanine",
+			Name:      "shard_table_advisory",
+			Help:      "1 while a shard table is advised a vacuum or analyze, by shard and advice.",
+		},
+		[]string{"shard", "advice"},
+	)
+	analyzeTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "mezzanine",
+			Name:      "shard_table_analyze_total",
+			Help:      "ANALYZEs of shard tables run by the advisor or after imports, by result (ok or error).",
+		},
+		[]string{"result"},
+	)
+	errorsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "mezzanine",
+			Name:      "shard_table_stats_errors_total",
+			Help:      "Reads of a shard table's statistics that failed; they are retried next interval.",
+		},
+	)
+)
+
+// Advice is what a shard table needs.
+type Advice string
+
+const (
+	// AdviceVacuum: dead tuples make up too much of the table.
+	AdviceVacuum Advice = "vacuum"
+	// AdviceAnalyze: too many rows changed since the table's statistics
+	// were gathered, or they never were.
+	AdviceAnalyze Advice = "analyze"
+)
+
+var allAdvice = []Advice{AdviceVacuum, AdviceAnalyze}
+
+// TableStats are a shard table's counters from pg_stat_user_tables.
+type TableStats struct {
+	LiveTuples       int64
+	DeadTuples       int64
+	ModsSinceAnalyze int64
+	// LastVacuum and LastAnalyze are the latest manual or automatic vacuum
+	// and analyze; zero if there was none.
+	LastVacuum  time.Time
+	LastAnalyze time.Time
+}
+
+// Store reads shard table statistics and analyzes shard tables.
+type Store interface {
+	TableStats(ctx context.Context, shardID int) (TableStats, error)
+	Analyze(ctx context.Context, shardID int) error
+}
+
+// Options configures an Advisor.
+type Options struct {
+	// NumShards is the number of shards.
+	NumShards int
+	// Interval is the time between checks of a shard table (default 10m).
+	Interval time.Duration
+	// DeadPercent is the share of dead tuples, in percent of all tuples, at
+	// which a vacuum is advised (default 20).
+	DeadPercent int
+	// AnalyzePercent is the share of rows changed since the last analyze,
+	// in percent of live tuples, at which an analyze is advised (default 10).
+	AnalyzePercent int
+	// MinRows is the fewest tuples, dead or changed, that are worth advising
+	// on, so that small tables are left to autovacuum (default 1000).
+	MinRows int64
+	// AutoAnalyze runs ANALYZE on tables advised one.
+	AutoAnalyze bool
+	// Concurrency bounds the shard tables checked at once (default 2).
+	Concurrency int
+}
+
+// Advise returns what a table with stats needs under opts.
+func Advise(s TableStats, opts Options) []Advice {
+	var out []Advice
+	if total := s.LiveTuples + s.DeadTuples; s.DeadTuples >= opts.MinRows && s.DeadTuples*100 >= total*int64(opts.DeadPercent) {
+		out = append(out, AdviceVacuum)
+	}
+	if s.ModsSinceAnalyze >= opts.MinRows && (s.LastAnalyze.IsZero() || s.ModsSinceAnalyze*100 >= s.LiveTuples*int64(opts.AnalyzePercent)) {
+		out = append(out, AdviceAnalyze)
+	}
+	return out
+}
+
+// Advisor checks shard tables and exports their statistics and advisories.
+type Advisor struct {
+	store  Store
+	opts   Options
+	sem    chan struct{}
+	logger *slog.Logger
+}
+
+// New returns an advisor reading statistics from store.
+func New(store Store, opts Options, logger *slog.Logger) *Advisor {
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Minute
+	}
+	if opts.DeadPercent <= 0 {
+		opts.DeadPercent = 20
+	}
+	if opts.AnalyzePercent <= 0 {
+		opts.AnalyzePercent = 10
+	}
+	if opts.MinRows <= 0 {
+		opts.MinRows = 1000
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 2
+	}
+	return &Advisor{store: store, opts: opts, sem: make(chan struct{}, opts.Concurrency), logger: logger}
+}
+
+// Run checks every shard table until ctx is cancelled. Use it when one
+// instance checks the whole cluster; with shard leases, register RunShard
+// as a lease handler instead.
+func (a *Advisor) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for id := range a.opts.NumShards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.RunShard(ctx, id)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// RunShard checks shardID's table once per interval until ctx is cancelled,
+// then stops exporting its statistics, which the next instance to check it
+// takes over. It has the signature of a lease.Handler.
+func (a *Advisor) RunShard(ctx context.Context, shardID int) {
+	label := strconv.Itoa(shardID)
+	defer func() {
+		liveTuples.DeleteLabelValues(label)
+		deadTuples.DeleteLabelValues(label)
+		modsSinceAnalyze.DeleteLabelValues(label)
+		for _, advice := range allAdvice {
+			advisories.DeleteLabelValues(label, string(advice))
+		}
+	}()
+	for {
+		if err := a.checkShard(ctx, shardID); err != nil && ctx.Err() == nil {
+			errorsTotal.Inc()
+			a.logger.Warn("failed to check shard table statistics; retrying next interval", "shard_id", shardID, "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(a.opts.Interval):
+		}
+	}
+}
+
+// checkShard reads shardID's statistics, exports them and acts on the
+// advice.
+func (a *Advisor) checkShard(ctx context.Context, shardID int) error {
+	select {
+	case a.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil
+	}
+	defer func() { <-a.sem }()
+
+	s, err := a.store.TableStats(ctx, shardID)
+	if err != nil {
+		return err
+	}
+	label := strconv.Itoa(shardID)
+	liveTuples.WithLabelValues(label).Set(float64(s.LiveTuples))
+	deadTuples.WithLabelValues(label).Set(float64(s.DeadTuples))
+	modsSinceAnalyze.WithLabelValues(label).Set(float64(s.ModsSinceAnalyze))
+
+	advice := Advise(s, a.opts)
+	for _, adv := range allAdvice {
+		advisories.WithLabelValues(label, string(adv)).Set(0)
+	}
+	for _, adv := range advice {
+		if adv == AdviceAnalyze && a.opts.AutoAnalyze {
+			if err := a.analyze(ctx, shardID); err != nil {
+				return err
+			}
+			modsSinceAnalyze.WithLabelValues(label).Set(0)
+			continue
+		}
+		advisories.WithLabelValues(label, string(adv)).Set(1)
+		a.logger.Warn("shard table needs maintenance", "shard_id", shardID, "advice", adv,
+			"live_tuples", s.LiveTuples, "dead_tuples", s.DeadTuples, "mods_since_analyze", s.ModsSinceAnalyze,
+			"last_vacuum", s.LastVacuum, "last_analyze", s.LastAnalyze)
+	}
+	return nil
+}
+
+func (a *Advisor) analyze(ctx context.Context, shardID int) error {
+	start := time.Now()
+	if err := Analyze(ctx, a.store, shardID); err != nil {
+		return err
+	}
+	a.logger.Info("analyzed shard table", "shard_id", shardID, "duration", time.Since(start))
+	return nil
+}
+
+// Analyze runs ANALYZE on shardID's table and counts the result, for
+// callers such as bulk imports that leave statistics behind.
+func Analyze(ctx context.Context, store Store, shardID int) error {
+	if err := store.Analyze(ctx, shardID); err != nil {
+		analyzeTotal.WithLabelValues("error").Inc()
+		return err
+	}
+	analyzeTotal.WithLabelValues("ok").Inc()
+	return nil
+}
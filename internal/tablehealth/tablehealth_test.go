@@ -0,0 +1,135 @@
+package tablehealth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+type fakeStore struct {
+	stats      map[int]TableStats
+	err        error
+	analyzed   []int
+	analyzeErr error
+}
+
+func (f *fakeStore) TableStats(_ context.Context, shardID int) (TableStats, error) {
+	return f.stats[shardID], f.err
+}
+
+func (f *fakeStore) Analyze(_ context.Context, shardID int) error {
+	f.analyzed = append(f.analyzed, shardID)
+	return f.analyzeErr
+}
+
+func TestAdvise(t *testing.T) {
+	opts := New(nil, Options{}, testLogger()).opts
+	analyzed := time.Date(2026, 2, 6, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		stats TableStats
+		want  []Advice
+	}{
+		{"healthy", TableStats{LiveTuples: 100000, DeadTuples: 5000, ModsSinceAnalyze: 5000, LastAnalyze: analyzed}, nil},
+		{"bloated", TableStats{LiveTuples: 100000, DeadTuples: 40000, LastAnalyze: analyzed}, []Advice{AdviceVacuum}},
+		{"stale statistics", TableStats{LiveTuples: 100000, ModsSinceAnalyze: 20000, LastAnalyze: analyzed}, []Advice{AdviceAnalyze}},
+		{"never analyzed", TableStats{LiveTuples: 5000, ModsSinceAnalyze: 5000}, []Advice{AdviceAnalyze}},
+		{"small table", TableStats{LiveTuples: 100, DeadTuples: 900, ModsSinceAnalyze: 900}, nil},
+		{"both", TableStats{LiveTuples: 10000, DeadTuples: 10000, ModsSinceAnalyze: 20000, LastAnalyze: analyzed}, []Advice{AdviceVacuum, AdviceAnalyze}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Advise(tt.stats, opts); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdvisor_ExportsAdvisories(t *testing.T) {
+	store := &fakeStore{stats: map[int]TableStats{
+		0: {LiveTuples: 100000, DeadTuples: 40000, ModsSinceAnalyze: 50000, LastAnalyze: time.Now()},
+	}}
+	a := New(store, Options{NumShards: 1}, testLogger())
+	if err := a.checkShard(context.Background(), 0); err != nil {
+		t.Fatalf("checkShard: %v", err)
+	}
+	if got := testutil.ToFloat64(deadTuples.WithLabelValues("0")); got != 40000 {
+		t.Errorf("dead tuples: got %v, want 40000", got)
+	}
+	for advice, want := range map[string]float64{"vacuum": 1, "analyze": 1} {
+		if got := testutil.ToFloat64(advisories.WithLabelValues("0", advice)); got != want {
+			t.Errorf("%s advisory: got %v, want %v", advice, got, want)
+		}
+	}
+	if len(store.analyzed) != 0 {
+		t.Errorf("analyzed %v without AutoAnalyze", store.analyzed)
+	}
+
+	// Once the table is vacuumed, its advisory is cleared.
+	store.stats[0] = TableStats{LiveTuples: 100000, ModsSinceAnalyze: 50000, LastAnalyze: time.Now()}
+	if err := a.checkShard(context.Background(), 0); err != nil {
+		t.Fatalf("checkShard: %v", err)
+	}
+	if got := testutil.ToFloat64(advisories.WithLabelValues("0", "vacuum")); got != 0 {
+		t.Errorf("vacuum advisory after vacuum: got %v, want 0", got)
+	}
+}
+
+func TestAdvisor_AutoAnalyze(t *testing.T) {
+	store := &fakeStore{stats: map[int]TableStats{
+		1: {LiveTuples: 100000, ModsSinceAnalyze: 50000},
+		2: {LiveTuples: 100000, ModsSinceAnalyze: 10, LastAnalyze: time.Now()},
+	}}
+	a := New(store, Options{NumShards: 3, AutoAnalyze: true}, testLogger())
+	before := testutil.ToFloat64(analyzeTotal.WithLabelValues("ok"))
+	for id := range 3 {
+		if err := a.checkShard(context.Background(), id); err != nil {
+			t.Fatalf("checkShard(%d): %v", id, err)
+		}
+	}
+	if !slices.Equal(store.analyzed, []int{1}) {
+		t.Errorf("analyzed %v, want [1]", store.analyzed)
+	}
+	if got := testutil.ToFloat64(analyzeTotal.WithLabelValues("ok")) - before; got != 1 {
+		t.Errorf("analyze count: got %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(advisories.WithLabelValues("1", "analyze")); got != 0 {
+		t.Errorf("analyze advisory after analyzing: got %v, want 0", got)
+	}
+
+	store.analyzeErr = errors.New("canceling statement due to statement timeout")
+	if err := a.checkShard(context.Background(), 1); err == nil {
+		t.Error("failed analyze: expected error")
+	}
+}
+
+func TestAdvisor_RunShardClearsMetrics(t *testing.T) {
+	store := &fakeStore{stats: map[int]TableStats{5: {LiveTuples: 10, DeadTuples: 2}}}
+	a := New(store, Options{NumShards: 6, Interval: time.Hour}, testLogger())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		a.RunShard(ctx, 5)
+		close(done)
+	}()
+	deadline := time.Now().Add(time.Second)
+	for testutil.ToFloat64(liveTuples.WithLabelValues("5")) != 10 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+	if liveTuples.DeleteLabelValues("5") {
+		t.Error("live tuples still exported after the shard was released")
+	}
+}
@@ -0,0 +1,237 @@
+package trigger
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Checkpoint is a plugin's oldest undelivered cell on a shard. A
+// cell.written notification for the cell at AddedID failed after all
+// retries, so the plugin cannot be assumed to have seen it or any later cell
+// of the shard. The checkpoint is held until the plugin has caught up, e.g.
+// with partitionRead from AddedID-1, and releases it; until then garbage
+// collection leaves those cells alone (see internal/compaction).
+type Checkpoint struct {
+	PluginID  uuid.UUID
+	ShardID   int
+	AddedID   int64
+	UpdatedAt time.Time
+	// Columns are the plugin's subscribed columns and those of its
+	// subscribed streams, or for a chained plugin those of its chain's
+	// first plugin: the only ones the checkpoint holds back.
+	Columns []string
+	// Handler names the internal handler (see Notifier.AddHandler) the
+	// checkpoint is for, whose columns Columns are; PluginID is then zero.
+	Handler string
+}
+
+// Holds reports whether the checkpoint holds back cells of columnName.
+func (c Checkpoint) Holds(columnName string) bool {
+	return slices.Contains(c.Columns, columnName)
+}
+
+// CheckpointStore persists trigger checkpoints.
+type CheckpointStore interface {
+	// HoldCheckpoint lowers pluginID's checkpoint on shardID to addedID,
+	// creating it if the plugin has none there.
+	HoldCheckpoint(ctx context.Context, pluginID uuid.UUID, shardID int, addedID int64) error
+	// ListCheckpoints returns every checkpoint with its plugin's subscribed
+	// columns, ordered by plugin and shard.
+	ListCheckpoints(ctx context.Context) ([]Checkpoint, error)
+	// AdvanceCheckpoint moves pluginID's checkpoint on shardID from from up
+	// to to, or deletes it if to is 0. It does nothing and reports false if
+	// the checkpoint is no longer at from, e.g. because a later failure
+	// lowered it.
+	AdvanceCheckpoint(ctx context.Context, pluginID uuid.UUID, shardID int, from, to int64) (bool, error)
+	// ReleaseCheckpoints deletes pluginID's checkpoints and returns how many
+	// there were.
+	ReleaseCheckpoints(ctx context.Context, pluginID uuid.UUID) (int64, error)
+}
+
+// HandlerCheckpointStore is implemented by checkpoint stores that also keep
+// the checkpoints of internal handlers, by handler name. Their
+// ListCheckpoints returns those too, with Handler set.
+type HandlerCheckpointStore interface {
+	// HoldHandlerCheckpoint lowers handler's checkpoint on shardID to
+	// addedID, creating it if the handler has none there, and records
+	// columns, the handler's, as those it holds back.
+	HoldHandlerCheckpoint(ctx context.Context, handler string, columns []string, shardID int, addedID int64) error
+	// AdvanceHandlerCheckpoint is AdvanceCheckpoint for a handler's
+	// checkpoint.
+	AdvanceHandlerCheckpoint(ctx context.Context, handler string, shardID int, from, to int64) (bool, error)
+}
+
+// PostgresCheckpointStore implements CheckpointStore and
+// HandlerCheckpointStore backed by the trigger_checkpoints and
+// handler_checkpoints tables (see storage.RunPluginMigration). Plugin
+// checkpoints are deleted with their plugin.
+type PostgresCheckpointStore struct {
+	pool         *pgxpool.Pool
+	queryTimeout time.Duration
+}
+
+// NewPostgresCheckpointStore creates a CheckpointStore using the given
+// connection pool. queryTimeout sets the per-query context deadline; zero
+// means no timeout.
+func NewPostgresCheckpointStore(pool *pgxpool.Pool, queryTimeout time.Duration) *PostgresCheckpointStore {
+	return &PostgresCheckpointStore{pool: pool, queryTimeout: queryTimeout}
+}
+
+func (s *PostgresCheckpointStore) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.queryTimeout > 0 {
+		return context.WithTimeout(ctx, s.queryTimeout)
+	}
+	return ctx, func() {}
+}
+
+func (s *PostgresCheckpointStore) HoldCheckpoint(ctx context.Context, pluginID uuid.UUID, shardID int, addedID int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.pool.Exec(ctx, `
+		INSERT INTO trigger_checkpoints (plugin_id, shard_id, added_id, updated_at)
+		VALUES ($1, $2, $3, now())
+		ON CONFLICT (plugin_id, shard_id) DO UPDATE
+		SET added_id = EXCLUDED.added_id, updated_at = EXCLUDED.updated_at
+		WHERE trigger_checkpoints.added_id > EXCLUDED.added_id
+	`, pluginID, shardID, addedID); err != nil {
+		return fmt.Errorf("hold trigger checkpoint: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresCheckpointStore) AdvanceCheckpoint(ctx context.Context, pluginID uuid.UUID, shardID int, from, to int64) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var tag pgconn.CommandTag
+	var err error
+	if to == 0 {
+		tag, err = s.pool.Exec(ctx, `
+			DELETE FROM trigger_checkpoints
+			WHERE plugin_id = $1 AND shard_id = $2 AND added_id = $3
+		`, pluginID, shardID, from)
+	} else {
+		tag, err = s.pool.Exec(ctx, `
+			UPDATE trigger_checkpoints SET added_id = $4, updated_at = now()
+			WHERE plugin_id = $1 AND shard_id = $2 AND added_id = $3
+		`, pluginID, shardID, from, to)
+	}
+	if err != nil {
+		return false, fmt.Errorf("advance trigger checkpoint: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (s *PostgresCheckpointStore) ListCheckpoints(ctx context.Context) ([]Checkpoint, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	// A chained plugin's cells are selected by its chain's first plugin.
+	rows, err := s.pool.Query(ctx, `
+		WITH RECURSIVE chain (id, name, root) AS (
+			SELECT id, name, id FROM plugins WHERE after = ''
+			UNION ALL
+			SELECT p.id, p.name, chain.root FROM plugins p JOIN chain ON p.after = chain.name
+		)
+		SELECT c.plugin_id, c.shard_id, c.added_id, c.updated_at,
+			p.subscribed_columns || ARRAY(
+				SELECT DISTINCT unnest(s.columns) FROM streams s
+				WHERE s.name = ANY(p.subscribed_streams)
+			)
+		FROM trigger_checkpoints c
+		JOIN chain ON chain.id = c.plugin_id
+		JOIN plugins p ON p.id = chain.root
+		ORDER BY c.plugin_id, c.shard_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("list trigger checkpoints: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Checkpoint
+	for rows.Next() {
+		var c Checkpoint
+		if err := rows.Scan(&c.PluginID, &c.ShardID, &c.AddedID, &c.UpdatedAt, &c.Columns); err != nil {
+			return nil, fmt.Errorf("scan trigger checkpoint: %w", err)
+		}
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list trigger checkpoints: %w", err)
+	}
+
+	rows, err = s.pool.Query(ctx, `
+		SELECT handler, shard_id, added_id, updated_at, columns
+		FROM handler_checkpoints
+		ORDER BY handler, shard_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("list handler checkpoints: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c Checkpoint
+		if err := rows.Scan(&c.Handler, &c.ShardID, &c.AddedID, &c.UpdatedAt, &c.Columns); err != nil {
+			return nil, fmt.Errorf("scan handler checkpoint: %w", err)
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func (s *PostgresCheckpointStore) HoldHandlerCheckpoint(ctx context.Context, handler string, columns []string, shardID int, addedID int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.pool.Exec(ctx, `
+		INSERT INTO handler_checkpoints (handler, shard_id, added_id, columns, updated_at)
+		VALUES ($1, $2, $3, $4, now())
+		ON CONFLICT (handler, shard_id) DO UPDATE
+		SET added_id = EXCLUDED.added_id, columns = EXCLUDED.columns, updated_at = EXCLUDED.updated_at
+		WHERE handler_checkpoints.added_id > EXCLUDED.added_id
+	`, handler, shardID, addedID, columns); err != nil {
+		return fmt.Errorf("hold handler checkpoint: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresCheckpointStore) AdvanceHandlerCheckpoint(ctx context.Context, handler string, shardID int, from, to int64) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var tag pgconn.CommandTag
+	var err error
+	if to == 0 {
+		tag, err = s.pool.Exec(ctx, `
+			DELETE FROM handler_checkpoints
+			WHERE handler = $1 AND shard_id = $2 AND added_id = $3
+		`, handler, shardID, from)
+	} else {
+		tag, err = s.pool.Exec(ctx, `
+			UPDATE handler_checkpoints SET added_id = $4, updated_at = now()
+			WHERE handler = $1 AND shard_id = $2 AND added_id = $3
+		`, handler, shardID, from, to)
+	}
+	if err != nil {
+		return false, fmt.Errorf("advance handler checkpoint: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (s *PostgresCheckpointStore) ReleaseCheckpoints(ctx context.Context, pluginID uuid.UUID) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := s.pool.Exec(ctx, `DELETE FROM trigger_checkpoints WHERE plugin_id = $1`, pluginID)
+	if err != nil {
+		return 0, fmt.Errorf("release trigger checkpoints: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,12 @@
+package trigger_test
+
+import (
+	"testing"
+
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger/pluginstoretest"
+)
+
+func TestMemoryPluginStore_Conformance(t *testing.T) {
+	pluginstoretest.Run(t, func(*testing.T) trigger.PluginStore { return trigger.NewMemoryPluginStore() })
+}
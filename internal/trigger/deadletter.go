@@ -0,0 +1,148 @@
+package trigger
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultDeadLetterCapacity is how many failed deliveries a Notifier keeps.
+const defaultDeadLetterCapacity = 100
+
+// DeadLetter is a cell.written notification that could not be delivered
+// after all retries.
+type DeadLetter struct {
+	Plugin     string    `json:"plugin"`
+	Endpoint   string    `json:"endpoint"`
+	ShardID    int       `json:"shard_id"`
+	AddedID    int64     `json:"added_id"`
+	RowKey     string    `json:"row_key"`
+	ColumnName string    `json:"column_name"`
+	RefKey     int64     `json:"ref_key"`
+	Error      string    `json:"error"`
+	FailedAt   time.Time `json:"failed_at"`
+	// Skipped is set when the watchdog gave up redelivering the cell and
+	// moved the plugin's checkpoint past it (see Watchdog).
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+func newDeadLetter(pluginName, endpoint string, params CellWrittenParams, err error) DeadLetter {
+	return DeadLetter{
+		Plugin:     pluginName,
+		Endpoint:   endpoint,
+		ShardID:    params.ShardID,
+		AddedID:    params.AddedID,
+		RowKey:     params.RowKey,
+		ColumnName: params.ColumnName,
+		RefKey:     params.RefKey,
+		Error:      err.Error(),
+		FailedAt:   time.Now(),
+	}
+}
+
+// DeadLetterLog is a fixed-size, thread-safe ring buffer of the most recent
+// dead letters. It is in-memory only and intended for operator visibility.
+type DeadLetterLog struct {
+	mu      sync.Mutex
+	entries []DeadLetter
+	next    int
+	full    bool
+}
+
+// NewDeadLetterLog creates a log holding up to capacity entries.
+func NewDeadLetterLog(capacity int) *DeadLetterLog {
+	if capacity <= 0 {
+		capacity = defaultDeadLetterCapacity
+	}
+	return &DeadLetterLog{entries: make([]DeadLetter, capacity)}
+}
+
+// Add records a dead letter, evicting the oldest entry when full.
+func (l *DeadLetterLog) Add(d DeadLetter) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries[l.next] = d
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Recent returns the retained dead letters, newest first.
+func (l *DeadLetterLog) Recent() []DeadLetter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := l.next
+	if l.full {
+		n = len(l.entries)
+	}
+	out := make([]DeadLetter, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+	return out
+}
+
+// DeliveryStats summarises notification delivery to one plugin since startup.
+type DeliveryStats struct {
+	Delivered int64 `json:"delivered"`
+	Failed    int64 `json:"failed"`
+	// InFlight is the number of notifications currently being delivered
+	// (including retries). A growing value means the plugin is falling behind.
+	InFlight int64 `json:"in_flight"`
+	// LastAddedID is the added_id of the most recently delivered cell.
+	LastAddedID     int64     `json:"last_added_id"`
+	LastDeliveredAt time.Time `json:"last_delivered_at,omitzero"`
+	LastError       string    `json:"last_error,omitempty"`
+}
+
+// deliveryTracker keeps DeliveryStats per plugin name.
+type deliveryTracker struct {
+	mu    sync.Mutex
+	stats map[string]*DeliveryStats
+}
+
+func newDeliveryTracker() *deliveryTracker {
+	return &deliveryTracker{stats: make(map[string]*DeliveryStats)}
+}
+
+func (t *deliveryTracker) get(plugin string) *DeliveryStats {
+	s, ok := t.stats[plugin]
+	if !ok {
+		s = &DeliveryStats{}
+		t.stats[plugin] = s
+	}
+	return s
+}
+
+func (t *deliveryTracker) start(plugin string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.get(plugin).InFlight++
+}
+
+func (t *deliveryTracker) done(plugin string, addedID int64, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.get(plugin)
+	s.InFlight--
+	if err != nil {
+		s.Failed++
+		s.LastError = err.Error()
+		return
+	}
+	s.Delivered++
+	s.LastDeliveredAt = time.Now()
+	if addedID > s.LastAddedID {
+		s.LastAddedID = addedID
+	}
+}
+
+func (t *deliveryTracker) snapshot() map[string]DeliveryStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[string]DeliveryStats, len(t.stats))
+	for name, s := range t.stats {
+		out[name] = *s
+	}
+	return out
+}
@@ -0,0 +1,53 @@
+package trigger
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDeadLetterLog_NewestFirst(t *testing.T) {
+	l := NewDeadLetterLog(3)
+	for i := range 2 {
+		l.Add(DeadLetter{AddedID: int64(i + 1)})
+	}
+
+	got := l.Recent()
+	if len(got) != 2 || got[0].AddedID != 2 || got[1].AddedID != 1 {
+		t.Errorf("got %+v, want added_ids [2 1]", got)
+	}
+}
+
+func TestDeadLetterLog_EvictsOldest(t *testing.T) {
+	l := NewDeadLetterLog(3)
+	for i := range 5 {
+		l.Add(DeadLetter{AddedID: int64(i + 1)})
+	}
+
+	got := l.Recent()
+	if len(got) != 3 {
+		t.Fatalf("got %d entries, want 3", len(got))
+	}
+	for i, want := range []int64{5, 4, 3} {
+		if got[i].AddedID != want {
+			t.Errorf("entry %d: got added_id %d, want %d", i, got[i].AddedID, want)
+		}
+	}
+}
+
+func TestDeliveryTracker(t *testing.T) {
+	tr := newDeliveryTracker()
+	tr.start("p")
+	tr.start("p")
+	tr.done("p", 10, nil)
+
+	s := tr.snapshot()["p"]
+	if s.InFlight != 1 || s.Delivered != 1 || s.LastAddedID != 10 {
+		t.Errorf("got %+v", s)
+	}
+
+	tr.done("p", 11, errors.New("boom"))
+	s = tr.snapshot()["p"]
+	if s.InFlight != 0 || s.Failed != 1 || s.LastError != "boom" || s.LastAddedID != 10 {
+		t.Errorf("got %+v", s)
+	}
+}
@@ -0,0 +1,87 @@
+package trigger
+
+import (
+	"context"
+	"slices"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+)
+
+var handlerFailures = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "mezzanine",
+		Name:      "trigger_handler_failures_total",
+		Help:      "Cells an internal trigger handler failed to handle, or did not get to before the notifier shut down, by handler.",
+	},
+	[]string{"handler"},
+)
+
+// HandlerFunc handles a cell written to shard shardID.
+type HandlerFunc func(ctx context.Context, shardID int, c *cell.Cell) error
+
+// handler is a trigger handler run in-process instead of by a plugin.
+type handler struct {
+	name    string
+	columns []string
+	fn      HandlerFunc
+}
+
+// AddHandler makes the notifier run fn, in a goroutine of its own, on every
+// cell written to one of columns, including cells derived by plugins. Like
+// plugin deliveries, handlers never block writes: their errors are logged
+// and counted, not returned, and the handler's checkpoint on the shard is
+// held at the cell, as a plugin's is, for the watchdog to run fn on it
+// again. fn must therefore be idempotent. AddHandler must be called before
+// the notifier is used.
+func (n *Notifier) AddHandler(name string, columns []string, fn HandlerFunc) {
+	n.handlers = append(n.handlers, handler{name: name, columns: columns, fn: fn})
+}
+
+// runHandlers dispatches c to the handlers of its column.
+func (n *Notifier) runHandlers(shardID int, c *cell.Cell) {
+	for _, h := range n.handlers {
+		if !slices.Contains(h.columns, c.ColumnName) {
+			continue
+		}
+		if n.ctx.Err() != nil {
+			handlerFailures.WithLabelValues(h.name).Inc()
+			n.logger.Warn("trigger handler skipped after shutdown", "handler", h.name, "shard_id", shardID, "added_id", c.AddedID)
+			n.spawn(func(context.Context) { n.holdHandlerCheckpoint(h, shardID, c.AddedID) })
+			continue
+		}
+		n.spawn(func(ctx context.Context) {
+			if err := h.fn(ctx, shardID, c); err != nil {
+				handlerFailures.WithLabelValues(h.name).Inc()
+				n.logger.Error("trigger handler failed", "handler", h.name, "column", c.ColumnName, "row_key", c.RowKey, "shard_id", shardID, "added_id", c.AddedID, "error", err)
+				n.holdHandlerCheckpoint(h, shardID, c.AddedID)
+			}
+		})
+	}
+}
+
+// handlerNamed returns the handler added as name.
+func (n *Notifier) handlerNamed(name string) (handler, bool) {
+	for _, h := range n.handlers {
+		if h.name == name {
+			return h, true
+		}
+	}
+	return handler{}, false
+}
+
+// holdHandlerCheckpoint holds h's checkpoint on shardID at addedID, if the
+// checkpoint store keeps handler checkpoints.
+func (n *Notifier) holdHandlerCheckpoint(h handler, shardID int, addedID int64) {
+	store, ok := n.checkpoints.(HandlerCheckpointStore)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), checkpointTimeout)
+	defer cancel()
+	if err := store.HoldHandlerCheckpoint(ctx, h.name, h.columns, shardID, addedID); err != nil {
+		checkpointFailures.WithLabelValues("hold").Inc()
+		n.logger.Error("failed to hold trigger handler checkpoint", "handler", h.name, "shard_id", shardID, "added_id", addedID, "error", err)
+	}
+}
@@ -0,0 +1,148 @@
+package trigger
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ErrHostQueueFull is returned for a call to a plugin host whose queue of
+// calls waiting for a free slot is full.
+var ErrHostQueueFull = errors.New("plugin host queue full")
+
+var (
+	hostInflight = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "mezzanine",
+			Name:      "trigger_host_inflight",
+			Help:      "Plugin calls in flight per endpoint host.",
+		},
+		[]string{"host"},
+	)
+	hostQueued = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "mezzanine",
+			Name:      "trigger_host_queued",
+			Help:      "Plugin calls waiting for a free slot per endpoint host.",
+		},
+		[]string{"host"},
+	)
+)
+
+// hostLimiter caps the calls in flight to each plugin endpoint host. Calls
+// over the cap wait for a slot, roughly in arrival order, up to a maximum
+// number waiting per host. A host is forgotten once no call holds or waits
+// for one of its slots, so endpoints no longer called take no memory.
+type hostLimiter struct {
+	maxInflight int
+	maxQueue    int // 0 leaves the queue unbounded
+
+	mu    sync.Mutex
+	hosts map[string]*hostSlots
+}
+
+type hostSlots struct {
+	sem    chan struct{}
+	queued int // guarded by hostLimiter.mu
+	calls  int // holding or waiting for a slot; guarded by hostLimiter.mu
+}
+
+func newHostLimiter(maxInflight, maxQueue int) *hostLimiter {
+	return &hostLimiter{maxInflight: maxInflight, maxQueue: maxQueue, hosts: make(map[string]*hostSlots)}
+}
+
+// hostSeries counts the calls of every limiter holding or waiting for a
+// slot of each host, since limiters share the per-host gauges: a host's
+// series are deleted once it has none.
+var hostSeries = struct {
+	sync.Mutex
+	calls map[string]int
+}{calls: make(map[string]int)}
+
+func trackHostSeries(host string, delta int) {
+	hostSeries.Lock()
+	defer hostSeries.Unlock()
+	hostSeries.calls[host] += delta
+	if hostSeries.calls[host] == 0 {
+		delete(hostSeries.calls, host)
+		hostInflight.DeleteLabelValues(host)
+		hostQueued.DeleteLabelValues(host)
+	}
+}
+
+// endpointHost returns the host and port calls to endpoint are limited by.
+func endpointHost(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return endpoint
+	}
+	return u.Host
+}
+
+// acquire waits for a slot to call host and returns the function that
+// frees it. It fails with ErrHostQueueFull if too many calls are waiting
+// already, or with ctx's error if ctx is done first.
+func (l *hostLimiter) acquire(ctx context.Context, host string) (func(), error) {
+	l.mu.Lock()
+	h, ok := l.hosts[host]
+	if !ok {
+		h = &hostSlots{sem: make(chan struct{}, l.maxInflight)}
+		l.hosts[host] = h
+	}
+	release := func() {
+		<-h.sem
+		hostInflight.WithLabelValues(host).Dec()
+		l.done(host, h)
+	}
+	select {
+	case h.sem <- struct{}{}:
+		h.calls++
+		l.mu.Unlock()
+		trackHostSeries(host, 1)
+		hostInflight.WithLabelValues(host).Inc()
+		return release, nil
+	default:
+	}
+	if l.maxQueue > 0 && h.queued >= l.maxQueue {
+		l.mu.Unlock()
+		return nil, ErrHostQueueFull
+	}
+	h.calls++
+	h.queued++
+	l.mu.Unlock()
+	trackHostSeries(host, 1)
+	hostQueued.WithLabelValues(host).Inc()
+
+	dequeue := func() {
+		l.mu.Lock()
+		h.queued--
+		l.mu.Unlock()
+		hostQueued.WithLabelValues(host).Dec()
+	}
+	select {
+	case h.sem <- struct{}{}:
+		dequeue()
+		hostInflight.WithLabelValues(host).Inc()
+		return release, nil
+	case <-ctx.Done():
+		dequeue()
+		l.done(host, h)
+		return nil, ctx.Err()
+	}
+}
+
+// done ends a call's claim on h, forgetting host once nothing holds or
+// waits for its slots.
+func (l *hostLimiter) done(host string, h *hostSlots) {
+	l.mu.Lock()
+	h.calls--
+	if h.calls == 0 && l.hosts[host] == h {
+		delete(l.hosts, host)
+	}
+	l.mu.Unlock()
+	trackHostSeries(host, -1)
+}
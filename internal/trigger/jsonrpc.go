@@ -10,6 +10,8 @@ import (
 	"net/http"
 	"sync/atomic"
 	"time"
+
+	"github.com/ryanbastic/go-mezzanine/pkg/plugin"
 )
 
 // JSONRPCRequest is a JSON-RPC 2.0 request.
@@ -47,27 +49,86 @@ type CellWrittenParams struct {
 	Body       json.RawMessage `json:"body"`
 	CreatedAt  time.Time       `json:"created_at"`
 	ShardID    int             `json:"shard_id"`
+	// Streams are the plugin's subscribed streams the cell belongs to.
+	Streams []string `json:"streams,omitempty"`
+	// SchemaVersion is the version of the column's latest registered schema
+	// (see internal/schema), 0 if it has none.
+	SchemaVersion int `json:"schema_version,omitempty"`
+	// Provenance is set for cells derived by a plugin.
+	Provenance *Provenance `json:"provenance,omitempty"`
 }
 
-// RPCClient sends JSON-RPC 2.0 requests over HTTP with retries.
+// RPCClient sends JSON-RPC 2.0 requests over HTTP with retries, encoded as
+// JSON or with another plugin.Codec.
 type RPCClient struct {
 	httpClient *http.Client
 	nextID     atomic.Int64
 	maxRetries int
 	baseDelay  time.Duration
+	secret     []byte
+	hosts      *hostLimiter // optional; nil leaves calls per host unlimited
+	// syncHosts limits the synchronous calls of writes waiting on them
+	// apart from hosts, so that a backlog of deliveries never holds up,
+	// or fills the queue of, a write.
+	syncHosts *hostLimiter
+}
+
+// syncCallKey marks the context of a synchronous call (see withSyncCall).
+type syncCallKey struct{}
+
+// withSyncCall returns ctx for a call a write waits on, which takes its
+// host slot from the synchronous calls' own limits.
+func withSyncCall(ctx context.Context) context.Context {
+	return context.WithValue(ctx, syncCallKey{}, true)
 }
 
-// NewRPCClient creates a client with the given retry settings and timeout.
+// NewRPCClient creates a client with the given retry settings and timeout,
+// calling plugins over a transport with the default TransportOptions.
 func NewRPCClient(maxRetries int, baseDelay time.Duration, timeout time.Duration) *RPCClient {
 	return &RPCClient{
-		httpClient: &http.Client{Timeout: timeout},
+		httpClient: &http.Client{Timeout: timeout, Transport: NewTransport(TransportOptions{})},
 		maxRetries: maxRetries,
 		baseDelay:  baseDelay,
 	}
 }
 
+// SetTransport replaces the HTTP transport used for plugin calls, e.g. with
+// one from NewTransport or to inject faults in tests. It must be called
+// before the client is used.
+func (c *RPCClient) SetTransport(rt http.RoundTripper) {
+	c.httpClient.Transport = rt
+}
+
+// SetSigningSecret makes the client sign every request body with an HMAC
+// (see pkg/plugin.Sign) so plugins can verify notifications came from this
+// server. It must be called before the client is used.
+func (c *RPCClient) SetSigningSecret(secret []byte) {
+	c.secret = secret
+}
+
+// SetHostLimits caps the calls in flight to each endpoint host (host and
+// port) at maxInflight. Calls over the cap wait for a slot; with maxQueue
+// set, a call finding that many waiting fails with ErrHostQueueFull, and
+// is retried like a network error. A slot is held for one attempt, not
+// through the backoff between retries. Synchronous validations of writes
+// have limits of their own, of the same size, so deliveries never take
+// their slots. It must be called before the client is used; maxInflight 0
+// leaves calls unlimited.
+func (c *RPCClient) SetHostLimits(maxInflight, maxQueue int) {
+	if maxInflight > 0 {
+		c.hosts = newHostLimiter(maxInflight, maxQueue)
+		c.syncHosts = newHostLimiter(maxInflight, maxQueue)
+	}
+}
+
 // Call sends a JSON-RPC 2.0 request to endpoint. Retries on 5xx/network errors.
 func (c *RPCClient) Call(ctx context.Context, endpoint, method string, params any) (*JSONRPCResponse, error) {
+	return c.CallWith(ctx, plugin.JSON, endpoint, method, params)
+}
+
+// CallWith is Call with the request encoded by codec. The response is
+// decoded according to its Content-Type.
+func (c *RPCClient) CallWith(ctx context.Context, codec plugin.Codec, endpoint, method string, params any) (*JSONRPCResponse, error) {
 	id := c.nextID.Add(1)
 	reqBody := JSONRPCRequest{
 		JSONRPC: "2.0",
@@ -76,7 +137,7 @@ func (c *RPCClient) Call(ctx context.Context, endpoint, method string, params an
 		ID:      id,
 	}
 
-	data, err := json.Marshal(reqBody)
+	data, err := codec.Marshal(reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("marshal rpc request: %w", err)
 	}
@@ -87,7 +148,7 @@ func (c *RPCClient) Call(ctx context.Context, endpoint, method string, params an
 			return nil, err
 		}
 
-		resp, err := c.doRequest(ctx, endpoint, data)
+		resp, err := c.attempt(ctx, codec, endpoint, data)
 		if err == nil {
 			return resp, nil
 		}
@@ -106,12 +167,32 @@ func (c *RPCClient) Call(ctx context.Context, endpoint, method string, params an
 	return nil, fmt.Errorf("rpc call failed after %d attempts: %w", c.maxRetries+1, lastErr)
 }
 
-func (c *RPCClient) doRequest(ctx context.Context, endpoint string, data []byte) (*JSONRPCResponse, error) {
+// attempt makes one request to endpoint, in a slot of its host if calls per
+// host are limited.
+func (c *RPCClient) attempt(ctx context.Context, codec plugin.Codec, endpoint string, data []byte) (*JSONRPCResponse, error) {
+	hosts := c.hosts
+	if ctx.Value(syncCallKey{}) != nil {
+		hosts = c.syncHosts
+	}
+	if hosts != nil {
+		release, err := hosts.acquire(ctx, endpointHost(endpoint))
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+	return c.doRequest(ctx, codec, endpoint, data)
+}
+
+func (c *RPCClient) doRequest(ctx context.Context, codec plugin.Codec, endpoint string, data []byte) (*JSONRPCResponse, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", codec.ContentType())
+	if len(c.secret) > 0 {
+		req.Header.Set(plugin.SignatureHeader, plugin.Sign(c.secret, data, time.Now()))
+	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -132,8 +213,12 @@ func (c *RPCClient) doRequest(ctx context.Context, endpoint string, data []byte)
 		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(body))
 	}
 
+	respCodec, ok := plugin.CodecFor(resp.Header.Get("Content-Type"))
+	if !ok {
+		respCodec = codec
+	}
 	var rpcResp JSONRPCResponse
-	if err := json.Unmarshal(body, &rpcResp); err != nil {
+	if err := respCodec.Unmarshal(body, &rpcResp); err != nil {
 		return nil, fmt.Errorf("unmarshal rpc response: %w", err)
 	}
 
@@ -3,11 +3,14 @@ package trigger
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/ryanbastic/go-mezzanine/pkg/plugin"
 )
 
 func TestRPCClient_Call_Success(t *testing.T) {
@@ -136,6 +139,200 @@ func TestRPCClient_Call_ContextCancellation(t *testing.T) {
 	}
 }
 
+func TestRPCClient_Call_LimitsCallsPerHost(t *testing.T) {
+	var inflight, peak atomic.Int32
+	unblock := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inflight.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		<-unblock
+		inflight.Add(-1)
+		var req JSONRPCRequest
+		json.NewDecoder(r.Body).Decode(&req) //nolint:errcheck
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(JSONRPCResponse{JSONRPC: "2.0", Result: json.RawMessage(`"ok"`), ID: req.ID}) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	client := NewRPCClient(0, time.Millisecond, 5*time.Second)
+	client.SetHostLimits(2, 3)
+
+	const calls = 8
+	errs := make(chan error, calls)
+	for range calls {
+		go func() {
+			_, err := client.Call(context.Background(), srv.URL+"/rpc", "cell.written", nil)
+			errs <- err
+		}()
+	}
+	// Two calls are in flight and three queued; the other three find the
+	// queue full.
+	var full int
+	for range 3 {
+		if err := <-errs; !errors.Is(err, ErrHostQueueFull) {
+			t.Errorf("call over the queue: got %v, want ErrHostQueueFull", err)
+		}
+		full++
+	}
+	for deadline := time.Now().Add(5 * time.Second); inflight.Load() < 2 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	close(unblock)
+	for range calls - full {
+		if err := <-errs; err != nil {
+			t.Errorf("queued call: %v", err)
+		}
+	}
+	if p := peak.Load(); p != 2 {
+		t.Errorf("peak calls in flight: got %d, want 2", p)
+	}
+}
+
+func TestRPCClient_Call_SyncCallsHaveTheirOwnHostLimits(t *testing.T) {
+	unblock := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req JSONRPCRequest
+		json.NewDecoder(r.Body).Decode(&req) //nolint:errcheck
+		if req.Method == "cell.written" {
+			<-unblock
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(JSONRPCResponse{JSONRPC: "2.0", Result: json.RawMessage(`"ok"`), ID: req.ID}) //nolint:errcheck
+	}))
+	defer srv.Close()
+	defer close(unblock)
+
+	client := NewRPCClient(0, time.Millisecond, 5*time.Second)
+	client.SetHostLimits(1, 1)
+	// One delivery takes the host's slot and another its queue.
+	for range 2 {
+		go client.Call(context.Background(), srv.URL+"/rpc", "cell.written", nil) //nolint:errcheck
+	}
+	var err error
+	for deadline := time.Now().Add(5 * time.Second); !errors.Is(err, ErrHostQueueFull) && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, err = client.Call(ctx, srv.URL+"/rpc", "cell.written", nil)
+		cancel()
+	}
+	if !errors.Is(err, ErrHostQueueFull) {
+		t.Fatalf("delivery over the queue: got %v, want ErrHostQueueFull", err)
+	}
+
+	ctx, cancel := context.WithTimeout(withSyncCall(context.Background()), 2*time.Second)
+	defer cancel()
+	if _, err := client.Call(ctx, srv.URL+"/rpc", "cell.validate", nil); err != nil {
+		t.Errorf("synchronous call behind a full delivery queue: %v", err)
+	}
+}
+
+func TestHostLimiter_ForgetsIdleHosts(t *testing.T) {
+	l := newHostLimiter(1, 0)
+	release, err := l.acquire(context.Background(), "a:80")
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	// A call waiting for the slot keeps the host until it gives up.
+	ctx, cancel := context.WithCancel(context.Background())
+	waited := make(chan error)
+	go func() {
+		_, err := l.acquire(ctx, "a:80")
+		waited <- err
+	}()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		l.mu.Lock()
+		queued := l.hosts["a:80"].queued
+		l.mu.Unlock()
+		if queued == 1 {
+			break
+		}
+	}
+	cancel()
+	if err := <-waited; !errors.Is(err, context.Canceled) {
+		t.Fatalf("waiting call: got %v, want context.Canceled", err)
+	}
+	release()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.hosts) != 0 {
+		t.Errorf("idle hosts kept: %v", l.hosts)
+	}
+}
+
+func TestRPCClient_Call_SignedForPluginSDK(t *testing.T) {
+	secret := []byte("s3cret")
+	p := plugin.New(plugin.Options{Secret: secret})
+	var got plugin.CellWritten
+	p.OnCellWritten(func(_ context.Context, c plugin.CellWritten) error {
+		got = c
+		return nil
+	})
+	srv := httptest.NewServer(p.Handler())
+	defer srv.Close()
+
+	params := CellWrittenParams{AddedID: 9, RowKey: "550e8400-e29b-41d4-a716-446655440000", ColumnName: "billing", Body: json.RawMessage(`{}`), CreatedAt: time.Now()}
+
+	unsigned := NewRPCClient(0, time.Millisecond, 5*time.Second)
+	if _, err := unsigned.Call(context.Background(), srv.URL+"/rpc", "cell.written", params); err == nil {
+		t.Error("unsigned call: expected rejection")
+	}
+
+	client := NewRPCClient(0, time.Millisecond, 5*time.Second)
+	client.SetSigningSecret(secret)
+	resp, err := client.Call(context.Background(), srv.URL+"/rpc", "cell.written", params)
+	if err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if resp.Error != nil {
+		t.Fatalf("rpc error: %v", resp.Error)
+	}
+	if got.AddedID != 9 {
+		t.Errorf("plugin got added_id %d, want 9", got.AddedID)
+	}
+}
+
+func TestRPCClient_CallWith_MessagePack(t *testing.T) {
+	p := plugin.New(plugin.Options{})
+	var got plugin.CellWritten
+	p.OnCellWritten(func(_ context.Context, c plugin.CellWritten) error {
+		got = c
+		return nil
+	})
+	var contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		p.Handler().ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	params := CellWrittenParams{AddedID: 9, RowKey: "550e8400-e29b-41d4-a716-446655440000", ColumnName: "billing", Body: json.RawMessage(`{"amount":4.5,"id":9007199254740993,"tags":["a"]}`), CreatedAt: created, Streams: []string{"eu"}}
+
+	client := NewRPCClient(0, time.Millisecond, 5*time.Second)
+	resp, err := client.CallWith(context.Background(), plugin.MessagePack, srv.URL+"/rpc", "cell.written", params)
+	if err != nil {
+		t.Fatalf("CallWith: %v", err)
+	}
+	if resp.Error != nil || string(resp.Result) != `"ok"` {
+		t.Fatalf("response: got result %s, error %v", resp.Result, resp.Error)
+	}
+	if contentType != "application/msgpack" {
+		t.Errorf("Content-Type: got %q, want application/msgpack", contentType)
+	}
+	if got.AddedID != 9 || !got.CreatedAt.Equal(created) || len(got.Streams) != 1 {
+		t.Errorf("plugin got %+v", got)
+	}
+	if string(got.Body) != `{"amount":4.5,"id":9007199254740993,"tags":["a"]}` {
+		t.Errorf("body: got %s", got.Body)
+	}
+}
+
 func TestJSONRPCError_Error(t *testing.T) {
 	e := &JSONRPCError{Code: -32600, Message: "invalid request"}
 	got := e.Error()
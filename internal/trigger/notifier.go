@@ -2,37 +2,209 @@ package trigger
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"sync"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/schema"
+	"github.com/ryanbastic/go-mezzanine/internal/stream"
+)
+
+// checkpointTimeout bounds saving a trigger checkpoint after a failed
+// delivery.
+const checkpointTimeout = 10 * time.Second
+
+var (
+	deliveryDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "mezzanine",
+			Name:      "trigger_delivery_duration_seconds",
+			Help:      "Time to deliver a cell.written notification to a plugin, including retries, by plugin and column.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"plugin", "column"},
+	)
+	checkpointFailures = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "mezzanine",
+			Name:      "trigger_checkpoint_failures_total",
+			Help:      "Trigger checkpoints that could not be saved, by operation: hold after a failed delivery, or advance by the watchdog.",
+		},
+		[]string{"op"},
+	)
+	deliveriesAbandoned = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "mezzanine",
+			Name:      "trigger_deliveries_abandoned_total",
+			Help:      "Deliveries cancelled because the notifier shut down before they finished, by plugin. The watchdog redelivers them from the held checkpoints.",
+		},
+		[]string{"plugin"},
+	)
 )
 
 // Notifier dispatches cell-write notifications to subscribed plugins via JSON-RPC.
 type Notifier struct {
-	registry  *PluginRegistry
-	rpcClient *RPCClient
-	logger    *slog.Logger
+	registry    *PluginRegistry
+	rpcClient   *RPCClient
+	logger      *slog.Logger
+	deadLetters *DeadLetterLog
+	deliveries  *deliveryTracker
+	checkpoints CheckpointStore  // optional; nil keeps no checkpoints
+	streams     *stream.Registry // optional; nil delivers by column only
+	schemas     *schema.Registry // optional; nil keeps no schemas
+	validation  SchemaValidation
+	writeBack   *WriteBackOptions // optional; nil ignores derived cells
+	handlers    []handler
+	syncTimeout time.Duration
+
+	// ctx is the context of dispatched deliveries. Shutdown cancels it to
+	// abandon those still in flight.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	inflight int           // goroutines started by spawn and still running
+	idle     chan struct{} // closed while inflight is 0
 }
 
 // NewNotifier creates a Notifier.
 func NewNotifier(registry *PluginRegistry, rpcClient *RPCClient, logger *slog.Logger) *Notifier {
+	ctx, cancel := context.WithCancel(context.Background())
+	idle := make(chan struct{})
+	close(idle)
 	return &Notifier{
-		registry:  registry,
-		rpcClient: rpcClient,
-		logger:    logger,
+		registry:    registry,
+		rpcClient:   rpcClient,
+		logger:      logger,
+		deadLetters: NewDeadLetterLog(defaultDeadLetterCapacity),
+		deliveries:  newDeliveryTracker(),
+		ctx:         ctx,
+		cancel:      cancel,
+		idle:        idle,
+	}
+}
+
+// SetCheckpoints makes the notifier hold a plugin's checkpoint at every cell
+// it fails to deliver, so that garbage collection keeps the cell until the
+// plugin catches up. It must be called before the notifier is used.
+func (n *Notifier) SetCheckpoints(store CheckpointStore) {
+	n.checkpoints = store
+}
+
+// SetStreams makes the notifier deliver cells to the plugins subscribed to
+// the streams they belong to. It must be called before the notifier is used.
+func (n *Notifier) SetStreams(streams *stream.Registry) {
+	n.streams = streams
+}
+
+// matchingStreams returns the names of the streams c belongs to.
+func (n *Notifier) matchingStreams(c *cell.Cell) []string {
+	if n.streams == nil {
+		return nil
 	}
+	return n.streams.Matching(c)
 }
 
 // NotifyCell fires a goroutine per subscribed plugin to deliver a cell.written
 // JSON-RPC notification. Errors are logged, not propagated — writes are never
-// blocked by slow plugins.
+// blocked by slow plugins. After Shutdown, the cell is not delivered: the
+// plugins' checkpoints are held at it instead.
 func (n *Notifier) NotifyCell(shardID int, c *cell.Cell) {
-	plugins := n.registry.ForColumn(c.ColumnName)
+	n.notifyCell(shardID, c, nil)
+}
+
+// notifyCell is NotifyCell for a cell with its provenance, nil unless a
+// plugin derived it.
+func (n *Notifier) notifyCell(shardID int, c *cell.Cell, prov *Provenance) {
+	n.runHandlers(shardID, c)
+
+	// Paused plugins are not notified; their checkpoints keep the cell for
+	// them to catch up on.
+	streams := n.matchingStreams(c)
+	for _, p := range n.registry.PausedForCell(c.ColumnName, streams) {
+		n.spawn(func(context.Context) { n.holdCheckpoint(p.ID, p.Name, shardID, c.AddedID) })
+	}
+
+	plugins := n.registry.ForCell(c.ColumnName, streams)
 	if len(plugins) == 0 {
 		return
 	}
 
-	params := CellWrittenParams{
+	if n.schemas != nil {
+		n.schemas.Observe(c.ColumnName, c.Body)
+	}
+	version, err := n.checkSchema(c)
+	if err != nil {
+		schemaViolations.WithLabelValues(c.ColumnName).Inc()
+		n.logger.Warn("cell does not match its column's schema", "column", c.ColumnName, "shard_id", shardID, "added_id", c.AddedID, "withheld", n.withheld(err), "error", err)
+	}
+	for _, p := range plugins {
+		params := newCellWrittenParams(shardID, c)
+		params.Streams, _ = p.Subscribes(c.ColumnName, streams)
+		params.SchemaVersion = version
+		params.Provenance = prov
+		if n.withheld(err) {
+			// The cell will never match: it is dead-lettered rather than
+			// held for the plugin to catch up on.
+			n.deadLetters.Add(newDeadLetter(p.Name, p.Endpoint, params, err))
+			continue
+		}
+		if n.ctx.Err() != nil {
+			deliveriesAbandoned.WithLabelValues(p.Name).Inc()
+			n.spawn(func(context.Context) { n.holdCheckpoint(p.ID, p.Name, shardID, params.AddedID) })
+			continue
+		}
+		n.deliveries.start(p.Name)
+		n.spawn(func(ctx context.Context) {
+			err := n.deliver(ctx, p, params)
+			n.deliveries.done(p.Name, params.AddedID, err)
+			if err != nil {
+				n.failed(ctx, p, shardID, params, err)
+				return
+			}
+			n.forward(ctx, p, shardID, params, nil)
+		})
+	}
+}
+
+// spawn runs fn in a goroutine that Drain and Shutdown wait for, with the
+// context of deliveries.
+func (n *Notifier) spawn(fn func(ctx context.Context)) {
+	n.mu.Lock()
+	if n.inflight == 0 {
+		n.idle = make(chan struct{})
+	}
+	n.inflight++
+	n.mu.Unlock()
+	go func() {
+		defer func() {
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			if n.inflight--; n.inflight == 0 {
+				close(n.idle)
+			}
+		}()
+		fn(n.ctx)
+	}()
+}
+
+// failed handles a delivery of params to p that returned err: it holds p's
+// checkpoint at the cell and, unless the delivery was cancelled with ctx,
+// dead-letters it.
+func (n *Notifier) failed(ctx context.Context, p *Plugin, shardID int, params CellWrittenParams, err error) {
+	if ctx.Err() == nil {
+		n.deadLetters.Add(newDeadLetter(p.Name, p.Endpoint, params, err))
+	}
+	n.holdCheckpoint(p.ID, p.Name, shardID, params.AddedID)
+}
+
+func newCellWrittenParams(shardID int, c *cell.Cell) CellWrittenParams {
+	return CellWrittenParams{
 		AddedID:    c.AddedID,
 		RowKey:     c.RowKey.String(),
 		ColumnName: c.ColumnName,
@@ -41,17 +213,127 @@ func (n *Notifier) NotifyCell(shardID int, c *cell.Cell) {
 		CreatedAt:  c.CreatedAt,
 		ShardID:    shardID,
 	}
+}
 
-	for _, p := range plugins {
-		go func(endpoint, pluginName string) {
-			resp, err := n.rpcClient.Call(context.Background(), endpoint, "cell.written", params)
-			if err != nil {
-				n.logger.Error("trigger rpc failed", "plugin", pluginName, "endpoint", endpoint, "error", err)
-				return
-			}
-			if resp.Error != nil {
-				n.logger.Error("trigger rpc returned error", "plugin", pluginName, "endpoint", endpoint, "error", resp.Error)
-			}
-		}(p.Endpoint, p.Name)
+// deliver sends a cell.written notification to p in its encoding, with the
+// client's retries, writes the cells p derived from it, and logs its
+// failure.
+func (n *Notifier) deliver(ctx context.Context, p *Plugin, params CellWrittenParams) error {
+	start := time.Now()
+	resp, err := n.rpcClient.CallWith(ctx, p.Codec(), p.Endpoint, "cell.written", params)
+	deliveryDuration.WithLabelValues(p.Name, params.ColumnName).Observe(time.Since(start).Seconds())
+	if err != nil {
+		n.logger.Error("trigger rpc failed", "plugin", p.Name, "endpoint", p.Endpoint, "error", err)
+		return err
+	}
+	if resp.Error != nil {
+		n.logger.Error("trigger rpc returned error", "plugin", p.Name, "endpoint", p.Endpoint, "error", resp.Error)
+		return resp.Error
+	}
+	if err := n.derive(ctx, p, params, resp.Result); err != nil {
+		n.logger.Error("failed to write derived cells", "plugin", p.Name, "error", err)
+		return err
+	}
+	return nil
+}
+
+// forward delivers a cell p has processed to the plugins chained after it,
+// each in turn passing it on once it succeeds. A failed or paused stage
+// holds its checkpoint at the cell, which the watchdog passes down the
+// chain when it catches the stage up; inactive stages cut the chain. Stages
+// for which behind, if set, reports true are left to catch up on the cell
+// themselves.
+func (n *Notifier) forward(ctx context.Context, p *Plugin, shardID int, params CellWrittenParams, behind func(*Plugin) bool) {
+	for _, next := range n.registry.Next(p.Name) {
+		if behind != nil && behind(next) {
+			continue
+		}
+		switch next.Status {
+		case PluginStatusActive:
+		case PluginStatusPaused:
+			n.holdCheckpoint(next.ID, next.Name, shardID, params.AddedID)
+			continue
+		default:
+			continue
+		}
+		n.deliveries.start(next.Name)
+		err := n.deliver(ctx, next, params)
+		n.deliveries.done(next.Name, params.AddedID, err)
+		if err != nil {
+			n.failed(ctx, next, shardID, params, err)
+			continue
+		}
+		n.forward(ctx, next, shardID, params, behind)
+	}
+}
+
+// holdCheckpoint records an undelivered cell in the plugin's checkpoint. A
+// checkpoint that cannot be saved is logged: the garbage collector's safety
+// window is then all that protects the cell.
+func (n *Notifier) holdCheckpoint(pluginID uuid.UUID, pluginName string, shardID int, addedID int64) {
+	if n.checkpoints == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), checkpointTimeout)
+	defer cancel()
+	if err := n.checkpoints.HoldCheckpoint(ctx, pluginID, shardID, addedID); err != nil {
+		checkpointFailures.WithLabelValues("hold").Inc()
+		n.logger.Error("failed to hold trigger checkpoint", "plugin", pluginName, "shard_id", shardID, "added_id", addedID, "error", err)
+	}
+}
+
+// Drain waits for notifications already dispatched to be delivered or to
+// fail. It returns ctx's error if they are still in flight when ctx is done.
+func (n *Notifier) Drain(ctx context.Context) error {
+	n.mu.Lock()
+	idle := n.idle
+	n.mu.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
+
+// Shutdown waits for notifications already dispatched to be delivered or to
+// fail, like Drain. If ctx is done first, it abandons the deliveries still
+// in flight: they are cancelled and counted by plugin, and their plugins'
+// checkpoints are held at the cells for the watchdog to redeliver them,
+// which Shutdown waits up to 10s more for. Cells notified after Shutdown
+// are abandoned the same way.
+func (n *Notifier) Shutdown(ctx context.Context) error {
+	err := n.Drain(ctx)
+	if err == nil {
+		n.cancel()
+		return nil
+	}
+	var abandoned int64
+	for name, s := range n.deliveries.snapshot() {
+		if s.InFlight > 0 {
+			deliveriesAbandoned.WithLabelValues(name).Add(float64(s.InFlight))
+			n.logger.Warn("abandoning trigger deliveries", "plugin", name, "deliveries", s.InFlight)
+			abandoned += s.InFlight
+		}
+	}
+	n.cancel()
+	// The cancelled deliveries hold their plugins' checkpoints on the way
+	// out; wait for those writes, which are bounded by checkpointTimeout,
+	// so the process does not exit before the cells are recorded.
+	holdCtx, cancel := context.WithTimeout(context.Background(), checkpointTimeout)
+	defer cancel()
+	if n.Drain(holdCtx) != nil {
+		n.logger.Warn("trigger checkpoints of abandoned deliveries still being held at shutdown")
+	}
+	return fmt.Errorf("abandon %d trigger deliveries: %w", abandoned, err)
+}
+
+// DeadLetters returns the most recent undeliverable notifications, newest first.
+func (n *Notifier) DeadLetters() []DeadLetter {
+	return n.deadLetters.Recent()
+}
+
+// DeliveryStats returns per-plugin delivery counters keyed by plugin name.
+func (n *Notifier) DeliveryStats() map[string]DeliveryStats {
+	return n.deliveries.snapshot()
+}
@@ -3,9 +3,12 @@ package trigger
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -13,6 +16,8 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/schema"
+	"github.com/ryanbastic/go-mezzanine/internal/stream"
 )
 
 func TestNotifier_DispatchesToSubscribedPlugins(t *testing.T) {
@@ -61,6 +66,115 @@ func TestNotifier_DispatchesToSubscribedPlugins(t *testing.T) {
 	}
 }
 
+func TestNotifier_DeliversStreams(t *testing.T) {
+	var mu sync.Mutex
+	received := make(map[string][]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     int64             `json:"id"`
+			Params CellWrittenParams `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&req) //nolint:errcheck
+		mu.Lock()
+		received[r.URL.Path] = req.Params.Streams
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(JSONRPCResponse{JSONRPC: "2.0", Result: json.RawMessage(`"ok"`), ID: req.ID}) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	streams := stream.NewRegistry()
+	for _, s := range []*stream.Stream{
+		{Name: "eu-orders", Columns: []string{"orders"}, Filters: []string{"region:eq:eu"}},
+		{Name: "us-orders", Columns: []string{"orders"}, Filters: []string{"region:eq:us"}},
+	} {
+		if err := streams.Create(context.Background(), s); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	registry := NewPluginRegistry()
+	registry.Register(context.Background(), &Plugin{Name: "eu", Endpoint: srv.URL + "/eu", SubscribedStreams: []string{"eu-orders"}}) //nolint:errcheck
+	registry.Register(context.Background(), &Plugin{Name: "us", Endpoint: srv.URL + "/us", SubscribedStreams: []string{"us-orders"}}) //nolint:errcheck
+	registry.Register(context.Background(), &Plugin{Name: "all", Endpoint: srv.URL + "/all", SubscribedColumns: []string{"orders"}})  //nolint:errcheck
+
+	notifier := NewNotifier(registry, NewRPCClient(0, time.Millisecond, 5*time.Second), slog.New(slog.DiscardHandler))
+	notifier.SetStreams(streams)
+	notifier.NotifyCell(0, &cell.Cell{AddedID: 1, RowKey: uuid.New(), ColumnName: "orders", RefKey: 1, Body: json.RawMessage(`{"region":"eu"}`), CreatedAt: time.Now()})
+	if err := notifier.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := received["/us"]; ok {
+		t.Error("EU order delivered to the us-orders subscriber")
+	}
+	if got := received["/eu"]; len(got) != 1 || got[0] != "eu-orders" {
+		t.Errorf("streams delivered to eu: got %v, want [eu-orders]", got)
+	}
+	if got, ok := received["/all"]; !ok || got != nil {
+		t.Errorf("column subscriber: got streams %v (delivered %v), want none", got, ok)
+	}
+}
+
+func TestNotifier_ValidatesSchemas(t *testing.T) {
+	var mu sync.Mutex
+	var versions []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     int64             `json:"id"`
+			Params CellWrittenParams `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&req) //nolint:errcheck
+		mu.Lock()
+		versions = append(versions, req.Params.SchemaVersion)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(JSONRPCResponse{JSONRPC: "2.0", Result: json.RawMessage(`"ok"`), ID: req.ID}) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	schemas := schema.NewRegistry()
+	if _, _, err := schemas.Register(context.Background(), "orders", json.RawMessage(`{"type":"object","required":["amount"]}`)); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	registry := NewPluginRegistry()
+	registry.Register(context.Background(), &Plugin{Name: "billing", Endpoint: srv.URL, SubscribedColumns: []string{"orders"}}) //nolint:errcheck
+
+	for _, tt := range []struct {
+		validation SchemaValidation
+		delivered  int
+		dead       int
+	}{
+		{SchemaValidationWarn, 2, 0},
+		{SchemaValidationEnforce, 1, 1},
+	} {
+		versions = nil
+		notifier := NewNotifier(registry, NewRPCClient(0, time.Millisecond, 5*time.Second), slog.New(slog.DiscardHandler))
+		notifier.SetSchemas(schemas, tt.validation)
+		notifier.NotifyCell(0, &cell.Cell{AddedID: 1, RowKey: uuid.New(), ColumnName: "orders", RefKey: 1, Body: json.RawMessage(`{"amount":5}`), CreatedAt: time.Now()})
+		notifier.NotifyCell(0, &cell.Cell{AddedID: 2, RowKey: uuid.New(), ColumnName: "orders", RefKey: 1, Body: json.RawMessage(`{"total":5}`), CreatedAt: time.Now()})
+		if err := notifier.Drain(context.Background()); err != nil {
+			t.Fatalf("Drain: %v", err)
+		}
+
+		mu.Lock()
+		if len(versions) != tt.delivered || versions[0] != 1 {
+			t.Errorf("%s: delivered schema versions %v, want %d deliveries of v1", tt.validation, versions, tt.delivered)
+		}
+		mu.Unlock()
+		if dead := notifier.DeadLetters(); len(dead) != tt.dead {
+			t.Errorf("%s: got %d dead letters, want %d", tt.validation, len(dead), tt.dead)
+		}
+	}
+	if err := schemas.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if _, ok := schemas.Derived("orders"); !ok {
+		t.Error("no schema derived from notified bodies")
+	}
+}
+
 func TestNotifier_SkipsUnsubscribedPlugins(t *testing.T) {
 	var received atomic.Int32
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -147,6 +261,236 @@ func TestNotifier_LogsRPCErrors(t *testing.T) {
 	}
 }
 
+func TestNotifier_RecordsDeadLettersAndStats(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	registry := NewPluginRegistry()
+	registry.Register(context.Background(), &Plugin{ //nolint:errcheck
+		Name:              "failing",
+		Endpoint:          srv.URL,
+		SubscribedColumns: []string{"profile"},
+	})
+	notifier := NewNotifier(registry, NewRPCClient(0, time.Millisecond, 5*time.Second), slog.New(slog.DiscardHandler))
+
+	rowKey := uuid.New()
+	notifier.NotifyCell(3, &cell.Cell{AddedID: 7, RowKey: rowKey, ColumnName: "profile", RefKey: 1, Body: json.RawMessage(`{}`)})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(notifier.DeadLetters()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	dl := notifier.DeadLetters()
+	if len(dl) != 1 {
+		t.Fatalf("got %d dead letters, want 1", len(dl))
+	}
+	if dl[0].Plugin != "failing" || dl[0].ShardID != 3 || dl[0].AddedID != 7 || dl[0].RowKey != rowKey.String() {
+		t.Errorf("unexpected dead letter: %+v", dl[0])
+	}
+	stats := notifier.DeliveryStats()["failing"]
+	if stats.Failed != 1 || stats.Delivered != 0 || stats.InFlight != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+// memCheckpoints is an in-memory CheckpointStore and HandlerCheckpointStore
+// keeping the lowest held added_id per plugin or handler and shard.
+type memCheckpoints struct {
+	mu       sync.Mutex
+	held     map[uuid.UUID]map[int]int64
+	handlers map[string]map[int]int64
+}
+
+func (m *memCheckpoints) HoldCheckpoint(_ context.Context, pluginID uuid.UUID, shardID int, addedID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.held[pluginID] == nil {
+		m.held[pluginID] = make(map[int]int64)
+	}
+	if cur, ok := m.held[pluginID][shardID]; !ok || addedID < cur {
+		m.held[pluginID][shardID] = addedID
+	}
+	return nil
+}
+
+func (m *memCheckpoints) ListCheckpoints(context.Context) ([]Checkpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []Checkpoint
+	for id, shards := range m.held {
+		for shardID, addedID := range shards {
+			out = append(out, Checkpoint{PluginID: id, ShardID: shardID, AddedID: addedID})
+		}
+	}
+	for name, shards := range m.handlers {
+		for shardID, addedID := range shards {
+			out = append(out, Checkpoint{Handler: name, ShardID: shardID, AddedID: addedID})
+		}
+	}
+	return out, nil
+}
+
+func (m *memCheckpoints) HoldHandlerCheckpoint(_ context.Context, handler string, _ []string, shardID int, addedID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.handlers == nil {
+		m.handlers = make(map[string]map[int]int64)
+	}
+	if m.handlers[handler] == nil {
+		m.handlers[handler] = make(map[int]int64)
+	}
+	if cur, ok := m.handlers[handler][shardID]; !ok || addedID < cur {
+		m.handlers[handler][shardID] = addedID
+	}
+	return nil
+}
+
+func (m *memCheckpoints) AdvanceHandlerCheckpoint(_ context.Context, handler string, shardID int, from, to int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cur, ok := m.handlers[handler][shardID]; !ok || cur != from {
+		return false, nil
+	}
+	if to == 0 {
+		delete(m.handlers[handler], shardID)
+	} else {
+		m.handlers[handler][shardID] = to
+	}
+	return true, nil
+}
+
+func (m *memCheckpoints) AdvanceCheckpoint(_ context.Context, pluginID uuid.UUID, shardID int, from, to int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cur, ok := m.held[pluginID][shardID]; !ok || cur != from {
+		return false, nil
+	}
+	if to == 0 {
+		delete(m.held[pluginID], shardID)
+	} else {
+		m.held[pluginID][shardID] = to
+	}
+	return true, nil
+}
+
+func (m *memCheckpoints) ReleaseCheckpoints(_ context.Context, pluginID uuid.UUID) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := int64(len(m.held[pluginID]))
+	delete(m.held, pluginID)
+	return n, nil
+}
+
+func TestNotifier_HoldsCheckpointsOfFailedDeliveries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	registry := NewPluginRegistry()
+	p := &Plugin{Name: "failing", Endpoint: srv.URL, SubscribedColumns: []string{"profile"}}
+	registry.Register(context.Background(), p) //nolint:errcheck
+	notifier := NewNotifier(registry, NewRPCClient(0, time.Millisecond, 5*time.Second), slog.New(slog.DiscardHandler))
+	checkpoints := &memCheckpoints{held: make(map[uuid.UUID]map[int]int64)}
+	notifier.SetCheckpoints(checkpoints)
+
+	for _, addedID := range []int64{9, 7, 8} {
+		notifier.NotifyCell(3, &cell.Cell{AddedID: addedID, RowKey: uuid.New(), ColumnName: "profile", RefKey: 1, Body: json.RawMessage(`{}`)})
+	}
+	if err := notifier.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+
+	if got := checkpoints.held[p.ID][3]; got != 7 {
+		t.Errorf("checkpoint: got %d, want 7", got)
+	}
+}
+
+func TestNotifier_HoldsCheckpointsOfPausedPlugins(t *testing.T) {
+	var received atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	defer srv.Close()
+
+	registry := NewPluginRegistry()
+	p := &Plugin{Name: "paused", Endpoint: srv.URL, SubscribedColumns: []string{"profile"}, Status: PluginStatusPaused}
+	registry.Register(context.Background(), p) //nolint:errcheck
+	notifier := NewNotifier(registry, NewRPCClient(0, time.Millisecond, 5*time.Second), slog.New(slog.DiscardHandler))
+	checkpoints := &memCheckpoints{held: make(map[uuid.UUID]map[int]int64)}
+	notifier.SetCheckpoints(checkpoints)
+
+	notifier.NotifyCell(2, &cell.Cell{AddedID: 4, RowKey: uuid.New(), ColumnName: "profile", RefKey: 1, Body: json.RawMessage(`{}`)})
+	if err := notifier.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+
+	if received.Load() != 0 {
+		t.Errorf("paused plugin received %d notifications", received.Load())
+	}
+	if got := checkpoints.held[p.ID][2]; got != 4 {
+		t.Errorf("checkpoint: got %d, want 4", got)
+	}
+}
+
+func TestNotifier_DeliversChainsInOrder(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	stage := func(name string, fail bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req JSONRPCRequest
+			json.NewDecoder(r.Body).Decode(&req) //nolint:errcheck
+			mu.Lock()
+			calls = append(calls, name)
+			mu.Unlock()
+			if fail {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(JSONRPCResponse{JSONRPC: "2.0", Result: json.RawMessage(`"ok"`), ID: req.ID}) //nolint:errcheck
+		}))
+	}
+	enricher, forwarder, archiver := stage("enricher", false), stage("forwarder", true), stage("archiver", false)
+	defer enricher.Close()
+	defer forwarder.Close()
+	defer archiver.Close()
+
+	registry := NewPluginRegistry()
+	a := &Plugin{Name: "enricher", Endpoint: enricher.URL, SubscribedColumns: []string{"orders"}}
+	b := &Plugin{Name: "forwarder", Endpoint: forwarder.URL, After: "enricher"}
+	c := &Plugin{Name: "archiver", Endpoint: archiver.URL, After: "forwarder"}
+	for _, p := range []*Plugin{a, b, c} {
+		if err := registry.Register(context.Background(), p); err != nil {
+			t.Fatalf("Register %s: %v", p.Name, err)
+		}
+	}
+	notifier := NewNotifier(registry, NewRPCClient(0, time.Millisecond, 5*time.Second), slog.New(slog.DiscardHandler))
+	checkpoints := &memCheckpoints{held: make(map[uuid.UUID]map[int]int64)}
+	notifier.SetCheckpoints(checkpoints)
+
+	notifier.NotifyCell(1, &cell.Cell{AddedID: 5, RowKey: uuid.New(), ColumnName: "orders", RefKey: 1, Body: json.RawMessage(`{}`)})
+	if err := notifier.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+
+	// The archiver never sees a cell the forwarder failed on.
+	if want := []string{"enricher", "forwarder"}; !slices.Equal(calls, want) {
+		t.Errorf("calls: got %v, want %v", calls, want)
+	}
+	if _, held := checkpoints.held[a.ID]; held {
+		t.Errorf("checkpoint held for the enricher, which succeeded")
+	}
+	if got := checkpoints.held[b.ID][1]; got != 5 {
+		t.Errorf("forwarder checkpoint: got %d, want 5", got)
+	}
+	if dl := notifier.DeadLetters(); len(dl) != 1 || dl[0].Plugin != "forwarder" {
+		t.Errorf("dead letters: got %+v, want one for the forwarder", dl)
+	}
+}
+
 func TestNotifier_NoPlugins(t *testing.T) {
 	registry := NewPluginRegistry()
 	rpcClient := NewRPCClient(0, time.Millisecond, 5*time.Second)
@@ -165,9 +509,134 @@ func TestNotifier_NoPlugins(t *testing.T) {
 	notifier.NotifyCell(0, c)
 }
 
+func TestNotifier_RunsHandlers(t *testing.T) {
+	notifier := NewNotifier(NewPluginRegistry(), nil, slog.New(slog.DiscardHandler))
+	checkpoints := &memCheckpoints{held: make(map[uuid.UUID]map[int]int64)}
+	notifier.SetCheckpoints(checkpoints)
+	var mu sync.Mutex
+	var handled []int64
+	notifier.AddHandler("test", []string{"order"}, func(_ context.Context, _ int, c *cell.Cell) error {
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, c.AddedID)
+		if c.AddedID == 3 {
+			return errors.New("boom")
+		}
+		return nil
+	})
+
+	for id, column := range map[int64]string{1: "order", 2: "profile", 3: "order"} {
+		notifier.NotifyCell(0, &cell.Cell{AddedID: id, RowKey: uuid.New(), ColumnName: column, RefKey: 1, Body: json.RawMessage(`{}`)})
+	}
+	if err := notifier.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(handled)
+	if !slices.Equal(handled, []int64{1, 3}) {
+		t.Errorf("handled: got %v, want [1 3]", handled)
+	}
+	if got := checkpoints.handlers["test"][0]; got != 3 {
+		t.Errorf("handler checkpoint: got %d, want 3", got)
+	}
+
+	// After Shutdown, cells are no longer handled but held.
+	if err := notifier.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	notifier.NotifyCell(0, &cell.Cell{AddedID: 4, RowKey: uuid.New(), ColumnName: "order", RefKey: 1, Body: json.RawMessage(`{}`)})
+	notifier.Drain(context.Background()) //nolint:errcheck
+	if len(handled) != 2 {
+		t.Errorf("handled after shutdown: got %v", handled)
+	}
+	if got := checkpoints.handlers["test"][0]; got != 3 {
+		t.Errorf("handler checkpoint after shutdown: got %d, want 3", got)
+	}
+}
+
 // writerFunc adapts a function to the io.Writer interface.
 type writerFunc func(p []byte) (int, error)
 
 func (f writerFunc) Write(p []byte) (int, error) {
 	return f(p)
 }
+
+func TestNotifier_Drain(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		var req JSONRPCRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(JSONRPCResponse{JSONRPC: "2.0", Result: json.RawMessage(`"ok"`), ID: req.ID})
+	}))
+	defer srv.Close()
+
+	registry := NewPluginRegistry()
+	registry.Register(context.Background(), &Plugin{ //nolint:errcheck
+		Name:              "slow",
+		Endpoint:          srv.URL,
+		SubscribedColumns: []string{"profile"},
+	})
+	notifier := NewNotifier(registry, NewRPCClient(0, time.Millisecond, 5*time.Second), slog.New(slog.DiscardHandler))
+	notifier.NotifyCell(0, &cell.Cell{AddedID: 1, RowKey: uuid.New(), ColumnName: "profile", RefKey: 1, Body: json.RawMessage(`{}`)})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := notifier.Drain(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Drain with delivery in flight: got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(release)
+	if err := notifier.Drain(context.Background()); err != nil {
+		t.Errorf("Drain: %v", err)
+	}
+	if got := notifier.DeliveryStats()["slow"].Delivered; got != 1 {
+		t.Errorf("delivered: got %d, want 1", got)
+	}
+}
+
+func TestNotifier_ShutdownAbandonsDeliveries(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		// The request context ends with the connection once the body is read.
+		var req JSONRPCRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	registry := NewPluginRegistry()
+	p := &Plugin{Name: "hung", Endpoint: srv.URL, SubscribedColumns: []string{"profile"}}
+	registry.Register(context.Background(), p) //nolint:errcheck
+	notifier := NewNotifier(registry, NewRPCClient(0, time.Millisecond, time.Minute), slog.New(slog.DiscardHandler))
+	checkpoints := &memCheckpoints{held: make(map[uuid.UUID]map[int]int64)}
+	notifier.SetCheckpoints(checkpoints)
+	notifier.NotifyCell(2, &cell.Cell{AddedID: 5, RowKey: uuid.New(), ColumnName: "profile", RefKey: 1, Body: json.RawMessage(`{}`)})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := notifier.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "abandon 1 trigger deliveries") {
+		t.Fatalf("Shutdown with a delivery in flight: got %v", err)
+	}
+	// Shutdown returns once the abandoned delivery has held its checkpoint.
+	if got, ok := checkpoints.held[p.ID][2]; !ok || got != 5 {
+		t.Errorf("checkpoint after Shutdown: got %d, want 5", got)
+	}
+	if got := len(notifier.DeadLetters()); got != 0 {
+		t.Errorf("dead letters: got %d, want none for an abandoned delivery", got)
+	}
+
+	// Cells notified after Shutdown are not delivered.
+	notifier.NotifyCell(2, &cell.Cell{AddedID: 4, RowKey: uuid.New(), ColumnName: "profile", RefKey: 1, Body: json.RawMessage(`{}`)})
+	if err := notifier.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("plugin calls: got %d, want 1", got)
+	}
+	if got := checkpoints.held[p.ID][2]; got != 4 {
+		t.Errorf("checkpoint: got %d, want 4", got)
+	}
+}
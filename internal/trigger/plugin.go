@@ -3,11 +3,14 @@ package trigger
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/pkg/plugin"
 )
 
 // PluginStatus represents the activation state of a plugin.
@@ -16,16 +19,95 @@ type PluginStatus string
 const (
 	PluginStatusActive   PluginStatus = "active"
 	PluginStatusInactive PluginStatus = "inactive"
+	// PluginStatusPaused is set by the watchdog under PoisonPolicyPause.
+	// A paused plugin receives no notifications; instead its checkpoints
+	// are held at the cells written meanwhile, for it to catch up on once
+	// it is active again.
+	PluginStatusPaused PluginStatus = "paused"
+)
+
+// PoisonPolicy is what the trigger watchdog does when a cell still fails
+// after a plugin's maximum number of redeliveries (see Watchdog).
+type PoisonPolicy string
+
+const (
+	// PoisonPolicyBlock keeps redelivering the cell, so the lane waits for
+	// the plugin to be fixed and never sees cells out of order. It is the
+	// default.
+	PoisonPolicyBlock PoisonPolicy = "block"
+	// PoisonPolicySkip dead-letters the cell and moves the lane past it.
+	PoisonPolicySkip PoisonPolicy = "skip"
+	// PoisonPolicyPause dead-letters the cell and pauses the plugin until
+	// an operator makes it active again.
+	PoisonPolicyPause PoisonPolicy = "pause"
 )
 
 // Plugin is an external JSON-RPC service that receives cell-write notifications.
 type Plugin struct {
-	ID                uuid.UUID    `json:"id"`
-	Name              string       `json:"name"`
-	Endpoint          string       `json:"endpoint"`
-	SubscribedColumns []string     `json:"subscribed_columns"`
+	ID                uuid.UUID `json:"id"`
+	Name              string    `json:"name"`
+	Endpoint          string    `json:"endpoint"`
+	SubscribedColumns []string  `json:"subscribed_columns"`
+	// SubscribedStreams are named streams (see internal/stream) whose cells
+	// the plugin receives, in addition to those of SubscribedColumns.
+	SubscribedStreams []string     `json:"subscribed_streams,omitempty"`
 	Status            PluginStatus `json:"status"`
 	CreatedAt         time.Time    `json:"created_at"`
+	// PoisonPolicy and MaxAttempts configure the watchdog's redelivery of
+	// the plugin's stuck lanes. MaxAttempts 0 uses the server's default.
+	PoisonPolicy PoisonPolicy `json:"poison_policy,omitempty"`
+	MaxAttempts  int          `json:"max_attempts,omitempty"`
+	// Encoding names the codec of the plugin's notifications (see
+	// pkg/plugin.Encoding); empty is JSON.
+	Encoding string `json:"encoding,omitempty"`
+	// After names the plugin this one follows in a chain. A chained plugin
+	// subscribes to nothing itself: it receives the cells of the chain's
+	// first plugin, each once the plugin before it has processed the cell
+	// successfully.
+	After string `json:"after,omitempty"`
+	// WritableColumns are the columns the plugin may write derived cells to
+	// by returning them from its notifications (see Notifier.SetWriteBack).
+	WritableColumns []string `json:"writable_columns,omitempty"`
+	// SynchronousColumns are subscribed columns whose writes wait for the
+	// plugin to accept each cell before it is stored (see
+	// Notifier.Validate).
+	SynchronousColumns []string `json:"synchronous_columns,omitempty"`
+}
+
+// Subscribes reports whether the plugin receives a cell of columnName that
+// belongs to streams, and which of the plugin's streams those are.
+func (p *Plugin) Subscribes(columnName string, streams []string) (matched []string, ok bool) {
+	for _, s := range streams {
+		if slices.Contains(p.SubscribedStreams, s) {
+			matched = append(matched, s)
+		}
+	}
+	return matched, len(matched) > 0 || slices.Contains(p.SubscribedColumns, columnName)
+}
+
+// EncodingName returns the plugin's encoding, "json" if unset.
+func (p *Plugin) EncodingName() string {
+	if p.Encoding == "" {
+		return "json"
+	}
+	return p.Encoding
+}
+
+// Codec returns the codec of the plugin's notifications, JSON if its
+// encoding is unknown.
+func (p *Plugin) Codec() plugin.Codec {
+	if c, ok := plugin.Encoding(p.Encoding); ok {
+		return c
+	}
+	return plugin.JSON
+}
+
+// Policy returns the plugin's poison policy, PoisonPolicyBlock if unset.
+func (p *Plugin) Policy() PoisonPolicy {
+	if p.PoisonPolicy == "" {
+		return PoisonPolicyBlock
+	}
+	return p.PoisonPolicy
 }
 
 // PluginRegistry is a thread-safe in-memory store of registered plugins.
@@ -34,6 +116,91 @@ type PluginRegistry struct {
 	mu      sync.RWMutex
 	plugins map[uuid.UUID]*Plugin
 	store   PluginStore // optional; nil means in-memory only
+	// writeMu serializes Register, Update and Delete, which persist their
+	// change without holding mu, so that notifications are never blocked
+	// on the store.
+	writeMu sync.Mutex
+
+	// routes is the routing table of ForCell, built on first use after a
+	// mutation; nil until then. It is swapped rather than changed, so cell
+	// writes read it without taking mu.
+	routes atomic.Pointer[routingTable]
+}
+
+// routingTable maps columns and streams to the plugins subscribed to them,
+// by status, and plugins to those chained after them, each list in
+// registration order.
+type routingTable struct {
+	columns  map[PluginStatus]map[string][]*Plugin
+	streams  map[PluginStatus]map[string][]*Plugin
+	next     map[string][]*Plugin
+	byName   map[string]*Plugin
+	writable map[string]bool      // columns plugins may derive cells in
+	sync     map[string][]*Plugin // active plugins validating a column's writes
+}
+
+// buildRoutes returns the routing table of plugins.
+func buildRoutes(plugins map[uuid.UUID]*Plugin) *routingTable {
+	sorted := make([]*Plugin, 0, len(plugins))
+	for _, p := range plugins {
+		sorted = append(sorted, p)
+	}
+	slices.SortFunc(sorted, func(a, b *Plugin) int { return a.CreatedAt.Compare(b.CreatedAt) })
+
+	t := &routingTable{
+		columns:  make(map[PluginStatus]map[string][]*Plugin),
+		streams:  make(map[PluginStatus]map[string][]*Plugin),
+		next:     make(map[string][]*Plugin),
+		byName:   make(map[string]*Plugin, len(sorted)),
+		writable: make(map[string]bool),
+		sync:     make(map[string][]*Plugin),
+	}
+	add := func(m map[PluginStatus]map[string][]*Plugin, status PluginStatus, key string, p *Plugin) {
+		if m[status] == nil {
+			m[status] = make(map[string][]*Plugin)
+		}
+		m[status][key] = append(m[status][key], p)
+	}
+	for _, p := range sorted {
+		for _, col := range p.SubscribedColumns {
+			add(t.columns, p.Status, col, p)
+		}
+		for _, s := range p.SubscribedStreams {
+			add(t.streams, p.Status, s, p)
+		}
+		if p.After != "" {
+			t.next[p.After] = append(t.next[p.After], p)
+		}
+		t.byName[p.Name] = p
+		for _, col := range p.WritableColumns {
+			t.writable[col] = true
+		}
+		if p.Status == PluginStatusActive {
+			for _, col := range p.SynchronousColumns {
+				t.sync[col] = append(t.sync[col], p)
+			}
+		}
+	}
+	return t
+}
+
+// invalidate drops the routing table after a mutation. The caller holds mu.
+func (r *PluginRegistry) invalidate() {
+	r.routes.Store(nil)
+}
+
+// table returns the routing table, building it if a mutation dropped it.
+func (r *PluginRegistry) table() *routingTable {
+	if t := r.routes.Load(); t != nil {
+		return t
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	// Built under mu, so no mutation can invalidate the plugins it was
+	// built from before it is stored.
+	t := buildRoutes(r.plugins)
+	r.routes.Store(t)
+	return t
 }
 
 // NewPluginRegistry creates an empty registry.
@@ -46,45 +213,85 @@ func NewPluginRegistry(store ...PluginStore) *PluginRegistry {
 	return r
 }
 
-// LoadAll populates the in-memory registry from the backing store.
-// It is a no-op if no store is configured.
+// LoadAll replaces the in-memory registry with the plugins in the backing
+// store, picking up those registered, changed or deleted by other
+// instances, such as a plugin the watchdog paused. It is a no-op if no
+// store is configured.
 func (r *PluginRegistry) LoadAll(ctx context.Context) error {
 	if r.store == nil {
 		return nil
 	}
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	plugins, err := r.store.ListPlugins(ctx)
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	stored, err := r.store.ListPlugins(ctx)
 	if err != nil {
 		return fmt.Errorf("load plugins: %w", err)
 	}
-	for _, p := range plugins {
-		r.plugins[p.ID] = p
+	plugins := make(map[uuid.UUID]*Plugin, len(stored))
+	for _, p := range stored {
+		plugins[p.ID] = p
 	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.plugins = plugins
+	r.invalidate()
 	return nil
 }
 
+// Run reloads the plugins every interval until ctx is cancelled.
+func (r *PluginRegistry) Run(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	if r.store == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.LoadAll(ctx); err != nil {
+				logger.Error("failed to reload plugins", "error", err)
+			}
+		}
+	}
+}
+
 // Register adds a plugin to the registry. It assigns an ID and creation timestamp.
 // It returns an error if a plugin with the same name is already registered.
 func (r *PluginRegistry) Register(ctx context.Context, p *Plugin) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	upstream := p.After == ""
+	r.mu.RLock()
 	for _, existing := range r.plugins {
 		if existing.Name == p.Name {
-			return fmt.Errorf("plugin %q already registered", p.Name)
+			r.mu.RUnlock()
+			return fmt.Errorf("plugin %q: %w", p.Name, ErrPluginExists)
 		}
+		upstream = upstream || existing.Name == p.After
+	}
+	r.mu.RUnlock()
+	if !upstream {
+		return fmt.Errorf("plugin %q follows unknown plugin %q", p.Name, p.After)
 	}
 	p.ID = uuid.New()
 	p.CreatedAt = time.Now()
 	if p.Status == "" {
 		p.Status = PluginStatusActive
 	}
+	if p.PoisonPolicy == "" {
+		p.PoisonPolicy = PoisonPolicyBlock
+	}
 	if r.store != nil {
 		if err := r.store.SavePlugin(ctx, p); err != nil {
 			return fmt.Errorf("persist plugin: %w", err)
 		}
 	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.plugins[p.ID] = p
+	r.invalidate()
 	return nil
 }
 
@@ -110,11 +317,42 @@ func (r *PluginRegistry) List() []*Plugin {
 	return out
 }
 
-// Delete removes a plugin by ID.
-func (r *PluginRegistry) Delete(id uuid.UUID) error {
+// Update applies fn to a copy of the plugin with the given ID, persists the
+// plugin's status and delivery settings, and swaps the copy in, so plugins
+// returned earlier are not changed under their readers.
+func (r *PluginRegistry) Update(ctx context.Context, id uuid.UUID, fn func(p *Plugin)) (*Plugin, error) {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	r.mu.RLock()
+	existing, ok := r.plugins[id]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("plugin %s not found", id)
+	}
+	p := *existing
+	p.SubscribedColumns = slices.Clone(existing.SubscribedColumns)
+	p.SubscribedStreams = slices.Clone(existing.SubscribedStreams)
+	fn(&p)
+	if r.store != nil {
+		if err := r.store.UpdatePlugin(ctx, &p); err != nil {
+			return nil, fmt.Errorf("persist plugin: %w", err)
+		}
+	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	if _, ok := r.plugins[id]; !ok {
+	r.plugins[id] = &p
+	r.invalidate()
+	return &p, nil
+}
+
+// Delete removes a plugin by ID.
+func (r *PluginRegistry) Delete(id uuid.UUID) error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	r.mu.RLock()
+	_, ok := r.plugins[id]
+	r.mu.RUnlock()
+	if !ok {
 		return fmt.Errorf("plugin %s not found", id)
 	}
 	if r.store != nil {
@@ -122,23 +360,105 @@ func (r *PluginRegistry) Delete(id uuid.UUID) error {
 			return fmt.Errorf("persist delete: %w", err)
 		}
 	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	delete(r.plugins, id)
+	r.invalidate()
 	return nil
 }
 
 // ForColumn returns all active plugins subscribed to the given column.
 func (r *PluginRegistry) ForColumn(columnName string) []*Plugin {
+	return r.forCell(columnName, nil, PluginStatusActive)
+}
+
+// ForCell returns all active plugins subscribed to the given column or to
+// one of streams, the streams a cell belongs to.
+func (r *PluginRegistry) ForCell(columnName string, streams []string) []*Plugin {
+	return r.forCell(columnName, streams, PluginStatusActive)
+}
+
+// PausedForCell returns the paused plugins that ForCell would return if
+// they were active.
+func (r *PluginRegistry) PausedForCell(columnName string, streams []string) []*Plugin {
+	return r.forCell(columnName, streams, PluginStatusPaused)
+}
+
+// forCell looks the cell up in the routing table rather than scanning every
+// plugin: it runs on every cell write.
+func (r *PluginRegistry) forCell(columnName string, streams []string, status PluginStatus) []*Plugin {
+	t := r.table()
+	out := t.columns[status][columnName]
+	if len(streams) == 0 {
+		// Shared with the table; clipped so appending to it copies.
+		return slices.Clip(out)
+	}
+	out = slices.Clone(out)
+	for i, s := range streams {
+		for _, p := range t.streams[status][s] {
+			// Skip plugins already added for the column or an earlier
+			// stream.
+			if slices.Contains(p.SubscribedColumns, columnName) || slices.ContainsFunc(streams[:i], func(s string) bool {
+				return slices.Contains(p.SubscribedStreams, s)
+			}) {
+				continue
+			}
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Next returns the plugins chained after the named one, whatever their
+// status.
+func (r *PluginRegistry) Next(name string) []*Plugin {
+	return slices.Clip(r.table().next[name])
+}
+
+// Upstream returns the plugin p follows in a chain.
+func (r *PluginRegistry) Upstream(p *Plugin) (*Plugin, bool) {
+	if p.After == "" {
+		return nil, false
+	}
+	up, ok := r.table().byName[p.After]
+	return up, ok
+}
+
+// Root returns the first plugin of p's chain, whose subscriptions select
+// the cells of every plugin in it; p itself if it is not chained.
+func (r *PluginRegistry) Root(p *Plugin) *Plugin {
+	for {
+		up, ok := r.Upstream(p)
+		if !ok {
+			return p
+		}
+		p = up
+	}
+}
+
+// SyncForColumn returns the active plugins that validate writes to a column
+// synchronously, in registration order.
+func (r *PluginRegistry) SyncForColumn(columnName string) []*Plugin {
+	return slices.Clip(r.table().sync[columnName])
+}
+
+// Writable reports whether any plugin may write derived cells to a column.
+func (r *PluginRegistry) Writable(columnName string) bool {
+	return r.table().writable[columnName]
+}
+
+// Subscribers returns the names of the plugins subscribed to a stream,
+// sorted.
+func (r *PluginRegistry) Subscribers(streamName string) []string {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	var out []*Plugin
+	var out []string
 	for _, p := range r.plugins {
-		if p.Status != PluginStatusActive {
-			continue
-		}
-		if slices.Contains(p.SubscribedColumns, columnName) {
-			out = append(out, p)
+		if slices.Contains(p.SubscribedStreams, streamName) {
+			out = append(out, p.Name)
 		}
 	}
+	slices.Sort(out)
 	return out
 }
 
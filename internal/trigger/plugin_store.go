@@ -2,17 +2,31 @@ package trigger
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var (
+	// ErrPluginExists is returned when a plugin has the same name as one
+	// already registered.
+	ErrPluginExists = errors.New("plugin already registered")
+	// ErrPluginNotFound is returned for a plugin ID that is not registered.
+	ErrPluginNotFound = errors.New("plugin not found")
+)
+
 // PluginStore is a persistent storage interface for trigger plugins.
 type PluginStore interface {
 	SavePlugin(ctx context.Context, p *Plugin) error
+	// UpdatePlugin persists a plugin's status and delivery settings.
+	UpdatePlugin(ctx context.Context, p *Plugin) error
 	DeletePlugin(ctx context.Context, id uuid.UUID) error
 	ListPlugins(ctx context.Context) ([]*Plugin, error)
 }
@@ -41,15 +55,35 @@ func (s *PostgresPluginStore) SavePlugin(ctx context.Context, p *Plugin) error {
 	defer cancel()
 
 	_, err := s.pool.Exec(ctx, `
-		INSERT INTO plugins (id, name, endpoint, subscribed_columns, status, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`, p.ID, p.Name, p.Endpoint, p.SubscribedColumns, string(p.Status), p.CreatedAt)
+		INSERT INTO plugins (id, name, endpoint, subscribed_columns, status, created_at, poison_policy, max_attempts, subscribed_streams, encoding, after, writable_columns, synchronous_columns)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`, p.ID, p.Name, p.Endpoint, nonNil(p.SubscribedColumns), string(p.Status), p.CreatedAt, string(p.Policy()), p.MaxAttempts, nonNil(p.SubscribedStreams), p.EncodingName(), p.After, nonNil(p.WritableColumns), nonNil(p.SynchronousColumns))
+	if pgErr := (*pgconn.PgError)(nil); errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return fmt.Errorf("save plugin %q: %w", p.Name, ErrPluginExists)
+	}
 	if err != nil {
 		return fmt.Errorf("save plugin: %w", err)
 	}
 	return nil
 }
 
+func (s *PostgresPluginStore) UpdatePlugin(ctx context.Context, p *Plugin) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE plugins SET status = $2, poison_policy = $3, max_attempts = $4, encoding = $5
+		WHERE id = $1
+	`, p.ID, string(p.Status), string(p.Policy()), p.MaxAttempts, p.EncodingName())
+	if err != nil {
+		return fmt.Errorf("update plugin: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("update plugin %s: %w", p.ID, ErrPluginNotFound)
+	}
+	return nil
+}
+
 func (s *PostgresPluginStore) DeletePlugin(ctx context.Context, id uuid.UUID) error {
 	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
@@ -59,7 +93,7 @@ func (s *PostgresPluginStore) DeletePlugin(ctx context.Context, id uuid.UUID) er
 		return fmt.Errorf("delete plugin: %w", err)
 	}
 	if tag.RowsAffected() == 0 {
-		return fmt.Errorf("plugin %s not found", id)
+		return fmt.Errorf("delete plugin %s: %w", id, ErrPluginNotFound)
 	}
 	return nil
 }
@@ -69,7 +103,7 @@ func (s *PostgresPluginStore) ListPlugins(ctx context.Context) ([]*Plugin, error
 	defer cancel()
 
 	rows, err := s.pool.Query(ctx, `
-		SELECT id, name, endpoint, subscribed_columns, status, created_at
+		SELECT id, name, endpoint, subscribed_columns, status, created_at, poison_policy, max_attempts, subscribed_streams, encoding, after, writable_columns, synchronous_columns
 		FROM plugins
 		ORDER BY created_at ASC
 	`)
@@ -91,10 +125,114 @@ func (s *PostgresPluginStore) ListPlugins(ctx context.Context) ([]*Plugin, error
 
 func scanPlugin(row pgx.Row) (*Plugin, error) {
 	var p Plugin
-	var status string
-	if err := row.Scan(&p.ID, &p.Name, &p.Endpoint, &p.SubscribedColumns, &status, &p.CreatedAt); err != nil {
+	var status, policy string
+	if err := row.Scan(&p.ID, &p.Name, &p.Endpoint, &p.SubscribedColumns, &status, &p.CreatedAt, &policy, &p.MaxAttempts, &p.SubscribedStreams, &p.Encoding, &p.After, &p.WritableColumns, &p.SynchronousColumns); err != nil {
 		return nil, fmt.Errorf("scan plugin: %w", err)
 	}
 	p.Status = PluginStatus(status)
+	p.PoisonPolicy = PoisonPolicy(policy)
 	return &p, nil
 }
+
+// MemoryPluginStore is an in-memory PluginStore with the semantics of
+// PostgresPluginStore: unique names, updates of status and delivery
+// settings only, and listing in created_at order. It stores and returns
+// copies, so callers cannot change its plugins under it.
+type MemoryPluginStore struct {
+	mu      sync.Mutex
+	plugins []*Plugin
+}
+
+// NewMemoryPluginStore creates an empty MemoryPluginStore.
+func NewMemoryPluginStore() *MemoryPluginStore {
+	return &MemoryPluginStore{}
+}
+
+func (s *MemoryPluginStore) SavePlugin(ctx context.Context, p *Plugin) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("save plugin: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.plugins {
+		if existing.Name == p.Name {
+			return fmt.Errorf("save plugin %q: %w", p.Name, ErrPluginExists)
+		}
+		if existing.ID == p.ID {
+			return fmt.Errorf("save plugin: duplicate id %s", p.ID)
+		}
+	}
+	s.plugins = append(s.plugins, clonePlugin(p))
+	slices.SortStableFunc(s.plugins, func(a, b *Plugin) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return nil
+}
+
+func (s *MemoryPluginStore) UpdatePlugin(ctx context.Context, p *Plugin) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("update plugin: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(p.ID)
+	if i < 0 {
+		return fmt.Errorf("update plugin %s: %w", p.ID, ErrPluginNotFound)
+	}
+	updated := clonePlugin(s.plugins[i])
+	updated.Status = p.Status
+	updated.PoisonPolicy = p.Policy()
+	updated.MaxAttempts = p.MaxAttempts
+	updated.Encoding = p.EncodingName()
+	s.plugins[i] = updated
+	return nil
+}
+
+func (s *MemoryPluginStore) DeletePlugin(ctx context.Context, id uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("delete plugin: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i < 0 {
+		return fmt.Errorf("delete plugin %s: %w", id, ErrPluginNotFound)
+	}
+	s.plugins = slices.Delete(s.plugins, i, i+1)
+	return nil
+}
+
+func (s *MemoryPluginStore) ListPlugins(ctx context.Context) ([]*Plugin, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("list plugins: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []*Plugin
+	for _, p := range s.plugins {
+		out = append(out, clonePlugin(p))
+	}
+	return out, nil
+}
+
+// index returns the position of the plugin with the given ID, or -1. The
+// caller holds s.mu.
+func (s *MemoryPluginStore) index(id uuid.UUID) int {
+	return slices.IndexFunc(s.plugins, func(p *Plugin) bool { return p.ID == id })
+}
+
+// clonePlugin returns a copy of p that shares no slices with it.
+func clonePlugin(p *Plugin) *Plugin {
+	c := *p
+	c.SubscribedColumns = slices.Clone(p.SubscribedColumns)
+	c.SubscribedStreams = slices.Clone(p.SubscribedStreams)
+	c.WritableColumns = slices.Clone(p.WritableColumns)
+	c.SynchronousColumns = slices.Clone(p.SynchronousColumns)
+	return &c
+}
+
+// nonNil returns s, or an empty slice for nil, for NOT NULL array columns.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -2,52 +2,13 @@ package trigger
 
 import (
 	"context"
-	"fmt"
-	"sync"
 	"testing"
 
 	"github.com/google/uuid"
 )
 
-// mockPluginStore is an in-memory implementation of PluginStore for testing.
-type mockPluginStore struct {
-	mu      sync.Mutex
-	plugins map[uuid.UUID]*Plugin
-}
-
-func newMockPluginStore() *mockPluginStore {
-	return &mockPluginStore{plugins: make(map[uuid.UUID]*Plugin)}
-}
-
-func (m *mockPluginStore) SavePlugin(_ context.Context, p *Plugin) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.plugins[p.ID] = p
-	return nil
-}
-
-func (m *mockPluginStore) DeletePlugin(_ context.Context, id uuid.UUID) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	if _, ok := m.plugins[id]; !ok {
-		return fmt.Errorf("plugin %s not found", id)
-	}
-	delete(m.plugins, id)
-	return nil
-}
-
-func (m *mockPluginStore) ListPlugins(_ context.Context) ([]*Plugin, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	out := make([]*Plugin, 0, len(m.plugins))
-	for _, p := range m.plugins {
-		out = append(out, p)
-	}
-	return out, nil
-}
-
 func TestPluginRegistry_WithStore_RegisterPersists(t *testing.T) {
-	store := newMockPluginStore()
+	store := NewMemoryPluginStore()
 	r := NewPluginRegistry(store)
 
 	p := &Plugin{
@@ -73,7 +34,7 @@ func TestPluginRegistry_WithStore_RegisterPersists(t *testing.T) {
 }
 
 func TestPluginRegistry_WithStore_DeleteRemovesFromStore(t *testing.T) {
-	store := newMockPluginStore()
+	store := NewMemoryPluginStore()
 	r := NewPluginRegistry(store)
 
 	p := &Plugin{
@@ -98,8 +59,40 @@ func TestPluginRegistry_WithStore_DeleteRemovesFromStore(t *testing.T) {
 	}
 }
 
+func TestPluginRegistry_WithStore_UpdatePersists(t *testing.T) {
+	store := NewMemoryPluginStore()
+	r := NewPluginRegistry(store)
+
+	p := &Plugin{Name: "to-pause", Endpoint: "http://localhost:9000/rpc", SubscribedColumns: []string{"profile"}}
+	if err := r.Register(context.Background(), p); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if p.Policy() != PoisonPolicyBlock {
+		t.Errorf("default policy: got %q, want %q", p.Policy(), PoisonPolicyBlock)
+	}
+	updated, err := r.Update(context.Background(), p.ID, func(p *Plugin) {
+		p.Status = PluginStatusPaused
+		p.PoisonPolicy = PoisonPolicyPause
+	})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if p.Status != PluginStatusActive {
+		t.Errorf("Update changed the plugin returned by Register")
+	}
+	if stored := store.plugins[store.index(p.ID)]; stored.Status != PluginStatusPaused || stored.PoisonPolicy != PoisonPolicyPause {
+		t.Errorf("stored: got %q/%q, want paused/pause", stored.Status, stored.PoisonPolicy)
+	}
+	if got := r.PausedForCell("profile", nil); len(got) != 1 || got[0] != updated {
+		t.Errorf("PausedForCell: got %v", got)
+	}
+	if got := r.ForColumn("profile"); len(got) != 0 {
+		t.Errorf("ForColumn returned a paused plugin")
+	}
+}
+
 func TestPluginRegistry_LoadAll(t *testing.T) {
-	store := newMockPluginStore()
+	store := NewMemoryPluginStore()
 
 	// Pre-populate the store (simulating data from a previous run)
 	existing := &Plugin{
@@ -134,6 +127,43 @@ func TestPluginRegistry_LoadAll(t *testing.T) {
 	}
 }
 
+func TestPluginRegistry_LoadAll_PicksUpOtherInstances(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryPluginStore()
+	leader, other := NewPluginRegistry(store), NewPluginRegistry(store)
+
+	p := &Plugin{Name: "enricher", Endpoint: "http://localhost:9000/rpc", SubscribedColumns: []string{"orders"}}
+	if err := leader.Register(ctx, p); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if err := other.LoadAll(ctx); err != nil {
+		t.Fatalf("LoadAll: %v", err)
+	}
+	if got := other.ForColumn("orders"); len(got) != 1 {
+		t.Fatalf("ForColumn: got %d plugins, want 1", len(got))
+	}
+
+	if _, err := leader.Update(ctx, p.ID, func(p *Plugin) { p.Status = PluginStatusPaused }); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := other.LoadAll(ctx); err != nil {
+		t.Fatalf("LoadAll: %v", err)
+	}
+	if got := other.ForColumn("orders"); len(got) != 0 {
+		t.Errorf("ForColumn: a plugin paused on another instance is still notified")
+	}
+
+	if err := leader.Delete(p.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := other.LoadAll(ctx); err != nil {
+		t.Fatalf("LoadAll: %v", err)
+	}
+	if got := other.List(); len(got) != 0 {
+		t.Errorf("List: got %d plugins after a delete on another instance, want 0", len(got))
+	}
+}
+
 func TestPluginRegistry_LoadAll_NoStore(t *testing.T) {
 	r := NewPluginRegistry()
 	// LoadAll should be a no-op without a store
@@ -2,6 +2,7 @@ package trigger
 
 import (
 	"context"
+	"slices"
 	"testing"
 
 	"github.com/google/uuid"
@@ -125,6 +126,106 @@ func TestPluginRegistry_ForColumn(t *testing.T) {
 	}
 }
 
+func TestPluginRegistry_ForCell(t *testing.T) {
+	r := NewPluginRegistry()
+	r.Register(context.Background(), &Plugin{Name: "a", Endpoint: "http://a/rpc", SubscribedColumns: []string{"orders"}})                 //nolint:errcheck
+	r.Register(context.Background(), &Plugin{Name: "b", Endpoint: "http://b/rpc", SubscribedStreams: []string{"eu-orders"}})              //nolint:errcheck
+	r.Register(context.Background(), &Plugin{Name: "c", Endpoint: "http://c/rpc", SubscribedStreams: []string{"us-orders", "eu-orders"}}) //nolint:errcheck
+	r.Register(context.Background(), &Plugin{Name: "d", Endpoint: "http://d/rpc", SubscribedStreams: []string{"us-orders"}})              //nolint:errcheck
+
+	if got := r.ForCell("orders", nil); len(got) != 1 || got[0].Name != "a" {
+		t.Errorf("ForCell(orders): got %v, want [a]", got)
+	}
+	if got := r.ForCell("orders", []string{"eu-orders"}); len(got) != 3 {
+		t.Errorf("ForCell(orders, eu-orders): got %d plugins, want 3", len(got))
+	}
+	if got := r.Subscribers("eu-orders"); len(got) != 2 {
+		t.Errorf("Subscribers(eu-orders): got %v, want b and c", got)
+	}
+}
+
+func TestPluginRegistry_ForCellFollowsMutations(t *testing.T) {
+	ctx := context.Background()
+	r := NewPluginRegistry()
+	a := &Plugin{Name: "a", Endpoint: "http://a/rpc", SubscribedColumns: []string{"orders"}, SubscribedStreams: []string{"eu-orders"}}
+	r.Register(ctx, a) //nolint:errcheck
+	names := func(ps []*Plugin) []string {
+		var out []string
+		for _, p := range ps {
+			out = append(out, p.Name)
+		}
+		return out
+	}
+
+	// A plugin subscribed to both the column and a stream is listed once.
+	if got := names(r.ForCell("orders", []string{"eu-orders"})); !slices.Equal(got, []string{"a"}) {
+		t.Errorf("ForCell: got %v, want [a]", got)
+	}
+
+	b := &Plugin{Name: "b", Endpoint: "http://b/rpc", SubscribedColumns: []string{"orders"}}
+	r.Register(ctx, b) //nolint:errcheck
+	if got := names(r.ForCell("orders", nil)); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("after Register: got %v, want [a b]", got)
+	}
+
+	r.Update(ctx, a.ID, func(p *Plugin) { p.Status = PluginStatusPaused }) //nolint:errcheck
+	if got := names(r.ForCell("orders", nil)); !slices.Equal(got, []string{"b"}) {
+		t.Errorf("after pausing a: got %v, want [b]", got)
+	}
+	if got := names(r.PausedForCell("orders", nil)); !slices.Equal(got, []string{"a"}) {
+		t.Errorf("PausedForCell after pausing a: got %v, want [a]", got)
+	}
+
+	r.Delete(b.ID) //nolint:errcheck
+	if got := r.ForCell("orders", nil); len(got) != 0 {
+		t.Errorf("after Delete: got %v, want none", names(got))
+	}
+}
+
+func TestPluginRegistry_Chains(t *testing.T) {
+	ctx := context.Background()
+	r := NewPluginRegistry()
+	a := &Plugin{Name: "a", Endpoint: "http://a/rpc", SubscribedColumns: []string{"orders"}}
+	b := &Plugin{Name: "b", Endpoint: "http://b/rpc", After: "a"}
+	c := &Plugin{Name: "c", Endpoint: "http://c/rpc", After: "b"}
+	for _, p := range []*Plugin{a, b, c} {
+		if err := r.Register(ctx, p); err != nil {
+			t.Fatalf("Register %s: %v", p.Name, err)
+		}
+	}
+	if err := r.Register(ctx, &Plugin{Name: "d", Endpoint: "http://d/rpc", After: "missing"}); err == nil {
+		t.Error("Register after an unknown plugin: expected error")
+	}
+
+	if got := r.Root(c); got != a {
+		t.Errorf("Root(c): got %s, want a", got.Name)
+	}
+	if got := r.Root(a); got != a {
+		t.Errorf("Root(a): got %s, want a", got.Name)
+	}
+	if next := r.Next("a"); len(next) != 1 || next[0] != b {
+		t.Errorf("Next(a): got %v, want [b]", next)
+	}
+	// Chained plugins receive cells through their chain only.
+	if got := r.ForCell("orders", nil); len(got) != 1 || got[0] != a {
+		t.Errorf("ForCell(orders): got %v, want [a]", got)
+	}
+}
+
+func TestPlugin_Subscribes(t *testing.T) {
+	p := &Plugin{SubscribedColumns: []string{"profile"}, SubscribedStreams: []string{"eu-orders", "big-orders"}}
+
+	if matched, ok := p.Subscribes("profile", nil); !ok || matched != nil {
+		t.Errorf("Subscribes(profile): got %v, %v; want no streams, true", matched, ok)
+	}
+	if matched, ok := p.Subscribes("orders", []string{"big-orders", "us-orders"}); !ok || len(matched) != 1 || matched[0] != "big-orders" {
+		t.Errorf("Subscribes(orders): got %v, %v; want [big-orders], true", matched, ok)
+	}
+	if _, ok := p.Subscribes("orders", []string{"us-orders"}); ok {
+		t.Error("Subscribes(orders) true for an unsubscribed stream")
+	}
+}
+
 func TestPluginRegistry_Columns(t *testing.T) {
 	r := NewPluginRegistry()
 	r.Register(context.Background(), &Plugin{Name: "a", Endpoint: "http://a/rpc", SubscribedColumns: []string{"profile", "settings"}})                  //nolint:errcheck
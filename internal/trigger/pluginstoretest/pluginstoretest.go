@@ -0,0 +1,285 @@
+// Package pluginstoretest is a conformance suite for trigger.PluginStore
+// implementations, so the in-memory store cannot drift from the Postgres
+// one in name uniqueness, ordering or not-found errors.
+//
+//	func TestConformance(t *testing.T) {
+//		pluginstoretest.Run(t, func(t *testing.T) trigger.PluginStore { return newEmptyStore(t) })
+//	}
+package pluginstoretest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+)
+
+// Run runs the suite. newStore must return an empty store each time it is
+// called.
+func Run(t *testing.T, newStore func(t *testing.T) trigger.PluginStore) {
+	for _, tc := range []struct {
+		name string
+		fn   func(*testing.T, trigger.PluginStore)
+	}{
+		{"SaveAndList", testSaveAndList},
+		{"ListOrder", testListOrder},
+		{"DuplicateName", testDuplicateName},
+		{"ConcurrentSave", testConcurrentSave},
+		{"Update", testUpdate},
+		{"Delete", testDelete},
+		{"NotFound", testNotFound},
+		{"ConcurrentRegister", testConcurrentRegister},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.fn(t, newStore(t))
+		})
+	}
+}
+
+// epoch is the created_at of the first plugin; it has no sub-microsecond
+// part, which PostgreSQL would drop.
+var epoch = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newPlugin(name string, createdAt time.Time) *trigger.Plugin {
+	return &trigger.Plugin{
+		ID:                uuid.New(),
+		Name:              name,
+		Endpoint:          "http://localhost:9000/rpc",
+		SubscribedColumns: []string{"profile"},
+		Status:            trigger.PluginStatusActive,
+		CreatedAt:         createdAt,
+		PoisonPolicy:      trigger.PoisonPolicyBlock,
+	}
+}
+
+func list(t *testing.T, store trigger.PluginStore) []*trigger.Plugin {
+	t.Helper()
+	plugins, err := store.ListPlugins(context.Background())
+	if err != nil {
+		t.Fatalf("ListPlugins: %v", err)
+	}
+	return plugins
+}
+
+func names(plugins []*trigger.Plugin) []string {
+	out := make([]string, len(plugins))
+	for i, p := range plugins {
+		out[i] = p.Name
+	}
+	return out
+}
+
+func testSaveAndList(t *testing.T, store trigger.PluginStore) {
+	p := newPlugin("full", epoch)
+	p.SubscribedStreams = []string{"users"}
+	p.MaxAttempts = 3
+	p.Encoding = "msgpack"
+	p.WritableColumns = []string{"derived"}
+	p.SynchronousColumns = []string{"profile"}
+	if err := store.SavePlugin(context.Background(), p); err != nil {
+		t.Fatalf("SavePlugin: %v", err)
+	}
+
+	got := list(t, store)
+	if len(got) != 1 {
+		t.Fatalf("ListPlugins: got %d plugins, want 1", len(got))
+	}
+	g := got[0]
+	if g.ID != p.ID || g.Name != p.Name || g.Endpoint != p.Endpoint || g.Status != p.Status ||
+		!g.CreatedAt.Equal(p.CreatedAt) || g.Policy() != p.Policy() || g.MaxAttempts != p.MaxAttempts ||
+		g.EncodingName() != p.EncodingName() || g.After != p.After {
+		t.Errorf("ListPlugins: got %+v, want %+v", g, p)
+	}
+	for _, tc := range []struct {
+		name      string
+		got, want []string
+	}{
+		{"subscribed_columns", g.SubscribedColumns, p.SubscribedColumns},
+		{"subscribed_streams", g.SubscribedStreams, p.SubscribedStreams},
+		{"writable_columns", g.WritableColumns, p.WritableColumns},
+		{"synchronous_columns", g.SynchronousColumns, p.SynchronousColumns},
+	} {
+		if !slices.Equal(tc.got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, tc.got, tc.want)
+		}
+	}
+}
+
+func testListOrder(t *testing.T, store trigger.PluginStore) {
+	ctx := context.Background()
+	// Saved out of order, listed by created_at.
+	for _, p := range []*trigger.Plugin{
+		newPlugin("second", epoch.Add(time.Second)),
+		newPlugin("third", epoch.Add(2*time.Second)),
+		newPlugin("first", epoch),
+	} {
+		if err := store.SavePlugin(ctx, p); err != nil {
+			t.Fatalf("SavePlugin(%s): %v", p.Name, err)
+		}
+	}
+	if got := names(list(t, store)); !slices.Equal(got, []string{"first", "second", "third"}) {
+		t.Errorf("ListPlugins: got %v, want first, second, third", got)
+	}
+}
+
+func testDuplicateName(t *testing.T, store trigger.PluginStore) {
+	ctx := context.Background()
+	first := newPlugin("dup", epoch)
+	if err := store.SavePlugin(ctx, first); err != nil {
+		t.Fatalf("SavePlugin: %v", err)
+	}
+	err := store.SavePlugin(ctx, newPlugin("dup", epoch.Add(time.Second)))
+	if !errors.Is(err, trigger.ErrPluginExists) {
+		t.Fatalf("duplicate name: got %v, want ErrPluginExists", err)
+	}
+	got := list(t, store)
+	if len(got) != 1 || got[0].ID != first.ID {
+		t.Errorf("after the duplicate: got %v, want only the first plugin", names(got))
+	}
+}
+
+func testConcurrentSave(t *testing.T, store trigger.PluginStore) {
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = store.SavePlugin(context.Background(), newPlugin("racy", epoch.Add(time.Duration(i)*time.Second)))
+		}()
+	}
+	wg.Wait()
+
+	saved := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			saved++
+		case !errors.Is(err, trigger.ErrPluginExists):
+			t.Errorf("SavePlugin: got %v, want nil or ErrPluginExists", err)
+		}
+	}
+	if saved != 1 {
+		t.Errorf("%d of %d concurrent saves of one name succeeded, want 1", saved, n)
+	}
+	if got := list(t, store); len(got) != 1 {
+		t.Errorf("ListPlugins: got %v, want one plugin", names(got))
+	}
+}
+
+func testUpdate(t *testing.T, store trigger.PluginStore) {
+	ctx := context.Background()
+	p := newPlugin("updated", epoch)
+	if err := store.SavePlugin(ctx, p); err != nil {
+		t.Fatalf("SavePlugin: %v", err)
+	}
+
+	u := *p
+	u.Status = trigger.PluginStatusPaused
+	u.PoisonPolicy = trigger.PoisonPolicySkip
+	u.MaxAttempts = 7
+	u.Encoding = "msgpack"
+	// Only the status and delivery settings are updated.
+	u.Endpoint = "http://elsewhere/rpc"
+	if err := store.UpdatePlugin(ctx, &u); err != nil {
+		t.Fatalf("UpdatePlugin: %v", err)
+	}
+
+	got := list(t, store)
+	if len(got) != 1 {
+		t.Fatalf("ListPlugins: got %d plugins, want 1", len(got))
+	}
+	g := got[0]
+	if g.Status != u.Status || g.Policy() != u.PoisonPolicy || g.MaxAttempts != u.MaxAttempts || g.EncodingName() != u.Encoding {
+		t.Errorf("updated plugin: got %+v, want status, policy, attempts and encoding of %+v", g, u)
+	}
+	if g.Endpoint != p.Endpoint {
+		t.Errorf("endpoint: got %q, want %q unchanged", g.Endpoint, p.Endpoint)
+	}
+}
+
+func testDelete(t *testing.T, store trigger.PluginStore) {
+	ctx := context.Background()
+	keep, drop := newPlugin("keep", epoch), newPlugin("drop", epoch.Add(time.Second))
+	for _, p := range []*trigger.Plugin{keep, drop} {
+		if err := store.SavePlugin(ctx, p); err != nil {
+			t.Fatalf("SavePlugin(%s): %v", p.Name, err)
+		}
+	}
+	if err := store.DeletePlugin(ctx, drop.ID); err != nil {
+		t.Fatalf("DeletePlugin: %v", err)
+	}
+	if got := names(list(t, store)); !slices.Equal(got, []string{"keep"}) {
+		t.Errorf("ListPlugins: got %v, want keep", got)
+	}
+	// A deleted plugin's name can be registered again.
+	if err := store.SavePlugin(ctx, newPlugin("drop", epoch.Add(2*time.Second))); err != nil {
+		t.Errorf("SavePlugin after delete: %v", err)
+	}
+}
+
+func testNotFound(t *testing.T, store trigger.PluginStore) {
+	ctx := context.Background()
+	if err := store.UpdatePlugin(ctx, newPlugin("ghost", epoch)); !errors.Is(err, trigger.ErrPluginNotFound) {
+		t.Errorf("UpdatePlugin of an unknown plugin: got %v, want ErrPluginNotFound", err)
+	}
+	if err := store.DeletePlugin(ctx, uuid.New()); !errors.Is(err, trigger.ErrPluginNotFound) {
+		t.Errorf("DeletePlugin of an unknown plugin: got %v, want ErrPluginNotFound", err)
+	}
+	if got := list(t, store); len(got) != 0 {
+		t.Errorf("ListPlugins of an empty store: got %v", names(got))
+	}
+}
+
+// testConcurrentRegister registers one name through several registries
+// sharing the store, as servers sharing a database do: the store lets only
+// one of them succeed.
+func testConcurrentRegister(t *testing.T, store trigger.PluginStore) {
+	const n = 4
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := trigger.NewPluginRegistry(store)
+			errs[i] = r.Register(context.Background(), &trigger.Plugin{
+				Name:              "shared",
+				Endpoint:          fmt.Sprintf("http://server-%d/rpc", i),
+				SubscribedColumns: []string{"profile"},
+			})
+		}()
+	}
+	wg.Wait()
+
+	registered := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			registered++
+		case !errors.Is(err, trigger.ErrPluginExists):
+			t.Errorf("Register: got %v, want nil or ErrPluginExists", err)
+		}
+	}
+	if registered != 1 {
+		t.Errorf("%d of %d registries registered the name, want 1", registered, n)
+	}
+
+	r := trigger.NewPluginRegistry(store)
+	if err := r.LoadAll(context.Background()); err != nil {
+		t.Fatalf("LoadAll: %v", err)
+	}
+	if got := r.List(); len(got) != 1 {
+		t.Errorf("loaded registry: got %v, want one plugin", names(got))
+	}
+	if err := r.Register(context.Background(), &trigger.Plugin{Name: "shared", Endpoint: "http://late/rpc"}); !errors.Is(err, trigger.ErrPluginExists) {
+		t.Errorf("Register after LoadAll: got %v, want ErrPluginExists", err)
+	}
+}
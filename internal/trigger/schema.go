@@ -0,0 +1,63 @@
+package trigger
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/schema"
+)
+
+// SchemaValidation says what the notifier does with a cell whose body does
+// not match its column's latest registered schema.
+type SchemaValidation string
+
+const (
+	// SchemaValidationOff delivers cells without validating them.
+	SchemaValidationOff SchemaValidation = "off"
+	// SchemaValidationWarn delivers invalid cells, logging and counting
+	// them.
+	SchemaValidationWarn SchemaValidation = "warn"
+	// SchemaValidationEnforce withholds invalid cells from plugins and
+	// dead-letters them.
+	SchemaValidationEnforce SchemaValidation = "enforce"
+)
+
+var schemaViolations = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "mezzanine",
+		Name:      "trigger_schema_violations_total",
+		Help:      "Cells whose body did not match their column's latest registered schema when notified.",
+	},
+	[]string{"column"},
+)
+
+// SetSchemas makes the notifier derive schemas of the bodies it notifies in
+// schemas, tag notifications with the version of their column's registered
+// schema and, unless validation is off, check bodies against it. It must be
+// called before the notifier is used.
+func (n *Notifier) SetSchemas(schemas *schema.Registry, validation SchemaValidation) {
+	n.schemas = schemas
+	n.validation = validation
+}
+
+// checkSchema returns the version of c's column's latest registered schema,
+// 0 if there is none, and c's violation of it when validation is on.
+func (n *Notifier) checkSchema(c *cell.Cell) (int, error) {
+	if n.schemas == nil {
+		return 0, nil
+	}
+	s, ok := n.schemas.Latest(c.ColumnName)
+	if !ok {
+		return 0, nil
+	}
+	if n.validation == SchemaValidationWarn || n.validation == SchemaValidationEnforce {
+		return s.Version, s.Validate(c.Body)
+	}
+	return s.Version, nil
+}
+
+// withheld reports whether a cell that failed schema validation with err is
+// kept from plugins.
+func (n *Notifier) withheld(err error) bool {
+	return err != nil && n.validation == SchemaValidationEnforce
+}
@@ -0,0 +1,78 @@
+package trigger
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// TransportOptions tunes the HTTP transport of plugin calls. Zero fields use
+// the defaults.
+type TransportOptions struct {
+	// MaxIdleConnsPerHost is the number of idle connections kept open to
+	// each plugin host for reuse (default 64). net/http keeps 2, so at high
+	// delivery rates most calls would open a connection and leave one in
+	// TIME_WAIT, exhausting ephemeral ports.
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout closes connections idle for longer (default 90s).
+	IdleConnTimeout time.Duration
+	// DialTimeout bounds opening a connection (default 5s).
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout bounds the TLS handshake of https endpoints
+	// (default 5s).
+	TLSHandshakeTimeout time.Duration
+	// DisableHTTP2 keeps https endpoints on HTTP/1.1 instead of negotiating
+	// HTTP/2, which multiplexes calls over one connection per host.
+	DisableHTTP2 bool
+	// H2C calls http endpoints over cleartext HTTP/2 (prior knowledge)
+	// instead of HTTP/1.1. Every plugin must accept it; pkg/plugin servers
+	// do.
+	H2C bool
+	// Proxy routes calls through a proxy; nil uses the HTTP_PROXY,
+	// HTTPS_PROXY and NO_PROXY environment variables.
+	Proxy *url.URL
+}
+
+func (o TransportOptions) withDefaults() TransportOptions {
+	if o.MaxIdleConnsPerHost <= 0 {
+		o.MaxIdleConnsPerHost = 64
+	}
+	if o.IdleConnTimeout <= 0 {
+		o.IdleConnTimeout = 90 * time.Second
+	}
+	if o.DialTimeout <= 0 {
+		o.DialTimeout = 5 * time.Second
+	}
+	if o.TLSHandshakeTimeout <= 0 {
+		o.TLSHandshakeTimeout = 5 * time.Second
+	}
+	return o
+}
+
+// NewTransport returns an HTTP transport for plugin calls configured from
+// opts.
+func NewTransport(opts TransportOptions) *http.Transport {
+	opts = opts.withDefaults()
+	proxy := http.ProxyFromEnvironment
+	if opts.Proxy != nil {
+		proxy = http.ProxyURL(opts.Proxy)
+	}
+	dialer := &net.Dialer{Timeout: opts.DialTimeout, KeepAlive: 30 * time.Second}
+	t := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     !opts.DisableHTTP2,
+		MaxIdleConns:          0, // bounded per host
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+		TLSHandshakeTimeout:   opts.TLSHandshakeTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+	var p http.Protocols
+	p.SetHTTP1(!opts.H2C || opts.DisableHTTP2)
+	p.SetHTTP2(!opts.DisableHTTP2)
+	p.SetUnencryptedHTTP2(opts.H2C)
+	t.Protocols = &p
+	return t
+}
@@ -0,0 +1,57 @@
+package trigger
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestNewTransport_H2C(t *testing.T) {
+	protos := make(chan int, 1)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protos <- r.ProtoMajor
+		var req JSONRPCRequest
+		json.NewDecoder(r.Body).Decode(&req) //nolint:errcheck
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(JSONRPCResponse{JSONRPC: "2.0", Result: json.RawMessage(`"ok"`), ID: req.ID}) //nolint:errcheck
+	}))
+	var p http.Protocols
+	p.SetHTTP1(true)
+	p.SetUnencryptedHTTP2(true)
+	srv.Config.Protocols = &p
+	srv.Start()
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		opts TransportOptions
+		want int
+	}{
+		{TransportOptions{}, 1},
+		{TransportOptions{H2C: true}, 2},
+	} {
+		client := NewRPCClient(0, time.Millisecond, 5*time.Second)
+		client.SetTransport(NewTransport(tt.opts))
+		if _, err := client.Call(context.Background(), srv.URL, "cell.written", nil); err != nil {
+			t.Fatalf("Call with %+v: %v", tt.opts, err)
+		}
+		if got := <-protos; got != tt.want {
+			t.Errorf("protocol with %+v: got HTTP/%d, want HTTP/%d", tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestNewTransport_Options(t *testing.T) {
+	proxy, _ := url.Parse("http://proxy:3128")
+	tr := NewTransport(TransportOptions{MaxIdleConnsPerHost: 16, Proxy: proxy})
+	if tr.MaxIdleConnsPerHost != 16 || tr.IdleConnTimeout != 90*time.Second || tr.TLSHandshakeTimeout != 5*time.Second {
+		t.Errorf("transport: got %d idle conns per host, %v idle timeout, %v TLS handshake", tr.MaxIdleConnsPerHost, tr.IdleConnTimeout, tr.TLSHandshakeTimeout)
+	}
+	req := httptest.NewRequest(http.MethodPost, "http://plugin:9000/rpc", nil)
+	if got, err := tr.Proxy(req); err != nil || got.String() != proxy.String() {
+		t.Errorf("proxy: got %v, %v; want %s", got, err, proxy)
+	}
+}
@@ -0,0 +1,152 @@
+package trigger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/pkg/plugin"
+)
+
+// DefaultSyncTimeout bounds the synchronous validation of a write when no
+// timeout is set.
+const DefaultSyncTimeout = 2 * time.Second
+
+var syncValidations = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "mezzanine",
+		Name:      "trigger_sync_validations_total",
+		Help:      "Cells validated synchronously by plugins before being stored, by outcome: accepted, transformed, rejected or failed.",
+	},
+	[]string{"plugin", "outcome"},
+)
+
+// RejectedError is a synchronous plugin's rejection of a cell, which is
+// then not stored.
+type RejectedError struct {
+	Plugin  string
+	Message string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("plugin %s rejected the cell: %s", e.Plugin, e.Message)
+}
+
+// CellValidateParams is the payload of the cell.validate requests sent to
+// synchronous plugins before a cell is stored.
+type CellValidateParams struct {
+	RowKey     string          `json:"row_key"`
+	ColumnName string          `json:"column_name"`
+	RefKey     int64           `json:"ref_key"`
+	Body       json.RawMessage `json:"body"`
+	ShardID    int             `json:"shard_id"`
+}
+
+// SetSyncTimeout bounds the calls to synchronous plugins made by Validate
+// (default DefaultSyncTimeout). It must be called before the notifier is
+// used.
+func (n *Notifier) SetSyncTimeout(timeout time.Duration) {
+	n.syncTimeout = timeout
+}
+
+// Validate asks the active plugins with a synchronous subscription to the
+// column of each cell of reqs, all on shard shardID, to accept it. A plugin
+// may transform the cell's body, replacing it in reqs: each cell goes
+// through its column's plugins in registration order, each seeing the body
+// the previous one returned, while cells are validated concurrently. It
+// returns a *RejectedError if a plugin rejects a cell, or another error if
+// one cannot be reached, fails to answer within the sync timeout, or does
+// not implement cell.validate; a rejection is reported first. Paused and
+// inactive plugins are not asked.
+func (n *Notifier) Validate(ctx context.Context, shardID int, reqs []cell.WriteCellRequest) error {
+	plugins := make([][]*Plugin, len(reqs))
+	asked := false
+	for i, req := range reqs {
+		plugins[i] = n.registry.SyncForColumn(req.ColumnName)
+		asked = asked || len(plugins[i]) > 0
+	}
+	if !asked {
+		return nil
+	}
+
+	timeout := n.syncTimeout
+	if timeout <= 0 {
+		timeout = DefaultSyncTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	errs := make([]error, len(reqs))
+	var wg sync.WaitGroup
+	for i := range reqs {
+		if len(plugins[i]) == 0 {
+			continue
+		}
+		wg.Go(func() {
+			for _, p := range plugins[i] {
+				body, err := n.validate(ctx, p, CellValidateParams{
+					RowKey:     reqs[i].RowKey.String(),
+					ColumnName: reqs[i].ColumnName,
+					RefKey:     reqs[i].RefKey,
+					Body:       reqs[i].Body,
+					ShardID:    shardID,
+				})
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				if body != nil {
+					reqs[i].Body = body
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	var failed error
+	for _, err := range errs {
+		var rejected *RejectedError
+		if errors.As(err, &rejected) {
+			return err
+		}
+		if failed == nil {
+			failed = err
+		}
+	}
+	return failed
+}
+
+// validate sends one cell.validate request to p, returning the body p
+// transformed the cell's into, nil if it accepted the cell as it is.
+func (n *Notifier) validate(ctx context.Context, p *Plugin, params CellValidateParams) (json.RawMessage, error) {
+	resp, err := n.rpcClient.CallWith(withSyncCall(ctx), p.Codec(), p.Endpoint, plugin.MethodCellValidate, params)
+	if err == nil && resp.Error != nil {
+		// JSON-RPC protocol errors mean the plugin could not validate the
+		// cell, not that it rejected it.
+		if resp.Error.Code >= plugin.CodeParseError && resp.Error.Code <= plugin.CodeInvalidRequest {
+			err = resp.Error
+		} else {
+			syncValidations.WithLabelValues(p.Name, "rejected").Inc()
+			return nil, &RejectedError{Plugin: p.Name, Message: resp.Error.Message}
+		}
+	}
+	if err != nil {
+		syncValidations.WithLabelValues(p.Name, "failed").Inc()
+		n.logger.Error("synchronous plugin validation failed", "plugin", p.Name, "endpoint", p.Endpoint, "column", params.ColumnName, "error", err)
+		return nil, fmt.Errorf("plugin %s: %w", p.Name, err)
+	}
+	var transformed struct {
+		Body json.RawMessage `json:"body"`
+	}
+	if len(resp.Result) > 0 && resp.Result[0] == '{' && json.Unmarshal(resp.Result, &transformed) == nil && transformed.Body != nil {
+		syncValidations.WithLabelValues(p.Name, "transformed").Inc()
+		return transformed.Body, nil
+	}
+	syncValidations.WithLabelValues(p.Name, "accepted").Inc()
+	return nil, nil
+}
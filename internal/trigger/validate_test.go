@@ -0,0 +1,105 @@
+package trigger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/pkg/plugin"
+)
+
+func TestNotifier_Validate(t *testing.T) {
+	rejecting := plugin.New(plugin.Options{})
+	rejecting.OnCellValidate(func(_ context.Context, c plugin.CellValidate) error {
+		if c.RefKey > 1 {
+			return errors.New("too late")
+		}
+		return nil
+	})
+	rejectingServer := httptest.NewServer(rejecting.Handler())
+	defer rejectingServer.Close()
+	// A plugin without a cell.validate handler cannot accept cells.
+	unimplementedServer := httptest.NewServer(plugin.New(plugin.Options{}).Handler())
+	defer unimplementedServer.Close()
+
+	registry := NewPluginRegistry()
+	for _, p := range []*Plugin{
+		{Name: "rejecting", Endpoint: rejectingServer.URL + "/rpc", SubscribedColumns: []string{"orders"}, SynchronousColumns: []string{"orders"}},
+		{Name: "unimplemented", Endpoint: unimplementedServer.URL + "/rpc", SubscribedColumns: []string{"audit"}, SynchronousColumns: []string{"audit"}},
+		{Name: "paused", Endpoint: "http://127.0.0.1:1/rpc", SubscribedColumns: []string{"orders"}, SynchronousColumns: []string{"orders"}, Status: PluginStatusPaused},
+	} {
+		if err := registry.Register(context.Background(), p); err != nil {
+			t.Fatalf("Register %s: %v", p.Name, err)
+		}
+	}
+	notifier := NewNotifier(registry, NewRPCClient(0, time.Millisecond, time.Second), slog.New(slog.DiscardHandler))
+	notifier.SetSyncTimeout(time.Second)
+
+	req := func(column string, refKey int64) cell.WriteCellRequest {
+		return cell.WriteCellRequest{RowKey: uuid.New(), ColumnName: column, RefKey: refKey, Body: json.RawMessage(`{}`)}
+	}
+	ctx := context.Background()
+
+	if err := notifier.Validate(ctx, 0, []cell.WriteCellRequest{req("orders", 1), req("profile", 9)}); err != nil {
+		t.Errorf("accepted cells: got %v", err)
+	}
+	err := notifier.Validate(ctx, 0, []cell.WriteCellRequest{req("audit", 1), req("orders", 2)})
+	var rejected *RejectedError
+	if !errors.As(err, &rejected) || rejected.Plugin != "rejecting" || rejected.Message != "too late" {
+		t.Errorf("rejected cell: got %v, want the rejection reported before the failure", err)
+	}
+	err = notifier.Validate(ctx, 0, []cell.WriteCellRequest{req("audit", 1)})
+	if err == nil || errors.As(err, &rejected) {
+		t.Errorf("unimplemented cell.validate: got %v, want a failure", err)
+	}
+}
+
+func TestNotifier_ValidateTransforms(t *testing.T) {
+	// Each plugin appends its name to the body's list of stages.
+	stage := func(name string) *httptest.Server {
+		p := plugin.New(plugin.Options{})
+		p.OnCellTransform(func(_ context.Context, c plugin.CellValidate) (json.RawMessage, error) {
+			var body struct{ Stages []string }
+			if err := c.Decode(&body); err != nil {
+				return nil, err
+			}
+			body.Stages = append(body.Stages, name)
+			return json.Marshal(body)
+		})
+		return httptest.NewServer(p.Handler())
+	}
+	first, second := stage("first"), stage("second")
+	defer first.Close()
+	defer second.Close()
+
+	registry := NewPluginRegistry()
+	for _, p := range []*Plugin{
+		{Name: "first", Endpoint: first.URL + "/rpc", SubscribedColumns: []string{"orders"}, SynchronousColumns: []string{"orders"}},
+		{Name: "second", Endpoint: second.URL + "/rpc", SubscribedColumns: []string{"orders"}, SynchronousColumns: []string{"orders"}},
+	} {
+		if err := registry.Register(context.Background(), p); err != nil {
+			t.Fatalf("Register %s: %v", p.Name, err)
+		}
+	}
+	notifier := NewNotifier(registry, NewRPCClient(0, time.Millisecond, time.Second), slog.New(slog.DiscardHandler))
+
+	reqs := []cell.WriteCellRequest{
+		{RowKey: uuid.New(), ColumnName: "orders", RefKey: 1, Body: json.RawMessage(`{"Stages":[]}`)},
+		{RowKey: uuid.New(), ColumnName: "profile", RefKey: 1, Body: json.RawMessage(`{}`)},
+	}
+	if err := notifier.Validate(context.Background(), 0, reqs); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if got := string(reqs[0].Body); got != `{"Stages":["first","second"]}` {
+		t.Errorf("transformed body: got %s, want both stages in registration order", got)
+	}
+	if got := string(reqs[1].Body); got != `{}` {
+		t.Errorf("unvalidated body: got %s, want it unchanged", got)
+	}
+}
@@ -0,0 +1,500 @@
+package trigger
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+var (
+	stuckLanes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "mezzanine",
+			Name:      "trigger_stuck_lanes",
+			Help:      "Shards on which a plugin's or internal handler's trigger checkpoint has not moved for longer than the watchdog threshold.",
+		},
+		[]string{"plugin"},
+	)
+	skippedCells = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "mezzanine",
+			Name:      "trigger_skipped_cells_total",
+			Help:      "Cells the trigger watchdog gave up redelivering to a plugin after the maximum number of attempts.",
+		},
+		[]string{"plugin"},
+	)
+	lanesByState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "mezzanine",
+			Name:      "trigger_lanes",
+			Help:      "Lanes with a held trigger checkpoint at the last watchdog check: active if the watchdog redelivered their cells, idle otherwise.",
+		},
+		[]string{"state"},
+	)
+	scannedCells = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "mezzanine",
+			Name:      "trigger_scanned_cells_total",
+			Help:      "Cells the trigger watchdog read while catching up a plugin's or internal handler's lanes.",
+		},
+		[]string{"plugin"},
+	)
+	scanBatchSize = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "mezzanine",
+			Name:      "trigger_scan_batch_size",
+			Help:      "Cells per batch read by the trigger watchdog from a lane's checkpoint.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 11),
+		},
+	)
+)
+
+// WatchdogOptions configures a Watchdog.
+type WatchdogOptions struct {
+	// Threshold is how long a checkpoint may stay where it is before its
+	// lane is stuck (default 15m).
+	Threshold time.Duration
+	// Interval is the time between checks (default 1m).
+	Interval time.Duration
+	// MaxAttempts is the number of times a stuck lane's first undeliverable
+	// cell is redelivered before the plugin's poison policy applies, for
+	// plugins without their own. Zero only reports their stuck lanes.
+	MaxAttempts int
+	// BatchSize is the number of cells redelivered per lane and check
+	// (default 100).
+	BatchSize int
+}
+
+// Watchdog detects stuck trigger lanes. A lane is the cell.written
+// notifications of one shard to one plugin; its checkpoint is held at the
+// oldest cell the plugin missed (see Checkpoint). A checkpoint that has not
+// moved for longer than the threshold means the plugin is not catching up,
+// typically because its handler keeps failing on one cell: the lane is
+// logged and counted in mezzanine_trigger_stuck_lanes.
+//
+// With a maximum number of attempts, the plugin's or MaxAttempts, the
+// watchdog catches stuck lanes of active plugins up itself, the way a plugin
+// would. Every interval it redelivers the lane's cells of subscribed columns
+// and streams from the checkpoint, in commit order from shards keeping a
+// commit log and in added_id order from others, moves the checkpoint past
+// those delivered and releases it once it passes the shard's head. A cell that
+// still fails after the maximum attempts is handled by the plugin's
+// PoisonPolicy: blocked lanes keep retrying it, skipped cells are
+// dead-lettered and passed, and paused plugins wait for an operator. Attempts
+// are counted in memory and start over when another instance takes over.
+//
+// Each plugin of a chain (see Plugin.After) has its own lanes. Cells caught
+// up are passed down the chain, and a chained plugin's lane is caught up
+// only to its upstream's checkpoint on the shard.
+//
+// Internal handlers (see Notifier.AddHandler) have lanes too, when the
+// checkpoint store keeps their checkpoints. Nothing else catches them up, so
+// the watchdog runs the handler on their cells every interval, whatever
+// MaxAttempts, and a cell it keeps failing on blocks the lane until it
+// succeeds. The checkpoints of handlers no longer added are released.
+type Watchdog struct {
+	notifier    *Notifier
+	checkpoints CheckpointStore
+	router      *shard.Router
+	opts        WatchdogOptions
+	lanes       map[lane]*laneState
+	logger      *slog.Logger
+	now         func() time.Time
+}
+
+// lane identifies a plugin's lane, or an internal handler's by name.
+type lane struct {
+	pluginID uuid.UUID
+	handler  string
+	shardID  int
+}
+
+// laneState tracks a stuck lane between checks.
+type laneState struct {
+	// addedID is the cell that failed redelivery, and attempts how many
+	// times it did.
+	addedID  int64
+	attempts int
+	// reported is whether a handler's lane has been logged as stuck.
+	reported bool
+	// seq is how far through the shard's commit log the lane was caught
+	// up when its checkpoint was at seqAt (see readLane).
+	seq, seqAt int64
+}
+
+// NewWatchdog returns a watchdog over the checkpoints that notifier holds,
+// redelivering through it cells read from router.
+func NewWatchdog(notifier *Notifier, checkpoints CheckpointStore, router *shard.Router, opts WatchdogOptions, logger *slog.Logger) *Watchdog {
+	if opts.Threshold <= 0 {
+		opts.Threshold = 15 * time.Minute
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Minute
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	return &Watchdog{
+		notifier:    notifier,
+		checkpoints: checkpoints,
+		router:      router,
+		opts:        opts,
+		lanes:       make(map[lane]*laneState),
+		logger:      logger,
+		now:         time.Now,
+	}
+}
+
+// Run checks the lanes once per interval until ctx is cancelled. Only one
+// instance should run it, e.g. under leader election.
+func (w *Watchdog) Run(ctx context.Context) error {
+	for {
+		if err := w.check(ctx); err != nil && ctx.Err() == nil {
+			w.logger.Warn("trigger watchdog check failed; retrying next interval", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			stuckLanes.Reset()
+			lanesByState.Reset()
+			return nil
+		case <-time.After(w.opts.Interval):
+		}
+	}
+}
+
+// check makes one pass over the checkpoints.
+func (w *Watchdog) check(ctx context.Context) error {
+	checkpoints, err := w.checkpoints.ListCheckpoints(ctx)
+	if err != nil {
+		return err
+	}
+	stuckLanes.Reset()
+	held := make(map[lane]int64, len(checkpoints))
+	for _, cp := range checkpoints {
+		held[lane{pluginID: cp.PluginID, handler: cp.Handler, shardID: cp.ShardID}] = cp.AddedID
+	}
+	stuck := make(map[lane]*laneState)
+	active := 0
+	for _, cp := range checkpoints {
+		if cp.Handler != "" {
+			active++
+			if err := w.checkHandler(ctx, cp, stuck); err != nil {
+				return err
+			}
+			continue
+		}
+		l := lane{pluginID: cp.PluginID, shardID: cp.ShardID}
+		// A lane being caught up stays stuck until it is released, even
+		// though each step moves its checkpoint.
+		st, ok := w.lanes[l]
+		if !ok && w.now().Sub(cp.UpdatedAt) < w.opts.Threshold {
+			continue
+		}
+		p, err := w.notifier.registry.Get(cp.PluginID)
+		if err != nil {
+			continue // deleted since; its checkpoints go with it
+		}
+		if !ok {
+			st = &laneState{}
+			w.logger.Warn("trigger lane stuck: plugin has not caught up past its checkpoint", "plugin", p.Name, "shard_id", cp.ShardID, "added_id", cp.AddedID, "held_since", cp.UpdatedAt)
+		}
+		stuckLanes.WithLabelValues(p.Name).Inc()
+		stuck[l] = st
+		maxAttempts := p.MaxAttempts
+		if maxAttempts == 0 {
+			maxAttempts = w.opts.MaxAttempts
+		}
+		if maxAttempts > 0 && p.Status == PluginStatusActive {
+			// A chained plugin is caught up only on the cells its upstream
+			// has processed: those before the upstream's own checkpoint.
+			var limit int64
+			if up, ok := w.notifier.registry.Upstream(p); ok {
+				limit = held[lane{pluginID: up.ID, shardID: cp.ShardID}]
+			}
+			active++
+			released, err := w.catchUp(ctx, cp, p, st, maxAttempts, limit, held)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				w.logger.Warn("failed to catch up trigger lane", "plugin", p.Name, "shard_id", cp.ShardID, "error", err)
+			}
+			if released {
+				delete(stuck, l)
+				stuckLanes.WithLabelValues(p.Name).Dec()
+				w.logger.Info("trigger lane caught up", "plugin", p.Name, "shard_id", cp.ShardID)
+			}
+		}
+	}
+	w.lanes = stuck
+	lanesByState.WithLabelValues("active").Set(float64(active))
+	lanesByState.WithLabelValues("idle").Set(float64(len(checkpoints) - active))
+	return nil
+}
+
+// checkHandler catches up a lane of an internal handler, recording it in
+// stuck unless it is released. It returns only ctx's error; others are
+// logged and retried next check.
+func (w *Watchdog) checkHandler(ctx context.Context, cp Checkpoint, stuck map[lane]*laneState) error {
+	l := lane{handler: cp.Handler, shardID: cp.ShardID}
+	st, ok := w.lanes[l]
+	if !ok {
+		st = &laneState{}
+	}
+	released, err := w.catchUpHandler(ctx, cp, st)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		w.logger.Warn("failed to catch up trigger handler lane", "handler", cp.Handler, "shard_id", cp.ShardID, "error", err)
+	}
+	if released {
+		if st.reported {
+			w.logger.Info("trigger handler lane caught up", "handler", cp.Handler, "shard_id", cp.ShardID)
+		}
+		return nil
+	}
+	stuck[l] = st
+	if st.reported || w.now().Sub(cp.UpdatedAt) >= w.opts.Threshold {
+		if !st.reported {
+			st.reported = true
+			w.logger.Warn("trigger handler lane stuck: handler keeps failing past its checkpoint", "handler", cp.Handler, "shard_id", cp.ShardID, "added_id", cp.AddedID, "held_since", cp.UpdatedAt)
+		}
+		stuckLanes.WithLabelValues(cp.Handler).Inc()
+	}
+	return nil
+}
+
+// catchUpHandler runs the lane's handler on up to a batch of the lane's
+// cells of its columns from the checkpoint and moves the checkpoint past
+// those handled. The checkpoint of a handler no longer added is released
+// as is. It reports whether the checkpoint was released.
+func (w *Watchdog) catchUpHandler(ctx context.Context, cp Checkpoint, st *laneState) (bool, error) {
+	h, ok := w.notifier.handlerNamed(cp.Handler)
+	if !ok {
+		return w.advance(ctx, cp, 0)
+	}
+	store, err := w.router.StoreFor(shard.ID(cp.ShardID))
+	if err != nil {
+		return false, err
+	}
+	page, err := w.readLane(ctx, store, cp, st)
+	if err != nil {
+		return false, err
+	}
+	cells := page.cells
+	scanBatchSize.Observe(float64(len(cells)))
+	scannedCells.WithLabelValues(h.name).Add(float64(len(cells)))
+
+	handled := 0
+	for i, c := range cells {
+		if slices.Contains(h.columns, c.ColumnName) {
+			if err := h.fn(ctx, cp.ShardID, &c); err != nil {
+				if ctx.Err() != nil {
+					return false, ctx.Err()
+				}
+				handlerFailures.WithLabelValues(h.name).Inc()
+				if st.addedID != c.AddedID {
+					*st = laneState{addedID: c.AddedID, reported: st.reported}
+					w.logger.Error("trigger handler failed catching up; retrying next check", "handler", h.name, "shard_id", cp.ShardID, "added_id", c.AddedID, "error", err)
+				}
+				st.attempts++
+				break
+			}
+		}
+		handled = i + 1
+	}
+	to := page.next(handled)
+	if to == cp.AddedID {
+		return false, nil
+	}
+	return w.advance(ctx, cp, to)
+}
+
+// advance moves cp to to, releasing it if to is 0, and reports whether it
+// was released. A checkpoint lowered since it was listed is left alone and
+// caught up from its new position next check.
+func (w *Watchdog) advance(ctx context.Context, cp Checkpoint, to int64) (bool, error) {
+	var ok bool
+	var err error
+	if cp.Handler != "" {
+		store, isHandlerStore := w.checkpoints.(HandlerCheckpointStore)
+		if !isHandlerStore {
+			return false, nil
+		}
+		ok, err = store.AdvanceHandlerCheckpoint(ctx, cp.Handler, cp.ShardID, cp.AddedID, to)
+	} else {
+		ok, err = w.checkpoints.AdvanceCheckpoint(ctx, cp.PluginID, cp.ShardID, cp.AddedID, to)
+	}
+	if err != nil {
+		checkpointFailures.WithLabelValues("advance").Inc()
+		return false, err
+	}
+	return to == 0 && ok, nil
+}
+
+// catchUp redelivers up to a batch of the lane's cells from its checkpoint,
+// stopping at limit unless it is 0, and moves the checkpoint past them.
+// Cells delivered are passed on to the plugins chained after p, except
+// those whose own lane, in held, is still to catch up on them. It reports
+// whether the checkpoint was released.
+func (w *Watchdog) catchUp(ctx context.Context, cp Checkpoint, p *Plugin, st *laneState, maxAttempts int, limit int64, held map[lane]int64) (bool, error) {
+	store, err := w.router.StoreFor(shard.ID(cp.ShardID))
+	if err != nil {
+		return false, err
+	}
+	page, err := w.readLane(ctx, store, cp, st)
+	if err != nil {
+		return false, err
+	}
+	cells := page.cells
+	scanBatchSize.Observe(float64(len(cells)))
+	scannedCells.WithLabelValues(p.Name).Add(float64(len(cells)))
+
+	root := w.notifier.registry.Root(p)
+	handled := 0
+cells:
+	for i, c := range cells {
+		if limit > 0 && c.AddedID >= limit {
+			break
+		}
+		if streams, ok := root.Subscribes(c.ColumnName, w.notifier.matchingStreams(&c)); ok {
+			version, err := w.notifier.checkSchema(&c)
+			if w.notifier.withheld(err) {
+				// Dead-lettered when it was written.
+				handled = i + 1
+				continue
+			}
+			params := newCellWrittenParams(cp.ShardID, &c)
+			params.Streams = streams
+			params.SchemaVersion = version
+			if params.Provenance, err = w.notifier.provenance(ctx, store, &c); err != nil {
+				return false, err
+			}
+			if err := w.notifier.deliver(ctx, p, params); err != nil {
+				if ctx.Err() != nil {
+					return false, ctx.Err()
+				}
+				if st.addedID != c.AddedID {
+					*st = laneState{addedID: c.AddedID}
+				}
+				st.attempts++
+				if st.attempts < maxAttempts {
+					break
+				}
+				switch p.Policy() {
+				case PoisonPolicySkip:
+					d := newDeadLetter(p.Name, p.Endpoint, params, err)
+					d.Skipped = true
+					w.notifier.deadLetters.Add(d)
+					skippedCells.WithLabelValues(p.Name).Inc()
+					w.logger.Error("skipping undeliverable cell after max attempts", "plugin", p.Name, "shard_id", cp.ShardID, "added_id", c.AddedID, "attempts", st.attempts, "error", err)
+				case PoisonPolicyPause:
+					w.notifier.deadLetters.Add(newDeadLetter(p.Name, p.Endpoint, params, err))
+					w.logger.Error("pausing plugin after max attempts on an undeliverable cell", "plugin", p.Name, "shard_id", cp.ShardID, "added_id", c.AddedID, "attempts", st.attempts, "error", err)
+					// Attempts start over when the plugin is made active again.
+					*st = laneState{}
+					if _, err := w.notifier.registry.Update(ctx, p.ID, func(p *Plugin) { p.Status = PluginStatusPaused }); err != nil {
+						return false, err
+					}
+					break cells
+				default:
+					if st.attempts == maxAttempts {
+						w.logger.Error("lane blocked on undeliverable cell after max attempts; still retrying", "plugin", p.Name, "shard_id", cp.ShardID, "added_id", c.AddedID, "error", err)
+					}
+					break cells
+				}
+			} else {
+				w.notifier.forward(ctx, p, cp.ShardID, params, func(next *Plugin) bool {
+					at, ok := held[lane{pluginID: next.ID, shardID: cp.ShardID}]
+					return ok && at <= c.AddedID
+				})
+			}
+		}
+		handled = i + 1
+	}
+	to := page.next(handled)
+	if to == cp.AddedID {
+		return false, nil
+	}
+	return w.advance(ctx, cp, to)
+}
+
+// lanePage is a batch of a lane's cells read from its checkpoint.
+type lanePage struct {
+	cells []cell.Cell
+	// next returns where the checkpoint moves once the first n cells are
+	// handled, or 0 if it is released.
+	next func(n int) int64
+}
+
+// readLane reads a batch of the lane's cells from its checkpoint cp. A
+// store keeping a commit log returns them in commit order, which never
+// skips a cell committed late: the checkpoint moves to the lowest added_id
+// still to be handled, and st remembers how far through the log the lane
+// got, so cells handled are not read again while the checkpoint stays put.
+// Other stores return them in added_id order, behind PartitionRead's fence,
+// and the checkpoint moves past the last cell handled.
+func (w *Watchdog) readLane(ctx context.Context, store storage.CellStore, cp Checkpoint, st *laneState) (lanePage, error) {
+	var after int64
+	if st.seqAt == cp.AddedID {
+		after = st.seq
+	}
+	cells, floor, err := storage.ScanCommitLog(ctx, store, cp.AddedID, after, w.opts.BatchSize)
+	if err == nil {
+		return lanePage{cells: cells, next: func(n int) int64 {
+			to := floor
+			for _, c := range cells[n:] {
+				if to == 0 || c.AddedID < to {
+					to = c.AddedID
+				}
+			}
+			st.seq, st.seqAt = after, to
+			if n > 0 {
+				st.seq = cells[n-1].CommitSeq
+			}
+			return to
+		}}, nil
+	}
+	if !errors.Is(err, storage.ErrNoCommitLog) {
+		return lanePage{}, err
+	}
+
+	// The head is read first: the cells up to it are in the pages below,
+	// or will be once the transactions holding back the fence end. It is
+	// the committed head, not Head, so the checkpoint is not released past
+	// cells the pages have yet to reach.
+	head, err := storage.CommittedHead(ctx, store)
+	if err != nil {
+		return lanePage{}, err
+	}
+	cells, err = store.PartitionRead(ctx, cp.ShardID, storage.PartitionReadTypeAddedID, cp.AddedID-1, time.Time{}, w.opts.BatchSize)
+	if err != nil {
+		return lanePage{}, err
+	}
+	for i, c := range cells {
+		if c.AddedID > head {
+			cells = cells[:i]
+			break
+		}
+	}
+	return lanePage{cells: cells, next: func(n int) int64 {
+		to := cp.AddedID
+		if n > 0 {
+			to = cells[n-1].AddedID + 1
+		}
+		if to > head {
+			return 0
+		}
+		return to
+	}}, nil
+}
@@ -0,0 +1,371 @@
+package trigger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// shardLog serves Head and PartitionRead by added_id from a slice.
+type shardLog struct {
+	storage.CellStore
+	cells []cell.Cell
+}
+
+func (s *shardLog) Head(context.Context) (storage.Head, error) {
+	if len(s.cells) == 0 {
+		return storage.Head{}, nil
+	}
+	last := s.cells[len(s.cells)-1]
+	return storage.Head{AddedID: last.AddedID, CreatedAt: last.CreatedAt}, nil
+}
+
+func (s *shardLog) PartitionRead(_ context.Context, _ int, _ int, addedID int64, _ time.Time, limit int) ([]cell.Cell, error) {
+	var out []cell.Cell
+	for _, c := range s.cells {
+		if c.AddedID > addedID && len(out) < limit {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+// committedLog is a shardLog keeping a commit log, in which its cells are
+// in the order of their added_ids in commits.
+type committedLog struct {
+	*shardLog
+	commits []int64
+}
+
+func (s *committedLog) ScanCommitLog(_ context.Context, fromAddedID, afterSeq int64, limit int) ([]cell.Cell, int64, error) {
+	var out []cell.Cell
+	var floor int64
+	for i, addedID := range s.commits {
+		seq := int64(i + 1)
+		if seq <= afterSeq || addedID < fromAddedID {
+			continue
+		}
+		if len(out) < limit {
+			c := s.cells[addedID-1]
+			c.CommitSeq = seq
+			out = append(out, c)
+		} else if floor == 0 || addedID < floor {
+			floor = addedID
+		}
+	}
+	return out, floor, nil
+}
+
+// recordingPlugin accepts cell.written notifications except for cells with
+// added_id poison, and records the added_ids it accepted.
+type recordingPlugin struct {
+	mu       sync.Mutex
+	poison   int64
+	accepted []int64
+}
+
+func (p *recordingPlugin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     int64             `json:"id"`
+		Params CellWrittenParams `json:"params"`
+	}
+	json.NewDecoder(r.Body).Decode(&req) //nolint:errcheck
+	if req.Params.AddedID == p.poison {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	p.mu.Lock()
+	p.accepted = append(p.accepted, req.Params.AddedID)
+	p.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(JSONRPCResponse{JSONRPC: "2.0", Result: json.RawMessage(`"ok"`), ID: req.ID}) //nolint:errcheck
+}
+
+// newWatchdogTest returns a watchdog over shard 0 holding cells 1..5, the
+// odd ones in the plugin's column, with the plugin's checkpoint held at 1.
+func newWatchdogTest(t *testing.T, plugin *recordingPlugin, policy PoisonPolicy, opts WatchdogOptions) (*Watchdog, *memCheckpoints, *Plugin) {
+	t.Helper()
+	srv := httptest.NewServer(plugin)
+	t.Cleanup(srv.Close)
+
+	registry := NewPluginRegistry()
+	p := &Plugin{Name: "search-sync", Endpoint: srv.URL, SubscribedColumns: []string{"profile"}, PoisonPolicy: policy}
+	if err := registry.Register(context.Background(), p); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	notifier := NewNotifier(registry, NewRPCClient(0, time.Millisecond, 5*time.Second), slog.New(slog.DiscardHandler))
+
+	log := &shardLog{}
+	for i := int64(1); i <= 5; i++ {
+		col := "profile"
+		if i%2 == 0 {
+			col = "settings"
+		}
+		log.cells = append(log.cells, cell.Cell{AddedID: i, RowKey: uuid.New(), ColumnName: col, RefKey: 1, Body: json.RawMessage(`{}`), CreatedAt: time.Now()})
+	}
+	router := shard.NewRouter()
+	router.Register(0, log)
+
+	checkpoints := &memCheckpoints{held: map[uuid.UUID]map[int]int64{p.ID: {0: 1}}}
+	return NewWatchdog(notifier, checkpoints, router, opts, slog.New(slog.DiscardHandler)), checkpoints, p
+}
+
+func TestWatchdog_ReportsStuckLanes(t *testing.T) {
+	plugin := &recordingPlugin{}
+	w, checkpoints, p := newWatchdogTest(t, plugin, "", WatchdogOptions{Threshold: time.Minute})
+
+	// memCheckpoints leaves UpdatedAt zero: a clock at zero sees it fresh.
+	w.now = func() time.Time { return time.Time{} }
+	if err := w.check(context.Background()); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if len(w.lanes) != 0 {
+		t.Errorf("fresh checkpoint reported stuck")
+	}
+
+	w.now = time.Now
+	if err := w.check(context.Background()); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if _, ok := w.lanes[lane{pluginID: p.ID, shardID: 0}]; !ok {
+		t.Errorf("old checkpoint not reported stuck")
+	}
+	if len(plugin.accepted) != 0 || checkpoints.held[p.ID][0] != 1 {
+		t.Errorf("watchdog without MaxAttempts redelivered %v", plugin.accepted)
+	}
+}
+
+func TestWatchdog_CatchesUpAndReleases(t *testing.T) {
+	plugin := &recordingPlugin{}
+	w, checkpoints, p := newWatchdogTest(t, plugin, "", WatchdogOptions{MaxAttempts: 3, BatchSize: 2})
+
+	for range 3 {
+		if err := w.check(context.Background()); err != nil {
+			t.Fatalf("check: %v", err)
+		}
+	}
+	if len(plugin.accepted) != 3 || plugin.accepted[2] != 5 {
+		t.Errorf("redelivered: got %v, want [1 3 5]", plugin.accepted)
+	}
+	if _, held := checkpoints.held[p.ID][0]; held {
+		t.Errorf("checkpoint still held at %d", checkpoints.held[p.ID][0])
+	}
+	if len(w.lanes) != 0 {
+		t.Errorf("released lane still stuck")
+	}
+}
+
+func TestWatchdog_CatchesUpHandlers(t *testing.T) {
+	// Handler lanes are caught up without MaxAttempts or the threshold.
+	w, checkpoints, _ := newWatchdogTest(t, &recordingPlugin{}, "", WatchdogOptions{BatchSize: 2})
+	var handled []int64
+	fail := true
+	w.notifier.AddHandler("views", []string{"profile"}, func(_ context.Context, _ int, c *cell.Cell) error {
+		if c.AddedID == 3 && fail {
+			return errors.New("boom")
+		}
+		handled = append(handled, c.AddedID)
+		return nil
+	})
+	checkpoints.HoldHandlerCheckpoint(context.Background(), "views", []string{"profile"}, 0, 1) //nolint:errcheck
+	checkpoints.HoldHandlerCheckpoint(context.Background(), "gone", []string{"profile"}, 0, 1)  //nolint:errcheck
+
+	for range 2 {
+		if err := w.check(context.Background()); err != nil {
+			t.Fatalf("check: %v", err)
+		}
+	}
+	if !slices.Equal(handled, []int64{1}) || checkpoints.handlers["views"][0] != 3 {
+		t.Errorf("blocked lane: handled %v, checkpoint at %d; want [1] at 3", handled, checkpoints.handlers["views"][0])
+	}
+	if _, held := checkpoints.handlers["gone"][0]; held {
+		t.Errorf("checkpoint of a removed handler still held")
+	}
+
+	fail = false
+	for range 2 {
+		if err := w.check(context.Background()); err != nil {
+			t.Fatalf("check: %v", err)
+		}
+	}
+	if !slices.Equal(handled, []int64{1, 3, 5}) {
+		t.Errorf("handled: got %v, want [1 3 5]", handled)
+	}
+	if _, held := checkpoints.handlers["views"][0]; held {
+		t.Errorf("handler checkpoint still held at %d", checkpoints.handlers["views"][0])
+	}
+}
+
+func TestWatchdog_ExportsMetrics(t *testing.T) {
+	plugin := &recordingPlugin{}
+	w, _, p := newWatchdogTest(t, plugin, "", WatchdogOptions{MaxAttempts: 3, BatchSize: 2})
+	scanned := testutil.ToFloat64(scannedCells.WithLabelValues(p.Name))
+
+	if err := w.check(context.Background()); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if got := testutil.ToFloat64(scannedCells.WithLabelValues(p.Name)) - scanned; got != 2 {
+		t.Errorf("scanned cells: got %v, want a batch of 2", got)
+	}
+	if got := testutil.ToFloat64(lanesByState.WithLabelValues("active")); got != 1 {
+		t.Errorf("active lanes: got %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(lanesByState.WithLabelValues("idle")); got != 0 {
+		t.Errorf("idle lanes: got %v, want 0", got)
+	}
+	if testutil.CollectAndCount(deliveryDuration) == 0 {
+		t.Errorf("delivery duration not observed")
+	}
+}
+
+func TestWatchdog_SkipsPoisonCell(t *testing.T) {
+	plugin := &recordingPlugin{poison: 3}
+	w, checkpoints, p := newWatchdogTest(t, plugin, PoisonPolicySkip, WatchdogOptions{MaxAttempts: 2})
+
+	if err := w.check(context.Background()); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if got := checkpoints.held[p.ID][0]; got != 3 {
+		t.Fatalf("checkpoint after first attempt: got %d, want 3", got)
+	}
+	if err := w.check(context.Background()); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if _, held := checkpoints.held[p.ID][0]; held {
+		t.Errorf("checkpoint still held at %d after skipping", checkpoints.held[p.ID][0])
+	}
+	dead := w.notifier.DeadLetters()
+	if len(dead) != 1 || dead[0].AddedID != 3 || !dead[0].Skipped {
+		t.Errorf("dead letters: got %+v, want skipped cell 3", dead)
+	}
+	if len(plugin.accepted) != 2 || plugin.accepted[1] != 5 {
+		t.Errorf("redelivered: got %v, want [1 5]", plugin.accepted)
+	}
+}
+
+func TestWatchdog_PausesPluginOnPoisonCell(t *testing.T) {
+	plugin := &recordingPlugin{poison: 1}
+	w, checkpoints, p := newWatchdogTest(t, plugin, PoisonPolicyPause, WatchdogOptions{MaxAttempts: 1})
+
+	if err := w.check(context.Background()); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	got, err := w.notifier.registry.Get(p.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Status != PluginStatusPaused {
+		t.Errorf("status: got %q, want %q", got.Status, PluginStatusPaused)
+	}
+	if checkpoints.held[p.ID][0] != 1 {
+		t.Errorf("checkpoint: got %d, want 1 (held for the paused plugin)", checkpoints.held[p.ID][0])
+	}
+
+	// A paused plugin is not redelivered to.
+	plugin.poison = 0
+	if err := w.check(context.Background()); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if len(plugin.accepted) != 0 {
+		t.Errorf("redelivered to paused plugin: %v", plugin.accepted)
+	}
+}
+
+func TestWatchdog_BlocksOnPoisonCellByDefault(t *testing.T) {
+	plugin := &recordingPlugin{poison: 3}
+	// The plugin's own max_attempts overrides the server's default.
+	w, checkpoints, p := newWatchdogTest(t, plugin, "", WatchdogOptions{})
+	if _, err := w.notifier.registry.Update(context.Background(), p.ID, func(p *Plugin) { p.MaxAttempts = 1 }); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	for range 3 {
+		if err := w.check(context.Background()); err != nil {
+			t.Fatalf("check: %v", err)
+		}
+	}
+	if got := checkpoints.held[p.ID][0]; got != 3 {
+		t.Errorf("checkpoint: got %d, want 3 (blocked on the poison cell)", got)
+	}
+	if len(w.notifier.DeadLetters()) != 0 || len(plugin.accepted) != 1 {
+		t.Errorf("blocked lane moved on: dead letters %+v, redelivered %v", w.notifier.DeadLetters(), plugin.accepted)
+	}
+}
+
+func TestWatchdog_CatchesUpChains(t *testing.T) {
+	upstream := &recordingPlugin{poison: 3}
+	w, checkpoints, up := newWatchdogTest(t, upstream, "", WatchdogOptions{MaxAttempts: 5})
+	downstream := &recordingPlugin{}
+	srv := httptest.NewServer(downstream)
+	t.Cleanup(srv.Close)
+	down := &Plugin{Name: "search-forward", Endpoint: srv.URL, After: up.Name}
+	if err := w.notifier.registry.Register(context.Background(), down); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	// The downstream missed cell 1 and the upstream cells 1 on.
+	checkpoints.held[down.ID] = map[int]int64{0: 1}
+
+	if err := w.check(context.Background()); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	// The upstream processes cell 1 and blocks on cell 3. The downstream,
+	// behind on cell 1 itself, is not caught up past where the upstream's
+	// checkpoint was.
+	if got := checkpoints.held[up.ID][0]; got != 3 {
+		t.Errorf("upstream checkpoint: got %d, want 3", got)
+	}
+	if !slices.Equal(upstream.accepted, []int64{1}) {
+		t.Errorf("upstream accepted %v, want [1]", upstream.accepted)
+	}
+	if got := checkpoints.held[down.ID][0]; got != 1 || len(downstream.accepted) != 0 {
+		t.Errorf("downstream: checkpoint %d, accepted %v; want 1 and none", got, downstream.accepted)
+	}
+
+	upstream.poison = 0
+	for range 2 {
+		if err := w.check(context.Background()); err != nil {
+			t.Fatalf("check: %v", err)
+		}
+	}
+	if len(checkpoints.held[up.ID]) != 0 || len(checkpoints.held[down.ID]) != 0 {
+		t.Errorf("checkpoints still held: %v", checkpoints.held)
+	}
+	if !slices.Equal(downstream.accepted, []int64{1, 3, 5}) {
+		t.Errorf("downstream accepted %v, want [1 3 5]", downstream.accepted)
+	}
+}
+
+func TestWatchdog_CatchesUpInCommitOrder(t *testing.T) {
+	plugin := &recordingPlugin{}
+	w, checkpoints, p := newWatchdogTest(t, plugin, "", WatchdogOptions{MaxAttempts: 3, BatchSize: 2})
+	store, _ := w.router.StoreFor(0)
+	w.router.Register(0, &committedLog{shardLog: store.(*shardLog), commits: []int64{1, 4, 2, 5, 3}})
+
+	var held []int64
+	for range 3 {
+		if err := w.check(context.Background()); err != nil {
+			t.Fatalf("check: %v", err)
+		}
+		held = append(held, checkpoints.held[p.ID][0])
+	}
+	if !slices.Equal(plugin.accepted, []int64{1, 5, 3}) {
+		t.Errorf("redelivered: got %v, want [1 5 3] in commit order, each once", plugin.accepted)
+	}
+	// The checkpoint stays at the lowest added_id not yet redelivered.
+	if !slices.Equal(held, []int64{2, 3, 0}) {
+		t.Errorf("checkpoints after each check: got %v, want [2 3 0]", held)
+	}
+}
@@ -0,0 +1,188 @@
+package trigger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/column"
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// DefaultMaxDerivationDepth bounds derivation chains when
+// WriteBackOptions.MaxDepth is unset.
+const DefaultMaxDerivationDepth = 4
+
+// provenancePrefix starts the reserved columns holding the provenance of
+// derived cells.
+const provenancePrefix = cell.ReservedPrefix + "provenance."
+
+// ProvenanceColumn returns the reserved column holding the provenance of the
+// cells derived in columnName, at the same row_key and ref_key.
+func ProvenanceColumn(columnName string) string {
+	return provenancePrefix + columnName
+}
+
+var derivedWrites = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "mezzanine",
+		Name:      "trigger_derived_writes_total",
+		Help:      "Derived cells returned by plugins, by outcome: written, exists (written by an earlier delivery), out_of_scope or too_deep.",
+	},
+	[]string{"plugin", "outcome"},
+)
+
+// Provenance records which plugin derived a cell, from which cell, and how
+// many derivations away from a client write it is.
+type Provenance struct {
+	Plugin string       `json:"plugin"`
+	Source cell.CellRef `json:"source"`
+	Depth  int          `json:"depth"`
+}
+
+// derivedWrite is a cell a plugin returns from a cell.written notification.
+type derivedWrite struct {
+	RowKey     string          `json:"row_key"`
+	ColumnName string          `json:"column_name"`
+	RefKey     int64           `json:"ref_key"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// WriteBackOptions configures the writing of the cells plugins derive.
+type WriteBackOptions struct {
+	Router    *shard.Router
+	NumShards int
+	// Indexes and Columns, if set, index and record derived cells like
+	// client writes.
+	Indexes *index.Registry
+	Columns *column.Registry
+	// MaxDepth refuses cells derived from cells that are already MaxDepth
+	// derivations away from a client write, breaking loops of plugins
+	// deriving each other's columns (default DefaultMaxDerivationDepth).
+	MaxDepth int
+}
+
+// SetWriteBack makes the notifier write the cells plugins return from their
+// cell.written notifications, each with its provenance, and notify them in
+// turn. A plugin may write only to its WritableColumns. It must be called
+// before the notifier is used.
+func (n *Notifier) SetWriteBack(opts WriteBackOptions) {
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = DefaultMaxDerivationDepth
+	}
+	n.writeBack = &opts
+}
+
+// derive writes the cells p returned in result for the cell of params. A
+// cell that cannot be stored fails the delivery, so it is redelivered and
+// derived again; cells out of p's scope or too deep are dropped and logged.
+func (n *Notifier) derive(ctx context.Context, p *Plugin, params CellWrittenParams, result json.RawMessage) error {
+	if n.writeBack == nil || len(result) == 0 || result[0] != '{' {
+		return nil
+	}
+	var res struct {
+		Writes []derivedWrite `json:"writes"`
+	}
+	if err := json.Unmarshal(result, &res); err != nil || len(res.Writes) == 0 {
+		return nil
+	}
+	source, err := uuid.Parse(params.RowKey)
+	if err != nil {
+		return fmt.Errorf("derive: source row_key: %w", err)
+	}
+	depth := 1
+	if params.Provenance != nil {
+		depth = params.Provenance.Depth + 1
+	}
+	if depth > n.writeBack.MaxDepth {
+		derivedWrites.WithLabelValues(p.Name, "too_deep").Add(float64(len(res.Writes)))
+		n.logger.Warn("dropping derived cells past the maximum derivation depth", "plugin", p.Name, "column", params.ColumnName, "shard_id", params.ShardID, "added_id", params.AddedID, "depth", depth, "max_depth", n.writeBack.MaxDepth)
+		return nil
+	}
+	prov := &Provenance{
+		Plugin: p.Name,
+		Source: cell.CellRef{RowKey: source, ColumnName: params.ColumnName, RefKey: params.RefKey},
+		Depth:  depth,
+	}
+	provBody, err := json.Marshal(prov)
+	if err != nil {
+		return fmt.Errorf("derive: %w", err)
+	}
+	for _, w := range res.Writes {
+		rowKey, err := uuid.Parse(w.RowKey)
+		if err != nil || cell.IsReserved(w.ColumnName) || !slices.Contains(p.WritableColumns, w.ColumnName) {
+			derivedWrites.WithLabelValues(p.Name, "out_of_scope").Inc()
+			n.logger.Warn("dropping derived cell outside the plugin's writable columns", "plugin", p.Name, "row_key", w.RowKey, "column", w.ColumnName)
+			continue
+		}
+		if len(w.Body) == 0 {
+			w.Body = json.RawMessage("null")
+		}
+		c, shardID, err := n.writeDerived(ctx, rowKey, w, provBody)
+		if errors.Is(err, storage.ErrCellExists) {
+			// Derived by an earlier delivery of the same cell.
+			derivedWrites.WithLabelValues(p.Name, "exists").Inc()
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("derive %s: %w", w.ColumnName, err)
+		}
+		derivedWrites.WithLabelValues(p.Name, "written").Inc()
+		if n.writeBack.Indexes != nil {
+			if err := n.writeBack.Indexes.IndexCell(ctx, c, n.writeBack.NumShards); err != nil {
+				n.logger.Error("failed to index derived cell", "plugin", p.Name, "column", c.ColumnName, "error", err)
+			}
+		}
+		if n.writeBack.Columns != nil {
+			n.writeBack.Columns.Observe(c.ColumnName, 1, len(c.Body), c.CreatedAt)
+		}
+		n.notifyCell(int(shardID), c, prov)
+	}
+	return nil
+}
+
+// writeDerived stores a derived cell together with its provenance cell,
+// which shares its row and so its shard.
+func (n *Notifier) writeDerived(ctx context.Context, rowKey uuid.UUID, w derivedWrite, provBody []byte) (*cell.Cell, shard.ID, error) {
+	shardID := n.writeBack.Router.ForRowKey(rowKey, n.writeBack.NumShards)
+	store, err := n.writeBack.Router.StoreFor(shardID)
+	if err != nil {
+		return nil, 0, err
+	}
+	cells, err := store.WriteCells(ctx, []cell.WriteCellRequest{
+		{RowKey: rowKey, ColumnName: w.ColumnName, RefKey: w.RefKey, Body: w.Body},
+		{RowKey: rowKey, ColumnName: ProvenanceColumn(w.ColumnName), RefKey: w.RefKey, Body: provBody},
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return &cells[0], shardID, nil
+}
+
+// provenance returns the provenance of c read from store, nil if c was not
+// derived by a plugin. Only columns plugins may write are looked up.
+func (n *Notifier) provenance(ctx context.Context, store storage.CellStore, c *cell.Cell) (*Provenance, error) {
+	if n.writeBack == nil || !n.registry.Writable(c.ColumnName) {
+		return nil, nil
+	}
+	pc, err := store.GetCell(ctx, cell.CellRef{RowKey: c.RowKey, ColumnName: ProvenanceColumn(c.ColumnName), RefKey: c.RefKey})
+	if errors.Is(err, storage.ErrCellNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var prov Provenance
+	if err := json.Unmarshal(pc.Body, &prov); err != nil {
+		return nil, fmt.Errorf("provenance of %s: %w", c.ColumnName, err)
+	}
+	return &prov, nil
+}
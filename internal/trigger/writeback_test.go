@@ -0,0 +1,122 @@
+package trigger
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+	"github.com/ryanbastic/go-mezzanine/pkg/plugin"
+)
+
+// cellMap stores cells by CellRef for WriteCells and GetCell.
+type cellMap struct {
+	storage.CellStore
+	mu     sync.Mutex
+	cells  map[cell.CellRef]cell.Cell
+	nextID int64
+}
+
+func (m *cellMap) WriteCells(_ context.Context, reqs []cell.WriteCellRequest) ([]cell.Cell, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, req := range reqs {
+		if _, ok := m.cells[cell.CellRef{RowKey: req.RowKey, ColumnName: req.ColumnName, RefKey: req.RefKey}]; ok {
+			return nil, storage.ErrCellExists
+		}
+	}
+	out := make([]cell.Cell, len(reqs))
+	for i, req := range reqs {
+		m.nextID++
+		out[i] = cell.Cell{AddedID: m.nextID, RowKey: req.RowKey, ColumnName: req.ColumnName, RefKey: req.RefKey, Body: req.Body, CreatedAt: time.Now()}
+		m.cells[cell.CellRef{RowKey: req.RowKey, ColumnName: req.ColumnName, RefKey: req.RefKey}] = out[i]
+	}
+	return out, nil
+}
+
+func (m *cellMap) GetCell(_ context.Context, ref cell.CellRef) (*cell.Cell, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.cells[ref]
+	if !ok {
+		return nil, storage.ErrCellNotFound
+	}
+	return &c, nil
+}
+
+func TestNotifier_WritesDerivedCells(t *testing.T) {
+	// The plugin echoes every cell of its column into the column's next
+	// ref_key, a loop only the derivation depth stops, and tries to write
+	// outside its scope.
+	var mu sync.Mutex
+	var provenances []*plugin.Provenance
+	srv := plugin.New(plugin.Options{})
+	srv.OnCellWrittenDerive(func(_ context.Context, c plugin.CellWritten) ([]plugin.Write, error) {
+		mu.Lock()
+		provenances = append(provenances, c.Provenance)
+		mu.Unlock()
+		return []plugin.Write{
+			{RowKey: c.RowKey, ColumnName: "echo", RefKey: c.RefKey + 1, Body: c.Body},
+			{RowKey: c.RowKey, ColumnName: "profile", RefKey: 1, Body: c.Body},
+		}, nil
+	})
+	server := httptest.NewServer(srv.Handler())
+	defer server.Close()
+
+	registry := NewPluginRegistry()
+	p := &Plugin{Name: "echo", Endpoint: server.URL + "/rpc", SubscribedColumns: []string{"echo"}, WritableColumns: []string{"echo"}}
+	if err := registry.Register(context.Background(), p); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	store := &cellMap{cells: make(map[cell.CellRef]cell.Cell)}
+	router := shard.NewRouter()
+	router.Register(0, store)
+	notifier := NewNotifier(registry, NewRPCClient(0, time.Millisecond, 5*time.Second), slog.New(slog.DiscardHandler))
+	notifier.SetWriteBack(WriteBackOptions{Router: router, NumShards: 1, MaxDepth: 2})
+
+	rowKey := uuid.New()
+	written := &cell.Cell{AddedID: 100, RowKey: rowKey, ColumnName: "echo", RefKey: 1, Body: json.RawMessage(`{"v":1}`)}
+	notifier.NotifyCell(0, written)
+	if err := notifier.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+
+	// Depths 1 and 2 are written; the third derivation is refused.
+	for ref, depth := range map[int64]int{2: 1, 3: 2} {
+		if _, err := store.GetCell(context.Background(), cell.CellRef{RowKey: rowKey, ColumnName: "echo", RefKey: ref}); err != nil {
+			t.Errorf("echo v%d: %v", ref, err)
+		}
+		pc, err := store.GetCell(context.Background(), cell.CellRef{RowKey: rowKey, ColumnName: ProvenanceColumn("echo"), RefKey: ref})
+		if err != nil {
+			t.Fatalf("provenance of echo v%d: %v", ref, err)
+		}
+		var prov Provenance
+		if err := json.Unmarshal(pc.Body, &prov); err != nil {
+			t.Fatalf("decode provenance: %v", err)
+		}
+		if prov.Plugin != "echo" || prov.Depth != depth || prov.Source.RefKey != ref-1 {
+			t.Errorf("provenance of echo v%d: got %+v, want depth %d from v%d", ref, prov, depth, ref-1)
+		}
+	}
+	if len(store.cells) != 4 {
+		t.Errorf("stored cells: got %d, want 2 derived cells and their provenance", len(store.cells))
+	}
+	if len(provenances) != 3 || provenances[0] != nil || provenances[2] == nil || provenances[2].Depth != 2 {
+		t.Errorf("notified provenances: got %v, want none, depth 1, depth 2", provenances)
+	}
+
+	// Redelivering the client's cell derives cells that already exist.
+	if err := notifier.deliver(context.Background(), p, newCellWrittenParams(0, written)); err != nil {
+		t.Errorf("redelivery: %v", err)
+	}
+	if len(store.cells) != 4 {
+		t.Errorf("stored cells after redelivery: got %d, want 4", len(store.cells))
+	}
+}
@@ -0,0 +1,117 @@
+package view
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+)
+
+// Aggregate is what a view keeps per key.
+type Aggregate string
+
+const (
+	// Count is the number of rows with the key.
+	Count Aggregate = "count"
+	// Sum is the sum of a numeric field over the rows with the key.
+	Sum Aggregate = "sum"
+	// Latest is the body of the most recently written row with the key.
+	Latest Aggregate = "latest"
+)
+
+// Definition describes a materialized view: the latest cell of SourceColumn
+// in each row counts towards the key found at KeyField of its body.
+type Definition struct {
+	Name         string    `json:"name"`
+	SourceColumn string    `json:"source_column"`
+	KeyField     string    `json:"key_field"`
+	Aggregate    Aggregate `json:"aggregate"`
+	// ValueField is the numeric body field summed by a Sum view.
+	ValueField string `json:"value_field,omitempty"`
+	// Fields are the body fields a Latest view keeps, or the whole body
+	// when empty.
+	Fields []string `json:"fields,omitempty"`
+}
+
+// Config is the contents of a view config file.
+type Config struct {
+	Views []Definition `json:"views"`
+}
+
+// Load reads and validates a view config file.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read view config: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse view config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// nameRE keeps view names usable in table names, which are at most 63
+// bytes long in PostgreSQL.
+var nameRE = regexp.MustCompile(`^[a-z][a-z0-9_]{0,47}$`)
+
+// Validate checks that every view has a unique name and reads a client
+// column with the fields its aggregate needs.
+func (c *Config) Validate() error {
+	if len(c.Views) == 0 {
+		return fmt.Errorf("view config: no views")
+	}
+	names := make(map[string]bool, len(c.Views))
+	for i, v := range c.Views {
+		if !nameRE.MatchString(v.Name) {
+			return fmt.Errorf("view %d: name %q must be lowercase letters, digits and underscores, starting with a letter, at most 48 bytes", i, v.Name)
+		}
+		if names[v.Name] {
+			return fmt.Errorf("view %s: defined twice", v.Name)
+		}
+		names[v.Name] = true
+		if err := v.validate(); err != nil {
+			return fmt.Errorf("view %s: %w", v.Name, err)
+		}
+	}
+	return nil
+}
+
+func (d Definition) validate() error {
+	if err := cell.ValidateColumnName(d.SourceColumn); err != nil {
+		return err
+	}
+	if cell.IsReserved(d.SourceColumn) {
+		return fmt.Errorf("system column %s cannot be a view's source", d.SourceColumn)
+	}
+	if d.KeyField == "" {
+		return fmt.Errorf("key_field is required")
+	}
+	switch d.Aggregate {
+	case Count:
+	case Sum:
+		if d.ValueField == "" {
+			return fmt.Errorf("value_field is required by sum")
+		}
+	case Latest:
+	default:
+		return fmt.Errorf("aggregate %q: want count, sum or latest", d.Aggregate)
+	}
+	if d.ValueField != "" && d.Aggregate != Sum {
+		return fmt.Errorf("value_field is only used by sum")
+	}
+	if len(d.Fields) > 0 && d.Aggregate != Latest {
+		return fmt.Errorf("fields are only used by latest")
+	}
+	for _, f := range d.Fields {
+		if f == "" {
+			return fmt.Errorf("empty field")
+		}
+	}
+	return nil
+}
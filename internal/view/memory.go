@@ -0,0 +1,56 @@
+package view
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStore is an in-memory Store for one shard of a view, for tests,
+// examples and embedding without a database.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	members map[uuid.UUID]Member
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{members: make(map[uuid.UUID]Member)}
+}
+
+func (s *MemoryStore) Apply(ctx context.Context, m Member) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("apply view member: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.members[m.RowKey]; ok && old.RefKey > m.RefKey {
+		return nil
+	}
+	m.Body = slices.Clone(m.Body)
+	s.members[m.RowKey] = m
+	return nil
+}
+
+func (s *MemoryStore) Read(ctx context.Context, key string, latest bool) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, fmt.Errorf("read view: %w", err)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var r Result
+	for _, m := range s.members {
+		if key == "" || m.Key != key {
+			continue
+		}
+		r.Count++
+		r.Sum += m.Value
+		if latest && (r.Latest == nil || newer(&m, r.Latest)) {
+			r.Latest = &m
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,165 @@
+package view
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+)
+
+// PostgresStore is one shard of a view, in the view table of the shard's
+// database.
+type PostgresStore struct {
+	pool         *pgxpool.Pool
+	table        string
+	queryTimeout time.Duration
+}
+
+// NewPostgresStore creates the Store of one shard of a view. queryTimeout
+// sets the per-query context deadline; zero means no timeout.
+func NewPostgresStore(pool *pgxpool.Pool, name string, shardID int, queryTimeout time.Duration) *PostgresStore {
+	return &PostgresStore{pool: pool, table: Table(name, shardID), queryTimeout: queryTimeout}
+}
+
+// Table returns the table name of one shard of a view.
+func Table(name string, shardID int) string {
+	return fmt.Sprintf("view_%s_%04d", name, shardID)
+}
+
+// withTimeout bounds a query by the configured query timeout and the
+// caller's deadline, whichever comes first; a per-endpoint request budget
+// replaces the query timeout (see storage.QueryContext).
+func (s *PostgresStore) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return storage.QueryContext(ctx, s.queryTimeout)
+}
+
+// Apply implements Store. A row out of the view keeps its member, with a
+// NULL view_key, so that replays of its older cells stay out.
+func (s *PostgresStore) Apply(ctx context.Context, m Member) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var key *string
+	if m.Key != "" {
+		key = &m.Key
+	}
+	query := fmt.Sprintf(`
+		INSERT INTO %[1]s AS v (row_key, view_key, ref_key, value, body, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (row_key) DO UPDATE
+		SET view_key = EXCLUDED.view_key, ref_key = EXCLUDED.ref_key, value = EXCLUDED.value,
+			body = EXCLUDED.body, created_at = EXCLUDED.created_at
+		WHERE v.ref_key <= EXCLUDED.ref_key
+	`, s.table)
+	if _, err := s.pool.Exec(ctx, query, m.RowKey, key, m.RefKey, m.Value, m.Body, m.CreatedAt); err != nil {
+		return fmt.Errorf("apply view member: %w", err)
+	}
+	return nil
+}
+
+// Read implements Store.
+func (s *PostgresStore) Read(ctx context.Context, key string, latest bool) (Result, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var r Result
+	err := s.pool.QueryRow(ctx, fmt.Sprintf(`
+		SELECT count(*), coalesce(sum(value), 0) FROM %s WHERE view_key = $1
+	`, s.table), key).Scan(&r.Count, &r.Sum)
+	if err != nil {
+		return Result{}, fmt.Errorf("read view: %w", err)
+	}
+	if !latest || r.Count == 0 {
+		return r, nil
+	}
+	m := Member{Key: key}
+	err = s.pool.QueryRow(ctx, fmt.Sprintf(`
+		SELECT row_key, ref_key, body, created_at FROM %s
+		WHERE view_key = $1
+		ORDER BY created_at DESC, row_key DESC
+		LIMIT 1
+	`, s.table), key).Scan(&m.RowKey, &m.RefKey, &m.Body, &m.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The key's last member left between the queries.
+		return r, nil
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("read latest view member: %w", err)
+	}
+	r.Latest = &m
+	return r, nil
+}
+
+// tableDDL creates the table of one shard of a view.
+const tableDDL = `
+	CREATE TABLE IF NOT EXISTS %[1]s (
+		row_key    UUID PRIMARY KEY,
+		view_key   TEXT,
+		ref_key    BIGINT NOT NULL,
+		value      DOUBLE PRECISION NOT NULL DEFAULT 0,
+		body       JSONB,
+		created_at TIMESTAMPTZ NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_%[1]s_view_key
+		ON %[1]s (view_key, created_at DESC);
+`
+
+// CreateTablesRange creates the tables of every registered view for shards
+// [shardStart, shardEnd] using the given pool.
+func (r *Registry) CreateTablesRange(ctx context.Context, db storage.DB, shardStart, shardEnd int) error {
+	for _, def := range r.Definitions() {
+		for i := shardStart; i <= shardEnd; i++ {
+			table := Table(def.Name, i)
+			if _, err := db.Exec(ctx, fmt.Sprintf(tableDDL, table)); err != nil {
+				return fmt.Errorf("create view table %s: %w", table, err)
+			}
+		}
+	}
+	return nil
+}
+
+// PruneRange deletes, from the tables of one view for shards [shardStart,
+// shardEnd], the members taken from no stored cell of the view's source
+// column: rows whose cells are gone, and members of versions no longer
+// stored. Run after replaying the column, it leaves only members of the
+// rows' latest versions; a write racing it is kept, since its cell is
+// stored before the view is updated.
+func (r *Registry) PruneRange(ctx context.Context, pool *pgxpool.Pool, name string, shardStart, shardEnd int) (int64, error) {
+	def, ok := r.Definition(name)
+	if !ok {
+		return 0, fmt.Errorf("unknown view %q", name)
+	}
+	var pruned int64
+	for i := shardStart; i <= shardEnd; i++ {
+		table := Table(name, i)
+		tag, err := pool.Exec(ctx, fmt.Sprintf(`
+			DELETE FROM %s v
+			WHERE NOT EXISTS (
+				SELECT 1 FROM %s c
+				WHERE c.row_key = v.row_key AND c.column_name = $1 AND c.ref_key = v.ref_key
+			)
+		`, table, storage.ShardTable(i)), def.SourceColumn)
+		if err != nil {
+			return pruned, fmt.Errorf("prune view table %s: %w", table, err)
+		}
+		pruned += tag.RowsAffected()
+	}
+	return pruned, nil
+}
+
+// TruncateRange empties the tables of one view for shards [shardStart,
+// shardEnd].
+func (r *Registry) TruncateRange(ctx context.Context, pool *pgxpool.Pool, name string, shardStart, shardEnd int) error {
+	for i := shardStart; i <= shardEnd; i++ {
+		table := Table(name, i)
+		if _, err := pool.Exec(ctx, fmt.Sprintf("TRUNCATE %s", table)); err != nil {
+			return fmt.Errorf("truncate view table %s: %w", table, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+// Package view maintains materialized views: aggregates, per key, of the
+// latest cell of a column in each row, such as the count of orders per
+// customer or the latest login per user. Views are kept by an internal
+// trigger handler (see trigger.Notifier.AddHandler) in per-shard view tables
+// on the shard of each source row, so reading a key gathers from every
+// shard.
+package view
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+)
+
+// Member is what a view records of one row: the key its latest source cell
+// counts towards, empty when the cell has none, and what it contributes.
+type Member struct {
+	RowKey uuid.UUID
+	Key    string
+	// RefKey is the ref_key of the cell the member was taken from; a member
+	// from a cell with a lower ref_key does not replace it.
+	RefKey int64
+	// Value is the summed field of a Sum view.
+	Value float64
+	// Body is the body kept by a Latest view.
+	Body      json.RawMessage
+	CreatedAt time.Time
+}
+
+// Result is a view's aggregate for one key on one shard, or on all of them
+// once merged.
+type Result struct {
+	Count int64
+	Sum   float64
+	// Latest is the most recently written member, when the view keeps
+	// bodies and the key has members.
+	Latest *Member
+}
+
+// Merge adds o's aggregate to r's.
+func (r *Result) Merge(o Result) {
+	r.Count += o.Count
+	r.Sum += o.Sum
+	if o.Latest != nil && (r.Latest == nil || newer(o.Latest, r.Latest)) {
+		r.Latest = o.Latest
+	}
+}
+
+// newer reports whether a was written after b, breaking ties by row_key so
+// that shards agree.
+func newer(a, b *Member) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	return bytes.Compare(a.RowKey[:], b.RowKey[:]) > 0
+}
+
+// Store holds one shard of a view.
+type Store interface {
+	// Apply records m as its row's member, unless the row's member was
+	// taken from a cell with a greater ref_key.
+	Apply(ctx context.Context, m Member) error
+	// Read returns the aggregate of key's members; latest reports whether
+	// to return the latest of them.
+	Read(ctx context.Context, key string, latest bool) (Result, error)
+}
+
+// Registry holds all view definitions and their per-shard stores.
+type Registry struct {
+	definitions  map[string]Definition
+	stores       map[string]map[shard.ID]Store // view name -> shard -> Store
+	queryTimeout time.Duration
+}
+
+// NewRegistry creates an empty view Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		definitions: make(map[string]Definition),
+		stores:      make(map[string]map[shard.ID]Store),
+	}
+}
+
+// SetQueryTimeout configures the per-query context deadline for view stores
+// created by subsequent RegisterRange calls. Zero means no timeout.
+func (r *Registry) SetQueryTimeout(d time.Duration) {
+	r.queryTimeout = d
+}
+
+// RegisterRange adds a view definition and creates stores for shards
+// [shardStart, shardEnd]. Calling it for each backend builds the full map.
+func (r *Registry) RegisterRange(pool *pgxpool.Pool, def Definition, shardStart, shardEnd int) {
+	for i := shardStart; i <= shardEnd; i++ {
+		r.RegisterStore(def, shard.ID(i), NewPostgresStore(pool, def.Name, i, r.queryTimeout))
+	}
+}
+
+// RegisterStore adds a view definition, unless it is registered, and sets
+// the store of one of its shards.
+func (r *Registry) RegisterStore(def Definition, shardID shard.ID, store Store) {
+	r.definitions[def.Name] = def
+	shardStores, ok := r.stores[def.Name]
+	if !ok {
+		shardStores = make(map[shard.ID]Store)
+		r.stores[def.Name] = shardStores
+	}
+	shardStores[shardID] = store
+}
+
+// Definition returns the definition of a view.
+func (r *Registry) Definition(name string) (Definition, bool) {
+	def, ok := r.definitions[name]
+	return def, ok
+}
+
+// Definitions returns all registered view definitions, sorted by name.
+func (r *Registry) Definitions() []Definition {
+	defs := make([]Definition, 0, len(r.definitions))
+	for _, def := range r.definitions {
+		defs = append(defs, def)
+	}
+	slices.SortFunc(defs, func(a, b Definition) int { return cmp.Compare(a.Name, b.Name) })
+	return defs
+}
+
+// Columns returns the source columns of all registered views.
+func (r *Registry) Columns() []string {
+	var columns []string
+	for _, def := range r.definitions {
+		if !slices.Contains(columns, def.SourceColumn) {
+			columns = append(columns, def.SourceColumn)
+		}
+	}
+	slices.Sort(columns)
+	return columns
+}
+
+// StoreFor returns the store of one shard of a view.
+func (r *Registry) StoreFor(name string, shardID shard.ID) (Store, bool) {
+	store, ok := r.stores[name][shardID]
+	return store, ok
+}
+
+// HandleCell records c, written to shard shardID, in every view of its
+// column. It is the trigger handler maintaining the views.
+func (r *Registry) HandleCell(ctx context.Context, shardID int, c *cell.Cell) error {
+	var errs []error
+	for _, def := range r.Definitions() {
+		if def.SourceColumn != c.ColumnName {
+			continue
+		}
+		store, ok := r.StoreFor(def.Name, shard.ID(shardID))
+		if !ok {
+			errs = append(errs, fmt.Errorf("view %s: no store for shard %d", def.Name, shardID))
+			continue
+		}
+		if err := store.Apply(ctx, def.member(c)); err != nil {
+			errs = append(errs, fmt.Errorf("view %s: %w", def.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// member returns what the view records of c's row. A body without a string
+// or numeric KeyField, including binary and offloaded bodies, takes the row
+// out of the view. A Sum view counts a missing or non-numeric ValueField as
+// zero.
+func (d Definition) member(c *cell.Cell) Member {
+	m := Member{RowKey: c.RowKey, RefKey: c.RefKey, CreatedAt: c.CreatedAt}
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(c.Body, &obj) != nil {
+		return m
+	}
+	m.Key = keyText(obj[d.KeyField])
+	if m.Key == "" {
+		return m
+	}
+	switch d.Aggregate {
+	case Sum:
+		var v float64
+		if json.Unmarshal(obj[d.ValueField], &v) == nil {
+			m.Value = v
+		}
+	case Latest:
+		m.Body = c.Body
+		if len(d.Fields) > 0 {
+			subset := make(map[string]json.RawMessage, len(d.Fields))
+			for _, f := range d.Fields {
+				if v, ok := obj[f]; ok {
+					subset[f] = v
+				}
+			}
+			m.Body, _ = json.Marshal(subset)
+		}
+	}
+	return m
+}
+
+// keyText returns a string field's value, or a number field's literal text,
+// so that numeric ids key views as they are written.
+func keyText(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var n json.Number
+	if json.Unmarshal(raw, &n) == nil {
+		return n.String()
+	}
+	return ""
+}
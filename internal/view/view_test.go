@@ -0,0 +1,134 @@
+package view
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+)
+
+func newTestRegistry(defs ...Definition) (*Registry, *MemoryStore) {
+	r := NewRegistry()
+	var store *MemoryStore
+	for _, def := range defs {
+		store = NewMemoryStore()
+		r.RegisterStore(def, shard.ID(0), store)
+	}
+	return r, store
+}
+
+func handle(t *testing.T, r *Registry, row uuid.UUID, ref int64, body string) {
+	t.Helper()
+	c := &cell.Cell{RowKey: row, ColumnName: "order", RefKey: ref, Body: json.RawMessage(body), CreatedAt: time.Now()}
+	if err := r.HandleCell(context.Background(), 0, c); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func read(t *testing.T, s Store, key string) Result {
+	t.Helper()
+	res, err := s.Read(context.Background(), key, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestHandleCell_KeepsLatestVersionPerRow(t *testing.T) {
+	r, store := newTestRegistry(Definition{Name: "spend", SourceColumn: "order", KeyField: "customer", Aggregate: Sum, ValueField: "total"})
+	a, b := uuid.New(), uuid.New()
+
+	handle(t, r, a, 2, `{"customer":"c-1","total":10}`)
+	// A replay of an older version changes nothing.
+	handle(t, r, a, 1, `{"customer":"c-2","total":99}`)
+	handle(t, r, b, 1, `{"customer":"c-1","total":"n/a"}`)
+	if got := read(t, store, "c-1"); got.Count != 2 || got.Sum != 10 {
+		t.Errorf("c-1: got %+v, want 2 rows summing 10", got)
+	}
+	if got := read(t, store, "c-2"); got.Count != 0 {
+		t.Errorf("c-2: got %d rows, want 0", got.Count)
+	}
+
+	// A version without the key takes the row out of the view.
+	handle(t, r, a, 3, `{"total":10}`)
+	if got := read(t, store, "c-1"); got.Count != 1 || got.Sum != 0 {
+		t.Errorf("c-1 after a left: got %+v, want 1 row summing 0", got)
+	}
+	handle(t, r, a, 2, `{"customer":"c-1","total":10}`)
+	if got := read(t, store, "c-1"); got.Count != 1 {
+		t.Errorf("c-1 after replay: got %d rows, want 1", got.Count)
+	}
+}
+
+func TestHandleCell_Keys(t *testing.T) {
+	r, store := newTestRegistry(Definition{Name: "last_login", SourceColumn: "order", KeyField: "user", Aggregate: Latest, Fields: []string{"at"}})
+	handle(t, r, uuid.New(), 1, `{"user":42,"at":"09:00","ip":"10.0.0.1"}`)
+	handle(t, r, uuid.New(), 1, `{"user":{"id":42}}`)
+	handle(t, r, uuid.New(), 1, `"not an object"`)
+
+	got := read(t, store, "42")
+	if got.Count != 1 || got.Latest == nil || string(got.Latest.Body) != `{"at":"09:00"}` {
+		t.Errorf("numeric key: got %+v", got)
+	}
+	if got := read(t, store, ""); got.Count != 0 {
+		t.Errorf("empty key: got %d rows, want 0", got.Count)
+	}
+}
+
+func TestResult_Merge(t *testing.T) {
+	now := time.Now()
+	older := &Member{RowKey: uuid.New(), CreatedAt: now.Add(-time.Minute)}
+	newer := &Member{RowKey: uuid.New(), CreatedAt: now}
+	var r Result
+	r.Merge(Result{Count: 1, Sum: 2, Latest: newer})
+	r.Merge(Result{Count: 2, Sum: 3, Latest: older})
+	r.Merge(Result{})
+	if r.Count != 3 || r.Sum != 5 || r.Latest != newer {
+		t.Errorf("got %+v", r)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	write := func(content string) string {
+		path := filepath.Join(t.TempDir(), "views.json")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	cfg, err := Load(write(`{"views":[
+		{"name":"orders_per_customer","source_column":"order","key_field":"customer","aggregate":"count"},
+		{"name":"last_login","source_column":"login","key_field":"user","aggregate":"latest","fields":["at"]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Views) != 2 || cfg.Views[1].Aggregate != Latest {
+		t.Errorf("got %+v", cfg.Views)
+	}
+
+	for name, content := range map[string]string{
+		"no views":        `{"views":[]}`,
+		"bad name":        `{"views":[{"name":"Orders","source_column":"order","key_field":"c","aggregate":"count"}]}`,
+		"duplicate":       `{"views":[{"name":"v","source_column":"order","key_field":"c","aggregate":"count"},{"name":"v","source_column":"order","key_field":"c","aggregate":"count"}]}`,
+		"system column":   `{"views":[{"name":"v","source_column":"_mezz.meta","key_field":"c","aggregate":"count"}]}`,
+		"no key":          `{"views":[{"name":"v","source_column":"order","aggregate":"count"}]}`,
+		"bad aggregate":   `{"views":[{"name":"v","source_column":"order","key_field":"c","aggregate":"max"}]}`,
+		"sum no value":    `{"views":[{"name":"v","source_column":"order","key_field":"c","aggregate":"sum"}]}`,
+		"count w/ fields": `{"views":[{"name":"v","source_column":"order","key_field":"c","aggregate":"count","fields":["a"]}]}`,
+	} {
+		if _, err := Load(write(content)); err == nil {
+			t.Errorf("%s: no error", name)
+		} else if !strings.Contains(err.Error(), "view") {
+			t.Errorf("%s: error %q does not name the view config", name, err)
+		}
+	}
+}
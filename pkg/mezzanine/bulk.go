@@ -0,0 +1,233 @@
+package mezzanine
+
+// This file is hand-written (see .openapi-generator-ignore).
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// MaxBatchSize is the largest batch POST /v1/cells/batch accepts.
+const MaxBatchSize = 1000
+
+// ErrBulkWriterClosed is returned by Write after Close.
+var ErrBulkWriterClosed = errors.New("mezzanine: bulk writer closed")
+
+// BulkWriterOptions configures a BulkWriter.
+type BulkWriterOptions struct {
+	// NumShards is the server's shard count. Zero fetches it from
+	// GET /v1/shards/count.
+	NumShards int
+	// Hash is the cluster's shard hash, from GET /v1/shards/map. The zero
+	// value is the default hash, which clusters use unless their shard map
+	// records another.
+	Hash ShardHash
+	// BatchSize is the number of buffered cells per shard that triggers a
+	// flush of that shard (default 100, at most MaxBatchSize).
+	BatchSize int
+	// Concurrency bounds the batch requests in flight (default 4).
+	Concurrency int
+}
+
+// BulkWriter buffers cell writes, groups them by shard and sends each group
+// through the batch endpoint, which stores it atomically. Full groups are
+// sent in the background; Flush sends the rest and waits.
+//
+//	w, err := client.NewBulkWriter(ctx, mezzanine.BulkWriterOptions{})
+//	for _, c := range cells {
+//		if err := w.Write(ctx, c); err != nil { ... }
+//	}
+//	if err := w.Close(ctx); err != nil { ... }
+//
+// A BulkWriter is safe for concurrent use.
+type BulkWriter struct {
+	c         *Client
+	numShards int
+	hash      ShardHash
+	batchSize int
+	sem       chan struct{}
+	wg        sync.WaitGroup
+
+	mu      sync.Mutex
+	pending map[int][]WriteCellBody
+	closed  bool
+	written int
+	failed  int
+	err     error
+}
+
+// NewBulkWriter creates a BulkWriter.
+func (c *Client) NewBulkWriter(ctx context.Context, opts BulkWriterOptions) (*BulkWriter, error) {
+	if err := opts.Hash.Validate(); err != nil {
+		return nil, fmt.Errorf("shard hash: %w", err)
+	}
+	if opts.NumShards <= 0 {
+		resp, httpResp, err := c.API.ShardsAPI.GetShardCount(ctx).Execute()
+		if err != nil {
+			return nil, fmt.Errorf("get shard count: %w", wrapError(httpResp, err))
+		}
+		opts.NumShards = int(resp.NumShards)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	} else if opts.BatchSize > MaxBatchSize {
+		opts.BatchSize = MaxBatchSize
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+	return &BulkWriter{
+		c:         c,
+		numShards: opts.NumShards,
+		hash:      opts.Hash,
+		batchSize: opts.BatchSize,
+		sem:       make(chan struct{}, opts.Concurrency),
+		pending:   make(map[int][]WriteCellBody),
+	}, nil
+}
+
+// Write buffers a cell. When its shard's buffer is full the buffer is sent
+// in the background; Write blocks only while Concurrency requests are
+// already in flight. Failures are reported by Flush and Close.
+func (w *BulkWriter) Write(ctx context.Context, cell WriteCellBody) error {
+	key, err := ParseRowKey(cell.RowKey)
+	if err != nil {
+		return err
+	}
+	shard := w.hash.Shard(key[:], w.numShards)
+
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrBulkWriterClosed
+	}
+	w.pending[shard] = append(w.pending[shard], cell)
+	var batch []WriteCellBody
+	if len(w.pending[shard]) >= w.batchSize {
+		batch = w.pending[shard]
+		delete(w.pending, shard)
+	}
+	w.mu.Unlock()
+
+	if batch != nil {
+		return w.send(ctx, batch)
+	}
+	return nil
+}
+
+// Flush sends every buffered cell and waits for all in-flight batches. It
+// returns the first error seen since the previous Flush, if any.
+func (w *BulkWriter) Flush(ctx context.Context) error {
+	w.mu.Lock()
+	batches := make([][]WriteCellBody, 0, len(w.pending))
+	for shard, cells := range w.pending {
+		batches = append(batches, cells)
+		delete(w.pending, shard)
+	}
+	w.mu.Unlock()
+
+	for _, batch := range batches {
+		if err := w.send(ctx, batch); err != nil {
+			return err
+		}
+	}
+	w.wg.Wait()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := w.err
+	if err != nil {
+		err = fmt.Errorf("%d cell(s) not written: %w", w.failed, err)
+	}
+	w.err, w.failed = nil, 0
+	return err
+}
+
+// Close flushes and rejects further writes.
+func (w *BulkWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+	return w.Flush(ctx)
+}
+
+// Written returns the number of cells stored so far.
+func (w *BulkWriter) Written() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.written
+}
+
+// send starts a background request for batch once a concurrency slot frees.
+func (w *BulkWriter) send(ctx context.Context, batch []WriteCellBody) error {
+	select {
+	case w.sem <- struct{}{}:
+	case <-ctx.Done():
+		w.record(len(batch), ctx.Err())
+		return ctx.Err()
+	}
+	w.wg.Add(1)
+	go func() {
+		defer func() {
+			<-w.sem
+			w.wg.Done()
+		}()
+		w.record(len(batch), w.c.writeBatch(ctx, batch))
+	}()
+	return nil
+}
+
+func (w *BulkWriter) record(n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err != nil {
+		w.failed += n
+		if w.err == nil {
+			w.err = err
+		}
+		return
+	}
+	w.written += n
+}
+
+// writeBatch posts cells, which must share a shard, to /v1/cells/batch. The
+// generated client predates the endpoint, so the request is built here.
+func (c *Client) writeBatch(ctx context.Context, cells []WriteCellBody) error {
+	cfg := c.API.GetConfig()
+	base, err := cfg.ServerURLWithContext(ctx, "CellsAPIService.WriteCell")
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(map[string]interface{}{"cells": cells})
+	if err != nil {
+		return fmt.Errorf("encode batch: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/v1/cells/batch", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("mezzanine: write batch: %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
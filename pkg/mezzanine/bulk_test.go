@@ -0,0 +1,131 @@
+package mezzanine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+type batchServer struct {
+	mu      sync.Mutex
+	batches [][]WriteCellBody
+	fail    bool
+}
+
+func (s *batchServer) handler(t *testing.T, numShards int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/shards/count":
+			writeJSON(w, http.StatusOK, map[string]int{"num_shards": numShards})
+		case "/v1/cells/batch":
+			var req struct {
+				Cells []WriteCellBody `json:"cells"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("decode batch: %v", err)
+			}
+			s.mu.Lock()
+			s.batches = append(s.batches, req.Cells)
+			fail := s.fail
+			s.mu.Unlock()
+			if fail {
+				writeJSON(w, http.StatusConflict, map[string]string{"title": "a cell in the batch already exists"})
+				return
+			}
+			writeJSON(w, http.StatusCreated, map[string]interface{}{"cells": []interface{}{}})
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}
+}
+
+func rowKey(i int) string {
+	return fmt.Sprintf("00000000-0000-4000-8000-%012d", i)
+}
+
+func TestBulkWriter_GroupsByShard(t *testing.T) {
+	const numShards = 4
+	srv := &batchServer{}
+	c := newTestClient(t, srv.handler(t, numShards))
+	ctx := context.Background()
+
+	w, err := c.NewBulkWriter(ctx, BulkWriterOptions{BatchSize: 3, Concurrency: 2})
+	if err != nil {
+		t.Fatalf("NewBulkWriter: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := w.Write(ctx, *NewWriteCellBody(map[string]int{"i": i}, "events", 1, rowKey(i))); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := w.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if w.Written() != 20 {
+		t.Errorf("Written = %d, want 20", w.Written())
+	}
+
+	total := 0
+	for _, batch := range srv.batches {
+		if len(batch) > 3 {
+			t.Errorf("batch of %d exceeds BatchSize", len(batch))
+		}
+		key, _ := ParseRowKey(batch[0].RowKey)
+		shard := ShardForRowKey(key, numShards)
+		for _, cell := range batch {
+			key, _ := ParseRowKey(cell.RowKey)
+			if got := ShardForRowKey(key, numShards); got != shard {
+				t.Errorf("batch mixes shards %d and %d", shard, got)
+			}
+		}
+		total += len(batch)
+	}
+	if total != 20 {
+		t.Errorf("sent %d cells, want 20", total)
+	}
+
+	if err := w.Write(ctx, *NewWriteCellBody(nil, "events", 1, rowKey(0))); !errors.Is(err, ErrBulkWriterClosed) {
+		t.Errorf("Write after Close: got %v, want ErrBulkWriterClosed", err)
+	}
+}
+
+func TestBulkWriter_FlushReportsFailures(t *testing.T) {
+	srv := &batchServer{fail: true}
+	c := newTestClient(t, srv.handler(t, 1))
+	ctx := context.Background()
+
+	w, err := c.NewBulkWriter(ctx, BulkWriterOptions{NumShards: 1, BatchSize: 2})
+	if err != nil {
+		t.Fatalf("NewBulkWriter: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := w.Write(ctx, *NewWriteCellBody(map[string]int{"i": i}, "events", 1, rowKey(i))); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := w.Flush(ctx); err == nil {
+		t.Fatal("Flush: expected error")
+	}
+	if w.Written() != 0 {
+		t.Errorf("Written = %d, want 0", w.Written())
+	}
+	// The error is reported once.
+	if err := w.Flush(ctx); err != nil {
+		t.Errorf("second Flush: %v", err)
+	}
+}
+
+func TestBulkWriter_RejectsInvalidRowKey(t *testing.T) {
+	c := newTestClient(t, (&batchServer{}).handler(t, 1))
+	w, err := c.NewBulkWriter(context.Background(), BulkWriterOptions{NumShards: 1})
+	if err != nil {
+		t.Fatalf("NewBulkWriter: %v", err)
+	}
+	if err := w.Write(context.Background(), *NewWriteCellBody(nil, "events", 1, "nope")); err == nil {
+		t.Error("expected error for invalid row key")
+	}
+}
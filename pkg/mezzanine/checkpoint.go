@@ -0,0 +1,204 @@
+package mezzanine
+
+// This file is hand-written (see .openapi-generator-ignore).
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// Checkpointer persists a Consumer's position: the last added_id handled on
+// each shard. Implementations must be safe for concurrent use.
+type Checkpointer interface {
+	// Load returns the saved positions of consumer; missing shards start at 0.
+	Load(ctx context.Context, consumer string) (map[int]int64, error)
+	// Save records that consumer has handled shard up to addedID.
+	Save(ctx context.Context, consumer string, shard int, addedID int64) error
+}
+
+// MemoryCheckpointer keeps positions in memory, for tests and consumers that
+// may restart from the beginning.
+type MemoryCheckpointer struct {
+	mu  sync.Mutex
+	pos map[string]map[int]int64
+}
+
+// NewMemoryCheckpointer creates an empty MemoryCheckpointer.
+func NewMemoryCheckpointer() *MemoryCheckpointer {
+	return &MemoryCheckpointer{pos: make(map[string]map[int]int64)}
+}
+
+func (m *MemoryCheckpointer) Load(_ context.Context, consumer string) (map[int]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[int]int64, len(m.pos[consumer]))
+	for shard, id := range m.pos[consumer] {
+		out[shard] = id
+	}
+	return out, nil
+}
+
+func (m *MemoryCheckpointer) Save(_ context.Context, consumer string, shard int, addedID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pos[consumer] == nil {
+		m.pos[consumer] = make(map[int]int64)
+	}
+	m.pos[consumer][shard] = addedID
+	return nil
+}
+
+// FileCheckpointer stores positions as JSON in a local file, one object per
+// consumer. Each Save rewrites the file atomically (write and rename).
+type FileCheckpointer struct {
+	path string
+
+	mu  sync.Mutex
+	pos map[string]map[string]int64
+}
+
+// NewFileCheckpointer reads path if it exists.
+func NewFileCheckpointer(path string) (*FileCheckpointer, error) {
+	f := &FileCheckpointer{path: path, pos: make(map[string]map[string]int64)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read checkpoints: %w", err)
+	}
+	if err := json.Unmarshal(data, &f.pos); err != nil {
+		return nil, fmt.Errorf("parse checkpoints %s: %w", path, err)
+	}
+	return f, nil
+}
+
+func (f *FileCheckpointer) Load(_ context.Context, consumer string) (map[int]int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make(map[int]int64, len(f.pos[consumer]))
+	for k, id := range f.pos[consumer] {
+		shard, err := strconv.Atoi(k)
+		if err != nil {
+			return nil, fmt.Errorf("parse checkpoints %s: invalid shard %q", f.path, k)
+		}
+		out[shard] = id
+	}
+	return out, nil
+}
+
+func (f *FileCheckpointer) Save(_ context.Context, consumer string, shard int, addedID int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.pos[consumer] == nil {
+		f.pos[consumer] = make(map[string]int64)
+	}
+	f.pos[consumer][strconv.Itoa(shard)] = addedID
+
+	data, err := json.MarshalIndent(f.pos, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode checkpoints: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("write checkpoints: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write checkpoints: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write checkpoints: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write checkpoints: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("write checkpoints: %w", err)
+	}
+	return nil
+}
+
+var tableNameRe = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// SQLCheckpointer stores positions in a PostgreSQL table through
+// database/sql, so it works with whichever driver the application already
+// uses (pgx's stdlib adapter, lib/pq, ...). Keeping checkpoints in the
+// consumer's own database lets a handler update them in the same place it
+// writes its results.
+type SQLCheckpointer struct {
+	db    *sql.DB
+	table string
+}
+
+// NewSQLCheckpointer creates a checkpointer using table (default
+// "mezzanine_checkpoints"). Call CreateTable once before use.
+func NewSQLCheckpointer(db *sql.DB, table string) (*SQLCheckpointer, error) {
+	if table == "" {
+		table = "mezzanine_checkpoints"
+	}
+	if !tableNameRe.MatchString(table) {
+		return nil, fmt.Errorf("invalid checkpoint table name %q", table)
+	}
+	return &SQLCheckpointer{db: db, table: table}, nil
+}
+
+// CreateTable creates the checkpoint table if it does not exist.
+func (s *SQLCheckpointer) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			consumer   TEXT        NOT NULL,
+			shard      INTEGER     NOT NULL,
+			added_id   BIGINT      NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (consumer, shard)
+		)`, s.table))
+	if err != nil {
+		return fmt.Errorf("create checkpoint table: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLCheckpointer) Load(ctx context.Context, consumer string) (map[int]int64, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT shard, added_id FROM %s WHERE consumer = $1`, s.table), consumer)
+	if err != nil {
+		return nil, fmt.Errorf("load checkpoints: %w", err)
+	}
+	defer rows.Close()
+	out := make(map[int]int64)
+	for rows.Next() {
+		var shard int
+		var id int64
+		if err := rows.Scan(&shard, &id); err != nil {
+			return nil, fmt.Errorf("scan checkpoint: %w", err)
+		}
+		out[shard] = id
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("load checkpoints: %w", err)
+	}
+	return out, nil
+}
+
+func (s *SQLCheckpointer) Save(ctx context.Context, consumer string, shard int, addedID int64) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO %s (consumer, shard, added_id, updated_at)
+		VALUES ($1, $2, $3, now())
+		ON CONFLICT (consumer, shard) DO UPDATE
+		SET added_id = EXCLUDED.added_id, updated_at = EXCLUDED.updated_at`, s.table),
+		consumer, shard, addedID)
+	if err != nil {
+		return fmt.Errorf("save checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package mezzanine
+
+// This file is hand-written (see .openapi-generator-ignore).
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CellHandler receives cells from a Consumer. Calls for one shard are made
+// one at a time in added_id order; calls for different shards may run
+// concurrently.
+type CellHandler func(ctx context.Context, shard int, cell CellResponse) error
+
+// ConsumerOptions configures a Consumer.
+type ConsumerOptions struct {
+	// Name identifies the consumer's checkpoints. Required.
+	Name string
+	// Checkpoints persists progress; defaults to a MemoryCheckpointer.
+	Checkpoints Checkpointer
+	// NumShards is the server's shard count. Zero fetches it from
+	// GET /v1/shards/count.
+	NumShards int
+	// Shards restricts consumption to these shards (default: all), so the
+	// work can be split between several processes.
+	Shards []int
+	// PageSize is the number of cells fetched per request (default 100,
+	// at most 1000).
+	PageSize int64
+	// PollInterval is how long a caught-up shard waits before it is
+	// polled again (default 1s).
+	PollInterval time.Duration
+	// Concurrency bounds the shards fetched and handled at once (default 8).
+	Concurrency int
+	// Lag holds back cells younger than this (by their created_at). Servers
+	// only return a cell once every lower added_id has committed; against
+	// older ones, which return cells as they commit, a lag longer than the
+	// slowest write keeps the cursor from passing a slow transaction's cell.
+	Lag time.Duration
+}
+
+// Consumer reads every shard's cells through partitionRead in added_id
+// order, hands them to a CellHandler and checkpoints its position, making it
+// a ready-made change-data-capture loop. Delivery is at least once: after a
+// crash, cells handled since the last checkpoint are delivered again.
+type Consumer struct {
+	c      *Client
+	opts   ConsumerOptions
+	shards []int
+
+	mu  sync.Mutex
+	pos map[int]int64
+}
+
+// NewConsumer creates a Consumer.
+func (c *Client) NewConsumer(ctx context.Context, opts ConsumerOptions) (*Consumer, error) {
+	if opts.Name == "" {
+		return nil, errors.New("consumer name is required")
+	}
+	if opts.Checkpoints == nil {
+		opts.Checkpoints = NewMemoryCheckpointer()
+	}
+	if opts.NumShards <= 0 {
+		resp, httpResp, err := c.API.ShardsAPI.GetShardCount(ctx).Execute()
+		if err != nil {
+			return nil, fmt.Errorf("get shard count: %w", wrapError(httpResp, err))
+		}
+		opts.NumShards = int(resp.NumShards)
+	}
+	if opts.PageSize <= 0 {
+		opts.PageSize = 100
+	} else if opts.PageSize > 1000 {
+		opts.PageSize = 1000
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 8
+	}
+
+	shards := opts.Shards
+	if len(shards) == 0 {
+		shards = make([]int, opts.NumShards)
+		for i := range shards {
+			shards[i] = i
+		}
+	}
+	for _, s := range shards {
+		if s < 0 || s >= opts.NumShards {
+			return nil, fmt.Errorf("shard %d out of range [0, %d)", s, opts.NumShards)
+		}
+	}
+	return &Consumer{c: c, opts: opts, shards: shards}, nil
+}
+
+// Run consumes until ctx is cancelled or fn returns an error. The position
+// of every cell fn accepted is checkpointed, so a later Run resumes after
+// it. Run returns nil when ctx is cancelled.
+func (co *Consumer) Run(ctx context.Context, fn CellHandler) error {
+	pos, err := co.opts.Checkpoints.Load(ctx, co.opts.Name)
+	if err != nil {
+		return err
+	}
+	co.mu.Lock()
+	co.pos = pos
+	co.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Each shard is in the queue at most once, so a shard is never handled
+	// by two workers at the same time and the buffer never fills.
+	queue := make(chan int, len(co.shards))
+	for _, s := range co.shards {
+		queue <- s
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for i := 0; i < co.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				var shard int
+				select {
+				case <-ctx.Done():
+					return
+				case shard = <-queue:
+				}
+				more, err := co.poll(ctx, shard, fn)
+				if err != nil {
+					if ctx.Err() == nil {
+						errOnce.Do(func() { firstErr = err })
+					}
+					cancel()
+					return
+				}
+				if more {
+					queue <- shard
+				} else {
+					time.AfterFunc(co.opts.PollInterval, func() { queue <- shard })
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// Position returns the last added_id handled on shard.
+func (co *Consumer) Position(shard int) int64 {
+	co.mu.Lock()
+	defer co.mu.Unlock()
+	return co.pos[shard]
+}
+
+// poll fetches and handles one page of shard. It reports whether the shard
+// may have more cells ready immediately.
+func (co *Consumer) poll(ctx context.Context, shard int, fn CellHandler) (bool, error) {
+	after := co.Position(shard)
+	page, httpResp, err := co.c.API.CellsAPI.PartitionRead(ctx).
+		PartitionNumber(int64(shard)).
+		ReadType(ReadTypeAddedID).
+		AddedId(after).
+		Limit(co.opts.PageSize).
+		Execute()
+	if err != nil {
+		return false, fmt.Errorf("read shard %d: %w", shard, wrapError(httpResp, err))
+	}
+
+	cutoff := time.Time{}
+	if co.opts.Lag > 0 {
+		cutoff = time.Now().Add(-co.opts.Lag)
+	}
+	last, held := after, false
+	var handleErr error
+	for _, cell := range page {
+		if !cutoff.IsZero() && cell.CreatedAt.After(cutoff) {
+			held = true
+			break
+		}
+		if err := fn(ctx, shard, cell); err != nil {
+			handleErr = fmt.Errorf("handle shard %d added_id %d: %w", shard, cell.AddedId, err)
+			break
+		}
+		last = cell.AddedId
+	}
+
+	if last != after {
+		if err := co.opts.Checkpoints.Save(ctx, co.opts.Name, shard, last); err != nil {
+			return false, fmt.Errorf("checkpoint shard %d: %w", shard, err)
+		}
+		co.mu.Lock()
+		co.pos[shard] = last
+		co.mu.Unlock()
+	}
+	if handleErr != nil {
+		return false, handleErr
+	}
+	return !held && int64(len(page)) == co.opts.PageSize, nil
+}
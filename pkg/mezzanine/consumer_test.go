@@ -0,0 +1,150 @@
+package mezzanine
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// partitionServer serves partitionRead over fixed per-shard cells whose
+// added_ids are 1..n.
+func partitionServer(t *testing.T, cellsPerShard map[int]int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		shard, _ := strconv.Atoi(q.Get("partition_number"))
+		after, _ := strconv.ParseInt(q.Get("added_id"), 10, 64)
+		limit, _ := strconv.ParseInt(q.Get("limit"), 10, 64)
+		page := []interface{}{}
+		for id := after + 1; id <= int64(cellsPerShard[shard]) && int64(len(page)) < limit; id++ {
+			page = append(page, cellJSON(id, map[string]int{"shard": shard}))
+		}
+		writeJSON(w, http.StatusOK, page)
+	}
+}
+
+type collected struct {
+	mu    sync.Mutex
+	cells map[int][]int64
+}
+
+func (c *collected) handle(_ context.Context, shard int, cell CellResponse) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cells[shard] = append(c.cells[shard], cell.AddedId)
+	return nil
+}
+
+func (c *collected) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, ids := range c.cells {
+		n += len(ids)
+	}
+	return n
+}
+
+// runUntil runs co until want cells were handled, then stops it.
+func runUntil(t *testing.T, co *Consumer, got *collected, want int) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- co.Run(ctx, got.handle) }()
+	deadline := time.After(5 * time.Second)
+	for got.count() < want {
+		select {
+		case <-deadline:
+			cancel()
+			t.Fatalf("handled %d cells, want %d", got.count(), want)
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+}
+
+func TestConsumer_DeliversInOrderAndResumes(t *testing.T) {
+	c := newTestClient(t, partitionServer(t, map[int]int{0: 5, 1: 3}))
+	cp, err := NewFileCheckpointer(filepath.Join(t.TempDir(), "checkpoints.json"))
+	if err != nil {
+		t.Fatalf("NewFileCheckpointer: %v", err)
+	}
+	opts := ConsumerOptions{Name: "test", Checkpoints: cp, NumShards: 2, PageSize: 2, PollInterval: 10 * time.Millisecond}
+
+	co, err := c.NewConsumer(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("NewConsumer: %v", err)
+	}
+	got := &collected{cells: make(map[int][]int64)}
+	runUntil(t, co, got, 8)
+
+	for shard, n := range map[int]int{0: 5, 1: 3} {
+		ids := got.cells[shard]
+		if len(ids) != n {
+			t.Fatalf("shard %d: got %v", shard, ids)
+		}
+		for i, id := range ids {
+			if id != int64(i+1) {
+				t.Errorf("shard %d out of order: %v", shard, ids)
+				break
+			}
+		}
+		if co.Position(shard) != int64(n) {
+			t.Errorf("shard %d position = %d, want %d", shard, co.Position(shard), n)
+		}
+	}
+
+	// A new consumer over the same checkpoint file starts where this one stopped.
+	reopened, err := NewFileCheckpointer(cp.path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	pos, err := reopened.Load(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if pos[0] != 5 || pos[1] != 3 {
+		t.Errorf("checkpoints = %v", pos)
+	}
+}
+
+func TestConsumer_HandlerErrorStopsAndCheckpointsProgress(t *testing.T) {
+	c := newTestClient(t, partitionServer(t, map[int]int{0: 4}))
+	cp := NewMemoryCheckpointer()
+	co, err := c.NewConsumer(context.Background(), ConsumerOptions{Name: "test", Checkpoints: cp, NumShards: 1, PageSize: 10})
+	if err != nil {
+		t.Fatalf("NewConsumer: %v", err)
+	}
+
+	boom := errors.New("boom")
+	err = co.Run(context.Background(), func(_ context.Context, _ int, cell CellResponse) error {
+		if cell.AddedId == 3 {
+			return boom
+		}
+		return nil
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("Run: got %v, want boom", err)
+	}
+	pos, _ := cp.Load(context.Background(), "test")
+	if pos[0] != 2 {
+		t.Errorf("checkpoint = %d, want 2 (last handled cell)", pos[0])
+	}
+}
+
+func TestConsumer_ShardSubsetValidated(t *testing.T) {
+	c := newTestClient(t, partitionServer(t, nil))
+	if _, err := c.NewConsumer(context.Background(), ConsumerOptions{Name: "x", NumShards: 2, Shards: []int{2}}); err == nil {
+		t.Error("expected error for out-of-range shard")
+	}
+	if _, err := c.NewConsumer(context.Background(), ConsumerOptions{NumShards: 2}); err == nil {
+		t.Error("expected error for missing name")
+	}
+}
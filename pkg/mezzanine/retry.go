@@ -0,0 +1,191 @@
+package mezzanine
+
+// This file is hand-written (see .openapi-generator-ignore).
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// IdempotencyKeyHeader is sent with writes so the server can recognise a
+// retried request and answer it with the cell the first attempt stored.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// RetryPolicy controls retries of failed calls. Network errors, 429 and 5xx
+// responses are retried; attempts are spaced by exponential backoff starting
+// at BaseDelay and capped at MaxDelay. A Retry-After response header is
+// honoured when it asks for a longer wait, still capped at MaxDelay.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts; values below 1 mean 1.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// Jitter randomises each delay by up to this fraction of it (0–1), so
+	// clients failing together do not retry in lockstep.
+	Jitter float64
+}
+
+// DefaultRetryPolicy makes three attempts, roughly 100ms then 200ms apart.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: 2 * time.Second, Jitter: 0.2}
+
+// NoRetry makes a single attempt.
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+// backoff returns the delay before retry number attempt (1-based).
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		d -= time.Duration(p.Jitter * mathrand.Float64() * float64(d))
+	}
+	return d
+}
+
+// delay returns how long to wait before retry number attempt, taking the
+// response's Retry-After header into account.
+func (p RetryPolicy) delay(attempt int, resp *http.Response) time.Duration {
+	d := p.backoff(attempt)
+	if ra := retryAfter(resp); ra > d {
+		d = ra
+		if p.MaxDelay > 0 && d > p.MaxDelay {
+			d = p.MaxDelay
+		}
+	}
+	return d
+}
+
+// retryable reports whether a call that returned resp and err may succeed if
+// repeated.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func retryAfter(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+type idempotencyKeyCtx struct{}
+
+// WithIdempotencyKey fixes the Idempotency-Key sent by writes made with ctx.
+// Use it to keep the key stable across retries made above the client, e.g.
+// when a job re-runs after a crash. Without it each write gets a random key
+// that is reused only for that call's own retries.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key)
+}
+
+// RetryTransport is an http.RoundTripper that retries requests according to
+// a RetryPolicy. Writes (POST, PUT, PATCH) are given an Idempotency-Key
+// before the first attempt so that retrying them cannot store a cell twice.
+// Install it on the generated client with:
+//
+//	cfg := mezzanine.NewConfiguration()
+//	cfg.HTTPClient = &http.Client{Transport: mezzanine.NewRetryTransport(mezzanine.DefaultRetryPolicy, nil)}
+type RetryTransport struct {
+	policy RetryPolicy
+	next   http.RoundTripper
+}
+
+// NewRetryTransport wraps next, which defaults to http.DefaultTransport.
+func NewRetryTransport(policy RetryPolicy, next http.RoundTripper) *RetryTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &RetryTransport{policy: policy, next: next}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	attempts := t.policy.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	if isWrite(req.Method) && req.Header.Get(IdempotencyKeyHeader) == "" {
+		key, _ := req.Context().Value(idempotencyKeyCtx{}).(string)
+		if key == "" {
+			var err error
+			if key, err = newIdempotencyKey(); err != nil {
+				return nil, err
+			}
+		}
+		req = req.Clone(req.Context())
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	// A body that cannot be rewound can only be sent once.
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		attempts = 1
+	}
+
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		if attempt >= attempts || !retryable(resp, err) {
+			return resp, err
+		}
+		wait := t.policy.delay(attempt, resp)
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("rewind request body: %w", err)
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+	}
+}
+
+func isWrite(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch
+}
+
+// newIdempotencyKey returns a random (version 4) UUID string.
+func newIdempotencyKey() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("generate idempotency key: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
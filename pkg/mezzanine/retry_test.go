@@ -0,0 +1,148 @@
+package mezzanine
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var fastRetry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond}
+	for attempt, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond} {
+		if got := p.backoff(attempt + 1); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempt+1, got, want)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.backoff(1); got < 50*time.Millisecond || got > 100*time.Millisecond {
+			t.Fatalf("jittered backoff(1) = %s, want within [50ms, 100ms]", got)
+		}
+	}
+}
+
+func TestRetryPolicyDelay_HonoursRetryAfter(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: 3 * time.Second}
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"2"}}}
+	if got := p.delay(1, resp); got != 2*time.Second {
+		t.Errorf("delay = %s, want 2s", got)
+	}
+	resp.Header.Set("Retry-After", "120")
+	if got := p.delay(1, resp); got != 3*time.Second {
+		t.Errorf("delay = %s, want MaxDelay 3s", got)
+	}
+}
+
+func TestRetryTransport_RetriesWritesWithSameKey(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		keys   []string
+		bodies []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		keys = append(keys, r.Header.Get(IdempotencyKeyHeader))
+		bodies = append(bodies, string(data))
+		n := len(keys)
+		mu.Unlock()
+		switch n {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: NewRetryTransport(fastRetry, nil)}
+	resp, err := client.Post(srv.URL, "application/json", strings.NewReader(`{"a":1}`))
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("status = %d, want 201", resp.StatusCode)
+	}
+	if len(keys) != 3 {
+		t.Fatalf("attempts = %d, want 3", len(keys))
+	}
+	for i := range keys {
+		if keys[i] == "" || keys[i] != keys[0] {
+			t.Errorf("attempt %d key = %q, want %q", i+1, keys[i], keys[0])
+		}
+		if bodies[i] != `{"a":1}` {
+			t.Errorf("attempt %d body = %q", i+1, bodies[i])
+		}
+	}
+}
+
+func TestRetryTransport_KeyFromContext(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(IdempotencyKeyHeader)
+	}))
+	defer srv.Close()
+
+	req, _ := http.NewRequestWithContext(WithIdempotencyKey(context.Background(), "job-42"), http.MethodPost, srv.URL, strings.NewReader("{}"))
+	resp, err := (&http.Client{Transport: NewRetryTransport(fastRetry, nil)}).Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+	if got != "job-42" {
+		t.Errorf("key = %q, want job-42", got)
+	}
+	if req.Header.Get(IdempotencyKeyHeader) != "" {
+		t.Error("caller's request was modified")
+	}
+}
+
+func TestRetryTransport_DoesNotRetryClientErrors(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusConflict)
+	}))
+	defer srv.Close()
+
+	resp, err := (&http.Client{Transport: NewRetryTransport(fastRetry, nil)}).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	resp.Body.Close()
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestRetryTransport_StopsOnContextCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	slow := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: time.Second}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	start := time.Now()
+	_, err := (&http.Client{Transport: NewRetryTransport(slow, nil)}).Do(req)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("retry loop ignored cancellation (%s)", time.Since(start))
+	}
+}
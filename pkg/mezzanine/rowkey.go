@@ -0,0 +1,100 @@
+package mezzanine
+
+// This file is hand-written (see .openapi-generator-ignore).
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+)
+
+// RowKeyNamespace is the UUID under which DeriveRowKey names namespaces
+// given as plain strings: the UUIDv5 of the URL
+// "https://github.com/ryanbastic/go-mezzanine/row-keys".
+const RowKeyNamespace = "1d01adc3-00a8-5822-9459-4f28f60c3f10"
+
+var rowKeyNamespace = [16]byte{0x1d, 0x01, 0xad, 0xc3, 0x00, 0xa8, 0x58, 0x22, 0x94, 0x59, 0x4f, 0x28, 0xf6, 0x0c, 0x3f, 0x10}
+
+// DeriveRowKey returns the row key of a natural key, such as an email
+// address in the namespace "user", as a UUIDv5, so producers that write the
+// same entity again arrive at the same row without keeping a key store. A
+// namespace in UUID form is used as the UUIDv5 namespace itself, which
+// matches keys derived by other UUIDv5 implementations; any other string
+// names one, itself derived under RowKeyNamespace. The server derives keys
+// the same way (POST /v1/row-keys:derive) and checks the natural_key of
+// writes against it.
+func DeriveRowKey(namespace, key string) [16]byte {
+	ns, err := ParseRowKey(namespace)
+	if err != nil {
+		ns = uuidV5(rowKeyNamespace, namespace)
+	}
+	return uuidV5(ns, key)
+}
+
+// NewRowKey returns a new row key for an entity without a natural key, as a
+// UUIDv7: 48 bits of Unix time in milliseconds followed by random bits, so
+// keys made later sort after earlier ones. New rows then land at the end of
+// the shard tables' row_key indexes instead of on random pages, and rows
+// written around the same time share index pages. Shards are chosen by a
+// hash of the whole key (ShardForRowKey), so time-ordered keys still spread
+// evenly across them. The server generates keys the same way for writes
+// that omit row_key.
+func NewRowKey() [16]byte {
+	return newTimeOrderedKey(time.Now(), true)
+}
+
+// NewULIDRowKey returns a new row key laid out as a ULID: 48 bits of Unix
+// time in milliseconds followed by 80 random bits, without the version and
+// variant bits of a UUID. It sorts like NewRowKey's keys, for clients that
+// already identify entities by ULIDs; the server stores and returns it in
+// UUID form.
+func NewULIDRowKey() [16]byte {
+	return newTimeOrderedKey(time.Now(), false)
+}
+
+// newTimeOrderedKey returns a random key whose first 48 bits are the Unix
+// milliseconds of t, marked as a UUIDv7 if v7 is set.
+func newTimeOrderedKey(t time.Time, v7 bool) [16]byte {
+	var u [16]byte
+	if _, err := rand.Read(u[6:]); err != nil {
+		panic("mezzanine: reading random bytes: " + err.Error())
+	}
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(t.UnixMilli()))
+	copy(u[:6], ms[2:])
+	if v7 {
+		u[6] = u[6]&0x0f | 0x70
+		u[8] = u[8]&0x3f | 0x80
+	}
+	return u
+}
+
+// FormatRowKey formats a row key in canonical UUID form, the inverse of
+// ParseRowKey.
+func FormatRowKey(key [16]byte) string {
+	var buf [36]byte
+	hex.Encode(buf[0:8], key[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], key[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], key[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], key[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:36], key[10:16])
+	return string(buf[:])
+}
+
+// uuidV5 is the RFC 9562 name-based UUID of name in namespace.
+func uuidV5(namespace [16]byte, name string) [16]byte {
+	h := sha1.New()
+	h.Write(namespace[:])
+	h.Write([]byte(name))
+	var u [16]byte
+	copy(u[:], h.Sum(nil))
+	u[6] = u[6]&0x0f | 0x50
+	u[8] = u[8]&0x3f | 0x80
+	return u
+}
@@ -0,0 +1,58 @@
+package mezzanine
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestDeriveRowKey(t *testing.T) {
+	// Derived keys name stored rows; these values must never change.
+	for _, tt := range []struct {
+		namespace, key, want string
+	}{
+		{"user", "alice@example.com", "eeb29f0a-6613-574e-97b7-3af95f9271c5"},
+		// A UUID namespace is used as is: this is the RFC DNS namespace.
+		{"6ba7b810-9dad-11d1-80b4-00c04fd430c8", "example.com", "cfbff0d1-9375-5685-968c-48ce8b15ae17"},
+	} {
+		if got := FormatRowKey(DeriveRowKey(tt.namespace, tt.key)); got != tt.want {
+			t.Errorf("DeriveRowKey(%q, %q) = %s, want %s", tt.namespace, tt.key, got, tt.want)
+		}
+	}
+	if FormatRowKey(rowKeyNamespace) != RowKeyNamespace {
+		t.Errorf("rowKeyNamespace is %s, want %s", FormatRowKey(rowKeyNamespace), RowKeyNamespace)
+	}
+}
+
+func TestFormatRowKey_RoundTrip(t *testing.T) {
+	const s = "550e8400-e29b-41d4-a716-446655440000"
+	key, err := ParseRowKey(s)
+	if err != nil {
+		t.Fatalf("ParseRowKey: %v", err)
+	}
+	if got := FormatRowKey(key); got != s {
+		t.Errorf("FormatRowKey = %s, want %s", got, s)
+	}
+}
+
+func TestNewRowKey_TimeOrdered(t *testing.T) {
+	at := time.UnixMilli(1700000000000)
+	for _, v7 := range []bool{true, false} {
+		earlier := newTimeOrderedKey(at, v7)
+		later := newTimeOrderedKey(at.Add(time.Millisecond), v7)
+		if bytes.Compare(earlier[:], later[:]) >= 0 {
+			t.Errorf("v7=%v: key %s made earlier does not sort before %s", v7, FormatRowKey(earlier), FormatRowKey(later))
+		}
+		if got := FormatRowKey(earlier)[:13]; got != "018bcfe5-6800" {
+			t.Errorf("v7=%v: timestamp prefix %s, want 018bcfe5-6800", v7, got)
+		}
+	}
+
+	key := NewRowKey()
+	if key[6]>>4 != 7 || key[8]>>6 != 2 {
+		t.Errorf("NewRowKey %s is not a UUIDv7", FormatRowKey(key))
+	}
+	if NewRowKey() == key {
+		t.Error("NewRowKey returned the same key twice")
+	}
+}
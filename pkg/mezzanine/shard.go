@@ -0,0 +1,155 @@
+package mezzanine
+
+// This file is hand-written (see .openapi-generator-ignore).
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"math"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// Hash functions a ShardHash may name.
+const (
+	HashFNV1a   = "fnv1a"
+	HashXXHash  = "xxhash"
+	HashMurmur3 = "murmur3"
+)
+
+// ShardHash is how a cluster hashes keys to shards: a function, the version
+// of its key-to-shard mapping and a seed. A version never changes meaning; a
+// better mapping for a function is added as a new version, so clusters keep
+// the placement their data was written with until they reshard onto
+// another. The zero ShardHash is FNV-1a version 1, which servers use unless
+// their shard map records another hash (GET /v1/shards/map).
+type ShardHash struct {
+	// Function is fnv1a, xxhash (XXH64) or murmur3 (MurmurHash3 x86
+	// 32-bit); empty is fnv1a.
+	Function string `json:"function,omitempty"`
+	// Version is the version of the mapping; zero is 1, the only one yet.
+	Version int `json:"version,omitempty"`
+	// Seed seeds xxhash and murmur3, up to 2^32-1 for murmur3. FNV-1a
+	// takes no seed.
+	Seed uint64 `json:"seed,omitempty"`
+}
+
+// Validate reports an error if h names an unknown function or version, or
+// a seed its function does not take.
+func (h ShardHash) Validate() error {
+	switch h.Function {
+	case "", HashFNV1a:
+		if h.Seed != 0 {
+			return fmt.Errorf("%s takes no seed", HashFNV1a)
+		}
+	case HashXXHash:
+	case HashMurmur3:
+		if h.Seed > math.MaxUint32 {
+			return fmt.Errorf("%s seed %d does not fit in 32 bits", HashMurmur3, h.Seed)
+		}
+	default:
+		return fmt.Errorf("unknown hash function %q: want %s, %s or %s", h.Function, HashFNV1a, HashXXHash, HashMurmur3)
+	}
+	if h.Version != 0 && h.Version != 1 {
+		return fmt.Errorf("unknown version %d of hash function %s", h.Version, h.function())
+	}
+	return nil
+}
+
+func (h ShardHash) function() string {
+	if h.Function == "" {
+		return HashFNV1a
+	}
+	return h.Function
+}
+
+// String names h as function/vN, with its seed if it has one.
+func (h ShardHash) String() string {
+	v := h.Version
+	if v == 0 {
+		v = 1
+	}
+	s := fmt.Sprintf("%s/v%d", h.function(), v)
+	if h.Seed != 0 {
+		s += fmt.Sprintf(" seed %d", h.Seed)
+	}
+	return s
+}
+
+// Shard returns the shard key is stored on among numShards. h must be
+// valid.
+func (h ShardHash) Shard(key []byte, numShards int) int {
+	switch h.Function {
+	case HashXXHash:
+		d := xxhash.NewWithSeed(h.Seed)
+		d.Write(key)
+		return int(d.Sum64() % uint64(numShards))
+	case HashMurmur3:
+		return int(murmur3(key, uint32(h.Seed)) % uint32(numShards))
+	}
+	f := fnv.New32a()
+	f.Write(key)
+	return int(f.Sum32()) % numShards
+}
+
+// ShardForRowKey returns the shard a row key is stored on, given the server's
+// shard count (GET /v1/shards/count). The server routes with this same
+// function, so clients can group writes by shard before sending them. It
+// uses the default hash; for a cluster whose shard map records another, use
+// that ShardHash's Shard.
+func ShardForRowKey(rowKey [16]byte, numShards int) int {
+	return ShardHash{}.Shard(rowKey[:], numShards)
+}
+
+// murmur3 is MurmurHash3's x86 32-bit hash of data.
+func murmur3(data []byte, seed uint32) uint32 {
+	const c1, c2 = 0xcc9e2d51, 0x1b873593
+	h := seed
+	n := len(data) / 4 * 4
+	for i := 0; i < n; i += 4 {
+		k := uint32(data[i]) | uint32(data[i+1])<<8 | uint32(data[i+2])<<16 | uint32(data[i+3])<<24
+		k *= c1
+		k = k<<15 | k>>17
+		k *= c2
+		h ^= k
+		h = h<<13 | h>>19
+		h = h*5 + 0xe6546b64
+	}
+	var k uint32
+	switch len(data) - n {
+	case 3:
+		k ^= uint32(data[n+2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(data[n+1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(data[n])
+		k *= c1
+		k = k<<15 | k>>17
+		k *= c2
+		h ^= k
+	}
+	h ^= uint32(len(data))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
+
+// ParseRowKey parses a row key in canonical UUID form
+// (xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx).
+func ParseRowKey(s string) ([16]byte, error) {
+	var key [16]byte
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return key, fmt.Errorf("invalid row key %q: not a UUID", s)
+	}
+	digits := s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:36]
+	if _, err := hex.Decode(key[:], []byte(digits)); err != nil {
+		return key, fmt.Errorf("invalid row key %q: %w", s, err)
+	}
+	return key, nil
+}
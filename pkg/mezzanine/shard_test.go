@@ -0,0 +1,76 @@
+package mezzanine
+
+import "testing"
+
+func TestShardForRowKey_Stable(t *testing.T) {
+	// Changing the hash would misroute every stored row; these values are
+	// pinned to what the server has always computed.
+	key, err := ParseRowKey("550e8400-e29b-41d4-a716-446655440000")
+	if err != nil {
+		t.Fatalf("ParseRowKey: %v", err)
+	}
+	if got := ShardForRowKey(key, 64); got != 50 {
+		t.Errorf("64 shards: got %d, want 50", got)
+	}
+	if got := ShardForRowKey(key, 4096); got != 178 {
+		t.Errorf("4096 shards: got %d, want 178", got)
+	}
+}
+
+func TestMurmur3(t *testing.T) {
+	for _, tt := range []struct {
+		data string
+		seed uint32
+		want uint32
+	}{
+		{"", 0, 0},
+		{"", 1, 0x514e28b7},
+		{"hello", 0, 0x248bfa47},
+		{"The quick brown fox jumps over the lazy dog", 0, 0x2e4ff723},
+	} {
+		if got := murmur3([]byte(tt.data), tt.seed); got != tt.want {
+			t.Errorf("murmur3(%q, %d) = %#x, want %#x", tt.data, tt.seed, got, tt.want)
+		}
+	}
+}
+
+func TestShardHash(t *testing.T) {
+	key, _ := ParseRowKey("550e8400-e29b-41d4-a716-446655440000")
+	if got := (ShardHash{Function: HashFNV1a, Version: 1}).Shard(key[:], 64); got != ShardForRowKey(key, 64) {
+		t.Errorf("fnv1a/v1: got shard %d, want the default's %d", got, ShardForRowKey(key, 64))
+	}
+	// Every function must spread keys over every shard.
+	for _, h := range []ShardHash{{Function: HashXXHash, Seed: 42}, {Function: HashMurmur3, Seed: 42}} {
+		seen := make(map[int]bool)
+		for i := 0; i < 1000; i++ {
+			key[15] = byte(i)
+			key[14] = byte(i >> 8)
+			seen[h.Shard(key[:], 8)] = true
+		}
+		if len(seen) != 8 {
+			t.Errorf("%s: 1000 keys hit %d of 8 shards", h, len(seen))
+		}
+	}
+
+	for _, h := range []ShardHash{
+		{Function: "sha1"},
+		{Function: HashXXHash, Version: 2},
+		{Function: HashFNV1a, Seed: 1},
+		{Function: HashMurmur3, Seed: 1 << 32},
+	} {
+		if err := h.Validate(); err == nil {
+			t.Errorf("Validate(%+v): expected error", h)
+		}
+	}
+	if err := (ShardHash{}).Validate(); err != nil {
+		t.Errorf("Validate(zero): %v", err)
+	}
+}
+
+func TestParseRowKey_Invalid(t *testing.T) {
+	for _, s := range []string{"", "not-a-uuid", "550e8400e29b41d4a716446655440000", "550e8400-e29b-41d4-a716-44665544000g"} {
+		if _, err := ParseRowKey(s); err == nil {
+			t.Errorf("ParseRowKey(%q): expected error", s)
+		}
+	}
+}
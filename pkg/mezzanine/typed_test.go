@@ -0,0 +1,195 @@
+package mezzanine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type profile struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+func newTestClient(t *testing.T, h http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return NewClient(ClientOptions{
+		BaseURL: srv.URL,
+		Retry:   RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func cellJSON(addedID int64, body interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"added_id":    addedID,
+		"row_key":     "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+		"column_name": "profile",
+		"ref_key":     1,
+		"body":        body,
+		"created_at":  time.Unix(1700000000+addedID, 0).UTC().Format(time.RFC3339),
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Body profile `json:"body"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		writeJSON(w, http.StatusCreated, cellJSON(7, req.Body))
+	})
+
+	got, err := WriteJSON(context.Background(), c, "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "profile", 1, profile{Name: "Ada", Email: "ada@example.com"})
+	if err != nil {
+		t.Fatalf("WriteJSON: %v", err)
+	}
+	if got.AddedID != 7 || got.Body.Email != "ada@example.com" {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestGetLatestAs_RetriesServerErrors(t *testing.T) {
+	var calls int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"title": "unavailable"})
+			return
+		}
+		writeJSON(w, http.StatusOK, cellJSON(1, profile{Name: "Ada"}))
+	})
+
+	got, err := GetLatestAs[profile](context.Background(), c, "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "profile")
+	if err != nil {
+		t.Fatalf("GetLatestAs: %v", err)
+	}
+	if got.Body.Name != "Ada" {
+		t.Errorf("body = %+v", got.Body)
+	}
+	if calls != 3 {
+		t.Errorf("calls = %d, want 3", calls)
+	}
+}
+
+func TestGetAs_NotFoundIsNotRetried(t *testing.T) {
+	var calls int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		writeJSON(w, http.StatusNotFound, map[string]string{"title": "not found"})
+	})
+
+	_, err := GetAs[profile](context.Background(), c, "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "profile", 1)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("err = %v, want ErrNotFound", err)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestPartitionReader_PagesByAddedID(t *testing.T) {
+	const total = 5
+	var requests int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		after, _ := strconv.ParseInt(r.URL.Query().Get("added_id"), 10, 64)
+		limit, _ := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+		page := []interface{}{}
+		for id := after + 1; id <= total && int64(len(page)) < limit; id++ {
+			page = append(page, cellJSON(id, profile{Name: "n" + strconv.FormatInt(id, 10)}))
+		}
+		writeJSON(w, http.StatusOK, page)
+	})
+
+	r := c.NewPartitionReader(3, PartitionReaderOptions{PageSize: 2})
+	var ids []int64
+	for r.Next(context.Background()) {
+		ids = append(ids, r.Cell().AddedId)
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if len(ids) != total || ids[0] != 1 || ids[total-1] != total {
+		t.Errorf("ids = %v", ids)
+	}
+	if r.Cursor() != total {
+		t.Errorf("Cursor = %d, want %d", r.Cursor(), total)
+	}
+	// Pages of 2, 2 and 1; the short page ends iteration without a fourth call.
+	if requests != 3 {
+		t.Errorf("requests = %d, want 3", requests)
+	}
+}
+
+func TestPartitionReader_PagesByCreatedAtWithinATimestamp(t *testing.T) {
+	const total = 5
+	at := time.Unix(1700000000, 0).UTC()
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		after, _ := strconv.ParseInt(q.Get("added_id"), 10, 64)
+		limit, _ := strconv.ParseInt(q.Get("limit"), 10, 64)
+		createdAfter, _ := time.Parse(time.RFC3339, q.Get("created_after"))
+		page := []interface{}{}
+		for id := int64(1); id <= total && int64(len(page)) < limit; id++ {
+			if at.After(createdAfter) || (at.Equal(createdAfter) && after > 0 && id > after) {
+				cell := cellJSON(id, profile{})
+				cell["created_at"] = at.Format(time.RFC3339)
+				page = append(page, cell)
+			}
+		}
+		writeJSON(w, http.StatusOK, page)
+	})
+
+	r := c.NewPartitionReader(3, PartitionReaderOptions{ReadType: ReadTypeCreatedAt, CreatedAfter: at.Add(-time.Second), PageSize: 2})
+	var ids []int64
+	for r.Next(context.Background()) {
+		ids = append(ids, r.Cell().AddedId)
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if len(ids) != total || ids[total-1] != total {
+		t.Errorf("ids = %v, want every cell sharing the timestamp", ids)
+	}
+	if !r.CreatedCursor().Equal(at) || r.Cursor() != total {
+		t.Errorf("cursor = (%v, %d), want (%v, %d)", r.CreatedCursor(), r.Cursor(), at, total)
+	}
+}
+
+func TestQueryIndexAll(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/index/by_email/ada@example.com" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		writeJSON(w, http.StatusOK, []interface{}{map[string]interface{}{
+			"added_id":   1,
+			"row_key":    "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+			"shard_key":  "ada@example.com",
+			"body":       profile{Name: "Ada", Email: "ada@example.com"},
+			"created_at": time.Now().UTC().Format(time.RFC3339),
+		}})
+	})
+
+	got, err := QueryIndexAll[profile](context.Background(), c, "by_email", "ada@example.com")
+	if err != nil {
+		t.Fatalf("QueryIndexAll: %v", err)
+	}
+	if len(got) != 1 || got[0].Body.Name != "Ada" {
+		t.Errorf("got %+v", got)
+	}
+}
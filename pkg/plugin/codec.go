@@ -0,0 +1,163 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"reflect"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec encodes JSON-RPC messages on the wire. Messages are described by
+// their json struct tags whatever the codec, and json.RawMessage values —
+// params, results and cell bodies — are carried in the codec's native form,
+// so a handler sees the same JSON whichever encoding delivered it.
+type Codec interface {
+	// ContentType is the media type of encoded messages.
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	// JSON is the default encoding.
+	JSON Codec = jsonCodec{}
+	// MessagePack is smaller on the wire and cheaper to decode than JSON,
+	// for plugins receiving large bodies at high rates.
+	MessagePack Codec = msgpackCodec{}
+)
+
+// encodings maps the names plugins register their encoding with to codecs.
+var encodings = map[string]Codec{
+	"json":    JSON,
+	"msgpack": MessagePack,
+}
+
+// Encoding returns the codec of a named encoding: "json" or "msgpack".
+// The empty name is JSON.
+func Encoding(name string) (Codec, bool) {
+	if name == "" {
+		return JSON, true
+	}
+	c, ok := encodings[name]
+	return c, ok
+}
+
+// CodecFor returns the codec of a Content-Type header.
+func CodecFor(contentType string) (Codec, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	switch mediaType {
+	case "application/json":
+		return JSON, true
+	case "application/msgpack", "application/x-msgpack":
+		return MessagePack, true
+	}
+	return nil, false
+}
+
+// isBatch reports whether body, encoded with c, is a batch of requests.
+func isBatch(c Codec, body []byte) bool {
+	switch c.(type) {
+	case jsonCodec:
+		trimmed := bytes.TrimSpace(body)
+		return len(trimmed) > 0 && trimmed[0] == '['
+	case msgpackCodec:
+		// fixarray, array 16 and array 32 headers.
+		return len(body) > 0 && (body[0]&0xf0 == 0x90 || body[0] == 0xdc || body[0] == 0xdd)
+	}
+	var probe []any
+	return c.Unmarshal(body, &probe) == nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string                { return "application/json" }
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string { return "application/msgpack" }
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+// json.RawMessage values are converted to and from MessagePack values
+// rather than carried as opaque bytes, so plugins decode bodies with
+// MessagePack too.
+func init() {
+	msgpack.Register(json.RawMessage(nil),
+		func(enc *msgpack.Encoder, v reflect.Value) error {
+			raw := v.Bytes()
+			if len(raw) == 0 {
+				return enc.EncodeNil()
+			}
+			generic, err := fromJSON(raw)
+			if err != nil {
+				return err
+			}
+			return enc.Encode(generic)
+		},
+		func(dec *msgpack.Decoder, v reflect.Value) error {
+			generic, err := dec.DecodeInterface()
+			if err != nil {
+				return err
+			}
+			raw, err := json.Marshal(generic)
+			if err != nil {
+				return err
+			}
+			v.SetBytes(raw)
+			return nil
+		})
+}
+
+// fromJSON decodes JSON into generic values, keeping integers exact.
+func fromJSON(raw []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return numbers(v), nil
+}
+
+// numbers replaces the json.Numbers in v with int64 or float64 values.
+func numbers(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for k, e := range v {
+			v[k] = numbers(e)
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = numbers(e)
+		}
+	}
+	return v
+}
@@ -0,0 +1,438 @@
+// Package plugin implements the receiving side of Mezzanine's trigger
+// framework, so a plugin is a handler function rather than a hand-written
+// JSON-RPC server:
+//
+//	p := plugin.New(plugin.Options{Secret: []byte(os.Getenv("TRIGGER_SIGNING_SECRET"))})
+//	p.OnCellWritten(func(ctx context.Context, c plugin.CellWritten) error {
+//		log.Printf("%s/%s v%d written", c.RowKey, c.ColumnName, c.RefKey)
+//		return nil
+//	})
+//	err := p.ListenAndServe(ctx, ":9001")
+//
+// The server accepts JSON-RPC 2.0 requests (single or batched) on /rpc,
+// encoded as JSON or, for plugins registered with the msgpack encoding,
+// MessagePack (see Codec); answers GET /healthz, verifies request signatures when a secret is set, and
+// drains in-flight requests on shutdown. A handler error is returned to
+// Mezzanine as a JSON-RPC error, which the notifier records as a dead letter.
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// MethodCellWritten is the notification Mezzanine sends after a cell write.
+const MethodCellWritten = "cell.written"
+
+// MethodCellValidate is the request Mezzanine sends before storing a cell of
+// a column the plugin subscribes to synchronously; the cell is stored only
+// if the plugin accepts it.
+const MethodCellValidate = "cell.validate"
+
+// JSON-RPC 2.0 error codes.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	// CodeHandlerError is returned when a registered handler fails.
+	CodeHandlerError = -32000
+)
+
+// maxBodyBytes bounds a request body, batched or not.
+const maxBodyBytes = 16 << 20
+
+// CellWritten is the cell.written notification payload.
+type CellWritten struct {
+	AddedID    int64           `json:"added_id"`
+	RowKey     string          `json:"row_key"`
+	ColumnName string          `json:"column_name"`
+	RefKey     int64           `json:"ref_key"`
+	Body       json.RawMessage `json:"body"`
+	CreatedAt  time.Time       `json:"created_at"`
+	ShardID    int             `json:"shard_id"`
+	// Streams are the plugin's subscribed streams the cell belongs to,
+	// empty if it was delivered for a subscribed column only.
+	Streams []string `json:"streams,omitempty"`
+	// SchemaVersion is the version of the column's latest registered schema
+	// when the cell was notified, 0 if it had none. Schemas are served at
+	// GET /v1/schemas/{column_name}.
+	SchemaVersion int `json:"schema_version,omitempty"`
+	// Provenance is set for cells derived by a plugin (see Write).
+	Provenance *Provenance `json:"provenance,omitempty"`
+}
+
+// CellValidate is the cell.validate request payload: a cell not yet stored.
+type CellValidate struct {
+	RowKey     string          `json:"row_key"`
+	ColumnName string          `json:"column_name"`
+	RefKey     int64           `json:"ref_key"`
+	Body       json.RawMessage `json:"body"`
+	ShardID    int             `json:"shard_id"`
+}
+
+// Decode unmarshals the cell body into v.
+func (c CellValidate) Decode(v any) error {
+	return json.Unmarshal(c.Body, v)
+}
+
+// CellRef addresses a cell.
+type CellRef struct {
+	RowKey     string `json:"row_key"`
+	ColumnName string `json:"column_name"`
+	RefKey     int64  `json:"ref_key"`
+}
+
+// Provenance says which plugin derived a cell, from which cell, and how many
+// derivations away from a client write it is. Mezzanine refuses cells
+// derived past its TRIGGER_MAX_DERIVATION_DEPTH.
+type Provenance struct {
+	Plugin string  `json:"plugin"`
+	Source CellRef `json:"source"`
+	Depth  int     `json:"depth"`
+}
+
+// Write is a cell derived from a notified cell, which Mezzanine writes on the
+// plugin's behalf. Its column must be one of the plugin's registered
+// writable_columns. A cell that already exists is left as it is, so
+// redelivered notifications may derive the same cells again.
+type Write struct {
+	RowKey     string          `json:"row_key"`
+	ColumnName string          `json:"column_name"`
+	RefKey     int64           `json:"ref_key"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// Decode unmarshals the cell body into v.
+func (c CellWritten) Decode(v any) error {
+	return json.Unmarshal(c.Body, v)
+}
+
+// MethodFunc handles one JSON-RPC method. Its result is marshalled into the
+// response; a returned error becomes a JSON-RPC error.
+type MethodFunc func(ctx context.Context, params json.RawMessage) (any, error)
+
+// Options configures a plugin Server.
+type Options struct {
+	// Secret enables signature verification; it must match the server's
+	// TRIGGER_SIGNING_SECRET. Empty accepts unsigned requests.
+	Secret []byte
+	// Tolerance bounds signature age (default DefaultTolerance).
+	Tolerance time.Duration
+	// ShutdownTimeout bounds the drain of in-flight requests (default 10s).
+	ShutdownTimeout time.Duration
+	// Logger defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+// Server is a JSON-RPC 2.0 server for Mezzanine notifications.
+type Server struct {
+	opts Options
+
+	mu      sync.RWMutex
+	methods map[string]MethodFunc
+}
+
+// New creates a Server with no methods registered.
+func New(opts Options) *Server {
+	if opts.Tolerance <= 0 {
+		opts.Tolerance = DefaultTolerance
+	}
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = 10 * time.Second
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	return &Server{opts: opts, methods: make(map[string]MethodFunc)}
+}
+
+// Handle registers fn for method, replacing any previous handler.
+func (s *Server) Handle(method string, fn MethodFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.methods[method] = fn
+}
+
+// OnCellWritten registers fn for cell.written notifications.
+func (s *Server) OnCellWritten(fn func(ctx context.Context, c CellWritten) error) {
+	s.Handle(MethodCellWritten, func(ctx context.Context, params json.RawMessage) (any, error) {
+		var c CellWritten
+		if err := json.Unmarshal(params, &c); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		if err := fn(ctx, c); err != nil {
+			return nil, err
+		}
+		return "ok", nil
+	})
+}
+
+// OnCellWrittenDerive registers fn for cell.written notifications, writing
+// the cells it returns. It replaces any handler registered with
+// OnCellWritten.
+func (s *Server) OnCellWrittenDerive(fn func(ctx context.Context, c CellWritten) ([]Write, error)) {
+	s.Handle(MethodCellWritten, func(ctx context.Context, params json.RawMessage) (any, error) {
+		var c CellWritten
+		if err := json.Unmarshal(params, &c); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		writes, err := fn(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		if len(writes) == 0 {
+			return "ok", nil
+		}
+		return struct {
+			Writes []Write `json:"writes"`
+		}{writes}, nil
+	})
+}
+
+// OnCellValidate registers fn for cell.validate requests. A returned error
+// rejects the write, failing it with 422 and fn's message; the cell is not
+// stored. Mezzanine waits at most its TRIGGER_SYNC_TIMEOUT for the answer.
+func (s *Server) OnCellValidate(fn func(ctx context.Context, c CellValidate) error) {
+	s.Handle(MethodCellValidate, func(ctx context.Context, params json.RawMessage) (any, error) {
+		var c CellValidate
+		if err := json.Unmarshal(params, &c); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		if err := fn(ctx, c); err != nil {
+			return nil, err
+		}
+		return "ok", nil
+	})
+}
+
+// OnCellTransform registers fn for cell.validate requests, storing the body
+// it returns instead of the cell's; a nil body keeps the cell as it is. A
+// returned error rejects the write as with OnCellValidate, whose handler it
+// replaces.
+func (s *Server) OnCellTransform(fn func(ctx context.Context, c CellValidate) (json.RawMessage, error)) {
+	s.Handle(MethodCellValidate, func(ctx context.Context, params json.RawMessage) (any, error) {
+		var c CellValidate
+		if err := json.Unmarshal(params, &c); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		body, err := fn(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		if body == nil {
+			return "ok", nil
+		}
+		return struct {
+			Body json.RawMessage `json:"body"`
+		}{body}, nil
+	})
+}
+
+// Handler returns the plugin's HTTP handler: POST /rpc and GET /healthz.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rpc", s.serveRPC)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"ok"}`))
+	})
+	return mux
+}
+
+// ListenAndServe serves Handler on addr until ctx is cancelled, then shuts
+// down gracefully, waiting up to ShutdownTimeout for in-flight requests. It
+// accepts cleartext HTTP/2 (h2c) alongside HTTP/1.1, for servers that set
+// TRIGGER_H2C.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	srv := &http.Server{Addr: addr, Handler: s.Handler(), ReadHeaderTimeout: 5 * time.Second, Protocols: &protocols}
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.ListenAndServe() }()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.opts.ShutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+// Error is a JSON-RPC error. Handlers may return one to choose the code;
+// any other error is reported with CodeHandlerError.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  any             `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+func (s *Server) serveRPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodyBytes))
+	if err != nil {
+		http.Error(w, "read body", http.StatusBadRequest)
+		return
+	}
+	if len(s.opts.Secret) > 0 {
+		if err := Verify(s.opts.Secret, body, r.Header.Get(SignatureHeader), time.Now(), s.opts.Tolerance); err != nil {
+			s.opts.Logger.Warn("rejected notification", "remote", r.RemoteAddr, "error", err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	// Requests are answered in their own encoding; anything but a known
+	// one is taken for JSON.
+	codec, ok := CodecFor(r.Header.Get("Content-Type"))
+	if !ok {
+		codec = JSON
+	}
+	var out any
+	if isBatch(codec, body) {
+		var reqs []request
+		if err := codec.Unmarshal(body, &reqs); err != nil {
+			out = errorResponse(nil, CodeParseError, err.Error())
+		} else if len(reqs) == 0 {
+			out = errorResponse(nil, CodeInvalidRequest, "empty batch")
+		} else {
+			// Batches are handled in order: notifications for one shard
+			// arrive in added_id order and handlers may rely on that.
+			resps := make([]response, len(reqs))
+			for i, req := range reqs {
+				resps[i] = s.call(r.Context(), req)
+			}
+			out = resps
+		}
+	} else {
+		var req request
+		if err := codec.Unmarshal(body, &req); err != nil {
+			out = errorResponse(nil, CodeParseError, err.Error())
+		} else {
+			out = s.call(r.Context(), req)
+		}
+	}
+
+	data, err := codec.Marshal(out)
+	if err != nil {
+		s.opts.Logger.Error("encode rpc response", "error", err)
+		http.Error(w, "encode response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", codec.ContentType())
+	if _, err := w.Write(data); err != nil {
+		s.opts.Logger.Error("write rpc response", "error", err)
+	}
+}
+
+func (s *Server) call(ctx context.Context, req request) response {
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return errorResponse(req.ID, CodeInvalidRequest, "invalid JSON-RPC 2.0 request")
+	}
+	s.mu.RLock()
+	fn, ok := s.methods[req.Method]
+	s.mu.RUnlock()
+	if !ok {
+		return errorResponse(req.ID, CodeMethodNotFound, "method not found: "+req.Method)
+	}
+
+	result, err := fn(ctx, req.Params)
+	if err != nil {
+		var rpcErr *Error
+		if errors.As(err, &rpcErr) {
+			return response{JSONRPC: "2.0", Error: rpcErr, ID: req.ID}
+		}
+		s.opts.Logger.Error("plugin handler failed", "method", req.Method, "error", err)
+		return errorResponse(req.ID, CodeHandlerError, err.Error())
+	}
+	return response{JSONRPC: "2.0", Result: result, ID: req.ID}
+}
+
+func errorResponse(id json.RawMessage, code int, msg string) response {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return response{JSONRPC: "2.0", Error: &Error{Code: code, Message: msg}, ID: id}
+}
+
+// Registration describes a plugin to register with Mezzanine.
+type Registration struct {
+	Name              string   `json:"name"`
+	Endpoint          string   `json:"endpoint"`
+	SubscribedColumns []string `json:"subscribed_columns,omitempty"`
+	// SubscribedStreams names streams, created beforehand, whose cells the
+	// plugin receives.
+	SubscribedStreams []string `json:"subscribed_streams,omitempty"`
+	// Encoding is the encoding of the notifications sent to the plugin:
+	// "json" (the default) or "msgpack".
+	Encoding string `json:"encoding,omitempty"`
+	// After names a registered plugin this one follows in a chain,
+	// receiving each cell once that plugin has processed it successfully.
+	// A chained plugin sets no subscriptions of its own.
+	After string `json:"after,omitempty"`
+	// WritableColumns are the columns the plugin may write derived cells to
+	// (see OnCellWrittenDerive).
+	WritableColumns []string `json:"writable_columns,omitempty"`
+	// SynchronousColumns are subscribed columns whose writes wait for the
+	// plugin to accept each cell (see OnCellValidate).
+	SynchronousColumns []string `json:"synchronous_columns,omitempty"`
+}
+
+// Register registers the plugin with the Mezzanine server at baseURL. A
+// plugin that is already registered (409) is not an error, so plugins can
+// call Register on every start.
+func Register(ctx context.Context, baseURL string, reg Registration) error {
+	data, err := json.Marshal(reg)
+	if err != nil {
+		return fmt.Errorf("marshal registration: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/v1/plugins", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("register plugin: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusConflict:
+		return nil
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("register plugin: unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+}
@@ -0,0 +1,206 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer(secret []byte) *Server {
+	return New(Options{Secret: secret, Logger: slog.New(slog.DiscardHandler)})
+}
+
+func post(t *testing.T, h http.Handler, body string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+const cellWrittenReq = `{"jsonrpc":"2.0","method":"cell.written","id":7,"params":{"added_id":3,"row_key":"550e8400-e29b-41d4-a716-446655440000","column_name":"billing","ref_key":1,"body":{"amount":4.5},"created_at":"2026-01-01T00:00:00Z","shard_id":2}}`
+
+func TestServer_CellWritten(t *testing.T) {
+	s := newTestServer(nil)
+	var got CellWritten
+	var amount struct {
+		Amount float64 `json:"amount"`
+	}
+	s.OnCellWritten(func(_ context.Context, c CellWritten) error {
+		got = c
+		return c.Decode(&amount)
+	})
+
+	w := post(t, s.Handler(), cellWrittenReq, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	var resp struct {
+		Result string          `json:"result"`
+		Error  *Error          `json:"error"`
+		ID     json.RawMessage `json:"id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Error != nil || resp.Result != "ok" || string(resp.ID) != "7" {
+		t.Errorf("response = %s", w.Body.String())
+	}
+	if got.AddedID != 3 || got.ShardID != 2 || amount.Amount != 4.5 {
+		t.Errorf("handler got %+v, amount %v", got, amount.Amount)
+	}
+}
+
+func TestServer_HandlerErrorAndUnknownMethod(t *testing.T) {
+	s := newTestServer(nil)
+	s.OnCellWritten(func(context.Context, CellWritten) error { return errors.New("ledger unavailable") })
+
+	w := post(t, s.Handler(), cellWrittenReq, nil)
+	var resp struct {
+		Error *Error `json:"error"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Error == nil || resp.Error.Code != CodeHandlerError {
+		t.Errorf("handler error: got %s", w.Body.String())
+	}
+
+	w = post(t, s.Handler(), `{"jsonrpc":"2.0","method":"nope","id":1}`, nil)
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Error == nil || resp.Error.Code != CodeMethodNotFound {
+		t.Errorf("unknown method: got %s", w.Body.String())
+	}
+
+	w = post(t, s.Handler(), `{not json`, nil)
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Error == nil || resp.Error.Code != CodeParseError {
+		t.Errorf("parse error: got %s", w.Body.String())
+	}
+}
+
+func TestServer_Batch(t *testing.T) {
+	s := newTestServer(nil)
+	var order []int64
+	s.OnCellWritten(func(_ context.Context, c CellWritten) error {
+		order = append(order, c.AddedID)
+		return nil
+	})
+
+	body := `[
+		{"jsonrpc":"2.0","method":"cell.written","id":1,"params":{"added_id":1}},
+		{"jsonrpc":"2.0","method":"cell.written","id":2,"params":{"added_id":2}},
+		{"jsonrpc":"2.0","method":"missing","id":3}
+	]`
+	w := post(t, s.Handler(), body, nil)
+	var resps []struct {
+		Result string `json:"result"`
+		Error  *Error `json:"error"`
+		ID     int    `json:"id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resps); err != nil {
+		t.Fatalf("decode: %v\n%s", err, w.Body.String())
+	}
+	if len(resps) != 3 || resps[0].ID != 1 || resps[1].Result != "ok" || resps[2].Error == nil {
+		t.Errorf("responses = %s", w.Body.String())
+	}
+	if len(order) != 2 || order[0] != 1 || order[1] != 2 {
+		t.Errorf("handled out of order: %v", order)
+	}
+}
+
+func TestServer_MessagePackBatch(t *testing.T) {
+	s := newTestServer(nil)
+	var got []CellWritten
+	s.OnCellWritten(func(_ context.Context, c CellWritten) error {
+		got = append(got, c)
+		return nil
+	})
+
+	var reqs []request
+	for _, id := range []string{"1", "2"} {
+		reqs = append(reqs, request{JSONRPC: "2.0", Method: MethodCellWritten, ID: json.RawMessage(id), Params: json.RawMessage(`{"added_id":` + id + `,"body":{"amount":4.5}}`)})
+	}
+	body, err := MessagePack.Marshal(reqs)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	w := post(t, s.Handler(), string(body), http.Header{"Content-Type": {"application/msgpack"}})
+	if ct := w.Header().Get("Content-Type"); ct != "application/msgpack" {
+		t.Fatalf("Content-Type = %q, body %q", ct, w.Body.String())
+	}
+	var resps []struct {
+		Result string          `json:"result"`
+		ID     json.RawMessage `json:"id"`
+	}
+	if err := MessagePack.Unmarshal(w.Body.Bytes(), &resps); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resps) != 2 || resps[1].Result != "ok" || string(resps[1].ID) != "2" {
+		t.Errorf("responses = %+v", resps)
+	}
+	if len(got) != 2 || got[1].AddedID != 2 || string(got[1].Body) != `{"amount":4.5}` {
+		t.Errorf("handler got %+v", got)
+	}
+}
+
+func TestServer_Signature(t *testing.T) {
+	secret := []byte("s3cret")
+	s := newTestServer(secret)
+	s.OnCellWritten(func(context.Context, CellWritten) error { return nil })
+
+	if w := post(t, s.Handler(), cellWrittenReq, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("unsigned: status = %d, want 401", w.Code)
+	}
+	h := http.Header{SignatureHeader: []string{Sign(secret, []byte(cellWrittenReq), time.Now())}}
+	if w := post(t, s.Handler(), cellWrittenReq, h); w.Code != http.StatusOK {
+		t.Errorf("signed: status = %d, want 200\n%s", w.Code, w.Body.String())
+	}
+}
+
+func TestServer_Healthz(t *testing.T) {
+	w := httptest.NewRecorder()
+	newTestServer(nil).Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d", w.Code)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	var got Registration
+	status := http.StatusCreated
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/plugins" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		data, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(data, &got)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	reg := Registration{Name: "billing", Endpoint: "http://billing/rpc", SubscribedColumns: []string{"billing"}}
+	if err := Register(context.Background(), srv.URL, reg); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if got.Name != "billing" || len(got.SubscribedColumns) != 1 {
+		t.Errorf("registration = %+v", got)
+	}
+
+	status = http.StatusConflict
+	if err := Register(context.Background(), srv.URL, reg); err != nil {
+		t.Errorf("already registered: %v", err)
+	}
+	status = http.StatusBadRequest
+	if err := Register(context.Background(), srv.URL, reg); err == nil {
+		t.Error("expected error for 400")
+	}
+}
@@ -0,0 +1,41 @@
+package plugin
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	secret := []byte("s3cret")
+	body := []byte(`{"jsonrpc":"2.0"}`)
+	now := time.Unix(1700000000, 0)
+	header := Sign(secret, body, now)
+
+	if err := Verify(secret, body, header, now.Add(time.Minute), DefaultTolerance); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		secret []byte
+		body   []byte
+		header string
+		now    time.Time
+		want   error
+	}{
+		{"missing", secret, body, "", now, ErrMissingSignature},
+		{"wrong secret", []byte("other"), body, header, now, ErrInvalidSignature},
+		{"tampered body", secret, []byte(`{"jsonrpc":"2.1"}`), header, now, ErrInvalidSignature},
+		{"malformed", secret, body, "v1=abc", now, ErrInvalidSignature},
+		{"stale", secret, body, header, now.Add(10 * time.Minute), ErrExpiredSignature},
+		{"future", secret, body, header, now.Add(-10 * time.Minute), ErrExpiredSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(tt.secret, tt.body, tt.header, tt.now, DefaultTolerance); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+// Package server runs Mezzanine in-process, for Go services that want to
+// embed the cell store and its HTTP API instead of deploying it separately.
+//
+// A minimal embedding registers a store per shard and serves the handler:
+//
+//	stores, err := server.PostgresStores(ctx, pool, 0, 63, 5*time.Second)
+//	if err != nil { ... }
+//	srv, err := server.New(server.Options{NumShards: 64, Stores: stores})
+//	if err != nil { ... }
+//	http.Handle("/", srv.Handler())
+//
+// The aliased types below are the same types the standalone server uses, so
+// custom CellStore implementations and interceptors plug in directly.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ryanbastic/go-mezzanine/internal/api"
+	"github.com/ryanbastic/go-mezzanine/internal/cell"
+	"github.com/ryanbastic/go-mezzanine/internal/index"
+	"github.com/ryanbastic/go-mezzanine/internal/shard"
+	"github.com/ryanbastic/go-mezzanine/internal/storage"
+	"github.com/ryanbastic/go-mezzanine/internal/storage/memory"
+	"github.com/ryanbastic/go-mezzanine/internal/trigger"
+	mezzanine "github.com/ryanbastic/go-mezzanine/pkg/mezzanine"
+)
+
+type (
+	// Cell is an immutable JSON blob stored at a (row_key, column_name, ref_key) coordinate.
+	Cell = cell.Cell
+	// CellRef identifies a cell.
+	CellRef = cell.CellRef
+	// WriteCellRequest is the input to CellStore.WriteCell.
+	WriteCellRequest = cell.WriteCellRequest
+	// CellStore stores the cells of one shard.
+	CellStore = storage.CellStore
+	// Head is a shard's write position, returned by CellStore.Head.
+	Head = storage.Head
+	// ShardID is a shard number in [0, NumShards).
+	ShardID = shard.ID
+	// Interceptor wraps a shard's CellStore (see Server.Use).
+	Interceptor = shard.Interceptor
+	// IndexDefinition describes a secondary index.
+	IndexDefinition = index.Definition
+	// IndexRegistry holds index definitions and their per-shard stores.
+	IndexRegistry = index.Registry
+	// Plugin is a JSON-RPC endpoint notified of cell writes.
+	Plugin = trigger.Plugin
+	// PluginRegistry holds registered plugins.
+	PluginRegistry = trigger.PluginRegistry
+	// Notifier delivers cell.written notifications to plugins.
+	Notifier = trigger.Notifier
+	// Pinger is checked by the readiness probe; *pgxpool.Pool satisfies it.
+	Pinger = api.Pinger
+	// Limits sets the page sizes of list endpoints.
+	Limits = api.Limits
+	// ListLimit is the default and maximum page size of one list endpoint.
+	ListLimit = api.ListLimit
+	// WriteHook rejects or transforms cells before they are stored (see
+	// Options.WriteHooks).
+	WriteHook = api.WriteHook
+)
+
+// Errors returned by CellStore implementations.
+var (
+	ErrCellNotFound = storage.ErrCellNotFound
+	ErrCellExists   = storage.ErrCellExists
+)
+
+// Options configures an embedded server. Only NumShards and Stores are required.
+type Options struct {
+	// NumShards is the number of shards rows are hashed into.
+	NumShards int
+	// Stores must hold a CellStore for every shard in [0, NumShards).
+	Stores map[ShardID]CellStore
+	// Indexes defaults to an empty registry.
+	Indexes *IndexRegistry
+	// Plugins defaults to an empty in-memory registry.
+	Plugins *PluginRegistry
+	// Notifier, if nil, is built from Plugins with default retry settings.
+	Notifier *Notifier
+	// Backends are pinged by /v1/readyz.
+	Backends map[string]Pinger
+	// Logger defaults to slog.Default().
+	Logger *slog.Logger
+	// Limits defaults to api defaults for every unset list endpoint.
+	Limits Limits
+	// WriteHooks run, in order, on every cell written through the API
+	// before it is stored: each may return a new body, or an error to
+	// reject the write with 422. Plugins subscribed synchronously to the
+	// cell's column validate it after them.
+	WriteHooks []WriteHook
+	// ShardHash places row keys and index keys on shards; the zero value
+	// is the default hash. It is also set on Indexes.
+	ShardHash mezzanine.ShardHash
+}
+
+// Server is an embeddable Mezzanine instance.
+type Server struct {
+	router    *shard.Router
+	numShards int
+	indexes   *IndexRegistry
+	plugins   *PluginRegistry
+	notifier  *Notifier
+	handler   http.Handler
+}
+
+// New validates opts and builds the HTTP API.
+func New(opts Options) (*Server, error) {
+	if opts.NumShards <= 0 {
+		return nil, errors.New("NumShards must be positive")
+	}
+	if err := opts.ShardHash.Validate(); err != nil {
+		return nil, fmt.Errorf("ShardHash: %w", err)
+	}
+	router := shard.NewRouter()
+	router.SetHash(opts.ShardHash)
+	for id := range ShardID(opts.NumShards) {
+		store, ok := opts.Stores[id]
+		if !ok || store == nil {
+			return nil, fmt.Errorf("no store for shard %d", id)
+		}
+		router.Register(id, store)
+	}
+
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	indexes := opts.Indexes
+	if indexes == nil {
+		indexes = NewIndexRegistry()
+	}
+	indexes.SetHash(opts.ShardHash)
+	plugins := opts.Plugins
+	if plugins == nil {
+		plugins = NewPluginRegistry()
+	}
+	notifier := opts.Notifier
+	if notifier == nil {
+		notifier = trigger.NewNotifier(plugins, trigger.NewRPCClient(3, 100*time.Millisecond, 5*time.Second), logger)
+	}
+
+	return &Server{
+		router:    router,
+		numShards: opts.NumShards,
+		indexes:   indexes,
+		plugins:   plugins,
+		notifier:  notifier,
+		handler:   api.NewServer(logger, router, indexes, plugins, notifier, opts.NumShards, opts.Backends, api.ServerOptions{Limits: opts.Limits, WriteHooks: opts.WriteHooks}),
+	}, nil
+}
+
+// Handler returns the HTTP API, including health probes and /metrics.
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// Use wraps every shard's store with i (e.g. caching or instrumentation).
+func (s *Server) Use(i Interceptor) {
+	s.router.Use(i)
+}
+
+// Store returns the (intercepted) store for a shard, for in-process access
+// that bypasses HTTP. Writes made this way are not indexed or notified.
+func (s *Server) Store(id ShardID) (CellStore, error) {
+	return s.router.StoreFor(id)
+}
+
+// Indexes returns the index registry.
+func (s *Server) Indexes() *IndexRegistry {
+	return s.indexes
+}
+
+// Plugins returns the plugin registry.
+func (s *Server) Plugins() *PluginRegistry {
+	return s.plugins
+}
+
+// ListenAndServe serves the API on addr until ctx is cancelled, then shuts
+// down gracefully, waiting up to 10 seconds for in-flight requests and the
+// plugin notifications they dispatched.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	srv := &http.Server{Addr: addr, Handler: s.handler, ReadHeaderTimeout: 5 * time.Second}
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.ListenAndServe() }()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := srv.Shutdown(shutdownCtx)
+	return errors.Join(err, s.notifier.Shutdown(shutdownCtx))
+}
+
+// PostgresStores creates the cell tables for shards [start, end] on pool
+// (if missing) and returns a PostgreSQL-backed store for each.
+func PostgresStores(ctx context.Context, pool *pgxpool.Pool, start, end int, queryTimeout time.Duration) (map[ShardID]CellStore, error) {
+	if err := storage.WithMigrationLock(ctx, pool, func(db storage.DB) error {
+		return storage.RunMigrationsForPool(ctx, db, start, end)
+	}); err != nil {
+		return nil, err
+	}
+	stores := make(map[ShardID]CellStore, end-start+1)
+	for i := start; i <= end; i++ {
+		stores[ShardID(i)] = storage.NewPostgresStore(pool, i, queryTimeout)
+	}
+	return stores, nil
+}
+
+// MemoryStores returns an empty in-memory store for each of shards
+// [start, end], for tests, examples and trying Mezzanine out without a
+// database. Cells are lost when the process exits.
+func MemoryStores(start, end int) map[ShardID]CellStore {
+	stores := make(map[ShardID]CellStore, end-start+1)
+	for i := start; i <= end; i++ {
+		stores[ShardID(i)] = memory.New()
+	}
+	return stores
+}
+
+// NewIndexRegistry returns an empty index registry. Register definitions
+// with RegisterRange and create their tables with CreateTablesRange.
+func NewIndexRegistry() *IndexRegistry {
+	return index.NewRegistry()
+}
+
+// NewPluginRegistry returns an in-memory plugin registry.
+func NewPluginRegistry() *PluginRegistry {
+	return trigger.NewPluginRegistry()
+}
+
+// ShardFor returns the shard a row key is stored on, placed with the
+// server's ShardHash.
+func (s *Server) ShardFor(rowKey uuid.UUID) ShardID {
+	return s.router.ForRowKey(rowKey, s.numShards)
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	mezzanine "github.com/ryanbastic/go-mezzanine/pkg/mezzanine"
+)
+
+func TestNew_RequiresEveryShard(t *testing.T) {
+	stores := MemoryStores(0, 2)
+	if _, err := New(Options{NumShards: 4, Stores: stores}); err == nil {
+		t.Error("expected error for missing shard store")
+	}
+	if _, err := New(Options{NumShards: 0}); err == nil {
+		t.Error("expected error for zero shards")
+	}
+	if _, err := New(Options{NumShards: 2, Stores: stores, ShardHash: mezzanine.ShardHash{Function: "crc32"}}); err == nil {
+		t.Error("expected error for an unknown shard hash")
+	}
+}
+
+func TestServer_WriteAndReadOverHTTP(t *testing.T) {
+	srv, err := New(Options{NumShards: 4, Stores: MemoryStores(0, 3), Logger: slog.New(slog.DiscardHandler)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	rowKey := uuid.New()
+	body := `{"row_key":"` + rowKey.String() + `","column_name":"profile","ref_key":1,"body":{"name":"alice"}}`
+	resp, err := http.Post(ts.URL+"/v1/cells", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("write status: got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(ts.URL + "/v1/cells/" + rowKey.String() + "/profile")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	var got struct {
+		Body json.RawMessage `json:"body"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if string(got.Body) != `{"name":"alice"}` {
+		t.Errorf("body: got %s", got.Body)
+	}
+
+	// The cell is also reachable in-process on its shard.
+	store, err := srv.Store(srv.ShardFor(rowKey))
+	if err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	if _, err := store.GetCell(context.Background(), CellRef{RowKey: rowKey, ColumnName: "profile", RefKey: 1}); err != nil {
+		t.Errorf("GetCell: %v", err)
+	}
+}
+
+func TestServer_Use(t *testing.T) {
+	srv, err := New(Options{NumShards: 2, Stores: MemoryStores(0, 1)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	var calls int
+	srv.Use(func(id ShardID, next CellStore) CellStore {
+		calls++
+		return next
+	})
+	if calls != 2 {
+		t.Errorf("interceptor applied to %d shards, want 2", calls)
+	}
+}
+
+func TestServer_WriteHooks(t *testing.T) {
+	stores := MemoryStores(0, 0)
+	srv, err := New(Options{NumShards: 1, Stores: stores, Logger: slog.New(slog.DiscardHandler), WriteHooks: []WriteHook{
+		func(_ context.Context, req WriteCellRequest) (json.RawMessage, error) {
+			if req.ColumnName == "blocked" {
+				return nil, errors.New("column is read-only")
+			}
+			if req.ColumnName == "bloated" {
+				return json.Marshal(strings.Repeat("x", 1<<20))
+			}
+			return nil, nil
+		},
+		func(_ context.Context, req WriteCellRequest) (json.RawMessage, error) {
+			var body map[string]any
+			if err := json.Unmarshal(req.Body, &body); err != nil {
+				return nil, err
+			}
+			body["checked"] = true
+			return json.Marshal(body)
+		},
+	}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	rowKey := uuid.New()
+	write := func(column string) int {
+		body := `{"row_key":"` + rowKey.String() + `","column_name":"` + column + `","ref_key":1,"body":{"name":"alice"}}`
+		resp, err := http.Post(ts.URL+"/v1/cells", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := write("blocked"); code != http.StatusUnprocessableEntity {
+		t.Errorf("rejected write: got %d, want 422", code)
+	}
+	if code := write("bloated"); code != http.StatusUnprocessableEntity {
+		t.Errorf("write transformed over the body limit: got %d, want 422", code)
+	}
+	if code := write("profile"); code != http.StatusCreated {
+		t.Fatalf("write: got %d, want 201", code)
+	}
+	c, err := stores[0].GetCell(context.Background(), CellRef{RowKey: rowKey, ColumnName: "profile", RefKey: 1})
+	if err != nil {
+		t.Fatalf("GetCell: %v", err)
+	}
+	if string(c.Body) != `{"checked":true,"name":"alice"}` {
+		t.Errorf("stored body: got %s, want the transformed body", c.Body)
+	}
+	if head, _ := stores[0].Head(context.Background()); head.AddedID != 1 {
+		t.Errorf("stored cells: got %d, want 1", head.AddedID)
+	}
+}